@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/app"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// newRootCommand returns the ratingsapp command, which serves the API when run
+// without a subcommand.
+func newRootCommand() *cobra.Command {
+	var verbose bool
+
+	root := &cobra.Command{
+		Use:   "ratingsapp",
+		Short: "Ratings App server and administrative tasks",
+		Long: "Serves the Ratings App API, the default, or runs the administrative tasks on its data.\n" +
+			"All the configuration is read from the environment variables, see the package documentation.",
+		Args: cobra.NoArgs,
+		PersistentPreRun: func(*cobra.Command, []string) {
+			configureLogger(verbose)
+		},
+		RunE: runServe,
+
+		// the errors are logged by main
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	root.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	root.CompletionOptions.DisableDefaultCmd = true
+
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "Serve the API (default)",
+			Args:  cobra.NoArgs,
+			RunE:  runServe,
+		},
+		newMigrateCommand(),
+		newCreateAdminCommand(),
+		newRotateJWTSecretCommand(),
+		newSeedCommand(),
+		&cobra.Command{
+			Use:   "rebuild-cards",
+			Short: "Refresh the rating cards of every rating",
+			Args:  cobra.NoArgs,
+			RunE:  runRebuildCards,
+		},
+	)
+
+	return root
+}
+
+// runServe configures the application from the environment and serves the API
+// until a termination signal is received.
+func runServe(*cobra.Command, []string) error {
+	// signal treatment
+	go handleSignals()
+
+	// greet the terminal
+	logrus.WithField("version", VERSION).Info("Ratings App server starting")
+
+	// configures the gateway application
+	err := application.Configure(envConfig())
+	if err != nil {
+		return err
+	}
+
+	// runs the application servers
+	err = application.Run()
+	if err != nil {
+		logrus.WithError(err).Error("Error when running the application")
+	}
+
+	shuttingDown.Lock()
+	logrus.Info("Server will exit now.")
+	return nil
+}
+
+// newMigrateCommand returns the command applying the pending migrations to the
+// database, the default, or reverting or forcing its version with its
+// subcommands.
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply the pending database migrations",
+		Args:  cobra.NoArgs,
+		RunE:  runMigrate,
+	}
+
+	var schema string
+	force := &cobra.Command{
+		Use:   "force <version>",
+		Short: "Set the schema version after a failed migration, without running any",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			version, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return xerrors.Errorf("invalid version %q: %w", args[0], err)
+			}
+
+			return app.ForceMigration(envConfig().DSL, schema, version)
+		},
+	}
+	force.Flags().StringVar(&schema, "schema", "", "schema of the tenant to force, the shared one if empty")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "Apply the pending database migrations (default)",
+			Args:  cobra.NoArgs,
+			RunE:  runMigrate,
+		},
+		&cobra.Command{
+			Use:   "down [steps]",
+			Short: "Revert the last database migrations, one by default",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(_ *cobra.Command, args []string) error {
+				steps := 1
+				if len(args) > 0 {
+					var err error
+					steps, err = strconv.Atoi(args[0])
+					if err != nil {
+						return xerrors.Errorf("invalid number of steps %q: %w", args[0], err)
+					}
+				}
+
+				return app.MigrateDown(envConfig().DSL, steps)
+			},
+		},
+		force,
+	)
+
+	return cmd
+}
+
+// runMigrate applies the pending migrations to the database.
+func runMigrate(*cobra.Command, []string) error {
+	return app.Migrate(envConfig().DSL)
+}
+
+// newCreateAdminCommand returns the command creating an admin user. The password
+// is read from the RATINGSAPP_ADMIN_PASSWORD environment variable or, if not set,
+// from the first line of the standard input, so it is not kept in the shell
+// history.
+func newCreateAdminCommand() *cobra.Command {
+	var email, firstName, lastName string
+
+	cmd := &cobra.Command{
+		Use:   "create-admin --email <email>",
+		Short: "Create a user with the admin role",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			password := os.Getenv("RATINGSAPP_ADMIN_PASSWORD")
+			if password == "" {
+				fmt.Fprint(cmd.ErrOrStderr(), "Password: ")
+				line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if err != nil && line == "" {
+					return xerrors.Errorf("could not read the password: %w", err)
+				}
+				password = strings.TrimRight(line, "\r\n")
+			}
+
+			tasks, err := app.NewTasks(envConfig())
+			if err != nil {
+				return err
+			}
+			defer tasks.Close()
+
+			u, err := tasks.CreateAdmin(email, firstName, lastName, password)
+			if err != nil {
+				return err
+			}
+
+			logrus.WithFields(logrus.Fields{"id": u.ID, "email": u.Email}).Info("Admin user created")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&email, "email", "", "email of the new admin user (required)")
+	cmd.Flags().StringVar(&firstName, "first-name", "admin", "first name of the new admin user")
+	cmd.Flags().StringVar(&lastName, "last-name", "", "last name of the new admin user")
+	cmd.MarkFlagRequired("email")
+
+	return cmd
+}
+
+// newRotateJWTSecretCommand returns the command rotating the JWT secret. It
+// prints the variables configuring the new secret to the standard output, where
+// the current one, read from RATINGSAPP_JWT_SECRET, stays valid for the grace
+// period.
+func newRotateJWTSecretCommand() *cobra.Command {
+	var grace time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "rotate-jwt-secret",
+		Short: "Generate a new JWT secret, keeping the current one valid for a grace period",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			r, err := app.RotateJWTSecret(os.Getenv("RATINGSAPP_JWT_SECRET"), grace)
+			if err != nil {
+				return err
+			}
+
+			// only the variables go to the standard output, so they can
+			// be captured in an environment file
+			expires := r.PreviousExpires.Format(time.RFC3339)
+			fmt.Fprintf(cmd.ErrOrStderr(), "Set these variables on every instance and restart them. "+
+				"Tokens signed with the previous secret stay valid until %s, when RATINGSAPP_JWT_PREVIOUS_SECRET "+
+				"and RATINGSAPP_JWT_PREVIOUS_SECRET_EXPIRES can be removed.\n", expires)
+			fmt.Fprintf(cmd.OutOrStdout(), "RATINGSAPP_JWT_SECRET=%s\n", r.Secret)
+			fmt.Fprintf(cmd.OutOrStdout(), "RATINGSAPP_JWT_PREVIOUS_SECRET=%s\n", r.Previous)
+			fmt.Fprintf(cmd.OutOrStdout(), "RATINGSAPP_JWT_PREVIOUS_SECRET_EXPIRES=%s\n", expires)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&grace, "grace", app.DefaultJWTGracePeriod, "time the current secret stays valid")
+
+	return cmd
+}
+
+// newSeedCommand returns the command filling the database with sample roles,
+// users and ratings.
+func newSeedCommand() *cobra.Command {
+	var users, targets int
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Fill the database with sample data for development",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			tasks, err := app.NewTasks(envConfig())
+			if err != nil {
+				return err
+			}
+			defer tasks.Close()
+
+			err = tasks.Seed(users, targets)
+			if err != nil {
+				return err
+			}
+
+			logrus.WithFields(logrus.Fields{"users": users, "targets": targets}).Info("Database seeded")
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&users, "users", 10, "number of sample users")
+	cmd.Flags().IntVar(&targets, "targets", 20, "number of targets rated by each user")
+
+	return cmd
+}
+
+// runRebuildCards refreshes every rating card from the ratings.
+func runRebuildCards(*cobra.Command, []string) error {
+	tasks, err := app.NewTasks(envConfig())
+	if err != nil {
+		return err
+	}
+	defer tasks.Close()
+
+	err = tasks.RebuildCards()
+	if err != nil {
+		return err
+	}
+
+	logrus.Info("Rating cards rebuilt")
+	return nil
+}
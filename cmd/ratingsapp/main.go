@@ -1,7 +1,6 @@
 package main
 
 import (
-	"flag"
 	"os"
 	"os/signal"
 	"sync"
@@ -23,9 +22,8 @@ var (
 // come, gracefully shutting down the application.
 func handleSignals() {
 	// set up signal catching
-	signals := make(chan os.Signal)
-	signal.Notify(signals, syscall.SIGINT)
-	signal.Notify(signals, syscall.SIGTERM)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
 	// wait for signals to come in
 	<-signals
@@ -53,38 +51,104 @@ func configureLogger(verbose bool) {
 	}
 }
 
-// main sets up the gateway with a auxiliary JSON config file and brings up the
-// servers and services.
-func main() {
-	// get CLI flags
-	verbose := flag.Bool("v", false, "verbose logging")
-	flag.Parse()
-
-	// configure logger
-	configureLogger(*verbose)
-
-	// signal treatment
-	go handleSignals()
-
-	// greet the terminal
-	logrus.WithField("version", VERSION).Info("Ratings App server starting")
-
-	// configures the gateway application
-	err := application.Configure(&app.Config{
+// envConfig reads the application configuration from the environment
+// variables.
+func envConfig() *app.Config {
+	return &app.Config{
 		DSL:       os.Getenv("RATINGSAPP_POSTGRES_DSL"),
 		JWTSecret: os.Getenv("RATINGSAPP_JWT_SECRET"),
 		Port:      os.Getenv("PORT"),
-	})
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to configure application")
+
+		PreviousJWTSecret:        os.Getenv("RATINGSAPP_JWT_PREVIOUS_SECRET"),
+		PreviousJWTSecretExpires: os.Getenv("RATINGSAPP_JWT_PREVIOUS_SECRET_EXPIRES"),
+		AccessTTL:                os.Getenv("RATINGSAPP_ACCESS_TTL"),
+		RefreshTTL:               os.Getenv("RATINGSAPP_REFRESH_TTL"),
+		RememberTTL:              os.Getenv("RATINGSAPP_REMEMBER_TTL"),
+
+		AdminPassword:            os.Getenv("RATINGSAPP_ADMIN_PASSWORD"),
+		MigrateOnStart:           os.Getenv("RATINGSAPP_MIGRATE_ON_START") == "true",
+		WarmUp:                   os.Getenv("RATINGSAPP_WARM_UP") == "true",
+		TrustTokenPermissions:    os.Getenv("RATINGSAPP_TRUST_TOKEN_PERMISSIONS") == "true",
+		TokenPermissionNames:     os.Getenv("RATINGSAPP_TOKEN_PERMISSION_NAMES") == "true",
+		OmitUserRoles:            os.Getenv("RATINGSAPP_OMIT_USER_ROLES") == "true",
+		Cache:                    os.Getenv("RATINGSAPP_CACHE"),
+		RedisURL:                 os.Getenv("RATINGSAPP_REDIS_URL"),
+		SavedQueriesFile:         os.Getenv("RATINGSAPP_SAVED_QUERIES"),
+		VisibilityRulesFile:      os.Getenv("RATINGSAPP_VISIBILITY_RULES"),
+		DefaultRolesFile:         os.Getenv("RATINGSAPP_DEFAULT_ROLES"),
+		OAuthClientsFile:         os.Getenv("RATINGSAPP_OAUTH_CLIENTS"),
+		OIDCIssuer:               os.Getenv("RATINGSAPP_OIDC_ISSUER"),
+		OIDCClientID:             os.Getenv("RATINGSAPP_OIDC_CLIENT_ID"),
+		LDAPURL:                  os.Getenv("RATINGSAPP_LDAP_URL"),
+		LDAPBindDN:               os.Getenv("RATINGSAPP_LDAP_BIND_DN"),
+		LDAPBindPassword:         os.Getenv("RATINGSAPP_LDAP_BIND_PASSWORD"),
+		LDAPBaseDN:               os.Getenv("RATINGSAPP_LDAP_BASE_DN"),
+		LDAPUserAttribute:        os.Getenv("RATINGSAPP_LDAP_USER_ATTRIBUTE"),
+		LDAPGroupRolesFile:       os.Getenv("RATINGSAPP_LDAP_GROUP_ROLES"),
+		LDAPStartTLS:             os.Getenv("RATINGSAPP_LDAP_START_TLS") == "true",
+		LDAPCAFile:               os.Getenv("RATINGSAPP_LDAP_CA_FILE"),
+		InvitationURL:            os.Getenv("RATINGSAPP_INVITATION_URL"),
+		ValidationPlugins:        os.Getenv("RATINGSAPP_VALIDATION_PLUGINS"),
+		WriteQueueDir:            os.Getenv("RATINGSAPP_WRITE_QUEUE_DIR"),
+		AttachmentStorage:        os.Getenv("RATINGSAPP_ATTACHMENT_STORAGE"),
+		ReputationInterval:       os.Getenv("RATINGSAPP_REPUTATION_INTERVAL"),
+		MetricsInterval:          os.Getenv("RATINGSAPP_METRICS_INTERVAL"),
+		TargetsReconcileInterval: os.Getenv("RATINGSAPP_TARGETS_RECONCILE_INTERVAL"),
+		SandboxReset:             os.Getenv("RATINGSAPP_SANDBOX_RESET"),
+		ServeStatic:              os.Getenv("RATINGSAPP_SERVE_STATIC"),
+		ErrorFormat:              os.Getenv("RATINGSAPP_ERROR_FORMAT"),
+		ErrorTypeBase:            os.Getenv("RATINGSAPP_ERROR_TYPE_BASE"),
+		HSTSMaxAge:               os.Getenv("RATINGSAPP_HSTS_MAX_AGE"),
+		ContentSecurityPolicy:    os.Getenv("RATINGSAPP_CONTENT_SECURITY_POLICY"),
+		FrameOptions:             os.Getenv("RATINGSAPP_FRAME_OPTIONS"),
+		ReferrerPolicy:           os.Getenv("RATINGSAPP_REFERRER_POLICY"),
+		ConsentPolicyVersion:     os.Getenv("RATINGSAPP_CONSENT_POLICY_VERSION"),
+		RatingQuota:              os.Getenv("RATINGSAPP_RATING_QUOTA"),
+		NewAccountPeriod:         os.Getenv("RATINGSAPP_NEW_ACCOUNT_PERIOD"),
+		VerificationURL:          os.Getenv("RATINGSAPP_VERIFICATION_URL"),
+		VerificationKey:          os.Getenv("RATINGSAPP_VERIFICATION_KEY"),
+		VerifiedRatingWeight:     os.Getenv("RATINGSAPP_VERIFIED_RATING_WEIGHT"),
+		RetentionDays:            os.Getenv("RATINGSAPP_RETENTION_DAYS"),
+		RetentionMode:            os.Getenv("RATINGSAPP_RETENTION_MODE"),
+		RetentionSchedule:        os.Getenv("RATINGSAPP_RETENTION_SCHEDULE"),
+		AuditRetentionDays:       os.Getenv("RATINGSAPP_AUDIT_RETENTION_DAYS"),
+		OTLPEndpoint:             os.Getenv("RATINGSAPP_OTLP_ENDPOINT"),
+		SMTPURL:                  os.Getenv("RATINGSAPP_SMTP_URL"),
+		SMTPFrom:                 os.Getenv("RATINGSAPP_SMTP_FROM"),
+		NotificationWebhooks:     os.Getenv("RATINGSAPP_NOTIFICATION_WEBHOOKS") == "true",
+		SecurityWebhookURL:       os.Getenv("RATINGSAPP_SECURITY_WEBHOOK"),
+		AlertInterval:            os.Getenv("RATINGSAPP_ALERT_INTERVAL"),
+		Tenancy:                  os.Getenv("RATINGSAPP_TENANCY") == "true",
+		TenantHeader:             os.Getenv("RATINGSAPP_TENANT_HEADER"),
+		MeteringInterval:         os.Getenv("RATINGSAPP_METERING_INTERVAL"),
+		BillingURL:               os.Getenv("RATINGSAPP_BILLING_URL"),
+		BillingKey:               os.Getenv("RATINGSAPP_BILLING_KEY"),
+		DBMaxOpenConns:           os.Getenv("RATINGSAPP_DB_MAX_OPEN_CONNS"),
+		DBMaxIdleConns:           os.Getenv("RATINGSAPP_DB_MAX_IDLE_CONNS"),
+		DBConnMaxLifetime:        os.Getenv("RATINGSAPP_DB_CONN_MAX_LIFETIME"),
+		DBConnectTimeout:         os.Getenv("RATINGSAPP_DB_CONNECT_TIMEOUT"),
+		PrivacyMode:              os.Getenv("RATINGSAPP_PRIVACY_MODE"),
+		TLSCert:                  os.Getenv("RATINGSAPP_TLS_CERT"),
+		TLSKey:                   os.Getenv("RATINGSAPP_TLS_KEY"),
+		AutocertDomains:          os.Getenv("RATINGSAPP_AUTOCERT_DOMAINS"),
+		AutocertCacheDir:         os.Getenv("RATINGSAPP_AUTOCERT_CACHE_DIR"),
+		RedirectPort:             os.Getenv("RATINGSAPP_REDIRECT_PORT"),
+		ReadTimeout:              os.Getenv("RATINGSAPP_READ_TIMEOUT"),
+		ReadHeaderTimeout:        os.Getenv("RATINGSAPP_READ_HEADER_TIMEOUT"),
+		WriteTimeout:             os.Getenv("RATINGSAPP_WRITE_TIMEOUT"),
+		IdleTimeout:              os.Getenv("RATINGSAPP_IDLE_TIMEOUT"),
+		RequestTimeout:           os.Getenv("RATINGSAPP_REQUEST_TIMEOUT"),
+		MaxHeaderBytes:           os.Getenv("RATINGSAPP_MAX_HEADER_BYTES"),
+		DisableKeepAlives:        os.Getenv("RATINGSAPP_DISABLE_KEEP_ALIVES") == "true",
+		H2C:                      os.Getenv("RATINGSAPP_H2C") == "true",
 	}
+}
 
-	// runs the application servers
-	err = application.Run()
+// main runs the command given as first argument, serving the API if none is
+// given.
+func main() {
+	cmd, err := newRootCommand().ExecuteC()
 	if err != nil {
-		logrus.WithError(err).Error("Error when running the application")
+		logrus.WithError(err).Fatal("Failed to run " + cmd.Name())
 	}
-
-	shuttingDown.Lock()
-	logrus.Info("Server will exit now.")
 }
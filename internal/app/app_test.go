@@ -12,7 +12,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/testsupport"
 	"golang.org/x/xerrors"
 )
 
@@ -32,6 +32,9 @@ const (
 
 var app App
 
+// testDSL is the DSL of the database of the application under test.
+var testDSL string
+
 var (
 	testUserNone         testUser
 	testUserAdmin        testUser
@@ -53,19 +56,27 @@ type testUser struct {
 
 func TestMain(m *testing.M) {
 	// setup app
-	dsl := os.Getenv("RATINGSAPP_POSTGRES_TEST_DSL")
-	if dsl == "" {
-		fmt.Println("SKIP: require RATINGSAPP_POSTGRES_TEST_DSL to run")
+	var err error
+	testDSL, err = testsupport.NewDatabase()
+	if xerrors.Is(err, testsupport.ErrNoServer) {
+		fmt.Println("SKIP:", err)
 		os.Exit(0)
+	} else if err != nil {
+		panic(err)
 	}
 
-	// clean up the database
-	cleanUpDatabase(dsl)
+	err = Migrate(testDSL)
+	if err != nil {
+		panic(err)
+	}
 
 	app.Configure(&Config{
-		DSL:       dsl,
-		Port:      testPort,
-		JWTSecret: testJWTSecret,
+		DSL:             testDSL,
+		Port:            testPort,
+		JWTSecret:       testJWTSecret,
+		AdminPassword:   "password",
+		Cache:           "memory",
+		MetricsInterval: "1h",
 	})
 
 	// start running the full application
@@ -83,6 +94,7 @@ func TestMain(m *testing.M) {
 
 	// tear down the application
 	app.Shutdown()
+	testsupport.Teardown()
 	os.Exit(ret)
 }
 
@@ -100,17 +112,6 @@ func isServerUp() {
 	panic(xerrors.Errorf("attempted to connect to test app, did not succeed: %w", err))
 }
 
-func cleanUpDatabase(dsl string) {
-	db, err := gorm.Open("postgres", dsl)
-	if err != nil {
-		panic(xerrors.Errorf("failed to connect to the database: %w", err))
-	}
-
-	db.Exec("DROP SCHEMA public CASCADE")
-	db.Exec("CREATE SCHEMA public")
-	db.Close()
-}
-
 func createUsersAndRoles() {
 	var tok, utok string
 	var rid int64
@@ -0,0 +1,15 @@
+package app
+
+import (
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newAutocertManager creates a certManager that obtains the certificates of
+// domains from Let's Encrypt, and caches them in cacheDir.
+func newAutocertManager(domains []string, cacheDir string) (certManager, error) {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+	}, nil
+}
@@ -0,0 +1,15 @@
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cHandler wraps h so it also serves HTTP/2 without TLS, closing idle
+// HTTP/2 connections after idleTimeout.
+func h2cHandler(h http.Handler, idleTimeout time.Duration) http.Handler {
+	return h2c.NewHandler(h, &http2.Server{IdleTimeout: idleTimeout})
+}
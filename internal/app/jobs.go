@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/scheduler"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultTargetsReconcileInterval is how often the scores of the targets are
+// reconciled if Config.TargetsReconcileInterval is left empty.
+const defaultTargetsReconcileInterval = time.Hour
+
+// defaultRetentionSchedule is when the retention policy is applied if
+// Config.RetentionSchedule is left empty.
+const defaultRetentionSchedule = "@daily"
+
+// webhookRetrySchedule is when the notifications that could not be posted to
+// the webhooks are retried.
+const webhookRetrySchedule = "* * * * *"
+
+// outboxDispatchInterval is how often the events of the ratings left in the
+// outbox are published, besides right after their change.
+const outboxDispatchInterval = 10 * time.Second
+
+// outboxDispatchJob is the name of the job publishing the events of the outbox.
+const outboxDispatchJob = "dispatchOutbox"
+
+// sandboxResetJob is the name of the job erasing the data in the sandbox mode.
+const sandboxResetJob = "resetSandbox"
+
+// newScheduler returns the scheduler of the background jobs maintaining the
+// data of services. Failures are logged, and retried on the next run. The jobs
+// run on an interval also run once the scheduler starts.
+func newScheduler(c *Config, services *models.Services) (*scheduler.Scheduler, error) {
+	s := scheduler.New(func(name string, err error) {
+		logrus.WithError(err).WithField("job", name).Warn("Background job failed")
+	})
+
+	// every adds the job run every interval, and once the scheduler starts
+	every := func(name string, interval time.Duration, job scheduler.Job) error {
+		schedule, err := scheduler.Parse("@every " + interval.String())
+		if err != nil {
+			return err
+		}
+
+		s.Add(name, schedule, job)
+		return s.Wake(name)
+	}
+
+	err := every(outboxDispatchJob, outboxDispatchInterval, func(ctx context.Context) error {
+		return services.DispatchOutbox()
+	})
+	if err != nil {
+		return nil, wrap("invalid outbox dispatch interval", err)
+	}
+	services.OnOutboxAdded(func() { s.Wake(outboxDispatchJob) })
+
+	if c.reputationInterval > 0 {
+		err = every("recomputeReputations", c.reputationInterval, func(ctx context.Context) error {
+			return services.Reputation.Recompute()
+		})
+		if err != nil {
+			return nil, wrap("invalid reputation interval", err)
+		}
+	}
+
+	if c.alertInterval > 0 {
+		err = every("evaluateAlerts", c.alertInterval, func(ctx context.Context) error {
+			return services.Alert.Evaluate()
+		})
+		if err != nil {
+			return nil, wrap("invalid alert interval", err)
+		}
+	}
+
+	if c.meteringInterval > 0 {
+		err = every("meterTenants", c.meteringInterval, func(ctx context.Context) error {
+			return services.Meter()
+		})
+		if err != nil {
+			return nil, wrap("invalid metering interval", err)
+		}
+	}
+
+	reconcile, err := scheduler.Parse("@every " + c.targetsReconcileInterval.String())
+	if err != nil {
+		return nil, wrap("invalid targets reconcile interval", err)
+	}
+	s.Add("reconcileTargets", reconcile, func(ctx context.Context) error {
+		corrected, err := services.ReconcileTargets()
+		if corrected > 0 {
+			logrus.WithField("targets", corrected).Info("Corrected the drift of the scores of the targets")
+		}
+		return err
+	})
+
+	// the tenants may have a policy of their own, so it runs even if the
+	// one of the application keeps the ratings
+	s.Add("applyRetention", c.retentionSchedule, func(ctx context.Context) error {
+		scrubbed, err := services.ApplyRetention(ctx)
+		if scrubbed > 0 {
+			logrus.WithField("ratings", scrubbed).Info("Applied the retention policy to the old ratings")
+		}
+		return err
+	})
+
+	s.Add("pruneAudit", c.retentionSchedule, func(ctx context.Context) error {
+		pruned, err := services.PruneAudit()
+		if pruned > 0 {
+			logrus.WithField("entries", pruned).Info("Pruned the old entries of the audit log")
+		}
+		return err
+	})
+
+	retry, err := scheduler.Parse(webhookRetrySchedule)
+	if err != nil {
+		return nil, wrap("invalid webhook retry schedule", err)
+	}
+	s.Add("retryWebhooks", retry, func(ctx context.Context) error {
+		return services.RetryWebhooks()
+	})
+
+	if c.sandboxReset != nil {
+		s.Add(sandboxResetJob, c.sandboxReset, func(ctx context.Context) error {
+			err := services.ResetSandbox()
+			if err == nil {
+				logrus.Info("Erased the data of the sandbox")
+			}
+			return err
+		})
+	}
+
+	return s, nil
+}
+
+// nextRun returns when the job named name runs next on s, or the zero time if
+// there is no such job.
+func nextRun(s *scheduler.Scheduler, name string) time.Time {
+	for _, st := range s.Stats() {
+		if st.Name == name {
+			return st.NextRun
+		}
+	}
+
+	return time.Time{}
+}
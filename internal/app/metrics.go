@@ -0,0 +1,250 @@
+package app
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"github.com/noelruault/ratingsapp/internal/controllers"
+	"github.com/noelruault/ratingsapp/internal/metrics"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/scheduler"
+	"github.com/sirupsen/logrus"
+)
+
+// metricsTopTargets is the number of targets, with the most active ratings,
+// whose stats are exported as metrics.
+const metricsTopTargets = 10
+
+// metricsCollector aggregates the application metrics periodically, and sets
+// them to be served by a Metrics controller.
+type metricsCollector struct {
+	services *models.Services
+	jobs     *scheduler.Scheduler
+	ctrl     *controllers.Metrics
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// startMetricsCollector collects the metrics right away, and then every
+// interval until it is closed. Failures are logged, and the last metrics
+// collected are served meanwhile.
+func startMetricsCollector(services *models.Services, jobs *scheduler.Scheduler, ctrl *controllers.Metrics, interval time.Duration) *metricsCollector {
+	mc := &metricsCollector{
+		services: services,
+		jobs:     jobs,
+		ctrl:     ctrl,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(mc.done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			err := mc.collect()
+			if err != nil {
+				logrus.WithError(err).Warn("Failed to collect the metrics")
+			}
+
+			select {
+			case <-t.C:
+			case <-mc.closing:
+				return
+			}
+		}
+	}()
+
+	return mc
+}
+
+// Close stops collecting metrics.
+func (mc *metricsCollector) Close() {
+	close(mc.closing)
+	<-mc.done
+}
+
+// collect aggregates the metrics and sets them to the controller.
+func (mc *metricsCollector) collect() error {
+	k, err := mc.services.KPIs(metricsTopTargets)
+	if err != nil {
+		return wrap("could not compute KPIs", err)
+	}
+
+	families := append(kpiFamilies(k), cacheFamilies(mc.services.CacheStats())...)
+	families = append(families, metrics.Family{
+		Name:    "ratingsapp_ratings_rate_limited_total",
+		Help:    "Ratings rejected because their authors exceeded the rating quota.",
+		Type:    metrics.Counter,
+		Samples: []metrics.Sample{{Value: float64(mc.services.RateLimited())}},
+	})
+	families = append(families, poolFamilies(mc.services.Stats())...)
+	families = append(families, jobFamilies(mc.jobs.Stats())...)
+
+	return mc.ctrl.Set(families)
+}
+
+// kpiFamilies converts k to metrics.
+func kpiFamilies(k models.KPIs) []metrics.Family {
+	var (
+		counts   = make([]metrics.Sample, 0, len(k.TopTargets))
+		averages = make([]metrics.Sample, 0, len(k.TopTargets))
+		weighted = make([]metrics.Sample, 0, len(k.TopTargets))
+	)
+
+	for _, s := range k.TopTargets {
+		labels := []metrics.Label{{Name: "target", Value: strconv.FormatInt(s.Target, 10)}}
+
+		counts = append(counts, metrics.Sample{Labels: labels, Value: float64(s.Count)})
+		averages = append(averages, metrics.Sample{Labels: labels, Value: s.Average})
+		weighted = append(weighted, metrics.Sample{Labels: labels, Value: s.WeightedAverage})
+	}
+
+	return []metrics.Family{
+		{
+			Name:    "ratingsapp_ratings_last_minute",
+			Help:    "Ratings submitted or updated during the last minute.",
+			Type:    metrics.Gauge,
+			Samples: []metrics.Sample{{Value: float64(k.RatingsLastMinute)}},
+		},
+		{
+			Name:    "ratingsapp_active_users",
+			Help:    "Users who submitted or updated a rating during the last 24 hours.",
+			Type:    metrics.Gauge,
+			Samples: []metrics.Sample{{Value: float64(k.ActiveUsers)}},
+		},
+		{
+			Name:    "ratingsapp_target_ratings",
+			Help:    "Active ratings of the targets with the most active ratings.",
+			Type:    metrics.Gauge,
+			Samples: counts,
+		},
+		{
+			Name:    "ratingsapp_target_average_score",
+			Help:    "Average score of the active ratings of the targets with the most active ratings.",
+			Type:    metrics.Gauge,
+			Samples: averages,
+		},
+		{
+			Name:    "ratingsapp_target_weighted_average_score",
+			Help:    "Average score, weighted by the reputation of their authors, of the active ratings of the targets with the most active ratings.",
+			Type:    metrics.Gauge,
+			Samples: weighted,
+		},
+	}
+}
+
+// cacheFamilies converts the counters of each cached service, by name, to
+// metrics. No metrics are returned if nothing is cached.
+func cacheFamilies(stats map[string]cache.Stats) []metrics.Family {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	counters := []struct {
+		name, help string
+		value      func(cache.Stats) uint64
+	}{
+		{"ratingsapp_cache_hits", "Values found in the cache.", func(s cache.Stats) uint64 { return s.Hits }},
+		{"ratingsapp_cache_misses", "Values not found in the cache.", func(s cache.Stats) uint64 { return s.Misses }},
+		{"ratingsapp_cache_loads", "Values loaded from their source.", func(s cache.Stats) uint64 { return s.Loads }},
+		{"ratingsapp_cache_errors", "Failed cache operations.", func(s cache.Stats) uint64 { return s.Errors }},
+	}
+
+	families := make([]metrics.Family, 0, len(counters))
+	for _, c := range counters {
+		f := metrics.Family{Name: c.name, Help: c.help, Type: metrics.Counter}
+		for _, name := range names {
+			f.Samples = append(f.Samples, metrics.Sample{
+				Labels: []metrics.Label{{Name: "cache", Value: name}},
+				Value:  float64(c.value(stats[name])),
+			})
+		}
+
+		families = append(families, f)
+	}
+
+	return families
+}
+
+// poolFamilies converts the statistics of the pool of database connections to
+// metrics.
+func poolFamilies(s sql.DBStats) []metrics.Family {
+	gauge := func(name, help string, v float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.Gauge, Samples: []metrics.Sample{{Value: v}}}
+	}
+	counter := func(name, help string, v float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.Counter, Samples: []metrics.Sample{{Value: v}}}
+	}
+
+	return []metrics.Family{
+		gauge("ratingsapp_db_connections_max_open", "Maximum number of open database connections, 0 if unlimited.", float64(s.MaxOpenConnections)),
+		gauge("ratingsapp_db_connections_open", "Open database connections.", float64(s.OpenConnections)),
+		gauge("ratingsapp_db_connections_in_use", "Database connections in use.", float64(s.InUse)),
+		gauge("ratingsapp_db_connections_idle", "Idle database connections.", float64(s.Idle)),
+		counter("ratingsapp_db_connection_waits_total", "Times a query waited for a database connection.", float64(s.WaitCount)),
+		counter("ratingsapp_db_connection_wait_seconds_total", "Time spent waiting for database connections.", s.WaitDuration.Seconds()),
+		counter("ratingsapp_db_connections_max_idle_closed_total", "Database connections closed because there were too many idle.", float64(s.MaxIdleClosed)),
+		counter("ratingsapp_db_connections_max_lifetime_closed_total", "Database connections closed because they reached their maximum lifetime.", float64(s.MaxLifetimeClosed)),
+	}
+}
+
+// jobFamilies converts the stats of the background jobs to metrics.
+func jobFamilies(stats []scheduler.Stats) []metrics.Family {
+	var (
+		runs      = make([]metrics.Sample, 0, len(stats))
+		failures  = make([]metrics.Sample, 0, len(stats))
+		durations = make([]metrics.Sample, 0, len(stats))
+		successes = make([]metrics.Sample, 0, len(stats))
+	)
+
+	for _, s := range stats {
+		labels := []metrics.Label{{Name: "job", Value: s.Name}}
+
+		runs = append(runs, metrics.Sample{Labels: labels, Value: float64(s.Runs)})
+		failures = append(failures, metrics.Sample{Labels: labels, Value: float64(s.Failures)})
+		durations = append(durations, metrics.Sample{Labels: labels, Value: s.LastDuration.Seconds()})
+		if s.LastSuccess != nil {
+			successes = append(successes, metrics.Sample{Labels: labels, Value: float64(s.LastSuccess.Unix())})
+		}
+	}
+
+	return []metrics.Family{
+		{
+			Name:    "ratingsapp_job_runs",
+			Help:    "Runs of the background jobs.",
+			Type:    metrics.Counter,
+			Samples: runs,
+		},
+		{
+			Name:    "ratingsapp_job_failures",
+			Help:    "Runs of the background jobs that failed.",
+			Type:    metrics.Counter,
+			Samples: failures,
+		},
+		{
+			Name:    "ratingsapp_job_last_duration_seconds",
+			Help:    "Duration of the last run of the background jobs.",
+			Type:    metrics.Gauge,
+			Samples: durations,
+		},
+		{
+			Name:    "ratingsapp_job_last_success_timestamp_seconds",
+			Help:    "Time the last successful run of the background jobs ended.",
+			Type:    metrics.Gauge,
+			Samples: successes,
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"plugin"
+	"strings"
+
+	"github.com/noelruault/ratingsapp/pkg/rules"
+)
+
+// rulesSymbol is the function the validation plugins export to add their rules.
+const rulesSymbol = "RegisterRules"
+
+// loadRules returns the custom validation rules compiled in, see rules.Default,
+// along with those of the Go plugins at the comma separated paths. Each plugin
+// must export a RegisterRules function taking a *rules.Rules.
+//
+// Plugins can only be opened by a server built with cgo, and must be built with
+// the same Go version, build flags and versions of the packages they share with
+// the server, like pkg/rules.
+func loadRules(paths string) (*rules.Rules, error) {
+	if paths == "" {
+		return rules.Default, nil
+	}
+
+	validation := rules.Default.Copy()
+	for _, path := range strings.Split(paths, ",") {
+		p, err := plugin.Open(strings.TrimSpace(path))
+		if err != nil {
+			return nil, wrap("could not open validation plugin "+path, err)
+		}
+
+		sym, err := p.Lookup(rulesSymbol)
+		if err != nil {
+			return nil, wrap("invalid validation plugin "+path, err)
+		}
+
+		register, ok := sym.(func(*rules.Rules))
+		if !ok {
+			return nil, wrapi("invalid validation plugin "+path+", "+rulesSymbol+" must be a func(*rules.Rules)", nil)
+		}
+
+		register(validation)
+	}
+
+	return validation, nil
+}
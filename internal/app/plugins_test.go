@@ -0,0 +1,53 @@
+package app
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/pkg/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRules(t *testing.T) {
+	validation, err := loadRules("")
+	require.NoError(t, err)
+	assert.Equal(t, rules.Default, validation, "must use the rules compiled in")
+
+	_, err = loadRules("testdata/missing.so")
+	assert.Error(t, err)
+
+	t.Run("plugin", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("builds a plugin")
+		}
+		switch runtime.GOOS {
+		case "linux", "darwin", "freebsd":
+		default:
+			t.Skip("plugins are not supported on " + runtime.GOOS)
+		}
+
+		cgo, err := exec.Command("go", "env", "CGO_ENABLED").Output()
+		if err != nil || strings.TrimSpace(string(cgo)) != "1" {
+			t.Skip("plugins require cgo")
+		}
+
+		// built like the test binary, so they share the same packages
+		path := filepath.Join(t.TempDir(), "rules.so")
+		out, err := exec.Command("go", "build", "-buildmode=plugin", "-o", path, "./testdata/plugin").CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		validation, err := loadRules(" " + path)
+		require.NoError(t, err)
+		require.Len(t, validation.Ratings(), 1)
+		assert.Empty(t, rules.Default.Ratings(), "must not change the rules compiled in")
+
+		rule := validation.Ratings()[0]
+		assert.Equal(t, "comment", rule.Field)
+		assert.Equal(t, rules.Error("comment_required"), rule.Check(&rules.Rating{Score: 1}))
+		assert.NoError(t, rule.Check(&rules.Rating{Score: 1, Comment: "meh"}))
+	})
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// logSecurityEvents logs the security events as warnings, with their details as
+// fields, so the log aggregators can alert on them.
+type logSecurityEvents struct{}
+
+// Record logs e.
+func (logSecurityEvents) Record(e models.SecurityEvent) {
+	fields := logrus.Fields{"security_event": e.Type}
+	if e.UserID != 0 {
+		fields["user"] = e.UserID
+	}
+	if e.Email != "" {
+		fields["email"] = e.Email
+	}
+	if e.SessionID != "" {
+		fields["session"] = e.SessionID
+	}
+	if e.IP != "" {
+		fields["ip"] = e.IP
+	}
+	if e.UserAgent != "" {
+		fields["user_agent"] = e.UserAgent
+	}
+	if e.Tenant != "" {
+		fields["tenant_schema"] = e.Tenant
+	}
+
+	logrus.WithFields(fields).Warn("Security event")
+}
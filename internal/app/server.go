@@ -0,0 +1,129 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/middleware"
+)
+
+// Default timeouts of the HTTP server.
+const (
+	defaultReadTimeout    = 10 * time.Second
+	defaultWriteTimeout   = 10 * time.Second
+	defaultRequestTimeout = 5 * time.Second
+)
+
+// serverConfig tunes the connections of the HTTP server, as set by the server
+// fields of Config. Zero values keep the defaults of http.Server.
+type serverConfig struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	disableKeepAlives bool
+
+	// requestTimeout is the deadline of the API requests, and the
+	// statement timeout of the database sessions serving them, see
+	// middleware.Deadline.
+	requestTimeout time.Duration
+
+	// h2c serves HTTP/2 without TLS.
+	h2c bool
+}
+
+// apply configures srv as set by sc.
+func (sc serverConfig) apply(srv *http.Server) {
+	srv.ReadTimeout = sc.readTimeout
+	srv.ReadHeaderTimeout = sc.readHeaderTimeout
+	srv.WriteTimeout = sc.writeTimeout
+	srv.IdleTimeout = sc.idleTimeout
+	srv.MaxHeaderBytes = sc.maxHeaderBytes
+	srv.SetKeepAlivesEnabled(!sc.disableKeepAlives)
+
+	if sc.h2c {
+		srv.Handler = h2cHandler(srv.Handler, sc.idleTimeout)
+	}
+}
+
+// checkServer verifies the server tuning options, and sets c.server.
+func (c *Config) checkServer() error {
+	c.server = serverConfig{
+		readTimeout:       defaultReadTimeout,
+		writeTimeout:      defaultWriteTimeout,
+		requestTimeout:    defaultRequestTimeout,
+		disableKeepAlives: c.DisableKeepAlives,
+		h2c:               c.H2C,
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"read timeout", c.ReadTimeout, &c.server.readTimeout},
+		{"read header timeout", c.ReadHeaderTimeout, &c.server.readHeaderTimeout},
+		{"write timeout", c.WriteTimeout, &c.server.writeTimeout},
+		{"idle timeout", c.IdleTimeout, &c.server.idleTimeout},
+		{"request timeout", c.RequestTimeout, &c.server.requestTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v < 0 {
+			return wrapi("invalid "+d.name+" "+d.value, err)
+		}
+		*d.dst = v
+	}
+
+	if c.MaxHeaderBytes != "" {
+		v, err := strconv.Atoi(c.MaxHeaderBytes)
+		if err != nil || v <= 0 {
+			return wrapi("invalid max header bytes "+c.MaxHeaderBytes, err)
+		}
+		c.server.maxHeaderBytes = v
+	}
+
+	if c.H2C && (c.TLSCert != "" || c.AutocertDomains != "") {
+		// HTTP/2 is negotiated over TLS already
+		return wrapi("h2c cannot be used with TLS", nil)
+	}
+
+	return nil
+}
+
+// checkHeaders verifies the values of the security headers, and sets c.headers.
+func (c *Config) checkHeaders() error {
+	c.headers = middleware.DefaultSecurityHeaders
+
+	if c.HSTSMaxAge != "" {
+		v, err := time.ParseDuration(c.HSTSMaxAge)
+		if err != nil || v < 0 {
+			return wrapi("invalid hsts max age "+c.HSTSMaxAge, err)
+		}
+		c.headers.HSTSMaxAge = v
+	}
+
+	if c.FrameOptions != "" {
+		fo := strings.ToLower(c.FrameOptions)
+		if fo != "deny" && fo != "sameorigin" {
+			return wrapi("invalid frame options "+c.FrameOptions, nil)
+		}
+		c.headers.FrameOptions = fo
+	}
+
+	if c.ContentSecurityPolicy != "" {
+		c.headers.ContentSecurityPolicy = c.ContentSecurityPolicy
+	}
+	if c.ReferrerPolicy != "" {
+		c.headers.ReferrerPolicy = c.ReferrerPolicy
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestConfig_checkServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      Config
+		valid  bool
+		server serverConfig
+	}{
+		{
+			"defaults",
+			Config{},
+			true,
+			serverConfig{readTimeout: defaultReadTimeout, writeTimeout: defaultWriteTimeout, requestTimeout: defaultRequestTimeout},
+		},
+		{
+			"tuned",
+			Config{ReadTimeout: "5s", ReadHeaderTimeout: "2s", WriteTimeout: "1m", IdleTimeout: "2m", RequestTimeout: "0", MaxHeaderBytes: "8192", DisableKeepAlives: true},
+			true,
+			serverConfig{readTimeout: 5 * time.Second, readHeaderTimeout: 2 * time.Second, writeTimeout: time.Minute, idleTimeout: 2 * time.Minute, maxHeaderBytes: 8192, disableKeepAlives: true},
+		},
+		{"invalid timeout", Config{IdleTimeout: "soon"}, false, serverConfig{}},
+		{"negative timeout", Config{ReadTimeout: "-1s"}, false, serverConfig{}},
+		{"negative request timeout", Config{RequestTimeout: "-5s"}, false, serverConfig{}},
+		{"invalid max header bytes", Config{MaxHeaderBytes: "1kb"}, false, serverConfig{}},
+		{"h2c with TLS", Config{H2C: true, TLSCert: "cert.pem", TLSKey: "key.pem"}, false, serverConfig{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.c.checkServer()
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.server, tt.c.server)
+		})
+	}
+
+	c := Config{H2C: true}
+	assert.NoError(t, c.checkServer())
+
+	c = Config{H2C: true, TLSCert: "cert.pem", TLSKey: "key.pem"}
+	assert.Error(t, c.checkServer(), "must not allow h2c with TLS")
+}
+
+func TestServerConfig_apply_h2c(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	srv := httptest.NewUnstartedServer(h)
+	serverConfig{h2c: true}.apply(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", string(body))
+}
+
+func TestServerConfig_apply(t *testing.T) {
+	h := http.NotFoundHandler()
+	srv := http.Server{Handler: h}
+
+	serverConfig{readTimeout: time.Second, idleTimeout: time.Minute, maxHeaderBytes: 4096}.apply(&srv)
+
+	assert.Equal(t, time.Second, srv.ReadTimeout)
+	assert.Equal(t, time.Duration(0), srv.WriteTimeout)
+	assert.Equal(t, time.Minute, srv.IdleTimeout)
+	assert.Equal(t, 4096, srv.MaxHeaderBytes)
+}
+
+func TestConfig_checkHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       Config
+		valid   bool
+		headers middleware.SecurityHeaders
+	}{
+		{"defaults", Config{}, true, middleware.DefaultSecurityHeaders},
+		{
+			"configured",
+			Config{HSTSMaxAge: "720h", ContentSecurityPolicy: "default-src 'self'", FrameOptions: "SAMEORIGIN", ReferrerPolicy: "same-origin"},
+			true,
+			middleware.SecurityHeaders{HSTSMaxAge: 720 * time.Hour, ContentSecurityPolicy: "default-src 'self'", FrameOptions: "sameorigin", ReferrerPolicy: "same-origin"},
+		},
+		{
+			"noHSTS",
+			Config{HSTSMaxAge: "0"},
+			true,
+			middleware.SecurityHeaders{ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'", FrameOptions: "deny", ReferrerPolicy: "no-referrer"},
+		},
+		{"invalid max age", Config{HSTSMaxAge: "a year"}, false, middleware.SecurityHeaders{}},
+		{"negative max age", Config{HSTSMaxAge: "-1h"}, false, middleware.SecurityHeaders{}},
+		{"invalid frame options", Config{FrameOptions: "allow-from https://example.com"}, false, middleware.SecurityHeaders{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.c.checkHeaders()
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.headers, tt.c.headers)
+		})
+	}
+}
+
+func TestConfig_checkStatic(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<!DOCTYPE html>"), 0o644))
+
+	for _, v := range []string{"", "false"} {
+		c := Config{ServeStatic: v}
+		require.NoError(t, c.checkStatic())
+		assert.Nil(t, c.static, "must only serve the API with %q", v)
+	}
+
+	c := Config{ServeStatic: "true"}
+	require.NoError(t, c.checkStatic())
+	_, err := fs.Stat(c.static, "index.html")
+	assert.NoError(t, err, "must serve the embedded frontend")
+
+	c = Config{ServeStatic: dir}
+	require.NoError(t, c.checkStatic())
+	data, err := fs.ReadFile(c.static, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "<!DOCTYPE html>", string(data))
+
+	c = Config{ServeStatic: t.TempDir()}
+	assert.Error(t, c.checkStatic(), "must require an index.html page")
+}
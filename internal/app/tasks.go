@@ -0,0 +1,183 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// jwtSecretSize is the number of random bytes of the secrets generated by
+// NewJWTSecret.
+const jwtSecretSize = 48
+
+// DefaultJWTGracePeriod is the time the secrets replaced by RotateJWTSecret
+// stay valid by default, as long as the refresh tokens they signed with the
+// default RefreshTTL.
+const DefaultJWTGracePeriod = models.DefaultRefreshTokenTTL
+
+// seedPassword is the password of the users created by Tasks.Seed.
+const seedPassword = "password"
+
+// Tasks runs administrative tasks on the application data, without serving the
+// API. It is used by the ratingsapp subcommands.
+type Tasks struct {
+	services *models.Services
+}
+
+// NewTasks connects to the services configured by c. The database must be
+// migrated.
+func NewTasks(c *Config) (*Tasks, error) {
+	err := c.check()
+	if err != nil {
+		return nil, wrap("NewTasks", err)
+	}
+
+	services, err := c.newServices()
+	if err != nil {
+		return nil, wrap("NewTasks", err)
+	}
+
+	return &Tasks{services: services}, nil
+}
+
+// Close releases the resources used by t.
+func (t *Tasks) Close() error {
+	return t.services.Close()
+}
+
+// CreateAdmin creates an active user with the admin role. The usual user
+// validation applies, so a models.ValidationError is returned if the email is
+// already taken or the password is too short.
+func (t *Tasks) CreateAdmin(email, firstName, lastName, password string) (models.User, error) {
+	u := models.NewUser()
+	u.Email = email
+	u.FirstName = firstName
+	u.LastName = lastName
+	u.Password = password
+	u.RoleID = 1
+
+	err := t.services.User.Create(&u)
+	if err != nil {
+		return models.User{}, wrap("could not create admin user", err)
+	}
+
+	u.Password = ""
+	return u, nil
+}
+
+// Seed fills the database with sample data for development: a "reviewer" role,
+// users reviewers with the role and a rating from each of them to every target
+// from 1 to targets. The reviewers can log in with their email, like
+// reviewer1@example.com, and the password "password".
+//
+// Seed fails if the reviewer role already exists.
+func (t *Tasks) Seed(users, targets int) error {
+	role := models.NewRole()
+	role.Label = "reviewer"
+	role.Permissions = models.PermissionReadRatings | models.PermissionWriteOwnRatings
+
+	err := t.services.Role.Create(&role)
+	if err != nil {
+		return wrap("could not create the reviewer role", err)
+	}
+
+	for i := 1; i <= users; i++ {
+		u := models.NewUser()
+		u.Email = "reviewer" + strconv.Itoa(i) + "@example.com"
+		u.FirstName = "Reviewer"
+		u.LastName = strconv.Itoa(i)
+		u.Password = seedPassword
+		u.RoleID = role.ID
+
+		err = t.services.User.Create(&u)
+		if err != nil {
+			return wrap("could not create user "+u.Email, err)
+		}
+
+		for target := 1; target <= targets; target++ {
+			score, err := rand.Int(rand.Reader, big.NewInt(5))
+			if err != nil {
+				return wrap("could not generate a score", err)
+			}
+
+			r := models.NewRating()
+			r.Target = int64(target)
+			r.Score = int(score.Int64()) + 1
+			r.Anonymous = i%2 == 0
+			r.Comment = "Sample rating from " + u.Email
+			r.User = &u
+
+			err = t.services.Rating.Create(&r)
+			if err != nil {
+				return wrap("could not create a rating of target "+strconv.Itoa(target), err)
+			}
+		}
+
+		logrus.WithField("email", u.Email).Debug("Seeded user")
+	}
+
+	return nil
+}
+
+// RebuildCards refreshes the rating cards of every rating, fixing those that
+// missed the changes of their ratings.
+func (t *Tasks) RebuildCards() error {
+	err := t.services.Card.Rebuild()
+	if err != nil {
+		return wrap("could not rebuild the rating cards", err)
+	}
+
+	return nil
+}
+
+// NewJWTSecret generates a random secret to be used as the JWT secret. Tokens
+// signed with the previous secret are no longer valid once the application
+// uses the new one, so every user has to log in again, unless it is rotated
+// with RotateJWTSecret.
+func NewJWTSecret() (string, error) {
+	b := make([]byte, jwtSecretSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", wrap("could not generate JWT secret", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// JWTRotation is a new JWT secret replacing the Previous one, which stays valid
+// until PreviousExpires. See Config.PreviousJWTSecret.
+type JWTRotation struct {
+	Secret          string
+	Previous        string
+	PreviousExpires time.Time
+}
+
+// RotateJWTSecret generates a new JWT secret replacing current, which keeps
+// verifying the tokens it signed during grace, so the users are not logged out.
+// The tokens of the users of the tenants are signed with keys derived from both
+// secrets, and are rotated along. Hashing the client data with
+// RATINGSAPP_PRIVACY_MODE=hash is keyed by the new secret right away.
+func RotateJWTSecret(current string, grace time.Duration) (JWTRotation, error) {
+	if current == "" {
+		return JWTRotation{}, wrapi("no jwt secret to rotate", nil)
+	}
+	if grace <= 0 {
+		return JWTRotation{}, wrapi("invalid grace period "+grace.String(), nil)
+	}
+
+	secret, err := NewJWTSecret()
+	if err != nil {
+		return JWTRotation{}, err
+	}
+
+	return JWTRotation{
+		Secret:          secret,
+		Previous:        current,
+		PreviousExpires: time.Now().UTC().Add(grace).Truncate(time.Second),
+	}, nil
+}
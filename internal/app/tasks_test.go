@@ -0,0 +1,91 @@
+package app
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTasks(t *testing.T) {
+	tasks, err := NewTasks(&Config{
+		DSL:       testDSL,
+		JWTSecret: testJWTSecret,
+	})
+	require.NoError(t, err)
+	defer tasks.Close()
+
+	t.Run("createAdmin", func(t *testing.T) {
+		u, err := tasks.CreateAdmin("ops@test.com", "ops", "", "very long password")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), u.RoleID)
+		assert.Empty(t, u.Password)
+
+		_, err = tasks.services.User.Authenticate("ops@test.com", "very long password")
+		assert.NoError(t, err, "the admin must be able to log in")
+
+		_, err = tasks.CreateAdmin("ops@test.com", "ops", "", "very long password")
+		assert.Error(t, err, "must not create users with the same email")
+	})
+
+	t.Run("seed", func(t *testing.T) {
+		require.NoError(t, tasks.Seed(2, 3))
+
+		u, err := tasks.services.User.ByEmail("reviewer2@example.com")
+		require.NoError(t, err)
+
+		ratings, err := tasks.services.Rating.ByTarget(3)
+		require.NoError(t, err)
+		assert.Len(t, ratings, 2)
+		for _, r := range ratings {
+			assert.True(t, r.Score >= 1 && r.Score <= 5)
+		}
+
+		role, err := tasks.services.Role.ByID(u.RoleID)
+		require.NoError(t, err)
+		assert.Equal(t, models.PermissionReadRatings|models.PermissionWriteRatings, role.Permissions)
+
+		assert.Error(t, tasks.Seed(1, 1), "must not seed twice")
+	})
+}
+
+func TestNewJWTSecret(t *testing.T) {
+	s1, err := NewJWTSecret()
+	require.NoError(t, err)
+	s2, err := NewJWTSecret()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, s1, s2)
+
+	b, err := base64.RawURLEncoding.DecodeString(s1)
+	require.NoError(t, err)
+	assert.Len(t, b, jwtSecretSize)
+}
+
+func TestRotateJWTSecret(t *testing.T) {
+	r, err := RotateJWTSecret(testJWTSecret, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, testJWTSecret, r.Previous)
+	assert.NotEqual(t, testJWTSecret, r.Secret)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), r.PreviousExpires, 2*time.Second)
+
+	c := Config{
+		DSL:                      testDSL,
+		JWTSecret:                r.Secret,
+		PreviousJWTSecret:        r.Previous,
+		PreviousJWTSecretExpires: r.PreviousExpires.Format(time.RFC3339),
+	}
+	require.NoError(t, c.check(), "the rotation must be a valid configuration")
+	assert.True(t, r.PreviousExpires.Equal(c.previousJWTSecretExpiry))
+
+	_, err = RotateJWTSecret("", time.Hour)
+	assert.Error(t, err, "must not rotate a missing secret")
+	_, err = RotateJWTSecret(testJWTSecret, 0)
+	assert.Error(t, err, "must not rotate without a grace period")
+
+	c = Config{DSL: testDSL, JWTSecret: r.Secret, PreviousJWTSecret: r.Previous}
+	assert.Error(t, c.check(), "must require the expiry of the previous secret")
+}
@@ -0,0 +1,308 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/controllers"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// tenantControllersKey is the key of the controllers of the provisioned
+// tenant set on the contexts of its requests.
+const tenantControllersKey = "tenantControllers"
+
+// errRequestFailed rolls back the transaction of the requests to a provisioned
+// tenant that failed.
+var errRequestFailed = xerrors.New("app: request failed")
+
+// tenantControllers are the controllers and middleware serving the data of the
+// tenants, which is either the data shared by the application, or the data in
+// the schema of a provisioned tenant.
+type tenantControllers struct {
+	authenticated gin.HandlerFunc
+	consented     gin.HandlerFunc
+
+	users       *controllers.Users
+	roles       *controllers.Roles
+	access      *controllers.Access
+	ratings     *controllers.Ratings
+	sync        *controllers.Sync
+	reputation  *controllers.Reputation
+	consent     *controllers.Consent
+	invitations *controllers.Invitations
+	audit       *controllers.Audit
+	retention   *controllers.Retention
+	campaigns   *controllers.Campaigns
+	categories  *controllers.TargetCategories
+	replies     *controllers.Replies
+	attachments *controllers.Attachments
+	graphql     *controllers.GraphQL
+}
+
+// newTenantControllers returns the controllers serving the data of svc. The
+// ratings are created through rq, if not nil.
+func newTenantControllers(svc *models.Services, rq models.RatingQueue) *tenantControllers {
+	return &tenantControllers{
+		authenticated: middleware.Authenticated(svc.User),
+		consented:     middleware.Consented(svc.Consent),
+
+		users:       controllers.NewUsers(svc.User).WithAuthCodes(svc.AuthCode).WithIdentities(svc.Identity).WithAudit(svc.Audit),
+		roles:       controllers.NewRoles(svc.Role).WithUsers(svc.User),
+		access:      controllers.NewAccess(svc.User, svc.Role),
+		ratings:     controllers.NewRatings(svc.Rating, rq).WithTransactions(transactor(svc)).WithReplies(svc.Reply).WithAttachments(svc.Attachment).WithUsers(svc.User),
+		sync:        controllers.NewSync(svc.Sync),
+		reputation:  controllers.NewReputation(svc.Reputation, svc.Rating),
+		consent:     controllers.NewConsent(svc.Consent),
+		invitations: controllers.NewInvitations(svc.Invitation),
+		audit:       controllers.NewAudit(svc.Audit),
+		retention:   controllers.NewRetention(svc.Retention),
+		campaigns:   controllers.NewCampaigns(svc.Campaign, svc.Rating),
+		categories:  controllers.NewTargetCategories(svc.Category),
+		replies:     controllers.NewReplies(svc.Reply, svc.Rating),
+		attachments: controllers.NewAttachments(svc.Attachment, svc.Rating),
+		graphql:     controllers.NewGraphQL(svc.User, svc.Role, svc.Rating),
+	}
+}
+
+// transactor returns the controllers.Transactor running the transactions of the
+// controllers on svc. See models.Services.WithTransaction.
+func transactor(svc *models.Services) controllers.Transactor {
+	return func(f func(us models.UserService, rs models.RatingService) error) error {
+		return svc.WithTransaction(func(tx *models.Services) error {
+			return f(tx.User, tx.Rating)
+		})
+	}
+}
+
+// inTenant returns a middleware running the rest of the requests to the
+// provisioned tenants in a request transaction on their schema, see
+// serveInRequest. It must run after the middleware.Tenant middleware, and
+// before the ones authenticating the users, as the users of the tenants are in
+// their schema.
+//
+// The write-behind queue is not used for the ratings of the provisioned
+// tenants, as it persists them on the shared data.
+func inTenant(svc *models.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t := models.TenantFrom(c.Request.Context())
+		if t == nil || t.Schema == "" {
+			c.Next()
+			return
+		}
+
+		serveInRequest(c, svc, t, nil, func(tc *tenantControllers) {
+			c.Set(tenantControllersKey, tc)
+			c.Next()
+		})
+	}
+}
+
+// serveInRequest calls next with the controllers of the services of a request,
+// see models.Services.InRequest, in a transaction on the schema of t if it is a
+// provisioned tenant. The transactions of the requests to the provisioned
+// tenants are rolled back if the request fails, while the other requests run
+// their statements on their own, and keep the changes made before the failure.
+// The ratings are created through rq, if not nil.
+func serveInRequest(c *gin.Context, svc *models.Services, t *models.Tenant, rq models.RatingQueue, next func(*tenantControllers)) {
+	provisioned := t != nil && t.Schema != ""
+
+	err := svc.InRequest(c.Request.Context(), t, func(rs *models.Services) error {
+		next(newTenantControllers(rs, rq))
+
+		if provisioned && c.Writer.Status() >= http.StatusBadRequest {
+			return errRequestFailed
+		}
+		return nil
+	})
+	if err == nil || xerrors.Is(err, errRequestFailed) {
+		return
+	}
+
+	if c.Writer.Written() {
+		// the commit of the transaction of the tenant failed once the
+		// response was sent
+		logrus.WithError(err).WithField("tenant_id", t.ID).Error("Failed to commit the request to the tenant")
+		return
+	}
+
+	var ev views.Error
+	ev.JSON(c, err)
+}
+
+// controllers returns the controllers serving the data of the tenant of the
+// request c, with the services of the application if it is not a provisioned
+// tenant.
+func (ws *webServer) controllers(c *gin.Context) *tenantControllers {
+	if tc, ok := c.Get(tenantControllersKey); ok {
+		return tc.(*tenantControllers)
+	}
+
+	return ws.shared
+}
+
+// inRequest returns a handler running h with the controllers of the tenant of
+// the request. The requests to the provisioned tenants already run in the
+// transaction of their tenant, see inTenant, and the other ones run h with the
+// services of the request, see serveInRequest, so the statements of the
+// handlers are limited by the statement timeout and traced as children of the
+// request.
+func (ws *webServer) inRequest(h func(*tenantControllers, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tc, ok := c.Get(tenantControllersKey); ok {
+			h(tc.(*tenantControllers), c)
+			return
+		}
+
+		serveInRequest(c, ws.svc, models.TenantFrom(c.Request.Context()), ws.svc.RatingQueue, func(tc *tenantControllers) {
+			h(tc, c)
+		})
+	}
+}
+
+// authenticated is the middleware.Authenticated middleware of the tenant of the
+// request.
+func (ws *webServer) authenticated(c *gin.Context) {
+	ws.controllers(c).authenticated(c)
+}
+
+// consented is the middleware.Consented middleware of the tenant of the
+// request.
+func (ws *webServer) consented(c *gin.Context) {
+	ws.controllers(c).consented(c)
+}
+
+// sharedOnly decorates the handlers of the features only available on the data
+// shared by the application, if tenancy is enabled. See
+// middleware.NoTenantSchema.
+func (ws *webServer) sharedOnly(h gin.HandlerFunc) gin.HandlerFunc {
+	if ws.mwTenant == nil {
+		return h
+	}
+
+	return middleware.NoTenantSchema(h)
+}
+
+// users returns a handler running h with the Users controller of the tenant of
+// the request.
+func (ws *webServer) users(h func(*controllers.Users, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.users, c)
+	})
+}
+
+// roles returns a handler running h with the Roles controller of the tenant of
+// the request.
+func (ws *webServer) roles(h func(*controllers.Roles, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.roles, c)
+	})
+}
+
+// access returns a handler running h with the Access controller of the tenant
+// of the request.
+func (ws *webServer) access(h func(*controllers.Access, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.access, c)
+	})
+}
+
+// ratings returns a handler running h with the Ratings controller of the tenant
+// of the request.
+func (ws *webServer) ratings(h func(*controllers.Ratings, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.ratings, c)
+	})
+}
+
+// sync returns a handler running h with the Sync controller of the tenant of
+// the request.
+func (ws *webServer) sync(h func(*controllers.Sync, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.sync, c)
+	})
+}
+
+// reputation returns a handler running h with the Reputation controller of the
+// tenant of the request.
+func (ws *webServer) reputation(h func(*controllers.Reputation, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.reputation, c)
+	})
+}
+
+// invitations returns a handler running h with the Invitations controller of the
+// tenant of the request.
+func (ws *webServer) invitations(h func(*controllers.Invitations, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.invitations, c)
+	})
+}
+
+// audit returns a handler running h with the Audit controller of the tenant of
+// the request.
+func (ws *webServer) audit(h func(*controllers.Audit, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.audit, c)
+	})
+}
+
+// retention returns a handler running h with the Retention controller of the
+// tenant of the request.
+func (ws *webServer) retention(h func(*controllers.Retention, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.retention, c)
+	})
+}
+
+// consent returns a handler running h with the Consent controller of the tenant
+// of the request.
+func (ws *webServer) consent(h func(*controllers.Consent, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.consent, c)
+	})
+}
+
+// campaigns returns a handler running h with the Campaigns controller of the
+// tenant of the request.
+func (ws *webServer) campaigns(h func(*controllers.Campaigns, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.campaigns, c)
+	})
+}
+
+// categories returns a handler running h with the TargetCategories controller of
+// the tenant of the request.
+func (ws *webServer) categories(h func(*controllers.TargetCategories, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.categories, c)
+	})
+}
+
+// replies returns a handler running h with the Replies controller of the tenant
+// of the request.
+func (ws *webServer) replies(h func(*controllers.Replies, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.replies, c)
+	})
+}
+
+// attachments returns a handler running h with the Attachments controller of the
+// tenant of the request.
+func (ws *webServer) attachments(h func(*controllers.Attachments, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.attachments, c)
+	})
+}
+
+// graphql returns a handler running h with the GraphQL controller of the tenant
+// of the request.
+func (ws *webServer) graphql(h func(*controllers.GraphQL, *gin.Context)) gin.HandlerFunc {
+	return ws.inRequest(func(tc *tenantControllers, c *gin.Context) {
+		h(tc.graphql, c)
+	})
+}
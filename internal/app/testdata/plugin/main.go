@@ -0,0 +1,15 @@
+// Package main is a validation plugin requiring a comment on the low scores,
+// loaded by the tests of loadRules.
+package main
+
+import "github.com/noelruault/ratingsapp/pkg/rules"
+
+// RegisterRules adds the rules of the plugin to r.
+func RegisterRules(r *rules.Rules) {
+	r.AddRating("comment", func(rt *rules.Rating) error {
+		if rt.Score <= 2 && rt.Comment == "" {
+			return rules.Error("comment_required")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// certManager obtains and renews TLS certificates automatically, like
+// autocert.Manager does with ACME certificate authorities.
+type certManager interface {
+	// TLSConfig returns the configuration of the TLS listener.
+	TLSConfig() *tls.Config
+
+	// HTTPHandler serves the HTTP challenges of the certificate
+	// authority, and calls fallback with any other request.
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
+// tlsConfig is how the web server serves TLS, as set by the TLS fields of
+// Config.
+type tlsConfig struct {
+	// certFile and keyFile are the paths to the certificate and key
+	// served, if they are not obtained by manager.
+	certFile, keyFile string
+
+	// manager obtains the certificates, if enabled.
+	manager certManager
+}
+
+// enabled tells whether TLS is served.
+func (t tlsConfig) enabled() bool {
+	return t.certFile != "" || t.manager != nil
+}
+
+// listenAndServe serves TLS with srv as configured by t.
+func (t tlsConfig) listenAndServe(srv *http.Server) error {
+	if t.manager != nil {
+		srv.TLSConfig = t.manager.TLSConfig()
+		return srv.ListenAndServeTLS("", "")
+	}
+
+	return srv.ListenAndServeTLS(t.certFile, t.keyFile)
+}
+
+// newRedirectServer creates a plain HTTP server listening on port, which
+// redirects every request to HTTPS on httpsPort. It also serves the challenges
+// of the certificate authority when the certificates are obtained by a
+// manager.
+func newRedirectServer(port, httpsPort string, t tlsConfig) *http.Server {
+	var h http.Handler = redirectHandler(httpsPort)
+	if t.manager != nil {
+		h = t.manager.HTTPHandler(h)
+	}
+
+	return &http.Server{
+		Addr:         ":" + port,
+		Handler:      h,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+// redirectHandler permanently redirects requests to the same URL over HTTPS,
+// on httpsPort.
+func redirectHandler(httpsPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			// IPv6 literal
+			host = "[" + host + "]"
+		}
+		if httpsPort != "443" {
+			host += ":" + httpsPort
+		}
+
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+
+		// 301 lets clients change other methods to GET, 308 does not
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+
+		http.Redirect(w, r, u.String(), status)
+	}
+}
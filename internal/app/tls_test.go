@@ -0,0 +1,66 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		httpsPort string
+		status    int
+		location  string
+	}{
+		{"default port", "GET", "http://example.com/api/v1/users/?page=2", "443", http.StatusMovedPermanently, "https://example.com/api/v1/users/?page=2"},
+		{"with port", "GET", "http://example.com:8080/health/live", "8443", http.StatusMovedPermanently, "https://example.com:8443/health/live"},
+		{"ipv6", "HEAD", "http://[::1]:8080/", "8443", http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"post", "POST", "http://example.com/api/v1/oauth/token/", "443", http.StatusPermanentRedirect, "https://example.com/api/v1/oauth/token/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.url, nil)
+
+			redirectHandler(tt.httpsPort)(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestConfig_checkTLS(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     Config
+		valid bool
+		tls   bool
+	}{
+		{"plain HTTP", Config{Port: "8000"}, true, false},
+		{"certificate", Config{Port: "8443", TLSCert: "cert.pem", TLSKey: "key.pem", RedirectPort: "8080"}, true, true},
+		{"certificate without key", Config{Port: "8443", TLSCert: "cert.pem"}, false, false},
+		{"key without certificate", Config{Port: "8443", TLSKey: "key.pem"}, false, false},
+		{"autocert", Config{Port: "443", AutocertDomains: "example.com, api.example.com", RedirectPort: "80"}, true, true},
+		{"certificate and autocert", Config{Port: "443", TLSCert: "cert.pem", TLSKey: "key.pem", AutocertDomains: "example.com"}, false, false},
+		{"redirect without TLS", Config{Port: "8000", RedirectPort: "8080"}, false, false},
+		{"redirect on the server port", Config{Port: "8443", TLSCert: "cert.pem", TLSKey: "key.pem", RedirectPort: "8443"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.c.checkTLS()
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.tls, tt.c.tls.enabled())
+		})
+	}
+}
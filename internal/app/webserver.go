@@ -3,49 +3,156 @@ package app
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/noelruault/ratingsapp/internal/controllers"
 	"github.com/noelruault/ratingsapp/internal/middleware"
 	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/scheduler"
 )
 
+// apiVersions lists the versions of the API served, each with its own route group.
+var apiVersions = []string{"v1"}
+
 type webServer struct {
 	eng    *gin.Engine
 	server http.Server
+	tls    tlsConfig
+
+	// redirect is the plain HTTP server redirecting to HTTPS, if
+	// enabled.
+	redirect *http.Server
+
+	staticCtrl   *controllers.Static
+	healthCtrl   *controllers.Health
+	metricsCtrl  *controllers.Metrics
+	queriesCtrl  *controllers.Queries
+	policiesCtrl *controllers.Policies
+	fieldsCtrl   *controllers.TargetFields
+	subsCtrl     *controllers.Subscriptions
+	inboxCtrl    *controllers.Notifications
+	alertsCtrl   *controllers.AlertRules
+	cardsCtrl    *controllers.Cards
+	tenantsCtrl  *controllers.Tenants
+	billingCtrl  *controllers.Billing
+	jobsCtrl     *controllers.Jobs
+	streamsCtrl  *controllers.Streams
+	orgsCtrl     *controllers.Organisations
+
+	// svc returns the services of the requests to the data shared by
+	// the application, see inRequest.
+	svc *models.Services
+
+	// shared are the controllers of the data shared by the
+	// application, authenticating the users of its requests. Their
+	// handlers use the controllers of the services of the request
+	// instead, see inRequest, and the requests to the provisioned tenants the
+	// controllers of their own schema, see inTenant.
+	shared *tenantControllers
+
+	mwLog gin.HandlerFunc
+
+	// mwSecure sets the security headers of the responses.
+	mwSecure gin.HandlerFunc
+
+	// mwErrors sets the format of the error responses.
+	mwErrors gin.HandlerFunc
+
+	// mwTenant resolves the tenant of the requests, and mwInTenant
+	// runs the requests to the provisioned tenants on their schema,
+	// if tenancy is enabled.
+	mwTenant   gin.HandlerFunc
+	mwInTenant gin.HandlerFunc
+
+	// mwMeter counts the API calls made to the tenants, if tenancy and
+	// metering are enabled.
+	mwMeter gin.HandlerFunc
+
+	// mwTrace records the spans of the requests, if tracing is
+	// enabled.
+	mwTrace gin.HandlerFunc
 
-	staticCtrl  *controllers.Static
-	usersCtrl   *controllers.Users
-	rolesCtrl   *controllers.Roles
-	ratingsCtrl *controllers.Ratings
+	// mwSandbox marks the responses in the sandbox mode.
+	mwSandbox gin.HandlerFunc
 
-	mwAuthenticated gin.HandlerFunc
+	// mwDeadline sets the deadline of the API requests, but for the
+	// streams, which are meant to last.
+	mwDeadline gin.HandlerFunc
+
+	// withMetrics enables the /metrics route.
+	withMetrics bool
 }
 
-func newWebServer(port string, svc *models.Services) *webServer {
-	var ws = &webServer{}
+func newWebServer(c *Config, svc *models.Services, jobs *scheduler.Scheduler) *webServer {
+	var ws = &webServer{
+		svc:         svc,
+		tls:         c.tls,
+		withMetrics: c.metricsInterval != 0,
+	}
 
-	ws.mwAuthenticated = middleware.Authenticated(svc.User)
+	ws.mwSecure = middleware.SecureHeaders(c.headers)
+	ws.mwLog = middleware.Log(c.anonymizer)
+	ws.mwErrors = middleware.ErrorFormat(c.errorFormat, c.ErrorTypeBase)
+	ws.mwDeadline = middleware.Deadline(c.server.requestTimeout)
+	if c.tracer != nil {
+		ws.mwTrace = middleware.Trace(c.tracer)
+	}
+	if c.sandboxReset != nil {
+		ws.mwSandbox = middleware.Sandbox(func() time.Time {
+			return nextRun(jobs, sandboxResetJob)
+		})
+	}
+	if c.Tenancy {
+		ws.mwTenant = middleware.Tenant(svc.Tenant, c.TenantHeader)
+		ws.mwInTenant = inTenant(svc)
+		if c.MeteringInterval != "" {
+			ws.mwMeter = middleware.Meter(svc.Metering)
+		}
+	}
 
 	ws.staticCtrl = controllers.NewStatic()
-	ws.usersCtrl = controllers.NewUsers(svc.User)
-	ws.rolesCtrl = controllers.NewRoles(svc.Role)
-	ws.ratingsCtrl = controllers.NewRatings(svc.Rating)
+	if c.static != nil {
+		ws.staticCtrl.WithFiles(c.static)
+	}
+	ws.healthCtrl = controllers.NewHealth().WithCheck(svc.Ping)
+	ws.metricsCtrl = controllers.NewMetrics()
+	ws.shared = newTenantControllers(svc, svc.RatingQueue)
+	ws.queriesCtrl = controllers.NewQueries(svc.Query)
+	ws.policiesCtrl = controllers.NewPolicies(svc.Policy)
+	ws.fieldsCtrl = controllers.NewTargetFields(svc.TargetField)
+	ws.subsCtrl = controllers.NewSubscriptions(svc.Subscription)
+	ws.inboxCtrl = controllers.NewNotifications(svc.Notification)
+	ws.alertsCtrl = controllers.NewAlertRules(svc.Alert)
+	ws.cardsCtrl = controllers.NewCards(svc.Card)
+	ws.tenantsCtrl = controllers.NewTenants(svc.Tenant)
+	ws.billingCtrl = controllers.NewBilling(svc.Metering)
+	ws.jobsCtrl = controllers.NewJobs(jobs)
+	ws.streamsCtrl = controllers.NewStreams(svc.Events, svc.Rating)
+	ws.orgsCtrl = controllers.NewOrganisations(svc.Organisation)
 
 	ws.setupRoutes()
 	ws.server = http.Server{
-		Addr:         ":" + port,
-		Handler:      ws.eng,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Addr:    ":" + c.Port,
+		Handler: ws.eng,
+	}
+	c.server.apply(&ws.server)
+
+	if c.RedirectPort != "" {
+		ws.redirect = newRedirectServer(c.RedirectPort, c.Port, c.tls)
 	}
 
 	return ws
 }
 
 func (ws *webServer) Run() error {
-	err := ws.server.ListenAndServe()
+	var err error
+	if ws.tls.enabled() {
+		err = ws.tls.listenAndServe(&ws.server)
+	} else {
+		err = ws.server.ListenAndServe()
+	}
 	if err != nil {
 		if err == http.ErrServerClosed {
 			return nil
@@ -57,14 +164,38 @@ func (ws *webServer) Run() error {
 	return nil
 }
 
+func (ws *webServer) RunRedirect() error {
+	err := ws.redirect.ListenAndServe()
+	if err != nil {
+		if err == http.ErrServerClosed {
+			return nil
+		}
+
+		return wrap("webServer.RunRedirect", err)
+	}
+
+	return nil
+}
+
 func (ws *webServer) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// the streams never end by themselves
+	ws.streamsCtrl.Close()
+
+	var errRedirect error
+	if ws.redirect != nil {
+		errRedirect = ws.redirect.Shutdown(ctx)
+	}
+
 	err := ws.server.Shutdown(ctx)
 	if err != nil {
 		return wrap("webServer.Shutdown", err)
 	}
+	if errRedirect != nil {
+		return wrap("webServer.Shutdown", errRedirect)
+	}
 
 	return nil
 }
@@ -73,98 +204,486 @@ func (ws *webServer) setupRoutes() {
 	gin.SetMode(gin.ReleaseMode)
 	mux := gin.New()
 
-	mux.Use(middleware.Log)
+	// the security headers are set first, so the errors of the other
+	// middlewares have them too
+	mux.Use(ws.mwSecure)
+	if ws.mwTrace != nil {
+		mux.Use(ws.mwTrace)
+	}
+	mux.Use(middleware.RequestID, ws.mwErrors)
+	mux.Use(ws.mwLog)
 	mux.Use(gin.Recovery())
-	mux.Use(middleware.SecureHeaders)
+	if ws.mwSandbox != nil {
+		mux.Use(ws.mwSandbox)
+	}
+	if ws.mwTenant != nil {
+		mux.Use(ws.mwTenant, ws.mwInTenant)
+	}
+
+	// Probes
+	mux.GET("/health/live", ws.healthCtrl.Live)
+	mux.GET("/health/ready", ws.healthCtrl.Ready)
+
+	if ws.withMetrics {
+		mux.GET("/metrics", ws.metricsCtrl.Get)
+	}
 
 	// Authentication
-	mux.POST("/api/v1/oauth/token/", ws.usersCtrl.Login)
+	mux.POST("/api/v1/oauth/token/", ws.mwDeadline, middleware.APIVersion("v1", apiVersions...), ws.users((*controllers.Users).Login))
+	mux.POST("/api/v1/oauth/authorize/", ws.mwDeadline, middleware.APIVersion("v1", apiVersions...), ws.users((*controllers.Users).Authorize))
+	mux.POST("/api/v1/oauth/oidc/nonce/", ws.mwDeadline, middleware.APIVersion("v1", apiVersions...), ws.users((*controllers.Users).OIDCNonce))
+	mux.POST("/api/v1/oauth/oidc/callback/", ws.mwDeadline, middleware.APIVersion("v1", apiVersions...), ws.users((*controllers.Users).OIDCCallback))
+	mux.POST("/api/v1/invitations/accept", ws.mwDeadline, middleware.APIVersion("v1", apiVersions...), middleware.ContentType("application/json"),
+		ws.invitations((*controllers.Invitations).Accept))
 
 	// restricted handlers
 	{
 		restricted := mux.Group("/")
+		restricted.Use(ws.mwDeadline)
 		restricted.Use(middleware.ContentType("application/json"))
-		restricted.Use(ws.mwAuthenticated)
+		restricted.Use(ws.authenticated)
 
 		{
 			apimux := restricted.Group("/api/v1/")
+			apimux.Use(middleware.APIVersion("v1", apiVersions...))
+			if ws.mwMeter != nil {
+				apimux.Use(ws.mwMeter)
+			}
 
 			ws.setupUsers(apimux)
 			ws.setupRoles(apimux)
+			ws.setupOrganisations(apimux)
 			ws.setupRatings(apimux)
+			ws.setupCampaigns(apimux)
+			ws.setupAlerts(apimux)
+			ws.setupSync(apimux)
+			ws.setupQueries(apimux)
+			ws.setupGraphQL(apimux)
+			ws.setupJobs(apimux)
+			if ws.mwTenant != nil {
+				ws.setupTenants(apimux)
+			}
+		}
+	}
+
+	// streams, sent as Server-Sent Events instead of JSON documents
+	{
+		streams := mux.Group("/api/v1/")
+		streams.Use(middleware.ContentType("text/event-stream"))
+		streams.Use(ws.authenticated)
+		streams.Use(middleware.APIVersion("v1", apiVersions...))
+		if ws.mwMeter != nil {
+			streams.Use(ws.mwMeter)
 		}
+
+		streams.GET("/ratings/stream", middleware.Can(
+			models.PermissionReadRatings,
+			middleware.NoOrganisation(ws.sharedOnly(ws.streamsCtrl.Ratings)),
+		))
 	}
 
+	mux.GET("/", ws.staticCtrl.Home)
 	mux.NoRoute(ws.staticCtrl.NotFound)
 
+	if unguarded := unguardedRoutes(mux.Routes()); len(unguarded) > 0 {
+		panic("routes registered without a permission check: " + strings.Join(unguarded, ", "))
+	}
+
 	ws.eng = mux
 }
 
+// publicRoutes are the API routes that do not require an authenticated user,
+// as they authenticate the users, or create them.
+var publicRoutes = map[string]bool{
+	"POST /api/v1/oauth/token/":         true,
+	"POST /api/v1/oauth/authorize/":     true,
+	"POST /api/v1/oauth/oidc/nonce/":    true,
+	"POST /api/v1/oauth/oidc/callback/": true,
+	"POST /api/v1/invitations/accept":   true,
+}
+
+// unguardedRoutes returns the API routes of routes that are neither public nor
+// wrapped by a permission check of the middleware package, such as Can, so a
+// route is not left open by mistake. The routes wrapped by middleware.AnyUser
+// are allowed to any authenticated user.
+func unguardedRoutes(routes gin.RoutesInfo) []string {
+	var unguarded []string
+	for _, r := range routes {
+		route := r.Method + " " + r.Path
+		if !strings.HasPrefix(r.Path, "/api/") || publicRoutes[route] || middleware.Guarded(r.Handler) {
+			continue
+		}
+
+		unguarded = append(unguarded, route)
+	}
+
+	return unguarded
+}
+
 func (ws *webServer) setupUsers(mux *gin.RouterGroup) {
 	mux.GET("/users/", middleware.Can(
 		models.PermissionReadUsers,
-		ws.usersCtrl.List,
+		ws.users((*controllers.Users).List),
 	))
 	mux.GET("/users/:id", middleware.Can(
 		models.PermissionReadUsers,
-		ws.usersCtrl.Get,
+		ws.users((*controllers.Users).Get),
 	))
 	mux.POST("/users/", middleware.Can(
 		models.PermissionWriteUsers,
-		ws.usersCtrl.Create,
+		ws.users((*controllers.Users).Create),
 	))
 	mux.PUT("/users/:id", middleware.Can(
 		models.PermissionWriteUsers,
-		ws.usersCtrl.Update,
+		ws.users((*controllers.Users).Update),
+	))
+	mux.PATCH("/users/:id", middleware.Can(
+		models.PermissionWriteUsers,
+		ws.users((*controllers.Users).Patch),
 	))
 	mux.DELETE("/users/:id", middleware.Can(
 		models.PermissionWriteUsers,
-		ws.usersCtrl.Delete,
+		ws.users((*controllers.Users).Delete),
+	))
+	mux.POST("/users/:id/deactivate", middleware.Can(
+		models.PermissionWriteUsers,
+		ws.users((*controllers.Users).Deactivate),
+	))
+	mux.POST("/users/:id/activate", middleware.Can(
+		models.PermissionWriteUsers,
+		ws.users((*controllers.Users).Activate),
+	))
+	mux.POST("/users/:id/impersonate", middleware.Admin(ws.users((*controllers.Users).Impersonate)))
+	mux.GET("/users/:id/sessions", middleware.CanOrSelf(
+		models.PermissionReadUsers,
+		ws.users((*controllers.Users).Sessions),
+	))
+	mux.DELETE("/users/:id/sessions", middleware.CanOrSelf(
+		models.PermissionWriteUsers,
+		ws.users((*controllers.Users).RevokeSessions),
+	))
+	mux.DELETE("/users/:id/sessions/:sid", middleware.CanOrSelf(
+		models.PermissionWriteUsers,
+		ws.users((*controllers.Users).RevokeSession),
+	))
+	mux.GET("/me/sessions", middleware.AnyUser(ws.users((*controllers.Users).MySessions)))
+	mux.DELETE("/me/sessions/:sid", middleware.AnyUser(ws.users((*controllers.Users).RevokeMySession)))
+	mux.POST("/me/identities", middleware.AnyUser(ws.users((*controllers.Users).LinkMyIdentity)))
+	mux.GET("/me/permissions", middleware.AnyUser(ws.users((*controllers.Users).MyPermissions)))
+	mux.GET("/me/settings", middleware.AnyUser(ws.users((*controllers.Users).MySettings)))
+	mux.PUT("/me/settings", middleware.AnyUser(ws.users((*controllers.Users).ReplaceMySettings)))
+	mux.PATCH("/me/settings", middleware.AnyUser(ws.users((*controllers.Users).PatchMySettings)))
+	mux.GET("/me/notifications", middleware.AnyUser(ws.sharedOnly(ws.inboxCtrl.List)))
+	mux.POST("/me/notifications/read", middleware.AnyUser(ws.sharedOnly(ws.inboxCtrl.MarkAllRead)))
+	mux.POST("/me/notifications/:id/read", middleware.AnyUser(ws.sharedOnly(ws.inboxCtrl.MarkRead)))
+	mux.GET("/invitations/", middleware.Can(
+		models.PermissionReadUsers,
+		middleware.NoOrganisation(ws.invitations((*controllers.Invitations).List)),
+	))
+	mux.POST("/invitations/", middleware.Can(
+		models.PermissionWriteUsers,
+		middleware.NoOrganisation(ws.invitations((*controllers.Invitations).Create)),
+	))
+	mux.POST("/invitations/:id/renew", middleware.Can(
+		models.PermissionWriteUsers,
+		middleware.NoOrganisation(ws.invitations((*controllers.Invitations).Renew)),
+	))
+	mux.DELETE("/invitations/:id", middleware.Can(
+		models.PermissionWriteUsers,
+		middleware.NoOrganisation(ws.invitations((*controllers.Invitations).Delete)),
+	))
+	mux.GET("/users/:id/reputation", middleware.CanOrSelf(
+		models.PermissionReadUsers,
+		middleware.NoOrganisation(ws.reputation((*controllers.Reputation).Get)),
+	))
+	mux.GET("/users/:id/consents", middleware.CanOrSelf(
+		models.PermissionReadUsers,
+		middleware.NoOrganisation(ws.consent((*controllers.Consent).List)),
+	))
+	mux.GET("/users/:id/follows", middleware.CanOrSelf(
+		models.PermissionReadUsers,
+		middleware.NoOrganisation(ws.sharedOnly(ws.subsCtrl.List)),
+	))
+	mux.GET("/users/:id/notifications", middleware.CanOrSelf(
+		models.PermissionReadUsers,
+		middleware.NoOrganisation(ws.sharedOnly(ws.subsCtrl.Notifications)),
 	))
+
+	// every user accepts the policy for themselves
+	mux.POST("/consents/", middleware.AnyUser(ws.consent((*controllers.Consent).Accept)))
 }
 
 func (ws *webServer) setupRoles(mux *gin.RouterGroup) {
 	mux.GET("/roles/", middleware.Can(
 		models.PermissionReadUsers,
-		ws.rolesCtrl.List,
+		ws.roles((*controllers.Roles).List),
 	))
 	mux.GET("/roles/:id", middleware.Can(
 		models.PermissionReadUsers,
-		ws.rolesCtrl.Get,
+		ws.roles((*controllers.Roles).Get),
 	))
 	mux.POST("/roles/", middleware.Can(
 		models.PermissionWriteUsers,
-		ws.rolesCtrl.Create,
+		ws.roles((*controllers.Roles).Create),
 	))
 	mux.PUT("/roles/:id", middleware.Can(
 		models.PermissionWriteUsers,
-		ws.rolesCtrl.Update,
+		ws.roles((*controllers.Roles).Update),
+	))
+	mux.PATCH("/roles/:id", middleware.Can(
+		models.PermissionWriteUsers,
+		ws.roles((*controllers.Roles).Patch),
 	))
 	mux.DELETE("/roles/:id", middleware.Can(
 		models.PermissionWriteUsers,
-		ws.rolesCtrl.Delete,
+		ws.roles((*controllers.Roles).Delete),
+	))
+	mux.POST("/roles/:id/clone", middleware.Can(
+		models.PermissionWriteUsers,
+		ws.roles((*controllers.Roles).Clone),
+	))
+	mux.POST("/roles/:id/preview", middleware.Can(
+		models.PermissionReadUsers,
+		ws.roles((*controllers.Roles).Preview),
+	))
+	mux.POST("/roles/:id/assign", middleware.Can(
+		models.PermissionWriteUsers,
+		ws.roles((*controllers.Roles).Assign),
+	))
+	mux.GET("/roles/:id/users", middleware.Can(
+		models.PermissionReadUsers,
+		ws.roles((*controllers.Roles).Users),
 	))
+	mux.GET("/permissions", middleware.Can(
+		models.PermissionReadUsers,
+		ws.roles((*controllers.Roles).Permissions),
+	))
+
+	mux.GET("/admin/access-report", middleware.Admin(ws.access((*controllers.Access).Report)))
+	mux.GET("/admin/audit-log", middleware.Admin(middleware.NoOrganisation(ws.audit((*controllers.Audit).List))))
+	mux.GET("/admin/retention", middleware.Admin(middleware.NoOrganisation(ws.retention((*controllers.Retention).Show))))
+}
+
+func (ws *webServer) setupOrganisations(mux *gin.RouterGroup) {
+	// the organisations are managed by the admins of no organisation
+	mux.GET("/admin/organisations/", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.orgsCtrl.List))))
+	mux.GET("/admin/organisations/:id", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.orgsCtrl.Get))))
+	mux.POST("/admin/organisations/", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.orgsCtrl.Create))))
+	mux.PUT("/admin/organisations/:id", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.orgsCtrl.Update))))
+	mux.DELETE("/admin/organisations/:id", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.orgsCtrl.Delete))))
 }
 
 func (ws *webServer) setupRatings(mux *gin.RouterGroup) {
 	mux.GET("/ratings/", middleware.Can(
 		models.PermissionReadRatings,
-		ws.ratingsCtrl.ListByTarget,
+		ws.ratings((*controllers.Ratings).ListByTarget),
+	))
+	mux.GET("/ratings/compare", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).Compare),
+	))
+	mux.GET("/ratings/cohorts", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).Cohorts),
 	))
 	mux.GET("/ratings/:id", middleware.Can(
 		models.PermissionReadRatings,
-		ws.ratingsCtrl.Get,
+		ws.ratings((*controllers.Ratings).Get),
+	))
+	mux.GET("/ratings/:id/history", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).History),
+	))
+	mux.POST("/ratings/", ws.consented, middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).Create),
+	))
+	mux.POST("/ratings/with-settings", ws.consented, middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).CreateWithSettings),
+	))
+	mux.PUT("/ratings/:id", ws.consented, middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).Update),
+	))
+	mux.PATCH("/ratings/:id", ws.consented, middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).Patch),
+	))
+	mux.DELETE("/ratings/:id", middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).Delete),
 	))
-	mux.POST("/ratings/", middleware.Can(
-		models.PermissionWriteRatings,
-		ws.ratingsCtrl.Create,
+	mux.GET("/me/drafts", middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).Drafts),
 	))
-	mux.PUT("/ratings/:id", middleware.Can(
-		models.PermissionWriteRatings,
-		ws.ratingsCtrl.Update,
+	mux.POST("/me/drafts/:id/publish", ws.consented, middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).PublishDraft),
 	))
-	mux.DELETE("/ratings/:id", middleware.Can(
-		models.PermissionWriteRatings,
-		ws.ratingsCtrl.Delete,
+	mux.DELETE("/me/drafts/:id", middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).DeleteDraft),
 	))
+	mux.PUT("/ratings/:id/reaction", middleware.Can(
+		models.PermissionReadRatings,
+		ws.reputation((*controllers.Reputation).React),
+	))
+	mux.DELETE("/ratings/:id/reaction", middleware.Can(
+		models.PermissionReadRatings,
+		ws.reputation((*controllers.Reputation).Unreact),
+	))
+	mux.GET("/ratings/:id/replies", middleware.Can(
+		models.PermissionReadRatings,
+		ws.replies((*controllers.Replies).List),
+	))
+	mux.POST("/ratings/:id/replies", middleware.Can(
+		models.PermissionReadRatings,
+		ws.replies((*controllers.Replies).Create),
+	))
+	mux.PUT("/ratings/:id/replies/:replyId", middleware.Can(
+		models.PermissionReadRatings,
+		ws.replies((*controllers.Replies).Update),
+	))
+	mux.DELETE("/ratings/:id/replies/:replyId", middleware.Can(
+		models.PermissionReadRatings,
+		ws.replies((*controllers.Replies).Delete),
+	))
+	mux.POST("/ratings/:id/attachments", ws.consented, middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.attachments((*controllers.Attachments).Create),
+	))
+	mux.DELETE("/ratings/:id/attachments/:attachmentId", middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.attachments((*controllers.Attachments).Delete),
+	))
+	mux.GET("/attachments/:id", middleware.Can(
+		models.PermissionReadRatings,
+		ws.attachments((*controllers.Attachments).Get),
+	))
+	mux.PUT("/ratings/:id/moderation", middleware.Admin(middleware.NoOrganisation(ws.reputation((*controllers.Reputation).Moderate))))
+	mux.GET("/moderation/ratings", middleware.Admin(middleware.NoOrganisation(ws.reputation((*controllers.Reputation).Held))))
+	mux.GET("/targets/scores", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).Scores),
+	))
+	mux.GET("/targets/:id/stats", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).Stats),
+	))
+	mux.GET("/targets/:id/cards", middleware.Can(
+		models.PermissionReadRatings,
+		middleware.NoOrganisation(ws.sharedOnly(ws.cardsCtrl.ListByTarget)),
+	))
+	mux.GET("/targets/:id/tags", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).Tags),
+	))
+	mux.PUT("/targets/:id/tags", middleware.Admin(middleware.NoOrganisation(ws.ratings((*controllers.Ratings).SetTags))))
+	mux.GET("/targets/:id/category", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).Category),
+	))
+	mux.PUT("/targets/:id/category", middleware.Admin(middleware.NoOrganisation(ws.ratings((*controllers.Ratings).SetCategory))))
+	mux.GET("/targets/:id/window", middleware.Can(
+		models.PermissionReadRatings,
+		ws.ratings((*controllers.Ratings).Window),
+	))
+	mux.PUT("/targets/:id/window", middleware.Admin(middleware.NoOrganisation(ws.ratings((*controllers.Ratings).SetWindow))))
+	mux.POST("/targets/:id/window/open", middleware.Admin(middleware.NoOrganisation(ws.ratings((*controllers.Ratings).OpenWindow))))
+	mux.POST("/targets/:id/window/close", middleware.Admin(middleware.NoOrganisation(ws.ratings((*controllers.Ratings).CloseWindow))))
+	mux.GET("/admin/categories/", middleware.Admin(middleware.NoOrganisation(ws.categories((*controllers.TargetCategories).List))))
+	mux.GET("/admin/categories/:name", middleware.Admin(middleware.NoOrganisation(ws.categories((*controllers.TargetCategories).Get))))
+	mux.PUT("/admin/categories/:name", middleware.Admin(middleware.NoOrganisation(ws.categories((*controllers.TargetCategories).Set))))
+	mux.DELETE("/admin/categories/:name", middleware.Admin(middleware.NoOrganisation(ws.categories((*controllers.TargetCategories).Remove))))
+	mux.GET("/targets/:id/owners", middleware.Admin(middleware.NoOrganisation(ws.replies((*controllers.Replies).Owners))))
+	mux.PUT("/targets/:id/owners", middleware.Admin(middleware.NoOrganisation(ws.replies((*controllers.Replies).SetOwners))))
+	mux.POST("/targets/:id/follow", middleware.Can(
+		models.PermissionReadRatings,
+		middleware.NoOrganisation(ws.sharedOnly(ws.subsCtrl.Follow)),
+	))
+	mux.DELETE("/targets/:id/follow", middleware.Can(
+		models.PermissionReadRatings,
+		middleware.NoOrganisation(ws.sharedOnly(ws.subsCtrl.Unfollow)),
+	))
+	mux.GET("/queue/ratings/:key", middleware.CanAny(
+		models.PermissionWriteRatings|models.PermissionWriteOwnRatings,
+		ws.ratings((*controllers.Ratings).Receipt),
+	))
+}
+
+func (ws *webServer) setupCampaigns(mux *gin.RouterGroup) {
+	mux.GET("/campaigns/", middleware.Can(
+		models.PermissionReadRatings,
+		ws.campaigns((*controllers.Campaigns).List),
+	))
+	mux.GET("/campaigns/:id", middleware.Can(
+		models.PermissionReadRatings,
+		ws.campaigns((*controllers.Campaigns).Get),
+	))
+	mux.GET("/campaigns/:id/stats", middleware.Can(
+		models.PermissionReadRatings,
+		ws.campaigns((*controllers.Campaigns).Stats),
+	))
+	mux.POST("/campaigns/", middleware.Admin(ws.campaigns((*controllers.Campaigns).Create)))
+	mux.PUT("/campaigns/:id", middleware.Admin(ws.campaigns((*controllers.Campaigns).Update)))
+	mux.DELETE("/campaigns/:id", middleware.Admin(ws.campaigns((*controllers.Campaigns).Delete)))
+}
+
+func (ws *webServer) setupAlerts(mux *gin.RouterGroup) {
+	mux.GET("/alert-rules/", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.alertsCtrl.List))))
+	mux.GET("/alert-rules/:id", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.alertsCtrl.Get))))
+	mux.POST("/alert-rules/", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.alertsCtrl.Create))))
+	mux.PUT("/alert-rules/:id", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.alertsCtrl.Update))))
+	mux.DELETE("/alert-rules/:id", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.alertsCtrl.Delete))))
+}
+
+func (ws *webServer) setupTenants(mux *gin.RouterGroup) {
+	mux.GET("/admin/tenants/", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.List))))
+	mux.GET("/admin/tenants/:id", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.Get))))
+	mux.GET("/admin/tenants/:id/usage", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.Usage))))
+	mux.POST("/admin/tenants/", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.Create))))
+	mux.PUT("/admin/tenants/:id", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.Update))))
+	mux.DELETE("/admin/tenants/:id", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.Delete))))
+	mux.PUT("/admin/tenants/:id/suspension", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.Suspend))))
+	mux.DELETE("/admin/tenants/:id/suspension", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.Resume))))
+	mux.PUT("/admin/tenants/:id/hostnames/:hostname", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.AddHostname))))
+	mux.DELETE("/admin/tenants/:id/hostnames/:hostname", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.tenantsCtrl.RemoveHostname))))
+
+	mux.GET("/admin/billing/usage", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.billingCtrl.Usage))))
+	mux.GET("/admin/billing/reconciliation", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.billingCtrl.Reconciliation))))
+}
+
+func (ws *webServer) setupJobs(mux *gin.RouterGroup) {
+	// the jobs maintain the data of every tenant, so only the admins of the
+	// application see them
+	mux.GET("/admin/jobs/", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.jobsCtrl.List))))
+	mux.POST("/admin/jobs/:name/run", middleware.Admin(middleware.NoOrganisation(middleware.NoTenant(ws.jobsCtrl.Run))))
+}
+
+func (ws *webServer) setupSync(mux *gin.RouterGroup) {
+	// the sync controller filters its output based on the user's permissions
+	mux.GET("/sync", middleware.AnyUser(middleware.NoOrganisation(ws.sync((*controllers.Sync).Get))))
+}
+
+func (ws *webServer) setupGraphQL(mux *gin.RouterGroup) {
+	// the GraphQL controller checks the user's permissions for each field
+	mux.POST("/graphql", middleware.AnyUser(ws.graphql((*controllers.GraphQL).Query)))
+}
+
+func (ws *webServer) setupQueries(mux *gin.RouterGroup) {
+	mux.GET("/admin/queries/", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.queriesCtrl.List))))
+	mux.GET("/admin/queries/:name", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.queriesCtrl.Run))))
+
+	mux.GET("/admin/policies/", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.policiesCtrl.List))))
+	mux.PUT("/admin/policies/:hook", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.policiesCtrl.Set))))
+	mux.DELETE("/admin/policies/:hook", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.policiesCtrl.Remove))))
+	mux.GET("/admin/policies/:hook/changes", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.policiesCtrl.Changes))))
+	mux.POST("/admin/policies/:hook/check", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.policiesCtrl.Check))))
+
+	mux.GET("/admin/target-fields/", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.fieldsCtrl.List))))
+	mux.PUT("/admin/target-fields/:name", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.fieldsCtrl.Set))))
+	mux.DELETE("/admin/target-fields/:name", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.fieldsCtrl.Remove))))
+	mux.POST("/admin/target-fields/check", middleware.Admin(middleware.NoOrganisation(ws.sharedOnly(ws.fieldsCtrl.Check))))
 }
@@ -6,8 +6,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/tracing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -150,6 +157,17 @@ func TestWebSever(t *testing.T) {
 				]}`},
 			},
 		},
+		{
+			"GET",
+			"/api/v1/users/?id=1,2,7&q=SOME&active=true&sort=-email",
+			"",
+			[]subCase{
+				{&testUserUser, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserReadUsers, http.StatusOK, `{"items":[
+					{"id":7,"active":true,"email":"someone@some.com","firstName":"testname","lastName":"","roleId":2}
+				]}`},
+			},
+		},
 		{
 			"PUT",
 			"/api/v1/users/7",
@@ -161,6 +179,17 @@ func TestWebSever(t *testing.T) {
 				{&testUserWriteUsers, http.StatusOK, `{"active":true,"email":"someoneupdate@some.com","firstName":"readuser","lastName":"washere","roleId":2}`},
 			},
 		},
+		{
+			"PATCH",
+			"/api/v1/users/7",
+			`{"lastName":"patched"}`,
+			[]subCase{
+				{&testUserNone, http.StatusUnauthorized, `{"error":"unauthorised"}`},
+				{&testUserUser, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserReadUsers, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserWriteUsers, http.StatusOK, `{"active":true,"email":"someoneupdate@some.com","firstName":"readuser","lastName":"patched","roleId":2}`},
+			},
+		},
 		{
 			"DELETE",
 			"/api/v1/users/7",
@@ -172,6 +201,25 @@ func TestWebSever(t *testing.T) {
 				{&testUserWriteUsers, http.StatusNoContent, ``},
 			},
 		},
+		// SYNC
+		{
+			"GET",
+			"/api/v1/sync?since=abc",
+			"",
+			[]subCase{
+				{&testUserNone, http.StatusUnauthorized, `{"error":"unauthorised"}`},
+				{&testUserUser, http.StatusBadRequest, `{"error":"validation_error","fields":{"since":"invalid"}}`},
+			},
+		},
+		{
+			"GET",
+			"/api/v1/sync",
+			"",
+			[]subCase{
+				{&testUserUser, http.StatusOK, `{}`},
+				{&testUserReadRatings, http.StatusOK, `{"ratings":{"updated":[],"deleted":[]}}`},
+			},
+		},
 		// ROLES
 		{
 			"POST",
@@ -223,6 +271,17 @@ func TestWebSever(t *testing.T) {
 				{&testUserWriteUsers, http.StatusOK, `{"label":"testrole","permissions":["writeRatings"]}`},
 			},
 		},
+		{
+			"PATCH",
+			"/api/v1/roles/7",
+			`{"permissions":["readRatings","writeRatings"]}`,
+			[]subCase{
+				{&testUserNone, http.StatusUnauthorized, `{"error":"unauthorised"}`},
+				{&testUserUser, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserReadUsers, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserWriteUsers, http.StatusOK, `{"label":"testrole","permissions":["readRatings","writeRatings"]}`},
+			},
+		},
 		{
 			"DELETE",
 			"/api/v1/roles/7",
@@ -279,6 +338,51 @@ func TestWebSever(t *testing.T) {
 				{&testUserWriteRatings, http.StatusOK, `{"id":1,"active":true,"anonymous":true,"comment":"amazing stuff","extra":{},"score":9,"target":999,"userId":6}`},
 			},
 		},
+		{
+			"GET",
+			"/api/v1/ratings/1/history",
+			"",
+			[]subCase{
+				{&testUserNone, http.StatusUnauthorized, `{"error":"unauthorised"}`},
+				{&testUserUser, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserReadRatings, http.StatusOK, `{"items":[{"ratingId":1,"active":true,"anonymous":true,"comment":"awesome stuff","extra":{},"score":6,"target":999,"userId":6}]}`},
+				{&testUserWriteRatings, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserAdmin, http.StatusOK, `{"items":[{"ratingId":1,"active":true,"anonymous":true,"comment":"awesome stuff","extra":{},"score":6,"target":999,"userId":6}]}`},
+			},
+		},
+		{
+			"PATCH",
+			"/api/v1/ratings/1",
+			`{"score":7,"extra":{"color":"red"}}`,
+			[]subCase{
+				{&testUserNone, http.StatusUnauthorized, `{"error":"unauthorised"}`},
+				{&testUserUser, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserReadRatings, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserWriteRatings, http.StatusOK, `{"id":1,"active":true,"anonymous":true,"comment":"amazing stuff","extra":{"color":"red"},"score":7,"target":999,"userId":6}`},
+			},
+		},
+		{
+			"GET",
+			"/api/v1/ratings/?target=999&minScore=7&active=true&sort=-score",
+			"",
+			[]subCase{
+				{&testUserNone, http.StatusUnauthorized, `{"error":"unauthorised"}`},
+				{&testUserUser, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserReadRatings, http.StatusOK, `{"items":[{"id":1,"active":true,"anonymous":true,"comment":"amazing stuff","extra":{"color":"red"},"score":7,"target":999,"userId":6}]}`},
+				{&testUserWriteRatings, http.StatusForbidden, `{"error":"forbidden"}`},
+			},
+		},
+		{
+			"GET",
+			"/api/v1/targets/999/stats",
+			"",
+			[]subCase{
+				{&testUserNone, http.StatusUnauthorized, `{"error":"unauthorised"}`},
+				{&testUserUser, http.StatusForbidden, `{"error":"forbidden"}`},
+				{&testUserReadRatings, http.StatusOK, `{"target":999,"count":1,"average":7,"min":7,"max":7,"weightedAverage":7,"verifiedWeightedAverage":7}`},
+				{&testUserWriteRatings, http.StatusForbidden, `{"error":"forbidden"}`},
+			},
+		},
 		{
 			"DELETE",
 			"/api/v1/ratings/1",
@@ -301,6 +405,7 @@ func TestWebSever(t *testing.T) {
 					cs.method, testURL+cs.path, bytes.NewReader([]byte(cs.input)))
 				req.Header.Add("Authorization", "Bearer "+scs.user.token)
 				req.Header.Add("Content-Type", "application/json")
+				req.Header.Add("If-Match", "*")
 
 				res, err := http.DefaultClient.Do(req)
 				require.NoError(t, err, "http client must not return any errors")
@@ -319,3 +424,265 @@ func TestWebSever(t *testing.T) {
 		}
 	}
 }
+
+func TestWebServer_RatingOwnership(t *testing.T) {
+	rid := createRole(testUserAdmin.token, "writeOwnRatings")
+	createUser(testUserAdmin.token, "author", rid)
+	createUser(testUserAdmin.token, "other", rid)
+	author := getAuthToken("author@test.com", "password")
+	other := getAuthToken("other@test.com", "password")
+
+	do := func(t *testing.T, method, path, token, ifMatch, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, testURL+path, bytes.NewReader([]byte(body)))
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Add("If-Match", ifMatch)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "http client must not return any errors")
+
+		b, _ := ioutil.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	create := func(t *testing.T, target string) string {
+		res, body := do(t, "POST", "/api/v1/ratings", author, "", `{"score":6,"target":`+target+`}`)
+		require.Equal(t, http.StatusCreated, res.StatusCode, body)
+
+		var rating struct {
+			ID int64 `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &rating))
+		return "/api/v1/ratings/" + strconv.FormatInt(rating.ID, 10)
+	}
+
+	path := create(t, "4201")
+
+	t.Run("updateByOther", func(t *testing.T) {
+		res, body := do(t, "PUT", path, other, "*", `{"score":1,"target":4201}`)
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+		assert.JSONEq(t, `{"error":"read_only"}`, body)
+	})
+
+	t.Run("deleteByOther", func(t *testing.T) {
+		res, body := do(t, "DELETE", path, other, "", "")
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+		assert.JSONEq(t, `{"error":"read_only"}`, body)
+	})
+
+	t.Run("deleteStaleVersion", func(t *testing.T) {
+		res, body := do(t, "DELETE", path, author, `"9"`, "")
+		assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+		assert.JSONEq(t, `{"error":"conflict"}`, body)
+	})
+
+	t.Run("deleteByAuthor", func(t *testing.T) {
+		res, _ := do(t, "DELETE", path, author, `"1"`, "")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		res, _ = do(t, "GET", path, testUserReadRatings.token, "", "")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("deleteByModerator", func(t *testing.T) {
+		path := create(t, "4202")
+
+		res, _ := do(t, "DELETE", path, testUserWriteRatings.token, "", "")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	})
+}
+
+func TestWebServer_TargetCategories(t *testing.T) {
+	do := func(t *testing.T, method, path, token, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, testURL+path, bytes.NewReader([]byte(body)))
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "http client must not return any errors")
+
+		b, _ := ioutil.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	res, body := do(t, "PUT", "/api/v1/admin/categories/drivers", testUserWriteRatings.token, `{"minScore":1,"maxScore":5}`)
+	require.Equal(t, http.StatusForbidden, res.StatusCode, body)
+
+	res, body = do(t, "PUT", "/api/v1/admin/categories/drivers", testUserAdmin.token, `{"minScore":1,"maxScore":5,"commentRequired":true}`)
+	require.Equal(t, http.StatusOK, res.StatusCode, body)
+	res, body = do(t, "PUT", "/api/v1/targets/4301/category", testUserAdmin.token, `{"category":"drivers"}`)
+	require.Equal(t, http.StatusOK, res.StatusCode, body)
+
+	res, body = do(t, "POST", "/api/v1/ratings", testUserWriteRatings.token, `{"score":6,"target":4301}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.JSONEq(t, `{"error":"validation_error","fields":{"score":"invalid","comment":"required"}}`, body)
+
+	res, body = do(t, "POST", "/api/v1/ratings", testUserWriteRatings.token, `{"score":5,"target":4301,"comment":"Smooth ride"}`)
+	assert.Equal(t, http.StatusCreated, res.StatusCode, body)
+
+	res, body = do(t, "DELETE", "/api/v1/admin/categories/drivers", testUserAdmin.token, "")
+	assert.Equal(t, http.StatusConflict, res.StatusCode, body)
+}
+
+func TestWebServer_Tracing(t *testing.T) {
+	c := &Config{DSL: testDSL, JWTSecret: testJWTSecret, AdminPassword: "password"}
+	require.NoError(t, c.check())
+	tracer, rec := tracing.NewRecorder()
+	c.tracer = tracer
+
+	svc, err := c.newServices()
+	require.NoError(t, err)
+	defer svc.Close()
+	jobs, err := newScheduler(c, svc)
+	require.NoError(t, err)
+	ws := newWebServer(c, svc, jobs)
+
+	req := httptest.NewRequest("GET", "/api/v1/ratings/999999", nil)
+	req.Header.Add("Authorization", "Bearer "+testUserReadRatings.token)
+	req.Header.Add("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ws.eng.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	var queries []tracing.RecordedSpan
+	for _, s := range rec.Spans() {
+		if s.Name == "SELECT ratings" {
+			queries = append(queries, s)
+		}
+	}
+	require.NotEmpty(t, queries, "must trace the queries of the request")
+	for _, s := range queries {
+		assert.Equal(t, "GET /api/v1/ratings/:id", s.Parent, "must trace the queries as children of the request")
+	}
+}
+
+func TestWebServer_Health(t *testing.T) {
+	for _, path := range []string{"/health/live", "/health/ready"} {
+		res, err := http.Get(testURL + path)
+		require.NoError(t, err, "http client must not return any errors")
+
+		b, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(t, http.StatusOK, res.StatusCode, path)
+		assertJSONSimilar(t, `{"status":"ok"}`, string(b))
+	}
+}
+
+func TestWebServer_SecureHeaders(t *testing.T) {
+	var cases = []struct {
+		name        string
+		path        string
+		token       string
+		expectsCode int
+	}{
+		{"ok", "/health/live", "", http.StatusOK},
+		{"unauthorised", "/api/v1/roles/", "", http.StatusUnauthorized},
+		{"forbidden", "/api/v1/users/", testUserUser.token, http.StatusForbidden},
+		{"notFound", "/not/found", "", http.StatusNotFound},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", testURL+cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+			if cs.token != "" {
+				req.Header.Add("Authorization", "Bearer "+cs.token)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err, "http client must not return any errors")
+			res.Body.Close()
+
+			assert.Equal(t, cs.expectsCode, res.StatusCode)
+			assert.Equal(t, "nosniff", res.Header.Get("X-Content-Type-Options"))
+			assert.Equal(t, "deny", res.Header.Get("X-Frame-Options"))
+			assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", res.Header.Get("Content-Security-Policy"))
+			assert.Equal(t, "no-referrer", res.Header.Get("Referrer-Policy"))
+			assert.Empty(t, res.Header.Get("Strict-Transport-Security"), "must not be sent over plain HTTP")
+		})
+	}
+}
+
+func TestWebServer_Metrics(t *testing.T) {
+	res, err := http.Get(testURL + "/metrics")
+	require.NoError(t, err, "http client must not return any errors")
+
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, res.Header.Get("Content-Type"), "application/openmetrics-text")
+	assert.Contains(t, string(b), "# TYPE ratingsapp_active_users gauge\n")
+	assert.Contains(t, string(b), `ratingsapp_cache_hits_total{cache="ratings"}`)
+	assert.Contains(t, string(b), "# TYPE ratingsapp_db_connections_in_use gauge\n")
+	assert.True(t, strings.HasSuffix(string(b), "# EOF\n"))
+}
+
+func TestWebServer_Jobs(t *testing.T) {
+	do := func(t *testing.T, method, path, token, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, testURL+path, bytes.NewReader([]byte(body)))
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "http client must not return any errors")
+
+		b, _ := ioutil.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	res, body := do(t, "GET", "/api/v1/admin/jobs/", testUserAdmin.token, "")
+	require.Equal(t, http.StatusOK, res.StatusCode, body)
+	assert.Contains(t, body, `"dispatchOutbox"`)
+	assert.Contains(t, body, `"reconcileTargets"`)
+
+	res, body = do(t, "POST", "/api/v1/admin/jobs/dispatchOutbox/run", testUserAdmin.token, "")
+	assert.Equal(t, http.StatusAccepted, res.StatusCode, body)
+
+	res, body = do(t, "GET", "/api/v1/admin/jobs/", testUserUser.token, "")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode, body)
+}
+
+func TestWebServer_APIVersion(t *testing.T) {
+	var cases = []struct {
+		name           string
+		accept         string
+		expectsCode    int
+		expectsCType   string
+		expectsContent string
+	}{
+		{"noVersion", "application/json", http.StatusOK, "application/json", `{"items":[{"id":1}]}`},
+		{"v1", "application/vnd.ratingsapp.v1+json", http.StatusOK, "application/vnd.ratingsapp.v1+json", `{"items":[{"id":1}]}`},
+		{"unsupported", "application/vnd.ratingsapp.v9+json", http.StatusNotAcceptable, "application/json",
+			`{"error":"unsupported_version","supported":["application/vnd.ratingsapp.v1+json"]}`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", testURL+"/api/v1/roles/?id=1", nil)
+			req.Header.Add("Authorization", "Bearer "+testUserReadUsers.token)
+			req.Header.Add("Accept", cs.accept)
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err, "http client must not return any errors")
+
+			b, _ := ioutil.ReadAll(res.Body)
+			assert.Equal(t, cs.expectsCode, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), cs.expectsCType)
+			assertJSONSimilar(t, cs.expectsContent, string(b))
+		})
+	}
+}
+
+func TestUnguardedRoutes(t *testing.T) {
+	hdl := func(c *gin.Context) {}
+
+	mux := gin.New()
+	mux.POST("/api/v1/oauth/token/", hdl)
+	mux.GET("/health/live", hdl)
+	mux.GET("/api/v1/users/", middleware.Can(models.PermissionReadUsers, hdl))
+	mux.GET("/api/v1/me/settings", middleware.AnyUser(hdl))
+	mux.GET("/api/v1/ratings/", hdl)
+	mux.DELETE("/api/v1/ratings/:id", hdl)
+
+	assert.ElementsMatch(t, []string{"GET /api/v1/ratings/", "DELETE /api/v1/ratings/:id"}, unguardedRoutes(mux.Routes()))
+}
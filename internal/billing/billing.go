@@ -0,0 +1,172 @@
+/*
+Package billing implements the billing providers the daily usage of the tenants is pushed to, see
+models.BillingProvider.
+
+HTTP pushes the usage records as JSON to the usage API of a billing service, in the style of the
+Stripe usage records: each record is posted with an idempotency key identifying its tenant and
+day, and replaces any record posted before with the same key. The records of a day are listed
+back from the same API to reconcile them.
+*/
+package billing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+var (
+	wrap = errors.Wrapper("billing")
+)
+
+// DefaultTimeout is the time a request to the billing service can take.
+const DefaultTimeout = 30 * time.Second
+
+// dayFormat is the format of the days of the usage records.
+const dayFormat = "2006-01-02"
+
+// HTTP pushes the usage records to the usage API of a billing service.
+type HTTP struct {
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+// NewHTTP creates an HTTP provider for the usage API at endpoint, like
+// https://billing.example.com/v1/usage_records, authenticating with the bearer
+// token key, if not empty. The requests taking longer than timeout, or
+// DefaultTimeout if it is zero, are given up.
+func NewHTTP(endpoint, key string, timeout time.Duration) (*HTTP, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, wrap("invalid billing endpoint", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, wrap("billing endpoint must use the http or https scheme", nil)
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &HTTP{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		key:      key,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// usageRecord is a usage record as sent to and listed from the usage API.
+type usageRecord struct {
+	ID       string `json:"id,omitempty"`
+	Tenant   int64  `json:"tenant"`
+	Day      string `json:"day"`
+	APICalls int64  `json:"api_calls"`
+	Users    int64  `json:"users"`
+	Ratings  int64  `json:"ratings"`
+	Storage  int64  `json:"storage"`
+}
+
+// idempotencyKey identifies the record of a tenant and day for the usage API.
+func idempotencyKey(r models.UsageRecord) string {
+	return "usage-" + strconv.FormatInt(r.TenantID, 10) + "-" + r.Day.Format(dayFormat)
+}
+
+// Push posts r to the usage API, and returns the ID it was given. Any status
+// other than 2xx is an error.
+func (h *HTTP) Push(r models.UsageRecord) (string, error) {
+	body, err := json.Marshal(usageRecord{
+		Tenant:   r.TenantID,
+		Day:      r.Day.Format(dayFormat),
+		APICalls: r.APICalls,
+		Users:    r.Stored.Users,
+		Ratings:  r.Stored.Ratings,
+		Storage:  r.Stored.Storage,
+	})
+	if err != nil {
+		return "", wrap("could not encode usage record", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", wrap("invalid usage request", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey(r))
+
+	var created usageRecord
+	err = h.do(req, &created)
+	if err != nil {
+		return "", err
+	}
+
+	return created.ID, nil
+}
+
+// Records lists the records of day from the usage API, which returns them as
+// {"data": [...]}.
+func (h *HTTP) Records(day time.Time) ([]models.UsageRecord, error) {
+	req, err := http.NewRequest(http.MethodGet, h.endpoint+"?day="+day.Format(dayFormat), nil)
+	if err != nil {
+		return nil, wrap("invalid usage request", err)
+	}
+
+	var list struct {
+		Data []usageRecord `json:"data"`
+	}
+	err = h.do(req, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]models.UsageRecord, 0, len(list.Data))
+	for _, ur := range list.Data {
+		d, err := time.Parse(dayFormat, ur.Day)
+		if err != nil {
+			return nil, wrap("invalid day in usage record "+ur.ID, err)
+		}
+
+		records = append(records, models.UsageRecord{
+			TenantID: ur.Tenant,
+			Day:      d,
+			APICalls: ur.APICalls,
+			Stored:   models.TenantResources{Users: ur.Users, Ratings: ur.Ratings, Storage: ur.Storage},
+			Ref:      ur.ID,
+		})
+	}
+
+	return records, nil
+}
+
+// do sends req, decoding the JSON response in dst.
+func (h *HTTP) do(req *http.Request, dst interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "ratingsapp")
+	if h.key != "" {
+		req.Header.Set("Authorization", "Bearer "+h.key)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return wrap("could not reach billing service", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return wrap(fmt.Sprintf("billing service responded %d", resp.StatusCode), nil)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(dst)
+	if err != nil {
+		return wrap("invalid billing service response", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTP(t *testing.T) {
+	h, err := NewHTTP("https://billing.test.com/v1/usage_records/", "sk_test", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "https://billing.test.com/v1/usage_records", h.endpoint)
+	assert.Equal(t, DefaultTimeout, h.client.Timeout)
+
+	_, err = NewHTTP("ftp://billing.test.com", "", 0)
+	assert.Error(t, err)
+}
+
+func TestHTTP(t *testing.T) {
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var pushed []usageRecord
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+
+		switch r.Method {
+		case http.MethodPost:
+			var ur usageRecord
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&ur))
+			if ur.Tenant == 404 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			pushed = append(pushed, ur)
+			keys = append(keys, r.Header.Get("Idempotency-Key"))
+			ur.ID = "ur_1"
+			json.NewEncoder(w).Encode(ur)
+		case http.MethodGet:
+			assert.Equal(t, "2020-03-01", r.URL.Query().Get("day"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": pushed})
+		}
+	}))
+	defer srv.Close()
+
+	h, err := NewHTTP(srv.URL, "sk_test", 0)
+	require.NoError(t, err)
+
+	r := models.UsageRecord{
+		TenantID: 3,
+		Day:      day,
+		APICalls: 1200,
+		Stored:   models.TenantResources{Users: 4, Ratings: 80, Storage: 5120},
+	}
+	ref, err := h.Push(r)
+	require.NoError(t, err)
+	assert.Equal(t, "ur_1", ref)
+	assert.Equal(t, []string{"usage-3-2020-03-01"}, keys)
+	assert.Equal(t, []usageRecord{{Tenant: 3, Day: "2020-03-01", APICalls: 1200, Users: 4, Ratings: 80, Storage: 5120}}, pushed)
+
+	_, err = h.Push(models.UsageRecord{TenantID: 404, Day: day})
+	assert.Error(t, err, "must fail when the billing service does not accept the record")
+
+	records, err := h.Records(day)
+	require.NoError(t, err)
+	r.Ref = ""
+	assert.Equal(t, []models.UsageRecord{r}, records)
+}
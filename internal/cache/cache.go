@@ -0,0 +1,37 @@
+/*
+Package cache implements key-value caches used to reduce the load on the database for frequently
+read values.
+
+Two implementations of Cache are provided: LRU, an in-memory cache local to the process, and Redis,
+which allows sharing a cache between multiple instances of the application. Values are read through a
+Loader, which protects their sources from stampedes and counts hits and misses.
+*/
+package cache
+
+import (
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+)
+
+var (
+	wrap = errors.Wrapper("cache")
+)
+
+// Cache defines a store of values with an expiration time. Values are opaque byte slices, it is
+// up to the callers to encode them.
+type Cache interface {
+	// Get retrieves the value stored with key. The boolean result is false if the key is not
+	// found or it has expired.
+	Get(key string) ([]byte, bool, error)
+
+	// Set stores value with key, replacing any previous value. The value expires after ttl. A
+	// ttl of zero or lower never expires.
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the values stored with keys. Missing keys are ignored.
+	Delete(keys ...string) error
+
+	// Flush removes all the values.
+	Flush() error
+}
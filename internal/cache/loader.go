@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Loader reads values through a Cache, loading the missing ones from their source. It is the
+// entry point used by the cached services, so all of them share the same behaviour:
+//
+//   - Concurrent loads of the same key are coalesced, so a popular value that expires is loaded
+//     once instead of once per request (stampede protection).
+//   - Cache errors are handled as misses, so values are loaded from their source instead.
+//   - Hits, misses and errors are counted, see Stats.
+//
+// A Loader is safe for concurrent use.
+type Loader struct {
+	cache Cache
+
+	mu    sync.Mutex
+	calls map[string]*loaderCall
+
+	hits, misses, loads, errors uint64
+}
+
+// loaderCall is a load in progress. Its value is only cached if none of its keys is deleted while
+// it runs, as it could be stale.
+type loaderCall struct {
+	done      chan struct{}
+	value     []byte
+	err       error
+	forgotten bool
+}
+
+// Stats holds the counters of a Loader since it was created.
+type Stats struct {
+	// Hits is the number of values found in the cache.
+	Hits uint64 `json:"hits"`
+
+	// Misses is the number of values not found in the cache.
+	Misses uint64 `json:"misses"`
+
+	// Loads is the number of values loaded from their source. It is lower
+	// than Misses when concurrent loads are coalesced.
+	Loads uint64 `json:"loads"`
+
+	// Errors is the number of failed cache operations.
+	Errors uint64 `json:"errors"`
+}
+
+// NewLoader creates a new Loader that keeps values in c.
+func NewLoader(c Cache) *Loader {
+	return &Loader{cache: c, calls: make(map[string]*loaderCall)}
+}
+
+// Get looks up key in the cache. The boolean result is false if it is missing or could not be
+// read.
+func (l *Loader) Get(key string) ([]byte, bool) {
+	v, ok, err := l.cache.Get(key)
+	if err != nil {
+		atomic.AddUint64(&l.errors, 1)
+		ok = false
+	}
+
+	if ok {
+		atomic.AddUint64(&l.hits, 1)
+	} else {
+		atomic.AddUint64(&l.misses, 1)
+	}
+
+	return v, ok
+}
+
+// Set stores value with key for ttl. Values that cannot be stored are just not cached.
+func (l *Loader) Set(key string, value []byte, ttl time.Duration) {
+	if l.cache.Set(key, value, ttl) != nil {
+		atomic.AddUint64(&l.errors, 1)
+	}
+}
+
+// Load returns the value cached with key, calling load to get it when missing. The loaded value
+// is cached for ttl. Only one load runs at a time for each key: concurrent callers wait for it
+// and share its result. Errors returned by load are not cached.
+func (l *Loader) Load(key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	if v, ok := l.Get(key); ok {
+		return v, nil
+	}
+
+	l.mu.Lock()
+	if c, ok := l.calls[key]; ok {
+		l.mu.Unlock()
+		<-c.done
+		return c.value, c.err
+	}
+
+	c := &loaderCall{done: make(chan struct{})}
+	l.calls[key] = c
+	l.mu.Unlock()
+
+	atomic.AddUint64(&l.loads, 1)
+	c.value, c.err = load()
+
+	l.mu.Lock()
+	if !c.forgotten {
+		delete(l.calls, key)
+		if c.err == nil {
+			l.Set(key, c.value, ttl)
+		}
+	}
+	l.mu.Unlock()
+
+	close(c.done)
+	return c.value, c.err
+}
+
+// Delete removes the values stored with keys. The loads of these keys in progress are not
+// cached, and the next calls to Load start new ones.
+func (l *Loader) Delete(keys ...string) error {
+	l.mu.Lock()
+	for _, k := range keys {
+		if c, ok := l.calls[k]; ok {
+			c.forgotten = true
+			delete(l.calls, k)
+		}
+	}
+	l.mu.Unlock()
+
+	err := l.cache.Delete(keys...)
+	if err != nil {
+		atomic.AddUint64(&l.errors, 1)
+		return wrap("could not delete values", err)
+	}
+
+	return nil
+}
+
+// Flush removes all the values of the cache, as Delete does for each of their keys. The loads in
+// progress are not cached.
+func (l *Loader) Flush() error {
+	l.mu.Lock()
+	for k, c := range l.calls {
+		c.forgotten = true
+		delete(l.calls, k)
+	}
+	l.mu.Unlock()
+
+	err := l.cache.Flush()
+	if err != nil {
+		atomic.AddUint64(&l.errors, 1)
+		return wrap("could not flush values", err)
+	}
+
+	return nil
+}
+
+// Stats returns the counters of l.
+func (l *Loader) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&l.hits),
+		Misses: atomic.LoadUint64(&l.misses),
+		Loads:  atomic.LoadUint64(&l.loads),
+		Errors: atomic.LoadUint64(&l.errors),
+	}
+}
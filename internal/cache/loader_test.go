@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingCache is a Cache whose operations always fail.
+type failingCache struct{}
+
+func (failingCache) Get(key string) ([]byte, bool, error) {
+	return nil, false, wrap("test get error", nil)
+}
+
+func (failingCache) Set(key string, value []byte, ttl time.Duration) error {
+	return wrap("test set error", nil)
+}
+
+func (failingCache) Delete(keys ...string) error {
+	return wrap("test delete error", nil)
+}
+
+func (failingCache) Flush() error {
+	return wrap("test flush error", nil)
+}
+
+func TestLoader(t *testing.T) {
+	l := NewLoader(NewLRU(10))
+
+	var loads int
+	load := func() ([]byte, error) {
+		loads++
+		return []byte("value"), nil
+	}
+
+	t.Run("loadsMissing", func(t *testing.T) {
+		v, err := l.Load("a", 0, load)
+		require.NoError(t, err)
+		assert.Equal(t, "value", string(v))
+
+		v, err = l.Load("a", 0, load)
+		require.NoError(t, err)
+		assert.Equal(t, "value", string(v))
+
+		assert.Equal(t, 1, loads)
+		assert.Equal(t, Stats{Hits: 1, Misses: 1, Loads: 1}, l.Stats())
+	})
+
+	t.Run("errorsNotCached", func(t *testing.T) {
+		_, err := l.Load("b", 0, func() ([]byte, error) { return nil, wrap("test load error", nil) })
+		assert.Error(t, err)
+
+		_, ok := l.Get("b")
+		assert.False(t, ok)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, l.Delete("a"))
+
+		_, err := l.Load("a", 0, load)
+		require.NoError(t, err)
+		assert.Equal(t, 2, loads)
+	})
+
+	t.Run("coalescesLoads", func(t *testing.T) {
+		l := NewLoader(NewLRU(10))
+		release := make(chan struct{})
+
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			runs int
+		)
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := l.Load("k", 0, func() ([]byte, error) {
+					mu.Lock()
+					runs++
+					mu.Unlock()
+					<-release
+					return []byte("shared"), nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, "shared", string(v))
+			}()
+		}
+
+		// wait for every goroutine to miss before releasing the load
+		for l.Stats().Misses < 5 {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, 1, runs)
+		assert.Equal(t, uint64(1), l.Stats().Loads)
+	})
+
+	t.Run("deleteDuringLoad", func(t *testing.T) {
+		l := NewLoader(NewLRU(10))
+
+		_, err := l.Load("k", 0, func() ([]byte, error) {
+			require.NoError(t, l.Delete("k"))
+			return []byte("stale"), nil
+		})
+		require.NoError(t, err)
+
+		_, ok := l.Get("k")
+		assert.False(t, ok, "values loaded before a delete must not be cached")
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		l := NewLoader(NewLRU(10))
+		l.Set("a", []byte("1"), 0)
+
+		_, err := l.Load("k", 0, func() ([]byte, error) {
+			require.NoError(t, l.Flush())
+			return []byte("stale"), nil
+		})
+		require.NoError(t, err)
+
+		_, ok := l.Get("a")
+		assert.False(t, ok)
+		_, ok = l.Get("k")
+		assert.False(t, ok, "values loaded before a flush must not be cached")
+	})
+
+	t.Run("cacheErrors", func(t *testing.T) {
+		l := NewLoader(failingCache{})
+
+		v, err := l.Load("k", 0, load)
+		require.NoError(t, err, "cache errors must be handled as misses")
+		assert.Equal(t, "value", string(v))
+		assert.Error(t, l.Delete("k"))
+		assert.Error(t, l.Flush())
+
+		assert.Equal(t, Stats{Misses: 1, Loads: 1, Errors: 4}, l.Stats())
+	})
+}
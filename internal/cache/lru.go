@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Cache that holds a maximum number of values. When full, the least recently
+// used value is evicted to make room for new ones. It is safe for concurrent use.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+
+	// now returns the current time. It is replaced when testing.
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU creates a new LRU cache that holds up to size values. size must be greater than zero.
+func NewLRU(size int) *LRU {
+	if size < 1 {
+		panic(wrap("LRU size must be greater than zero", nil))
+	}
+
+	return &LRU{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get implements Cache.Get. It never returns an error.
+func (l *LRU) Get(key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && !l.now().Before(e.expires) {
+		l.remove(el)
+		return nil, false, nil
+	}
+
+	l.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+// Set implements Cache.Set. It never returns an error.
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = l.now().Add(ttl)
+	}
+
+	if el, ok := l.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value = value
+		e.expires = expires
+		l.order.MoveToFront(el)
+		return nil
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	if l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+
+	return nil
+}
+
+// Delete implements Cache.Delete. It never returns an error.
+func (l *LRU) Delete(keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, k := range keys {
+		if el, ok := l.entries[k]; ok {
+			l.remove(el)
+		}
+	}
+
+	return nil
+}
+
+// Flush implements Cache.Flush. It never returns an error.
+func (l *LRU) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = make(map[string]*list.Element, l.size)
+	l.order.Init()
+	return nil
+}
+
+// Len returns the number of values stored, including the expired ones not evicted yet.
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.order.Len()
+}
+
+// remove drops el from the cache. The caller must hold l.mu.
+func (l *LRU) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.entries, el.Value.(*lruEntry).key)
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Unix(1257894000, 0)
+
+	l := NewLRU(2)
+	l.now = func() time.Time { return now }
+
+	assertGet := func(t *testing.T, key, value string, found bool) {
+		v, ok, err := l.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, found, ok, "key %s", key)
+		if found {
+			assert.Equal(t, value, string(v))
+		}
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		assertGet(t, "a", "", false)
+	})
+
+	t.Run("setGet", func(t *testing.T) {
+		assert.NoError(t, l.Set("a", []byte("1"), 0))
+		assert.NoError(t, l.Set("b", []byte("2"), 0))
+		assertGet(t, "a", "1", true)
+		assertGet(t, "b", "2", true)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		assert.NoError(t, l.Set("a", []byte("3"), 0))
+		assertGet(t, "a", "3", true)
+		assert.Equal(t, 2, l.Len())
+	})
+
+	t.Run("evictsLeastRecentlyUsed", func(t *testing.T) {
+		// "b" was used after "a" was replaced, so "a" is the oldest
+		assertGet(t, "b", "2", true)
+		assert.NoError(t, l.Set("c", []byte("4"), 0))
+
+		assertGet(t, "a", "", false)
+		assertGet(t, "b", "2", true)
+		assertGet(t, "c", "4", true)
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		assert.NoError(t, l.Set("d", []byte("5"), time.Minute))
+		assertGet(t, "d", "5", true)
+
+		now = now.Add(time.Minute)
+		assertGet(t, "d", "", false)
+		assert.Equal(t, 1, l.Len())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, l.Delete("c", "unknown"))
+		assertGet(t, "c", "", false)
+		assert.Equal(t, 0, l.Len())
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		assert.NoError(t, l.Set("e", []byte("6"), 0))
+		assert.NoError(t, l.Set("f", []byte("7"), 0))
+		assert.NoError(t, l.Flush())
+		assertGet(t, "e", "", false)
+		assert.Equal(t, 0, l.Len())
+
+		assert.NoError(t, l.Set("g", []byte("8"), 0))
+		assertGet(t, "g", "8", true)
+	})
+
+	t.Run("invalidSize", func(t *testing.T) {
+		assert.Panics(t, func() {
+			NewLRU(0)
+		})
+	})
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/xerrors"
+)
+
+// redisTimeout is the timeout of the connections to the Redis server, and of
+// the commands sent.
+const redisTimeout = 2 * time.Second
+
+// Redis is a Cache backed by a Redis server, which allows sharing cached values between processes.
+// It keeps a pool of connections and is safe for concurrent use.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis creates a Redis cache from a URL with the format
+// "redis://[:password@]host[:port][/db]", or "rediss://" to connect over TLS. Every key is
+// prefixed with prefix, which allows sharing a Redis database with other applications.
+//
+// No connection is made until the cache is first used.
+func NewRedis(rawurl, prefix string) (*Redis, error) {
+	opts, err := redis.ParseURL(rawurl)
+	if err != nil {
+		return nil, wrap("invalid redis URL", err)
+	}
+
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+
+	return &Redis{client: redis.NewClient(opts), prefix: prefix}, nil
+}
+
+// Get implements Cache.Get.
+func (r *Redis) Get(key string) ([]byte, bool, error) {
+	v, err := r.client.Get(context.Background(), r.prefix+key).Bytes()
+	if xerrors.Is(err, redis.Nil) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, wrap("redis GET failed", err)
+	}
+
+	return v, true, nil
+}
+
+// Set implements Cache.Set.
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	switch {
+	case ttl < 0:
+		// a negative TTL keeps the TTL of the previous value
+		ttl = 0
+	case ttl > 0 && ttl < time.Millisecond:
+		ttl = time.Millisecond
+	}
+
+	err := r.client.Set(context.Background(), r.prefix+key, value, ttl).Err()
+	if err != nil {
+		return wrap("redis SET failed", err)
+	}
+
+	return nil
+}
+
+// Delete implements Cache.Delete.
+func (r *Redis) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, k := range keys {
+		prefixed[i] = r.prefix + k
+	}
+
+	err := r.client.Del(context.Background(), prefixed...).Err()
+	if err != nil {
+		return wrap("redis DEL failed", err)
+	}
+
+	return nil
+}
+
+// Flush implements Cache.Flush. Only the keys with the prefix of r are removed, the other ones
+// are left to the applications sharing the database.
+func (r *Redis) Flush() error {
+	ctx := context.Background()
+	iter := r.client.Scan(ctx, 0, r.prefix+"*", 0).Iterator()
+
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return wrap("redis SCAN failed", err)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := r.client.Del(ctx, keys...).Err()
+	if err != nil {
+		return wrap("redis DEL failed", err)
+	}
+
+	return nil
+}
+
+// Client returns the client of the Redis server, which allows using it for more than caching.
+// Unlike the Cache methods, the keys of its commands are not prefixed.
+func (r *Redis) Client() *redis.Client {
+	return r.client
+}
+
+// Close closes the connections to the server.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
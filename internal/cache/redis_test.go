@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedis(t *testing.T) {
+	var cases = []struct {
+		name     string
+		url      string
+		addr     string
+		password string
+		db       int
+		fails    bool
+	}{
+		{"defaults", "redis://cache", "cache:6379", "", 0, false},
+		{"full", "redis://:pass@cache:7000/3", "cache:7000", "pass", 3, false},
+		{"badScheme", "http://cache", "", "", 0, true},
+		{"badDB", "redis://cache/first", "", "", 0, true},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			r, err := NewRedis(cs.url, "")
+			if cs.fails {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			opts := r.Client().Options()
+			assert.Equal(t, cs.addr, opts.Addr)
+			assert.Equal(t, cs.password, opts.Password)
+			assert.Equal(t, cs.db, opts.DB)
+		})
+	}
+}
+
+func TestRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+
+	r, err := NewRedis("redis://:secret@"+mr.Addr()+"/2", "test:")
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, ok, err := r.Get("a")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, r.Set("a", []byte("line\r\nbreak"), 1500*time.Millisecond))
+	assert.NoError(t, r.Set("b", []byte("2"), 0))
+
+	v, ok, err := r.Get("a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "line\r\nbreak", string(v))
+
+	mr.Select(2)
+	assert.Equal(t, 1500*time.Millisecond, mr.TTL("test:a"))
+	assert.Equal(t, time.Duration(0), mr.TTL("test:b"), "must not expire")
+
+	assert.NoError(t, r.Delete("a", "b"))
+	assert.NoError(t, r.Delete())
+
+	_, ok, err = r.Get("b")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, mr.Keys())
+
+	t.Run("expiry", func(t *testing.T) {
+		assert.NoError(t, r.Set("c", []byte("3"), time.Microsecond))
+		assert.Equal(t, time.Millisecond, mr.TTL("test:c"), "must expire in a millisecond at least")
+
+		mr.FastForward(time.Millisecond)
+		_, ok, err := r.Get("c")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		assert.NoError(t, r.Set("d", []byte("4"), 0))
+		assert.NoError(t, r.Set("e", []byte("5"), 0))
+		assert.NoError(t, mr.Set("other:f", "6"))
+
+		assert.NoError(t, r.Flush())
+		assert.Equal(t, []string{"other:f"}, mr.Keys(), "must only remove the keys with the prefix")
+		assert.NoError(t, r.Flush())
+		mr.Del("other:f")
+	})
+
+	t.Run("client", func(t *testing.T) {
+		assert.NoError(t, r.Client().Set(context.Background(), "raw", "1", 0).Err())
+		assert.True(t, mr.Exists("raw"), "must not prefix the keys")
+	})
+
+	t.Run("badPassword", func(t *testing.T) {
+		r, err := NewRedis("redis://:wrong@"+mr.Addr(), "")
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, _, err = r.Get("a")
+		assert.Error(t, err)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		r, err := NewRedis("redis://127.0.0.1:1", "")
+		require.NoError(t, err)
+		defer r.Close()
+
+		err = r.Set("a", []byte("1"), 0)
+		assert.Error(t, err)
+	})
+}
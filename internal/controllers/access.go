@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Access implements a controller reporting the permissions of the users, for the access
+// certification reviews.
+type Access struct {
+	us  models.UserService
+	rls models.RoleService
+
+	viewErr views.Error
+}
+
+// NewAccess creates a new Access controller.
+func NewAccess(us models.UserService, rls models.RoleService) *Access {
+	return &Access{
+		us:  us,
+		rls: rls,
+	}
+}
+
+// Report returns the effective permissions of every user, sorted by ID, as a JSON document or,
+// if the "format" parameter is "csv", as a CSV file with a column by permission.
+//
+// GET /api/v1/admin/access-report
+// GET /api/v1/admin/access-report?format=csv
+func (a *Access) Report(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		a.viewErr.JSON(c, models.ValidationError{"format": models.ErrInvalid})
+		return
+	}
+
+	users, err := a.us.Search(models.SearchQuery{})
+	if err != nil {
+		a.viewErr.JSON(c, err)
+		return
+	}
+
+	roles, err := a.rls.ByIDs()
+	if err != nil {
+		a.viewErr.JSON(c, err)
+		return
+	}
+
+	report := models.AccessReport(users, roles)
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"generatedAt": time.Now().UTC().Format(time.RFC3339),
+			"permissions": models.PermissionNames(),
+			"items":       report,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="access-report.csv"`)
+	c.Status(http.StatusOK)
+
+	names := models.PermissionNames()
+	w := csv.NewWriter(c.Writer)
+	w.Write(append([]string{"userId", "email", "active", "roleId", "role", "admin"}, names...))
+	for _, ua := range report {
+		row := []string{
+			strconv.FormatInt(ua.UserID, 10),
+			ua.Email,
+			strconv.FormatBool(ua.Active),
+			strconv.FormatInt(ua.RoleID, 10),
+			ua.Role,
+			strconv.FormatBool(ua.Admin),
+		}
+
+		granted := make(map[string]bool, len(names))
+		for _, p := range ua.Permissions.Names() {
+			granted[p] = true
+		}
+		for _, p := range names {
+			row = append(row, strconv.FormatBool(granted[p]))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccess_Report(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	rls := &modelstest.RoleService{}
+	a := NewAccess(us, rls)
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/access-report", a.Report)
+
+	services := func(t *testing.T) {
+		us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+			assert.Equal(t, models.SearchQuery{}, q)
+			return []models.User{
+				{ID: 1, Active: true, Email: "admin@test.com", RoleID: 1},
+				{ID: 3, Active: false, Email: "user@test.com", RoleID: 2},
+			}, nil
+		}
+		rls.ByIDsFunc = func(ids ...int64) ([]models.Role, error) {
+			assert.Empty(t, ids)
+			return []models.Role{
+				{ID: 1, Label: "admin", Permissions: models.PermissionReadUsers | models.PermissionWriteUsers | models.PermissionReadRatings | models.PermissionWriteRatings},
+				{ID: 2, Label: "user", Permissions: models.PermissionReadRatings},
+			}, nil
+		}
+	}
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outBody   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"formatInvalid",
+			"/api/v1/admin/access-report?format=xml",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"format":"invalid"}}`,
+			nil,
+		},
+		{
+			"internalError",
+			"/api/v1/admin/access-report",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					return nil, privateError("test error message")
+				}
+			},
+		},
+		{
+			"json",
+			"/api/v1/admin/access-report",
+			http.StatusOK,
+			`{"permissions":["readUsers","writeUsers","readRatings","writeRatings","writeOwnRatings"],"items":[
+				{"userId":1,"email":"admin@test.com","active":true,"roleId":1,"role":"admin","admin":true,
+				 "permissions":["readUsers","writeUsers","readRatings","writeRatings"]},
+				{"userId":3,"email":"user@test.com","active":false,"roleId":2,"role":"user","admin":false,"permissions":[]}
+			]}`,
+			services,
+		},
+		{
+			"csv",
+			"/api/v1/admin/access-report?format=csv",
+			http.StatusOK,
+			"userId,email,active,roleId,role,admin,readUsers,writeUsers,readRatings,writeRatings,writeOwnRatings\n" +
+				"1,admin@test.com,true,1,admin,true,true,true,true,true,false\n" +
+				"3,user@test.com,false,2,user,false,false,false,false,false,false\n",
+			services,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+			c.Request.Header.Add("Accept", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			switch {
+			case cs.name == "csv":
+				assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename="access-report.csv"`, w.Header().Get("Content-Disposition"))
+				assert.Equal(t, cs.outBody, w.Body.String())
+			case cs.name == "json":
+				var out map[string]interface{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+				assert.NotEmpty(t, out["generatedAt"])
+				delete(out, "generatedAt")
+
+				body, _ := json.Marshal(out)
+				assert.JSONEq(t, cs.outBody, string(body))
+			default:
+				assert.JSONEq(t, cs.outBody, w.Body.String())
+			}
+
+			*us = modelstest.UserService{}
+			*rls = modelstest.RoleService{}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// AlertRules implements a controller for the management of the alert rules.
+type AlertRules struct {
+	as models.AlertService
+
+	viewErr views.Error
+}
+
+// NewAlertRules creates a new AlertRules controller.
+func NewAlertRules(as models.AlertService) *AlertRules {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrRefNotFound, http.StatusNotFound)
+
+	return &AlertRules{
+		as:      as,
+		viewErr: ev,
+	}
+}
+
+// Create performs the addition of an alert rule, owned by the requester, who receives its alerts.
+//
+// POST /api/v1/alert-rules/
+func (ar *AlertRules) Create(c *gin.Context) {
+	var rule models.AlertRule
+
+	err := parseJSON(c, &rule)
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+	rule.OwnerID = middleware.Actor(c).ID
+
+	err = ar.as.Create(&rule)
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &rule)
+}
+
+// Update performs the change of an alert rule. Its owner is kept.
+//
+// PUT /api/v1/alert-rules/:id
+func (ar *AlertRules) Update(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	var rule models.AlertRule
+
+	err = parseJSON(c, &rule)
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+	rule.ID = id
+
+	err = ar.as.Update(&rule)
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &rule)
+}
+
+// Delete performs the removal of an alert rule, along with its alerts.
+//
+// DELETE /api/v1/alert-rules/:id
+func (ar *AlertRules) Delete(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	err = ar.as.Delete(id)
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// Get returns one alert rule by ID to the requester.
+//
+// GET /api/v1/alert-rules/:id
+func (ar *AlertRules) Get(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	rule, err := ar.as.ByID(id)
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &rule)
+}
+
+// List returns all the alert rules.
+//
+// GET /api/v1/alert-rules/
+func (ar *AlertRules) List(c *gin.Context) {
+	rules, err := ar.as.List()
+	if err != nil {
+		ar.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": rules,
+	})
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := &modelstest.AlertService{}
+	ar := NewAlertRules(as)
+
+	created := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	rule := models.AlertRule{
+		ID:         4,
+		Name:       "Shoes",
+		Tag:        "shoes",
+		WindowDays: 7,
+		Below:      3,
+		OwnerID:    1,
+		Channel:    models.ChannelInApp,
+		CreatedAt:  created,
+	}
+	const ruleJSON = `{"id":4,"name":"Shoes","tag":"shoes","windowDays":7,"below":3,"ownerId":1,"channel":"inApp",` +
+		`"createdAt":"2020-03-01T00:00:00Z"}`
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	})
+	mux.GET("/api/v1/alert-rules/", ar.List)
+	mux.GET("/api/v1/alert-rules/:id", ar.Get)
+	mux.POST("/api/v1/alert-rules/", ar.Create)
+	mux.PUT("/api/v1/alert-rules/:id", ar.Update)
+	mux.DELETE("/api/v1/alert-rules/:id", ar.Delete)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/alert-rules/",
+			"",
+			http.StatusOK,
+			`{"items":[` + ruleJSON + `]}`,
+			func(t *testing.T) {
+				as.ListFunc = func() ([]models.AlertRule, error) {
+					return []models.AlertRule{rule}, nil
+				}
+			},
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/alert-rules/4",
+			"",
+			http.StatusOK,
+			ruleJSON,
+			func(t *testing.T) {
+				as.ByIDFunc = func(id int64) (models.AlertRule, error) {
+					assert.Equal(t, int64(4), id)
+					return rule, nil
+				}
+			},
+		},
+		{
+			"getNotFound",
+			"GET",
+			"/api/v1/alert-rules/5",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				as.ByIDFunc = func(id int64) (models.AlertRule, error) {
+					return models.AlertRule{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"create",
+			"POST",
+			"/api/v1/alert-rules/",
+			`{"name":"Shoes","tag":"shoes","below":3,"channel":"inApp","ownerId":9}`,
+			http.StatusCreated,
+			ruleJSON,
+			func(t *testing.T) {
+				as.CreateFunc = func(r *models.AlertRule) error {
+					assert.Equal(t, int64(1), r.OwnerID, "must be owned by the requester")
+					r.ID, r.WindowDays, r.CreatedAt = 4, 7, created
+					return nil
+				}
+			},
+		},
+		{
+			"createInvalid",
+			"POST",
+			"/api/v1/alert-rules/",
+			`{"name":"Shoes","channel":"inApp"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"target":"required","below":"required"}}`,
+			func(t *testing.T) {
+				as.CreateFunc = func(r *models.AlertRule) error {
+					return models.ValidationError{"target": models.ErrRequired, "below": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"update",
+			"PUT",
+			"/api/v1/alert-rules/4",
+			`{"name":"Shoes","tag":"shoes","below":3,"channel":"inApp"}`,
+			http.StatusOK,
+			ruleJSON,
+			func(t *testing.T) {
+				as.UpdateFunc = func(r *models.AlertRule) error {
+					assert.Equal(t, int64(4), r.ID)
+					*r = rule
+					return nil
+				}
+			},
+		},
+		{
+			"delete",
+			"DELETE",
+			"/api/v1/alert-rules/4",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				as.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(4), id)
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*as = modelstest.AlertService{}
+		})
+	}
+}
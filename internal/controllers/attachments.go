@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+	"golang.org/x/xerrors"
+)
+
+// maxAttachmentRequest is the maximum size of the body of a request uploading an attachment,
+// leaving room for the multipart headers.
+const maxAttachmentRequest = models.MaxAttachmentSize + 64<<10
+
+// Attachments implements a controller for the files attached to the ratings.
+type Attachments struct {
+	as models.AttachmentService
+	rs models.RatingService
+
+	viewErr views.Error
+}
+
+// NewAttachments creates a new Attachments controller. rs is used to check that the ratings of
+// the attachments are visible to the user. The attachments are not found when as is nil.
+func NewAttachments(as models.AttachmentService, rs models.RatingService) *Attachments {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(ErrForbidden, http.StatusForbidden)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	return &Attachments{
+		as:      as,
+		rs:      rs,
+		viewErr: ev,
+	}
+}
+
+// Create performs the upload of a file attached to a rating, sent as the "file" field of a
+// multipart form. Only the author of the rating or an administrator can attach files to it.
+//
+// POST /api/v1/ratings/:id/attachments
+func (ac *Attachments) Create(c *gin.Context) {
+	if ac.as == nil {
+		ac.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	rating, err := ac.rating(c)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	u := middleware.Actor(c)
+	if rating.UserID != u.ID && !u.ModeratesRatings() {
+		ac.viewErr.JSON(c, ErrForbidden)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentRequest)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case xerrors.As(err, &tooLarge):
+			err = models.ValidationError{"file": models.ErrTooLong}
+		case xerrors.Is(err, http.ErrMissingFile):
+			err = models.ValidationError{"file": models.ErrRequired}
+		default:
+			err = ErrInvalidFormInput
+		}
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		ac.viewErr.JSON(c, wrapi("could not open the uploaded file", err))
+		return
+	}
+	defer f.Close()
+
+	a := models.Attachment{
+		RatingID: rating.ID,
+		UserID:   u.ID,
+		Name:     fh.Filename,
+		Size:     fh.Size,
+	}
+
+	err = ac.as.Create(&a, f)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &a)
+}
+
+// Get serves the content of an attachment, if its rating is visible to the requester.
+//
+// GET /api/v1/attachments/:id
+func (ac *Attachments) Get(c *gin.Context) {
+	if ac.as == nil {
+		ac.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	a, err := ac.as.ByID(id)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	_, err = ac.rs.Scoped(middleware.Actor(c).User).ByID(a.RatingID)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	f, err := ac.as.Open(a)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+	defer f.Close()
+
+	c.DataFromReader(http.StatusOK, a.Size, a.ContentType, f, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// Delete removes an attachment of a rating, and its content. Only the user who uploaded it or
+// an administrator can remove it.
+//
+// DELETE /api/v1/ratings/:id/attachments/:attachmentId
+func (ac *Attachments) Delete(c *gin.Context) {
+	if ac.as == nil {
+		ac.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	rating, err := ac.rating(c)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	id, err := getParamInt(c, "attachmentId")
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	a, err := ac.as.ByID(id)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	} else if a.RatingID != rating.ID {
+		ac.viewErr.JSON(c, models.ErrNotFound)
+		return
+	}
+
+	u := middleware.Actor(c)
+	if a.UserID != u.ID && !u.ModeratesRatings() {
+		ac.viewErr.JSON(c, ErrForbidden)
+		return
+	}
+
+	err = ac.as.Delete(rating.ID, a.ID)
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// rating returns the rating of the path of a request, if visible to the requester.
+func (ac *Attachments) rating(c *gin.Context) (models.Rating, error) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		return models.Rating{}, err
+	}
+
+	return ac.rs.Scoped(middleware.Actor(c).User).ByID(id)
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// multipartFile returns the body and the content type of a multipart form sending content as
+// the "file" field, or no file if content is nil.
+func multipartFile(t *testing.T, name string, content []byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if content != nil {
+		fw, err := mw.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = fw.Write(content)
+		require.NoError(t, err)
+	} else {
+		require.NoError(t, mw.WriteField("other", "value"))
+	}
+	require.NoError(t, mw.Close())
+
+	return &body, mw.FormDataContentType()
+}
+
+func TestAttachments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := &modelstest.AttachmentService{}
+	rs := &modelstest.RatingService{}
+	ac := NewAttachments(as, rs)
+
+	created := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	attachment := models.Attachment{ID: 4, RatingID: 10, UserID: 7, Key: "attachments/abc", Name: "picture.png", ContentType: "image/png", Size: 5, CreatedAt: created}
+	const attachmentJSON = `{"id":4,"ratingId":10,"userId":7,"name":"picture.png","contentType":"image/png","size":5,"createdAt":"2020-03-01T00:00:00Z"}`
+
+	var user *models.User
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", user)
+	})
+	mux.POST("/api/v1/ratings/:id/attachments", ac.Create)
+	mux.DELETE("/api/v1/ratings/:id/attachments/:attachmentId", ac.Delete)
+	mux.GET("/api/v1/attachments/:id", ac.Get)
+
+	author := &models.User{ID: 7, RoleID: 2}
+	admin := &models.User{ID: 1, RoleID: 1}
+	other := &models.User{ID: 8, RoleID: 2}
+
+	rating := func(t *testing.T) {
+		rs.ByIDFunc = func(id int64) (models.Rating, error) {
+			if id != 10 {
+				return models.Rating{}, models.ErrNotFound
+			}
+			return models.Rating{ID: 10, Target: 9, UserID: 7}, nil
+		}
+		as.ByIDFunc = func(id int64) (models.Attachment, error) {
+			if id != 4 {
+				return models.Attachment{}, models.ErrNotFound
+			}
+			return attachment, nil
+		}
+	}
+
+	var cases = []struct {
+		name      string
+		user      *models.User
+		method    string
+		path      string
+		content   []byte
+		outStatus int
+		outBody   string
+		setup     func(*testing.T)
+	}{
+		{
+			"create",
+			author,
+			"POST",
+			"/api/v1/ratings/10/attachments",
+			[]byte("\x89PNG"),
+			http.StatusCreated,
+			attachmentJSON,
+			func(t *testing.T) {
+				rating(t)
+				as.CreateFunc = func(a *models.Attachment, content io.ReadSeeker) error {
+					assert.Equal(t, models.Attachment{RatingID: 10, UserID: 7, Name: "picture.png", Size: 4}, *a)
+					read, err := ioutil.ReadAll(content)
+					assert.NoError(t, err)
+					assert.Equal(t, []byte("\x89PNG"), read)
+					*a = attachment
+					return nil
+				}
+			},
+		},
+		{
+			"createForbidden",
+			other,
+			"POST",
+			"/api/v1/ratings/10/attachments",
+			[]byte("\x89PNG"),
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+			rating,
+		},
+		{
+			"createRatingNotFound",
+			admin,
+			"POST",
+			"/api/v1/ratings/11/attachments",
+			[]byte("\x89PNG"),
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			rating,
+		},
+		{
+			"createWithoutFile",
+			author,
+			"POST",
+			"/api/v1/ratings/10/attachments",
+			nil,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"file":"required"}}`,
+			rating,
+		},
+		{
+			"createTooLarge",
+			author,
+			"POST",
+			"/api/v1/ratings/10/attachments",
+			make([]byte, maxAttachmentRequest),
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"file":"too_long"}}`,
+			rating,
+		},
+		{
+			"createInvalid",
+			admin,
+			"POST",
+			"/api/v1/ratings/10/attachments",
+			[]byte("text"),
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"file":"invalid"}}`,
+			func(t *testing.T) {
+				rating(t)
+				as.CreateFunc = func(a *models.Attachment, content io.ReadSeeker) error {
+					assert.Equal(t, int64(1), a.UserID)
+					return models.ValidationError{"file": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"get",
+			other,
+			"GET",
+			"/api/v1/attachments/4",
+			nil,
+			http.StatusOK,
+			"\x89PNG!",
+			func(t *testing.T) {
+				rating(t)
+				as.OpenFunc = func(a models.Attachment) (io.ReadCloser, error) {
+					assert.Equal(t, "attachments/abc", a.Key)
+					return ioutil.NopCloser(bytes.NewBufferString("\x89PNG!")), nil
+				}
+			},
+		},
+		{
+			"getHiddenRating",
+			other,
+			"GET",
+			"/api/v1/attachments/4",
+			nil,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rating(t)
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					return models.Rating{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"delete",
+			author,
+			"DELETE",
+			"/api/v1/ratings/10/attachments/4",
+			nil,
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				rating(t)
+				as.DeleteFunc = func(ratingID, id int64) error {
+					assert.Equal(t, int64(10), ratingID)
+					assert.Equal(t, int64(4), id)
+					return nil
+				}
+			},
+		},
+		{
+			"deleteForbidden",
+			other,
+			"DELETE",
+			"/api/v1/ratings/10/attachments/4",
+			nil,
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+			rating,
+		},
+		{
+			"deleteOtherRating",
+			admin,
+			"DELETE",
+			"/api/v1/ratings/10/attachments/5",
+			nil,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			rating,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req *http.Request
+			if tc.method == "POST" {
+				body, contentType := multipartFile(t, "picture.png", tc.content)
+				req, _ = http.NewRequest(tc.method, tc.path, body)
+				req.Header.Add("Content-Type", contentType)
+			} else {
+				req, _ = http.NewRequest(tc.method, tc.path, nil)
+			}
+			req.Header.Add("Accept", "application/json")
+
+			user = tc.user
+			w := serveCase(t, mux, req, tc.setup, rs)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			switch {
+			case tc.name == "get":
+				assert.Equal(t, tc.outBody, w.Body.String())
+				assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename=picture.png`, w.Header().Get("Content-Disposition"))
+				assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			case tc.outStatus != http.StatusNoContent:
+				assert.JSONEq(t, tc.outBody, w.Body.String())
+			}
+
+			*as = modelstest.AttachmentService{}
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestAttachments_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ac := NewAttachments(nil, &modelstest.RatingService{})
+
+	mux := gin.New()
+	mux.GET("/api/v1/attachments/:id", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	}, ac.Get)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/attachments/4", nil)
+	req.Header.Add("Accept", "application/json")
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"not_found"}`, w.Body.String())
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Audit implements a controller for the audit log of the actions of the administrators.
+type Audit struct {
+	as models.AuditService
+
+	viewErr views.Error
+}
+
+// NewAudit creates a new Audit controller.
+func NewAudit(as models.AuditService) *Audit {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+
+	return &Audit{
+		as:      as,
+		viewErr: ev,
+	}
+}
+
+// List returns the latest entries of the audit log, newest first.
+//
+// GET /api/v1/admin/audit-log
+func (ac *Audit) List(c *gin.Context) {
+	entries, err := ac.as.List()
+	if err != nil {
+		ac.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": entries})
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := &modelstest.AuditService{}
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/audit-log", NewAudit(as).List)
+
+	userID := int64(45)
+	as.ListFunc = func() ([]models.AuditEntry, error) {
+		return []models.AuditEntry{{ID: 3, ActorID: 1, Action: models.AuditImpersonate, UserID: &userID,
+			CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}}, nil
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/admin/audit-log", nil)
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items":[{"id":3,"actorId":1,"action":"impersonate","userId":45,"createdAt":"2020-01-02T03:04:05Z"}]}`,
+		w.Body.String())
+}
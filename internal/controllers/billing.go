@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Billing implements a controller for the daily usage of the tenants, as pushed to the billing
+// provider.
+type Billing struct {
+	ms models.MeteringService
+
+	viewErr views.Error
+}
+
+// NewBilling creates a new Billing controller.
+func NewBilling(ms models.MeteringService) *Billing {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrBillingDisabled, http.StatusNotImplemented)
+
+	return &Billing{
+		ms:      ms,
+		viewErr: ev,
+	}
+}
+
+// Usage returns the usage records of the tenants for a day, given by the "day" parameter as
+// YYYY-MM-DD. It defaults to the previous day.
+//
+// GET /api/v1/admin/billing/usage?day=2020-03-01
+func (bc *Billing) Usage(c *gin.Context) {
+	day, err := getQueryDay(c, "day")
+	if err != nil {
+		bc.viewErr.JSON(c, err)
+		return
+	}
+
+	records, err := bc.ms.Records(day)
+	if err != nil {
+		bc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": records,
+	})
+}
+
+// Reconciliation compares the usage records of a day, given as in Usage, with the records
+// known to the billing provider.
+//
+// GET /api/v1/admin/billing/reconciliation?day=2020-03-01
+func (bc *Billing) Reconciliation(c *gin.Context) {
+	day, err := getQueryDay(c, "day")
+	if err != nil {
+		bc.viewErr.JSON(c, err)
+		return
+	}
+
+	rc, err := bc.ms.Reconcile(day)
+	if err != nil {
+		bc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &rc)
+}
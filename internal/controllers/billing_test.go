@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBilling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &modelstest.MeteringService{}
+	bc := NewBilling(ms)
+
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	pushed := time.Date(2020, 3, 2, 0, 10, 0, 0, time.UTC)
+	record := models.UsageRecord{
+		TenantID:  3,
+		Day:       day,
+		APICalls:  1200,
+		Stored:    models.TenantResources{Users: 4, Ratings: 80, Storage: 5120},
+		PushedAt:  &pushed,
+		Ref:       "ur_1",
+		CreatedAt: pushed,
+	}
+	const recordJSON = `{"tenantId":3,"day":"2020-03-01T00:00:00Z","apiCalls":1200,` +
+		`"stored":{"users":4,"ratings":80,"storage":5120},"pushedAt":"2020-03-02T00:10:00Z","ref":"ur_1",` +
+		`"createdAt":"2020-03-02T00:10:00Z"}`
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/billing/usage", bc.Usage)
+	mux.GET("/api/v1/admin/billing/reconciliation", bc.Reconciliation)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"usage",
+			"/api/v1/admin/billing/usage?day=2020-03-01",
+			http.StatusOK,
+			`{"items":[` + recordJSON + `]}`,
+			func(t *testing.T) {
+				ms.RecordsFunc = func(d time.Time) ([]models.UsageRecord, error) {
+					assert.Equal(t, day, d)
+					return []models.UsageRecord{record}, nil
+				}
+			},
+		},
+		{
+			"usageYesterday",
+			"/api/v1/admin/billing/usage",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				ms.RecordsFunc = func(d time.Time) ([]models.UsageRecord, error) {
+					y, m, dd := time.Now().UTC().AddDate(0, 0, -1).Date()
+					assert.Equal(t, time.Date(y, m, dd, 0, 0, 0, 0, time.UTC), d)
+					return []models.UsageRecord{}, nil
+				}
+			},
+		},
+		{
+			"usageBadDay",
+			"/api/v1/admin/billing/usage?day=yesterday",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"day":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"reconciliation",
+			"/api/v1/admin/billing/reconciliation?day=2020-03-01",
+			http.StatusOK,
+			`{"day":"2020-03-01T00:00:00Z","matched":1,"mismatched":0,"items":[` +
+				`{"tenantId":3,"status":"matched","local":` + recordJSON + `,"provider":` + recordJSON + `}]}`,
+			func(t *testing.T) {
+				ms.ReconcileFunc = func(d time.Time) (models.Reconciliation, error) {
+					assert.Equal(t, day, d)
+					return models.Reconciliation{
+						Day:     day,
+						Matched: 1,
+						Items: []models.ReconciliationItem{
+							{TenantID: 3, Status: models.ReconciliationMatched, Local: &record, Provider: &record},
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			"reconciliationDisabled",
+			"/api/v1/admin/billing/reconciliation?day=2020-03-01",
+			http.StatusNotImplemented,
+			`{"error":"billing_disabled"}`,
+			func(t *testing.T) {
+				ms.ReconcileFunc = func(d time.Time) (models.Reconciliation, error) {
+					return models.Reconciliation{}, models.ErrBillingDisabled
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", tc.path, nil)
+			c.Request.Header.Add("Accept", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			assert.JSONEq(t, tc.outJSON, w.Body.String())
+
+			*ms = modelstest.MeteringService{}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Campaigns implements a controller for rating campaign management.
+type Campaigns struct {
+	cs models.CampaignService
+	rs models.RatingService
+
+	viewErr views.Error
+}
+
+// NewCampaigns creates a new Campaigns controller. rs is used to summarise the ratings of the
+// campaigns, as visible to each user.
+func NewCampaigns(cs models.CampaignService, rs models.RatingService) *Campaigns {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrRefNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrInUse, http.StatusConflict)
+
+	return &Campaigns{
+		cs:      cs,
+		rs:      rs,
+		viewErr: ev,
+	}
+}
+
+// Create performs the addition of a campaign.
+//
+// POST /api/v1/campaigns/
+func (cp *Campaigns) Create(c *gin.Context) {
+	var campaign models.Campaign
+
+	err := parseJSON(c, &campaign)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	err = cp.cs.Create(&campaign)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &campaign)
+}
+
+// Update performs the change of a campaign.
+//
+// PUT /api/v1/campaigns/:id
+func (cp *Campaigns) Update(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	var campaign models.Campaign
+
+	err = parseJSON(c, &campaign)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+	campaign.ID = id
+
+	err = cp.cs.Update(&campaign)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &campaign)
+}
+
+// Delete performs the removal of a campaign. Campaigns with ratings cannot be deleted.
+//
+// DELETE /api/v1/campaigns/:id
+func (cp *Campaigns) Delete(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	err = cp.cs.Delete(id)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// Get returns one campaign by ID to the requester.
+//
+// GET /api/v1/campaigns/:id
+func (cp *Campaigns) Get(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	campaign, err := cp.cs.ByID(id)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &campaign)
+}
+
+// List returns all the campaigns, sorted by start date.
+//
+// GET /api/v1/campaigns/
+func (cp *Campaigns) List(c *gin.Context) {
+	campaigns, err := cp.cs.List()
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": campaigns,
+	})
+}
+
+// Stats returns a summary of the active ratings submitted to a campaign, overall and by target.
+// Only the ratings visible to the requester are summarised.
+//
+// GET /api/v1/campaigns/:id/stats
+func (cp *Campaigns) Stats(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	_, err = cp.cs.ByID(id)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	stats, err := cp.rs.Scoped(middleware.Actor(c).User).StatsByCampaign(id)
+	if err != nil {
+		cp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &stats)
+}
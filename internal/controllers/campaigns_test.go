@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaigns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cs := &modelstest.CampaignService{}
+	rs := &modelstest.RatingService{}
+	cp := NewCampaigns(cs, rs)
+
+	start := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	campaign := models.Campaign{
+		ID:        4,
+		Name:      "Spring",
+		Targets:   pq.Int64Array{3, 9},
+		Roles:     pq.Int64Array{},
+		StartsAt:  start,
+		EndsAt:    start.Add(24 * time.Hour),
+		CreatedAt: start,
+	}
+	const campaignJSON = `{"id":4,"name":"Spring","targets":[3,9],"roles":[],` +
+		`"startsAt":"2020-03-01T00:00:00Z","endsAt":"2020-03-02T00:00:00Z","createdAt":"2020-03-01T00:00:00Z"}`
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	})
+	mux.GET("/api/v1/campaigns/", cp.List)
+	mux.GET("/api/v1/campaigns/:id", cp.Get)
+	mux.GET("/api/v1/campaigns/:id/stats", cp.Stats)
+	mux.POST("/api/v1/campaigns/", cp.Create)
+	mux.PUT("/api/v1/campaigns/:id", cp.Update)
+	mux.DELETE("/api/v1/campaigns/:id", cp.Delete)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/campaigns/",
+			"",
+			http.StatusOK,
+			`{"items":[` + campaignJSON + `]}`,
+			func(t *testing.T) {
+				cs.ListFunc = func() ([]models.Campaign, error) {
+					return []models.Campaign{campaign}, nil
+				}
+			},
+		},
+		{
+			"getBadID",
+			"GET",
+			"/api/v1/campaigns/abc",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/campaigns/4",
+			"",
+			http.StatusOK,
+			campaignJSON,
+			func(t *testing.T) {
+				cs.ByIDFunc = func(id int64) (models.Campaign, error) {
+					assert.Equal(t, int64(4), id)
+					return campaign, nil
+				}
+			},
+		},
+		{
+			"createInvalid",
+			"POST",
+			"/api/v1/campaigns/",
+			`{"name":"Spring"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"targets":"required"}}`,
+			func(t *testing.T) {
+				cs.CreateFunc = func(c *models.Campaign) error {
+					return models.ValidationError{"targets": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"create",
+			"POST",
+			"/api/v1/campaigns/",
+			`{"name":"Spring","targets":[9,3],"startsAt":"2020-03-01T00:00:00Z","endsAt":"2020-03-02T00:00:00Z"}`,
+			http.StatusCreated,
+			campaignJSON,
+			func(t *testing.T) {
+				cs.CreateFunc = func(c *models.Campaign) error {
+					assert.Equal(t, pq.Int64Array{9, 3}, c.Targets)
+					*c = campaign
+					return nil
+				}
+			},
+		},
+		{
+			"update",
+			"PUT",
+			"/api/v1/campaigns/4",
+			`{"id":7,"name":"Spring","targets":[3,9],"startsAt":"2020-03-01T00:00:00Z","endsAt":"2020-03-02T00:00:00Z"}`,
+			http.StatusOK,
+			campaignJSON,
+			func(t *testing.T) {
+				cs.UpdateFunc = func(c *models.Campaign) error {
+					assert.Equal(t, int64(4), c.ID, "must use the ID of the path")
+					*c = campaign
+					return nil
+				}
+			},
+		},
+		{
+			"deleteInUse",
+			"DELETE",
+			"/api/v1/campaigns/4",
+			"",
+			http.StatusConflict,
+			`{"error":"in_use"}`,
+			func(t *testing.T) {
+				cs.DeleteFunc = func(id int64) error {
+					return models.ErrInUse
+				}
+			},
+		},
+		{
+			"delete",
+			"DELETE",
+			"/api/v1/campaigns/4",
+			"",
+			http.StatusNoContent,
+			`{}`,
+			func(t *testing.T) {
+				cs.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(4), id)
+					return nil
+				}
+			},
+		},
+		{
+			"statsNotFound",
+			"GET",
+			"/api/v1/campaigns/5/stats",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				cs.ByIDFunc = func(id int64) (models.Campaign, error) {
+					return models.Campaign{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"stats",
+			"GET",
+			"/api/v1/campaigns/4/stats",
+			"",
+			http.StatusOK,
+			`{"campaignId":4,"count":2,"average":3,"weightedAverage":3,"targets":[` +
+				`{"target":9,"count":2,"average":3,"weightedAverage":3,"verifiedWeightedAverage":3,"min":1,"max":5}]}`,
+			func(t *testing.T) {
+				cs.ByIDFunc = func(id int64) (models.Campaign, error) {
+					return campaign, nil
+				}
+				rs.StatsByCampaignFunc = func(id int64) (models.CampaignStats, error) {
+					assert.Equal(t, int64(4), id)
+					return models.CampaignStats{
+						CampaignID:      4,
+						Count:           2,
+						Average:         3,
+						WeightedAverage: 3,
+						Targets: []models.RatingStats{
+							{Target: 9, Count: 2, Average: 3, WeightedAverage: 3, VerifiedWeightedAverage: 3, Min: 1, Max: 5},
+						},
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, tc.setup, rs)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*cs = modelstest.CampaignService{}
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Cards implements a controller for the rating cards, the read model of the ratings listed by
+// the frontend.
+type Cards struct {
+	cs models.CardService
+
+	viewErr views.Error
+}
+
+// NewCards creates a new Cards controller.
+func NewCards(cs models.CardService) *Cards {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+
+	return &Cards{
+		cs:      cs,
+		viewErr: ev,
+	}
+}
+
+// ListByTarget returns the cards of the active ratings of a target visible to the requester,
+// newest first. The "limit" parameter sets the size of the page, and the "before" parameter
+// the ID of the last card of the previous page.
+//
+// GET /api/v1/targets/:id/cards
+// GET /api/v1/targets/:id/cards?limit=20&before=1234
+func (cc *Cards) ListByTarget(c *gin.Context) {
+	target, err := getParamInt(c, "id")
+	if err != nil {
+		cc.viewErr.JSON(c, err)
+		return
+	}
+
+	var q models.CardQuery
+	limit, err := getQueryInt(c, "limit")
+	if err != nil {
+		cc.viewErr.JSON(c, err)
+		return
+	} else if limit != nil {
+		q.Limit = int(*limit)
+	}
+
+	before, err := getQueryInt(c, "before")
+	if err != nil {
+		cc.viewErr.JSON(c, err)
+		return
+	} else if before != nil {
+		q.Before = *before
+	}
+
+	cards, err := cc.cs.Scoped(middleware.Actor(c).User).ByTarget(target, q)
+	if err != nil {
+		cc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": cards,
+	})
+}
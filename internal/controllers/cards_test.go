@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCards(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cs := &modelstest.CardService{}
+	cc := NewCards(cs)
+
+	updated := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	card := models.RatingCard{ID: 12, Target: 9, Score: 4, Comment: "Nice", Date: 1577934245, UserID: 3, ReviewerName: "Jane D.", Helpful: 2, UpdatedAt: updated}
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 7, RoleID: 2})
+	})
+	mux.GET("/api/v1/targets/:id/cards", cc.ListByTarget)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"/api/v1/targets/9/cards",
+			http.StatusOK,
+			`{"items":[{"id":12,"target":9,"score":4,"comment":"Nice","anonymous":false,"date":1577934245,` +
+				`"reviewerName":"Jane D.","helpful":2,"unhelpful":0,"updatedAt":"2020-01-02T03:04:05Z"}]}`,
+			func(t *testing.T) {
+				cs.ByTargetFunc = func(target int64, q models.CardQuery) ([]models.RatingCard, error) {
+					assert.Equal(t, int64(9), target)
+					assert.Equal(t, models.CardQuery{}, q)
+					return []models.RatingCard{card}, nil
+				}
+			},
+		},
+		{
+			"page",
+			"/api/v1/targets/9/cards?limit=20&before=100",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				cs.ByTargetFunc = func(target int64, q models.CardQuery) ([]models.RatingCard, error) {
+					assert.Equal(t, models.CardQuery{Limit: 20, Before: 100}, q)
+					return []models.RatingCard{}, nil
+				}
+			},
+		},
+		{
+			"scoped",
+			"/api/v1/targets/9/cards",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				scoped := &modelstest.CardService{
+					ByTargetFunc: func(target int64, q models.CardQuery) ([]models.RatingCard, error) {
+						return []models.RatingCard{}, nil
+					},
+				}
+				cs.ScopedFunc = func(u *models.User) models.CardService {
+					assert.Equal(t, int64(7), u.ID)
+					return scoped
+				}
+			},
+		},
+		{
+			"badLimit",
+			"/api/v1/targets/9/cards?limit=many",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"limit":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"invalidLimit",
+			"/api/v1/targets/9/cards?limit=1000",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"limit":"invalid"}}`,
+			func(t *testing.T) {
+				cs.ByTargetFunc = func(target int64, q models.CardQuery) ([]models.RatingCard, error) {
+					return nil, models.ValidationError{"limit": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"badTarget",
+			"/api/v1/targets/shoes/cards",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			w := serveCase(t, mux, req, tc.setup, cs)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			assert.JSONEq(t, tc.outJSON, w.Body.String())
+
+			*cs = modelstest.CardService{}
+		})
+	}
+}
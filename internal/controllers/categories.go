@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// TargetCategories implements a controller for the management of the categories of the
+// targets, and the rules of their ratings.
+type TargetCategories struct {
+	cs models.TargetCategoryService
+
+	viewErr views.Error
+}
+
+// NewTargetCategories creates a new TargetCategories controller.
+func NewTargetCategories(cs models.TargetCategoryService) *TargetCategories {
+	var ev views.Error
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrInUse, http.StatusConflict)
+
+	return &TargetCategories{
+		cs:      cs,
+		viewErr: ev,
+	}
+}
+
+// List returns the categories of the targets.
+//
+// GET /api/v1/admin/categories/
+func (tc *TargetCategories) List(c *gin.Context) {
+	categories, err := tc.cs.List()
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": categories,
+	})
+}
+
+// Get returns a category of the targets.
+//
+// GET /api/v1/admin/categories/:name
+func (tc *TargetCategories) Get(c *gin.Context) {
+	category, err := tc.cs.ByName(c.Param("name"))
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &category)
+}
+
+// Set sets the rules of a category of the targets, creating it if needed, recording the
+// change by the user of the session.
+//
+// PUT /api/v1/admin/categories/:name
+func (tc *TargetCategories) Set(c *gin.Context) {
+	var category models.TargetCategory
+
+	err := parseJSON(c, &category)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+	category.Name = c.Param("name")
+	category.UpdatedBy = middleware.Actor(c).ID
+
+	err = tc.cs.Set(&category)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &category)
+}
+
+// Remove removes a category of the targets, which must not have any target left.
+//
+// DELETE /api/v1/admin/categories/:name
+func (tc *TargetCategories) Remove(c *gin.Context) {
+	err := tc.cs.Remove(c.Param("name"))
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetCategories(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cs := &modelstest.TargetCategoryService{}
+	tc := NewTargetCategories(cs)
+
+	updated := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	one, five := 1, 5
+	category := models.TargetCategory{
+		Name:      "restaurants",
+		MinScore:  &one,
+		MaxScore:  &five,
+		UpdatedBy: 1,
+		UpdatedAt: updated,
+	}
+	const categoryJSON = `{"name":"restaurants","minScore":1,"maxScore":5,"commentRequired":false,"updatedBy":1,"updatedAt":"2020-03-01T00:00:00Z"}`
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	})
+	mux.GET("/api/v1/admin/categories/", tc.List)
+	mux.GET("/api/v1/admin/categories/:name", tc.Get)
+	mux.PUT("/api/v1/admin/categories/:name", tc.Set)
+	mux.DELETE("/api/v1/admin/categories/:name", tc.Remove)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/admin/categories/",
+			"",
+			http.StatusOK,
+			`{"items":[` + categoryJSON + `]}`,
+			func(t *testing.T) {
+				cs.ListFunc = func() ([]models.TargetCategory, error) {
+					return []models.TargetCategory{category}, nil
+				}
+			},
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/admin/categories/restaurants",
+			"",
+			http.StatusOK,
+			categoryJSON,
+			func(t *testing.T) {
+				cs.ByNameFunc = func(name string) (models.TargetCategory, error) {
+					assert.Equal(t, "restaurants", name)
+					return category, nil
+				}
+			},
+		},
+		{
+			"getUnknown",
+			"GET",
+			"/api/v1/admin/categories/drivers",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				cs.ByNameFunc = func(name string) (models.TargetCategory, error) {
+					return models.TargetCategory{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"set",
+			"PUT",
+			"/api/v1/admin/categories/restaurants",
+			`{"name":"other","minScore":1,"maxScore":5,"updatedBy":9}`,
+			http.StatusOK,
+			categoryJSON,
+			func(t *testing.T) {
+				cs.SetFunc = func(c *models.TargetCategory) error {
+					assert.Equal(t, "restaurants", c.Name, "must be named by the path")
+					assert.Equal(t, int64(1), c.UpdatedBy, "must be recorded as changed by the requester")
+					c.UpdatedAt = updated
+					return nil
+				}
+			},
+		},
+		{
+			"setInvalid",
+			"PUT",
+			"/api/v1/admin/categories/restaurants",
+			`{"minScore":5,"maxScore":1}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"maxScore":"invalid"}}`,
+			func(t *testing.T) {
+				cs.SetFunc = func(c *models.TargetCategory) error {
+					return models.ValidationError{"maxScore": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"remove",
+			"DELETE",
+			"/api/v1/admin/categories/restaurants",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				cs.RemoveFunc = func(name string) error {
+					assert.Equal(t, "restaurants", name)
+					return nil
+				}
+			},
+		},
+		{
+			"removeInUse",
+			"DELETE",
+			"/api/v1/admin/categories/restaurants",
+			"",
+			http.StatusConflict,
+			`{"error":"in_use"}`,
+			func(t *testing.T) {
+				cs.RemoveFunc = func(name string) error {
+					return models.ErrInUse
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*cs = modelstest.TargetCategoryService{}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/privacy"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Consent implements a controller for the acceptance of the data processing policy by the
+// users.
+type Consent struct {
+	cs models.ConsentService
+
+	viewErr views.Error
+}
+
+// NewConsent creates a new Consent controller.
+func NewConsent(cs models.ConsentService) *Consent {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+
+	return &Consent{
+		cs:      cs,
+		viewErr: ev,
+	}
+}
+
+// List returns the versions of the policy accepted by a user, along with the current version
+// and whether the user accepted it.
+//
+// GET /api/v1/users/:id/consents
+func (cn *Consent) List(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		cn.viewErr.JSON(c, err)
+		return
+	}
+
+	consents, err := cn.cs.ByUser(id)
+	if err != nil {
+		cn.viewErr.JSON(c, err)
+		return
+	}
+
+	upToDate, err := cn.cs.UpToDate(id)
+	if err != nil {
+		cn.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policyVersion": cn.cs.PolicyVersion(),
+		"upToDate":      upToDate,
+		"items":         consents,
+	})
+}
+
+// Accept records the acceptance of the current version of the policy by the requester, along
+// with their IP address and user agent as they are logged. Accepting a version again keeps
+// the original acceptance.
+//
+// POST /api/v1/consents/
+func (cn *Consent) Accept(c *gin.Context) {
+	var input struct {
+		PolicyVersion string `json:"policyVersion"`
+	}
+
+	err := parseJSON(c, &input)
+	if err != nil {
+		cn.viewErr.JSON(c, err)
+		return
+	}
+
+	consent := models.Consent{
+		UserID:        middleware.Actor(c).ID,
+		PolicyVersion: input.PolicyVersion,
+	}
+	if client, ok := c.Value("client").(privacy.Client); ok {
+		consent.IP, consent.UserAgent = client.IP, client.UserAgent
+	}
+
+	err = cn.cs.Accept(&consent)
+	if err != nil {
+		cn.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &consent)
+}
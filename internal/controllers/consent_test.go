@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/noelruault/ratingsapp/internal/privacy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cs := &modelstest.ConsentService{}
+	cn := NewConsent(cs)
+
+	accepted := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 7, RoleID: 2})
+		c.Set("client", privacy.Client{IP: "203.0.113.0", UserAgent: "curl/7"})
+	})
+	mux.GET("/api/v1/users/:id/consents", cn.List)
+	mux.POST("/api/v1/consents/", cn.Accept)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"listBadID",
+			"GET",
+			"/api/v1/users/abc/consents",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"list",
+			"GET",
+			"/api/v1/users/3/consents",
+			"",
+			http.StatusOK,
+			`{"policyVersion":"2020-01","upToDate":false,"items":[{"userId":3,"policyVersion":"2019-06","acceptedAt":"2020-01-02T03:04:05Z"}]}`,
+			func(t *testing.T) {
+				cs.PolicyVersionFunc = func() string { return "2020-01" }
+				cs.ByUserFunc = func(id int64) ([]models.Consent, error) {
+					assert.Equal(t, int64(3), id)
+					return []models.Consent{{UserID: 3, PolicyVersion: "2019-06", AcceptedAt: accepted}}, nil
+				}
+				cs.UpToDateFunc = func(id int64) (bool, error) {
+					return false, nil
+				}
+			},
+		},
+		{
+			"acceptOutdated",
+			"POST",
+			"/api/v1/consents/",
+			`{"policyVersion":"2019-06"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"policyVersion":"invalid"}}`,
+			func(t *testing.T) {
+				cs.AcceptFunc = func(c *models.Consent) error {
+					return models.ValidationError{"policyVersion": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"accept",
+			"POST",
+			"/api/v1/consents/",
+			`{"policyVersion":"2020-01","userId":99}`,
+			http.StatusCreated,
+			`{"userId":7,"policyVersion":"2020-01","acceptedAt":"2020-01-02T03:04:05Z","ip":"203.0.113.0","userAgent":"curl/7"}`,
+			func(t *testing.T) {
+				cs.AcceptFunc = func(c *models.Consent) error {
+					assert.Equal(t, models.Consent{UserID: 7, PolicyVersion: "2020-01", IP: "203.0.113.0", UserAgent: "curl/7"}, *c)
+					c.AcceptedAt = accepted
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			assert.JSONEq(t, tc.outJSON, w.Body.String())
+
+			*cs = modelstest.ConsentService{}
+		})
+	}
+}
@@ -17,6 +17,10 @@ const (
 	ErrInvalidFormInput       ControllerError   = "controllers: invalid_form, provided input cannot be parsed"
 	ErrContentTypeNotAccepted ControllerError   = "controllers: content_type_not_accepted, the content-type provided is not supported"
 	ErrInvalidJSONInput       ControllerError   = "controllers: invalid_json, provided input cannot be parsed"
+	ErrForbidden              ControllerError   = "controllers: forbidden, the user is not authorised to read the resource"
+	ErrPreconditionRequired   ControllerError   = "controllers: precondition_required, an If-Match header with the resource version is required"
+	ErrWeakETag               ControllerError   = "controllers: weak_etag, If-Match requires the strong ETag of the resource"
+	ErrJobRunning             ControllerError   = "controllers: job_running, the job is already running"
 	ErrParseError             models.ModelError = "models: invalid_parse, contents are not in appropriate format"
 )
 
@@ -0,0 +1,35 @@
+// Package graph holds the GraphQL schema served by the GraphQL controller, see GraphQL.md, and
+// the executable schema gqlgen generates from it. The resolvers of the fields are implemented by
+// the controller.
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+// User is the User type. Deleted marks the placeholder of the deleted authors of the ratings, see
+// views.ResolveAuthor, whose private fields are null.
+type User struct {
+	*models.User
+
+	Deleted bool
+}
+
+// JSON is the JSON type, holding raw JSON values.
+type JSON json.RawMessage
+
+// MarshalGQL writes the raw JSON value.
+func (j JSON) MarshalGQL(w io.Writer) {
+	w.Write(j)
+}
+
+// UnmarshalGQL always fails, as no argument is of the JSON type.
+func (j *JSON) UnmarshalGQL(v interface{}) error {
+	return fmt.Errorf("JSON arguments are not supported")
+}
@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/executor"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/controllers/graph"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"golang.org/x/xerrors"
+)
+
+// gqlExecutor executes the queries of the GraphQL controllers, with the schema generated in
+// package graph. Its resolvers are shared, and resolve the fields with the gqlQuery of each
+// request.
+var gqlExecutor = newGQLExecutor()
+
+// newGQLExecutor creates the executor of the GraphQL queries. The fields are resolved one at a
+// time, as the services of the provisioned tenants run on a single transaction.
+func newGQLExecutor() *executor.Executor {
+	e := executor.New(graph.NewExecutableSchema(graph.Config{Resolvers: gqlResolver{}}))
+	e.Use(extension.Introspection{})
+	e.AroundFields(func(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+		q := gqlQueryFrom(ctx)
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		return next(ctx)
+	})
+
+	return e
+}
+
+// gqlRuleCodes are the codes of the errors reported by the validation rules of the queries.
+// The queries failing the other rules have the "invalid_query" code.
+var gqlRuleCodes = map[string]string{
+	"FieldsOnCorrectType":        "unknown_field",
+	"KnownArgumentNames":         "invalid_argument",
+	"ProvidedRequiredArguments":  "invalid_argument",
+	"ValuesOfCorrectType":        "invalid_argument",
+	"ScalarLeafs":                "invalid_selection",
+	"VariablesAreInputTypes":     "invalid_variable",
+	"VariablesInAllowedPosition": "invalid_variable",
+	"NoUnusedVariables":          "invalid_variable",
+	"NoUndefinedVariables":       "invalid_variable",
+	"LoneAnonymousOperation":     "unknown_operation",
+	"KnownRootType":              "unsupported",
+}
+
+// gqlMessageCodes are the codes of the errors reported without a rule by gqlgen, by the prefix
+// of their message.
+var gqlMessageCodes = []struct {
+	prefix string
+	code   string
+}{
+	{"no operation provided", "unknown_operation"},
+	{"operation ", "unknown_operation"},
+}
+
+// GraphQL implements a controller that serves GraphQL queries on users, roles
+// and ratings, so clients can fetch related resources in a single request.
+type GraphQL struct {
+	us  models.UserService
+	rls models.RoleService
+	rs  models.RatingService
+
+	viewErr views.Error
+}
+
+// NewGraphQL creates a new GraphQL controller.
+func NewGraphQL(us models.UserService, rls models.RoleService, rs models.RatingService) *GraphQL {
+	var ev views.Error
+
+	return &GraphQL{
+		us:      us,
+		rls:     rls,
+		rs:      rs,
+		viewErr: ev,
+	}
+}
+
+// gqlRequest is the body of the requests to the GraphQL controller.
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Query executes a GraphQL query. The data of the fields the requester cannot read is left out,
+// and an error with the "forbidden" code is reported for each of them. The fields of other users
+// are masked to their public profile without the readUsers permission.
+//
+// Requests that cannot be executed return an HTTP Bad Request code, and errors found while
+// resolving the fields are returned along with the rest of the data.
+//
+// POST /api/v1/graphql
+func (g *GraphQL) Query(c *gin.Context) {
+	var req gqlRequest
+
+	dec := json.NewDecoder(c.Request.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		g.viewErr.JSON(c, ErrInvalidJSONInput)
+		return
+	}
+
+	q := &gqlQuery{
+		g:      g,
+		viewer: middleware.Actor(c).User,
+		users:  map[int64]*models.User{},
+	}
+
+	ctx := context.WithValue(c.Request.Context(), gqlQueryKey{}, q)
+	ctx = graphql.StartOperationTrace(ctx)
+	oc, errs := gqlExecutor.CreateOperationContext(ctx, &graphql.RawParams{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+	})
+	if errs != nil {
+		for _, e := range errs {
+			e.Extensions = map[string]interface{}{"code": gqlCode(e)}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"errors": errs})
+		return
+	}
+
+	responses, ctx := gqlExecutor.DispatchOperation(ctx, oc)
+	res := responses(ctx)
+	for _, e := range res.Errors {
+		var code string
+		if pe, ok := e.Err.(publicError); ok {
+			code = pe.Public()
+		} else {
+			// a copy is logged, as the message is replaced by the code
+			code = "server_error"
+			err := *e
+			c.Error(&err)
+		}
+		e.Message = code
+		e.Extensions = map[string]interface{}{"code": code}
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// gqlCode returns the code of an error reported while parsing or validating a query.
+func gqlCode(e *gqlerror.Error) string {
+	if code, ok := gqlRuleCodes[e.Rule]; ok {
+		return code
+	}
+	if e.Rule != "" {
+		return "invalid_query"
+	}
+	if e.Extensions["code"] == errcode.ParseFailed {
+		return "syntax_error"
+	}
+	if len(e.Path) > 0 && e.Path[0] == ast.PathName("variable") {
+		return "invalid_variable"
+	}
+
+	for _, mc := range gqlMessageCodes {
+		if strings.HasPrefix(e.Message, mc.prefix) {
+			return mc.code
+		}
+	}
+	return "invalid_query"
+}
+
+// gqlQueryKey is the key of the gqlQuery of a request, set on the context of its query.
+type gqlQueryKey struct{}
+
+// gqlQuery holds the requester of a query, and caches the users and roles resolved for it, so
+// they are only fetched once. Its fields are resolved while holding mu.
+type gqlQuery struct {
+	g      *GraphQL
+	viewer *models.User
+
+	mu    sync.Mutex
+	users map[int64]*models.User
+	roles map[int64]*models.Role
+}
+
+// gqlQueryFrom returns the gqlQuery of the query run with ctx.
+func gqlQueryFrom(ctx context.Context) *gqlQuery {
+	return ctx.Value(gqlQueryKey{}).(*gqlQuery)
+}
+
+// can tells whether the requester has all the permissions in p.
+func (q *gqlQuery) can(p models.Permissions) bool {
+	return q.viewer.Role != nil && q.viewer.Role.Permissions&p == p
+}
+
+// user resolves the user with ID id.
+func (q *gqlQuery) user(id int64) (*graph.User, error) {
+	u, ok := q.users[id]
+	if !ok {
+		mu, err := q.g.us.ByID(id)
+		if err != nil {
+			return nil, err
+		}
+		u = &mu
+		q.users[id] = u
+	}
+
+	return &graph.User{User: u}, nil
+}
+
+// loadUsers fetches the authors of ratings that were not fetched yet, in a single query.
+func (q *gqlQuery) loadUsers(ratings []models.Rating) error {
+	var ids []int64
+	seen := map[int64]bool{}
+	for _, r := range ratings {
+		if _, ok := q.users[r.UserID]; !ok && !seen[r.UserID] {
+			seen[r.UserID] = true
+			ids = append(ids, r.UserID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	users, err := q.g.us.ByIDs(ids...)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		q.users[users[i].ID] = &users[i]
+	}
+
+	return nil
+}
+
+// role resolves the role with ID id.
+func (q *gqlQuery) role(id int64) (*models.Role, error) {
+	if err := q.loadRoles(); err != nil {
+		return nil, err
+	}
+
+	r, ok := q.roles[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	return r, nil
+}
+
+// loadRoles fetches all the roles, if they were not fetched yet. There are few of them, so they
+// are fetched at once.
+func (q *gqlQuery) loadRoles() error {
+	if q.roles != nil {
+		return nil
+	}
+
+	roles, err := q.g.rls.ByIDs()
+	if err != nil {
+		return err
+	}
+
+	q.roles = make(map[int64]*models.Role, len(roles))
+	for i := range roles {
+		q.roles[roles[i].ID] = &roles[i]
+	}
+
+	return nil
+}
+
+// private returns ErrForbidden if the requester cannot read the private fields of u.
+func (q *gqlQuery) private(u *graph.User) error {
+	if !q.can(models.PermissionReadUsers) && u.ID != q.viewer.ID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// gqlResolver implements the resolvers of the schema generated in package graph. They resolve
+// the fields with the gqlQuery of the request.
+type gqlResolver struct{}
+
+func (gqlResolver) Query() graph.QueryResolver {
+	return gqlQueryResolver{}
+}
+
+func (gqlResolver) User() graph.UserResolver {
+	return gqlUserResolver{}
+}
+
+func (gqlResolver) Role() graph.RoleResolver {
+	return gqlRoleResolver{}
+}
+
+func (gqlResolver) Rating() graph.RatingResolver {
+	return gqlRatingResolver{}
+}
+
+// gqlQueryResolver resolves the fields of the Query type.
+type gqlQueryResolver struct{}
+
+func (gqlQueryResolver) Me(ctx context.Context) (*graph.User, error) {
+	q := gqlQueryFrom(ctx)
+	return q.user(q.viewer.ID)
+}
+
+func (gqlQueryResolver) User(ctx context.Context, id int64) (*graph.User, error) {
+	q := gqlQueryFrom(ctx)
+	if !q.can(models.PermissionReadUsers) && id != q.viewer.ID {
+		return nil, ErrForbidden
+	}
+
+	return q.user(id)
+}
+
+func (gqlQueryResolver) Users(ctx context.Context) ([]*graph.User, error) {
+	q := gqlQueryFrom(ctx)
+	if !q.can(models.PermissionReadUsers) {
+		return nil, ErrForbidden
+	}
+
+	users, err := q.g.us.ByIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*graph.User, len(users))
+	for i := range users {
+		q.users[users[i].ID] = &users[i]
+		list[i] = &graph.User{User: &users[i]}
+	}
+	return list, nil
+}
+
+func (gqlQueryResolver) Role(ctx context.Context, id int64) (*models.Role, error) {
+	q := gqlQueryFrom(ctx)
+	if !q.can(models.PermissionReadUsers) {
+		return nil, ErrForbidden
+	}
+
+	return q.role(id)
+}
+
+func (gqlQueryResolver) Roles(ctx context.Context) ([]*models.Role, error) {
+	q := gqlQueryFrom(ctx)
+	if !q.can(models.PermissionReadUsers) {
+		return nil, ErrForbidden
+	}
+	if err := q.loadRoles(); err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Role, 0, len(q.roles))
+	for _, r := range q.roles {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+func (gqlQueryResolver) RatingsByTarget(ctx context.Context, target int64) ([]*models.Rating, error) {
+	q := gqlQueryFrom(ctx)
+	if !q.can(models.PermissionReadRatings) {
+		return nil, ErrForbidden
+	}
+
+	ratings, err := q.g.rs.Scoped(q.viewer).ByTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.loadUsers(ratings); err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Rating, len(ratings))
+	for i := range ratings {
+		list[i] = &ratings[i]
+	}
+	return list, nil
+}
+
+// gqlUserResolver resolves the private fields of the User type. Without the readUsers
+// permission, only the public profile of other users can be read, and the private fields of the
+// placeholder of a deleted author are null.
+type gqlUserResolver struct{}
+
+func (gqlUserResolver) Active(ctx context.Context, u *graph.User) (*bool, error) {
+	if err := gqlQueryFrom(ctx).private(u); err != nil || u.Deleted {
+		return nil, err
+	}
+	return &u.User.Active, nil
+}
+
+func (gqlUserResolver) Email(ctx context.Context, u *graph.User) (*string, error) {
+	if err := gqlQueryFrom(ctx).private(u); err != nil || u.Deleted {
+		return nil, err
+	}
+	return &u.User.Email, nil
+}
+
+func (gqlUserResolver) RoleID(ctx context.Context, u *graph.User) (*int64, error) {
+	if err := gqlQueryFrom(ctx).private(u); err != nil || u.Deleted {
+		return nil, err
+	}
+	return &u.User.RoleID, nil
+}
+
+func (gqlUserResolver) Role(ctx context.Context, u *graph.User) (*models.Role, error) {
+	q := gqlQueryFrom(ctx)
+	if err := q.private(u); err != nil || u.Deleted {
+		return nil, err
+	}
+	return q.role(u.User.RoleID)
+}
+
+// gqlRoleResolver resolves the fields of the Role type that are not read from models.Role.
+type gqlRoleResolver struct{}
+
+func (gqlRoleResolver) Permissions(ctx context.Context, r *models.Role) ([]*string, error) {
+	names := r.Permissions.Names()
+	list := make([]*string, len(names))
+	for i := range names {
+		list[i] = &names[i]
+	}
+	return list, nil
+}
+
+// gqlRatingResolver resolves the fields of the Rating type that are not read from
+// models.Rating. The author of anonymous ratings can only be read with the readUsers permission,
+// or by the author.
+type gqlRatingResolver struct{}
+
+func (gqlRatingResolver) Extra(ctx context.Context, r *models.Rating) (graph.JSON, error) {
+	if len(r.Extra) == 0 {
+		return nil, nil
+	}
+	return graph.JSON(r.Extra), nil
+}
+
+// User returns the author of the rating, or the placeholder of a deleted user if it was removed,
+// deactivated or anonymised, which are inactive.
+func (gqlRatingResolver) User(ctx context.Context, r *models.Rating) (*graph.User, error) {
+	q := gqlQueryFrom(ctx)
+	if r.Anonymous && !q.can(models.PermissionReadUsers) && r.UserID != q.viewer.ID {
+		return nil, nil
+	}
+
+	u, err := q.user(r.UserID)
+	if err != nil && !xerrors.Is(err, models.ErrNotFound) {
+		return nil, err
+	}
+
+	var found *models.User
+	if u != nil {
+		found = u.User
+	}
+	a := views.ResolveAuthor(models.RatingAuthor{RatingID: r.ID, UserID: r.UserID, Deleted: found != nil && !found.Active}, found)
+	return &graph.User{User: a.User, Deleted: a.Deleted}, nil
+}
@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestGraphQL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tus := &modelstest.UserService{}
+	trls := &modelstest.RoleService{}
+	trs := &modelstest.RatingService{}
+	g := NewGraphQL(tus, trls, trs)
+
+	reader := &models.User{ID: 5, RoleID: 2, Role: &models.Role{ID: 2, Permissions: models.PermissionReadRatings}}
+	admin := &models.User{ID: 1, RoleID: 1, Role: &models.Role{ID: 1, Permissions: models.PermissionReadUsers | models.PermissionReadRatings}}
+	viewer := reader
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", viewer)
+	})
+	mux.POST("/api/v1/graphql", g.Query)
+
+	ratings := func(t *testing.T) {
+		trs.ByTargetFunc = func(target int64) ([]models.Rating, error) {
+			assert.Equal(t, int64(9), target)
+			return []models.Rating{
+				{ID: 10, Score: 4, Target: 9, UserID: 7},
+				{ID: 11, Score: 2, Target: 9, UserID: 8, Anonymous: true},
+				{ID: 12, Score: 5, Target: 9, UserID: 7},
+			}, nil
+		}
+		tus.ByIDsFunc = func(ids ...int64) ([]models.User, error) {
+			assert.Equal(t, []int64{7, 8}, ids, "must fetch the authors at once")
+			return []models.User{
+				{ID: 7, Active: true, FirstName: "Ana", Email: "ana@test.com", RoleID: 2},
+				{ID: 8, Active: true, FirstName: "Bo", Email: "bo@test.com", RoleID: 2},
+			}, nil
+		}
+		trls.ByIDsFunc = func(ids ...int64) ([]models.Role, error) {
+			return []models.Role{{ID: 1, Label: "admin"}, {ID: 2, Label: "user"}}, nil
+		}
+	}
+
+	var cases = []struct {
+		name      string
+		viewer    *models.User
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"invalidJSON",
+			reader,
+			`{"query":`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"syntaxError",
+			reader,
+			`{"query":"{ me "}`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"Expected Name, found <EOF>","locations":[{"line":1,"column":6}],"extensions":{"code":"syntax_error"}}]}`,
+			nil,
+		},
+		{
+			"unknownField",
+			reader,
+			`{"query":"{ me { password } }"}`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"Cannot query field \"password\" on type \"User\".","locations":[{"line":1,"column":8}],"extensions":{"code":"unknown_field"}}]}`,
+			nil,
+		},
+		{
+			"mutation",
+			reader,
+			`{"query":"mutation { me { id } }"}`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"Schema does not support operation type \"mutation\"","locations":[{"line":1,"column":1}],"extensions":{"code":"unsupported"}}]}`,
+			nil,
+		},
+		{
+			"invalidVariable",
+			reader,
+			`{"query":"query ($id: Int!) { user(id: $id) { id } }","variables":{"id":"five"}}`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"cannot use string as Int","path":["variable","id"],"extensions":{"code":"invalid_variable"}}]}`,
+			nil,
+		},
+		{
+			"invalidArgument",
+			admin,
+			`{"query":"{ user(id: 99999999999999999999) { id } }"}`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"Int cannot represent non 32-bit signed integer value: 99999999999999999999","locations":[{"line":1,"column":12}],"extensions":{"code":"invalid_argument"}}]}`,
+			nil,
+		},
+		{
+			"unknownOperation",
+			reader,
+			`{"query":"query A { me { id } } query B { me { id } }","operationName":"C"}`,
+			http.StatusBadRequest,
+			`{"errors":[{"message":"operation C not found","extensions":{"code":"unknown_operation"}}]}`,
+			nil,
+		},
+		{
+			"introspection",
+			reader,
+			`{"query":"{ __type(name: \"Role\") { fields { name } } }"}`,
+			http.StatusOK,
+			`{"data":{"__type":{"fields":[{"name":"id"},{"name":"label"},{"name":"permissions"}]}}}`,
+			nil,
+		},
+		{
+			"ratingsMasked",
+			reader,
+			`{"query":"{ ratingsByTarget(target: 9) { id user { firstName email } } }"}`,
+			http.StatusOK,
+			`{"data":{"ratingsByTarget":[
+				{"id":10,"user":{"firstName":"Ana","email":null}},
+				{"id":11,"user":null},
+				{"id":12,"user":{"firstName":"Ana","email":null}}
+			]},"errors":[
+				{"message":"forbidden","path":["ratingsByTarget",0,"user","email"],"extensions":{"code":"forbidden"}},
+				{"message":"forbidden","path":["ratingsByTarget",2,"user","email"],"extensions":{"code":"forbidden"}}
+			]}`,
+			ratings,
+		},
+		{
+			"ratingsWithReadUsers",
+			admin,
+			`{"query":"query ($t: Int!) { ratingsByTarget(target: $t) { id user { email role { label } } } }","variables":{"t":9}}`,
+			http.StatusOK,
+			`{"data":{"ratingsByTarget":[
+				{"id":10,"user":{"email":"ana@test.com","role":{"label":"user"}}},
+				{"id":11,"user":{"email":"bo@test.com","role":{"label":"user"}}},
+				{"id":12,"user":{"email":"ana@test.com","role":{"label":"user"}}}
+			]}}`,
+			ratings,
+		},
+		{
+			"ratingsDeletedAuthors",
+			admin,
+			`{"query":"{ ratingsByTarget(target: 9) { id user { id firstName email deleted } } }"}`,
+			http.StatusOK,
+			`{"data":{"ratingsByTarget":[
+				{"id":10,"user":{"id":7,"firstName":"Deleted user","email":null,"deleted":true}},
+				{"id":11,"user":{"id":8,"firstName":"Deleted user","email":null,"deleted":true}},
+				{"id":12,"user":{"id":7,"firstName":"Deleted user","email":null,"deleted":true}}
+			]}}`,
+			func(t *testing.T) {
+				ratings(t)
+				tus.ByIDsFunc = func(ids ...int64) ([]models.User, error) {
+					return []models.User{{ID: 7, Active: false, FirstName: "Ana", Email: "ana@test.com", RoleID: 2}}, nil
+				}
+				tus.ByIDFunc = func(id int64) (models.User, error) {
+					assert.Equal(t, int64(8), id)
+					return models.User{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"largeIDs",
+			reader,
+			`{"query":"query ($id: Int!) { user(id: $id) { id roleId } }","variables":{"id":8589934592}}`,
+			http.StatusOK,
+			`{"data":{"user":{"id":8589934592,"roleId":8589934593}}}`,
+			func(t *testing.T) {
+				viewer = &models.User{ID: 8589934592, Role: &models.Role{}}
+				tus.ByIDFunc = func(id int64) (models.User, error) {
+					return models.User{ID: id, RoleID: 8589934593}, nil
+				}
+			},
+		},
+		{
+			"largeLiteralIDs",
+			reader,
+			`{"query":"{ user(id: 8589934592) { id } }"}`,
+			http.StatusOK,
+			`{"data":{"user":{"id":8589934592}}}`,
+			func(t *testing.T) {
+				viewer = &models.User{ID: 8589934592, Role: &models.Role{}}
+				tus.ByIDFunc = func(id int64) (models.User, error) {
+					return models.User{ID: id}, nil
+				}
+			},
+		},
+		{
+			"usersForbidden",
+			reader,
+			`{"query":"{ users { id } roles { id } me { id email } }"}`,
+			http.StatusOK,
+			`{"data":{"users":null,"roles":null,"me":{"id":5,"email":"me@test.com"}},"errors":[
+				{"message":"forbidden","path":["users"],"extensions":{"code":"forbidden"}},
+				{"message":"forbidden","path":["roles"],"extensions":{"code":"forbidden"}}
+			]}`,
+			func(t *testing.T) {
+				tus.ByIDFunc = func(id int64) (models.User, error) {
+					return models.User{ID: id, Email: "me@test.com"}, nil
+				}
+			},
+		},
+		{
+			"userErrors",
+			admin,
+			`{"query":"{ a: user(id: 404) { id } b: user(id: 500) { id } }"}`,
+			http.StatusOK,
+			`{"data":{"a":null,"b":null},"errors":[
+				{"message":"not_found","path":["a"],"extensions":{"code":"not_found"}},
+				{"message":"server_error","path":["b"],"extensions":{"code":"server_error"}}
+			]}`,
+			func(t *testing.T) {
+				tus.ByIDFunc = func(id int64) (models.User, error) {
+					if id == 404 {
+						return models.User{}, models.ErrNotFound
+					}
+					return models.User{}, xerrors.New("test error")
+				}
+			},
+		},
+		{
+			"roles",
+			admin,
+			`{"query":"{ roles { id label permissions } }"}`,
+			http.StatusOK,
+			`{"data":{"roles":[{"id":1,"label":"admin","permissions":["readUsers"]},{"id":2,"label":"user","permissions":[]}]}}`,
+			func(t *testing.T) {
+				trls.ByIDsFunc = func(ids ...int64) ([]models.Role, error) {
+					return []models.Role{
+						{ID: 2, Label: "user"},
+						{ID: 1, Label: "admin", Permissions: models.PermissionReadUsers},
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/api/v1/graphql", bytes.NewBufferString(tc.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			viewer = tc.viewer
+			w := serveCase(t, mux, req, tc.setup, trs)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+
+			// the fields are resolved concurrently, so their errors are not ordered
+			var want, got struct {
+				Data   interface{}
+				Errors []interface{}
+				Error  string
+			}
+			assert.NoError(t, json.Unmarshal([]byte(tc.outJSON), &want))
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, want.Data, got.Data)
+			assert.ElementsMatch(t, want.Errors, got.Errors)
+			assert.Equal(t, want.Error, got.Error)
+
+			*tus = modelstest.UserService{}
+			*trls = modelstest.RoleService{}
+			*trs = modelstest.RatingService{}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckTimeout is how long the check of Ready waits for the dependencies
+// of the application to answer.
+const healthCheckTimeout = 2 * time.Second
+
+// Health implements the probes used by orchestrators to check the state of the
+// application. It is not ready until SetReady is called, so no traffic is
+// routed to an instance while it warms up.
+type Health struct {
+	ready int32
+
+	// check, if not nil, reports whether the dependencies of the
+	// application answer.
+	check func(context.Context) error
+}
+
+// NewHealth creates a new Health controller, not ready yet.
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// WithCheck sets the check of the dependencies of the application, like the database, and
+// returns h. The application is not ready while it fails, so no traffic is routed to it while
+// the database restarts, but it stays live, so orchestrators don't restart it for that.
+func (h *Health) WithCheck(check func(context.Context) error) *Health {
+	h.check = check
+	return h
+}
+
+// SetReady sets whether the application can serve requests.
+func (h *Health) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+
+	atomic.StoreInt32(&h.ready, v)
+}
+
+// Live reports that the application is running.
+//
+// GET /health/live
+func (h *Health) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports whether the application can serve requests, with a 503 status
+// code while it is starting or shutting down, or while its check fails.
+//
+// GET /health/ready
+func (h *Health) Ready(c *gin.Context) {
+	if atomic.LoadInt32(&h.ready) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+		return
+	}
+
+	if h.check != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+		defer cancel()
+
+		err := h.check(ctx)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hc := NewHealth()
+	mux := gin.New()
+	mux.GET("/health/live", hc.Live)
+	mux.GET("/health/ready", hc.Ready)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/health/live")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	w = get("/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "must not be ready until set")
+	assert.JSONEq(t, `{"status":"unavailable"}`, w.Body.String())
+
+	hc.SetReady(true)
+	w = get("/health/ready")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	hc.SetReady(false)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/health/ready").Code)
+}
+
+func TestHealth_Check(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var checkErr error
+	hc := NewHealth().WithCheck(func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok, "must check with a timeout")
+		return checkErr
+	})
+	hc.SetReady(true)
+	mux := gin.New()
+	mux.GET("/health/live", hc.Live)
+	mux.GET("/health/ready", hc.Ready)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/health/ready").Code)
+
+	checkErr = errors.New("connection refused")
+	w := get("/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable"}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, get("/health/live").Code, "must stay live while the check fails")
+}
@@ -1,9 +1,12 @@
 package controllers
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/noelruault/ratingsapp/internal/models"
@@ -23,6 +26,18 @@ func parseForm(c *gin.Context, dst interface{}) error {
 	return nil
 }
 
+// parseFormOrJSON parses a form-encoded or a JSON input into a destination value, depending on the
+// Content-Type of the request, for the endpoints that must take forms but are also called by
+// clients only speaking JSON. Types using the +json structured syntax suffix are parsed as JSON.
+func parseFormOrJSON(c *gin.Context, dst interface{}) error {
+	ctype := c.ContentType()
+	if ctype != "application/json" && !strings.HasSuffix(ctype, "+json") {
+		return parseForm(c, dst)
+	}
+
+	return parseJSON(c, dst)
+}
+
 // parseJSON uses Gin to parse a json input into a destination value. It does not check for
 // Content-Type as it is expected to already be checked by middleware.
 func parseJSON(c *gin.Context, dst interface{}) error {
@@ -34,6 +49,27 @@ func parseJSON(c *gin.Context, dst interface{}) error {
 	return nil
 }
 
+// parsePatch reads a JSON Merge Patch document (RFC 7396) from the body of a request. The document
+// must be a JSON object whose members can be decoded into dst, which is only used to check their
+// types. ErrInvalidJSONInput is returned otherwise.
+func parsePatch(c *gin.Context, dst interface{}) ([]byte, error) {
+	b, err := c.GetRawData()
+	if err != nil {
+		return nil, ErrInvalidJSONInput
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil || members == nil {
+		return nil, ErrInvalidJSONInput
+	}
+
+	if err := json.Unmarshal(b, dst); err != nil {
+		return nil, ErrInvalidJSONInput
+	}
+
+	return b, nil
+}
+
 // getParamInt retrieves an int64 parameter from the URL path of a request. In
 // case the parameter is not an integer, ErrNotFound is returned.
 // Negative integers are accepted.
@@ -48,6 +84,83 @@ func getParamInt(c *gin.Context, paramName string) (int64, error) {
 	return v, nil
 }
 
+// anyVersion is the version getIfMatch returns for "If-Match: *", which matches the current version
+// of any existing resource. The services skip the version check for it, and still return
+// models.ErrNotFound for the resources that do not exist.
+const anyVersion int64 = 0
+
+// getIfMatch retrieves the resource version a request expects to modify, as passed in its If-Match
+// header. The version is expected to be one of the ETag values returned by the API, or "*", which
+// results in anyVersion.
+//
+// ErrPreconditionRequired is returned if the header is missing. As If-Match compares the entity tags
+// strongly, weak tags like W/"3" never match and ErrWeakETag is returned for them. If the header holds
+// any other value that was not issued as an ETag, models.ErrConflict is returned, as it can never match
+// the current version.
+func getIfMatch(c *gin.Context) (int64, error) {
+	h := strings.TrimSpace(c.GetHeader("If-Match"))
+	switch {
+	case h == "":
+		return 0, ErrPreconditionRequired
+	case h == "*":
+		return anyVersion, nil
+	case strings.HasPrefix(h, "W/"):
+		return 0, ErrWeakETag
+	}
+
+	if len(h) < 2 || h[0] != '"' || h[len(h)-1] != '"' {
+		return 0, models.ErrConflict
+	}
+
+	v, err := strconv.ParseInt(h[1:len(h)-1], 10, 0)
+	if err != nil || v < 1 {
+		return 0, models.ErrConflict
+	}
+
+	return v, nil
+}
+
+// setETag sets the ETag header of a response to represent the resource version v.
+func setETag(c *gin.Context, v int64) {
+	c.Header("ETag", versionETag(v))
+}
+
+// versionETag returns the entity tag of the resource version v.
+func versionETag(v int64) string {
+	return `"` + strconv.FormatInt(v, 10) + `"`
+}
+
+// notModified sets the ETag header of a response to etag, and the Last-Modified header to modified if
+// it is not nil, and tells whether the client has this representation already: when the If-None-Match
+// header lists etag, or, without the header, when If-Modified-Since is not before modified. The tags
+// are compared weakly, so W/"3" matches "3". The response is then set to 304 Not Modified, and the
+// handler must not write a body.
+func notModified(c *gin.Context, etag string, modified *time.Time) bool {
+	c.Header("ETag", etag)
+	if modified != nil {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	var match bool
+	if h := c.GetHeader("If-None-Match"); h != "" {
+		for _, tag := range strings.Split(h, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				match = true
+				break
+			}
+		}
+	} else if h := c.GetHeader("If-Modified-Since"); h != "" && modified != nil {
+		since, err := http.ParseTime(h)
+		match = err == nil && !modified.Truncate(time.Second).After(since)
+	}
+
+	if match {
+		c.Status(http.StatusNotModified)
+	}
+	return match
+}
+
 // getQueryListInt retrieves a list of int64 parameters from a request's query string.
 // In case paramName is not found, nil is returned for both return values.
 // If there's a failure in parsing the integers in the list, a ValidationError
@@ -75,6 +188,99 @@ func getQueryListInt(c *gin.Context, paramName string) ([]int64, error) {
 	return ret, nil
 }
 
+// getQueryExpand retrieves the names of the related models to embed in a response, from the
+// comma-separated list of the "expand" query parameter. In case it is not found, nil is returned
+// for both return values, and an empty set if it is empty. If a name is not in allowed, a
+// ValidationError is returned.
+func getQueryExpand(c *gin.Context, allowed ...string) (map[string]bool, error) {
+	p, ok := c.GetQuery("expand")
+	if !ok {
+		return nil, nil
+	}
+
+	expand := make(map[string]bool)
+	for _, name := range strings.Split(p, ",") {
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, a := range allowed {
+			if name == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, models.ValidationError{
+				"expand": models.ErrInvalid,
+			}
+		}
+
+		expand[name] = true
+	}
+
+	return expand, nil
+}
+
+// getQueryBool retrieves an optional boolean parameter from a request's query string.
+// In case paramName is not found, nil is returned for both return values.
+// If the value is not a boolean, a ValidationError is returned.
+func getQueryBool(c *gin.Context, paramName string) (*bool, error) {
+	p, ok := c.GetQuery(paramName)
+	if !ok {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseBool(p)
+	if err != nil {
+		return nil, models.ValidationError{
+			paramName: ErrParseError,
+		}
+	}
+
+	return &v, nil
+}
+
+// getQueryInt retrieves an optional int64 parameter from a request's query string.
+// In case paramName is not found, nil is returned for both return values.
+// If the value is not an integer, a ValidationError is returned.
+func getQueryInt(c *gin.Context, paramName string) (*int64, error) {
+	p, ok := c.GetQuery(paramName)
+	if !ok {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseInt(p, 10, 0)
+	if err != nil {
+		return nil, models.ValidationError{
+			paramName: ErrParseError,
+		}
+	}
+
+	return &v, nil
+}
+
+// getQueryDay retrieves an optional day parameter, as YYYY-MM-DD, from a request's query
+// string. In case paramName is not found, the previous UTC day is returned. If the value is
+// not a day, a ValidationError is returned.
+func getQueryDay(c *gin.Context, paramName string) (time.Time, error) {
+	p, ok := c.GetQuery(paramName)
+	if !ok {
+		y, m, d := time.Now().UTC().AddDate(0, 0, -1).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	}
+
+	day, err := time.Parse("2006-01-02", p)
+	if err != nil {
+		return time.Time{}, models.ValidationError{
+			paramName: ErrParseError,
+		}
+	}
+
+	return day, nil
+}
+
 // getEncodedListInt retrieves a list of int64 parameters from a query string.
 // In case paramName is not found, nil is returned for both return values.
 // If there's a failure in parsing the integers in the list, a ValidationError
@@ -122,3 +328,21 @@ func getQueryParam(c *gin.Context, paramName string) (int64, error) {
 
 	return id, nil
 }
+
+// sessionClient returns the client of the request, recorded in the sessions
+// the tokens issued to it start, and in the security events.
+func sessionClient(c *gin.Context) models.SessionClient {
+	return models.SessionClient{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+// hasScope reports whether scope is among the space-delimited list of scopes of
+// an OAuth request.
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+)
+
+// serveCase serves req with mux for a test case, once its setup, if any, has run, and returns
+// the recorded response. The fake services in unscoped are unrestricted, unless scoped by the
+// setup.
+func serveCase(t *testing.T, mux *gin.Engine, req *http.Request, setup func(*testing.T), unscoped ...interface{}) *httptest.ResponseRecorder {
+	if setup != nil {
+		setup(t)
+	}
+	for _, s := range unscoped {
+		switch s := s.(type) {
+		case *modelstest.RatingService:
+			modelstest.Unscoped(s)
+		case *modelstest.CardService:
+			modelstest.UnscopedCards(s)
+		default:
+			t.Fatalf("cannot unscope %T", s)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	mux.HandleContext(c)
+
+	return w
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Invitations implements a controller for the invitations to create a user.
+type Invitations struct {
+	is models.InvitationService
+
+	viewErr views.Error
+}
+
+// NewInvitations creates a new Invitations controller.
+func NewInvitations(is models.InvitationService) *Invitations {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrDuplicate, http.StatusConflict)
+	ev.SetCode(models.ErrReadOnly, http.StatusConflict)
+	ev.SetCode(models.ErrQuotaExceeded, http.StatusForbidden)
+
+	return &Invitations{
+		is:      is,
+		viewErr: ev,
+	}
+}
+
+// Create invites someone to create their user with a role, and returns the invitation with the
+// token and link to send them. The pending invitations of the same email address are replaced.
+//
+// POST /api/v1/invitations/
+func (ic *Invitations) Create(c *gin.Context) {
+	var input struct {
+		Email  string `json:"email"`
+		RoleID int64  `json:"roleId"`
+	}
+
+	err := parseJSON(c, &input)
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	inv := models.Invitation{
+		Email:     input.Email,
+		RoleID:    input.RoleID,
+		InvitedBy: middleware.Actor(c).ID,
+	}
+
+	err = ic.is.Create(&inv)
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &inv)
+}
+
+// List returns all the invitations, most recent first, with their status.
+//
+// GET /api/v1/invitations/
+func (ic *Invitations) List(c *gin.Context) {
+	invs, err := ic.is.List()
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	if invs == nil {
+		invs = []models.Invitation{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": invs,
+	})
+}
+
+// Renew extends an invitation that was not accepted, expired or not, and returns it with a new
+// token and link. The links sent before are revoked.
+//
+// POST /api/v1/invitations/:id/renew
+func (ic *Invitations) Renew(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	inv, err := ic.is.Renew(id)
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &inv)
+}
+
+// Delete removes an invitation, revoking its link if it was not accepted.
+//
+// DELETE /api/v1/invitations/:id
+func (ic *Invitations) Delete(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	err = ic.is.Delete(id)
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// Accept takes the token of an invitation, and creates the user invited with the names and
+// password the invitee chose. It does not require authentication.
+//
+// POST /api/v1/invitations/accept
+func (ic *Invitations) Accept(c *gin.Context) {
+	var input struct {
+		Token     string          `json:"token"`
+		FirstName string          `json:"firstName"`
+		LastName  string          `json:"lastName"`
+		Password  string          `json:"password"`
+		Settings  json.RawMessage `json:"settings"`
+	}
+
+	err := parseJSON(c, &input)
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	user := models.User{
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Password:  input.Password,
+		Settings:  input.Settings,
+	}
+
+	err = ic.is.Accept(input.Token, &user)
+	if err != nil {
+		ic.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusCreated, &user)
+}
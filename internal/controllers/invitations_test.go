@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	is := &modelstest.InvitationService{}
+	ic := NewInvitations(is)
+
+	created := time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC)
+	invitation := models.Invitation{
+		ID:        12,
+		Email:     "morty@smith.com",
+		RoleID:    2,
+		InvitedBy: 1,
+		CreatedAt: created,
+		ExpiresAt: created.Add(models.InvitationTTL),
+		Status:    models.InvitationPending,
+		Token:     "12.signature",
+		Link:      "https://app.example.com/invite?token=12.signature",
+	}
+	const invitationJSON = `{"id":12,"email":"morty@smith.com","roleId":2,"invitedBy":1,` +
+		`"createdAt":"2019-10-01T10:00:00Z","expiresAt":"2019-10-08T10:00:00Z","status":"pending",` +
+		`"token":"12.signature","link":"https://app.example.com/invite?token=12.signature"}`
+
+	mux := gin.New()
+	mux.POST("/api/v1/invitations/accept", ic.Accept)
+	authed := mux.Group("/", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	})
+	authed.GET("/api/v1/invitations/", ic.List)
+	authed.POST("/api/v1/invitations/", ic.Create)
+	authed.POST("/api/v1/invitations/:id/renew", ic.Renew)
+	authed.DELETE("/api/v1/invitations/:id", ic.Delete)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"createBadJSON",
+			"POST",
+			"/api/v1/invitations/",
+			`{"email":`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"createDuplicate",
+			"POST",
+			"/api/v1/invitations/",
+			`{"email":"admin@admin.com","roleId":2}`,
+			http.StatusConflict,
+			`{"error":"validation_error","fields":{"email":"is_duplicate"}}`,
+			func(t *testing.T) {
+				is.CreateFunc = func(inv *models.Invitation) error {
+					return models.ValidationError{"email": models.ErrDuplicate}
+				}
+			},
+		},
+		{
+			"create",
+			"POST",
+			"/api/v1/invitations/",
+			`{"email":"morty@smith.com","roleId":2,"invitedBy":7}`,
+			http.StatusCreated,
+			invitationJSON,
+			func(t *testing.T) {
+				is.CreateFunc = func(inv *models.Invitation) error {
+					assert.Equal(t, &models.Invitation{Email: "morty@smith.com", RoleID: 2, InvitedBy: 1}, inv,
+						"must be invited by the authenticated user")
+					*inv = invitation
+					return nil
+				}
+			},
+		},
+		{
+			"listEmpty",
+			"GET",
+			"/api/v1/invitations/",
+			"",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				is.ListFunc = func() ([]models.Invitation, error) {
+					return nil, nil
+				}
+			},
+		},
+		{
+			"listError",
+			"GET",
+			"/api/v1/invitations/",
+			"",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				is.ListFunc = func() ([]models.Invitation, error) {
+					return nil, privateError("test error message")
+				}
+			},
+		},
+		{
+			"renewBadID",
+			"POST",
+			"/api/v1/invitations/abc/renew",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"renewAccepted",
+			"POST",
+			"/api/v1/invitations/12/renew",
+			"",
+			http.StatusConflict,
+			`{"error":"read_only"}`,
+			func(t *testing.T) {
+				is.RenewFunc = func(id int64) (models.Invitation, error) {
+					return models.Invitation{}, models.ErrReadOnly
+				}
+			},
+		},
+		{
+			"renew",
+			"POST",
+			"/api/v1/invitations/12/renew",
+			"",
+			http.StatusOK,
+			invitationJSON,
+			func(t *testing.T) {
+				is.RenewFunc = func(id int64) (models.Invitation, error) {
+					assert.Equal(t, int64(12), id)
+					return invitation, nil
+				}
+			},
+		},
+		{
+			"deleteNotFound",
+			"DELETE",
+			"/api/v1/invitations/13",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				is.DeleteFunc = func(id int64) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"delete",
+			"DELETE",
+			"/api/v1/invitations/12",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				is.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(12), id)
+					return nil
+				}
+			},
+		},
+		{
+			"acceptInvalid",
+			"POST",
+			"/api/v1/invitations/accept",
+			`{"token":"12.forged","firstName":"Morty","password":"OhGeezRick1234"}`,
+			http.StatusBadRequest,
+			`{"error":"invalid_invitation"}`,
+			func(t *testing.T) {
+				is.AcceptFunc = func(token string, u *models.User) error {
+					return models.ErrInvalidInvitation
+				}
+			},
+		},
+		{
+			"accept",
+			"POST",
+			"/api/v1/invitations/accept",
+			`{"token":"12.signature","firstName":"Morty","lastName":"Smith","password":"OhGeezRick1234","roleId":1}`,
+			http.StatusCreated,
+			`{"id":991,"active":true,"email":"morty@smith.com","firstName":"Morty","lastName":"Smith","roleId":2}`,
+			func(t *testing.T) {
+				is.AcceptFunc = func(token string, u *models.User) error {
+					assert.Equal(t, "12.signature", token)
+					assert.Equal(t, &models.User{FirstName: "Morty", LastName: "Smith", Password: "OhGeezRick1234"}, u,
+						"must not take the role from the input")
+
+					*u = models.User{ID: 991, Active: true, Email: "morty@smith.com", FirstName: "Morty", LastName: "Smith", RoleID: 2, Version: 1}
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outJSON == "" {
+				assert.Empty(t, w.Body.String())
+			} else {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*is = modelstest.InvitationService{}
+		})
+	}
+}
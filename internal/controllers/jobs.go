@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/scheduler"
+	"github.com/noelruault/ratingsapp/internal/views"
+	"golang.org/x/xerrors"
+)
+
+// Jobs implements a controller for the background jobs of the application, run by a scheduler.
+type Jobs struct {
+	s *scheduler.Scheduler
+
+	viewErr views.Error
+}
+
+// NewJobs creates a new Jobs controller for the jobs of s.
+func NewJobs(s *scheduler.Scheduler) *Jobs {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(ErrJobRunning, http.StatusConflict)
+
+	return &Jobs{
+		s:       s,
+		viewErr: ev,
+	}
+}
+
+// job is the representation of the stats of a job in the responses.
+type job struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration float64    `json:"lastDuration"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastSuccess  *time.Time `json:"lastSuccess,omitempty"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+}
+
+// List returns the jobs, sorted by name, with the stats of their runs since the application
+// started. The duration of the last run is in seconds.
+//
+// GET /api/v1/admin/jobs/
+func (j *Jobs) List(c *gin.Context) {
+	stats := j.s.Stats()
+
+	items := make([]job, len(stats))
+	for i, st := range stats {
+		items[i] = job{
+			Name:         st.Name,
+			Schedule:     st.Schedule,
+			Runs:         st.Runs,
+			Failures:     st.Failures,
+			Running:      st.Running,
+			LastRun:      st.LastRun,
+			LastDuration: st.LastDuration.Seconds(),
+			LastError:    st.LastError,
+			LastSuccess:  st.LastSuccess,
+		}
+		if !st.NextRun.IsZero() {
+			next := st.NextRun
+			items[i].NextRun = &next
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+	})
+}
+
+// Run triggers a job by name, which runs in the background as soon as possible.
+//
+// POST /api/v1/admin/jobs/:name/run
+func (j *Jobs) Run(c *gin.Context) {
+	err := j.s.Trigger(c.Param("name"))
+	if xerrors.Is(err, scheduler.ErrNotFound) {
+		err = ErrNotFound
+	} else if xerrors.Is(err, scheduler.ErrRunning) {
+		err = ErrJobRunning
+	}
+	if err != nil {
+		j.viewErr.JSON(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// the 31st of February never comes, so the job only runs when triggered
+	never, err := scheduler.Parse("0 0 31 2 *")
+	require.NoError(t, err)
+
+	var (
+		started = make(chan struct{}, 1)
+		release = make(chan struct{})
+	)
+	s := scheduler.New(nil)
+	s.Add("cleanup", never, func(ctx context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	s.Start()
+	defer s.Close()
+
+	j := NewJobs(s)
+	mux := gin.New()
+	mux.GET("/api/v1/admin/jobs/", j.List)
+	mux.POST("/api/v1/admin/jobs/:name/run", j.Run)
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(method, path, nil)
+		c.Request.Header.Add("Accept", "application/json")
+		mux.HandleContext(c)
+		return w
+	}
+
+	w := request("GET", "/api/v1/admin/jobs/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items":[{"name":"cleanup","schedule":"0 0 31 2 *","runs":0,"failures":0,"running":false,"lastDuration":0}]}`, w.Body.String())
+
+	w = request("POST", "/api/v1/admin/jobs/missing/run")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"not_found"}`, w.Body.String())
+
+	w = request("POST", "/api/v1/admin/jobs/cleanup/run")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	<-started
+
+	w = request("POST", "/api/v1/admin/jobs/cleanup/run")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error":"job_running"}`, w.Body.String())
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		st := s.Stats()[0]
+		return st.Runs == 1 && !st.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	w = request("GET", "/api/v1/admin/jobs/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"runs":1`)
+	assert.Contains(t, w.Body.String(), `"lastSuccess":`)
+}
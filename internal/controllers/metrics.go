@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/metrics"
+)
+
+// Metrics serves the application metrics to monitoring systems, in the OpenMetrics text format.
+// Metrics are aggregated periodically and set with Set, so scrapes never reach the database.
+type Metrics struct {
+	// page holds the last metrics set, already written.
+	page atomic.Value
+}
+
+// NewMetrics creates a new Metrics controller, without any metrics until Set is called.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// Set replaces the metrics served with families.
+func (m *Metrics) Set(families []metrics.Family) error {
+	var b bytes.Buffer
+	err := metrics.Write(&b, families)
+	if err != nil {
+		return err
+	}
+
+	m.page.Store(b.Bytes())
+	return nil
+}
+
+// Get returns the last metrics set, with a 503 status code if they were never set.
+//
+// GET /metrics
+func (m *Metrics) Get(c *gin.Context) {
+	page, ok := m.page.Load().([]byte)
+	if !ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+		return
+	}
+
+	c.Data(http.StatusOK, metrics.ContentType, page)
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := NewMetrics()
+
+	mux := gin.New()
+	mux.GET("/metrics", m.Get)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/metrics", nil)
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "must not be available until set")
+
+	require.NoError(t, m.Set([]metrics.Family{{Name: "users", Type: metrics.Gauge, Samples: []metrics.Sample{{Value: 3}}}}))
+	w = get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE users gauge\nusers 3\n# EOF\n", w.Body.String())
+
+	assert.Error(t, m.Set([]metrics.Family{{Name: "bad name", Type: metrics.Gauge}}))
+	w = get()
+	assert.Equal(t, "# TYPE users gauge\nusers 3\n# EOF\n", w.Body.String(), "must keep the last valid metrics")
+}
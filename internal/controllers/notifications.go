@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Notifications implements a controller for the inbox of the authenticated user.
+type Notifications struct {
+	ns models.NotificationService
+
+	viewErr views.Error
+}
+
+// NewNotifications creates a new Notifications controller.
+func NewNotifications(ns models.NotificationService) *Notifications {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	return &Notifications{
+		ns:      ns,
+		viewErr: ev,
+	}
+}
+
+// List returns the latest in-app notifications of the requester, newest first. With the
+// unread parameter set to true, only the ones not read yet are returned.
+//
+// GET /api/v1/me/notifications?unread=true
+func (nc *Notifications) List(c *gin.Context) {
+	unread, err := getQueryBool(c, "unread")
+	if err != nil {
+		nc.viewErr.JSON(c, err)
+		return
+	}
+
+	ns, err := nc.ns.List(middleware.Actor(c).ID, unread != nil && *unread)
+	if err != nil {
+		nc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": ns})
+}
+
+// MarkRead marks a notification of the requester as read, and returns it.
+//
+// POST /api/v1/me/notifications/:id/read
+func (nc *Notifications) MarkRead(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		nc.viewErr.JSON(c, err)
+		return
+	}
+
+	n, err := nc.ns.MarkRead(middleware.Actor(c).ID, id)
+	if err != nil {
+		nc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &n)
+}
+
+// MarkAllRead marks every notification of the requester as read, and returns the number of
+// notifications that were not read yet.
+//
+// POST /api/v1/me/notifications/read
+func (nc *Notifications) MarkAllRead(c *gin.Context) {
+	count, err := nc.ns.MarkAllRead(middleware.Actor(c).ID)
+	if err != nil {
+		nc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": count})
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifications(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ns := &modelstest.NotificationService{}
+	nc := NewNotifications(ns)
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	read := created.Add(time.Hour)
+	ratingID, replyID, score := int64(12), int64(5), 2
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 7, RoleID: 2})
+	})
+	mux.GET("/api/v1/me/notifications", nc.List)
+	mux.POST("/api/v1/me/notifications/read", nc.MarkAllRead)
+	mux.POST("/api/v1/me/notifications/:id/read", nc.MarkRead)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/me/notifications",
+			http.StatusOK,
+			`{"items":[{"id":3,"userId":7,"kind":"reply","target":9,"ratingId":12,"score":2,"replyId":5,"average":3.5,` +
+				`"createdAt":"2020-01-02T03:04:05Z"}]}`,
+			func(t *testing.T) {
+				ns.ListFunc = func(userID int64, unread bool) ([]models.Notification, error) {
+					assert.Equal(t, int64(7), userID)
+					assert.False(t, unread)
+					return []models.Notification{{ID: 3, UserID: 7, Kind: models.NotificationReply, Target: 9,
+						RatingID: &ratingID, Score: &score, ReplyID: &replyID, Average: 3.5, CreatedAt: created}}, nil
+				}
+			},
+		},
+		{
+			"listUnread",
+			"GET",
+			"/api/v1/me/notifications?unread=true",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				ns.ListFunc = func(userID int64, unread bool) ([]models.Notification, error) {
+					assert.True(t, unread)
+					return []models.Notification{}, nil
+				}
+			},
+		},
+		{
+			"listBadUnread",
+			"GET",
+			"/api/v1/me/notifications?unread=maybe",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"unread":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"markRead",
+			"POST",
+			"/api/v1/me/notifications/3/read",
+			http.StatusOK,
+			`{"id":3,"userId":7,"kind":"ratingRemoved","target":9,"ratingId":12,"score":2,"average":3.5,` +
+				`"createdAt":"2020-01-02T03:04:05Z","readAt":"2020-01-02T04:04:05Z"}`,
+			func(t *testing.T) {
+				ns.MarkReadFunc = func(userID, id int64) (models.Notification, error) {
+					assert.Equal(t, int64(7), userID)
+					assert.Equal(t, int64(3), id)
+					return models.Notification{ID: 3, UserID: 7, Kind: models.NotificationRatingRemoved, Target: 9,
+						RatingID: &ratingID, Score: &score, Average: 3.5, CreatedAt: created, ReadAt: &read}, nil
+				}
+			},
+		},
+		{
+			"markReadNotFound",
+			"POST",
+			"/api/v1/me/notifications/4/read",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ns.MarkReadFunc = func(userID, id int64) (models.Notification, error) {
+					return models.Notification{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"markReadBadID",
+			"POST",
+			"/api/v1/me/notifications/abc/read",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"markAllRead",
+			"POST",
+			"/api/v1/me/notifications/read",
+			http.StatusOK,
+			`{"marked":4}`,
+			func(t *testing.T) {
+				ns.MarkAllReadFunc = func(userID int64) (int64, error) {
+					assert.Equal(t, int64(7), userID)
+					return 4, nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			assert.JSONEq(t, tc.outJSON, w.Body.String())
+
+			*ns = modelstest.NotificationService{}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Organisations implements a controller for the management of the organisations, the isolated
+// workspaces of the customers of a deployment.
+type Organisations struct {
+	os models.OrganisationService
+
+	viewErr views.Error
+}
+
+// NewOrganisations creates a new Organisations controller.
+func NewOrganisations(os models.OrganisationService) *Organisations {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrInUse, http.StatusConflict)
+
+	return &Organisations{
+		os:      os,
+		viewErr: ev,
+	}
+}
+
+// List returns the organisations, sorted by name.
+//
+// GET /api/v1/admin/organisations/
+func (oc *Organisations) List(c *gin.Context) {
+	orgs, err := oc.os.List()
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": orgs,
+	})
+}
+
+// Get returns one organisation by ID.
+//
+// GET /api/v1/admin/organisations/:id
+func (oc *Organisations) Get(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	o, err := oc.os.ByID(id)
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &o)
+}
+
+// Create adds an organisation. Its users and roles are then created by the admins, with the
+// orgId field.
+//
+// POST /api/v1/admin/organisations/
+func (oc *Organisations) Create(c *gin.Context) {
+	var o models.Organisation
+
+	err := parseJSON(c, &o)
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = oc.os.Create(&o)
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &o)
+}
+
+// Update renames an organisation.
+//
+// PUT /api/v1/admin/organisations/:id
+func (oc *Organisations) Update(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	var o models.Organisation
+
+	err = parseJSON(c, &o)
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+	o.ID = id
+
+	err = oc.os.Update(&o)
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &o)
+}
+
+// Delete removes an organisation, which must not have any user, role or rating left.
+//
+// DELETE /api/v1/admin/organisations/:id
+func (oc *Organisations) Delete(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = oc.os.Delete(id)
+	if err != nil {
+		oc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganisations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	os := &modelstest.OrganisationService{}
+	oc := NewOrganisations(os)
+
+	created := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	org := models.Organisation{ID: 4, Name: "Acme", CreatedAt: created}
+	const orgJSON = `{"id":4,"name":"Acme","createdAt":"2020-03-01T00:00:00Z"}`
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/organisations/", oc.List)
+	mux.POST("/api/v1/admin/organisations/", oc.Create)
+	mux.GET("/api/v1/admin/organisations/:id", oc.Get)
+	mux.PUT("/api/v1/admin/organisations/:id", oc.Update)
+	mux.DELETE("/api/v1/admin/organisations/:id", oc.Delete)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/admin/organisations/",
+			"",
+			http.StatusOK,
+			`{"items":[` + orgJSON + `]}`,
+			func(t *testing.T) {
+				os.ListFunc = func() ([]models.Organisation, error) {
+					return []models.Organisation{org}, nil
+				}
+			},
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/admin/organisations/4",
+			"",
+			http.StatusOK,
+			orgJSON,
+			func(t *testing.T) {
+				os.ByIDFunc = func(id int64) (models.Organisation, error) {
+					assert.Equal(t, int64(4), id)
+					return org, nil
+				}
+			},
+		},
+		{
+			"getBadID",
+			"GET",
+			"/api/v1/admin/organisations/acme",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"getUnknown",
+			"GET",
+			"/api/v1/admin/organisations/5",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				os.ByIDFunc = func(id int64) (models.Organisation, error) {
+					return models.Organisation{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"create",
+			"POST",
+			"/api/v1/admin/organisations/",
+			`{"name":"Acme"}`,
+			http.StatusCreated,
+			orgJSON,
+			func(t *testing.T) {
+				os.CreateFunc = func(o *models.Organisation) error {
+					assert.Equal(t, "Acme", o.Name)
+					o.ID, o.CreatedAt = 4, created
+					return nil
+				}
+			},
+		},
+		{
+			"createDuplicate",
+			"POST",
+			"/api/v1/admin/organisations/",
+			`{"name":"Acme"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"name":"is_duplicate"}}`,
+			func(t *testing.T) {
+				os.CreateFunc = func(o *models.Organisation) error {
+					return models.ValidationError{"name": models.ErrDuplicate}
+				}
+			},
+		},
+		{
+			"update",
+			"PUT",
+			"/api/v1/admin/organisations/4",
+			`{"id":9,"name":"Acme"}`,
+			http.StatusOK,
+			orgJSON,
+			func(t *testing.T) {
+				os.UpdateFunc = func(o *models.Organisation) error {
+					assert.Equal(t, int64(4), o.ID, "must be identified by the path")
+					o.CreatedAt = created
+					return nil
+				}
+			},
+		},
+		{
+			"delete",
+			"DELETE",
+			"/api/v1/admin/organisations/4",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				os.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(4), id)
+					return nil
+				}
+			},
+		},
+		{
+			"deleteInUse",
+			"DELETE",
+			"/api/v1/admin/organisations/4",
+			"",
+			http.StatusConflict,
+			`{"error":"in_use"}`,
+			func(t *testing.T) {
+				os.DeleteFunc = func(id int64) error {
+					return models.ErrInUse
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*os = modelstest.OrganisationService{}
+		})
+	}
+}
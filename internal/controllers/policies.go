@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+	"golang.org/x/xerrors"
+)
+
+// Policies implements a controller for the management of the policies, the expressions
+// evaluated on the ratings, and of the record of their changes.
+type Policies struct {
+	ps models.PolicyService
+
+	viewErr views.Error
+}
+
+// NewPolicies creates a new Policies controller.
+func NewPolicies(ps models.PolicyService) *Policies {
+	var ev views.Error
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	return &Policies{
+		ps:      ps,
+		viewErr: ev,
+	}
+}
+
+// List returns the policies set.
+//
+// GET /api/v1/admin/policies/
+func (pc *Policies) List(c *gin.Context) {
+	policies, err := pc.ps.List()
+	if err != nil {
+		pc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": policies,
+	})
+}
+
+// Set sets the expression of the policy of a hook, like canRate, recording the change by the
+// user of the session.
+//
+// PUT /api/v1/admin/policies/:hook
+func (pc *Policies) Set(c *gin.Context) {
+	var p models.Policy
+
+	err := parseJSON(c, &p)
+	if err != nil {
+		pc.viewErr.JSON(c, err)
+		return
+	}
+	p.Hook = c.Param("hook")
+	p.UpdatedBy = middleware.Actor(c).ID
+
+	err = pc.ps.Set(&p)
+	if err != nil {
+		pc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &p)
+}
+
+// Remove removes the policy of a hook, recording the change by the user of the session.
+//
+// DELETE /api/v1/admin/policies/:hook
+func (pc *Policies) Remove(c *gin.Context) {
+	err := pc.ps.Remove(c.Param("hook"), middleware.Actor(c).ID)
+	if err != nil {
+		pc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Changes returns the changes of the policy of a hook, newest first.
+//
+// GET /api/v1/admin/policies/:hook/changes
+func (pc *Policies) Changes(c *gin.Context) {
+	changes, err := pc.ps.Changes(c.Param("hook"))
+	if err != nil {
+		pc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": changes,
+	})
+}
+
+// Check checks an expression for the policy of a hook without setting it, returning whether
+// it is valid and, if not, why.
+//
+// POST /api/v1/admin/policies/:hook/check
+func (pc *Policies) Check(c *gin.Context) {
+	var body struct {
+		Expression string `json:"expression"`
+	}
+
+	err := parseJSON(c, &body)
+	if err != nil {
+		pc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = pc.ps.Check(c.Param("hook"), body.Expression)
+	if xerrors.Is(err, models.ErrNotFound) {
+		pc.viewErr.JSON(c, err)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"valid": false,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid": true,
+	})
+}
@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestPolicies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ps := &modelstest.PolicyService{}
+	pc := NewPolicies(ps)
+
+	updated := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	policy := models.Policy{
+		Hook:       models.PolicyCanRate,
+		Expression: "user.roleId != 3",
+		UpdatedBy:  1,
+		UpdatedAt:  updated,
+	}
+	const policyJSON = `{"hook":"canRate","expression":"user.roleId != 3","updatedBy":1,"updatedAt":"2020-03-01T00:00:00Z"}`
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	})
+	mux.GET("/api/v1/admin/policies/", pc.List)
+	mux.PUT("/api/v1/admin/policies/:hook", pc.Set)
+	mux.DELETE("/api/v1/admin/policies/:hook", pc.Remove)
+	mux.GET("/api/v1/admin/policies/:hook/changes", pc.Changes)
+	mux.POST("/api/v1/admin/policies/:hook/check", pc.Check)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/admin/policies/",
+			"",
+			http.StatusOK,
+			`{"items":[` + policyJSON + `]}`,
+			func(t *testing.T) {
+				ps.ListFunc = func() ([]models.Policy, error) {
+					return []models.Policy{policy}, nil
+				}
+			},
+		},
+		{
+			"set",
+			"PUT",
+			"/api/v1/admin/policies/canRate",
+			`{"expression":"user.roleId != 3","updatedBy":9}`,
+			http.StatusOK,
+			policyJSON,
+			func(t *testing.T) {
+				ps.SetFunc = func(p *models.Policy) error {
+					assert.Equal(t, models.PolicyCanRate, p.Hook)
+					assert.Equal(t, int64(1), p.UpdatedBy, "must be recorded as changed by the requester")
+					p.UpdatedAt = updated
+					return nil
+				}
+			},
+		},
+		{
+			"setInvalid",
+			"PUT",
+			"/api/v1/admin/policies/canRate",
+			`{"expression":"user.roleId !="}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"expression":"invalid"}}`,
+			func(t *testing.T) {
+				ps.SetFunc = func(p *models.Policy) error {
+					return models.ValidationError{"expression": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"setUnknownHook",
+			"PUT",
+			"/api/v1/admin/policies/other",
+			`{"expression":"true"}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ps.SetFunc = func(p *models.Policy) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"remove",
+			"DELETE",
+			"/api/v1/admin/policies/score",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				ps.RemoveFunc = func(hook string, userID int64) error {
+					assert.Equal(t, models.PolicyScore, hook)
+					assert.Equal(t, int64(1), userID)
+					return nil
+				}
+			},
+		},
+		{
+			"changes",
+			"GET",
+			"/api/v1/admin/policies/canRate/changes",
+			"",
+			http.StatusOK,
+			`{"items":[{"id":2,"hook":"canRate","previous":"true","expression":"user.roleId != 3","userId":1,` +
+				`"createdAt":"2020-03-01T00:00:00Z"}]}`,
+			func(t *testing.T) {
+				ps.ChangesFunc = func(hook string) ([]models.PolicyChange, error) {
+					return []models.PolicyChange{{
+						ID:         2,
+						Hook:       hook,
+						Previous:   "true",
+						Expression: "user.roleId != 3",
+						UserID:     1,
+						CreatedAt:  updated,
+					}}, nil
+				}
+			},
+		},
+		{
+			"checkValid",
+			"POST",
+			"/api/v1/admin/policies/score/check",
+			`{"expression":"rating.score * 2"}`,
+			http.StatusOK,
+			`{"valid":true}`,
+			func(t *testing.T) {
+				ps.CheckFunc = func(hook, expression string) error {
+					assert.Equal(t, models.PolicyScore, hook)
+					assert.Equal(t, "rating.score * 2", expression)
+					return nil
+				}
+			},
+		},
+		{
+			"checkInvalid",
+			"POST",
+			"/api/v1/admin/policies/score/check",
+			`{"expression":"rating.score > 2"}`,
+			http.StatusOK,
+			`{"valid":false,"error":"models: the score policy must return a value of type int"}`,
+			func(t *testing.T) {
+				ps.CheckFunc = func(hook, expression string) error {
+					return xerrors.New("models: the score policy must return a value of type int")
+				}
+			},
+		},
+		{
+			"checkUnknownHook",
+			"POST",
+			"/api/v1/admin/policies/other/check",
+			`{"expression":"true"}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ps.CheckFunc = func(hook, expression string) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*ps = modelstest.PolicyService{}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Queries implements a controller that runs the saved analytical queries.
+type Queries struct {
+	qs models.QueryService
+
+	viewErr views.Error
+}
+
+// NewQueries creates a new Queries controller.
+func NewQueries(qs models.QueryService) *Queries {
+	var ev views.Error
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	return &Queries{
+		qs:      qs,
+		viewErr: ev,
+	}
+}
+
+// List returns the saved queries that can be run, along with their parameters.
+//
+// GET /api/v1/admin/queries/
+func (q *Queries) List(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"items": q.qs.List(),
+	})
+}
+
+// Run executes a saved query by name. The query parameters are passed in the query string.
+//
+// GET /api/v1/admin/queries/:name?target=999
+func (q *Queries) Run(c *gin.Context) {
+	params := make(map[string]string)
+	for k, v := range c.Request.URL.Query() {
+		params[k] = v[0]
+	}
+
+	res, err := q.qs.Run(c.Param("name"), params)
+	if err != nil {
+		q.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &res)
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueries_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	qs := &modelstest.QueryService{
+		ListFunc: func() []models.SavedQuery {
+			return []models.SavedQuery{
+				{
+					Name:        "topTargets",
+					Description: "Targets with most ratings",
+					SQL:         "SELECT target, count(*) FROM ratings GROUP BY target",
+					Params:      []models.QueryParam{{Name: "since", Type: models.QueryParamInt, Default: "0"}},
+					MaxRows:     10,
+				},
+			}
+		},
+	}
+	q := NewQueries(qs)
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/queries/", q.List)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/api/v1/admin/queries/", nil)
+
+	mux.HandleContext(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items":[{
+		"name":"topTargets",
+		"description":"Targets with most ratings",
+		"params":[{"name":"since","type":"int","default":"0"}],
+		"maxRows":10
+	}]}`, w.Body.String())
+}
+
+func TestQueries_Run(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	qs := &modelstest.QueryService{}
+	q := NewQueries(qs)
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/queries/:name", q.Run)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"notFound",
+			"/api/v1/admin/queries/unknown",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				qs.RunFunc = func(name string, params map[string]string) (models.QueryResult, error) {
+					assert.Equal(t, "unknown", name)
+					return models.QueryResult{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"validationError",
+			"/api/v1/admin/queries/topTargets?since=yesterday",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"since":"invalid"}}`,
+			func(t *testing.T) {
+				qs.RunFunc = func(name string, params map[string]string) (models.QueryResult, error) {
+					return models.QueryResult{}, models.ValidationError{"since": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"internalError",
+			"/api/v1/admin/queries/topTargets",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				qs.RunFunc = func(name string, params map[string]string) (models.QueryResult, error) {
+					return models.QueryResult{}, privateError("test error message")
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/admin/queries/topTargets?since=1257894000&limit=5&limit=6",
+			http.StatusOK,
+			`{"columns":["target","count"],"rows":[[999,2],[1000,1]],"truncated":true}`,
+			func(t *testing.T) {
+				qs.RunFunc = func(name string, params map[string]string) (models.QueryResult, error) {
+					assert.Equal(t, "topTargets", name)
+					assert.Equal(t, map[string]string{"since": "1257894000", "limit": "5"}, params)
+
+					return models.QueryResult{
+						Columns:   []string{"target", "count"},
+						Rows:      [][]interface{}{{999, 2}, {1000, 1}},
+						Truncated: true,
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*qs = modelstest.QueryService{}
+		})
+	}
+}
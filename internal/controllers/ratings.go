@@ -1,23 +1,39 @@
 package controllers
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
 	"github.com/noelruault/ratingsapp/internal/models"
 	"github.com/noelruault/ratingsapp/internal/views"
+	"golang.org/x/xerrors"
 )
 
+// Transactor runs f with the user and rating services of a single database transaction, which
+// is committed if f returns nil, and rolled back otherwise. See models.Services.WithTransaction.
+type Transactor func(f func(us models.UserService, rs models.RatingService) error) error
+
 // Ratings implements a controller for rating management.
 type Ratings struct {
 	rs models.RatingService
+	rq models.RatingQueue
+	tx Transactor
+	ps models.ReplyService
+	as models.AttachmentService
+	us models.UserService
 
 	viewErr views.Error
 }
 
-// NewRatings creates a new Ratings controller.
-func NewRatings(rs models.RatingService) *Ratings {
+// NewRatings creates a new Ratings controller. When rq is not nil, ratings are created through
+// the write-behind queue.
+func NewRatings(rs models.RatingService, rq models.RatingQueue) *Ratings {
 	var ev views.Error
 	ev.SetCode(ErrNotFound, http.StatusNotFound)
 	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
@@ -25,39 +41,160 @@ func NewRatings(rs models.RatingService) *Ratings {
 	ev.SetCode(models.ErrReadOnly, http.StatusConflict)
 	ev.SetCode(models.ErrDuplicate, http.StatusConflict)
 	ev.SetCode(models.ErrIDTaken, http.StatusConflict)
+	ev.SetCode(models.ErrConflict, http.StatusPreconditionFailed)
+	ev.SetCode(ErrPreconditionRequired, http.StatusPreconditionRequired)
+	ev.SetCode(ErrWeakETag, http.StatusPreconditionFailed)
+	ev.SetCode(models.ErrRateLimited, http.StatusTooManyRequests)
+	ev.SetCode(models.ErrPolicyDenied, http.StatusForbidden)
+	ev.SetCode(models.ErrQuotaExceeded, http.StatusForbidden)
+	ev.SetCode(ErrForbidden, http.StatusForbidden)
 
 	return &Ratings{
 		rs:      rs,
+		rq:      rq,
 		viewErr: ev,
 	}
 }
 
-// Create performs the addition of a rating.
-//
-// POST /api/v1/ratings/
-func (r *Ratings) Create(c *gin.Context) {
+// WithTransactions sets the transactor of the operations changing several models at once, like
+// CreateWithSettings, and returns r. They are not found without it.
+func (r *Ratings) WithTransactions(tx Transactor) *Ratings {
+	r.tx = tx
+	return r
+}
+
+// WithReplies sets the service of the replies to the ratings, which Get returns on request, and
+// returns r.
+func (r *Ratings) WithReplies(ps models.ReplyService) *Ratings {
+	r.ps = ps
+	return r
+}
+
+// WithAttachments sets the service of the files attached to the ratings, which Get and
+// ListByTarget return along with them, and returns r.
+func (r *Ratings) WithAttachments(as models.AttachmentService) *Ratings {
+	r.as = as
+	return r
+}
+
+// WithUsers sets the service of the users, which Get and ListByTarget embed in the ratings they
+// return on request, and returns r.
+func (r *Ratings) WithUsers(us models.UserService) *Ratings {
+	r.us = us
+	return r
+}
+
+// ratingWithUser is a rating returned along with its author, see expandUsers.
+type ratingWithUser struct {
+	*models.Rating
+	User *views.Author `json:"user,omitempty"`
+}
+
+// ratingWithReplies is a rating returned along with its replies, see Get.
+type ratingWithReplies struct {
+	ratingWithUser
+	Replies []models.Reply `json:"replies"`
+}
 
-	// user will be used to attach the rating to a specific user.
-	user, exists := c.Get("user")
-	if !exists {
-		r.viewErr.JSON(c, errors.New("user couldn't be get from the context"))
+// ratingWithSettings is a rating created along with the settings of its author, see
+// CreateWithSettings.
+type ratingWithSettings struct {
+	Rating   *models.Rating  `json:"rating"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+	User     *models.User    `json:"user,omitempty"`
+}
+
+// CreateWithSettings performs the addition of a rating and the merge of settings into the ones of
+// the current user in a single transaction, so neither is stored if the other fails. The write-behind
+// queue is not used.
+//
+// POST /api/v1/ratings/with-settings
+func (r *Ratings) CreateWithSettings(c *gin.Context) {
+	if r.tx == nil {
+		r.viewErr.JSON(c, ErrNotFound)
 		return
 	}
 
+	u := middleware.Actor(c)
+
 	var rating = models.NewRating()
+	req := ratingWithSettings{Rating: &rating}
+	err := parseJSON(c, &req)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
 
-	u, ok := user.(*models.User)
-	if !ok {
-		panic("user from the context must be a pointer of models.User type")
+	if len(req.Settings) == 0 || string(req.Settings) == "null" {
+		r.viewErr.JSON(c, models.ValidationError{"settings": models.ErrRequired})
+		return
+	}
+
+	patch, err := json.Marshal(map[string]json.RawMessage{"settings": req.Settings})
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
 	}
 
+	rating.User = u.User
+	updated := models.User{ID: u.ID}
+
+	err = r.tx(func(us models.UserService, rs models.RatingService) error {
+		err := rs.Create(&rating)
+		if err != nil {
+			return err
+		}
+
+		return us.UpdatePartial(&updated, patch)
+	})
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &ratingWithSettings{Rating: &rating, User: &updated})
+}
+
+// Create performs the addition of a rating.
+//
+// If the write-behind queue is enabled, the rating is only validated and queued, and an HTTP
+// Accepted response is returned with the receipt of the queued creation. A rating sent with
+// "draft" set to true is saved as a draft instead, without the queue, see PublishDraft.
+//
+// POST /api/v1/ratings/
+func (r *Ratings) Create(c *gin.Context) {
+	var rating = models.NewRating()
 	err := parseJSON(c, &rating)
 	if err != nil {
 		r.viewErr.JSON(c, err)
 		return
 	}
 
-	rating.User = u
+	// attaches the rating to the user creating it
+	rating.User = middleware.Actor(c).User
+
+	if rating.Draft {
+		err = r.rs.CreateDraft(&rating)
+		if err != nil {
+			r.viewErr.JSON(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, &rating)
+		return
+	}
+
+	if r.rq != nil {
+		key, err := r.rq.Enqueue(&rating)
+		if err != nil {
+			r.viewErr.JSON(c, err)
+			return
+		}
+
+		c.Header("Location", "/api/v1/queue/ratings/"+key)
+		c.JSON(http.StatusAccepted, &models.QueueReceipt{Key: key, Status: models.QueuePending})
+		return
+	}
 
 	err = r.rs.Create(&rating)
 	if err != nil {
@@ -65,6 +202,7 @@ func (r *Ratings) Create(c *gin.Context) {
 		return
 	}
 
+	setETag(c, rating.Version)
 	c.JSON(http.StatusCreated, &rating)
 }
 
@@ -79,19 +217,13 @@ func (r *Ratings) Update(c *gin.Context) {
 		return
 	}
 
-	user, exists := c.Get("user")
-	if !exists {
-		r.viewErr.JSON(c, errors.New("user couldn't be obtained from the context"))
+	version, err := getIfMatch(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
 		return
 	}
 
 	var rating = models.NewRating()
-
-	u, ok := user.(*models.User)
-	if !ok {
-		panic("user from the context must be a pointer of models.User type")
-	}
-
 	err = parseJSON(c, &rating)
 	if err != nil {
 		r.viewErr.JSON(c, err)
@@ -99,7 +231,8 @@ func (r *Ratings) Update(c *gin.Context) {
 	}
 
 	rating.ID = id
-	rating.User = u
+	rating.Version = version
+	rating.User = middleware.Actor(c).User
 
 	err = r.rs.Update(&rating)
 	if err != nil {
@@ -107,37 +240,130 @@ func (r *Ratings) Update(c *gin.Context) {
 		return
 	}
 
+	setETag(c, rating.Version)
 	c.JSON(http.StatusOK, &rating)
 }
 
-// Delete performs the removal of a rating.
+// Patch performs the alteration of the fields of a rating present in the request, a JSON Merge
+// Patch document.
+//
+// PATCH /api/v1/ratings/:id
+func (r *Ratings) Patch(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	version, err := getIfMatch(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	patch, err := parsePatch(c, &models.Rating{})
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	rating := models.Rating{ID: id, Version: version, User: middleware.Actor(c).User}
+
+	err = r.rs.UpdatePartial(&rating, patch)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, rating.Version)
+	c.JSON(http.StatusOK, &rating)
+}
+
+// Delete performs the removal of a rating by its author or a moderator, as Update does. The
+// If-Match header is optional: with it, the rating is only removed if it has the version sent.
 //
 // DELETE /api/v1/ratings/:id
 func (r *Ratings) Delete(c *gin.Context) {
-
 	id, err := getParamInt(c, "id")
 	if err != nil {
 		r.viewErr.JSON(c, err)
 		return
 	}
 
-	user, exists := c.Get("user")
-	if !exists {
-		r.viewErr.JSON(c, errors.New("user couldn't be obtained from the context"))
+	version, err := getIfMatch(c)
+	if err != nil && !xerrors.Is(err, ErrPreconditionRequired) {
+		r.viewErr.JSON(c, err)
 		return
 	}
 
-	var rating = models.Rating{}
+	rating := models.Rating{ID: id, Version: version, User: middleware.Actor(c).User}
 
-	u, ok := user.(*models.User)
-	if !ok {
-		panic("user from the context must be a pointer of models.User type")
+	err = r.rs.Delete(&rating)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
 	}
 
-	rating.ID = id
-	rating.User = u
+	c.JSON(http.StatusNoContent, gin.H{})
+}
 
-	err = r.rs.Delete(&rating)
+// Drafts returns the drafts of the current user, newest first.
+//
+// GET /api/v1/me/drafts
+func (r *Ratings) Drafts(c *gin.Context) {
+	drafts, err := r.rs.Drafts(middleware.Actor(c).ID)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, drafts)
+}
+
+// PublishDraft creates a rating from a draft of the current user, which is removed. The request
+// body is optional: a JSON Merge Patch document applied to the draft first, to complete it. The
+// rating is validated as by Create, but the write-behind queue is not used.
+//
+// POST /api/v1/me/drafts/:id/publish
+func (r *Ratings) PublishDraft(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var patch []byte
+	if c.Request.ContentLength != 0 {
+		patch, err = parsePatch(c, &models.Rating{})
+		if err != nil {
+			r.viewErr.JSON(c, err)
+			return
+		}
+	}
+
+	rating := models.Rating{ID: id, User: middleware.Actor(c).User}
+
+	err = r.rs.PublishDraft(&rating, patch)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, rating.Version)
+	c.JSON(http.StatusCreated, &rating)
+}
+
+// DeleteDraft removes a draft of the current user.
+//
+// DELETE /api/v1/me/drafts/:id
+func (r *Ratings) DeleteDraft(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	err = r.rs.DeleteDraft(&models.Rating{ID: id, User: middleware.Actor(c).User})
 	if err != nil {
 		r.viewErr.JSON(c, err)
 		return
@@ -146,9 +372,13 @@ func (r *Ratings) Delete(c *gin.Context) {
 	c.JSON(http.StatusNoContent, gin.H{})
 }
 
-// Get returns one rating by ID to the requester.
+// Get returns one rating by ID to the requester, along with its attachments. Its replies, oldest
+// first, are included when the "replies" parameter is true, and its author when the "expand"
+// parameter includes "user", see expandUsers.
 //
 // GET /api/v1/ratings/:id
+// GET /api/v1/ratings/:id?replies=true
+// GET /api/v1/ratings/:id?expand=user
 func (r *Ratings) Get(c *gin.Context) {
 	id, err := getParamInt(c, "id")
 	if err != nil {
@@ -156,18 +386,311 @@ func (r *Ratings) Get(c *gin.Context) {
 		return
 	}
 
-	rating, err := r.rs.ByID(id)
+	withReplies, err := getQueryBool(c, "replies")
 	if err != nil {
 		r.viewErr.JSON(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, &rating)
+	expand, err := r.getQueryExpand(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	rating, err := r.scoped(c).ByID(id)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	ratings := []models.Rating{rating}
+	err = r.attach(ratings)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+	rating = ratings[0]
+
+	expanded, err := r.expandUsers(c, expand, ratings)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, rating.Version)
+	if withReplies == nil || !*withReplies || r.ps == nil {
+		if expanded != nil {
+			c.JSON(http.StatusOK, &expanded[0])
+			return
+		}
+
+		c.JSON(http.StatusOK, &rating)
+		return
+	}
+
+	replies, err := r.ps.ByRating(rating.ID)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	out := ratingWithReplies{ratingWithUser: ratingWithUser{Rating: &rating}, Replies: replies}
+	if expanded != nil {
+		out.User = expanded[0].User
+	}
+	c.JSON(http.StatusOK, &out)
+}
+
+// Receipt returns the outcome of a rating creation queued by Create. Only the user that created
+// the rating or an administrator of no organisation can look it up, as the queue is shared by
+// the organisations.
+//
+// GET /api/v1/queue/ratings/:key
+func (r *Ratings) Receipt(c *gin.Context) {
+	if r.rq == nil {
+		r.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	rc, err := r.rq.Receipt(c.Param("key"))
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	if a := middleware.Actor(c); !a.IsSelf(rc.UserID) && !(a.IsAdmin() && a.OrgID == nil) {
+		r.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, &rc)
+}
+
+// Stats returns a summary of the active ratings of a target.
+//
+// The percentiles and the histogram of the scores are included when the "distribution" parameter
+// is true, or when the ratings are filtered with the "verified", "from" and "to" parameters. The
+// "buckets" parameter sets the number of buckets of the histogram.
+//
+// GET /api/v1/targets/:id/stats
+// GET /api/v1/targets/:id/stats?distribution=true&verified=true&from=1257894000&buckets=10
+func (r *Ratings) Stats(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	f, err := getStatsFilter(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var stats models.RatingStats
+	if f != nil {
+		stats, err = r.scoped(c).DetailedStatsByTarget(tid, *f)
+	} else {
+		stats, err = r.scoped(c).StatsByTarget(tid)
+	}
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &stats)
+}
+
+// getStatsFilter retrieves the filter of the detailed stats of a target from a request's query
+// string. In case none of its parameters are found, nil is returned for both return values. If
+// any parameter cannot be parsed, a ValidationError is returned.
+func getStatsFilter(c *gin.Context) (*models.StatsFilter, error) {
+	var (
+		f     models.StatsFilter
+		found bool
+		ve    = models.ValidationError{}
+	)
+
+	for _, p := range []struct {
+		name string
+		dst  *bool
+	}{{"distribution", nil}, {"verified", &f.Verified}} {
+		v, err := getQueryBool(c, p.name)
+		if err != nil {
+			ve[p.name] = ErrParseError
+		} else if v != nil && *v {
+			found = true
+			if p.dst != nil {
+				*p.dst = true
+			}
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v, err := getQueryInt(c, p.name)
+		if err != nil {
+			ve[p.name] = ErrParseError
+		} else if v != nil {
+			*p.dst, found = *v, true
+		}
+	}
+
+	v, err := getQueryInt(c, "buckets")
+	if err != nil {
+		ve["buckets"] = ErrParseError
+	} else if v != nil {
+		f.Buckets, found = int(*v), true
+	}
+
+	if len(ve) > 0 {
+		return nil, ve
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return &f, nil
+}
+
+// Cohorts returns the volume and the average score of the active ratings by cohort of their
+// authors, oldest first, grouped by the period they signed up in: the "by" parameter is either
+// "signupWeek", "signupMonth" or "signupYear".
+//
+// GET /api/v1/ratings/cohorts?by=signupMonth
+func (r *Ratings) Cohorts(c *gin.Context) {
+	cohorts, err := r.scoped(c).Cohorts(c.Query("by"))
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"by":    c.Query("by"),
+		"items": cohorts,
+	})
+}
+
+// Scores returns the number of active ratings and the average score of several targets, read
+// from their denormalised scores, ordered by target. Repeated targets are returned once.
+//
+// GET /api/v1/targets/scores?targets=1,2,3
+func (r *Ratings) Scores(c *gin.Context) {
+	targets, err := getQueryListInt(c, "targets")
+	if err != nil {
+		r.viewErr.JSON(c, models.ValidationError{"targets": ErrParseError})
+		return
+	}
+
+	scores, err := r.scoped(c).Scores(targets)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": scores,
+	})
+}
+
+// maxCompareTargets is the maximum number of targets compared by Compare, and
+// compareRecentRatings the number of recent ratings returned for each of them.
+const (
+	maxCompareTargets    = 10
+	compareRecentRatings = 5
+)
+
+// targetComparison holds the summary of a target compared by Compare.
+type targetComparison struct {
+	Stats  models.RatingStats `json:"stats"`
+	Recent []models.Rating    `json:"recent"`
+}
+
+// Compare returns, side by side, the stats and the most recent active ratings of several targets,
+// in the order requested. Repeated targets are returned once.
+//
+// GET /api/v1/ratings/compare?targets=1,2,3
+func (r *Ratings) Compare(c *gin.Context) {
+	targets, err := getQueryListInt(c, "targets")
+	if err != nil {
+		r.viewErr.JSON(c, models.ValidationError{"targets": ErrParseError})
+		return
+	}
+
+	var (
+		unique = make([]int64, 0, len(targets))
+		seen   = make(map[int64]bool, len(targets))
+	)
+	for _, t := range targets {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+
+	if len(unique) == 0 {
+		r.viewErr.JSON(c, models.ValidationError{"targets": models.ErrRequired})
+		return
+	} else if len(unique) > maxCompareTargets {
+		r.viewErr.JSON(c, models.ValidationError{"targets": models.ErrTooLong})
+		return
+	}
+
+	var (
+		rs     = r.scoped(c)
+		active = true
+		items  = make([]targetComparison, 0, len(unique))
+	)
+	for _, t := range unique {
+		stats, err := rs.StatsByTarget(t)
+		if err != nil {
+			r.viewErr.JSON(c, err)
+			return
+		}
+
+		recent, err := rs.Search(models.RatingQuery{Target: t, Active: &active, Sort: "-date", Limit: compareRecentRatings})
+		if err != nil {
+			r.viewErr.JSON(c, err)
+			return
+		}
+
+		if recent == nil {
+			recent = []models.Rating{}
+		}
+
+		items = append(items, targetComparison{Stats: stats, Recent: recent})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+	})
 }
 
 // ListByTarget returns a list of ratings for a given target
 //
+// The ratings can be filtered by score with the "minScore" and "maxScore" parameters, by date
+// with the "from" and "to" parameters, and by their flags with the "active" and "anonymous"
+// parameters. They can be sorted with the "sort" parameter.
+//
+// Their authors are included when the "expand" parameter includes "user", see expandUsers, and
+// the "fields" parameter trims them to the fields it lists, see views.Items.
+//
 // GET /api/v1/ratings/?target=999
+// GET /api/v1/ratings/?target=999&minScore=3&from=1257894000&active=true&sort=-date
+//
+// The ratings are paged by ID with the "limit" parameter, and the "after" parameter set to the ID
+// of the last rating of the previous page.
+//
+// GET /api/v1/ratings/?target=999&limit=50&after=1234
+//
+// The response is tagged with a weak ETag, see ratingsETag, and 304 Not Modified is returned when
+// the If-None-Match header lists it.
+//
+// GET /api/v1/ratings/?target=999&expand=user&fields=id,score,user
 func (r *Ratings) ListByTarget(c *gin.Context) {
 	tid, err := getQueryParam(c, "target")
 	if err != nil {
@@ -175,7 +698,28 @@ func (r *Ratings) ListByTarget(c *gin.Context) {
 		return
 	}
 
-	ratings, err := r.rs.ByTarget(tid)
+	q, err := getRatingQuery(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	expand, err := r.getQueryExpand(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var (
+		ratings []models.Rating
+		rs      = r.scoped(c)
+	)
+	if q != nil {
+		q.Target = tid
+		ratings, err = rs.Search(*q)
+	} else {
+		ratings, err = rs.ByTarget(tid)
+	}
 	if err != nil {
 		r.viewErr.JSON(c, err)
 		return
@@ -185,7 +729,460 @@ func (r *Ratings) ListByTarget(c *gin.Context) {
 		ratings = []models.Rating{}
 	}
 
+	err = r.attach(ratings)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	expanded, err := r.expandUsers(c, expand, ratings)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	if notModified(c, ratingsETag(ratings, expanded), nil) {
+		return
+	}
+
+	if expanded != nil {
+		err = views.Items(c, expanded)
+	} else {
+		err = views.Items(c, ratings)
+	}
+	if err != nil {
+		r.viewErr.JSON(c, err)
+	}
+}
+
+// ratingsETag returns a weak entity tag of a list of ratings, which changes when a rating is added,
+// removed or updated, when its attachments change, and when its author changes if expanded is set.
+// The lists are not given a Last-Modified time, as removing a rating does not change it.
+func ratingsETag(ratings []models.Rating, expanded []ratingWithUser) string {
+	h := fnv.New64a()
+	for _, rating := range ratings {
+		fmt.Fprintf(h, "%d.%d", rating.ID, rating.Version)
+		for _, a := range rating.Attachments {
+			fmt.Fprintf(h, ",%d", a.ID)
+		}
+		h.Write([]byte{';'})
+	}
+	for _, rating := range expanded {
+		switch {
+		case rating.User == nil:
+		case rating.User.Deleted:
+			fmt.Fprintf(h, "%d.deleted;", rating.User.ID)
+		default:
+			fmt.Fprintf(h, "%d.%d;", rating.User.ID, rating.User.Version)
+		}
+	}
+
+	return `W/"` + strconv.FormatUint(h.Sum64(), 36) + `"`
+}
+
+// getQueryExpand retrieves the related models to embed in the ratings returned, from the
+// "expand" query parameter. Only "user" is accepted, if the service of the users is set.
+func (r *Ratings) getQueryExpand(c *gin.Context) (map[string]bool, error) {
+	if r.us == nil {
+		return getQueryExpand(c)
+	}
+
+	return getQueryExpand(c, "user")
+}
+
+// expandUsers returns the ratings along with their authors, read in a single query, if expand
+// includes "user", and nil otherwise. Embedding the authors requires the readUsers permission,
+// and ErrForbidden is returned without it.
+//
+// The authors removed, deactivated or anonymised are embedded as the placeholder of a deleted
+// user, see views.ResolveAuthor, and only the others are read.
+func (r *Ratings) expandUsers(c *gin.Context, expand map[string]bool, ratings []models.Rating) ([]ratingWithUser, error) {
+	if !expand["user"] {
+		return nil, nil
+	}
+
+	if !middleware.Actor(c).Can(models.PermissionReadUsers) {
+		return nil, ErrForbidden
+	}
+
+	expanded := make([]ratingWithUser, len(ratings))
+	if len(ratings) == 0 {
+		return expanded, nil
+	}
+
+	rids := make([]int64, len(ratings))
+	for i, rating := range ratings {
+		rids[i] = rating.ID
+	}
+
+	authors, err := r.rs.Authors(rids...)
+	if err != nil {
+		return nil, err
+	}
+
+	byRating := make(map[int64]models.RatingAuthor, len(authors))
+	for _, a := range authors {
+		byRating[a.RatingID] = a
+	}
+
+	// the ratings removed since they were read are not found, and keep
+	// the author they were read with
+	var ids []int64
+	seen := make(map[int64]bool, len(ratings))
+	for _, rating := range ratings {
+		a, ok := byRating[rating.ID]
+		if !ok {
+			a = models.RatingAuthor{RatingID: rating.ID, UserID: rating.UserID}
+			byRating[rating.ID] = a
+		}
+
+		if !a.Deleted && !seen[a.UserID] {
+			seen[a.UserID] = true
+			ids = append(ids, a.UserID)
+		}
+	}
+
+	byID := make(map[int64]*models.User, len(ids))
+	if len(ids) > 0 {
+		users, err := r.us.ByIDs(ids...)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range users {
+			byID[users[i].ID] = &users[i]
+		}
+	}
+
+	for i := range ratings {
+		a := byRating[ratings[i].ID]
+		expanded[i] = ratingWithUser{Rating: &ratings[i], User: views.ResolveAuthor(a, byID[a.UserID])}
+	}
+
+	return expanded, nil
+}
+
+// attach sets the attachments of the ratings, if the attachments are enabled.
+func (r *Ratings) attach(ratings []models.Rating) error {
+	if r.as == nil || len(ratings) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(ratings))
+	for i, rating := range ratings {
+		ids[i] = rating.ID
+	}
+
+	byRating, err := r.as.ByRatings(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range ratings {
+		ratings[i].Attachments = byRating[ratings[i].ID]
+	}
+
+	return nil
+}
+
+// getRatingQuery retrieves the rating filtering and sorting criteria from a request's query
+// string. In case none of them are found, nil is returned for both return values. If any
+// parameter cannot be parsed, a ValidationError is returned.
+func getRatingQuery(c *gin.Context) (*models.RatingQuery, error) {
+	var (
+		q     models.RatingQuery
+		found bool
+		ve    = models.ValidationError{}
+	)
+
+	if v, ok := c.GetQuery("sort"); ok {
+		q.Sort, found = v, true
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **int
+	}{{"minScore", &q.MinScore}, {"maxScore", &q.MaxScore}} {
+		v, err := getQueryInt(c, p.name)
+		if err != nil {
+			ve[p.name] = ErrParseError
+		} else if v != nil {
+			score := int(*v)
+			*p.dst, found = &score, true
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"from", &q.From}, {"to", &q.To}, {"after", &q.After}} {
+		v, err := getQueryInt(c, p.name)
+		if err != nil {
+			ve[p.name] = ErrParseError
+		} else if v != nil {
+			*p.dst, found = *v, true
+		}
+	}
+
+	limit, err := getQueryInt(c, "limit")
+	if err != nil {
+		ve["limit"] = ErrParseError
+	} else if limit != nil {
+		q.Limit, found = int(*limit), true
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **bool
+	}{{"active", &q.Active}, {"anonymous", &q.Anonymous}} {
+		v, err := getQueryBool(c, p.name)
+		if err != nil {
+			ve[p.name] = ErrParseError
+		} else if v != nil {
+			*p.dst, found = v, true
+		}
+	}
+
+	if len(ve) > 0 {
+		return nil, ve
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return &q, nil
+}
+
+// History returns the previous versions of a rating, oldest first.
+//
+// GET /api/v1/ratings/:id/history
+func (r *Ratings) History(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	revisions, err := r.scoped(c).History(id)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	if revisions == nil {
+		revisions = []models.RatingRevision{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": revisions,
+	})
+}
+
+// Tags returns the tags of a target, which are used by the visibility rules to restrict the
+// ratings the users of some roles can read.
+//
+// GET /api/v1/targets/:id/tags
+func (r *Ratings) Tags(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	tags, err := r.rs.Tags(tid)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"target": tid,
+		"tags":   tags,
+	})
+}
+
+// SetTags replaces the tags of a target.
+//
+// PUT /api/v1/targets/:id/tags
+func (r *Ratings) SetTags(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+
+	err = parseJSON(c, &body)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	err = r.rs.SetTags(tid, body.Tags)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	tags, err := r.rs.Tags(tid)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"target": tid,
+		"tags":   tags,
+	})
+}
+
+// Category returns the category of a target, whose rules its ratings must follow, or null if
+// it has none.
+//
+// GET /api/v1/targets/:id/category
+func (r *Ratings) Category(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	r.renderCategory(c, tid)
+}
+
+// SetCategory puts a target in a category, or takes it out of its category if the category
+// is null or empty.
+//
+// PUT /api/v1/targets/:id/category
+func (r *Ratings) SetCategory(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var body struct {
+		Category string `json:"category"`
+	}
+
+	err = parseJSON(c, &body)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	err = r.rs.SetCategory(tid, body.Category)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	r.renderCategory(c, tid)
+}
+
+// renderCategory responds with the category of the target tid.
+func (r *Ratings) renderCategory(c *gin.Context, tid int64) {
+	category, err := r.rs.Category(tid)
+	if xerrors.Is(err, models.ErrNotFound) {
+		c.JSON(http.StatusOK, gin.H{
+			"target":   tid,
+			"category": nil,
+		})
+		return
+	} else if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"items": ratings,
+		"target":   tid,
+		"category": &category,
 	})
 }
+
+// Window returns the rating window of a target, whose bounds are null if it has none.
+//
+// GET /api/v1/targets/:id/window
+func (r *Ratings) Window(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	w, err := r.rs.Window(tid)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &w)
+}
+
+// SetWindow sets the bounds of the rating window of a target. Both are optional.
+//
+// PUT /api/v1/targets/:id/window
+func (r *Ratings) SetWindow(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var w models.TargetWindow
+	err = parseJSON(c, &w)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	w.Target = tid
+	r.setWindow(c, &w)
+}
+
+// OpenWindow opens the rating of a target from now on, removing the bounds of its window.
+//
+// POST /api/v1/targets/:id/window/open
+func (r *Ratings) OpenWindow(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	r.setWindow(c, &models.TargetWindow{Target: tid})
+}
+
+// CloseWindow closes the rating of a target from now on, until it is opened again.
+//
+// POST /api/v1/targets/:id/window/close
+func (r *Ratings) CloseWindow(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	r.setWindow(c, &models.TargetWindow{Target: tid, ClosesAt: &now})
+}
+
+// setWindow sets the window w and responds with it.
+func (r *Ratings) setWindow(c *gin.Context, w *models.TargetWindow) {
+	err := r.rs.SetWindow(w)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, w)
+}
+
+// scoped returns the rating service restricted to the ratings the requester is allowed to read.
+func (r *Ratings) scoped(c *gin.Context) models.RatingService {
+	return r.rs.Scoped(middleware.Actor(c).User)
+}
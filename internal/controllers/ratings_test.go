@@ -5,66 +5,20 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
 	"github.com/stretchr/testify/assert"
 )
 
-type testRatingService struct {
-	models.RatingService
-	create   func(*models.Rating) error
-	update   func(*models.Rating) error
-	delete   func(*models.Rating) error
-	byID     func(int64) (models.Rating, error)
-	byTarget func(int64) ([]models.Rating, error)
-}
-
-func (t *testRatingService) Create(mr *models.Rating) error {
-	if t.create != nil {
-		return t.create(mr)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRatingService) Update(mr *models.Rating) error {
-	if t.update != nil {
-		return t.update(mr)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRatingService) Delete(mr *models.Rating) error {
-	if t.delete != nil {
-		return t.delete(mr)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRatingService) ByID(id int64) (models.Rating, error) {
-	if t.byID != nil {
-		return t.byID(id)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRatingService) ByTarget(id int64) ([]models.Rating, error) {
-	if t.byTarget != nil {
-		return t.byTarget(id)
-	}
-
-	panic("not provided")
-}
-
 func TestRatings_Create(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRatingService{}
-	r := NewRatings(rs)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
 
 	mux := gin.New()
 	mux.POST("/api/v1/ratings/", func(c *gin.Context) {
@@ -106,7 +60,7 @@ func TestRatings_Create(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.create = func(mr *models.Rating) error {
+				rs.CreateFunc = func(mr *models.Rating) error {
 					return privateError("test error message")
 				}
 			},
@@ -120,7 +74,7 @@ func TestRatings_Create(t *testing.T) {
 			http.StatusBadRequest,
 			`{"error":"validation_error","fields":{"target":"invalid"}}`,
 			func(t *testing.T) {
-				rs.create = func(mr *models.Rating) error {
+				rs.CreateFunc = func(mr *models.Rating) error {
 					mr.UserID = 1
 					mr.User = nil
 
@@ -136,6 +90,22 @@ func TestRatings_Create(t *testing.T) {
 				}
 			},
 		},
+		{
+			"rateLimited",
+			`{
+				"score": 10,
+				"target": 9999
+			}`,
+			http.StatusTooManyRequests,
+			`{"error":"validation_error","fields":{"userId":"rate_limited"}}`,
+			func(t *testing.T) {
+				rs.CreateFunc = func(mr *models.Rating) error {
+					return models.ValidationError{
+						"userId": models.ErrRateLimited,
+					}
+				}
+			},
+		},
 		{
 			"ok",
 			`{
@@ -154,7 +124,7 @@ func TestRatings_Create(t *testing.T) {
 				"userId": 1
 			}`,
 			func(t *testing.T) {
-				rs.create = func(mr *models.Rating) error {
+				rs.CreateFunc = func(mr *models.Rating) error {
 					mr.ID = 99
 					mr.UserID = 1
 					return nil
@@ -165,13 +135,393 @@ func TestRatings_Create(t *testing.T) {
 
 	for _, cs := range cases {
 		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/api/v1/ratings/",
+				bytes.NewReader([]byte(cs.content)))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+// testTransactor runs the transactions on staged copies of the ratings and the
+// settings of the users, which are only kept if the transaction is committed.
+type testTransactor struct {
+	ratings  map[int64]models.Rating
+	settings map[int64]string
+
+	// failSettings fails the updates of the settings with the given error
+	failSettings error
+}
+
+func (tt *testTransactor) run(f func(us models.UserService, rs models.RatingService) error) error {
+	ratings := map[int64]models.Rating{}
+	for id, r := range tt.ratings {
+		ratings[id] = r
+	}
+	settings := map[int64]string{}
+	for id, s := range tt.settings {
+		settings[id] = s
+	}
+
+	rs := &modelstest.RatingService{CreateFunc: func(mr *models.Rating) error {
+		mr.ID = int64(len(ratings) + 1)
+		mr.UserID = mr.User.ID
+		mr.User = nil
+		ratings[mr.ID] = *mr
+		return nil
+	}}
+	us := &modelstest.UserService{UpdatePartialFunc: func(u *models.User, patch []byte) error {
+		if tt.failSettings != nil {
+			return tt.failSettings
+		}
+
+		var p struct{ Settings json.RawMessage }
+		if err := json.Unmarshal(patch, &p); err != nil {
+			return err
+		}
+
+		settings[u.ID] = string(p.Settings)
+		u.Settings = p.Settings
+		u.Version = 2
+		return nil
+	}}
+
+	err := f(us, rs)
+	if err != nil {
+		return err
+	}
+
+	tt.ratings, tt.settings = ratings, settings
+	return nil
+}
+
+func TestRatings_CreateWithSettings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cases = []struct {
+		name         string
+		content      string
+		failSettings error
+		outStatus    int
+		outJSON      string
+		outRatings   int
+		outSettings  string
+	}{
+		{
+			"badContent",
+			`{"rating": 1}`,
+			nil,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			0,
+			`{"lastTarget":1}`,
+		},
+		{
+			"settingsRequired",
+			`{"rating": {"score": 4, "target": 9999}}`,
+			nil,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"settings":"required"}}`,
+			0,
+			`{"lastTarget":1}`,
+		},
+		{
+			"settingsNull",
+			`{"rating": {"score": 4, "target": 9999}, "settings": null}`,
+			nil,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"settings":"required"}}`,
+			0,
+			`{"lastTarget":1}`,
+		},
+		{
+			"settingsFailed",
+			`{"rating": {"score": 4, "target": 9999}, "settings": {"lastTarget": 9999}}`,
+			models.ValidationError{"settings": models.ErrTooLong},
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"settings":"too_long"}}`,
+			0,
+			`{"lastTarget":1}`,
+		},
+		{
+			"settingsInternalError",
+			`{"rating": {"score": 4, "target": 9999}, "settings": {"lastTarget": 9999}}`,
+			privateError("test error message"),
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			0,
+			`{"lastTarget":1}`,
+		},
+		{
+			"ok",
+			`{"rating": {"score": 4, "target": 9999}, "settings": {"lastTarget": 9999}}`,
+			nil,
+			http.StatusCreated,
+			`{
+				"rating": {
+					"id": 1,
+					"active": true,
+					"anonymous": true,
+					"extra": {},
+					"date": 0,
+					"score": 4,
+					"target": 9999,
+					"userId": 1
+				},
+				"user": {
+					"id": 1,
+					"active": false,
+					"email": "",
+					"firstName": "",
+					"lastName": "",
+					"roleId": 0,
+					"settings": {"lastTarget": 9999}
+				}
+			}`,
+			1,
+			`{"lastTarget":9999}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			tt := &testTransactor{
+				ratings:      map[int64]models.Rating{},
+				settings:     map[int64]string{1: `{"lastTarget":1}`},
+				failSettings: cs.failSettings,
+			}
+			r := NewRatings(&modelstest.RatingService{}, nil).WithTransactions(tt.run)
+
+			mux := gin.New()
+			mux.POST("/api/v1/ratings/with-settings", func(c *gin.Context) {
+				c.Set("user", &models.User{ID: 1})
+			}, r.CreateWithSettings)
+
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("POST", "/api/v1/ratings/",
+			c.Request, _ = http.NewRequest("POST", "/api/v1/ratings/with-settings",
 				bytes.NewReader([]byte(cs.content)))
 			c.Request.Header.Add("Accept", "application/json")
 			c.Request.Header.Add("Content-Type", "application/json")
 
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			assert.Len(t, tt.ratings, cs.outRatings, "the rating must be rolled back with the settings")
+			assert.Equal(t, cs.outSettings, tt.settings[1])
+		})
+	}
+
+	t.Run("noTransactions", func(t *testing.T) {
+		mux := gin.New()
+		mux.POST("/api/v1/ratings/with-settings", NewRatings(&modelstest.RatingService{}, nil).CreateWithSettings)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ratings/with-settings", bytes.NewReader([]byte(`{}`)))
+		mux.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRatings_CreateQueued(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	rq := &modelstest.RatingQueue{}
+	r := NewRatings(rs, rq)
+
+	mux := gin.New()
+	mux.POST("/api/v1/ratings/", func(c *gin.Context) {
+		c.Set("user", &models.User{
+			ID: 1,
+		})
+	}, r.Create)
+
+	var cases = []struct {
+		name        string
+		content     string
+		outStatus   int
+		outLocation string
+		outJSON     string
+		setup       func(t *testing.T)
+	}{
+		{
+			"internalError",
+			`{"score": 10, "target": 9999}`,
+			http.StatusInternalServerError,
+			"",
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				rq.EnqueueFunc = func(mr *models.Rating) (string, error) {
+					return "", privateError("test error message")
+				}
+			},
+		},
+		{
+			"validationError",
+			`{"score": 10}`,
+			http.StatusBadRequest,
+			"",
+			`{"error":"validation_error","fields":{"target":"required"}}`,
+			func(t *testing.T) {
+				rq.EnqueueFunc = func(mr *models.Rating) (string, error) {
+					return "", models.ValidationError{"target": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"ok",
+			`{"score": 10, "target": 9999}`,
+			http.StatusAccepted,
+			"/api/v1/queue/ratings/0123456789abcdef0123456789abcdef",
+			`{"key":"0123456789abcdef0123456789abcdef","status":"pending"}`,
+			func(t *testing.T) {
+				rq.EnqueueFunc = func(mr *models.Rating) (string, error) {
+					rating := models.NewRating()
+					rating.Score = 10
+					rating.Target = 9999
+					rating.User = &models.User{ID: 1}
+
+					assert.Equal(t, &rating, mr)
+					return "0123456789abcdef0123456789abcdef", nil
+				}
+			},
+		},
+		{
+			"draft",
+			`{"comment": "To be continued", "draft": true}`,
+			http.StatusCreated,
+			"",
+			`{"id":4,"userId":1,"target":0,"score":0,"active":true,"anonymous":true,"comment":"To be continued","extra":{},"date":0,"draft":true}`,
+			func(t *testing.T) {
+				rs.CreateDraftFunc = func(mr *models.Rating) error {
+					mr.ID = 4
+					mr.UserID = 1
+					mr.User = nil
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/api/v1/ratings/",
+				bytes.NewReader([]byte(cs.content)))
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Equal(t, cs.outLocation, res.Header.Get("Location"))
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+			*rq = modelstest.RatingQueue{}
+		})
+	}
+}
+
+func TestRatings_Receipt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rq := &modelstest.RatingQueue{}
+
+	var cases = []struct {
+		name      string
+		user      *models.User
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"notFound",
+			&models.User{ID: 5, RoleID: 2},
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rq.ReceiptFunc = func(key string) (models.QueueReceipt, error) {
+					return models.QueueReceipt{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"otherUser",
+			&models.User{ID: 5, RoleID: 2},
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rq.ReceiptFunc = func(key string) (models.QueueReceipt, error) {
+					return models.QueueReceipt{Key: key, UserID: 6, Status: models.QueuePending}, nil
+				}
+			},
+		},
+		{
+			"admin",
+			&models.User{ID: 1, RoleID: 1},
+			http.StatusOK,
+			`{"key":"0123456789abcdef0123456789abcdef","status":"created","ratingId":99}`,
+			func(t *testing.T) {
+				rq.ReceiptFunc = func(key string) (models.QueueReceipt, error) {
+					return models.QueueReceipt{Key: key, UserID: 6, Status: models.QueueCreated, RatingID: 99}, nil
+				}
+			},
+		},
+		{
+			"organisationAdmin",
+			&models.User{ID: 2, RoleID: 1, OrgID: new(int64)},
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rq.ReceiptFunc = func(key string) (models.QueueReceipt, error) {
+					return models.QueueReceipt{Key: key, UserID: 6, Status: models.QueueCreated, RatingID: 99}, nil
+				}
+			},
+		},
+		{
+			"failed",
+			&models.User{ID: 6, RoleID: 2},
+			http.StatusOK,
+			`{"key":"0123456789abcdef0123456789abcdef","status":"failed","error":"validation_error","fields":{"target":"is_duplicate"}}`,
+			func(t *testing.T) {
+				rq.ReceiptFunc = func(key string) (models.QueueReceipt, error) {
+					assert.Equal(t, "0123456789abcdef0123456789abcdef", key)
+					return models.QueueReceipt{
+						Key:    key,
+						UserID: 6,
+						Status: models.QueueFailed,
+						Error:  "validation_error",
+						Fields: json.RawMessage(`{"target":"is_duplicate"}`),
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			r := NewRatings(&modelstest.RatingService{}, rq)
+
+			mux := gin.New()
+			mux.GET("/api/v1/queue/ratings/:key", func(c *gin.Context) {
+				c.Set("user", cs.user)
+			}, r.Receipt)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/api/v1/queue/ratings/0123456789abcdef0123456789abcdef", nil)
+
 			if cs.setup != nil {
 				cs.setup(t)
 			}
@@ -180,18 +530,35 @@ func TestRatings_Create(t *testing.T) {
 
 			res := w.Result()
 			assert.Equal(t, cs.outStatus, res.StatusCode)
-			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*rs = testRatingService{}
+			*rq = modelstest.RatingQueue{}
 		})
 	}
+
+	t.Run("queueDisabled", func(t *testing.T) {
+		r := NewRatings(&modelstest.RatingService{}, nil)
+
+		mux := gin.New()
+		mux.GET("/api/v1/queue/ratings/:key", func(c *gin.Context) {
+			c.Set("user", &models.User{ID: 1, RoleID: 1})
+		}, r.Receipt)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/api/v1/queue/ratings/0123456789abcdef0123456789abcdef", nil)
+
+		mux.HandleContext(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.JSONEq(t, `{"error":"not_found"}`, w.Body.String())
+	})
 }
 
 func TestRatings_Update(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRatingService{}
-	r := NewRatings(rs)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
 
 	mux := gin.New()
 	mux.PUT("/api/v1/ratings/:id", func(c *gin.Context) {
@@ -203,6 +570,7 @@ func TestRatings_Update(t *testing.T) {
 	var cases = []struct {
 		name      string
 		path      string
+		ifMatch   string
 		content   string
 		outStatus int
 		outJSON   string
@@ -211,6 +579,7 @@ func TestRatings_Update(t *testing.T) {
 		{
 			"badPathID",
 			"/api/v1/ratings/lksdjflk",
+			`"3"`,
 			"",
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
@@ -218,7 +587,8 @@ func TestRatings_Update(t *testing.T) {
 		},
 		{
 			"badContent",
-			"api/v1/ratings/99",
+			"/api/v1/ratings/99",
+			`"3"`,
 			"graskdfhjglk!@98574sjdgfh ksdhf lksdfghlksjkl",
 			http.StatusBadRequest,
 			`{"error":"invalid_json"}`,
@@ -226,7 +596,8 @@ func TestRatings_Update(t *testing.T) {
 		},
 		{
 			"badContent2",
-			"api/v1/ratings/99",
+			"/api/v1/ratings/99",
+			`"3"`,
 			`{
 					score: asldfkj,
 					target: asldfkj
@@ -237,7 +608,8 @@ func TestRatings_Update(t *testing.T) {
 		},
 		{
 			"internalError",
-			"api/v1/ratings/99",
+			"/api/v1/ratings/99",
+			`"3"`,
 			`{
 					"score": 10,
 					"target": 9999
@@ -245,14 +617,15 @@ func TestRatings_Update(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.update = func(mr *models.Rating) error {
+				rs.UpdateFunc = func(mr *models.Rating) error {
 					return privateError("test error message")
 				}
 			},
 		},
 		{
 			"validationError",
-			"api/v1/ratings/99",
+			"/api/v1/ratings/99",
+			`"3"`,
 			`{
 					"score": 10,
 					"target": -9999
@@ -260,12 +633,13 @@ func TestRatings_Update(t *testing.T) {
 			http.StatusBadRequest,
 			`{"error":"validation_error","fields":{"target":"invalid"}}`,
 			func(t *testing.T) {
-				rs.update = func(mr *models.Rating) error {
+				rs.UpdateFunc = func(mr *models.Rating) error {
 					mr.UserID = 1
 					mr.User = nil
 
 					rating := models.NewRating()
 					rating.ID = 99
+					rating.Version = 3
 					rating.Score = 10
 					rating.Target = -9999
 					rating.UserID = 1
@@ -280,17 +654,19 @@ func TestRatings_Update(t *testing.T) {
 		{
 			"notFound",
 			"/api/v1/ratings/99",
+			`"3"`,
 			`{"score": 10, "target": 9999}`,
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				rs.update = func(mr *models.Rating) error {
+				rs.UpdateFunc = func(mr *models.Rating) error {
 
 					mr.UserID = 1
 					mr.User = nil
 
 					rating := models.NewRating()
 					rating.ID = 99
+					rating.Version = 3
 					rating.Score = 10
 					rating.Target = 9999
 					rating.UserID = 1
@@ -302,7 +678,8 @@ func TestRatings_Update(t *testing.T) {
 		},
 		{
 			"ok",
-			"api/v1/ratings/99",
+			"/api/v1/ratings/99",
+			`"3"`,
 			`{
 				"comment": "a great comment",
 				"extra": {"color": "red"},
@@ -322,7 +699,7 @@ func TestRatings_Update(t *testing.T) {
 				"userId": 1
 			}`,
 			func(t *testing.T) {
-				rs.update = func(mr *models.Rating) error {
+				rs.UpdateFunc = func(mr *models.Rating) error {
 					mr.User = nil
 					mr.UserID = 1
 
@@ -336,97 +713,193 @@ func TestRatings_Update(t *testing.T) {
 						Score:     10,
 						Target:    9999,
 						UserID:    1,
+						Version:   3,
 					}, mr)
 
+					mr.Version = 4
 					return nil
 				}
 			},
 		},
-	}
-
-	for _, cs := range cases {
-		t.Run(cs.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("PUT", cs.path,
-				bytes.NewReader([]byte(cs.content)))
-			c.Request.Header.Add("Accept", "application/json")
-			c.Request.Header.Add("Content-Type", "application/json")
-
-			if cs.setup != nil {
-				cs.setup(t)
-			}
-
-			mux.HandleContext(c)
-
-			res := w.Result()
-			assert.Equal(t, cs.outStatus, res.StatusCode)
-			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
-			assert.JSONEq(t, cs.outJSON, w.Body.String())
+		{
+			"missingIfMatch",
+			"/api/v1/ratings/99",
+			"",
+			`{"score": 10, "target": 9999}`,
+			http.StatusPreconditionRequired,
+			`{"error":"precondition_required"}`,
+			nil,
+		},
+		{
+			"staleVersion",
+			"/api/v1/ratings/99",
+			`"3"`,
+			`{"score": 10, "target": 9999}`,
+			http.StatusPreconditionFailed,
+			`{"error":"conflict"}`,
+			func(t *testing.T) {
+				rs.UpdateFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(3), mr.Version)
+					return models.ErrConflict
+				}
+			},
+		},
+		{
+			"weakETag",
+			"/api/v1/ratings/99",
+			`W/"3"`,
+			`{"score": 10, "target": 9999}`,
+			http.StatusPreconditionFailed,
+			`{"error":"weak_etag"}`,
+			nil,
+		},
+		{
+			"unquotedETag",
+			"/api/v1/ratings/99",
+			`3`,
+			`{"score": 10, "target": 9999}`,
+			http.StatusPreconditionFailed,
+			`{"error":"conflict"}`,
+			nil,
+		},
+		{
+			"anyVersion",
+			"/api/v1/ratings/99",
+			`*`,
+			`{"score": 10, "target": 9999}`,
+			http.StatusOK,
+			`{
+				"id": 99,
+				"active": true,
+				"anonymous": true,
+				"date": 0,
+				"extra": {},
+				"score": 10,
+				"target": 9999,
+				"userId": 1
+			}`,
+			func(t *testing.T) {
+				rs.UpdateFunc = func(mr *models.Rating) error {
+					assert.Equal(t, anyVersion, mr.Version, "must not check the version")
+
+					mr.User = nil
+					mr.UserID = 1
+					mr.Version = 4
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", cs.path,
+				bytes.NewReader([]byte(cs.content)))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+			if cs.ifMatch != "" {
+				req.Header.Add("If-Match", cs.ifMatch)
+			}
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			if cs.outStatus == http.StatusOK {
+				assert.Equal(t, `"4"`, res.Header.Get("ETag"))
+			}
 
-			*rs = testRatingService{}
+			*rs = modelstest.RatingService{}
 		})
 	}
 }
 
-func TestRatings_Delete(t *testing.T) {
+func TestRatings_Patch(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRatingService{}
-	r := NewRatings(rs)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
 
 	mux := gin.New()
-	mux.DELETE("/api/v1/ratings/:id", func(c *gin.Context) {
+	mux.PATCH("/api/v1/ratings/:id", func(c *gin.Context) {
 		c.Set("user", &models.User{
 			ID: 1,
 		})
-	}, r.Delete)
+	}, r.Patch)
 
 	var cases = []struct {
 		name      string
 		path      string
+		ifMatch   string
+		input     string
 		outStatus int
 		outJSON   string
 		setup     func(*testing.T)
 	}{
 		{
-			"badPathID",
-			"/api/v1/ratings/lksdjflk",
-			http.StatusNotFound,
-			`{"error":"not_found"}`,
+			"missingIfMatch",
+			"/api/v1/ratings/99",
+			"",
+			`{"score":5}`,
+			http.StatusPreconditionRequired,
+			`{"error":"precondition_required"}`,
 			nil,
 		},
 		{
-			"notInStore",
-			"/api/v1/ratings/999",
-			http.StatusNotFound,
-			`{"error":"not_found"}`,
-			func(t *testing.T) {
-				rs.delete = func(mr *models.Rating) error {
-					assert.Equal(t, int64(999), mr.ID)
-					return models.ErrNotFound
-				}
-			},
+			"badFieldType",
+			"/api/v1/ratings/99",
+			`"3"`,
+			`{"score":"five"}`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
 		},
 		{
-			"storeInternalError",
-			"/api/v1/ratings/999",
-			http.StatusInternalServerError,
-			`{"error":"server_error"}`,
+			"notOwner",
+			"/api/v1/ratings/99",
+			`"3"`,
+			`{"score":5}`,
+			http.StatusConflict,
+			`{"error":"read_only"}`,
 			func(t *testing.T) {
-				rs.delete = func(mr *models.Rating) error {
-					assert.Equal(t, int64(999), mr.ID)
-					return wrap("test internal error", nil)
+				rs.UpdatePartialFunc = func(mr *models.Rating, patch []byte) error {
+					return models.ErrReadOnly
 				}
 			},
 		},
 		{
 			"ok",
-			"/api/v1/ratings/999",
-			http.StatusNoContent,
-			`{}`,
+			"/api/v1/ratings/99",
+			`"3"`,
+			`{"score":5,"extra":{"color":"red"}}`,
+			http.StatusOK,
+			`{
+				"id": 99,
+				"active": true,
+				"anonymous": true,
+				"date": 1257894000,
+				"extra": {"color": "red", "size": "xl"},
+				"score": 5,
+				"target": 9999,
+				"userId": 1
+			}`,
 			func(t *testing.T) {
-				rs.delete = func(mr *models.Rating) error {
-					assert.Equal(t, int64(999), mr.ID)
+				rs.UpdatePartialFunc = func(mr *models.Rating, patch []byte) error {
+					assert.Equal(t, &models.Rating{ID: 99, Version: 3, User: &models.User{ID: 1}}, mr)
+					assert.JSONEq(t, `{"score":5,"extra":{"color":"red"}}`, string(patch))
+
+					*mr = models.Rating{
+						ID:        99,
+						Active:    true,
+						Anonymous: true,
+						Date:      1257894000,
+						Extra:     json.RawMessage(`{"color": "red", "size": "xl"}`),
+						Score:     5,
+						Target:    9999,
+						UserID:    1,
+						Version:   4,
+					}
 					return nil
 				}
 			},
@@ -435,43 +908,45 @@ func TestRatings_Delete(t *testing.T) {
 
 	for _, cs := range cases {
 		t.Run(cs.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("DELETE", cs.path, nil)
-			c.Request.Header.Add("Accept", "application/json")
-
-			if cs.setup != nil {
-				cs.setup(t)
+			req, _ := http.NewRequest("PATCH", cs.path,
+				bytes.NewReader([]byte(cs.input)))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+			if cs.ifMatch != "" {
+				req.Header.Add("If-Match", cs.ifMatch)
 			}
 
-			mux.HandleContext(c)
+			w := serveCase(t, mux, req, cs.setup, rs)
 
 			res := w.Result()
 			assert.Equal(t, cs.outStatus, res.StatusCode)
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
-
-			if res.StatusCode != 204 {
-				assert.JSONEq(t, cs.outJSON, w.Body.String())
-			} else {
-				assert.Equal(t, "", w.Body.String())
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			if cs.outStatus == http.StatusOK {
+				assert.Equal(t, `"4"`, res.Header.Get("ETag"))
 			}
 
-			*rs = testRatingService{}
+			*rs = modelstest.RatingService{}
 		})
 	}
 }
 
-func TestRatings_Get(t *testing.T) {
+func TestRatings_Delete(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRatingService{}
-	r := NewRatings(rs)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
 
 	mux := gin.New()
-	mux.GET("/api/v1/ratings/:id", r.Get)
+	mux.DELETE("/api/v1/ratings/:id", func(c *gin.Context) {
+		c.Set("user", &models.User{
+			ID: 1,
+		})
+	}, r.Delete)
 
 	var cases = []struct {
 		name      string
 		path      string
+		ifMatch   string
 		outStatus int
 		outJSON   string
 		setup     func(*testing.T)
@@ -479,6 +954,7 @@ func TestRatings_Get(t *testing.T) {
 		{
 			"badPathID",
 			"/api/v1/ratings/lksdjflk",
+			"",
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			nil,
@@ -486,58 +962,106 @@ func TestRatings_Get(t *testing.T) {
 		{
 			"notInStore",
 			"/api/v1/ratings/999",
+			"*",
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				rs.byID = func(id int64) (models.Rating, error) {
-					assert.Equal(t, int64(999), id)
-					return models.Rating{}, models.ErrNotFound
+				rs.DeleteFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(999), mr.ID)
+					return models.ErrNotFound
 				}
 			},
 		},
 		{
 			"storeInternalError",
 			"/api/v1/ratings/999",
+			"*",
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.byID = func(id int64) (models.Rating, error) {
-					assert.Equal(t, int64(999), id)
-					return models.Rating{}, wrap("test internal error", nil)
+				rs.DeleteFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(999), mr.ID)
+					return wrap("test internal error", nil)
+				}
+			},
+		},
+		{
+			"notOwner",
+			"/api/v1/ratings/999",
+			"*",
+			http.StatusConflict,
+			`{"error":"read_only"}`,
+			func(t *testing.T) {
+				rs.DeleteFunc = func(mr *models.Rating) error {
+					return models.ErrReadOnly
+				}
+			},
+		},
+		{
+			"badVersion",
+			"/api/v1/ratings/999",
+			`W/"3"`,
+			http.StatusPreconditionFailed,
+			`{"error":"weak_etag"}`,
+			nil,
+		},
+		{
+			"versionConflict",
+			"/api/v1/ratings/999",
+			`"3"`,
+			http.StatusPreconditionFailed,
+			`{"error":"conflict"}`,
+			func(t *testing.T) {
+				rs.DeleteFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(3), mr.Version)
+					return models.ErrConflict
 				}
 			},
 		},
 		{
 			"ok",
 			"/api/v1/ratings/999",
-			http.StatusOK,
-			`{
-				"id": 999,
-				"active": true,
-				"anonymous": true,
-				"comment": "a great comment",
-				"date": 0,
-				"extra": {"color": "red"},
-				"score": 10,
-				"target": 9999,
-				"userId": 1
-			}`,
+			"",
+			http.StatusNoContent,
+			`{}`,
 			func(t *testing.T) {
-				rs.byID = func(id int64) (models.Rating, error) {
-					assert.Equal(t, int64(999), id)
-
-					return models.Rating{
-						ID:        999,
-						Active:    true,
-						Anonymous: true,
-						Comment:   "a great comment",
-						Date:      0,
-						Extra:     json.RawMessage(`{"color": "red"}`),
-						Score:     10,
-						Target:    9999,
-						UserID:    1,
-					}, nil
-
+				rs.DeleteFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(999), mr.ID)
+					assert.Equal(t, int64(0), mr.Version, "must delete any version without If-Match")
+					if assert.NotNil(t, mr.User, "must delete on behalf of the session user") {
+						assert.Equal(t, int64(1), mr.User.ID)
+					}
+					return nil
+				}
+			},
+		},
+		{
+			"okAnyVersion",
+			"/api/v1/ratings/999",
+			"*",
+			http.StatusNoContent,
+			`{}`,
+			func(t *testing.T) {
+				rs.DeleteFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(999), mr.ID)
+					assert.Equal(t, int64(0), mr.Version, "must delete any version with If-Match: *")
+					if assert.NotNil(t, mr.User, "must delete on behalf of the session user") {
+						assert.Equal(t, int64(1), mr.User.ID)
+					}
+					return nil
+				}
+			},
+		},
+		{
+			"okVersion",
+			"/api/v1/ratings/999",
+			`"3"`,
+			http.StatusNoContent,
+			`{}`,
+			func(t *testing.T) {
+				rs.DeleteFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(3), mr.Version)
+					return nil
 				}
 			},
 		},
@@ -545,69 +1069,447 @@ func TestRatings_Get(t *testing.T) {
 
 	for _, cs := range cases {
 		t.Run(cs.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("GET", cs.path, nil)
-			c.Request.Header.Add("Accept", "application/json")
-
-			if cs.setup != nil {
-				cs.setup(t)
+			req, _ := http.NewRequest("DELETE", cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+			if cs.ifMatch != "" {
+				req.Header.Add("If-Match", cs.ifMatch)
 			}
 
-			mux.HandleContext(c)
+			w := serveCase(t, mux, req, cs.setup, rs)
 
 			res := w.Result()
 			assert.Equal(t, cs.outStatus, res.StatusCode)
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
-			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*rs = testRatingService{}
+			if res.StatusCode != 204 {
+				assert.JSONEq(t, cs.outJSON, w.Body.String())
+			} else {
+				assert.Equal(t, "", w.Body.String())
+			}
+
+			*rs = modelstest.RatingService{}
 		})
 	}
 }
 
-func TestRatings_ListByTarget(t *testing.T) {
+func TestRatings_Drafts(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRatingService{}
-	r := NewRatings(rs)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
 
 	mux := gin.New()
-	mux.GET("/api/v1/ratings/", r.ListByTarget)
+	session := func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1})
+	}
+	mux.GET("/api/v1/me/drafts", session, r.Drafts)
+	mux.POST("/api/v1/me/drafts/:id/publish", session, r.PublishDraft)
+	mux.DELETE("/api/v1/me/drafts/:id", session, r.DeleteDraft)
 
 	var cases = []struct {
 		name      string
+		method    string
 		path      string
+		content   string
 		outStatus int
+		outETag   string
 		outJSON   string
 		setup     func(*testing.T)
 	}{
 		{
-			"badQueryID",
-			"/api/v1/ratings/?target=kdfjhgkhjlsfg",
-			http.StatusBadRequest,
-			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
-			nil,
+			"list",
+			"GET",
+			"/api/v1/me/drafts",
+			"",
+			http.StatusOK,
+			"",
+			`[{"id":4,"userId":1,"target":9,"score":0,"active":true,"anonymous":false,"extra":{},"date":0,"draft":true}]`,
+			func(t *testing.T) {
+				rs.DraftsFunc = func(userID int64) ([]models.Rating, error) {
+					assert.Equal(t, int64(1), userID)
+					return []models.Rating{{ID: 4, UserID: 1, Target: 9, Active: true, Extra: json.RawMessage(`{}`), Draft: true}}, nil
+				}
+			},
 		},
 		{
-			"badQueryID2",
-			"/api/v1/ratings/?target=kdfjhg,khjlsfg",
-			http.StatusBadRequest,
-			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
-			nil,
+			"listEmpty",
+			"GET",
+			"/api/v1/me/drafts",
+			"",
+			http.StatusOK,
+			"",
+			`[]`,
+			func(t *testing.T) {
+				rs.DraftsFunc = func(int64) ([]models.Rating, error) {
+					return []models.Rating{}, nil
+				}
+			},
 		},
 		{
-			"badQueryID3",
-			"/api/v1/ratings/?whatever=999",
-			http.StatusBadRequest,
-			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
+			"publishBadPathID",
+			"POST",
+			"/api/v1/me/drafts/abc/publish",
+			"",
+			http.StatusNotFound,
+			"",
+			`{"error":"not_found"}`,
 			nil,
 		},
 		{
-			"blankTarget",
-			"/api/v1/ratings/?target=",
-			http.StatusBadRequest,
-			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
-			nil,
+			"publishNotFound",
+			"POST",
+			"/api/v1/me/drafts/4/publish",
+			"",
+			http.StatusNotFound,
+			"",
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.PublishDraftFunc = func(*models.Rating, []byte) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"publishIncomplete",
+			"POST",
+			"/api/v1/me/drafts/4/publish",
+			"",
+			http.StatusBadRequest,
+			"",
+			`{"error":"validation_error","fields":{"score":"required"}}`,
+			func(t *testing.T) {
+				rs.PublishDraftFunc = func(*models.Rating, []byte) error {
+					return models.ValidationError{"score": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"publishBadPatch",
+			"POST",
+			"/api/v1/me/drafts/4/publish",
+			`[]`,
+			http.StatusBadRequest,
+			"",
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"publish",
+			"POST",
+			"/api/v1/me/drafts/4/publish",
+			"",
+			http.StatusCreated,
+			`"1"`,
+			`{"id":12,"userId":1,"target":9,"score":4,"active":true,"anonymous":false,"extra":{},"date":0}`,
+			func(t *testing.T) {
+				rs.PublishDraftFunc = func(mr *models.Rating, patch []byte) error {
+					assert.Equal(t, int64(4), mr.ID)
+					assert.Equal(t, &models.User{ID: 1}, mr.User)
+					assert.Nil(t, patch)
+					*mr = models.Rating{ID: 12, UserID: 1, Target: 9, Score: 4, Active: true, Extra: json.RawMessage(`{}`), Version: 1}
+					return nil
+				}
+			},
+		},
+		{
+			"publishPatch",
+			"POST",
+			"/api/v1/me/drafts/4/publish",
+			`{"score": 4}`,
+			http.StatusCreated,
+			`"1"`,
+			`{"id":12,"userId":1,"target":9,"score":4,"active":true,"anonymous":false,"extra":{},"date":0}`,
+			func(t *testing.T) {
+				rs.PublishDraftFunc = func(mr *models.Rating, patch []byte) error {
+					assert.JSONEq(t, `{"score": 4}`, string(patch))
+					*mr = models.Rating{ID: 12, UserID: 1, Target: 9, Score: 4, Active: true, Extra: json.RawMessage(`{}`), Version: 1}
+					return nil
+				}
+			},
+		},
+		{
+			"deleteNotFound",
+			"DELETE",
+			"/api/v1/me/drafts/4",
+			"",
+			http.StatusNotFound,
+			"",
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.DeleteDraftFunc = func(*models.Rating) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"delete",
+			"DELETE",
+			"/api/v1/me/drafts/4",
+			"",
+			http.StatusNoContent,
+			"",
+			"",
+			func(t *testing.T) {
+				rs.DeleteDraftFunc = func(mr *models.Rating) error {
+					assert.Equal(t, int64(4), mr.ID)
+					assert.Equal(t, &models.User{ID: 1}, mr.User)
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest(cs.method, cs.path, strings.NewReader(cs.content))
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Equal(t, cs.outETag, res.Header.Get("ETag"))
+			if cs.outJSON != "" {
+				assert.JSONEq(t, cs.outJSON, w.Body.String())
+			} else {
+				assert.Equal(t, "", w.Body.String())
+			}
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Get(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	ps := &modelstest.ReplyService{}
+	as := &modelstest.AttachmentService{}
+	r := NewRatings(rs, nil).WithReplies(ps).WithAttachments(as)
+
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/:id", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, r.Get)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badPathID",
+			"/api/v1/ratings/lksdjflk",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"notInStore",
+			"/api/v1/ratings/999",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					assert.Equal(t, int64(999), id)
+					return models.Rating{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"storeInternalError",
+			"/api/v1/ratings/999",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					assert.Equal(t, int64(999), id)
+					return models.Rating{}, wrap("test internal error", nil)
+				}
+			},
+		},
+		{
+			"notVisible",
+			"/api/v1/ratings/999",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.ScopedFunc = func(u *models.User) models.RatingService {
+					assert.Equal(t, int64(2), u.RoleID)
+					return &modelstest.RatingService{
+						ByIDFunc: func(id int64) (models.Rating, error) {
+							return models.Rating{}, models.ErrNotFound
+						},
+					}
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/ratings/999",
+			http.StatusOK,
+			`{
+				"id": 999,
+				"active": true,
+				"anonymous": true,
+				"comment": "a great comment",
+				"date": 0,
+				"extra": {"color": "red"},
+				"score": 10,
+				"target": 9999,
+				"userId": 1
+			}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					assert.Equal(t, int64(999), id)
+
+					return models.Rating{
+						ID:        999,
+						Active:    true,
+						Anonymous: true,
+						Comment:   "a great comment",
+						Date:      0,
+						Extra:     json.RawMessage(`{"color": "red"}`),
+						Score:     10,
+						Target:    9999,
+						UserID:    1,
+					}, nil
+
+				}
+			},
+		},
+		{
+			"withReplies",
+			"/api/v1/ratings/999?replies=true",
+			http.StatusOK,
+			`{
+				"id": 999,
+				"active": true,
+				"anonymous": false,
+				"date": 0,
+				"extra": {},
+				"score": 10,
+				"target": 9999,
+				"userId": 1,
+				"replies": [
+					{"id": 4, "ratingId": 999, "authorId": 7, "body": "Thanks!", "createdAt": "0001-01-01T00:00:00Z", "updatedAt": "0001-01-01T00:00:00Z"}
+				]
+			}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					return models.Rating{ID: 999, Active: true, Extra: json.RawMessage(`{}`), Score: 10, Target: 9999, UserID: 1}, nil
+				}
+				ps.ByRatingFunc = func(ratingID int64) ([]models.Reply, error) {
+					assert.Equal(t, int64(999), ratingID)
+					return []models.Reply{{ID: 4, RatingID: 999, AuthorID: 7, Body: "Thanks!"}}, nil
+				}
+			},
+		},
+		{
+			"badRepliesFlag",
+			"/api/v1/ratings/999?replies=maybe",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"replies":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"withAttachments",
+			"/api/v1/ratings/999",
+			http.StatusOK,
+			`{
+				"id": 999,
+				"active": true,
+				"anonymous": false,
+				"date": 0,
+				"extra": {},
+				"score": 10,
+				"target": 9999,
+				"userId": 1,
+				"attachments": [
+					{"id": 4, "ratingId": 999, "userId": 1, "name": "picture.png", "contentType": "image/png", "size": 5, "createdAt": "0001-01-01T00:00:00Z"}
+				]
+			}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					return models.Rating{ID: 999, Active: true, Extra: json.RawMessage(`{}`), Score: 10, Target: 9999, UserID: 1}, nil
+				}
+				as.ByRatingsFunc = func(ratingIDs []int64) (map[int64][]models.Attachment, error) {
+					assert.Equal(t, []int64{999}, ratingIDs)
+					return map[int64][]models.Attachment{
+						999: {{ID: 4, RatingID: 999, UserID: 1, Key: "attachments/abc", Name: "picture.png", ContentType: "image/png", Size: 5}},
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			as.ByRatingsFunc = func([]int64) (map[int64][]models.Attachment, error) {
+				return nil, nil
+			}
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+			*ps = modelstest.ReplyService{}
+			*as = modelstest.AttachmentService{}
+		})
+	}
+}
+
+func TestRatings_ListByTarget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, r.ListByTarget)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badQueryID",
+			"/api/v1/ratings/?target=kdfjhgkhjlsfg",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
+			nil,
+		},
+		{
+			"badQueryID2",
+			"/api/v1/ratings/?target=kdfjhg,khjlsfg",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
+			nil,
+		},
+		{
+			"badQueryID3",
+			"/api/v1/ratings/?whatever=999",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
+			nil,
+		},
+		{
+			"blankTarget",
+			"/api/v1/ratings/?target=",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"target": "invalid_parse"}}`,
+			nil,
 		},
 		{
 			"notInStore",
@@ -615,7 +1517,7 @@ func TestRatings_ListByTarget(t *testing.T) {
 			http.StatusOK,
 			`{"items":[]}`,
 			func(t *testing.T) {
-				rs.byTarget = func(id int64) ([]models.Rating, error) {
+				rs.ByTargetFunc = func(id int64) ([]models.Rating, error) {
 					assert.Equal(t, int64(999), id)
 					return nil, nil
 				}
@@ -627,7 +1529,7 @@ func TestRatings_ListByTarget(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.byTarget = func(id int64) ([]models.Rating, error) {
+				rs.ByTargetFunc = func(id int64) ([]models.Rating, error) {
 					assert.Equal(t, int64(999), id)
 					return nil, wrap("test internal error", nil)
 				}
@@ -662,7 +1564,7 @@ func TestRatings_ListByTarget(t *testing.T) {
 					}
 				]}`,
 			func(t *testing.T) {
-				rs.byTarget = func(id int64) ([]models.Rating, error) {
+				rs.ByTargetFunc = func(id int64) ([]models.Rating, error) {
 					assert.Equal(t, int64(99), id)
 					return []models.Rating{
 						models.Rating{
@@ -709,7 +1611,7 @@ func TestRatings_ListByTarget(t *testing.T) {
 					}
 				]}`,
 			func(t *testing.T) {
-				rs.byTarget = func(id int64) ([]models.Rating, error) {
+				rs.ByTargetFunc = func(id int64) ([]models.Rating, error) {
 					assert.Equal(t, int64(99), id)
 					return []models.Rating{
 						models.Rating{
@@ -727,27 +1629,1102 @@ func TestRatings_ListByTarget(t *testing.T) {
 				}
 			},
 		},
-	}
-
-	for _, cs := range cases {
-		t.Run(cs.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("GET", cs.path, nil)
-			c.Request.Header.Add("Accept", "application/json")
+		{
+			"badQueryFilters",
+			"/api/v1/ratings/?target=999&minScore=low&to=yesterday&anonymous=maybe",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"minScore":"invalid_parse","to":"invalid_parse","anonymous":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"searchInvalid",
+			"/api/v1/ratings/?target=999&sort=comment",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"sort":"invalid"}}`,
+			func(t *testing.T) {
+				rs.SearchFunc = func(q models.RatingQuery) ([]models.Rating, error) {
+					return nil, models.ValidationError{"sort": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"page",
+			"/api/v1/ratings/?target=999&limit=50&after=87",
+			http.StatusOK,
+			`{"items":[{"id":88,"active":true,"anonymous":false,"date":1257894500,"extra":{},"score":7,"target":999,"userId":1}]}`,
+			func(t *testing.T) {
+				rs.SearchFunc = func(q models.RatingQuery) ([]models.Rating, error) {
+					assert.Equal(t, models.RatingQuery{Target: 999, Limit: 50, After: 87}, q)
 
-			if cs.setup != nil {
-				cs.setup(t)
-			}
+					return []models.Rating{
+						{ID: 88, Active: true, Date: 1257894500, Extra: json.RawMessage(`{}`), Score: 7, Target: 999, UserID: 1},
+					}, nil
+				}
+			},
+		},
+		{
+			"badPage",
+			"/api/v1/ratings/?target=999&limit=all&after=last",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"limit":"invalid_parse","after":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"searchOk",
+			"/api/v1/ratings/?target=999&minScore=3&maxScore=9&from=1257894000&to=1257895000&active=true&anonymous=false&sort=-score",
+			http.StatusOK,
+			`{"items":[{"id":88,"active":true,"anonymous":false,"date":1257894500,"extra":{},"score":7,"target":999,"userId":1}]}`,
+			func(t *testing.T) {
+				rs.SearchFunc = func(q models.RatingQuery) ([]models.Rating, error) {
+					minScore, maxScore, active, anonymous := 3, 9, true, false
+					assert.Equal(t, models.RatingQuery{
+						Target:    999,
+						MinScore:  &minScore,
+						MaxScore:  &maxScore,
+						From:      1257894000,
+						To:        1257895000,
+						Active:    &active,
+						Anonymous: &anonymous,
+						Sort:      "-score",
+					}, q)
 
-			mux.HandleContext(c)
+					return []models.Rating{
+						{ID: 88, Active: true, Date: 1257894500, Extra: json.RawMessage(`{}`), Score: 7, Target: 999, UserID: 1},
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_ListByTargetNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	version := int64(1)
+	rs := modelstest.Unscoped(&modelstest.RatingService{
+		ByTargetFunc: func(id int64) ([]models.Rating, error) {
+			return []models.Rating{{ID: 1, Score: 5, Target: id, UserID: 1, Version: version}}, nil
+		},
+	})
+
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, NewRatings(rs, nil).ListByTarget)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/ratings/?target=999", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+
+	w = get(`"other", ` + etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.String())
+
+	version = 2
+	w = get(etag)
+	assert.Equal(t, http.StatusOK, w.Code, "must be modified by the updates")
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestRatings_ListByTargetExpand(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := modelstest.Unscoped(&modelstest.RatingService{
+		ByTargetFunc: func(id int64) ([]models.Rating, error) {
+			return []models.Rating{
+				{ID: 777, Active: true, Extra: json.RawMessage(`{}`), Score: 9, Target: 99, UserID: 8},
+				{ID: 888, Active: true, Extra: json.RawMessage(`{}`), Score: 10, Target: 99, UserID: 1},
+				{ID: 999, Active: true, Extra: json.RawMessage(`{}`), Score: 8, Target: 99, UserID: 8},
+			}, nil
+		},
+		AuthorsFunc: func(ids ...int64) ([]models.RatingAuthor, error) {
+			return []models.RatingAuthor{
+				{RatingID: 777, UserID: 8},
+				{RatingID: 888, UserID: 1},
+				{RatingID: 999, UserID: 8},
+			}, nil
+		},
+	})
+	var requested [][]int64
+	us := &modelstest.UserService{
+		ByIDsFunc: func(ids ...int64) ([]models.User, error) {
+			requested = append(requested, ids)
+			return []models.User{
+				{ID: 1, Active: true, Email: "one@email.com", FirstName: "One", RoleID: 2},
+				{ID: 8, Active: true, Email: "eight@email.com", FirstName: "Eight", RoleID: 2},
+			}, nil
+		},
+	}
+	r := NewRatings(rs, nil).WithUsers(us)
+
+	var perms models.Permissions
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2, Role: &models.Role{ID: 2, Permissions: perms}})
+	}, r.ListByTarget)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", path, nil)
+		mux.HandleContext(c)
+		return w
+	}
+
+	t.Run("forbidden", func(t *testing.T) {
+		perms = models.PermissionReadRatings
+
+		w := get("/api/v1/ratings/?target=99&expand=user")
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.JSONEq(t, `{"error":"forbidden"}`, w.Body.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		w := get("/api/v1/ratings/?target=99&expand=role")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"validation_error","fields":{"expand":"invalid"}}`, w.Body.String())
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		perms = models.PermissionReadRatings | models.PermissionReadUsers
+		requested = nil
+
+		w := get("/api/v1/ratings/?target=99&expand=user")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"items":[
+			{"id":777,"active":true,"anonymous":false,"date":0,"extra":{},"score":9,"target":99,"userId":8,
+				"user":{"id":8,"active":true,"email":"eight@email.com","firstName":"Eight","lastName":"","roleId":2}},
+			{"id":888,"active":true,"anonymous":false,"date":0,"extra":{},"score":10,"target":99,"userId":1,
+				"user":{"id":1,"active":true,"email":"one@email.com","firstName":"One","lastName":"","roleId":2}},
+			{"id":999,"active":true,"anonymous":false,"date":0,"extra":{},"score":8,"target":99,"userId":8,
+				"user":{"id":8,"active":true,"email":"eight@email.com","firstName":"Eight","lastName":"","roleId":2}}
+		]}`, w.Body.String())
+		assert.Equal(t, [][]int64{{8, 1}}, requested, "must read the users in a single query")
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		w := get("/api/v1/ratings/?target=99&expand=user&fields=id,user")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"items":[
+			{"id":777,"user":{"id":8,"active":true,"email":"eight@email.com","firstName":"Eight","lastName":"","roleId":2}},
+			{"id":888,"user":{"id":1,"active":true,"email":"one@email.com","firstName":"One","lastName":"","roleId":2}},
+			{"id":999,"user":{"id":8,"active":true,"email":"eight@email.com","firstName":"Eight","lastName":"","roleId":2}}
+		]}`, w.Body.String())
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		rs.AuthorsFunc = func(ids ...int64) ([]models.RatingAuthor, error) {
+			assert.Equal(t, []int64{777, 888, 999}, ids)
+			return []models.RatingAuthor{
+				{RatingID: 777, UserID: 8, Deleted: true},
+				{RatingID: 888, UserID: 1},
+				{RatingID: 999, UserID: 8, Deleted: true},
+			}, nil
+		}
+		us.ByIDsFunc = func(ids ...int64) ([]models.User, error) {
+			assert.Equal(t, []int64{1}, ids, "must not read the deleted users")
+			return nil, nil
+		}
+
+		w := get("/api/v1/ratings/?target=99&expand=user&fields=id,user")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"items":[
+			{"id":777,"user":{"id":8,"firstName":"Deleted user","deleted":true}},
+			{"id":888,"user":{"id":1,"firstName":"Deleted user","deleted":true}},
+			{"id":999,"user":{"id":8,"firstName":"Deleted user","deleted":true}}
+		]}`, w.Body.String(), "must render the users not found as deleted")
+	})
+}
+
+func TestRatings_History(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/:id/history", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, r.History)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badID",
+			"/api/v1/ratings/abc/history",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"notFound",
+			"/api/v1/ratings/999/history",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.HistoryFunc = func(id int64) ([]models.RatingRevision, error) {
+					assert.Equal(t, int64(999), id)
+					return nil, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"storeInternalError",
+			"/api/v1/ratings/999/history",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				rs.HistoryFunc = func(id int64) ([]models.RatingRevision, error) {
+					return nil, wrap("test internal error", nil)
+				}
+			},
+		},
+		{
+			"noRevisions",
+			"/api/v1/ratings/999/history",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				rs.HistoryFunc = func(id int64) ([]models.RatingRevision, error) {
+					return nil, nil
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/ratings/999/history",
+			http.StatusOK,
+			`{"items":[
+					{
+						"id": 1,
+						"ratingId": 999,
+						"active": true,
+						"anonymous": true,
+						"comment": "a first comment",
+						"extra": {},
+						"date": 100,
+						"score": 3,
+						"target": 99,
+						"userId": 8,
+						"revisedAt": 200
+					}
+				]}`,
+			func(t *testing.T) {
+				rs.HistoryFunc = func(id int64) ([]models.RatingRevision, error) {
+					assert.Equal(t, int64(999), id)
+					return []models.RatingRevision{
+						models.RatingRevision{
+							ID:        1,
+							RatingID:  999,
+							Active:    true,
+							Anonymous: true,
+							Comment:   "a first comment",
+							Date:      100,
+							Extra:     json.RawMessage(`{}`),
+							Score:     3,
+							Target:    99,
+							UserID:    8,
+							RevisedAt: 200,
+						},
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
 
 			res := w.Result()
 			assert.Equal(t, cs.outStatus, res.StatusCode)
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*rs = testRatingService{}
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Stats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/targets/:id/stats", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, r.Stats)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"badID",
+			"/api/v1/targets/abc/stats",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"validationError",
+			"/api/v1/targets/-9/stats",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"target":"invalid"}}`,
+			func(t *testing.T) {
+				rs.StatsByTargetFunc = func(target int64) (models.RatingStats, error) {
+					return models.RatingStats{}, models.ValidationError{"target": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"internalError",
+			"/api/v1/targets/999/stats",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				rs.StatsByTargetFunc = func(target int64) (models.RatingStats, error) {
+					return models.RatingStats{}, privateError("test error message")
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/targets/999/stats",
+			http.StatusOK,
+			`{"target":999,"count":3,"average":4.5,"min":-1,"max":9,"weightedAverage":5.25,"verifiedWeightedAverage":6}`,
+			func(t *testing.T) {
+				rs.StatsByTargetFunc = func(target int64) (models.RatingStats, error) {
+					assert.Equal(t, int64(999), target)
+					return models.RatingStats{Target: 999, Count: 3, Average: 4.5, Min: -1, Max: 9, WeightedAverage: 5.25, VerifiedWeightedAverage: 6}, nil
+				}
+			},
+		},
+		{
+			"distribution",
+			"/api/v1/targets/999/stats?distribution=true",
+			http.StatusOK,
+			`{"target":999,"count":3,"average":4,"min":1,"max":5,"weightedAverage":4,"verifiedWeightedAverage":4,
+				"percentiles":{"p25":2.5,"p50":4,"p75":4.5},
+				"histogram":[{"min":1,"max":3,"count":1},{"min":4,"max":5,"count":2}]}`,
+			func(t *testing.T) {
+				rs.DetailedStatsByTargetFunc = func(target int64, f models.StatsFilter) (models.RatingStats, error) {
+					assert.Equal(t, int64(999), target)
+					assert.Equal(t, models.StatsFilter{}, f)
+					return models.RatingStats{
+						Target: 999, Count: 3, Average: 4, Min: 1, Max: 5, WeightedAverage: 4, VerifiedWeightedAverage: 4,
+						Percentiles: &models.ScorePercentiles{P25: 2.5, P50: 4, P75: 4.5},
+						Histogram:   []models.HistogramBucket{{Min: 1, Max: 3, Count: 1}, {Min: 4, Max: 5, Count: 2}},
+					}, nil
+				}
+			},
+		},
+		{
+			"filtered",
+			"/api/v1/targets/999/stats?verified=true&from=100&to=200&buckets=10",
+			http.StatusOK,
+			`{"target":999,"count":0,"average":0,"min":0,"max":0,"weightedAverage":0,"verifiedWeightedAverage":0,"percentiles":{"p25":0,"p50":0,"p75":0}}`,
+			func(t *testing.T) {
+				rs.DetailedStatsByTargetFunc = func(target int64, f models.StatsFilter) (models.RatingStats, error) {
+					assert.Equal(t, models.StatsFilter{Verified: true, From: 100, To: 200, Buckets: 10}, f)
+					return models.RatingStats{Target: 999, Percentiles: &models.ScorePercentiles{}}, nil
+				}
+			},
+		},
+		{
+			"notDistribution",
+			"/api/v1/targets/999/stats?distribution=false&verified=false",
+			http.StatusOK,
+			`{"target":999,"count":0,"average":0,"min":0,"max":0,"weightedAverage":0,"verifiedWeightedAverage":0}`,
+			func(t *testing.T) {
+				rs.StatsByTargetFunc = func(target int64) (models.RatingStats, error) {
+					return models.RatingStats{Target: 999}, nil
+				}
+			},
+		},
+		{
+			"badFilter",
+			"/api/v1/targets/999/stats?verified=maybe&buckets=many",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"verified":"invalid_parse","buckets":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"invalidFilter",
+			"/api/v1/targets/999/stats?buckets=50",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"buckets":"invalid"}}`,
+			func(t *testing.T) {
+				rs.DetailedStatsByTargetFunc = func(target int64, f models.StatsFilter) (models.RatingStats, error) {
+					return models.RatingStats{}, models.ValidationError{"buckets": models.ErrInvalid}
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", cs.path, nil)
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Compare(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/compare", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, r.Compare)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"targetsRequired",
+			"/api/v1/ratings/compare",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"targets":"required"}}`,
+			nil,
+		},
+		{
+			"badTargets",
+			"/api/v1/ratings/compare?targets=1,abc",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"targets":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"tooManyTargets",
+			"/api/v1/ratings/compare?targets=1,2,3,4,5,6,7,8,9,10,11",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"targets":"too_long"}}`,
+			nil,
+		},
+		{
+			"validationError",
+			"/api/v1/ratings/compare?targets=1,-9",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"target":"invalid"}}`,
+			func(t *testing.T) {
+				rs.StatsByTargetFunc = func(target int64) (models.RatingStats, error) {
+					if target < 1 {
+						return models.RatingStats{}, models.ValidationError{"target": models.ErrInvalid}
+					}
+					return models.RatingStats{Target: target}, nil
+				}
+				rs.SearchFunc = func(q models.RatingQuery) ([]models.Rating, error) {
+					return nil, nil
+				}
+			},
+		},
+		{
+			"internalError",
+			"/api/v1/ratings/compare?targets=1,2",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				rs.StatsByTargetFunc = func(target int64) (models.RatingStats, error) {
+					return models.RatingStats{Target: target}, nil
+				}
+				rs.SearchFunc = func(q models.RatingQuery) ([]models.Rating, error) {
+					return nil, privateError("test error message")
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/ratings/compare?targets=9,3,9",
+			http.StatusOK,
+			`{"items":[` +
+				`{"stats":{"target":9,"count":2,"average":4.5,"min":3,"max":6,"weightedAverage":4.5,"verifiedWeightedAverage":4.5},` +
+				`"recent":[{"id":7,"active":true,"anonymous":false,"date":1000,"extra":{},"score":6,"target":9,"userId":2}]},` +
+				`{"stats":{"target":3,"count":0,"average":0,"min":0,"max":0,"weightedAverage":0,"verifiedWeightedAverage":0},"recent":[]}]}`,
+			func(t *testing.T) {
+				rs.StatsByTargetFunc = func(target int64) (models.RatingStats, error) {
+					if target == 9 {
+						return models.RatingStats{Target: 9, Count: 2, Average: 4.5, Min: 3, Max: 6, WeightedAverage: 4.5, VerifiedWeightedAverage: 4.5}, nil
+					}
+					return models.RatingStats{Target: target}, nil
+				}
+				rs.SearchFunc = func(q models.RatingQuery) ([]models.Rating, error) {
+					assert.Equal(t, "-date", q.Sort)
+					assert.Equal(t, 5, q.Limit)
+					assert.Equal(t, true, *q.Active, "must only return the active ratings")
+					if q.Target == 9 {
+						return []models.Rating{{ID: 7, Active: true, Date: 1000, Extra: json.RawMessage(`{}`), Score: 6, Target: 9, UserID: 2}}, nil
+					}
+					return nil, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", cs.path, nil)
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Tags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/targets/:id/tags", r.Tags)
+	mux.PUT("/api/v1/targets/:id/tags", r.SetTags)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"badID",
+			"GET",
+			"/api/v1/targets/abc/tags",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/targets/9/tags",
+			"",
+			http.StatusOK,
+			`{"target":9,"tags":["retail","north"]}`,
+			func(t *testing.T) {
+				rs.TagsFunc = func(target int64) ([]string, error) {
+					assert.Equal(t, int64(9), target)
+					return []string{"retail", "north"}, nil
+				}
+			},
+		},
+		{
+			"setBadJSON",
+			"PUT",
+			"/api/v1/targets/9/tags",
+			`{"tags": "retail"}`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"setValidationError",
+			"PUT",
+			"/api/v1/targets/9/tags",
+			`{"tags": [""]}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"tags":"required"}}`,
+			func(t *testing.T) {
+				rs.SetTagsFunc = func(target int64, tags []string) error {
+					return models.ValidationError{"tags": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"set",
+			"PUT",
+			"/api/v1/targets/9/tags",
+			`{"tags": ["Retail"]}`,
+			http.StatusOK,
+			`{"target":9,"tags":["retail"]}`,
+			func(t *testing.T) {
+				rs.SetTagsFunc = func(target int64, tags []string) error {
+					assert.Equal(t, int64(9), target)
+					assert.Equal(t, []string{"Retail"}, tags)
+					return nil
+				}
+				rs.TagsFunc = func(target int64) ([]string, error) {
+					return []string{"retail"}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest(cs.method, cs.path, bytes.NewBufferString(cs.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Category(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/targets/:id/category", r.Category)
+	mux.PUT("/api/v1/targets/:id/category", r.SetCategory)
+
+	one, five := 1, 5
+	restaurants := models.TargetCategory{Name: "restaurants", MinScore: &one, MaxScore: &five, CommentRequired: true, UpdatedBy: 1}
+	const restaurantsJSON = `{"name":"restaurants","minScore":1,"maxScore":5,"commentRequired":true,"updatedBy":1,"updatedAt":"0001-01-01T00:00:00Z"}`
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"get",
+			"GET",
+			"/api/v1/targets/9/category",
+			"",
+			http.StatusOK,
+			`{"target":9,"category":` + restaurantsJSON + `}`,
+			func(t *testing.T) {
+				rs.CategoryFunc = func(target int64) (models.TargetCategory, error) {
+					assert.Equal(t, int64(9), target)
+					return restaurants, nil
+				}
+			},
+		},
+		{
+			"getNone",
+			"GET",
+			"/api/v1/targets/9/category",
+			"",
+			http.StatusOK,
+			`{"target":9,"category":null}`,
+			func(t *testing.T) {
+				rs.CategoryFunc = func(target int64) (models.TargetCategory, error) {
+					return models.TargetCategory{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"setUnknown",
+			"PUT",
+			"/api/v1/targets/9/category",
+			`{"category": "drivers"}`,
+			http.StatusNotFound,
+			`{"error":"validation_error","fields":{"category":"reference_not_found"}}`,
+			func(t *testing.T) {
+				rs.SetCategoryFunc = func(target int64, name string) error {
+					return models.ValidationError{"category": models.ErrRefNotFound}
+				}
+			},
+		},
+		{
+			"set",
+			"PUT",
+			"/api/v1/targets/9/category",
+			`{"category": "restaurants"}`,
+			http.StatusOK,
+			`{"target":9,"category":` + restaurantsJSON + `}`,
+			func(t *testing.T) {
+				rs.SetCategoryFunc = func(target int64, name string) error {
+					assert.Equal(t, int64(9), target)
+					assert.Equal(t, "restaurants", name)
+					return nil
+				}
+				rs.CategoryFunc = func(target int64) (models.TargetCategory, error) {
+					return restaurants, nil
+				}
+			},
+		},
+		{
+			"unset",
+			"PUT",
+			"/api/v1/targets/9/category",
+			`{"category": null}`,
+			http.StatusOK,
+			`{"target":9,"category":null}`,
+			func(t *testing.T) {
+				rs.SetCategoryFunc = func(target int64, name string) error {
+					assert.Empty(t, name)
+					return nil
+				}
+				rs.CategoryFunc = func(target int64) (models.TargetCategory, error) {
+					return models.TargetCategory{}, models.ErrNotFound
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest(cs.method, cs.path, bytes.NewBufferString(cs.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Window(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/targets/:id/window", r.Window)
+	mux.PUT("/api/v1/targets/:id/window", r.SetWindow)
+	mux.POST("/api/v1/targets/:id/window/open", r.OpenWindow)
+	mux.POST("/api/v1/targets/:id/window/close", r.CloseWindow)
+
+	opens := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	closes := opens.AddDate(0, 0, 7)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"badPathID",
+			"GET",
+			"/api/v1/targets/abc/window",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/targets/9/window",
+			"",
+			http.StatusOK,
+			`{"target":9,"opensAt":"2020-03-01T00:00:00Z","closesAt":null}`,
+			func(t *testing.T) {
+				rs.WindowFunc = func(target int64) (models.TargetWindow, error) {
+					assert.Equal(t, int64(9), target)
+					return models.TargetWindow{Target: 9, OpensAt: &opens}, nil
+				}
+			},
+		},
+		{
+			"set",
+			"PUT",
+			"/api/v1/targets/9/window",
+			`{"target": 8, "opensAt": "2020-03-01T00:00:00Z", "closesAt": "2020-03-08T00:00:00Z"}`,
+			http.StatusOK,
+			`{"target":9,"opensAt":"2020-03-01T00:00:00Z","closesAt":"2020-03-08T00:00:00Z"}`,
+			func(t *testing.T) {
+				rs.SetWindowFunc = func(w *models.TargetWindow) error {
+					assert.Equal(t, &models.TargetWindow{Target: 9, OpensAt: &opens, ClosesAt: &closes}, w)
+					return nil
+				}
+			},
+		},
+		{
+			"setInvalid",
+			"PUT",
+			"/api/v1/targets/9/window",
+			`{"opensAt": "2020-03-08T00:00:00Z", "closesAt": "2020-03-01T00:00:00Z"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"closesAt":"invalid"}}`,
+			func(t *testing.T) {
+				rs.SetWindowFunc = func(*models.TargetWindow) error {
+					return models.ValidationError{"closesAt": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"setBadJSON",
+			"PUT",
+			"/api/v1/targets/9/window",
+			`{"opensAt": "yesterday"}`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"open",
+			"POST",
+			"/api/v1/targets/9/window/open",
+			"",
+			http.StatusOK,
+			`{"target":9,"opensAt":null,"closesAt":null}`,
+			func(t *testing.T) {
+				rs.SetWindowFunc = func(w *models.TargetWindow) error {
+					assert.Equal(t, &models.TargetWindow{Target: 9}, w)
+					return nil
+				}
+			},
+		},
+		{
+			"close",
+			"POST",
+			"/api/v1/targets/9/window/close",
+			"",
+			http.StatusOK,
+			`{"target":9,"opensAt":null,"closesAt":"2020-03-08T00:00:00Z"}`,
+			func(t *testing.T) {
+				rs.SetWindowFunc = func(w *models.TargetWindow) error {
+					assert.Nil(t, w.OpensAt)
+					if assert.NotNil(t, w.ClosesAt) {
+						assert.WithinDuration(t, time.Now(), *w.ClosesAt, time.Minute)
+					}
+					w.ClosesAt = &closes
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest(cs.method, cs.path, bytes.NewBufferString(cs.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Cohorts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/cohorts", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, r.Cohorts)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"byRequired",
+			"/api/v1/ratings/cohorts",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"by":"required"}}`,
+			func(t *testing.T) {
+				rs.CohortsFunc = func(by string) ([]models.RatingCohort, error) {
+					assert.Equal(t, "", by)
+					return nil, models.ValidationError{"by": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"internalError",
+			"/api/v1/ratings/cohorts?by=signupMonth",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				rs.CohortsFunc = func(by string) ([]models.RatingCohort, error) {
+					return nil, privateError("test error message")
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/ratings/cohorts?by=signupMonth",
+			http.StatusOK,
+			`{"by":"signupMonth","items":[
+				{"cohort":"2020-03-01T00:00:00Z","users":2,"count":3,"average":3},
+				{"cohort":"2020-04-01T00:00:00Z","users":1,"count":1,"average":4}
+			]}`,
+			func(t *testing.T) {
+				rs.CohortsFunc = func(by string) ([]models.RatingCohort, error) {
+					assert.Equal(t, "signupMonth", by)
+					return []models.RatingCohort{
+						{Cohort: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), Users: 2, Count: 3, Average: 3},
+						{Cohort: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), Users: 1, Count: 1, Average: 4},
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
+
+func TestRatings_Scores(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RatingService{}
+	r := NewRatings(rs, nil)
+
+	mux := gin.New()
+	mux.GET("/api/v1/targets/scores", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, r.Scores)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(t *testing.T)
+	}{
+		{
+			"parseError",
+			"/api/v1/targets/scores?targets=1,x",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"targets":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"targetsRequired",
+			"/api/v1/targets/scores",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"targets":"required"}}`,
+			func(t *testing.T) {
+				rs.ScoresFunc = func(targets []int64) ([]models.TargetScore, error) {
+					assert.Empty(t, targets)
+					return nil, models.ValidationError{"targets": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"internalError",
+			"/api/v1/targets/scores?targets=1",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				rs.ScoresFunc = func(targets []int64) ([]models.TargetScore, error) {
+					return nil, privateError("test error message")
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/targets/scores?targets=7,3",
+			http.StatusOK,
+			`{"items":[{"target":3,"count":2,"average":3.5},{"target":7,"count":0,"average":0}]}`,
+			func(t *testing.T) {
+				rs.ScoresFunc = func(targets []int64) ([]models.TargetScore, error) {
+					assert.Equal(t, []int64{7, 3}, targets)
+					return []models.TargetScore{{Target: 3, Count: 2, Average: 3.5, ScoreSum: 7}, {Target: 7}}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RatingService{}
 		})
 	}
 }
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Replies implements a controller for the replies of the owners of the targets, and of the
+// administrators, to the ratings, and for the management of the owners of the targets.
+type Replies struct {
+	ps models.ReplyService
+	rs models.RatingService
+
+	viewErr views.Error
+}
+
+// NewReplies creates a new Replies controller. rs is used to check that the ratings replied to
+// are visible to the user.
+func NewReplies(ps models.ReplyService, rs models.RatingService) *Replies {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(ErrForbidden, http.StatusForbidden)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	return &Replies{
+		ps:      ps,
+		rs:      rs,
+		viewErr: ev,
+	}
+}
+
+// List returns the replies to a rating, oldest first.
+//
+// GET /api/v1/ratings/:id/replies
+func (rp *Replies) List(c *gin.Context) {
+	rating, err := rp.rating(c)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	replies, err := rp.ps.ByRating(rating.ID)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": replies,
+	})
+}
+
+// Create performs the addition of a reply to a rating by the requester, who must own the rated
+// target or be an administrator.
+//
+// POST /api/v1/ratings/:id/replies
+func (rp *Replies) Create(c *gin.Context) {
+	rating, err := rp.rating(c)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	var reply models.Reply
+
+	err = parseJSON(c, &reply)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	u := middleware.Actor(c)
+	if !u.IsAdmin() {
+		owners, err := rp.ps.Owners(rating.Target)
+		if err != nil {
+			rp.viewErr.JSON(c, err)
+			return
+		} else if !ownedBy(owners, u.ID) {
+			rp.viewErr.JSON(c, ErrForbidden)
+			return
+		}
+	}
+
+	reply.RatingID = rating.ID
+	reply.AuthorID = u.ID
+
+	err = rp.ps.Create(&reply)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &reply)
+}
+
+// Update performs the change of the body of a reply. Only its author or an administrator can
+// change it.
+//
+// PUT /api/v1/ratings/:id/replies/:replyId
+func (rp *Replies) Update(c *gin.Context) {
+	reply, err := rp.reply(c)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	err = parseJSON(c, &input)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+	reply.Body = input.Body
+
+	err = rp.ps.Update(&reply)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &reply)
+}
+
+// Delete removes a reply. Only its author or an administrator can remove it.
+//
+// DELETE /api/v1/ratings/:id/replies/:replyId
+func (rp *Replies) Delete(c *gin.Context) {
+	reply, err := rp.reply(c)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	err = rp.ps.Delete(reply.RatingID, reply.ID)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// Owners returns the IDs of the users owning a target, who can reply to its ratings.
+//
+// GET /api/v1/targets/:id/owners
+func (rp *Replies) Owners(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	owners, err := rp.ps.Owners(tid)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"target": tid,
+		"owners": owners,
+	})
+}
+
+// SetOwners replaces the users owning a target.
+//
+// PUT /api/v1/targets/:id/owners
+func (rp *Replies) SetOwners(c *gin.Context) {
+	tid, err := getParamInt(c, "id")
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	var input struct {
+		Owners []int64 `json:"owners"`
+	}
+
+	err = parseJSON(c, &input)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	err = rp.ps.SetOwners(tid, input.Owners)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	owners, err := rp.ps.Owners(tid)
+	if err != nil {
+		rp.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"target": tid,
+		"owners": owners,
+	})
+}
+
+// rating returns the rating of the path of a request, if visible to the requester.
+func (rp *Replies) rating(c *gin.Context) (models.Rating, error) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		return models.Rating{}, err
+	}
+
+	return rp.rs.Scoped(middleware.Actor(c).User).ByID(id)
+}
+
+// reply returns the reply of the path of a request, if the requester wrote it or is an
+// administrator, and its rating is visible to them.
+func (rp *Replies) reply(c *gin.Context) (models.Reply, error) {
+	rating, err := rp.rating(c)
+	if err != nil {
+		return models.Reply{}, err
+	}
+
+	id, err := getParamInt(c, "replyId")
+	if err != nil {
+		return models.Reply{}, err
+	}
+
+	reply, err := rp.ps.ByID(rating.ID, id)
+	if err != nil {
+		return models.Reply{}, err
+	}
+
+	u := middleware.Actor(c)
+	if reply.AuthorID != u.ID && !u.IsAdmin() {
+		return models.Reply{}, ErrForbidden
+	}
+
+	return reply, nil
+}
+
+// ownedBy tells whether the owners of a target include userID.
+func ownedBy(owners []int64, userID int64) bool {
+	for _, id := range owners {
+		if id == userID {
+			return true
+		}
+	}
+
+	return false
+}
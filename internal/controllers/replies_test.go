@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ps := &modelstest.ReplyService{}
+	rs := &modelstest.RatingService{}
+	rp := NewReplies(ps, rs)
+
+	created := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	reply := models.Reply{ID: 4, RatingID: 10, AuthorID: 7, Body: "Thanks!", CreatedAt: created, UpdatedAt: created}
+	const replyJSON = `{"id":4,"ratingId":10,"authorId":7,"body":"Thanks!","createdAt":"2020-03-01T00:00:00Z","updatedAt":"2020-03-01T00:00:00Z"}`
+
+	var user *models.User
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", user)
+	})
+	mux.GET("/api/v1/ratings/:id/replies", rp.List)
+	mux.POST("/api/v1/ratings/:id/replies", rp.Create)
+	mux.PUT("/api/v1/ratings/:id/replies/:replyId", rp.Update)
+	mux.DELETE("/api/v1/ratings/:id/replies/:replyId", rp.Delete)
+	mux.GET("/api/v1/targets/:id/owners", rp.Owners)
+	mux.PUT("/api/v1/targets/:id/owners", rp.SetOwners)
+
+	owner := &models.User{ID: 7, RoleID: 2}
+	admin := &models.User{ID: 1, RoleID: 1}
+	other := &models.User{ID: 8, RoleID: 2}
+
+	rating := func(t *testing.T) {
+		rs.ByIDFunc = func(id int64) (models.Rating, error) {
+			if id != 10 {
+				return models.Rating{}, models.ErrNotFound
+			}
+			return models.Rating{ID: 10, Target: 9}, nil
+		}
+		ps.OwnersFunc = func(target int64) ([]int64, error) {
+			assert.Equal(t, int64(9), target)
+			return []int64{3, 7}, nil
+		}
+		ps.ByIDFunc = func(ratingID, id int64) (models.Reply, error) {
+			if ratingID != 10 || id != 4 {
+				return models.Reply{}, models.ErrNotFound
+			}
+			return reply, nil
+		}
+	}
+
+	var cases = []struct {
+		name      string
+		user      *models.User
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			other,
+			"GET",
+			"/api/v1/ratings/10/replies",
+			"",
+			http.StatusOK,
+			`{"items":[` + replyJSON + `]}`,
+			func(t *testing.T) {
+				rating(t)
+				ps.ByRatingFunc = func(ratingID int64) ([]models.Reply, error) {
+					assert.Equal(t, int64(10), ratingID)
+					return []models.Reply{reply}, nil
+				}
+			},
+		},
+		{
+			"listRatingNotVisible",
+			other,
+			"GET",
+			"/api/v1/ratings/11/replies",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			rating,
+		},
+		{
+			"createByOwner",
+			owner,
+			"POST",
+			"/api/v1/ratings/10/replies",
+			`{"body":"Thanks!","ratingId":99,"authorId":99}`,
+			http.StatusCreated,
+			replyJSON,
+			func(t *testing.T) {
+				rating(t)
+				ps.CreateFunc = func(r *models.Reply) error {
+					assert.Equal(t, int64(10), r.RatingID, "must reply to the rating of the path")
+					assert.Equal(t, int64(7), r.AuthorID, "must be written by the requester")
+					r.ID, r.CreatedAt, r.UpdatedAt = 4, created, created
+					return nil
+				}
+			},
+		},
+		{
+			"createByAdmin",
+			admin,
+			"POST",
+			"/api/v1/ratings/10/replies",
+			`{"body":"Thanks!"}`,
+			http.StatusCreated,
+			`{"id":4,"ratingId":10,"authorId":1,"body":"Thanks!","createdAt":"2020-03-01T00:00:00Z","updatedAt":"2020-03-01T00:00:00Z"}`,
+			func(t *testing.T) {
+				rating(t)
+				ps.OwnersFunc = nil
+				ps.CreateFunc = func(r *models.Reply) error {
+					r.ID, r.CreatedAt, r.UpdatedAt = 4, created, created
+					return nil
+				}
+			},
+		},
+		{
+			"createNotOwner",
+			other,
+			"POST",
+			"/api/v1/ratings/10/replies",
+			`{"body":"Thanks!"}`,
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+			rating,
+		},
+		{
+			"createInvalid",
+			owner,
+			"POST",
+			"/api/v1/ratings/10/replies",
+			`{"body":""}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"body":"required"}}`,
+			func(t *testing.T) {
+				rating(t)
+				ps.CreateFunc = func(r *models.Reply) error {
+					return models.ValidationError{"body": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"update",
+			owner,
+			"PUT",
+			"/api/v1/ratings/10/replies/4",
+			`{"body":"Thanks a lot!"}`,
+			http.StatusOK,
+			`{"id":4,"ratingId":10,"authorId":7,"body":"Thanks a lot!","createdAt":"2020-03-01T00:00:00Z","updatedAt":"2020-03-01T00:00:00Z"}`,
+			func(t *testing.T) {
+				rating(t)
+				ps.UpdateFunc = func(r *models.Reply) error {
+					assert.Equal(t, int64(4), r.ID)
+					return nil
+				}
+			},
+		},
+		{
+			"updateNotAuthor",
+			&models.User{ID: 3, RoleID: 2},
+			"PUT",
+			"/api/v1/ratings/10/replies/4",
+			`{"body":"Thanks a lot!"}`,
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+			rating,
+		},
+		{
+			"deleteByAdmin",
+			admin,
+			"DELETE",
+			"/api/v1/ratings/10/replies/4",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				rating(t)
+				ps.DeleteFunc = func(ratingID, id int64) error {
+					assert.Equal(t, int64(10), ratingID)
+					assert.Equal(t, int64(4), id)
+					return nil
+				}
+			},
+		},
+		{
+			"deleteOtherRating",
+			admin,
+			"DELETE",
+			"/api/v1/ratings/10/replies/5",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			rating,
+		},
+		{
+			"owners",
+			admin,
+			"GET",
+			"/api/v1/targets/9/owners",
+			"",
+			http.StatusOK,
+			`{"target":9,"owners":[3,7]}`,
+			rating,
+		},
+		{
+			"setOwners",
+			admin,
+			"PUT",
+			"/api/v1/targets/9/owners",
+			`{"owners":[7,3]}`,
+			http.StatusOK,
+			`{"target":9,"owners":[3,7]}`,
+			func(t *testing.T) {
+				rating(t)
+				ps.SetOwnersFunc = func(target int64, userIDs []int64) error {
+					assert.Equal(t, int64(9), target)
+					assert.Equal(t, []int64{7, 3}, userIDs)
+					return nil
+				}
+			},
+		},
+		{
+			"setUnknownOwners",
+			admin,
+			"PUT",
+			"/api/v1/targets/9/owners",
+			`{"owners":[404]}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"owners":"reference_not_found"}}`,
+			func(t *testing.T) {
+				ps.SetOwnersFunc = func(target int64, userIDs []int64) error {
+					return models.ValidationError{"owners": models.ErrRefNotFound}
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			user = tc.user
+			w := serveCase(t, mux, req, tc.setup, rs)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*ps = modelstest.ReplyService{}
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Reputation implements a controller for the reactions to ratings, their moderation and the
+// resulting reputation of the users.
+type Reputation struct {
+	reps models.ReputationService
+	rs   models.RatingService
+
+	viewErr views.Error
+}
+
+// NewReputation creates a new Reputation controller. rs is used to check that the ratings
+// reacted to are visible to the user.
+func NewReputation(reps models.ReputationService, rs models.RatingService) *Reputation {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrOwnRating, http.StatusForbidden)
+
+	return &Reputation{
+		reps:    reps,
+		rs:      rs,
+		viewErr: ev,
+	}
+}
+
+// Get returns the reputation of a user by ID.
+//
+// GET /api/v1/users/:id/reputation
+func (r *Reputation) Get(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	rep, err := r.reps.ByUser(id)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &rep)
+}
+
+// React records whether the requester found a rating helpful, replacing their previous
+// reaction to it. Users cannot react to their own ratings.
+//
+// PUT /api/v1/ratings/:id/reaction
+func (r *Reputation) React(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	u := middleware.Actor(c)
+
+	var input struct {
+		Helpful *bool `json:"helpful"`
+	}
+
+	err = parseJSON(c, &input)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	} else if input.Helpful == nil {
+		r.viewErr.JSON(c, models.ValidationError{"helpful": models.ErrRequired})
+		return
+	}
+
+	// ratings that are not visible to the user cannot be reacted to
+	_, err = r.rs.Scoped(u.User).ByID(id)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	x := models.Reaction{RatingID: id, UserID: u.ID, Helpful: *input.Helpful}
+	err = r.reps.React(&x)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &x)
+}
+
+// Unreact removes the reaction of the requester to a rating.
+//
+// DELETE /api/v1/ratings/:id/reaction
+func (r *Reputation) Unreact(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	err = r.reps.Unreact(id, middleware.Actor(c).ID)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// Moderate records the outcome of the moderation of a rating, which is either "approved" or
+// "removed". Removed ratings are deactivated.
+//
+// PUT /api/v1/ratings/:id/moderation
+func (r *Reputation) Moderate(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var m models.Moderation
+
+	err = parseJSON(c, &m)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	m.RatingID = id
+	m.ModeratorID = middleware.Actor(c).ID
+
+	err = r.reps.Moderate(&m)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &m)
+}
+
+// Held lists the moderation queue: the active ratings held back from the aggregates until they
+// are approved, because their authors' accounts are new.
+//
+// GET /api/v1/moderation/ratings
+func (r *Reputation) Held(c *gin.Context) {
+	ratings, err := r.reps.Held()
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": ratings})
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReputation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reps := &modelstest.ReputationService{}
+	rs := &modelstest.RatingService{}
+	r := NewReputation(reps, rs)
+
+	decided := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 7, RoleID: 2})
+	})
+	mux.GET("/api/v1/users/:id/reputation", r.Get)
+	mux.PUT("/api/v1/ratings/:id/reaction", r.React)
+	mux.DELETE("/api/v1/ratings/:id/reaction", r.Unreact)
+	mux.PUT("/api/v1/ratings/:id/moderation", r.Moderate)
+	mux.GET("/api/v1/moderation/ratings", r.Held)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"getNotFound",
+			"GET",
+			"/api/v1/users/404/reputation",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				reps.ByUserFunc = func(id int64) (models.Reputation, error) {
+					return models.Reputation{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/users/3/reputation",
+			"",
+			http.StatusOK,
+			`{"userId":3,"points":120,"weight":3.08,"ratings":60,"helpful":30,"unhelpful":0,"approved":0,"removed":0,"badges":["prolific"]}`,
+			func(t *testing.T) {
+				reps.ByUserFunc = func(id int64) (models.Reputation, error) {
+					assert.Equal(t, int64(3), id)
+					return models.Reputation{UserID: 3, Points: 120, Weight: 3.08, Ratings: 60, Helpful: 30, Badges: []string{"prolific"}}, nil
+				}
+			},
+		},
+		{
+			"reactMissingHelpful",
+			"PUT",
+			"/api/v1/ratings/5/reaction",
+			`{}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"helpful":"required"}}`,
+			nil,
+		},
+		{
+			"reactNotVisible",
+			"PUT",
+			"/api/v1/ratings/5/reaction",
+			`{"helpful":true}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.ScopedFunc = func(u *models.User) models.RatingService {
+					return &modelstest.RatingService{
+						ByIDFunc: func(id int64) (models.Rating, error) {
+							return models.Rating{}, models.ErrNotFound
+						},
+					}
+				}
+			},
+		},
+		{
+			"reactOwnRating",
+			"PUT",
+			"/api/v1/ratings/5/reaction",
+			`{"helpful":true}`,
+			http.StatusForbidden,
+			`{"error":"own_rating"}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					return models.Rating{ID: id, UserID: 7}, nil
+				}
+				reps.ReactFunc = func(x *models.Reaction) error {
+					return models.ErrOwnRating
+				}
+			},
+		},
+		{
+			"react",
+			"PUT",
+			"/api/v1/ratings/5/reaction",
+			`{"helpful":false}`,
+			http.StatusOK,
+			`{"ratingId":5,"userId":7,"helpful":false,"createdAt":"2020-01-02T03:04:05Z"}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Rating, error) {
+					assert.Equal(t, int64(5), id)
+					return models.Rating{ID: id, UserID: 3}, nil
+				}
+				reps.ReactFunc = func(x *models.Reaction) error {
+					assert.Equal(t, models.Reaction{RatingID: 5, UserID: 7}, *x)
+					x.CreatedAt = decided
+					return nil
+				}
+			},
+		},
+		{
+			"unreact",
+			"DELETE",
+			"/api/v1/ratings/5/reaction",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				reps.UnreactFunc = func(ratingID, userID int64) error {
+					assert.Equal(t, []int64{5, 7}, []int64{ratingID, userID})
+					return nil
+				}
+			},
+		},
+		{
+			"moderateInvalid",
+			"PUT",
+			"/api/v1/ratings/5/moderation",
+			`{"outcome":"hidden"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"outcome":"invalid"}}`,
+			func(t *testing.T) {
+				reps.ModerateFunc = func(m *models.Moderation) error {
+					return models.ValidationError{"outcome": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"moderate",
+			"PUT",
+			"/api/v1/ratings/5/moderation",
+			`{"outcome":"removed","moderatorId":99}`,
+			http.StatusOK,
+			`{"ratingId":5,"userId":3,"outcome":"removed","moderatorId":7,"decidedAt":"2020-01-02T03:04:05Z"}`,
+			func(t *testing.T) {
+				reps.ModerateFunc = func(m *models.Moderation) error {
+					assert.Equal(t, models.Moderation{RatingID: 5, Outcome: models.ModerationRemoved, ModeratorID: 7}, *m)
+					m.UserID = 3
+					m.DecidedAt = decided
+					return nil
+				}
+			},
+		},
+		{
+			"held",
+			"GET",
+			"/api/v1/moderation/ratings",
+			"",
+			http.StatusOK,
+			`{"items":[{"id":5,"active":true,"anonymous":false,"date":1577934245,"extra":{},"score":2,"target":9,"userId":3}]}`,
+			func(t *testing.T) {
+				reps.HeldFunc = func() ([]models.Rating, error) {
+					return []models.Rating{{ID: 5, Active: true, Date: 1577934245, Extra: []byte(`{}`), Score: 2, Target: 9, UserID: 3}}, nil
+				}
+			},
+		},
+		{
+			"heldError",
+			"GET",
+			"/api/v1/moderation/ratings",
+			"",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				reps.HeldFunc = func() ([]models.Rating, error) {
+					return nil, errors.New("boom")
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			req, _ := http.NewRequest(cs.method, cs.path, bytes.NewBufferString(cs.body))
+			req.Header.Add("Accept", "application/json")
+			req.Header.Add("Content-Type", "application/json")
+
+			w := serveCase(t, mux, req, cs.setup, rs)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			if cs.outJSON == "" {
+				assert.Empty(t, w.Body.String())
+			} else {
+				assert.JSONEq(t, cs.outJSON, w.Body.String())
+			}
+
+			*reps = modelstest.ReputationService{}
+			*rs = modelstest.RatingService{}
+		})
+	}
+}
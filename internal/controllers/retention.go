@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Retention implements a controller for the retention policy of the ratings.
+type Retention struct {
+	rs models.RetentionService
+
+	viewErr views.Error
+}
+
+// NewRetention creates a new Retention controller.
+func NewRetention(rs models.RetentionService) *Retention {
+	return &Retention{
+		rs: rs,
+	}
+}
+
+// Show returns the retention policy of the ratings, and the latest ratings it
+// changed, newest first.
+//
+// GET /api/v1/admin/retention
+func (rc *Retention) Show(c *gin.Context) {
+	entries, err := rc.rs.Log()
+	if err != nil {
+		rc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": rc.rs.Policy(), "items": entries})
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention_Show(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RetentionService{
+		PolicyFunc: func() models.RetentionPolicy {
+			return models.RetentionPolicy{Days: 90, Mode: models.RetentionAnonymise}
+		},
+	}
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/retention", NewRetention(rs).Show)
+
+	var cases = []struct {
+		name    string
+		outcode int
+		outbody string
+		setup   func()
+	}{
+		{
+			"ok",
+			http.StatusOK,
+			`{"policy":{"days":90,"mode":"anonymise"},"items":[{"id":2,"ratingId":7,"userId":45,"target":6345,` +
+				`"mode":"anonymise","days":90,"scrubbedAt":"2020-01-02T03:04:05Z"}]}`,
+			func() {
+				rs.LogFunc = func() ([]models.RetentionEntry, error) {
+					return []models.RetentionEntry{{ID: 2, RatingID: 7, UserID: 45, Target: 6345, Mode: models.RetentionAnonymise,
+						Days: 90, ScrubbedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}}, nil
+				}
+			},
+		},
+		{
+			"empty",
+			http.StatusOK,
+			`{"policy":{"days":90,"mode":"anonymise"},"items":[]}`,
+			func() {
+				rs.LogFunc = func() ([]models.RetentionEntry, error) {
+					return []models.RetentionEntry{}, nil
+				}
+			},
+		},
+		{
+			"error",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func() {
+				rs.LogFunc = func() ([]models.RetentionEntry, error) {
+					return nil, privateError("test error message")
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setup()
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/admin/retention", nil)
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.outcode, w.Code)
+			assert.JSONEq(t, tc.outbody, w.Body.String())
+		})
+	}
+}
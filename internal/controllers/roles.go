@@ -11,6 +11,7 @@ import (
 // Roles implements a controller for role management.
 type Roles struct {
 	rs models.RoleService
+	us models.UserService
 
 	viewErr views.Error
 }
@@ -23,6 +24,9 @@ func NewRoles(rs models.RoleService) *Roles {
 	ev.SetCode(models.ErrReadOnly, http.StatusConflict)
 	ev.SetCode(ErrNotFound, http.StatusNotFound)
 	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrConflict, http.StatusPreconditionFailed)
+	ev.SetCode(ErrPreconditionRequired, http.StatusPreconditionRequired)
+	ev.SetCode(ErrWeakETag, http.StatusPreconditionFailed)
 
 	return &Roles{
 		rs:      rs,
@@ -30,6 +34,22 @@ func NewRoles(rs models.RoleService) *Roles {
 	}
 }
 
+// WithUsers sets the service of the users, which Preview reports the changes of, and returns r.
+// Preview is not found without it.
+func (r *Roles) WithUsers(us models.UserService) *Roles {
+	r.us = us
+	return r
+}
+
+// Permissions returns all the permissions that can be given to the roles, with what they allow.
+//
+// GET /api/v1/permissions
+func (r *Roles) Permissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"items": models.AllPermissions(),
+	})
+}
+
 // Create performs the addition of a role.
 //
 // POST /api/v1/roles/
@@ -48,6 +68,7 @@ func (r *Roles) Create(c *gin.Context) {
 		return
 	}
 
+	setETag(c, role.Version)
 	c.JSON(http.StatusCreated, &role)
 }
 
@@ -61,6 +82,12 @@ func (r *Roles) Update(c *gin.Context) {
 		return
 	}
 
+	version, err := getIfMatch(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
 	var role = models.NewRole()
 
 	err = parseJSON(c, &role)
@@ -69,6 +96,7 @@ func (r *Roles) Update(c *gin.Context) {
 		return
 	}
 	role.ID = id
+	role.Version = version
 
 	err = r.rs.Update(&role)
 	if err != nil {
@@ -76,6 +104,42 @@ func (r *Roles) Update(c *gin.Context) {
 		return
 	}
 
+	setETag(c, role.Version)
+	c.JSON(http.StatusOK, &role)
+}
+
+// Patch performs the change of the fields of a role present in the request, a JSON Merge Patch
+// document.
+//
+// PATCH /api/v1/roles/:id
+func (r *Roles) Patch(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	version, err := getIfMatch(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	patch, err := parsePatch(c, &models.Role{})
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	role := models.Role{ID: id, Version: version}
+
+	err = r.rs.UpdatePartial(&role, patch)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, role.Version)
 	c.JSON(http.StatusOK, &role)
 }
 
@@ -114,6 +178,7 @@ func (r *Roles) Get(c *gin.Context) {
 		return
 	}
 
+	setETag(c, role.Version)
 	c.JSON(http.StatusOK, &role)
 }
 
@@ -146,3 +211,179 @@ func (r *Roles) List(c *gin.Context) {
 		"items": roles,
 	})
 }
+
+// Clone creates a role with the permissions of an existing one, and the label of the request.
+//
+// POST /api/v1/roles/:id/clone
+func (r *Roles) Clone(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var input struct {
+		Label string `json:"label"`
+	}
+
+	err = parseJSON(c, &input)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	src, err := r.rs.ByID(id)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	role := src.Clone(input.Label)
+
+	err = r.rs.Create(&role)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, role.Version)
+	c.JSON(http.StatusCreated, &role)
+}
+
+// Preview reports the users who would gain or lose permissions if a role was given the permissions
+// of the request, without changing it.
+//
+// POST /api/v1/roles/:id/preview
+func (r *Roles) Preview(c *gin.Context) {
+	if r.us == nil {
+		r.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var input struct {
+		Permissions *models.Permissions `json:"permissions"`
+	}
+
+	err = parseJSON(c, &input)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+	if input.Permissions == nil {
+		r.viewErr.JSON(c, models.ValidationError{"permissions": models.ErrRequired})
+		return
+	}
+
+	role, err := r.rs.ByID(id)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	active, roles := true, false
+	users, err := r.us.Search(models.SearchQuery{RoleID: id, Active: &active, Roles: &roles})
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	change, err := models.PreviewRoleChange(role, *input.Permissions, users)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &change)
+}
+
+// Assign gives a role to the users of the request at once, in a single transaction, and returns
+// the result for each of them, sorted by ID. The users that could not be given the role are
+// reported without failing the others.
+//
+// POST /api/v1/roles/:id/assign
+func (r *Roles) Assign(c *gin.Context) {
+	if r.us == nil {
+		r.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	var input struct {
+		UserIDs []int64 `json:"userIds"`
+	}
+
+	err = parseJSON(c, &input)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	results, err := r.us.AssignRole(id, input.UserIDs...)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": results,
+	})
+}
+
+// Users returns the users of a role, without their role, which may be searched as the users are.
+//
+// GET /api/v1/roles/:id/users?q=rick&active=true&sort=email
+func (r *Roles) Users(c *gin.Context) {
+	if r.us == nil {
+		r.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	q, err := getUserSearchQuery(c)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+	if q == nil {
+		q = &models.SearchQuery{}
+	}
+
+	_, err = r.rs.ByID(id)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	roles := false
+	q.RoleID, q.Roles = id, &roles
+
+	users, err := r.us.Search(*q)
+	if err != nil {
+		r.viewErr.JSON(c, err)
+		return
+	}
+
+	if users == nil {
+		users = []models.User{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": users,
+	})
+}
@@ -8,61 +8,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
 	"github.com/stretchr/testify/assert"
 )
 
-type testRoleService struct {
-	models.RoleService
-	create func(*models.Role) error
-	update func(*models.Role) error
-	delete func(int64) error
-	byID   func(int64) (models.Role, error)
-	byIDs  func(...int64) ([]models.Role, error)
-}
-
-func (t *testRoleService) Create(mr *models.Role) error {
-	if t.create != nil {
-		return t.create(mr)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRoleService) Update(mr *models.Role) error {
-	if t.update != nil {
-		return t.update(mr)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRoleService) Delete(id int64) error {
-	if t.delete != nil {
-		return t.delete(id)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRoleService) ByID(id int64) (models.Role, error) {
-	if t.byID != nil {
-		return t.byID(id)
-	}
-
-	panic("not provided")
-}
-
-func (t *testRoleService) ByIDs(id ...int64) ([]models.Role, error) {
-	if t.byIDs != nil {
-		return t.byIDs(id...)
-	}
-
-	panic("not provided")
-}
-
 func TestRoles_Create(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRoleService{}
+	rs := &modelstest.RoleService{}
 	r := NewRoles(rs)
 
 	mux := gin.New()
@@ -104,7 +56,7 @@ func TestRoles_Create(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.create = func(mr *models.Role) error {
+				rs.CreateFunc = func(mr *models.Role) error {
 					return privateError("test error message")
 				}
 			},
@@ -120,7 +72,7 @@ func TestRoles_Create(t *testing.T) {
 			http.StatusBadRequest,
 			`{"error":"validation_error","fields":{"label":"too_short"}}`,
 			func(t *testing.T) {
-				rs.create = func(r *models.Role) error {
+				rs.CreateFunc = func(r *models.Role) error {
 					role := models.NewRole()
 					role.Label = "tes"
 					role.Permissions = models.PermissionReadRatings
@@ -143,7 +95,7 @@ func TestRoles_Create(t *testing.T) {
 			http.StatusConflict,
 			`{"error":"validation_error","fields":{"label":"is_duplicate"}}`,
 			func(t *testing.T) {
-				rs.create = func(r *models.Role) error {
+				rs.CreateFunc = func(r *models.Role) error {
 					role := models.NewRole()
 					role.Label = "testlabel"
 					role.Permissions = models.PermissionReadRatings
@@ -174,7 +126,7 @@ func TestRoles_Create(t *testing.T) {
 				]
 			}`,
 			func(t *testing.T) {
-				rs.create = func(mr *models.Role) error {
+				rs.CreateFunc = func(mr *models.Role) error {
 					mr.ID = 99
 					return nil
 				}
@@ -202,14 +154,14 @@ func TestRoles_Create(t *testing.T) {
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*rs = testRoleService{}
+			*rs = modelstest.RoleService{}
 		})
 	}
 }
 
 func TestRoles_Update(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRoleService{}
+	rs := &modelstest.RoleService{}
 	u := NewRoles(rs)
 
 	mux := gin.New()
@@ -218,6 +170,7 @@ func TestRoles_Update(t *testing.T) {
 	var cases = []struct {
 		name      string
 		path      string
+		ifMatch   string
 		input     string
 		outStatus int
 		outJSON   string
@@ -226,6 +179,7 @@ func TestRoles_Update(t *testing.T) {
 		{
 			"badPathID",
 			"/api/v1/roles/lksdjflk",
+			`"3"`,
 			"",
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
@@ -234,6 +188,7 @@ func TestRoles_Update(t *testing.T) {
 		{
 			"notJSON",
 			"/api/v1/roles/99",
+			`"3"`,
 			"a dalhd lkald fkjahd lfkjasdlf ",
 			http.StatusBadRequest,
 			`{"error":"invalid_json"}`,
@@ -242,13 +197,15 @@ func TestRoles_Update(t *testing.T) {
 		{
 			"notFound",
 			"/api/v1/roles/99",
+			`"3"`,
 			`{"label":"atest","permissions":[]}`,
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				rs.update = func(r *models.Role) error {
+				rs.UpdateFunc = func(r *models.Role) error {
 					role := models.NewRole()
 					role.ID = 99
+					role.Version = 3
 					role.Label = "atest"
 
 					assert.Equal(t, &role, r)
@@ -259,13 +216,15 @@ func TestRoles_Update(t *testing.T) {
 		{
 			"validationError",
 			"/api/v1/roles/99",
+			`"3"`,
 			`{"label":"atest","permissions":["readRatings"]}`,
 			http.StatusBadRequest,
 			`{"error":"validation_error","fields":{"label":"too_short"}}`,
 			func(t *testing.T) {
-				rs.update = func(r *models.Role) error {
+				rs.UpdateFunc = func(r *models.Role) error {
 					role := models.NewRole()
 					role.ID = 99
+					role.Version = 3
 					role.Label = "atest"
 					role.Permissions = models.PermissionReadRatings
 
@@ -279,13 +238,15 @@ func TestRoles_Update(t *testing.T) {
 		{
 			"labelTaken",
 			"/api/v1/roles/99",
+			`"3"`,
 			`{"label":"admin","permissions":["readRatings"]}`,
 			http.StatusConflict,
 			`{"error":"validation_error","fields":{"label":"is_duplicate"}}`,
 			func(t *testing.T) {
-				rs.update = func(r *models.Role) error {
+				rs.UpdateFunc = func(r *models.Role) error {
 					role := models.NewRole()
 					role.ID = 99
+					role.Version = 3
 					role.Label = "admin"
 					role.Permissions = models.PermissionReadRatings
 
@@ -299,21 +260,47 @@ func TestRoles_Update(t *testing.T) {
 		{
 			"ok",
 			"/api/v1/roles/99",
+			`"3"`,
 			`{"label":"atest","permissions":["readRatings"]}`,
 			http.StatusOK,
 			`{"id": 99, "label":"atest","permissions":["readRatings"]}`,
 			func(t *testing.T) {
-				rs.update = func(r *models.Role) error {
+				rs.UpdateFunc = func(r *models.Role) error {
 					assert.Equal(t, &models.Role{
 						ID:          99,
 						Label:       "atest",
 						Permissions: models.PermissionReadRatings,
+						Version:     3,
 					}, r)
 
+					r.Version = 4
 					return nil
 				}
 			},
 		},
+		{
+			"missingIfMatch",
+			"/api/v1/roles/99",
+			"",
+			`{"label":"atest","permissions":["readRatings"]}`,
+			http.StatusPreconditionRequired,
+			`{"error":"precondition_required"}`,
+			nil,
+		},
+		{
+			"staleVersion",
+			"/api/v1/roles/99",
+			`"3"`,
+			`{"label":"atest","permissions":["readRatings"]}`,
+			http.StatusPreconditionFailed,
+			`{"error":"conflict"}`,
+			func(t *testing.T) {
+				rs.UpdateFunc = func(r *models.Role) error {
+					assert.Equal(t, int64(3), r.Version)
+					return models.ErrConflict
+				}
+			},
+		},
 	}
 
 	for _, cs := range cases {
@@ -324,6 +311,9 @@ func TestRoles_Update(t *testing.T) {
 				bytes.NewReader([]byte(cs.input)))
 			c.Request.Header.Add("Accept", "application/json")
 			c.Request.Header.Add("Content-Type", "application/json")
+			if cs.ifMatch != "" {
+				c.Request.Header.Add("If-Match", cs.ifMatch)
+			}
 
 			if cs.setup != nil {
 				cs.setup(t)
@@ -335,15 +325,121 @@ func TestRoles_Update(t *testing.T) {
 			assert.Equal(t, cs.outStatus, res.StatusCode)
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			if cs.outStatus == http.StatusOK {
+				assert.Equal(t, `"4"`, res.Header.Get("ETag"))
+			}
 
-			*rs = testRoleService{}
+			*rs = modelstest.RoleService{}
+		})
+	}
+}
+
+func TestRoles_Patch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RoleService{}
+	r := NewRoles(rs)
+
+	mux := gin.New()
+	mux.PATCH("/api/v1/roles/:id", r.Patch)
+
+	var cases = []struct {
+		name      string
+		path      string
+		ifMatch   string
+		input     string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"missingIfMatch",
+			"/api/v1/roles/99",
+			"",
+			`{"label":"atest"}`,
+			http.StatusPreconditionRequired,
+			`{"error":"precondition_required"}`,
+			nil,
+		},
+		{
+			"badFieldType",
+			"/api/v1/roles/99",
+			`"3"`,
+			`{"permissions":"readRatings"}`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"readOnly",
+			"/api/v1/roles/1",
+			`"3"`,
+			`{"label":"atest"}`,
+			http.StatusConflict,
+			`{"error":"read_only"}`,
+			func(t *testing.T) {
+				rs.UpdatePartialFunc = func(r *models.Role, patch []byte) error {
+					return models.ErrReadOnly
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/roles/99",
+			`"3"`,
+			`{"permissions":["readRatings"]}`,
+			http.StatusOK,
+			`{"id":99,"label":"atest","permissions":["readRatings"]}`,
+			func(t *testing.T) {
+				rs.UpdatePartialFunc = func(r *models.Role, patch []byte) error {
+					assert.Equal(t, &models.Role{ID: 99, Version: 3}, r)
+					assert.JSONEq(t, `{"permissions":["readRatings"]}`, string(patch))
+
+					*r = models.Role{
+						ID:          99,
+						Label:       "atest",
+						Permissions: models.PermissionReadRatings,
+						Version:     4,
+					}
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("PATCH", cs.path,
+				bytes.NewReader([]byte(cs.input)))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+			if cs.ifMatch != "" {
+				c.Request.Header.Add("If-Match", cs.ifMatch)
+			}
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			if cs.outStatus == http.StatusOK {
+				assert.Equal(t, `"4"`, res.Header.Get("ETag"))
+			}
+
+			*rs = modelstest.RoleService{}
 		})
 	}
 }
 
 func TestRoles_Delete(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRoleService{}
+	rs := &modelstest.RoleService{}
 	r := NewRoles(rs)
 
 	mux := gin.New()
@@ -369,7 +465,7 @@ func TestRoles_Delete(t *testing.T) {
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				rs.delete = func(id int64) error {
+				rs.DeleteFunc = func(id int64) error {
 					assert.Equal(t, int64(999), id)
 					return models.ErrNotFound
 				}
@@ -381,7 +477,7 @@ func TestRoles_Delete(t *testing.T) {
 			http.StatusConflict,
 			`{"error":"read_only"}`,
 			func(t *testing.T) {
-				rs.delete = func(id int64) error {
+				rs.DeleteFunc = func(id int64) error {
 					assert.Equal(t, int64(999), id)
 					return models.ErrReadOnly
 				}
@@ -393,7 +489,7 @@ func TestRoles_Delete(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.delete = func(id int64) error {
+				rs.DeleteFunc = func(id int64) error {
 					assert.Equal(t, int64(999), id)
 					return wrap("test internal error", nil)
 				}
@@ -405,7 +501,7 @@ func TestRoles_Delete(t *testing.T) {
 			http.StatusNoContent,
 			`{}`,
 			func(t *testing.T) {
-				rs.delete = func(id int64) error {
+				rs.DeleteFunc = func(id int64) error {
 					assert.Equal(t, int64(999), id)
 					return nil
 				}
@@ -436,14 +532,14 @@ func TestRoles_Delete(t *testing.T) {
 				assert.Equal(t, "", w.Body.String())
 			}
 
-			*rs = testRoleService{}
+			*rs = modelstest.RoleService{}
 		})
 	}
 }
 
 func TestRoles_Get(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRoleService{}
+	rs := &modelstest.RoleService{}
 	r := NewRoles(rs)
 
 	mux := gin.New()
@@ -469,7 +565,7 @@ func TestRoles_Get(t *testing.T) {
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				rs.byID = func(id int64) (models.Role, error) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
 					assert.Equal(t, int64(999), id)
 					return models.Role{}, models.ErrNotFound
 				}
@@ -481,7 +577,7 @@ func TestRoles_Get(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.byID = func(id int64) (models.Role, error) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
 					assert.Equal(t, int64(999), id)
 					return models.Role{}, wrap("test internal error", nil)
 				}
@@ -497,7 +593,7 @@ func TestRoles_Get(t *testing.T) {
 				"permissions":["readUsers", "writeUsers", "readRatings"]
 			}`,
 			func(t *testing.T) {
-				rs.byID = func(id int64) (models.Role, error) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
 					return models.Role{
 						ID:          2,
 						Label:       "user",
@@ -526,14 +622,14 @@ func TestRoles_Get(t *testing.T) {
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*rs = testRoleService{}
+			*rs = modelstest.RoleService{}
 		})
 	}
 }
 
 func TestRoles_List(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	rs := &testRoleService{}
+	rs := &modelstest.RoleService{}
 	r := NewRoles(rs)
 
 	mux := gin.New()
@@ -566,7 +662,7 @@ func TestRoles_List(t *testing.T) {
 			http.StatusOK,
 			`{"items":[]}`,
 			func(t *testing.T) {
-				rs.byIDs = func(id ...int64) ([]models.Role, error) {
+				rs.ByIDsFunc = func(id ...int64) ([]models.Role, error) {
 					assert.Equal(t, []int64{999, 1000}, id)
 					return nil, nil
 				}
@@ -578,7 +674,7 @@ func TestRoles_List(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				rs.byIDs = func(id ...int64) ([]models.Role, error) {
+				rs.ByIDsFunc = func(id ...int64) ([]models.Role, error) {
 					assert.Equal(t, []int64{999}, id)
 					return nil, wrap("test internal error", nil)
 				}
@@ -602,7 +698,7 @@ func TestRoles_List(t *testing.T) {
 				}]
 			}`,
 			func(t *testing.T) {
-				rs.byIDs = func(id ...int64) ([]models.Role, error) {
+				rs.ByIDsFunc = func(id ...int64) ([]models.Role, error) {
 					assert.Equal(t, []int64{1, 2}, id)
 					return []models.Role{
 							models.Role{
@@ -638,7 +734,7 @@ func TestRoles_List(t *testing.T) {
 				}]
 			}`,
 			func(t *testing.T) {
-				rs.byIDs = func(id ...int64) ([]models.Role, error) {
+				rs.ByIDsFunc = func(id ...int64) ([]models.Role, error) {
 					assert.Len(t, id, 0)
 					return []models.Role{
 							models.Role{
@@ -676,7 +772,336 @@ func TestRoles_List(t *testing.T) {
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*rs = testRoleService{}
+			*rs = modelstest.RoleService{}
 		})
 	}
 }
+
+func TestRoles_Permissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mux := gin.New()
+	mux.GET("/api/v1/permissions", NewRoles(&modelstest.RoleService{}).Permissions)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/permissions", nil)
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items":[
+		{"name":"readUsers","description":"Read and list the users and roles."},
+		{"name":"writeUsers","description":"Create, modify and delete the users and roles, and invite users."},
+		{"name":"readRatings","description":"Read and list any rating."},
+		{"name":"writeRatings","description":"Create ratings, and modify and delete any rating, as moderators do."},
+		{"name":"writeOwnRatings","description":"Create ratings, and modify and delete the ones of the user."}
+	]}`, w.Body.String())
+}
+
+func TestRoles_CloneAndPreview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RoleService{}
+	us := &modelstest.UserService{}
+	r := NewRoles(rs).WithUsers(us)
+
+	editor := models.Role{ID: 7, Label: "editor", Permissions: models.PermissionReadRatings | models.PermissionWriteRatings, Version: 2}
+
+	mux := gin.New()
+	mux.POST("/api/v1/roles/:id/clone", r.Clone)
+	mux.POST("/api/v1/roles/:id/preview", r.Preview)
+
+	var cases = []struct {
+		name      string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"cloneNotFound",
+			"/api/v1/roles/9/clone",
+			`{"label":"copy"}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					return models.Role{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"cloneLabelTaken",
+			"/api/v1/roles/7/clone",
+			`{"label":"editor"}`,
+			http.StatusConflict,
+			`{"error":"validation_error","fields":{"label":"is_duplicate"}}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					return editor, nil
+				}
+				rs.CreateFunc = func(r *models.Role) error {
+					return models.ValidationError{"label": models.ErrDuplicate}
+				}
+			},
+		},
+		{
+			"clone",
+			"/api/v1/roles/7/clone",
+			`{"label":"reviewer"}`,
+			http.StatusCreated,
+			`{"id":8,"label":"reviewer","permissions":["readRatings","writeRatings"]}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					assert.Equal(t, int64(7), id)
+					return editor, nil
+				}
+				rs.CreateFunc = func(r *models.Role) error {
+					assert.Equal(t, &models.Role{Label: "reviewer", Permissions: editor.Permissions}, r)
+					r.ID, r.Version = 8, 1
+					return nil
+				}
+			},
+		},
+		{
+			"previewMissingPermissions",
+			"/api/v1/roles/7/preview",
+			`{}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"permissions":"required"}}`,
+			nil,
+		},
+		{
+			"previewUnknownPermission",
+			"/api/v1/roles/7/preview",
+			`{"permissions":["flyPlanes"]}`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"previewDefaultRole",
+			"/api/v1/roles/2/preview",
+			`{"permissions":["readRatings"]}`,
+			http.StatusConflict,
+			`{"error":"read_only"}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					return models.Role{ID: 2, Label: "user", Permissions: models.PermissionReadRatings}, nil
+				}
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					return nil, nil
+				}
+			},
+		},
+		{
+			"preview",
+			"/api/v1/roles/7/preview",
+			`{"permissions":["readUsers","readRatings"]}`,
+			http.StatusOK,
+			`{"roleId":7,"gained":["readUsers"],"lost":["writeRatings"],"users":[
+				{"userId":3,"email":"editor@test.com","active":true,"roleId":7,"role":"editor","admin":false,"permissions":["readUsers","readRatings"]}
+			]}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					return editor, nil
+				}
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					assert.Equal(t, int64(7), q.RoleID)
+					assert.True(t, *q.Active)
+					return []models.User{{ID: 3, Active: true, Email: "editor@test.com", RoleID: 7}}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", cs.path, bytes.NewBufferString(cs.body))
+			req.Header.Add("Content-Type", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RoleService{}
+			*us = modelstest.UserService{}
+		})
+	}
+
+	t.Run("previewWithoutUsers", func(t *testing.T) {
+		mux := gin.New()
+		mux.POST("/api/v1/roles/:id/preview", NewRoles(rs).Preview)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/roles/7/preview", bytes.NewBufferString(`{"permissions":[]}`))
+		mux.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRoles_AssignAndUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rs := &modelstest.RoleService{}
+	us := &modelstest.UserService{}
+	r := NewRoles(rs).WithUsers(us)
+
+	mux := gin.New()
+	mux.POST("/api/v1/roles/:id/assign", r.Assign)
+	mux.GET("/api/v1/roles/:id/users", r.Users)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"assignBadID",
+			"POST",
+			"/api/v1/roles/abc/assign",
+			`{"userIds":[3]}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"assignRoleNotFound",
+			"POST",
+			"/api/v1/roles/9/assign",
+			`{"userIds":[3]}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				us.AssignRoleFunc = func(roleID int64, ids ...int64) ([]models.RoleAssignment, error) {
+					return nil, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"assignNoUsers",
+			"POST",
+			"/api/v1/roles/7/assign",
+			`{"userIds":[]}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"userIds":"required"}}`,
+			func(t *testing.T) {
+				us.AssignRoleFunc = func(roleID int64, ids ...int64) ([]models.RoleAssignment, error) {
+					return nil, models.ValidationError{"userIds": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"assign",
+			"POST",
+			"/api/v1/roles/7/assign",
+			`{"userIds":[3,1,4,5]}`,
+			http.StatusOK,
+			`{"items":[
+				{"userId":1,"status":"failed","error":"read_only"},
+				{"userId":3,"status":"assigned"},
+				{"userId":4,"status":"unchanged"},
+				{"userId":5,"status":"failed","error":"not_found"}
+			]}`,
+			func(t *testing.T) {
+				us.AssignRoleFunc = func(roleID int64, ids ...int64) ([]models.RoleAssignment, error) {
+					assert.Equal(t, int64(7), roleID)
+					assert.Equal(t, []int64{3, 1, 4, 5}, ids)
+					return []models.RoleAssignment{
+						{UserID: 1, Status: models.AssignmentFailed, Error: "read_only"},
+						{UserID: 3, Status: models.AssignmentAssigned},
+						{UserID: 4, Status: models.AssignmentUnchanged},
+						{UserID: 5, Status: models.AssignmentFailed, Error: "not_found"},
+					}, nil
+				}
+			},
+		},
+		{
+			"usersRoleNotFound",
+			"GET",
+			"/api/v1/roles/9/users",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					return models.Role{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"usersEmpty",
+			"GET",
+			"/api/v1/roles/7/users",
+			"",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					return models.Role{ID: 7, Label: "editor"}, nil
+				}
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					return nil, nil
+				}
+			},
+		},
+		{
+			"users",
+			"GET",
+			"/api/v1/roles/7/users?q=rick&roleId=2",
+			"",
+			http.StatusOK,
+			`{"items":[{"id":3,"active":true,"email":"rick@sanchez.com","firstName":"Rick","lastName":"","roleId":7}]}`,
+			func(t *testing.T) {
+				rs.ByIDFunc = func(id int64) (models.Role, error) {
+					return models.Role{ID: 7, Label: "editor"}, nil
+				}
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					assert.Equal(t, "rick", q.Q)
+					assert.Equal(t, int64(7), q.RoleID)
+					assert.False(t, *q.Roles)
+					return []models.User{{ID: 3, Active: true, Email: "rick@sanchez.com", FirstName: "Rick", RoleID: 7}}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(cs.method, cs.path, bytes.NewBufferString(cs.body))
+			req.Header.Add("Content-Type", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*rs = modelstest.RoleService{}
+			*us = modelstest.UserService{}
+		})
+	}
+
+	t.Run("withoutUsers", func(t *testing.T) {
+		mux := gin.New()
+		mux.POST("/api/v1/roles/:id/assign", NewRoles(rs).Assign)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/roles/7/assign", bytes.NewBufferString(`{"userIds":[3]}`))
+		mux.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -1,15 +1,32 @@
 package controllers
 
 import (
+	"bytes"
+	"hash/fnv"
+	"io/fs"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/noelruault/ratingsapp/internal/views"
 )
 
+// staticIndex is the page of the frontend served for the paths that are not files, so it
+// routes them itself, as single page applications routing with the history API do.
+const staticIndex = "index.html"
+
+// staticAssets is the directory of the assets of the frontend, whose names change with their
+// contents, so they are cached for good.
+const staticAssets = "assets/"
+
 // The Static controller provides HTTP handlers for all static page serving needs of the
 // application.
 type Static struct {
+	files fs.FS
+
 	viewErr views.Error
 }
 
@@ -23,21 +40,78 @@ func NewStatic() *Static {
 	}
 }
 
-// NotFound either redirects to a Not Found error page or returns a JSON message and status code
-// for routes that could not be resolved.
+// WithFiles sets the files of the frontend served, and returns s. Its index.html page is served
+// on the root route, and for the routes that could not be resolved. Without it, only Not Found
+// errors are returned.
+func (s *Static) WithFiles(files fs.FS) *Static {
+	s.files = files
+	return s
+}
+
+// NotFound either serves the frontend or returns a JSON message and status code for routes that
+// could not be resolved.
 //
-// If a request has an "Accept" header that contains "application/json", then the JSON message will
-// be returned.
+// The frontend is served, if set, to the GET and HEAD requests outside of the API that do not
+// prefer JSON: the file of their path if it exists, and index.html otherwise, unless their path
+// has an extension, as missing files do. The files of the assets directory are cached for good,
+// and the others revalidated with their ETag.
 func (s *Static) NotFound(c *gin.Context) {
-	// TODO: when working on serving the UI, this needs to decide between
-	// returning JSON and returning a UI message.
+	if s.files == nil || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) ||
+		strings.HasPrefix(c.Request.URL.Path, "/api/") ||
+		c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		s.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(c.Request.URL.Path), "/")
+	if name == "" {
+		name = staticIndex
+	}
 
-	s.viewErr.JSON(c, ErrNotFound)
+	data, err := fs.ReadFile(s.files, name)
+	if err != nil && path.Ext(name) == "" {
+		name = staticIndex
+		data, err = fs.ReadFile(s.files, name)
+	}
+	if err != nil {
+		s.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	s.serve(c, name, data)
 }
 
-// Home redirects a user to the main UI page from the root route.
+// Home serves the index.html page of the frontend, if set, from the root route.
 //
 // GET /
 func (s *Static) Home(c *gin.Context) {
-	// TODO: this needs to be implemented, the home page
+	if s.files == nil {
+		s.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	data, err := fs.ReadFile(s.files, staticIndex)
+	if err != nil {
+		s.viewErr.JSON(c, err)
+		return
+	}
+
+	s.serve(c, staticIndex, data)
+}
+
+// serve serves the file name of the frontend, with data as contents, along with its cache
+// headers.
+func (s *Static) serve(c *gin.Context, name string, data []byte) {
+	if strings.HasPrefix(name, staticAssets) {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		h := fnv.New64a()
+		h.Write(data)
+		c.Header("Cache-Control", "no-cache")
+		c.Header("ETag", `"`+strconv.FormatUint(h.Sum64(), 36)+`"`)
+	}
+
+	// the embedded files have no modification time, and ServeContent answers the
+	// conditional requests with the ETag
+	http.ServeContent(c.Writer, c.Request, name, time.Time{}, bytes.NewReader(data))
 }
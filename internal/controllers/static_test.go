@@ -4,9 +4,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"testing/fstest"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStatic_NotFound(t *testing.T) {
@@ -27,6 +29,73 @@ func TestStatic_NotFound(t *testing.T) {
 	})
 }
 
+func TestStatic_Files(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	files := fstest.MapFS{
+		"index.html":           {Data: []byte("<!DOCTYPE html><title>RatingsApp</title>")},
+		"favicon.ico":          {Data: []byte("icon")},
+		"assets/app.3f9a1c.js": {Data: []byte("console.log('ratings')")},
+	}
+	sc := NewStatic().WithFiles(files)
+
+	mux := gin.New()
+	mux.GET("/", sc.Home)
+	mux.GET("/api/v1/ratings/", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"items": []int{}}) })
+	mux.NoRoute(sc.NotFound)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		accept    string
+		outStatus int
+		outBody   string
+		outCache  string
+	}{
+		{"home", "GET", "/", "text/html", http.StatusOK, "<!DOCTYPE html><title>RatingsApp</title>", "no-cache"},
+		{"file", "GET", "/favicon.ico", "", http.StatusOK, "icon", "no-cache"},
+		{"asset", "GET", "/assets/app.3f9a1c.js", "*/*", http.StatusOK, "console.log('ratings')", "public, max-age=31536000, immutable"},
+		{"history", "GET", "/ratings/999/replies", "text/html,application/xhtml+xml", http.StatusOK, "<!DOCTYPE html><title>RatingsApp</title>", "no-cache"},
+		{"head", "HEAD", "/ratings/999", "text/html", http.StatusOK, "", "no-cache"},
+		{"missingAsset", "GET", "/assets/app.000000.js", "*/*", http.StatusNotFound, `{"error":"not_found"}`, ""},
+		{"api", "GET", "/api/v1/unknown", "text/html", http.StatusNotFound, `{"error":"not_found"}`, ""},
+		{"apiRoute", "GET", "/api/v1/ratings/", "application/json", http.StatusOK, `{"items":[]}`, ""},
+		{"json", "GET", "/ratings/999", "application/json", http.StatusNotFound, `{"error":"not_found"}`, ""},
+		{"post", "POST", "/ratings/999", "text/html", http.StatusNotFound, `{"error":"not_found"}`, ""},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(cs.method, cs.path, nil)
+			if cs.accept != "" {
+				req.Header.Set("Accept", cs.accept)
+			}
+
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.Equal(t, cs.outBody, w.Body.String())
+			assert.Equal(t, cs.outCache, w.Header().Get("Cache-Control"))
+		})
+	}
+
+	t.Run("notModified", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		mux.ServeHTTP(w, req)
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/ratings/999", nil)
+		req.Header.Set("If-None-Match", etag)
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
+}
+
 func TestStatic_Home(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -38,7 +107,5 @@ func TestStatic_Home(t *testing.T) {
 
 	sc.Home(c)
 
-	// TODO: this needs to be implemented
-	t.Skip()
-
+	assert.Equal(t, http.StatusNotFound, w.Code, "must not serve a frontend without its files")
 }
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+const (
+	// defaultHeartbeat is the interval of the comments sent on the idle streams, so the proxies
+	// do not close them, see Streams.WithHeartbeat.
+	defaultHeartbeat = 15 * time.Second
+
+	// streamRetry is the time the clients wait to reconnect once a stream ends, in milliseconds.
+	streamRetry = 3000
+
+	// streamQueueSize is the number of events queued for a client. The stream ends when it is
+	// full, and the client catches up when it reconnects.
+	streamQueueSize = 64
+
+	// maxStreamReplay is the maximum number of ratings sent again to the clients reconnecting.
+	maxStreamReplay = 100
+)
+
+// EventSubscriber is a subset of events.Bus, containing only the method used to receive the
+// events published.
+type EventSubscriber interface {
+	Subscribe(h events.Handler, types ...string) (cancel func())
+}
+
+// Streams implements a controller sending the changes of the application to the clients as they
+// happen, as Server-Sent Events.
+type Streams struct {
+	bus EventSubscriber
+	rs  models.RatingService
+
+	heartbeat time.Duration
+
+	// done is closed by Close to end the streams.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	viewErr views.Error
+}
+
+// NewStreams creates a new Streams controller sending the events of bus. The ratings missed by
+// the clients reconnecting are read from rs.
+func NewStreams(bus EventSubscriber, rs models.RatingService) *Streams {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+
+	return &Streams{
+		bus:       bus,
+		rs:        rs,
+		heartbeat: defaultHeartbeat,
+		done:      make(chan struct{}),
+		viewErr:   ev,
+	}
+}
+
+// WithHeartbeat sets the interval of the comments sent on the idle streams.
+func (s *Streams) WithHeartbeat(d time.Duration) *Streams {
+	s.heartbeat = d
+	return s
+}
+
+// Close ends the streams open, and the ones opened afterwards, so the server can shut down.
+func (s *Streams) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Ratings streams the ratings of a target as they are created and updated, as rating.created
+// and rating.updated events holding the rating. The id of the events is the date of the rating,
+// and the clients reconnecting with the Last-Event-ID header are first sent the ratings dated
+// since then, up to maxStreamReplay, which may include some of the ratings they received
+// already. A comment is sent every heartbeat while no rating changes.
+//
+// The stream ends when the client does not keep up with the ratings, and the client catches up
+// when it reconnects.
+//
+// GET /api/v1/ratings/stream?target=999
+func (s *Streams) Ratings(c *gin.Context) {
+	target, err := getQueryParam(c, "target")
+	if err != nil {
+		s.viewErr.JSON(c, err)
+		return
+	} else if target == 0 {
+		s.viewErr.JSON(c, models.ValidationError{"target": models.ErrRequired})
+		return
+	}
+
+	var replay []models.Rating
+	if id := c.GetHeader("Last-Event-ID"); id != "" {
+		since, err := strconv.ParseInt(id, 10, 64)
+		if err == nil {
+			replay, err = s.rs.Search(models.RatingQuery{Target: target, From: since, Sort: "date", Limit: maxStreamReplay})
+			if err != nil {
+				s.viewErr.JSON(c, err)
+				return
+			}
+		}
+	}
+
+	// the events are queued by the bus, and dropped if the client does
+	// not keep up, which ends the stream
+	var (
+		queue    = make(chan events.Event, streamQueueSize)
+		overflow = make(chan struct{})
+		once     sync.Once
+	)
+	cancel := s.bus.Subscribe(func(e events.Event) {
+		if r, ok := e.Data.(models.Rating); !ok || r.Target != target {
+			return
+		}
+
+		select {
+		case queue <- e:
+		default:
+			once.Do(func() { close(overflow) })
+		}
+	}, events.RatingCreated, events.RatingUpdated)
+	defer cancel()
+
+	// the streams outlive the write timeout of the server
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry)
+
+	for _, r := range replay {
+		typ := events.RatingCreated
+		if r.Version > 1 {
+			typ = events.RatingUpdated
+		}
+		if writeRatingEvent(c, typ, r) != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e := <-queue:
+			if writeRatingEvent(c, e.Type, e.Data.(models.Rating)) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-overflow:
+			return
+		case <-s.done:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+
+		c.Writer.Flush()
+	}
+}
+
+// writeRatingEvent writes the event typ of the rating r to the stream of c.
+func writeRatingEvent(c *gin.Context, typ string, r models.Rating) error {
+	data, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", r.Date, typ, data)
+	return err
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreams_Ratings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bus := events.NewBus(0)
+	defer bus.Close()
+
+	rs := &modelstest.RatingService{}
+	s := NewStreams(bus, rs).WithHeartbeat(50 * time.Millisecond)
+	defer s.Close()
+
+	mux := gin.New()
+	mux.GET("/api/v1/ratings/stream", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 2})
+	}, s.Ratings)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// open returns the lines of the stream of the ratings of target, up to
+	// the blank line following the retry field
+	open := func(t *testing.T, target, lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/v1/ratings/stream?target="+target, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res, bufio.NewReader(res.Body)
+	}
+	// next reads the next message of the stream
+	next := func(t *testing.T, r *bufio.Reader) string {
+		var msg []string
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			if line == "\n" {
+				return strings.Join(msg, "\n")
+			}
+			msg = append(msg, strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	t.Run("badTarget", func(t *testing.T) {
+		res, _ := open(t, "x", "")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("noTarget", func(t *testing.T) {
+		res, _ := open(t, "0", "")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("events", func(t *testing.T) {
+		res, r := open(t, "999", "")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+		assert.Equal(t, "retry: 3000", next(t, r))
+
+		bus.Publish(events.Event{Type: events.RatingCreated, Data: models.Rating{ID: 1, Score: 3, Target: 888, UserID: 1, Date: 100}})
+		bus.Publish(events.Event{Type: events.RatingCreated, Data: models.Rating{ID: 2, Score: 5, Target: 999, UserID: 1, Date: 200}})
+		bus.Publish(events.Event{Type: events.RatingUpdated, Data: models.Rating{ID: 2, Score: 4, Target: 999, UserID: 1, Date: 300}})
+
+		assert.Equal(t, "id: 200\nevent: rating.created\n"+
+			`data: {"id":2,"active":false,"anonymous":false,"date":200,"extra":null,"score":5,"target":999,"userId":1}`, next(t, r))
+		assert.Equal(t, "id: 300\nevent: rating.updated\n"+
+			`data: {"id":2,"active":false,"anonymous":false,"date":300,"extra":null,"score":4,"target":999,"userId":1}`, next(t, r))
+		assert.Equal(t, ": heartbeat", next(t, r))
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		rs.SearchFunc = func(q models.RatingQuery) ([]models.Rating, error) {
+			assert.Equal(t, models.RatingQuery{Target: 999, From: 200, Sort: "date", Limit: maxStreamReplay}, q)
+			return []models.Rating{{ID: 2, Score: 4, Target: 999, UserID: 1, Date: 300, Version: 2}}, nil
+		}
+		defer func() { rs.SearchFunc = nil }()
+
+		res, r := open(t, "999", "200")
+		defer res.Body.Close()
+		assert.Equal(t, "retry: 3000", next(t, r))
+		assert.Equal(t, "id: 300\nevent: rating.updated\n"+
+			`data: {"id":2,"active":false,"anonymous":false,"date":300,"extra":null,"score":4,"target":999,"userId":1}`, next(t, r))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		res, r := open(t, "999", "")
+		defer res.Body.Close()
+		assert.Equal(t, "retry: 3000", next(t, r))
+
+		s.Close()
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				break
+			}
+		}
+	})
+}
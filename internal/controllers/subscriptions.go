@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Subscriptions implements a controller for the targets followed by the users, and the
+// notifications they receive about them.
+type Subscriptions struct {
+	ss models.SubscriptionService
+
+	viewErr views.Error
+}
+
+// NewSubscriptions creates a new Subscriptions controller.
+func NewSubscriptions(ss models.SubscriptionService) *Subscriptions {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+
+	return &Subscriptions{
+		ss:      ss,
+		viewErr: ev,
+	}
+}
+
+// Follow subscribes the requester to the ratings of a target, replacing their previous
+// subscription to it. Without a channel, the notifications are kept in the application, and
+// without thresholds, every new rating is notified.
+//
+// POST /api/v1/targets/:id/follow
+func (sc *Subscriptions) Follow(c *gin.Context) {
+	target, err := getParamInt(c, "id")
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	input := struct {
+		Channel      string   `json:"channel"`
+		WebhookURL   string   `json:"webhookUrl"`
+		NewRatings   *bool    `json:"newRatings"`
+		AverageBelow *float64 `json:"averageBelow"`
+		AverageAbove *float64 `json:"averageAbove"`
+	}{Channel: models.ChannelInApp}
+
+	err = parseJSON(c, &input)
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	sub := models.Subscription{
+		UserID:       middleware.Actor(c).ID,
+		Target:       target,
+		Channel:      input.Channel,
+		WebhookURL:   input.WebhookURL,
+		AverageBelow: input.AverageBelow,
+		AverageAbove: input.AverageAbove,
+	}
+	if input.NewRatings != nil {
+		sub.NewRatings = *input.NewRatings
+	} else {
+		sub.NewRatings = input.AverageBelow == nil && input.AverageAbove == nil
+	}
+
+	err = sc.ss.Follow(&sub)
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &sub)
+}
+
+// Unfollow removes the subscription of the requester to a target.
+//
+// DELETE /api/v1/targets/:id/follow
+func (sc *Subscriptions) Unfollow(c *gin.Context) {
+	target, err := getParamInt(c, "id")
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = sc.ss.Unfollow(middleware.Actor(c).ID, target)
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// List returns the targets followed by a user.
+//
+// GET /api/v1/users/:id/follows
+func (sc *Subscriptions) List(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	subs, err := sc.ss.ByUser(id)
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": subs})
+}
+
+// Notifications returns the latest in-app notifications of a user, newest first.
+//
+// GET /api/v1/users/:id/notifications
+func (sc *Subscriptions) Notifications(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	ns, err := sc.ss.Notifications(id)
+	if err != nil {
+		sc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": ns})
+}
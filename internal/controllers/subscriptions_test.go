@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ss := &modelstest.SubscriptionService{}
+	sc := NewSubscriptions(ss)
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 7, RoleID: 2})
+	})
+	mux.POST("/api/v1/targets/:id/follow", sc.Follow)
+	mux.DELETE("/api/v1/targets/:id/follow", sc.Unfollow)
+	mux.GET("/api/v1/users/:id/follows", sc.List)
+	mux.GET("/api/v1/users/:id/notifications", sc.Notifications)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"followDefaults",
+			"POST",
+			"/api/v1/targets/9/follow",
+			`{}`,
+			http.StatusOK,
+			`{"userId":7,"target":9,"channel":"inApp","newRatings":true,"createdAt":"2020-01-02T03:04:05Z"}`,
+			func(t *testing.T) {
+				ss.FollowFunc = func(s *models.Subscription) error {
+					s.CreatedAt = created
+					return nil
+				}
+			},
+		},
+		{
+			"followThreshold",
+			"POST",
+			"/api/v1/targets/9/follow",
+			`{"channel":"webhook","webhookUrl":"https://hooks.test.com","averageBelow":2.5}`,
+			http.StatusOK,
+			`{"userId":7,"target":9,"channel":"webhook","webhookUrl":"https://hooks.test.com","newRatings":false,` +
+				`"averageBelow":2.5,"createdAt":"2020-01-02T03:04:05Z"}`,
+			func(t *testing.T) {
+				ss.FollowFunc = func(s *models.Subscription) error {
+					s.CreatedAt = created
+					return nil
+				}
+			},
+		},
+		{
+			"followInvalid",
+			"POST",
+			"/api/v1/targets/9/follow",
+			`{"channel":"sms"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"channel":"invalid"}}`,
+			func(t *testing.T) {
+				ss.FollowFunc = func(s *models.Subscription) error {
+					return models.ValidationError{"channel": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"followBadJSON",
+			"POST",
+			"/api/v1/targets/9/follow",
+			`[`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"followBadID",
+			"POST",
+			"/api/v1/targets/abc/follow",
+			`{}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"unfollow",
+			"DELETE",
+			"/api/v1/targets/9/follow",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				ss.UnfollowFunc = func(userID, target int64) error {
+					assert.Equal(t, int64(7), userID)
+					assert.Equal(t, int64(9), target)
+					return nil
+				}
+			},
+		},
+		{
+			"unfollowNotFound",
+			"DELETE",
+			"/api/v1/targets/9/follow",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ss.UnfollowFunc = func(userID, target int64) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"list",
+			"GET",
+			"/api/v1/users/7/follows",
+			"",
+			http.StatusOK,
+			`{"items":[{"userId":7,"target":9,"channel":"email","newRatings":true,"createdAt":"2020-01-02T03:04:05Z"}]}`,
+			func(t *testing.T) {
+				ss.ByUserFunc = func(id int64) ([]models.Subscription, error) {
+					assert.Equal(t, int64(7), id)
+					return []models.Subscription{{UserID: 7, Target: 9, Channel: models.ChannelEmail, NewRatings: true, CreatedAt: created}}, nil
+				}
+			},
+		},
+		{
+			"notifications",
+			"GET",
+			"/api/v1/users/7/notifications",
+			"",
+			http.StatusOK,
+			`{"items":[{"id":3,"userId":7,"kind":"newRating","target":9,"ratingId":12,"score":4,"average":3.5,` +
+				`"createdAt":"2020-01-02T03:04:05Z"}]}`,
+			func(t *testing.T) {
+				ratingID, score := int64(12), 4
+				ss.NotificationsFunc = func(id int64) ([]models.Notification, error) {
+					return []models.Notification{{ID: 3, UserID: 7, Kind: models.NotificationNewRating, Target: 9,
+						RatingID: &ratingID, Score: &score, Average: 3.5, CreatedAt: created}}, nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*ss = modelstest.SubscriptionService{}
+		})
+	}
+}
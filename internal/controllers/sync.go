@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Sync implements a controller that lets clients fetch the changes made to
+// the system since their last synchronisation.
+type Sync struct {
+	ss models.SyncService
+
+	viewErr views.Error
+}
+
+// NewSync creates a new Sync controller.
+func NewSync(ss models.SyncService) *Sync {
+	var ev views.Error
+
+	return &Sync{
+		ss:      ss,
+		viewErr: ev,
+	}
+}
+
+// Get returns the users, roles and ratings created, updated or deleted since
+// the cursor passed as the "since" query parameter. Only the entities the
+// requester is allowed to read are included: users and roles require the
+// readUsers permission and ratings require the readRatings permission.
+//
+// The response includes a new cursor that must be passed on the next
+// request. If "since" is not provided, all entities are returned.
+//
+// GET /api/v1/sync?since=x1024
+func (s *Sync) Get(c *gin.Context) {
+	user := middleware.Actor(c)
+
+	var perms models.Permissions
+	if user.Role != nil {
+		perms = user.Role.Permissions
+	}
+
+	q := models.SyncQuery{
+		Since:   c.Query("since"),
+		Users:   perms&models.PermissionReadUsers != 0,
+		Roles:   perms&models.PermissionReadUsers != 0,
+		Ratings: perms&models.PermissionReadRatings != 0,
+		RoleID:  user.RoleID,
+	}
+
+	changes, err := s.ss.Changes(&q)
+	if err != nil {
+		s.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &changes)
+}
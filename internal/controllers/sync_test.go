@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSync_Get(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ss := &modelstest.SyncService{}
+	s := NewSync(ss)
+
+	var perms models.Permissions
+
+	mux := gin.New()
+	mux.GET("/api/v1/sync", func(c *gin.Context) {
+		c.Set("user", &models.User{
+			ID:   1,
+			Role: &models.Role{Permissions: perms},
+		})
+	}, s.Get)
+
+	var cases = []struct {
+		name      string
+		path      string
+		perms     models.Permissions
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badCursor",
+			"/api/v1/sync?since=abc",
+			models.PermissionReadRatings,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"since":"invalid"}}`,
+			func(t *testing.T) {
+				ss.ChangesFunc = func(q *models.SyncQuery) (models.Changes, error) {
+					assert.Equal(t, "abc", q.Since)
+					return models.Changes{}, models.ValidationError{"since": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"internalError",
+			"/api/v1/sync",
+			models.PermissionReadRatings,
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				ss.ChangesFunc = func(q *models.SyncQuery) (models.Changes, error) {
+					return models.Changes{}, wrap("test internal error", nil)
+				}
+			},
+		},
+		{
+			"noPermissions",
+			"/api/v1/sync",
+			0,
+			http.StatusOK,
+			`{"cursor":"100"}`,
+			func(t *testing.T) {
+				ss.ChangesFunc = func(q *models.SyncQuery) (models.Changes, error) {
+					assert.Equal(t, &models.SyncQuery{}, q)
+					return models.Changes{Cursor: "100"}, nil
+				}
+			},
+		},
+		{
+			"readRatings",
+			"/api/v1/sync?since=50",
+			models.PermissionReadRatings,
+			http.StatusOK,
+			`{"cursor":"100","ratings":{"updated":[{"id":1,"active":true,"anonymous":false,"date":0,"extra":null,"score":5,"target":9,"userId":1}],"deleted":[2]}}`,
+			func(t *testing.T) {
+				ss.ChangesFunc = func(q *models.SyncQuery) (models.Changes, error) {
+					assert.Equal(t, &models.SyncQuery{Since: "50", Ratings: true}, q)
+					return models.Changes{
+						Cursor: "100",
+						Ratings: &models.RatingChanges{
+							Updated: []models.Rating{{ID: 1, Active: true, Score: 5, Target: 9, UserID: 1}},
+							Deleted: []int64{2},
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			"readUsers",
+			"/api/v1/sync?since=50",
+			models.PermissionReadUsers,
+			http.StatusOK,
+			`{"cursor":"100","users":{"updated":[],"deleted":[3]},"roles":{"updated":[{"id":4,"label":"test","permissions":[]}],"deleted":[]}}`,
+			func(t *testing.T) {
+				ss.ChangesFunc = func(q *models.SyncQuery) (models.Changes, error) {
+					assert.Equal(t, &models.SyncQuery{Since: "50", Users: true, Roles: true}, q)
+					return models.Changes{
+						Cursor: "100",
+						Users: &models.UserChanges{
+							Updated: []models.User{},
+							Deleted: []int64{3},
+						},
+						Roles: &models.RoleChanges{
+							Updated: []models.Role{{ID: 4, Label: "test"}},
+							Deleted: []int64{},
+						},
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+			c.Request.Header.Add("Accept", "application/json")
+
+			perms = cs.perms
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*ss = modelstest.SyncService{}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// TargetFields implements a controller for the management of the target fields, the
+// expressions computed along with the stats of each target.
+type TargetFields struct {
+	ts models.TargetFieldService
+
+	viewErr views.Error
+}
+
+// NewTargetFields creates a new TargetFields controller.
+func NewTargetFields(ts models.TargetFieldService) *TargetFields {
+	var ev views.Error
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	return &TargetFields{
+		ts:      ts,
+		viewErr: ev,
+	}
+}
+
+// List returns the target fields set.
+//
+// GET /api/v1/admin/target-fields/
+func (tc *TargetFields) List(c *gin.Context) {
+	fields, err := tc.ts.List()
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": fields,
+	})
+}
+
+// Set sets the expression of a target field, creating it if needed, recording the change by
+// the user of the session.
+//
+// PUT /api/v1/admin/target-fields/:name
+func (tc *TargetFields) Set(c *gin.Context) {
+	var f models.TargetField
+
+	err := parseJSON(c, &f)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+	f.Name = c.Param("name")
+	f.UpdatedBy = middleware.Actor(c).ID
+
+	err = tc.ts.Set(&f)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &f)
+}
+
+// Remove removes a target field.
+//
+// DELETE /api/v1/admin/target-fields/:name
+func (tc *TargetFields) Remove(c *gin.Context) {
+	err := tc.ts.Remove(c.Param("name"))
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Check checks the expression of a target field without setting it, returning whether it is
+// valid and, if not, why.
+//
+// POST /api/v1/admin/target-fields/check
+func (tc *TargetFields) Check(c *gin.Context) {
+	var body struct {
+		Expression string `json:"expression"`
+	}
+
+	err := parseJSON(c, &body)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = tc.ts.Check(body.Expression)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"valid": false,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid": true,
+	})
+}
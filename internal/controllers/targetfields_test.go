@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestTargetFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := &modelstest.TargetFieldService{}
+	tc := NewTargetFields(ts)
+
+	updated := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	field := models.TargetField{
+		Name:       "spread",
+		Expression: "stats.max - stats.min",
+		UpdatedBy:  1,
+		UpdatedAt:  updated,
+	}
+	const fieldJSON = `{"name":"spread","expression":"stats.max - stats.min","updatedBy":1,"updatedAt":"2020-03-01T00:00:00Z"}`
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	})
+	mux.GET("/api/v1/admin/target-fields/", tc.List)
+	mux.PUT("/api/v1/admin/target-fields/:name", tc.Set)
+	mux.DELETE("/api/v1/admin/target-fields/:name", tc.Remove)
+	mux.POST("/api/v1/admin/target-fields/check", tc.Check)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/admin/target-fields/",
+			"",
+			http.StatusOK,
+			`{"items":[` + fieldJSON + `]}`,
+			func(t *testing.T) {
+				ts.ListFunc = func() ([]models.TargetField, error) {
+					return []models.TargetField{field}, nil
+				}
+			},
+		},
+		{
+			"set",
+			"PUT",
+			"/api/v1/admin/target-fields/spread",
+			`{"name":"other","expression":"stats.max - stats.min","updatedBy":9}`,
+			http.StatusOK,
+			fieldJSON,
+			func(t *testing.T) {
+				ts.SetFunc = func(f *models.TargetField) error {
+					assert.Equal(t, "spread", f.Name, "must be named by the path")
+					assert.Equal(t, int64(1), f.UpdatedBy, "must be recorded as changed by the requester")
+					f.UpdatedAt = updated
+					return nil
+				}
+			},
+		},
+		{
+			"setInvalid",
+			"PUT",
+			"/api/v1/admin/target-fields/spread",
+			`{"expression":"stats.max -"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"expression":"invalid"}}`,
+			func(t *testing.T) {
+				ts.SetFunc = func(f *models.TargetField) error {
+					return models.ValidationError{"expression": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"remove",
+			"DELETE",
+			"/api/v1/admin/target-fields/spread",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				ts.RemoveFunc = func(name string) error {
+					assert.Equal(t, "spread", name)
+					return nil
+				}
+			},
+		},
+		{
+			"removeUnknown",
+			"DELETE",
+			"/api/v1/admin/target-fields/other",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ts.RemoveFunc = func(name string) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"checkValid",
+			"POST",
+			"/api/v1/admin/target-fields/check",
+			`{"expression":"stats.average * 20.0"}`,
+			http.StatusOK,
+			`{"valid":true}`,
+			func(t *testing.T) {
+				ts.CheckFunc = func(expression string) error {
+					assert.Equal(t, "stats.average * 20.0", expression)
+					return nil
+				}
+			},
+		},
+		{
+			"checkInvalid",
+			"POST",
+			"/api/v1/admin/target-fields/check",
+			`{"expression":"[stats.min]"}`,
+			http.StatusOK,
+			`{"valid":false,"error":"models: target fields must return an int, a double, a bool or a string"}`,
+			func(t *testing.T) {
+				ts.CheckFunc = func(expression string) error {
+					return xerrors.New("models: target fields must return an int, a double, a bool or a string")
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*ts = modelstest.TargetFieldService{}
+		})
+	}
+}
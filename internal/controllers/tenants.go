@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// Tenants implements a controller for the management of the tenants, their lifecycle and the
+// hostnames they are served on.
+type Tenants struct {
+	ts models.TenantService
+
+	viewErr views.Error
+}
+
+// NewTenants creates a new Tenants controller.
+func NewTenants(ts models.TenantService) *Tenants {
+	var ev views.Error
+	ev.SetCode(ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrDuplicate, http.StatusConflict)
+	ev.SetCode(models.ErrTenantStatus, http.StatusConflict)
+
+	return &Tenants{
+		ts:      ts,
+		viewErr: ev,
+	}
+}
+
+// Create provisions a tenant, without hostnames. The tenant is returned right away, while its
+// schema is prepared in the background: its progress is reported by Get.
+//
+// POST /api/v1/admin/tenants/
+func (tc *Tenants) Create(c *gin.Context) {
+	var body struct {
+		models.Tenant
+		Admin models.TenantAdmin `json:"admin"`
+	}
+
+	err := parseJSON(c, &body)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	t := body.Tenant
+	err = tc.ts.Provision(&t, body.Admin)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, &t)
+}
+
+// Update renames a tenant. Its hostnames are kept.
+//
+// PUT /api/v1/admin/tenants/:id
+func (tc *Tenants) Update(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	var t models.Tenant
+
+	err = parseJSON(c, &t)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+	t.ID = id
+
+	err = tc.ts.Update(&t)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &t)
+}
+
+// Get returns one tenant by ID, with its hostnames.
+//
+// GET /api/v1/admin/tenants/:id
+func (tc *Tenants) Get(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	t, err := tc.ts.ByID(id)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &t)
+}
+
+// Usage returns the resources used by a tenant, with its limits, like for billing.
+//
+// GET /api/v1/admin/tenants/:id/usage
+func (tc *Tenants) Usage(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	u, err := tc.ts.Usage(id)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &u)
+}
+
+// List returns all the tenants, with their hostnames.
+//
+// GET /api/v1/admin/tenants/
+func (tc *Tenants) List(c *gin.Context) {
+	tenants, err := tc.ts.List()
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": tenants,
+	})
+}
+
+// AddHostname serves a tenant on a hostname, returning the tenant with its hostnames.
+//
+// PUT /api/v1/admin/tenants/:id/hostnames/:hostname
+func (tc *Tenants) AddHostname(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = tc.ts.AddHostname(id, c.Param("hostname"))
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	t, err := tc.ts.ByID(id)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &t)
+}
+
+// RemoveHostname stops serving a tenant on a hostname.
+//
+// DELETE /api/v1/admin/tenants/:id/hostnames/:hostname
+func (tc *Tenants) RemoveHostname(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = tc.ts.RemoveHostname(id, c.Param("hostname"))
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// Suspend stops serving a tenant, returning the tenant.
+//
+// PUT /api/v1/admin/tenants/:id/suspension
+func (tc *Tenants) Suspend(c *gin.Context) {
+	tc.setStatus(c, tc.ts.Suspend)
+}
+
+// Resume serves a suspended tenant again, returning the tenant.
+//
+// DELETE /api/v1/admin/tenants/:id/suspension
+func (tc *Tenants) Resume(c *gin.Context) {
+	tc.setStatus(c, tc.ts.Resume)
+}
+
+// setStatus changes the status of the tenant with set, returning the tenant.
+func (tc *Tenants) setStatus(c *gin.Context, set func(id int64) error) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = set(id)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	t, err := tc.ts.ByID(id)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &t)
+}
+
+// Delete removes a tenant with its schema and hostnames. The tenant is returned right away,
+// while it is removed in the background.
+//
+// DELETE /api/v1/admin/tenants/:id
+func (tc *Tenants) Delete(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	t, err := tc.ts.ByID(id)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	err = tc.ts.Delete(id)
+	if err != nil {
+		tc.viewErr.JSON(c, err)
+		return
+	}
+
+	t.Status = models.TenantDeleting
+	c.JSON(http.StatusAccepted, &t)
+}
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := &modelstest.TenantService{}
+	tc := NewTenants(ts)
+
+	created := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	tenant := models.Tenant{
+		ID:        3,
+		Name:      "Acme",
+		Hostnames: []string{"acme.ratings.test"},
+		Status:    models.TenantActive,
+		Schema:    "tenant_3",
+		Progress:  models.TenantProgress{Step: "admin", Done: 4, Total: 4},
+		Limits:    models.TenantResources{Users: 10},
+		Used:      models.TenantResources{Users: 2},
+		CreatedAt: created,
+	}
+	const tenantJSON = `{"id":3,"name":"Acme","hostnames":["acme.ratings.test"],"status":"active","schema":"tenant_3",` +
+		`"progress":{"step":"admin","done":4,"total":4},` +
+		`"limits":{"users":10,"ratings":0,"storage":0},"retention":{"days":0,"mode":""},"used":{"users":2,"ratings":0,"storage":0},"createdAt":"2020-03-01T00:00:00Z"}`
+
+	mux := gin.New()
+	mux.GET("/api/v1/admin/tenants/", tc.List)
+	mux.GET("/api/v1/admin/tenants/:id", tc.Get)
+	mux.POST("/api/v1/admin/tenants/", tc.Create)
+	mux.PUT("/api/v1/admin/tenants/:id", tc.Update)
+	mux.DELETE("/api/v1/admin/tenants/:id", tc.Delete)
+	mux.GET("/api/v1/admin/tenants/:id/usage", tc.Usage)
+	mux.PUT("/api/v1/admin/tenants/:id/suspension", tc.Suspend)
+	mux.DELETE("/api/v1/admin/tenants/:id/suspension", tc.Resume)
+	mux.PUT("/api/v1/admin/tenants/:id/hostnames/:hostname", tc.AddHostname)
+	mux.DELETE("/api/v1/admin/tenants/:id/hostnames/:hostname", tc.RemoveHostname)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"list",
+			"GET",
+			"/api/v1/admin/tenants/",
+			"",
+			http.StatusOK,
+			`{"items":[` + tenantJSON + `]}`,
+			func(t *testing.T) {
+				ts.ListFunc = func() ([]models.Tenant, error) {
+					return []models.Tenant{tenant}, nil
+				}
+			},
+		},
+		{
+			"get",
+			"GET",
+			"/api/v1/admin/tenants/3",
+			"",
+			http.StatusOK,
+			tenantJSON,
+			func(t *testing.T) {
+				ts.ByIDFunc = func(id int64) (models.Tenant, error) {
+					assert.Equal(t, int64(3), id)
+					return tenant, nil
+				}
+			},
+		},
+		{
+			"getNotFound",
+			"GET",
+			"/api/v1/admin/tenants/4",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ts.ByIDFunc = func(id int64) (models.Tenant, error) {
+					return models.Tenant{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"create",
+			"POST",
+			"/api/v1/admin/tenants/",
+			`{"name":"Acme","admin":{"email":"admin@acme.test","password":"very long password"}}`,
+			http.StatusAccepted,
+			`{"id":3,"name":"Acme","hostnames":[],"status":"provisioning","schema":"tenant_3",` +
+				`"progress":{"step":"","done":0,"total":0},` +
+				`"limits":{"users":0,"ratings":0,"storage":0},"retention":{"days":0,"mode":""},"used":{"users":0,"ratings":0,"storage":0},"createdAt":"2020-03-01T00:00:00Z"}`,
+			func(t *testing.T) {
+				ts.ProvisionFunc = func(tn *models.Tenant, admin models.TenantAdmin) error {
+					assert.Equal(t, "Acme", tn.Name)
+					assert.Equal(t, models.TenantAdmin{Email: "admin@acme.test", Password: "very long password"}, admin)
+					tn.ID, tn.Hostnames, tn.CreatedAt = 3, []string{}, created
+					tn.Status, tn.Schema = models.TenantProvisioning, "tenant_3"
+					return nil
+				}
+			},
+		},
+		{
+			"createInvalid",
+			"POST",
+			"/api/v1/admin/tenants/",
+			`{}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"name":"required"}}`,
+			func(t *testing.T) {
+				ts.ProvisionFunc = func(tn *models.Tenant, admin models.TenantAdmin) error {
+					return models.ValidationError{"name": models.ErrRequired}
+				}
+			},
+		},
+		{
+			"createInvalidAdmin",
+			"POST",
+			"/api/v1/admin/tenants/",
+			`{"name":"Acme","admin":{"email":"admin@acme.test","password":"short"}}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"admin.password":"too_short"}}`,
+			func(t *testing.T) {
+				ts.ProvisionFunc = func(tn *models.Tenant, admin models.TenantAdmin) error {
+					return models.ValidationError{"admin.password": models.ErrTooShort}
+				}
+			},
+		},
+		{
+			"suspend",
+			"PUT",
+			"/api/v1/admin/tenants/3/suspension",
+			"",
+			http.StatusOK,
+			tenantJSON,
+			func(t *testing.T) {
+				ts.SuspendFunc = func(id int64) error {
+					assert.Equal(t, int64(3), id)
+					return nil
+				}
+				ts.ByIDFunc = func(id int64) (models.Tenant, error) {
+					return tenant, nil
+				}
+			},
+		},
+		{
+			"suspendNotActive",
+			"PUT",
+			"/api/v1/admin/tenants/3/suspension",
+			"",
+			http.StatusConflict,
+			`{"error":"invalid_tenant_status"}`,
+			func(t *testing.T) {
+				ts.SuspendFunc = func(id int64) error {
+					return models.ErrTenantStatus
+				}
+			},
+		},
+		{
+			"resume",
+			"DELETE",
+			"/api/v1/admin/tenants/3/suspension",
+			"",
+			http.StatusOK,
+			tenantJSON,
+			func(t *testing.T) {
+				ts.ResumeFunc = func(id int64) error {
+					assert.Equal(t, int64(3), id)
+					return nil
+				}
+				ts.ByIDFunc = func(id int64) (models.Tenant, error) {
+					return tenant, nil
+				}
+			},
+		},
+		{
+			"delete",
+			"DELETE",
+			"/api/v1/admin/tenants/3",
+			"",
+			http.StatusAccepted,
+			`{"id":3,"name":"Acme","hostnames":["acme.ratings.test"],"status":"deleting","schema":"tenant_3",` +
+				`"progress":{"step":"admin","done":4,"total":4},` +
+				`"limits":{"users":10,"ratings":0,"storage":0},"retention":{"days":0,"mode":""},"used":{"users":2,"ratings":0,"storage":0},"createdAt":"2020-03-01T00:00:00Z"}`,
+			func(t *testing.T) {
+				ts.ByIDFunc = func(id int64) (models.Tenant, error) {
+					return tenant, nil
+				}
+				ts.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(3), id)
+					return nil
+				}
+			},
+		},
+		{
+			"deleteNotFound",
+			"DELETE",
+			"/api/v1/admin/tenants/4",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ts.ByIDFunc = func(id int64) (models.Tenant, error) {
+					return models.Tenant{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"usage",
+			"GET",
+			"/api/v1/admin/tenants/3/usage",
+			"",
+			http.StatusOK,
+			`{"tenantId":3,"used":{"users":2,"ratings":40,"storage":5120},` +
+				`"limits":{"users":10,"ratings":0,"storage":0},"at":"2020-03-02T00:00:00Z"}`,
+			func(t *testing.T) {
+				ts.UsageFunc = func(id int64) (models.TenantUsage, error) {
+					assert.Equal(t, int64(3), id)
+					return models.TenantUsage{
+						TenantID: 3,
+						Used:     models.TenantResources{Users: 2, Ratings: 40, Storage: 5120},
+						Limits:   tenant.Limits,
+						At:       created.AddDate(0, 0, 1),
+					}, nil
+				}
+			},
+		},
+		{
+			"usageNotFound",
+			"GET",
+			"/api/v1/admin/tenants/4/usage",
+			"",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				ts.UsageFunc = func(id int64) (models.TenantUsage, error) {
+					return models.TenantUsage{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"update",
+			"PUT",
+			"/api/v1/admin/tenants/3",
+			`{"name":"Acme","limits":{"users":10},"retention":{"days":90,"mode":"anonymise"}}`,
+			http.StatusOK,
+			tenantJSON,
+			func(t *testing.T) {
+				ts.UpdateFunc = func(tn *models.Tenant) error {
+					assert.Equal(t, int64(3), tn.ID)
+					assert.Equal(t, models.TenantResources{Users: 10}, tn.Limits)
+					assert.Equal(t, models.RetentionPolicy{Days: 90, Mode: models.RetentionAnonymise}, tn.Retention)
+					*tn = tenant
+					return nil
+				}
+			},
+		},
+		{
+			"addHostname",
+			"PUT",
+			"/api/v1/admin/tenants/3/hostnames/acme.ratings.test",
+			"",
+			http.StatusOK,
+			tenantJSON,
+			func(t *testing.T) {
+				ts.AddHostnameFunc = func(id int64, hostname string) error {
+					assert.Equal(t, int64(3), id)
+					assert.Equal(t, "acme.ratings.test", hostname)
+					return nil
+				}
+				ts.ByIDFunc = func(id int64) (models.Tenant, error) {
+					return tenant, nil
+				}
+			},
+		},
+		{
+			"addHostnameTaken",
+			"PUT",
+			"/api/v1/admin/tenants/3/hostnames/globex.ratings.test",
+			"",
+			http.StatusConflict,
+			`{"error":"validation_error","fields":{"hostname":"is_duplicate"}}`,
+			func(t *testing.T) {
+				ts.AddHostnameFunc = func(id int64, hostname string) error {
+					return models.ValidationError{"hostname": models.ErrDuplicate}
+				}
+			},
+		},
+		{
+			"removeHostname",
+			"DELETE",
+			"/api/v1/admin/tenants/3/hostnames/acme.ratings.test",
+			"",
+			http.StatusNoContent,
+			"",
+			func(t *testing.T) {
+				ts.RemoveHostnameFunc = func(id int64, hostname string) error {
+					assert.Equal(t, "acme.ratings.test", hostname)
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+
+			if tc.setup != nil {
+				tc.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			if tc.outStatus != http.StatusNoContent {
+				assert.JSONEq(t, tc.outJSON, w.Body.String())
+			}
+
+			*ts = modelstest.TenantService{}
+		})
+	}
+}
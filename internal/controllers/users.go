@@ -1,9 +1,12 @@
 package controllers
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/middleware"
 	"github.com/noelruault/ratingsapp/internal/models"
 	"github.com/noelruault/ratingsapp/internal/views"
 	"golang.org/x/xerrors"
@@ -12,7 +15,10 @@ import (
 // Users implements a controller for authentication, authorisation and
 // user management.
 type Users struct {
-	us models.UserService
+	us    models.UserService
+	codes models.AuthCodeService
+	ids   models.IdentityService
+	audit models.AuditService
 
 	viewErr views.Error
 }
@@ -25,6 +31,13 @@ func NewUsers(us models.UserService) *Users {
 	ev.SetCode(models.ErrReadOnly, http.StatusConflict)
 	ev.SetCode(ErrNotFound, http.StatusNotFound)
 	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+	ev.SetCode(models.ErrConflict, http.StatusPreconditionFailed)
+	ev.SetCode(ErrPreconditionRequired, http.StatusPreconditionRequired)
+	ev.SetCode(ErrWeakETag, http.StatusPreconditionFailed)
+	ev.SetCode(models.ErrSessionsDisabled, http.StatusNotImplemented)
+	ev.SetCode(models.ErrInUse, http.StatusConflict)
+	ev.SetCode(models.ErrQuotaExceeded, http.StatusForbidden)
+	ev.SetCode(models.ErrCannotImpersonate, http.StatusForbidden)
 
 	return &Users{
 		us:      us,
@@ -32,8 +45,33 @@ func NewUsers(us models.UserService) *Users {
 	}
 }
 
-// Login takes a username and password or a refresh token and returns a set of
-// access and refresh tokens.
+// WithAuthCodes sets the service of the codes of the authorization code grant, which Authorize
+// issues and Login exchanges, and returns u. The grant is not supported without it.
+func (u *Users) WithAuthCodes(codes models.AuthCodeService) *Users {
+	u.codes = codes
+	return u
+}
+
+// WithIdentities sets the service signing in the users with an OpenID Connect provider, which
+// OIDCNonce, OIDCCallback and LinkMyIdentity use, and returns u. They are not found without it.
+func (u *Users) WithIdentities(ids models.IdentityService) *Users {
+	u.ids = ids
+	return u
+}
+
+// WithAudit sets the audit log the impersonations are recorded in, and returns u. Impersonate
+// is not found without it.
+func (u *Users) WithAudit(audit models.AuditService) *Users {
+	u.audit = audit
+	return u
+}
+
+// Login takes a username and password, a refresh token or an authorization code
+// and returns a set of access and refresh tokens. The parameters are
+// form-encoded, as defined by OAuth, or a JSON object with the same names. The
+// logins with remember=true, or with offline_access among their scopes, are
+// remembered: their refresh token is valid for longer, as are the ones it is
+// refreshed with.
 //
 // Login takes care of its own Content-Types as it is not a standard API call. No
 // middlewares for content types should be appliced to Login.
@@ -41,14 +79,22 @@ func NewUsers(us models.UserService) *Users {
 // POST /api/v1/oauth/token
 func (u *Users) Login(c *gin.Context) {
 	var auth struct {
-		Email        string `form:"email"`
-		Password     string `form:"password"`
-		RefreshToken string `form:"refresh_token"`
-		GrantType    string `form:"grant_type" binding:"required"` // password, client_credentials, refresh_token
+		Email        string `form:"email" json:"email"`
+		Password     string `form:"password" json:"password"`
+		RefreshToken string `form:"refresh_token" json:"refresh_token"`
+		GrantType    string `form:"grant_type" json:"grant_type" binding:"required"` // password, client_credentials, refresh_token, authorization_code
+		Scope        string `form:"scope" json:"scope"`
+		Remember     bool   `form:"remember" json:"remember"`
+
+		// the parameters of the authorization code grant
+		Code         string `form:"code" json:"code"`
+		ClientID     string `form:"client_id" json:"client_id"`
+		RedirectURI  string `form:"redirect_uri" json:"redirect_uri"`
+		CodeVerifier string `form:"code_verifier" json:"code_verifier"`
 	}
 
-	// parse the form-encoded input
-	err := parseForm(c, &auth)
+	// parse the form-encoded or JSON input
+	err := parseFormOrJSON(c, &auth)
 	if err != nil {
 		oauthBadRequest(c, err)
 		return
@@ -57,14 +103,26 @@ func (u *Users) Login(c *gin.Context) {
 	// check grant-types
 	var user models.User
 	if auth.GrantType == "password" {
-		user, err = u.us.Authenticate(auth.Email, auth.Password)
+		user, err = u.us.AuthenticateFrom(auth.Email, auth.Password, sessionClient(c))
 		if err != nil {
 			oauthAuthError(c, err)
 			return
 		}
 
 	} else if auth.GrantType == "refresh_token" {
-		user, err = u.us.Refresh(auth.RefreshToken)
+		// the session refreshed is replaced, keeping its details
+		var tok models.Token
+		_, tok, err = u.us.RefreshSession(auth.RefreshToken, sessionClient(c))
+		if err != nil {
+			oauthAuthError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &tok)
+		return
+
+	} else if auth.GrantType == "authorization_code" && u.codes != nil {
+		user, err = u.codes.Exchange(auth.Code, auth.ClientID, auth.RedirectURI, auth.CodeVerifier)
 		if err != nil {
 			oauthAuthError(c, err)
 			return
@@ -75,7 +133,150 @@ func (u *Users) Login(c *gin.Context) {
 		return
 	}
 
-	tok, err := u.us.Token(&user)
+	opts := models.TokenOptions{
+		Client:   sessionClient(c),
+		Remember: auth.Remember || hasScope(auth.Scope, "offline_access"),
+	}
+	tok, err := u.us.TokenFor(&user, opts)
+	if err != nil {
+		oauthAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &tok)
+}
+
+// Authorize authenticates a user with a username and password, and redirects it
+// to the redirect URI of a client with a code the client exchanges for tokens
+// with Login, as defined by the authorization code grant of OAuth. The client
+// must send a PKCE challenge, with the S256 method, so only it can exchange the
+// code.
+//
+// The parameters are sent as Login takes them. The errors of the client and of
+// its redirect URI, and of the credentials of the user, are returned as the
+// ones of Login, so the user can try again; the others are sent to the
+// redirect URI.
+//
+// POST /api/v1/oauth/authorize
+func (u *Users) Authorize(c *gin.Context) {
+	var auth struct {
+		ResponseType        string `form:"response_type" json:"response_type"`
+		ClientID            string `form:"client_id" json:"client_id"`
+		RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+		State               string `form:"state" json:"state"`
+		CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+		CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+		Email               string `form:"email" json:"email"`
+		Password            string `form:"password" json:"password"`
+	}
+
+	if u.codes == nil {
+		oauthAuthError(c, models.ErrUnknownClient)
+		return
+	}
+
+	err := parseFormOrJSON(c, &auth)
+	if err != nil {
+		oauthBadRequest(c, err)
+		return
+	}
+
+	// never redirect to the URIs the client did not register
+	err = u.codes.Client(auth.ClientID, auth.RedirectURI)
+	if err != nil {
+		oauthAuthError(c, err)
+		return
+	}
+
+	if auth.ResponseType != "code" {
+		oauthRedirect(c, auth.RedirectURI, url.Values{"error": {"unsupported_response_type"}}, auth.State)
+		return
+	}
+
+	if auth.CodeChallengeMethod != "S256" {
+		oauthRedirect(c, auth.RedirectURI, url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"code_challenge_method"},
+		}, auth.State)
+		return
+	}
+
+	user, err := u.us.AuthenticateFrom(auth.Email, auth.Password, sessionClient(c))
+	if err != nil {
+		oauthAuthError(c, err)
+		return
+	}
+
+	code, err := u.codes.Issue(&models.AuthCode{
+		UserID:        user.ID,
+		ClientID:      auth.ClientID,
+		RedirectURI:   auth.RedirectURI,
+		CodeChallenge: auth.CodeChallenge,
+	})
+	if verr := models.ValidationError(nil); xerrors.As(err, &verr) {
+		oauthRedirect(c, auth.RedirectURI, url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"code_challenge"},
+		}, auth.State)
+		return
+	} else if err != nil {
+		oauthAuthError(c, err)
+		return
+	}
+
+	oauthRedirect(c, auth.RedirectURI, url.Values{"code": {code}}, auth.State)
+}
+
+// OIDCNonce issues a nonce, which the client asks the OpenID Connect provider to put in the ID
+// token of the user, and sends along with it to OIDCCallback or LinkMyIdentity.
+//
+// POST /api/v1/oauth/oidc/nonce
+func (u *Users) OIDCNonce(c *gin.Context) {
+	if u.ids == nil {
+		u.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	nonce, err := u.ids.Nonce()
+	if err != nil {
+		oauthAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"nonce": nonce})
+}
+
+// OIDCCallback takes an ID token issued by the OpenID Connect provider to the
+// application, and returns a set of access and refresh tokens for its user, as
+// Login does. The user is created with the default role the first time it
+// signs in, unless a user has its email address already, who must link the
+// account with LinkMyIdentity.
+//
+// POST /api/v1/oauth/oidc/callback
+func (u *Users) OIDCCallback(c *gin.Context) {
+	if u.ids == nil {
+		u.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	var auth struct {
+		IDToken string `form:"id_token" json:"id_token"`
+		Nonce   string `form:"nonce" json:"nonce"`
+	}
+
+	err := parseFormOrJSON(c, &auth)
+	if err != nil {
+		oauthBadRequest(c, err)
+		return
+	}
+
+	user, err := u.ids.SignIn(auth.IDToken, auth.Nonce)
+	if err != nil {
+		oauthAuthError(c, err)
+		return
+	}
+
+	tok, err := u.us.TokenFor(&user, models.TokenOptions{Client: sessionClient(c)})
 	if err != nil {
 		oauthAuthError(c, err)
 		return
@@ -102,6 +303,7 @@ func (u *Users) Create(c *gin.Context) {
 		return
 	}
 
+	setETag(c, user.Version)
 	c.JSON(http.StatusCreated, &user)
 }
 
@@ -115,6 +317,12 @@ func (u *Users) Update(c *gin.Context) {
 		return
 	}
 
+	version, err := getIfMatch(c)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
 	var user = models.NewUser()
 
 	err = parseJSON(c, &user)
@@ -123,6 +331,7 @@ func (u *Users) Update(c *gin.Context) {
 		return
 	}
 	user.ID = id
+	user.Version = version
 
 	err = u.us.Update(&user)
 	if err != nil {
@@ -130,12 +339,50 @@ func (u *Users) Update(c *gin.Context) {
 		return
 	}
 
+	setETag(c, user.Version)
 	c.JSON(http.StatusOK, &user)
 }
 
-// Delete removes a user by ID.
+// Patch updates the fields of an existing user present in the request, a JSON Merge Patch document.
+//
+// PATCH /api/v1/users/:id
+func (u *Users) Patch(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	version, err := getIfMatch(c)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	patch, err := parsePatch(c, &models.User{})
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	user := models.User{ID: id, Version: version}
+
+	err = u.us.UpdatePartial(&user, patch)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, &user)
+}
+
+// Delete removes a user by ID. A user with ratings can only be removed if the "ratings" parameter
+// is set to "anonymise", to keep them as anonymous ratings, or to "reassign", to move them to the
+// user given by the "to" parameter. Otherwise, a conflict is returned.
 //
 // DELETE /api/v1/users/:id
+// DELETE /api/v1/users/:id?ratings=reassign&to=3
 func (u *Users) Delete(c *gin.Context) {
 	id, err := getParamInt(c, "id")
 	if err != nil {
@@ -143,7 +390,23 @@ func (u *Users) Delete(c *gin.Context) {
 		return
 	}
 
-	err = u.us.Delete(id)
+	mode, ok := c.GetQuery("ratings")
+	if !ok {
+		err = u.us.Delete(id)
+	} else {
+		d := models.UserDeletion{Ratings: mode}
+
+		var to *int64
+		to, err = getQueryInt(c, "to")
+		if err != nil {
+			u.viewErr.JSON(c, err)
+			return
+		} else if to != nil {
+			d.ReassignTo = *to
+		}
+
+		err = u.us.DeleteWith(id, d)
+	}
 	if err != nil {
 		u.viewErr.JSON(c, err)
 		return
@@ -152,9 +415,15 @@ func (u *Users) Delete(c *gin.Context) {
 	c.JSON(http.StatusNoContent, gin.H{})
 }
 
-// Get returns one user by ID to the requester.
+// Get returns one user by ID to the requester, along with its role. The role is left out if the
+// "expand" parameter is set without it.
+//
+// 304 Not Modified is returned when the If-None-Match header lists the ETag of the user, or without
+// it, when the user was not updated since If-Modified-Since. The changes to the role are not
+// considered.
 //
 // GET /api/v1/users/:id
+// GET /api/v1/users/:id?expand=role
 func (u *Users) Get(c *gin.Context) {
 	id, err := getParamInt(c, "id")
 	if err != nil {
@@ -162,12 +431,26 @@ func (u *Users) Get(c *gin.Context) {
 		return
 	}
 
+	expand, err := getQueryExpand(c, "role")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
 	user, err := u.us.ByID(id)
 	if err != nil {
 		u.viewErr.JSON(c, err)
 		return
 	}
 
+	if expand != nil && !expand["role"] {
+		user.Role = nil
+	}
+
+	if notModified(c, versionETag(user.Version), user.UpdatedAt) {
+		return
+	}
+
 	c.JSON(http.StatusOK, &user)
 }
 
@@ -176,9 +459,21 @@ func (u *Users) Get(c *gin.Context) {
 // The IDs are passed as a comma-separated list of user IDs, as the "id" query parameter.
 // If any ID passed are not found, those are not shown on the returned list.
 //
+// Users can also be searched by text in their email and names with the "q" parameter, filtered
+// by the "active" and "roleId" parameters and sorted with the "sort" parameter.
+//
+// The users are returned with their role, unless the server omits them. The "expand" parameter
+// tells whether they are, "expand=role" including them and an empty "expand" leaving them out.
+// The roles are read in a single query.
+//
+// The "fields" parameter trims the users to the fields it lists, see views.Items.
+//
 // This handler will never return a NotFound error, instead returnind an empty list.
 //
 // GET /api/v1/users/?id=1,2,3
+// GET /api/v1/users/?fields=id,email,firstName
+// GET /api/v1/users/?q=alice&active=true&roleId=2&sort=email
+// GET /api/v1/users/?id=1,2,3&expand=role
 func (u *Users) List(c *gin.Context) {
 	ids, err := getQueryListInt(c, "id")
 	if err != nil {
@@ -186,7 +481,32 @@ func (u *Users) List(c *gin.Context) {
 		return
 	}
 
-	users, err := u.us.ByIDs(ids...)
+	q, err := getUserSearchQuery(c)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	expand, err := getQueryExpand(c, "role")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+	if expand != nil {
+		if q == nil {
+			q = &models.SearchQuery{}
+		}
+		roles := expand["role"]
+		q.Roles = &roles
+	}
+
+	var users []models.User
+	if q != nil {
+		q.IDs = ids
+		users, err = u.us.Search(*q)
+	} else {
+		users, err = u.us.ByIDs(ids...)
+	}
 	if err != nil {
 		u.viewErr.JSON(c, err)
 		return
@@ -196,47 +516,434 @@ func (u *Users) List(c *gin.Context) {
 		users = []models.User{}
 	}
 
+	err = views.Items(c, users)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+	}
+}
+
+// Sessions returns the active sessions of a user, that is, the sets of tokens issued to them that
+// have not expired nor been revoked.
+//
+// GET /api/v1/users/:id/sessions
+func (u *Users) Sessions(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	sessions, err := u.us.Sessions(id)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"items": users,
+		"items": sessions,
 	})
 }
 
-func oauthBadRequest(c *gin.Context, err error) {
-	out := gin.H{
-		"error": "invalid_request",
+// RevokeSession ends a session of a user by ID, so its tokens can no longer be used.
+//
+// DELETE /api/v1/users/:id/sessions/:sid
+func (u *Users) RevokeSession(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	err = u.us.RevokeSession(id, c.Param("sid"))
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// MySessions returns the active sessions of the authenticated user, as Sessions, so they can see
+// the devices they are signed in on.
+//
+// GET /api/v1/me/sessions
+func (u *Users) MySessions(c *gin.Context) {
+	sessions, err := u.us.Sessions(middleware.Actor(c).ID)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": sessions,
+	})
+}
+
+// RevokeMySession ends a session of the authenticated user by ID, logging them out of the device
+// it was started on.
+//
+// DELETE /api/v1/me/sessions/:sid
+func (u *Users) RevokeMySession(c *gin.Context) {
+	err := u.us.RevokeSession(middleware.Actor(c).ID, c.Param("sid"))
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// LinkMyIdentity links the account of the OpenID Connect provider asserted by an ID token to the
+// authenticated user, so they can sign in with it.
+//
+// POST /api/v1/me/identities
+func (u *Users) LinkMyIdentity(c *gin.Context) {
+	if u.ids == nil {
+		u.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	var link struct {
+		IDToken string `json:"id_token"`
+		Nonce   string `json:"nonce"`
+	}
+
+	err := parseJSON(c, &link)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	err = u.ids.Link(middleware.Actor(c).ID, link.IDToken, link.Nonce)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
 	}
 
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// MyPermissions returns the names of the permissions of the role of the authenticated user, and
+// whether they are an administrator, so the clients can tell what they can do without reading the
+// role.
+//
+// GET /api/v1/me/permissions
+func (u *Users) MyPermissions(c *gin.Context) {
+	a := middleware.Actor(c)
+
+	var p models.Permissions
+	if a.Role != nil {
+		p = a.Role.Permissions
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"permissions": p.Names(),
+		"admin":       a.IsAdmin(),
+	})
+}
+
+// settingsMergeAttempts is the number of times PatchMySettings merges the settings when they are
+// changed by another request in between, when the client does not send the version it expects.
+const settingsMergeAttempts = 3
+
+// MySettings returns the settings of the authenticated user, a JSON object.
+//
+// GET /api/v1/me/settings
+func (u *Users) MySettings(c *gin.Context) {
+	user, err := u.us.ByID(middleware.Actor(c).ID)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, settingsObject(user.Settings))
+}
+
+// ReplaceMySettings replaces the settings of the authenticated user with the JSON object of the
+// request. As it drops the members other clients set, the If-Match header is required.
+//
+// PUT /api/v1/me/settings
+func (u *Users) ReplaceMySettings(c *gin.Context) {
+	version, err := getIfMatch(c)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	settings, err := parsePatch(c, &map[string]json.RawMessage{})
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	user, err := u.us.ByID(middleware.Actor(c).ID)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+	user.Role = nil
+	user.Settings = settings
+	user.Version = version
+
+	err = u.us.Update(&user)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, settingsObject(user.Settings))
+}
+
+// PatchMySettings merges the members of the JSON object of the request into the settings of the
+// authenticated user, as a JSON Merge Patch document, so the members other clients set are kept.
+// Null members remove them. The If-Match header is optional: without it, the settings changed by
+// another request in between are merged again.
+//
+// PATCH /api/v1/me/settings
+func (u *Users) PatchMySettings(c *gin.Context) {
+	version, err := getIfMatch(c)
+	retry := xerrors.Is(err, ErrPreconditionRequired)
+	if err != nil && !retry {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	settings, err := parsePatch(c, &map[string]json.RawMessage{})
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	patch, err := json.Marshal(map[string]json.RawMessage{"settings": settings})
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	id := middleware.Actor(c).ID
+	var user models.User
+	for i := 0; i < settingsMergeAttempts; i++ {
+		user = models.User{ID: id, Version: version}
+		err = u.us.UpdatePartial(&user, patch)
+		if !retry || !xerrors.Is(err, models.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, settingsObject(user.Settings))
+}
+
+// settingsObject returns the settings of a user, or an empty object if they have none.
+func settingsObject(settings json.RawMessage) json.RawMessage {
+	if len(settings) == 0 {
+		return json.RawMessage(`{}`)
+	}
+
+	return settings
+}
+
+// RevokeSessions ends all the sessions of a user, logging them out everywhere.
+//
+// DELETE /api/v1/users/:id/sessions
+func (u *Users) RevokeSessions(c *gin.Context) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	err = u.us.RevokeSessions(id)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// Impersonate returns an access token with which the requester, an administrator, acts as a
+// user for models.ImpersonationDuration, as support does to see what they see. There is no
+// refresh token. The impersonation is recorded in the audit log, and the token is only returned
+// once it is.
+//
+// POST /api/v1/users/:id/impersonate
+func (u *Users) Impersonate(c *gin.Context) {
+	if u.audit == nil {
+		u.viewErr.JSON(c, ErrNotFound)
+		return
+	}
+
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	user, err := u.us.ByID(id)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	admin := middleware.Actor(c)
+	tok, err := u.us.Impersonate(&user, admin.User)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	err = u.audit.Record(&models.AuditEntry{ActorID: admin.ID, Action: models.AuditImpersonate, UserID: &user.ID})
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, &tok)
+}
+
+// Deactivate marks a user as inactive, ending its sessions, and returns it. Its ratings are kept.
+//
+// POST /api/v1/users/:id/deactivate
+func (u *Users) Deactivate(c *gin.Context) {
+	u.setActive(c, u.us.Deactivate)
+}
+
+// Activate marks a user deactivated as active again, and returns it.
+//
+// POST /api/v1/users/:id/activate
+func (u *Users) Activate(c *gin.Context) {
+	u.setActive(c, u.us.Activate)
+}
+
+func (u *Users) setActive(c *gin.Context, set func(id int64) error) {
+	id, err := getParamInt(c, "id")
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	err = set(id)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	user, err := u.us.ByID(id)
+	if err != nil {
+		u.viewErr.JSON(c, err)
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, &user)
+}
+
+// getUserSearchQuery retrieves the user search criteria from a request's query string. In case
+// none of the search parameters are found, nil is returned for both return values. If the active
+// or roleId parameters cannot be parsed, a ValidationError is returned.
+func getUserSearchQuery(c *gin.Context) (*models.SearchQuery, error) {
+	var (
+		q     models.SearchQuery
+		found bool
+	)
+
+	if v, ok := c.GetQuery("q"); ok {
+		q.Q, found = v, true
+	}
+
+	if v, ok := c.GetQuery("sort"); ok {
+		q.Sort, found = v, true
+	}
+
+	active, err := getQueryBool(c, "active")
+	if err != nil {
+		return nil, err
+	} else if active != nil {
+		q.Active, found = active, true
+	}
+
+	rid, err := getQueryInt(c, "roleId")
+	if err != nil {
+		return nil, err
+	} else if rid != nil {
+		q.RoleID, found = *rid, true
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return &q, nil
+}
+
+func oauthBadRequest(c *gin.Context, err error) {
+	var description string
 	if pe, ok := err.(publicError); ok {
-		out["error_description"] = pe.Public()
+		description = pe.Public()
 	}
 
-	c.AbortWithStatusJSON(http.StatusBadRequest, out)
+	views.OAuthJSON(c, http.StatusBadRequest, "invalid_request", description)
 }
 
 func oauthAuthError(c *gin.Context, err error) {
-	if xerrors.Is(err, models.ErrUnauthorised) {
+	if xerrors.Is(err, models.ErrUnauthorised) || xerrors.Is(err, models.ErrUnknownClient) {
+		views.OAuthJSON(c, http.StatusUnauthorized, "invalid_client", "")
+		return
 
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-			"error": "invalid_client",
-		})
+	} else if xerrors.Is(err, models.ErrInvalidGrant) {
+		views.OAuthJSON(c, http.StatusBadRequest, "invalid_grant", "")
 		return
 
 	} else if pe, ok := err.(publicError); ok {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error":             "invalid_request",
-			"error_description": pe.Public(),
-		})
+		views.OAuthJSON(c, http.StatusBadRequest, "invalid_request", pe.Public())
 		return
 	}
 
 	c.Error(err)
-	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-		"error": "server_error",
-	})
+	views.OAuthJSON(c, http.StatusInternalServerError, "server_error", "")
 }
 
 func oauthBadGrantType(c *gin.Context) {
-	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-		"error": "unsupported_grant_type",
-	})
+	views.OAuthJSON(c, http.StatusBadRequest, "unsupported_grant_type", "")
+}
+
+// oauthRedirect redirects the request of c to the redirect URI of a client, adding params and the
+// state of the client, if any, to its query.
+func oauthRedirect(c *gin.Context, redirectURI string, params url.Values, state string) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		// the redirect URIs are checked to be valid when registered
+		c.Error(err)
+		views.OAuthJSON(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, u.String())
 }
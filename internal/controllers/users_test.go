@@ -2,94 +2,21 @@ package controllers
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
 	"github.com/stretchr/testify/assert"
 )
 
-type testUserService struct {
-	models.UserService
-	auth    func(username, password string) (models.User, error)
-	refresh func(refreshToken string) (models.User, error)
-	token   func(*models.User) (models.Token, error)
-	byID    func(int64) (models.User, error)
-	byIDs   func(...int64) ([]models.User, error)
-	delete  func(int64) error
-	create  func(*models.User) error
-	update  func(*models.User) error
-}
-
-func (t *testUserService) Authenticate(username, password string) (models.User, error) {
-	if t.auth != nil {
-		return t.auth(username, password)
-	}
-
-	panic("not provided")
-}
-
-func (t *testUserService) Refresh(refreshToken string) (models.User, error) {
-	if t.refresh != nil {
-		return t.refresh(refreshToken)
-	}
-
-	panic("not provided")
-}
-
-func (t *testUserService) Token(u *models.User) (models.Token, error) {
-	if t.token != nil {
-		return t.token(u)
-	}
-
-	panic("not provided")
-}
-
-func (t *testUserService) ByID(id int64) (models.User, error) {
-	if t.byID != nil {
-		return t.byID(id)
-	}
-
-	panic("not provided")
-}
-
-func (t *testUserService) ByIDs(id ...int64) ([]models.User, error) {
-	if t.byIDs != nil {
-		return t.byIDs(id...)
-	}
-
-	panic("not provided")
-}
-
-func (t *testUserService) Delete(id int64) error {
-	if t.delete != nil {
-		return t.delete(id)
-	}
-
-	panic("not provided")
-}
-
-func (t *testUserService) Create(u *models.User) error {
-	if t.create != nil {
-		return t.create(u)
-	}
-
-	panic("not provided")
-}
-
-func (t *testUserService) Update(u *models.User) error {
-	if t.update != nil {
-		return t.update(u)
-	}
-
-	panic("not provided")
-}
-
 func TestUsers_Login(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	us := &testUserService{}
+	us := &modelstest.UserService{}
 	u := NewUsers(us)
 
 	var cases = []struct {
@@ -139,7 +66,7 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusBadRequest,
 			`{"error": "invalid_request", "error_description":"credentials_not_provided"}`,
 			func(*testing.T) {
-				us.auth = func(username, password string) (models.User, error) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
 					return models.User{}, models.ErrNoCredentials
 				}
 			},
@@ -151,7 +78,7 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error": "server_error"}`,
 			func(*testing.T) {
-				us.auth = func(username, password string) (models.User, error) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
 					return models.User{}, privateError("models: some type of internal error")
 				}
 			},
@@ -163,10 +90,10 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error": "server_error"}`,
 			func(*testing.T) {
-				us.auth = func(username, password string) (models.User, error) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
 					return models.User{}, nil
 				}
-				us.token = func(*models.User) (models.Token, error) {
+				us.TokenForFunc = func(*models.User, models.TokenOptions) (models.Token, error) {
 					return models.Token{}, privateError("models: some type of internal error")
 				}
 			},
@@ -178,7 +105,7 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusUnauthorized,
 			`{"error": "invalid_client"}`,
 			func(*testing.T) {
-				us.auth = func(username, password string) (models.User, error) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
 					return models.User{}, models.ErrUnauthorised
 				}
 			},
@@ -190,7 +117,7 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusUnauthorized,
 			`{"error": "invalid_client"}`,
 			func(*testing.T) {
-				us.auth = func(username, password string) (models.User, error) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
 					return models.User{}, models.ErrUnauthorised
 				}
 			},
@@ -202,7 +129,7 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusUnauthorized,
 			`{"error": "invalid_client"}`,
 			func(*testing.T) {
-				us.auth = func(username, password string) (models.User, error) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
 					return models.User{}, models.ErrUnauthorised
 				}
 			},
@@ -214,7 +141,7 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusOK,
 			`{"access_token": "test access token", "refresh_token": "test token", "expires_in": 900, "token_type": "bearer"}`,
 			func(t *testing.T) {
-				us.auth = func(username, password string) (models.User, error) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
 					assert.Equal(t, username, "user@example.com")
 					assert.Equal(t, password, "1234luggage")
 
@@ -224,7 +151,7 @@ func TestUsers_Login(t *testing.T) {
 						Password: password,
 					}, nil
 				}
-				us.token = func(u *models.User) (models.Token, error) {
+				us.TokenForFunc = func(u *models.User, opts models.TokenOptions) (models.Token, error) {
 					assert.Equal(t, int64(99), u.ID)
 
 					return models.Token{
@@ -236,6 +163,45 @@ func TestUsers_Login(t *testing.T) {
 				}
 			},
 		},
+		{
+			"grantedPasswordJSON",
+			"application/json; charset=utf-8",
+			`{"grant_type": "password", "email": "user@example.com", "password": "1234luggage"}`,
+			http.StatusOK,
+			`{"access_token": "test access token", "refresh_token": "test token", "expires_in": 900, "token_type": "bearer"}`,
+			func(t *testing.T) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
+					assert.Equal(t, username, "user@example.com")
+					assert.Equal(t, password, "1234luggage")
+
+					return models.User{ID: 99, Email: username}, nil
+				}
+				us.TokenForFunc = func(u *models.User, opts models.TokenOptions) (models.Token, error) {
+					return models.Token{
+						RefreshToken: "test token",
+						AccessToken:  "test access token",
+						ExpiresIn:    900,
+						TokenType:    "bearer",
+					}, nil
+				}
+			},
+		},
+		{
+			"badContentJSON",
+			"application/json",
+			`{"grant_type": "password",`,
+			http.StatusBadRequest,
+			`{"error": "invalid_request", "error_description":"invalid_json"}`,
+			nil,
+		},
+		{
+			"missingGrantTypeJSON",
+			"application/vnd.ratingsapp.v1+json",
+			`{"email": "user@example.com"}`,
+			http.StatusBadRequest,
+			`{"error": "invalid_request", "error_description":"invalid_json"}`,
+			nil,
+		},
 
 		{
 			"refreshValidationFails",
@@ -244,8 +210,8 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusBadRequest,
 			`{"error": "invalid_request", "error_description":"credentials_not_provided"}`,
 			func(*testing.T) {
-				us.refresh = func(r string) (models.User, error) {
-					return models.User{}, models.ErrNoCredentials
+				us.RefreshSessionFunc = func(r string, client models.SessionClient) (models.User, models.Token, error) {
+					return models.User{}, models.Token{}, models.ErrNoCredentials
 				}
 			},
 		},
@@ -256,8 +222,8 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error": "server_error"}`,
 			func(*testing.T) {
-				us.refresh = func(r string) (models.User, error) {
-					return models.User{}, privateError("models: some type of internal error")
+				us.RefreshSessionFunc = func(r string, client models.SessionClient) (models.User, models.Token, error) {
+					return models.User{}, models.Token{}, privateError("models: some type of internal error")
 				}
 			},
 		},
@@ -268,8 +234,8 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error": "server_error"}`,
 			func(*testing.T) {
-				us.refresh = func(r string) (models.User, error) {
-					return models.User{}, privateError("models: some type of internal error")
+				us.RefreshSessionFunc = func(r string, client models.SessionClient) (models.User, models.Token, error) {
+					return models.User{}, models.Token{}, privateError("models: some type of internal error")
 				}
 			},
 		},
@@ -280,8 +246,8 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusUnauthorized,
 			`{"error": "invalid_client"}`,
 			func(*testing.T) {
-				us.refresh = func(r string) (models.User, error) {
-					return models.User{}, models.ErrUnauthorised
+				us.RefreshSessionFunc = func(r string, client models.SessionClient) (models.User, models.Token, error) {
+					return models.User{}, models.Token{}, models.ErrUnauthorised
 				}
 			},
 		},
@@ -292,8 +258,8 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusUnauthorized,
 			`{"error": "invalid_client"}`,
 			func(*testing.T) {
-				us.refresh = func(r string) (models.User, error) {
-					return models.User{}, models.ErrUnauthorised
+				us.RefreshSessionFunc = func(r string, client models.SessionClient) (models.User, models.Token, error) {
+					return models.User{}, models.Token{}, models.ErrUnauthorised
 				}
 			},
 		},
@@ -304,8 +270,8 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusUnauthorized,
 			`{"error": "invalid_client"}`,
 			func(*testing.T) {
-				us.refresh = func(r string) (models.User, error) {
-					return models.User{}, models.ErrUnauthorised
+				us.RefreshSessionFunc = func(r string, client models.SessionClient) (models.User, models.Token, error) {
+					return models.User{}, models.Token{}, models.ErrUnauthorised
 				}
 			},
 		},
@@ -316,18 +282,13 @@ func TestUsers_Login(t *testing.T) {
 			http.StatusOK,
 			`{"access_token": "test access token", "refresh_token": "test token", "expires_in": 900, "token_type": "bearer"}`,
 			func(t *testing.T) {
-				us.refresh = func(r string) (models.User, error) {
+				us.RefreshSessionFunc = func(r string, client models.SessionClient) (models.User, models.Token, error) {
 					assert.Equal(t, r, "k@sjdhdfgkjsgfkj")
+					assert.Equal(t, "test/1.0", client.UserAgent)
 
 					return models.User{
 						ID: 99,
-					}, nil
-
-				}
-				us.token = func(u *models.User) (models.Token, error) {
-					assert.Equal(t, int64(99), u.ID)
-
-					return models.Token{
+					}, models.Token{
 						RefreshToken: "test token",
 						AccessToken:  "test access token",
 						ExpiresIn:    900,
@@ -336,6 +297,57 @@ func TestUsers_Login(t *testing.T) {
 				}
 			},
 		},
+		{
+			"grantedRemember",
+			"application/x-www-form-urlencoded",
+			"grant_type=password&email=user%40example.com&password=1234luggage&remember=true",
+			http.StatusOK,
+			`{"access_token": "test access token", "refresh_token": "test token", "expires_in": 900, "token_type": "bearer"}`,
+			func(t *testing.T) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
+					return models.User{ID: 99}, nil
+				}
+				us.TokenForFunc = func(u *models.User, opts models.TokenOptions) (models.Token, error) {
+					assert.True(t, opts.Remember, "must remember the login")
+
+					return models.Token{RefreshToken: "test token", AccessToken: "test access token", ExpiresIn: 900, TokenType: "bearer"}, nil
+				}
+			},
+		},
+		{
+			"grantedOfflineAccess",
+			"application/x-www-form-urlencoded",
+			"grant_type=password&email=user%40example.com&password=1234luggage&scope=openid+offline_access",
+			http.StatusOK,
+			`{"access_token": "test access token", "refresh_token": "test token", "expires_in": 900, "token_type": "bearer"}`,
+			func(t *testing.T) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
+					return models.User{ID: 99}, nil
+				}
+				us.TokenForFunc = func(u *models.User, opts models.TokenOptions) (models.Token, error) {
+					assert.True(t, opts.Remember, "must remember the login")
+
+					return models.Token{RefreshToken: "test token", AccessToken: "test access token", ExpiresIn: 900, TokenType: "bearer"}, nil
+				}
+			},
+		},
+		{
+			"grantedNotRemembered",
+			"application/x-www-form-urlencoded",
+			"grant_type=password&email=user%40example.com&password=1234luggage&scope=openid",
+			http.StatusOK,
+			`{"access_token": "test access token", "refresh_token": "test token", "expires_in": 900, "token_type": "bearer"}`,
+			func(t *testing.T) {
+				us.AuthenticateFromFunc = func(username, password string, client models.SessionClient) (models.User, error) {
+					return models.User{ID: 99}, nil
+				}
+				us.TokenForFunc = func(u *models.User, opts models.TokenOptions) (models.Token, error) {
+					assert.False(t, opts.Remember)
+
+					return models.Token{RefreshToken: "test token", AccessToken: "test access token", ExpiresIn: 900, TokenType: "bearer"}, nil
+				}
+			},
+		},
 	}
 
 	for _, cs := range cases {
@@ -345,6 +357,7 @@ func TestUsers_Login(t *testing.T) {
 			c.Request, _ = http.NewRequest("POST", "/api/v1/oauth/token",
 				bytes.NewReader([]byte(cs.content)))
 			c.Request.Header.Add("Content-Type", cs.contentType)
+			c.Request.Header.Add("User-Agent", "test/1.0")
 
 			if cs.setup != nil {
 				cs.setup(t)
@@ -357,205 +370,424 @@ func TestUsers_Login(t *testing.T) {
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*us = testUserService{}
+			*us = modelstest.UserService{}
 		})
 	}
 }
 
-func TestUsers_Create(t *testing.T) {
+func TestUsers_Authorize(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	us := &testUserService{}
-	u := NewUsers(us)
+	us := &modelstest.UserService{
+		AuthenticateFromFunc: func(username, password string, client models.SessionClient) (models.User, error) {
+			if password != "1234luggage" {
+				return models.User{}, models.ErrUnauthorised
+			}
 
-	mux := gin.New()
-	mux.POST("/api/v1/users/", u.Create)
+			return models.User{ID: 99, Email: username}, nil
+		},
+	}
+
+	const params = "client_id=mobile&redirect_uri=app%3A%2Fcb%3Fx%3D1&state=xyz&email=user%40example.com"
 
 	var cases = []struct {
-		name      string
-		input     string
-		outStatus int
-		outJSON   string
-		setup     func(*testing.T)
+		name        string
+		content     string
+		outStatus   int
+		outLocation string
+		outJSON     string
 	}{
 		{
-			"notJSON",
-			"a dalhd lkald fkjahd lfkjasdlf ",
-			http.StatusBadRequest,
-			`{"error":"invalid_json"}`,
-			nil,
+			"granted",
+			params + "&response_type=code&code_challenge=challenge&code_challenge_method=S256&password=1234luggage",
+			http.StatusFound,
+			"app:/cb?code=test+code&state=xyz&x=1",
+			"",
 		},
 		{
-			"validationError",
-			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
-			http.StatusBadRequest,
-			`{"error":"validation_error","fields":{"email":"invalid","password":"required"}}`,
-			func(t *testing.T) {
-				us.create = func(u *models.User) error {
-					user := models.NewUser()
-					user.Email = "someone@somewhere.com"
-					user.FirstName = "John"
-					user.LastName = "Dear"
-
-					assert.Equal(t, &user, u)
-					return models.ValidationError{
-						"email":    models.ErrInvalid,
-						"password": models.ErrRequired,
-					}
-				}
-			},
+			"unknownClient",
+			"client_id=web&redirect_uri=app%3A%2Fcb%3Fx%3D1&response_type=code",
+			http.StatusUnauthorized,
+			"",
+			`{"error": "invalid_client"}`,
 		},
 		{
-			"internalError",
-			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
-			http.StatusInternalServerError,
-			`{"error":"server_error"}`,
-			func(t *testing.T) {
-				us.create = func(u *models.User) error {
-					user := models.NewUser()
-					user.Email = "someone@somewhere.com"
-					user.FirstName = "John"
-					user.LastName = "Dear"
-
-					assert.Equal(t, &user, u)
-					return privateError("test error message")
-				}
-			},
+			"wrongPassword",
+			params + "&response_type=code&code_challenge=challenge&code_challenge_method=S256&password=1234",
+			http.StatusUnauthorized,
+			"",
+			`{"error": "invalid_client"}`,
 		},
 		{
-			"emailTaken",
-			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
-			http.StatusConflict,
-			`{"error":"validation_error","fields":{"email":"is_duplicate","password":"required"}}`,
-			func(t *testing.T) {
-				us.create = func(u *models.User) error {
-					user := models.NewUser()
-					user.Email = "someone@somewhere.com"
-					user.FirstName = "John"
-					user.LastName = "Dear"
-
-					assert.Equal(t, &user, u)
-					return models.ValidationError{
-						"email":    models.ErrDuplicate,
-						"password": models.ErrRequired,
-					}
-				}
-			},
+			"badResponseType",
+			params + "&response_type=token&password=1234luggage",
+			http.StatusFound,
+			"app:/cb?error=unsupported_response_type&state=xyz&x=1",
+			"",
 		},
 		{
-			"ok",
-			`{"active":true,"email":"someone@somewhere.com",
-				"firstName":"John","lastName":"Dear","password":"testpassword","roleId":99,
-				"settings":"a string of preferences"}`,
-			http.StatusCreated,
-			`{"id":88,"active":true,"email":"someone@somewhere.com",
-				"firstName":"John","lastName":"Dear","password":"testpassword","roleId":99,
-				"settings":"a string of preferences"}`,
-			func(t *testing.T) {
-				us.create = func(u *models.User) error {
-					assert.Equal(t, &models.User{
-						Active:    true,
-						Email:     "someone@somewhere.com",
-						FirstName: "John",
-						LastName:  "Dear",
-						Password:  "testpassword",
-						RoleID:    99,
-						Settings:  "a string of preferences",
-					}, u)
-
-					u.ID = 88
-					return nil
-				}
-			},
+			"plainChallenge",
+			params + "&response_type=code&code_challenge=challenge&code_challenge_method=plain&password=1234luggage",
+			http.StatusFound,
+			"app:/cb?error=invalid_request&error_description=code_challenge_method&state=xyz&x=1",
+			"",
+		},
+		{
+			"noChallenge",
+			params + "&response_type=code&code_challenge_method=S256&password=1234luggage",
+			http.StatusFound,
+			"app:/cb?error=invalid_request&error_description=code_challenge&state=xyz&x=1",
+			"",
 		},
 	}
 
 	for _, cs := range cases {
 		t.Run(cs.name, func(t *testing.T) {
-			w := httptest.NewRecorder()
-			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("POST", "/api/v1/users/",
-				bytes.NewReader([]byte(cs.input)))
-			c.Request.Header.Add("Accept", "application/json")
-			c.Request.Header.Add("Content-Type", "application/json")
+			codes := &modelstest.AuthCodeService{
+				ClientFunc: func(clientID, redirectURI string) error {
+					if clientID != "mobile" || redirectURI != "app:/cb?x=1" {
+						return models.ErrUnknownClient
+					}
 
-			if cs.setup != nil {
-				cs.setup(t)
+					return nil
+				},
+				IssueFunc: func(c *models.AuthCode) (string, error) {
+					if c.CodeChallenge == "" {
+						return "", models.ValidationError{"codeChallenge": models.ErrRequired}
+					}
+
+					return "test code", nil
+				},
 			}
+			u := NewUsers(us).WithAuthCodes(codes)
 
-			mux.HandleContext(c)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/api/v1/oauth/authorize",
+				bytes.NewReader([]byte(cs.content)))
+			c.Request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+			u.Authorize(c)
+			c.Writer.WriteHeaderNow()
 
 			res := w.Result()
 			assert.Equal(t, cs.outStatus, res.StatusCode)
-			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
-			assert.JSONEq(t, cs.outJSON, w.Body.String())
-
-			*us = testUserService{}
+			assert.Equal(t, cs.outLocation, res.Header.Get("Location"))
+			if cs.outJSON != "" {
+				assert.JSONEq(t, cs.outJSON, w.Body.String())
+			}
+			if cs.name == "granted" {
+				issued := codes.IssueCalls()
+				if assert.Len(t, issued, 1) {
+					assert.Equal(t, models.AuthCode{
+						UserID:        99,
+						ClientID:      "mobile",
+						RedirectURI:   "app:/cb?x=1",
+						CodeChallenge: "challenge",
+					}, *issued[0].C)
+				}
+			}
 		})
 	}
 
+	t.Run("notSupported", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/api/v1/oauth/authorize",
+			bytes.NewReader([]byte(params+"&response_type=code")))
+		c.Request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		NewUsers(us).Authorize(c)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
 }
 
-func TestUsers_Update(t *testing.T) {
+func TestUsers_LoginAuthorizationCode(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	us := &testUserService{}
-	u := NewUsers(us)
+	us := &modelstest.UserService{
+		TokenForFunc: func(u *models.User, opts models.TokenOptions) (models.Token, error) {
+			assert.Equal(t, int64(99), u.ID)
+			return models.Token{AccessToken: "test access token", TokenType: "bearer"}, nil
+		},
+	}
+	codes := &modelstest.AuthCodeService{
+		ExchangeFunc: func(code, clientID, redirectURI, verifier string) (models.User, error) {
+			if code != "test code" || clientID != "mobile" || redirectURI != "app:/cb" || verifier != "verifier" {
+				return models.User{}, models.ErrInvalidGrant
+			}
 
-	mux := gin.New()
-	mux.PUT("/api/v1/users/:id", u.Update)
+			return models.User{ID: 99}, nil
+		},
+	}
 
 	var cases = []struct {
 		name      string
-		path      string
-		input     string
+		users     *Users
+		content   string
 		outStatus int
 		outJSON   string
-		setup     func(*testing.T)
 	}{
 		{
-			"badPathID",
-			"/api/v1/users/lksdjflk",
-			"",
-			http.StatusNotFound,
-			`{"error":"not_found"}`,
-			nil,
+			"granted",
+			NewUsers(us).WithAuthCodes(codes),
+			"grant_type=authorization_code&code=test+code&client_id=mobile&redirect_uri=app%3A%2Fcb&code_verifier=verifier",
+			http.StatusOK,
+			`{"access_token": "test access token", "token_type": "bearer", "expires_in": 0, "refresh_token": ""}`,
 		},
 		{
-			"notJSON",
-			"/api/v1/users/99",
-			"a dalhd lkald fkjahd lfkjasdlf ",
+			"invalidGrant",
+			NewUsers(us).WithAuthCodes(codes),
+			"grant_type=authorization_code&code=test+code&client_id=mobile&redirect_uri=app%3A%2Fcb&code_verifier=other",
 			http.StatusBadRequest,
-			`{"error":"invalid_json"}`,
-			nil,
+			`{"error": "invalid_grant"}`,
 		},
 		{
-			"notFound",
-			"/api/v1/users/99",
-			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			"notSupported",
+			NewUsers(us),
+			"grant_type=authorization_code&code=test+code",
+			http.StatusBadRequest,
+			`{"error": "unsupported_grant_type"}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/api/v1/oauth/token",
+				bytes.NewReader([]byte(cs.content)))
+			c.Request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+			cs.users.Login(c)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+		})
+	}
+}
+
+func TestUsers_OIDCCallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{
+		TokenForFunc: func(u *models.User, opts models.TokenOptions) (models.Token, error) {
+			assert.Equal(t, int64(99), u.ID)
+			return models.Token{AccessToken: "test access token", TokenType: "bearer"}, nil
+		},
+	}
+	ids := &modelstest.IdentityService{
+		SignInFunc: func(idToken, nonce string) (models.User, error) {
+			switch {
+			case idToken == "" || nonce == "":
+				return models.User{}, models.ErrNoCredentials
+			case nonce != "nonce":
+				return models.User{}, models.ErrUnauthorised
+			case idToken == "id token":
+				return models.User{ID: 99}, nil
+			case idToken == "existing":
+				return models.User{}, models.ErrIdentityNotLinked
+			}
+
+			return models.User{}, models.ErrUnauthorised
+		},
+	}
+
+	var cases = []struct {
+		name        string
+		users       *Users
+		contentType string
+		content     string
+		outStatus   int
+		outJSON     string
+	}{
+		{
+			"signedIn",
+			NewUsers(us).WithIdentities(ids),
+			"application/x-www-form-urlencoded",
+			"id_token=id+token&nonce=nonce",
+			http.StatusOK,
+			`{"access_token": "test access token", "token_type": "bearer", "expires_in": 0, "refresh_token": ""}`,
+		},
+		{
+			"signedInJSON",
+			NewUsers(us).WithIdentities(ids),
+			"application/json",
+			`{"id_token": "id token", "nonce": "nonce"}`,
+			http.StatusOK,
+			`{"access_token": "test access token", "token_type": "bearer", "expires_in": 0, "refresh_token": ""}`,
+		},
+		{
+			"invalidToken",
+			NewUsers(us).WithIdentities(ids),
+			"application/x-www-form-urlencoded",
+			"id_token=forged&nonce=nonce",
+			http.StatusUnauthorized,
+			`{"error": "invalid_client"}`,
+		},
+		{
+			"invalidNonce",
+			NewUsers(us).WithIdentities(ids),
+			"application/x-www-form-urlencoded",
+			"id_token=id+token&nonce=replayed",
+			http.StatusUnauthorized,
+			`{"error": "invalid_client"}`,
+		},
+		{
+			"noNonce",
+			NewUsers(us).WithIdentities(ids),
+			"application/x-www-form-urlencoded",
+			"id_token=id+token",
+			http.StatusBadRequest,
+			`{"error": "invalid_request", "error_description": "credentials_not_provided"}`,
+		},
+		{
+			"notLinked",
+			NewUsers(us).WithIdentities(ids),
+			"application/x-www-form-urlencoded",
+			"id_token=existing&nonce=nonce",
+			http.StatusBadRequest,
+			`{"error": "invalid_request", "error_description": "identity_not_linked"}`,
+		},
+		{
+			"noToken",
+			NewUsers(us).WithIdentities(ids),
+			"application/x-www-form-urlencoded",
+			"",
+			http.StatusBadRequest,
+			`{"error": "invalid_request", "error_description": "credentials_not_provided"}`,
+		},
+		{
+			"notConfigured",
+			NewUsers(us),
+			"application/x-www-form-urlencoded",
+			"id_token=id+token",
 			http.StatusNotFound,
-			`{"error":"not_found"}`,
-			func(t *testing.T) {
-				us.update = func(u *models.User) error {
-					user := models.NewUser()
-					user.ID = 99
-					user.Email = "someone@somewhere.com"
-					user.FirstName = "John"
-					user.LastName = "Dear"
+			`{"error": "not_found"}`,
+		},
+	}
 
-					assert.Equal(t, &user, u)
-					return models.ErrNotFound
-				}
-			},
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/api/v1/oauth/oidc/callback",
+				bytes.NewReader([]byte(cs.content)))
+			c.Request.Header.Add("Content-Type", cs.contentType)
+
+			cs.users.OIDCCallback(c)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+		})
+	}
+}
+
+func TestUsers_OIDCNonce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ids := &modelstest.IdentityService{
+		NonceFunc: func() (string, error) {
+			return "nonce", nil
+		},
+	}
+
+	for name, cs := range map[string]struct {
+		users     *Users
+		outStatus int
+		outJSON   string
+	}{
+		"issued":        {NewUsers(nil).WithIdentities(ids), http.StatusOK, `{"nonce": "nonce"}`},
+		"notConfigured": {NewUsers(nil), http.StatusNotFound, `{"error": "not_found"}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/api/v1/oauth/oidc/nonce", nil)
+
+			cs.users.OIDCNonce(c)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+		})
+	}
+}
+
+func TestUsers_LinkMyIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ids := &modelstest.IdentityService{
+		LinkFunc: func(userID int64, idToken, nonce string) error {
+			assert.Equal(t, int64(999), userID)
+			switch {
+			case nonce != "nonce":
+				return models.ErrUnauthorised
+			case idToken == "taken":
+				return models.ValidationError{"id_token": models.ErrDuplicate}
+			}
+
+			return nil
+		},
+	}
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 999})
+	})
+	mux.POST("/api/v1/me/identities", NewUsers(nil).WithIdentities(ids).LinkMyIdentity)
+
+	var cases = []struct {
+		name      string
+		input     string
+		outStatus int
+		outJSON   string
+	}{
+		{"linked", `{"id_token": "id token", "nonce": "nonce"}`, http.StatusNoContent, ``},
+		{"invalidNonce", `{"id_token": "id token", "nonce": "replayed"}`, http.StatusBadRequest, `{"error": "unauthorised"}`},
+		{"linkedToOther", `{"id_token": "taken", "nonce": "nonce"}`, http.StatusConflict, `{"error": "validation_error", "fields": {"id_token": "is_duplicate"}}`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/me/identities", bytes.NewReader([]byte(cs.input)))
+			req.Header.Set("Content-Type", "application/json")
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			if cs.outJSON != "" {
+				assert.JSONEq(t, cs.outJSON, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUsers_Create(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	u := NewUsers(us)
+
+	mux := gin.New()
+	mux.POST("/api/v1/users/", u.Create)
+
+	var cases = []struct {
+		name      string
+		input     string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"notJSON",
+			"a dalhd lkald fkjahd lfkjasdlf ",
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
 		},
 		{
 			"validationError",
-			"/api/v1/users/99",
 			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
 			http.StatusBadRequest,
 			`{"error":"validation_error","fields":{"email":"invalid","password":"required"}}`,
 			func(t *testing.T) {
-				us.update = func(u *models.User) error {
+				us.CreateFunc = func(u *models.User) error {
 					user := models.NewUser()
-					user.ID = 99
 					user.Email = "someone@somewhere.com"
 					user.FirstName = "John"
 					user.LastName = "Dear"
@@ -569,66 +801,64 @@ func TestUsers_Update(t *testing.T) {
 			},
 		},
 		{
-			"cannotChangeAdmin",
-			"/api/v1/users/1",
+			"internalError",
 			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
-			http.StatusConflict,
-			`{"error":"read_only"}`,
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				us.update = func(u *models.User) error {
+				us.CreateFunc = func(u *models.User) error {
 					user := models.NewUser()
-					user.ID = 1
 					user.Email = "someone@somewhere.com"
 					user.FirstName = "John"
 					user.LastName = "Dear"
 
 					assert.Equal(t, &user, u)
-					return models.ErrReadOnly
+					return privateError("test error message")
 				}
 			},
 		},
 		{
-			"emailAlreadyUsed",
-			"/api/v1/users/1",
+			"emailTaken",
 			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
 			http.StatusConflict,
-			`{"error":"validation_error", "fields":{"email":"is_duplicate"}}`,
+			`{"error":"validation_error","fields":{"email":"is_duplicate","password":"required"}}`,
 			func(t *testing.T) {
-				us.update = func(u *models.User) error {
+				us.CreateFunc = func(u *models.User) error {
 					user := models.NewUser()
-					user.ID = 1
 					user.Email = "someone@somewhere.com"
 					user.FirstName = "John"
 					user.LastName = "Dear"
 
 					assert.Equal(t, &user, u)
-					return models.ValidationError{"email": models.ErrDuplicate}
+					return models.ValidationError{
+						"email":    models.ErrDuplicate,
+						"password": models.ErrRequired,
+					}
 				}
 			},
 		},
 		{
 			"ok",
-			"/api/v1/users/99",
 			`{"active":true,"email":"someone@somewhere.com",
 				"firstName":"John","lastName":"Dear","password":"testpassword","roleId":99,
-				"settings":"a string of preferences"}`,
-			http.StatusOK,
-			`{"id":99,"active":true,"email":"someone@somewhere.com",
+				"settings":{"theme":"dark"}}`,
+			http.StatusCreated,
+			`{"id":88,"active":true,"email":"someone@somewhere.com",
 				"firstName":"John","lastName":"Dear","password":"testpassword","roleId":99,
-				"settings":"a string of preferences"}`,
+				"settings":{"theme":"dark"}}`,
 			func(t *testing.T) {
-				us.update = func(u *models.User) error {
+				us.CreateFunc = func(u *models.User) error {
 					assert.Equal(t, &models.User{
-						ID:        99,
 						Active:    true,
 						Email:     "someone@somewhere.com",
 						FirstName: "John",
 						LastName:  "Dear",
 						Password:  "testpassword",
 						RoleID:    99,
-						Settings:  "a string of preferences",
+						Settings:  json.RawMessage(`{"theme":"dark"}`),
 					}, u)
 
+					u.ID = 88
 					return nil
 				}
 			},
@@ -639,7 +869,7 @@ func TestUsers_Update(t *testing.T) {
 		t.Run(cs.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("PUT", cs.path,
+			c.Request, _ = http.NewRequest("POST", "/api/v1/users/",
 				bytes.NewReader([]byte(cs.input)))
 			c.Request.Header.Add("Accept", "application/json")
 			c.Request.Header.Add("Content-Type", "application/json")
@@ -655,22 +885,25 @@ func TestUsers_Update(t *testing.T) {
 			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*us = testUserService{}
+			*us = modelstest.UserService{}
 		})
 	}
+
 }
 
-func TestUsers_Delete(t *testing.T) {
+func TestUsers_Update(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	us := &testUserService{}
+	us := &modelstest.UserService{}
 	u := NewUsers(us)
 
 	mux := gin.New()
-	mux.DELETE("/api/v1/users/:id", u.Delete)
+	mux.PUT("/api/v1/users/:id", u.Update)
 
 	var cases = []struct {
 		name      string
 		path      string
+		ifMatch   string
+		input     string
 		outStatus int
 		outJSON   string
 		setup     func(*testing.T)
@@ -678,53 +911,1350 @@ func TestUsers_Delete(t *testing.T) {
 		{
 			"badPathID",
 			"/api/v1/users/lksdjflk",
+			`"3"`,
+			"",
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			nil,
 		},
 		{
-			"notInStore",
-			"/api/v1/users/999",
+			"notJSON",
+			"/api/v1/users/99",
+			`"3"`,
+			"a dalhd lkald fkjahd lfkjasdlf ",
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"notFound",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
 			http.StatusNotFound,
 			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				us.delete = func(id int64) error {
-					assert.Equal(t, int64(999), id)
-					return models.ErrNotFound
+				us.UpdateFunc = func(u *models.User) error {
+					user := models.NewUser()
+					user.ID = 99
+					user.Version = 3
+					user.Email = "someone@somewhere.com"
+					user.FirstName = "John"
+					user.LastName = "Dear"
+
+					assert.Equal(t, &user, u)
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"validationError",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"email":"invalid","password":"required"}}`,
+			func(t *testing.T) {
+				us.UpdateFunc = func(u *models.User) error {
+					user := models.NewUser()
+					user.ID = 99
+					user.Version = 3
+					user.Email = "someone@somewhere.com"
+					user.FirstName = "John"
+					user.LastName = "Dear"
+
+					assert.Equal(t, &user, u)
+					return models.ValidationError{
+						"email":    models.ErrInvalid,
+						"password": models.ErrRequired,
+					}
+				}
+			},
+		},
+		{
+			"cannotChangeAdmin",
+			"/api/v1/users/1",
+			`"3"`,
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusConflict,
+			`{"error":"read_only"}`,
+			func(t *testing.T) {
+				us.UpdateFunc = func(u *models.User) error {
+					user := models.NewUser()
+					user.ID = 1
+					user.Version = 3
+					user.Email = "someone@somewhere.com"
+					user.FirstName = "John"
+					user.LastName = "Dear"
+
+					assert.Equal(t, &user, u)
+					return models.ErrReadOnly
+				}
+			},
+		},
+		{
+			"emailAlreadyUsed",
+			"/api/v1/users/1",
+			`"3"`,
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusConflict,
+			`{"error":"validation_error", "fields":{"email":"is_duplicate"}}`,
+			func(t *testing.T) {
+				us.UpdateFunc = func(u *models.User) error {
+					user := models.NewUser()
+					user.ID = 1
+					user.Version = 3
+					user.Email = "someone@somewhere.com"
+					user.FirstName = "John"
+					user.LastName = "Dear"
+
+					assert.Equal(t, &user, u)
+					return models.ValidationError{"email": models.ErrDuplicate}
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"active":true,"email":"someone@somewhere.com",
+				"firstName":"John","lastName":"Dear","password":"testpassword","roleId":99,
+				"settings":{"theme":"dark"}}`,
+			http.StatusOK,
+			`{"id":99,"active":true,"email":"someone@somewhere.com",
+				"firstName":"John","lastName":"Dear","password":"testpassword","roleId":99,
+				"settings":{"theme":"dark"}}`,
+			func(t *testing.T) {
+				us.UpdateFunc = func(u *models.User) error {
+					assert.Equal(t, &models.User{
+						ID:        99,
+						Active:    true,
+						Email:     "someone@somewhere.com",
+						FirstName: "John",
+						LastName:  "Dear",
+						Password:  "testpassword",
+						RoleID:    99,
+						Settings:  json.RawMessage(`{"theme":"dark"}`),
+						Version:   3,
+					}, u)
+
+					u.Version = 4
+					return nil
+				}
+			},
+		},
+		{
+			"missingIfMatch",
+			"/api/v1/users/99",
+			"",
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusPreconditionRequired,
+			`{"error":"precondition_required"}`,
+			nil,
+		},
+		{
+			"badIfMatch",
+			"/api/v1/users/99",
+			`"abc"`,
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusPreconditionFailed,
+			`{"error":"conflict"}`,
+			nil,
+		},
+		{
+			"weakIfMatch",
+			"/api/v1/users/99",
+			`W/"3"`,
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusPreconditionFailed,
+			`{"error":"weak_etag"}`,
+			nil,
+		},
+		{
+			"staleVersion",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusPreconditionFailed,
+			`{"error":"conflict"}`,
+			func(t *testing.T) {
+				us.UpdateFunc = func(u *models.User) error {
+					assert.Equal(t, int64(3), u.Version)
+					return models.ErrConflict
+				}
+			},
+		},
+		{
+			"anyVersion",
+			"/api/v1/users/99",
+			"*",
+			`{"email":"someone@somewhere.com","firstName":"John","lastName":"Dear"}`,
+			http.StatusOK,
+			`{"id":99,"active":true,"email":"someone@somewhere.com","firstName":"John","lastName":"Dear",
+				"roleId":2}`,
+			func(t *testing.T) {
+				us.UpdateFunc = func(u *models.User) error {
+					assert.Equal(t, int64(0), u.Version)
+					u.Version = 4
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("PUT", cs.path,
+				bytes.NewReader([]byte(cs.input)))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+			if cs.ifMatch != "" {
+				c.Request.Header.Add("If-Match", cs.ifMatch)
+			}
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			if cs.outStatus == http.StatusOK {
+				assert.Equal(t, `"4"`, res.Header.Get("ETag"))
+			}
+
+			*us = modelstest.UserService{}
+		})
+	}
+}
+
+func TestUsers_Patch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	u := NewUsers(us)
+
+	mux := gin.New()
+	mux.PATCH("/api/v1/users/:id", u.Patch)
+
+	var cases = []struct {
+		name      string
+		path      string
+		ifMatch   string
+		input     string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badPathID",
+			"/api/v1/users/lksdjflk",
+			`"3"`,
+			`{"lastName":"Dear"}`,
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"missingIfMatch",
+			"/api/v1/users/99",
+			"",
+			`{"lastName":"Dear"}`,
+			http.StatusPreconditionRequired,
+			`{"error":"precondition_required"}`,
+			nil,
+		},
+		{
+			"notJSON",
+			"/api/v1/users/99",
+			`"3"`,
+			"a dalhd lkald fkjahd lfkjasdlf ",
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"notObject",
+			"/api/v1/users/99",
+			`"3"`,
+			`["lastName","Dear"]`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"badFieldType",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"lastName":99}`,
+			http.StatusBadRequest,
+			`{"error":"invalid_json"}`,
+			nil,
+		},
+		{
+			"validationError",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"email":"someone"}`,
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"email":"invalid"}}`,
+			func(t *testing.T) {
+				us.UpdatePartialFunc = func(u *models.User, patch []byte) error {
+					return models.ValidationError{"email": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"staleVersion",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"lastName":"Dear"}`,
+			http.StatusPreconditionFailed,
+			`{"error":"conflict"}`,
+			func(t *testing.T) {
+				us.UpdatePartialFunc = func(u *models.User, patch []byte) error {
+					return models.ErrConflict
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/users/99",
+			`"3"`,
+			`{"lastName":"Dear","settings":null}`,
+			http.StatusOK,
+			`{"id":99,"active":true,"email":"someone@somewhere.com",
+				"firstName":"John","lastName":"Dear","roleId":2}`,
+			func(t *testing.T) {
+				us.UpdatePartialFunc = func(u *models.User, patch []byte) error {
+					assert.Equal(t, &models.User{ID: 99, Version: 3}, u)
+					assert.JSONEq(t, `{"lastName":"Dear","settings":null}`, string(patch))
+
+					*u = models.User{
+						ID:        99,
+						Active:    true,
+						Email:     "someone@somewhere.com",
+						FirstName: "John",
+						LastName:  "Dear",
+						RoleID:    2,
+						Version:   4,
+					}
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("PATCH", cs.path,
+				bytes.NewReader([]byte(cs.input)))
+			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+			if cs.ifMatch != "" {
+				c.Request.Header.Add("If-Match", cs.ifMatch)
+			}
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			if cs.outStatus == http.StatusOK {
+				assert.Equal(t, `"4"`, res.Header.Get("ETag"))
+			}
+
+			*us = modelstest.UserService{}
+		})
+	}
+}
+
+func TestUsers_Delete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	u := NewUsers(us)
+
+	mux := gin.New()
+	mux.DELETE("/api/v1/users/:id", u.Delete)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badPathID",
+			"/api/v1/users/lksdjflk",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"notInStore",
+			"/api/v1/users/999",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				us.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(999), id)
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"isAdmin",
+			"/api/v1/users/999",
+			http.StatusConflict,
+			`{"error":"read_only"}`,
+			func(t *testing.T) {
+				us.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(999), id)
+					return models.ErrReadOnly
+				}
+			},
+		},
+		{
+			"storeInternalError",
+			"/api/v1/users/999",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				us.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(999), id)
+					return wrap("test internal error", nil)
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/users/999",
+			http.StatusNoContent,
+			`{}`,
+			func(t *testing.T) {
+				us.DeleteFunc = func(id int64) error {
+					assert.Equal(t, int64(999), id)
+					return nil
+				}
+			},
+		},
+		{
+			"hasRatings",
+			"/api/v1/users/999",
+			http.StatusConflict,
+			`{"error":"in_use"}`,
+			func(t *testing.T) {
+				us.DeleteFunc = func(id int64) error {
+					return models.ErrInUse
+				}
+			},
+		},
+		{
+			"anonymise",
+			"/api/v1/users/999?ratings=anonymise",
+			http.StatusNoContent,
+			`{}`,
+			func(t *testing.T) {
+				us.DeleteWithFunc = func(id int64, d models.UserDeletion) error {
+					assert.Equal(t, int64(999), id)
+					assert.Equal(t, models.UserDeletion{Ratings: models.RatingsAnonymise}, d)
+					return nil
+				}
+			},
+		},
+		{
+			"reassign",
+			"/api/v1/users/999?ratings=reassign&to=3",
+			http.StatusNoContent,
+			`{}`,
+			func(t *testing.T) {
+				us.DeleteWithFunc = func(id int64, d models.UserDeletion) error {
+					assert.Equal(t, int64(999), id)
+					assert.Equal(t, models.UserDeletion{Ratings: models.RatingsReassign, ReassignTo: 3}, d)
+					return nil
+				}
+			},
+		},
+		{
+			"reassignBadTo",
+			"/api/v1/users/999?ratings=reassign&to=alice",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"to":"invalid_parse"}}`,
+			nil,
+		},
+		{
+			"reassignDuplicate",
+			"/api/v1/users/999?ratings=reassign&to=3",
+			http.StatusConflict,
+			`{"error":"validation_error","fields":{"reassignTo":"is_duplicate"}}`,
+			func(t *testing.T) {
+				us.DeleteWithFunc = func(id int64, d models.UserDeletion) error {
+					return models.ValidationError{"reassignTo": models.ErrDuplicate}
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("DELETE", cs.path, nil)
+			c.Request.Header.Add("Accept", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+
+			if res.StatusCode != 204 {
+				assert.JSONEq(t, cs.outJSON, w.Body.String())
+			} else {
+				assert.Equal(t, "", w.Body.String())
+			}
+
+			*us = modelstest.UserService{}
+		})
+	}
+}
+
+func TestUsers_Impersonate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	as := &modelstest.AuditService{}
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, RoleID: 1})
+	})
+	mux.POST("/api/v1/users/:id/impersonate", NewUsers(us).WithAudit(as).Impersonate)
+
+	noAudit := gin.New()
+	noAudit.POST("/api/v1/users/:id/impersonate", NewUsers(us).Impersonate)
+
+	user := func(id int64) (models.User, error) {
+		return models.User{ID: id, Active: true, RoleID: 2}, nil
+	}
+
+	var cases = []struct {
+		name      string
+		mux       *gin.Engine
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"noAudit",
+			noAudit,
+			"/api/v1/users/999/impersonate",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"badPathID",
+			mux,
+			"/api/v1/users/abc/impersonate",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"notFound",
+			mux,
+			"/api/v1/users/999/impersonate",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				us.ByIDFunc = func(id int64) (models.User, error) {
+					return models.User{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"cannotImpersonate",
+			mux,
+			"/api/v1/users/999/impersonate",
+			http.StatusForbidden,
+			`{"error":"cannot_impersonate"}`,
+			func(t *testing.T) {
+				us.ByIDFunc = user
+				us.ImpersonateFunc = func(u, actor *models.User) (models.Token, error) {
+					return models.Token{}, models.ErrCannotImpersonate
+				}
+			},
+		},
+		{
+			"notRecorded",
+			mux,
+			"/api/v1/users/999/impersonate",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				us.ByIDFunc = user
+				us.ImpersonateFunc = func(u, actor *models.User) (models.Token, error) {
+					return models.Token{AccessToken: "impersonation", ExpiresIn: 900, TokenType: "bearer"}, nil
+				}
+				as.RecordFunc = func(e *models.AuditEntry) error {
+					return assert.AnError
+				}
+			},
+		},
+		{
+			"impersonate",
+			mux,
+			"/api/v1/users/999/impersonate",
+			http.StatusOK,
+			`{"access_token":"impersonation","expires_in":900,"refresh_token":"","token_type":"bearer"}`,
+			func(t *testing.T) {
+				us.ByIDFunc = user
+				us.ImpersonateFunc = func(u, actor *models.User) (models.Token, error) {
+					assert.Equal(t, int64(999), u.ID)
+					assert.Equal(t, int64(1), actor.ID)
+					return models.Token{AccessToken: "impersonation", ExpiresIn: 900, TokenType: "bearer"}, nil
+				}
+				as.RecordFunc = func(e *models.AuditEntry) error {
+					assert.Equal(t, int64(1), e.ActorID)
+					assert.Equal(t, models.AuditImpersonate, e.Action)
+					assert.Equal(t, int64(999), *e.UserID)
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", cs.path, nil)
+			req.Header.Add("Accept", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			cs.mux.ServeHTTP(w, req)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+			if cs.outStatus == http.StatusOK {
+				assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			}
+
+			*us = modelstest.UserService{}
+			*as = modelstest.AuditService{}
+		})
+	}
+}
+
+func TestUsers_SetActive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	u := NewUsers(us)
+
+	mux := gin.New()
+	mux.POST("/api/v1/users/:id/deactivate", u.Deactivate)
+	mux.POST("/api/v1/users/:id/activate", u.Activate)
+
+	user := func(active bool) func(int64) (models.User, error) {
+		return func(id int64) (models.User, error) {
+			return models.User{ID: id, Active: active, Email: "test@email.com", FirstName: "Test", RoleID: 2}, nil
+		}
+	}
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badPathID",
+			"/api/v1/users/lksdjflk/deactivate",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"isAdmin",
+			"/api/v1/users/1/deactivate",
+			http.StatusConflict,
+			`{"error":"read_only"}`,
+			func(t *testing.T) {
+				us.DeactivateFunc = func(id int64) error {
+					return models.ErrReadOnly
+				}
+			},
+		},
+		{
+			"notInStore",
+			"/api/v1/users/999/activate",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				us.ActivateFunc = func(id int64) error {
+					return models.ErrNotFound
+				}
+			},
+		},
+		{
+			"deactivate",
+			"/api/v1/users/999/deactivate",
+			http.StatusOK,
+			`{"id":999,"active":false,"email":"test@email.com","firstName":"Test","lastName":"","roleId":2}`,
+			func(t *testing.T) {
+				us.DeactivateFunc = func(id int64) error {
+					assert.Equal(t, int64(999), id)
+					return nil
+				}
+				us.ByIDFunc = user(false)
+			},
+		},
+		{
+			"activate",
+			"/api/v1/users/999/activate",
+			http.StatusOK,
+			`{"id":999,"active":true,"email":"test@email.com","firstName":"Test","lastName":"","roleId":2}`,
+			func(t *testing.T) {
+				us.ActivateFunc = func(id int64) error {
+					assert.Equal(t, int64(999), id)
+					return nil
+				}
+				us.ByIDFunc = user(true)
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", cs.path, nil)
+			c.Request.Header.Add("Accept", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*us = modelstest.UserService{}
+		})
+	}
+}
+
+func TestUsers_Get(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	u := NewUsers(us)
+
+	mux := gin.New()
+	mux.GET("/api/v1/users/:id", u.Get)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badPathID",
+			"/api/v1/users/lksdjflk",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"notInStore",
+			"/api/v1/users/999",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			func(t *testing.T) {
+				us.ByIDFunc = func(id int64) (models.User, error) {
+					assert.Equal(t, int64(999), id)
+					return models.User{}, models.ErrNotFound
+				}
+			},
+		},
+		{
+			"storeInternalError",
+			"/api/v1/users/999",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				us.ByIDFunc = func(id int64) (models.User, error) {
+					assert.Equal(t, int64(999), id)
+					return models.User{}, wrap("test internal error", nil)
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/users/999",
+			http.StatusOK,
+			`{
+				"active":true,
+				"email":"test@email.com",
+				"firstName":"Test",
+				"id":999,
+				"lastName":"User",
+				"role":{
+					"id":88,
+					"label":"testrole",
+					"permissions":[
+						"readUsers",
+						"writeUsers",
+						"readRatings",
+						"writeRatings"
+					]
+				},
+				"roleId":88,
+				"settings":{"theme":"dark"}
+			}`,
+			func(t *testing.T) {
+				us.ByIDFunc = func(id int64) (models.User, error) {
+					assert.Equal(t, int64(999), id)
+					return models.User{
+						ID:        999,
+						Active:    true,
+						Email:     "test@email.com",
+						FirstName: "Test",
+						LastName:  "User",
+						RoleID:    88,
+						Role: &models.Role{
+							ID:          88,
+							Label:       "testrole",
+							Permissions: 15,
+						},
+						Settings: json.RawMessage(`{"theme":"dark"}`),
+					}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+			c.Request.Header.Add("Accept", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*us = modelstest.UserService{}
+		})
+	}
+}
+
+func TestUsers_GetNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	updated := time.Date(2020, 3, 14, 10, 0, 0, 0, time.UTC)
+	us := &modelstest.UserService{
+		ByIDFunc: func(id int64) (models.User, error) {
+			return models.User{ID: id, Email: "test@email.com", RoleID: 2, Version: 3, UpdatedAt: &updated}, nil
+		},
+	}
+
+	mux := gin.New()
+	mux.GET("/api/v1/users/:id", NewUsers(us).Get)
+
+	var cases = []struct {
+		name      string
+		header    string
+		value     string
+		outStatus int
+	}{
+		{"none", "", "", http.StatusOK},
+		{"etag", "If-None-Match", `"3"`, http.StatusNotModified},
+		{"weakETag", "If-None-Match", `W/"3"`, http.StatusNotModified},
+		{"any", "If-None-Match", `*`, http.StatusNotModified},
+		{"otherETag", "If-None-Match", `"2"`, http.StatusOK},
+		{"notModifiedSince", "If-Modified-Since", "Sat, 14 Mar 2020 10:00:00 GMT", http.StatusNotModified},
+		{"modifiedSince", "If-Modified-Since", "Sat, 14 Mar 2020 09:59:59 GMT", http.StatusOK},
+		{"badDate", "If-Modified-Since", "yesterday", http.StatusOK},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/users/999", nil)
+			if cs.header != "" {
+				req.Header.Set(cs.header, cs.value)
+			}
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+			assert.Equal(t, "Sat, 14 Mar 2020 10:00:00 GMT", w.Header().Get("Last-Modified"))
+			if cs.outStatus == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUsers_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	u := NewUsers(us)
+
+	mux := gin.New()
+	mux.GET("/api/v1/users/", u.List)
+
+	var cases = []struct {
+		name      string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badQueryID",
+			"/api/v1/users/?id=kdfjhgkhjlsfg",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"id": "invalid_parse"}}`,
+			nil,
+		},
+		{
+			"badQueryID2",
+			"/api/v1/users/?id=kdfjhg,khjlsfg",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"id": "invalid_parse"}}`,
+			nil,
+		},
+		{
+			"notInStore",
+			"/api/v1/users/?id=999,1000",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				us.ByIDsFunc = func(id ...int64) ([]models.User, error) {
+					assert.Equal(t, []int64{999, 1000}, id)
+					return nil, nil
+				}
+			},
+		},
+		{
+			"storeInternalError",
+			"/api/v1/users/?id=999",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				us.ByIDsFunc = func(id ...int64) ([]models.User, error) {
+					assert.Equal(t, []int64{999}, id)
+					return nil, wrap("test internal error", nil)
+				}
+			},
+		},
+		{
+			"ok",
+			"/api/v1/users/?id=999,888",
+			http.StatusOK,
+			`{"items":[{
+				"active":true,
+				"email":"test@email.com",
+				"firstName":"Test",
+				"id":999,
+				"lastName":"User",
+				"role":{
+					"id":88,
+					"label":"testrole",
+					"permissions":[
+						"readUsers",
+						"writeUsers",
+						"readRatings",
+						"writeRatings"
+					]
+				},
+				"roleId":88,
+				"settings":{"theme":"dark"}
+			}]}`,
+			func(t *testing.T) {
+				us.ByIDsFunc = func(id ...int64) ([]models.User, error) {
+					assert.Equal(t, []int64{999, 888}, id)
+					return []models.User{
+						{
+							ID:        999,
+							Active:    true,
+							Email:     "test@email.com",
+							FirstName: "Test",
+							LastName:  "User",
+							RoleID:    88,
+							Role: &models.Role{
+								ID:          88,
+								Label:       "testrole",
+								Permissions: 15,
+							},
+							Settings: json.RawMessage(`{"theme":"dark"}`),
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			"okBlankID",
+			"/api/v1/users/?id=",
+			http.StatusOK,
+			`{"items":[{
+				"active":true,
+				"email":"test@email.com",
+				"firstName":"Test",
+				"id":999,
+				"lastName":"User",
+				"role":{
+					"id":88,
+					"label":"testrole",
+					"permissions":[
+						"readUsers",
+						"writeUsers",
+						"readRatings",
+						"writeRatings"
+					]
+				},
+				"roleId":88,
+				"settings":{"theme":"dark"}
+			}]}`,
+			func(t *testing.T) {
+				us.ByIDsFunc = func(id ...int64) ([]models.User, error) {
+					assert.Len(t, id, 0)
+					return []models.User{
+						{
+							ID:        999,
+							Active:    true,
+							Email:     "test@email.com",
+							FirstName: "Test",
+							LastName:  "User",
+							RoleID:    88,
+							Role: &models.Role{
+								ID:          88,
+								Label:       "testrole",
+								Permissions: 15,
+							},
+							Settings: json.RawMessage(`{"theme":"dark"}`),
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			"badQueryActive",
+			"/api/v1/users/?active=maybe",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"active": "invalid_parse"}}`,
+			nil,
+		},
+		{
+			"badQueryRoleID",
+			"/api/v1/users/?q=alice&roleId=admin",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"roleId": "invalid_parse"}}`,
+			nil,
+		},
+		{
+			"searchInvalidSort",
+			"/api/v1/users/?sort=password",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"sort": "invalid"}}`,
+			func(t *testing.T) {
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					return nil, models.ValidationError{"sort": models.ErrInvalid}
+				}
+			},
+		},
+		{
+			"searchNotFound",
+			"/api/v1/users/?q=nobody",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					return nil, nil
+				}
+			},
+		},
+		{
+			"searchOk",
+			"/api/v1/users/?id=999,888&q=alice&active=true&roleId=2&sort=-email",
+			http.StatusOK,
+			`{"items":[{
+				"active":true,
+				"email":"alice@email.com",
+				"firstName":"Alice",
+				"id":999,
+				"lastName":"User",
+				"roleId":2
+			}]}`,
+			func(t *testing.T) {
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					active := true
+					assert.Equal(t, models.SearchQuery{
+						IDs:    []int64{999, 888},
+						Q:      "alice",
+						Active: &active,
+						RoleID: 2,
+						Sort:   "-email",
+					}, q)
+
+					return []models.User{
+						{
+							ID:        999,
+							Active:    true,
+							Email:     "alice@email.com",
+							FirstName: "Alice",
+							LastName:  "User",
+							RoleID:    2,
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			"fields",
+			"/api/v1/users/?id=999&fields=id,email,firstName",
+			http.StatusOK,
+			`{"items":[{"email":"alice@email.com","firstName":"Alice","id":999}]}`,
+			func(t *testing.T) {
+				us.ByIDsFunc = func(ids ...int64) ([]models.User, error) {
+					return []models.User{
+						{
+							ID:        999,
+							Active:    true,
+							Email:     "alice@email.com",
+							FirstName: "Alice",
+							LastName:  "User",
+							RoleID:    2,
+							Settings:  json.RawMessage(`{"theme":"dark"}`),
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			"expandInvalid",
+			"/api/v1/users/?expand=role,user",
+			http.StatusBadRequest,
+			`{"error":"validation_error","fields":{"expand": "invalid"}}`,
+			nil,
+		},
+		{
+			"expandRole",
+			"/api/v1/users/?id=999&expand=role",
+			http.StatusOK,
+			`{"items":[{
+				"active":true,
+				"email":"alice@email.com",
+				"firstName":"Alice",
+				"id":999,
+				"lastName":"User",
+				"roleId":2,
+				"role":{"id":2,"label":"reviewer","permissions":["readUsers","writeUsers","readRatings","writeRatings"]}
+			}]}`,
+			func(t *testing.T) {
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					roles := true
+					assert.Equal(t, models.SearchQuery{IDs: []int64{999}, Roles: &roles}, q)
+
+					return []models.User{
+						{
+							ID:        999,
+							Active:    true,
+							Email:     "alice@email.com",
+							FirstName: "Alice",
+							LastName:  "User",
+							RoleID:    2,
+							Role:      &models.Role{ID: 2, Label: "reviewer", Permissions: 15},
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			"expandNone",
+			"/api/v1/users/?q=alice&expand=",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				us.SearchFunc = func(q models.SearchQuery) ([]models.User, error) {
+					roles := false
+					assert.Equal(t, models.SearchQuery{Q: "alice", Roles: &roles}, q)
+					return nil, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+			c.Request.Header.Add("Accept", "application/json")
+
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			mux.HandleContext(c)
+
+			res := w.Result()
+			assert.Equal(t, cs.outStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+
+			*us = modelstest.UserService{}
+		})
+	}
+}
+
+func TestUsers_Sessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	us := &modelstest.UserService{}
+	u := NewUsers(us)
+
+	mux := gin.New()
+	mux.GET("/api/v1/users/:id/sessions", u.Sessions)
+	mux.DELETE("/api/v1/users/:id/sessions", u.RevokeSessions)
+	mux.DELETE("/api/v1/users/:id/sessions/:sid", u.RevokeSession)
+
+	var cases = []struct {
+		name      string
+		method    string
+		path      string
+		outStatus int
+		outJSON   string
+		setup     func(*testing.T)
+	}{
+		{
+			"badPathID",
+			"GET",
+			"/api/v1/users/lksdjflk/sessions",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+			nil,
+		},
+		{
+			"disabled",
+			"GET",
+			"/api/v1/users/999/sessions",
+			http.StatusNotImplemented,
+			`{"error":"sessions_disabled"}`,
+			func(t *testing.T) {
+				us.SessionsFunc = func(id int64) ([]models.Session, error) {
+					return nil, models.ErrSessionsDisabled
+				}
+			},
+		},
+		{
+			"listEmpty",
+			"GET",
+			"/api/v1/users/999/sessions",
+			http.StatusOK,
+			`{"items":[]}`,
+			func(t *testing.T) {
+				us.SessionsFunc = func(id int64) ([]models.Session, error) {
+					assert.Equal(t, int64(999), id)
+					return nil, nil
+				}
+			},
+		},
+		{
+			"list",
+			"GET",
+			"/api/v1/users/999/sessions",
+			http.StatusOK,
+			`{"items":[{"id":"abc","userId":999,"userAgent":"test/1.0","createdAt":"2019-10-01T10:00:00Z","lastUsedAt":"2019-10-02T10:00:00Z","expiresAt":"2019-10-12T10:00:00Z"}]}`,
+			func(t *testing.T) {
+				us.SessionsFunc = func(id int64) ([]models.Session, error) {
+					return []models.Session{{
+						ID:         "abc",
+						UserID:     999,
+						UserAgent:  "test/1.0",
+						CreatedAt:  time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC),
+						LastUsedAt: time.Date(2019, 10, 2, 10, 0, 0, 0, time.UTC),
+						ExpiresAt:  time.Date(2019, 10, 12, 10, 0, 0, 0, time.UTC),
+					}}, nil
+				}
+			},
+		},
+		{
+			"listInternalError",
+			"GET",
+			"/api/v1/users/999/sessions",
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+			func(t *testing.T) {
+				us.SessionsFunc = func(id int64) ([]models.Session, error) {
+					return nil, wrap("test internal error", nil)
 				}
 			},
 		},
 		{
-			"isAdmin",
-			"/api/v1/users/999",
-			http.StatusConflict,
-			`{"error":"read_only"}`,
+			"revokeNotFound",
+			"DELETE",
+			"/api/v1/users/999/sessions/abc",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				us.delete = func(id int64) error {
-					assert.Equal(t, int64(999), id)
-					return models.ErrReadOnly
+				us.RevokeSessionFunc = func(id int64, sid string) error {
+					return models.ErrNotFound
 				}
 			},
 		},
 		{
-			"storeInternalError",
-			"/api/v1/users/999",
-			http.StatusInternalServerError,
-			`{"error":"server_error"}`,
+			"revoke",
+			"DELETE",
+			"/api/v1/users/999/sessions/abc",
+			http.StatusNoContent,
+			``,
 			func(t *testing.T) {
-				us.delete = func(id int64) error {
+				us.RevokeSessionFunc = func(id int64, sid string) error {
 					assert.Equal(t, int64(999), id)
-					return wrap("test internal error", nil)
+					assert.Equal(t, "abc", sid)
+					return nil
 				}
 			},
 		},
 		{
-			"ok",
-			"/api/v1/users/999",
+			"revokeAll",
+			"DELETE",
+			"/api/v1/users/999/sessions",
 			http.StatusNoContent,
-			`{}`,
+			``,
 			func(t *testing.T) {
-				us.delete = func(id int64) error {
+				us.RevokeSessionsFunc = func(id int64) error {
 					assert.Equal(t, int64(999), id)
 					return nil
 				}
@@ -736,7 +2266,7 @@ func TestUsers_Delete(t *testing.T) {
 		t.Run(cs.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("DELETE", cs.path, nil)
+			c.Request, _ = http.NewRequest(cs.method, cs.path, nil)
 			c.Request.Header.Add("Accept", "application/json")
 
 			if cs.setup != nil {
@@ -747,7 +2277,6 @@ func TestUsers_Delete(t *testing.T) {
 
 			res := w.Result()
 			assert.Equal(t, cs.outStatus, res.StatusCode)
-			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
 
 			if res.StatusCode != 204 {
 				assert.JSONEq(t, cs.outJSON, w.Body.String())
@@ -755,97 +2284,129 @@ func TestUsers_Delete(t *testing.T) {
 				assert.Equal(t, "", w.Body.String())
 			}
 
-			*us = testUserService{}
+			*us = modelstest.UserService{}
 		})
 	}
 }
 
-func TestUsers_Get(t *testing.T) {
+func TestUsers_MyPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	u := NewUsers(&modelstest.UserService{})
+
+	var cases = []struct {
+		name    string
+		user    models.User
+		outJSON string
+	}{
+		{
+			"permissions",
+			models.User{ID: 7, RoleID: 3, Role: &models.Role{ID: 3, Permissions: models.PermissionReadRatings | models.PermissionWriteOwnRatings}},
+			`{"permissions":["readRatings","writeOwnRatings"],"admin":false}`,
+		},
+		{
+			"admin",
+			models.User{ID: 1, RoleID: 1, Role: &models.Role{ID: 1, Permissions: -1}},
+			`{"permissions":["readUsers","writeUsers","readRatings","writeRatings","writeOwnRatings"],"admin":true}`,
+		},
+		{
+			"noRole",
+			models.User{ID: 7, RoleID: 2},
+			`{"permissions":[],"admin":false}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			mux := gin.New()
+			mux.GET("/api/v1/me/permissions", func(c *gin.Context) {
+				c.Set("user", &cs.user)
+			}, u.MyPermissions)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/api/v1/me/permissions", nil)
+			mux.HandleContext(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, cs.outJSON, w.Body.String())
+		})
+	}
+}
+
+func TestUsers_MySessions(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	us := &testUserService{}
+	us := &modelstest.UserService{}
 	u := NewUsers(us)
 
 	mux := gin.New()
-	mux.GET("/api/v1/users/:id", u.Get)
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 999})
+	})
+	mux.GET("/api/v1/me/sessions", u.MySessions)
+	mux.DELETE("/api/v1/me/sessions/:sid", u.RevokeMySession)
 
 	var cases = []struct {
 		name      string
+		method    string
 		path      string
 		outStatus int
 		outJSON   string
 		setup     func(*testing.T)
 	}{
 		{
-			"badPathID",
-			"/api/v1/users/lksdjflk",
-			http.StatusNotFound,
-			`{"error":"not_found"}`,
-			nil,
+			"disabled",
+			"GET",
+			"/api/v1/me/sessions",
+			http.StatusNotImplemented,
+			`{"error":"sessions_disabled"}`,
+			func(t *testing.T) {
+				us.SessionsFunc = func(id int64) ([]models.Session, error) {
+					return nil, models.ErrSessionsDisabled
+				}
+			},
 		},
 		{
-			"notInStore",
-			"/api/v1/users/999",
-			http.StatusNotFound,
-			`{"error":"not_found"}`,
+			"list",
+			"GET",
+			"/api/v1/me/sessions",
+			http.StatusOK,
+			`{"items":[{"id":"abc","userId":999,"createdAt":"2019-10-01T10:00:00Z","lastUsedAt":"2019-10-01T10:00:00Z","expiresAt":"2019-10-11T10:00:00Z"}]}`,
 			func(t *testing.T) {
-				us.byID = func(id int64) (models.User, error) {
+				us.SessionsFunc = func(id int64) ([]models.Session, error) {
 					assert.Equal(t, int64(999), id)
-					return models.User{}, models.ErrNotFound
+					return []models.Session{{
+						ID:         "abc",
+						UserID:     999,
+						CreatedAt:  time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC),
+						LastUsedAt: time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC),
+						ExpiresAt:  time.Date(2019, 10, 11, 10, 0, 0, 0, time.UTC),
+					}}, nil
 				}
 			},
 		},
 		{
-			"storeInternalError",
-			"/api/v1/users/999",
-			http.StatusInternalServerError,
-			`{"error":"server_error"}`,
+			"revokeNotFound",
+			"DELETE",
+			"/api/v1/me/sessions/abc",
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
 			func(t *testing.T) {
-				us.byID = func(id int64) (models.User, error) {
-					assert.Equal(t, int64(999), id)
-					return models.User{}, wrap("test internal error", nil)
+				us.RevokeSessionFunc = func(id int64, sid string) error {
+					return models.ErrNotFound
 				}
 			},
 		},
 		{
-			"ok",
-			"/api/v1/users/999",
-			http.StatusOK,
-			`{
-				"active":true,
-				"email":"test@email.com",
-				"firstName":"Test",
-				"id":999,
-				"lastName":"User",
-				"role":{
-					"id":88,
-					"label":"testrole",
-					"permissions":[
-						"readUsers",
-						"writeUsers",
-						"readRatings",
-						"writeRatings"
-					]
-				},
-				"roleId":88,
-				"settings":"settings_string"
-			}`,
+			"revoke",
+			"DELETE",
+			"/api/v1/me/sessions/abc",
+			http.StatusNoContent,
+			``,
 			func(t *testing.T) {
-				us.byID = func(id int64) (models.User, error) {
+				us.RevokeSessionFunc = func(id int64, sid string) error {
 					assert.Equal(t, int64(999), id)
-					return models.User{
-						ID:        999,
-						Active:    true,
-						Email:     "test@email.com",
-						FirstName: "Test",
-						LastName:  "User",
-						RoleID:    88,
-						Role: &models.Role{
-							ID:          88,
-							Label:       "testrole",
-							Permissions: 15,
-						},
-						Settings: "settings_string",
-					}, nil
+					assert.Equal(t, "abc", sid)
+					return nil
 				}
 			},
 		},
@@ -855,7 +2416,7 @@ func TestUsers_Get(t *testing.T) {
 		t.Run(cs.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+			c.Request, _ = http.NewRequest(cs.method, cs.path, nil)
 			c.Request.Header.Add("Accept", "application/json")
 
 			if cs.setup != nil {
@@ -866,154 +2427,170 @@ func TestUsers_Get(t *testing.T) {
 
 			res := w.Result()
 			assert.Equal(t, cs.outStatus, res.StatusCode)
-			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
-			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*us = testUserService{}
+			if res.StatusCode != 204 {
+				assert.JSONEq(t, cs.outJSON, w.Body.String())
+			} else {
+				assert.Equal(t, "", w.Body.String())
+			}
+
+			*us = modelstest.UserService{}
 		})
 	}
 }
 
-func TestUsers_List(t *testing.T) {
+func TestUsers_MySettings(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	us := &testUserService{}
+	us := &modelstest.UserService{}
 	u := NewUsers(us)
 
 	mux := gin.New()
-	mux.GET("/api/v1/users/", u.List)
+	mux.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 999})
+	})
+	mux.GET("/api/v1/me/settings", u.MySettings)
+	mux.PUT("/api/v1/me/settings", u.ReplaceMySettings)
+	mux.PATCH("/api/v1/me/settings", u.PatchMySettings)
+
+	stored := models.User{ID: 999, Active: true, Email: "test@address.com", FirstName: "Test", RoleID: 2,
+		Settings: json.RawMessage(`{"theme":"dark","lang":"en"}`), Version: 3}
 
 	var cases = []struct {
 		name      string
-		path      string
+		method    string
+		ifMatch   string
+		body      string
 		outStatus int
+		outETag   string
 		outJSON   string
 		setup     func(*testing.T)
 	}{
 		{
-			"badQueryID",
-			"/api/v1/users/?id=kdfjhgkhjlsfg",
-			http.StatusBadRequest,
-			`{"error":"validation_error","fields":{"id": "invalid_parse"}}`,
+			"get",
+			"GET",
+			"",
+			"",
+			http.StatusOK,
+			`"3"`,
+			`{"theme":"dark","lang":"en"}`,
+			func(t *testing.T) {
+				us.ByIDFunc = func(id int64) (models.User, error) {
+					assert.Equal(t, int64(999), id)
+					return stored, nil
+				}
+			},
+		},
+		{
+			"getEmpty",
+			"GET",
+			"",
+			"",
+			http.StatusOK,
+			`"1"`,
+			`{}`,
+			func(t *testing.T) {
+				us.ByIDFunc = func(id int64) (models.User, error) {
+					return models.User{ID: 999, Version: 1}, nil
+				}
+			},
+		},
+		{
+			"replaceNoIfMatch",
+			"PUT",
+			"",
+			`{"theme":"light"}`,
+			http.StatusPreconditionRequired,
+			"",
+			`{"error":"precondition_required"}`,
 			nil,
 		},
 		{
-			"badQueryID2",
-			"/api/v1/users/?id=kdfjhg,khjlsfg",
+			"replaceNotObject",
+			"PUT",
+			`"3"`,
+			`["theme"]`,
 			http.StatusBadRequest,
-			`{"error":"validation_error","fields":{"id": "invalid_parse"}}`,
+			"",
+			`{"error":"invalid_json"}`,
 			nil,
 		},
 		{
-			"notInStore",
-			"/api/v1/users/?id=999,1000",
+			"replace",
+			"PUT",
+			`"3"`,
+			`{"theme":"light"}`,
 			http.StatusOK,
-			`{"items":[]}`,
+			`"4"`,
+			`{"theme":"light"}`,
 			func(t *testing.T) {
-				us.byIDs = func(id ...int64) ([]models.User, error) {
-					assert.Equal(t, []int64{999, 1000}, id)
-					return nil, nil
+				us.ByIDFunc = func(id int64) (models.User, error) {
+					return stored, nil
+				}
+				us.UpdateFunc = func(u *models.User) error {
+					assert.Equal(t, int64(999), u.ID)
+					assert.Equal(t, "test@address.com", u.Email, "must keep the other fields")
+					assert.JSONEq(t, `{"theme":"light"}`, string(u.Settings))
+					assert.Equal(t, int64(3), u.Version)
+
+					u.Version = 4
+					return nil
 				}
 			},
 		},
 		{
-			"storeInternalError",
-			"/api/v1/users/?id=999",
-			http.StatusInternalServerError,
-			`{"error":"server_error"}`,
+			"patchTooLong",
+			"PATCH",
+			"",
+			`{"theme":"light"}`,
+			http.StatusBadRequest,
+			"",
+			`{"error":"validation_error","fields":{"settings":"too_long"}}`,
 			func(t *testing.T) {
-				us.byIDs = func(id ...int64) ([]models.User, error) {
-					assert.Equal(t, []int64{999}, id)
-					return nil, wrap("test internal error", nil)
+				us.UpdatePartialFunc = func(u *models.User, patch []byte) error {
+					return models.ValidationError{"settings": models.ErrTooLong}
 				}
 			},
 		},
 		{
-			"ok",
-			"/api/v1/users/?id=999,888",
-			http.StatusOK,
-			`{"items":[{
-				"active":true,
-				"email":"test@email.com",
-				"firstName":"Test",
-				"id":999,
-				"lastName":"User",
-				"role":{
-					"id":88,
-					"label":"testrole",
-					"permissions":[
-						"readUsers",
-						"writeUsers",
-						"readRatings",
-						"writeRatings"
-					]
-				},
-				"roleId":88,
-				"settings":"settings_string"
-			}]}`,
+			"patchConflict",
+			"PATCH",
+			`"2"`,
+			`{"theme":"light"}`,
+			http.StatusPreconditionFailed,
+			"",
+			`{"error":"conflict"}`,
 			func(t *testing.T) {
-				us.byIDs = func(id ...int64) ([]models.User, error) {
-					assert.Equal(t, []int64{999, 888}, id)
-					return []models.User{
-						{
-							ID:        999,
-							Active:    true,
-							Email:     "test@email.com",
-							FirstName: "Test",
-							LastName:  "User",
-							RoleID:    88,
-							Role: &models.Role{
-								ID:          88,
-								Label:       "testrole",
-								Permissions: 15,
-							},
-							Settings: "settings_string",
-						},
-					}, nil
+				calls := 0
+				us.UpdatePartialFunc = func(u *models.User, patch []byte) error {
+					calls++
+					assert.Equal(t, 1, calls, "must not merge again when the version is given")
+					return models.ErrConflict
 				}
 			},
 		},
 		{
-			"okBlankID",
-			"/api/v1/users/?id=",
+			"patch",
+			"PATCH",
+			"",
+			`{"theme":"light","lang":null}`,
 			http.StatusOK,
-			`{"items":[{
-				"active":true,
-				"email":"test@email.com",
-				"firstName":"Test",
-				"id":999,
-				"lastName":"User",
-				"role":{
-					"id":88,
-					"label":"testrole",
-					"permissions":[
-						"readUsers",
-						"writeUsers",
-						"readRatings",
-						"writeRatings"
-					]
-				},
-				"roleId":88,
-				"settings":"settings_string"
-			}]}`,
+			`"4"`,
+			`{"theme":"light"}`,
 			func(t *testing.T) {
-				us.byIDs = func(id ...int64) ([]models.User, error) {
-					assert.Len(t, id, 0)
-					return []models.User{
-						{
-							ID:        999,
-							Active:    true,
-							Email:     "test@email.com",
-							FirstName: "Test",
-							LastName:  "User",
-							RoleID:    88,
-							Role: &models.Role{
-								ID:          88,
-								Label:       "testrole",
-								Permissions: 15,
-							},
-							Settings: "settings_string",
-						},
-					}, nil
+				calls := 0
+				us.UpdatePartialFunc = func(u *models.User, patch []byte) error {
+					calls++
+					assert.Equal(t, &models.User{ID: 999}, u)
+					assert.JSONEq(t, `{"settings":{"theme":"light","lang":null}}`, string(patch))
+
+					// changed by another request in between the first time
+					if calls == 1 {
+						return models.ErrConflict
+					}
+
+					u.Settings = json.RawMessage(`{"theme":"light"}`)
+					u.Version = 4
+					return nil
 				}
 			},
 		},
@@ -1023,8 +2600,12 @@ func TestUsers_List(t *testing.T) {
 		t.Run(cs.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
-			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+			c.Request, _ = http.NewRequest(cs.method, "/api/v1/me/settings", bytes.NewBufferString(cs.body))
 			c.Request.Header.Add("Accept", "application/json")
+			c.Request.Header.Add("Content-Type", "application/json")
+			if cs.ifMatch != "" {
+				c.Request.Header.Add("If-Match", cs.ifMatch)
+			}
 
 			if cs.setup != nil {
 				cs.setup(t)
@@ -1032,12 +2613,11 @@ func TestUsers_List(t *testing.T) {
 
 			mux.HandleContext(c)
 
-			res := w.Result()
-			assert.Equal(t, cs.outStatus, res.StatusCode)
-			assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+			assert.Equal(t, cs.outStatus, w.Code)
+			assert.Equal(t, cs.outETag, w.Header().Get("ETag"))
 			assert.JSONEq(t, cs.outJSON, w.Body.String())
 
-			*us = testUserService{}
+			*us = modelstest.UserService{}
 		})
 	}
 }
@@ -1,10 +1,24 @@
 /*
 Package errors provides utilities that make it easier to wrap and unwrap errors
 throughout the project.
+
+Wrapped errors capture the stack where the first error of a chain was wrapped,
+and can carry key-value pairs describing their context, see With. Both are meant
+for logs: they are retrieved with Stack and Fields, and are never part of the
+message returned by Error, so they do not reach API responses.
 */
 package errors
 
-import "golang.org/x/xerrors"
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// maxStackDepth is the maximum number of frames captured in a stack.
+const maxStackDepth = 32
 
 // FuncWrap is a function that wraps the err argument with the msg message,
 // returning the wrapped error. When err is nil, the function will create a new
@@ -15,20 +29,142 @@ type FuncWrap func(msg string, err error) error
 // to the error results.
 func Wrapper(pkg string) FuncWrap {
 	return func(msg string, err error) error {
-		if err == nil {
-			return xerrors.Errorf(pkg + ": " + msg)
-		}
-
-		return xerrors.Errorf(pkg+": "+msg+": %w", err)
+		return newWrapped(pkg+": "+msg, err, nil)
 	}
 }
 
 // WrapInternal wraps the err argument with the msg message without prepending
 // any package information.
 func WrapInternal(msg string, err error) error {
+	return newWrapped(msg, err, nil)
+}
+
+// With attaches key-value pairs to err, like a user or target ID, so they are
+// logged along with it. keyvals alternates string keys and their values. The
+// message of err is not modified. nil is returned if err is nil.
+func With(err error, keyvals ...interface{}) error {
 	if err == nil {
-		return xerrors.Errorf(msg)
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+	}
+
+	return newWrapped("", err, fields)
+}
+
+// Fields returns the key-value pairs attached with With to err or any of the
+// errors it wraps. When a key is attached more than once, the outermost value
+// is kept.
+func Fields(err error) map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	for ; err != nil; err = xerrors.Unwrap(err) {
+		w, ok := err.(*wrapped)
+		if !ok {
+			continue
+		}
+
+		for k, v := range w.fields {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		}
+	}
+
+	return fields
+}
+
+// Stack returns the stack captured when the first error of the chain of err was
+// wrapped, one "function file:line" frame per line. It is empty if err was not
+// wrapped by this package.
+func Stack(err error) string {
+	var b strings.Builder
+
+	frames := runtime.CallersFrames(stackOf(err))
+	for {
+		f, more := frames.Next()
+		if f.Function != "" {
+			fmt.Fprintf(&b, "%s %s:%d\n", f.Function, f.File, f.Line)
+		}
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
+
+// wrapped is an error wrapped by this package.
+type wrapped struct {
+	// msg is prepended to the message of err. When empty, the message
+	// of err is kept.
+	msg string
+	err error
+
+	// stack is only captured by the innermost wrapped error of a chain.
+	stack  []uintptr
+	fields map[string]interface{}
+}
+
+func newWrapped(msg string, err error, fields map[string]interface{}) *wrapped {
+	w := &wrapped{msg: msg, err: err, fields: fields}
+
+	if stackOf(err) == nil {
+		// skip runtime.Callers, newWrapped and its caller in this package
+		pcs := make([]uintptr, maxStackDepth)
+		n := runtime.Callers(3, pcs)
+		w.stack = pcs[:n]
+	}
+
+	return w
+}
+
+// Error returns the message of the error, prefixed with the messages of the
+// errors wrapping it.
+func (w *wrapped) Error() string {
+	switch {
+	case w.err == nil:
+		return w.msg
+	case w.msg == "":
+		return w.err.Error()
+	}
+
+	return w.msg + ": " + w.err.Error()
+}
+
+// Unwrap returns the wrapped error, so it can be matched with xerrors.Is and
+// xerrors.As.
+func (w *wrapped) Unwrap() error {
+	return w.err
+}
+
+// Format prints the stack and the fields of the error after its message when
+// formatted with %+v.
+func (w *wrapped) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprint(s, w.Error())
+		if fields := Fields(w); len(fields) > 0 {
+			fmt.Fprintf(s, " %v", fields)
+		}
+		fmt.Fprint(s, "\n", Stack(w))
+		return
+	}
+
+	fmt.Fprint(s, w.Error())
+}
+
+// stackOf returns the stack captured by the innermost wrapped error of the
+// chain of err.
+func stackOf(err error) []uintptr {
+	var stack []uintptr
+	for ; err != nil; err = xerrors.Unwrap(err) {
+		if w, ok := err.(*wrapped); ok && w.stack != nil {
+			stack = w.stack
+		}
 	}
 
-	return xerrors.Errorf(msg+": %w", err)
+	return stack
 }
@@ -0,0 +1,67 @@
+package errors
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+var errTest = xerrors.New("cause")
+
+func TestWrap(t *testing.T) {
+	wrap := Wrapper("pkg")
+
+	var tests = []struct {
+		name string
+		err  error
+		msg  string
+	}{
+		{"new", wrap("failed", nil), "pkg: failed"},
+		{"wrap", wrap("failed", errTest), "pkg: failed: cause"},
+		{"internal", WrapInternal("failed", errTest), "failed: cause"},
+		{"notFormat", wrap("100% failed", nil), "pkg: 100% failed"},
+		{"nested", wrap("outer", WrapInternal("inner", errTest)), "pkg: outer: inner: cause"},
+		{"with", With(wrap("failed", errTest), "id", 1), "pkg: failed: cause"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.msg, tt.err.Error())
+			assert.Equal(t, tt.msg, fmt.Sprint(tt.err))
+			assert.NotEmpty(t, Stack(tt.err))
+		})
+	}
+
+	t.Run("is", func(t *testing.T) {
+		err := With(wrap("outer", WrapInternal("inner", errTest)), "id", 1)
+		assert.True(t, xerrors.Is(err, errTest))
+	})
+
+	t.Run("withNil", func(t *testing.T) {
+		assert.Nil(t, With(nil, "id", 1))
+	})
+}
+
+func TestStack(t *testing.T) {
+	inner := WrapInternal("inner", errTest)
+	outer := Wrapper("pkg")("outer", inner)
+
+	assert.Equal(t, Stack(inner), Stack(outer), "must keep the stack of the innermost error")
+	assert.Contains(t, Stack(outer), "errors.TestStack")
+	assert.Equal(t, "", Stack(errTest))
+
+	formatted := fmt.Sprintf("%+v", outer)
+	assert.True(t, strings.HasPrefix(formatted, "pkg: outer: inner: cause\n"))
+	assert.Contains(t, formatted, "errors.TestStack")
+}
+
+func TestFields(t *testing.T) {
+	err := With(WrapInternal("failed", With(errTest, "id", 1, "target", 2)), "id", 3, "odd")
+
+	assert.Equal(t, map[string]interface{}{"id": 3, "target": 2}, Fields(err), "outer fields must win")
+	assert.Equal(t, map[string]interface{}{}, Fields(errTest))
+	assert.Contains(t, fmt.Sprintf("%+v", err), "map[id:3 target:2]")
+}
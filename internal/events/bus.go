@@ -0,0 +1,210 @@
+/*
+Package events implements an in-process bus where the services publish domain events, like the
+ratings created, so other parts of the application can react to them without the services knowing
+about them.
+
+Events are delivered asynchronously and at most once: each subscriber has its own queue, so slow
+subscribers do not delay the others, and events are dropped if the queue of a subscriber is full.
+
+The services publish the events of the ratings from an outbox, once the changes they report are
+committed, and again if the application stopped before it was done: these events have an ID, and
+the subscribers may receive them twice.
+*/
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types published by the services.
+const (
+	// RatingCreated is published with the Rating created as Data.
+	RatingCreated = "rating.created"
+
+	// RatingUpdated is published with the Rating updated as Data.
+	RatingUpdated = "rating.updated"
+
+	// RatingModerated is published with the Rating moderated as Data,
+	// as it was after the moderation.
+	RatingModerated = "rating.moderated"
+
+	// ReactionChanged is published with the Reaction recorded or
+	// removed as Data. Only its RatingID and UserID are set when it is
+	// removed.
+	ReactionChanged = "reaction.changed"
+
+	// ReplyCreated is published with the Reply created as Data.
+	ReplyCreated = "reply.created"
+
+	// UserUpdated is published with the User updated as Data.
+	UserUpdated = "user.updated"
+)
+
+// An Event is something that happened in the application.
+type Event struct {
+	// ID identifies the events published from an outbox, which are
+	// published again with the same ID if their publication was
+	// interrupted, so the subscribers can recognise the events they
+	// already handled. It is empty for the other events.
+	ID string
+
+	// Type identifies the kind of event, like RatingCreated.
+	Type string
+
+	// Time is when the event happened.
+	Time time.Time
+
+	// Data holds the details of the event. Its type depends on Type, and
+	// it must not be modified by the subscribers.
+	Data interface{}
+}
+
+// A Handler processes the events a subscriber receives.
+type Handler func(Event)
+
+// DefaultQueueSize is the number of events queued for each subscriber when
+// NewBus is called with a size of zero.
+const DefaultQueueSize = 1024
+
+// A Bus delivers the events published to its subscribers. The zero value is not
+// usable, see NewBus. A nil *Bus is valid and discards the events published.
+type Bus struct {
+	// dropped is the number of events dropped, updated atomically. It
+	// comes first so it is aligned on 32-bit platforms.
+	dropped uint64
+
+	queueSize int
+
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+type subscriber struct {
+	types   map[string]bool
+	handler Handler
+	queue   chan Event
+	done    chan struct{}
+}
+
+// NewBus creates a Bus queueing up to queueSize events for each subscriber.
+func NewBus(queueSize int) *Bus {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	return &Bus{
+		queueSize:   queueSize,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Subscribe calls h with the events of the given types published from now on,
+// or all of them if no types are given. Events are passed to h one at a time,
+// in the order they were published. The returned function cancels the
+// subscription, waiting for h to return if it is running.
+func (b *Bus) Subscribe(h Handler, types ...string) (cancel func()) {
+	if b == nil {
+		return func() {}
+	}
+
+	s := &subscriber{
+		handler: h,
+		queue:   make(chan Event, b.queueSize),
+		done:    make(chan struct{}),
+	}
+	if len(types) > 0 {
+		s.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(s.done)
+		return func() {}
+	}
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		defer close(s.done)
+		for e := range s.queue {
+			s.handler(e)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			if _, ok := b.subscribers[s]; ok {
+				delete(b.subscribers, s)
+				close(s.queue)
+			}
+			b.mu.Unlock()
+			<-s.done
+		})
+	}
+}
+
+// Publish queues e for the subscribers of its type, setting its Time if it is
+// zero. It never blocks: e is dropped for the subscribers whose queue is full.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subscribers {
+		if s.types != nil && !s.types[e.Type] {
+			continue
+		}
+
+		select {
+		case s.queue <- e:
+		default:
+			atomic.AddUint64(&b.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because the queue of a
+// subscriber was full.
+func (b *Bus) Dropped() uint64 {
+	if b == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&b.dropped)
+}
+
+// Close cancels every subscription, waiting for the events queued to be
+// handled. Events published afterwards are discarded.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.closed = true
+	subscribers := b.subscribers
+	b.subscribers = make(map[*subscriber]struct{})
+	for s := range subscribers {
+		close(s.queue)
+	}
+	b.mu.Unlock()
+
+	for s := range subscribers {
+		<-s.done
+	}
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus(0)
+
+	var (
+		mu      sync.Mutex
+		created []Event
+		all     []string
+	)
+	cancelCreated := b.Subscribe(func(e Event) {
+		mu.Lock()
+		created = append(created, e)
+		mu.Unlock()
+	}, RatingCreated)
+	b.Subscribe(func(e Event) {
+		mu.Lock()
+		all = append(all, e.Type)
+		mu.Unlock()
+	})
+
+	b.Publish(Event{Type: RatingCreated, Data: 1})
+	b.Publish(Event{Type: RatingUpdated, Data: 1})
+	cancelCreated()
+	cancelCreated()
+	b.Publish(Event{Type: RatingCreated, Data: 2})
+	b.Close()
+	b.Publish(Event{Type: RatingCreated, Data: 3})
+
+	assert.Len(t, created, 1)
+	assert.Equal(t, 1, created[0].Data)
+	assert.False(t, created[0].Time.IsZero(), "the time must be set")
+	assert.Equal(t, []string{RatingCreated, RatingUpdated, RatingCreated}, all)
+
+	// subscriptions after closing receive nothing
+	b.Subscribe(func(e Event) { t.Error("unexpected event") })()
+}
+
+func TestBus_Dropped(t *testing.T) {
+	b := NewBus(1)
+	defer b.Close()
+
+	block := make(chan struct{})
+	b.Subscribe(func(e Event) { <-block })
+
+	// the first event is handled, the second queued and the rest dropped
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Type: RatingCreated})
+	}
+	assert.True(t, b.Dropped() >= 2, "must drop when the queue is full")
+	close(block)
+}
+
+func TestBus_Nil(t *testing.T) {
+	var b *Bus
+	b.Publish(Event{Type: RatingCreated})
+	b.Subscribe(func(Event) {})()
+	b.Close()
+	assert.Zero(t, b.Dropped())
+}
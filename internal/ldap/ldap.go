@@ -0,0 +1,312 @@
+/*
+Package ldap implements the authentication of the users against an LDAP directory, like Active
+Directory, see models.AuthProvider.
+
+The entry of a user is searched for by its email address with the credentials of a service
+account, and the user is authenticated by binding with its DN and the password given. The groups
+the entry is a member of, from its memberOf attribute, tell the role of the user.
+
+The protocol is spoken by github.com/go-ldap/ldap, over a plain connection, a TLS connection for
+the ldaps URLs, or a plain connection upgraded with StartTLS, see Config.StartTLS.
+*/
+package ldap
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+var (
+	wrap = errors.Wrapper("ldap")
+)
+
+const (
+	// DefaultTimeout is the time a login can spend talking to the directory.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultUserAttribute is the attribute of the entries holding the
+	// email address of the users.
+	DefaultUserAttribute = "mail"
+)
+
+// The attributes of the entries of the users read, besides their email address.
+const (
+	attributeFirstName = "givenName"
+	attributeLastName  = "sn"
+	attributeMemberOf  = "memberOf"
+)
+
+// A GroupRole gives a role to the members of a group of the directory.
+type GroupRole struct {
+	// Group is the DN of the group, like
+	// CN=Moderators,OU=Groups,DC=corp,DC=com. It is
+	// compared to the memberOf values of the users
+	// ignoring the case.
+	Group string `json:"group"`
+
+	// RoleID is the ID of the role of its members.
+	RoleID int64 `json:"role_id"`
+}
+
+// ParseGroupRoles reads the roles of the groups of the directory from b, a JSON
+// array of GroupRoles. The users in several groups get the role of the one
+// listed first.
+func ParseGroupRoles(b []byte) ([]GroupRole, error) {
+	var roles []GroupRole
+	err := json.Unmarshal(b, &roles)
+	if err != nil {
+		return nil, wrap("invalid group roles", err)
+	}
+
+	for _, r := range roles {
+		if r.Group == "" || r.RoleID <= 0 {
+			return nil, wrap("group roles must have a group and a role ID", nil)
+		}
+	}
+
+	return roles, nil
+}
+
+// Config configures a Provider.
+type Config struct {
+	// URL is the address of the directory, like
+	// ldaps://dc.corp.com, or ldap://dc.corp.com:389 for
+	// a plain connection.
+	URL string
+
+	// BindDN and BindPassword are the credentials of the
+	// service account the users are searched for with.
+	// The users are searched for anonymously if empty.
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is the entry the users are searched under,
+	// like DC=corp,DC=com.
+	BaseDN string
+
+	// UserAttribute is the attribute of the entries of
+	// the users holding their email address, like
+	// userPrincipalName in Active Directory.
+	// DefaultUserAttribute is used if empty.
+	UserAttribute string
+
+	// GroupRoles are the roles given to the members of
+	// the groups. The users in none of them keep their
+	// role, or get the default role if they are new.
+	GroupRoles []GroupRole
+
+	// Timeout is the time a login can spend talking to
+	// the directory. DefaultTimeout is used if zero.
+	Timeout time.Duration
+
+	// StartTLS upgrades the plain connections to the
+	// directory of the ldap URLs to TLS with the StartTLS
+	// operation, before any bind. The ldaps URLs are
+	// always connected to with TLS.
+	StartTLS bool
+
+	// TLSConfig configures the TLS connections to the
+	// directory, of the ldaps URLs or upgraded with
+	// StartTLS. The default configuration is used if nil.
+	TLSConfig *tls.Config
+}
+
+// Provider authenticates the users against an LDAP directory.
+type Provider struct {
+	addr    string
+	tls     *tls.Config
+	c       Config
+	timeout time.Duration
+
+	// startTLS tells whether the connections are upgraded to TLS
+	// with the tls configuration once open.
+	startTLS bool
+}
+
+// NewProvider creates a Provider authenticating the users against the directory
+// configured by c.
+func NewProvider(c Config) (*Provider, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, wrap("invalid directory URL", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, wrap("directory URL must use the ldap or ldaps scheme", nil)
+	}
+	if u.Hostname() == "" {
+		return nil, wrap("directory URL must have a host", nil)
+	}
+	if c.BaseDN == "" {
+		return nil, wrap("base DN is required", nil)
+	}
+	if c.UserAttribute == "" {
+		c.UserAttribute = DefaultUserAttribute
+	}
+
+	p := &Provider{c: c, timeout: c.Timeout}
+	if p.timeout <= 0 {
+		p.timeout = DefaultTimeout
+	}
+
+	if u.Scheme == "ldaps" && c.StartTLS {
+		return nil, wrap("StartTLS is only used with the ldap scheme", nil)
+	}
+
+	port := u.Port()
+	if u.Scheme == "ldaps" || c.StartTLS {
+		p.tls = c.TLSConfig
+		if p.tls == nil {
+			p.tls = &tls.Config{}
+		}
+		if p.tls.ServerName == "" {
+			p.tls = p.tls.Clone()
+			p.tls.ServerName = u.Hostname()
+		}
+		p.startTLS = c.StartTLS
+	}
+	if port == "" {
+		port = "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+	}
+	p.addr = net.JoinHostPort(u.Hostname(), port)
+
+	return p, nil
+}
+
+// Authenticate returns the user of the directory with the given email address if
+// password is theirs, with its names and the role of its groups.
+// models.ErrNotFound is returned if the directory has no such user, and
+// models.ErrUnauthorised if the password is wrong.
+func (p *Provider) Authenticate(email, password string) (models.User, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return models.User{}, err
+	}
+	defer conn.Close()
+
+	if p.c.BindDN != "" {
+		err = conn.Bind(p.c.BindDN, p.c.BindPassword)
+		if err != nil {
+			return models.User{}, wrap("could not bind with the service account", err)
+		}
+	}
+
+	e, err := p.search(conn, email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// the directories accept the binds without a password as anonymous
+	// binds, which would let anybody in
+	if password == "" {
+		return models.User{}, models.ErrUnauthorised
+	}
+
+	err = conn.Bind(e.DN, password)
+	if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+		return models.User{}, models.ErrUnauthorised
+	} else if err != nil {
+		return models.User{}, wrap("could not bind with the user", err)
+	}
+
+	return models.User{
+		FirstName: e.GetEqualFoldAttributeValue(attributeFirstName),
+		LastName:  e.GetEqualFoldAttributeValue(attributeLastName),
+		RoleID:    p.role(e.GetEqualFoldAttributeValues(attributeMemberOf)),
+	}, nil
+}
+
+// search returns the only entry under the base DN whose user attribute equals
+// email. models.ErrNotFound is returned if there is none.
+func (p *Provider) search(conn *goldap.Conn, email string) (*goldap.Entry, error) {
+	res, err := conn.Search(goldap.NewSearchRequest(
+		p.c.BaseDN,
+		goldap.ScopeWholeSubtree,
+		goldap.NeverDerefAliases,
+		2, // enough to tell several entries apart
+		0,
+		false,
+		"("+goldap.EscapeFilter(p.c.UserAttribute)+"="+goldap.EscapeFilter(email)+")",
+		[]string{attributeFirstName, attributeLastName, attributeMemberOf},
+		nil,
+	))
+	if goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, wrap("several users have the email address", nil)
+	} else if err != nil {
+		return nil, wrap("could not search for the user", err)
+	}
+
+	// the referrals to other directories are not followed
+	switch len(res.Entries) {
+	case 0:
+		return nil, models.ErrNotFound
+	case 1:
+		return res.Entries[0], nil
+	default:
+		return nil, wrap("several users have the email address", nil)
+	}
+}
+
+// role returns the role of the first GroupRole with a group among groups, or
+// zero if there is none.
+func (p *Provider) role(groups []string) int64 {
+	for _, r := range p.c.GroupRoles {
+		for _, g := range groups {
+			if strings.EqualFold(r.Group, g) {
+				return r.RoleID
+			}
+		}
+	}
+
+	return 0
+}
+
+// dial opens a connection to the directory, upgraded with StartTLS if
+// configured, which must be closed. The connection can't be used once the
+// timeout of the login is over.
+func (p *Provider) dial() (*goldap.Conn, error) {
+	deadline := time.Now().Add(p.timeout)
+	d := &net.Dialer{Deadline: deadline}
+
+	var (
+		nc  net.Conn
+		err error
+	)
+	if p.tls != nil && !p.startTLS {
+		nc, err = tls.DialWithDialer(d, "tcp", p.addr, p.tls)
+	} else {
+		nc, err = d.Dial("tcp", p.addr)
+	}
+	if err != nil {
+		return nil, wrap("could not connect to the directory", err)
+	}
+
+	err = nc.SetDeadline(deadline)
+	if err != nil {
+		nc.Close()
+		return nil, wrap("could not set the deadline of the connection", err)
+	}
+
+	conn := goldap.NewConn(nc, p.tls != nil && !p.startTLS)
+	conn.Start()
+
+	if p.startTLS {
+		err = conn.StartTLS(p.tls)
+		if err != nil {
+			conn.Close()
+			return nil, wrap("could not start TLS with the directory", err)
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,338 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDirectory is a directory answering the binds and searches of a login.
+type testDirectory struct {
+	// passwords are the passwords of the DNs that can bind.
+	passwords map[string]string
+
+	// entries are the entries found by the value of the user attribute.
+	entries map[string][]testEntry
+
+	// tls configures the connections upgraded with StartTLS.
+	tls *tls.Config
+
+	// searchedBy is the attribute of the last search.
+	searchedBy string
+
+	// plainBinds is the number of binds received in plain text.
+	plainBinds int
+}
+
+// testEntry is an entry of a testDirectory.
+type testEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// serve answers the messages of the connections to l until it is closed.
+func (d *testDirectory) serve(l net.Listener) {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			_, secure := nc.(*tls.Conn)
+			defer func() { nc.Close() }()
+			for {
+				msg, err := ber.ReadPacket(nc)
+				if err != nil || len(msg.Children) < 2 {
+					return
+				}
+				id, op := msg.Children[0].Value, msg.Children[1]
+
+				if op.Tag == goldap.ApplicationBindRequest && !secure {
+					d.plainBinds++
+				}
+				for _, res := range d.answer(op) {
+					env := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+					env.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+					env.AppendChild(res)
+					nc.Write(env.Bytes())
+				}
+
+				if op.Tag == goldap.ApplicationExtendedRequest {
+					nc = tls.Server(nc, d.tls)
+					secure = true
+				}
+			}
+		}()
+	}
+}
+
+func (d *testDirectory) answer(op *ber.Packet) []*ber.Packet {
+	done := func(tag ber.Tag, code uint16) *ber.Packet {
+		p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+		p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+		p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+		p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+		return p
+	}
+
+	switch op.Tag {
+	case goldap.ApplicationBindRequest:
+		dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+		if p, ok := d.passwords[dn]; dn != "" && (!ok || p != password) {
+			return []*ber.Packet{done(goldap.ApplicationBindResponse, goldap.LDAPResultInvalidCredentials)}
+		}
+		return []*ber.Packet{done(goldap.ApplicationBindResponse, goldap.LDAPResultSuccess)}
+
+	case goldap.ApplicationSearchRequest:
+		filter := op.Children[6]
+		d.searchedBy = filter.Children[0].Data.String()
+
+		var res []*ber.Packet
+		for _, e := range d.entries[filter.Children[1].Data.String()] {
+			attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			for name, vals := range e.attributes {
+				set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+				for _, v := range vals {
+					set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+				}
+				attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+				attr.AppendChild(set)
+				attrs.AppendChild(attr)
+			}
+
+			entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "")
+			entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+			entry.AppendChild(attrs)
+			res = append(res, entry)
+		}
+		return append(res, done(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess))
+
+	case goldap.ApplicationExtendedRequest:
+		if d.tls == nil {
+			return []*ber.Packet{done(goldap.ApplicationExtendedResponse, goldap.LDAPResultProtocolError)}
+		}
+		return []*ber.Packet{done(goldap.ApplicationExtendedResponse, goldap.LDAPResultSuccess)}
+	}
+
+	return nil
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1, and a pool
+// trusting it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dc.corp.com"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider(Config{URL: "ldaps://dc.corp.com", BaseDN: "DC=corp,DC=com"})
+	require.NoError(t, err)
+	assert.Equal(t, "dc.corp.com:636", p.addr)
+	assert.Equal(t, "dc.corp.com", p.tls.ServerName)
+	assert.Equal(t, DefaultUserAttribute, p.c.UserAttribute)
+	assert.Equal(t, DefaultTimeout, p.timeout)
+
+	p, err = NewProvider(Config{URL: "ldap://dc.corp.com", BaseDN: "DC=corp,DC=com"})
+	require.NoError(t, err)
+	assert.Equal(t, "dc.corp.com:389", p.addr)
+	assert.Nil(t, p.tls)
+
+	p, err = NewProvider(Config{URL: "ldap://dc.corp.com", BaseDN: "DC=corp,DC=com", StartTLS: true})
+	require.NoError(t, err)
+	assert.Equal(t, "dc.corp.com:389", p.addr)
+	assert.Equal(t, "dc.corp.com", p.tls.ServerName)
+	assert.True(t, p.startTLS)
+
+	_, err = NewProvider(Config{URL: "ldaps://dc.corp.com", BaseDN: "DC=corp,DC=com", StartTLS: true})
+	assert.Error(t, err)
+
+	_, err = NewProvider(Config{URL: "https://dc.corp.com", BaseDN: "DC=corp,DC=com"})
+	assert.Error(t, err)
+
+	_, err = NewProvider(Config{URL: "ldap://dc.corp.com"})
+	assert.Error(t, err)
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	roles, err := ParseGroupRoles([]byte(`[{"group": "CN=Moderators,DC=corp,DC=com", "role_id": 3}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []GroupRole{{Group: "CN=Moderators,DC=corp,DC=com", RoleID: 3}}, roles)
+
+	_, err = ParseGroupRoles([]byte(`[{"group": "CN=Moderators,DC=corp,DC=com"}]`))
+	assert.Error(t, err)
+
+	_, err = ParseGroupRoles([]byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestProvider_Authenticate(t *testing.T) {
+	jane := testEntry{dn: "CN=Jane Doe,OU=Staff,DC=corp,DC=com", attributes: map[string][]string{
+		"givenName": {"Jane"},
+		"sn":        {"Doe"},
+		"memberOf":  {"CN=Everyone,DC=corp,DC=com", "cn=moderators,dc=corp,dc=com"},
+	}}
+	john := testEntry{dn: "CN=John Roe,OU=Staff,DC=corp,DC=com", attributes: map[string][]string{
+		"givenName": {"John"},
+	}}
+
+	d := &testDirectory{
+		passwords: map[string]string{
+			"CN=Service,DC=corp,DC=com": "servicepassword",
+			jane.dn:                     "janepassword",
+			john.dn:                     "johnpassword",
+		},
+		entries: map[string][]testEntry{
+			"jane@corp.com": {jane},
+			"john@corp.com": {john},
+			"dup@corp.com":  {jane, john},
+		},
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go d.serve(l)
+
+	c := Config{
+		URL:           "ldap://" + l.Addr().String(),
+		BindDN:        "CN=Service,DC=corp,DC=com",
+		BindPassword:  "servicepassword",
+		BaseDN:        "DC=corp,DC=com",
+		UserAttribute: "userPrincipalName",
+		GroupRoles: []GroupRole{
+			{Group: "CN=Moderators,DC=corp,DC=com", RoleID: 3},
+			{Group: "CN=Everyone,DC=corp,DC=com", RoleID: 2},
+		},
+	}
+	p, err := NewProvider(c)
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		u, err := p.Authenticate("jane@corp.com", "janepassword")
+		require.NoError(t, err)
+		assert.Equal(t, models.User{FirstName: "Jane", LastName: "Doe", RoleID: 3}, u)
+		assert.Equal(t, "userPrincipalName", d.searchedBy)
+	})
+
+	t.Run("noGroup", func(t *testing.T) {
+		u, err := p.Authenticate("john@corp.com", "johnpassword")
+		require.NoError(t, err)
+		assert.Equal(t, models.User{FirstName: "John"}, u)
+	})
+
+	t.Run("wrongPassword", func(t *testing.T) {
+		_, err := p.Authenticate("jane@corp.com", "johnpassword")
+		assert.Equal(t, models.ErrUnauthorised, err)
+	})
+
+	t.Run("emptyPassword", func(t *testing.T) {
+		_, err := p.Authenticate("jane@corp.com", "")
+		assert.Equal(t, models.ErrUnauthorised, err)
+	})
+
+	t.Run("notFound", func(t *testing.T) {
+		_, err := p.Authenticate("nobody@corp.com", "janepassword")
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		_, err := p.Authenticate("dup@corp.com", "janepassword")
+		require.Error(t, err)
+		assert.NotEqual(t, models.ErrNotFound, err)
+	})
+
+	t.Run("serviceAccount", func(t *testing.T) {
+		c := c
+		c.BindPassword = "wrong"
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+
+		_, err = p.Authenticate("jane@corp.com", "janepassword")
+		require.Error(t, err)
+		assert.NotEqual(t, models.ErrUnauthorised, err, "must not be mistaken for a wrong password")
+		assert.True(t, strings.Contains(err.Error(), "service account"))
+	})
+
+	cert, pool := testCertificate(t)
+	d.tls = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	t.Run("startTLS", func(t *testing.T) {
+		c := c
+		c.StartTLS = true
+		c.TLSConfig = &tls.Config{RootCAs: pool}
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+
+		binds := d.plainBinds
+		u, err := p.Authenticate("jane@corp.com", "janepassword")
+		require.NoError(t, err)
+		assert.Equal(t, "Jane", u.FirstName)
+		assert.Equal(t, binds, d.plainBinds, "must only bind once TLS is started")
+	})
+
+	t.Run("startTLSUntrusted", func(t *testing.T) {
+		c := c
+		c.StartTLS = true
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+
+		binds := d.plainBinds
+		_, err = p.Authenticate("jane@corp.com", "janepassword")
+		require.Error(t, err)
+		assert.True(t, strings.Contains(err.Error(), "start TLS"))
+		assert.Equal(t, binds, d.plainBinds, "must not bind in plain text")
+	})
+
+	t.Run("ldaps", func(t *testing.T) {
+		tl, err := tls.Listen("tcp", "127.0.0.1:0", d.tls)
+		require.NoError(t, err)
+		defer tl.Close()
+		go d.serve(tl)
+
+		c := c
+		c.URL = "ldaps://" + tl.Addr().String()
+		c.TLSConfig = &tls.Config{RootCAs: pool}
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+
+		binds := d.plainBinds
+		u, err := p.Authenticate("jane@corp.com", "janepassword")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), u.RoleID)
+		assert.Equal(t, binds, d.plainBinds)
+	})
+}
@@ -0,0 +1,144 @@
+/*
+Package metrics writes metrics in the OpenMetrics text format, so they can be scraped by Prometheus
+and compatible systems.
+
+Only the subset of the format needed by the application is supported: gauges and counters, with
+optional labels. Metrics are built as Family values by their producers and written together with
+Write.
+*/
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+)
+
+var (
+	wrap = errors.Wrapper("metrics")
+)
+
+// ContentType is the media type of the documents written by Write.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Type is the type of the metrics of a Family.
+type Type string
+
+// Supported metric types.
+const (
+	// Gauge is a value that can go up and down.
+	Gauge Type = "gauge"
+
+	// Counter is a value that only goes up, except when it is reset.
+	// Its samples are written with the "_total" suffix.
+	Counter Type = "counter"
+)
+
+// nameRe matches the valid metric and label names.
+var nameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// A Family is a set of metrics with the same name and meaning, distinguished by their labels.
+type Family struct {
+	// Name identifies the family. Counters must not include the "_total"
+	// suffix, which is added to their samples.
+	Name string
+
+	// Help describes the family.
+	Help string
+
+	Type    Type
+	Samples []Sample
+}
+
+// A Sample is the value of a metric of a Family.
+type Sample struct {
+	// Labels distinguish the samples of a family. They may be empty if
+	// the family has only one sample.
+	Labels []Label
+
+	Value float64
+}
+
+// A Label is a name and value pair identifying a Sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Write writes families to w in the OpenMetrics text format, in order, followed by the EOF
+// marker. An error is returned if any family or label name is not valid.
+func Write(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families {
+		if !nameRe.MatchString(f.Name) {
+			return wrap("invalid metric name "+strconv.Quote(f.Name), nil)
+		}
+
+		name := f.Name
+		if f.Type == Counter {
+			name += "_total"
+		}
+
+		bw.WriteString("# TYPE " + f.Name + " " + string(f.Type) + "\n")
+		if f.Help != "" {
+			bw.WriteString("# HELP " + f.Name + " " + escape(f.Help) + "\n")
+		}
+
+		for _, s := range f.Samples {
+			bw.WriteString(name)
+
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if !nameRe.MatchString(l.Name) {
+						return wrap("invalid label name "+strconv.Quote(l.Name)+" in metric "+f.Name, nil)
+					}
+
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(l.Name + `="` + escape(l.Value) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+
+			bw.WriteString(" " + formatValue(s.Value) + "\n")
+		}
+	}
+
+	bw.WriteString("# EOF\n")
+
+	err := bw.Flush()
+	if err != nil {
+		return wrap("could not write metrics", err)
+	}
+
+	return nil
+}
+
+// escaper escapes the label values and help texts.
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// formatValue formats v as expected by the OpenMetrics text format.
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	var cases = []struct {
+		name     string
+		families []Family
+		out      string
+		err      bool
+	}{
+		{
+			"empty",
+			nil,
+			"# EOF\n",
+			false,
+		},
+		{
+			"gauge",
+			[]Family{{Name: "users", Help: "Active users.", Type: Gauge, Samples: []Sample{{Value: 12}}}},
+			"# TYPE users gauge\n# HELP users Active users.\nusers 12\n# EOF\n",
+			false,
+		},
+		{
+			"counterWithLabels",
+			[]Family{{Name: "hits", Type: Counter, Samples: []Sample{
+				{Labels: []Label{{"cache", "roles"}}, Value: 3},
+				{Labels: []Label{{"cache", "ratings"}, {"node", "a"}}, Value: 1.5},
+			}}},
+			"# TYPE hits counter\nhits_total{cache=\"roles\"} 3\nhits_total{cache=\"ratings\",node=\"a\"} 1.5\n# EOF\n",
+			false,
+		},
+		{
+			"escaping",
+			[]Family{{Name: "x", Help: "a \\ \"b\"\nc", Type: Gauge, Samples: []Sample{
+				{Labels: []Label{{"l", "q\"\\\n"}}, Value: math.NaN()},
+				{Value: math.Inf(1)},
+				{Value: math.Inf(-1)},
+			}}},
+			"# TYPE x gauge\n# HELP x a \\\\ \\\"b\\\"\\nc\nx{l=\"q\\\"\\\\\\n\"} NaN\nx +Inf\nx -Inf\n# EOF\n",
+			false,
+		},
+		{
+			"invalidName",
+			[]Family{{Name: "1x", Type: Gauge}},
+			"",
+			true,
+		},
+		{
+			"invalidLabel",
+			[]Family{{Name: "x", Type: Gauge, Samples: []Sample{{Labels: []Label{{"a-b", "c"}}}}}},
+			"",
+			true,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := Write(&b, cs.families)
+			if cs.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, cs.out, b.String())
+		})
+	}
+}
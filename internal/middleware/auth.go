@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
 
 	"github.com/noelruault/ratingsapp/internal/models"
 
@@ -16,6 +19,10 @@ var viewErr = func() views.Error {
 	ev.SetCode(models.ErrUnauthorised, http.StatusUnauthorized)
 	ev.SetCode(ErrForbidden, http.StatusForbidden)
 	ev.SetCode(ErrNotAcceptable, http.StatusNotAcceptable)
+	ev.SetCode(ErrConsentRequired, http.StatusForbidden)
+	ev.SetCode(models.ErrTenantUnavailable, http.StatusForbidden)
+	ev.SetCode(ErrUnsupportedVersion, http.StatusNotAcceptable)
+	ev.SetCode(ErrVersionMismatch, http.StatusNotAcceptable)
 
 	return ev
 }()
@@ -26,13 +33,99 @@ type UserService interface {
 	Validate(string) (models.User, error)
 }
 
+// userKey is the key of the user authenticated by Authenticated in the contexts
+// of the requests.
+const userKey = "user"
+
+// A RequestActor is the user a request is made by, as authenticated by
+// Authenticated. It tells what the user can do on the request, see Actor.
+type RequestActor struct {
+	*models.User
+}
+
+// Actor returns the user the request of c is made by. It is set on all the
+// requests that went through Authenticated, which the routes wrapped by Can,
+// CanAny, CanOrSelf, Admin and AnyUser require, so it panics if there is none:
+// the handler was routed without them, which Guarded prevents.
+func Actor(c *gin.Context) RequestActor {
+	a, ok := LookupActor(c)
+	if !ok {
+		panic("middleware: no actor in the context, the route must run after Authenticated")
+	}
+
+	return a
+}
+
+// LookupActor returns the user the request of c is made by, and whether it was
+// authenticated, for the handlers serving anonymous requests too.
+func LookupActor(c *gin.Context) (RequestActor, bool) {
+	v, ok := c.Get(userKey)
+	if !ok {
+		return RequestActor{}, false
+	}
+
+	u, ok := v.(*models.User)
+	if !ok || u == nil {
+		return RequestActor{}, false
+	}
+
+	return RequestActor{User: u}, true
+}
+
+// SetActor sets user as the user the request of c is made by, as Authenticated
+// does.
+func SetActor(c *gin.Context, user *models.User) {
+	c.Set(userKey, user)
+}
+
+// permissions returns the permissions of the role of a, none if it was not
+// read.
+func (a RequestActor) permissions() models.Permissions {
+	if a.Role == nil {
+		return 0
+	}
+
+	return a.Role.Permissions
+}
+
+// Can tells whether the role of a permits all of the permissions in p.
+func (a RequestActor) Can(p models.Permissions) bool {
+	return a.permissions()&p == p
+}
+
+// CanAny tells whether the role of a permits any of the permissions in p.
+func (a RequestActor) CanAny(p models.Permissions) bool {
+	return a.permissions()&p != 0
+}
+
+// IsAdmin tells whether a is an administrator.
+func (a RequestActor) IsAdmin() bool {
+	return a.RoleID == models.AdminRoleID
+}
+
+// IsSelf tells whether a is the user with the given ID.
+func (a RequestActor) IsSelf(id int64) bool {
+	return a.ID == id
+}
+
+// CanOrSelf tells whether the role of a permits all of the permissions in p, or
+// a is the user with the given ID.
+func (a RequestActor) CanOrSelf(p models.Permissions, id int64) bool {
+	return a.Can(p) || a.IsSelf(id)
+}
+
 // Authenticated is a middleware that will only allow a request to go through if
-// a user is authenticated. A "user" value of type *User is set on successfully
-// authenticated contexts.
+// a user is authenticated. The user is set on successfully authenticated
+// contexts, and returned by Actor.
 //
 // The authentication is verified by checking a token passed in an HTTP header
 // in the request. If authentication fails, an HTTP Unauthorized error is
-// returned with a JSON description.
+// returned with a JSON description. If models.Config.TrustTokenPermissions is
+// set, the user may only have its ID, role ID and the permissions of its role
+// set, as carried by the token. If the cache is enabled, the user of a token
+// may be served from it, see models.Config.Cache. The organisation of the user,
+// if any, is carried by the context of the request, see models.OrganisationFrom,
+// so the services of the request only reach its data.
 func Authenticated(us UserService) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
@@ -48,7 +141,10 @@ func Authenticated(us UserService) gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user", &user)
+		SetActor(c, &user)
+		if user.OrgID != nil {
+			c.Request = c.Request.WithContext(models.WithOrganisation(c.Request.Context(), *user.OrgID))
+		}
 		c.Next()
 	}
 }
@@ -61,9 +157,37 @@ func Authenticated(us UserService) gin.HandlerFunc {
 // user's role permits ALL of the roles in p.
 func Can(p models.Permissions, h gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user := c.MustGet("user").(*models.User)
+		if !Actor(c).Can(p) {
+			viewErr.JSON(c, ErrForbidden)
+			return
+		}
+
+		h(c)
+	}
+}
+
+// CanAny is a decorator for Gin handlers that works as Can, but allows the
+// request if the user's role permits ANY of the permissions in p, like a
+// permission and a narrower one split from it.
+func CanAny(p models.Permissions, h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Actor(c).CanAny(p) {
+			viewErr.JSON(c, ErrForbidden)
+			return
+		}
+
+		h(c)
+	}
+}
+
+// CanOrSelf is a decorator for Gin handlers that works as Can, but also allows
+// users without the permissions in p to execute h for themselves, that is, when
+// the "id" route parameter is their own ID.
+func CanOrSelf(p models.Permissions, h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a := Actor(c)
 
-		if user.Role.Permissions&p != p {
+		if !a.Can(p) && c.Param("id") != strconv.FormatInt(a.ID, 10) {
 			viewErr.JSON(c, ErrForbidden)
 			return
 		}
@@ -71,3 +195,71 @@ func Can(p models.Permissions, h gin.HandlerFunc) gin.HandlerFunc {
 		h(c)
 	}
 }
+
+// Admin is a decorator for Gin handlers that only allows administrators to
+// execute h. Otherwise, a Forbidden message is returned.
+func Admin(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Actor(c).IsAdmin() {
+			viewErr.JSON(c, ErrForbidden)
+			return
+		}
+
+		h(c)
+	}
+}
+
+// AnyUser is a decorator for Gin handlers that allows any authenticated user to
+// execute h, whatever their permissions, as for the routes of their own data.
+// Otherwise, an Unauthorised message is returned.
+func AnyUser(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := LookupActor(c); !ok {
+			viewErr.JSON(c, models.ErrUnauthorised)
+			return
+		}
+
+		h(c)
+	}
+}
+
+// NoOrganisation is a decorator for Gin handlers that only runs h for the users
+// of no organisation, like the features whose data is not split by
+// organisation, see models.Organisation. Otherwise, a Forbidden message is
+// returned. It must run after Authenticated.
+//
+// It does not check the permissions of the user, so it is not one of the guards
+// reported by Guarded: the routes wrap it in one of them, like
+// Admin(NoOrganisation(h)).
+func NoOrganisation(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Actor(c).OrgID != nil {
+			viewErr.JSON(c, ErrForbidden)
+			return
+		}
+
+		h(c)
+	}
+}
+
+// guards are the names of the handlers returned by the decorators above
+// checking the permissions, as gin reports them in gin.RouteInfo. NoOrganisation
+// is left out, see its documentation.
+var guards = map[string]bool{
+	handlerName(Can(0, nil)):       true,
+	handlerName(CanAny(0, nil)):    true,
+	handlerName(CanOrSelf(0, nil)): true,
+	handlerName(Admin(nil)):        true,
+	handlerName(AnyUser(nil)):      true,
+}
+
+// Guarded tells whether handler, the name of the last handler of a route as
+// reported by gin.RouteInfo, is wrapped by Can, CanAny, CanOrSelf, Admin or
+// AnyUser. They all require the user authenticated by Authenticated.
+func Guarded(handler string) bool {
+	return guards[handler]
+}
+
+func handlerName(h gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+}
@@ -8,24 +8,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
 	"github.com/stretchr/testify/assert"
 )
 
-type testUserService struct {
-	validate func(string) (models.User, error)
-}
-
-func (tus *testUserService) Validate(aToken string) (models.User, error) {
-	if tus.validate != nil {
-		return tus.validate(aToken)
-	}
-
-	return models.User{}, nil
-}
-
 func TestAuthenticated(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	tus := testUserService{}
+	tus := modelstest.UserService{}
 	hdl := func(c *gin.Context) {
 		c.JSON(200, gin.H{"test": "ok"})
 	}
@@ -67,7 +56,7 @@ func TestAuthenticated(t *testing.T) {
 			http.StatusUnauthorized,
 			`{"error":"unauthorised"}`,
 			func(t *testing.T) {
-				tus.validate = func(atok string) (models.User, error) {
+				tus.ValidateFunc = func(atok string) (models.User, error) {
 					assert.Equal(t, "gibberish", atok)
 					return models.User{}, models.ErrUnauthorised
 				}
@@ -79,7 +68,7 @@ func TestAuthenticated(t *testing.T) {
 			http.StatusInternalServerError,
 			`{"error":"server_error"}`,
 			func(t *testing.T) {
-				tus.validate = func(atok string) (models.User, error) {
+				tus.ValidateFunc = func(atok string) (models.User, error) {
 					assert.Equal(t, "sometoken", atok)
 					return models.User{}, errors.New("some internal type of error")
 				}
@@ -91,7 +80,7 @@ func TestAuthenticated(t *testing.T) {
 			http.StatusOK,
 			`{"test":"ok"}`,
 			func(t *testing.T) {
-				tus.validate = func(atok string) (models.User, error) {
+				tus.ValidateFunc = func(atok string) (models.User, error) {
 					assert.Equal(t, "sometoken", atok)
 					return models.User{}, nil
 				}
@@ -126,6 +115,28 @@ func TestAuthenticated(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("organisation", func(t *testing.T) {
+		org := int64(4)
+		tus.ValidateFunc = func(atok string) (models.User, error) {
+			return models.User{ID: 7, OrgID: &org}, nil
+		}
+
+		var got int64
+		mux := gin.New()
+		mux.Use(Authenticated(&tus))
+		mux.GET("/", func(c *gin.Context) {
+			got = models.OrganisationFrom(c.Request.Context())
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer sometoken")
+		mux.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, org, got, "the services of the request must be scoped to the organisation of the user")
+	})
 }
 
 func TestCan(t *testing.T) {
@@ -212,3 +223,235 @@ func TestCan(t *testing.T) {
 		})
 	}
 }
+
+func TestAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hdl := func(c *gin.Context) {
+		c.JSON(200, gin.H{"test": "ok"})
+	}
+
+	var cases = []struct {
+		name      string
+		user      models.User
+		outstatus int
+		outbody   string
+	}{
+		{
+			"admin",
+			models.User{ID: 1, RoleID: 1, Role: &models.Role{ID: 1, Permissions: -1}},
+			http.StatusOK,
+			`{"test":"ok"}`,
+		},
+		{
+			"allPermissionsNotAdmin",
+			models.User{ID: 7, RoleID: 99, Role: &models.Role{ID: 99, Permissions: -1}},
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+		},
+		{
+			"user",
+			models.User{ID: 7, RoleID: 2, Role: &models.Role{ID: 2}},
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+
+			c.Set("user", &cs.user)
+			Admin(hdl)(c)
+
+			assert.Equal(t, cs.outstatus, w.Code)
+			assert.JSONEq(t, cs.outbody, w.Body.String())
+		})
+	}
+}
+
+func TestCanOrSelf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hdl := func(c *gin.Context) {
+		c.JSON(200, gin.H{"test": "ok"})
+	}
+
+	var cases = []struct {
+		name      string
+		user      models.User
+		id        string
+		outstatus int
+		outbody   string
+	}{
+		{
+			"permitted",
+			models.User{ID: 7, RoleID: 3, Role: &models.Role{ID: 3, Permissions: 15}},
+			"8",
+			http.StatusOK,
+			`{"test":"ok"}`,
+		},
+		{
+			"self",
+			models.User{ID: 7, RoleID: 2, Role: &models.Role{ID: 2}},
+			"7",
+			http.StatusOK,
+			`{"test":"ok"}`,
+		},
+		{
+			"other",
+			models.User{ID: 7, RoleID: 2, Role: &models.Role{ID: 2}},
+			"8",
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+		},
+		{
+			"notNormalised",
+			models.User{ID: 7, RoleID: 2, Role: &models.Role{ID: 2}},
+			"07",
+			http.StatusForbidden,
+			`{"error":"forbidden"}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			c.Params = gin.Params{{Key: "id", Value: cs.id}}
+
+			c.Set("user", &cs.user)
+			CanOrSelf(models.PermissionReadUsers, hdl)(c)
+
+			assert.Equal(t, cs.outstatus, w.Code)
+			assert.JSONEq(t, cs.outbody, w.Body.String())
+		})
+	}
+}
+
+func TestCanAny(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hdl := func(c *gin.Context) {
+		c.JSON(200, gin.H{"test": "ok"})
+	}
+
+	var cases = []struct {
+		name        string
+		permissions models.Permissions
+		outstatus   int
+		outbody     string
+	}{
+		{"both", models.PermissionWriteRatings | models.PermissionWriteOwnRatings, http.StatusOK, `{"test":"ok"}`},
+		{"broader", models.PermissionWriteRatings, http.StatusOK, `{"test":"ok"}`},
+		{"narrower", models.PermissionWriteOwnRatings, http.StatusOK, `{"test":"ok"}`},
+		{"none", models.PermissionReadRatings, http.StatusForbidden, `{"error":"forbidden"}`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+
+			c.Set("user", &models.User{ID: 7, RoleID: 3, Role: &models.Role{ID: 3, Permissions: cs.permissions}})
+			CanAny(models.PermissionWriteRatings|models.PermissionWriteOwnRatings, hdl)(c)
+
+			assert.Equal(t, cs.outstatus, w.Code)
+			assert.JSONEq(t, cs.outbody, w.Body.String())
+		})
+	}
+}
+
+func TestAnyUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hdl := func(c *gin.Context) {
+		c.JSON(200, gin.H{"test": "ok"})
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Set("user", &models.User{ID: 7, RoleID: 2, Role: &models.Role{ID: 2}})
+	AnyUser(hdl)(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	AnyUser(hdl)(c)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestNoOrganisation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hdl := func(c *gin.Context) {
+		c.JSON(200, gin.H{"test": "ok"})
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Set("user", &models.User{ID: 7, RoleID: 1})
+	NoOrganisation(hdl)(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	org := int64(4)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Set("user", &models.User{ID: 7, RoleID: 1, OrgID: &org})
+	NoOrganisation(hdl)(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"forbidden"}`, w.Body.String())
+}
+
+func TestGuarded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hdl := func(c *gin.Context) {}
+
+	mux := gin.New()
+	mux.GET("/can", Can(models.PermissionReadUsers, hdl))
+	mux.GET("/canAny", CanAny(models.PermissionReadUsers, hdl))
+	mux.GET("/canOrSelf/:id", CanOrSelf(models.PermissionReadUsers, hdl))
+	mux.GET("/admin", Admin(hdl))
+	mux.GET("/anyUser", AnyUser(hdl))
+	mux.GET("/open", hdl)
+
+	for _, r := range mux.Routes() {
+		assert.Equal(t, r.Path != "/open", Guarded(r.Handler), r.Path)
+	}
+}
+
+func TestActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, ok := LookupActor(c)
+	assert.False(t, ok)
+	assert.Panics(t, func() { Actor(c) }, "must not be called without Authenticated")
+
+	c.Set("user", "not a user")
+	_, ok = LookupActor(c)
+	assert.False(t, ok)
+
+	user := &models.User{ID: 7, RoleID: 3, Role: &models.Role{ID: 3, Permissions: models.PermissionReadUsers | models.PermissionReadRatings}}
+	SetActor(c, user)
+	a := Actor(c)
+	assert.Same(t, user, a.User)
+	assert.True(t, a.Can(models.PermissionReadUsers|models.PermissionReadRatings))
+	assert.False(t, a.Can(models.PermissionReadUsers|models.PermissionWriteUsers))
+	assert.True(t, a.CanAny(models.PermissionReadUsers|models.PermissionWriteUsers))
+	assert.False(t, a.CanAny(models.PermissionWriteUsers))
+	assert.True(t, a.IsSelf(7))
+	assert.True(t, a.CanOrSelf(models.PermissionWriteUsers, 7))
+	assert.False(t, a.CanOrSelf(models.PermissionWriteUsers, 8))
+	assert.False(t, a.IsAdmin())
+
+	// the users read without their role have no permissions
+	SetActor(c, &models.User{ID: 1, RoleID: 1})
+	a = Actor(c)
+	assert.True(t, a.IsAdmin())
+	assert.False(t, a.CanAny(models.PermissionReadUsers))
+	assert.True(t, a.Can(0))
+}
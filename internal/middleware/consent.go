@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// ConsentService is a subset of the models.ConsentService interface, containing
+// only the methods required to run middleware.
+type ConsentService interface {
+	UpToDate(userID int64) (bool, error)
+}
+
+// Consented is a middleware that only allows a request to go through if the
+// authenticated user accepted the current version of the data processing
+// policy. Otherwise, a Forbidden message with the consent_required code is
+// returned. It must run after Authenticated.
+func Consented(cs ConsentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, err := cs.UpToDate(Actor(c).ID)
+		if err != nil {
+			viewErr.JSON(c, err)
+			return
+		} else if !ok {
+			viewErr.JSON(c, ErrConsentRequired)
+			return
+		}
+
+		c.Next()
+	}
+}
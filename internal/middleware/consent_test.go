@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cases = []struct {
+		name      string
+		upToDate  func(int64) (bool, error)
+		outstatus int
+		outbody   string
+	}{
+		{
+			"upToDate",
+			func(id int64) (bool, error) { return id == 7, nil },
+			http.StatusOK,
+			`{"test":"ok"}`,
+		},
+		{
+			"notAccepted",
+			func(int64) (bool, error) { return false, nil },
+			http.StatusForbidden,
+			`{"error":"consent_required"}`,
+		},
+		{
+			"serviceError",
+			func(int64) (bool, error) { return false, errors.New("connection lost") },
+			http.StatusInternalServerError,
+			`{"error":"server_error"}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			mux := gin.New()
+			mux.Use(func(c *gin.Context) {
+				c.Set("user", &models.User{ID: 7})
+			})
+			mux.Use(Consented(&modelstest.ConsentService{UpToDateFunc: cs.upToDate}))
+			mux.POST("/", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"test": "ok"})
+			})
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/", nil)
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, cs.outstatus, w.Code)
+			assert.JSONEq(t, cs.outbody, w.Body.String())
+		})
+	}
+}
@@ -8,7 +8,8 @@ import (
 
 // ContentType is a middleware that makes sure all request with input are provided with
 // an appropriate Content-Type value, and if an Accept header is provided, it includes the
-// type in ct.
+// type in ct. Types using ct's subtype as a structured syntax suffix, like
+// "application/vnd.ratingsapp.v1+json" for "application/json", are accepted as well.
 func ContentType(ct string) gin.HandlerFunc {
 	mime := strings.SplitN(ct, "/", 2)
 	if len(mime) != 2 {
@@ -20,7 +21,8 @@ func ContentType(ct string) gin.HandlerFunc {
 		if acc != "" &&
 			!strings.Contains(acc, "*/*") &&
 			!strings.Contains(acc, mime[0]+"/*") &&
-			!strings.Contains(acc, ct) {
+			!strings.Contains(acc, ct) &&
+			!hasSuffixedType(acc, mime) {
 			viewErr.JSON(c, ErrNotAcceptable)
 		}
 
@@ -28,7 +30,7 @@ func ContentType(ct string) gin.HandlerFunc {
 		if c.Request.Method == "POST" ||
 			c.Request.Method == "PUT" ||
 			c.Request.Method == "PATCH" {
-			if !strings.Contains(ctype, ct) {
+			if !strings.Contains(ctype, ct) && !hasSuffixedType(ctype, mime) {
 				viewErr.JSON(c, ErrNotAcceptable)
 			}
 		}
@@ -36,3 +38,16 @@ func ContentType(ct string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// hasSuffixedType checks if any of the media types in the comma separated list mts belongs
+// to the top-level type in mime and has its subtype as a structured syntax suffix.
+func hasSuffixedType(mts string, mime []string) bool {
+	for _, mt := range strings.Split(mts, ",") {
+		mt = strings.ToLower(strings.TrimSpace(strings.SplitN(mt, ";", 2)[0]))
+		if strings.HasPrefix(mt, mime[0]+"/") && strings.HasSuffix(mt, "+"+mime[1]) {
+			return true
+		}
+	}
+
+	return false
+}
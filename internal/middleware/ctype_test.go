@@ -87,6 +87,24 @@ func TestContentType(t *testing.T) {
 			http.StatusOK,
 			`{"test":"ok"}`,
 		},
+		{
+			"acceptSuffixMatch",
+			"",
+			"text/html, application/vnd.ratingsapp.v1+json",
+			"application/json",
+			"GET",
+			http.StatusOK,
+			`{"test":"ok"}`,
+		},
+		{
+			"acceptSuffixNoMatch",
+			"",
+			"application/vnd.ratingsapp.v1+xml",
+			"application/json",
+			"GET",
+			http.StatusNotAcceptable,
+			`{"error":"not_acceptable"}`,
+		},
 		{
 			"ctypeNoMatch",
 			"text/html",
@@ -105,6 +123,15 @@ func TestContentType(t *testing.T) {
 			http.StatusOK,
 			`{"test":"ok"}`,
 		},
+		{
+			"ctypeSuffixMatch",
+			"application/vnd.ratingsapp.v1+json",
+			"*/*",
+			"application/json",
+			"PATCH",
+			http.StatusOK,
+			`{"test":"ok"}`,
+		},
 	}
 
 	for _, cs := range cases {
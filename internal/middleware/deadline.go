@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deadline sets a deadline on the context of each request, timeout after it starts. The handlers
+// and the services they call give up once it passes, and the slow statements of the database are
+// cancelled by its statement timeout, see models.Config.StatementTimeout: the request then fails
+// with a 504 Gateway Timeout status code and a "timeout" error code, see models.IsTimeout.
+//
+// The statement timeout only limits each statement, so a request may still run past its
+// deadline. The responses of the handlers that did not start writing them before the deadline
+// are then discarded, and the request fails as well, reporting the 504 status code to the
+// middleware before it, so their changes are rolled back if they run in a transaction. A zero
+// timeout leaves the requests without a deadline.
+func Deadline(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		// the headers set by the handlers are dropped with their responses
+		header := c.Writer.Header().Clone()
+		dw := &deadlineWriter{ResponseWriter: c.Writer, ctx: ctx}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = dw
+		c.Next()
+		c.Writer = dw.ResponseWriter
+
+		// the handlers that gave up without responding, or responded too
+		// late, are answered here
+		if dw.expired() {
+			for k := range c.Writer.Header() {
+				delete(c.Writer.Header(), k)
+			}
+			for k, v := range header {
+				c.Writer.Header()[k] = v
+			}
+
+			viewErr.JSON(c, context.DeadlineExceeded)
+		}
+	}
+}
+
+// deadlineWriter discards the responses not written before the deadline of ctx.
+type deadlineWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+
+	late bool
+}
+
+// expired tells whether the response is discarded, as the deadline passed before it was written.
+func (w *deadlineWriter) expired() bool {
+	if !w.late && !w.ResponseWriter.Written() && w.ctx.Err() == context.DeadlineExceeded {
+		w.late = true
+	}
+	return w.late
+}
+
+func (w *deadlineWriter) WriteHeader(code int) {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *deadlineWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	if w.expired() {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *deadlineWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *deadlineWriter) Flush() {
+	if !w.expired() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Status returns the 504 status code of the response once it is discarded.
+func (w *deadlineWriter) Status() int {
+	if w.expired() {
+		return http.StatusGatewayTimeout
+	}
+	return w.ResponseWriter.Status()
+}
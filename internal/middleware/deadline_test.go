@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cases = []struct {
+		name      string
+		timeout   time.Duration
+		handler   gin.HandlerFunc
+		outStatus int
+		outBody   string
+	}{
+		{"inTime", time.Minute, func(c *gin.Context) {
+			_, ok := c.Request.Context().Deadline()
+			assert.True(t, ok)
+			c.JSON(http.StatusOK, gin.H{})
+		}, http.StatusOK, `{}`},
+		{"noTimeout", 0, func(c *gin.Context) {
+			_, ok := c.Request.Context().Deadline()
+			assert.False(t, ok)
+			c.JSON(http.StatusOK, gin.H{})
+		}, http.StatusOK, `{}`},
+		{"gaveUp", time.Millisecond, func(c *gin.Context) {
+			<-c.Request.Context().Done()
+		}, http.StatusGatewayTimeout, `{"error":"timeout"}`},
+		{"failed", time.Millisecond, func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			viewErr.JSON(c, c.Request.Context().Err())
+		}, http.StatusGatewayTimeout, `{"error":"timeout"}`},
+		{"late", 20 * time.Millisecond, func(c *gin.Context) {
+			// the statements of a request may each finish in time
+			time.Sleep(40 * time.Millisecond)
+			c.Header("ETag", `"1"`)
+			c.JSON(http.StatusOK, gin.H{"id": 1})
+			assert.Equal(t, http.StatusGatewayTimeout, c.Writer.Status(), "the failure must be reported to the middleware")
+		}, http.StatusGatewayTimeout, `{"error":"timeout"}`},
+		{"notTimedOut", time.Minute, func(c *gin.Context) {
+			ctx, cancel := context.WithCancel(c.Request.Context())
+			cancel()
+			viewErr.JSON(c, ctx.Err())
+		}, http.StatusInternalServerError, `{"error":"server_error"}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := gin.New()
+			mux.GET("/", Deadline(tc.timeout), tc.handler)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.outStatus, w.Code)
+			assert.JSONEq(t, tc.outBody, w.Body.String())
+			assert.Empty(t, w.Header().Get("ETag"), "the headers of the late responses must be dropped")
+		})
+	}
+}
@@ -13,6 +13,11 @@ var (
 const (
 	ErrForbidden     MiddlewareError = "middleware: forbidden, user does not have permissions to perform this action"
 	ErrNotAcceptable MiddlewareError = "middleware: not_acceptable, the content-type provided is not supported or the requested accept header cannot be satisfied"
+
+	ErrUnsupportedVersion MiddlewareError = "middleware: unsupported_version, the requested API version does not exist"
+	ErrVersionMismatch    MiddlewareError = "middleware: version_mismatch, the requested API version is not served on this path"
+
+	ErrConsentRequired MiddlewareError = "middleware: consent_required, the current data processing policy must be accepted first"
 )
 
 // MiddlewareError defines errors exported by this package. This type implement a Public() method that
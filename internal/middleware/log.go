@@ -1,15 +1,37 @@
 package middleware
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/privacy"
 	"github.com/sirupsen/logrus"
 )
 
 // Log improves on Gin's logging middleware by including any error messages that may
-// result from a request.
-func Log(c *gin.Context) {
+// result from a request. Server errors are logged at the error level, along with the
+// fields and the stack of the last error, see errors.Fields and errors.Stack. They are
+// only logged: responses never include them.
+//
+// The ID of the request is logged if it has one, see RequestID, and the user and the
+// administrator impersonating them if the request was made with the token of an
+// impersonation, see models.UserService.Impersonate.
+//
+// The IP address and the user agent of the client are anonymised by a, and a "client"
+// value of type privacy.Client is set on the context, so handlers recording them never
+// see the original values.
+func Log(a *privacy.Anonymizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logRequest(c, a.Client(c.ClientIP(), c.Request.UserAgent()))
+	}
+}
+
+func logRequest(c *gin.Context, client privacy.Client) {
+	c.Set("client", client)
+
 	path := c.Request.URL.Path
 	raw := c.Request.URL.RawQuery
 	if raw != "" {
@@ -22,12 +44,33 @@ func Log(c *gin.Context) {
 	latency := time.Now().Sub(start)
 
 	// log it
-	logrus.WithFields(logrus.Fields{
+	entry := logrus.WithFields(logrus.Fields{
 		"status":  c.Writer.Status(),
 		"latency": latency,
-		"from":    c.ClientIP(),
+		"from":    client.IP,
+		"agent":   client.UserAgent,
 		"method":  c.Request.Method,
 		"path":    path,
 		"comment": c.Errors.Errors(),
-	}).Info("Gin Request")
+	})
+	if t, ok := c.Get("tenant"); ok {
+		entry = entry.WithField("tenant", t.(*models.Tenant).ID)
+	}
+	if id := c.GetString("requestId"); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	if a, ok := LookupActor(c); ok && a.ImpersonatedBy != 0 {
+		entry = entry.WithField("user", a.ID).
+			WithField("impersonated_by", a.ImpersonatedBy)
+	}
+
+	last := c.Errors.Last()
+	if c.Writer.Status() < http.StatusInternalServerError || last == nil {
+		entry.Info("Gin Request")
+		return
+	}
+
+	entry.WithFields(logrus.Fields(errors.Fields(last.Err))).
+		WithField("stack", errors.Stack(last.Err)).
+		Error("Gin Request")
 }
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/privacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	truncate, err := privacy.NewAnonymizer(privacy.Truncate, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		anon   *privacy.Anonymizer
+		client privacy.Client
+	}{
+		{"off", nil, privacy.Client{IP: "203.0.113.25", UserAgent: "curl/7.64.0"}},
+		{"truncate", truncate, privacy.Client{IP: "203.0.113.0", UserAgent: "curl/7"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client interface{}
+			mux := gin.New()
+			mux.Use(Log(tt.anon))
+			mux.GET("/", func(c *gin.Context) {
+				client, _ = c.Get("client")
+				c.Status(http.StatusNoContent)
+			})
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "203.0.113.25:41234"
+			r.Header.Set("User-Agent", "curl/7.64.0")
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			assert.Equal(t, tt.client, client)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+// CallMeter is a subset of the models.MeteringService interface, containing
+// only the methods required to run middleware.
+type CallMeter interface {
+	RecordCall(tenantID int64)
+}
+
+// Meter is a middleware that counts the requests made to each tenant, once
+// they are handled, for billing. It must run after the Tenant middleware, and
+// the requests made without a tenant are not counted.
+func Meter(cm CallMeter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		t, ok := c.Get("tenant")
+		if !ok {
+			return
+		}
+
+		cm.RecordCall(t.(*models.Tenant).ID)
+	}
+}
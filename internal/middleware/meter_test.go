@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCallMeter map[int64]int
+
+func (tcm testCallMeter) RecordCall(tenantID int64) {
+	tcm[tenantID]++
+}
+
+func TestMeter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cm := testCallMeter{}
+
+	mux := gin.New()
+	mux.Use(func(c *gin.Context) {
+		if c.Query("tenant") != "" {
+			c.Set("tenant", &models.Tenant{ID: 3})
+		}
+	})
+	mux.Use(Meter(cm))
+	mux.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	for _, path := range []string{"/?tenant=3", "/?tenant=3", "/"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	assert.Equal(t, testCallMeter{3: 2}, cm, "must only count the requests made to a tenant")
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/views"
+)
+
+// maxRequestIDLength is the longest request ID accepted from the clients.
+const maxRequestIDLength = 64
+
+// RequestID assigns an ID to each request, so the error a client got can be found in the logs. The
+// ID is the one of the X-Request-Id header of the request, if it has up to 64 letters, digits,
+// dashes, underscores or dots, like the IDs set by a proxy, or a random one otherwise. It is
+// returned in the X-Request-Id header of the response, and set on the context as the "requestId"
+// string value, see views.SetRequestID.
+func RequestID(c *gin.Context) {
+	id := c.GetHeader("X-Request-Id")
+	if !validRequestID(id) {
+		b := make([]byte, 16)
+		_, err := rand.Read(b)
+		if err != nil {
+			c.Next()
+			return
+		}
+		id = hex.EncodeToString(b)
+	}
+
+	views.SetRequestID(c, id)
+	c.Header("X-Request-Id", id)
+	c.Next()
+}
+
+// validRequestID tells whether the request ID id can be logged and returned as it is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrorFormat is a middleware that sets the format of the errors returned to the requests, see
+// views.ErrorFormat, and the prefix of the type URIs of the problem documents, if not empty, see
+// views.SetProblemTypeBase.
+func ErrorFormat(f views.ErrorFormat, problemTypeBase string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		views.SetErrorFormat(c, f)
+		if problemTypeBase != "" {
+			views.SetProblemTypeBase(c, problemTypeBase)
+		}
+		c.Next()
+	}
+}
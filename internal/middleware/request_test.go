@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/views"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cases = []struct {
+		name   string
+		header string
+		kept   bool
+	}{
+		{"fromProxy", "a1b2-c3d4_e5.f6", true},
+		{"missing", "", false},
+		{"tooLong", "0123456789012345678901234567890123456789012345678901234567890123456789", false},
+		{"invalidCharacters", "id\nX-Injected: true", false},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/api/v1/ratings/", nil)
+			c.Request.Header.Set("X-Request-Id", cs.header)
+
+			RequestID(c)
+
+			id := w.Header().Get("X-Request-Id")
+			if cs.kept {
+				assert.Equal(t, cs.header, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+			assert.Equal(t, id, c.GetString("requestId"))
+		})
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mux := gin.New()
+	mux.Use(RequestID, ErrorFormat(views.EnvelopeErrors, ""))
+	mux.GET("/", func(c *gin.Context) {
+		viewErr.JSON(c, ErrForbidden)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{
+		"code": "forbidden",
+		"message": "user does not have permissions to perform this action",
+		"requestId": "req-1"
+	}`, w.Body.String())
+
+	// the errors of the models are returned in the same envelope
+	mux.GET("/models", func(c *gin.Context) {
+		viewErr.JSON(c, models.ErrTenantUnavailable)
+	})
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/models", nil)
+	req.Header.Set("X-Request-Id", "req-2")
+	mux.ServeHTTP(w, req)
+
+	assert.JSONEq(t, `{
+		"code": "tenant_unavailable",
+		"message": "the tenant is not active",
+		"requestId": "req-2"
+	}`, w.Body.String())
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sandbox is a middleware that marks the responses of a sandbox deployment,
+// whose data are erased periodically, so the clients can tell it apart from a
+// production one.
+//
+// The following headers are set:
+//
+//	X-Sandbox: true
+//	X-Sandbox-Reset: 2020-03-15T00:00:00Z
+//
+// X-Sandbox-Reset is when the data are erased next, as returned by next, and
+// is left out if next returns the zero time.
+func Sandbox(next func() time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Sandbox", "true")
+		if t := next(); !t.IsZero() {
+			c.Header("X-Sandbox-Reset", t.UTC().Format(time.RFC3339))
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandbox(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cases = []struct {
+		name  string
+		next  time.Time
+		reset string
+	}{
+		{"scheduled", time.Date(2020, 3, 15, 1, 0, 0, 0, time.FixedZone("CET", 3600)), "2020-03-15T00:00:00Z"},
+		{"unknown", time.Time{}, ""},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/api/v1/ratings/", nil)
+
+			Sandbox(func() time.Time { return cs.next })(c)
+
+			assert.Equal(t, "true", w.Header().Get("X-Sandbox"))
+			assert.Equal(t, cs.reset, w.Header().Get("X-Sandbox-Reset"))
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"crypto/tls"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -15,9 +17,132 @@ func TestSecureHeaders(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	c.Request, _ = http.NewRequest("GET", "/snow/oauth/callback?code=testcode&state=teststate", nil)
 
-	SecureHeaders(c)
+	SecureHeaders(DefaultSecurityHeaders)(c)
 
 	assert.Equal(t, "nosniff", c.Writer.Header().Get("X-Content-Type-Options"))
 	assert.Equal(t, "deny", c.Writer.Header().Get("X-Frame-Options"))
 	assert.Equal(t, []string{"1; mode=block"}, c.Writer.Header()["X-XSS-Protection"])
+	assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", c.Writer.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "no-referrer", c.Writer.Header().Get("Referrer-Policy"))
+	assert.Empty(t, c.Writer.Header().Get("Strict-Transport-Security"), "must not be set over plain HTTP")
+}
+
+func TestSecureHeaders_configured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cases = []struct {
+		name    string
+		headers SecurityHeaders
+		tls     bool
+		proto   string
+		out     map[string]string
+	}{
+		{
+			"hsts",
+			DefaultSecurityHeaders,
+			true,
+			"",
+			map[string]string{"Strict-Transport-Security": "max-age=31536000"},
+		},
+		{
+			"hstsProxy",
+			DefaultSecurityHeaders,
+			false,
+			"https",
+			map[string]string{"Strict-Transport-Security": "max-age=31536000"},
+		},
+		{
+			"hstsPlain",
+			DefaultSecurityHeaders,
+			false,
+			"http",
+			map[string]string{"Strict-Transport-Security": ""},
+		},
+		{
+			"custom",
+			SecurityHeaders{
+				HSTSMaxAge:            time.Hour,
+				ContentSecurityPolicy: "default-src 'self'",
+				FrameOptions:          "sameorigin",
+				ReferrerPolicy:        "same-origin",
+			},
+			true,
+			"",
+			map[string]string{
+				"Strict-Transport-Security": "max-age=3600",
+				"Content-Security-Policy":   "default-src 'self'",
+				"X-Frame-Options":           "sameorigin",
+				"Referrer-Policy":           "same-origin",
+			},
+		},
+		{
+			"empty",
+			SecurityHeaders{},
+			true,
+			"",
+			map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Strict-Transport-Security": "",
+				"Content-Security-Policy":   "",
+				"X-Frame-Options":           "",
+				"Referrer-Policy":           "",
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/api/v1/ratings/", nil)
+			if cs.tls {
+				c.Request.TLS = &tls.ConnectionState{}
+			}
+			if cs.proto != "" {
+				c.Request.Header.Set("X-Forwarded-Proto", cs.proto)
+			}
+
+			SecureHeaders(cs.headers)(c)
+
+			for k, v := range cs.out {
+				assert.Equal(t, v, c.Writer.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestSecureHeaders_errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mux := gin.New()
+	mux.Use(SecureHeaders(DefaultSecurityHeaders), gin.Recovery())
+	mux.GET("/panic", func(c *gin.Context) {
+		panic("test panic")
+	})
+	mux.GET("/abort", func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorised"})
+	})
+
+	var cases = []struct {
+		path   string
+		status int
+	}{
+		{"/panic", http.StatusInternalServerError},
+		{"/abort", http.StatusUnauthorized},
+		{"/not-found", http.StatusNotFound},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", cs.path, nil)
+
+			mux.ServeHTTP(w, req)
+
+			assert.Equal(t, cs.status, w.Code)
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, "deny", w.Header().Get("X-Frame-Options"))
+			assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", w.Header().Get("Content-Security-Policy"))
+			assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+		})
+	}
 }
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"golang.org/x/xerrors"
+)
+
+// TenantService is a subset of the models.TenantService interface, containing
+// only the methods required to run middleware.
+type TenantService interface {
+	ByHostname(hostname string) (models.Tenant, error)
+}
+
+// Tenant is a middleware that resolves the tenant a request is sent to from its
+// hostname. The hostname is read from the header named header, as set by a
+// gateway in front of the application, or from the Host header if header is
+// empty or missing from the request.
+//
+// A "tenant" value of type *models.Tenant is set on the contexts of the
+// requests to the hostnames of a tenant, and the tenant is carried by the
+// context of the request, see models.TenantFrom. Requests to other hostnames
+// go through without a tenant. The requests to the tenants which are not
+// active, like the suspended ones, are refused with a Forbidden message.
+func Tenant(ts TenantService, header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host := c.Request.Host
+		if header != "" {
+			if h := c.GetHeader(header); h != "" {
+				host = h
+			}
+		}
+
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		t, err := ts.ByHostname(host)
+		if err != nil {
+			if !xerrors.Is(err, models.ErrNotFound) {
+				viewErr.JSON(c, err)
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		if t.Status != models.TenantActive {
+			viewErr.JSON(c, models.ErrTenantUnavailable)
+			return
+		}
+
+		c.Set("tenant", &t)
+		c.Request = c.Request.WithContext(models.WithTenant(c.Request.Context(), &t))
+		c.Next()
+	}
+}
+
+// NoTenant is a decorator for Gin handlers that only runs h for the requests
+// sent to the hostnames of no tenant, like the administration of the tenants
+// themselves. Otherwise, a Forbidden message is returned.
+func NoTenant(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("tenant"); ok {
+			viewErr.JSON(c, ErrForbidden)
+			return
+		}
+
+		h(c)
+	}
+}
+
+// NoTenantSchema is a decorator for Gin handlers that only runs h for the
+// requests not sent to a tenant with its own schema, like the features that
+// only work on the data shared by the application. Otherwise, a Forbidden
+// message is returned.
+func NoTenantSchema(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t, ok := c.Get("tenant"); ok && t.(*models.Tenant).Schema != "" {
+			viewErr.JSON(c, ErrForbidden)
+			return
+		}
+
+		h(c)
+	}
+}
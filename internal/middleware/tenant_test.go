@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/noelruault/ratingsapp/internal/models/modelstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hostnames := map[string]models.Tenant{
+		"acme.ratings.test":     {ID: 3, Name: "Acme", Status: models.TenantActive},
+		"globex.ratings.test":   {ID: 4, Name: "Globex", Status: models.TenantActive},
+		"initech.ratings.test":  {ID: 5, Name: "Initech", Status: models.TenantSuspended},
+		"umbrella.ratings.test": {ID: 6, Name: "Umbrella", Status: models.TenantProvisioning},
+	}
+
+	var cases = []struct {
+		name      string
+		host      string
+		gateway   string
+		err       error
+		outstatus int
+		outbody   string
+	}{
+		{"host", "acme.ratings.test", "", nil, http.StatusOK, `{"tenant":3,"context":3}`},
+		{"hostWithPort", "acme.ratings.test:8000", "", nil, http.StatusOK, `{"tenant":3,"context":3}`},
+		{"gateway", "internal:8000", "globex.ratings.test", nil, http.StatusOK, `{"tenant":4,"context":4}`},
+		{"unknown", "ratings.test", "", nil, http.StatusOK, `{"tenant":0,"context":0}`},
+		{"suspended", "initech.ratings.test", "", nil, http.StatusForbidden, `{"error":"tenant_unavailable"}`},
+		{"provisioning", "umbrella.ratings.test", "", nil, http.StatusForbidden, `{"error":"tenant_unavailable"}`},
+		{"serviceError", "acme.ratings.test", "", errors.New("connection lost"), http.StatusInternalServerError, `{"error":"server_error"}`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			ts := &modelstest.TenantService{
+				ByHostnameFunc: func(hostname string) (models.Tenant, error) {
+					if cs.err != nil {
+						return models.Tenant{}, cs.err
+					}
+
+					t, ok := hostnames[hostname]
+					if !ok {
+						return models.Tenant{}, models.ErrNotFound
+					}
+
+					return t, nil
+				},
+			}
+
+			mux := gin.New()
+			mux.Use(Tenant(ts, "X-Forwarded-Host"))
+			mux.GET("/", func(c *gin.Context) {
+				var id, ctxID int64
+				if v, ok := c.Get("tenant"); ok {
+					id = v.(*models.Tenant).ID
+				}
+				if t := models.TenantFrom(c.Request.Context()); t != nil {
+					ctxID = t.ID
+				}
+				c.JSON(http.StatusOK, gin.H{"tenant": id, "context": ctxID})
+			})
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.Host = cs.host
+			if cs.gateway != "" {
+				r.Header.Set("X-Forwarded-Host", cs.gateway)
+			}
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, cs.outstatus, w.Code)
+			assert.JSONEq(t, cs.outbody, w.Body.String())
+		})
+	}
+}
+
+func TestNoTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := NoTenant(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"test": "ok"})
+	})
+
+	mux := gin.New()
+	mux.GET("/", h)
+	mux.GET("/tenant", func(c *gin.Context) {
+		c.Set("tenant", &models.Tenant{ID: 3})
+		h(c)
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/tenant", nil)
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"forbidden"}`, w.Body.String())
+}
+
+func TestNoTenantSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := NoTenantSchema(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"test": "ok"})
+	})
+
+	var cases = []struct {
+		name      string
+		tenant    *models.Tenant
+		outstatus int
+	}{
+		{"noTenant", nil, http.StatusOK},
+		{"shared", &models.Tenant{ID: 3}, http.StatusOK},
+		{"schema", &models.Tenant{ID: 4, Schema: "tenant_4"}, http.StatusForbidden},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			mux := gin.New()
+			mux.GET("/", func(c *gin.Context) {
+				if cs.tenant != nil {
+					c.Set("tenant", cs.tenant)
+				}
+				h(c)
+			})
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/", nil)
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, cs.outstatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/tracing"
+)
+
+// Trace records a span for each request, named after its method and route, like
+// "GET /api/v1/ratings/:id". The span continues the trace propagated by the client, if
+// any, and its context is set on the request, so the handlers can start child spans
+// from c.Request.Context().
+func Trace(t *tracing.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := t.Extract(c.Request.Context(), c.Request.Header)
+		ctx, span := t.Start(ctx, c.Request.Method+" "+route(c), tracing.KindServer)
+		defer span.End()
+
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.target", c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.status_code", status)
+		if last := c.Errors.Last(); status >= http.StatusInternalServerError && last != nil {
+			span.SetError(last.Err)
+		}
+	}
+}
+
+// route returns the route of the path of the request, replacing the values of its
+// parameters with their names. It keeps the cardinality of the span names low.
+func route(c *gin.Context) string {
+	segments := strings.Split(c.Request.URL.Path, "/")
+	for _, p := range c.Params {
+		for i, s := range segments {
+			if s == p.Value {
+				segments[i] = ":" + p.Key
+				break
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tracer, rec := tracing.NewRecorder()
+	mux := gin.New()
+	mux.Use(Trace(tracer))
+	mux.GET("/api/v1/ratings/:id", func(c *gin.Context) {
+		_, span := tracer.Start(c.Request.Context(), "child", tracing.KindInternal)
+		span.End()
+		c.Status(http.StatusNoContent)
+	})
+	mux.GET("/fail", func(c *gin.Context) {
+		c.Error(errors.New("boom"))
+		c.Status(http.StatusInternalServerError)
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/ratings/12", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	mux.ServeHTTP(w, r)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/fail", nil)
+	mux.ServeHTTP(w, r)
+
+	spans := rec.Spans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, "GET /api/v1/ratings/:id", spans[0].Parent)
+
+	assert.Equal(t, "GET /api/v1/ratings/:id", spans[1].Name)
+	assert.Equal(t, tracing.KindServer, spans[1].Kind)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", spans[1].Parent)
+	assert.Equal(t, "/api/v1/ratings/12", spans[1].Attributes["http.target"])
+	assert.Equal(t, http.StatusNoContent, spans[1].Attributes["http.status_code"])
+	assert.NoError(t, spans[1].Err)
+
+	assert.Equal(t, "GET /fail", spans[2].Name)
+	assert.EqualError(t, spans[2].Err, "boom")
+
+	t.Run("disabled", func(t *testing.T) {
+		mux := gin.New()
+		mux.Use(Trace(nil))
+		mux.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/", nil)
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+}
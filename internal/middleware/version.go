@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	vendorPrefix = "application/vnd.ratingsapp."
+	vendorSuffix = "+json"
+)
+
+// APIVersion is a middleware that negotiates the version of the API with the Accept header.
+// A client may request a specific version with a vendor media type, like
+// "application/vnd.ratingsapp.v1+json".
+//
+// version is the version served by the route group the middleware is attached to, and
+// supported lists every version served by the application. Requests that don't ask for a
+// version are served by the group. Requests for an unknown version, or for a version
+// served by a different route group, are rejected with a 406 status code and the list of
+// supported versions.
+func APIVersion(version string, supported ...string) gin.HandlerFunc {
+	known := make(map[string]bool, len(supported))
+	for _, v := range supported {
+		known[v] = true
+	}
+
+	if !known[version] {
+		panic(wrap("the version served must be one of the supported versions", nil))
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept")
+
+		requested := acceptedVersions(c.GetHeader("Accept"))
+		if len(requested) == 0 {
+			c.Next()
+			return
+		}
+
+		var err error = ErrUnsupportedVersion
+		for _, v := range requested {
+			if v == version {
+				c.Header("Content-Type", vendorPrefix+version+vendorSuffix+"; charset=utf-8")
+				c.Next()
+				return
+			}
+
+			if known[v] {
+				err = ErrVersionMismatch
+			}
+		}
+
+		viewErr.JSONWith(c, err, gin.H{
+			"supported": supportedMediaTypes(supported),
+		})
+	}
+}
+
+// acceptedVersions extracts the API versions requested with vendor media types in the
+// Accept header acc, in the same order they are found.
+func acceptedVersions(acc string) []string {
+	var vs []string
+
+	for _, mt := range strings.Split(acc, ",") {
+		mt = strings.ToLower(strings.TrimSpace(strings.SplitN(mt, ";", 2)[0]))
+		if !strings.HasPrefix(mt, vendorPrefix) || !strings.HasSuffix(mt, vendorSuffix) {
+			continue
+		}
+
+		v := mt[len(vendorPrefix) : len(mt)-len(vendorSuffix)]
+		if v != "" {
+			vs = append(vs, v)
+		}
+	}
+
+	return vs
+}
+
+// supportedMediaTypes returns the vendor media types for each version in vs.
+func supportedMediaTypes(vs []string) []string {
+	mts := make([]string, len(vs))
+	for i, v := range vs {
+		mts[i] = vendorPrefix + v + vendorSuffix
+	}
+
+	return mts
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hdl := func(c *gin.Context) {
+		c.JSON(200, gin.H{"test": "ok"})
+	}
+
+	var cases = []struct {
+		name      string
+		atype     string
+		outstatus int
+		outctype  string
+		outbody   string
+	}{
+		{
+			"noAccept",
+			"",
+			http.StatusOK,
+			"application/json; charset=utf-8",
+			`{"test":"ok"}`,
+		},
+		{
+			"noVendorType",
+			"application/json, */*",
+			http.StatusOK,
+			"application/json; charset=utf-8",
+			`{"test":"ok"}`,
+		},
+		{
+			"versionMatch",
+			"application/vnd.ratingsapp.v1+json",
+			http.StatusOK,
+			"application/vnd.ratingsapp.v1+json; charset=utf-8",
+			`{"test":"ok"}`,
+		},
+		{
+			"versionMatchWithParams",
+			"text/html;q=0.9, Application/Vnd.RatingsApp.V1+JSON; q=0.8",
+			http.StatusOK,
+			"application/vnd.ratingsapp.v1+json; charset=utf-8",
+			`{"test":"ok"}`,
+		},
+		{
+			"versionMatchAfterUnknown",
+			"application/vnd.ratingsapp.v7+json, application/vnd.ratingsapp.v1+json",
+			http.StatusOK,
+			"application/vnd.ratingsapp.v1+json; charset=utf-8",
+			`{"test":"ok"}`,
+		},
+		{
+			"unsupportedVersion",
+			"application/vnd.ratingsapp.v7+json",
+			http.StatusNotAcceptable,
+			"application/json; charset=utf-8",
+			`{"error":"unsupported_version","supported":["application/vnd.ratingsapp.v1+json","application/vnd.ratingsapp.v2+json"]}`,
+		},
+		{
+			"versionMismatch",
+			"application/vnd.ratingsapp.v2+json",
+			http.StatusNotAcceptable,
+			"application/json; charset=utf-8",
+			`{"error":"version_mismatch","supported":["application/vnd.ratingsapp.v1+json","application/vnd.ratingsapp.v2+json"]}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			mux := gin.New()
+			mux.Use(APIVersion("v1", "v1", "v2"))
+			mux.GET("/", hdl)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			if cs.atype != "" {
+				c.Request.Header.Add("Accept", cs.atype)
+			}
+
+			mux.HandleContext(c)
+
+			assert.Equal(t, cs.outstatus, w.Code)
+			assert.Equal(t, cs.outctype, w.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+			assert.JSONEq(t, cs.outbody, w.Body.String())
+		})
+	}
+
+	t.Run("unknownServedVersion", func(t *testing.T) {
+		assert.Panics(t, func() {
+			APIVersion("v3", "v1", "v2")
+		}, "must not serve a version that is not supported")
+	})
+}
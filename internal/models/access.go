@@ -0,0 +1,131 @@
+package models
+
+// A UserAccess holds the effective permissions of a user, for the access
+// certification reviews. See AccessReport.
+type UserAccess struct {
+	UserID int64  `json:"userId"`
+	Email  string `json:"email"`
+	Active bool   `json:"active"`
+	RoleID int64  `json:"roleId"`
+	Role   string `json:"role"`
+
+	// Admin marks the users of the admin role, who can also run the
+	// administration endpoints.
+	Admin bool `json:"admin"`
+
+	// Permissions are the permissions the user is granted. The inactive
+	// users, and the users of a role that does not exist, have none.
+	Permissions Permissions `json:"permissions"`
+}
+
+// A PermissionInfo describes a permission, see AllPermissions.
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// A RoleChange reports the users who would gain or lose permissions if the
+// permissions of a role were changed, see PreviewRoleChange.
+type RoleChange struct {
+	RoleID int64 `json:"roleId"`
+
+	// Gained and Lost are the permissions the role would gain and lose.
+	Gained Permissions `json:"gained"`
+	Lost   Permissions `json:"lost"`
+
+	// Users are the active users of the role, with the permissions they
+	// would have after the change. It is empty if nothing changes.
+	Users []UserAccess `json:"users"`
+}
+
+// allPermissions returns all the permissions recognised by the application.
+func allPermissions() Permissions {
+	var all Permissions
+	for p := range permissionsToString {
+		all |= p
+	}
+
+	return all
+}
+
+// PermissionNames returns the names of all the permissions, in the order
+// Permissions.Names returns them.
+func PermissionNames() []string {
+	return allPermissions().Names()
+}
+
+// AllPermissions returns all the permissions, in the order of PermissionNames,
+// with what they allow.
+func AllPermissions() []PermissionInfo {
+	names := PermissionNames()
+	infos := make([]PermissionInfo, 0, len(names))
+	for _, n := range names {
+		infos = append(infos, PermissionInfo{
+			Name:        n,
+			Description: permissionDescriptions[permissionsFromString[n]],
+		})
+	}
+
+	return infos
+}
+
+// PreviewRoleChange reports what giving role the permissions p would change
+// for users, without changing anything. The users of other roles and the
+// inactive ones, who have no permissions, are left out. ErrReadOnly is returned
+// for the admin and user roles, which can't be changed.
+func PreviewRoleChange(role Role, p Permissions, users []User) (RoleChange, error) {
+	if role.ID == AdminRoleID || role.ID == UserRoleID {
+		return RoleChange{}, ErrReadOnly
+	}
+
+	rc := RoleChange{
+		RoleID: role.ID,
+		Gained: p &^ role.Permissions,
+		Lost:   role.Permissions &^ p,
+		Users:  []UserAccess{},
+	}
+	if rc.Gained == 0 && rc.Lost == 0 {
+		return rc, nil
+	}
+
+	changed := role
+	changed.Permissions = p
+	for _, ua := range AccessReport(users, []Role{changed}) {
+		if ua.Active && ua.RoleID == role.ID {
+			rc.Users = append(rc.Users, ua)
+		}
+	}
+
+	return rc, nil
+}
+
+// AccessReport returns the effective permissions of users, in their order,
+// granted by roles. The users can't be granted permissions by anything but
+// their role: there are neither per-user overrides nor inherited roles.
+func AccessReport(users []User, roles []Role) []UserAccess {
+	byID := make(map[int64]Role, len(roles))
+	for _, r := range roles {
+		byID[r.ID] = r
+	}
+
+	report := make([]UserAccess, 0, len(users))
+	for _, u := range users {
+		r, ok := byID[u.RoleID]
+
+		a := UserAccess{
+			UserID: u.ID,
+			Email:  u.Email,
+			Active: u.Active,
+			RoleID: u.RoleID,
+			Role:   r.Label,
+			Admin:  ok && u.Active && u.RoleID == AdminRoleID,
+		}
+		if ok && u.Active {
+			a.Permissions = r.Permissions
+		}
+
+		report = append(report, a)
+	}
+
+	return report
+}
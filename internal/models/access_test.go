@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermissionNames(t *testing.T) {
+	assert.Equal(t, []string{"readUsers", "writeUsers", "readRatings", "writeRatings", "writeOwnRatings"}, PermissionNames())
+}
+
+func TestAccessReport(t *testing.T) {
+	roles := []Role{
+		{ID: 1, Label: "admin", Permissions: PermissionReadUsers | PermissionWriteUsers | PermissionReadRatings | PermissionWriteRatings},
+		{ID: 2, Label: "user", Permissions: PermissionReadRatings | PermissionWriteRatings},
+	}
+	users := []User{
+		{ID: 3, Active: true, Email: "user@test.com", RoleID: 2},
+		{ID: 1, Active: true, Email: "admin@test.com", RoleID: 1},
+		{ID: 4, Active: false, Email: "inactive@test.com", RoleID: 1},
+		{ID: 5, Active: true, Email: "orphan@test.com", RoleID: 9},
+	}
+
+	assert.Equal(t, []UserAccess{
+		{UserID: 3, Active: true, Email: "user@test.com", RoleID: 2, Role: "user", Permissions: PermissionReadRatings | PermissionWriteRatings},
+		{UserID: 1, Active: true, Email: "admin@test.com", RoleID: 1, Role: "admin", Admin: true, Permissions: roles[0].Permissions},
+		{UserID: 4, Active: false, Email: "inactive@test.com", RoleID: 1, Role: "admin"},
+		{UserID: 5, Active: true, Email: "orphan@test.com", RoleID: 9},
+	}, AccessReport(users, roles))
+
+	assert.Equal(t, []UserAccess{}, AccessReport(nil, roles))
+}
+
+func TestAllPermissions(t *testing.T) {
+	infos := AllPermissions()
+
+	var names []string
+	for _, pi := range infos {
+		names = append(names, pi.Name)
+		assert.NotEmpty(t, pi.Description, "every permission must be described: %s", pi.Name)
+	}
+	assert.Equal(t, PermissionNames(), names)
+}
+
+func TestRole_Clone(t *testing.T) {
+	admin := Role{ID: 1, Label: "admin", Permissions: Permissions(-1), Version: 3}
+	assert.Equal(t, Role{Label: "auditor", Permissions: allPermissions()}, admin.Clone("auditor"))
+
+	editor := Role{ID: 7, Label: "editor", Permissions: PermissionReadRatings | PermissionWriteRatings, Version: 2}
+	assert.Equal(t, Role{Label: "editor copy", Permissions: editor.Permissions}, editor.Clone("editor copy"))
+}
+
+func TestPreviewRoleChange(t *testing.T) {
+	role := Role{ID: 7, Label: "editor", Permissions: PermissionReadRatings | PermissionWriteRatings}
+	users := []User{
+		{ID: 3, Active: true, Email: "editor@test.com", RoleID: 7},
+		{ID: 4, Active: false, Email: "inactive@test.com", RoleID: 7},
+		{ID: 5, Active: true, Email: "other@test.com", RoleID: 8},
+	}
+
+	rc, err := PreviewRoleChange(role, PermissionReadRatings|PermissionReadUsers, users)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleChange{
+		RoleID: 7,
+		Gained: PermissionReadUsers,
+		Lost:   PermissionWriteRatings,
+		Users: []UserAccess{
+			{UserID: 3, Active: true, Email: "editor@test.com", RoleID: 7, Role: "editor", Permissions: PermissionReadRatings | PermissionReadUsers},
+		},
+	}, rc)
+
+	rc, err = PreviewRoleChange(role, role.Permissions, users)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleChange{RoleID: 7, Users: []UserAccess{}}, rc, "no user is affected if nothing changes")
+
+	_, err = PreviewRoleChange(Role{ID: 1}, PermissionReadUsers, users)
+	assert.Equal(t, ErrReadOnly, err)
+}
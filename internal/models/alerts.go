@@ -0,0 +1,382 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/alerts.go -pkg modelstest . AlertService:AlertService
+
+// AlertService defines a set of methods to be used when dealing with the alert
+// rules, which notify their owners when the recent average score of targets
+// drops below a threshold.
+type AlertService interface {
+	AlertDB
+}
+
+// AlertDB defines how the service interacts with the database.
+type AlertDB interface {
+	// Create adds an alert rule to the system. The Name, Below, OwnerID
+	// and Channel fields are required, as well as either Target or Tag.
+	// The input parameter will be modified with normalised values and ID
+	// will be set to the new rule ID.
+	Create(*AlertRule) error
+
+	// Update replaces the values of the rule with ID r.ID, except its
+	// owner. The state of the rule is kept, so the targets already below
+	// the threshold are not notified again.
+	Update(*AlertRule) error
+
+	// Delete removes an alert rule by ID, along with its alerts.
+	Delete(id int64) error
+
+	// ByID retrieves an alert rule by ID.
+	ByID(id int64) (AlertRule, error)
+
+	// List retrieves all the alert rules, sorted by ID.
+	List() ([]AlertRule, error)
+
+	// Evaluate computes the average score of the targets of every rule
+	// over its window, and alerts the owners of the rules of the targets
+	// whose average dropped below the threshold since the previous
+	// evaluation. Targets without ratings in the window are not
+	// evaluated.
+	Evaluate() error
+}
+
+// maxAlertWindowDays is the longest window of an alert rule.
+const maxAlertWindowDays = 365
+
+// An AlertRule alerts its owner when the average score of a target, or of any
+// target of a tag, over the last WindowDays days drops below a threshold.
+type AlertRule struct {
+	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
+
+	Name string `gorm:"size:128;not null" json:"name"`
+
+	// Target or Tag, but not both, select the targets evaluated.
+	Target *int64 `gorm:"type:bigint" json:"target,omitempty"`
+	Tag    string `gorm:"size:64;not null" json:"tag,omitempty"`
+
+	// WindowDays is the number of days the average is computed over, 7
+	// by default.
+	WindowDays int `gorm:"type:int;not null" json:"windowDays"`
+
+	// Below is the threshold the average must drop below.
+	Below float64 `gorm:"not null" json:"below"`
+
+	// OwnerID is the user alerted, through Channel as in Subscription.
+	OwnerID    int64  `gorm:"type:bigint;not null" json:"ownerId"`
+	Channel    string `gorm:"size:16;not null" json:"channel"`
+	WebhookURL string `gorm:"size:2048;not null" json:"webhookUrl,omitempty"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// alertRuleState is the state of an AlertRule for one of its targets.
+type alertRuleState struct {
+	RuleID      int64     `gorm:"primary_key;type:bigint"`
+	Target      int64     `gorm:"primary_key;type:bigint"`
+	Firing      bool      `gorm:"not null"`
+	Average     float64   `gorm:"not null"`
+	EvaluatedAt time.Time `gorm:"type:timestamptz;not null"`
+}
+
+type alertService struct {
+	AlertDB
+}
+
+// NewAlertService instantiates a new AlertService implementation with db as
+// the backing database, accepting the channels given besides ChannelInApp and
+// delivering their alerts with senders.
+func NewAlertService(db *gorm.DB, senders map[string]NotificationSender) AlertService {
+	channels := make([]string, 0, len(senders))
+	for ch := range senders {
+		channels = append(channels, ch)
+	}
+
+	return newAlertService(db, &notifier{db: db, senders: senders}, channels, SystemClock)
+}
+
+// newAlertService instantiates a new AlertService implementation delivering the
+// alerts with n, whose probation also applies to the averages.
+func newAlertService(db *gorm.DB, n *notifier, channels []string, clock Clock) AlertService {
+	return &alertService{
+		AlertDB: &alertValidator{
+			AlertDB:  &alertGorm{db: db, notifier: n, clock: clock},
+			channels: enabledChannels(channels),
+		},
+	}
+}
+
+type alertValidator struct {
+	AlertDB
+
+	// channels are the channels enabled.
+	channels map[string]bool
+}
+
+func (av *alertValidator) Create(r *AlertRule) error {
+	r.ID = 0
+
+	ve := av.validate(r)
+	if r.OwnerID < 1 {
+		ve["ownerId"] = ErrRequired
+	}
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return av.AlertDB.Create(r)
+}
+
+func (av *alertValidator) Update(r *AlertRule) error {
+	if r.ID < 1 {
+		return ErrNotFound
+	}
+
+	ve := av.validate(r)
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return av.AlertDB.Update(r)
+}
+
+// validate checks the fields of r but its owner, normalising them.
+func (av *alertValidator) validate(r *AlertRule) ValidationError {
+	ve := ValidationError{}
+
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		ve["name"] = ErrRequired
+	} else if len(r.Name) > 128 {
+		ve["name"] = ErrTooLong
+	}
+
+	r.Tag = normaliseTag(r.Tag)
+	switch {
+	case r.Target != nil && r.Tag != "":
+		ve["tag"] = ErrInvalid
+	case r.Target != nil && *r.Target < 1:
+		ve["target"] = ErrInvalid
+	case r.Target == nil && r.Tag == "":
+		ve["target"] = ErrRequired
+	case len(r.Tag) > 64:
+		ve["tag"] = ErrTooLong
+	}
+
+	if r.WindowDays == 0 {
+		r.WindowDays = 7
+	} else if r.WindowDays < 0 || r.WindowDays > maxAlertWindowDays {
+		ve["windowDays"] = ErrInvalid
+	}
+
+	if r.Below <= 0 {
+		ve["below"] = ErrRequired
+	}
+
+	validateChannel(ve, av.channels, r.Channel, &r.WebhookURL)
+
+	return ve
+}
+
+func (av *alertValidator) Delete(id int64) error {
+	if id < 1 {
+		return ErrNotFound
+	}
+
+	return av.AlertDB.Delete(id)
+}
+
+func (av *alertValidator) ByID(id int64) (AlertRule, error) {
+	if id < 1 {
+		return AlertRule{}, ErrNotFound
+	}
+
+	return av.AlertDB.ByID(id)
+}
+
+type alertGorm struct {
+	db *gorm.DB
+
+	// notifier delivers the alerts.
+	notifier *notifier
+
+	// clock dates the rules created, and their evaluations.
+	clock Clock
+}
+
+func (ag *alertGorm) Create(r *AlertRule) error {
+	r.CreatedAt = ag.clock.Now()
+	err := ag.db.Create(r).Error
+	if err != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ValidationError{"ownerId": ErrRefNotFound}
+		}
+
+		return wrap("could not create alert rule", err)
+	}
+
+	return nil
+}
+
+func (ag *alertGorm) Update(r *AlertRule) error {
+	res := ag.db.Model(&AlertRule{}).Where("id = ?", r.ID).Updates(map[string]interface{}{
+		"name":        r.Name,
+		"target":      r.Target,
+		"tag":         r.Tag,
+		"window_days": r.WindowDays,
+		"below":       r.Below,
+		"channel":     r.Channel,
+		"webhook_url": r.WebhookURL,
+	})
+	if res.Error != nil {
+		return with(wrap("could not update alert rule", res.Error), "alert_rule_id", r.ID)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	var err error
+	*r, err = ag.ByID(r.ID)
+	return err
+}
+
+func (ag *alertGorm) Delete(id int64) error {
+	res := ag.db.Delete(&AlertRule{}, id)
+	if res.Error != nil {
+		return with(wrap("could not delete alert rule", res.Error), "alert_rule_id", id)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (ag *alertGorm) ByID(id int64) (AlertRule, error) {
+	var r AlertRule
+	err := ag.db.First(&r, id).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return AlertRule{}, ErrNotFound
+		}
+		return AlertRule{}, with(wrap("could not get alert rule by ID", err), "alert_rule_id", id)
+	}
+
+	return r, nil
+}
+
+func (ag *alertGorm) List() ([]AlertRule, error) {
+	rules := []AlertRule{}
+	err := ag.db.Order("id").Find(&rules).Error
+	if err != nil {
+		return nil, wrap("could not list alert rules", err)
+	}
+
+	return rules, nil
+}
+
+func (ag *alertGorm) Evaluate() error {
+	rules, err := ag.List()
+	if err != nil {
+		return err
+	}
+
+	// every rule is evaluated, even if others fail
+	var firstErr error
+	for _, r := range rules {
+		err = ag.evaluate(r, ag.clock.Now())
+		if err != nil && firstErr == nil {
+			firstErr = with(err, "alert_rule_id", r.ID)
+		}
+	}
+
+	return firstErr
+}
+
+// evaluate evaluates r at now.
+func (ag *alertGorm) evaluate(r AlertRule, now time.Time) error {
+	var averages []struct {
+		Target  int64
+		Average float64
+	}
+
+	q := ag.notifier.probation.counted(ag.db.Model(&Rating{})).
+		Select("target, avg(score) AS average").
+		Where("active AND created_at > ?", now.AddDate(0, 0, -r.WindowDays))
+	if r.Target != nil {
+		q = q.Where("target = ?", *r.Target)
+	} else {
+		q = q.Where("target IN (SELECT target FROM target_tags WHERE tag = ?)", r.Tag)
+	}
+
+	err := q.Group("target").Order("target").Scan(&averages).Error
+	if err != nil {
+		return wrap("could not compute alert averages", err)
+	}
+	if len(averages) == 0 {
+		return nil
+	}
+
+	var states []alertRuleState
+	err = ag.db.Where("rule_id = ?", r.ID).Find(&states).Error
+	if err != nil {
+		return wrap("could not get alert rule states", err)
+	}
+
+	firing := make(map[int64]bool, len(states))
+	for _, s := range states {
+		firing[s.Target] = s.Firing
+	}
+
+	var owner User
+	err = ag.db.First(&owner, r.OwnerID).Error
+	if err != nil {
+		return wrap("could not get alert rule owner", err)
+	}
+
+	// alerts are delivered through the channel of the rule, as if it was
+	// a subscription to each target
+	sub := Subscription{
+		UserID:       r.OwnerID,
+		Channel:      r.Channel,
+		WebhookURL:   r.WebhookURL,
+		AverageBelow: &r.Below,
+	}
+
+	for _, a := range averages {
+		below := a.Average < r.Below
+		if below && !firing[a.Target] && owner.Active {
+			sub.Target = a.Target
+			err = ag.notifier.deliver(owner, sub, Notification{
+				UserID:      r.OwnerID,
+				Kind:        NotificationAlert,
+				Target:      a.Target,
+				AlertRuleID: &r.ID,
+				Average:     a.Average,
+				CreatedAt:   now,
+			})
+			if err != nil {
+				// retried on the next evaluation
+				return err
+			}
+		}
+
+		err = ag.db.Exec(`INSERT INTO alert_rule_states (rule_id, target, firing, average, evaluated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (rule_id, target) DO UPDATE SET
+				firing = EXCLUDED.firing,
+				average = EXCLUDED.average,
+				evaluated_at = EXCLUDED.evaluated_at`,
+			r.ID, a.Target, below, a.Average, now).Error
+		if err != nil {
+			return with(wrap("could not save alert rule state", err), "target", a.Target)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type testAlertDB struct {
+	AlertDB
+}
+
+func (t *testAlertDB) Create(r *AlertRule) error {
+	return nil
+}
+
+func (t *testAlertDB) Update(r *AlertRule) error {
+	return nil
+}
+
+func TestAlertValidator(t *testing.T) {
+	as := newAlertService(nil, nil, []string{ChannelWebhook}, SystemClock)
+	as.(*alertService).AlertDB.(*alertValidator).AlertDB = &testAlertDB{}
+
+	target := int64(9)
+	valid := func() *AlertRule {
+		return &AlertRule{Name: " Drop ", Target: &target, Below: 3, OwnerID: 1, Channel: ChannelInApp}
+	}
+
+	var cases = []struct {
+		name   string
+		change func(*AlertRule)
+		outerr error
+	}{
+		{"ok", func(r *AlertRule) {}, nil},
+		{"tag", func(r *AlertRule) { r.Target, r.Tag = nil, " Shoes " }, nil},
+		{"nameRequired", func(r *AlertRule) { r.Name = " " }, ValidationError{"name": ErrRequired}},
+		{"targetRequired", func(r *AlertRule) { r.Target = nil }, ValidationError{"target": ErrRequired}},
+		{"targetInvalid", func(r *AlertRule) { r.Target = new(int64) }, ValidationError{"target": ErrInvalid}},
+		{"targetAndTag", func(r *AlertRule) { r.Tag = "shoes" }, ValidationError{"tag": ErrInvalid}},
+		{"windowDaysInvalid", func(r *AlertRule) { r.WindowDays = maxAlertWindowDays + 1 }, ValidationError{"windowDays": ErrInvalid}},
+		{"belowRequired", func(r *AlertRule) { r.Below = 0 }, ValidationError{"below": ErrRequired}},
+		{"ownerIdRequired", func(r *AlertRule) { r.OwnerID = 0 }, ValidationError{"ownerId": ErrRequired}},
+		{"channelDisabled", func(r *AlertRule) { r.Channel = ChannelEmail }, ValidationError{"channel": ErrInvalid}},
+		{"webhookUrlRequired", func(r *AlertRule) { r.Channel = ChannelWebhook }, ValidationError{"webhookUrl": ErrRequired}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := valid()
+			r.ID = 55
+			tc.change(r)
+
+			err := as.Create(r)
+			assert.Equal(t, tc.outerr, err)
+			if tc.outerr == nil {
+				assert.Equal(t, int64(0), r.ID, "must not use the ID provided")
+				assert.Equal(t, "Drop", r.Name)
+				assert.Equal(t, 7, r.WindowDays)
+			}
+		})
+	}
+
+	t.Run("tagNormalised", func(t *testing.T) {
+		r := valid()
+		r.Target, r.Tag = nil, " Shoes "
+		require.NoError(t, as.Create(r))
+		assert.Equal(t, "shoes", r.Tag)
+	})
+
+	t.Run("updateNotFound", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, as.Update(valid()))
+	})
+}
+
+func TestAlertGorm(t *testing.T) {
+	db := setupGorm(t)
+	email := &testNotificationSender{}
+	n := &notifier{db: db, senders: map[string]NotificationSender{ChannelEmail: email}}
+	as := newAlertService(db, n, []string{ChannelEmail}, SystemClock)
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh", Active: true}).Error)
+
+	target := int64(9)
+	rule := AlertRule{Name: "Drop", Target: &target, Below: 3, OwnerID: 1, Channel: ChannelEmail}
+	require.NoError(t, as.Create(&rule))
+	assert.NotZero(t, rule.ID)
+
+	t.Run("unknownOwner", func(t *testing.T) {
+		bad := rule
+		bad.OwnerID = 404
+		assert.Equal(t, ValidationError{"ownerId": ErrRefNotFound}, as.Create(&bad))
+	})
+
+	tagged := AlertRule{Name: "Shoes", Tag: "shoes", Below: 4, OwnerID: 98, Channel: ChannelInApp}
+	require.NoError(t, as.Create(&tagged))
+
+	require.NoError(t, db.Create(&TargetTag{Target: 7, Tag: "shoes"}).Error)
+	require.NoError(t, db.Create(&TargetTag{Target: 9, Tag: "shoes"}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 7, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 9, UserID: 1}).Error)
+	// outside of the window
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 98}).Error)
+	require.NoError(t, db.Exec("UPDATE ratings SET created_at = now() - interval '8 days' WHERE user_id = 98").Error)
+
+	require.NoError(t, as.Evaluate())
+	require.Len(t, email.sent, 1)
+	assert.Equal(t, NotificationAlert, email.sent[0].Kind)
+	assert.Equal(t, int64(9), email.sent[0].Target)
+	assert.Equal(t, float64(2), email.sent[0].Average)
+	assert.Equal(t, rule.ID, *email.sent[0].AlertRuleID)
+
+	var ns []Notification
+	require.NoError(t, db.Where("user_id = 98").Find(&ns).Error)
+	require.Len(t, ns, 1, "only target 9 of the tag is below")
+	assert.Equal(t, int64(9), ns[0].Target)
+	assert.Nil(t, ns[0].RatingID)
+
+	require.NoError(t, as.Evaluate())
+	assert.Len(t, email.sent, 1, "must not alert twice while below")
+
+	rule.Below = 1
+	require.NoError(t, as.Update(&rule))
+	assert.Equal(t, int64(1), rule.OwnerID)
+	require.NoError(t, as.Evaluate())
+	rule.Below = 3
+	require.NoError(t, as.Update(&rule))
+	require.NoError(t, as.Evaluate())
+	assert.Len(t, email.sent, 2, "must alert again after recovering")
+
+	list, err := as.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	require.NoError(t, as.Delete(tagged.ID))
+	_, err = as.ByID(tagged.ID)
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+	require.NoError(t, db.Where("user_id = 98").Find(&ns).Error)
+	assert.Empty(t, ns, "must delete the alerts of the rule")
+}
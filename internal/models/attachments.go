@@ -0,0 +1,352 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/storage"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/attachments.go -pkg modelstest . AttachmentService:AttachmentService
+
+// AttachmentService defines a set of methods to be used when dealing with the
+// files attached to the ratings.
+type AttachmentService interface {
+	// Create stores the content of a file attached to the rating
+	// a.RatingID by the user a.UserID, which is a.Size bytes long, and
+	// adds its metadata. The type of the content is detected, and must be
+	// one of AttachmentTypes. ID, Key, ContentType and CreatedAt are set.
+	//
+	// A ValidationError is returned for the "file" field if the file is
+	// empty, larger than MaxAttachmentSize or of another type, and for
+	// the "attachments" field if the rating already has
+	// MaxRatingAttachments attachments.
+	Create(a *Attachment, content io.ReadSeeker) error
+
+	// Open opens the content of an attachment, which must be closed once
+	// read.
+	Open(a Attachment) (io.ReadCloser, error)
+
+	AttachmentDB
+}
+
+// AttachmentDB defines how the service interacts with the database.
+type AttachmentDB interface {
+	// Delete removes the attachment with ID id of the rating ratingID,
+	// and its content.
+	Delete(ratingID, id int64) error
+
+	// ByID retrieves an attachment by ID.
+	ByID(id int64) (Attachment, error)
+
+	// ByRatings retrieves the attachments of the ratings, by rating ID,
+	// oldest first. The ratings without attachments are left out.
+	ByRatings(ratingIDs []int64) (map[int64][]Attachment, error)
+}
+
+const (
+	// MaxAttachmentSize is the maximum size of an attachment, in bytes.
+	MaxAttachmentSize = 5 << 20
+
+	// MaxRatingAttachments is the maximum number of attachments of a
+	// rating.
+	MaxRatingAttachments = 5
+)
+
+// AttachmentTypes are the content types of the files accepted as attachments.
+var AttachmentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf"}
+
+// An Attachment is a file, like a picture, attached to a rating.
+type Attachment struct {
+	ID       int64 `gorm:"primary_key;type:bigserial" json:"id"`
+	RatingID int64 `gorm:"type:bigint;not null" json:"ratingId"`
+
+	// UserID is the ID of the user who uploaded the file.
+	UserID int64 `gorm:"type:bigint;not null" json:"userId"`
+
+	// Key is the key of the content in the storage.
+	Key string `gorm:"size:128;not null" json:"-"`
+
+	// Name is the name of the file uploaded, without its directories.
+	Name        string `gorm:"size:255;not null" json:"name"`
+	ContentType string `gorm:"size:64;not null" json:"contentType"`
+	Size        int64  `gorm:"type:bigint;not null" json:"size"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+type attachmentService struct {
+	AttachmentDB
+
+	db    *attachmentGorm
+	files storage.Storage
+}
+
+// NewAttachmentService instantiates a new AttachmentService implementation with
+// db as the backing database, keeping the content of the attachments in files.
+func NewAttachmentService(db *gorm.DB, files storage.Storage) AttachmentService {
+	return newAttachmentService(db, files, SystemClock)
+}
+
+// newAttachmentService instantiates a new AttachmentService implementation, as
+// NewAttachmentService does, dating the attachments with clock.
+func newAttachmentService(db *gorm.DB, files storage.Storage, clock Clock) AttachmentService {
+	ag := &attachmentGorm{db: db, files: files, clock: clock}
+
+	return &attachmentService{
+		AttachmentDB: ag,
+		db:           ag,
+		files:        files,
+	}
+}
+
+func (as *attachmentService) Create(a *Attachment, content io.ReadSeeker) error {
+	a.ID = 0
+
+	ve := ValidationError{}
+
+	a.Name = attachmentName(a.Name)
+	if a.Name == "" {
+		ve["name"] = ErrRequired
+	}
+
+	if a.UserID < 1 {
+		ve["userId"] = ErrRequired
+	}
+
+	switch {
+	case a.Size < 1:
+		ve["file"] = ErrRequired
+	case a.Size > MaxAttachmentSize:
+		ve["file"] = ErrTooLong
+	default:
+		var err error
+		a.ContentType, err = detectAttachmentType(content)
+		if err != nil {
+			return err
+		} else if a.ContentType == "" {
+			ve["file"] = ErrInvalid
+		}
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	if a.RatingID < 1 {
+		return ErrNotFound
+	}
+
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		return wrap("could not generate attachment key", err)
+	}
+	a.Key = "attachments/" + hex.EncodeToString(key)
+
+	err = as.files.Put(a.Key, content, a.Size, a.ContentType)
+	if err != nil {
+		return with(wrap("could not store attachment", err), "rating_id", a.RatingID)
+	}
+
+	err = as.db.create(a)
+	if err != nil {
+		// the file is not referenced without its metadata
+		as.files.Delete(a.Key)
+		return err
+	}
+
+	return nil
+}
+
+func (as *attachmentService) Open(a Attachment) (io.ReadCloser, error) {
+	f, err := as.files.Get(a.Key)
+	if xerrors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, with(wrap("could not open attachment", err), "attachment_id", a.ID)
+	}
+
+	return f, nil
+}
+
+// attachmentName returns the name of an uploaded file without its directories,
+// truncated to 255 bytes.
+func attachmentName(name string) string {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
+
+// detectAttachmentType returns the content type of content, if it is one of
+// AttachmentTypes, and an empty string otherwise. It rewinds content.
+func detectAttachmentType(content io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !xerrors.Is(err, io.ErrUnexpectedEOF) && !xerrors.Is(err, io.EOF) {
+		return "", wrap("could not read attachment", err)
+	}
+
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", wrap("could not rewind attachment", err)
+	}
+
+	detected := http.DetectContentType(head[:n])
+	for _, t := range AttachmentTypes {
+		if detected == t {
+			return t, nil
+		}
+	}
+
+	return "", nil
+}
+
+type attachmentGorm struct {
+	db    *gorm.DB
+	files storage.Storage
+	clock Clock
+}
+
+// create adds the metadata of an attachment whose content is stored, if its
+// rating has less than MaxRatingAttachments attachments.
+func (ag *attachmentGorm) create(a *Attachment) error {
+	return gormTransaction(ag.db, func(tx *gorm.DB) error {
+		// locks the rating, so its attachments are counted once at a time
+		var ids []int64
+		err := tx.Raw("SELECT id FROM ratings WHERE id = ? FOR UPDATE", a.RatingID).Pluck("id", &ids).Error
+		if err != nil {
+			return with(wrap("could not look up the rating of the attachment", err), "rating_id", a.RatingID)
+		} else if len(ids) == 0 {
+			return ErrNotFound
+		}
+
+		var ct int
+		err = tx.Model(&Attachment{}).Where("rating_id = ?", a.RatingID).Count(&ct).Error
+		if err != nil {
+			return with(wrap("could not count the attachments of the rating", err), "rating_id", a.RatingID)
+		} else if ct >= MaxRatingAttachments {
+			return ValidationError{"attachments": ErrTooLong}
+		}
+
+		a.CreatedAt = ag.clock.Now()
+		err = tx.Create(a).Error
+		if err != nil {
+			return with(wrap("could not create attachment", err), "rating_id", a.RatingID)
+		}
+
+		return nil
+	})
+}
+
+func (ag *attachmentGorm) Delete(ratingID, id int64) error {
+	var a Attachment
+	err := ag.db.Where("rating_id = ?", ratingID).First(&a, id).Error
+	if xerrors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	} else if err != nil {
+		return with(wrap("could not get attachment by ID", err), "attachment_id", id)
+	}
+
+	err = ag.db.Delete(&Attachment{}, id).Error
+	if err != nil {
+		return with(wrap("could not delete attachment", err), "attachment_id", id)
+	}
+
+	err = ag.files.Delete(a.Key)
+	if err != nil {
+		return with(wrap("could not delete the content of the attachment", err), "attachment_id", id)
+	}
+
+	return nil
+}
+
+func (ag *attachmentGorm) ByID(id int64) (Attachment, error) {
+	if id < 1 {
+		return Attachment{}, ErrNotFound
+	}
+
+	var a Attachment
+	err := ag.db.First(&a, id).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return Attachment{}, ErrNotFound
+		}
+		return Attachment{}, with(wrap("could not get attachment by ID", err), "attachment_id", id)
+	}
+
+	return a, nil
+}
+
+func (ag *attachmentGorm) ByRatings(ratingIDs []int64) (map[int64][]Attachment, error) {
+	byRating := make(map[int64][]Attachment)
+	if len(ratingIDs) == 0 {
+		return byRating, nil
+	}
+
+	var attachments []Attachment
+	err := ag.db.Where("rating_id IN (?)", ratingIDs).Order("rating_id, id").Find(&attachments).Error
+	if err != nil {
+		return nil, wrap("could not list the attachments of the ratings", err)
+	}
+
+	for _, a := range attachments {
+		byRating[a.RatingID] = append(byRating[a.RatingID], a)
+	}
+
+	return byRating, nil
+}
+
+// ratingAttachments is a RatingService decorator removing the content of the
+// attachments of the ratings deleted. Their metadata go along with the ratings.
+type ratingAttachments struct {
+	RatingService
+	attachments AttachmentDB
+	files       storage.Storage
+}
+
+func (ra *ratingAttachments) Scoped(u *User) RatingService {
+	scoped := ra.RatingService.Scoped(u)
+	if scoped == ra.RatingService {
+		return ra
+	}
+
+	return &ratingAttachments{RatingService: scoped, attachments: ra.attachments, files: ra.files}
+}
+
+func (ra *ratingAttachments) Delete(r *Rating) error {
+	byRating, err := ra.attachments.ByRatings([]int64{r.ID})
+	if err != nil {
+		return err
+	}
+
+	err = ra.RatingService.Delete(r)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range byRating[r.ID] {
+		err = ra.files.Delete(a.Key)
+		if err != nil {
+			return with(wrap("could not delete the content of an attachment of the rating", err), "attachment_id", a.ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// pngHeader is enough of a PNG file for its type to be detected.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestAttachmentService_Create(t *testing.T) {
+	files, err := storage.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	as := NewAttachmentService(nil, files)
+
+	var cases = []struct {
+		name    string
+		content []byte
+		change  func(*Attachment)
+		outerr  error
+	}{
+		{"empty", nil, func(a *Attachment) {}, ValidationError{"file": ErrRequired}},
+		{"tooLarge", pngHeader, func(a *Attachment) { a.Size = MaxAttachmentSize + 1 }, ValidationError{"file": ErrTooLong}},
+		{"text", []byte("just some text"), func(a *Attachment) {}, ValidationError{"file": ErrInvalid}},
+		{"html", []byte("<html><body>hi</body></html>"), func(a *Attachment) {}, ValidationError{"file": ErrInvalid}},
+		{"nameRequired", pngHeader, func(a *Attachment) { a.Name = "../" }, ValidationError{"name": ErrRequired}},
+		{"userRequired", pngHeader, func(a *Attachment) { a.UserID = 0 }, ValidationError{"userId": ErrRequired}},
+		{"ratingNotFound", pngHeader, func(a *Attachment) { a.RatingID = 0 }, ErrNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &Attachment{RatingID: 10, UserID: 1, Name: "picture.png", Size: int64(len(tc.content))}
+			tc.change(a)
+
+			err := as.Create(a, bytes.NewReader(tc.content))
+			assert.Equal(t, tc.outerr, err)
+		})
+	}
+}
+
+func TestAttachmentName(t *testing.T) {
+	assert.Equal(t, "picture.png", attachmentName("picture.png"))
+	assert.Equal(t, "picture.png", attachmentName(`C:\Users\me\picture.png`))
+	assert.Equal(t, "passwd", attachmentName("../../etc/passwd"))
+	assert.Equal(t, "", attachmentName(" "))
+	assert.Len(t, attachmentName(strings.Repeat("é", 200)), 254, "must not split a character")
+}
+
+func TestDetectAttachmentType(t *testing.T) {
+	content := bytes.NewReader(append(pngHeader, bytes.Repeat([]byte{0}, 1024)...))
+	ct, err := detectAttachmentType(content)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", ct)
+
+	read, err := ioutil.ReadAll(content)
+	require.NoError(t, err)
+	assert.Len(t, read, len(pngHeader)+1024, "must rewind the content")
+
+	ct, err = detectAttachmentType(strings.NewReader("%PDF-1.4\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", ct)
+}
+
+func TestAttachmentGorm(t *testing.T) {
+	db := setupGorm(t)
+	files, err := storage.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	as := NewAttachmentService(db, files)
+
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1}).Error)
+
+	t.Run("ratingNotFound", func(t *testing.T) {
+		a := &Attachment{RatingID: 404, UserID: 1, Name: "picture.png", Size: int64(len(pngHeader))}
+		assert.Equal(t, ErrNotFound, as.Create(a, bytes.NewReader(pngHeader)))
+
+		_, err := files.Get(a.Key)
+		assert.True(t, xerrors.Is(err, storage.ErrNotFound), "must remove the file without its metadata")
+	})
+
+	var created []Attachment
+	for i := 0; i < MaxRatingAttachments; i++ {
+		a := Attachment{RatingID: 10, UserID: 1, Name: "picture.png", Size: int64(len(pngHeader))}
+		require.NoError(t, as.Create(&a, bytes.NewReader(pngHeader)))
+		assert.NotZero(t, a.ID)
+		assert.Equal(t, "image/png", a.ContentType)
+		created = append(created, a)
+	}
+
+	t.Run("tooMany", func(t *testing.T) {
+		a := &Attachment{RatingID: 10, UserID: 1, Name: "picture.png", Size: int64(len(pngHeader))}
+		assert.Equal(t, ValidationError{"attachments": ErrTooLong}, as.Create(a, bytes.NewReader(pngHeader)))
+	})
+
+	a, err := as.ByID(created[0].ID)
+	require.NoError(t, err)
+	f, err := as.Open(a)
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, pngHeader, content)
+
+	byRating, err := as.ByRatings([]int64{10, 11})
+	require.NoError(t, err)
+	assert.Len(t, byRating[10], MaxRatingAttachments)
+	assert.NotContains(t, byRating, int64(11))
+
+	assert.True(t, xerrors.Is(as.Delete(11, a.ID), ErrNotFound), "must not delete the attachments of other ratings")
+	require.NoError(t, as.Delete(10, a.ID))
+	_, err = as.ByID(a.ID)
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+	_, err = as.Open(a)
+	assert.True(t, xerrors.Is(err, ErrNotFound), "must remove the file")
+}
+
+type testAttachmentDB struct {
+	AttachmentDB
+	byRatings func([]int64) (map[int64][]Attachment, error)
+}
+
+func (t *testAttachmentDB) ByRatings(ratingIDs []int64) (map[int64][]Attachment, error) {
+	return t.byRatings(ratingIDs)
+}
+
+type testDeletedRatingService struct {
+	RatingService
+	err error
+}
+
+func (t *testDeletedRatingService) Delete(r *Rating) error {
+	return t.err
+}
+
+func TestRatingAttachments_Delete(t *testing.T) {
+	files, err := storage.NewDisk(t.TempDir())
+	require.NoError(t, err)
+
+	put := func(key string) {
+		require.NoError(t, files.Put(key, bytes.NewReader(pngHeader), int64(len(pngHeader)), "image/png"))
+	}
+	stored := func(key string) bool {
+		f, err := files.Get(key)
+		if err != nil {
+			return false
+		}
+		f.Close()
+		return true
+	}
+
+	tadb := &testAttachmentDB{byRatings: func(ratingIDs []int64) (map[int64][]Attachment, error) {
+		assert.Equal(t, []int64{10}, ratingIDs)
+		return map[int64][]Attachment{10: {{ID: 1, Key: "attachments/a"}, {ID: 2, Key: "attachments/b"}}}, nil
+	}}
+	trs := &testDeletedRatingService{}
+	ra := &ratingAttachments{RatingService: trs, attachments: tadb, files: files}
+
+	put("attachments/a")
+	put("attachments/b")
+
+	trs.err = ErrNotFound
+	assert.Equal(t, ErrNotFound, ra.Delete(&Rating{ID: 10}))
+	assert.True(t, stored("attachments/a"), "must keep the files if the rating is not deleted")
+
+	trs.err = nil
+	require.NoError(t, ra.Delete(&Rating{ID: 10}))
+	assert.False(t, stored("attachments/a"))
+	assert.False(t, stored("attachments/b"))
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/audit.go -pkg modelstest . AuditService:AuditService
+
+// AuditService defines a set of methods to be used when dealing with the audit
+// log, where the sensitive actions of the administrators are recorded, like the
+// impersonation of the users.
+type AuditService interface {
+	AuditDB
+}
+
+// AuditDB defines how the service interacts with the database.
+type AuditDB interface {
+	// Record adds e to the audit log, and sets its ID and CreatedAt.
+	// The ActorID and Action fields are required.
+	Record(e *AuditEntry) error
+
+	// List retrieves the latest entries of the audit log, newest first.
+	List() ([]AuditEntry, error)
+
+	// Prune deletes the entries recorded before before, and returns the
+	// number of entries deleted.
+	Prune(before time.Time) (int64, error)
+}
+
+// Audited actions, as used in AuditEntry.Action.
+const (
+	// AuditImpersonate tells that the actor impersonated the user, see
+	// UserService.Impersonate.
+	AuditImpersonate = "impersonate"
+)
+
+// maxAuditEntries is the number of entries listed by AuditService.List.
+const maxAuditEntries = 100
+
+// An AuditEntry records an action of an administrator.
+type AuditEntry struct {
+	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
+
+	// ActorID is the ID of the administrator who took the action, and
+	// UserID the ID of the user it was taken on, if any.
+	ActorID int64  `gorm:"type:bigint;not null" json:"actorId"`
+	Action  string `gorm:"size:32;not null" json:"action"`
+	UserID  *int64 `gorm:"type:bigint" json:"userId,omitempty"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// TableName is the name of the table holding the audit log.
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+type auditService struct {
+	AuditDB
+}
+
+// NewAuditService instantiates a new AuditService implementation with db as the
+// backing database.
+func NewAuditService(db *gorm.DB) AuditService {
+	return newAuditService(db, SystemClock)
+}
+
+// newAuditService instantiates a new AuditService implementation, as
+// NewAuditService does, dating the entries recorded with clock.
+func newAuditService(db *gorm.DB, clock Clock) AuditService {
+	return &auditService{
+		AuditDB: &auditValidator{
+			AuditDB: &auditGorm{db: db, clock: clock},
+		},
+	}
+}
+
+type auditValidator struct {
+	AuditDB
+}
+
+func (av *auditValidator) Record(e *AuditEntry) error {
+	ve := ValidationError{}
+	if e.ActorID < 1 {
+		ve["actorId"] = ErrRequired
+	}
+	if e.Action == "" {
+		ve["action"] = ErrRequired
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return av.AuditDB.Record(e)
+}
+
+type auditGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (ag *auditGorm) Record(e *AuditEntry) error {
+	e.ID = 0
+	e.CreatedAt = ag.clock.Now()
+	err := ag.db.Create(e).Error
+	if err != nil {
+		return with(wrap("could not record audit entry", err), "action", e.Action, "actor_id", e.ActorID)
+	}
+
+	return nil
+}
+
+func (ag *auditGorm) Prune(before time.Time) (int64, error) {
+	res := ag.db.Where("created_at < ?", before).Delete(AuditEntry{})
+	if res.Error != nil {
+		return 0, wrap("could not prune audit entries", res.Error)
+	}
+
+	return res.RowsAffected, nil
+}
+
+func (ag *auditGorm) List() ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	err := ag.db.Order("id DESC").Limit(maxAuditEntries).Find(&entries).Error
+	if err != nil {
+		return nil, wrap("could not list audit entries", err)
+	}
+
+	return entries, nil
+}
+
+// PruneAudit deletes the entries of the audit log older than
+// Config.AuditRetention, in the shared data and in the schemas of the
+// provisioned tenants, and returns the number of entries deleted. The audit log
+// is kept whole if Config.AuditRetention is zero.
+func (s *Services) PruneAudit() (int64, error) {
+	if s.auditRetention <= 0 {
+		return 0, nil
+	}
+	before := s.clock.Now().Add(-s.auditRetention)
+
+	pruned, err := (&auditGorm{db: s.db, clock: s.clock}).Prune(before)
+	if err != nil {
+		return 0, err
+	}
+
+	var schemas []string
+	err = s.db.Model(&Tenant{}).
+		Where("schema_name <> '' AND status IN (?)", []string{TenantActive, TenantSuspended}).
+		Order("id").
+		Pluck("schema_name", &schemas).
+		Error
+	if err != nil {
+		return pruned, wrap("failed to list the schemas of the tenants", err)
+	}
+
+	for _, schema := range schemas {
+		err = gormTransaction(s.db, func(tx *gorm.DB) error {
+			err := tx.Exec("SET LOCAL search_path TO " + pq.QuoteIdentifier(schema)).Error
+			if err != nil {
+				return wrap("could not switch to the tenant schema", err)
+			}
+
+			n, err := (&auditGorm{db: tx, clock: s.clock}).Prune(before)
+			pruned += n
+			return err
+		})
+		if err != nil {
+			return pruned, with(err, "schema", schema)
+		}
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServices_PruneAudit(t *testing.T) {
+	dsl := testsupport.Database(t)
+	db := testsupport.Open(t, dsl)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	entries := []AuditEntry{
+		{ActorID: 1, Action: AuditImpersonate, CreatedAt: now.AddDate(0, 0, -91)},
+		{ActorID: 1, Action: AuditImpersonate, CreatedAt: now.AddDate(0, 0, -1)},
+	}
+	for i := range entries {
+		require.NoError(t, db.Create(&entries[i]).Error)
+	}
+
+	services, err := NewServices(&Config{JWTSecret: []byte(testJWTSecret), DatabaseDSL: dsl,
+		Clock: FixedClock(now)})
+	require.NoError(t, err)
+	defer services.Close()
+
+	pruned, err := services.PruneAudit()
+	require.NoError(t, err)
+	assert.Zero(t, pruned, "must keep the audit log without a retention")
+
+	services.auditRetention = 90 * 24 * time.Hour
+	pruned, err = services.PruneAudit()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+
+	list, err := services.Audit.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, entries[1].ID, list[0].ID)
+}
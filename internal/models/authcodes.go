@@ -0,0 +1,227 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/xerrors"
+)
+
+// AuthCodeTTL is the time the codes of the authorization code grant can be
+// exchanged for tokens once issued.
+const AuthCodeTTL = time.Minute
+
+//go:generate go run github.com/matryer/moq -out modelstest/authcodes.go -pkg modelstest . AuthCodeService:AuthCodeService
+
+// AuthCodeService defines a set of methods used to issue the codes of the OAuth
+// authorization code grant, and to exchange them for the user they were issued
+// to. The codes are protected with PKCE (RFC 7636): only the client knowing the
+// verifier of the challenge sent along with the authorization request can
+// exchange them, and only the S256 method is supported.
+type AuthCodeService interface {
+	// Client checks that a client is allowed to use the grant with a
+	// redirect URI. ErrUnknownClient is returned otherwise.
+	Client(clientID, redirectURI string) error
+
+	// Issue stores c until AuthCodeTTL elapses, and returns the code
+	// identifying it, which is not stored.
+	Issue(c *AuthCode) (string, error)
+
+	// Exchange consumes a code, and returns the user it was issued to.
+	// ErrInvalidGrant is returned if the code does not exist, has expired,
+	// was issued to another client or redirect URI, if the verifier does
+	// not match its challenge, or if the user was deactivated since.
+	Exchange(code, clientID, redirectURI, verifier string) (User, error)
+}
+
+// An AuthCode is a code of the authorization code grant, issued to a user
+// authenticated for a client.
+type AuthCode struct {
+	// CodeHash is the SHA-256 hash of the code, hex-encoded.
+	CodeHash string `gorm:"primary_key;size:64" json:"-"`
+
+	UserID      int64  `gorm:"type:bigint;not null" json:"userId"`
+	ClientID    string `gorm:"size:255;not null" json:"clientId"`
+	RedirectURI string `gorm:"size:2048;not null" json:"redirectUri"`
+
+	// CodeChallenge is the S256 challenge of the verifier of the client,
+	// base64url-encoded without padding.
+	CodeChallenge string `gorm:"size:128;not null" json:"codeChallenge"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null" json:"createdAt"`
+	ExpiresAt time.Time `gorm:"type:timestamptz;not null" json:"expiresAt"`
+}
+
+// OAuthClients maps the IDs of the clients allowed to use the authorization
+// code grant to the redirect URIs they registered. See Config.OAuthClients.
+type OAuthClients map[string][]string
+
+// ParseOAuthClients decodes the clients defined in b, a JSON object mapping
+// their IDs to their redirect URIs, which must be absolute URIs without a
+// fragment, as required by RFC 6749.
+func ParseOAuthClients(b []byte) (OAuthClients, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+
+	var clients OAuthClients
+	err := d.Decode(&clients)
+	if err != nil {
+		return nil, wrap("could not decode oauth clients", err)
+	}
+
+	for id, uris := range clients {
+		if id == "" || len(id) > 255 {
+			return nil, wrap("client ID must have from 1 to 255 characters", nil)
+		}
+
+		for _, uri := range uris {
+			u, err := url.Parse(uri)
+			if err != nil || !u.IsAbs() || u.Fragment != "" || len(uri) > 2048 {
+				return nil, wrap("invalid redirect URI "+strconv.Quote(uri)+" of client "+strconv.Quote(id), nil)
+			}
+		}
+	}
+
+	return clients, nil
+}
+
+// pkceS256 returns the S256 challenge of a PKCE verifier.
+func pkceS256(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// validPKCE tells whether s is a valid PKCE verifier, or a valid challenge,
+// which have the same syntax: from 43 to 128 unreserved URI characters.
+func validPKCE(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '.', r == '_', r == '~':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashAuthCode returns the hash a code is stored with.
+func hashAuthCode(code string) string {
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
+
+type authCodeService struct {
+	db      *gorm.DB
+	users   UserDB
+	clients OAuthClients
+	clock   Clock
+}
+
+// newAuthCodeService instantiates a new AuthCodeService implementation with db
+// as the backing database, issuing codes to the users of us for the clients.
+func newAuthCodeService(db *gorm.DB, us UserDB, clients OAuthClients, clock Clock) AuthCodeService {
+	return &authCodeService{db: db, users: us, clients: clients, clock: clock}
+}
+
+func (as *authCodeService) Client(clientID, redirectURI string) error {
+	for _, uri := range as.clients[clientID] {
+		// redirect URIs are compared as strings, as RFC 6749 requires
+		if uri == redirectURI {
+			return nil
+		}
+	}
+
+	return ErrUnknownClient
+}
+
+func (as *authCodeService) Issue(c *AuthCode) (string, error) {
+	switch {
+	case c.UserID < 1:
+		return "", ValidationError{"userId": ErrRequired}
+	case c.CodeChallenge == "":
+		return "", ValidationError{"codeChallenge": ErrRequired}
+	case !validPKCE(c.CodeChallenge):
+		return "", ValidationError{"codeChallenge": ErrInvalid}
+	}
+
+	err := as.Client(c.ClientID, c.RedirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	var b [32]byte
+	_, err = rand.Read(b[:])
+	if err != nil {
+		return "", wrap("could not generate authorization code", err)
+	}
+	code := base64.RawURLEncoding.EncodeToString(b[:])
+
+	now := as.clock.Now()
+	c.CodeHash = hashAuthCode(code)
+	c.CreatedAt = now
+	c.ExpiresAt = now.Add(AuthCodeTTL)
+
+	// the codes never exchanged are removed along the way
+	err = as.db.Exec("DELETE FROM auth_codes WHERE expires_at < ?", now).Error
+	if err != nil {
+		return "", wrap("could not remove expired authorization codes", err)
+	}
+
+	err = as.db.Create(c).Error
+	if err != nil {
+		return "", with(wrap("could not save authorization code", err), "user_id", c.UserID)
+	}
+
+	return code, nil
+}
+
+func (as *authCodeService) Exchange(code, clientID, redirectURI, verifier string) (User, error) {
+	if code == "" || verifier == "" {
+		return User{}, ErrNoCredentials
+	}
+
+	// the code is consumed before it is checked, so the requests racing
+	// to exchange it can't all succeed
+	var c AuthCode
+	err := as.db.Raw("DELETE FROM auth_codes WHERE code_hash = ? RETURNING *", hashAuthCode(code)).Scan(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return User{}, ErrInvalidGrant
+	} else if err != nil {
+		return User{}, wrap("could not consume authorization code", err)
+	}
+
+	if !as.clock.Now().Before(c.ExpiresAt) ||
+		c.ClientID != clientID ||
+		c.RedirectURI != redirectURI ||
+		!validPKCE(verifier) ||
+		subtle.ConstantTimeCompare([]byte(pkceS256(verifier)), []byte(c.CodeChallenge)) != 1 {
+		return User{}, ErrInvalidGrant
+	}
+
+	user, err := as.users.ByID(c.UserID)
+	if xerrors.Is(err, ErrNotFound) {
+		return User{}, ErrInvalidGrant
+	} else if err != nil {
+		return User{}, with(wrap("could not get the user of the authorization code", err), "user_id", c.UserID)
+	}
+
+	if !user.Active {
+		return User{}, ErrInvalidGrant
+	}
+
+	return user, nil
+}
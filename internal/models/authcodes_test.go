@@ -0,0 +1,120 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testVerifier  = "dBjftJeZ4CVP-mJ92ZXnzdwh5xRb5CcPSS5LEKGpEKI"
+	testChallenge = "NxGo9OcrrVegbnEBuPSu4b02vnS0Q2BcomNGSnxfslo"
+)
+
+func TestParseOAuthClients(t *testing.T) {
+	clients, err := ParseOAuthClients([]byte(`{"mobile": ["com.example.ratings:/oauth", "https://example.com/cb?x=1"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, OAuthClients{"mobile": {"com.example.ratings:/oauth", "https://example.com/cb?x=1"}}, clients)
+
+	for _, b := range []string{
+		`["mobile"]`,
+		`{"": ["https://example.com/cb"]}`,
+		`{"mobile": ["/cb"]}`,
+		`{"mobile": ["https://example.com/cb#fragment"]}`,
+	} {
+		_, err := ParseOAuthClients([]byte(b))
+		assert.Error(t, err, b)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	assert.Equal(t, testChallenge, pkceS256(testVerifier))
+
+	assert.True(t, validPKCE(testVerifier))
+	assert.True(t, validPKCE(strings.Repeat("a~._-", 25)))
+	assert.False(t, validPKCE("short"))
+	assert.False(t, validPKCE(strings.Repeat("a", 129)))
+	assert.False(t, validPKCE(strings.Repeat("a", 42)+"+"))
+}
+
+func TestAuthCodeService_Issue(t *testing.T) {
+	as := newAuthCodeService(nil, nil, OAuthClients{"mobile": {"app:/cb"}}, SystemClock)
+
+	var cases = []struct {
+		name string
+		c    AuthCode
+		err  error
+	}{
+		{"noUser", AuthCode{ClientID: "mobile", RedirectURI: "app:/cb", CodeChallenge: testChallenge}, ValidationError{"userId": ErrRequired}},
+		{"noChallenge", AuthCode{UserID: 1, ClientID: "mobile", RedirectURI: "app:/cb"}, ValidationError{"codeChallenge": ErrRequired}},
+		{"badChallenge", AuthCode{UserID: 1, ClientID: "mobile", RedirectURI: "app:/cb", CodeChallenge: "plain"}, ValidationError{"codeChallenge": ErrInvalid}},
+		{"unknownClient", AuthCode{UserID: 1, ClientID: "web", RedirectURI: "app:/cb", CodeChallenge: testChallenge}, ErrUnknownClient},
+		{"unknownURI", AuthCode{UserID: 1, ClientID: "mobile", RedirectURI: "app:/other", CodeChallenge: testChallenge}, ErrUnknownClient},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			_, err := as.Issue(&cs.c)
+			assert.Equal(t, cs.err, err)
+		})
+	}
+}
+
+func TestAuthCodeGorm(t *testing.T) {
+	db := setupGorm(t)
+
+	now := time.Now()
+	clock := FixedClock(now)
+	as := newAuthCodeService(db, &userGorm{db: db}, OAuthClients{"mobile": {"app:/cb"}}, clock)
+
+	issue := func() string {
+		code, err := as.Issue(&AuthCode{UserID: 1, ClientID: "mobile", RedirectURI: "app:/cb", CodeChallenge: testChallenge})
+		require.NoError(t, err)
+		return code
+	}
+
+	t.Run("exchange", func(t *testing.T) {
+		code := issue()
+
+		u, err := as.Exchange(code, "mobile", "app:/cb", testVerifier)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), u.ID)
+
+		_, err = as.Exchange(code, "mobile", "app:/cb", testVerifier)
+		assert.Equal(t, ErrInvalidGrant, err, "must only be exchanged once")
+	})
+
+	t.Run("wrongVerifier", func(t *testing.T) {
+		code := issue()
+
+		_, err := as.Exchange(code, "mobile", "app:/cb", strings.Repeat("v", 43))
+		assert.Equal(t, ErrInvalidGrant, err)
+
+		_, err = as.Exchange(code, "mobile", "app:/cb", testVerifier)
+		assert.Equal(t, ErrInvalidGrant, err, "must be consumed by a failed exchange")
+	})
+
+	t.Run("wrongClient", func(t *testing.T) {
+		_, err := as.Exchange(issue(), "web", "app:/cb", testVerifier)
+		assert.Equal(t, ErrInvalidGrant, err)
+
+		_, err = as.Exchange(issue(), "mobile", "app:/other", testVerifier)
+		assert.Equal(t, ErrInvalidGrant, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		code := issue()
+
+		later := newAuthCodeService(db, &userGorm{db: db}, OAuthClients{"mobile": {"app:/cb"}}, FixedClock(now.Add(AuthCodeTTL)))
+		_, err := later.Exchange(code, "mobile", "app:/cb", testVerifier)
+		assert.Equal(t, ErrInvalidGrant, err)
+	})
+
+	t.Run("noCredentials", func(t *testing.T) {
+		_, err := as.Exchange("", "mobile", "app:/cb", testVerifier)
+		assert.Equal(t, ErrNoCredentials, err)
+	})
+}
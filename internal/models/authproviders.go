@@ -0,0 +1,148 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/xerrors"
+)
+
+// An AuthProvider checks the passwords of the users logging in, see
+// Config.AuthProvider. The database checks the passwords it stores itself.
+type AuthProvider interface {
+	// Authenticate returns the user with the given email address, normalised,
+	// if password is theirs. ErrNotFound is returned if the provider does not
+	// know the address, and ErrUnauthorised if the password is wrong.
+	//
+	// The users of the providers other than the database, like a
+	// directory, have no ID: they are linked to the user of the database
+	// with the email address they logged in with, created with their
+	// names if it does not exist. Their RoleID, if not zero, is the role
+	// they are given.
+	Authenticate(email, password string) (User, error)
+}
+
+// passwordAuth checks the passwords stored in the database, hashed with bcrypt.
+type passwordAuth struct {
+	db UserDB
+}
+
+// Authenticate returns the user with the given email address if password
+// matches its hash. The user is returned with its ID only, along with
+// ErrInvalid if it is not active, and a ValidationError if the password is
+// wrong.
+func (pa passwordAuth) Authenticate(email, password string) (User, error) {
+	user, err := pa.db.ByEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+
+	if !user.Active {
+		return User{ID: user.ID}, ErrInvalid
+	}
+
+	// check the password matches
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		if xerrors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return User{ID: user.ID}, ValidationError{"password": ErrPasswordIncorrect}
+		}
+
+		return User{}, wrap("failed to compare password hashes", err)
+	}
+
+	return user, nil
+}
+
+// authenticate returns the user of the credentials, checked by the provider of
+// uv, if any, and by the database otherwise. The users the provider does not
+// know are checked by the database, so its users, like the admin, can still log
+// in.
+func (uv *userValidator) authenticate(email, password string) (User, error) {
+	if uv.auth != nil {
+		user, err := uv.auth.Authenticate(email, password)
+		if err == nil {
+			user.Email = email
+			return uv.link(user)
+		} else if !xerrors.Is(err, ErrNotFound) {
+			return User{}, err
+		}
+	}
+
+	return passwordAuth{db: uv.UserDB}.Authenticate(email, password)
+}
+
+// link returns the user of the database with the email address of acc, a user
+// of an AuthProvider, which is created if it does not exist. The user is given
+// the role of acc, if it has one, but for the admin user, whose role can't be
+// changed.
+func (uv *userValidator) link(acc User) (User, error) {
+	if acc.RoleID != 0 {
+		_, err := uv.roleService.ByID(acc.RoleID)
+		if xerrors.Is(err, ErrNotFound) {
+			return User{}, with(wrap("the role given by the auth provider does not exist", nil), "role_id", acc.RoleID)
+		} else if err != nil {
+			return User{}, with(wrap("could not get the role given by the auth provider", err), "role_id", acc.RoleID)
+		}
+	}
+
+	user, err := uv.UserDB.ByEmail(acc.Email)
+	if xerrors.Is(err, ErrNotFound) {
+		return uv.provision(acc)
+	} else if err != nil {
+		return User{}, err
+	}
+
+	if !user.Active {
+		return User{ID: user.ID}, ErrInvalid
+	}
+
+	if acc.RoleID == 0 || acc.RoleID == user.RoleID || user.ID == adminID {
+		return user, nil
+	}
+
+	res, err := uv.UserDB.AssignRole(acc.RoleID, user.ID)
+	if err != nil {
+		return User{}, with(wrap("could not assign the role given by the auth provider", err), "user_id", user.ID)
+	}
+	if len(res) != 1 || res[0].Status == AssignmentFailed {
+		return User{}, with(wrap("could not assign the role given by the auth provider", nil), "user_id", user.ID)
+	}
+
+	// read again with its new role
+	return uv.UserDB.ByID(user.ID)
+}
+
+// provision creates the user of acc, with its role or the default one. Its
+// password is random, so it only logs in through the provider.
+func (uv *userValidator) provision(acc User) (User, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return User{}, wrap("failed to generate a password", err)
+	}
+
+	user := NewUser()
+	user.Email = acc.Email
+	user.FirstName = acc.FirstName
+	user.LastName = acc.LastName
+	user.Password = base64.RawURLEncoding.EncodeToString(b)
+	if acc.RoleID != 0 {
+		user.RoleID = acc.RoleID
+	}
+	if user.FirstName == "" {
+		user.FirstName = strings.SplitN(acc.Email, "@", 2)[0]
+	}
+
+	err = uv.Create(&user)
+	if xerrors.Is(err, ValidationError{"email": ErrDuplicate}) {
+		// created since it was looked up
+		return uv.UserDB.ByEmail(acc.Email)
+	} else if err != nil {
+		return User{}, with(wrap("could not create the user of the auth provider", err), "email", acc.Email)
+	}
+
+	return uv.UserDB.ByID(user.ID)
+}
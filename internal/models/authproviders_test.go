@@ -0,0 +1,141 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/xerrors"
+)
+
+type testAuthProvider func(email, password string) (User, error)
+
+func (f testAuthProvider) Authenticate(email, password string) (User, error) {
+	return f(email, password)
+}
+
+func TestUserValidator_AuthProvider(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("databasepassword"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	rdb := &testRoleDB{byID: func(id int64) (Role, error) {
+		if id == 404 {
+			return Role{}, ErrNotFound
+		}
+		return Role{ID: id}, nil
+	}}
+	rs := NewRoleService(nil)
+	rs.(*roleService).RoleService.(*roleValidator).RoleDB = rdb
+
+	provider := testAuthProvider(func(email, password string) (User, error) {
+		switch {
+		case email == "local@corp.com":
+			return User{}, ErrNotFound
+		case password != "directorypassword":
+			return User{}, ErrUnauthorised
+		case email == "nobody@corp.com":
+			return User{FirstName: "No", LastName: "Body"}, nil
+		case email == "unknown@corp.com":
+			return User{RoleID: 404}, nil
+		}
+		return User{RoleID: 7}, nil
+	})
+
+	users := map[string]User{
+		"local@corp.com":    {ID: 3, Email: "local@corp.com", Active: true, RoleID: 2, Password: string(hash)},
+		"analyst@corp.com":  {ID: 4, Email: "analyst@corp.com", Active: true, RoleID: 2},
+		"admin@corp.com":    {ID: 1, Email: "admin@corp.com", Active: true, RoleID: 1},
+		"inactive@corp.com": {ID: 5, Email: "inactive@corp.com", RoleID: 7},
+	}
+	var created, assigned []int64
+	tudb := &testUserDB{
+		byEmail: func(e string) (User, error) {
+			if u, ok := users[e]; ok {
+				return u, nil
+			}
+			return User{}, ErrNotFound
+		},
+		byID: func(id int64) (User, error) {
+			for _, u := range users {
+				if u.ID == id {
+					return u, nil
+				}
+			}
+			return User{}, ErrNotFound
+		},
+		create: func(u *User) error {
+			u.ID = 10 + int64(len(users))
+			users[u.Email] = *u
+			created = append(created, u.ID)
+			return nil
+		},
+		assign: func(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+			for e, u := range users {
+				if u.ID == ids[0] {
+					u.RoleID = roleID
+					users[e] = u
+				}
+			}
+			assigned = append(assigned, ids...)
+			return []RoleAssignment{{UserID: ids[0], Status: AssignmentAssigned}}, nil
+		},
+	}
+
+	us, err := newUserService(nil, rs, jwtKeys{secret: []byte(testJWTSecret)}, nil, nil, provider, nil, nil, false)
+	require.NoError(t, err)
+	uv := us.(*userService).UserService.(*userValidator)
+	uv.UserDB = tudb
+
+	t.Run("database", func(t *testing.T) {
+		u, err := uv.Authenticate("local@corp.com", "databasepassword")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), u.ID, "the users the provider does not know must log in with the database")
+	})
+
+	t.Run("wrongPassword", func(t *testing.T) {
+		_, err := uv.Authenticate("analyst@corp.com", "databasepassword")
+		assert.Equal(t, ErrUnauthorised, err)
+	})
+
+	t.Run("roleAssigned", func(t *testing.T) {
+		u, err := uv.Authenticate("  Analyst@corp.com ", "directorypassword")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), u.ID)
+		assert.Equal(t, int64(7), u.RoleID)
+		assert.Equal(t, []int64{4}, assigned)
+
+		_, err = uv.Authenticate("analyst@corp.com", "directorypassword")
+		require.NoError(t, err)
+		assert.Equal(t, []int64{4}, assigned, "must not assign the role the user has")
+	})
+
+	t.Run("adminKeepsRole", func(t *testing.T) {
+		u, err := uv.Authenticate("admin@corp.com", "directorypassword")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), u.RoleID)
+	})
+
+	t.Run("inactive", func(t *testing.T) {
+		u, err := uv.Authenticate("inactive@corp.com", "directorypassword")
+		assert.Equal(t, ErrInvalid, err)
+		assert.Equal(t, int64(5), u.ID)
+	})
+
+	t.Run("provisioned", func(t *testing.T) {
+		u, err := uv.Authenticate("nobody@corp.com", "directorypassword")
+		require.NoError(t, err)
+		assert.Len(t, created, 1)
+		assert.Equal(t, created[0], u.ID)
+		assert.Equal(t, "No", u.FirstName)
+		assert.Equal(t, "Body", u.LastName)
+		assert.Equal(t, int64(2), u.RoleID, "must have the default role without a role from the provider")
+		assert.NotEmpty(t, u.Password)
+	})
+
+	t.Run("unknownRole", func(t *testing.T) {
+		_, err := uv.Authenticate("unknown@corp.com", "directorypassword")
+		require.Error(t, err)
+		assert.False(t, xerrors.Is(err, ErrNotFound), "must not be mistaken for unknown credentials")
+	})
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultAdminPasswordMaxAge is the time the admin user can keep the password it
+// was created with when Config.AdminPasswordMaxAge is not set.
+const DefaultAdminPasswordMaxAge = 7 * 24 * time.Hour
+
+// adminID is the ID of the admin user created on the first start.
+const adminID = 1
+
+// adminBootstrap records the password hash the admin user was created with,
+// until it is changed.
+type adminBootstrap struct {
+	UserID    int64     `gorm:"primary_key;type:bigint"`
+	Password  string    `gorm:"size:255;not null"`
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()"`
+}
+
+func (adminBootstrap) TableName() string {
+	return "admin_bootstrap"
+}
+
+// createAdmin creates the admin user if it does not exist, with password or,
+// if empty, a random one. The generated password is returned, as it is not
+// stored anywhere else. The password is dated with clock, see
+// checkAdminPassword.
+func createAdmin(db *gorm.DB, password string, clock Clock) (string, error) {
+	return createAdminUser(db, "admin@admin.com", password, clock)
+}
+
+// createAdminUser creates the admin user with the given email, as createAdmin
+// does.
+func createAdminUser(db *gorm.DB, email, password string, clock Clock) (string, error) {
+	var count int
+	err := db.Model(&User{}).Where("id = ?", adminID).Count(&count).Error
+	if err != nil {
+		return "", wrapi("failed to look up the admin user", err)
+	}
+	if count > 0 {
+		return "", nil
+	}
+
+	var generated string
+	if password == "" {
+		b := make([]byte, 18)
+		_, err = rand.Read(b)
+		if err != nil {
+			return "", wrap("failed to generate the admin password", err)
+		}
+
+		password = base64.RawURLEncoding.EncodeToString(b)
+		generated = password
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost+2)
+	if err != nil {
+		return "", wrap("failed to hash the admin password", err)
+	}
+
+	// warning: non standard SQL used to update sequence counters
+	err = gormTransaction(db, func(tx *gorm.DB) error {
+		return tx.
+			Create(&User{ID: adminID, Active: true, Email: email, FirstName: "admin", Password: string(hash), RoleID: AdminRoleID, Version: 1}).
+			Create(&adminBootstrap{UserID: adminID, Password: string(hash), CreatedAt: clock.Now()}).
+			Exec("DO $$ BEGIN IF (SELECT last_value = 1 FROM users_id_seq) THEN ALTER SEQUENCE users_id_seq RESTART WITH 2; END IF; END; $$").
+			Error
+	})
+	if err != nil {
+		return "", wrapi("failed to create the admin user", err)
+	}
+
+	return generated, nil
+}
+
+// checkAdminPassword returns ErrAdminPasswordNotChanged if the admin user kept
+// the password it was created with for longer than maxAge, as told by clock.
+// Once the password is changed, it is no longer checked.
+func checkAdminPassword(db *gorm.DB, maxAge time.Duration, clock Clock) error {
+	var b adminBootstrap
+	err := db.Where("user_id = ?", adminID).First(&b).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	} else if err != nil {
+		return wrapi("failed to look up the admin bootstrap", err)
+	}
+
+	var admin User
+	err = db.Select("password").Where("id = ?", adminID).First(&admin).Error
+	if err != nil {
+		return wrapi("failed to look up the admin user", err)
+	}
+
+	if admin.Password != b.Password {
+		err = db.Delete(&b).Error
+		if err != nil {
+			return wrapi("failed to forget the admin bootstrap", err)
+		}
+
+		return nil
+	}
+
+	if clock.Now().Sub(b.CreatedAt) > maxAge {
+		return ErrAdminPasswordNotChanged
+	}
+
+	return nil
+}
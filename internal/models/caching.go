@@ -0,0 +1,704 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// cacheTTL bounds the time a cached value can be served after a change that
+// could not invalidate it, like one made by another process that does not share
+// the cache.
+const cacheTTL = time.Minute
+
+// cacheGet looks up key in l and decodes its value into v. Values that cannot be
+// decoded are handled as misses, so they are read from the database instead.
+func cacheGet(l *cache.Loader, key string, v interface{}) bool {
+	b, ok := l.Get(key)
+	if !ok {
+		return false
+	}
+
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v) == nil
+}
+
+// cacheSet encodes v and stores it in l with key. Values that cannot be stored
+// are just not cached.
+func cacheSet(l *cache.Loader, key string, v interface{}) {
+	b, err := cacheEncode(v)
+	if err != nil {
+		return
+	}
+
+	l.Set(key, b, cacheTTL)
+}
+
+// cacheLoad reads the value of key from l into v. When missing, load is called
+// to fill v from the database, and v is cached. Concurrent calls for the same
+// key share a single call to load.
+func cacheLoad(l *cache.Loader, key string, v interface{}, load func() error) error {
+	var loaded bool
+	b, err := l.Load(key, cacheTTL, func() ([]byte, error) {
+		err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		loaded = true
+		return cacheEncode(v)
+	})
+
+	switch {
+	case loaded:
+		// v was filled by this call
+		return nil
+	case err != nil:
+		return err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+	if err != nil {
+		l.Delete(key)
+		return load()
+	}
+
+	return nil
+}
+
+// cacheEncode encodes v to be cached.
+func cacheEncode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+
+	// gob is used instead of JSON as it also encodes the fields hidden
+	// from the API, like Version
+	err := gob.NewEncoder(&b).Encode(v)
+	if err != nil {
+		return nil, wrap("could not encode cached value", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+func ratingsByTargetKey(target int64) string {
+	return "ratings:target:" + strconv.FormatInt(target, 10)
+}
+
+func ratingStatsKey(target int64) string {
+	return "ratings:stats:" + strconv.FormatInt(target, 10)
+}
+
+func roleKey(id int64) string {
+	return "roles:" + strconv.FormatInt(id, 10)
+}
+
+// allRolesKey holds the result of listing the roles without any IDs.
+const allRolesKey = "roles:all"
+
+// ratingCache is a RatingService decorator that caches the ratings and the
+// stats of each target, invalidating them when any rating of the target is
+// written.
+type ratingCache struct {
+	RatingService
+	cache *cache.Loader
+}
+
+// newRatingCache wraps rs so ByTarget and StatsByTarget are served from l.
+func newRatingCache(rs RatingService, l *cache.Loader) RatingService {
+	return &ratingCache{RatingService: rs, cache: l}
+}
+
+func (rc *ratingCache) ByTarget(target int64) ([]Rating, error) {
+	var ratings []Rating
+	err := cacheLoad(rc.cache, ratingsByTargetKey(target), &ratings, func() (err error) {
+		ratings, err = rc.RatingService.ByTarget(target)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ratings, nil
+}
+
+func (rc *ratingCache) StatsByTarget(target int64) (RatingStats, error) {
+	var stats RatingStats
+	err := cacheLoad(rc.cache, ratingStatsKey(target), &stats, func() (err error) {
+		stats, err = rc.RatingService.StatsByTarget(target)
+		return err
+	})
+	if err != nil {
+		return RatingStats{}, err
+	}
+
+	return stats, nil
+}
+
+// Scoped bypasses the cache for restricted roles, as the cached values hold all
+// the ratings of each target.
+func (rc *ratingCache) Scoped(u *User) RatingService {
+	scoped := rc.RatingService.Scoped(u)
+	if scoped == rc.RatingService {
+		return rc
+	}
+
+	return scoped
+}
+
+func (rc *ratingCache) Create(r *Rating) error {
+	err := rc.RatingService.Create(r)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(r.Target)
+	return nil
+}
+
+func (rc *ratingCache) Update(r *Rating) error {
+	err := rc.RatingService.Update(r)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(r.Target)
+	return nil
+}
+
+func (rc *ratingCache) UpdatePartial(r *Rating, patch []byte) error {
+	err := rc.RatingService.UpdatePartial(r, patch)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(r.Target)
+	return nil
+}
+
+func (rc *ratingCache) PublishDraft(r *Rating, patch []byte) error {
+	err := rc.RatingService.PublishDraft(r, patch)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(r.Target)
+	return nil
+}
+
+func (rc *ratingCache) Delete(r *Rating) error {
+	// only the ID is known before deleting
+	current, err := rc.RatingService.ByID(r.ID)
+	if err != nil {
+		return rc.RatingService.Delete(r)
+	}
+
+	err = rc.RatingService.Delete(r)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(current.Target)
+	return nil
+}
+
+// invalidate removes the cached values of target.
+func (rc *ratingCache) invalidate(target int64) {
+	rc.cache.Delete(ratingsByTargetKey(target), ratingStatsKey(target))
+}
+
+// userRatingChanges is a UserService decorator calling changed with each target
+// of the ratings of a user anonymised or reassigned when the user is deleted,
+// so their cached values are invalidated, see ratingCache.
+type userRatingChanges struct {
+	UserService
+	targets func(userID int64) ([]int64, error)
+	changed func(target int64)
+}
+
+func (uc *userRatingChanges) DeleteWith(id int64, d UserDeletion) error {
+	if d.Ratings != RatingsAnonymise && d.Ratings != RatingsReassign {
+		return uc.UserService.DeleteWith(id, d)
+	}
+
+	// the ratings of a user reassigned can't be told apart once deleted
+	targets, err := uc.targets(id)
+	if err != nil {
+		return uc.UserService.DeleteWith(id, d)
+	}
+
+	err = uc.UserService.DeleteWith(id, d)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		uc.changed(target)
+	}
+	return nil
+}
+
+// roleCache is a RoleService decorator that caches roles by ID, invalidating
+// them when they are written.
+type roleCache struct {
+	RoleService
+	cache *cache.Loader
+}
+
+// newRoleCache wraps rs so ByIDs is served from l.
+func newRoleCache(rs RoleService, l *cache.Loader) RoleService {
+	return &roleCache{RoleService: rs, cache: l}
+}
+
+// ByIDs looks up each role in the cache, and only reads the missing ones from
+// the database. Roles are returned sorted by ID.
+func (rc *roleCache) ByIDs(ids ...int64) ([]Role, error) {
+	if len(ids) == 0 {
+		var roles []Role
+		err := cacheLoad(rc.cache, allRolesKey, &roles, func() (err error) {
+			roles, err = rc.RoleService.ByIDs()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return roles, nil
+	}
+
+	var (
+		roles   []Role
+		missing []int64
+		seen    = make(map[int64]bool, len(ids))
+	)
+
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var role Role
+		if cacheGet(rc.cache, roleKey(id), &role) {
+			roles = append(roles, role)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := rc.RoleService.ByIDs(missing...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, role := range fetched {
+			cacheSet(rc.cache, roleKey(role.ID), role)
+		}
+
+		roles = append(roles, fetched...)
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].ID < roles[j].ID
+	})
+
+	return roles, nil
+}
+
+func (rc *roleCache) Create(r *Role) error {
+	err := rc.RoleService.Create(r)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(r.ID)
+	return nil
+}
+
+func (rc *roleCache) Update(r *Role) error {
+	err := rc.RoleService.Update(r)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(r.ID)
+	return nil
+}
+
+func (rc *roleCache) UpdatePartial(r *Role, patch []byte) error {
+	err := rc.RoleService.UpdatePartial(r, patch)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(r.ID)
+	return nil
+}
+
+func (rc *roleCache) Delete(id int64) error {
+	err := rc.RoleService.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	rc.invalidate(id)
+	return nil
+}
+
+// invalidate removes the cached values of the role with the given ID.
+func (rc *roleCache) invalidate(id int64) {
+	rc.cache.Delete(roleKey(id), allRolesKey)
+}
+
+func tokenKey(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return "tokens:" + hex.EncodeToString(h[:])
+}
+
+// userTokensKey holds the generation of the cached tokens of a user, see
+// userCache.
+func userTokensKey(id int64) string {
+	return "users:" + strconv.FormatInt(id, 10) + ":tokens"
+}
+
+// tokenCacheTTL bounds the time an access token is served from the cache, as
+// the tokens are also revoked by changes not made through the cache, like the
+// expiry of their sessions.
+const tokenCacheTTL = 30 * time.Second
+
+// cachedToken is the user an access token was validated for. The token is only
+// valid while Generation matches the generation of the tokens of the user, and
+// until Expiry.
+type cachedToken struct {
+	User       User
+	Generation string
+	Expiry     time.Time
+}
+
+// userCache is a UserService decorator that caches the users the access tokens
+// are validated for, by the hash of the token, so the user is not read from the
+// database on every request. The tokens of a user are invalidated together when
+// it is written or its sessions are ended, by changing their generation. The
+// impersonation tokens are validated on every request. The
+// role of the user is read from roles, which is expected to be cached, so the
+// changes to the roles apply right away.
+type userCache struct {
+	UserService
+	cache *cache.Loader
+	roles RoleService
+	clock Clock
+}
+
+// newUserCache wraps us so Validate is served from l.
+func newUserCache(us UserService, l *cache.Loader, roles RoleService, clock Clock) *userCache {
+	return &userCache{UserService: us, cache: l, roles: roles, clock: clock}
+}
+
+func (uc *userCache) Validate(accessToken string) (User, error) {
+	key := tokenKey(accessToken)
+
+	var ct cachedToken
+	if cacheGet(uc.cache, key, &ct) && uc.clock.Now().Before(ct.Expiry) {
+		var generation string
+		if cacheGet(uc.cache, userTokensKey(ct.User.ID), &generation) && generation == ct.Generation {
+			roles, err := uc.roles.ByIDs(ct.User.RoleID)
+			if err == nil && len(roles) == 1 {
+				ct.User.Role = &roles[0]
+				return ct.User, nil
+			}
+		}
+	}
+
+	u, err := uc.UserService.Validate(accessToken)
+	if err != nil {
+		return User{}, err
+	}
+
+	uc.set(key, accessToken, u)
+	return u, nil
+}
+
+// set caches u as the user accessToken, which is valid, was validated for. The
+// impersonation tokens are not cached: their session belongs to the
+// administrator, so revoking it would not invalidate the tokens of the user.
+func (uc *userCache) set(key, accessToken string, u User) {
+	if u.ImpersonatedBy != 0 {
+		return
+	}
+
+	tok, err := jwt.ParseSigned(accessToken)
+	if err != nil {
+		return
+	}
+
+	var cl jwt.Claims
+	err = tok.UnsafeClaimsWithoutVerification(&cl)
+	if err != nil || cl.Expiry == nil {
+		return
+	}
+
+	var generation string
+	if !cacheGet(uc.cache, userTokensKey(u.ID), &generation) {
+		generation, err = newSessionID()
+		if err != nil {
+			return
+		}
+	}
+
+	// the generation outlives the tokens cached with it
+	b, err := cacheEncode(generation)
+	if err != nil {
+		return
+	}
+	uc.cache.Set(userTokensKey(u.ID), b, 2*tokenCacheTTL)
+
+	u.Role = nil
+	b, err = cacheEncode(cachedToken{User: u, Generation: generation, Expiry: cl.Expiry.Time()})
+	if err != nil {
+		return
+	}
+	uc.cache.Set(key, b, tokenCacheTTL)
+}
+
+// Refresh invalidates the tokens of the user, as the session of the refresh
+// token ends.
+func (uc *userCache) Refresh(refreshToken string) (User, error) {
+	u, err := uc.UserService.Refresh(refreshToken)
+	if err != nil {
+		return User{}, err
+	}
+
+	uc.invalidate(u.ID)
+	return u, nil
+}
+
+// RefreshSession invalidates the tokens of the user, as Refresh.
+func (uc *userCache) RefreshSession(refreshToken string, client SessionClient) (User, Token, error) {
+	u, tok, err := uc.UserService.RefreshSession(refreshToken, client)
+	if err != nil {
+		return User{}, Token{}, err
+	}
+
+	uc.invalidate(u.ID)
+	return u, tok, nil
+}
+
+func (uc *userCache) RevokeSession(userID int64, id string) error {
+	err := uc.UserService.RevokeSession(userID, id)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(userID)
+	return nil
+}
+
+func (uc *userCache) RevokeSessions(userID int64) error {
+	err := uc.UserService.RevokeSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(userID)
+	return nil
+}
+
+func (uc *userCache) Deactivate(id int64) error {
+	err := uc.UserService.Deactivate(id)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(id)
+	return nil
+}
+
+func (uc *userCache) Activate(id int64) error {
+	err := uc.UserService.Activate(id)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(id)
+	return nil
+}
+
+func (uc *userCache) Update(u *User) error {
+	err := uc.UserService.Update(u)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(u.ID)
+	return nil
+}
+
+func (uc *userCache) UpdatePartial(u *User, patch []byte) error {
+	err := uc.UserService.UpdatePartial(u, patch)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(u.ID)
+	return nil
+}
+
+func (uc *userCache) Delete(id int64) error {
+	err := uc.UserService.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(id)
+	return nil
+}
+
+func (uc *userCache) DeleteWith(id int64, d UserDeletion) error {
+	err := uc.UserService.DeleteWith(id, d)
+	if err != nil {
+		return err
+	}
+
+	uc.invalidate(id)
+	return nil
+}
+
+func (uc *userCache) AssignRole(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+	results, err := uc.UserService.AssignRole(roleID, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ra := range results {
+		if ra.Status == AssignmentAssigned {
+			uc.invalidate(ra.UserID)
+		}
+	}
+	return results, nil
+}
+
+// invalidate removes the cached tokens of the user with the given ID.
+func (uc *userCache) invalidate(id int64) {
+	uc.cache.Delete(userTokensKey(id))
+}
+
+func tenantHostnameKey(hostname string) string {
+	return "tenants:hostname:" + hostname
+}
+
+// tenantCache is a TenantService decorator that caches the tenants by hostname,
+// invalidating them when they are written.
+type tenantCache struct {
+	TenantService
+	cache *cache.Loader
+}
+
+// newTenantCache wraps ts so ByHostname is served from l.
+func newTenantCache(ts TenantService, l *cache.Loader) TenantService {
+	return &tenantCache{TenantService: ts, cache: l}
+}
+
+func (tc *tenantCache) ByHostname(hostname string) (Tenant, error) {
+	hostname = normaliseHostname(hostname)
+
+	var t Tenant
+	err := cacheLoad(tc.cache, tenantHostnameKey(hostname), &t, func() (err error) {
+		t, err = tc.TenantService.ByHostname(hostname)
+		return err
+	})
+	if err != nil {
+		return Tenant{}, err
+	}
+
+	return t, nil
+}
+
+func (tc *tenantCache) Update(t *Tenant) error {
+	err := tc.TenantService.Update(t)
+	if err != nil {
+		return err
+	}
+
+	tc.invalidate(t.Hostnames...)
+	return nil
+}
+
+func (tc *tenantCache) AddHostname(tenantID int64, hostname string) error {
+	err := tc.TenantService.AddHostname(tenantID, hostname)
+	if err != nil {
+		return err
+	}
+
+	// the other hostnames of the tenant hold it with its hostnames
+	tc.invalidateTenant(tenantID)
+	return nil
+}
+
+func (tc *tenantCache) RemoveHostname(tenantID int64, hostname string) error {
+	err := tc.TenantService.RemoveHostname(tenantID, hostname)
+	if err != nil {
+		return err
+	}
+
+	tc.invalidate(normaliseHostname(hostname))
+	tc.invalidateTenant(tenantID)
+	return nil
+}
+
+func (tc *tenantCache) Suspend(id int64) error {
+	err := tc.TenantService.Suspend(id)
+	if err != nil {
+		return err
+	}
+
+	tc.invalidateTenant(id)
+	return nil
+}
+
+func (tc *tenantCache) Resume(id int64) error {
+	err := tc.TenantService.Resume(id)
+	if err != nil {
+		return err
+	}
+
+	tc.invalidateTenant(id)
+	return nil
+}
+
+func (tc *tenantCache) Delete(id int64) error {
+	err := tc.TenantService.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	// the tenant is no longer served while it is deleted
+	tc.invalidateTenant(id)
+	return nil
+}
+
+// invalidateTenant removes the cached values of the hostnames of a tenant. If
+// they cannot be read, the cached values expire after cacheTTL.
+func (tc *tenantCache) invalidateTenant(id int64) {
+	t, err := tc.TenantService.ByID(id)
+	if err != nil {
+		return
+	}
+
+	tc.invalidate(t.Hostnames...)
+}
+
+// invalidate removes the cached tenants of the given hostnames.
+func (tc *tenantCache) invalidate(hostnames ...string) {
+	keys := make([]string, len(hostnames))
+	for i, h := range hostnames {
+		keys[i] = tenantHostnameKey(h)
+	}
+
+	tc.cache.Delete(keys...)
+}
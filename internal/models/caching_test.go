@@ -0,0 +1,435 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+type testCachedRatingService struct {
+	RatingService
+	calls map[string]int
+}
+
+func (t *testCachedRatingService) ByTarget(target int64) ([]Rating, error) {
+	t.calls["byTarget"]++
+	if target == 404 {
+		return nil, ErrNotFound
+	}
+
+	return []Rating{{ID: int64(t.calls["byTarget"]), Target: target, Version: 3}}, nil
+}
+
+func (t *testCachedRatingService) StatsByTarget(target int64) (RatingStats, error) {
+	t.calls["stats"]++
+	return RatingStats{Target: target, Count: int64(t.calls["stats"])}, nil
+}
+
+func (t *testCachedRatingService) ByID(id int64) (Rating, error) {
+	t.calls["byID"]++
+	return Rating{ID: id, Target: 9}, nil
+}
+
+func (t *testCachedRatingService) Scoped(u *User) RatingService {
+	if u.RoleID == 3 {
+		return &testCachedRatingService{calls: t.calls}
+	}
+
+	return t
+}
+
+func (t *testCachedRatingService) Create(r *Rating) error {
+	t.calls["create"]++
+	if r.Score == 0 {
+		return ValidationError{"score": ErrRequired}
+	}
+
+	return nil
+}
+
+func (t *testCachedRatingService) Update(r *Rating) error {
+	t.calls["update"]++
+	r.Target = 9
+	return nil
+}
+
+func (t *testCachedRatingService) UpdatePartial(r *Rating, patch []byte) error {
+	t.calls["patch"]++
+	r.Target = 9
+	return nil
+}
+
+func (t *testCachedRatingService) Delete(r *Rating) error {
+	t.calls["delete"]++
+	return nil
+}
+
+func TestRatingCache(t *testing.T) {
+	trs := &testCachedRatingService{calls: map[string]int{}}
+	l := cache.NewLoader(cache.NewLRU(10))
+	rs := newRatingCache(trs, l)
+
+	ratings, err := rs.ByTarget(9)
+	require.NoError(t, err)
+	assert.Equal(t, []Rating{{ID: 1, Target: 9, Version: 3}}, ratings)
+
+	stats, err := rs.StatsByTarget(9)
+	require.NoError(t, err)
+	assert.Equal(t, RatingStats{Target: 9, Count: 1}, stats)
+
+	t.Run("hit", func(t *testing.T) {
+		ratings, err := rs.ByTarget(9)
+		require.NoError(t, err)
+		assert.Equal(t, []Rating{{ID: 1, Target: 9, Version: 3}}, ratings, "must keep the fields hidden from JSON")
+
+		_, err = rs.StatsByTarget(9)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, trs.calls["byTarget"])
+		assert.Equal(t, 1, trs.calls["stats"])
+		assert.Equal(t, cache.Stats{Hits: 2, Misses: 2, Loads: 2}, l.Stats())
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		assert.Equal(t, rs, rs.Scoped(&User{RoleID: 2}), "unrestricted roles must use the cache")
+
+		_, err := rs.Scoped(&User{RoleID: 3}).ByTarget(9)
+		require.NoError(t, err)
+		assert.Equal(t, 2, trs.calls["byTarget"], "restricted roles must bypass the cache")
+		trs.calls["byTarget"] = 1
+	})
+
+	t.Run("errorsNotCached", func(t *testing.T) {
+		_, err := rs.ByTarget(404)
+		assert.Equal(t, ErrNotFound, err)
+		_, err = rs.ByTarget(404)
+		assert.Equal(t, ErrNotFound, err)
+
+		assert.Equal(t, 3, trs.calls["byTarget"])
+		trs.calls["byTarget"] = 1
+	})
+
+	var writes = []struct {
+		name  string
+		write func() error
+	}{
+		{"create", func() error { return rs.Create(&Rating{Score: 2, Target: 9}) }},
+		{"update", func() error { return rs.Update(&Rating{ID: 1}) }},
+		{"patch", func() error { return rs.UpdatePartial(&Rating{ID: 1}, []byte(`{}`)) }},
+		{"delete", func() error { return rs.Delete(&Rating{ID: 1}) }},
+	}
+
+	for _, w := range writes {
+		t.Run(w.name+"Invalidates", func(t *testing.T) {
+			_, err := rs.ByTarget(9)
+			require.NoError(t, err)
+			_, err = rs.StatsByTarget(9)
+			require.NoError(t, err)
+			byTarget, statsCalls := trs.calls["byTarget"], trs.calls["stats"]
+
+			require.NoError(t, w.write())
+
+			_, err = rs.ByTarget(9)
+			require.NoError(t, err)
+			_, err = rs.StatsByTarget(9)
+			require.NoError(t, err)
+
+			assert.Equal(t, byTarget+1, trs.calls["byTarget"])
+			assert.Equal(t, statsCalls+1, trs.calls["stats"])
+		})
+	}
+
+	t.Run("failedWriteKeepsCache", func(t *testing.T) {
+		_, err := rs.ByTarget(9)
+		require.NoError(t, err)
+		byTarget := trs.calls["byTarget"]
+
+		err = rs.Create(&Rating{Target: 9})
+		assert.Error(t, err)
+
+		_, err = rs.ByTarget(9)
+		require.NoError(t, err)
+		assert.Equal(t, byTarget, trs.calls["byTarget"])
+	})
+}
+
+type testDeletedUserService struct {
+	UserService
+	err error
+}
+
+func (t *testDeletedUserService) DeleteWith(id int64, d UserDeletion) error {
+	return t.err
+}
+
+func TestUserRatingChanges(t *testing.T) {
+	var cases = []struct {
+		name      string
+		d         UserDeletion
+		deleteErr error
+		changed   []int64
+	}{
+		{"anonymise", UserDeletion{Ratings: RatingsAnonymise}, nil, []int64{7, 9}},
+		{"reassign", UserDeletion{Ratings: RatingsReassign, ReassignTo: 98}, nil, []int64{7, 9}},
+		{"restrict", UserDeletion{Ratings: RatingsRestrict}, nil, nil},
+		{"failed", UserDeletion{Ratings: RatingsAnonymise}, ErrNotFound, nil},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var changed []int64
+			us := &userRatingChanges{
+				UserService: &testDeletedUserService{err: cs.deleteErr},
+				targets: func(userID int64) ([]int64, error) {
+					assert.Equal(t, int64(97), userID, "must read the targets of the user deleted")
+					return []int64{7, 9}, nil
+				},
+				changed: func(target int64) {
+					changed = append(changed, target)
+				},
+			}
+
+			err := us.DeleteWith(97, cs.d)
+			assert.Equal(t, cs.deleteErr, err)
+			assert.Equal(t, cs.changed, changed)
+		})
+	}
+
+	t.Run("invalidatesRatingCache", func(t *testing.T) {
+		trs := &testCachedRatingService{calls: map[string]int{}}
+		rc := newRatingCache(trs, cache.NewLoader(cache.NewLRU(10))).(*ratingCache)
+		us := &userRatingChanges{
+			UserService: &testDeletedUserService{},
+			targets:     func(int64) ([]int64, error) { return []int64{9}, nil },
+			changed:     rc.invalidate,
+		}
+
+		_, err := rc.ByTarget(9)
+		require.NoError(t, err)
+		require.NoError(t, us.DeleteWith(97, UserDeletion{Ratings: RatingsAnonymise}))
+		_, err = rc.ByTarget(9)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, trs.calls["byTarget"], "must not serve the ratings of the user deleted from the cache")
+	})
+}
+
+type testCachedRoleService struct {
+	RoleService
+	requested [][]int64
+}
+
+func (t *testCachedRoleService) ByIDs(ids ...int64) ([]Role, error) {
+	t.requested = append(t.requested, ids)
+
+	if len(ids) == 0 {
+		ids = []int64{1, 2, 3}
+	}
+
+	var roles []Role
+	for _, id := range ids {
+		if id < 10 {
+			roles = append(roles, Role{ID: id, Label: "role", Version: 2})
+		}
+	}
+
+	return roles, nil
+}
+
+func (t *testCachedRoleService) Update(r *Role) error {
+	return nil
+}
+
+func (t *testCachedRoleService) Delete(id int64) error {
+	return nil
+}
+
+func TestRoleCache(t *testing.T) {
+	trs := &testCachedRoleService{}
+	rs := newRoleCache(trs, cache.NewLoader(cache.NewLRU(10)))
+
+	roles, err := rs.ByIDs(3, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Role{{ID: 1, Label: "role", Version: 2}, {ID: 3, Label: "role", Version: 2}}, roles)
+
+	// only the missing roles are read
+	roles, err = rs.ByIDs(1, 2, 2, 3, 12)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, []int64{roles[0].ID, roles[1].ID, roles[2].ID})
+	assert.Len(t, roles, 3)
+
+	_, err = rs.ByIDs()
+	require.NoError(t, err)
+	_, err = rs.ByIDs()
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]int64{{3, 1}, {2, 12}, nil}, trs.requested)
+
+	t.Run("updateInvalidates", func(t *testing.T) {
+		trs.requested = nil
+		require.NoError(t, rs.Update(&Role{ID: 2}))
+
+		_, err = rs.ByIDs(1, 2)
+		require.NoError(t, err)
+		_, err = rs.ByIDs()
+		require.NoError(t, err)
+
+		assert.Equal(t, [][]int64{{2}, nil}, trs.requested)
+	})
+
+	t.Run("deleteInvalidates", func(t *testing.T) {
+		trs.requested = nil
+		require.NoError(t, rs.Delete(3))
+
+		_, err = rs.ByIDs(3)
+		require.NoError(t, err)
+
+		assert.Equal(t, [][]int64{{3}}, trs.requested)
+	})
+}
+
+type testCachedTenantService struct {
+	TenantService
+	requested []string
+}
+
+func (t *testCachedTenantService) ByHostname(hostname string) (Tenant, error) {
+	t.requested = append(t.requested, hostname)
+	return Tenant{ID: 3, Name: "Acme", Hostnames: []string{"acme.test", "www.acme.test"}}, nil
+}
+
+func (t *testCachedTenantService) ByID(id int64) (Tenant, error) {
+	return Tenant{ID: id, Name: "Acme", Hostnames: []string{"acme.test", "www.acme.test"}}, nil
+}
+
+func (t *testCachedTenantService) AddHostname(tenantID int64, hostname string) error {
+	return nil
+}
+
+func (t *testCachedTenantService) Suspend(id int64) error {
+	return nil
+}
+
+func TestTenantCache(t *testing.T) {
+	tts := &testCachedTenantService{}
+	ts := newTenantCache(tts, cache.NewLoader(cache.NewLRU(10)))
+
+	tenant, err := ts.ByHostname("Acme.Test")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), tenant.ID)
+	_, err = ts.ByHostname("acme.test")
+	require.NoError(t, err)
+	_, err = ts.ByHostname("www.acme.test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme.test", "www.acme.test"}, tts.requested)
+
+	t.Run("addHostnameInvalidates", func(t *testing.T) {
+		tts.requested = nil
+		require.NoError(t, ts.AddHostname(3, "shop.acme.test"))
+
+		_, err = ts.ByHostname("www.acme.test")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"www.acme.test"}, tts.requested)
+	})
+
+	t.Run("suspendInvalidates", func(t *testing.T) {
+		tts.requested = nil
+		require.NoError(t, ts.Suspend(3))
+
+		_, err = ts.ByHostname("acme.test")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"acme.test"}, tts.requested)
+	})
+}
+
+type testCachedUserService struct {
+	UserService
+	validated      int
+	impersonatedBy int64
+}
+
+func (t *testCachedUserService) Validate(accessToken string) (User, error) {
+	t.validated++
+	return User{ID: 4, Email: "user@example.com", RoleID: 2, Role: &Role{ID: 2, Label: "stale"}, ImpersonatedBy: t.impersonatedBy}, nil
+}
+
+func (t *testCachedUserService) Update(u *User) error {
+	return nil
+}
+
+func (t *testCachedUserService) Deactivate(id int64) error {
+	return nil
+}
+
+func TestUserCache(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("secret")}, nil)
+	require.NoError(t, err)
+	token, err := jwt.Signed(signer).
+		Claims(jwt.Claims{Subject: "4", Expiry: jwt.NewNumericDate(now.Add(time.Minute))}).
+		CompactSerialize()
+	require.NoError(t, err)
+
+	tus := &testCachedUserService{}
+	us := newUserCache(tus, cache.NewLoader(cache.NewLRU(10)), &testCachedRoleService{}, FixedClock(now))
+
+	u, err := us.Validate(token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), u.ID)
+
+	u, err = us.Validate(token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tus.validated, "must serve the user of the token from the cache")
+	assert.Equal(t, "user@example.com", u.Email)
+	require.NotNil(t, u.Role)
+	assert.Equal(t, Role{ID: 2, Label: "role", Version: 2}, *u.Role, "must read the role from the roles")
+
+	t.Run("expired", func(t *testing.T) {
+		tus.validated = 0
+		us.clock = FixedClock(now.Add(time.Minute))
+
+		_, err = us.Validate(token)
+		require.NoError(t, err)
+		assert.Equal(t, 1, tus.validated, "must not serve an expired token from the cache")
+		us.clock = FixedClock(now)
+	})
+
+	t.Run("updateInvalidates", func(t *testing.T) {
+		tus.validated = 0
+		require.NoError(t, us.Update(&User{ID: 4}))
+
+		_, err = us.Validate(token)
+		require.NoError(t, err)
+		_, err = us.Validate(token)
+		require.NoError(t, err)
+		assert.Equal(t, 1, tus.validated)
+	})
+
+	t.Run("deactivateInvalidates", func(t *testing.T) {
+		tus.validated = 0
+		require.NoError(t, us.Deactivate(4))
+
+		_, err = us.Validate(token)
+		require.NoError(t, err)
+		assert.Equal(t, 1, tus.validated)
+	})
+
+	t.Run("impersonationNotCached", func(t *testing.T) {
+		tus.validated = 0
+		tus.impersonatedBy = 1
+		defer func() { tus.impersonatedBy = 0 }()
+		require.NoError(t, us.Update(&User{ID: 4}))
+
+		_, err = us.Validate(token)
+		require.NoError(t, err)
+		_, err = us.Validate(token)
+		require.NoError(t, err)
+		assert.Equal(t, 2, tus.validated, "must validate an impersonation token on every request")
+	})
+}
@@ -0,0 +1,363 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/campaigns.go -pkg modelstest . CampaignService:CampaignService
+
+// CampaignService defines a set of methods to be used when dealing with rating
+// campaigns.
+type CampaignService interface {
+	CampaignDB
+}
+
+// CampaignDB defines how the service interacts with the database.
+type CampaignDB interface {
+	// Create adds a campaign to the system. The Name, Targets, StartsAt
+	// and EndsAt fields are required. The input parameter will be
+	// modified with normalised values and ID will be set to the new
+	// campaign ID.
+	Create(*Campaign) error
+
+	// Update replaces the values of the campaign with ID c.ID. Ratings
+	// already submitted to the campaign are kept, even if they no longer
+	// match it.
+	Update(*Campaign) error
+
+	// Delete removes a campaign by ID. ErrInUse is returned if any rating
+	// was submitted to it.
+	Delete(id int64) error
+
+	// ByID retrieves a campaign by ID.
+	ByID(id int64) (Campaign, error)
+
+	// List retrieves all the campaigns, sorted by start date.
+	List() ([]Campaign, error)
+}
+
+// maxCampaignTargets is the maximum number of targets of a campaign.
+const maxCampaignTargets = 1000
+
+// A Campaign collects the ratings of a set of targets during a period of time.
+// Ratings submitted to a campaign must rate one of its targets, within its
+// window, and come from users of its eligible roles.
+type Campaign struct {
+	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
+
+	Name string `gorm:"size:128;not null" json:"name"`
+
+	// Targets are the IDs of the targets that can be rated in the
+	// campaign, sorted.
+	Targets pq.Int64Array `gorm:"type:bigint[];not null" json:"targets"`
+
+	// Roles are the IDs of the roles whose users can take part in the
+	// campaign, sorted. Users of any role can if it is empty.
+	Roles pq.Int64Array `gorm:"type:bigint[];not null" json:"roles"`
+
+	// StartsAt and EndsAt delimit the window when ratings are accepted,
+	// StartsAt included.
+	StartsAt time.Time `gorm:"type:timestamptz;not null" json:"startsAt"`
+	EndsAt   time.Time `gorm:"type:timestamptz;not null" json:"endsAt"`
+
+	// OrgID is the ID of the organisation the campaign belongs to, see
+	// Organisation, and nil for the campaigns of no organisation. It can
+	// only be set when the campaign is created: the input value is kept for
+	// the users of no organisation, and must then reference an existing
+	// organisation, and replaced by their organisation for the others.
+	// Updates keep the current value.
+	OrgID *int64 `gorm:"type:bigint" json:"orgId,omitempty"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// Open tells whether the campaign accepts ratings at t.
+func (c Campaign) Open(t time.Time) bool {
+	return !t.Before(c.StartsAt) && t.Before(c.EndsAt)
+}
+
+// Eligible tells whether users with the role roleID can take part in the
+// campaign.
+func (c Campaign) Eligible(roleID int64) bool {
+	return len(c.Roles) == 0 || containsID(c.Roles, roleID)
+}
+
+// Includes tells whether target can be rated in the campaign.
+func (c Campaign) Includes(target int64) bool {
+	return containsID(c.Targets, target)
+}
+
+// CampaignStats summarises the active ratings submitted to a campaign.
+type CampaignStats struct {
+	CampaignID int64 `json:"campaignId"`
+
+	// Count, Average and WeightedAverage are computed from the active
+	// ratings of all the targets, as in RatingStats.
+	Count           int64   `json:"count"`
+	Average         float64 `json:"average"`
+	WeightedAverage float64 `json:"weightedAverage"`
+
+	// Targets summarises the ratings of each target of the campaign
+	// that was rated, sorted by target.
+	Targets []RatingStats `json:"targets"`
+}
+
+// containsID tells whether the sorted ids contain id.
+func containsID(ids []int64, id int64) bool {
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	return i < len(ids) && ids[i] == id
+}
+
+// normaliseIDs sorts ids and removes duplicates. ErrInvalid is returned if any
+// of them is not valid.
+func normaliseIDs(ids []int64) ([]int64, error) {
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id < 1 {
+			return nil, ErrInvalid
+		}
+		out = append(out, id)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+
+	n := 0
+	for i, id := range out {
+		if i == 0 || id != out[n-1] {
+			out[n] = id
+			n++
+		}
+	}
+
+	return out[:n], nil
+}
+
+type campaignService struct {
+	CampaignService
+}
+
+// NewCampaignService instantiates a new CampaignService implementation with db
+// as the backing database.
+func NewCampaignService(db *gorm.DB) CampaignService {
+	return newCampaignService(db, SystemClock)
+}
+
+// newCampaignService instantiates a new CampaignService implementation, as
+// NewCampaignService does, dating the campaigns created with clock.
+func newCampaignService(db *gorm.DB, clock Clock) CampaignService {
+	return &campaignService{
+		CampaignService: &campaignValidator{
+			CampaignDB: &campaignGorm{db: db, clock: clock},
+		},
+	}
+}
+
+type campaignValidator struct {
+	CampaignDB
+}
+
+func (cv *campaignValidator) Create(c *Campaign) error {
+	c.ID = 0
+
+	err := cv.validate(c)
+	if err != nil {
+		return err
+	}
+
+	return cv.CampaignDB.Create(c)
+}
+
+func (cv *campaignValidator) Update(c *Campaign) error {
+	if c.ID < 1 {
+		return ErrNotFound
+	}
+
+	err := cv.validate(c)
+	if err != nil {
+		return err
+	}
+
+	return cv.CampaignDB.Update(c)
+}
+
+// validate checks the fields of c, normalising them.
+func (cv *campaignValidator) validate(c *Campaign) error {
+	ve := ValidationError{}
+
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		ve["name"] = ErrRequired
+	} else if len(c.Name) > 128 {
+		ve["name"] = ErrTooLong
+	}
+
+	targets, err := normaliseIDs(c.Targets)
+	switch {
+	case err != nil:
+		ve["targets"] = ErrInvalid
+	case len(targets) == 0:
+		ve["targets"] = ErrRequired
+	case len(targets) > maxCampaignTargets:
+		ve["targets"] = ErrTooLong
+	default:
+		c.Targets = targets
+	}
+
+	roles, err := normaliseIDs(c.Roles)
+	if err != nil {
+		ve["roles"] = ErrInvalid
+	} else {
+		c.Roles = roles
+	}
+
+	if c.StartsAt.IsZero() {
+		ve["startsAt"] = ErrRequired
+	}
+	if c.EndsAt.IsZero() {
+		ve["endsAt"] = ErrRequired
+	} else if !c.EndsAt.After(c.StartsAt) {
+		ve["endsAt"] = ErrInvalid
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return nil
+}
+
+func (cv *campaignValidator) Delete(id int64) error {
+	if id < 1 {
+		return ErrNotFound
+	}
+
+	return cv.CampaignDB.Delete(id)
+}
+
+func (cv *campaignValidator) ByID(id int64) (Campaign, error) {
+	if id < 1 {
+		return Campaign{}, ErrNotFound
+	}
+
+	return cv.CampaignDB.ByID(id)
+}
+
+type campaignGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+// checkRoles returns a ValidationError if any of the roles of c does not exist,
+// or is not available to its organisation, see Role.AvailableTo.
+func (cg *campaignGorm) checkRoles(c *Campaign) error {
+	if len(c.Roles) == 0 {
+		return nil
+	}
+
+	qb := cg.db.Model(&Role{}).Where("id IN (?)", []int64(c.Roles))
+	if c.OrgID != nil {
+		qb = qb.Where("org_id IS NULL OR org_id = ?", *c.OrgID)
+	}
+
+	var ct int
+	err := qb.Count(&ct).Error
+	if err != nil {
+		return wrap("could not look up campaign roles", err)
+	} else if ct != len(c.Roles) {
+		return ValidationError{"roles": ErrRefNotFound}
+	}
+
+	return nil
+}
+
+func (cg *campaignGorm) Create(c *Campaign) error {
+	err := cg.checkRoles(c)
+	if err != nil {
+		return err
+	}
+
+	c.CreatedAt = cg.clock.Now()
+	err = cg.db.Create(c).Error
+	if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "foreign_key_violation" && perr.Constraint == "campaigns_org_id_fkey" {
+		return ValidationError{"orgId": ErrRefNotFound}
+	} else if err != nil {
+		return wrap("could not create campaign", err)
+	}
+
+	return nil
+}
+
+func (cg *campaignGorm) Update(c *Campaign) error {
+	// the organisation of the campaign is never changed
+	current, err := cg.ByID(c.ID)
+	if err != nil {
+		return err
+	}
+	c.OrgID = current.OrgID
+
+	err = cg.checkRoles(c)
+	if err != nil {
+		return err
+	}
+
+	res := cg.db.Model(&Campaign{}).Where("id = ?", c.ID).Updates(map[string]interface{}{
+		"name":      c.Name,
+		"targets":   c.Targets,
+		"roles":     c.Roles,
+		"starts_at": c.StartsAt,
+		"ends_at":   c.EndsAt,
+	})
+	if res.Error != nil {
+		return with(wrap("could not update campaign", res.Error), "campaign_id", c.ID)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	*c, err = cg.ByID(c.ID)
+	return err
+}
+
+func (cg *campaignGorm) Delete(id int64) error {
+	res := cg.db.Delete(&Campaign{}, id)
+
+	if res.Error != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ErrInUse
+		}
+		return with(wrap("could not delete campaign", res.Error), "campaign_id", id)
+
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (cg *campaignGorm) ByID(id int64) (Campaign, error) {
+	var c Campaign
+	err := cg.db.First(&c, id).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return Campaign{}, ErrNotFound
+		}
+		return Campaign{}, with(wrap("could not get campaign by ID", err), "campaign_id", id)
+	}
+
+	return c, nil
+}
+
+func (cg *campaignGorm) List() ([]Campaign, error) {
+	campaigns := []Campaign{}
+	err := cg.db.Order("starts_at, id").Find(&campaigns).Error
+	if err != nil {
+		return nil, wrap("could not list campaigns", err)
+	}
+
+	return campaigns, nil
+}
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type testCampaignDB struct {
+	CampaignDB
+	create func(*Campaign) error
+	update func(*Campaign) error
+	byID   func(int64) (Campaign, error)
+}
+
+func (t *testCampaignDB) Create(c *Campaign) error {
+	if t.create != nil {
+		return t.create(c)
+	}
+
+	return nil
+}
+
+func (t *testCampaignDB) Update(c *Campaign) error {
+	if t.update != nil {
+		return t.update(c)
+	}
+
+	return nil
+}
+
+func (t *testCampaignDB) ByID(id int64) (Campaign, error) {
+	if t.byID != nil {
+		return t.byID(id)
+	}
+
+	return Campaign{}, ErrNotFound
+}
+
+func TestCampaign(t *testing.T) {
+	start := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	c := Campaign{
+		Targets:  pq.Int64Array{3, 7, 9},
+		StartsAt: start,
+		EndsAt:   start.Add(24 * time.Hour),
+	}
+
+	assert.False(t, c.Open(start.Add(-time.Second)))
+	assert.True(t, c.Open(start))
+	assert.True(t, c.Open(start.Add(23*time.Hour)))
+	assert.False(t, c.Open(start.Add(24*time.Hour)))
+
+	assert.True(t, c.Includes(7))
+	assert.False(t, c.Includes(8))
+	assert.False(t, c.Includes(10))
+
+	assert.True(t, c.Eligible(2), "any role must be eligible without roles")
+	c.Roles = pq.Int64Array{1, 3}
+	assert.True(t, c.Eligible(3))
+	assert.False(t, c.Eligible(2))
+}
+
+func TestCampaignValidator(t *testing.T) {
+	tcdb := &testCampaignDB{}
+	cs := NewCampaignService(nil)
+	cs.(*campaignService).CampaignService.(*campaignValidator).CampaignDB = tcdb
+
+	start := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	valid := func() *Campaign {
+		return &Campaign{
+			Name:     " Spring ",
+			Targets:  pq.Int64Array{9, 3, 9},
+			Roles:    pq.Int64Array{2},
+			StartsAt: start,
+			EndsAt:   start.Add(time.Hour),
+		}
+	}
+
+	var cases = []struct {
+		name   string
+		change func(*Campaign)
+		outerr error
+	}{
+		{"ok", func(c *Campaign) {}, nil},
+		{"nameRequired", func(c *Campaign) { c.Name = "  " }, ValidationError{"name": ErrRequired}},
+		{"targetsRequired", func(c *Campaign) { c.Targets = nil }, ValidationError{"targets": ErrRequired}},
+		{"targetsInvalid", func(c *Campaign) { c.Targets = pq.Int64Array{4, 0} }, ValidationError{"targets": ErrInvalid}},
+		{"targetsTooLong", func(c *Campaign) {
+			c.Targets = make(pq.Int64Array, maxCampaignTargets+1)
+			for i := range c.Targets {
+				c.Targets[i] = int64(i + 1)
+			}
+		}, ValidationError{"targets": ErrTooLong}},
+		{"rolesInvalid", func(c *Campaign) { c.Roles = pq.Int64Array{-1} }, ValidationError{"roles": ErrInvalid}},
+		{"datesRequired", func(c *Campaign) { c.StartsAt, c.EndsAt = time.Time{}, time.Time{} },
+			ValidationError{"startsAt": ErrRequired, "endsAt": ErrRequired}},
+		{"endsBeforeStart", func(c *Campaign) { c.EndsAt = c.StartsAt }, ValidationError{"endsAt": ErrInvalid}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid()
+			c.ID = 55
+			tc.change(c)
+
+			err := cs.Create(c)
+			assert.Equal(t, tc.outerr, err)
+			if tc.outerr == nil {
+				assert.Equal(t, int64(0), c.ID, "must not use the ID provided")
+				assert.Equal(t, "Spring", c.Name)
+				assert.Equal(t, pq.Int64Array{3, 9}, c.Targets)
+			}
+		})
+	}
+
+	t.Run("updateNotFound", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, cs.Update(valid()))
+	})
+
+	t.Run("byIDNotFound", func(t *testing.T) {
+		_, err := cs.ByID(0)
+		assert.Equal(t, ErrNotFound, err)
+	})
+}
+
+func TestRatingService_CreateInCampaign(t *testing.T) {
+	tudb := &testUserDB{
+		byID: func(id int64) (User, error) {
+			return User{ID: id, Active: true, RoleID: 2}, nil
+		},
+	}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	tcdb := &testCampaignDB{}
+	rs := NewRatingService(nil, us)
+	rv := rs.(*ratingService).RatingService.(*ratingValidator)
+	rv.RatingDB = &testRatingDB{}
+	rv.campaigns = tcdb
+
+	open := Campaign{
+		ID:       4,
+		Targets:  pq.Int64Array{9},
+		StartsAt: time.Now().Add(-time.Hour),
+		EndsAt:   time.Now().Add(time.Hour),
+	}
+
+	campaignID := int64(4)
+	var cases = []struct {
+		name     string
+		target   int64
+		campaign func(Campaign) Campaign
+		outerr   error
+	}{
+		{"ok", 9, func(c Campaign) Campaign { return c }, nil},
+		{"notFound", 9, nil, ValidationError{"campaignId": ErrRefNotFound}},
+		{"closed", 9, func(c Campaign) Campaign {
+			c.EndsAt = time.Now().Add(-time.Minute)
+			return c
+		}, ValidationError{"campaignId": ErrCampaignClosed}},
+		{"notEligible", 9, func(c Campaign) Campaign {
+			c.Roles = pq.Int64Array{1}
+			return c
+		}, ValidationError{"campaignId": ErrNotEligible}},
+		{"targetNotIncluded", 8, func(c Campaign) Campaign { return c }, ValidationError{"target": ErrInvalid}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tcdb.byID = nil
+			if tc.campaign != nil {
+				tcdb.byID = func(id int64) (Campaign, error) {
+					assert.Equal(t, campaignID, id)
+					return tc.campaign(open), nil
+				}
+			}
+
+			err := rs.Create(&Rating{Score: 3, Target: tc.target, CampaignID: &campaignID, User: &User{ID: 1}})
+			assert.Equal(t, tc.outerr, err)
+		})
+	}
+}
+
+func TestCampaignGorm(t *testing.T) {
+	db := setupGorm(t)
+	cs := NewCampaignService(db)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	c := Campaign{
+		Name:     "Spring",
+		Targets:  pq.Int64Array{9, 3},
+		StartsAt: start,
+		EndsAt:   start.Add(2 * time.Hour),
+	}
+	require.NoError(t, cs.Create(&c))
+	assert.NotZero(t, c.ID)
+
+	t.Run("unknownRole", func(t *testing.T) {
+		bad := c
+		bad.Roles = pq.Int64Array{404}
+		assert.Equal(t, ValidationError{"roles": ErrRefNotFound}, cs.Create(&bad))
+	})
+
+	t.Run("organisation", func(t *testing.T) {
+		acme, globex := Organisation{Name: "Acme"}, Organisation{Name: "Globex"}
+		require.NoError(t, db.Create(&acme).Error)
+		require.NoError(t, db.Create(&globex).Error)
+		require.NoError(t, db.Create(&Role{ID: 90, Label: "globex", OrgID: &globex.ID}).Error)
+
+		bad := c
+		bad.ID, bad.OrgID, bad.Roles = 0, &acme.ID, pq.Int64Array{90}
+		assert.Equal(t, ValidationError{"roles": ErrRefNotFound}, cs.Create(&bad), "must not use the roles of another organisation")
+
+		bad.OrgID, bad.Roles = new(int64), pq.Int64Array{2}
+		*bad.OrgID = 404
+		assert.Equal(t, ValidationError{"orgId": ErrRefNotFound}, cs.Create(&bad))
+
+		owned := c
+		owned.ID, owned.OrgID, owned.Roles = 0, &acme.ID, pq.Int64Array{2}
+		require.NoError(t, cs.Create(&owned))
+		owned.OrgID = &globex.ID
+		require.NoError(t, cs.Update(&owned))
+		assert.Equal(t, &acme.ID, owned.OrgID, "must not change the organisation")
+		require.NoError(t, cs.Delete(owned.ID))
+	})
+
+	c.Roles = pq.Int64Array{2}
+	require.NoError(t, cs.Update(&c))
+	got, err := cs.ByID(c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pq.Int64Array{2}, got.Roles)
+	assert.Equal(t, pq.Int64Array{3, 9}, got.Targets)
+
+	list, err := cs.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, c.ID, list[0].ID)
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1, CampaignID: &c.ID}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 98, CampaignID: &c.ID}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 3, Target: 3, UserID: 98, CampaignID: &c.ID}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 9, Target: 9, UserID: 98}).Error)
+
+	stats, err := (&ratingGorm{db: db}).StatsByCampaign(c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CampaignStats{
+		CampaignID:      c.ID,
+		Count:           3,
+		Average:         3,
+		WeightedAverage: 3,
+		Targets: []RatingStats{
+			{Target: 3, Count: 1, Average: 3, WeightedAverage: 3, VerifiedWeightedAverage: 3, Min: 3, Max: 3},
+			{Target: 9, Count: 2, Average: 3, WeightedAverage: 3, VerifiedWeightedAverage: 3, Min: 1, Max: 5},
+		},
+	}, stats)
+
+	assert.Equal(t, ErrInUse, cs.Delete(c.ID))
+
+	require.NoError(t, db.Where("campaign_id = ?", c.ID).Delete(&Rating{}).Error)
+	require.NoError(t, cs.Delete(c.ID))
+	_, err = cs.ByID(c.ID)
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,289 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/events"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/cards.go -pkg modelstest . CardService:CardService
+
+// CardService defines a set of methods to be used when dealing with the rating
+// cards, a read model of the active ratings denormalised for the lists of the
+// frontend. The cards are kept up to date from the event bus, so they may lag
+// slightly behind the ratings.
+type CardService interface {
+	// Scoped returns a CardService that only reads the cards of the
+	// ratings visible to u, as in RatingService.Scoped.
+	//
+	// The service itself is returned if u's role is not restricted.
+	Scoped(u *User) CardService
+
+	CardDB
+}
+
+// CardDB defines how the service interacts with the database.
+type CardDB interface {
+	// ByTarget retrieves the cards of the active ratings of a target,
+	// newest first, paginated as set in q.
+	//
+	// A ValidationError is returned if the target or q are not valid.
+	ByTarget(target int64, q CardQuery) ([]RatingCard, error)
+
+	// Refresh updates the cards of the given ratings from the ratings
+	// themselves, their reviewers and the reactions to them. The cards
+	// of the ratings no longer active are removed.
+	Refresh(ratingIDs ...int64) error
+
+	// RefreshByUser updates the cards of the ratings of a user, as in
+	// Refresh.
+	RefreshByUser(userID int64) error
+
+	// Rebuild updates the cards of every rating, as in Refresh, fixing
+	// those that missed the events dropped by the bus.
+	Rebuild() error
+}
+
+// Limits of the number of cards returned by CardDB.ByTarget.
+const (
+	defaultCardLimit = 50
+	maxCardLimit     = 200
+)
+
+// A RatingCard holds what the frontend shows of an active rating: the rating
+// itself, the display name of its reviewer and the reactions to it.
+type RatingCard struct {
+	// ID is the ID of the rating.
+	ID int64 `gorm:"primary_key;type:bigint" json:"id"`
+
+	Target    int64  `gorm:"type:bigint;not null" json:"target"`
+	Score     int    `gorm:"type:int;not null" json:"score"`
+	Comment   string `gorm:"type:text;not null" json:"comment,omitempty"`
+	Anonymous bool   `gorm:"not null" json:"anonymous"`
+	Date      int64  `gorm:"type:bigint;not null" json:"date"`
+
+	// UserID is the author of the rating, only used to refresh the
+	// cards when the author is updated.
+	UserID int64 `gorm:"type:bigint;not null" json:"-"`
+
+	// ReviewerName is the first name of the author and the initial of
+	// their last name, like "Jane D.". It is empty for anonymous
+	// ratings.
+	ReviewerName string `gorm:"size:255;not null" json:"reviewerName,omitempty"`
+
+	// Helpful and Unhelpful count the reactions to the rating.
+	Helpful   int64 `gorm:"type:bigint;not null" json:"helpful"`
+	Unhelpful int64 `gorm:"type:bigint;not null" json:"unhelpful"`
+
+	// UpdatedAt is when the card was last refreshed.
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null" json:"updatedAt"`
+}
+
+// A CardQuery paginates the cards of a target.
+type CardQuery struct {
+	// Limit is the maximum number of cards returned, 50 by default and
+	// up to 200.
+	Limit int
+
+	// Before only returns the cards of the ratings with a lower ID, like
+	// the ID of the last card of the previous page. Ignored if zero.
+	Before int64
+}
+
+type cardService struct {
+	CardService
+
+	db     *gorm.DB
+	policy visibilityPolicy
+}
+
+// NewCardService instantiates a new CardService implementation with db as the
+// backing database.
+func NewCardService(db *gorm.DB) CardService {
+	return newCardService(db, nil)
+}
+
+// newCardService instantiates a new CardService implementation restricting the
+// cards read with the visibility rules of policy.
+func newCardService(db *gorm.DB, policy visibilityPolicy) CardService {
+	return &cardService{
+		CardService: &cardValidator{
+			CardDB: &cardGorm{db: db},
+		},
+		db:     db,
+		policy: policy,
+	}
+}
+
+func (cs *cardService) Scoped(u *User) CardService {
+	scope := cs.policy.scope(u.RoleID)
+	if scope == nil {
+		return cs
+	}
+
+	return &cardService{
+		CardService: &cardValidator{
+			CardDB: &cardGorm{db: cs.db, scope: scope},
+		},
+		db:     cs.db,
+		policy: cs.policy,
+	}
+}
+
+type cardValidator struct {
+	CardDB
+}
+
+func (cv *cardValidator) Scoped(u *User) CardService {
+	panic("method Scoped of cardValidator must never be called")
+}
+
+func (cv *cardValidator) ByTarget(target int64, q CardQuery) ([]RatingCard, error) {
+	ve := ValidationError{}
+	if target < 1 {
+		ve["target"] = ErrInvalid
+	}
+
+	if q.Limit == 0 {
+		q.Limit = defaultCardLimit
+	} else if q.Limit < 0 || q.Limit > maxCardLimit {
+		ve["limit"] = ErrInvalid
+	}
+
+	if q.Before < 0 {
+		ve["before"] = ErrInvalid
+	}
+
+	if len(ve) > 0 {
+		return nil, ve
+	}
+
+	return cv.CardDB.ByTarget(target, q)
+}
+
+type cardGorm struct {
+	db *gorm.DB
+
+	// scope restricts the cards read to the ratings it matches, and may
+	// be nil.
+	scope func(*gorm.DB) *gorm.DB
+}
+
+// cardRefreshSQL upserts the cards of the active ratings matching a condition
+// on the ratings table, given as its only argument.
+const cardRefreshSQL = `INSERT INTO rating_cards (id, target, score, comment, anonymous, date, user_id, reviewer_name, helpful, unhelpful, updated_at)
+	SELECT r.id, r.target, r.score, r.comment, r.anonymous, r.date, r.user_id,
+		CASE WHEN r.anonymous THEN '' ELSE trim(u.first_name || ' ' || CASE WHEN u.last_name = '' THEN '' ELSE left(u.last_name, 1) || '.' END) END,
+		(SELECT count(*) FROM rating_reactions x WHERE x.rating_id = r.id AND x.helpful),
+		(SELECT count(*) FROM rating_reactions x WHERE x.rating_id = r.id AND NOT x.helpful),
+		now()
+	FROM (SELECT * FROM ratings WHERE active AND %s) r
+	JOIN users u ON u.id = r.user_id
+	ON CONFLICT (id) DO UPDATE SET
+		target = EXCLUDED.target,
+		score = EXCLUDED.score,
+		comment = EXCLUDED.comment,
+		anonymous = EXCLUDED.anonymous,
+		date = EXCLUDED.date,
+		user_id = EXCLUDED.user_id,
+		reviewer_name = EXCLUDED.reviewer_name,
+		helpful = EXCLUDED.helpful,
+		unhelpful = EXCLUDED.unhelpful,
+		updated_at = EXCLUDED.updated_at`
+
+func (cg *cardGorm) ByTarget(target int64, q CardQuery) ([]RatingCard, error) {
+	query := cg.db.Where("target = ?", target)
+	if q.Before > 0 {
+		query = query.Where("id < ?", q.Before)
+	}
+	if cg.scope != nil {
+		visible := cg.db.Table("ratings").Select("id").Where("target = ?", target).Scopes(cg.scope)
+		query = query.Where("id IN (?)", visible.QueryExpr())
+	}
+
+	cards := []RatingCard{}
+	err := query.Order("id DESC").Limit(q.Limit).Find(&cards).Error
+	if err != nil {
+		return nil, with(wrap("could not list rating cards", err), "target", target)
+	}
+
+	return cards, nil
+}
+
+func (cg *cardGorm) Refresh(ratingIDs ...int64) error {
+	if len(ratingIDs) == 0 {
+		return nil
+	}
+
+	err := cg.refresh("id IN (?)", ratingIDs)
+	if err != nil {
+		return with(err, "rating_ids", ratingIDs)
+	}
+
+	return nil
+}
+
+func (cg *cardGorm) RefreshByUser(userID int64) error {
+	err := cg.refresh("user_id = ?", userID)
+	if err != nil {
+		return with(err, "user_id", userID)
+	}
+
+	return nil
+}
+
+func (cg *cardGorm) Rebuild() error {
+	return cg.refresh("TRUE", nil)
+}
+
+// refresh updates the cards of the ratings matching cond, a condition on the
+// columns shared by the ratings and rating_cards tables. cond has a placeholder
+// for arg, unless arg is nil.
+func (cg *cardGorm) refresh(cond string, arg interface{}) error {
+	args := []interface{}{arg}
+	if arg == nil {
+		args = nil
+	}
+
+	return gormTransaction(cg.db, func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM rating_cards WHERE "+cond+
+			" AND id NOT IN (SELECT id FROM ratings WHERE active AND "+cond+")", append(args, args...)...).Error
+		if err != nil {
+			return wrap("could not delete stale rating cards", err)
+		}
+
+		err = tx.Exec(fmt.Sprintf(cardRefreshSQL, cond), args...).Error
+		if err != nil {
+			return wrap("could not refresh rating cards", err)
+		}
+
+		return nil
+	})
+}
+
+// cardProjector keeps the rating cards up to date with the events published to
+// the event bus.
+type cardProjector struct {
+	cards   CardDB
+	onError func(error)
+}
+
+// handle is the events.Handler of the projector.
+func (cp *cardProjector) handle(e events.Event) {
+	var err error
+
+	switch d := e.Data.(type) {
+	case Rating:
+		err = cp.cards.Refresh(d.ID)
+	case Reaction:
+		err = cp.cards.Refresh(d.RatingID)
+	case User:
+		err = cp.cards.RefreshByUser(d.ID)
+	}
+
+	if err != nil && cp.onError != nil {
+		cp.onError(err)
+	}
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCardDB struct {
+	CardDB
+	refreshed []int64
+	users     []int64
+	err       error
+}
+
+func (t *testCardDB) ByTarget(target int64, q CardQuery) ([]RatingCard, error) {
+	return []RatingCard{}, nil
+}
+
+func (t *testCardDB) Refresh(ratingIDs ...int64) error {
+	t.refreshed = append(t.refreshed, ratingIDs...)
+	return t.err
+}
+
+func (t *testCardDB) RefreshByUser(userID int64) error {
+	t.users = append(t.users, userID)
+	return t.err
+}
+
+func TestCardValidator(t *testing.T) {
+	cv := &cardValidator{CardDB: &testCardDB{}}
+
+	var cases = []struct {
+		name   string
+		target int64
+		q      CardQuery
+		outerr error
+	}{
+		{"ok", 9, CardQuery{}, nil},
+		{"page", 9, CardQuery{Limit: maxCardLimit, Before: 100}, nil},
+		{"targetInvalid", 0, CardQuery{}, ValidationError{"target": ErrInvalid}},
+		{"limitTooHigh", 9, CardQuery{Limit: maxCardLimit + 1}, ValidationError{"limit": ErrInvalid}},
+		{"limitNegative", 9, CardQuery{Limit: -1}, ValidationError{"limit": ErrInvalid}},
+		{"beforeInvalid", 9, CardQuery{Before: -1}, ValidationError{"before": ErrInvalid}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := cv.ByTarget(tc.target, tc.q)
+			assert.Equal(t, tc.outerr, err)
+		})
+	}
+}
+
+func TestCardProjector(t *testing.T) {
+	cards := &testCardDB{}
+	var errs []error
+	cp := &cardProjector{cards: cards, onError: func(err error) { errs = append(errs, err) }}
+
+	cp.handle(events.Event{Type: events.RatingCreated, Data: Rating{ID: 1}})
+	cp.handle(events.Event{Type: events.RatingModerated, Data: Rating{ID: 2}})
+	cp.handle(events.Event{Type: events.ReactionChanged, Data: Reaction{RatingID: 3, UserID: 7}})
+	cp.handle(events.Event{Type: events.UserUpdated, Data: User{ID: 7}})
+	assert.Equal(t, []int64{1, 2, 3}, cards.refreshed)
+	assert.Equal(t, []int64{7}, cards.users)
+	assert.Empty(t, errs)
+
+	cards.err = errors.New("database down")
+	cp.handle(events.Event{Type: events.RatingUpdated, Data: Rating{ID: 1}})
+	assert.Len(t, errs, 1)
+}
+
+type testEventsUserService struct {
+	UserService
+}
+
+func (t *testEventsUserService) Update(u *User) error {
+	u.Version++
+	return nil
+}
+
+func TestReactionAndUserEvents(t *testing.T) {
+	bus := events.NewBus(0)
+
+	var got []events.Event
+	bus.Subscribe(func(e events.Event) { got = append(got, e) })
+
+	rs := newReputationEvents(&testReputationDB{}, bus)
+	require.NoError(t, rs.React(&Reaction{RatingID: 3, UserID: 7, Helpful: true}))
+	require.NoError(t, rs.Unreact(3, 7))
+
+	us := newUserEvents(&testEventsUserService{}, bus)
+	require.NoError(t, us.Update(&User{ID: 7, FirstName: "Jane", Password: "secret"}))
+	bus.Close()
+
+	require.Len(t, got, 3)
+	assert.Equal(t, events.ReactionChanged, got[0].Type)
+	assert.Equal(t, Reaction{RatingID: 3, UserID: 7, Helpful: true}, got[0].Data)
+	assert.Equal(t, Reaction{RatingID: 3, UserID: 7}, got[1].Data)
+	assert.Equal(t, events.UserUpdated, got[2].Type)
+	assert.Equal(t, User{ID: 7, FirstName: "Jane", Version: 1}, got[2].Data, "must not publish the password")
+}
+
+func TestCardGorm(t *testing.T) {
+	db := setupGorm(t)
+	cs := newCardService(db, newVisibilityPolicy([]VisibilityRule{{RoleID: 2, SQL: "NOT anonymous"}}))
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Jane", LastName: "Doe", Password: "TestPasswordHAsh", Active: true}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh", Active: true}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 9, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 11, Active: true, Anonymous: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 9, UserID: 99}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 12, Active: false, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Reaction{RatingID: 10, UserID: 99, Helpful: true}).Error)
+	require.NoError(t, db.Create(&Reaction{RatingID: 10, UserID: 1, Helpful: false}).Error)
+
+	require.NoError(t, cs.Rebuild())
+
+	cards, err := cs.ByTarget(9, CardQuery{})
+	require.NoError(t, err)
+	require.Len(t, cards, 2, "must only hold active ratings")
+	assert.Equal(t, int64(11), cards[0].ID)
+	assert.Empty(t, cards[0].ReviewerName, "must not name the authors of anonymous ratings")
+	assert.Equal(t, "Jane D.", cards[1].ReviewerName)
+	assert.Equal(t, int64(1), cards[1].Helpful)
+	assert.Equal(t, int64(1), cards[1].Unhelpful)
+
+	cards, err = cs.ByTarget(9, CardQuery{Limit: 1, Before: 11})
+	require.NoError(t, err)
+	require.Len(t, cards, 1)
+	assert.Equal(t, int64(10), cards[0].ID)
+
+	cards, err = cs.Scoped(&User{ID: 98, RoleID: 2}).ByTarget(9, CardQuery{})
+	require.NoError(t, err)
+	require.Len(t, cards, 1, "must apply the visibility rules")
+	assert.Equal(t, int64(10), cards[0].ID)
+
+	t.Run("refresh", func(t *testing.T) {
+		require.NoError(t, db.Exec("UPDATE ratings SET active = false WHERE id = 11").Error)
+		require.NoError(t, db.Exec("UPDATE ratings SET active = true WHERE id = 12").Error)
+		require.NoError(t, cs.Refresh(11, 12))
+
+		cards, err := cs.ByTarget(9, CardQuery{})
+		require.NoError(t, err)
+		require.Len(t, cards, 2)
+		assert.Equal(t, int64(12), cards[0].ID)
+		assert.Equal(t, "admin", cards[0].ReviewerName)
+		assert.Equal(t, int64(10), cards[1].ID)
+	})
+
+	t.Run("refreshByUser", func(t *testing.T) {
+		require.NoError(t, db.Exec("UPDATE users SET first_name = 'Janet' WHERE id = 98").Error)
+		require.NoError(t, cs.RefreshByUser(98))
+
+		cards, err := cs.ByTarget(9, CardQuery{})
+		require.NoError(t, err)
+		assert.Equal(t, "Janet D.", cards[1].ReviewerName)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		require.NoError(t, db.Delete(&Rating{ID: 12}).Error)
+
+		cards, err := cs.ByTarget(9, CardQuery{})
+		require.NoError(t, err)
+		assert.Len(t, cards, 1, "must delete the cards of the ratings deleted")
+	})
+}
@@ -0,0 +1,268 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+// categoryName matches the valid names of the target categories.
+var categoryName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+//go:generate go run github.com/matryer/moq -out modelstest/categories.go -pkg modelstest . TargetCategoryService:TargetCategoryService
+
+// TargetCategoryService defines a set of methods used to manage the categories
+// of the targets, like restaurants or drivers, and the rules their ratings must
+// follow. The targets are put in a category with RatingDB.SetCategory, and the
+// ratings of a target are checked against the rules of its category when they
+// are created or updated.
+type TargetCategoryService interface {
+	// List retrieves the categories, sorted by name.
+	List() ([]TargetCategory, error)
+
+	// ByName retrieves a category by name.
+	ByName(name string) (TargetCategory, error)
+
+	// Set sets the rules of the category named c.Name, creating it if
+	// needed. The ratings already stored are not checked again. On
+	// success, c.UpdatedAt is set.
+	Set(c *TargetCategory) error
+
+	// Remove removes a category by name. ErrInUse is returned if any
+	// target is in it.
+	Remove(name string) error
+}
+
+// A TargetCategory holds the rules of the ratings of the targets of a category.
+type TargetCategory struct {
+	// Name is lowercase, like "restaurants".
+	Name string `gorm:"primary_key;size:64" json:"name"`
+
+	// MinScore and MaxScore bound the scores of the ratings, both
+	// included. A nil bound does not restrict the scores.
+	MinScore *int `gorm:"type:int" json:"minScore"`
+	MaxScore *int `gorm:"type:int" json:"maxScore"`
+
+	// CommentRequired tells the ratings must have a comment.
+	CommentRequired bool `gorm:"not null" json:"commentRequired"`
+
+	// UpdatedBy is the ID of the user who set the rules.
+	UpdatedBy int64     `gorm:"type:bigint;not null" json:"updatedBy"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updatedAt"`
+}
+
+// AllowsScore tells whether the ratings of the category can have the given
+// score.
+func (tc TargetCategory) AllowsScore(score int) bool {
+	return (tc.MinScore == nil || score >= *tc.MinScore) && (tc.MaxScore == nil || score <= *tc.MaxScore)
+}
+
+// NewTargetCategoryService instantiates a new TargetCategoryService
+// implementation with db as the backing database.
+func NewTargetCategoryService(db *gorm.DB) TargetCategoryService {
+	return newTargetCategoryService(db, SystemClock)
+}
+
+// newTargetCategoryService instantiates a new TargetCategoryService
+// implementation, as NewTargetCategoryService does, dating the changes of the
+// categories with clock.
+func newTargetCategoryService(db *gorm.DB, clock Clock) TargetCategoryService {
+	return &targetCategoryValidator{
+		TargetCategoryService: &targetCategoryGorm{db: db, clock: clock},
+	}
+}
+
+type targetCategoryValidator struct {
+	TargetCategoryService
+}
+
+func (cv *targetCategoryValidator) ByName(name string) (TargetCategory, error) {
+	if !categoryName.MatchString(name) {
+		return TargetCategory{}, ErrNotFound
+	}
+
+	return cv.TargetCategoryService.ByName(name)
+}
+
+func (cv *targetCategoryValidator) Set(c *TargetCategory) error {
+	ve := ValidationError{}
+	switch {
+	case c.Name == "":
+		ve["name"] = ErrRequired
+	case !categoryName.MatchString(c.Name):
+		ve["name"] = ErrInvalid
+	}
+
+	// a score of 0 is never valid, see Rating.Score, so the bounds
+	// must leave other scores
+	switch {
+	case c.MinScore != nil && c.MaxScore != nil && *c.MinScore > *c.MaxScore:
+		ve["maxScore"] = ErrInvalid
+	case c.MinScore != nil && c.MaxScore != nil && *c.MinScore == 0 && *c.MaxScore == 0:
+		ve["maxScore"] = ErrInvalid
+	}
+
+	if c.UpdatedBy < 1 {
+		ve["updatedBy"] = ErrRequired
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return cv.TargetCategoryService.Set(c)
+}
+
+func (cv *targetCategoryValidator) Remove(name string) error {
+	if !categoryName.MatchString(name) {
+		return ErrNotFound
+	}
+
+	return cv.TargetCategoryService.Remove(name)
+}
+
+type targetCategoryGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (cg *targetCategoryGorm) List() ([]TargetCategory, error) {
+	categories := []TargetCategory{}
+	err := cg.db.Order("name").Find(&categories).Error
+	if err != nil {
+		return nil, wrap("could not list target categories", err)
+	}
+
+	return categories, nil
+}
+
+func (cg *targetCategoryGorm) ByName(name string) (TargetCategory, error) {
+	var c TargetCategory
+	err := cg.db.Where("name = ?", name).First(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return TargetCategory{}, ErrNotFound
+	} else if err != nil {
+		return TargetCategory{}, with(wrap("could not get target category", err), "name", name)
+	}
+
+	return c, nil
+}
+
+func (cg *targetCategoryGorm) Set(c *TargetCategory) error {
+	c.UpdatedAt = cg.clock.Now()
+	err := cg.db.Exec(`INSERT INTO target_categories (name, min_score, max_score, comment_required, updated_by, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET min_score = excluded.min_score, max_score = excluded.max_score,
+			comment_required = excluded.comment_required, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		c.Name, c.MinScore, c.MaxScore, c.CommentRequired, c.UpdatedBy, c.UpdatedAt).Error
+	if err != nil {
+		return with(wrap("could not set target category", err), "name", c.Name)
+	}
+
+	return nil
+}
+
+func (cg *targetCategoryGorm) Remove(name string) error {
+	res := cg.db.Exec("DELETE FROM target_categories WHERE name = ?", name)
+	if res.Error != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ErrInUse
+		}
+		return with(wrap("could not remove target category", res.Error), "name", name)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (rv *ratingValidator) Category(target int64) (TargetCategory, error) {
+	if target < 1 {
+		return TargetCategory{}, ValidationError{"target": ErrInvalid}
+	}
+
+	return rv.RatingDB.Category(target)
+}
+
+func (rv *ratingValidator) SetCategory(target int64, name string) error {
+	if target < 1 {
+		return ValidationError{"target": ErrInvalid}
+	} else if name != "" && !categoryName.MatchString(name) {
+		return ValidationError{"category": ErrRefNotFound}
+	}
+
+	return rv.RatingDB.SetCategory(target, name)
+}
+
+func (rg *ratingGorm) Category(target int64) (TargetCategory, error) {
+	var c TargetCategory
+	err := rg.db.Raw(`SELECT c.* FROM target_categories c JOIN targets t ON t.category = c.name WHERE t.target = ?`, target).
+		Scan(&c).
+		Error
+	if gorm.IsRecordNotFoundError(err) {
+		return TargetCategory{}, ErrNotFound
+	} else if err != nil {
+		return TargetCategory{}, with(wrap("could not get the category of the target", err), "target", target)
+	}
+
+	return c, nil
+}
+
+// SetCategory sets the category of a target on its row of the targets, which is
+// created if it has no ratings yet.
+func (rg *ratingGorm) SetCategory(target int64, name string) error {
+	var category *string
+	if name != "" {
+		category = &name
+	}
+
+	err := rg.db.Exec(`INSERT INTO targets (target, category) VALUES (?, ?)
+		ON CONFLICT (target) DO UPDATE SET category = excluded.category`, target, category).Error
+	if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "foreign_key_violation" {
+		return ValidationError{"category": ErrRefNotFound}
+	} else if err != nil {
+		return with(wrap("could not set the category of the target", err), "target", target)
+	}
+
+	return nil
+}
+
+// fetchCategory retrieves the category of the target of the rating, whose rules
+// are checked by the next validators. The targets without a category have no
+// rules. This method is dependent on the target being set.
+func (rc *ratingValWithDBData) fetchCategory() (string, ratingValFn) {
+	return "", func(r *Rating) error {
+		var err error
+		rc.category, err = rc.rv.RatingDB.Category(r.Target)
+		if xerrors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+}
+
+// categoryScoreRange makes sure the score is allowed by the category of the
+// target. It may return ErrInvalid. This method is dependent on fetchCategory.
+func (rc *ratingValWithDBData) categoryScoreRange() (string, ratingValFn) {
+	return "score", func(r *Rating) error {
+		if !rc.category.AllowsScore(r.Score) {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
+// categoryCommentRequired makes sure the rating has a comment if the category
+// of the target requires one. It may return ErrRequired. This method is
+// dependent on fetchCategory.
+func (rc *ratingValWithDBData) categoryCommentRequired() (string, ratingValFn) {
+	return "comment", func(r *Rating) error {
+		if rc.category.CommentRequired && strings.TrimSpace(r.Comment) == "" {
+			return ErrRequired
+		}
+		return nil
+	}
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type testTargetCategoryDB struct {
+	TargetCategoryService
+	set func(*TargetCategory) error
+}
+
+func (t *testTargetCategoryDB) Set(c *TargetCategory) error {
+	if t.set != nil {
+		return t.set(c)
+	}
+
+	return nil
+}
+
+func TestTargetCategoryValidator(t *testing.T) {
+	cs := NewTargetCategoryService(nil)
+	cs.(*targetCategoryValidator).TargetCategoryService = &testTargetCategoryDB{}
+
+	one, five, zero := 1, 5, 0
+	var cases = []struct {
+		name     string
+		category TargetCategory
+		outerr   error
+	}{
+		{"ok", TargetCategory{Name: "restaurants", MinScore: &one, MaxScore: &five, UpdatedBy: 1}, nil},
+		{"unbounded", TargetCategory{Name: "drivers", CommentRequired: true, UpdatedBy: 1}, nil},
+		{"nameRequired", TargetCategory{UpdatedBy: 1}, ValidationError{"name": ErrRequired}},
+		{"nameInvalid", TargetCategory{Name: "Restaurants", UpdatedBy: 1}, ValidationError{"name": ErrInvalid}},
+		{"reversedBounds", TargetCategory{Name: "drivers", MinScore: &five, MaxScore: &one, UpdatedBy: 1}, ValidationError{"maxScore": ErrInvalid}},
+		{"onlyZero", TargetCategory{Name: "drivers", MinScore: &zero, MaxScore: &zero, UpdatedBy: 1}, ValidationError{"maxScore": ErrInvalid}},
+		{"updatedByRequired", TargetCategory{Name: "drivers"}, ValidationError{"updatedBy": ErrRequired}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.category
+			assert.Equal(t, tc.outerr, cs.Set(&c))
+		})
+	}
+
+	t.Run("notFound", func(t *testing.T) {
+		_, err := cs.ByName("Not a category")
+		assert.Equal(t, ErrNotFound, err)
+		assert.Equal(t, ErrNotFound, cs.Remove(""))
+	})
+}
+
+func TestRatingService_CategoryRules(t *testing.T) {
+	tudb := &testUserDB{
+		byID: func(id int64) (User, error) {
+			return User{ID: id, Active: true, RoleID: 2}, nil
+		},
+	}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	one, five := 1, 5
+	restaurants := TargetCategory{Name: "restaurants", MinScore: &one, MaxScore: &five, CommentRequired: true}
+
+	trdb := &testRatingDB{
+		category: func(target int64) (TargetCategory, error) {
+			if target == 9 {
+				return restaurants, nil
+			}
+			return TargetCategory{}, ErrNotFound
+		},
+		byID: func(id int64) (Rating, error) {
+			return Rating{ID: id, Target: 9, UserID: 1, Score: 4, Comment: "Fine", Extra: json.RawMessage(`{}`)}, nil
+		},
+	}
+	rs := NewRatingService(nil, us)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	var cases = []struct {
+		name   string
+		rating Rating
+		outerr error
+	}{
+		{"ok", Rating{Target: 9, Score: 5, Comment: "Great food"}, nil},
+		{"scoreTooLow", Rating{Target: 9, Score: -1, Comment: "Awful"}, ValidationError{"score": ErrInvalid}},
+		{"scoreTooHigh", Rating{Target: 9, Score: 10, Comment: "Best ever"}, ValidationError{"score": ErrInvalid}},
+		{"commentRequired", Rating{Target: 9, Score: 3, Comment: "  "}, ValidationError{"comment": ErrRequired}},
+		{"both", Rating{Target: 9, Score: 10}, ValidationError{"score": ErrInvalid, "comment": ErrRequired}},
+		{"noCategory", Rating{Target: 8, Score: 10}, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := tc.rating
+			r.User = &User{ID: 1}
+			assert.Equal(t, tc.outerr, rs.Create(&r))
+		})
+	}
+
+	t.Run("update", func(t *testing.T) {
+		r := Rating{ID: 3, Target: 8, Score: 10, Comment: "Target ignored", User: &User{ID: 1}}
+		assert.Equal(t, ValidationError{"score": ErrInvalid}, rs.Update(&r))
+	})
+
+	t.Run("updatePartial", func(t *testing.T) {
+		r := Rating{ID: 3, User: &User{ID: 1}}
+		assert.Equal(t, ValidationError{"comment": ErrRequired}, rs.UpdatePartial(&r, []byte(`{"comment": ""}`)))
+
+		r = Rating{ID: 3, User: &User{ID: 1}}
+		assert.NoError(t, rs.UpdatePartial(&r, []byte(`{"score": 2}`)))
+	})
+
+	t.Run("lookupFails", func(t *testing.T) {
+		trdb.category = func(int64) (TargetCategory, error) {
+			return TargetCategory{}, wrap("connection lost", nil)
+		}
+		defer func() { trdb.category = nil }()
+
+		r := Rating{Target: 9, Score: 5, User: &User{ID: 1}}
+		err := rs.Create(&r)
+		require.Error(t, err)
+		_, ok := err.(ValidationError)
+		assert.False(t, ok, "must not be reported as a validation error")
+	})
+}
+
+func TestTargetCategoryGorm(t *testing.T) {
+	db := setupGorm(t)
+	cs := NewTargetCategoryService(db)
+	rg := &ratingGorm{db: db}
+
+	one, five := 1, 5
+	c := TargetCategory{Name: "restaurants", MinScore: &one, MaxScore: &five, UpdatedBy: 1}
+	require.NoError(t, cs.Set(&c))
+	assert.False(t, c.UpdatedAt.IsZero())
+
+	c.CommentRequired = true
+	require.NoError(t, cs.Set(&c))
+	got, err := cs.ByName("restaurants")
+	require.NoError(t, err)
+	assert.True(t, got.CommentRequired)
+	assert.Equal(t, &five, got.MaxScore)
+
+	list, err := cs.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	_, err = rg.Category(9)
+	assert.Equal(t, ErrNotFound, err)
+
+	t.Run("unknownCategory", func(t *testing.T) {
+		assert.Equal(t, ValidationError{"category": ErrRefNotFound}, rg.SetCategory(9, "drivers"))
+	})
+
+	// the target has no ratings, so no row, yet
+	require.NoError(t, rg.SetCategory(9, "restaurants"))
+	got, err = rg.Category(9)
+	require.NoError(t, err)
+	assert.Equal(t, "restaurants", got.Name)
+	assert.True(t, got.CommentRequired)
+
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1}).Error)
+	scores, err := rg.Scores([]int64{9})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), scores[0].Count, "the category must not change the scores")
+
+	assert.Equal(t, ErrInUse, cs.Remove("restaurants"))
+
+	require.NoError(t, rg.SetCategory(9, ""))
+	_, err = rg.Category(9)
+	assert.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, cs.Remove("restaurants"))
+	_, err = cs.ByName("restaurants")
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+	assert.Equal(t, ErrNotFound, cs.Remove("restaurants"))
+}
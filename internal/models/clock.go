@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// A Clock tells the services the current time. They use the clock of the
+// system, unless another one is set in Config.Clock, which allows freezing the
+// time, like in tests or in demonstrations.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock telling the time of the system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a Clock always telling the same time.
+type FixedClock time.Time
+
+// Now returns c as a time.
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The waits between the attempts to connect to the database, see
+// Config.ConnectTimeout. They double after each attempt, from the first wait
+// up to the longest one.
+const (
+	firstConnectWait   = 500 * time.Millisecond
+	longestConnectWait = 10 * time.Second
+)
+
+// connector opens the connections to the database, retrying until it is
+// ready.
+type connector struct {
+	// open connects to the database, and checks it answers.
+	open func() (*gorm.DB, error)
+
+	// timeout is how long open is retried for, or zero to only try once.
+	timeout time.Duration
+
+	// onRetry, if not nil, is called with the error of each failed attempt
+	// that is retried, along with the wait before the next one.
+	onRetry func(err error, wait time.Duration)
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// newConnector returns the connector of the database of c, opening dsl.
+func newConnector(c *Config, dsl string) *connector {
+	return &connector{
+		open: func() (*gorm.DB, error) {
+			return gorm.Open("postgres", dsl)
+		},
+		timeout: c.ConnectTimeout,
+		onRetry: c.OnConnectRetry,
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+}
+
+// statementTimeoutDSL returns dsl with the statement timeout of its sessions set
+// to d, as lib/pq sends the parameters it does not know of to the database. dsl
+// is either a URL or a list of key/value pairs.
+func statementTimeoutDSL(dsl string, d time.Duration) string {
+	ms := strconv.FormatInt(d.Milliseconds(), 10)
+
+	if strings.HasPrefix(dsl, "postgres://") || strings.HasPrefix(dsl, "postgresql://") {
+		u, err := url.Parse(dsl)
+		if err != nil {
+			// left for the driver to report
+			return dsl
+		}
+
+		q := u.Query()
+		q.Set("statement_timeout", ms)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	return dsl + " statement_timeout=" + ms
+}
+
+// connect opens a connection to the database, retried with an exponential
+// backoff while the database is not ready, like when it starts along with the
+// application. The error of the last attempt is returned once the timeout
+// would be exceeded.
+func (cn *connector) connect() (*gorm.DB, error) {
+	deadline := cn.now().Add(cn.timeout)
+	wait := firstConnectWait
+
+	for {
+		db, err := cn.open()
+		if err == nil {
+			return db, nil
+		}
+
+		if cn.now().Add(wait).After(deadline) {
+			return nil, err
+		}
+
+		if cn.onRetry != nil {
+			cn.onRetry(err, wait)
+		}
+		cn.sleep(wait)
+
+		wait *= 2
+		if wait > longestConnectWait {
+			wait = longestConnectWait
+		}
+	}
+}
+
+// Ping checks the database answers, as it may restart while the services run.
+// The pool of connections replaces the ones the restart closed on its own, once
+// the database is back.
+func (s *Services) Ping(ctx context.Context) error {
+	err := s.db.DB().PingContext(ctx)
+	if err != nil {
+		return wrap("failed to connect to the database", err)
+	}
+
+	return nil
+}
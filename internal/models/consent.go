@@ -0,0 +1,168 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/consent.go -pkg modelstest . ConsentService:ConsentService
+
+// ConsentService defines a set of methods used to track the acceptance of the
+// data processing policy by the users, as required by privacy regulations.
+type ConsentService interface {
+	ConsentDB
+
+	// PolicyVersion returns the version of the policy the users must
+	// accept, or an empty string if none is required.
+	PolicyVersion() string
+
+	// UpToDate tells whether a user accepted the current version of the
+	// policy. It is always true if no policy is required.
+	UpToDate(userID int64) (bool, error)
+}
+
+// ConsentDB defines how the service interacts with the database.
+type ConsentDB interface {
+	// ByUser retrieves the versions of the policy accepted by a user,
+	// sorted by acceptance time.
+	ByUser(userID int64) ([]Consent, error)
+
+	// Accept records the acceptance of a version of the policy. Versions
+	// already accepted keep their original acceptance, which is set in
+	// c.
+	Accept(c *Consent) error
+
+	// Accepted tells whether a user accepted a version of the policy.
+	Accepted(userID int64, version string) (bool, error)
+}
+
+// consentUserAgentSize is the maximum length of Consent.UserAgent.
+const consentUserAgentSize = 512
+
+// A Consent records the acceptance of a version of the data processing policy
+// by a user.
+type Consent struct {
+	UserID        int64  `gorm:"primary_key;type:bigint" json:"userId"`
+	PolicyVersion string `gorm:"primary_key;size:64" json:"policyVersion"`
+
+	AcceptedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"acceptedAt"`
+
+	// IP and UserAgent identify the client the policy was accepted
+	// from, anonymised as configured for the deployment.
+	IP        string `gorm:"size:64;not null" json:"ip,omitempty"`
+	UserAgent string `gorm:"size:512;not null" json:"userAgent,omitempty"`
+}
+
+// TableName is the name of the table holding the consents.
+func (Consent) TableName() string {
+	return "user_consents"
+}
+
+type consentService struct {
+	ConsentDB
+
+	policyVersion string
+}
+
+// NewConsentService instantiates a new ConsentService implementation with db as
+// the backing database. Users must accept policyVersion before submitting
+// ratings, unless it is empty.
+func NewConsentService(db *gorm.DB, policyVersion string) ConsentService {
+	return newConsentService(db, policyVersion, SystemClock)
+}
+
+// newConsentService instantiates a new ConsentService implementation, as
+// NewConsentService does, dating the consents with clock.
+func newConsentService(db *gorm.DB, policyVersion string, clock Clock) ConsentService {
+	return &consentService{
+		ConsentDB: &consentValidator{
+			ConsentDB:     &consentGorm{db: db, clock: clock},
+			policyVersion: policyVersion,
+		},
+		policyVersion: policyVersion,
+	}
+}
+
+func (cs *consentService) PolicyVersion() string {
+	return cs.policyVersion
+}
+
+func (cs *consentService) UpToDate(userID int64) (bool, error) {
+	if cs.policyVersion == "" {
+		return true, nil
+	}
+
+	return cs.Accepted(userID, cs.policyVersion)
+}
+
+type consentValidator struct {
+	ConsentDB
+
+	policyVersion string
+}
+
+func (cv *consentValidator) Accept(c *Consent) error {
+	if c.UserID < 1 {
+		return ValidationError{"userId": ErrRequired}
+	}
+
+	switch {
+	case c.PolicyVersion == "":
+		return ValidationError{"policyVersion": ErrRequired}
+	case cv.policyVersion != "" && c.PolicyVersion != cv.policyVersion:
+		// only the current policy can be accepted
+		return ValidationError{"policyVersion": ErrInvalid}
+	case len(c.PolicyVersion) > 64:
+		return ValidationError{"policyVersion": ErrTooLong}
+	}
+
+	if len(c.UserAgent) > consentUserAgentSize {
+		c.UserAgent = c.UserAgent[:consentUserAgentSize]
+	}
+
+	return cv.ConsentDB.Accept(c)
+}
+
+type consentGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (cg *consentGorm) ByUser(userID int64) ([]Consent, error) {
+	consents := []Consent{}
+	err := cg.db.Where("user_id = ?", userID).Order("accepted_at, policy_version").Find(&consents).Error
+	if err != nil {
+		return nil, with(wrap("could not list consents", err), "user_id", userID)
+	}
+
+	return consents, nil
+}
+
+func (cg *consentGorm) Accept(c *Consent) error {
+	c.AcceptedAt = cg.clock.Now()
+	err := cg.db.Exec(`INSERT INTO user_consents (user_id, policy_version, accepted_at, ip, user_agent) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, policy_version) DO NOTHING`,
+		c.UserID, c.PolicyVersion, c.AcceptedAt, c.IP, c.UserAgent).Error
+	if err != nil {
+		return with(wrap("could not save consent", err), "user_id", c.UserID)
+	}
+
+	// the policy may have been accepted before
+	err = cg.db.Where("user_id = ? AND policy_version = ?", c.UserID, c.PolicyVersion).First(c).Error
+	if err != nil {
+		return with(wrap("could not get consent", err), "user_id", c.UserID)
+	}
+
+	return nil
+}
+
+func (cg *consentGorm) Accepted(userID int64, version string) (bool, error) {
+	var ct int64
+	err := cg.db.Model(&Consent{}).Where("user_id = ? AND policy_version = ?", userID, version).Count(&ct).Error
+	if err != nil {
+		return false, with(wrap("could not look up consent", err), "user_id", userID)
+	}
+
+	return ct > 0, nil
+}
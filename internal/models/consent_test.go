@@ -0,0 +1,112 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConsentDB struct {
+	ConsentDB
+	accepted []Consent
+}
+
+func (t *testConsentDB) Accept(c *Consent) error {
+	t.accepted = append(t.accepted, *c)
+	return nil
+}
+
+func (t *testConsentDB) Accepted(userID int64, version string) (bool, error) {
+	for _, c := range t.accepted {
+		if c.UserID == userID && c.PolicyVersion == version {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func TestConsentValidator(t *testing.T) {
+	var cases = []struct {
+		name    string
+		current string
+		c       Consent
+		err     error
+	}{
+		{"valid", "2020-01", Consent{UserID: 1, PolicyVersion: "2020-01"}, nil},
+		{"anyVersionWithoutPolicy", "", Consent{UserID: 1, PolicyVersion: "2019-06"}, nil},
+		{"noUser", "2020-01", Consent{PolicyVersion: "2020-01"}, ValidationError{"userId": ErrRequired}},
+		{"noVersion", "2020-01", Consent{UserID: 1}, ValidationError{"policyVersion": ErrRequired}},
+		{"outdatedVersion", "2020-01", Consent{UserID: 1, PolicyVersion: "2019-06"}, ValidationError{"policyVersion": ErrInvalid}},
+		{"longVersion", "", Consent{UserID: 1, PolicyVersion: strings.Repeat("v", 65)}, ValidationError{"policyVersion": ErrTooLong}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			cv := &consentValidator{ConsentDB: &testConsentDB{}, policyVersion: cs.current}
+			assert.Equal(t, cs.err, cv.Accept(&cs.c))
+		})
+	}
+
+	cv := &consentValidator{ConsentDB: &testConsentDB{}}
+	c := Consent{UserID: 1, PolicyVersion: "2020-01", UserAgent: strings.Repeat("a", 600)}
+	require.NoError(t, cv.Accept(&c))
+	assert.Len(t, c.UserAgent, consentUserAgentSize, "must truncate long user agents")
+}
+
+func TestConsentService_UpToDate(t *testing.T) {
+	db := &testConsentDB{}
+
+	none := &consentService{ConsentDB: db}
+	ok, err := none.UpToDate(1)
+	require.NoError(t, err)
+	assert.True(t, ok, "must not require consent without a policy")
+
+	cs := &consentService{ConsentDB: db, policyVersion: "2020-01"}
+	ok, err = cs.UpToDate(1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	db.accepted = append(db.accepted, Consent{UserID: 1, PolicyVersion: "2019-06"})
+	ok, err = cs.UpToDate(1)
+	require.NoError(t, err)
+	assert.False(t, ok, "must require the current version")
+
+	db.accepted = append(db.accepted, Consent{UserID: 1, PolicyVersion: "2020-01"})
+	ok, err = cs.UpToDate(1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestConsentGorm(t *testing.T) {
+	db := setupGorm(t)
+	cs := NewConsentService(db, "2020-01")
+
+	ok, err := cs.UpToDate(1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	c := Consent{UserID: 1, PolicyVersion: "2020-01", IP: "203.0.113.0", UserAgent: "curl/7"}
+	require.NoError(t, cs.Accept(&c))
+	assert.False(t, c.AcceptedAt.IsZero())
+
+	again := Consent{UserID: 1, PolicyVersion: "2020-01", IP: "198.51.100.0"}
+	require.NoError(t, cs.Accept(&again))
+	assert.True(t, c.AcceptedAt.Equal(again.AcceptedAt), "must keep the first acceptance")
+	assert.Equal(t, "203.0.113.0", again.IP)
+
+	ok, err = cs.UpToDate(1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	list, err := cs.ByUser(1)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "2020-01", list[0].PolicyVersion)
+
+	list, err = cs.ByUser(2)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
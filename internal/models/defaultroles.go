@@ -0,0 +1,69 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A DefaultRole is a role created when the services start, if no role has its
+// label yet, besides the admin and user roles. See Config.DefaultRoles.
+type DefaultRole struct {
+	Label       string      `json:"label"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// ParseDefaultRoles decodes the default roles defined in b, a JSON array of
+// DefaultRole values. Their labels are normalised as the labels of the roles
+// created with RoleService, and checked to be valid and unique.
+func ParseDefaultRoles(b []byte) ([]DefaultRole, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+
+	var roles []DefaultRole
+	err := d.Decode(&roles)
+	if err != nil {
+		return nil, wrap("could not decode default roles", err)
+	}
+
+	labels := make(map[string]bool, len(roles))
+	for i := range roles {
+		r := &roles[i]
+		r.Label = strings.Join(strings.Fields(strings.ToLower(r.Label)), " ")
+
+		switch {
+		case len(r.Label) < 4 || len(r.Label) > 255:
+			err = wrap("label must have from 4 to 255 characters", nil)
+		case r.Label == "admin" || r.Label == "user":
+			err = wrap("the "+r.Label+" role is always created", nil)
+		case labels[r.Label]:
+			err = wrap("duplicate label "+strconv.Quote(r.Label), nil)
+		}
+		if err != nil {
+			return nil, wrap("invalid default role "+strconv.Itoa(i), err)
+		}
+		labels[r.Label] = true
+	}
+
+	return roles, nil
+}
+
+// createConfiguredRoles adds roles to db as shared roles, unless a shared role
+// already has their label, so the roles edited since they were created are left
+// as they are. It returns the number of roles created.
+func createConfiguredRoles(db *gorm.DB, roles []DefaultRole) (int64, error) {
+	var created int64
+	for _, r := range roles {
+		res := db.Exec("INSERT INTO roles (label, permissions, version) VALUES (?, ?, 1) ON CONFLICT ((COALESCE(org_id, 0)), label) DO NOTHING",
+			r.Label, r.Permissions)
+		if res.Error != nil {
+			return created, with(wrapi("failed to create default role", res.Error), "label", r.Label)
+		}
+		created += res.RowsAffected
+	}
+
+	return created, nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDefaultRoles(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		roles, err := ParseDefaultRoles([]byte(`[
+			{"label": " Support  Team ", "permissions": ["readUsers", "readRatings"]},
+			{"label": "moderator", "permissions": []}
+		]`))
+		require.NoError(t, err)
+		assert.Equal(t, []DefaultRole{
+			{Label: "support team", Permissions: PermissionReadUsers | PermissionReadRatings},
+			{Label: "moderator"},
+		}, roles)
+	})
+
+	var cases = []struct {
+		name string
+		in   string
+	}{
+		{"badJSON", `{"label": "moderator"}`},
+		{"unknownField", `[{"label": "moderator", "id": 3}]`},
+		{"unknownPermission", `[{"label": "moderator", "permissions": ["deleteEverything"]}]`},
+		{"labelTooShort", `[{"label": " mod "}]`},
+		{"admin", `[{"label": "Admin"}]`},
+		{"user", `[{"label": "user"}]`},
+		{"duplicate", `[{"label": "moderator"}, {"label": "MODERATOR"}]`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			_, err := ParseDefaultRoles([]byte(cs.in))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCreateConfiguredRoles(t *testing.T) {
+	db := setupGorm(t)
+	roles := []DefaultRole{
+		{Label: "moderator", Permissions: PermissionReadRatings | PermissionWriteRatings},
+		{Label: "auditor", Permissions: PermissionReadUsers},
+	}
+
+	created, err := createConfiguredRoles(db, roles)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), created)
+
+	var moderator Role
+	require.NoError(t, db.Where("label = ?", "moderator").First(&moderator).Error)
+	assert.Equal(t, PermissionReadRatings|PermissionWriteRatings, moderator.Permissions)
+	assert.True(t, moderator.ID > 2)
+
+	// edited by an administrator since
+	require.NoError(t, db.Model(&moderator).Update("permissions", PermissionReadRatings).Error)
+	require.NoError(t, db.Where("label = ?", "auditor").Delete(&Role{}).Error)
+
+	created, err = createConfiguredRoles(db, roles)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), created, "must only create the missing roles")
+
+	require.NoError(t, db.First(&moderator, moderator.ID).Error)
+	assert.Equal(t, PermissionReadRatings, moderator.Permissions, "must not overwrite the roles edited")
+
+	var count int
+	require.NoError(t, db.Model(&Role{}).Count(&count).Error)
+	assert.Equal(t, 4, count)
+}
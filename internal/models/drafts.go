@@ -0,0 +1,207 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+// draftColumns are the columns of the drafts, read into Rating.
+const draftColumns = "id, user_id, target, score, active, anonymous, comment, extra, campaign_id, date, created_at"
+
+func (rv *ratingValidator) CreateDraft(rating *Rating) error {
+	rc := ratingValWithDBData{rv: rv, us: rv.userService}
+	err := rv.runValFuncs(rating,
+		rv.idSetToZero,
+		rv.userSessionExists,
+		rv.userSessionInvalid,
+		rv.commentLength,
+		rv.extraLength,
+		rv.draftTargetInvalid,
+		rc.fetchUser,
+		rc.setSessionUserAsUserID,
+		rv.setDate,
+	)
+	if err != nil {
+		return err
+	}
+
+	rating.User = nil
+	rating.Draft = true
+	return rv.RatingDB.CreateDraft(rating)
+}
+
+func (rv *ratingValidator) Drafts(userID int64) ([]Rating, error) {
+	if userID < 1 {
+		return nil, ValidationError{"userId": ErrInvalid}
+	}
+
+	return rv.RatingDB.Drafts(userID)
+}
+
+func (rv *ratingValidator) DraftByID(id int64) (Rating, error) {
+	if id < 1 {
+		return Rating{}, ErrNotFound
+	}
+
+	return rv.RatingDB.DraftByID(id)
+}
+
+func (rv *ratingValidator) DeleteDraft(rating *Rating) error {
+	_, err := rv.ownDraft(rating)
+	if err != nil {
+		return err
+	}
+
+	return rv.RatingDB.DeleteDraft(rating)
+}
+
+func (rv *ratingValidator) PublishDraft(rating *Rating, patch []byte) error {
+	draft, err := rv.ownDraft(rating)
+	if err != nil {
+		return err
+	}
+
+	pr := draft
+	if len(patch) > 0 {
+		pr = Rating{}
+		err = applyMergePatch(&draft, patch, &pr)
+		if err != nil {
+			return err
+		}
+	}
+	if len(pr.Extra) == 0 {
+		pr.Extra = json.RawMessage(`{}`)
+	}
+
+	draftID := rating.ID
+	pr.User = rating.User
+	*rating = pr
+
+	err = rv.validateCreate(rating)
+	if err != nil {
+		return err
+	}
+
+	rating.User = nil
+	return rv.RatingDB.Publish(rating, draftID)
+}
+
+// ownDraft retrieves the draft with ID rating.ID, which must be of the session
+// user. The drafts of the other users are not found, even by the moderators.
+func (rv *ratingValidator) ownDraft(rating *Rating) (Rating, error) {
+	err := rv.runValFuncs(rating,
+		rv.userSessionExists,
+		rv.userSessionInvalid,
+	)
+	if err != nil {
+		return Rating{}, err
+	}
+
+	draft, err := rv.DraftByID(rating.ID)
+	if err != nil {
+		return Rating{}, err
+	} else if draft.UserID != rating.User.ID {
+		return Rating{}, ErrNotFound
+	}
+
+	return draft, nil
+}
+
+// draftTargetInvalid returns an error if the target of a draft is set but less
+// than 1. It may return ErrInvalid.
+func (rv *ratingValidator) draftTargetInvalid() (string, ratingValFn) {
+	return "target", func(r *Rating) error {
+		if r.Target < 0 {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
+func (rg *ratingGorm) CreateDraft(r *Rating) error {
+	var created time.Time
+	err := rg.db.Raw(`INSERT INTO rating_drafts (user_id, target, score, active, anonymous, comment, extra, campaign_id, date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at`,
+		r.UserID, r.Target, r.Score, r.Active, r.Anonymous, r.Comment, []byte(r.Extra), r.CampaignID, r.Date).
+		Row().
+		Scan(&r.ID, &created)
+	if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "foreign_key_violation" {
+		if perr.Constraint == "rating_drafts_campaign_id_fkey" {
+			return ValidationError{"campaignId": ErrRefNotFound}
+		}
+		return ValidationError{"userId": ErrRefNotFound}
+	} else if err != nil {
+		return with(wrap("could not create draft", err), "user_id", r.UserID)
+	}
+
+	r.CreatedAt = &created
+	return nil
+}
+
+func (rg *ratingGorm) Drafts(userID int64) ([]Rating, error) {
+	drafts := []Rating{}
+	err := rg.db.Table("rating_drafts").
+		Select(draftColumns).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Scan(&drafts).
+		Error
+	if err != nil {
+		return nil, with(wrap("could not list drafts", err), "user_id", userID)
+	}
+
+	for i := range drafts {
+		drafts[i].Draft = true
+	}
+
+	return drafts, nil
+}
+
+func (rg *ratingGorm) DraftByID(id int64) (Rating, error) {
+	var draft Rating
+	err := rg.db.Table("rating_drafts").Select(draftColumns).Where("id = ?", id).Scan(&draft).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Rating{}, ErrNotFound
+	} else if err != nil {
+		return Rating{}, with(wrap("could not get draft by ID", err), "draft_id", id)
+	}
+
+	draft.Draft = true
+	return draft, nil
+}
+
+func (rg *ratingGorm) DeleteDraft(r *Rating) error {
+	res := rg.db.Exec("DELETE FROM rating_drafts WHERE id = ?", r.ID)
+	if res.Error != nil {
+		return with(wrap("could not delete draft", res.Error), "draft_id", r.ID)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Publish creates r, held back from the aggregates as by Create, and deletes the
+// draft in the same transaction.
+func (rg *ratingGorm) Publish(r *Rating, draftID int64) error {
+	err := gormTransaction(rg.db, func(tx *gorm.DB) error {
+		res := tx.Exec("DELETE FROM rating_drafts WHERE id = ? AND user_id = ?", draftID, r.UserID)
+		if res.Error != nil {
+			return with(wrap("could not delete published draft", res.Error), "draft_id", draftID)
+		} else if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return rg.insert(tx, r)
+	})
+	if err != nil {
+		return err
+	}
+
+	rg.outbox.added(rg.db)
+	return nil
+}
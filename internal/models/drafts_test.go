@@ -0,0 +1,203 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func (t *testRatingDB) CreateDraft(mr *Rating) error {
+	if t.createDraft != nil {
+		return t.createDraft(mr)
+	}
+
+	return nil
+}
+
+func (t *testRatingDB) DraftByID(id int64) (Rating, error) {
+	if t.draftByID != nil {
+		return t.draftByID(id)
+	}
+
+	return Rating{}, ErrNotFound
+}
+
+func (t *testRatingDB) Publish(mr *Rating, draftID int64) error {
+	if t.publish != nil {
+		return t.publish(mr, draftID)
+	}
+
+	return nil
+}
+
+func TestRatingService_CreateDraft(t *testing.T) {
+	tudb := &testUserDB{
+		byID: func(id int64) (User, error) {
+			return User{ID: id, Active: true, RoleID: 2}, nil
+		},
+	}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	trdb := &testRatingDB{}
+	rs := NewRatingService(nil, us)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	var cases = []struct {
+		name   string
+		rating Rating
+		outerr error
+	}{
+		{"empty", Rating{Extra: json.RawMessage(`{}`)}, nil},
+		{"targetOnly", Rating{Target: 9, Extra: json.RawMessage(`{}`)}, nil},
+		{"targetInvalid", Rating{Target: -1, Extra: json.RawMessage(`{}`)}, ValidationError{"target": ErrInvalid}},
+		{"commentTooLong", Rating{Comment: strings.Repeat("a", 513), Extra: json.RawMessage(`{}`)}, ValidationError{"comment": ErrTooLong}},
+		{"idIgnored", Rating{ID: 3, Extra: json.RawMessage(`{}`)}, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var created *Rating
+			trdb.createDraft = func(mr *Rating) error {
+				created = mr
+				return nil
+			}
+
+			r := tc.rating
+			r.User = &User{ID: 1}
+			err := rs.CreateDraft(&r)
+			assert.Equal(t, tc.outerr, err)
+			if tc.outerr == nil && assert.NotNil(t, created) {
+				assert.Equal(t, int64(0), created.ID)
+				assert.Equal(t, int64(1), created.UserID)
+				assert.True(t, created.Draft)
+				assert.NotZero(t, created.Date)
+			} else {
+				assert.Nil(t, created)
+			}
+		})
+	}
+
+	t.Run("userRequired", func(t *testing.T) {
+		assert.True(t, xerrors.Is(rs.CreateDraft(&Rating{}), ErrRequired))
+	})
+}
+
+func TestRatingService_PublishDraft(t *testing.T) {
+	tudb := &testUserDB{
+		byID: func(id int64) (User, error) {
+			return User{ID: id, Active: true, RoleID: 2}, nil
+		},
+	}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	trdb := &testRatingDB{
+		draftByID: func(id int64) (Rating, error) {
+			switch id {
+			case 4:
+				return Rating{ID: 4, UserID: 1, Target: 9, Active: true, Comment: "Nice", Extra: json.RawMessage(`{}`), Date: 1, Draft: true}, nil
+			case 5:
+				return Rating{ID: 5, UserID: 2, Target: 9, Score: 3, Active: true, Extra: json.RawMessage(`{}`), Date: 1, Draft: true}, nil
+			}
+			return Rating{}, ErrNotFound
+		},
+	}
+	rs := NewRatingService(nil, us)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	t.Run("notFound", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, rs.PublishDraft(&Rating{ID: 6, User: &User{ID: 1}}, nil))
+		assert.Equal(t, ErrNotFound, rs.PublishDraft(&Rating{ID: 0, User: &User{ID: 1}}, nil))
+	})
+
+	t.Run("notOwner", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, rs.PublishDraft(&Rating{ID: 5, User: &User{ID: 1}}, nil))
+		assert.Equal(t, ErrNotFound, rs.DeleteDraft(&Rating{ID: 5, User: &User{ID: 1}}))
+	})
+
+	t.Run("incomplete", func(t *testing.T) {
+		trdb.publish = func(*Rating, int64) error {
+			t.Error("must not publish an incomplete draft")
+			return nil
+		}
+		defer func() { trdb.publish = nil }()
+
+		err := rs.PublishDraft(&Rating{ID: 4, User: &User{ID: 1}}, nil)
+		assert.Equal(t, ValidationError{"score": ErrRequired}, err)
+	})
+
+	t.Run("patched", func(t *testing.T) {
+		var draftID int64
+		trdb.publish = func(mr *Rating, id int64) error {
+			draftID = id
+			mr.ID = 12
+			return nil
+		}
+		defer func() { trdb.publish = nil }()
+
+		r := Rating{ID: 4, User: &User{ID: 1}}
+		require.NoError(t, rs.PublishDraft(&r, []byte(`{"score": 4}`)))
+		assert.Equal(t, int64(4), draftID)
+		assert.NotEqual(t, int64(1), r.Date, "must be dated when published")
+		r.Date = 0
+		assert.Equal(t, Rating{ID: 12, UserID: 1, Target: 9, Score: 4, Active: true, Comment: "Nice", Extra: json.RawMessage(`{}`)}, r)
+	})
+
+	t.Run("badPatch", func(t *testing.T) {
+		err := rs.PublishDraft(&Rating{ID: 4, User: &User{ID: 1}}, []byte(`{"score": "four"}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestRatingGORM_Drafts(t *testing.T) {
+	db := setupGorm(t)
+	rg := &ratingGorm{db: db}
+
+	draft := Rating{UserID: 1, Target: 9, Active: true, Comment: "To be continued", Extra: json.RawMessage(`{}`), Date: 1}
+	require.NoError(t, rg.CreateDraft(&draft))
+	assert.NotZero(t, draft.ID)
+	assert.NotNil(t, draft.CreatedAt)
+
+	other := Rating{UserID: 2, Active: true, Extra: json.RawMessage(`{}`), Date: 1}
+	require.NoError(t, rg.CreateDraft(&other))
+
+	t.Run("unknownUser", func(t *testing.T) {
+		r := Rating{UserID: 999, Active: true, Extra: json.RawMessage(`{}`), Date: 1}
+		assert.Equal(t, ValidationError{"userId": ErrRefNotFound}, rg.CreateDraft(&r))
+	})
+
+	drafts, err := rg.Drafts(1)
+	require.NoError(t, err)
+	require.Len(t, drafts, 1)
+	assert.Equal(t, draft.ID, drafts[0].ID)
+	assert.True(t, drafts[0].Draft)
+
+	ratings, err := rg.ByTarget(9)
+	require.NoError(t, err)
+	assert.Empty(t, ratings, "the drafts must not be listed with the ratings")
+
+	stats, err := rg.StatsByTarget(9)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Count, "the drafts must not be counted in the stats")
+
+	r := draft
+	r.ID, r.Score = 0, 4
+	require.NoError(t, rg.Publish(&r, draft.ID))
+	assert.NotZero(t, r.ID)
+
+	_, err = rg.DraftByID(draft.ID)
+	assert.Equal(t, ErrNotFound, err, "the draft must be removed once published")
+	assert.Equal(t, ErrNotFound, rg.Publish(&Rating{UserID: 1, Target: 8, Score: 4, Extra: json.RawMessage(`{}`)}, draft.ID))
+
+	ratings, err = rg.ByTarget(9)
+	require.NoError(t, err)
+	assert.Len(t, ratings, 1)
+
+	require.NoError(t, rg.DeleteDraft(&other))
+	assert.Equal(t, ErrNotFound, rg.DeleteDraft(&other))
+}
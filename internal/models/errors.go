@@ -1,12 +1,17 @@
 package models
 
 import (
+	"context"
+
+	"github.com/lib/pq"
 	"github.com/noelruault/ratingsapp/internal/errors"
+	"golang.org/x/xerrors"
 )
 
 var (
 	wrap  = errors.Wrapper("models")
 	wrapi = errors.WrapInternal
+	with  = errors.With
 )
 
 // These errors are returned by the services and can be used to provide error codes to the
@@ -17,6 +22,7 @@ const (
 	ErrFieldReadOnly ModelError = "models: field_read_only, field cannot be modified"
 	ErrInUse         ModelError = "models: in_use, resource cannot be deleted because other resources depend on it"
 	ErrUnauthorised  ModelError = "models: unauthorised, username, password or refresh token are invalid, user does not exist or validation failed"
+	ErrConflict      ModelError = "models: conflict, resource was modified since the version provided"
 
 	ErrIDTaken     ModelError = "models: id_taken, primary key already exists"
 	ErrTooShort    ModelError = "models: too_short, value is shorter than required"
@@ -28,12 +34,54 @@ const (
 
 	ErrNoCredentials     ModelError   = "models: credentials_not_provided, username, password or refresh token are empty"
 	ErrJWTSecretTooShort privateError = "models: JWTSecret value must have at least 32 bytes"
+	ErrSchemaOutdated    privateError = "models: database schema is outdated, migrations must be applied"
+
+	ErrAdminPasswordNotChanged privateError = "models: the admin password must be changed, it was created too long ago"
 	ErrRefreshInvalid    ModelError   = "models: invalid_refresh_token, refresh token is not valid"
 	ErrRefreshExpired    ModelError   = "models: expired_refresh_token, refresh token has expired"
+	ErrSessionsDisabled  ModelError   = "models: sessions_disabled, sessions are not tracked"
+
+	ErrUnknownClient ModelError = "models: unknown_client, the client is not allowed to use the redirect URI"
+	ErrInvalidGrant  ModelError = "models: invalid_grant, the authorization code is invalid, expired or was issued to another client"
+
+	ErrIdentityNotLinked ModelError = "models: identity_not_linked, a user has the email address of the identity, and must link it once signed in"
+
+	ErrInvalidInvitation ModelError = "models: invalid_invitation, the invitation is invalid, expired, was accepted or was revoked"
+
+	ErrCannotImpersonate ModelError = "models: cannot_impersonate, the user cannot be impersonated"
 
 	ErrPasswordIncorrect ModelError = "models: incorrect_password, incorrect password provided"
+	ErrOwnRating         ModelError = "models: own_rating, users cannot react to their own ratings"
+
+	ErrCampaignClosed ModelError = "models: campaign_closed, the campaign does not accept ratings at this time"
+	ErrNotEligible    ModelError = "models: not_eligible, the role of the user cannot take part in the campaign"
+	ErrRatingClosed   ModelError = "models: rating_closed, the target does not accept ratings at this time"
+
+	ErrRateLimited ModelError = "models: rate_limited, the user created too many ratings recently"
+
+	ErrPolicyDenied ModelError = "models: policy_denied, a policy does not allow the operation"
+
+	ErrTenantStatus      ModelError = "models: invalid_tenant_status, the tenant cannot be changed in its current status"
+	ErrTenantUnavailable ModelError = "models: tenant_unavailable, the tenant is not active"
+	ErrQuotaExceeded     ModelError = "models: quota_exceeded, the tenant used all the resources it is allowed"
+
+	ErrBillingDisabled ModelError = "models: billing_disabled, no billing provider is configured"
+
+	ErrTimeout ModelError = "models: timeout, the request took too long to complete"
 )
 
+// IsTimeout reports whether err was caused by a deadline, either the one of a
+// context or the statement timeout of the database, see Config.StatementTimeout.
+// The requests failing with such an error are answered with ErrTimeout.
+func IsTimeout(err error) bool {
+	if xerrors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	perr := (*pq.Error)(nil)
+	return xerrors.As(err, &perr) && perr.Code.Name() == "query_canceled"
+}
+
 // PublicError is an error that returns a string code that can be presented to the API user.
 type PublicError interface {
 	error
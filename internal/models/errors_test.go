@@ -1,8 +1,11 @@
 package models
 
 import (
+	"context"
 	"testing"
 
+	"github.com/lib/pq"
+
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/xerrors"
 )
@@ -164,3 +167,12 @@ func TestValidationError_Is(t *testing.T) {
 		})
 	}
 }
+
+func TestIsTimeout(t *testing.T) {
+	assert.True(t, IsTimeout(context.DeadlineExceeded))
+	assert.True(t, IsTimeout(wrap("could not list ratings", context.DeadlineExceeded)))
+	assert.True(t, IsTimeout(wrap("could not list ratings", &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"})))
+	assert.False(t, IsTimeout(context.Canceled))
+	assert.False(t, IsTimeout(&pq.Error{Code: "23505"}))
+	assert.False(t, IsTimeout(ErrNotFound))
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"github.com/noelruault/ratingsapp/internal/events"
+)
+
+// publisher publishes events, like an events.Bus. The services in a transaction
+// publish to a txChanges instead, until it is committed.
+type publisher interface {
+	Publish(events.Event)
+}
+
+// reputationEvents is a ReputationService decorator that publishes the reactions
+// recorded and removed to the event bus, see events.ReactionChanged.
+type reputationEvents struct {
+	ReputationService
+	bus publisher
+}
+
+func newReputationEvents(rs ReputationService, bus publisher) ReputationService {
+	return &reputationEvents{ReputationService: rs, bus: bus}
+}
+
+func (re *reputationEvents) React(x *Reaction) error {
+	err := re.ReputationService.React(x)
+	if err != nil {
+		return err
+	}
+
+	re.bus.Publish(events.Event{Type: events.ReactionChanged, Data: *x})
+	return nil
+}
+
+func (re *reputationEvents) Unreact(ratingID, userID int64) error {
+	err := re.ReputationService.Unreact(ratingID, userID)
+	if err != nil {
+		return err
+	}
+
+	re.bus.Publish(events.Event{Type: events.ReactionChanged, Data: Reaction{RatingID: ratingID, UserID: userID}})
+	return nil
+}
+
+// replyEvents is a ReplyService decorator that publishes the replies created to
+// the event bus, see events.ReplyCreated.
+type replyEvents struct {
+	ReplyService
+	bus publisher
+}
+
+func newReplyEvents(ps ReplyService, bus publisher) ReplyService {
+	return &replyEvents{ReplyService: ps, bus: bus}
+}
+
+func (re *replyEvents) Create(r *Reply) error {
+	err := re.ReplyService.Create(r)
+	if err != nil {
+		return err
+	}
+
+	re.bus.Publish(events.Event{Type: events.ReplyCreated, Data: *r})
+	return nil
+}
+
+// userEvents is a UserService decorator that publishes the users updated to
+// the event bus, see events.UserUpdated. The events hold a copy of the User
+// without its password.
+type userEvents struct {
+	UserService
+	bus publisher
+}
+
+func newUserEvents(us UserService, bus publisher) UserService {
+	return &userEvents{UserService: us, bus: bus}
+}
+
+func (ue *userEvents) Update(u *User) error {
+	err := ue.UserService.Update(u)
+	if err != nil {
+		return err
+	}
+
+	ue.publish(*u)
+	return nil
+}
+
+func (ue *userEvents) UpdatePartial(u *User, patch []byte) error {
+	err := ue.UserService.UpdatePartial(u, patch)
+	if err != nil {
+		return err
+	}
+
+	ue.publish(*u)
+	return nil
+}
+
+func (ue *userEvents) Deactivate(id int64) error {
+	err := ue.UserService.Deactivate(id)
+	if err != nil {
+		return err
+	}
+
+	ue.publishByID(id)
+	return nil
+}
+
+func (ue *userEvents) Activate(id int64) error {
+	err := ue.UserService.Activate(id)
+	if err != nil {
+		return err
+	}
+
+	ue.publishByID(id)
+	return nil
+}
+
+// DeleteWith publishes the user who keeps the ratings of the user deleted, if
+// any, so their cards are refreshed.
+func (ue *userEvents) DeleteWith(id int64, d UserDeletion) error {
+	err := ue.UserService.DeleteWith(id, d)
+	if err != nil {
+		return err
+	}
+
+	switch d.Ratings {
+	case RatingsAnonymise:
+		ue.publishByID(id)
+	case RatingsReassign:
+		ue.publishByID(d.ReassignTo)
+	}
+	return nil
+}
+
+// publishByID publishes the user with the given ID, if it can be read.
+func (ue *userEvents) publishByID(id int64) {
+	u, err := ue.UserService.ByID(id)
+	if err != nil {
+		return
+	}
+
+	ue.publish(u)
+}
+
+func (ue *userEvents) publish(u User) {
+	u.Password = ""
+	ue.bus.Publish(events.Event{Type: events.UserUpdated, Data: u})
+}
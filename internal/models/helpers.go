@@ -1,7 +1,12 @@
 package models
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 )
@@ -96,6 +101,105 @@ func runValidationFunctions(value interface{}, fns interface{}) error {
 	return nil
 }
 
+// patchFields returns the names of the top-level members of patch, a JSON Merge Patch document as
+// defined by RFC 7396. Partial updates use them to know which fields must be validated. It returns
+// ErrInvalid if patch is not a JSON object.
+func patchFields(patch []byte) (map[string]bool, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return nil, ErrInvalid
+	}
+
+	fields := make(map[string]bool, len(members))
+	for k := range members {
+		fields[k] = true
+	}
+
+	return fields, nil
+}
+
+// applyMergePatch applies patch, a JSON Merge Patch document as defined by RFC 7396, to the JSON
+// encoding of current and decodes the result into dst. Members of patch replace the ones of current,
+// null members remove them, leaving the zero value in dst, and object members are merged recursively.
+//
+// Fields that are not encoded to JSON, like IDs and versions, are left untouched in dst and must be set
+// by the caller. It returns ErrInvalid if patch is not a JSON object or cannot be decoded into dst.
+func applyMergePatch(current interface{}, patch []byte, dst interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return wrap("could not encode the value to patch", err)
+	}
+
+	var dm, pm map[string]interface{}
+	if err := decodeJSONNumbers(doc, &dm); err != nil {
+		return wrap("could not decode the value to patch", err)
+	}
+
+	if err := decodeJSONNumbers(patch, &pm); err != nil || pm == nil {
+		return ErrInvalid
+	}
+
+	merged, err := json.Marshal(mergePatchObject(dm, pm))
+	if err != nil {
+		return wrap("could not encode the patched value", err)
+	}
+
+	if err := json.Unmarshal(merged, dst); err != nil {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+// mergePatchObject merges the patch object into doc following the rules of RFC 7396. doc may be
+// modified and is returned.
+func mergePatchObject(doc, patch map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(doc, k)
+		case map[string]interface{}:
+			dv, _ := doc[k].(map[string]interface{})
+			doc[k] = mergePatchObject(dv, pv)
+		default:
+			doc[k] = v
+		}
+	}
+
+	return doc
+}
+
+// decodeJSONNumbers decodes b into dst keeping numbers as json.Number, so big integers such as IDs do
+// not lose precision when going through an interface{} value.
+func decodeJSONNumbers(b []byte, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(dst)
+}
+
+// sameJSON reports whether a and b encode the same JSON value, regardless of their spacing and of
+// the order of their object members, which the database does not keep. Empty values are the same
+// as empty objects.
+func sameJSON(a, b []byte) bool {
+	var av, bv interface{} = map[string]interface{}{}, map[string]interface{}{}
+	if len(a) > 0 && decodeJSONNumbers(a, &av) != nil {
+		return false
+	}
+	if len(b) > 0 && decodeJSONNumbers(b, &bv) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(av, bv)
+}
+
+// likeEscaper escapes the wildcard characters of a text used in a LIKE expression, so it is matched
+// literally. It relies on backslash being the default escape character in PostgreSQL.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 // gormToMap helps us get around the issue where stupid GORM is unable to simply and only run
 // an UPDATE for all fields of an object regardless of their value. We instead need to pass a
 // map to db.Updates(...) to have all fields updated.
@@ -110,9 +214,79 @@ func gormToMap(db *gorm.DB, obj interface{}) map[string]interface{} {
 	return ret
 }
 
+// gormVersionedUpdates updates the row pointed by model with all the field values of obj, increasing
+// the row's version column by one. When version is not zero, the row is only updated if its current
+// version is equal to it, otherwise ErrConflict is returned. ErrNotFound is returned if the row does
+// not exist. Other errors are returned as they come from the database.
+//
+// The rows with CreatedAt and UpdatedAt fields keep their creation time, and their update time is set
+// by the update. Both are read back into obj. The organisation of the rows with an OrgID field is
+// never changed, see Organisation.
+//
+// On success, the new version of the row is returned. It must be called within a transaction so the
+// version read back belongs to this update.
+func gormVersionedUpdates(tx *gorm.DB, model, obj interface{}, version int64) (int64, error) {
+	values := gormToMap(tx, obj)
+	values["version"] = gorm.Expr("version + 1")
+	delete(values, "created_at")
+	delete(values, "updated_at")
+	delete(values, "org_id")
+
+	qb := tx.Model(model)
+	if version != 0 {
+		qb = qb.Where("version = ?", version)
+	}
+
+	res := qb.Updates(values)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		var ct int64
+		if err := tx.Model(model).Count(&ct).Error; err != nil {
+			return 0, err
+		}
+
+		if ct == 0 {
+			return 0, ErrNotFound
+		}
+
+		return 0, ErrConflict
+	}
+
+	var versions []int64
+	if err := tx.Model(model).Pluck("version", &versions).Error; err != nil {
+		return 0, err
+	} else if len(versions) != 1 {
+		return 0, ErrNotFound
+	}
+
+	scope := tx.NewScope(obj)
+	if _, ok := scope.FieldByName("UpdatedAt"); ok {
+		var createdAt, updatedAt time.Time
+		err := tx.Model(model).Select("created_at, updated_at").Row().Scan(&createdAt, &updatedAt)
+		if err != nil {
+			return 0, err
+		}
+
+		scope.SetColumn("CreatedAt", createdAt)
+		scope.SetColumn("UpdatedAt", updatedAt)
+	}
+
+	return versions[0], nil
+}
+
 // gormTransaction wraps the given function in a transaction. In case the given
 // functions returns an error, the transaction will be rolled back.
+//
+// If db is already a transaction, the function is wrapped in a savepoint
+// instead, and only its own changes are rolled back.
 func gormTransaction(db *gorm.DB, f func(tx *gorm.DB) error) error {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return gormSavepoint(db, f)
+	}
+
 	tx := db.Begin()
 	if err := tx.Error; err != nil {
 		return err
@@ -139,3 +313,32 @@ func gormTransaction(db *gorm.DB, f func(tx *gorm.DB) error) error {
 
 	return nil
 }
+
+// gormSavepoint wraps the given function in a savepoint of the transaction tx,
+// as gormTransaction does with transactions.
+func gormSavepoint(tx *gorm.DB, f func(tx *gorm.DB) error) error {
+	if err := tx.Exec("SAVEPOINT gorm_transaction").Error; err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Exec("ROLLBACK TO SAVEPOINT gorm_transaction")
+			panic(r)
+		}
+	}()
+
+	err := f(tx)
+	if err != nil {
+		if rbErr := tx.Exec("ROLLBACK TO SAVEPOINT gorm_transaction").Error; rbErr != nil {
+			return wrapi("gorm savepoint rollback error", rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Exec("RELEASE SAVEPOINT gorm_transaction").Error; err != nil {
+		return wrapi("gorm savepoint release error", err)
+	}
+
+	return nil
+}
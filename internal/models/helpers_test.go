@@ -4,48 +4,34 @@ import (
 	"os"
 	"testing"
 
+	"github.com/golang-migrate/migrate/v4"
 	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/testsupport"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 )
 
 const testJWTSecret = "very lengthy jwt test secret to be used for tests"
 
-var db *gorm.DB
-
-// setupGorm helps initialising a GORM DB connection. It cleans up the database in each call.
-func setupGorm(t *testing.T) *gorm.DB {
-	dsl := os.Getenv("RATINGSAPP_POSTGRES_TEST_DSL")
-	if dsl == "" {
-		t.Skip("require RATINGSAPP_POSTGRES_TEST_DSL to run")
-	}
-
-	if db == nil {
-		var err error
-		db, err = gorm.Open("postgres", dsl)
-		require.NoError(t, err)
-
-		db.Exec("DROP SCHEMA public CASCADE")
-		db.Exec("CREATE SCHEMA public")
+func TestMain(m *testing.M) {
+	os.Exit(testsupport.Main(m, migrateTestDB))
+}
 
-		// uncoment this line to see helpful SQL output
-		// db.LogMode(true)
+// migrateTestDB migrates the template of the test databases, creating the
+// default values.
+func migrateTestDB(db *gorm.DB) error {
+	_, _, err := migrateSchema(db, migrationFiles, "", (*migrate.Migrate).Up)
+	if err != nil {
+		return err
 	}
 
-	err := db.DropTableIfExists(
-		&Rating{},
-		&User{},
-		&Role{},
-	).Error
-	assert.NoError(t, err, "setupGorm: must drop existing tables")
-
-	// use the services autoMigrate to fix up the DB
-	err = (&Services{db: db}).autoMigrate()
-	require.NoError(t, err)
-	err = (&Services{db: db}).createDefaultValues()
-	require.NoError(t, err)
+	_, err = (&Services{db: db}).createDefaultValues("password", nil)
+	return err
+}
 
-	return db
+// setupGorm helps initialising a GORM DB connection. Each call returns a new
+// migrated database, see testsupport.DB.
+func setupGorm(t *testing.T) *gorm.DB {
+	return testsupport.DB(t)
 }
 
 func TestGORMTransaction(t *testing.T) {
@@ -55,7 +41,6 @@ func TestGORMTransaction(t *testing.T) {
 
 	t.Run("cannotBegin", func(t *testing.T) {
 		tdb := setupGorm(t)
-		db = nil
 
 		tdb.Close()
 		err := gormTransaction(tdb, func(tx *gorm.DB) error {
@@ -94,4 +79,80 @@ func TestGORMTransaction(t *testing.T) {
 		assert.NoError(t, db.Model(&Role{ID: 99}).Count(&ct).Error)
 		assert.Equal(t, int64(0), ct)
 	})
+
+	t.Run("nestedRollsBackToSavepoint", func(t *testing.T) {
+		tx := testsupport.Tx(t, setupGorm(t))
+		assert.NoError(t, tx.Create(&Role{ID: 98, Label: "kept", Permissions: PermissionReadRatings}).Error)
+
+		err := gormTransaction(tx, func(tx *gorm.DB) error {
+			assert.NoError(t, tx.Create(&Role{ID: 99, Label: "test", Permissions: PermissionWriteRatings}).Error)
+			return privateError("this is a test error")
+		})
+		assert.Error(t, err, "must return an error when the transation func returns an error")
+
+		err = gormTransaction(tx, func(tx *gorm.DB) error {
+			return tx.Create(&Role{ID: 100, Label: "committed", Permissions: PermissionWriteRatings}).Error
+		})
+		assert.NoError(t, err, "must release the savepoint when the transaction func succeeds")
+
+		var ids []int64
+		assert.NoError(t, tx.Model(&Role{}).Where("id >= 98").Order("id").Pluck("id", &ids).Error)
+		assert.Equal(t, []int64{98, 100}, ids, "must only roll back the changes of the failed func")
+	})
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	type doc struct {
+		A     string                 `json:"a,omitempty"`
+		B     int64                  `json:"b"`
+		Extra map[string]interface{} `json:"extra,omitempty"`
+	}
+
+	var cases = []struct {
+		name    string
+		current doc
+		patch   string
+		out     doc
+		outerr  error
+	}{
+		{"replace", doc{A: "x", B: 1}, `{"a":"y"}`, doc{A: "y", B: 1}, nil},
+		{"remove", doc{A: "x", B: 1}, `{"a":null}`, doc{B: 1}, nil},
+		{"bigInteger", doc{}, `{"b":9007199254740993}`, doc{B: 9007199254740993}, nil},
+		{"mergeObject", doc{Extra: map[string]interface{}{"c": "d", "e": "f"}}, `{"extra":{"c":null,"g":"h"}}`,
+			doc{Extra: map[string]interface{}{"e": "f", "g": "h"}}, nil},
+		{"emptyPatch", doc{A: "x"}, `{}`, doc{A: "x"}, nil},
+		{"notObject", doc{}, `["a"]`, doc{}, ErrInvalid},
+		{"badType", doc{}, `{"b":"x"}`, doc{}, ErrInvalid},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var out doc
+			err := applyMergePatch(&cs.current, []byte(cs.patch), &out)
+
+			if cs.outerr != nil {
+				assert.Equal(t, cs.outerr, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cs.out, out)
+			}
+		})
+	}
+}
+
+func TestSameJSON(t *testing.T) {
+	var cases = []struct {
+		a, b string
+		out  bool
+	}{
+		{`{"a":1,"b":[2,3]}`, `{"b": [2, 3], "a": 1}`, true},
+		{`{}`, ``, true},
+		{`{"a":1}`, `{"a":1.0}`, false},
+		{`{"a":1}`, `{"a":"1"}`, false},
+		{`{"a":1}`, `not json`, false},
+	}
+
+	for _, cs := range cases {
+		assert.Equal(t, cs.out, sameJSON([]byte(cs.a), []byte(cs.b)), cs.a+" "+cs.b)
+	}
 }
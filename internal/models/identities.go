@@ -0,0 +1,271 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/xerrors"
+)
+
+// An IdentityProvider verifies the ID tokens issued by an OpenID Connect
+// provider, like Google, to the users signing in with it.
+type IdentityProvider interface {
+	// Verify checks the signature, issuer, audience and expiry of an ID
+	// token, and that it was issued with nonce, and returns the identity
+	// it asserts. ErrUnauthorised is returned if it is not valid.
+	Verify(idToken, nonce string) (Identity, error)
+}
+
+// OIDCNonceTTL is the time the nonces issued by IdentityService.Nonce can be
+// used once issued.
+const OIDCNonceTTL = 10 * time.Minute
+
+// An Identity is a user account of an OpenID Connect provider, as asserted by
+// one of its ID tokens.
+type Identity struct {
+	// Issuer and Subject identify the account.
+	Issuer  string
+	Subject string
+
+	// Email is the email address of the account, and EmailVerified
+	// whether the provider checked it belongs to the user.
+	Email         string
+	EmailVerified bool
+
+	// GivenName and FamilyName are the names of the user, if shared.
+	GivenName  string
+	FamilyName string
+}
+
+//go:generate go run github.com/matryer/moq -out modelstest/identities.go -pkg modelstest . IdentityService:IdentityService
+
+// IdentityService signs in the users with the ID tokens of an OpenID Connect
+// provider. The tokens must be issued with a nonce of Nonce, which is consumed
+// when they are used, so they can't be replayed.
+type IdentityService interface {
+	// Nonce issues a nonce, which the client asks the provider to put in
+	// the ID token of the user, and sends along with it. It can be used
+	// once, until OIDCNonceTTL elapses.
+	Nonce() (string, error)
+
+	// SignIn returns the user linked to the identity asserted by
+	// idToken. The identities seen for the first time are linked to a
+	// new user with the default role, provided the provider verified
+	// their email address. ErrIdentityNotLinked is returned if a user has
+	// the address already, as only the user can link the identity, see
+	// Link. ErrUnauthorised is returned if the token or the nonce is not
+	// valid, if the address is missing or not verified, or if the user is
+	// not active.
+	SignIn(idToken, nonce string) (User, error)
+
+	// Link links the identity asserted by idToken to the user with the
+	// given ID, so it signs in as the user. ErrUnauthorised is returned
+	// if the token or the nonce is not valid, and ValidationError if the
+	// identity is linked to another user.
+	Link(userID int64, idToken, nonce string) error
+}
+
+// A UserIdentity links the identity of an OpenID Connect provider to a user.
+type UserIdentity struct {
+	Issuer  string `gorm:"primary_key;size:255"`
+	Subject string `gorm:"primary_key;size:255"`
+
+	UserID    int64     `gorm:"type:bigint;not null"`
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()"`
+}
+
+// An OIDCNonce is a nonce issued by IdentityService.Nonce.
+type OIDCNonce struct {
+	// NonceHash is the SHA-256 hash of the nonce, hex-encoded.
+	NonceHash string    `gorm:"primary_key;size:64"`
+	ExpiresAt time.Time `gorm:"type:timestamptz;not null"`
+}
+
+// TableName is the name of the table holding the nonces.
+func (OIDCNonce) TableName() string {
+	return "oidc_nonces"
+}
+
+type identityService struct {
+	db       *gorm.DB
+	users    UserService
+	provider IdentityProvider
+	clock    Clock
+}
+
+// newIdentityService instantiates a new IdentityService implementation with db
+// as the backing database, signing in the users of us with the ID tokens
+// provider verifies.
+func newIdentityService(db *gorm.DB, us UserService, provider IdentityProvider, clock Clock) IdentityService {
+	return &identityService{db: db, users: us, provider: provider, clock: clock}
+}
+
+func (is *identityService) Nonce() (string, error) {
+	var b [32]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", wrap("could not generate nonce", err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b[:])
+
+	// the nonces never used are removed along the way
+	now := is.clock.Now()
+	err = is.db.Exec("DELETE FROM oidc_nonces WHERE expires_at < ?", now).Error
+	if err != nil {
+		return "", wrap("could not remove expired nonces", err)
+	}
+
+	// hashed as the authorization codes
+	err = is.db.Create(&OIDCNonce{NonceHash: hashAuthCode(nonce), ExpiresAt: now.Add(OIDCNonceTTL)}).Error
+	if err != nil {
+		return "", wrap("could not save nonce", err)
+	}
+
+	return nonce, nil
+}
+
+// verify consumes nonce, and returns the identity asserted by idToken if it was
+// issued with it.
+func (is *identityService) verify(idToken, nonce string) (Identity, error) {
+	if idToken == "" || nonce == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	// the nonce is consumed before the token is checked, so the requests
+	// racing to use it can't all succeed
+	var n OIDCNonce
+	err := is.db.Raw("DELETE FROM oidc_nonces WHERE nonce_hash = ? RETURNING *", hashAuthCode(nonce)).Scan(&n).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Identity{}, ErrUnauthorised
+	} else if err != nil {
+		return Identity{}, wrap("could not consume nonce", err)
+	}
+
+	if !is.clock.Now().Before(n.ExpiresAt) {
+		return Identity{}, ErrUnauthorised
+	}
+
+	return is.provider.Verify(idToken, nonce)
+}
+
+func (is *identityService) SignIn(idToken, nonce string) (User, error) {
+	id, err := is.verify(idToken, nonce)
+	if err != nil {
+		return User{}, err
+	}
+
+	var link UserIdentity
+	err = is.db.Where("issuer = ? AND subject = ?", id.Issuer, id.Subject).First(&link).Error
+	if err == nil {
+		return is.active(link.UserID)
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return User{}, wrap("could not look up identity", err)
+	}
+
+	if id.Email == "" || !id.EmailVerified {
+		return User{}, ErrUnauthorised
+	}
+	id.Email = strings.ToLower(strings.TrimSpace(id.Email))
+
+	// the address may have been taken over at the provider, so only the
+	// user, signed in, links an identity to an existing account
+	_, err = is.users.ByEmail(id.Email)
+	if err == nil {
+		return User{}, ErrIdentityNotLinked
+	} else if !xerrors.Is(err, ErrNotFound) {
+		return User{}, wrap("could not get the user of the identity", err)
+	}
+
+	user, err := is.provision(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	// the identities linked concurrently keep their first user
+	err = is.db.Exec("INSERT INTO user_identities (issuer, subject, user_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		id.Issuer, id.Subject, user.ID).Error
+	if err != nil {
+		return User{}, with(wrap("could not link identity", err), "user_id", user.ID)
+	}
+
+	if !user.Active {
+		return User{}, ErrUnauthorised
+	}
+
+	return user, nil
+}
+
+func (is *identityService) Link(userID int64, idToken, nonce string) error {
+	id, err := is.verify(idToken, nonce)
+	if err != nil {
+		return err
+	}
+
+	res := is.db.Exec("INSERT INTO user_identities (issuer, subject, user_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		id.Issuer, id.Subject, userID)
+	if res.Error != nil {
+		return with(wrap("could not link identity", res.Error), "user_id", userID)
+	} else if res.RowsAffected == 1 {
+		return nil
+	}
+
+	var link UserIdentity
+	err = is.db.Where("issuer = ? AND subject = ?", id.Issuer, id.Subject).First(&link).Error
+	if err != nil {
+		return with(wrap("could not look up identity", err), "user_id", userID)
+	}
+
+	if link.UserID != userID {
+		return ValidationError{"id_token": ErrDuplicate}
+	}
+
+	return nil
+}
+
+// active returns the user with the given ID, if it is active.
+func (is *identityService) active(id int64) (User, error) {
+	user, err := is.users.ByID(id)
+	if xerrors.Is(err, ErrNotFound) {
+		return User{}, ErrUnauthorised
+	} else if err != nil {
+		return User{}, with(wrap("could not get the user of the identity", err), "user_id", id)
+	}
+
+	if !user.Active {
+		return User{}, ErrUnauthorised
+	}
+
+	return user, nil
+}
+
+// provision creates a user with the default role for id. Its password is
+// random, so it can only sign in with its identity until it is changed.
+func (is *identityService) provision(id Identity) (User, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return User{}, wrap("failed to generate a password", err)
+	}
+
+	user := NewUser()
+	user.Email = id.Email
+	user.FirstName = id.GivenName
+	user.LastName = id.FamilyName
+	user.Password = base64.RawURLEncoding.EncodeToString(b)
+	if user.FirstName == "" {
+		user.FirstName = strings.SplitN(id.Email, "@", 2)[0]
+	}
+
+	err = is.users.Create(&user)
+	if xerrors.Is(err, ValidationError{"email": ErrDuplicate}) {
+		// created since it was looked up
+		return User{}, ErrIdentityNotLinked
+	} else if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
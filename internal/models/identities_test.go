@@ -0,0 +1,153 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIdentityProvider asserts the identities mapped to their ID tokens, which
+// are all issued with the nonce of the provider.
+type testIdentityProvider struct {
+	nonce      string
+	identities map[string]Identity
+}
+
+func (t *testIdentityProvider) Verify(idToken, nonce string) (Identity, error) {
+	id, ok := t.identities[idToken]
+	if !ok || nonce != t.nonce {
+		return Identity{}, ErrUnauthorised
+	}
+
+	return id, nil
+}
+
+func TestIdentityService_SignIn(t *testing.T) {
+	provider := &testIdentityProvider{identities: map[string]Identity{
+		"new":        {Issuer: "https://idp.test", Subject: "1", Email: "New.User@Example.com", EmailVerified: true, GivenName: "New", FamilyName: "User"},
+		"noName":     {Issuer: "https://idp.test", Subject: "2", Email: "anonymous@example.com", EmailVerified: true},
+		"unverified": {Issuer: "https://idp.test", Subject: "3", Email: "unverified@example.com"},
+		"existing":   {Issuer: "https://idp.test", Subject: "4", Email: "admin@admin.com", EmailVerified: true},
+	}}
+
+	t.Run("noCredentials", func(t *testing.T) {
+		is := newIdentityService(nil, nil, provider, SystemClock)
+
+		_, err := is.SignIn("", "nonce")
+		assert.Equal(t, ErrNoCredentials, err)
+
+		_, err = is.SignIn("new", "")
+		assert.Equal(t, ErrNoCredentials, err)
+	})
+
+	db := setupGorm(t)
+	us, err := NewUserService(db, NewRoleService(db), []byte(testJWTSecret))
+	require.NoError(t, err)
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := FixedClock(now)
+	is := newIdentityService(db, us, provider, clock)
+
+	// signIn signs in with idToken and a nonce issued for it
+	signIn := func(t *testing.T, idToken string) (User, error) {
+		var err error
+		provider.nonce, err = is.Nonce()
+		require.NoError(t, err)
+
+		return is.SignIn(idToken, provider.nonce)
+	}
+
+	t.Run("invalidToken", func(t *testing.T) {
+		_, err := signIn(t, "forged")
+		assert.Equal(t, ErrUnauthorised, err)
+	})
+
+	t.Run("provisioned", func(t *testing.T) {
+		u, err := signIn(t, "new")
+		require.NoError(t, err)
+		assert.Equal(t, "new.user@example.com", u.Email)
+		assert.Equal(t, "New", u.FirstName)
+		assert.Equal(t, "User", u.LastName)
+		assert.Equal(t, int64(2), u.RoleID, "must have the default role")
+
+		again, err := signIn(t, "new")
+		require.NoError(t, err)
+		assert.Equal(t, u.ID, again.ID, "must sign in the same user")
+
+		var ct int
+		require.NoError(t, db.Model(&UserIdentity{}).Where("user_id = ?", u.ID).Count(&ct).Error)
+		assert.Equal(t, 1, ct)
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		_, err := signIn(t, "new")
+		require.NoError(t, err)
+
+		_, err = is.SignIn("new", provider.nonce)
+		assert.Equal(t, ErrUnauthorised, err, "must not use a nonce twice")
+
+		_, err = is.SignIn("new", "unknown")
+		assert.Equal(t, ErrUnauthorised, err, "must not use a nonce not issued")
+
+		provider.nonce, err = is.Nonce()
+		require.NoError(t, err)
+		is.(*identityService).clock = FixedClock(now.Add(OIDCNonceTTL))
+		defer func() { is.(*identityService).clock = clock }()
+
+		_, err = is.SignIn("new", provider.nonce)
+		assert.Equal(t, ErrUnauthorised, err, "must not use an expired nonce")
+	})
+
+	t.Run("noName", func(t *testing.T) {
+		u, err := signIn(t, "noName")
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous", u.FirstName)
+	})
+
+	t.Run("unverified", func(t *testing.T) {
+		_, err := signIn(t, "unverified")
+		assert.Equal(t, ErrUnauthorised, err)
+	})
+
+	t.Run("notLinked", func(t *testing.T) {
+		_, err := signIn(t, "existing")
+		assert.Equal(t, ErrIdentityNotLinked, err, "must not link the user with the address")
+
+		var ct int
+		require.NoError(t, db.Model(&UserIdentity{}).Where("user_id = ?", 1).Count(&ct).Error)
+		assert.Zero(t, ct)
+	})
+
+	t.Run("linked", func(t *testing.T) {
+		var err error
+		provider.nonce, err = is.Nonce()
+		require.NoError(t, err)
+		require.NoError(t, is.Link(1, "existing", provider.nonce))
+
+		u, err := signIn(t, "existing")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), u.ID, "must sign in the user who linked the identity")
+
+		provider.nonce, err = is.Nonce()
+		require.NoError(t, err)
+		assert.NoError(t, is.Link(1, "existing", provider.nonce), "must link the identity again")
+
+		provider.nonce, err = is.Nonce()
+		require.NoError(t, err)
+		err = is.Link(1, "new", provider.nonce)
+		assert.Equal(t, ValidationError{"id_token": ErrDuplicate}, err, "must not link the identity of another user")
+
+		err = is.Link(1, "existing", "unknown")
+		assert.Equal(t, ErrUnauthorised, err)
+	})
+
+	t.Run("inactive", func(t *testing.T) {
+		u, err := signIn(t, "noName")
+		require.NoError(t, err)
+		require.NoError(t, db.Model(&User{}).Where("id = ?", u.ID).Update("active", false).Error)
+
+		_, err = signIn(t, "noName")
+		assert.Equal(t, ErrUnauthorised, err)
+	})
+}
@@ -0,0 +1,342 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/xerrors"
+)
+
+// InvitationTTL is the time the invitations can be accepted once created or
+// renewed.
+const InvitationTTL = 7 * 24 * time.Hour
+
+// The statuses of the invitations.
+const (
+	InvitationPending  = "pending"
+	InvitationExpired  = "expired"
+	InvitationAccepted = "accepted"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/invitations.go -pkg modelstest . InvitationService:InvitationService
+
+// InvitationService defines a set of methods used to invite people to create
+// their user, with a role chosen by the administrator inviting them. Each
+// invitation is sent as a link carrying a token signed with the JWT secret,
+// which the invitee follows to set their own password.
+type InvitationService interface {
+	// Create adds an invitation of inv.Email to create a user with the
+	// role inv.RoleID, which expires after InvitationTTL. The pending
+	// invitations of the same address are replaced. inv is set to the
+	// invitation created, with the token and link to send the invitee.
+	//
+	// ValidationError{"email": ErrDuplicate} is returned if a user has
+	// the address already.
+	Create(inv *Invitation) error
+
+	// List retrieves all the invitations, the accepted ones included,
+	// most recent first.
+	List() ([]Invitation, error)
+
+	// Renew extends an invitation that was not accepted by InvitationTTL
+	// from now, and returns it with a new token and link. The links sent
+	// before are no longer valid. ErrNotFound is returned if it does not
+	// exist, and ErrReadOnly if it was accepted.
+	Renew(id int64) (Invitation, error)
+
+	// Delete removes an invitation by ID, revoking its link if it was
+	// not accepted. ErrNotFound is returned if it does not exist.
+	Delete(id int64) error
+
+	// Accept creates the user invited with the token of an invitation,
+	// with the names and password of u, and sets u to the user created.
+	// ErrInvalidInvitation is returned if the token is not valid, or if
+	// its invitation expired, was accepted or was deleted.
+	Accept(token string, u *User) error
+}
+
+// An Invitation invites someone to create their user, with the role chosen by
+// the user who invited them.
+type Invitation struct {
+	ID     int64  `gorm:"primary_key;type:bigserial" json:"id"`
+	Email  string `gorm:"size:255;not null" json:"email"`
+	RoleID int64  `gorm:"type:bigint;not null" json:"roleId"`
+
+	// InvitedBy is the ID of the user who created the invitation, and
+	// UserID the ID of the user created when it was accepted.
+	InvitedBy int64  `gorm:"type:bigint;not null" json:"invitedBy"`
+	UserID    *int64 `gorm:"type:bigint" json:"userId,omitempty"`
+
+	CreatedAt  time.Time  `gorm:"type:timestamptz;not null" json:"createdAt"`
+	ExpiresAt  time.Time  `gorm:"type:timestamptz;not null" json:"expiresAt"`
+	AcceptedAt *time.Time `gorm:"type:timestamptz" json:"acceptedAt,omitempty"`
+
+	// Status is InvitationPending, InvitationExpired or
+	// InvitationAccepted.
+	Status string `gorm:"-" json:"status"`
+
+	// Token authenticates the invitee, and Link is the link carrying it
+	// when Config.InvitationURL is set. They are only returned when the
+	// invitation is created or renewed.
+	Token string `gorm:"-" json:"token,omitempty"`
+	Link  string `gorm:"-" json:"link,omitempty"`
+}
+
+type invitationService struct {
+	db    *gorm.DB
+	users UserService
+	roles RoleService
+	keys  jwtKeys
+	clock Clock
+
+	// link is the URL of the links of the invitations, which may be nil.
+	link *url.URL
+}
+
+// newInvitationService instantiates a new InvitationService implementation with
+// db as the backing database, creating the users in us with the roles of rs.
+// The tokens are signed with keys, and sent as the token query parameter of
+// link, if not nil.
+func newInvitationService(db *gorm.DB, us UserService, rs RoleService, keys jwtKeys, link *url.URL, clock Clock) InvitationService {
+	return &invitationService{db: db, users: us, roles: rs, keys: keys, link: link, clock: clock}
+}
+
+// invitationMAC returns the signature of the token of inv with key. The
+// signature covers the address and expiry, so the tokens are revoked by the
+// changes to them.
+func invitationMAC(key []byte, inv Invitation) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte("invitation:" + strconv.FormatInt(inv.ID, 10) + ":" + inv.Email + ":" +
+		strconv.FormatInt(inv.ExpiresAt.Unix(), 10)))
+	return m.Sum(nil)
+}
+
+// sign sets the token and link of inv.
+func (is *invitationService) sign(inv *Invitation) {
+	inv.Token = strconv.FormatInt(inv.ID, 10) + "." +
+		base64.RawURLEncoding.EncodeToString(invitationMAC(is.keys.secret, *inv))
+
+	if is.link != nil {
+		u := *is.link
+		q := u.Query()
+		q.Set("token", inv.Token)
+		u.RawQuery = q.Encode()
+		inv.Link = u.String()
+	}
+}
+
+// setStatus sets the status of inv at now.
+func setStatus(inv *Invitation, now time.Time) {
+	switch {
+	case inv.AcceptedAt != nil:
+		inv.Status = InvitationAccepted
+	case !now.Before(inv.ExpiresAt):
+		inv.Status = InvitationExpired
+	default:
+		inv.Status = InvitationPending
+	}
+}
+
+func (is *invitationService) Create(inv *Invitation) error {
+	inv.Email = strings.ToLower(strings.TrimSpace(inv.Email))
+	switch {
+	case inv.Email == "":
+		return ValidationError{"email": ErrRequired}
+	case len(inv.Email) > 255 || !emailRegex.MatchString(inv.Email):
+		return ValidationError{"email": ErrInvalid}
+	case inv.RoleID < 1:
+		return ValidationError{"roleId": ErrRequired}
+	}
+
+	_, err := is.roles.ByID(inv.RoleID)
+	if xerrors.Is(err, ErrNotFound) {
+		return ValidationError{"roleId": ErrRefNotFound}
+	} else if err != nil {
+		return err
+	}
+
+	_, err = is.users.ByEmail(inv.Email)
+	if err == nil {
+		return ValidationError{"email": ErrDuplicate}
+	} else if !xerrors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	now := is.clock.Now().UTC().Truncate(time.Second)
+	inv.ID = 0
+	inv.UserID = nil
+	inv.AcceptedAt = nil
+	inv.CreatedAt = now
+	inv.ExpiresAt = now.Add(InvitationTTL)
+
+	err = gormTransaction(is.db, func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM invitations WHERE email = ? AND accepted_at IS NULL", inv.Email).Error
+		if err != nil {
+			return wrap("could not replace pending invitations", err)
+		}
+
+		err = tx.Create(inv).Error
+		if err != nil {
+			return wrap("could not save invitation", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	setStatus(inv, now)
+	is.sign(inv)
+	return nil
+}
+
+func (is *invitationService) List() ([]Invitation, error) {
+	var invs []Invitation
+	err := is.db.Order("id DESC").Find(&invs).Error
+	if err != nil {
+		return nil, wrap("could not list invitations", err)
+	}
+
+	now := is.clock.Now()
+	for i := range invs {
+		setStatus(&invs[i], now)
+	}
+
+	return invs, nil
+}
+
+func (is *invitationService) Renew(id int64) (Invitation, error) {
+	inv, err := is.byID(id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if inv.AcceptedAt != nil {
+		return Invitation{}, ErrReadOnly
+	}
+
+	now := is.clock.Now().UTC().Truncate(time.Second)
+	res := is.db.Model(&Invitation{}).Where("id = ? AND accepted_at IS NULL", id).
+		UpdateColumn("expires_at", now.Add(InvitationTTL))
+	if res.Error != nil {
+		return Invitation{}, with(wrap("could not renew invitation", res.Error), "id", id)
+	}
+	if res.RowsAffected == 0 {
+		// accepted or deleted since it was read
+		return Invitation{}, ErrNotFound
+	}
+
+	inv.ExpiresAt = now.Add(InvitationTTL)
+	setStatus(&inv, now)
+	is.sign(&inv)
+	return inv, nil
+}
+
+func (is *invitationService) Delete(id int64) error {
+	res := is.db.Where("id = ?", id).Delete(&Invitation{})
+	if res.Error != nil {
+		return with(wrap("could not delete invitation", res.Error), "id", id)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (is *invitationService) Accept(token string, u *User) error {
+	inv, err := is.verify(token)
+	if err != nil {
+		return err
+	}
+
+	// the invitation is claimed before the user is created, so it can
+	// only be accepted once
+	now := is.clock.Now().UTC()
+	res := is.db.Model(&Invitation{}).Where("id = ? AND accepted_at IS NULL AND expires_at > ?", inv.ID, now).
+		UpdateColumn("accepted_at", now)
+	if res.Error != nil {
+		return with(wrap("could not accept invitation", res.Error), "id", inv.ID)
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidInvitation
+	}
+
+	user := NewUser()
+	user.Email = inv.Email
+	user.RoleID = inv.RoleID
+	user.FirstName = u.FirstName
+	user.LastName = u.LastName
+	user.Password = u.Password
+	user.Settings = u.Settings
+
+	err = is.users.Create(&user)
+	if err != nil {
+		// the invitee can try again
+		if rerr := is.db.Model(&Invitation{}).Where("id = ?", inv.ID).UpdateColumn("accepted_at", nil).Error; rerr != nil {
+			return with(wrap("could not release invitation", rerr), "id", inv.ID)
+		}
+
+		return err
+	}
+
+	err = is.db.Model(&Invitation{}).Where("id = ?", inv.ID).UpdateColumn("user_id", user.ID).Error
+	if err != nil {
+		return with(wrap("could not link invitation", err), "id", inv.ID, "user_id", user.ID)
+	}
+
+	*u = user
+	return nil
+}
+
+// verify returns the invitation of a token, if its signature is valid with one
+// of the keys. ErrInvalidInvitation is returned otherwise.
+func (is *invitationService) verify(token string) (Invitation, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return Invitation{}, ErrInvalidInvitation
+	}
+
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Invitation{}, ErrInvalidInvitation
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Invitation{}, ErrInvalidInvitation
+	}
+
+	inv, err := is.byID(id)
+	if xerrors.Is(err, ErrNotFound) {
+		return Invitation{}, ErrInvalidInvitation
+	} else if err != nil {
+		return Invitation{}, err
+	}
+
+	for _, key := range is.keys.verifying(is.clock.Now()) {
+		if hmac.Equal(mac, invitationMAC(key, inv)) {
+			return inv, nil
+		}
+	}
+
+	return Invitation{}, ErrInvalidInvitation
+}
+
+// byID retrieves an invitation by ID.
+func (is *invitationService) byID(id int64) (Invitation, error) {
+	var inv Invitation
+	err := is.db.Where("id = ?", id).First(&inv).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Invitation{}, ErrNotFound
+	} else if err != nil {
+		return Invitation{}, with(wrap("could not get invitation", err), "id", id)
+	}
+
+	return inv, nil
+}
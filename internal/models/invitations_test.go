@@ -0,0 +1,162 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvitationService_Create(t *testing.T) {
+	is := newInvitationService(nil, nil, nil, jwtKeys{secret: []byte(testJWTSecret)}, nil, SystemClock)
+
+	var cases = []struct {
+		name string
+		inv  Invitation
+		err  error
+	}{
+		{"noEmail", Invitation{RoleID: 2}, ValidationError{"email": ErrRequired}},
+		{"badEmail", Invitation{Email: "someone", RoleID: 2}, ValidationError{"email": ErrInvalid}},
+		{"noRole", Invitation{Email: "someone@example.com"}, ValidationError{"roleId": ErrRequired}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			err := is.Create(&cs.inv)
+			assert.Equal(t, cs.err, err)
+		})
+	}
+}
+
+func TestInvitationService_sign(t *testing.T) {
+	link, _ := url.Parse("https://app.example.com/invite?lang=en")
+	keys := jwtKeys{secret: []byte(testJWTSecret)}
+	is := newInvitationService(nil, nil, nil, keys, link, SystemClock).(*invitationService)
+
+	inv := Invitation{ID: 12, Email: "someone@example.com", ExpiresAt: time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC)}
+	is.sign(&inv)
+
+	assert.True(t, strings.HasPrefix(inv.Token, "12."))
+	assert.Equal(t, "https://app.example.com/invite?lang=en&token="+inv.Token, inv.Link)
+
+	// the token is revoked by the changes to the address or expiry
+	renewed := inv
+	renewed.ExpiresAt = renewed.ExpiresAt.Add(time.Hour)
+	is.sign(&renewed)
+	assert.NotEqual(t, inv.Token, renewed.Token)
+
+	other := newInvitationService(nil, nil, nil, keys.tenant("tenant_1"), nil, SystemClock).(*invitationService)
+	signed := Invitation{ID: inv.ID, Email: inv.Email, ExpiresAt: inv.ExpiresAt}
+	other.sign(&signed)
+	assert.NotEqual(t, inv.Token, signed.Token, "the tokens of the tenants must be signed with their own key")
+	assert.Empty(t, signed.Link)
+}
+
+func TestInvitationGorm(t *testing.T) {
+	db := setupGorm(t)
+
+	rs := NewRoleService(db)
+	us, err := NewUserService(db, rs, []byte(testJWTSecret))
+	require.NoError(t, err)
+
+	now := time.Now()
+	is := newInvitationService(db, us, rs, jwtKeys{secret: []byte(testJWTSecret)}, nil, FixedClock(now))
+
+	invite := func(email string) Invitation {
+		inv := Invitation{Email: email, RoleID: 2, InvitedBy: 1}
+		require.NoError(t, is.Create(&inv))
+		return inv
+	}
+
+	t.Run("accept", func(t *testing.T) {
+		inv := invite(" Invited@Example.com")
+		assert.Equal(t, "invited@example.com", inv.Email)
+		assert.Equal(t, InvitationPending, inv.Status)
+		assert.NotEmpty(t, inv.Token)
+
+		u := User{FirstName: "Invited", Password: "1234luggage"}
+		require.NoError(t, is.Accept(inv.Token, &u))
+		assert.NotZero(t, u.ID)
+		assert.Equal(t, "invited@example.com", u.Email)
+		assert.Equal(t, int64(2), u.RoleID)
+
+		_, err := us.Authenticate("invited@example.com", "1234luggage")
+		assert.NoError(t, err, "must sign in with the password set")
+
+		err = is.Accept(inv.Token, &User{FirstName: "Again", Password: "1234luggage"})
+		assert.Equal(t, ErrInvalidInvitation, err, "must only be accepted once")
+
+		invs, err := is.List()
+		require.NoError(t, err)
+		require.NotEmpty(t, invs)
+		assert.Equal(t, InvitationAccepted, invs[0].Status)
+		assert.Equal(t, &u.ID, invs[0].UserID)
+
+		_, err = is.Renew(inv.ID)
+		assert.Equal(t, ErrReadOnly, err)
+	})
+
+	t.Run("existingUser", func(t *testing.T) {
+		inv := Invitation{Email: "admin@admin.com", RoleID: 2, InvitedBy: 1}
+		assert.Equal(t, ValidationError{"email": ErrDuplicate}, is.Create(&inv))
+	})
+
+	t.Run("unknownRole", func(t *testing.T) {
+		inv := Invitation{Email: "norole@example.com", RoleID: 99999, InvitedBy: 1}
+		assert.Equal(t, ValidationError{"roleId": ErrRefNotFound}, is.Create(&inv))
+	})
+
+	t.Run("invalidUser", func(t *testing.T) {
+		inv := invite("retry@example.com")
+
+		err := is.Accept(inv.Token, &User{FirstName: "Retry", Password: "short"})
+		assert.Error(t, err)
+
+		err = is.Accept(inv.Token, &User{FirstName: "Retry", Password: "1234luggage"})
+		assert.NoError(t, err, "must be accepted once the user is valid")
+	})
+
+	t.Run("expiredAndRenewed", func(t *testing.T) {
+		inv := invite("expired@example.com")
+
+		later := newInvitationService(db, us, rs, jwtKeys{secret: []byte(testJWTSecret)}, nil, FixedClock(now.Add(InvitationTTL)))
+		err := later.Accept(inv.Token, &User{FirstName: "Expired", Password: "1234luggage"})
+		assert.Equal(t, ErrInvalidInvitation, err)
+
+		renewed, err := later.Renew(inv.ID)
+		require.NoError(t, err)
+		assert.Equal(t, InvitationPending, renewed.Status)
+
+		err = later.Accept(inv.Token, &User{FirstName: "Expired", Password: "1234luggage"})
+		assert.Equal(t, ErrInvalidInvitation, err, "the previous link must be revoked")
+
+		err = later.Accept(renewed.Token, &User{FirstName: "Expired", Password: "1234luggage"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("replacedAndDeleted", func(t *testing.T) {
+		first := invite("revoked@example.com")
+		second := invite("revoked@example.com")
+
+		err := is.Accept(first.Token, &User{FirstName: "Revoked", Password: "1234luggage"})
+		assert.Equal(t, ErrInvalidInvitation, err, "must be replaced by the new invitation")
+
+		require.NoError(t, is.Delete(second.ID))
+		assert.Equal(t, ErrNotFound, is.Delete(second.ID))
+
+		err = is.Accept(second.Token, &User{FirstName: "Revoked", Password: "1234luggage"})
+		assert.Equal(t, ErrInvalidInvitation, err)
+	})
+
+	t.Run("forged", func(t *testing.T) {
+		inv := invite("forged@example.com")
+
+		for _, tok := range []string{"", "forged", "x.y", inv.Token + "x", strings.Replace(inv.Token, ".", "0.", 1)} {
+			err := is.Accept(tok, &User{FirstName: "Forged", Password: "1234luggage"})
+			assert.Equal(t, ErrInvalidInvitation, err, tok)
+		}
+	})
+}
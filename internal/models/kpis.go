@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// KPIs summarises the activity of the application, as exported to monitoring
+// systems.
+type KPIs struct {
+	// RatingsLastMinute is the number of ratings submitted or updated
+	// during the last minute.
+	RatingsLastMinute int64
+
+	// ActiveUsers is the number of users who submitted or updated a
+	// rating during the last 24 hours.
+	ActiveUsers int64
+
+	// TopTargets holds the stats of the targets with the most active
+	// ratings, most rated first.
+	TopTargets []RatingStats
+}
+
+// KPIs computes the key performance indicators of the application, including
+// the stats of the topTargets targets with the most active ratings. They are
+// read from a single snapshot of the database, and are not restricted by any
+// visibility rules. The ratings held back from the stats of the targets are not
+// counted in the top targets either, see Config.NewAccountPeriod.
+func (s *Services) KPIs(topTargets int) (KPIs, error) {
+	var k KPIs
+
+	err := gormTransaction(s.db, func(tx *gorm.DB) error {
+		err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY").Error
+		if err != nil {
+			return wrap("could not set KPIs transaction mode", err)
+		}
+
+		now := s.clock.Now()
+
+		err = tx.Model(&Rating{}).
+			Where("date >= ?", now.Add(-time.Minute).Unix()).
+			Count(&k.RatingsLastMinute).
+			Error
+		if err != nil {
+			return wrap("could not count recent ratings", err)
+		}
+
+		err = tx.Model(&Rating{}).
+			Where("date >= ?", now.Add(-24*time.Hour).Unix()).
+			Select("count(DISTINCT user_id)").
+			Row().
+			Scan(&k.ActiveUsers)
+		if err != nil {
+			return wrap("could not count active users", err)
+		}
+
+		if topTargets < 1 {
+			return nil
+		}
+
+		err = s.probation.counted(tx).Model(&Rating{}).
+			Select("target, count(*) AS count, avg(score) AS average, min(score) AS min, max(score) AS max, " +
+				"sum(score * " + reputationWeightSQL + ") / sum(" + reputationWeightSQL + ") AS weighted_average").
+			Where("active").
+			Group("target").
+			Order("count(*) DESC, target").
+			Limit(topTargets).
+			Scan(&k.TopTargets).
+			Error
+		if err != nil {
+			return wrap("could not get the stats of the top targets", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return KPIs{}, err
+	}
+
+	return k, nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServices_KPIs(t *testing.T) {
+	dsl := testsupport.Database(t)
+	db := testsupport.Open(t, dsl)
+
+	now := time.Now()
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh"}).Error)
+	for _, r := range []Rating{
+		{Active: true, Score: 4, Target: 7, UserID: 1, Date: now.Unix()},
+		{Active: true, Score: 2, Target: 7, UserID: 98, Date: now.Add(-time.Hour).Unix()},
+		{Active: false, Score: 5, Target: 7, UserID: 99, Date: now.Add(-48 * time.Hour).Unix()},
+		{Active: true, Score: 5, Target: 8, UserID: 99, Date: now.Add(-48 * time.Hour).Unix()},
+		{Active: true, Score: 1, Target: 9, UserID: 1, Date: now.Add(-48 * time.Hour).Unix()},
+	} {
+		r.Extra = json.RawMessage(`{}`)
+		require.NoError(t, db.Create(&r).Error)
+	}
+
+	services, err := NewServices(&Config{
+		JWTSecret:   []byte(testJWTSecret),
+		DatabaseDSL: dsl,
+	})
+	require.NoError(t, err)
+	defer services.Close()
+
+	k, err := services.KPIs(2)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), k.RatingsLastMinute)
+	assert.Equal(t, int64(2), k.ActiveUsers)
+	assert.Equal(t, []RatingStats{
+		{Target: 7, Count: 2, Average: 3, Min: 2, Max: 4, WeightedAverage: 3},
+		{Target: 8, Count: 1, Average: 5, Min: 5, Max: 5, WeightedAverage: 5},
+	}, k.TopTargets)
+
+	k, err = services.KPIs(0)
+	require.NoError(t, err)
+	assert.Empty(t, k.TopTargets)
+}
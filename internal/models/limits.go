@@ -0,0 +1,134 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+// meterSchema starts counting the resources stored in the schema tx runs on, if
+// they are not counted yet. The tables counted are locked against writes while
+// the resources already stored are added up, so none is missed.
+func meterSchema(tx *gorm.DB) error {
+	var counted bool
+	err := tx.Raw("SELECT EXISTS (SELECT 1 FROM resource_usage)").Row().Scan(&counted)
+	if err != nil || counted {
+		return err
+	}
+
+	return tx.
+		Exec("LOCK TABLE users, ratings, rating_revisions IN SHARE MODE").
+		Exec(`INSERT INTO resource_usage (users, ratings, storage)
+			SELECT (SELECT count(*) FROM users), (SELECT count(*) FROM ratings),
+				(SELECT COALESCE(sum(pg_column_size(u)), 0) FROM users u) +
+				(SELECT COALESCE(sum(pg_column_size(r)), 0) FROM ratings r) +
+				(SELECT COALESCE(sum(pg_column_size(v)), 0) FROM rating_revisions v)
+			ON CONFLICT (id) DO NOTHING`).
+		Error
+}
+
+// schemaUsage returns the resources stored in a schema, or in the schema db
+// runs on if empty. Nothing is stored in the schemas not counted, see
+// meterSchema.
+func schemaUsage(db *gorm.DB, schema string) (TenantResources, error) {
+	table := "resource_usage"
+	if schema != "" {
+		table = pq.QuoteIdentifier(schema) + "." + table
+	}
+
+	var r TenantResources
+	err := db.Raw("SELECT users, ratings, storage FROM " + table).Scan(&r).Error
+	if err != nil && !xerrors.Is(err, gorm.ErrRecordNotFound) {
+		return TenantResources{}, with(wrap("could not get schema usage", err), "schema", schema)
+	}
+
+	return r, nil
+}
+
+// tenantLimits enforces the limits of a provisioned tenant on the users and
+// ratings created in the transaction db runs, on its schema. See InTenant.
+type tenantLimits struct {
+	db     *gorm.DB
+	limits TenantResources
+}
+
+// in returns a copy of tl enforcing the limits in the transaction db.
+func (tl *tenantLimits) in(db *gorm.DB) *tenantLimits {
+	return &tenantLimits{db: db, limits: tl.limits}
+}
+
+// create runs f, creating the resources of kind, like TenantResources{Users:
+// 1}, and rolls it back returning ErrQuotaExceeded if the resources of kind, or
+// the storage, stored by the tenant exceed its limits once created. Only the
+// creations are limited, so a tenant over a limit can still update or delete
+// what it stores.
+//
+// The counters of the resources stored stay locked once updated by f until the
+// transaction ends, so the creations of the tenant can't exceed its limits
+// together.
+func (tl *tenantLimits) create(kind TenantResources, f func() error) error {
+	if tl.limits == (TenantResources{}) {
+		return f()
+	}
+
+	return gormTransaction(tl.db, func(*gorm.DB) error {
+		err := f()
+		if err != nil {
+			return err
+		}
+
+		used, err := schemaUsage(tl.db, "")
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case kind.Users > 0 && tl.limits.Users > 0 && used.Users > tl.limits.Users,
+			kind.Ratings > 0 && tl.limits.Ratings > 0 && used.Ratings > tl.limits.Ratings,
+			tl.limits.Storage > 0 && used.Storage > tl.limits.Storage:
+			return ErrQuotaExceeded
+		}
+		return nil
+	})
+}
+
+// userLimits is a UserService decorator enforcing the limits of a tenant on the
+// users created, see tenantLimits.
+type userLimits struct {
+	UserService
+	limits *tenantLimits
+}
+
+func (ul *userLimits) Create(u *User) error {
+	return ul.limits.create(TenantResources{Users: 1}, func() error {
+		return ul.UserService.Create(u)
+	})
+}
+
+// ratingLimits is a RatingService decorator enforcing the limits of a tenant on
+// the ratings created, see tenantLimits.
+type ratingLimits struct {
+	RatingService
+	limits *tenantLimits
+}
+
+func (rl *ratingLimits) Scoped(u *User) RatingService {
+	scoped := rl.RatingService.Scoped(u)
+	if scoped == rl.RatingService {
+		return rl
+	}
+
+	return &ratingLimits{RatingService: scoped, limits: rl.limits}
+}
+
+func (rl *ratingLimits) Create(r *Rating) error {
+	return rl.limits.create(TenantResources{Ratings: 1}, func() error {
+		return rl.RatingService.Create(r)
+	})
+}
+
+func (rl *ratingLimits) PublishDraft(r *Rating, patch []byte) error {
+	return rl.limits.create(TenantResources{Ratings: 1}, func() error {
+		return rl.RatingService.PublishDraft(r, patch)
+	})
+}
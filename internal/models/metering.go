@@ -0,0 +1,384 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/metering.go -pkg modelstest . MeteringService:MeteringService
+
+// MeteringService defines a set of methods used to meter the usage of the
+// tenants, and to push it daily to a billing provider. See Config.Billing.
+type MeteringService interface {
+	// RecordCall counts an API call made to a tenant. The calls are
+	// kept in memory until they are flushed.
+	RecordCall(tenantID int64)
+
+	// Flush writes the calls counted since the last flush. The calls
+	// that cannot be written are kept for the next flush.
+	Flush() error
+
+	// Aggregate computes the usage records of day for the active and
+	// suspended tenants: the API calls made to them that day, and the
+	// users, ratings and storage they use when aggregated. The records
+	// of a day are only computed once, so days already aggregated are
+	// returned as they are. Only the days over can be aggregated.
+	Aggregate(day time.Time) ([]UsageRecord, error)
+
+	// Push sends the usage records not pushed yet to the billing
+	// provider, oldest first, and returns the number of records pushed.
+	// It returns ErrBillingDisabled if no provider is configured.
+	Push() (int, error)
+
+	// Records returns the usage records of day, sorted by tenant.
+	Records(day time.Time) ([]UsageRecord, error)
+
+	// Reconcile compares the usage records of day with the records known
+	// to the billing provider. It returns ErrBillingDisabled if no
+	// provider is configured.
+	Reconcile(day time.Time) (Reconciliation, error)
+}
+
+// A BillingProvider charges the tenants for their usage, like a Stripe
+// account with metered subscriptions. See Config.Billing.
+type BillingProvider interface {
+	// Push records r, replacing any record of the same tenant and day,
+	// so it can be retried safely. It returns the reference of the
+	// record for the provider.
+	Push(r UsageRecord) (ref string, err error)
+
+	// Records returns the records of day known to the provider.
+	Records(day time.Time) ([]UsageRecord, error)
+}
+
+// A UsageRecord reports the usage of a tenant during a day.
+type UsageRecord struct {
+	TenantID int64 `gorm:"primary_key;auto_increment:false" json:"tenantId"`
+
+	// Day is the UTC day of the usage, at midnight.
+	Day time.Time `gorm:"primary_key;type:date" json:"day"`
+
+	// APICalls is the number of API calls made to the tenant during the
+	// day, including the calls refused.
+	APICalls int64 `gorm:"not null;default:0" json:"apiCalls"`
+
+	// Stored are the resources used by the tenant when the record was
+	// aggregated, see Tenant.Used.
+	Stored TenantResources `gorm:"embedded;embedded_prefix:stored_" json:"stored"`
+
+	// PushedAt is when the record was pushed to the billing provider,
+	// if it was, with Ref its reference for the provider.
+	PushedAt *time.Time `gorm:"type:timestamptz" json:"pushedAt,omitempty"`
+	Ref      string     `gorm:"not null;default:''" json:"ref,omitempty"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// Statuses of the usage records reconciled, see ReconciliationItem.
+const (
+	// ReconciliationMatched is the status of the records known to the
+	// billing provider with the same usage.
+	ReconciliationMatched = "matched"
+
+	// ReconciliationMismatched is the status of the records known to
+	// the billing provider with another usage.
+	ReconciliationMismatched = "mismatched"
+
+	// ReconciliationMissing is the status of the records unknown to the
+	// billing provider.
+	ReconciliationMissing = "missing"
+
+	// ReconciliationUnexpected is the status of the records only known
+	// to the billing provider.
+	ReconciliationUnexpected = "unexpected"
+)
+
+// A Reconciliation compares the usage records of a day with the records of the
+// billing provider.
+type Reconciliation struct {
+	Day time.Time `json:"day"`
+
+	// Items holds a result for each tenant with a record, sorted by
+	// tenant.
+	Items []ReconciliationItem `json:"items"`
+
+	// Matched is the number of items matched, and Mismatched the number
+	// of the others.
+	Matched    int `json:"matched"`
+	Mismatched int `json:"mismatched"`
+}
+
+// A ReconciliationItem compares the usage record of a tenant with the record of
+// the billing provider.
+type ReconciliationItem struct {
+	TenantID int64 `json:"tenantId"`
+
+	// Status is ReconciliationMatched, ReconciliationMismatched,
+	// ReconciliationMissing or ReconciliationUnexpected.
+	Status string `json:"status"`
+
+	// Local is the usage record, and Provider the record of the
+	// provider, if any.
+	Local    *UsageRecord `json:"local,omitempty"`
+	Provider *UsageRecord `json:"provider,omitempty"`
+}
+
+// usageDay returns the UTC day of t, at midnight.
+func usageDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// callKey identifies the calls made to a tenant during a day.
+type callKey struct {
+	tenantID int64
+	day      time.Time
+}
+
+type meteringService struct {
+	db       *gorm.DB
+	provider BillingProvider
+
+	// clock tells the day the calls are counted in, and the days that
+	// can be aggregated.
+	clock Clock
+
+	// grace is the time the other instances may take to flush the calls
+	// of a day, before it is aggregated by meter.
+	grace time.Duration
+
+	mu    sync.Mutex
+	calls map[callKey]int64
+}
+
+// NewMeteringService instantiates a new MeteringService implementation with db
+// as the backing database, pushing the usage records to provider, which may be
+// nil.
+func NewMeteringService(db *gorm.DB, provider BillingProvider) MeteringService {
+	return newMeteringService(db, provider, SystemClock)
+}
+
+// newMeteringService instantiates a new MeteringService implementation, as
+// NewMeteringService does, telling the time with clock.
+func newMeteringService(db *gorm.DB, provider BillingProvider, clock Clock) *meteringService {
+	return &meteringService{
+		db:       db,
+		provider: provider,
+		clock:    clock,
+		calls:    make(map[callKey]int64),
+	}
+}
+
+func (ms *meteringService) RecordCall(tenantID int64) {
+	k := callKey{tenantID: tenantID, day: usageDay(ms.clock.Now())}
+
+	ms.mu.Lock()
+	ms.calls[k]++
+	ms.mu.Unlock()
+}
+
+func (ms *meteringService) Flush() error {
+	ms.mu.Lock()
+	calls := ms.calls
+	ms.calls = make(map[callKey]int64)
+	ms.mu.Unlock()
+
+	for k, n := range calls {
+		err := ms.db.Exec(`INSERT INTO tenant_api_calls (tenant_id, day, calls) VALUES (?, ?, ?)
+			ON CONFLICT (tenant_id, day) DO UPDATE SET calls = tenant_api_calls.calls + excluded.calls`,
+			k.tenantID, k.day, n,
+		).Error
+		if err != nil {
+			ms.restore(calls)
+			return wrap("could not flush api calls", err)
+		}
+		delete(calls, k)
+	}
+
+	return nil
+}
+
+// restore adds the calls not flushed back to the calls counted.
+func (ms *meteringService) restore(calls map[callKey]int64) {
+	ms.mu.Lock()
+	for k, n := range calls {
+		ms.calls[k] += n
+	}
+	ms.mu.Unlock()
+}
+
+func (ms *meteringService) Aggregate(day time.Time) ([]UsageRecord, error) {
+	day = usageDay(day)
+	if !day.Before(usageDay(ms.clock.Now())) {
+		return nil, ValidationError{"day": ErrInvalid}
+	}
+
+	err := gormTransaction(ms.db, func(tx *gorm.DB) error {
+		var tenants []Tenant
+		err := tx.Where("status IN (?)", []string{TenantActive, TenantSuspended}).Order("id").Find(&tenants).Error
+		if err != nil {
+			return err
+		}
+
+		// the resources stored are read now, as they are not
+		// recorded along the day
+		err = (&tenantGorm{db: tx}).setUsed(tenants)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range tenants {
+			err = tx.Exec(`INSERT INTO usage_records (tenant_id, day, api_calls, stored_users, stored_ratings, stored_storage)
+				SELECT ?, ?, COALESCE((SELECT calls FROM tenant_api_calls WHERE tenant_id = ? AND day = ?), 0), ?, ?, ?
+				ON CONFLICT (tenant_id, day) DO NOTHING`,
+				t.ID, day, t.ID, day, t.Used.Users, t.Used.Ratings, t.Used.Storage,
+			).Error
+			if err != nil {
+				return with(err, "tenant_id", t.ID)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, with(wrap("could not aggregate usage records", err), "day", day)
+	}
+
+	return ms.Records(day)
+}
+
+func (ms *meteringService) Push() (int, error) {
+	if ms.provider == nil {
+		return 0, ErrBillingDisabled
+	}
+
+	var pending []UsageRecord
+	err := ms.db.Where("pushed_at IS NULL").Order("day, tenant_id").Find(&pending).Error
+	if err != nil {
+		return 0, wrap("could not list pending usage records", err)
+	}
+
+	for i, r := range pending {
+		ref, err := ms.provider.Push(r)
+		if err != nil {
+			return i, with(with(wrap("could not push usage record", err), "tenant_id", r.TenantID), "day", r.Day)
+		}
+
+		err = ms.db.Model(&UsageRecord{}).
+			Where("tenant_id = ? AND day = ?", r.TenantID, r.Day).
+			Updates(map[string]interface{}{"pushed_at": ms.clock.Now(), "ref": ref}).
+			Error
+		if err != nil {
+			// pushed again on the next run
+			return i, with(wrap("could not mark usage record pushed", err), "tenant_id", r.TenantID)
+		}
+	}
+
+	return len(pending), nil
+}
+
+func (ms *meteringService) Records(day time.Time) ([]UsageRecord, error) {
+	records := []UsageRecord{}
+	err := ms.db.Where("day = ?", usageDay(day)).Order("tenant_id").Find(&records).Error
+	if err != nil {
+		return nil, wrap("could not list usage records", err)
+	}
+
+	return records, nil
+}
+
+func (ms *meteringService) Reconcile(day time.Time) (Reconciliation, error) {
+	if ms.provider == nil {
+		return Reconciliation{}, ErrBillingDisabled
+	}
+
+	day = usageDay(day)
+	local, err := ms.Records(day)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+
+	remote, err := ms.provider.Records(day)
+	if err != nil {
+		return Reconciliation{}, with(wrap("could not list the usage records of the billing provider", err), "day", day)
+	}
+
+	return reconcile(day, local, remote), nil
+}
+
+// reconcile compares the local usage records of day with the remote records of
+// the billing provider.
+func reconcile(day time.Time, local, remote []UsageRecord) Reconciliation {
+	items := make(map[int64]*ReconciliationItem, len(local))
+	for i := range local {
+		items[local[i].TenantID] = &ReconciliationItem{
+			TenantID: local[i].TenantID,
+			Status:   ReconciliationMissing,
+			Local:    &local[i],
+		}
+	}
+
+	for i := range remote {
+		r := &remote[i]
+		it, ok := items[r.TenantID]
+		if !ok {
+			items[r.TenantID] = &ReconciliationItem{TenantID: r.TenantID, Status: ReconciliationUnexpected, Provider: r}
+			continue
+		}
+
+		it.Provider = r
+		if it.Local.APICalls == r.APICalls && it.Local.Stored == r.Stored {
+			it.Status = ReconciliationMatched
+		} else {
+			it.Status = ReconciliationMismatched
+		}
+	}
+
+	rc := Reconciliation{Day: day, Items: make([]ReconciliationItem, 0, len(items))}
+	for _, it := range items {
+		rc.Items = append(rc.Items, *it)
+		if it.Status == ReconciliationMatched {
+			rc.Matched++
+		} else {
+			rc.Mismatched++
+		}
+	}
+	sort.Slice(rc.Items, func(i, j int) bool {
+		return rc.Items[i].TenantID < rc.Items[j].TenantID
+	})
+
+	return rc
+}
+
+// Meter meters the tenants: the API calls counted are written, and the usage of
+// the previous day is aggregated and pushed to Config.Billing once the other
+// instances had Config.MeteringGrace to write its calls. It is meant to be run
+// periodically.
+func (s *Services) Meter() error {
+	return s.metering.meter()
+}
+
+// meter runs the metering periodically: it flushes the calls counted, and
+// aggregates the previous day once the other instances had time to flush its
+// calls, pushing the records to the billing provider, if any.
+func (ms *meteringService) meter() error {
+	err := ms.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = ms.Aggregate(usageDay(ms.clock.Now().Add(-ms.grace)).AddDate(0, 0, -1))
+	if err != nil {
+		return err
+	}
+
+	if ms.provider == nil {
+		return nil
+	}
+
+	_, err = ms.Push()
+	return err
+}
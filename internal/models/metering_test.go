@@ -0,0 +1,135 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBillingProvider struct {
+	records map[int64]UsageRecord
+	err     error
+}
+
+func (t *testBillingProvider) Push(r UsageRecord) (string, error) {
+	if t.err != nil {
+		return "", t.err
+	}
+
+	t.records[r.TenantID] = r
+	return "ur_" + r.Day.Format("20060102"), nil
+}
+
+func (t *testBillingProvider) Records(day time.Time) ([]UsageRecord, error) {
+	var records []UsageRecord
+	for _, r := range t.records {
+		if r.Day.Equal(day) {
+			records = append(records, r)
+		}
+	}
+
+	return records, nil
+}
+
+func TestReconcile(t *testing.T) {
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	local := []UsageRecord{
+		{TenantID: 3, Day: day, APICalls: 10},
+		{TenantID: 4, Day: day, APICalls: 20},
+		{TenantID: 5, Day: day, APICalls: 30},
+	}
+	remote := []UsageRecord{
+		{TenantID: 6, Day: day, APICalls: 40},
+		{TenantID: 4, Day: day, APICalls: 20, Stored: TenantResources{Users: 1}},
+		{TenantID: 3, Day: day, APICalls: 10},
+	}
+
+	rc := reconcile(day, local, remote)
+	assert.Equal(t, day, rc.Day)
+	assert.Equal(t, 1, rc.Matched)
+	assert.Equal(t, 3, rc.Mismatched)
+
+	var statuses []string
+	for _, it := range rc.Items {
+		statuses = append(statuses, it.Status)
+	}
+	assert.Equal(t, []string{
+		ReconciliationMatched,
+		ReconciliationMismatched,
+		ReconciliationMissing,
+		ReconciliationUnexpected,
+	}, statuses)
+	assert.Nil(t, rc.Items[2].Provider)
+	assert.Nil(t, rc.Items[3].Local)
+}
+
+func TestMeteringService(t *testing.T) {
+	db := setupGorm(t)
+	bp := &testBillingProvider{records: map[int64]UsageRecord{}}
+	ms := NewMeteringService(db, bp).(*meteringService)
+
+	tp := &tenantProvisioner{db: db, clock: SystemClock}
+	acme := Tenant{Name: "Acme", Limits: TenantResources{Users: 10}}
+	require.NoError(t, newTenantService(db, tp).Provision(&acme, TenantAdmin{Email: "admin@acme.test", Password: "very long password"}))
+	tp.wait()
+	stored, err := schemaUsage(db, acme.Schema)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), stored.Users, "must count the admin")
+
+	today := usageDay(time.Now())
+	yesterday := today.AddDate(0, 0, -1)
+
+	// calls counted yesterday, and flushed in two runs
+	ms.calls[callKey{tenantID: acme.ID, day: yesterday}] = 3
+	require.NoError(t, ms.Flush())
+	ms.calls[callKey{tenantID: acme.ID, day: yesterday}] = 2
+	ms.RecordCall(acme.ID)
+	require.NoError(t, ms.Flush())
+	assert.Empty(t, ms.calls)
+
+	_, err = ms.Aggregate(today)
+	assert.Equal(t, ValidationError{"day": ErrInvalid}, err, "must only aggregate the days over")
+
+	records, err := ms.Aggregate(yesterday)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, acme.ID, records[0].TenantID)
+	assert.True(t, yesterday.Equal(records[0].Day))
+	assert.Equal(t, int64(5), records[0].APICalls)
+	assert.Equal(t, stored, records[0].Stored)
+	assert.Nil(t, records[0].PushedAt)
+
+	require.NoError(t, db.Exec("UPDATE "+acme.Schema+".resource_usage SET users = users + 1").Error)
+	again, err := ms.Aggregate(yesterday)
+	require.NoError(t, err)
+	assert.Equal(t, records, again, "must only aggregate a day once")
+
+	bp.err = ErrNotFound
+	n, err := ms.Push()
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	bp.err = nil
+	n, err = ms.Push()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = ms.Push()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "must not push the records again")
+
+	records, err = ms.Records(yesterday)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.NotNil(t, records[0].PushedAt)
+	assert.Equal(t, "ur_"+yesterday.Format("20060102"), records[0].Ref)
+
+	rc, err := ms.Reconcile(yesterday)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rc.Matched)
+	assert.Equal(t, 0, rc.Mismatched)
+
+	_, err = NewMeteringService(db, nil).Reconcile(yesterday)
+	assert.Equal(t, ErrBillingDisabled, err)
+}
@@ -0,0 +1,484 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"io/fs"
+	"strconv"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+// migrationFiles holds the SQL migrations of the database schema, applied with
+// golang-migrate. Each version has two files named after it and a short
+// description, like 0002_add_labels.up.sql and 0002_add_labels.down.sql, the
+// second one reverting the first. Each file is applied in a single transaction.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	// migrationLockID identifies the Postgres advisory lock held while
+	// upgrading the schema_migrations tables written before golang-migrate,
+	// see upgradeMigrationsTable. golang-migrate holds a lock of its own
+	// while migrating.
+	migrationLockID = 7236134
+
+	// migrationLockTimeout is the longest time an instance waits for
+	// another one to finish migrating.
+	migrationLockTimeout = 5 * time.Minute
+)
+
+// A Migration is a versioned change of the database schema.
+type Migration struct {
+	// Version orders the migrations. The schema version of a database is
+	// the version of the last migration applied to it.
+	Version int64
+
+	// Name describes the migration.
+	Name string
+}
+
+// Migrate connects to the database at dsl and applies the migrations it is
+// missing, in order, and then to the schemas of the provisioned tenants. The
+// migrations applied to the shared schema are returned. It is safe to run
+// concurrently from several instances: the others wait for the first one to
+// get the golang-migrate lock, and then find no migrations pending.
+//
+// A migration failing leaves the schema dirty at its version, see
+// ForceMigration. NewServices refuses to start until the database is migrated,
+// unless Config.Migrate is set.
+func Migrate(dsl string) ([]Migration, error) {
+	db, err := gorm.Open("postgres", dsl)
+	if err != nil {
+		return nil, wrap("failed to connect to postgres", err)
+	}
+	defer db.Close()
+
+	return migrateAll(db)
+}
+
+// MigrateDown connects to the database at dsl and reverts its last steps
+// migrations, in the schemas of the provisioned tenants and then in the shared
+// schema. The migrations reverted in the shared schema are returned.
+func MigrateDown(dsl string, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, wrap("invalid number of steps "+strconv.Itoa(steps), nil)
+	}
+
+	db, err := gorm.Open("postgres", dsl)
+	if err != nil {
+		return nil, wrap("failed to connect to postgres", err)
+	}
+	defer db.Close()
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	down := func(m *migrate.Migrate) error { return m.Steps(-steps) }
+
+	schemas, err := tenantSchemas(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schema := range schemas {
+		_, _, err = migrateSchema(db, migrationFiles, schema, down)
+		if err != nil {
+			return nil, with(wrapi("failed to revert tenant migrations", err), "schema", schema)
+		}
+	}
+
+	from, to, err := migrateSchema(db, migrationFiles, "", down)
+	return migrationsBetween(migrations, to, from), err
+}
+
+// ForceMigration connects to the database at dsl and sets the version of the
+// given schema, or of the shared one if empty, without running any migration,
+// clearing its dirty state. Once a migration failed, the schema must be forced
+// to the version before it, 0 if none, fixed, and migrated again.
+func ForceMigration(dsl, schema string, version int64) error {
+	if version < 0 {
+		return wrap("invalid version "+strconv.FormatInt(version, 10), nil)
+	}
+
+	db, err := gorm.Open("postgres", dsl)
+	if err != nil {
+		return wrap("failed to connect to postgres", err)
+	}
+	defer db.Close()
+
+	force := int(version)
+	if force == 0 {
+		force = database.NilVersion
+	}
+
+	_, _, err = migrateSchema(db, migrationFiles, schema, func(m *migrate.Migrate) error {
+		return m.Force(force)
+	})
+	return err
+}
+
+// loadMigrations lists the migrations found in the migrations directory of fsys,
+// sorted by version. Every migration must have an up and a down file.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, wrap("could not list migrations", err)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	// golang-migrate ignores the files it can't parse, so they are
+	// rejected here rather than left out
+	for _, name := range names {
+		base := name[len("migrations/"):]
+		m, err := source.DefaultParse(base)
+		if err != nil {
+			return nil, wrap("invalid migration file name "+base, err)
+		}
+		if m.Version < 1 {
+			return nil, wrap("invalid migration version in "+base, nil)
+		}
+	}
+
+	src, err := iofs.New(fsys, "migrations")
+	if err != nil {
+		return nil, wrap("could not read migrations", err)
+	}
+	defer src.Close()
+
+	var migrations []Migration
+	version, err := src.First()
+	for err == nil {
+		var name string
+		name, err = readMigration(src, version)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: int64(version), Name: name})
+
+		version, err = src.Next(version)
+	}
+	if !xerrors.Is(err, fs.ErrNotExist) {
+		return nil, wrap("could not list migrations", err)
+	}
+
+	return migrations, nil
+}
+
+// readMigration returns the name of the migration with the given version, after
+// checking it can be applied and reverted.
+func readMigration(src source.Driver, version uint) (string, error) {
+	v := strconv.FormatUint(uint64(version), 10)
+
+	up, name, err := src.ReadUp(version)
+	if err != nil {
+		return "", wrap("could not read migration "+v, err)
+	}
+	up.Close()
+
+	down, _, err := src.ReadDown(version)
+	if err != nil {
+		return "", wrap("migration "+v+"_"+name+" can't be reverted", err)
+	}
+	down.Close()
+
+	return name, nil
+}
+
+// migrationsBetween returns the migrations newer than from, up to version to.
+func migrationsBetween(migrations []Migration, from, to int64) []Migration {
+	var between []Migration
+	for _, m := range migrations {
+		if m.Version > from && m.Version <= to {
+			between = append(between, m)
+		}
+	}
+
+	return between
+}
+
+// migrateAll applies the migrations to db, and then to the schemas of the
+// provisioned tenants, returning the ones applied to db.
+func migrateAll(db *gorm.DB) ([]Migration, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, err := migrateSchema(db, migrationFiles, "", (*migrate.Migrate).Up)
+	applied := migrationsBetween(migrations, from, to)
+	if err != nil {
+		return applied, err
+	}
+
+	return applied, migrateTenants(db)
+}
+
+// migrateTenants applies the migrations to the schemas of the active and
+// suspended tenants, and counts the resources they store, see meterSchema. The
+// tenants being provisioned are migrated by their provisioning, see
+// TenantService.Provision.
+func migrateTenants(db *gorm.DB) error {
+	schemas, err := tenantSchemas(db)
+	if err != nil {
+		return err
+	}
+
+	for _, schema := range schemas {
+		_, _, err = migrateSchema(db, migrationFiles, schema, (*migrate.Migrate).Up)
+		if err == nil {
+			// the schemas provisioned before the resources were
+			// counted start being counted once migrated
+			err = inSchema(db, schema, meterSchema)
+		}
+		if err != nil {
+			return with(wrapi("failed to migrate tenant", err), "schema", schema)
+		}
+	}
+
+	return nil
+}
+
+// tenantSchemas returns the schemas of the active and suspended tenants.
+func tenantSchemas(db *gorm.DB) ([]string, error) {
+	var schemas []string
+	err := db.Model(&Tenant{}).
+		Where("schema_name <> '' AND status IN (?)", []string{TenantActive, TenantSuspended}).
+		Order("id").
+		Pluck("schema_name", &schemas).
+		Error
+	if err != nil {
+		return nil, wrapi("failed to list the schemas of the tenants", err)
+	}
+
+	return schemas, nil
+}
+
+// migrateSchema runs golang-migrate with the migrations of fsys on the given
+// schema of db, or on the shared one if empty, returning its versions before
+// and after. The migrations of the schema are recorded in its own
+// schema_migrations table, and run with it as their search path.
+func migrateSchema(db *gorm.DB, fsys fs.FS, schema string, run func(*migrate.Migrate) error) (from, to int64, err error) {
+	ctx := context.Background()
+
+	// golang-migrate holds its lock on the connection it migrates, so
+	// one is reserved from the pool
+	conn, err := db.DB().Conn(ctx)
+	if err != nil {
+		return 0, 0, wrapi("failed to reserve a connection to migrate", err)
+	}
+	defer conn.Close()
+
+	if schema != "" {
+		_, err = conn.ExecContext(ctx, "SET search_path TO "+pq.QuoteIdentifier(schema))
+		if err != nil {
+			return 0, 0, wrapi("failed to set the search path", err)
+		}
+
+		defer func() {
+			_, err := conn.ExecContext(context.Background(), "RESET search_path")
+			if err != nil {
+				// closing the session, instead of returning the
+				// connection to the pool still using the schema
+				conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+
+	err = upgradeMigrationsTable(ctx, conn)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pg, err := postgres.WithConnection(ctx, conn, &postgres.Config{SchemaName: schema})
+	if err != nil {
+		return 0, 0, wrapi("failed to prepare the migrations", err)
+	}
+
+	src, err := iofs.New(fsys, "migrations")
+	if err != nil {
+		return 0, 0, wrap("could not read migrations", err)
+	}
+
+	// the versions are read while holding the lock, so the migrations of
+	// another instance are not taken for the ones run here
+	d := &versionDriver{Driver: pg}
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", d)
+	if err != nil {
+		return 0, 0, wrapi("failed to prepare the migrations", err)
+	}
+	// closing m would close conn before the search path is reset, so only
+	// the source is closed
+	defer src.Close()
+	m.LockTimeout = migrationLockTimeout
+
+	err = run(m)
+	if xerrors.Is(err, migrate.ErrNoChange) {
+		err = nil
+	}
+	if err != nil {
+		return d.locked, d.unlocked, wrapi("failed to migrate", err)
+	}
+
+	return d.locked, d.unlocked, nil
+}
+
+// versionDriver is a golang-migrate database driver recording the version of
+// the schema when its lock is acquired and released.
+type versionDriver struct {
+	database.Driver
+
+	locked, unlocked int64
+}
+
+func (d *versionDriver) Lock() error {
+	err := d.Driver.Lock()
+	if err != nil {
+		return err
+	}
+
+	d.locked, err = d.version()
+	if err != nil {
+		d.Driver.Unlock()
+	}
+
+	return err
+}
+
+func (d *versionDriver) Unlock() error {
+	v, err := d.version()
+	if err == nil {
+		d.unlocked = v
+	}
+
+	return d.Driver.Unlock()
+}
+
+// version returns the version of the schema, 0 if it was never migrated.
+func (d *versionDriver) version() (int64, error) {
+	v, _, err := d.Driver.Version()
+	if err != nil || v == database.NilVersion {
+		return 0, err
+	}
+
+	return int64(v), nil
+}
+
+// upgradeMigrationsTable converts the schema_migrations table of the schema conn
+// uses, if it was written by the migrations run before golang-migrate, which
+// recorded every migration applied. golang-migrate keeps a single row, with the
+// version of the schema and whether its last migration failed.
+func upgradeMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapi("failed to upgrade schema_migrations", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID)
+	if err != nil {
+		return wrapi("failed to acquire the migration lock", err)
+	}
+
+	var legacy bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'schema_migrations' AND column_name = 'name')`).
+		Scan(&legacy)
+	if err != nil {
+		return wrapi("failed to look up schema_migrations", err)
+	}
+	if !legacy {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version < (SELECT MAX(version) FROM schema_migrations);
+		ALTER TABLE schema_migrations DROP COLUMN name, DROP COLUMN applied_at, ADD COLUMN dirty boolean NOT NULL DEFAULT false;
+		ALTER TABLE schema_migrations ALTER COLUMN dirty DROP DEFAULT`)
+	if err != nil {
+		return wrapi("failed to upgrade schema_migrations", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return wrapi("failed to upgrade schema_migrations", err)
+	}
+
+	return nil
+}
+
+// schemaVersion returns the version of the schema of db, 0 if it was never
+// migrated with golang-migrate, and whether its last migration failed.
+func schemaVersion(db *gorm.DB) (version int64, dirty bool, err error) {
+	var exists bool
+	err = db.Raw(`SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'schema_migrations' AND column_name = 'dirty')`).
+		Row().
+		Scan(&exists)
+	if err != nil {
+		return 0, false, wrapi("failed to look up schema_migrations", err)
+	}
+	if !exists {
+		return 0, false, nil
+	}
+
+	err = db.Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Row().Scan(&version, &dirty)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, wrapi("failed to read the schema version", err)
+	}
+
+	return version, dirty, nil
+}
+
+// checkSchema returns ErrSchemaOutdated if db is missing any of the migrations,
+// or if its last migration failed.
+func checkSchema(db *gorm.DB, migrations []Migration) error {
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	current, dirty, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	version := strconv.FormatInt(current, 10)
+	if dirty {
+		return wrap("schema version "+version+" is dirty, a migration failed", ErrSchemaOutdated)
+	}
+
+	if latest := migrations[len(migrations)-1].Version; current < latest {
+		return wrap("schema version is "+version+", expected "+strconv.FormatInt(latest, 10), ErrSchemaOutdated)
+	}
+
+	return nil
+}
+
+// inSchema runs f in a transaction of db using the given schema.
+func inSchema(db *gorm.DB, schema string, f func(tx *gorm.DB) error) error {
+	return gormTransaction(db, func(tx *gorm.DB) error {
+		err := tx.Exec("SET LOCAL search_path TO " + pq.QuoteIdentifier(schema)).Error
+		if err != nil {
+			return err
+		}
+
+		return f(tx)
+	})
+}
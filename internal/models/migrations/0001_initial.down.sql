@@ -0,0 +1,12 @@
+-- Drops the whole schema created by the initial migration, with its data.
+
+DROP TABLE IF EXISTS queue_receipts;
+DROP TABLE IF EXISTS tombstones;
+DROP TABLE IF EXISTS target_tags;
+DROP TABLE IF EXISTS rating_revisions;
+DROP TABLE IF EXISTS ratings;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS roles;
+
+DROP FUNCTION IF EXISTS sync_tombstone();
+DROP FUNCTION IF EXISTS sync_set_updated_at();
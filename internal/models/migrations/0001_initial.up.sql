@@ -0,0 +1,121 @@
+-- Initial schema, as created by the AutoMigrate calls that preceded the
+-- migrations. Every statement is idempotent so databases set up by AutoMigrate
+-- can be migrated too.
+
+CREATE TABLE IF NOT EXISTS roles (
+	id bigserial PRIMARY KEY,
+	label varchar(255) NOT NULL UNIQUE,
+	permissions bigint NOT NULL,
+	version bigint NOT NULL DEFAULT 1,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id bigserial PRIMARY KEY,
+	active boolean NOT NULL,
+	email varchar(255) NOT NULL UNIQUE,
+	first_name varchar(255) NOT NULL,
+	last_name varchar(255) NOT NULL,
+	password varchar(255) NOT NULL,
+	role_id bigint NOT NULL CONSTRAINT users_role_id_roles_id_foreign REFERENCES roles (id) ON DELETE RESTRICT ON UPDATE RESTRICT,
+	settings text NOT NULL,
+	version bigint NOT NULL DEFAULT 1,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS ratings (
+	id bigserial PRIMARY KEY,
+	active boolean NOT NULL,
+	anonymous boolean NOT NULL,
+	comment text NOT NULL,
+	date bigint NOT NULL,
+	extra bytea NOT NULL,
+	score int NOT NULL,
+	target bigint NOT NULL,
+	user_id bigint NOT NULL CONSTRAINT ratings_user_id_users_id_foreign REFERENCES users (id) ON DELETE RESTRICT ON UPDATE RESTRICT,
+	version bigint NOT NULL DEFAULT 1,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uix_ratings_user_id_target ON ratings (user_id, target);
+CREATE INDEX IF NOT EXISTS idx_ratings_target_date ON ratings (target, date);
+CREATE INDEX IF NOT EXISTS idx_ratings_target_score ON ratings (target, score);
+
+CREATE TABLE IF NOT EXISTS rating_revisions (
+	id bigserial PRIMARY KEY,
+	rating_id bigint NOT NULL CONSTRAINT rating_revisions_rating_id_ratings_id_foreign REFERENCES ratings (id) ON DELETE CASCADE ON UPDATE RESTRICT,
+	active boolean NOT NULL,
+	anonymous boolean NOT NULL,
+	comment text NOT NULL,
+	date bigint NOT NULL,
+	extra bytea NOT NULL,
+	score int NOT NULL,
+	target bigint NOT NULL,
+	user_id bigint NOT NULL,
+	revised_at bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rating_revisions_rating_id ON rating_revisions (rating_id);
+
+CREATE TABLE IF NOT EXISTS target_tags (
+	target bigint NOT NULL,
+	tag varchar(64) NOT NULL,
+	PRIMARY KEY (target, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_target_tags_tag ON target_tags (tag);
+
+CREATE TABLE IF NOT EXISTS tombstones (
+	id bigserial PRIMARY KEY,
+	entity varchar(64) NOT NULL,
+	entity_id bigint NOT NULL,
+	removed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tombstones_removed_at ON tombstones (removed_at);
+
+CREATE TABLE IF NOT EXISTS queue_receipts (
+	key varchar(32) PRIMARY KEY,
+	user_id bigint NOT NULL,
+	status varchar(16) NOT NULL,
+	rating_id bigint NOT NULL DEFAULT 0,
+	error varchar(64) NOT NULL DEFAULT '',
+	fields jsonb,
+	processed_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- sync tracking: keeps updated_at current and records the deleted rows
+
+CREATE OR REPLACE FUNCTION sync_set_updated_at() RETURNS trigger AS $$
+BEGIN
+	IF NEW IS DISTINCT FROM OLD THEN
+		NEW.updated_at = now();
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION sync_tombstone() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO tombstones (entity, entity_id) VALUES (TG_TABLE_NAME, OLD.id);
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE INDEX IF NOT EXISTS idx_users_updated_at ON users (updated_at);
+CREATE INDEX IF NOT EXISTS idx_roles_updated_at ON roles (updated_at);
+CREATE INDEX IF NOT EXISTS idx_ratings_updated_at ON ratings (updated_at);
+
+DROP TRIGGER IF EXISTS users_updated_at ON users;
+CREATE TRIGGER users_updated_at BEFORE UPDATE ON users FOR EACH ROW EXECUTE PROCEDURE sync_set_updated_at();
+DROP TRIGGER IF EXISTS roles_updated_at ON roles;
+CREATE TRIGGER roles_updated_at BEFORE UPDATE ON roles FOR EACH ROW EXECUTE PROCEDURE sync_set_updated_at();
+DROP TRIGGER IF EXISTS ratings_updated_at ON ratings;
+CREATE TRIGGER ratings_updated_at BEFORE UPDATE ON ratings FOR EACH ROW EXECUTE PROCEDURE sync_set_updated_at();
+
+DROP TRIGGER IF EXISTS users_tombstone ON users;
+CREATE TRIGGER users_tombstone AFTER DELETE ON users FOR EACH ROW EXECUTE PROCEDURE sync_tombstone();
+DROP TRIGGER IF EXISTS roles_tombstone ON roles;
+CREATE TRIGGER roles_tombstone AFTER DELETE ON roles FOR EACH ROW EXECUTE PROCEDURE sync_tombstone();
+DROP TRIGGER IF EXISTS ratings_tombstone ON ratings;
+CREATE TRIGGER ratings_tombstone AFTER DELETE ON ratings FOR EACH ROW EXECUTE PROCEDURE sync_tombstone();
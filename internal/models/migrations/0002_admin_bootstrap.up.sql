@@ -0,0 +1,13 @@
+-- Records the password the admin user was created with, so the application
+-- can warn when it is kept for too long.
+CREATE TABLE admin_bootstrap (
+	user_id bigint PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	password varchar(255) NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- the admin user created by previous versions has the well known password
+-- "password", which must be changed too
+INSERT INTO admin_bootstrap (user_id, password)
+SELECT id, password FROM users
+WHERE id = 1 AND password = '$2y$12$5wXQu8UknGQxEvdATbjvUORLJAQXYfB7tLCqqISFZqjlXz3f9FYwO';
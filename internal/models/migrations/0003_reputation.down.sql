@@ -0,0 +1,3 @@
+DROP TABLE user_reputations;
+DROP TABLE rating_moderations;
+DROP TABLE rating_reactions;
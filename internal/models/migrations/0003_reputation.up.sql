@@ -0,0 +1,34 @@
+-- Helpfulness reactions to ratings, moderation outcomes and the reputation of
+-- the users computed from them.
+
+CREATE TABLE rating_reactions (
+	rating_id bigint NOT NULL REFERENCES ratings (id) ON DELETE CASCADE,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	helpful boolean NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (rating_id, user_id)
+);
+
+-- outcomes are kept when their rating is deleted, so removed ratings keep
+-- counting against the reputation of their author
+CREATE TABLE rating_moderations (
+	rating_id bigint PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	outcome varchar(16) NOT NULL CHECK (outcome IN ('approved', 'removed')),
+	moderator_id bigint NOT NULL,
+	decided_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_rating_moderations_user_id ON rating_moderations (user_id);
+
+CREATE TABLE user_reputations (
+	user_id bigint PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	points bigint NOT NULL,
+	weight double precision NOT NULL DEFAULT 1,
+	ratings bigint NOT NULL,
+	helpful bigint NOT NULL,
+	unhelpful bigint NOT NULL,
+	approved bigint NOT NULL,
+	removed bigint NOT NULL,
+	computed_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,11 @@
+-- Acceptances of the data processing policy by the users. Each version of the
+-- policy is accepted once, and acceptances are kept as evidence.
+
+CREATE TABLE user_consents (
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	policy_version varchar(64) NOT NULL,
+	accepted_at timestamptz NOT NULL DEFAULT now(),
+	ip varchar(64) NOT NULL DEFAULT '',
+	user_agent varchar(512) NOT NULL DEFAULT '',
+	PRIMARY KEY (user_id, policy_version)
+);
@@ -0,0 +1,4 @@
+-- The ratings submitted to the campaigns are kept, outside of any campaign.
+
+ALTER TABLE ratings DROP COLUMN campaign_id;
+DROP TABLE campaigns;
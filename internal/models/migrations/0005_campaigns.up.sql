@@ -0,0 +1,19 @@
+-- Time-boxed rating campaigns. Ratings may be submitted to a campaign, which
+-- only accepts them for its targets, within its window and from its eligible
+-- roles.
+
+CREATE TABLE campaigns (
+	id bigserial PRIMARY KEY,
+	name varchar(128) NOT NULL,
+	targets bigint[] NOT NULL,
+	roles bigint[] NOT NULL DEFAULT '{}',
+	starts_at timestamptz NOT NULL,
+	ends_at timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CHECK (starts_at < ends_at)
+);
+
+-- campaigns with ratings cannot be deleted, so their stats are kept
+ALTER TABLE ratings ADD COLUMN campaign_id bigint REFERENCES campaigns (id);
+
+CREATE INDEX idx_ratings_campaign_id ON ratings (campaign_id) WHERE campaign_id IS NOT NULL;
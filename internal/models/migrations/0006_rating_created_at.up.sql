@@ -0,0 +1,9 @@
+-- Creation time of the ratings, used to enforce the rating quota. The date of
+-- existing ratings is the best known approximation.
+
+ALTER TABLE ratings ADD COLUMN created_at timestamptz;
+UPDATE ratings SET created_at = to_timestamp(date);
+ALTER TABLE ratings ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE ratings ALTER COLUMN created_at SET DEFAULT now();
+
+CREATE INDEX idx_ratings_user_id_created_at ON ratings (user_id, created_at);
@@ -0,0 +1,6 @@
+-- The creation time of the users, so the ratings of new accounts can be held
+-- back from the aggregates until they are reviewed. Existing accounts predate
+-- the policy, so they are not held back.
+
+ALTER TABLE users ADD COLUMN created_at timestamptz NOT NULL DEFAULT to_timestamp(0);
+ALTER TABLE users ALTER COLUMN created_at SET DEFAULT now();
@@ -0,0 +1,33 @@
+-- Users follow targets to be notified of their new ratings, or when their
+-- average score crosses a threshold, through a channel of their choice. The
+-- notifications delivered in the application are kept in notifications.
+
+CREATE TABLE target_subscriptions (
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	target bigint NOT NULL,
+	channel varchar(16) NOT NULL CHECK (channel IN ('inApp', 'email', 'webhook')),
+	webhook_url varchar(2048) NOT NULL DEFAULT '',
+	new_ratings boolean NOT NULL DEFAULT true,
+	average_below double precision,
+	average_above double precision,
+	-- the average of the target when the subscription was last evaluated,
+	-- so thresholds are only notified when they are crossed
+	last_average double precision,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (user_id, target)
+);
+
+CREATE INDEX idx_target_subscriptions_target ON target_subscriptions (target);
+
+CREATE TABLE notifications (
+	id bigserial PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	kind varchar(32) NOT NULL,
+	target bigint NOT NULL,
+	rating_id bigint NOT NULL,
+	score int NOT NULL,
+	average double precision NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications (user_id, id);
@@ -0,0 +1,12 @@
+-- The notifications of the alerts, without a rating, are deleted along with
+-- the rules.
+
+DROP INDEX idx_ratings_target_created_at;
+
+DELETE FROM notifications WHERE rating_id IS NULL OR score IS NULL;
+ALTER TABLE notifications ALTER COLUMN score SET NOT NULL;
+ALTER TABLE notifications ALTER COLUMN rating_id SET NOT NULL;
+ALTER TABLE notifications DROP COLUMN alert_rule_id;
+
+DROP TABLE alert_rule_states;
+DROP TABLE alert_rules;
@@ -0,0 +1,33 @@
+-- Alert rules notify their owners when the average score of a target, or of
+-- each target of a tag, over the last days drops below a threshold. Their
+-- state by target is kept in alert_rule_states, so each drop is only notified
+-- once. Alerts are notifications without a rating.
+
+CREATE TABLE alert_rules (
+	id bigserial PRIMARY KEY,
+	name varchar(128) NOT NULL,
+	target bigint,
+	tag varchar(64) NOT NULL DEFAULT '',
+	window_days int NOT NULL,
+	below double precision NOT NULL,
+	owner_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	channel varchar(16) NOT NULL CHECK (channel IN ('inApp', 'email', 'webhook')),
+	webhook_url varchar(2048) NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CHECK ((target IS NULL) <> (tag = ''))
+);
+
+CREATE TABLE alert_rule_states (
+	rule_id bigint NOT NULL REFERENCES alert_rules (id) ON DELETE CASCADE,
+	target bigint NOT NULL,
+	firing boolean NOT NULL,
+	average double precision NOT NULL,
+	evaluated_at timestamptz NOT NULL,
+	PRIMARY KEY (rule_id, target)
+);
+
+ALTER TABLE notifications ADD COLUMN alert_rule_id bigint REFERENCES alert_rules (id) ON DELETE CASCADE;
+ALTER TABLE notifications ALTER COLUMN rating_id DROP NOT NULL;
+ALTER TABLE notifications ALTER COLUMN score DROP NOT NULL;
+
+CREATE INDEX idx_ratings_target_created_at ON ratings (target, created_at);
@@ -0,0 +1,31 @@
+-- Rating cards are a read model of the active ratings, holding the display
+-- name of their reviewers and the counts of the reactions to them, so the
+-- lists of the frontend only need one indexed query. They are refreshed from
+-- the event bus, and built here from the existing ratings.
+
+CREATE TABLE rating_cards (
+	id bigint PRIMARY KEY REFERENCES ratings (id) ON DELETE CASCADE,
+	target bigint NOT NULL,
+	score int NOT NULL,
+	comment text NOT NULL,
+	anonymous boolean NOT NULL,
+	date bigint NOT NULL,
+	user_id bigint NOT NULL,
+	reviewer_name varchar(255) NOT NULL,
+	helpful bigint NOT NULL,
+	unhelpful bigint NOT NULL,
+	updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_rating_cards_target_id ON rating_cards (target, id DESC);
+CREATE INDEX idx_rating_cards_user_id ON rating_cards (user_id);
+
+INSERT INTO rating_cards (id, target, score, comment, anonymous, date, user_id, reviewer_name, helpful, unhelpful, updated_at)
+SELECT r.id, r.target, r.score, r.comment, r.anonymous, r.date, r.user_id,
+	CASE WHEN r.anonymous THEN '' ELSE trim(u.first_name || ' ' || CASE WHEN u.last_name = '' THEN '' ELSE left(u.last_name, 1) || '.' END) END,
+	(SELECT count(*) FROM rating_reactions x WHERE x.rating_id = r.id AND x.helpful),
+	(SELECT count(*) FROM rating_reactions x WHERE x.rating_id = r.id AND NOT x.helpful),
+	now()
+FROM ratings r
+JOIN users u ON u.id = r.user_id
+WHERE r.active;
@@ -0,0 +1,2 @@
+DROP TABLE tenant_hostnames;
+DROP TABLE tenants;
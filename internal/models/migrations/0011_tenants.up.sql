@@ -0,0 +1,15 @@
+-- Tenants are the organisations served by the application, each on its own
+-- hostnames, which attribute the requests to them.
+
+CREATE TABLE tenants (
+	id bigserial PRIMARY KEY,
+	name varchar(128) NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE tenant_hostnames (
+	hostname varchar(253) PRIMARY KEY,
+	tenant_id bigint NOT NULL REFERENCES tenants (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_tenant_hostnames_tenant_id ON tenant_hostnames (tenant_id);
@@ -0,0 +1,9 @@
+-- The schemas of the provisioned tenants are left in place.
+
+ALTER TABLE tenants
+	DROP COLUMN status,
+	DROP COLUMN schema_name,
+	DROP COLUMN progress_step,
+	DROP COLUMN progress_done,
+	DROP COLUMN progress_total,
+	DROP COLUMN progress_error;
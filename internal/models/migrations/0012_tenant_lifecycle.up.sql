@@ -0,0 +1,11 @@
+-- The lifecycle of the tenants: the provisioned tenants get a schema of their
+-- own, and the progress of their provisioning or deletion is reported. The
+-- existing tenants are active, without a schema.
+
+ALTER TABLE tenants
+	ADD COLUMN status varchar(16) NOT NULL DEFAULT 'active',
+	ADD COLUMN schema_name varchar(63) NOT NULL DEFAULT '',
+	ADD COLUMN progress_step varchar(32) NOT NULL DEFAULT '',
+	ADD COLUMN progress_done integer NOT NULL DEFAULT 0,
+	ADD COLUMN progress_total integer NOT NULL DEFAULT 0,
+	ADD COLUMN progress_error text NOT NULL DEFAULT '';
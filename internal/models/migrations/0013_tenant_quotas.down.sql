@@ -0,0 +1,7 @@
+ALTER TABLE tenants
+	DROP COLUMN limit_users,
+	DROP COLUMN limit_ratings,
+	DROP COLUMN limit_storage,
+	DROP COLUMN used_users,
+	DROP COLUMN used_ratings,
+	DROP COLUMN used_storage;
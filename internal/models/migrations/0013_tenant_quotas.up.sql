@@ -0,0 +1,11 @@
+-- The limits of the resources each tenant can use, and the counters of the
+-- resources they use, enforced when users and ratings are created. Zero limits
+-- do not limit anything.
+
+ALTER TABLE tenants
+	ADD COLUMN limit_users bigint NOT NULL DEFAULT 0,
+	ADD COLUMN limit_ratings bigint NOT NULL DEFAULT 0,
+	ADD COLUMN limit_storage bigint NOT NULL DEFAULT 0,
+	ADD COLUMN used_users bigint NOT NULL DEFAULT 0,
+	ADD COLUMN used_ratings bigint NOT NULL DEFAULT 0,
+	ADD COLUMN used_storage bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP TABLE usage_records;
+DROP TABLE tenant_api_calls;
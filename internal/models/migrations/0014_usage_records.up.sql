@@ -0,0 +1,25 @@
+-- The API calls made to each tenant by day, and the daily usage records pushed
+-- to the billing provider. They are kept when the tenants are deleted, so their
+-- last days can still be billed.
+
+CREATE TABLE tenant_api_calls (
+	tenant_id bigint NOT NULL,
+	day date NOT NULL,
+	calls bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (tenant_id, day)
+);
+
+CREATE TABLE usage_records (
+	tenant_id bigint NOT NULL,
+	day date NOT NULL,
+	api_calls bigint NOT NULL DEFAULT 0,
+	stored_users bigint NOT NULL DEFAULT 0,
+	stored_ratings bigint NOT NULL DEFAULT 0,
+	stored_storage bigint NOT NULL DEFAULT 0,
+	pushed_at timestamptz,
+	ref varchar(255) NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (tenant_id, day)
+);
+
+CREATE INDEX idx_usage_records_pending ON usage_records (day) WHERE pushed_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE policy_changes;
+DROP TABLE policies;
@@ -0,0 +1,22 @@
+-- Policies are expressions evaluated at some points of the processing of the
+-- ratings, like whether a user can rate a target, set by the administrators.
+-- Their changes are kept in policy_changes for auditing, along with the user
+-- who made them, who may have been deleted since.
+
+CREATE TABLE policies (
+	hook varchar(64) PRIMARY KEY,
+	expression text NOT NULL,
+	updated_by bigint NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE policy_changes (
+	id bigserial PRIMARY KEY,
+	hook varchar(64) NOT NULL,
+	previous text NOT NULL DEFAULT '',
+	expression text NOT NULL DEFAULT '',
+	user_id bigint NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_policy_changes_hook ON policy_changes (hook, id);
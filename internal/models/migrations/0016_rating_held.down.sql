@@ -0,0 +1,5 @@
+-- The ratings held for review are deleted, as they would be published
+-- otherwise.
+
+DELETE FROM ratings WHERE held;
+ALTER TABLE ratings DROP COLUMN held;
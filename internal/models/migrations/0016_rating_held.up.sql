@@ -0,0 +1,9 @@
+-- Ratings of accounts on probation are flagged as held when they are created,
+-- and stay held back from the aggregates until a moderator reviews them, so
+-- they are not released silently when the probation ends.
+--
+-- The ratings created before are not held: the probation period is not known
+-- here, so those still waiting for a review are released.
+ALTER TABLE ratings ADD COLUMN held boolean NOT NULL DEFAULT false;
+
+CREATE INDEX ratings_held_idx ON ratings (id) WHERE held;
@@ -0,0 +1,14 @@
+-- The usage of the tenants is counted from zero again, until their resources
+-- are counted by the metering.
+
+ALTER TABLE tenants
+	ADD COLUMN used_users bigint NOT NULL DEFAULT 0,
+	ADD COLUMN used_ratings bigint NOT NULL DEFAULT 0,
+	ADD COLUMN used_storage bigint NOT NULL DEFAULT 0;
+
+DROP TRIGGER rating_revisions_resource_usage ON rating_revisions;
+DROP TRIGGER ratings_resource_usage ON ratings;
+DROP TRIGGER users_resource_usage ON users;
+DROP FUNCTION count_resource_usage();
+
+DROP TABLE resource_usage;
@@ -0,0 +1,51 @@
+-- The resources stored in the schemas of the provisioned tenants, counted by
+-- triggers as the rows are written, so only the users and ratings actually
+-- stored are counted, and they are only released once actually deleted. The
+-- storage is the size in bytes of the rows of the users, the ratings and their
+-- revisions.
+--
+-- The counters are a single row, added to the schemas of the tenants when
+-- provisioned or migrated: the triggers do nothing without it, so the data
+-- shared by the application is not counted, and its writes are not serialised
+-- on the row.
+CREATE TABLE resource_usage (
+	id boolean PRIMARY KEY DEFAULT true CHECK (id),
+	users bigint NOT NULL DEFAULT 0,
+	ratings bigint NOT NULL DEFAULT 0,
+	storage bigint NOT NULL DEFAULT 0
+);
+
+CREATE OR REPLACE FUNCTION count_resource_usage() RETURNS trigger AS $$
+DECLARE
+	added bigint := 0;
+	bytes bigint := 0;
+BEGIN
+	IF TG_OP <> 'DELETE' THEN
+		bytes := bytes + pg_column_size(NEW);
+	END IF;
+	IF TG_OP <> 'INSERT' THEN
+		bytes := bytes - pg_column_size(OLD);
+	END IF;
+	IF TG_OP = 'INSERT' THEN
+		added := 1;
+	ELSIF TG_OP = 'DELETE' THEN
+		added := -1;
+	END IF;
+
+	UPDATE resource_usage SET
+		users = users + CASE WHEN TG_TABLE_NAME = 'users' THEN added ELSE 0 END,
+		ratings = ratings + CASE WHEN TG_TABLE_NAME = 'ratings' THEN added ELSE 0 END,
+		storage = storage + bytes;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_resource_usage AFTER INSERT OR UPDATE OR DELETE ON users FOR EACH ROW EXECUTE PROCEDURE count_resource_usage();
+CREATE TRIGGER ratings_resource_usage AFTER INSERT OR UPDATE OR DELETE ON ratings FOR EACH ROW EXECUTE PROCEDURE count_resource_usage();
+CREATE TRIGGER rating_revisions_resource_usage AFTER INSERT OR UPDATE OR DELETE ON rating_revisions FOR EACH ROW EXECUTE PROCEDURE count_resource_usage();
+
+-- the counters reserved per request are replaced by the ones above
+ALTER TABLE tenants
+	DROP COLUMN used_users,
+	DROP COLUMN used_ratings,
+	DROP COLUMN used_storage;
@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION sync_set_updated_at() RETURNS trigger AS $$
+BEGIN
+	IF NEW IS DISTINCT FROM OLD THEN
+		NEW.updated_at = now();
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE tombstones DROP COLUMN removed_xid;
+ALTER TABLE ratings DROP COLUMN sync_xid;
+ALTER TABLE roles DROP COLUMN sync_xid;
+ALTER TABLE users DROP COLUMN sync_xid;
@@ -0,0 +1,24 @@
+-- The changes are synchronised by the ID of the transaction writing them,
+-- instead of their time: the time is read when the transaction writes, so a
+-- transaction committing after a sync had read past its time was never synced.
+-- The cursors are the oldest transaction still running when they are read, see
+-- SyncService.
+ALTER TABLE users ADD COLUMN sync_xid bigint NOT NULL DEFAULT txid_current();
+ALTER TABLE roles ADD COLUMN sync_xid bigint NOT NULL DEFAULT txid_current();
+ALTER TABLE ratings ADD COLUMN sync_xid bigint NOT NULL DEFAULT txid_current();
+ALTER TABLE tombstones ADD COLUMN removed_xid bigint NOT NULL DEFAULT txid_current();
+
+CREATE INDEX users_sync_xid_idx ON users (sync_xid);
+CREATE INDEX roles_sync_xid_idx ON roles (sync_xid);
+CREATE INDEX ratings_sync_xid_idx ON ratings (sync_xid);
+CREATE INDEX tombstones_removed_xid_idx ON tombstones (removed_xid);
+
+CREATE OR REPLACE FUNCTION sync_set_updated_at() RETURNS trigger AS $$
+BEGIN
+	IF NEW IS DISTINCT FROM OLD THEN
+		NEW.updated_at = now();
+		NEW.sync_xid = txid_current();
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
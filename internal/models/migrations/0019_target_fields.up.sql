@@ -0,0 +1,9 @@
+-- Target fields are the summary fields computed from the stats of each target,
+-- like a net promoter-like score, defined by the administrators as expressions.
+
+CREATE TABLE target_fields (
+	name varchar(64) PRIMARY KEY,
+	expression text NOT NULL,
+	updated_by bigint NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
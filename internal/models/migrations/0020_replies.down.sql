@@ -0,0 +1,2 @@
+DROP TABLE target_owners;
+DROP TABLE replies;
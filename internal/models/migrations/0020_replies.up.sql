@@ -0,0 +1,23 @@
+-- Replies are the answers of the owners of the targets, or of the
+-- administrators, to the ratings. The owners of each target are set by the
+-- administrators. Both go along with the ratings and the users they refer to.
+
+CREATE TABLE replies (
+	id bigserial PRIMARY KEY,
+	rating_id bigint NOT NULL REFERENCES ratings (id) ON DELETE CASCADE,
+	author_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	body text NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_replies_rating_id ON replies (rating_id, id);
+CREATE INDEX idx_replies_author_id ON replies (author_id);
+
+CREATE TABLE target_owners (
+	target bigint NOT NULL,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	PRIMARY KEY (target, user_id)
+);
+
+CREATE INDEX idx_target_owners_user_id ON target_owners (user_id);
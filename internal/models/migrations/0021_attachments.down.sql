@@ -0,0 +1,3 @@
+-- The files of the attachments are left in their storage.
+
+DROP TABLE attachments;
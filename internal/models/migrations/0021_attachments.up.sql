@@ -0,0 +1,16 @@
+-- Attachments are the files, like pictures, uploaded along with the ratings.
+-- The files are kept in the attachment storage, under key, and the rows go
+-- along with their rating.
+
+CREATE TABLE attachments (
+	id bigserial PRIMARY KEY,
+	rating_id bigint NOT NULL REFERENCES ratings (id) ON DELETE CASCADE,
+	user_id bigint NOT NULL,
+	key varchar(128) NOT NULL UNIQUE,
+	name varchar(255) NOT NULL,
+	content_type varchar(64) NOT NULL,
+	size bigint NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_attachments_rating_id ON attachments (rating_id, id);
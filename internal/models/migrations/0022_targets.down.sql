@@ -0,0 +1,4 @@
+DROP TRIGGER ratings_target_scores ON ratings;
+DROP FUNCTION count_target_scores();
+
+DROP TABLE targets;
@@ -0,0 +1,46 @@
+-- The count and the average score of the ratings of each target, denormalised
+-- so they are read without scanning the ratings. They are maintained by a
+-- trigger in the transactions writing the ratings, and only count the active
+-- ratings not held back, as the stats of the targets. The writes of the ratings
+-- of a target are serialised on its row.
+--
+-- The targets without such ratings have no row, or a count of 0. The drift,
+-- like the one of the ratings written with the trigger disabled, is corrected
+-- by Services.ReconcileTargets.
+CREATE TABLE targets (
+	target bigint PRIMARY KEY,
+	count bigint NOT NULL DEFAULT 0,
+	score_sum bigint NOT NULL DEFAULT 0,
+	average double precision NOT NULL DEFAULT 0,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE OR REPLACE FUNCTION count_target_scores() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP <> 'INSERT' AND OLD.active AND NOT OLD.held THEN
+		UPDATE targets SET
+			count = count - 1,
+			score_sum = score_sum - OLD.score,
+			average = CASE WHEN count > 1 THEN (score_sum - OLD.score)::double precision / (count - 1) ELSE 0 END,
+			updated_at = now()
+		WHERE target = OLD.target;
+	END IF;
+
+	IF TG_OP <> 'DELETE' AND NEW.active AND NOT NEW.held THEN
+		INSERT INTO targets (target, count, score_sum, average) VALUES (NEW.target, 1, NEW.score, NEW.score)
+		ON CONFLICT (target) DO UPDATE SET
+			count = targets.count + 1,
+			score_sum = targets.score_sum + NEW.score,
+			average = (targets.score_sum + NEW.score)::double precision / (targets.count + 1),
+			updated_at = now();
+	END IF;
+
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ratings_target_scores AFTER INSERT OR UPDATE OF target, score, active, held OR DELETE ON ratings
+	FOR EACH ROW EXECUTE PROCEDURE count_target_scores();
+
+INSERT INTO targets (target, count, score_sum, average)
+	SELECT target, count(*), sum(score), avg(score) FROM ratings WHERE active AND NOT held GROUP BY target;
@@ -0,0 +1,16 @@
+-- The notifications that could not be posted to the webhook of a subscription
+-- are kept in webhook_deliveries, and retried with an increasing delay until
+-- they are delivered or too many attempts failed.
+
+CREATE TABLE webhook_deliveries (
+	id bigserial PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	webhook_url varchar(2048) NOT NULL,
+	notification jsonb NOT NULL,
+	attempts int NOT NULL,
+	last_error text NOT NULL DEFAULT '',
+	next_attempt_at timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
@@ -0,0 +1,8 @@
+-- The permissions added after the first release are granted once to the roles
+-- selected by their policy, see permissionUpgrades, and recorded in
+-- permission_upgrades so the roles edited since keep their permissions.
+
+CREATE TABLE permission_upgrades (
+	permission bigint PRIMARY KEY,
+	applied_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,15 @@
+-- The codes of the OAuth authorization code grant, kept until they are
+-- exchanged for tokens or expire, see AuthCodeService. Only the hash of the
+-- codes is stored.
+
+CREATE TABLE auth_codes (
+	code_hash varchar(64) PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	client_id varchar(255) NOT NULL,
+	redirect_uri varchar(2048) NOT NULL,
+	code_challenge varchar(128) NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_auth_codes_expires_at ON auth_codes (expires_at);
@@ -0,0 +1,4 @@
+-- The users created by the providers are kept, but they can't sign in with
+-- them anymore.
+
+DROP TABLE user_identities;
@@ -0,0 +1,12 @@
+-- The accounts of the OpenID Connect providers the users signed in with, see
+-- IdentityService, identified by their issuer and subject.
+
+CREATE TABLE user_identities (
+	issuer varchar(255) NOT NULL,
+	subject varchar(255) NOT NULL,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,15 @@
+-- The invitations to create a user, see InvitationService. Their tokens are
+-- signed, and not stored.
+
+CREATE TABLE invitations (
+	id bigserial PRIMARY KEY,
+	email varchar(255) NOT NULL,
+	role_id bigint NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+	invited_by bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	user_id bigint REFERENCES users (id) ON DELETE SET NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	expires_at timestamptz NOT NULL,
+	accepted_at timestamptz
+);
+
+CREATE INDEX idx_invitations_email ON invitations (email);
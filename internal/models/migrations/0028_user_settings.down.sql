@@ -0,0 +1,10 @@
+-- The settings go back to text: the legacy ones as they were, the empty ones
+-- as an empty string, and the other ones as their JSON encoding.
+
+ALTER TABLE users ALTER COLUMN settings DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN settings TYPE text USING
+	CASE
+		WHEN settings = '{}'::jsonb THEN ''
+		WHEN settings - 'legacy' = '{}'::jsonb THEN settings->>'legacy'
+		ELSE settings::text
+	END;
@@ -0,0 +1,23 @@
+-- The settings of the users are stored as JSON objects, whose members are
+-- merged by the partial updates. The settings that are not JSON objects are
+-- kept under the "legacy" member, so the frontend can still read them.
+CREATE OR REPLACE FUNCTION settings_to_jsonb(s text) RETURNS jsonb AS $$
+BEGIN
+	IF s = '' THEN
+		RETURN '{}'::jsonb;
+	END IF;
+
+	IF jsonb_typeof(s::jsonb) = 'object' THEN
+		RETURN s::jsonb;
+	END IF;
+
+	RETURN jsonb_build_object('legacy', s);
+EXCEPTION WHEN invalid_text_representation THEN
+	RETURN jsonb_build_object('legacy', s);
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+ALTER TABLE users ALTER COLUMN settings TYPE jsonb USING settings_to_jsonb(settings);
+ALTER TABLE users ALTER COLUMN settings SET DEFAULT '{}'::jsonb;
+
+DROP FUNCTION settings_to_jsonb(text);
@@ -0,0 +1,6 @@
+-- The roles with writeOwnRatings (16) get writeRatings (8) back instead,
+-- which only lets them change their own ratings again. The admin role is left
+-- as it is.
+
+UPDATE roles SET permissions = (permissions & ~16::bigint) | 8, version = version + 1
+WHERE id <> 1 AND permissions & 16 = 16;
@@ -0,0 +1,7 @@
+-- The writeRatings permission (8) only let the roles change their own ratings
+-- until writeOwnRatings (16) was split from it, and it now lets them change
+-- the ratings of anyone, as moderators do. The roles that had it are given
+-- writeOwnRatings instead, so they keep changing their own ratings only. The
+-- admin role has every permission, and is left as it is.
+UPDATE roles SET permissions = (permissions & ~8::bigint) | 16, version = version + 1
+WHERE id <> 1 AND permissions & 8 = 8;
@@ -0,0 +1,5 @@
+-- The notifications of the replies are deleted along with their column.
+
+DELETE FROM notifications WHERE reply_id IS NOT NULL;
+ALTER TABLE notifications DROP COLUMN reply_id;
+ALTER TABLE notifications DROP COLUMN read_at;
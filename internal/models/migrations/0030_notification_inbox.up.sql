@@ -0,0 +1,8 @@
+-- The in-app notifications are read and marked as read by their users from
+-- their inbox. Besides the targets followed, the authors of the ratings are
+-- notified of the replies to them and of their moderation, and reply_id links
+-- the notifications of the replies.
+ALTER TABLE notifications ADD COLUMN read_at timestamptz;
+ALTER TABLE notifications ADD COLUMN reply_id bigint REFERENCES replies (id) ON DELETE CASCADE;
+
+CREATE INDEX idx_notifications_unread ON notifications (user_id, id) WHERE read_at IS NULL;
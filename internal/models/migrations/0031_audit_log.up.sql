@@ -0,0 +1,12 @@
+-- The audit log records the sensitive actions of the administrators, like the
+-- impersonation of the users. The entries are kept when their users are
+-- deleted, so they reference them without foreign keys.
+CREATE TABLE audit_log (
+	id bigserial PRIMARY KEY,
+	actor_id bigint NOT NULL,
+	action varchar(32) NOT NULL,
+	user_id bigint,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_audit_log_actor_id ON audit_log (actor_id);
@@ -0,0 +1,3 @@
+-- The events not delivered yet are lost.
+
+DROP TABLE outbox_events;
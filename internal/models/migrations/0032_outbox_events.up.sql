@@ -0,0 +1,15 @@
+-- The events of the ratings are written to outbox_events in the transaction
+-- of the change they report, and published once it is committed, so they are
+-- not lost if the application stops in between. key identifies each event,
+-- and is published along with it, as an event may be published twice.
+
+CREATE TABLE outbox_events (
+	id bigserial PRIMARY KEY,
+	key varchar(32) NOT NULL UNIQUE,
+	type varchar(64) NOT NULL,
+	data jsonb NOT NULL,
+	next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_outbox_events_next_attempt_at ON outbox_events (next_attempt_at);
@@ -0,0 +1,2 @@
+ALTER TABLE targets DROP COLUMN category;
+DROP TABLE target_categories;
@@ -0,0 +1,16 @@
+-- The categories of the targets, like restaurants or drivers, hold the rules the
+-- ratings of their targets must follow. The category of a target is set on its
+-- row of the targets, which is created if it has no ratings yet.
+
+CREATE TABLE target_categories (
+	name varchar(64) PRIMARY KEY,
+	min_score int,
+	max_score int,
+	comment_required boolean NOT NULL DEFAULT false,
+	updated_by bigint NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE targets ADD COLUMN category varchar(64) REFERENCES target_categories (name);
+
+CREATE INDEX idx_targets_category ON targets (category);
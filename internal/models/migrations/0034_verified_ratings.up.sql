@@ -0,0 +1,5 @@
+-- The ratings of the users who completed a transaction with their target are
+-- verified when they are created or updated, and weigh more in the weighted
+-- stats. Verified ratings stay verified.
+
+ALTER TABLE ratings ADD COLUMN verified boolean NOT NULL DEFAULT false;
@@ -0,0 +1,20 @@
+-- The drafts are the incomplete ratings saved by their authors to be published
+-- later. They are kept apart from the ratings, so they are never listed with
+-- them nor counted in the aggregates, and may have no target or score yet,
+-- stored as 0. Publishing a draft creates its rating and deletes it.
+
+CREATE TABLE rating_drafts (
+	id bigserial PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	target bigint NOT NULL DEFAULT 0,
+	score int NOT NULL DEFAULT 0,
+	active boolean NOT NULL,
+	anonymous boolean NOT NULL,
+	comment text NOT NULL,
+	extra bytea NOT NULL,
+	campaign_id bigint REFERENCES campaigns (id) ON DELETE SET NULL,
+	date bigint NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_rating_drafts_user_id ON rating_drafts (user_id, id);
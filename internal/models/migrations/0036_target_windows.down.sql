@@ -0,0 +1,2 @@
+ALTER TABLE targets DROP COLUMN closes_at;
+ALTER TABLE targets DROP COLUMN opens_at;
@@ -0,0 +1,7 @@
+-- The rating windows of the targets bound the time their ratings are accepted,
+-- for the reviews open for a limited time. A target without bounds is always
+-- open. The window is set on the row of the target, which is created if it has
+-- no ratings yet.
+
+ALTER TABLE targets ADD COLUMN opens_at timestamptz;
+ALTER TABLE targets ADD COLUMN closes_at timestamptz;
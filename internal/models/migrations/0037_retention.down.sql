@@ -0,0 +1,8 @@
+DROP INDEX idx_rating_revisions_date;
+DROP INDEX idx_ratings_date;
+
+DROP TABLE retention_log;
+
+ALTER TABLE tenants
+	DROP COLUMN retention_days,
+	DROP COLUMN retention_mode;
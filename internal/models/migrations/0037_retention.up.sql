@@ -0,0 +1,21 @@
+-- The retention policy scrubs the comments of the old ratings, or anonymises
+-- them, see RetentionPolicy. The tenants can override the policy of the
+-- application, and every rating changed is recorded in the retention log of
+-- its schema.
+
+ALTER TABLE tenants
+	ADD COLUMN retention_days int NOT NULL DEFAULT 0,
+	ADD COLUMN retention_mode varchar(16) NOT NULL DEFAULT '';
+
+CREATE TABLE retention_log (
+	id bigserial PRIMARY KEY,
+	rating_id bigint NOT NULL,
+	user_id bigint NOT NULL,
+	target bigint NOT NULL,
+	mode varchar(16) NOT NULL,
+	days int NOT NULL,
+	scrubbed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_ratings_date ON ratings (date);
+CREATE INDEX idx_rating_revisions_date ON rating_revisions (date);
@@ -0,0 +1,8 @@
+DROP INDEX roles_label_key;
+ALTER TABLE roles ADD CONSTRAINT roles_label_key UNIQUE (label);
+
+ALTER TABLE ratings DROP COLUMN org_id;
+ALTER TABLE roles DROP COLUMN org_id;
+ALTER TABLE users DROP COLUMN org_id;
+
+DROP TABLE organisations;
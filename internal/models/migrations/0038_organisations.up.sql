@@ -0,0 +1,24 @@
+-- The organisations are the isolated workspaces of the customers served by a
+-- single deployment, see Organisation. Their users only reach the users, roles
+-- and ratings of their own organisation. The rows of no organisation belong to
+-- the deployment itself: its users reach every organisation, and its roles are
+-- shared by all of them.
+
+CREATE TABLE organisations (
+	id bigserial PRIMARY KEY,
+	name varchar(255) NOT NULL UNIQUE,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE users ADD COLUMN org_id bigint REFERENCES organisations (id);
+ALTER TABLE roles ADD COLUMN org_id bigint REFERENCES organisations (id);
+ALTER TABLE ratings ADD COLUMN org_id bigint REFERENCES organisations (id);
+
+CREATE INDEX idx_users_org_id ON users (org_id);
+CREATE INDEX idx_roles_org_id ON roles (org_id);
+CREATE INDEX idx_ratings_org_id ON ratings (org_id, target);
+
+-- the labels of the roles are unique in each organisation, and among the
+-- shared roles
+ALTER TABLE roles DROP CONSTRAINT roles_label_key;
+CREATE UNIQUE INDEX roles_label_key ON roles ((COALESCE(org_id, 0)), label);
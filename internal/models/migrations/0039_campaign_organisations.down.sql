@@ -0,0 +1 @@
+ALTER TABLE campaigns DROP COLUMN org_id;
@@ -0,0 +1,7 @@
+-- The campaigns belong to the organisation of the administrator creating them,
+-- see Organisation, and are only reached by its users. The campaigns of no
+-- organisation belong to the deployment itself.
+
+ALTER TABLE campaigns ADD COLUMN org_id bigint REFERENCES organisations (id);
+
+CREATE INDEX idx_campaigns_org_id ON campaigns (org_id);
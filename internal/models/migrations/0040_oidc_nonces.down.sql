@@ -0,0 +1,3 @@
+-- The ID tokens can't be checked against their nonce anymore.
+
+DROP TABLE oidc_nonces;
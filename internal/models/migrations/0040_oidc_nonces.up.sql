@@ -0,0 +1,8 @@
+-- The nonces the clients signing in with an OpenID Connect provider send to
+-- it, see IdentityService.Nonce, identified by the SHA-256 hash of their value
+-- and deleted once used.
+
+CREATE TABLE oidc_nonces (
+	nonce_hash varchar(64) PRIMARY KEY,
+	expires_at timestamptz NOT NULL
+);
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"io/fs"
+	"strconv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(sql string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(sql)}
+	}
+
+	var cases = []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int64
+		outerr   bool
+	}{
+		{"sorted", fstest.MapFS{
+			"migrations/0010_third.up.sql":    file("SELECT 3"),
+			"migrations/0010_third.down.sql":  file("SELECT 3"),
+			"migrations/0001_first.up.sql":    file("SELECT 1"),
+			"migrations/0001_first.down.sql":  file("SELECT 1"),
+			"migrations/0002_second.up.sql":   file("SELECT 2"),
+			"migrations/0002_second.down.sql": file("SELECT 2"),
+			"migrations/README.md":            file("ignored"),
+		}, []int64{1, 2, 10}, false},
+		{"empty", fstest.MapFS{}, nil, false},
+		{"badName", fstest.MapFS{"migrations/first.up.sql": file("SELECT 1")}, nil, true},
+		{"zeroVersion", fstest.MapFS{
+			"migrations/0000_first.up.sql":   file("SELECT 1"),
+			"migrations/0000_first.down.sql": file("SELECT 1"),
+		}, nil, true},
+		{"duplicate", fstest.MapFS{
+			"migrations/0001_first.up.sql":   file("SELECT 1"),
+			"migrations/0001_first.down.sql": file("SELECT 1"),
+			"migrations/1_again.up.sql":      file("SELECT 1"),
+		}, nil, true},
+		{"noDown", fstest.MapFS{"migrations/0001_first.up.sql": file("SELECT 1")}, nil, true},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			migrations, err := loadMigrations(cs.fsys)
+			if cs.outerr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, cs.versions, versions)
+		})
+	}
+
+	t.Run("embedded", func(t *testing.T) {
+		migrations, err := loadMigrations(migrationFiles)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+		assert.Equal(t, Migration{Version: 1, Name: "initial"}, migrations[0])
+	})
+}
+
+func TestMigrationsBetween(t *testing.T) {
+	migrations := []Migration{{1, "first"}, {2, "second"}, {3, "third"}}
+
+	assert.Equal(t, migrations[1:], migrationsBetween(migrations, 1, 3))
+	assert.Equal(t, migrations, migrationsBetween(migrations, 0, 3))
+	assert.Empty(t, migrationsBetween(migrations, 3, 3))
+}
+
+func TestMigrate(t *testing.T) {
+	db := setupGorm(t)
+
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	up := (*migrate.Migrate).Up
+	from, to, err := migrateSchema(db, migrationFiles, "", up)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int64{latest, latest}, [2]int64{from, to}, "must not apply migrations twice")
+	assert.NoError(t, checkSchema(db, migrations))
+
+	next := Migration{Version: latest + 1, Name: "test"}
+	assert.True(t, xerrors.Is(checkSchema(db, append(migrations, next)), ErrSchemaOutdated))
+
+	// withNext returns the embedded migrations, followed by next
+	withNext := func(sql string) fs.FS {
+		fsys := fstest.MapFS{}
+		names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+		require.NoError(t, err)
+		for _, name := range names {
+			b, err := fs.ReadFile(migrationFiles, name)
+			require.NoError(t, err)
+			fsys[name] = &fstest.MapFile{Data: b}
+		}
+
+		name := "migrations/" + strconv.FormatInt(next.Version, 10) + "_" + next.Name
+		fsys[name+".up.sql"] = &fstest.MapFile{Data: []byte(sql)}
+		fsys[name+".down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE migrate_test")}
+		return fsys
+	}
+
+	t.Run("dirty", func(t *testing.T) {
+		broken := withNext("CREATE TABLE migrate_test (id int); SELECT * FROM not_a_table")
+
+		_, _, err := migrateSchema(db, broken, "", up)
+		assert.Error(t, err)
+		assert.False(t, db.HasTable("migrate_test"), "must roll back the failed migration")
+
+		version, dirty, err := schemaVersion(db)
+		require.NoError(t, err)
+		assert.Equal(t, next.Version, version)
+		assert.True(t, dirty)
+		assert.True(t, xerrors.Is(checkSchema(db, migrations), ErrSchemaOutdated))
+
+		_, _, err = migrateSchema(db, broken, "", up)
+		assert.True(t, xerrors.As(err, &migrate.ErrDirty{}), "must not migrate a dirty schema")
+
+		_, _, err = migrateSchema(db, broken, "", func(m *migrate.Migrate) error { return m.Force(int(latest)) })
+		require.NoError(t, err)
+		assert.NoError(t, checkSchema(db, migrations))
+	})
+
+	t.Run("applies", func(t *testing.T) {
+		from, to, err := migrateSchema(db, withNext("CREATE TABLE migrate_test (id int)"), "", up)
+		require.NoError(t, err)
+		assert.Equal(t, []Migration{next}, migrationsBetween(append(migrations, next), from, to))
+		assert.True(t, db.HasTable("migrate_test"))
+	})
+
+	t.Run("reverts", func(t *testing.T) {
+		from, to, err := migrateSchema(db, withNext("CREATE TABLE migrate_test (id int)"), "", func(m *migrate.Migrate) error {
+			return m.Steps(-1)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, [2]int64{next.Version, latest}, [2]int64{from, to})
+		assert.False(t, db.HasTable("migrate_test"))
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		// with a single connection, the one migrating is used next
+		db.DB().SetMaxOpenConns(1)
+		require.NoError(t, db.Exec("CREATE SCHEMA migrate_test").Error)
+
+		from, to, err := migrateSchema(db, migrationFiles, "migrate_test", up)
+		require.NoError(t, err)
+		assert.Equal(t, [2]int64{0, latest}, [2]int64{from, to})
+		assert.True(t, db.HasTable("migrate_test.ratings"))
+
+		var schema string
+		require.NoError(t, db.Raw("SELECT current_schema()").Row().Scan(&schema))
+		assert.Equal(t, "public", schema, "must reset the search path")
+	})
+}
+
+func TestMigrate_legacyTable(t *testing.T) {
+	db := setupGorm(t)
+
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	// the table written before golang-migrate, with every migration applied
+	require.NoError(t, db.Exec("DROP TABLE schema_migrations").Error)
+	require.NoError(t, db.Exec(`CREATE TABLE schema_migrations (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`).Error)
+	for _, m := range migrations {
+		require.NoError(t, db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name).Error)
+	}
+	assert.True(t, xerrors.Is(checkSchema(db, migrations), ErrSchemaOutdated), "must be upgraded first")
+
+	from, to, err := migrateSchema(db, migrationFiles, "", (*migrate.Migrate).Up)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int64{latest, latest}, [2]int64{from, to}, "must not apply migrations twice")
+	assert.NoError(t, checkSchema(db, migrations))
+
+	var count int
+	require.NoError(t, db.Raw("SELECT count(*) FROM schema_migrations").Row().Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestMigrateAll(t *testing.T) {
+	db := setupGorm(t)
+
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+
+	// forget the applied migrations so they run again, they are idempotent
+	require.NoError(t, db.Exec("DROP TABLE schema_migrations").Error)
+
+	const replicas = 4
+	results := make(chan int, replicas)
+	for i := 0; i < replicas; i++ {
+		go func() {
+			applied, err := migrateAll(db)
+			assert.NoError(t, err)
+			results <- len(applied)
+		}()
+	}
+
+	var total int
+	for i := 0; i < replicas; i++ {
+		total += <-results
+	}
+	assert.Equal(t, len(migrations), total, "each migration must be applied by a single replica")
+
+	var name string
+	require.NoError(t, db.Raw("SELECT current_database()").Row().Scan(&name))
+	lockID, err := database.GenerateAdvisoryLockId(name, "public", "schema_migrations")
+	require.NoError(t, err)
+
+	// transaction locks conflict with session locks too
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	var locked bool
+	err = tx.Raw("SELECT pg_try_advisory_xact_lock(?)", lockID).Row().Scan(&locked)
+	require.NoError(t, err)
+	assert.True(t, locked, "the lock must be released")
+}
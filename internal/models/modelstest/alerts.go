@@ -0,0 +1,281 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that AlertService does implement models.AlertService.
+// If this is not the case, regenerate this file with moq.
+var _ models.AlertService = &AlertService{}
+
+// AlertService is a mock implementation of models.AlertService.
+//
+//	func TestSomethingThatUsesAlertService(t *testing.T) {
+//
+//		// make and configure a mocked models.AlertService
+//		mockedAlertService := &AlertService{
+//			ByIDFunc: func(id int64) (models.AlertRule, error) {
+//				panic("mock out the ByID method")
+//			},
+//			CreateFunc: func(alertRule *models.AlertRule) error {
+//				panic("mock out the Create method")
+//			},
+//			DeleteFunc: func(id int64) error {
+//				panic("mock out the Delete method")
+//			},
+//			EvaluateFunc: func() error {
+//				panic("mock out the Evaluate method")
+//			},
+//			ListFunc: func() ([]models.AlertRule, error) {
+//				panic("mock out the List method")
+//			},
+//			UpdateFunc: func(alertRule *models.AlertRule) error {
+//				panic("mock out the Update method")
+//			},
+//		}
+//
+//		// use mockedAlertService in code that requires models.AlertService
+//		// and then make assertions.
+//
+//	}
+type AlertService struct {
+	// ByIDFunc mocks the ByID method.
+	ByIDFunc func(id int64) (models.AlertRule, error)
+
+	// CreateFunc mocks the Create method.
+	CreateFunc func(alertRule *models.AlertRule) error
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(id int64) error
+
+	// EvaluateFunc mocks the Evaluate method.
+	EvaluateFunc func() error
+
+	// ListFunc mocks the List method.
+	ListFunc func() ([]models.AlertRule, error)
+
+	// UpdateFunc mocks the Update method.
+	UpdateFunc func(alertRule *models.AlertRule) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// ByID holds details about calls to the ByID method.
+		ByID []struct {
+			// ID is the id argument value.
+			ID int64
+		}
+		// Create holds details about calls to the Create method.
+		Create []struct {
+			// AlertRule is the alertRule argument value.
+			AlertRule *models.AlertRule
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ID is the id argument value.
+			ID int64
+		}
+		// Evaluate holds details about calls to the Evaluate method.
+		Evaluate []struct {
+		}
+		// List holds details about calls to the List method.
+		List []struct {
+		}
+		// Update holds details about calls to the Update method.
+		Update []struct {
+			// AlertRule is the alertRule argument value.
+			AlertRule *models.AlertRule
+		}
+	}
+	lockByID     sync.RWMutex
+	lockCreate   sync.RWMutex
+	lockDelete   sync.RWMutex
+	lockEvaluate sync.RWMutex
+	lockList     sync.RWMutex
+	lockUpdate   sync.RWMutex
+}
+
+// ByID calls ByIDFunc.
+func (mock *AlertService) ByID(id int64) (models.AlertRule, error) {
+	if mock.ByIDFunc == nil {
+		panic("AlertService.ByIDFunc: method is nil but AlertService.ByID was just called")
+	}
+	callInfo := struct {
+		ID int64
+	}{
+		ID: id,
+	}
+	mock.lockByID.Lock()
+	mock.calls.ByID = append(mock.calls.ByID, callInfo)
+	mock.lockByID.Unlock()
+	return mock.ByIDFunc(id)
+}
+
+// ByIDCalls gets all the calls that were made to ByID.
+// Check the length with:
+//
+//	len(mockedAlertService.ByIDCalls())
+func (mock *AlertService) ByIDCalls() []struct {
+	ID int64
+} {
+	var calls []struct {
+		ID int64
+	}
+	mock.lockByID.RLock()
+	calls = mock.calls.ByID
+	mock.lockByID.RUnlock()
+	return calls
+}
+
+// Create calls CreateFunc.
+func (mock *AlertService) Create(alertRule *models.AlertRule) error {
+	if mock.CreateFunc == nil {
+		panic("AlertService.CreateFunc: method is nil but AlertService.Create was just called")
+	}
+	callInfo := struct {
+		AlertRule *models.AlertRule
+	}{
+		AlertRule: alertRule,
+	}
+	mock.lockCreate.Lock()
+	mock.calls.Create = append(mock.calls.Create, callInfo)
+	mock.lockCreate.Unlock()
+	return mock.CreateFunc(alertRule)
+}
+
+// CreateCalls gets all the calls that were made to Create.
+// Check the length with:
+//
+//	len(mockedAlertService.CreateCalls())
+func (mock *AlertService) CreateCalls() []struct {
+	AlertRule *models.AlertRule
+} {
+	var calls []struct {
+		AlertRule *models.AlertRule
+	}
+	mock.lockCreate.RLock()
+	calls = mock.calls.Create
+	mock.lockCreate.RUnlock()
+	return calls
+}
+
+// Delete calls DeleteFunc.
+func (mock *AlertService) Delete(id int64) error {
+	if mock.DeleteFunc == nil {
+		panic("AlertService.DeleteFunc: method is nil but AlertService.Delete was just called")
+	}
+	callInfo := struct {
+		ID int64
+	}{
+		ID: id,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(id)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedAlertService.DeleteCalls())
+func (mock *AlertService) DeleteCalls() []struct {
+	ID int64
+} {
+	var calls []struct {
+		ID int64
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// Evaluate calls EvaluateFunc.
+func (mock *AlertService) Evaluate() error {
+	if mock.EvaluateFunc == nil {
+		panic("AlertService.EvaluateFunc: method is nil but AlertService.Evaluate was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockEvaluate.Lock()
+	mock.calls.Evaluate = append(mock.calls.Evaluate, callInfo)
+	mock.lockEvaluate.Unlock()
+	return mock.EvaluateFunc()
+}
+
+// EvaluateCalls gets all the calls that were made to Evaluate.
+// Check the length with:
+//
+//	len(mockedAlertService.EvaluateCalls())
+func (mock *AlertService) EvaluateCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockEvaluate.RLock()
+	calls = mock.calls.Evaluate
+	mock.lockEvaluate.RUnlock()
+	return calls
+}
+
+// List calls ListFunc.
+func (mock *AlertService) List() ([]models.AlertRule, error) {
+	if mock.ListFunc == nil {
+		panic("AlertService.ListFunc: method is nil but AlertService.List was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc()
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedAlertService.ListCalls())
+func (mock *AlertService) ListCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
+
+// Update calls UpdateFunc.
+func (mock *AlertService) Update(alertRule *models.AlertRule) error {
+	if mock.UpdateFunc == nil {
+		panic("AlertService.UpdateFunc: method is nil but AlertService.Update was just called")
+	}
+	callInfo := struct {
+		AlertRule *models.AlertRule
+	}{
+		AlertRule: alertRule,
+	}
+	mock.lockUpdate.Lock()
+	mock.calls.Update = append(mock.calls.Update, callInfo)
+	mock.lockUpdate.Unlock()
+	return mock.UpdateFunc(alertRule)
+}
+
+// UpdateCalls gets all the calls that were made to Update.
+// Check the length with:
+//
+//	len(mockedAlertService.UpdateCalls())
+func (mock *AlertService) UpdateCalls() []struct {
+	AlertRule *models.AlertRule
+} {
+	var calls []struct {
+		AlertRule *models.AlertRule
+	}
+	mock.lockUpdate.RLock()
+	calls = mock.calls.Update
+	mock.lockUpdate.RUnlock()
+	return calls
+}
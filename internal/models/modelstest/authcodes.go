@@ -0,0 +1,187 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that AuthCodeService does implement models.AuthCodeService.
+// If this is not the case, regenerate this file with moq.
+var _ models.AuthCodeService = &AuthCodeService{}
+
+// AuthCodeService is a mock implementation of models.AuthCodeService.
+//
+//	func TestSomethingThatUsesAuthCodeService(t *testing.T) {
+//
+//		// make and configure a mocked models.AuthCodeService
+//		mockedAuthCodeService := &AuthCodeService{
+//			ClientFunc: func(clientID string, redirectURI string) error {
+//				panic("mock out the Client method")
+//			},
+//			ExchangeFunc: func(code string, clientID string, redirectURI string, verifier string) (models.User, error) {
+//				panic("mock out the Exchange method")
+//			},
+//			IssueFunc: func(c *models.AuthCode) (string, error) {
+//				panic("mock out the Issue method")
+//			},
+//		}
+//
+//		// use mockedAuthCodeService in code that requires models.AuthCodeService
+//		// and then make assertions.
+//
+//	}
+type AuthCodeService struct {
+	// ClientFunc mocks the Client method.
+	ClientFunc func(clientID string, redirectURI string) error
+
+	// ExchangeFunc mocks the Exchange method.
+	ExchangeFunc func(code string, clientID string, redirectURI string, verifier string) (models.User, error)
+
+	// IssueFunc mocks the Issue method.
+	IssueFunc func(c *models.AuthCode) (string, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Client holds details about calls to the Client method.
+		Client []struct {
+			// ClientID is the clientID argument value.
+			ClientID string
+			// RedirectURI is the redirectURI argument value.
+			RedirectURI string
+		}
+		// Exchange holds details about calls to the Exchange method.
+		Exchange []struct {
+			// Code is the code argument value.
+			Code string
+			// ClientID is the clientID argument value.
+			ClientID string
+			// RedirectURI is the redirectURI argument value.
+			RedirectURI string
+			// Verifier is the verifier argument value.
+			Verifier string
+		}
+		// Issue holds details about calls to the Issue method.
+		Issue []struct {
+			// C is the c argument value.
+			C *models.AuthCode
+		}
+	}
+	lockClient   sync.RWMutex
+	lockExchange sync.RWMutex
+	lockIssue    sync.RWMutex
+}
+
+// Client calls ClientFunc.
+func (mock *AuthCodeService) Client(clientID string, redirectURI string) error {
+	if mock.ClientFunc == nil {
+		panic("AuthCodeService.ClientFunc: method is nil but AuthCodeService.Client was just called")
+	}
+	callInfo := struct {
+		ClientID    string
+		RedirectURI string
+	}{
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+	}
+	mock.lockClient.Lock()
+	mock.calls.Client = append(mock.calls.Client, callInfo)
+	mock.lockClient.Unlock()
+	return mock.ClientFunc(clientID, redirectURI)
+}
+
+// ClientCalls gets all the calls that were made to Client.
+// Check the length with:
+//
+//	len(mockedAuthCodeService.ClientCalls())
+func (mock *AuthCodeService) ClientCalls() []struct {
+	ClientID    string
+	RedirectURI string
+} {
+	var calls []struct {
+		ClientID    string
+		RedirectURI string
+	}
+	mock.lockClient.RLock()
+	calls = mock.calls.Client
+	mock.lockClient.RUnlock()
+	return calls
+}
+
+// Exchange calls ExchangeFunc.
+func (mock *AuthCodeService) Exchange(code string, clientID string, redirectURI string, verifier string) (models.User, error) {
+	if mock.ExchangeFunc == nil {
+		panic("AuthCodeService.ExchangeFunc: method is nil but AuthCodeService.Exchange was just called")
+	}
+	callInfo := struct {
+		Code        string
+		ClientID    string
+		RedirectURI string
+		Verifier    string
+	}{
+		Code:        code,
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+		Verifier:    verifier,
+	}
+	mock.lockExchange.Lock()
+	mock.calls.Exchange = append(mock.calls.Exchange, callInfo)
+	mock.lockExchange.Unlock()
+	return mock.ExchangeFunc(code, clientID, redirectURI, verifier)
+}
+
+// ExchangeCalls gets all the calls that were made to Exchange.
+// Check the length with:
+//
+//	len(mockedAuthCodeService.ExchangeCalls())
+func (mock *AuthCodeService) ExchangeCalls() []struct {
+	Code        string
+	ClientID    string
+	RedirectURI string
+	Verifier    string
+} {
+	var calls []struct {
+		Code        string
+		ClientID    string
+		RedirectURI string
+		Verifier    string
+	}
+	mock.lockExchange.RLock()
+	calls = mock.calls.Exchange
+	mock.lockExchange.RUnlock()
+	return calls
+}
+
+// Issue calls IssueFunc.
+func (mock *AuthCodeService) Issue(c *models.AuthCode) (string, error) {
+	if mock.IssueFunc == nil {
+		panic("AuthCodeService.IssueFunc: method is nil but AuthCodeService.Issue was just called")
+	}
+	callInfo := struct {
+		C *models.AuthCode
+	}{
+		C: c,
+	}
+	mock.lockIssue.Lock()
+	mock.calls.Issue = append(mock.calls.Issue, callInfo)
+	mock.lockIssue.Unlock()
+	return mock.IssueFunc(c)
+}
+
+// IssueCalls gets all the calls that were made to Issue.
+// Check the length with:
+//
+//	len(mockedAuthCodeService.IssueCalls())
+func (mock *AuthCodeService) IssueCalls() []struct {
+	C *models.AuthCode
+} {
+	var calls []struct {
+		C *models.AuthCode
+	}
+	mock.lockIssue.RLock()
+	calls = mock.calls.Issue
+	mock.lockIssue.RUnlock()
+	return calls
+}
@@ -0,0 +1,250 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that CardService does implement models.CardService.
+// If this is not the case, regenerate this file with moq.
+var _ models.CardService = &CardService{}
+
+// CardService is a mock implementation of models.CardService.
+//
+//	func TestSomethingThatUsesCardService(t *testing.T) {
+//
+//		// make and configure a mocked models.CardService
+//		mockedCardService := &CardService{
+//			ByTargetFunc: func(target int64, q models.CardQuery) ([]models.RatingCard, error) {
+//				panic("mock out the ByTarget method")
+//			},
+//			RebuildFunc: func() error {
+//				panic("mock out the Rebuild method")
+//			},
+//			RefreshFunc: func(ratingIDs ...int64) error {
+//				panic("mock out the Refresh method")
+//			},
+//			RefreshByUserFunc: func(userID int64) error {
+//				panic("mock out the RefreshByUser method")
+//			},
+//			ScopedFunc: func(u *models.User) models.CardService {
+//				panic("mock out the Scoped method")
+//			},
+//		}
+//
+//		// use mockedCardService in code that requires models.CardService
+//		// and then make assertions.
+//
+//	}
+type CardService struct {
+	// ByTargetFunc mocks the ByTarget method.
+	ByTargetFunc func(target int64, q models.CardQuery) ([]models.RatingCard, error)
+
+	// RebuildFunc mocks the Rebuild method.
+	RebuildFunc func() error
+
+	// RefreshFunc mocks the Refresh method.
+	RefreshFunc func(ratingIDs ...int64) error
+
+	// RefreshByUserFunc mocks the RefreshByUser method.
+	RefreshByUserFunc func(userID int64) error
+
+	// ScopedFunc mocks the Scoped method.
+	ScopedFunc func(u *models.User) models.CardService
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// ByTarget holds details about calls to the ByTarget method.
+		ByTarget []struct {
+			// Target is the target argument value.
+			Target int64
+			// Q is the q argument value.
+			Q models.CardQuery
+		}
+		// Rebuild holds details about calls to the Rebuild method.
+		Rebuild []struct {
+		}
+		// Refresh holds details about calls to the Refresh method.
+		Refresh []struct {
+			// RatingIDs is the ratingIDs argument value.
+			RatingIDs []int64
+		}
+		// RefreshByUser holds details about calls to the RefreshByUser method.
+		RefreshByUser []struct {
+			// UserID is the userID argument value.
+			UserID int64
+		}
+		// Scoped holds details about calls to the Scoped method.
+		Scoped []struct {
+			// U is the u argument value.
+			U *models.User
+		}
+	}
+	lockByTarget      sync.RWMutex
+	lockRebuild       sync.RWMutex
+	lockRefresh       sync.RWMutex
+	lockRefreshByUser sync.RWMutex
+	lockScoped        sync.RWMutex
+}
+
+// ByTarget calls ByTargetFunc.
+func (mock *CardService) ByTarget(target int64, q models.CardQuery) ([]models.RatingCard, error) {
+	if mock.ByTargetFunc == nil {
+		panic("CardService.ByTargetFunc: method is nil but CardService.ByTarget was just called")
+	}
+	callInfo := struct {
+		Target int64
+		Q      models.CardQuery
+	}{
+		Target: target,
+		Q:      q,
+	}
+	mock.lockByTarget.Lock()
+	mock.calls.ByTarget = append(mock.calls.ByTarget, callInfo)
+	mock.lockByTarget.Unlock()
+	return mock.ByTargetFunc(target, q)
+}
+
+// ByTargetCalls gets all the calls that were made to ByTarget.
+// Check the length with:
+//
+//	len(mockedCardService.ByTargetCalls())
+func (mock *CardService) ByTargetCalls() []struct {
+	Target int64
+	Q      models.CardQuery
+} {
+	var calls []struct {
+		Target int64
+		Q      models.CardQuery
+	}
+	mock.lockByTarget.RLock()
+	calls = mock.calls.ByTarget
+	mock.lockByTarget.RUnlock()
+	return calls
+}
+
+// Rebuild calls RebuildFunc.
+func (mock *CardService) Rebuild() error {
+	if mock.RebuildFunc == nil {
+		panic("CardService.RebuildFunc: method is nil but CardService.Rebuild was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockRebuild.Lock()
+	mock.calls.Rebuild = append(mock.calls.Rebuild, callInfo)
+	mock.lockRebuild.Unlock()
+	return mock.RebuildFunc()
+}
+
+// RebuildCalls gets all the calls that were made to Rebuild.
+// Check the length with:
+//
+//	len(mockedCardService.RebuildCalls())
+func (mock *CardService) RebuildCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockRebuild.RLock()
+	calls = mock.calls.Rebuild
+	mock.lockRebuild.RUnlock()
+	return calls
+}
+
+// Refresh calls RefreshFunc.
+func (mock *CardService) Refresh(ratingIDs ...int64) error {
+	if mock.RefreshFunc == nil {
+		panic("CardService.RefreshFunc: method is nil but CardService.Refresh was just called")
+	}
+	callInfo := struct {
+		RatingIDs []int64
+	}{
+		RatingIDs: ratingIDs,
+	}
+	mock.lockRefresh.Lock()
+	mock.calls.Refresh = append(mock.calls.Refresh, callInfo)
+	mock.lockRefresh.Unlock()
+	return mock.RefreshFunc(ratingIDs...)
+}
+
+// RefreshCalls gets all the calls that were made to Refresh.
+// Check the length with:
+//
+//	len(mockedCardService.RefreshCalls())
+func (mock *CardService) RefreshCalls() []struct {
+	RatingIDs []int64
+} {
+	var calls []struct {
+		RatingIDs []int64
+	}
+	mock.lockRefresh.RLock()
+	calls = mock.calls.Refresh
+	mock.lockRefresh.RUnlock()
+	return calls
+}
+
+// RefreshByUser calls RefreshByUserFunc.
+func (mock *CardService) RefreshByUser(userID int64) error {
+	if mock.RefreshByUserFunc == nil {
+		panic("CardService.RefreshByUserFunc: method is nil but CardService.RefreshByUser was just called")
+	}
+	callInfo := struct {
+		UserID int64
+	}{
+		UserID: userID,
+	}
+	mock.lockRefreshByUser.Lock()
+	mock.calls.RefreshByUser = append(mock.calls.RefreshByUser, callInfo)
+	mock.lockRefreshByUser.Unlock()
+	return mock.RefreshByUserFunc(userID)
+}
+
+// RefreshByUserCalls gets all the calls that were made to RefreshByUser.
+// Check the length with:
+//
+//	len(mockedCardService.RefreshByUserCalls())
+func (mock *CardService) RefreshByUserCalls() []struct {
+	UserID int64
+} {
+	var calls []struct {
+		UserID int64
+	}
+	mock.lockRefreshByUser.RLock()
+	calls = mock.calls.RefreshByUser
+	mock.lockRefreshByUser.RUnlock()
+	return calls
+}
+
+// Scoped calls ScopedFunc.
+func (mock *CardService) Scoped(u *models.User) models.CardService {
+	if mock.ScopedFunc == nil {
+		panic("CardService.ScopedFunc: method is nil but CardService.Scoped was just called")
+	}
+	callInfo := struct {
+		U *models.User
+	}{
+		U: u,
+	}
+	mock.lockScoped.Lock()
+	mock.calls.Scoped = append(mock.calls.Scoped, callInfo)
+	mock.lockScoped.Unlock()
+	return mock.ScopedFunc(u)
+}
+
+// ScopedCalls gets all the calls that were made to Scoped.
+// Check the length with:
+//
+//	len(mockedCardService.ScopedCalls())
+func (mock *CardService) ScopedCalls() []struct {
+	U *models.User
+} {
+	var calls []struct {
+		U *models.User
+	}
+	mock.lockScoped.RLock()
+	calls = mock.calls.Scoped
+	mock.lockScoped.RUnlock()
+	return calls
+}
@@ -0,0 +1,250 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that ConsentService does implement models.ConsentService.
+// If this is not the case, regenerate this file with moq.
+var _ models.ConsentService = &ConsentService{}
+
+// ConsentService is a mock implementation of models.ConsentService.
+//
+//	func TestSomethingThatUsesConsentService(t *testing.T) {
+//
+//		// make and configure a mocked models.ConsentService
+//		mockedConsentService := &ConsentService{
+//			AcceptFunc: func(c *models.Consent) error {
+//				panic("mock out the Accept method")
+//			},
+//			AcceptedFunc: func(userID int64, version string) (bool, error) {
+//				panic("mock out the Accepted method")
+//			},
+//			ByUserFunc: func(userID int64) ([]models.Consent, error) {
+//				panic("mock out the ByUser method")
+//			},
+//			PolicyVersionFunc: func() string {
+//				panic("mock out the PolicyVersion method")
+//			},
+//			UpToDateFunc: func(userID int64) (bool, error) {
+//				panic("mock out the UpToDate method")
+//			},
+//		}
+//
+//		// use mockedConsentService in code that requires models.ConsentService
+//		// and then make assertions.
+//
+//	}
+type ConsentService struct {
+	// AcceptFunc mocks the Accept method.
+	AcceptFunc func(c *models.Consent) error
+
+	// AcceptedFunc mocks the Accepted method.
+	AcceptedFunc func(userID int64, version string) (bool, error)
+
+	// ByUserFunc mocks the ByUser method.
+	ByUserFunc func(userID int64) ([]models.Consent, error)
+
+	// PolicyVersionFunc mocks the PolicyVersion method.
+	PolicyVersionFunc func() string
+
+	// UpToDateFunc mocks the UpToDate method.
+	UpToDateFunc func(userID int64) (bool, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Accept holds details about calls to the Accept method.
+		Accept []struct {
+			// C is the c argument value.
+			C *models.Consent
+		}
+		// Accepted holds details about calls to the Accepted method.
+		Accepted []struct {
+			// UserID is the userID argument value.
+			UserID int64
+			// Version is the version argument value.
+			Version string
+		}
+		// ByUser holds details about calls to the ByUser method.
+		ByUser []struct {
+			// UserID is the userID argument value.
+			UserID int64
+		}
+		// PolicyVersion holds details about calls to the PolicyVersion method.
+		PolicyVersion []struct {
+		}
+		// UpToDate holds details about calls to the UpToDate method.
+		UpToDate []struct {
+			// UserID is the userID argument value.
+			UserID int64
+		}
+	}
+	lockAccept        sync.RWMutex
+	lockAccepted      sync.RWMutex
+	lockByUser        sync.RWMutex
+	lockPolicyVersion sync.RWMutex
+	lockUpToDate      sync.RWMutex
+}
+
+// Accept calls AcceptFunc.
+func (mock *ConsentService) Accept(c *models.Consent) error {
+	if mock.AcceptFunc == nil {
+		panic("ConsentService.AcceptFunc: method is nil but ConsentService.Accept was just called")
+	}
+	callInfo := struct {
+		C *models.Consent
+	}{
+		C: c,
+	}
+	mock.lockAccept.Lock()
+	mock.calls.Accept = append(mock.calls.Accept, callInfo)
+	mock.lockAccept.Unlock()
+	return mock.AcceptFunc(c)
+}
+
+// AcceptCalls gets all the calls that were made to Accept.
+// Check the length with:
+//
+//	len(mockedConsentService.AcceptCalls())
+func (mock *ConsentService) AcceptCalls() []struct {
+	C *models.Consent
+} {
+	var calls []struct {
+		C *models.Consent
+	}
+	mock.lockAccept.RLock()
+	calls = mock.calls.Accept
+	mock.lockAccept.RUnlock()
+	return calls
+}
+
+// Accepted calls AcceptedFunc.
+func (mock *ConsentService) Accepted(userID int64, version string) (bool, error) {
+	if mock.AcceptedFunc == nil {
+		panic("ConsentService.AcceptedFunc: method is nil but ConsentService.Accepted was just called")
+	}
+	callInfo := struct {
+		UserID  int64
+		Version string
+	}{
+		UserID:  userID,
+		Version: version,
+	}
+	mock.lockAccepted.Lock()
+	mock.calls.Accepted = append(mock.calls.Accepted, callInfo)
+	mock.lockAccepted.Unlock()
+	return mock.AcceptedFunc(userID, version)
+}
+
+// AcceptedCalls gets all the calls that were made to Accepted.
+// Check the length with:
+//
+//	len(mockedConsentService.AcceptedCalls())
+func (mock *ConsentService) AcceptedCalls() []struct {
+	UserID  int64
+	Version string
+} {
+	var calls []struct {
+		UserID  int64
+		Version string
+	}
+	mock.lockAccepted.RLock()
+	calls = mock.calls.Accepted
+	mock.lockAccepted.RUnlock()
+	return calls
+}
+
+// ByUser calls ByUserFunc.
+func (mock *ConsentService) ByUser(userID int64) ([]models.Consent, error) {
+	if mock.ByUserFunc == nil {
+		panic("ConsentService.ByUserFunc: method is nil but ConsentService.ByUser was just called")
+	}
+	callInfo := struct {
+		UserID int64
+	}{
+		UserID: userID,
+	}
+	mock.lockByUser.Lock()
+	mock.calls.ByUser = append(mock.calls.ByUser, callInfo)
+	mock.lockByUser.Unlock()
+	return mock.ByUserFunc(userID)
+}
+
+// ByUserCalls gets all the calls that were made to ByUser.
+// Check the length with:
+//
+//	len(mockedConsentService.ByUserCalls())
+func (mock *ConsentService) ByUserCalls() []struct {
+	UserID int64
+} {
+	var calls []struct {
+		UserID int64
+	}
+	mock.lockByUser.RLock()
+	calls = mock.calls.ByUser
+	mock.lockByUser.RUnlock()
+	return calls
+}
+
+// PolicyVersion calls PolicyVersionFunc.
+func (mock *ConsentService) PolicyVersion() string {
+	if mock.PolicyVersionFunc == nil {
+		panic("ConsentService.PolicyVersionFunc: method is nil but ConsentService.PolicyVersion was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockPolicyVersion.Lock()
+	mock.calls.PolicyVersion = append(mock.calls.PolicyVersion, callInfo)
+	mock.lockPolicyVersion.Unlock()
+	return mock.PolicyVersionFunc()
+}
+
+// PolicyVersionCalls gets all the calls that were made to PolicyVersion.
+// Check the length with:
+//
+//	len(mockedConsentService.PolicyVersionCalls())
+func (mock *ConsentService) PolicyVersionCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockPolicyVersion.RLock()
+	calls = mock.calls.PolicyVersion
+	mock.lockPolicyVersion.RUnlock()
+	return calls
+}
+
+// UpToDate calls UpToDateFunc.
+func (mock *ConsentService) UpToDate(userID int64) (bool, error) {
+	if mock.UpToDateFunc == nil {
+		panic("ConsentService.UpToDateFunc: method is nil but ConsentService.UpToDate was just called")
+	}
+	callInfo := struct {
+		UserID int64
+	}{
+		UserID: userID,
+	}
+	mock.lockUpToDate.Lock()
+	mock.calls.UpToDate = append(mock.calls.UpToDate, callInfo)
+	mock.lockUpToDate.Unlock()
+	return mock.UpToDateFunc(userID)
+}
+
+// UpToDateCalls gets all the calls that were made to UpToDate.
+// Check the length with:
+//
+//	len(mockedConsentService.UpToDateCalls())
+func (mock *ConsentService) UpToDateCalls() []struct {
+	UserID int64
+} {
+	var calls []struct {
+		UserID int64
+	}
+	mock.lockUpToDate.RLock()
+	calls = mock.calls.UpToDate
+	mock.lockUpToDate.RUnlock()
+	return calls
+}
@@ -0,0 +1,250 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that InvitationService does implement models.InvitationService.
+// If this is not the case, regenerate this file with moq.
+var _ models.InvitationService = &InvitationService{}
+
+// InvitationService is a mock implementation of models.InvitationService.
+//
+//	func TestSomethingThatUsesInvitationService(t *testing.T) {
+//
+//		// make and configure a mocked models.InvitationService
+//		mockedInvitationService := &InvitationService{
+//			AcceptFunc: func(token string, u *models.User) error {
+//				panic("mock out the Accept method")
+//			},
+//			CreateFunc: func(inv *models.Invitation) error {
+//				panic("mock out the Create method")
+//			},
+//			DeleteFunc: func(id int64) error {
+//				panic("mock out the Delete method")
+//			},
+//			ListFunc: func() ([]models.Invitation, error) {
+//				panic("mock out the List method")
+//			},
+//			RenewFunc: func(id int64) (models.Invitation, error) {
+//				panic("mock out the Renew method")
+//			},
+//		}
+//
+//		// use mockedInvitationService in code that requires models.InvitationService
+//		// and then make assertions.
+//
+//	}
+type InvitationService struct {
+	// AcceptFunc mocks the Accept method.
+	AcceptFunc func(token string, u *models.User) error
+
+	// CreateFunc mocks the Create method.
+	CreateFunc func(inv *models.Invitation) error
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(id int64) error
+
+	// ListFunc mocks the List method.
+	ListFunc func() ([]models.Invitation, error)
+
+	// RenewFunc mocks the Renew method.
+	RenewFunc func(id int64) (models.Invitation, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Accept holds details about calls to the Accept method.
+		Accept []struct {
+			// Token is the token argument value.
+			Token string
+			// U is the u argument value.
+			U *models.User
+		}
+		// Create holds details about calls to the Create method.
+		Create []struct {
+			// Inv is the inv argument value.
+			Inv *models.Invitation
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ID is the id argument value.
+			ID int64
+		}
+		// List holds details about calls to the List method.
+		List []struct {
+		}
+		// Renew holds details about calls to the Renew method.
+		Renew []struct {
+			// ID is the id argument value.
+			ID int64
+		}
+	}
+	lockAccept sync.RWMutex
+	lockCreate sync.RWMutex
+	lockDelete sync.RWMutex
+	lockList   sync.RWMutex
+	lockRenew  sync.RWMutex
+}
+
+// Accept calls AcceptFunc.
+func (mock *InvitationService) Accept(token string, u *models.User) error {
+	if mock.AcceptFunc == nil {
+		panic("InvitationService.AcceptFunc: method is nil but InvitationService.Accept was just called")
+	}
+	callInfo := struct {
+		Token string
+		U     *models.User
+	}{
+		Token: token,
+		U:     u,
+	}
+	mock.lockAccept.Lock()
+	mock.calls.Accept = append(mock.calls.Accept, callInfo)
+	mock.lockAccept.Unlock()
+	return mock.AcceptFunc(token, u)
+}
+
+// AcceptCalls gets all the calls that were made to Accept.
+// Check the length with:
+//
+//	len(mockedInvitationService.AcceptCalls())
+func (mock *InvitationService) AcceptCalls() []struct {
+	Token string
+	U     *models.User
+} {
+	var calls []struct {
+		Token string
+		U     *models.User
+	}
+	mock.lockAccept.RLock()
+	calls = mock.calls.Accept
+	mock.lockAccept.RUnlock()
+	return calls
+}
+
+// Create calls CreateFunc.
+func (mock *InvitationService) Create(inv *models.Invitation) error {
+	if mock.CreateFunc == nil {
+		panic("InvitationService.CreateFunc: method is nil but InvitationService.Create was just called")
+	}
+	callInfo := struct {
+		Inv *models.Invitation
+	}{
+		Inv: inv,
+	}
+	mock.lockCreate.Lock()
+	mock.calls.Create = append(mock.calls.Create, callInfo)
+	mock.lockCreate.Unlock()
+	return mock.CreateFunc(inv)
+}
+
+// CreateCalls gets all the calls that were made to Create.
+// Check the length with:
+//
+//	len(mockedInvitationService.CreateCalls())
+func (mock *InvitationService) CreateCalls() []struct {
+	Inv *models.Invitation
+} {
+	var calls []struct {
+		Inv *models.Invitation
+	}
+	mock.lockCreate.RLock()
+	calls = mock.calls.Create
+	mock.lockCreate.RUnlock()
+	return calls
+}
+
+// Delete calls DeleteFunc.
+func (mock *InvitationService) Delete(id int64) error {
+	if mock.DeleteFunc == nil {
+		panic("InvitationService.DeleteFunc: method is nil but InvitationService.Delete was just called")
+	}
+	callInfo := struct {
+		ID int64
+	}{
+		ID: id,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(id)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedInvitationService.DeleteCalls())
+func (mock *InvitationService) DeleteCalls() []struct {
+	ID int64
+} {
+	var calls []struct {
+		ID int64
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// List calls ListFunc.
+func (mock *InvitationService) List() ([]models.Invitation, error) {
+	if mock.ListFunc == nil {
+		panic("InvitationService.ListFunc: method is nil but InvitationService.List was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc()
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedInvitationService.ListCalls())
+func (mock *InvitationService) ListCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
+
+// Renew calls RenewFunc.
+func (mock *InvitationService) Renew(id int64) (models.Invitation, error) {
+	if mock.RenewFunc == nil {
+		panic("InvitationService.RenewFunc: method is nil but InvitationService.Renew was just called")
+	}
+	callInfo := struct {
+		ID int64
+	}{
+		ID: id,
+	}
+	mock.lockRenew.Lock()
+	mock.calls.Renew = append(mock.calls.Renew, callInfo)
+	mock.lockRenew.Unlock()
+	return mock.RenewFunc(id)
+}
+
+// RenewCalls gets all the calls that were made to Renew.
+// Check the length with:
+//
+//	len(mockedInvitationService.RenewCalls())
+func (mock *InvitationService) RenewCalls() []struct {
+	ID int64
+} {
+	var calls []struct {
+		ID int64
+	}
+	mock.lockRenew.RLock()
+	calls = mock.calls.Renew
+	mock.lockRenew.RUnlock()
+	return calls
+}
@@ -0,0 +1,48 @@
+// Package modelstest provides fakes of the services of package models, to test
+// the code depending on them without a database.
+//
+// The fakes are generated by moq from the service interfaces, see the
+// go:generate directives of package models, and generated again once the
+// interfaces change with:
+//
+//	go generate ./internal/models
+//
+// Fakes are configured with the functions of their fields, one for each method of
+// the service, and panic when a method is called without its function, so tests
+// only provide what they expect to be called:
+//
+//	us := &modelstest.UserService{
+//		ByIDFunc: func(id int64) (models.User, error) {
+//			return models.User{ID: id, Active: true}, nil
+//		},
+//	}
+//
+// The calls made to each method are recorded, and listed by the method named
+// after it with a Calls suffix, like ByIDCalls.
+package modelstest
+
+import "github.com/noelruault/ratingsapp/internal/models"
+
+// Unscoped sets the Scoped function of rs, unless it is provided, to return rs
+// itself, as an unrestricted service. It returns rs.
+func Unscoped(rs *RatingService) *RatingService {
+	if rs.ScopedFunc == nil {
+		rs.ScopedFunc = func(*models.User) models.RatingService {
+			return rs
+		}
+	}
+
+	return rs
+}
+
+// UnscopedCards sets the Scoped function of cs, unless it is provided, to return
+// cs itself, as an unrestricted service. It returns cs.
+func UnscopedCards(cs *CardService) *CardService {
+	if cs.ScopedFunc == nil {
+		cs.ScopedFunc = func(*models.User) models.CardService {
+			return cs
+		}
+	}
+
+	return cs
+}
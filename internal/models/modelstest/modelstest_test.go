@@ -0,0 +1,26 @@
+package modelstest
+
+import (
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakes(t *testing.T) {
+	us := &UserService{
+		ByIDFunc: func(id int64) (models.User, error) {
+			return models.User{ID: id}, nil
+		},
+	}
+
+	u, err := us.ByID(7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), u.ID)
+	assert.Len(t, us.ByIDCalls(), 1)
+	assert.Panics(t, func() { us.ByEmail("rick@sanchez.com") })
+
+	rs := Unscoped(&RatingService{})
+	assert.Same(t, rs, rs.Scoped(&models.User{ID: 7}))
+	assert.Panics(t, func() { rs.ByID(1) })
+}
@@ -0,0 +1,105 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that RetentionService does implement models.RetentionService.
+// If this is not the case, regenerate this file with moq.
+var _ models.RetentionService = &RetentionService{}
+
+// RetentionService is a mock implementation of models.RetentionService.
+//
+//	func TestSomethingThatUsesRetentionService(t *testing.T) {
+//
+//		// make and configure a mocked models.RetentionService
+//		mockedRetentionService := &RetentionService{
+//			LogFunc: func() ([]models.RetentionEntry, error) {
+//				panic("mock out the Log method")
+//			},
+//			PolicyFunc: func() models.RetentionPolicy {
+//				panic("mock out the Policy method")
+//			},
+//		}
+//
+//		// use mockedRetentionService in code that requires models.RetentionService
+//		// and then make assertions.
+//
+//	}
+type RetentionService struct {
+	// LogFunc mocks the Log method.
+	LogFunc func() ([]models.RetentionEntry, error)
+
+	// PolicyFunc mocks the Policy method.
+	PolicyFunc func() models.RetentionPolicy
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Log holds details about calls to the Log method.
+		Log []struct {
+		}
+		// Policy holds details about calls to the Policy method.
+		Policy []struct {
+		}
+	}
+	lockLog    sync.RWMutex
+	lockPolicy sync.RWMutex
+}
+
+// Log calls LogFunc.
+func (mock *RetentionService) Log() ([]models.RetentionEntry, error) {
+	if mock.LogFunc == nil {
+		panic("RetentionService.LogFunc: method is nil but RetentionService.Log was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockLog.Lock()
+	mock.calls.Log = append(mock.calls.Log, callInfo)
+	mock.lockLog.Unlock()
+	return mock.LogFunc()
+}
+
+// LogCalls gets all the calls that were made to Log.
+// Check the length with:
+//
+//	len(mockedRetentionService.LogCalls())
+func (mock *RetentionService) LogCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockLog.RLock()
+	calls = mock.calls.Log
+	mock.lockLog.RUnlock()
+	return calls
+}
+
+// Policy calls PolicyFunc.
+func (mock *RetentionService) Policy() models.RetentionPolicy {
+	if mock.PolicyFunc == nil {
+		panic("RetentionService.PolicyFunc: method is nil but RetentionService.Policy was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockPolicy.Lock()
+	mock.calls.Policy = append(mock.calls.Policy, callInfo)
+	mock.lockPolicy.Unlock()
+	return mock.PolicyFunc()
+}
+
+// PolicyCalls gets all the calls that were made to Policy.
+// Check the length with:
+//
+//	len(mockedRetentionService.PolicyCalls())
+func (mock *RetentionService) PolicyCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockPolicy.RLock()
+	calls = mock.calls.Policy
+	mock.lockPolicy.RUnlock()
+	return calls
+}
@@ -0,0 +1,301 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that RoleService does implement models.RoleService.
+// If this is not the case, regenerate this file with moq.
+var _ models.RoleService = &RoleService{}
+
+// RoleService is a mock implementation of models.RoleService.
+//
+//	func TestSomethingThatUsesRoleService(t *testing.T) {
+//
+//		// make and configure a mocked models.RoleService
+//		mockedRoleService := &RoleService{
+//			ByIDFunc: func(n int64) (models.Role, error) {
+//				panic("mock out the ByID method")
+//			},
+//			ByIDsFunc: func(int64s ...int64) ([]models.Role, error) {
+//				panic("mock out the ByIDs method")
+//			},
+//			CreateFunc: func(role *models.Role) error {
+//				panic("mock out the Create method")
+//			},
+//			DeleteFunc: func(n int64) error {
+//				panic("mock out the Delete method")
+//			},
+//			UpdateFunc: func(role *models.Role) error {
+//				panic("mock out the Update method")
+//			},
+//			UpdatePartialFunc: func(r *models.Role, patch []byte) error {
+//				panic("mock out the UpdatePartial method")
+//			},
+//		}
+//
+//		// use mockedRoleService in code that requires models.RoleService
+//		// and then make assertions.
+//
+//	}
+type RoleService struct {
+	// ByIDFunc mocks the ByID method.
+	ByIDFunc func(n int64) (models.Role, error)
+
+	// ByIDsFunc mocks the ByIDs method.
+	ByIDsFunc func(int64s ...int64) ([]models.Role, error)
+
+	// CreateFunc mocks the Create method.
+	CreateFunc func(role *models.Role) error
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(n int64) error
+
+	// UpdateFunc mocks the Update method.
+	UpdateFunc func(role *models.Role) error
+
+	// UpdatePartialFunc mocks the UpdatePartial method.
+	UpdatePartialFunc func(r *models.Role, patch []byte) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// ByID holds details about calls to the ByID method.
+		ByID []struct {
+			// N is the n argument value.
+			N int64
+		}
+		// ByIDs holds details about calls to the ByIDs method.
+		ByIDs []struct {
+			// Int64s is the int64s argument value.
+			Int64s []int64
+		}
+		// Create holds details about calls to the Create method.
+		Create []struct {
+			// Role is the role argument value.
+			Role *models.Role
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// N is the n argument value.
+			N int64
+		}
+		// Update holds details about calls to the Update method.
+		Update []struct {
+			// Role is the role argument value.
+			Role *models.Role
+		}
+		// UpdatePartial holds details about calls to the UpdatePartial method.
+		UpdatePartial []struct {
+			// R is the r argument value.
+			R *models.Role
+			// Patch is the patch argument value.
+			Patch []byte
+		}
+	}
+	lockByID          sync.RWMutex
+	lockByIDs         sync.RWMutex
+	lockCreate        sync.RWMutex
+	lockDelete        sync.RWMutex
+	lockUpdate        sync.RWMutex
+	lockUpdatePartial sync.RWMutex
+}
+
+// ByID calls ByIDFunc.
+func (mock *RoleService) ByID(n int64) (models.Role, error) {
+	if mock.ByIDFunc == nil {
+		panic("RoleService.ByIDFunc: method is nil but RoleService.ByID was just called")
+	}
+	callInfo := struct {
+		N int64
+	}{
+		N: n,
+	}
+	mock.lockByID.Lock()
+	mock.calls.ByID = append(mock.calls.ByID, callInfo)
+	mock.lockByID.Unlock()
+	return mock.ByIDFunc(n)
+}
+
+// ByIDCalls gets all the calls that were made to ByID.
+// Check the length with:
+//
+//	len(mockedRoleService.ByIDCalls())
+func (mock *RoleService) ByIDCalls() []struct {
+	N int64
+} {
+	var calls []struct {
+		N int64
+	}
+	mock.lockByID.RLock()
+	calls = mock.calls.ByID
+	mock.lockByID.RUnlock()
+	return calls
+}
+
+// ByIDs calls ByIDsFunc.
+func (mock *RoleService) ByIDs(int64s ...int64) ([]models.Role, error) {
+	if mock.ByIDsFunc == nil {
+		panic("RoleService.ByIDsFunc: method is nil but RoleService.ByIDs was just called")
+	}
+	callInfo := struct {
+		Int64s []int64
+	}{
+		Int64s: int64s,
+	}
+	mock.lockByIDs.Lock()
+	mock.calls.ByIDs = append(mock.calls.ByIDs, callInfo)
+	mock.lockByIDs.Unlock()
+	return mock.ByIDsFunc(int64s...)
+}
+
+// ByIDsCalls gets all the calls that were made to ByIDs.
+// Check the length with:
+//
+//	len(mockedRoleService.ByIDsCalls())
+func (mock *RoleService) ByIDsCalls() []struct {
+	Int64s []int64
+} {
+	var calls []struct {
+		Int64s []int64
+	}
+	mock.lockByIDs.RLock()
+	calls = mock.calls.ByIDs
+	mock.lockByIDs.RUnlock()
+	return calls
+}
+
+// Create calls CreateFunc.
+func (mock *RoleService) Create(role *models.Role) error {
+	if mock.CreateFunc == nil {
+		panic("RoleService.CreateFunc: method is nil but RoleService.Create was just called")
+	}
+	callInfo := struct {
+		Role *models.Role
+	}{
+		Role: role,
+	}
+	mock.lockCreate.Lock()
+	mock.calls.Create = append(mock.calls.Create, callInfo)
+	mock.lockCreate.Unlock()
+	return mock.CreateFunc(role)
+}
+
+// CreateCalls gets all the calls that were made to Create.
+// Check the length with:
+//
+//	len(mockedRoleService.CreateCalls())
+func (mock *RoleService) CreateCalls() []struct {
+	Role *models.Role
+} {
+	var calls []struct {
+		Role *models.Role
+	}
+	mock.lockCreate.RLock()
+	calls = mock.calls.Create
+	mock.lockCreate.RUnlock()
+	return calls
+}
+
+// Delete calls DeleteFunc.
+func (mock *RoleService) Delete(n int64) error {
+	if mock.DeleteFunc == nil {
+		panic("RoleService.DeleteFunc: method is nil but RoleService.Delete was just called")
+	}
+	callInfo := struct {
+		N int64
+	}{
+		N: n,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(n)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedRoleService.DeleteCalls())
+func (mock *RoleService) DeleteCalls() []struct {
+	N int64
+} {
+	var calls []struct {
+		N int64
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// Update calls UpdateFunc.
+func (mock *RoleService) Update(role *models.Role) error {
+	if mock.UpdateFunc == nil {
+		panic("RoleService.UpdateFunc: method is nil but RoleService.Update was just called")
+	}
+	callInfo := struct {
+		Role *models.Role
+	}{
+		Role: role,
+	}
+	mock.lockUpdate.Lock()
+	mock.calls.Update = append(mock.calls.Update, callInfo)
+	mock.lockUpdate.Unlock()
+	return mock.UpdateFunc(role)
+}
+
+// UpdateCalls gets all the calls that were made to Update.
+// Check the length with:
+//
+//	len(mockedRoleService.UpdateCalls())
+func (mock *RoleService) UpdateCalls() []struct {
+	Role *models.Role
+} {
+	var calls []struct {
+		Role *models.Role
+	}
+	mock.lockUpdate.RLock()
+	calls = mock.calls.Update
+	mock.lockUpdate.RUnlock()
+	return calls
+}
+
+// UpdatePartial calls UpdatePartialFunc.
+func (mock *RoleService) UpdatePartial(r *models.Role, patch []byte) error {
+	if mock.UpdatePartialFunc == nil {
+		panic("RoleService.UpdatePartialFunc: method is nil but RoleService.UpdatePartial was just called")
+	}
+	callInfo := struct {
+		R     *models.Role
+		Patch []byte
+	}{
+		R:     r,
+		Patch: patch,
+	}
+	mock.lockUpdatePartial.Lock()
+	mock.calls.UpdatePartial = append(mock.calls.UpdatePartial, callInfo)
+	mock.lockUpdatePartial.Unlock()
+	return mock.UpdatePartialFunc(r, patch)
+}
+
+// UpdatePartialCalls gets all the calls that were made to UpdatePartial.
+// Check the length with:
+//
+//	len(mockedRoleService.UpdatePartialCalls())
+func (mock *RoleService) UpdatePartialCalls() []struct {
+	R     *models.Role
+	Patch []byte
+} {
+	var calls []struct {
+		R     *models.Role
+		Patch []byte
+	}
+	mock.lockUpdatePartial.RLock()
+	calls = mock.calls.UpdatePartial
+	mock.lockUpdatePartial.RUnlock()
+	return calls
+}
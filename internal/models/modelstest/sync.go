@@ -0,0 +1,75 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package modelstest
+
+import (
+	"github.com/noelruault/ratingsapp/internal/models"
+	"sync"
+)
+
+// Ensure, that SyncService does implement models.SyncService.
+// If this is not the case, regenerate this file with moq.
+var _ models.SyncService = &SyncService{}
+
+// SyncService is a mock implementation of models.SyncService.
+//
+//	func TestSomethingThatUsesSyncService(t *testing.T) {
+//
+//		// make and configure a mocked models.SyncService
+//		mockedSyncService := &SyncService{
+//			ChangesFunc: func(q *models.SyncQuery) (models.Changes, error) {
+//				panic("mock out the Changes method")
+//			},
+//		}
+//
+//		// use mockedSyncService in code that requires models.SyncService
+//		// and then make assertions.
+//
+//	}
+type SyncService struct {
+	// ChangesFunc mocks the Changes method.
+	ChangesFunc func(q *models.SyncQuery) (models.Changes, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Changes holds details about calls to the Changes method.
+		Changes []struct {
+			// Q is the q argument value.
+			Q *models.SyncQuery
+		}
+	}
+	lockChanges sync.RWMutex
+}
+
+// Changes calls ChangesFunc.
+func (mock *SyncService) Changes(q *models.SyncQuery) (models.Changes, error) {
+	if mock.ChangesFunc == nil {
+		panic("SyncService.ChangesFunc: method is nil but SyncService.Changes was just called")
+	}
+	callInfo := struct {
+		Q *models.SyncQuery
+	}{
+		Q: q,
+	}
+	mock.lockChanges.Lock()
+	mock.calls.Changes = append(mock.calls.Changes, callInfo)
+	mock.lockChanges.Unlock()
+	return mock.ChangesFunc(q)
+}
+
+// ChangesCalls gets all the calls that were made to Changes.
+// Check the length with:
+//
+//	len(mockedSyncService.ChangesCalls())
+func (mock *SyncService) ChangesCalls() []struct {
+	Q *models.SyncQuery
+} {
+	var calls []struct {
+		Q *models.SyncQuery
+	}
+	mock.lockChanges.RLock()
+	calls = mock.calls.Changes
+	mock.lockChanges.RUnlock()
+	return calls
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/events"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/notifications.go -pkg modelstest . NotificationService:NotificationService
+
+// NotificationService defines a set of methods to be used when dealing with the
+// inbox of the users: the in-app notifications of the targets they follow, and
+// of the replies to their ratings and their moderation.
+type NotificationService interface {
+	NotificationDB
+}
+
+// NotificationDB defines how the service interacts with the database.
+type NotificationDB interface {
+	// List retrieves the latest in-app notifications of a user, newest
+	// first, only the ones not read yet if unread is true.
+	List(userID int64, unread bool) ([]Notification, error)
+
+	// MarkRead marks a notification of a user as read, and returns it.
+	// Notifications read already keep the time they were first read.
+	// ErrNotFound is returned if the user has no such notification.
+	MarkRead(userID, id int64) (Notification, error)
+
+	// MarkAllRead marks every notification of a user as read, and
+	// returns the number of notifications that were not read yet.
+	MarkAllRead(userID int64) (int64, error)
+}
+
+// settingsNotifications is the member of the settings of the users holding their
+// notification preferences, see notificationPreferences.
+const settingsNotifications = "notifications"
+
+// notificationPreferences are the notifications the authors of the ratings
+// receive in their inbox, as set in the "notifications" member of their
+// settings, like {"notifications": {"replies": false}}. The notifications
+// missing are received.
+type notificationPreferences struct {
+	Replies    *bool `json:"replies"`
+	Moderation *bool `json:"moderation"`
+}
+
+// preferences returns the notification preferences of the settings of a user.
+// Settings that can't be read receive every notification.
+func preferences(settings json.RawMessage) notificationPreferences {
+	var s map[string]json.RawMessage
+	if json.Unmarshal(settings, &s) != nil {
+		return notificationPreferences{}
+	}
+
+	var p notificationPreferences
+	if json.Unmarshal(s[settingsNotifications], &p) != nil {
+		return notificationPreferences{}
+	}
+
+	return p
+}
+
+// receives reports whether the notifications of kind are received.
+func (p notificationPreferences) receives(kind string) bool {
+	pref := p.Moderation
+	if kind == NotificationReply {
+		pref = p.Replies
+	}
+
+	return pref == nil || *pref
+}
+
+type notificationService struct {
+	NotificationDB
+}
+
+// NewNotificationService instantiates a new NotificationService implementation
+// with db as the backing database.
+func NewNotificationService(db *gorm.DB) NotificationService {
+	return newNotificationService(db, SystemClock)
+}
+
+// newNotificationService instantiates a new NotificationService
+// implementation, as NewNotificationService does, telling the time the
+// notifications are read with clock.
+func newNotificationService(db *gorm.DB, clock Clock) NotificationService {
+	return &notificationService{
+		NotificationDB: &notificationValidator{
+			NotificationDB: &notificationGorm{db: db, clock: clock},
+		},
+	}
+}
+
+type notificationValidator struct {
+	NotificationDB
+}
+
+func (nv *notificationValidator) MarkRead(userID, id int64) (Notification, error) {
+	if userID < 1 || id < 1 {
+		return Notification{}, ErrNotFound
+	}
+
+	return nv.NotificationDB.MarkRead(userID, id)
+}
+
+type notificationGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (ng *notificationGorm) List(userID int64, unread bool) ([]Notification, error) {
+	db := ng.db.Where("user_id = ?", userID)
+	if unread {
+		db = db.Where("read_at IS NULL")
+	}
+
+	ns := []Notification{}
+	err := db.Order("id DESC").Limit(maxNotifications).Find(&ns).Error
+	if err != nil {
+		return nil, with(wrap("could not list notifications", err), "user_id", userID)
+	}
+
+	return ns, nil
+}
+
+func (ng *notificationGorm) MarkRead(userID, id int64) (Notification, error) {
+	err := ng.db.Model(&Notification{}).Where("id = ? AND user_id = ? AND read_at IS NULL", id, userID).
+		UpdateColumn("read_at", ng.clock.Now()).Error
+	if err != nil {
+		return Notification{}, with(wrap("could not mark notification as read", err), "id", id)
+	}
+
+	var n Notification
+	err = ng.db.Where("id = ? AND user_id = ?", id, userID).First(&n).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Notification{}, ErrNotFound
+	} else if err != nil {
+		return Notification{}, with(wrap("could not get notification", err), "id", id)
+	}
+
+	return n, nil
+}
+
+func (ng *notificationGorm) MarkAllRead(userID int64) (int64, error) {
+	res := ng.db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).
+		UpdateColumn("read_at", ng.clock.Now())
+	if res.Error != nil {
+		return 0, with(wrap("could not mark notifications as read", res.Error), "user_id", userID)
+	}
+
+	return res.RowsAffected, nil
+}
+
+// inbox notifies the authors of the ratings, in the application, of the replies
+// to them and of their moderation, as published to the event bus.
+type inbox struct {
+	db    *gorm.DB
+	clock Clock
+
+	// ratings computes the averages of the targets.
+	ratings RatingDB
+	onError func(error)
+}
+
+// handle is the events.Handler of the inbox.
+func (ib *inbox) handle(e events.Event) {
+	var err error
+	switch d := e.Data.(type) {
+	case Reply:
+		err = ib.replied(d)
+	case Rating:
+		err = ib.moderated(d)
+	}
+
+	if err != nil && ib.onError != nil {
+		ib.onError(err)
+	}
+}
+
+// replied notifies the author of the rating replied to by rp, unless they wrote
+// the reply.
+func (ib *inbox) replied(rp Reply) error {
+	var r Rating
+	err := ib.db.First(&r, rp.RatingID).Error
+	if gorm.IsRecordNotFoundError(err) {
+		// deleted since
+		return nil
+	} else if err != nil {
+		return with(wrap("could not get the rating replied to", err), "rating_id", rp.RatingID)
+	}
+
+	if r.UserID == rp.AuthorID {
+		return nil
+	}
+
+	return ib.notify(r, NotificationReply, &rp.ID)
+}
+
+// moderated notifies the author of r of the outcome of its moderation, unless
+// they moderated it.
+func (ib *inbox) moderated(r Rating) error {
+	var m Moderation
+	err := ib.db.Where("rating_id = ?", r.ID).First(&m).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	} else if err != nil {
+		return with(wrap("could not get moderation", err), "rating_id", r.ID)
+	}
+
+	if m.ModeratorID == r.UserID {
+		return nil
+	}
+
+	kind := NotificationRatingApproved
+	if m.Outcome == ModerationRemoved {
+		kind = NotificationRatingRemoved
+	}
+
+	return ib.notify(r, kind, nil)
+}
+
+// notify saves a notification of kind about r for its author, if they are
+// active and receive it.
+func (ib *inbox) notify(r Rating, kind string, replyID *int64) error {
+	var u User
+	err := ib.db.First(&u, r.UserID).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	} else if err != nil {
+		return with(wrap("could not get the author of the rating", err), "user_id", r.UserID)
+	}
+
+	if !u.Active || !preferences(u.Settings).receives(kind) {
+		return nil
+	}
+
+	stats, err := ib.ratings.StatsByTarget(r.Target)
+	if err != nil {
+		return err
+	}
+
+	n := Notification{
+		UserID:    u.ID,
+		Kind:      kind,
+		Target:    r.Target,
+		RatingID:  &r.ID,
+		Score:     &r.Score,
+		ReplyID:   replyID,
+		Average:   stats.Average,
+		CreatedAt: ib.clock.Now(),
+	}
+	err = ib.db.Create(&n).Error
+	if err != nil {
+		return with(wrap("could not save notification", err), "user_id", u.ID)
+	}
+
+	return nil
+}
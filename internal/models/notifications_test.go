@@ -0,0 +1,120 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationPreferences(t *testing.T) {
+	var cases = []struct {
+		name       string
+		settings   string
+		replies    bool
+		moderation bool
+	}{
+		{"none", ``, true, true},
+		{"noMember", `{"theme":"dark"}`, true, true},
+		{"repliesOff", `{"notifications":{"replies":false}}`, false, true},
+		{"moderationOff", `{"notifications":{"replies":true,"moderation":false}}`, true, false},
+		{"invalid", `{"notifications":"off"}`, true, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := preferences(json.RawMessage(tc.settings))
+			assert.Equal(t, tc.replies, p.receives(NotificationReply))
+			assert.Equal(t, tc.moderation, p.receives(NotificationRatingApproved))
+			assert.Equal(t, tc.moderation, p.receives(NotificationRatingRemoved))
+		})
+	}
+}
+
+func TestNotificationValidator(t *testing.T) {
+	ns := NewNotificationService(nil)
+
+	_, err := ns.MarkRead(1, 0)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = ns.MarkRead(0, 1)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestReplyEvents(t *testing.T) {
+	bus := events.NewBus(0)
+
+	var got []events.Event
+	bus.Subscribe(func(e events.Event) { got = append(got, e) })
+
+	ps := newReplyEvents(NewReplyService(nil), bus)
+	assert.Error(t, ps.Create(&Reply{RatingID: 1}))
+	bus.Close()
+
+	assert.Empty(t, got, "must not publish the replies not created")
+}
+
+func TestInbox(t *testing.T) {
+	db := setupGorm(t)
+	ns := NewNotificationService(db)
+	ib := &inbox{db: db, clock: SystemClock, ratings: &ratingGorm{db: db}}
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh", Active: true}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh", Active: true,
+		Settings: json.RawMessage(`{"notifications":{"replies":false}}`)}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 9, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 11, Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 9, UserID: 99}).Error)
+
+	reply := Reply{RatingID: 10, AuthorID: 1, Body: "Thanks"}
+	require.NoError(t, db.Create(&reply).Error)
+	ib.handle(events.Event{Type: events.ReplyCreated, Data: reply})
+	ib.handle(events.Event{Type: events.ReplyCreated, Data: Reply{ID: reply.ID, RatingID: 10, AuthorID: 98}})
+
+	ns98, err := ns.List(98, false)
+	require.NoError(t, err)
+	require.Len(t, ns98, 1, "authors must not be notified of their own replies")
+	assert.Equal(t, NotificationReply, ns98[0].Kind)
+	assert.Equal(t, int64(10), *ns98[0].RatingID)
+	assert.Equal(t, reply.ID, *ns98[0].ReplyID)
+	assert.Equal(t, float64(3), ns98[0].Average)
+
+	other := Reply{RatingID: 11, AuthorID: 1, Body: "Sorry"}
+	require.NoError(t, db.Create(&other).Error)
+	ib.handle(events.Event{Type: events.ReplyCreated, Data: other})
+
+	require.NoError(t, db.Create(&Moderation{RatingID: 11, UserID: 99, Outcome: ModerationRemoved, ModeratorID: 1}).Error)
+	ib.handle(events.Event{Type: events.RatingModerated, Data: Rating{ID: 11, Score: 2, Target: 9, UserID: 99}})
+
+	ns99, err := ns.List(99, false)
+	require.NoError(t, err)
+	require.Len(t, ns99, 1, "the replies must not be notified when disabled")
+	assert.Equal(t, NotificationRatingRemoved, ns99[0].Kind)
+
+	t.Run("markRead", func(t *testing.T) {
+		n, err := ns.MarkRead(98, ns98[0].ID)
+		require.NoError(t, err)
+		require.NotNil(t, n.ReadAt)
+
+		again, err := ns.MarkRead(98, ns98[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, n.ReadAt, again.ReadAt, "must keep the time it was first read")
+
+		_, err = ns.MarkRead(99, ns98[0].ID)
+		assert.Equal(t, ErrNotFound, err, "must not mark the notifications of others")
+
+		unread, err := ns.List(98, true)
+		require.NoError(t, err)
+		assert.Empty(t, unread)
+	})
+
+	t.Run("markAllRead", func(t *testing.T) {
+		count, err := ns.MarkAllRead(99)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		count, err = ns.MarkAllRead(99)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
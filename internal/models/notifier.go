@@ -0,0 +1,204 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/events"
+)
+
+// A NotificationSender delivers the notifications of a channel outside of the
+// application, like ChannelEmail. See Config.Notifiers.
+type NotificationSender interface {
+	// Send delivers n to u, who subscribed to its target with s.
+	Send(u User, s Subscription, n Notification) error
+}
+
+// notifier notifies the followers of a target of the ratings created and
+// updated for it, as published to the event bus.
+type notifier struct {
+	db *gorm.DB
+
+	// ratings computes the averages of the targets, with the ratings held
+	// back by the probation excluded.
+	ratings   RatingDB
+	policy    visibilityPolicy
+	probation probation
+
+	// senders deliver the notifications of the channels other than
+	// ChannelInApp.
+	senders map[string]NotificationSender
+	onError func(error)
+}
+
+// handle is the events.Handler of the notifier.
+func (n *notifier) handle(e events.Event) {
+	r, ok := e.Data.(Rating)
+	if !ok {
+		return
+	}
+
+	err := n.notify(r, e.Type == events.RatingCreated, e.ID)
+	if err != nil && n.onError != nil {
+		n.onError(err)
+	}
+}
+
+// notify notifies the followers of the target of r, which was just created or
+// updated, as reported by the event with ID eventID. The followers are not
+// notified of their own ratings, nor of the ratings they can't read, or held
+// back by the probation.
+func (n *notifier) notify(r Rating, created bool, eventID string) error {
+	sg := &subscriptionGorm{db: n.db, ratings: n.ratings}
+	subs, err := sg.ByTarget(r.Target)
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+
+	stats, err := n.ratings.StatsByTarget(r.Target)
+	if err != nil {
+		return err
+	}
+
+	followers, err := n.followers(subs)
+	if err != nil {
+		return err
+	}
+
+	// whether r is visible to each role
+	visible := make(map[int64]bool)
+	var firstErr error
+	for _, s := range subs {
+		u, ok := followers[s.UserID]
+		if !ok || !u.Active || u.ID == r.UserID {
+			continue
+		}
+
+		v, ok := visible[u.RoleID]
+		if !ok {
+			v, err = n.visible(r, u.RoleID)
+			if err != nil {
+				return err
+			}
+			visible[u.RoleID] = v
+		}
+		if !v {
+			continue
+		}
+
+		for _, kind := range notifications(s, stats.Average, created) {
+			nt := Notification{
+				UserID:    u.ID,
+				Kind:      kind,
+				Target:    r.Target,
+				RatingID:  &r.ID,
+				Score:     &r.Score,
+				Average:   stats.Average,
+				EventID:   eventID,
+				CreatedAt: n.probation.now(),
+			}
+			err = n.deliver(u, s, nt)
+			if err != nil && s.Channel == ChannelWebhook {
+				// retried by Services.RetryWebhooks
+				if qerr := n.queueWebhook(s, nt, err); qerr != nil {
+					err = qerr
+				}
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	// thresholds are crossed from the average notified
+	err = n.db.Model(&Subscription{}).Where("target = ?", r.Target).
+		UpdateColumn("last_average", stats.Average).Error
+	if err != nil {
+		return with(wrap("could not update subscriptions", err), "target", r.Target)
+	}
+
+	return firstErr
+}
+
+// notifications returns the kinds of notifications s gets for a rating, given the
+// average of the target after it.
+func notifications(s Subscription, average float64, created bool) []string {
+	var kinds []string
+	if s.NewRatings && created {
+		kinds = append(kinds, NotificationNewRating)
+	}
+
+	if s.LastAverage == nil {
+		return kinds
+	}
+
+	if s.AverageBelow != nil && *s.LastAverage >= *s.AverageBelow && average < *s.AverageBelow {
+		kinds = append(kinds, NotificationAverageBelow)
+	}
+	if s.AverageAbove != nil && *s.LastAverage <= *s.AverageAbove && average > *s.AverageAbove {
+		kinds = append(kinds, NotificationAverageAbove)
+	}
+
+	return kinds
+}
+
+// followers retrieves the users of subs, by ID.
+func (n *notifier) followers(subs []Subscription) (map[int64]User, error) {
+	ids := make([]int64, len(subs))
+	for i, s := range subs {
+		ids[i] = s.UserID
+	}
+
+	var users []User
+	err := n.db.Where("id IN (?)", ids).Find(&users).Error
+	if err != nil {
+		return nil, wrap("could not get followers", err)
+	}
+
+	followers := make(map[int64]User, len(users))
+	for _, u := range users {
+		followers[u.ID] = u
+	}
+
+	return followers, nil
+}
+
+// visible reports whether the users of a role can read r, and it is not held
+// back by the probation.
+func (n *notifier) visible(r Rating, roleID int64) (bool, error) {
+	db := n.probation.counted(n.db.Model(&Rating{}).Where("id = ? AND active", r.ID))
+	if scope := n.policy.scope(roleID); scope != nil {
+		db = db.Scopes(scope)
+	}
+
+	var count int
+	err := db.Count(&count).Error
+	if err != nil {
+		return false, with(wrap("could not check rating visibility", err), "id", r.ID)
+	}
+
+	return count > 0, nil
+}
+
+// deliver delivers nt through the channel of s. Notifications of channels
+// without a sender, which were disabled after s was created, are discarded.
+func (n *notifier) deliver(u User, s Subscription, nt Notification) error {
+	if s.Channel == ChannelInApp {
+		err := n.db.Create(&nt).Error
+		if err != nil {
+			return with(wrap("could not save notification", err), "user_id", u.ID)
+		}
+
+		return nil
+	}
+
+	sender, ok := n.senders[s.Channel]
+	if !ok {
+		return nil
+	}
+
+	err := sender.Send(u, s, nt)
+	if err != nil {
+		return with(wrap("could not send notification", err), "channel", s.Channel, "user_id", u.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,569 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/organisations.go -pkg modelstest . OrganisationService:OrganisationService
+
+// OrganisationService defines a set of methods used to manage the
+// organisations, the isolated workspaces of the customers served by a single
+// deployment. The users, roles, ratings and campaigns of an organisation are
+// only reached by its own users, see Services.InRequest, while the users of no
+// organisation, the operators of the deployment, reach all of them.
+type OrganisationService interface {
+	// Create adds an organisation. The Name field is mandatory, and
+	// unique. On success, ID and CreatedAt are set.
+	Create(o *Organisation) error
+
+	// Update renames the organisation with ID o.ID. On success,
+	// CreatedAt is set.
+	Update(o *Organisation) error
+
+	// Delete removes an organisation by ID. ErrInUse is returned while
+	// it has users, roles, ratings or campaigns.
+	Delete(id int64) error
+
+	// ByID retrieves an organisation by ID.
+	ByID(id int64) (Organisation, error)
+
+	// List retrieves the organisations, sorted by name.
+	List() ([]Organisation, error)
+}
+
+// An Organisation is the workspace of a customer, whose users only reach its
+// own users, roles and ratings. The roles of no organisation, like the system
+// roles, are shared by all of them.
+type Organisation struct {
+	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
+
+	// Name uniquely identifies the organisation, like the name of the
+	// customer.
+	Name string `gorm:"size:255;not null" json:"name"`
+
+	// CreatedAt is the time the organisation was created. Any input
+	// value will be ignored.
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// NewOrganisationService instantiates a new OrganisationService implementation
+// with db as the backing database.
+func NewOrganisationService(db *gorm.DB) OrganisationService {
+	return &organisationValidator{
+		OrganisationService: &organisationGorm{db: db},
+	}
+}
+
+type organisationContextKey struct{}
+
+// WithOrganisation returns a copy of ctx carrying the organisation of the user
+// making a request, see OrganisationFrom.
+func WithOrganisation(ctx context.Context, org int64) context.Context {
+	return context.WithValue(ctx, organisationContextKey{}, org)
+}
+
+// OrganisationFrom returns the ID of the organisation carried by ctx, or zero
+// if there is none, like in the requests of the users of no organisation.
+func OrganisationFrom(ctx context.Context) int64 {
+	org, _ := ctx.Value(organisationContextKey{}).(int64)
+	return org
+}
+
+// orgID returns the ID of the organisation org, zero if nil.
+func orgID(org *int64) int64 {
+	if org == nil {
+		return 0
+	}
+
+	return *org
+}
+
+// sameOrganisation tells whether a and b are the same organisation, nil being
+// no organisation.
+func sameOrganisation(a, b *int64) bool {
+	return orgID(a) == orgID(b)
+}
+
+type organisationValidator struct {
+	OrganisationService
+}
+
+func (ov *organisationValidator) Create(o *Organisation) error {
+	o.ID = 0
+
+	err := ov.validate(o)
+	if err != nil {
+		return err
+	}
+
+	return ov.OrganisationService.Create(o)
+}
+
+func (ov *organisationValidator) Update(o *Organisation) error {
+	if o.ID < 1 {
+		return ErrNotFound
+	}
+
+	err := ov.validate(o)
+	if err != nil {
+		return err
+	}
+
+	return ov.OrganisationService.Update(o)
+}
+
+func (ov *organisationValidator) Delete(id int64) error {
+	if id < 1 {
+		return ErrNotFound
+	}
+
+	return ov.OrganisationService.Delete(id)
+}
+
+func (ov *organisationValidator) ByID(id int64) (Organisation, error) {
+	if id < 1 {
+		return Organisation{}, ErrNotFound
+	}
+
+	return ov.OrganisationService.ByID(id)
+}
+
+// validate normalises the name of o, and checks it.
+func (ov *organisationValidator) validate(o *Organisation) error {
+	o.Name = strings.TrimSpace(o.Name)
+
+	switch {
+	case o.Name == "":
+		return ValidationError{"name": ErrRequired}
+	case len(o.Name) > 255:
+		return ValidationError{"name": ErrTooLong}
+	}
+
+	return nil
+}
+
+type organisationGorm struct {
+	db *gorm.DB
+}
+
+func (og *organisationGorm) Create(o *Organisation) error {
+	err := og.db.Raw("INSERT INTO organisations (name) VALUES (?) RETURNING id, created_at", o.Name).
+		Row().
+		Scan(&o.ID, &o.CreatedAt)
+	if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "unique_violation" {
+		return ValidationError{"name": ErrDuplicate}
+	} else if err != nil {
+		return with(wrap("could not create organisation", err), "name", o.Name)
+	}
+
+	return nil
+}
+
+func (og *organisationGorm) Update(o *Organisation) error {
+	err := og.db.Raw("UPDATE organisations SET name = ? WHERE id = ? RETURNING created_at", o.Name, o.ID).
+		Row().
+		Scan(&o.CreatedAt)
+	if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "unique_violation" {
+		return ValidationError{"name": ErrDuplicate}
+	} else if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return with(wrap("could not update organisation", err), "org_id", o.ID)
+	}
+
+	return nil
+}
+
+func (og *organisationGorm) Delete(id int64) error {
+	res := og.db.Exec("DELETE FROM organisations WHERE id = ?", id)
+	if res.Error != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ErrInUse
+		}
+		return with(wrap("could not delete organisation", res.Error), "org_id", id)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (og *organisationGorm) ByID(id int64) (Organisation, error) {
+	var o Organisation
+	err := og.db.Where("id = ?", id).First(&o).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Organisation{}, ErrNotFound
+	} else if err != nil {
+		return Organisation{}, with(wrap("could not get organisation", err), "org_id", id)
+	}
+
+	return o, nil
+}
+
+func (og *organisationGorm) List() ([]Organisation, error) {
+	organisations := []Organisation{}
+	err := og.db.Order("name").Find(&organisations).Error
+	if err != nil {
+		return nil, wrap("could not list organisations", err)
+	}
+
+	return organisations, nil
+}
+
+// userOrganisation is a UserService decorator serving the requests of the users
+// of an organisation: the users of the other organisations, and of none, are not
+// found, and the users created join the organisation. The roles of the users
+// are checked by the RoleService of the organisation, see roleOrganisation.
+type userOrganisation struct {
+	UserService
+	org int64
+}
+
+// member returns ErrNotFound if the user with the given ID is not a user of
+// the organisation.
+func (uo *userOrganisation) member(id int64) error {
+	_, err := uo.ByID(id)
+	return err
+}
+
+func (uo *userOrganisation) Sessions(userID int64) ([]Session, error) {
+	if err := uo.member(userID); err != nil {
+		return nil, err
+	}
+
+	return uo.UserService.Sessions(userID)
+}
+
+func (uo *userOrganisation) RevokeSession(userID int64, id string) error {
+	if err := uo.member(userID); err != nil {
+		return err
+	}
+
+	return uo.UserService.RevokeSession(userID, id)
+}
+
+func (uo *userOrganisation) RevokeSessions(userID int64) error {
+	if err := uo.member(userID); err != nil {
+		return err
+	}
+
+	return uo.UserService.RevokeSessions(userID)
+}
+
+func (uo *userOrganisation) Deactivate(id int64) error {
+	if err := uo.member(id); err != nil {
+		return err
+	}
+
+	return uo.UserService.Deactivate(id)
+}
+
+func (uo *userOrganisation) Activate(id int64) error {
+	if err := uo.member(id); err != nil {
+		return err
+	}
+
+	return uo.UserService.Activate(id)
+}
+
+func (uo *userOrganisation) SetActive(id int64, active bool) error {
+	if err := uo.member(id); err != nil {
+		return err
+	}
+
+	return uo.UserService.SetActive(id, active)
+}
+
+func (uo *userOrganisation) Create(u *User) error {
+	org := uo.org
+	u.OrgID = &org
+
+	return uo.UserService.Create(u)
+}
+
+func (uo *userOrganisation) Update(u *User) error {
+	if err := uo.member(u.ID); err != nil {
+		return err
+	}
+
+	return uo.UserService.Update(u)
+}
+
+func (uo *userOrganisation) UpdatePartial(u *User, patch []byte) error {
+	if err := uo.member(u.ID); err != nil {
+		return err
+	}
+
+	return uo.UserService.UpdatePartial(u, patch)
+}
+
+func (uo *userOrganisation) Delete(id int64) error {
+	if err := uo.member(id); err != nil {
+		return err
+	}
+
+	return uo.UserService.Delete(id)
+}
+
+func (uo *userOrganisation) DeleteWith(id int64, d UserDeletion) error {
+	if err := uo.member(id); err != nil {
+		return err
+	}
+
+	// the ratings are only reassigned to a user of the organisation
+	if d.Ratings == RatingsReassign && d.ReassignTo != 0 {
+		if err := uo.member(d.ReassignTo); xerrors.Is(err, ErrNotFound) {
+			return ValidationError{"reassignTo": ErrRefNotFound}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return uo.UserService.DeleteWith(id, d)
+}
+
+// AssignRole assigns the role to the users of the organisation with the given
+// IDs, the other ones are reported as not found.
+func (uo *userOrganisation) AssignRole(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+	if len(ids) == 0 {
+		return uo.UserService.AssignRole(roleID, ids...)
+	}
+
+	roles := false
+	members, err := uo.UserService.Search(SearchQuery{IDs: ids, OrgID: uo.org, Roles: &roles})
+	if err != nil {
+		return nil, err
+	}
+
+	member := make(map[int64]bool, len(members))
+	for _, u := range members {
+		member[u.ID] = true
+	}
+
+	var results []RoleAssignment
+	assign := make([]int64, 0, len(members))
+	for _, id := range ids {
+		if member[id] {
+			assign = append(assign, id)
+		} else if id > 0 {
+			results = append(results, failedAssignment(id, ErrNotFound))
+		}
+	}
+
+	if len(assign) > 0 || len(results) == 0 {
+		assigned, err := uo.UserService.AssignRole(roleID, assign...)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, assigned...)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].UserID < results[j].UserID
+	})
+
+	return results, nil
+}
+
+func (uo *userOrganisation) ByID(id int64) (User, error) {
+	u, err := uo.UserService.ByID(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	if orgID(u.OrgID) != uo.org {
+		return User{}, ErrNotFound
+	}
+
+	return u, nil
+}
+
+func (uo *userOrganisation) ByIDs(ids ...int64) ([]User, error) {
+	users, err := uo.UserService.ByIDs(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]User, 0, len(users))
+	for _, u := range users {
+		if orgID(u.OrgID) == uo.org {
+			members = append(members, u)
+		}
+	}
+
+	return members, nil
+}
+
+func (uo *userOrganisation) ByEmail(email string) (User, error) {
+	u, err := uo.UserService.ByEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+
+	if orgID(u.OrgID) != uo.org {
+		return User{}, ErrNotFound
+	}
+
+	return u, nil
+}
+
+func (uo *userOrganisation) Search(q SearchQuery) ([]User, error) {
+	q.OrgID = uo.org
+	return uo.UserService.Search(q)
+}
+
+// roleOrganisation is a RoleService decorator serving the requests of the users
+// of an organisation: they reach the roles of the organisation, and the shared
+// roles, which they can't change. The roles of the other organisations are not
+// found, and the roles created belong to the organisation.
+type roleOrganisation struct {
+	RoleService
+	org int64
+}
+
+// owned returns ErrNotFound if the role with the given ID is not available to
+// the organisation, and ErrReadOnly if it is a shared role.
+func (ro *roleOrganisation) owned(id int64) error {
+	r, err := ro.ByID(id)
+	if err != nil {
+		return err
+	}
+
+	if r.OrgID == nil {
+		return ErrReadOnly
+	}
+
+	return nil
+}
+
+func (ro *roleOrganisation) Create(r *Role) error {
+	org := ro.org
+	r.OrgID = &org
+
+	return ro.RoleService.Create(r)
+}
+
+func (ro *roleOrganisation) Update(r *Role) error {
+	if err := ro.owned(r.ID); err != nil {
+		return err
+	}
+
+	org := ro.org
+	r.OrgID = &org
+
+	return ro.RoleService.Update(r)
+}
+
+func (ro *roleOrganisation) UpdatePartial(r *Role, patch []byte) error {
+	if err := ro.owned(r.ID); err != nil {
+		return err
+	}
+
+	return ro.RoleService.UpdatePartial(r, patch)
+}
+
+func (ro *roleOrganisation) Delete(id int64) error {
+	if err := ro.owned(id); err != nil {
+		return err
+	}
+
+	return ro.RoleService.Delete(id)
+}
+
+func (ro *roleOrganisation) ByID(id int64) (Role, error) {
+	r, err := ro.RoleService.ByID(id)
+	if err != nil {
+		return Role{}, err
+	}
+
+	if !r.AvailableTo(&ro.org) {
+		return Role{}, ErrNotFound
+	}
+
+	return r, nil
+}
+
+func (ro *roleOrganisation) ByIDs(ids ...int64) ([]Role, error) {
+	roles, err := ro.RoleService.ByIDs(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the roles may be shared with the cache, see roleCache
+	available := make([]Role, 0, len(roles))
+	for _, r := range roles {
+		if r.AvailableTo(&ro.org) {
+			available = append(available, r)
+		}
+	}
+
+	return available, nil
+}
+
+// campaignOrganisation is a CampaignService decorator serving the requests of
+// the users of an organisation: the campaigns of the other organisations, and
+// of none, are not found, and the campaigns created belong to the organisation.
+type campaignOrganisation struct {
+	CampaignService
+	org int64
+}
+
+func (co *campaignOrganisation) Create(c *Campaign) error {
+	org := co.org
+	c.OrgID = &org
+
+	return co.CampaignService.Create(c)
+}
+
+func (co *campaignOrganisation) Update(c *Campaign) error {
+	if _, err := co.ByID(c.ID); err != nil {
+		return err
+	}
+
+	return co.CampaignService.Update(c)
+}
+
+func (co *campaignOrganisation) Delete(id int64) error {
+	if _, err := co.ByID(id); err != nil {
+		return err
+	}
+
+	return co.CampaignService.Delete(id)
+}
+
+func (co *campaignOrganisation) ByID(id int64) (Campaign, error) {
+	c, err := co.CampaignService.ByID(id)
+	if err != nil {
+		return Campaign{}, err
+	}
+
+	if orgID(c.OrgID) != co.org {
+		return Campaign{}, ErrNotFound
+	}
+
+	return c, nil
+}
+
+func (co *campaignOrganisation) List() ([]Campaign, error) {
+	campaigns, err := co.CampaignService.List()
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make([]Campaign, 0, len(campaigns))
+	for _, c := range campaigns {
+		if orgID(c.OrgID) == co.org {
+			owned = append(owned, c)
+		}
+	}
+
+	return owned, nil
+}
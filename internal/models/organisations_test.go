@@ -0,0 +1,325 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOrganisationService struct {
+	OrganisationService
+}
+
+func (t *testOrganisationService) Create(o *Organisation) error {
+	return nil
+}
+
+func (t *testOrganisationService) Update(o *Organisation) error {
+	return nil
+}
+
+func TestOrganisationValidator(t *testing.T) {
+	ov := &organisationValidator{OrganisationService: &testOrganisationService{}}
+
+	o := Organisation{ID: 5, Name: " Acme "}
+	require.NoError(t, ov.Create(&o))
+	assert.Equal(t, Organisation{Name: "Acme"}, o)
+
+	assert.Equal(t, ValidationError{"name": ErrRequired}, ov.Create(&Organisation{Name: " "}))
+	assert.Equal(t, ValidationError{"name": ErrTooLong}, ov.Create(&Organisation{Name: strings.Repeat("a", 256)}))
+	assert.Equal(t, ErrNotFound, ov.Update(&Organisation{Name: "Acme"}))
+	assert.Equal(t, ValidationError{"name": ErrRequired}, ov.Update(&Organisation{ID: 5}))
+	assert.Equal(t, ErrNotFound, ov.Delete(0))
+
+	_, err := ov.ByID(-1)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestOrganisationFrom(t *testing.T) {
+	assert.Equal(t, int64(0), OrganisationFrom(context.Background()))
+	assert.Equal(t, int64(4), OrganisationFrom(WithOrganisation(context.Background(), 4)))
+
+	four, other := int64(4), int64(4)
+	assert.True(t, sameOrganisation(nil, nil))
+	assert.True(t, sameOrganisation(&four, &other))
+	assert.False(t, sameOrganisation(&four, nil))
+
+	assert.True(t, Role{}.AvailableTo(&four), "the shared roles must be available to every organisation")
+	assert.True(t, Role{OrgID: &other}.AvailableTo(&four))
+	assert.False(t, Role{OrgID: &four}.AvailableTo(nil))
+}
+
+func TestOrganisationGorm(t *testing.T) {
+	db := setupGorm(t)
+	os := NewOrganisationService(db)
+
+	globex := Organisation{Name: "Globex"}
+	require.NoError(t, os.Create(&globex))
+	assert.NotZero(t, globex.ID)
+	assert.False(t, globex.CreatedAt.IsZero())
+
+	acme := Organisation{Name: "Acme"}
+	require.NoError(t, os.Create(&acme))
+	assert.Equal(t, ValidationError{"name": ErrDuplicate}, os.Create(&Organisation{Name: "Acme"}))
+
+	orgs, err := os.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Acme", "Globex"}, []string{orgs[0].Name, orgs[1].Name}, "must be sorted by name")
+
+	acme.Name = "Acme Corp"
+	require.NoError(t, os.Update(&acme))
+	got, err := os.ByID(acme.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme Corp", got.Name)
+	assert.Equal(t, ValidationError{"name": ErrDuplicate}, os.Update(&Organisation{ID: acme.ID, Name: "Globex"}))
+	assert.Equal(t, ErrNotFound, os.Update(&Organisation{ID: 999, Name: "Initech"}))
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, OrgID: &acme.ID, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	assert.Equal(t, ErrInUse, os.Delete(acme.ID), "must not delete an organisation with users")
+
+	require.NoError(t, os.Delete(globex.ID))
+	_, err = os.ByID(globex.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, os.Delete(globex.ID))
+}
+
+type testOrganisationUserService struct {
+	UserService
+	users   map[int64]User
+	deleted int64
+	query   SearchQuery
+}
+
+func (t *testOrganisationUserService) ByID(id int64) (User, error) {
+	u, ok := t.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	return u, nil
+}
+
+func (t *testOrganisationUserService) ByIDs(ids ...int64) ([]User, error) {
+	var users []User
+	for _, id := range ids {
+		if u, ok := t.users[id]; ok {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (t *testOrganisationUserService) Create(u *User) error {
+	return nil
+}
+
+func (t *testOrganisationUserService) DeleteWith(id int64, d UserDeletion) error {
+	t.deleted = id
+	return nil
+}
+
+func (t *testOrganisationUserService) Search(q SearchQuery) ([]User, error) {
+	t.query = q
+
+	var users []User
+	for _, id := range q.IDs {
+		if u, ok := t.users[id]; ok && orgID(u.OrgID) == q.OrgID {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (t *testOrganisationUserService) AssignRole(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+	var results []RoleAssignment
+	for _, id := range ids {
+		results = append(results, RoleAssignment{UserID: id, Status: AssignmentAssigned})
+	}
+
+	return results, nil
+}
+
+func TestUserOrganisation(t *testing.T) {
+	acme, globex := int64(4), int64(5)
+	tus := &testOrganisationUserService{users: map[int64]User{
+		1: {ID: 1, RoleID: 1},
+		7: {ID: 7, RoleID: 2, OrgID: &acme},
+		8: {ID: 8, RoleID: 2, OrgID: &acme},
+		9: {ID: 9, RoleID: 2, OrgID: &globex},
+	}}
+	us := &userOrganisation{UserService: tus, org: acme}
+
+	u, err := us.ByID(7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), u.ID)
+
+	_, err = us.ByID(9)
+	assert.Equal(t, ErrNotFound, err, "the users of the other organisations must not be found")
+	_, err = us.ByID(1)
+	assert.Equal(t, ErrNotFound, err, "the users of no organisation must not be found")
+
+	users, err := us.ByIDs(1, 7, 9)
+	require.NoError(t, err)
+	assert.Equal(t, []User{tus.users[7]}, users)
+
+	_, err = us.Search(SearchQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, acme, tus.query.OrgID)
+
+	nu := User{Email: "new@test.com", OrgID: &globex}
+	require.NoError(t, us.Create(&nu))
+	assert.Equal(t, &acme, nu.OrgID, "the users created must join the organisation")
+
+	assert.Equal(t, ErrNotFound, us.DeleteWith(9, UserDeletion{}))
+	assert.Equal(t, ValidationError{"reassignTo": ErrRefNotFound}, us.DeleteWith(7, UserDeletion{Ratings: RatingsReassign, ReassignTo: 9}))
+	require.NoError(t, us.DeleteWith(7, UserDeletion{Ratings: RatingsReassign, ReassignTo: 8}))
+	assert.Equal(t, int64(7), tus.deleted)
+
+	results, err := us.AssignRole(3, 9, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []RoleAssignment{
+		{UserID: 7, Status: AssignmentAssigned},
+		failedAssignment(9, ErrNotFound),
+	}, results)
+}
+
+type testOrganisationRoleService struct {
+	RoleService
+	roles   map[int64]Role
+	updated bool
+}
+
+func (t *testOrganisationRoleService) ByID(id int64) (Role, error) {
+	r, ok := t.roles[id]
+	if !ok {
+		return Role{}, ErrNotFound
+	}
+
+	return r, nil
+}
+
+func (t *testOrganisationRoleService) ByIDs(ids ...int64) ([]Role, error) {
+	var roles []Role
+	for _, r := range t.roles {
+		roles = append(roles, r)
+	}
+
+	return roles, nil
+}
+
+func (t *testOrganisationRoleService) Create(r *Role) error {
+	return nil
+}
+
+func (t *testOrganisationRoleService) Update(r *Role) error {
+	t.updated = true
+	return nil
+}
+
+func (t *testOrganisationRoleService) Delete(id int64) error {
+	return nil
+}
+
+func TestRoleOrganisation(t *testing.T) {
+	acme, globex := int64(4), int64(5)
+	trs := &testOrganisationRoleService{roles: map[int64]Role{
+		2: {ID: 2, Label: "user"},
+		4: {ID: 4, Label: "acme", OrgID: &acme},
+		5: {ID: 5, Label: "globex", OrgID: &globex},
+	}}
+	rs := &roleOrganisation{RoleService: trs, org: acme}
+
+	_, err := rs.ByID(2)
+	require.NoError(t, err, "the shared roles must be available")
+	_, err = rs.ByID(5)
+	assert.Equal(t, ErrNotFound, err)
+
+	roles, err := rs.ByIDs()
+	require.NoError(t, err)
+	assert.Len(t, roles, 2)
+	for _, r := range roles {
+		assert.NotEqual(t, int64(5), r.ID, "the roles of the other organisations must not be listed")
+	}
+
+	nr := Role{Label: "new"}
+	require.NoError(t, rs.Create(&nr))
+	assert.Equal(t, &acme, nr.OrgID, "the roles created must belong to the organisation")
+
+	assert.Equal(t, ErrReadOnly, rs.Update(&Role{ID: 2, Label: "user"}), "the shared roles must not be changed")
+	assert.Equal(t, ErrNotFound, rs.Update(&Role{ID: 5, Label: "globex"}))
+	assert.Equal(t, ErrReadOnly, rs.Delete(2))
+	assert.False(t, trs.updated)
+
+	require.NoError(t, rs.Update(&Role{ID: 4, Label: "acme"}))
+	assert.True(t, trs.updated)
+}
+
+type testOrganisationCampaignService struct {
+	CampaignService
+	campaigns map[int64]Campaign
+	deleted   int64
+}
+
+func (t *testOrganisationCampaignService) ByID(id int64) (Campaign, error) {
+	c, ok := t.campaigns[id]
+	if !ok {
+		return Campaign{}, ErrNotFound
+	}
+
+	return c, nil
+}
+
+func (t *testOrganisationCampaignService) List() ([]Campaign, error) {
+	var campaigns []Campaign
+	for _, c := range t.campaigns {
+		campaigns = append(campaigns, c)
+	}
+
+	return campaigns, nil
+}
+
+func (t *testOrganisationCampaignService) Create(c *Campaign) error {
+	return nil
+}
+
+func (t *testOrganisationCampaignService) Delete(id int64) error {
+	t.deleted = id
+	return nil
+}
+
+func TestCampaignOrganisation(t *testing.T) {
+	acme, globex := int64(4), int64(5)
+	tcs := &testOrganisationCampaignService{campaigns: map[int64]Campaign{
+		1: {ID: 1, Name: "shared"},
+		4: {ID: 4, Name: "acme", OrgID: &acme},
+		5: {ID: 5, Name: "globex", OrgID: &globex},
+	}}
+	cs := &campaignOrganisation{CampaignService: tcs, org: acme}
+
+	_, err := cs.ByID(4)
+	require.NoError(t, err)
+	_, err = cs.ByID(1)
+	assert.Equal(t, ErrNotFound, err, "the campaigns of no organisation must not be found")
+	_, err = cs.ByID(5)
+	assert.Equal(t, ErrNotFound, err)
+
+	campaigns, err := cs.List()
+	require.NoError(t, err)
+	require.Len(t, campaigns, 1)
+	assert.Equal(t, int64(4), campaigns[0].ID)
+
+	nc := Campaign{Name: "new", OrgID: &globex}
+	require.NoError(t, cs.Create(&nc))
+	assert.Equal(t, &acme, nc.OrgID, "the campaigns created must belong to the organisation")
+
+	assert.Equal(t, ErrNotFound, cs.Update(&Campaign{ID: 5, Name: "globex"}))
+	assert.Equal(t, ErrNotFound, cs.Delete(5))
+	assert.Zero(t, tcs.deleted)
+	require.NoError(t, cs.Delete(4))
+	assert.Equal(t, int64(4), tcs.deleted)
+}
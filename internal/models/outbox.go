@@ -0,0 +1,191 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/events"
+)
+
+const (
+	// outboxBatch is the maximum number of events leased at once by a
+	// dispatch of the outbox.
+	outboxBatch = 100
+
+	// outboxLease is how long the events being published by an instance
+	// are hidden from the others. They are published again once it
+	// elapses if the instance stopped before removing them.
+	outboxLease = time.Minute
+)
+
+// outboxEvent is an event of a rating written to the outbox, in the
+// transaction of the change it reports, to be published once it is committed.
+type outboxEvent struct {
+	ID int64 `gorm:"primary_key;type:bigserial"`
+
+	// Key identifies the event, and is published as its ID.
+	Key  string          `gorm:"size:32;not null"`
+	Type string          `gorm:"size:64;not null"`
+	Data json.RawMessage `gorm:"type:jsonb;not null"`
+
+	NextAttemptAt time.Time `gorm:"type:timestamptz;not null;default:now()"`
+	CreatedAt     time.Time `gorm:"type:timestamptz;not null;default:now()"`
+}
+
+// TableName returns the name of the table of the outbox.
+func (outboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+// outboxRating is the Data of the events of the outbox, with the version of the
+// rating, which its JSON leaves out.
+type outboxRating struct {
+	Rating
+	Version int64 `json:"version"`
+}
+
+// outbox publishes the events of the ratings to the event bus reliably: they are
+// written to the outbox_events table in the transaction of the change they
+// report, and published once it is committed, even if the application stopped
+// in between. The events are published at least once, with their key as ID. A
+// nil *outbox writes no events, as the services of the tenants do.
+type outbox struct {
+	db  *gorm.DB
+	bus publisher
+
+	// onAdded holds the func() called once events are added, see
+	// Services.OnOutboxAdded.
+	onAdded atomic.Value
+}
+
+// add writes e, whose Data must be a Rating, to the outbox with tx, the
+// transaction of the change it reports.
+func (o *outbox) add(tx *gorm.DB, e events.Event) error {
+	if o == nil {
+		return nil
+	}
+
+	var k [16]byte
+	_, err := rand.Read(k[:])
+	if err != nil {
+		return wrap("could not generate outbox key", err)
+	}
+
+	r := e.Data.(Rating)
+	data, err := json.Marshal(outboxRating{Rating: r, Version: r.Version})
+	if err != nil {
+		return wrap("could not encode outbox event", err)
+	}
+
+	err = tx.Create(&outboxEvent{Key: hex.EncodeToString(k[:]), Type: e.Type, Data: data}).Error
+	if err != nil {
+		return with(wrap("could not add outbox event", err), "rating_id", r.ID)
+	}
+
+	return nil
+}
+
+// added dispatches the events added with db right away, unless db is a
+// transaction: its events are dispatched once it is committed, see
+// Services.committed.
+func (o *outbox) added(db *gorm.DB) {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return
+	}
+
+	o.wake()
+}
+
+// wake tells the events were added, so the outbox is dispatched right away.
+func (o *outbox) wake() {
+	if o == nil {
+		return
+	}
+
+	if f, ok := o.onAdded.Load().(func()); ok {
+		f()
+	}
+}
+
+// DispatchOutbox publishes the events of the ratings left in the outbox, like
+// the ones of an instance that stopped before publishing them. It is meant to
+// be run periodically, and once f passed to OnOutboxAdded is called.
+func (s *Services) DispatchOutbox() error {
+	return s.outbox.dispatch()
+}
+
+// OnOutboxAdded sets f to be called once events are added to the outbox, so it
+// can be dispatched right away. f must not block.
+func (s *Services) OnOutboxAdded(f func()) {
+	s.outbox.onAdded.Store(f)
+}
+
+// dispatch publishes the events of the outbox, in the order they were added,
+// and removes them. The events are leased, so only one instance publishes
+// them.
+func (o *outbox) dispatch() error {
+	for {
+		n, err := o.dispatchBatch()
+		if err != nil || n < outboxBatch {
+			return err
+		}
+	}
+}
+
+// dispatchBatch publishes and removes a batch of events, and returns their
+// number.
+func (o *outbox) dispatchBatch() (int, error) {
+	var batch []outboxEvent
+	err := o.db.Raw(`UPDATE outbox_events SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM outbox_events WHERE next_attempt_at <= now()
+			ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, time.Now().Add(outboxLease), outboxBatch).
+		Scan(&batch).
+		Error
+	if err != nil {
+		return 0, wrap("could not lease outbox events", err)
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	sort.Slice(batch, func(i, j int) bool {
+		return batch[i].ID < batch[j].ID
+	})
+
+	var firstErr error
+	ids := make([]int64, 0, len(batch))
+	for _, oe := range batch {
+		// the events that can't be decoded are dropped, instead of
+		// being leased again and again
+		ids = append(ids, oe.ID)
+
+		var or outboxRating
+		err = json.Unmarshal(oe.Data, &or)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = with(wrap("could not decode outbox event", err), "key", oe.Key)
+			}
+			continue
+		}
+
+		r := or.Rating
+		r.Version = or.Version
+		o.bus.Publish(events.Event{ID: oe.Key, Type: oe.Type, Time: oe.CreatedAt, Data: r})
+	}
+
+	err = o.db.Where("id IN (?)", ids).Delete(&outboxEvent{}).Error
+	if err != nil {
+		return len(batch), wrap("could not remove outbox events", err)
+	}
+
+	return len(batch), firstErr
+}
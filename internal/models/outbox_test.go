@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	db := setupGorm(t)
+
+	bus := events.NewBus(0)
+	var got []events.Event
+	bus.Subscribe(func(e events.Event) { got = append(got, e) })
+
+	ob := &outbox{db: db, bus: bus}
+	rg := &ratingGorm{db: db, outbox: ob}
+	reps := newReputationService(db, probation{}, nil, ob)
+
+	r := Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 9, UserID: 1}
+	require.NoError(t, rg.Create(&r))
+	r.Score = 2
+	require.NoError(t, rg.Update(&r))
+	require.NoError(t, reps.Moderate(&Moderation{RatingID: 10, Outcome: ModerationRemoved, ModeratorID: 1}))
+
+	t.Run("rolledBack", func(t *testing.T) {
+		err := gormTransaction(db, func(tx *gorm.DB) error {
+			require.NoError(t, (&ratingGorm{db: tx, outbox: ob}).Create(&Rating{ID: 11, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 1}))
+			return ErrConflict
+		})
+		assert.Equal(t, ErrConflict, err)
+	})
+
+	require.NoError(t, ob.dispatch())
+	bus.Close()
+
+	require.Len(t, got, 3)
+	assert.Equal(t, events.RatingCreated, got[0].Type)
+	assert.Equal(t, 4, got[0].Data.(Rating).Score)
+	assert.Equal(t, events.RatingUpdated, got[1].Type)
+	assert.Equal(t, int64(2), got[1].Data.(Rating).Version)
+	assert.Equal(t, events.RatingModerated, got[2].Type)
+	assert.False(t, got[2].Data.(Rating).Active)
+	for _, e := range got {
+		assert.Len(t, e.ID, 32)
+		assert.False(t, e.Time.IsZero())
+	}
+
+	var pending int
+	require.NoError(t, db.Model(&outboxEvent{}).Count(&pending).Error)
+	assert.Zero(t, pending, "must remove the events published")
+
+	t.Run("leased", func(t *testing.T) {
+		require.NoError(t, db.Create(&outboxEvent{Key: "0123456789abcdef0123456789abcdef", Type: events.RatingCreated,
+			Data: json.RawMessage(`{"id":12}`), NextAttemptAt: time.Now().Add(time.Minute)}).Error)
+
+		require.NoError(t, ob.dispatch())
+		require.NoError(t, db.Model(&outboxEvent{}).Count(&pending).Error)
+		assert.Equal(t, 1, pending, "must not publish the events leased by another instance")
+	})
+}
+
+func TestOutboxRating(t *testing.T) {
+	var nilOutbox *outbox
+	assert.NoError(t, nilOutbox.add(nil, events.Event{Type: events.RatingCreated, Data: Rating{ID: 1}}))
+	nilOutbox.wake()
+
+	data, err := json.Marshal(outboxRating{Rating: Rating{ID: 1, Score: 3, Version: 4}, Version: 4})
+	require.NoError(t, err)
+
+	var or outboxRating
+	require.NoError(t, json.Unmarshal(data, &or))
+	assert.Equal(t, int64(4), or.Version, "must keep the version of the rating")
+	assert.Equal(t, 3, or.Score)
+}
+
+func TestOutbox_Wake(t *testing.T) {
+	var woken int
+	s := Services{outbox: &outbox{}}
+	s.outbox.wake()
+
+	s.OnOutboxAdded(func() { woken++ })
+	s.outbox.added(&gorm.DB{})
+	assert.Equal(t, 1, woken, "must wake once events are added")
+}
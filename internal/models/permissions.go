@@ -0,0 +1,142 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// basePermissions are the permissions of the first release, which the roles
+// created before any upgrade were given knowingly.
+const basePermissions = PermissionReadUsers | PermissionWriteUsers | PermissionReadRatings | PermissionWriteRatings
+
+// A permissionUpgrade declares which of the existing roles gain a permission
+// added after the first release. Without it, the roles would keep their
+// permissions as they are, except the admin role, which has every bit set and
+// would silently gain it.
+type permissionUpgrade struct {
+	// Permission is the permission added.
+	Permission Permissions
+
+	// Implied grants Permission to the roles that have all these
+	// permissions, if not zero, like a finer permission split from a
+	// broader one. No other role gains it.
+	Implied Permissions
+
+	// Admin tells whether the admin role has Permission. If not, it is
+	// removed from the admin role, which can't be modified, so only the
+	// roles granted it explicitly have it.
+	Admin bool
+}
+
+// permissionUpgrades are the policies of the permissions added after the first
+// release, in the order they were added. Every permission added to the
+// constants must be declared here, which TestPermissionUpgrades checks. They
+// are applied once to every database, see upgradePermissions, when the
+// services start or a tenant is provisioned.
+var permissionUpgrades = []permissionUpgrade{
+	// writeOwnRatings was split from writeRatings, which the roles kept
+	// to change their own ratings only are converted to by the migration
+	// 0029_write_own_ratings
+	{Permission: PermissionWriteOwnRatings, Implied: PermissionWriteRatings, Admin: true},
+}
+
+// adminPermissions returns the permissions of the admin role: all of them, but
+// the ones upgrades exclude.
+func adminPermissions(upgrades []permissionUpgrade) Permissions {
+	p := Permissions(-1)
+	for _, u := range upgrades {
+		if !u.Admin {
+			p &^= u.Permission
+		}
+	}
+
+	return p
+}
+
+// upgradePermissions grants the permissions of the upgrades not applied yet to
+// db to the roles their policies select, recording them in permission_upgrades
+// so they are only applied once: the roles created or edited since keep the
+// permissions they were given. db must be a transaction. The IDs of the roles
+// changed are returned.
+func upgradePermissions(db *gorm.DB, upgrades []permissionUpgrade) ([]int64, error) {
+	// the instances starting together apply the upgrades one at a time
+	err := db.Exec("LOCK TABLE permission_upgrades IN EXCLUSIVE MODE").Error
+	if err != nil {
+		return nil, wrap("could not lock the permission upgrades", err)
+	}
+
+	var changed []int64
+	for _, u := range upgrades {
+		res := db.Exec("INSERT INTO permission_upgrades (permission) VALUES (?) ON CONFLICT DO NOTHING", u.Permission)
+		if res.Error != nil {
+			return nil, with(wrap("could not record permission upgrade", res.Error), "permission", u.Permission)
+		}
+		if res.RowsAffected == 0 || u.Implied == 0 {
+			continue
+		}
+
+		var ids []int64
+		err = db.Raw(`UPDATE roles SET permissions = permissions | ?, version = version + 1
+			WHERE id <> 1 AND permissions & ? = ? AND permissions & ? = 0
+			RETURNING id`, u.Permission, u.Implied, u.Implied, u.Permission).
+			Pluck("id", &ids).
+			Error
+		if err != nil {
+			return nil, with(wrap("could not upgrade the permissions of the roles", err), "permission", u.Permission)
+		}
+		changed = append(changed, ids...)
+	}
+
+	return changed, nil
+}
+
+// upgradeAllPermissions applies the permission upgrades to the data shared by
+// the application and to the active and suspended tenants, see
+// upgradePermissions. The roles changed in the shared data are removed from
+// the cache.
+func (s *Services) upgradeAllPermissions() error {
+	var changed []int64
+	err := gormTransaction(s.db, func(tx *gorm.DB) error {
+		var err error
+		changed, err = upgradePermissions(tx, permissionUpgrades)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(changed) > 0 && s.cache != nil {
+		keys := []string{allRolesKey}
+		for _, id := range changed {
+			keys = append(keys, roleKey(id))
+		}
+		s.cache.Delete(keys...)
+	}
+
+	var schemas []string
+	err = s.db.Model(&Tenant{}).
+		Where("schema_name <> '' AND status IN (?)", []string{TenantActive, TenantSuspended}).
+		Order("id").
+		Pluck("schema_name", &schemas).
+		Error
+	if err != nil {
+		return wrap("failed to list the schemas of the tenants", err)
+	}
+
+	for _, schema := range schemas {
+		err = gormTransaction(s.db, func(tx *gorm.DB) error {
+			err := tx.Exec("SET LOCAL search_path TO " + pq.QuoteIdentifier(schema)).Error
+			if err != nil {
+				return wrap("could not switch to the tenant schema", err)
+			}
+
+			_, err = upgradePermissions(tx, permissionUpgrades)
+			return err
+		})
+		if err != nil {
+			return with(err, "schema", schema)
+		}
+	}
+
+	return nil
+}
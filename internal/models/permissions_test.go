@@ -0,0 +1,78 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionUpgrades(t *testing.T) {
+	declared := basePermissions
+	for _, u := range permissionUpgrades {
+		name, ok := permissionsToString[u.Permission]
+		require.True(t, ok, "permission %d must be one of the constants", u.Permission)
+		assert.Zero(t, declared&u.Permission, "%s must only be declared once", name)
+		assert.Equal(t, u.Implied, u.Implied&declared, "%s must only be implied by the permissions added before it", name)
+		declared |= u.Permission
+	}
+
+	for p, name := range permissionsToString {
+		assert.NotZero(t, declared&p, "%s must have an upgrade policy in permissionUpgrades", name)
+	}
+}
+
+func TestAdminPermissions(t *testing.T) {
+	assert.Equal(t, Permissions(-1), adminPermissions(nil))
+
+	p := adminPermissions([]permissionUpgrade{
+		{Permission: 1 << 10, Admin: true},
+		{Permission: 1 << 11},
+	})
+	assert.NotZero(t, p&(1<<10))
+	assert.Zero(t, p&(1<<11), "must exclude the permissions the admin role must not have")
+	assert.Equal(t, basePermissions, p&basePermissions)
+}
+
+func TestUpgradePermissions(t *testing.T) {
+	db := setupGorm(t)
+	upgrades := []permissionUpgrade{
+		{Permission: 1 << 10, Implied: PermissionReadRatings | PermissionWriteRatings, Admin: true},
+		{Permission: 1 << 11},
+	}
+
+	editor := Role{Label: "editor", Permissions: PermissionReadRatings | PermissionWriteRatings}
+	reader := Role{Label: "reader", Permissions: PermissionReadRatings}
+	require.NoError(t, db.Create(&editor).Error)
+	require.NoError(t, db.Create(&reader).Error)
+
+	upgrade := func() []int64 {
+		var changed []int64
+		require.NoError(t, gormTransaction(db, func(tx *gorm.DB) error {
+			var err error
+			changed, err = upgradePermissions(tx, upgrades)
+			return err
+		}))
+		return changed
+	}
+
+	assert.Equal(t, []int64{editor.ID}, upgrade())
+
+	require.NoError(t, db.First(&editor, editor.ID).Error)
+	assert.Equal(t, PermissionReadRatings|PermissionWriteRatings|1<<10, editor.Permissions)
+	assert.Equal(t, int64(2), editor.Version)
+	require.NoError(t, db.First(&reader, reader.ID).Error)
+	assert.Equal(t, PermissionReadRatings, reader.Permissions)
+
+	var user Role
+	require.NoError(t, db.First(&user, 2).Error)
+	assert.Equal(t, Permissions(0), user.Permissions)
+
+	// removed by an administrator since
+	require.NoError(t, db.Model(&editor).Update("permissions", PermissionReadRatings|PermissionWriteRatings).Error)
+	assert.Empty(t, upgrade(), "must only apply the upgrades once")
+
+	require.NoError(t, db.First(&editor, editor.ID).Error)
+	assert.Equal(t, PermissionReadRatings|PermissionWriteRatings, editor.Permissions)
+}
@@ -0,0 +1,501 @@
+package models
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/xerrors"
+)
+
+// The hooks policies can be set on. Their expressions are written in CEL, see
+// https://github.com/google/cel-spec, and can use these variables:
+//
+//	user    the user rating: id, roleId and email
+//	rating  the rating created or updated: id, zero when created, target, score,
+//	        comment, anonymous and campaignId, which may be null
+//	now     the current time, in seconds since the Unix epoch
+const (
+	// PolicyCanRate tells whether the user can create or update the
+	// rating, returning a bool. Ratings not allowed fail with
+	// ErrPolicyDenied.
+	PolicyCanRate = "canRate"
+
+	// PolicyScore adjusts the score of the ratings created or updated,
+	// returning the int score stored, which must not be zero.
+	PolicyScore = "score"
+)
+
+// policyHooks are the hooks policies can be set on, with the type of the values
+// their expressions must return.
+var policyHooks = map[string]string{
+	PolicyCanRate: "bool",
+	PolicyScore:   "int",
+}
+
+// policyEnv is the CEL environment the expressions of the policies are compiled
+// in, declaring their variables. The ints and doubles can be compared with each
+// other.
+var policyEnv = mustPolicyEnv(
+	cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+	cel.Variable("rating", cel.MapType(cel.StringType, cel.DynType)),
+	cel.Variable("now", cel.IntType),
+	cel.CrossTypeNumericComparisons(true),
+	cel.ParserExpressionSizeLimit(policyMaxLength),
+	cel.ParserRecursionLimit(policyMaxDepth),
+)
+
+// policyMaxDepth is the maximum nesting of the operations of the expressions of
+// the policies, and policyMaxCost the maximum cost of their evaluation, as
+// estimated by CEL, where most operations cost 1.
+const (
+	policyMaxDepth = 32
+	policyMaxCost  = 1000
+)
+
+// policyRefresh is how often the policies are read again, so the changes made by
+// other instances are applied.
+const policyRefresh = 10 * time.Second
+
+//go:generate go run github.com/matryer/moq -out modelstest/policies.go -pkg modelstest . PolicyService:PolicyService
+
+// PolicyService defines a set of methods used to manage the policies, the
+// expressions set by the administrators that are evaluated when the ratings are
+// created or updated, see PolicyCanRate and PolicyScore.
+//
+// The changes of the policies are recorded, and are applied by the other
+// instances in a few seconds.
+type PolicyService interface {
+	// List retrieves the policies set, sorted by hook.
+	List() ([]Policy, error)
+
+	// Set sets the expression of the policy of p.Hook, recording the
+	// change by p.UpdatedBy. The expression is checked as in Check,
+	// and a ValidationError is returned for the "expression" field if
+	// it is invalid. On success, p.UpdatedAt is set.
+	Set(p *Policy) error
+
+	// Remove removes the policy of a hook, recording the change by
+	// userID. ErrNotFound is returned if no policy is set.
+	Remove(hook string, userID int64) error
+
+	// Changes retrieves the changes of the policy of a hook, newest
+	// first.
+	Changes(hook string) ([]PolicyChange, error)
+
+	// Check compiles the expression of a policy for hook, and evaluates
+	// it with sample values, returning an error describing why it is
+	// invalid, if so. ErrNotFound is returned for unknown hooks.
+	Check(hook, expression string) error
+}
+
+// A Policy is the expression evaluated at a hook, like PolicyCanRate.
+type Policy struct {
+	Hook       string `gorm:"primary_key;size:64" json:"hook"`
+	Expression string `gorm:"type:text;not null" json:"expression"`
+
+	// UpdatedBy is the ID of the user who set the expression.
+	UpdatedBy int64     `gorm:"type:bigint;not null" json:"updatedBy"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updatedAt"`
+}
+
+// A PolicyChange records a change of the policy of a hook by a user.
+type PolicyChange struct {
+	ID   int64  `gorm:"primary_key;type:bigserial" json:"id"`
+	Hook string `gorm:"size:64;not null" json:"hook"`
+
+	// Previous and Expression are the expressions before and after the
+	// change, empty if no policy was set or if it was removed.
+	Previous   string `gorm:"type:text;not null" json:"previous"`
+	Expression string `gorm:"type:text;not null" json:"expression"`
+
+	UserID    int64     `gorm:"type:bigint;not null" json:"userId"`
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// policyMaxLength is the maximum length of the expressions of the policies.
+const policyMaxLength = 1024
+
+type policyService struct {
+	PolicyService
+
+	engine *policyEngine
+}
+
+// NewPolicyService instantiates a new PolicyService implementation with db as
+// the backing database.
+func NewPolicyService(db *gorm.DB) PolicyService {
+	return newPolicyService(db, &policyEngine{db: db, clock: SystemClock})
+}
+
+// newPolicyService instantiates a new PolicyService implementation whose
+// changes are applied to engine right away, and dated with its clock.
+func newPolicyService(db *gorm.DB, engine *policyEngine) PolicyService {
+	return &policyService{
+		PolicyService: &policyValidator{
+			PolicyService: &policyGorm{db: db, clock: engine.clock},
+		},
+		engine: engine,
+	}
+}
+
+func (ps *policyService) Set(p *Policy) error {
+	err := ps.PolicyService.Set(p)
+	if err != nil {
+		return err
+	}
+
+	ps.engine.invalidate()
+	return nil
+}
+
+func (ps *policyService) Remove(hook string, userID int64) error {
+	err := ps.PolicyService.Remove(hook, userID)
+	if err != nil {
+		return err
+	}
+
+	ps.engine.invalidate()
+	return nil
+}
+
+type policyValidator struct {
+	PolicyService
+}
+
+func (pv *policyValidator) Set(p *Policy) error {
+	if _, ok := policyHooks[p.Hook]; !ok {
+		return ErrNotFound
+	}
+
+	switch {
+	case p.UpdatedBy < 1:
+		return ValidationError{"updatedBy": ErrRequired}
+	case p.Expression == "":
+		return ValidationError{"expression": ErrRequired}
+	case len(p.Expression) > policyMaxLength:
+		return ValidationError{"expression": ErrTooLong}
+	}
+
+	if err := pv.Check(p.Hook, p.Expression); err != nil {
+		return ValidationError{"expression": ErrInvalid}
+	}
+
+	return pv.PolicyService.Set(p)
+}
+
+func (pv *policyValidator) Remove(hook string, userID int64) error {
+	if _, ok := policyHooks[hook]; !ok {
+		return ErrNotFound
+	}
+
+	return pv.PolicyService.Remove(hook, userID)
+}
+
+func (pv *policyValidator) Changes(hook string) ([]PolicyChange, error) {
+	if _, ok := policyHooks[hook]; !ok {
+		return nil, ErrNotFound
+	}
+
+	return pv.PolicyService.Changes(hook)
+}
+
+func (pv *policyValidator) Check(hook, expression string) error {
+	want, ok := policyHooks[hook]
+	if !ok {
+		return ErrNotFound
+	}
+
+	p, err := compilePolicy(expression)
+	if err != nil {
+		return err
+	}
+
+	// the sample values catch the type errors, like misspelt fields
+	v, err := evalPolicy(p, policyValues(&Rating{Score: 1, User: &User{}}, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	switch v.(type) {
+	case bool:
+		if want == "bool" {
+			return nil
+		}
+	case int64:
+		if want == "int" {
+			return nil
+		}
+	}
+
+	return wrap("the "+hook+" policy must return a value of type "+want, nil)
+}
+
+type policyGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (pg *policyGorm) List() ([]Policy, error) {
+	policies := []Policy{}
+	err := pg.db.Order("hook").Find(&policies).Error
+	if err != nil {
+		return nil, wrap("could not list policies", err)
+	}
+
+	return policies, nil
+}
+
+func (pg *policyGorm) Set(p *Policy) error {
+	return gormTransaction(pg.db, func(tx *gorm.DB) error {
+		previous, err := lockPolicy(tx, p.Hook)
+		if err != nil {
+			return err
+		}
+
+		p.UpdatedAt = pg.clock.Now()
+		err = tx.Exec(`INSERT INTO policies (hook, expression, updated_by, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (hook) DO UPDATE SET expression = excluded.expression, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+			p.Hook, p.Expression, p.UpdatedBy, p.UpdatedAt).Error
+		if err != nil {
+			return with(wrap("could not set policy", err), "hook", p.Hook)
+		}
+
+		return recordPolicyChange(tx, &PolicyChange{
+			Hook:       p.Hook,
+			Previous:   previous,
+			Expression: p.Expression,
+			UserID:     p.UpdatedBy,
+		})
+	})
+}
+
+func (pg *policyGorm) Remove(hook string, userID int64) error {
+	return gormTransaction(pg.db, func(tx *gorm.DB) error {
+		previous, err := lockPolicy(tx, hook)
+		if err != nil {
+			return err
+		} else if previous == "" {
+			return ErrNotFound
+		}
+
+		err = tx.Exec("DELETE FROM policies WHERE hook = ?", hook).Error
+		if err != nil {
+			return with(wrap("could not remove policy", err), "hook", hook)
+		}
+
+		return recordPolicyChange(tx, &PolicyChange{
+			Hook:     hook,
+			Previous: previous,
+			UserID:   userID,
+		})
+	})
+}
+
+// lockPolicy locks the policy of hook until the end of the transaction tx,
+// returning its expression, or an empty string if none is set. The changes of
+// the hook are serialised even if no policy is set, so they are recorded in
+// order.
+func lockPolicy(tx *gorm.DB, hook string) (string, error) {
+	err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('policy:' || ?))", hook).Error
+	if err != nil {
+		return "", with(wrap("could not lock policy", err), "hook", hook)
+	}
+
+	var p Policy
+	err = tx.Where("hook = ?", hook).First(&p).Error
+	if err != nil && !xerrors.Is(err, gorm.ErrRecordNotFound) {
+		return "", with(wrap("could not get policy", err), "hook", hook)
+	}
+
+	return p.Expression, nil
+}
+
+// recordPolicyChange records c in the transaction tx.
+func recordPolicyChange(tx *gorm.DB, c *PolicyChange) error {
+	err := tx.Create(c).Error
+	if err != nil {
+		return with(wrap("could not record policy change", err), "hook", c.Hook)
+	}
+
+	return nil
+}
+
+func (pg *policyGorm) Changes(hook string) ([]PolicyChange, error) {
+	changes := []PolicyChange{}
+	err := pg.db.Where("hook = ?", hook).Order("id DESC").Find(&changes).Error
+	if err != nil {
+		return nil, with(wrap("could not list policy changes", err), "hook", hook)
+	}
+
+	return changes, nil
+}
+
+func (pg *policyGorm) Check(hook, expression string) error {
+	panic("method Check of policyGorm must never be called")
+}
+
+// mustPolicyEnv returns the CEL environment with opts, panicking if they are
+// invalid.
+func mustPolicyEnv(opts ...cel.EnvOption) *cel.Env {
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		panic(err)
+	}
+
+	return env
+}
+
+// compilePolicy compiles the expression of a policy, limiting the cost of its
+// evaluation.
+func compilePolicy(expression string) (cel.Program, error) {
+	return compileIn(policyEnv, expression)
+}
+
+// compileIn compiles an expression in env, limiting the cost of its evaluation
+// as for the policies.
+func compileIn(env *cel.Env, expression string) (cel.Program, error) {
+	ast, iss := env.Compile(expression)
+	if iss.Err() != nil {
+		return nil, wrap("could not compile expression", iss.Err())
+	}
+
+	p, err := env.Program(ast, cel.CostLimit(policyMaxCost))
+	if err != nil {
+		return nil, wrap("could not compile expression", err)
+	}
+
+	return p, nil
+}
+
+// evalPolicy evaluates p with the values of its variables, returning the bool
+// or int64 it returns.
+func evalPolicy(p cel.Program, values map[string]interface{}) (interface{}, error) {
+	out, _, err := p.Eval(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Value(), nil
+}
+
+// policyValues returns the values of the variables of the policies evaluated
+// for r, created or updated by r.User at now.
+func policyValues(r *Rating, now time.Time) map[string]interface{} {
+	user := map[string]interface{}{"id": r.UserID, "roleId": int64(0), "email": ""}
+	if r.User != nil {
+		user["id"], user["roleId"], user["email"] = r.User.ID, r.User.RoleID, r.User.Email
+	}
+
+	var campaignID interface{}
+	if r.CampaignID != nil {
+		campaignID = *r.CampaignID
+	}
+
+	return map[string]interface{}{
+		"user": user,
+		"rating": map[string]interface{}{
+			"id":         r.ID,
+			"target":     r.Target,
+			"score":      int64(r.Score),
+			"comment":    r.Comment,
+			"anonymous":  r.Anonymous,
+			"campaignId": campaignID,
+		},
+		"now": now.Unix(),
+	}
+}
+
+// policyEngine evaluates the policies on the ratings, as a rule run by the
+// RatingService, see Rules. The policies are read from the database at most
+// every policyRefresh. The now value of the policies is told by clock.
+type policyEngine struct {
+	db    *gorm.DB
+	clock Clock
+
+	mu       sync.Mutex
+	programs map[string]cel.Program
+	loadedAt time.Time
+}
+
+// invalidate makes the policies be read again on their next evaluation.
+func (pe *policyEngine) invalidate() {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	pe.programs = nil
+}
+
+// load returns the compiled policies, reading them if they are outdated.
+func (pe *policyEngine) load() (map[string]cel.Program, error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if pe.programs != nil && time.Since(pe.loadedAt) < policyRefresh {
+		return pe.programs, nil
+	}
+
+	policies, err := (&policyGorm{db: pe.db}).List()
+	if err != nil {
+		return nil, err
+	}
+
+	programs := make(map[string]cel.Program, len(policies))
+	for _, p := range policies {
+		programs[p.Hook], err = compilePolicy(p.Expression)
+		if err != nil {
+			return nil, with(wrap("invalid policy", err), "hook", p.Hook)
+		}
+	}
+
+	pe.programs, pe.loadedAt = programs, time.Now()
+	return programs, nil
+}
+
+// checkRating evaluates the policies on r, denying it or adjusting its score.
+// The errors of the evaluation fail the rating.
+func (pe *policyEngine) checkRating(r *Rating) error {
+	programs, err := pe.load()
+	if err != nil {
+		return err
+	}
+
+	if len(programs) == 0 {
+		return nil
+	}
+
+	values := policyValues(r, pe.clock.Now())
+	if p := programs[PolicyCanRate]; p != nil {
+		v, err := evalPolicy(p, values)
+		if err != nil {
+			return with(wrap("could not evaluate policy", err), "hook", PolicyCanRate)
+		}
+
+		allowed, ok := v.(bool)
+		if !ok {
+			return with(wrap("policy did not return a bool", nil), "hook", PolicyCanRate)
+		} else if !allowed {
+			return ErrPolicyDenied
+		}
+	}
+
+	if p := programs[PolicyScore]; p != nil {
+		v, err := evalPolicy(p, values)
+		if err != nil {
+			return with(wrap("could not evaluate policy", err), "hook", PolicyScore)
+		}
+
+		score, ok := v.(int64)
+		if !ok {
+			return with(wrap("policy did not return an int", nil), "hook", PolicyScore)
+		} else if score == 0 || score < math.MinInt32 || score > math.MaxInt32 {
+			return ValidationError{"score": ErrInvalid}
+		}
+
+		r.Score = int(score)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyService_Check(t *testing.T) {
+	ps := newPolicyService(nil, &policyEngine{clock: SystemClock})
+
+	var cases = []struct {
+		name  string
+		hook  string
+		expr  string
+		valid bool
+	}{
+		{"canRate", PolicyCanRate, `user.roleId != 3 && !rating.comment.contains("http")`, true},
+		{"score", PolicyScore, `rating.campaignId == null ? rating.score : rating.score * 2`, true},
+		{"now", PolicyCanRate, `now > 0`, true},
+		{"wrongType", PolicyCanRate, `rating.score + 1`, false},
+		{"wrongScoreType", PolicyScore, `rating.score > 2`, false},
+		{"syntax", PolicyCanRate, `user.roleId !=`, false},
+		{"unknownField", PolicyCanRate, `user.name == "Rick"`, false},
+		{"unknownVariable", PolicyCanRate, `target == 2`, false},
+		{"crossTypeNumbers", PolicyCanRate, `rating.score >= 1.5`, true},
+		{"macros", PolicyCanRate, `["spam", "ads"].all(w, !rating.comment.contains(w))`, true},
+		{"costLimit", PolicyCanRate, `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9].all(a, [0, 1, 2, 3, 4, 5, 6, 7, 8, 9].all(b,
+			[0, 1, 2, 3, 4, 5, 6, 7, 8, 9].all(c, a + b + c >= 0)))`, false},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			err := ps.Check(cs.hook, cs.expr)
+			if cs.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	t.Run("unknownHook", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, ps.Check("other", "true"))
+	})
+
+	t.Run("setInvalid", func(t *testing.T) {
+		err := ps.Set(&Policy{Hook: PolicyCanRate, Expression: "1", UpdatedBy: 1})
+		assert.Equal(t, ValidationError{"expression": ErrInvalid}, err)
+
+		err = ps.Set(&Policy{Hook: PolicyCanRate, UpdatedBy: 1})
+		assert.Equal(t, ValidationError{"expression": ErrRequired}, err)
+	})
+}
+
+func TestPolicyEngine_CheckRating(t *testing.T) {
+	compile := func(expr string) cel.Program {
+		p, err := compilePolicy(expr)
+		require.NoError(t, err)
+		return p
+	}
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	pe := &policyEngine{clock: FixedClock(now), loadedAt: time.Now()}
+	user := &User{ID: 7, RoleID: 2, Email: "rick@acme.com"}
+
+	t.Run("none", func(t *testing.T) {
+		pe.programs = map[string]cel.Program{}
+
+		r := Rating{Score: 3, User: user}
+		assert.NoError(t, pe.checkRating(&r))
+		assert.Equal(t, 3, r.Score)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		pe.programs = map[string]cel.Program{
+			PolicyCanRate: compile(`user.email.endsWith("@acme.com") && rating.target != 9`),
+		}
+
+		assert.Equal(t, ErrPolicyDenied, pe.checkRating(&Rating{Target: 9, Score: 3, User: user}))
+		assert.NoError(t, pe.checkRating(&Rating{Target: 8, Score: 3, User: user}))
+	})
+
+	t.Run("score", func(t *testing.T) {
+		pe.programs = map[string]cel.Program{
+			PolicyScore: compile(`user.roleId == 2 ? rating.score * 2 : rating.score`),
+		}
+
+		r := Rating{Score: 3, User: user}
+		assert.NoError(t, pe.checkRating(&r))
+		assert.Equal(t, 6, r.Score)
+	})
+
+	t.Run("zeroScore", func(t *testing.T) {
+		pe.programs = map[string]cel.Program{
+			PolicyScore: compile(`rating.score - 3`),
+		}
+
+		r := Rating{Score: 3, User: user}
+		assert.Equal(t, ValidationError{"score": ErrInvalid}, pe.checkRating(&r))
+	})
+
+	t.Run("userID", func(t *testing.T) {
+		pe.programs = map[string]cel.Program{
+			PolicyCanRate: compile(`user.id == 7`),
+		}
+
+		assert.NoError(t, pe.checkRating(&Rating{UserID: 7, Score: 3}), "must fall back to the UserID")
+	})
+
+	t.Run("now", func(t *testing.T) {
+		pe.programs = map[string]cel.Program{
+			PolicyCanRate: compile(`now == 1577880000`),
+		}
+
+		assert.NoError(t, pe.checkRating(&Rating{Score: 3, User: user}), "must tell the time with the clock")
+	})
+
+	t.Run("evaluationError", func(t *testing.T) {
+		pe.programs = map[string]cel.Program{
+			PolicyScore: compile(`rating.score / (rating.target - 9)`),
+		}
+
+		err := pe.checkRating(&Rating{Target: 9, Score: 3, User: user})
+		require.Error(t, err)
+		_, public := err.(PublicError)
+		assert.False(t, public, "must fail as an internal error")
+	})
+}
+
+func TestPolicyGORM(t *testing.T) {
+	db := setupGorm(t)
+	pe := &policyEngine{db: db, clock: SystemClock}
+	ps := newPolicyService(db, pe)
+
+	assert.NoError(t, pe.checkRating(&Rating{Score: 3, UserID: 1}))
+
+	p := Policy{Hook: PolicyCanRate, Expression: "user.id != 1", UpdatedBy: 1}
+	require.NoError(t, ps.Set(&p))
+	assert.False(t, p.UpdatedAt.IsZero())
+	assert.Equal(t, ErrPolicyDenied, pe.checkRating(&Rating{Score: 3, UserID: 1}), "must apply the policy set right away")
+
+	p = Policy{Hook: PolicyCanRate, Expression: "user.id != 2", UpdatedBy: 1}
+	require.NoError(t, ps.Set(&p))
+
+	policies, err := ps.List()
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, "user.id != 2", policies[0].Expression)
+
+	require.NoError(t, ps.Remove(PolicyCanRate, 1))
+	assert.Equal(t, ErrNotFound, ps.Remove(PolicyCanRate, 1))
+	assert.NoError(t, pe.checkRating(&Rating{Score: 3, UserID: 2}))
+
+	changes, err := ps.Changes(PolicyCanRate)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, [][2]string{
+		{"user.id != 2", ""},
+		{"user.id != 1", "user.id != 2"},
+		{"", "user.id != 1"},
+	}, [][2]string{
+		{changes[0].Previous, changes[0].Expression},
+		{changes[1].Previous, changes[1].Expression},
+		{changes[2].Previous, changes[2].Expression},
+	})
+	assert.Equal(t, int64(1), changes[0].UserID)
+
+	_, err = ps.Changes("other")
+	assert.Equal(t, ErrNotFound, err)
+}
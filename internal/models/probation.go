@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// probation holds back the ratings of new accounts, on probation for period,
+// see Config.NewAccountPeriod. The ratings they create are held back from the
+// aggregates until a moderator reviews them, even once the period ends.
+// Nothing new is held back if period is zero, but the ratings held before stay
+// held until they are reviewed.
+type probation struct {
+	period time.Duration
+
+	// clock tells the age of the accounts, the clock of the system if
+	// nil.
+	clock Clock
+}
+
+// now returns the time told by the clock of p.
+func (p probation) now() time.Time {
+	if p.clock == nil {
+		return SystemClock.Now()
+	}
+
+	return p.clock.Now()
+}
+
+// since returns the creation time after which accounts are on probation.
+func (p probation) since() time.Time {
+	return p.now().Add(-p.period)
+}
+
+// hold flags the rating with ID id as held back from the aggregates if its
+// user is on probation. It must be called in the transaction that creates the
+// rating.
+func (p probation) hold(tx *gorm.DB, id int64) error {
+	if p.period <= 0 {
+		return nil
+	}
+
+	err := tx.Exec(`UPDATE ratings SET held = true WHERE id = ?
+		AND EXISTS (SELECT 1 FROM users WHERE users.id = ratings.user_id AND users.created_at > ?)`,
+		id, p.since()).Error
+	if err != nil {
+		return with(wrap("could not hold back rating", err), "rating_id", id)
+	}
+
+	return nil
+}
+
+// release clears the held flag of the rating with ID id, once a moderator
+// reviewed it.
+func release(tx *gorm.DB, id int64) error {
+	err := tx.Exec("UPDATE ratings SET held = false WHERE id = ? AND held", id).Error
+	if err != nil {
+		return with(wrap("could not release rating", err), "rating_id", id)
+	}
+
+	return nil
+}
+
+// counted restricts db, a query on the ratings table, to the ratings counted in
+// the aggregates.
+func (p probation) counted(db *gorm.DB) *gorm.DB {
+	return db.Where("NOT ratings.held")
+}
+
+// held restricts db, a query on the ratings table, to the active ratings held
+// back from the aggregates.
+func (p probation) held(db *gorm.DB) *gorm.DB {
+	return db.Where("ratings.active AND ratings.held")
+}
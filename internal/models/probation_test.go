@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbation_since(t *testing.T) {
+	now := time.Date(2020, 3, 14, 10, 0, 0, 0, time.UTC)
+	p := probation{period: 7 * 24 * time.Hour, clock: FixedClock(now)}
+
+	assert.Equal(t, time.Date(2020, 3, 7, 10, 0, 0, 0, time.UTC), p.since())
+	assert.Equal(t, now, p.now())
+	assert.WithinDuration(t, time.Now(), probation{}.now(), time.Minute, "must default to the clock of the system")
+}
+
+func TestProbation(t *testing.T) {
+	db := setupGorm(t)
+
+	// user 1 was just created, user 98 is an established account
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Exec("UPDATE users SET created_at = now() - interval '30 days' WHERE id = 98").Error)
+
+	rg := &ratingGorm{db: db, probation: probation{period: 7 * 24 * time.Hour}}
+	require.NoError(t, rg.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 1}))
+	require.NoError(t, rg.Create(&Rating{ID: 11, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 98}))
+	require.NoError(t, rg.Create(&Rating{ID: 12, Active: true, Extra: json.RawMessage(`{}`), Score: 3, Target: 7, UserID: 1}))
+
+	var moderated []int64
+	reps := newReputationService(db, probation{period: 7 * 24 * time.Hour}, func(r Rating) {
+		moderated = append(moderated, r.ID)
+	}, nil)
+	rs := newRatingService(db, nil, nil, nil, probation{period: 7 * 24 * time.Hour}, nil, nil, nil, nil, verification{})
+
+	t.Run("disabled", func(t *testing.T) {
+		// nothing new is held back, but the held ratings stay held
+		require.NoError(t, (&ratingGorm{db: db}).Create(&Rating{ID: 13, Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 8, UserID: 1}))
+
+		stats, err := NewRatingService(db, nil).StatsByTarget(8)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Count)
+
+		stats, err = NewRatingService(db, nil).StatsByTarget(9)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Count)
+	})
+
+	stats, err := rs.StatsByTarget(9)
+	require.NoError(t, err)
+	assert.Equal(t, RatingStats{Target: 9, Count: 1, Average: 5, WeightedAverage: 5, Min: 5, Max: 5}, stats)
+
+	held, err := reps.Held()
+	require.NoError(t, err)
+	require.Len(t, held, 2)
+	assert.Equal(t, int64(10), held[0].ID)
+	assert.Equal(t, int64(12), held[1].ID)
+
+	// the end of the probation does not release the ratings
+	require.NoError(t, db.Exec("UPDATE users SET created_at = now() - interval '30 days' WHERE id = 1").Error)
+	held, err = reps.Held()
+	require.NoError(t, err)
+	assert.Len(t, held, 2)
+
+	require.NoError(t, reps.Moderate(&Moderation{RatingID: 10, Outcome: ModerationApproved, ModeratorID: 98}))
+	require.NoError(t, reps.Moderate(&Moderation{RatingID: 12, Outcome: ModerationRemoved, ModeratorID: 98}))
+	assert.Equal(t, []int64{10, 12}, moderated)
+
+	held, err = reps.Held()
+	require.NoError(t, err)
+	assert.Empty(t, held)
+
+	stats, err = rs.StatsByTarget(9)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Count)
+	assert.Equal(t, float64(3), stats.Average)
+
+	k, err := (&Services{db: db, probation: probation{period: 7 * 24 * time.Hour}, clock: SystemClock}).KPIs(5)
+	require.NoError(t, err)
+	require.Len(t, k.TopTargets, 1)
+	assert.Equal(t, int64(9), k.TopTargets[0].Target)
+}
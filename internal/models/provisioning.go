@@ -0,0 +1,218 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+// tenantLockSpace is the first key of the Postgres advisory locks held while
+// provisioning or deleting a tenant, the second being its ID.
+const tenantLockSpace = 7236135
+
+// A tenantStep is a step of the provisioning or deletion of a tenant. Each step
+// commits its changes before the next one runs, as the migrations are applied
+// on a connection of their own.
+type tenantStep struct {
+	name string
+	run  func(db *gorm.DB) error
+}
+
+// tenantProvisioner provisions and deletes the tenants in the background,
+// reporting its progress on them.
+type tenantProvisioner struct {
+	db      *gorm.DB
+	tenants TenantDB
+
+	// clock dates the tenants, and the password of their admin user.
+	clock Clock
+
+	// defaultRoles are created along with the admin and user roles, see
+	// Config.DefaultRoles.
+	defaultRoles []DefaultRole
+
+	// onError is called with the errors found provisioning or deleting
+	// the tenants, and may be nil.
+	onError func(error)
+
+	// onChanged is called with the tenants changed in the background, and
+	// may be nil.
+	onChanged func(Tenant)
+
+	wg sync.WaitGroup
+}
+
+// start runs f in the background.
+func (tp *tenantProvisioner) start(f func()) {
+	tp.wg.Add(1)
+	go func() {
+		defer tp.wg.Done()
+		f()
+	}()
+}
+
+// wait waits for the operations running in the background to end.
+func (tp *tenantProvisioner) wait() {
+	tp.wg.Wait()
+}
+
+// provision prepares the schema of t, making it active.
+func (tp *tenantProvisioner) provision(t Tenant, admin TenantAdmin) {
+	steps := []tenantStep{
+		{"schema", func(db *gorm.DB) error {
+			return db.Exec("CREATE SCHEMA " + pq.QuoteIdentifier(t.Schema)).Error
+		}},
+		{"migrations", func(db *gorm.DB) error {
+			_, _, err := migrateSchema(db, migrationFiles, t.Schema, (*migrate.Migrate).Up)
+			return err
+		}},
+		// the public schema is left out of the search path of the
+		// next steps, so nothing can be created there by mistake
+		{"metering", func(db *gorm.DB) error {
+			return inSchema(db, t.Schema, meterSchema)
+		}},
+		{"roles", func(db *gorm.DB) error {
+			return inSchema(db, t.Schema, func(tx *gorm.DB) error {
+				err := createDefaultRoles(tx)
+				if err != nil {
+					return err
+				}
+
+				_, err = upgradePermissions(tx, permissionUpgrades)
+				if err != nil {
+					return err
+				}
+
+				_, err = createConfiguredRoles(tx, tp.defaultRoles)
+				return err
+			})
+		}},
+		{"admin", func(db *gorm.DB) error {
+			return inSchema(db, t.Schema, func(tx *gorm.DB) error {
+				_, err := createAdminUser(tx, admin.Email, admin.Password, tp.clock)
+				return err
+			})
+		}},
+	}
+
+	err := tp.run(t, steps)
+	if err != nil {
+		// the steps done are dropped with the schema, so a failed
+		// tenant is left without one
+		drop := tp.db.Exec("DROP SCHEMA IF EXISTS " + pq.QuoteIdentifier(t.Schema) + " CASCADE").Error
+		if drop != nil && tp.onError != nil {
+			tp.onError(with(wrap("could not drop the schema of a failed tenant", drop), "tenant_id", t.ID))
+		}
+	}
+	if err == nil {
+		err = tp.tenants.SetStatus(t.ID, TenantActive, TenantProvisioning)
+		if xerrors.Is(err, ErrTenantStatus) {
+			// deleted meanwhile
+			err = nil
+		}
+	}
+	if err != nil {
+		tp.fail(t, wrap("could not provision tenant", err))
+	}
+
+	tp.changed(t.ID)
+}
+
+// remove deletes t with its schema and hostnames.
+func (tp *tenantProvisioner) remove(t Tenant) {
+	var steps []tenantStep
+	if t.Schema != "" {
+		steps = append(steps, tenantStep{"schema", func(db *gorm.DB) error {
+			return db.Exec("DROP SCHEMA IF EXISTS " + pq.QuoteIdentifier(t.Schema) + " CASCADE").Error
+		}})
+	}
+	steps = append(steps, tenantStep{"tenant", func(db *gorm.DB) error {
+		return db.Exec("DELETE FROM tenants WHERE id = ?", t.ID).Error
+	}})
+
+	err := tp.run(t, steps)
+	if err != nil {
+		tp.fail(t, wrap("could not delete tenant", err))
+		tp.changed(t.ID)
+		return
+	}
+
+	if tp.onChanged != nil {
+		tp.onChanged(t)
+	}
+}
+
+// run runs the steps in order, recording the progress on t. It waits for the
+// other operations on t to end first. The steps done are kept if a later one
+// fails.
+func (tp *tenantProvisioner) run(t Tenant, steps []tenantStep) error {
+	ctx := context.Background()
+
+	// the lock is held by a session for the whole operation, on a
+	// connection reserved from the pool, while the steps run on others
+	conn, err := tp.db.DB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1, $2)", tenantLockSpace, t.ID)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1, $2)", tenantLockSpace, t.ID)
+		if err != nil {
+			// closing the session releases the lock, instead of
+			// returning the connection to the pool still holding it
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+
+	for i, s := range steps {
+		err = tp.tenants.SetProgress(t.ID, TenantProgress{Step: s.name, Done: i, Total: len(steps)})
+		if err != nil {
+			return err
+		}
+
+		err = s.run(tp.db)
+		if err != nil {
+			return with(err, "step", s.name)
+		}
+	}
+
+	return tp.tenants.SetProgress(t.ID, TenantProgress{Step: steps[len(steps)-1].name, Done: len(steps), Total: len(steps)})
+}
+
+// fail leaves t failed, recording err on its progress.
+func (tp *tenantProvisioner) fail(t Tenant, err error) {
+	if tp.onError != nil {
+		tp.onError(with(err, "tenant_id", t.ID))
+	}
+
+	tn, _ := tp.tenants.ByID(t.ID)
+	p := tn.Progress
+	p.Error = err.Error()
+	tp.tenants.SetProgress(t.ID, p)
+	tp.tenants.SetStatus(t.ID, TenantFailed)
+}
+
+// changed passes the tenant with the given ID to onChanged, if it still exists.
+func (tp *tenantProvisioner) changed(id int64) {
+	if tp.onChanged == nil {
+		return
+	}
+
+	t, err := tp.tenants.ByID(id)
+	if err != nil {
+		return
+	}
+
+	tp.onChanged(t)
+}
@@ -0,0 +1,479 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/queries.go -pkg modelstest . QueryService:QueryService
+
+// QueryService defines a set of methods used to run saved analytical queries
+// against the database. Saved queries are defined in the configuration, and
+// run in read-only transactions with a limited number of rows and time.
+type QueryService interface {
+	// List returns the saved queries sorted by name.
+	List() []SavedQuery
+
+	// Run executes the saved query with the given name. params holds the
+	// values of the query parameters, as found in a request, and is
+	// validated against the parameters defined by the query.
+	//
+	// ErrNotFound is returned if no query exists with the name. A
+	// ValidationError is returned if any parameter is missing, unknown or
+	// cannot be parsed.
+	Run(name string, params map[string]string) (QueryResult, error)
+}
+
+// Saved query parameter types, as used in QueryParam.Type.
+const (
+	QueryParamInt    = "int"
+	QueryParamString = "string"
+	QueryParamBool   = "bool"
+)
+
+const (
+	// defaultQueryMaxRows is the row limit applied to saved queries that
+	// do not define their own.
+	defaultQueryMaxRows = 100
+
+	// queryMaxRowsLimit is the highest row limit a saved query can have.
+	queryMaxRowsLimit = 10000
+
+	// queryTimeout is the longest time a saved query may run for, or the
+	// statement timeout of the requests if shorter, see
+	// Config.StatementTimeout.
+	queryTimeout = 10 * time.Second
+)
+
+// A SavedQuery is a curated SQL query that can be run through QueryService.
+type SavedQuery struct {
+	// Name identifies the query.
+	Name string `json:"name"`
+
+	// Description explains what the query returns.
+	Description string `json:"description,omitempty"`
+
+	// SQL is a single SELECT statement. Parameters are referenced in the
+	// statement by their name prefixed with a colon, like ":target".
+	SQL string `json:"-"`
+
+	// Params defines the parameters accepted by the query.
+	Params []QueryParam `json:"params"`
+
+	// MaxRows is the maximum number of rows returned. Defaults to 100.
+	MaxRows int `json:"maxRows"`
+
+	// sql is SQL with the parameter references replaced by the
+	// positional placeholders of Postgres, $1, $2..., and args holds the
+	// name of the parameter of each placeholder.
+	sql  string
+	args []string
+}
+
+// A QueryParam defines a parameter of a SavedQuery.
+type QueryParam struct {
+	// Name identifies the parameter.
+	Name string `json:"name"`
+
+	// Type is one of QueryParamInt, QueryParamString or QueryParamBool.
+	Type string `json:"type"`
+
+	// Default is used when no value is provided for the parameter. The
+	// parameter is required if left empty.
+	Default string `json:"default,omitempty"`
+}
+
+// A QueryResult holds the rows returned by a saved query.
+type QueryResult struct {
+	// Columns contains the names of the columns of each row.
+	Columns []string `json:"columns"`
+
+	// Rows contains the values of each row, in the order of Columns.
+	Rows [][]interface{} `json:"rows"`
+
+	// Truncated is true when the query returned more rows than allowed by
+	// its MaxRows.
+	Truncated bool `json:"truncated"`
+}
+
+// queryParamRef matches parameter references in the SQL of saved queries. The
+// first group makes sure casts like "::int" are not taken as references.
+var queryParamRef = regexp.MustCompile(`(^|[^:]):([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// sqlDollarTag matches the opening tag of a dollar-quoted string, like $$ or
+// $body$.
+var sqlDollarTag = regexp.MustCompile(`^\$([a-zA-Z_][a-zA-Z0-9_]*)?\$`)
+
+// splitSQL splits sql into the sections holding code, and those holding string
+// literals, quoted identifiers and comments, whose contents must not be taken
+// as code. The sections are returned in order, the code ones at even indexes,
+// so joining them gives sql back. An error is returned if a quote or comment is
+// not terminated.
+func splitSQL(sql string) ([]string, error) {
+	var (
+		sections []string
+		start    int
+	)
+
+	isIdent := func(i int) bool {
+		c := sql[i]
+		return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+
+	for i := 0; i < len(sql); i++ {
+		var end string
+		escapes := false
+
+		switch c := sql[i]; {
+		case c == '\'' || c == '"':
+			end = string(c)
+			// E'...' strings accept backslash escapes
+			escapes = c == '\'' && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdent(i-2))
+		case strings.HasPrefix(sql[i:], "--"):
+			end = "\n"
+		case strings.HasPrefix(sql[i:], "/*"):
+			end = "*/"
+		case c == '$' && (i == 0 || !isIdent(i-1)):
+			end = sqlDollarTag.FindString(sql[i:])
+		}
+		if end == "" {
+			continue
+		}
+
+		j := i + len(end)
+		if end == "*/" {
+			j = i + 2
+		}
+		for ; j < len(sql); j++ {
+			if escapes && sql[j] == '\\' {
+				j++
+				continue
+			}
+			if !strings.HasPrefix(sql[j:], end) {
+				continue
+			}
+			// doubled quotes are escaped quotes
+			if len(end) == 1 && end != "\n" && strings.HasPrefix(sql[j+1:], end) {
+				j++
+				continue
+			}
+			break
+		}
+
+		switch {
+		case j < len(sql):
+			j += len(end)
+		case end != "\n":
+			return nil, wrap("sql has an unterminated quote or comment", nil)
+		default:
+			j = len(sql)
+		}
+
+		sections = append(sections, sql[start:i], sql[i:j])
+		start, i = j, j-1
+	}
+
+	return append(sections, sql[start:]), nil
+}
+
+// ParseSavedQueries decodes the saved queries defined in b, a JSON object with
+// query names as keys and SavedQuery definitions as values. The queries are
+// checked to be usable by QueryService.
+func ParseSavedQueries(b []byte) (map[string]SavedQuery, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+
+	// the SQL field is not decoded from its JSON tag, which hides it from
+	// API responses
+	var defs map[string]struct {
+		SavedQuery
+		SQL string `json:"sql"`
+	}
+	err := d.Decode(&defs)
+	if err != nil {
+		return nil, wrap("could not decode saved queries", err)
+	}
+
+	qs := make(map[string]SavedQuery, len(defs))
+	for name, def := range defs {
+		q := def.SavedQuery
+		q.Name = name
+		q.SQL = def.SQL
+
+		err = q.prepare()
+		if err != nil {
+			return nil, wrap("invalid saved query "+name, err)
+		}
+
+		qs[name] = q
+	}
+
+	return qs, nil
+}
+
+// prepare checks the definition of q and sets its unexported fields.
+func (q *SavedQuery) prepare() error {
+	sql := strings.TrimSpace(q.SQL)
+	sql = strings.TrimSuffix(sql, ";")
+	if !strings.HasPrefix(strings.ToUpper(sql), "SELECT") && !strings.HasPrefix(strings.ToUpper(sql), "WITH") {
+		return wrap("sql must be a SELECT statement", nil)
+	}
+
+	sections, err := splitSQL(sql)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(sections); i += 2 {
+		if strings.Contains(sections[i], ";") {
+			return wrap("sql must be a single statement", nil)
+		}
+	}
+
+	if q.MaxRows == 0 {
+		q.MaxRows = defaultQueryMaxRows
+	}
+	if q.MaxRows < 0 || q.MaxRows > queryMaxRowsLimit {
+		return wrap("maxRows must be between 1 and "+strconv.Itoa(queryMaxRowsLimit), nil)
+	}
+
+	declared := make(map[string]bool, len(q.Params))
+	for _, p := range q.Params {
+		switch p.Type {
+		case QueryParamInt, QueryParamString, QueryParamBool:
+		default:
+			return wrap("param "+p.Name+" has an unknown type", nil)
+		}
+
+		if p.Default != "" {
+			if _, err := p.parse(p.Default); err != nil {
+				return wrap("param "+p.Name+" has an invalid default", err)
+			}
+		}
+
+		declared[p.Name] = true
+	}
+
+	q.args = nil
+	for i := 0; i < len(sections); i += 2 {
+		sections[i] = queryParamRef.ReplaceAllStringFunc(sections[i], func(ref string) string {
+			m := queryParamRef.FindStringSubmatch(ref)
+			q.args = append(q.args, m[2])
+			return m[1] + "$" + strconv.Itoa(len(q.args))
+		})
+	}
+	q.sql = strings.Join(sections, "")
+
+	for _, a := range q.args {
+		if !declared[a] {
+			return wrap("param "+a+" is not declared", nil)
+		}
+	}
+
+	return nil
+}
+
+// parse converts v to the type of p. It may return ErrInvalid.
+func (p QueryParam) parse(v string) (interface{}, error) {
+	switch p.Type {
+	case QueryParamInt:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		return i, nil
+
+	case QueryParamBool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		return b, nil
+	}
+
+	return v, nil
+}
+
+type queryService struct {
+	QueryService
+}
+
+// NewQueryService instantiates a new QueryService implementation with db as
+// the backing database, serving the saved queries in qs.
+func NewQueryService(db *gorm.DB, qs map[string]SavedQuery) QueryService {
+	return newQueryService(db, qs, 0)
+}
+
+// newQueryService creates the QueryService of NewQueryService, whose queries
+// run for up to limit if it is shorter than queryTimeout and not zero.
+func newQueryService(db *gorm.DB, qs map[string]SavedQuery, limit time.Duration) QueryService {
+	timeout := queryTimeout
+	if limit > 0 && limit < timeout {
+		timeout = limit
+	}
+
+	return &queryService{
+		QueryService: &queryValidator{
+			queries: qs,
+			qg:      &queryGorm{db: db, timeout: timeout},
+		},
+	}
+}
+
+type queryValidator struct {
+	queries map[string]SavedQuery
+	qg      *queryGorm
+}
+
+func (qv *queryValidator) List() []SavedQuery {
+	qs := make([]SavedQuery, 0, len(qv.queries))
+	for _, q := range qv.queries {
+		qs = append(qs, q)
+	}
+
+	sort.Slice(qs, func(i, j int) bool {
+		return qs[i].Name < qs[j].Name
+	})
+
+	return qs
+}
+
+func (qv *queryValidator) Run(name string, params map[string]string) (QueryResult, error) {
+	q, ok := qv.queries[name]
+	if !ok {
+		return QueryResult{}, ErrNotFound
+	}
+
+	var (
+		ve     = ValidationError{}
+		values = make(map[string]interface{}, len(q.Params))
+	)
+
+	for k := range params {
+		if !q.hasParam(k) {
+			ve[k] = ErrInvalid
+		}
+	}
+
+	for _, p := range q.Params {
+		v, ok := params[p.Name]
+		if !ok {
+			v, ok = p.Default, p.Default != ""
+		}
+		if !ok {
+			ve[p.Name] = ErrRequired
+			continue
+		}
+
+		pv, err := p.parse(v)
+		if err != nil {
+			ve[p.Name] = ErrInvalid
+			continue
+		}
+
+		values[p.Name] = pv
+	}
+
+	if len(ve) > 0 {
+		return QueryResult{}, ve
+	}
+
+	args := make([]interface{}, len(q.args))
+	for i, a := range q.args {
+		args[i] = values[a]
+	}
+
+	return qv.qg.run(&q, args)
+}
+
+// hasParam checks if q defines a parameter with the given name.
+func (q *SavedQuery) hasParam(name string) bool {
+	for _, p := range q.Params {
+		if p.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+type queryGorm struct {
+	db *gorm.DB
+
+	// timeout is the statement timeout of the queries.
+	timeout time.Duration
+}
+
+// run executes q with args as the values of its placeholders, within a
+// read-only transaction. One more row than allowed is fetched to find out if
+// the result is truncated.
+func (qg *queryGorm) run(q *SavedQuery, args []interface{}) (QueryResult, error) {
+	var res = QueryResult{Rows: [][]interface{}{}}
+
+	err := gormTransaction(qg.db, func(tx *gorm.DB) error {
+		// warning: non standard SQL used to restrict the transaction
+		err := tx.
+			Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY").
+			Exec("SET LOCAL statement_timeout = " + strconv.Itoa(int(qg.timeout/time.Millisecond))).
+			Error
+		if err != nil {
+			return wrap("could not set query transaction mode", err)
+		}
+
+		// the query may end with a line comment
+		limited := "SELECT * FROM (" + q.sql + "\n) AS saved_query LIMIT " + strconv.Itoa(q.MaxRows+1)
+
+		// the placeholders are given to the driver as they are, as gorm
+		// would also replace the question marks of the string literals
+		rows, err := tx.CommonDB().Query(limited, args...)
+		if err != nil {
+			return wrap("could not run saved query "+q.Name, err)
+		}
+		defer rows.Close()
+
+		res.Columns, err = rows.Columns()
+		if err != nil {
+			return wrap("could not get saved query columns", err)
+		}
+
+		for rows.Next() {
+			if len(res.Rows) == q.MaxRows {
+				res.Truncated = true
+				break
+			}
+
+			row := make([]interface{}, len(res.Columns))
+			ptrs := make([]interface{}, len(row))
+			for i := range row {
+				ptrs[i] = &row[i]
+			}
+
+			err = rows.Scan(ptrs...)
+			if err != nil {
+				return wrap("could not scan saved query row", err)
+			}
+
+			// text values are returned as bytes by the driver
+			for i, v := range row {
+				if b, ok := v.([]byte); ok {
+					row[i] = string(b)
+				}
+			}
+
+			res.Rows = append(res.Rows, row)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+const testSavedQueries = `{
+	"ratingsByScore": {
+		"description": "Number of ratings of a target per score",
+		"sql": "SELECT score, count(*)::int AS ratings FROM ratings WHERE target = :target AND active = :active GROUP BY score ORDER BY score",
+		"params": [
+			{"name": "target", "type": "int"},
+			{"name": "active", "type": "bool", "default": "true"}
+		],
+		"maxRows": 2
+	},
+	"usersByEmail": {
+		"sql": "SELECT id, email FROM users WHERE email LIKE :pattern OR email = :pattern ORDER BY id",
+		"params": [
+			{"name": "pattern", "type": "string"}
+		]
+	}
+}`
+
+func TestParseSavedQueries(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		qs, err := ParseSavedQueries([]byte(testSavedQueries))
+		require.NoError(t, err)
+		require.Len(t, qs, 2)
+
+		q := qs["ratingsByScore"]
+		assert.Equal(t, "ratingsByScore", q.Name)
+		assert.Equal(t, 2, q.MaxRows)
+		assert.Equal(t, "SELECT score, count(*)::int AS ratings FROM ratings WHERE target = $1 AND active = $2 GROUP BY score ORDER BY score", q.sql)
+		assert.Equal(t, []string{"target", "active"}, q.args)
+
+		q = qs["usersByEmail"]
+		assert.Equal(t, 100, q.MaxRows)
+		assert.Equal(t, []string{"pattern", "pattern"}, q.args)
+	})
+
+	var cases = []struct {
+		name string
+		in   string
+	}{
+		{"badJSON", `{"q": []}`},
+		{"unknownField", `{"q": {"sql": "SELECT 1", "query": "SELECT 2"}}`},
+		{"notSelect", `{"q": {"sql": "DELETE FROM ratings"}}`},
+		{"multipleStatements", `{"q": {"sql": "SELECT 1; DELETE FROM ratings"}}`},
+		{"statementAfterLiteral", `{"q": {"sql": "SELECT ';'; DELETE FROM ratings"}}`},
+		{"unterminatedLiteral", `{"q": {"sql": "SELECT 'it''s"}}`},
+		{"unterminatedComment", `{"q": {"sql": "SELECT 1 /* ;"}}`},
+		{"maxRowsTooHigh", `{"q": {"sql": "SELECT 1", "maxRows": 100000}}`},
+		{"maxRowsNegative", `{"q": {"sql": "SELECT 1", "maxRows": -1}}`},
+		{"unknownType", `{"q": {"sql": "SELECT :a", "params": [{"name": "a", "type": "float"}]}}`},
+		{"badDefault", `{"q": {"sql": "SELECT :a", "params": [{"name": "a", "type": "int", "default": "one"}]}}`},
+		{"undeclaredParam", `{"q": {"sql": "SELECT :a, :b", "params": [{"name": "a", "type": "int"}]}}`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			_, err := ParseSavedQueries([]byte(cs.in))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSavedQuery_prepare(t *testing.T) {
+	var cases = []struct {
+		name string
+		sql  string
+		out  string
+		args []string
+	}{
+		{
+			"literal",
+			`SELECT id FROM ratings WHERE comment = '10:30' AND target = :target`,
+			`SELECT id FROM ratings WHERE comment = '10:30' AND target = $1`,
+			[]string{"target"},
+		},
+		{
+			"escapedQuote",
+			`SELECT 'it''s :target', :target`,
+			`SELECT 'it''s :target', $1`,
+			[]string{"target"},
+		},
+		{
+			"escapeString",
+			`SELECT E'it\'s :target', :target`,
+			`SELECT E'it\'s :target', $1`,
+			[]string{"target"},
+		},
+		{
+			"semicolons",
+			`SELECT ';' AS a, "b;c" FROM ratings WHERE comment <> $$;:target$$ AND target = :target;`,
+			`SELECT ';' AS a, "b;c" FROM ratings WHERE comment <> $$;:target$$ AND target = $1`,
+			[]string{"target"},
+		},
+		{
+			"questionMark",
+			`SELECT id FROM ratings WHERE comment LIKE '%?' AND target = :target`,
+			`SELECT id FROM ratings WHERE comment LIKE '%?' AND target = $1`,
+			[]string{"target"},
+		},
+		{
+			"comments",
+			"SELECT id /* :other; */ FROM ratings -- :other;\nWHERE target = :target::int -- :other",
+			"SELECT id /* :other; */ FROM ratings -- :other;\nWHERE target = $1::int -- :other",
+			[]string{"target"},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			q := SavedQuery{SQL: cs.sql, Params: []QueryParam{{Name: "target", Type: QueryParamInt}}}
+			require.NoError(t, q.prepare())
+			assert.Equal(t, cs.out, q.sql)
+			assert.Equal(t, cs.args, q.args)
+		})
+	}
+}
+
+func TestQueryService_List(t *testing.T) {
+	qs, err := ParseSavedQueries([]byte(testSavedQueries))
+	require.NoError(t, err)
+
+	list := NewQueryService(nil, qs).List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "ratingsByScore", list[0].Name)
+	assert.Equal(t, "usersByEmail", list[1].Name)
+
+	// the SQL must never be part of the API output
+	b, err := json.Marshal(list[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "SELECT")
+}
+
+func TestQueryService_timeout(t *testing.T) {
+	for _, tc := range []struct {
+		limit, out time.Duration
+	}{
+		{0, queryTimeout},
+		{time.Minute, queryTimeout},
+		{2 * time.Second, 2 * time.Second},
+	} {
+		s := newQueryService(nil, nil, tc.limit).(*queryService)
+		assert.Equal(t, tc.out, s.QueryService.(*queryValidator).qg.timeout,
+			"the queries must not outlive the requests, limited to %v", tc.limit)
+	}
+}
+
+func TestQueryService_Run(t *testing.T) {
+	qs, err := ParseSavedQueries([]byte(testSavedQueries))
+	require.NoError(t, err)
+
+	t.Run("validation", func(t *testing.T) {
+		s := NewQueryService(nil, qs)
+
+		var cases = []struct {
+			name   string
+			query  string
+			params map[string]string
+			outerr error
+		}{
+			{"notFound", "dropTables", nil, ErrNotFound},
+			{"required", "ratingsByScore", map[string]string{}, ValidationError{"target": ErrRequired}},
+			{"invalidInt", "ratingsByScore", map[string]string{"target": "x"}, ValidationError{"target": ErrInvalid}},
+			{"invalidBool", "ratingsByScore", map[string]string{"target": "1", "active": "maybe"}, ValidationError{"active": ErrInvalid}},
+			{"unknown", "ratingsByScore", map[string]string{"target": "1", "limit": "5"}, ValidationError{"limit": ErrInvalid}},
+		}
+
+		for _, cs := range cases {
+			t.Run(cs.name, func(t *testing.T) {
+				_, err := s.Run(cs.query, cs.params)
+				assert.True(t, xerrors.Is(err, cs.outerr),
+					"errors must match, expected %v, got %v", cs.outerr, err)
+			})
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		db := setupGorm(t)
+		s := NewQueryService(db, qs)
+
+		require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+		require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh"}).Error)
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 7, UserID: 1}).Error)
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 7, UserID: 98}).Error)
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 7, Target: 7, UserID: 99}).Error)
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 9, Target: 8, UserID: 99}).Error)
+
+		res, err := s.Run("ratingsByScore", map[string]string{"target": "7"})
+		require.NoError(t, err)
+		assert.Equal(t, QueryResult{
+			Columns:   []string{"score", "ratings"},
+			Rows:      [][]interface{}{{int64(5), int64(2)}, {int64(7), int64(1)}},
+			Truncated: false,
+		}, res)
+
+		res, err = s.Run("usersByEmail", map[string]string{"pattern": "%@test.com"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id", "email"}, res.Columns)
+		assert.Equal(t, [][]interface{}{{int64(98), "second@test.com"}, {int64(99), "third@test.com"}}, res.Rows)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		db := setupGorm(t)
+		s := NewQueryService(db, map[string]SavedQuery{
+			"series": {Name: "series", sql: "SELECT generate_series(1, 5) AS n", MaxRows: 3},
+		})
+
+		res, err := s.Run("series", nil)
+		require.NoError(t, err)
+		assert.Len(t, res.Rows, 3)
+		assert.True(t, res.Truncated)
+	})
+
+	t.Run("readOnly", func(t *testing.T) {
+		db := setupGorm(t)
+		s := NewQueryService(db, map[string]SavedQuery{
+			"sneaky": {Name: "sneaky", sql: "WITH d AS (DELETE FROM ratings RETURNING id) SELECT * FROM d", MaxRows: 3},
+		})
+
+		_, err := s.Run("sneaky", nil)
+		assert.Error(t, err)
+	})
+}
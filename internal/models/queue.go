@@ -0,0 +1,667 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/queue.go -pkg modelstest . RatingQueue:RatingQueue
+
+// RatingQueue defines a write-behind queue for the creation of ratings. It
+// allows accepting bursts of new ratings without hitting the database on each
+// request: ratings are validated and stored on disk, and persisted to the
+// database later on by a set of workers.
+//
+// Ratings of the same user and target are persisted in the same order they
+// were enqueued. Every queued rating is persisted exactly once, even if the
+// process is stopped before the queue is drained: pending ratings are resumed
+// the next time the queue is started.
+type RatingQueue interface {
+	// Enqueue validates r as RatingService.Create does for the fields that
+	// do not require any database access, for the campaign it is
+	// submitted to, if any, and for the rating quota of the user, and
+	// queues it for creation. The quota counts the ratings of the user
+	// still in this queue, and is checked again when the rating is
+	// persisted, as other queues may have accepted ratings of the same
+	// user in the meantime: the rating then fails with ErrRateLimited. The
+	// returned key identifies the creation and can be used to look up its
+	// outcome with Receipt.
+	//
+	// The rating is stored on disk by the time Enqueue returns.
+	Enqueue(r *Rating) (string, error)
+
+	// Receipt returns the outcome of the creation of a queued rating by its
+	// key. ErrNotFound is returned if the key is unknown.
+	Receipt(key string) (QueueReceipt, error)
+
+	// Close stops the queue workers once the ratings being persisted are
+	// done. Any other pending rating is kept on disk.
+	Close() error
+}
+
+// Queued rating creation statuses, as found in QueueReceipt.Status.
+const (
+	QueuePending = "pending"
+	QueueCreated = "created"
+	QueueFailed  = "failed"
+)
+
+// A QueueReceipt records the outcome of the creation of a queued rating.
+type QueueReceipt struct {
+	// Key is the key returned by RatingQueue.Enqueue.
+	Key string `gorm:"primary_key;size:32" json:"key"`
+
+	// UserID is the ID of the user that created the rating.
+	UserID int64 `gorm:"type:bigint;not null" json:"-"`
+
+	// Status is one of QueuePending, QueueCreated or QueueFailed.
+	Status string `gorm:"size:16;not null" json:"status"`
+
+	// RatingID is the ID of the created rating.
+	RatingID int64 `gorm:"type:bigint;not null;default:0" json:"ratingId,omitempty"`
+
+	// Error and Fields describe why the rating could not be created, with
+	// the same error codes returned by RatingService.Create.
+	Error  string          `gorm:"size:64;not null;default:''" json:"error,omitempty"`
+	Fields json.RawMessage `gorm:"type:jsonb" json:"fields,omitempty"`
+
+	// ProcessedAt is the time the rating left the queue.
+	ProcessedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"-"`
+}
+
+// QueueConfig defines configuration options for instantiating a RatingQueue.
+type QueueConfig struct {
+	// Dir is the directory where queued ratings are stored until they are
+	// persisted. It is created if it does not exist.
+	Dir string
+
+	// Workers is the number of ratings persisted concurrently. Defaults
+	// to 4.
+	Workers int
+
+	// OnError is called with the errors found when persisting queued
+	// ratings. These errors are retried, so it is only useful for
+	// reporting. May be nil.
+	OnError func(error)
+
+	// OnPersisted is called with each queued rating once it leaves the
+	// queue, whether it was created or not. May be nil.
+	OnPersisted func(r Rating)
+
+	// quota limits the ratings queued by each user, if not nil.
+	quota *ratingQuota
+
+	// rules are the custom rules on the ratings queued, if not nil.
+	rules *Rules
+
+	// probation holds back the ratings of new accounts when they are
+	// persisted.
+	probation probation
+
+	// outbox publishes the events of the ratings persisted, if not nil.
+	outbox *outbox
+
+	// verifier verifies the ratings queued, if not nil.
+	verifier TransactionVerifier
+
+	// clock dates the ratings queued, the clock of the system if nil.
+	clock Clock
+}
+
+// queuedRating is the content of each file stored in the queue directory.
+type queuedRating struct {
+	Key    string `json:"key"`
+	Rating Rating `json:"rating"`
+}
+
+type queuePartition struct {
+	mu      sync.Mutex
+	pending []string
+
+	// wake is signalled when a file is added to pending.
+	wake chan struct{}
+}
+
+type ratingQueue struct {
+	dir         string
+	db          *gorm.DB
+	rv          *ratingValidator
+	onError     func(error)
+	onPersisted func(Rating)
+	probation   probation
+	outbox      *outbox
+
+	// persist stores a queued rating in the database. It is replaced when
+	// testing.
+	persist func(qr *queuedRating) error
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	parts []*queuePartition
+	seq   int64
+
+	// queued is the number of ratings of each user in the queue, counted
+	// by the quota.
+	queuedMu sync.Mutex
+	queued   map[int64]int
+
+	closeOnce sync.Once
+	closing   chan struct{}
+	workers   sync.WaitGroup
+}
+
+// NewRatingQueue instantiates a new RatingQueue with db as the database where
+// ratings are persisted, and starts its workers. The ratings found in c.Dir
+// that were not persisted before are queued again.
+func NewRatingQueue(db *gorm.DB, c *QueueConfig) (RatingQueue, error) {
+	q, err := newRatingQueue(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	q.start()
+	return q, nil
+}
+
+func newRatingQueue(db *gorm.DB, c *QueueConfig) (*ratingQueue, error) {
+	if c.Dir == "" {
+		return nil, wrap("queue directory not defined", nil)
+	}
+
+	workers := c.Workers
+	if workers < 1 {
+		workers = 4
+	}
+
+	clock := c.clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	q := &ratingQueue{
+		dir:         c.Dir,
+		db:          db,
+		rv:          &ratingValidator{RatingDB: &ratingGorm{db: db}, campaigns: &campaignGorm{db: db}, quota: c.quota, rules: c.rules, clock: clock, verifier: c.verifier},
+		onError:     c.OnError,
+		onPersisted: c.OnPersisted,
+		probation:   c.probation,
+		outbox:      c.outbox,
+		minBackoff:  100 * time.Millisecond,
+		maxBackoff:  10 * time.Second,
+		parts:       make([]*queuePartition, workers),
+		seq:         time.Now().UnixNano(),
+		queued:      make(map[int64]int),
+		closing:     make(chan struct{}),
+	}
+	q.persist = q.persistGorm
+
+	for i := range q.parts {
+		q.parts[i] = &queuePartition{wake: make(chan struct{}, 1)}
+	}
+
+	err := os.MkdirAll(q.dir, 0700)
+	if err != nil {
+		return nil, wrap("could not create queue directory", err)
+	}
+
+	err = q.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// validator returns the validator of the ratings of u, whose campaigns are
+// restricted to the organisation of u, if any, as for the ratings created
+// directly.
+func (q *ratingQueue) validator(u *User) *ratingValidator {
+	if u == nil || u.OrgID == nil {
+		return q.rv
+	}
+
+	rv := *q.rv
+	rv.campaigns = &campaignOrganisation{CampaignService: q.rv.campaigns, org: *u.OrgID}
+	return &rv
+}
+
+func (q *ratingQueue) Enqueue(r *Rating) (string, error) {
+	// the role of the session user is checked without reading it again
+	rc := ratingValWithDBData{rv: q.validator(r.User)}
+	if r.User != nil {
+		rc.sessionUser = *r.User
+	}
+
+	err := q.rv.runValFuncs(r,
+		q.rv.idSetToZero,
+		q.rv.userSessionExists,
+		q.rv.userSessionInvalid,
+		q.rv.targetRequired,
+		q.rv.scoreRequired,
+		q.rv.commentLength,
+		q.rv.extraLength,
+		q.rv.targetInvalid,
+		q.quotaNotExceeded,
+		rc.fetchWindow,
+		rc.windowOpen,
+		rc.fetchCampaign,
+		rc.campaignOpen,
+		rc.campaignEligible,
+		rc.campaignIncludesTarget,
+		rc.fetchCategory,
+		rc.categoryScoreRange,
+		rc.categoryCommentRequired,
+		q.rv.setDate,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	// the rules see the user as the ratings created directly, and the
+	// rating belongs to the organisation of its author
+	r.UserID = r.User.ID
+	r.OrgID = r.User.OrgID
+	err = q.rv.runValFuncs(r, append([]func() (string, ratingValFn){rc.setVerified}, q.rv.rules.ratingRules()...)...)
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case <-q.closing:
+		return "", wrap("queue is closed", nil)
+	default:
+	}
+
+	r.User = nil
+
+	var k [16]byte
+	_, err = rand.Read(k[:])
+	if err != nil {
+		return "", wrap("could not generate queue key", err)
+	}
+
+	qr := queuedRating{Key: hex.EncodeToString(k[:]), Rating: *r}
+	name := fmt.Sprintf("%020d-%s.json", atomic.AddInt64(&q.seq, 1), qr.Key)
+
+	err = q.write(name, &qr)
+	if err != nil {
+		return "", err
+	}
+
+	q.countQueued(qr.Rating.UserID, 1)
+	q.push(q.partition(&qr.Rating), name)
+	return qr.Key, nil
+}
+
+// quotaNotExceeded makes sure the session user did not create the maximum
+// number of ratings allowed by the quota recently, counting the ratings of
+// the user in the queue. It may return ErrRateLimited.
+func (q *ratingQueue) quotaNotExceeded() (string, ratingValFn) {
+	return "userId", func(r *Rating) error {
+		if q.rv.quota == nil {
+			return nil
+		}
+
+		q.queuedMu.Lock()
+		pending := q.queued[r.User.ID]
+		q.queuedMu.Unlock()
+
+		return q.rv.quota.checkPending(q.db, r.User.ID, pending)
+	}
+}
+
+// countQueued adds n to the number of ratings of the user with ID userID in
+// the queue.
+func (q *ratingQueue) countQueued(userID int64, n int) {
+	q.queuedMu.Lock()
+	defer q.queuedMu.Unlock()
+
+	q.queued[userID] += n
+	if q.queued[userID] <= 0 {
+		delete(q.queued, userID)
+	}
+}
+
+func (q *ratingQueue) Receipt(key string) (QueueReceipt, error) {
+	if _, err := hex.DecodeString(key); err != nil || len(key) != 32 {
+		return QueueReceipt{}, ErrNotFound
+	}
+
+	var rc QueueReceipt
+	err := q.db.Where("key = ?", key).First(&rc).Error
+	if err == nil {
+		return rc, nil
+	}
+	if !xerrors.Is(err, gorm.ErrRecordNotFound) {
+		return QueueReceipt{}, wrap("could not get queue receipt", err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(q.dir, "*-"+key+".json"))
+	if err != nil {
+		return QueueReceipt{}, wrap("could not look up queued rating", err)
+	}
+	if len(names) == 0 {
+		return QueueReceipt{}, ErrNotFound
+	}
+
+	qr, err := q.read(filepath.Base(names[0]))
+	if err != nil {
+		if _, serr := os.Stat(names[0]); os.IsNotExist(serr) {
+			// persisted in the meantime
+			return q.Receipt(key)
+		}
+
+		return QueueReceipt{}, err
+	}
+
+	return QueueReceipt{Key: key, UserID: qr.Rating.UserID, Status: QueuePending}, nil
+}
+
+func (q *ratingQueue) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.closing)
+	})
+	q.workers.Wait()
+
+	return nil
+}
+
+// start launches one worker per partition.
+func (q *ratingQueue) start() {
+	for _, p := range q.parts {
+		q.workers.Add(1)
+		go q.work(p)
+	}
+}
+
+// load queues again the ratings stored in the queue directory, in the order
+// they were first enqueued. Files left half written are removed, as they were
+// never acknowledged.
+func (q *ratingQueue) load() error {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return wrap("could not read queue directory", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		switch {
+		case strings.HasPrefix(f.Name(), ".tmp-"):
+			err = os.Remove(filepath.Join(q.dir, f.Name()))
+			if err != nil {
+				return wrap("could not remove incomplete queue file", err)
+			}
+		case strings.HasSuffix(f.Name(), ".json"):
+			names = append(names, f.Name())
+		}
+	}
+
+	// names start with a zero padded sequence number
+	sort.Strings(names)
+
+	for _, name := range names {
+		qr, err := q.read(name)
+		if err != nil {
+			return err
+		}
+
+		seq, err := strconv.ParseInt(strings.SplitN(name, "-", 2)[0], 10, 64)
+		if err == nil && seq > q.seq {
+			q.seq = seq
+		}
+
+		q.countQueued(qr.Rating.UserID, 1)
+		q.push(q.partition(&qr.Rating), name)
+	}
+
+	return nil
+}
+
+// partition returns the partition in charge of r. All the ratings of the same
+// user and target are assigned to the same partition, so they are persisted in
+// order.
+func (q *ratingQueue) partition(r *Rating) *queuePartition {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%d", r.UserID, r.Target)
+
+	return q.parts[h.Sum32()%uint32(len(q.parts))]
+}
+
+// push adds the queue file name to p and wakes up its worker.
+func (q *ratingQueue) push(p *queuePartition, name string) {
+	p.mu.Lock()
+	p.pending = append(p.pending, name)
+	p.mu.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work persists the ratings of p one at a time until the queue is closed. A
+// rating is retried, with an increasing delay, until it is persisted; the
+// following ratings of p wait for it to preserve their order.
+func (q *ratingQueue) work(p *queuePartition) {
+	defer q.workers.Done()
+
+	backoff := q.minBackoff
+	for {
+		select {
+		case <-q.closing:
+			return
+		default:
+		}
+
+		p.mu.Lock()
+		if len(p.pending) == 0 {
+			p.mu.Unlock()
+
+			select {
+			case <-p.wake:
+			case <-q.closing:
+				return
+			}
+			continue
+		}
+		name := p.pending[0]
+		p.mu.Unlock()
+
+		err := q.process(name)
+		if err != nil {
+			if q.onError != nil {
+				q.onError(err)
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-q.closing:
+				return
+			}
+
+			if backoff *= 2; backoff > q.maxBackoff {
+				backoff = q.maxBackoff
+			}
+			continue
+		}
+		backoff = q.minBackoff
+
+		p.mu.Lock()
+		p.pending = p.pending[1:]
+		p.mu.Unlock()
+	}
+}
+
+// process persists the rating in the queue file name and removes the file.
+func (q *ratingQueue) process(name string) error {
+	qr, err := q.read(name)
+	if err != nil {
+		return err
+	}
+
+	err = q.persist(qr)
+	if err != nil {
+		return wrap("could not persist queued rating "+qr.Key, err)
+	}
+
+	if q.onPersisted != nil {
+		q.onPersisted(qr.Rating)
+	}
+
+	err = os.Remove(filepath.Join(q.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return wrap("could not remove queue file", err)
+	}
+
+	q.countQueued(qr.Rating.UserID, -1)
+	return nil
+}
+
+// persistGorm creates the rating in qr along with its QueueReceipt in the same
+// transaction. The rating is not created again if the receipt already exists.
+// When the rating is rejected by the database or the quota, a receipt with the
+// failure is stored instead and no error is returned, as retrying would not
+// help.
+func (q *ratingQueue) persistGorm(qr *queuedRating) error {
+	// warning: non standard SQL used for upserts
+	const insertReceipt = `INSERT INTO queue_receipts (key, user_id, status, error, fields)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT (key) DO NOTHING`
+
+	err := gormTransaction(q.db, func(tx *gorm.DB) error {
+		res := tx.Exec(insertReceipt, qr.Key, qr.Rating.UserID, QueuePending, "", nil)
+		if res.Error != nil {
+			return wrap("could not create queue receipt", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			// already processed before
+			return nil
+		}
+
+		// the ratings of the user accepted by other queues since it was
+		// enqueued may have used up the quota
+		if q.rv.quota != nil {
+			err := q.rv.quota.checkPending(tx, qr.Rating.UserID, 0)
+			if err != nil {
+				return err
+			}
+		}
+
+		r := qr.Rating
+		err := (&ratingGorm{db: tx, probation: q.probation, outbox: q.outbox, clock: q.rv.clock}).Create(&r)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&QueueReceipt{}).Where("key = ?", qr.Key).
+			Updates(map[string]interface{}{"status": QueueCreated, "rating_id": r.ID}).
+			Error
+		if err != nil {
+			return wrap("could not update queue receipt", err)
+		}
+
+		return nil
+	})
+
+	var pe PublicError
+	if err == nil || !xerrors.As(err, &pe) {
+		return err
+	}
+
+	var fields interface{}
+	if ve, ok := pe.(ValidationError); ok {
+		codes := make(map[string]string, len(ve))
+		for f, e := range ve {
+			codes[f] = e.Public()
+		}
+
+		b, _ := json.Marshal(codes)
+		fields = string(b)
+	}
+
+	err = q.db.Exec(insertReceipt, qr.Key, qr.Rating.UserID, QueueFailed, pe.Public(), fields).Error
+	if err != nil {
+		return wrap("could not create failed queue receipt", err)
+	}
+
+	return nil
+}
+
+// write stores qr in the queue file name. The file is written under a
+// temporary name and renamed once synced, so only complete files are found
+// with their final name.
+func (q *ratingQueue) write(name string, qr *queuedRating) error {
+	b, err := json.Marshal(qr)
+	if err != nil {
+		return wrap("could not encode queued rating", err)
+	}
+
+	tmp := filepath.Join(q.dir, ".tmp-"+name)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return wrap("could not create queue file", err)
+	}
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return wrap("could not write queue file", err)
+	}
+
+	err = os.Rename(tmp, filepath.Join(q.dir, name))
+	if err != nil {
+		os.Remove(tmp)
+		return wrap("could not rename queue file", err)
+	}
+
+	// make the rename durable
+	d, err := os.Open(q.dir)
+	if err != nil {
+		return wrap("could not open queue directory", err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil {
+		return wrap("could not sync queue directory", err)
+	}
+
+	return nil
+}
+
+// read loads the queued rating in the queue file name.
+func (q *ratingQueue) read(name string) (*queuedRating, error) {
+	b, err := ioutil.ReadFile(filepath.Join(q.dir, name))
+	if err != nil {
+		return nil, wrap("could not read queue file "+name, err)
+	}
+
+	var qr queuedRating
+	err = json.Unmarshal(b, &qr)
+	if err != nil {
+		return nil, wrap("could not decode queue file "+name, err)
+	}
+
+	return &qr, nil
+}
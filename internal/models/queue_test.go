@@ -0,0 +1,423 @@
+package models
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// setupQueue creates a ratingQueue that is not started on a temporary
+// directory, with persist recording the persisted keys.
+func setupQueue(t *testing.T, dir string) (*ratingQueue, func() []string) {
+	if dir == "" {
+		var err error
+		dir, err = ioutil.TempDir("", "ratingsapp-queue")
+		require.NoError(t, err)
+	}
+
+	q, err := newRatingQueue(nil, &QueueConfig{Dir: dir, Workers: 3})
+	require.NoError(t, err)
+	q.rv.RatingDB = &testRatingDB{}
+	q.minBackoff = time.Millisecond
+	q.maxBackoff = time.Millisecond
+
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	q.persist = func(qr *queuedRating) error {
+		mu.Lock()
+		keys = append(keys, qr.Key)
+		mu.Unlock()
+		return nil
+	}
+
+	return q, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), keys...)
+	}
+}
+
+// waitDrained waits until all the partitions of q have no pending ratings.
+func waitDrained(t *testing.T, q *ratingQueue) {
+	for i := 0; i < 500; i++ {
+		var pending int
+		for _, p := range q.parts {
+			p.mu.Lock()
+			pending += len(p.pending)
+			p.mu.Unlock()
+		}
+
+		if pending == 0 {
+			return
+		}
+
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	t.Fatal("queue was not drained")
+}
+
+func queueFiles(t *testing.T, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+
+	return names
+}
+
+func TestRatingQueue_Enqueue(t *testing.T) {
+	var cases = []struct {
+		name   string
+		rating Rating
+		outerr error
+	}{
+		{"sessionRequired", Rating{Score: 2, Target: 9}, ErrRequired},
+		{"sessionInvalid", Rating{Score: 2, Target: 9, User: &User{}}, ErrInvalid},
+		{"targetRequired", Rating{Score: 2, User: &User{ID: 5}}, ValidationError{"target": ErrRequired}},
+		{"targetInvalid", Rating{Score: 2, Target: -9, User: &User{ID: 5}}, ValidationError{"target": ErrInvalid}},
+		{"scoreRequired", Rating{Target: 9, User: &User{ID: 5}}, ValidationError{"score": ErrRequired}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			q, _ := setupQueue(t, "")
+			defer os.RemoveAll(q.dir)
+
+			_, err := q.Enqueue(&cs.rating)
+			assert.True(t, xerrors.Is(err, cs.outerr),
+				"errors must match, expected %v, got %v", cs.outerr, err)
+			assert.Empty(t, queueFiles(t, q.dir))
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		q, _ := setupQueue(t, "")
+		defer os.RemoveAll(q.dir)
+
+		r := NewRating()
+		r.ID = 77
+		r.Score = 3
+		r.Target = 9
+		r.User = &User{ID: 5}
+
+		key, err := q.Enqueue(&r)
+		require.NoError(t, err)
+		assert.Len(t, key, 32)
+
+		files := queueFiles(t, q.dir)
+		require.Len(t, files, 1)
+		assert.Contains(t, files[0], key)
+
+		b, err := ioutil.ReadFile(files[0])
+		require.NoError(t, err)
+
+		var qr queuedRating
+		require.NoError(t, json.Unmarshal(b, &qr))
+		assert.Equal(t, key, qr.Key)
+		assert.Equal(t, int64(0), qr.Rating.ID)
+		assert.Equal(t, int64(5), qr.Rating.UserID)
+		assert.NotZero(t, qr.Rating.Date)
+		assert.Nil(t, r.User)
+	})
+
+	t.Run("organisation", func(t *testing.T) {
+		q, _ := setupQueue(t, "")
+		defer os.RemoveAll(q.dir)
+
+		acme, globex := int64(4), int64(5)
+		for _, org := range []*int64{&globex, nil} {
+			r := Rating{Score: 3, Target: 9, OrgID: org, User: &User{ID: 5, OrgID: &acme}}
+			_, err := q.Enqueue(&r)
+			require.NoError(t, err)
+			assert.Equal(t, &acme, r.OrgID, "the rating must belong to the organisation of the author")
+		}
+
+		r := Rating{Score: 3, Target: 9, OrgID: &globex, User: &User{ID: 5}}
+		_, err := q.Enqueue(&r)
+		require.NoError(t, err)
+		assert.Nil(t, r.OrgID, "the ratings of the users of no organisation must belong to none")
+
+		orgs := map[int64]int{}
+		for _, name := range queueFiles(t, q.dir) {
+			b, err := ioutil.ReadFile(name)
+			require.NoError(t, err)
+
+			var qr queuedRating
+			require.NoError(t, json.Unmarshal(b, &qr))
+			if qr.Rating.OrgID == nil {
+				orgs[0]++
+			} else {
+				orgs[*qr.Rating.OrgID]++
+			}
+		}
+		assert.Equal(t, map[int64]int{acme: 2, 0: 1}, orgs, "the spilled ratings must keep their organisation")
+	})
+
+	t.Run("organisationCampaigns", func(t *testing.T) {
+		q, _ := setupQueue(t, "")
+		defer os.RemoveAll(q.dir)
+
+		acme, globex := int64(4), int64(5)
+		q.rv.campaigns = &testOrganisationCampaignService{campaigns: map[int64]Campaign{
+			1: {ID: 1, Name: "shared"},
+			5: {ID: 5, Name: "globex", OrgID: &globex},
+		}}
+
+		for _, id := range []int64{1, 5} {
+			id := id
+			_, err := q.Enqueue(&Rating{Score: 3, Target: 9, CampaignID: &id, User: &User{ID: 5, OrgID: &acme}})
+			assert.Equal(t, ValidationError{"campaignId": ErrRefNotFound}, err,
+				"the campaigns of other organisations must not be found")
+		}
+		assert.Empty(t, queueFiles(t, q.dir))
+	})
+
+	t.Run("categoryRules", func(t *testing.T) {
+		q, _ := setupQueue(t, "")
+		defer os.RemoveAll(q.dir)
+
+		five := 5
+		q.rv.RatingDB = &testRatingDB{category: func(int64) (TargetCategory, error) {
+			return TargetCategory{Name: "restaurants", MaxScore: &five, CommentRequired: true}, nil
+		}}
+
+		_, err := q.Enqueue(&Rating{Score: 7, Target: 9, User: &User{ID: 5}})
+		assert.Equal(t, ValidationError{"score": ErrInvalid, "comment": ErrRequired}, err)
+		assert.Empty(t, queueFiles(t, q.dir))
+	})
+
+	t.Run("verified", func(t *testing.T) {
+		q, _ := setupQueue(t, "")
+		defer os.RemoveAll(q.dir)
+
+		q.rv.verifier = TransactionVerifierFunc(func(userID, target int64) (bool, error) {
+			return userID == 5 && target == 9, nil
+		})
+
+		r := Rating{Score: 3, Target: 9, User: &User{ID: 5}}
+		_, err := q.Enqueue(&r)
+		require.NoError(t, err)
+		assert.True(t, r.Verified)
+
+		r = Rating{Score: 3, Target: 10, Verified: true, User: &User{ID: 5}}
+		_, err = q.Enqueue(&r)
+		require.NoError(t, err)
+		assert.False(t, r.Verified, "the input value must be ignored")
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		q, _ := setupQueue(t, "")
+		defer os.RemoveAll(q.dir)
+		require.NoError(t, q.Close())
+
+		_, err := q.Enqueue(&Rating{Score: 3, Target: 9, User: &User{ID: 5}})
+		assert.Error(t, err)
+	})
+}
+
+func TestRatingQueue_Order(t *testing.T) {
+	q, persisted := setupQueue(t, "")
+	defer os.RemoveAll(q.dir)
+
+	var keys = map[int64][]string{}
+	for i := 0; i < 30; i++ {
+		target := int64(i%4 + 1)
+		key, err := q.Enqueue(&Rating{Score: i + 1, Target: target, User: &User{ID: 5}})
+		require.NoError(t, err)
+
+		keys[target] = append(keys[target], key)
+	}
+
+	q.start()
+	defer q.Close()
+	waitDrained(t, q)
+
+	// the ratings of each user and target must keep their order
+	var got = map[string]int{}
+	for i, k := range persisted() {
+		got[k] = i
+	}
+	assert.Len(t, got, 30)
+
+	for _, ks := range keys {
+		for i := 1; i < len(ks); i++ {
+			assert.True(t, got[ks[i-1]] < got[ks[i]], "ratings of the same target must be persisted in order")
+		}
+	}
+
+	assert.Empty(t, queueFiles(t, q.dir))
+}
+
+func TestRatingQueue_Resume(t *testing.T) {
+	q, _ := setupQueue(t, "")
+	defer os.RemoveAll(q.dir)
+
+	var keys []string
+	for i := 0; i < 5; i++ {
+		key, err := q.Enqueue(&Rating{Score: i + 1, Target: 9, User: &User{ID: 5}})
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+
+	// a file that was never completely written must be ignored
+	err := ioutil.WriteFile(filepath.Join(q.dir, ".tmp-00000000000000000001-broken.json"), []byte(`{"ke`), 0600)
+	require.NoError(t, err)
+
+	// the first queue is never started, as if the process had stopped
+	q2, persisted := setupQueue(t, q.dir)
+	q2.start()
+	defer q2.Close()
+	waitDrained(t, q2)
+
+	assert.Equal(t, keys, persisted())
+	assert.Empty(t, queueFiles(t, q.dir))
+}
+
+func TestRatingQueue_Retry(t *testing.T) {
+	q, _ := setupQueue(t, "")
+	defer os.RemoveAll(q.dir)
+
+	var (
+		mu       sync.Mutex
+		attempts int
+		errs     []error
+	)
+	q.persist = func(qr *queuedRating) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts < 3 {
+			return privateError("database is down")
+		}
+		return nil
+	}
+	q.onError = func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	_, err := q.Enqueue(&Rating{Score: 3, Target: 9, User: &User{ID: 5}})
+	require.NoError(t, err)
+
+	q.start()
+	defer q.Close()
+	waitDrained(t, q)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, errs, 2)
+	assert.Empty(t, queueFiles(t, q.dir))
+}
+
+func TestRatingQueue_Receipt(t *testing.T) {
+	t.Run("invalidKey", func(t *testing.T) {
+		q, _ := setupQueue(t, "")
+		defer os.RemoveAll(q.dir)
+
+		_, err := q.Receipt("../../etc/passwd")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	db := setupGorm(t)
+
+	q, _ := setupQueue(t, "")
+	defer os.RemoveAll(q.dir)
+	q.db = db
+	q.persist = q.persistGorm
+
+	key, err := q.Enqueue(&Rating{Score: 3, Target: 9, Extra: json.RawMessage(`{}`), User: &User{ID: 1}})
+	require.NoError(t, err)
+	dupKey, err := q.Enqueue(&Rating{Score: 4, Target: 9, Extra: json.RawMessage(`{}`), User: &User{ID: 1}})
+	require.NoError(t, err)
+
+	rc, err := q.Receipt(key)
+	require.NoError(t, err)
+	assert.Equal(t, QueueReceipt{Key: key, UserID: 1, Status: QueuePending}, rc)
+
+	q.start()
+	defer q.Close()
+	waitDrained(t, q)
+
+	rc, err = q.Receipt(key)
+	require.NoError(t, err)
+	assert.Equal(t, QueueCreated, rc.Status)
+	assert.NotZero(t, rc.RatingID)
+
+	rc, err = q.Receipt(dupKey)
+	require.NoError(t, err)
+	assert.Equal(t, QueueFailed, rc.Status)
+	assert.Equal(t, "validation_error", rc.Error)
+	assert.JSONEq(t, `{"target":"is_duplicate"}`, string(rc.Fields))
+
+	_, err = q.Receipt("0123456789abcdef0123456789abcdef")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestRatingQueue_persistGorm(t *testing.T) {
+	db := setupGorm(t)
+
+	q, _ := setupQueue(t, "")
+	defer os.RemoveAll(q.dir)
+	q.db = db
+
+	qr := &queuedRating{
+		Key:    "0123456789abcdef0123456789abcdef",
+		Rating: Rating{Score: 3, Target: 9, Extra: json.RawMessage(`{}`), UserID: 1},
+	}
+
+	// persisting the same queued rating again must not create it twice
+	require.NoError(t, q.persistGorm(qr))
+	require.NoError(t, q.persistGorm(qr))
+
+	var count int
+	require.NoError(t, db.Model(&Rating{}).Where("target = ?", 9).Count(&count).Error)
+	assert.Equal(t, 1, count)
+
+	t.Run("quota", func(t *testing.T) {
+		q.rv.quota = newRatingQuota(db, RatingQuota{Max: 2, Window: time.Hour}, nil)
+		defer func() { q.rv.quota = nil }()
+
+		// the queued ratings are counted along with the stored one
+		_, err := q.Enqueue(&Rating{Score: 3, Target: 10, User: &User{ID: 1}})
+		require.NoError(t, err)
+		_, err = q.Enqueue(&Rating{Score: 3, Target: 11, User: &User{ID: 1}})
+		assert.True(t, xerrors.Is(err, ValidationError{"userId": ErrRateLimited}), "expected rate_limited, got %v", err)
+
+		// a rating accepted by another queue used up the quota
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 12, UserID: 1}).Error)
+
+		key := "00000000000000000000000000000001"
+		require.NoError(t, q.persistGorm(&queuedRating{
+			Key:    key,
+			Rating: Rating{Score: 3, Target: 10, Extra: json.RawMessage(`{}`), UserID: 1},
+		}))
+
+		rc, err := q.Receipt(key)
+		require.NoError(t, err)
+		assert.Equal(t, QueueFailed, rc.Status)
+		assert.Equal(t, "rate_limited", rc.Error)
+		assert.Zero(t, rc.RatingID)
+	})
+
+	t.Run("internalError", func(t *testing.T) {
+		dropRatingsTable(db)
+
+		err := q.persistGorm(&queuedRating{
+			Key:    "fedcba9876543210fedcba9876543210",
+			Rating: Rating{Score: 3, Target: 9, Extra: json.RawMessage(`{}`), UserID: 1},
+		})
+		assert.Error(t, err)
+	})
+}
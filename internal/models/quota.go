@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RatingQuota limits the ratings each user can create in a period of time, to
+// discourage bulk fake reviews.
+type RatingQuota struct {
+	// Max is the number of ratings a user can create per Window. Ratings
+	// are not limited if zero.
+	Max int
+
+	// Window is the period of time, up to now, the ratings created by a
+	// user are counted over.
+	Window time.Duration
+}
+
+// ParseRatingQuota parses a quota written as the maximum number of ratings and
+// the window, separated by a slash, like "20/24h" for 20 ratings a day.
+func ParseRatingQuota(s string) (RatingQuota, error) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return RatingQuota{}, wrap("invalid rating quota "+strconv.Quote(s)+", expected max/window", nil)
+	}
+
+	max, err := strconv.Atoi(s[:i])
+	if err != nil || max < 1 {
+		return RatingQuota{}, wrap("invalid rating quota maximum "+strconv.Quote(s[:i]), err)
+	}
+
+	window, err := time.ParseDuration(s[i+1:])
+	if err != nil || window <= 0 {
+		return RatingQuota{}, wrap("invalid rating quota window "+strconv.Quote(s[i+1:]), err)
+	}
+
+	return RatingQuota{Max: max, Window: window}, nil
+}
+
+// ratingQuota enforces a RatingQuota with the ratings stored in the database,
+// counting the ratings rejected.
+type ratingQuota struct {
+	RatingQuota
+	db    *gorm.DB
+	clock Clock
+
+	// rejected is the number of ratings rejected, updated atomically.
+	rejected uint64
+}
+
+// newRatingQuota returns a ratingQuota enforcing q, or nil if q does not limit
+// the ratings. The window ends at the time told by clock, the clock of the
+// system if nil.
+func newRatingQuota(db *gorm.DB, q RatingQuota, clock Clock) *ratingQuota {
+	if q.Max == 0 {
+		return nil
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	return &ratingQuota{RatingQuota: q, db: db, clock: clock}
+}
+
+// check returns ErrRateLimited if the user with ID userID created the maximum
+// number of ratings in the window already. Deleted ratings are not counted.
+func (rq *ratingQuota) check(userID int64) error {
+	return rq.checkPending(rq.db, userID, 0)
+}
+
+// checkPending is check counting, along with the ratings stored in db, the
+// pending ratings of the user that are not stored yet, like the queued ones.
+func (rq *ratingQuota) checkPending(db *gorm.DB, userID int64, pending int) error {
+	var ct int
+	err := db.Model(&Rating{}).
+		Where("user_id = ? AND created_at > ?", userID, rq.clock.Now().Add(-rq.Window)).
+		Count(&ct).
+		Error
+	if err != nil {
+		return with(wrap("could not count the recent ratings of the user", err), "user_id", userID)
+	}
+
+	if ct+pending >= rq.Max {
+		atomic.AddUint64(&rq.rejected, 1)
+		return ErrRateLimited
+	}
+
+	return nil
+}
+
+// rejections returns the number of ratings rejected because of the quota since
+// the services started.
+func (rq *ratingQuota) rejections() uint64 {
+	if rq == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&rq.rejected)
+}
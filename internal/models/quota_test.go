@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRatingQuota(t *testing.T) {
+	q, err := ParseRatingQuota("20/24h")
+	require.NoError(t, err)
+	assert.Equal(t, RatingQuota{Max: 20, Window: 24 * time.Hour}, q)
+
+	for _, s := range []string{"", "20", "0/1h", "x/1h", "20/-1h", "20/abc", "20/"} {
+		_, err := ParseRatingQuota(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRatingValidator_QuotaNotExceeded(t *testing.T) {
+	// without a quota the ratings are never limited
+	rc := &ratingValWithDBData{rv: &ratingValidator{}, sessionUser: User{ID: 1}}
+	field, fn := rc.quotaNotExceeded()
+	assert.Equal(t, "userId", field)
+	assert.NoError(t, fn(&Rating{}))
+
+	assert.Zero(t, (*ratingQuota)(nil).rejections())
+	assert.Nil(t, newRatingQuota(nil, RatingQuota{}, nil))
+}
+
+func TestRatingQuota(t *testing.T) {
+	db := setupGorm(t)
+	rq := newRatingQuota(db, RatingQuota{Max: 2, Window: time.Hour}, nil)
+
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 1, UserID: 1}).Error)
+	assert.NoError(t, rq.check(1))
+
+	// ratings created before the window are not counted
+	old := &Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 2, UserID: 1}
+	require.NoError(t, db.Create(old).Error)
+	require.NoError(t, db.Exec("UPDATE ratings SET created_at = now() - interval '2 hours' WHERE id = ?", old.ID).Error)
+	assert.NoError(t, rq.check(1))
+
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 3, UserID: 1}).Error)
+	assert.Equal(t, ErrRateLimited, rq.check(1))
+	assert.Equal(t, ErrRateLimited, rq.check(1))
+	assert.Equal(t, uint64(2), rq.rejections())
+
+	// other users have their own quota
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	assert.NoError(t, rq.check(98))
+}
@@ -2,15 +2,50 @@ package models
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/lib/pq"
+	"github.com/noelruault/ratingsapp/internal/events"
 	"golang.org/x/xerrors"
 )
 
+//go:generate go run github.com/matryer/moq -out modelstest/ratings.go -pkg modelstest . RatingService:RatingService
+
 // RatingService defines a set of methods to be used when dealing with ratings.
 type RatingService interface {
+	// UpdatePartial updates the rating with ID r.ID by applying patch, a
+	// JSON Merge Patch document (RFC 7396). Only the fields present in
+	// patch are validated and modified, the others keep their stored
+	// values. As with Update, only the owner and the moderators can
+	// update a rating and the date, target and userId fields are set by
+	// the service.
+	//
+	// r.Version is handled as in Update. On success, r is set to the
+	// updated rating.
+	UpdatePartial(r *Rating, patch []byte) error
+
+	// Scoped returns a RatingService that only reads the ratings visible
+	// to u, as defined by the visibility rules of u's role, and of the
+	// organisation of u, if any, see Organisation. Ratings that are not
+	// visible are not listed, and are not found when looked up by ID.
+	// Writes are not restricted.
+	//
+	// The service itself is returned if u's role is not restricted, and
+	// u is of no other organisation than the one the service reads.
+	Scoped(u *User) RatingService
+
+	// PublishDraft publishes the draft with ID r.ID, which only its
+	// author, the session user r.User, can publish, after applying patch
+	// to it, a JSON Merge Patch document (RFC 7396) which may be empty to
+	// complete it. The draft is validated and created as a rating by
+	// Create, and deleted along with the creation. ErrNotFound is
+	// returned if the draft does not exist or is not the session user's.
+	//
+	// On success, r is set to the rating created.
+	PublishDraft(r *Rating, patch []byte) error
+
 	RatingDB
 }
 
@@ -31,10 +66,17 @@ type RatingDB interface {
 	//
 	// Use NewRating() to use appropriate default values for the fields.
 	//
-	// The admin and user rating cannot be updated.
+	// If the Version field is not zero, ErrConflict is returned when the
+	// stored rating has a different version. On success, Version is set
+	// to the new version.
 	Update(*Rating) error
 
-	// Delete removes a rating by ID.
+	// Delete removes a rating by ID on behalf of the User set on it, as
+	// Update does: ErrReadOnly is returned unless they are its author or
+	// moderate the ratings.
+	//
+	// If the Version field is not zero, ErrConflict is returned when the
+	// stored rating has a different version.
 	Delete(*Rating) error
 
 	// ByID retrieves a rating by ID.
@@ -42,6 +84,126 @@ type RatingDB interface {
 
 	// ByTarget retrieves a list of ratings by their common target ID.
 	ByTarget(int64) ([]Rating, error)
+
+	// Search retrieves the ratings of a target matching all the criteria
+	// in q. The Target field is required.
+	//
+	// A ValidationError is returned if any of the criteria is invalid.
+	Search(q RatingQuery) ([]Rating, error)
+
+	// StatsByTarget summarises the active ratings of a target. A target
+	// without any active ratings results in zero values. The ratings of
+	// new accounts may be held back, see Config.NewAccountPeriod.
+	//
+	// A ValidationError is returned if the target is not valid.
+	StatsByTarget(target int64) (RatingStats, error)
+
+	// DetailedStatsByTarget summarises the active ratings of a target
+	// matching f, as StatsByTarget, along with the percentiles and the
+	// histogram of their scores. The target fields are not computed.
+	//
+	// A ValidationError is returned if the target or f is not valid.
+	DetailedStatsByTarget(target int64, f StatsFilter) (RatingStats, error)
+
+	// Scores retrieves the number of active ratings of several targets and
+	// their average score, in the order of the target IDs, which are
+	// deduplicated. The ratings held back are not counted, as in
+	// StatsByTarget. They are read from the denormalised scores of the
+	// targets, updated along with the ratings, unless the ratings are
+	// restricted by visibility rules.
+	//
+	// A ValidationError is returned if there are no targets, more than
+	// 100, or any is not valid.
+	Scores(targets []int64) ([]TargetScore, error)
+
+	// Cohorts summarises the active ratings by cohort of their authors,
+	// oldest first. by is one of the keys of CohortGroupings, like
+	// "signupMonth". The ratings of new accounts may be held back, as in
+	// StatsByTarget.
+	//
+	// A ValidationError is returned if by is not valid.
+	Cohorts(by string) ([]RatingCohort, error)
+
+	// StatsByCampaign summarises the active ratings submitted to a
+	// campaign, overall and by target. A campaign without any active
+	// ratings results in zero values. The ratings of new accounts may be
+	// held back, as in StatsByTarget.
+	StatsByCampaign(campaignID int64) (CampaignStats, error)
+
+	// History retrieves the previous versions of a rating by its ID, oldest
+	// first. A revision is recorded every time a rating is updated, holding
+	// the values the rating had before the update.
+	History(int64) ([]RatingRevision, error)
+
+	// Tags retrieves the tags of a target, sorted alphabetically.
+	//
+	// A ValidationError is returned if the target is not valid.
+	Tags(target int64) ([]string, error)
+
+	// SetTags replaces the tags of a target. Tags are trimmed and
+	// lowercased, and duplicates are removed.
+	//
+	// A ValidationError is returned if the target or any tag is not valid.
+	SetTags(target int64, tags []string) error
+
+	// Category retrieves the category of a target, see
+	// TargetCategoryService. ErrNotFound is returned if the target has no
+	// category.
+	//
+	// A ValidationError is returned if the target is not valid.
+	Category(target int64) (TargetCategory, error)
+
+	// SetCategory puts a target in the category with the given name, or
+	// takes it out of its category if name is empty. The ratings already
+	// stored are not checked against the rules of the category.
+	//
+	// A ValidationError is returned if the target is not valid, or for
+	// the "category" field if the category does not exist.
+	SetCategory(target int64, name string) error
+
+	// Window retrieves the rating window of a target, see TargetWindow.
+	// The ratings of a target are only created and updated while its
+	// window is open, or ErrRatingClosed is returned for the "target"
+	// field. A target without a window has no bounds.
+	//
+	// A ValidationError is returned if the target is not valid.
+	Window(target int64) (TargetWindow, error)
+
+	// SetWindow sets the rating window of the target w.Target. Both
+	// bounds may be nil to open the target for good.
+	//
+	// A ValidationError is returned if the target is not valid, or if
+	// w.ClosesAt is not after w.OpensAt.
+	SetWindow(w *TargetWindow) error
+
+	// CreateDraft saves r as a draft of the session user r.User, see
+	// Rating.Draft. Its target and score may be left empty, but they are
+	// validated otherwise as in Create. On success, r.ID is set to the ID
+	// of the draft, which is not the ID of any rating.
+	CreateDraft(r *Rating) error
+
+	// Drafts retrieves the drafts of the user with ID userID, most
+	// recent first.
+	Drafts(userID int64) ([]Rating, error)
+
+	// DraftByID retrieves a draft by its ID.
+	DraftByID(id int64) (Rating, error)
+
+	// DeleteDraft deletes the draft with ID r.ID, which only its author,
+	// the session user r.User, can delete. ErrNotFound is returned if the
+	// draft does not exist or is not the session user's.
+	DeleteDraft(r *Rating) error
+
+	// Publish creates r, as Create does, and deletes the draft with ID
+	// draftID in the same transaction. ErrNotFound is returned if the
+	// draft does not exist, or is not of r.UserID.
+	Publish(r *Rating, draftID int64) error
+
+	// Authors tells who wrote the ratings with the given IDs, and whether
+	// they are shown as deleted users, see RatingAuthor. The ratings not
+	// found are left out. The authors are read along with the ratings,
+	// and those that no longer exist are reported as deleted.
+	Authors(ids ...int64) ([]RatingAuthor, error)
 }
 
 // A Rating represents a valoration in the system from a user to an object.
@@ -76,6 +238,214 @@ type Rating struct {
 
 	// User contains the data that belongs to the user making the request.
 	User *User `gorm:"-" json:"-"`
+
+	// CampaignID is the ID of the campaign the rating was submitted to,
+	// if any. It cannot be changed once the rating is created.
+	CampaignID *int64 `gorm:"type:bigint" json:"campaignId,omitempty"`
+
+	// OrgID is the ID of the organisation of the author of the rating, if
+	// any, see Organisation. It is set when the rating is created, and any
+	// input value will be ignored.
+	OrgID *int64 `gorm:"type:bigint" json:"orgId,omitempty"`
+
+	// Verified tells the user completed a transaction with the target, see
+	// TransactionVerifier. It is set when the rating is created or
+	// updated, and any input value will be ignored.
+	Verified bool `gorm:"not null;default:false" json:"verified,omitempty"`
+
+	// Draft tells the rating is an incomplete rating saved by its author
+	// to be published later, see RatingService.CreateDraft. The drafts
+	// are kept apart from the ratings, so they are never listed with
+	// them nor counted in the stats.
+	Draft bool `gorm:"-" json:"draft,omitempty"`
+
+	// Version is increased every time the rating is updated. When set on
+	// an update, the update only succeeds if it matches the stored version.
+	Version int64 `gorm:"type:bigint;not null;default:1" json:"-"`
+
+	// CreatedAt and UpdatedAt are the times the rating was created and
+	// last updated, and are only nil until it is stored. Any input value
+	// will be ignored.
+	CreatedAt *time.Time `gorm:"type:timestamptz;not null" json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `gorm:"type:timestamptz;not null" json:"updatedAt,omitempty"`
+
+	// Attachments are the files attached to the rating. They are not
+	// loaded by the RatingService, see AttachmentService.ByRatings.
+	Attachments []Attachment `gorm:"-" json:"attachments,omitempty"`
+}
+
+// RatingQuery defines the criteria used to look up the ratings of a target in
+// RatingDB.Search. Nil and zero-valued fields are not used for filtering.
+type RatingQuery struct {
+	// Target is the ID of the rated entity.
+	Target int64
+
+	// MinScore and MaxScore filter ratings by their score, both bounds
+	// included.
+	MinScore *int
+	MaxScore *int
+
+	// From and To filter ratings by their date, as an epoch, both bounds
+	// included.
+	From int64
+	To   int64
+
+	// Active and Anonymous filter ratings by their flags.
+	Active    *bool
+	Anonymous *bool
+
+	// Sort is the name of the field used to sort the results, which is
+	// either "date" or "score". The name can be prefixed with "-" to sort
+	// in descending order. Results are sorted by ID if it is left empty.
+	Sort string
+
+	// Limit is the maximum number of results, or zero for no limit.
+	Limit int
+
+	// After only returns the ratings with a higher ID, like the ID of the
+	// last rating of the previous page. It requires the results sorted by
+	// ID, and is ignored if zero.
+	After int64
+}
+
+// RatingStats summarises the active ratings of a target.
+type RatingStats struct {
+	Target int64 `json:"target"`
+
+	// Count is the number of active ratings.
+	Count int64 `json:"count"`
+
+	// Average, Min and Max are computed from the scores of the active
+	// ratings.
+	Average float64 `json:"average"`
+	Min     int     `json:"min"`
+	Max     int     `json:"max"`
+
+	// WeightedAverage weights each score with the reputation of its
+	// author, see Reputation.Weight.
+	WeightedAverage float64 `json:"weightedAverage"`
+
+	// VerifiedWeightedAverage weights the scores of the verified ratings
+	// with Config.VerifiedWeight, and the others with 1.
+	VerifiedWeightedAverage float64 `json:"verifiedWeightedAverage"`
+
+	// Computed holds the values of the target fields by name, see
+	// TargetFieldService. It is only set by StatsByTarget.
+	Computed map[string]interface{} `gorm:"-" json:"computed,omitempty"`
+
+	// Percentiles and Histogram describe the distribution of the scores.
+	// They are only set by DetailedStatsByTarget, and there is no
+	// histogram without ratings.
+	Percentiles *ScorePercentiles `gorm:"-" json:"percentiles,omitempty"`
+	Histogram   []HistogramBucket `gorm:"-" json:"histogram,omitempty"`
+}
+
+// ScorePercentiles are the quartiles of the scores of the ratings, interpolated
+// between the closest scores.
+type ScorePercentiles struct {
+	P25 float64 `json:"p25"`
+	P50 float64 `json:"p50"`
+	P75 float64 `json:"p75"`
+}
+
+// A HistogramBucket counts the ratings with a score from Min to Max, both
+// included.
+type HistogramBucket struct {
+	Min   int   `json:"min"`
+	Max   int   `json:"max"`
+	Count int64 `json:"count"`
+}
+
+// A RatingCohort summarises the ratings of the users who signed up in the same
+// period, see RatingDB.Cohorts.
+type RatingCohort struct {
+	// Cohort is the start of the period the users signed up in, in UTC.
+	// Users created before their signup date was recorded are in the
+	// cohort of the Unix epoch.
+	Cohort time.Time `json:"cohort"`
+
+	// Users is the number of users of the cohort who rated any target,
+	// and Count the number of their active ratings.
+	Users int64 `json:"users"`
+	Count int64 `json:"count"`
+
+	// Average is computed from the scores of the active ratings.
+	Average float64 `json:"average"`
+}
+
+// CohortGroupings maps the groupings of RatingDB.Cohorts to the periods the
+// users are grouped by.
+var CohortGroupings = map[string]string{
+	"signupWeek":  "week",
+	"signupMonth": "month",
+	"signupYear":  "year",
+}
+
+// StatsFilter restricts the ratings summarised by
+// RatingDB.DetailedStatsByTarget. Zero-valued fields are not used for
+// filtering.
+type StatsFilter struct {
+	// Verified restricts the ratings to the ones approved by a moderator.
+	Verified bool
+
+	// From and To filter ratings by their date, as an epoch, both bounds
+	// included.
+	From int64
+	To   int64
+
+	// Buckets is the number of buckets of the histogram, of the same
+	// width, from the minimum to the maximum score. There may be less
+	// buckets when the scores are close. It is DefaultHistogramBuckets if
+	// zero, and can't be greater than MaxHistogramBuckets.
+	Buckets int
+}
+
+// Number of buckets of the histograms of the scores, see StatsFilter.Buckets.
+const (
+	DefaultHistogramBuckets = 5
+	MaxHistogramBuckets     = 20
+)
+
+// ratingSortColumns maps the rating fields accepted by RatingQuery.Sort to
+// their database columns.
+var ratingSortColumns = map[string]string{
+	"date":  "date",
+	"score": "score",
+}
+
+// A RatingRevision is an immutable snapshot of a rating as it was before one of
+// its updates.
+type RatingRevision struct {
+	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
+
+	// The ID of the rating this revision belongs to.
+	RatingID int64 `gorm:"index;type:bigint;not null" json:"ratingId"`
+
+	// The following fields hold the values of the rating before it was
+	// updated. See Rating for their meaning.
+	Active    bool            `gorm:"not null" json:"active"`
+	Anonymous bool            `gorm:"not null" json:"anonymous"`
+	Comment   string          `gorm:"type:text;not null" json:"comment,omitempty"`
+	Date      int64           `gorm:"type:bigint;not null" json:"date"`
+	Extra     json.RawMessage `gorm:"not null" json:"extra"`
+	Score     int             `gorm:"type:int;not null" json:"score"`
+	Target    int64           `gorm:"type:bigint;not null" json:"target"`
+	UserID    int64           `gorm:"type:bigint;not null" json:"userId"`
+
+	// RevisedAt is the time, as an epoch, when the rating was updated and
+	// this revision was recorded.
+	RevisedAt int64 `gorm:"type:bigint;not null" json:"revisedAt"`
+}
+
+// A RatingAuthor tells who wrote a rating, see RatingDB.Authors.
+type RatingAuthor struct {
+	RatingID int64
+	UserID   int64
+
+	// Deleted tells the author must not be shown, but as a deleted user:
+	// the user was removed, or it was deactivated or anonymised, see
+	// RatingsAnonymise.
+	Deleted bool
 }
 
 // NewRating creates a new Rating value with default field values applied.
@@ -87,27 +457,176 @@ func NewRating() Rating {
 	}
 }
 
+// maxTargetTags is the maximum number of tags a target can have.
+const maxTargetTags = 32
+
 type ratingService struct {
 	RatingService
+
+	db        *gorm.DB
+	us        UserService
+	policy    visibilityPolicy
+	quota     *ratingQuota
+	probation probation
+	rules     *Rules
+	fields    *targetFieldEngine
+	clock     Clock
+	outbox    *outbox
+
+	verification verification
+
+	// org is the organisation whose ratings are read, if not zero, see
+	// inOrganisation.
+	org int64
 }
 
 // NewRatingService instantiates a new RatingService implementation with db as the
 // backing database.
 func NewRatingService(db *gorm.DB, us UserService) RatingService {
+	return newRatingService(db, us, nil, nil, probation{}, nil, nil, nil, nil, verification{})
+}
+
+// newRatingService instantiates a new RatingService implementation that
+// restricts the ratings read by each role with the rules in policy, and the
+// ratings created by each user with quota, if not nil. The ratings of accounts
+// on probation are held back from the stats. The custom rules on the ratings, which
+// may be nil, are checked when they are created or updated. The ratings are
+// dated with clock, the clock of the system if nil. The events of the ratings
+// created and updated are written to ob, which may be nil. The ratings are
+// verified, and weighted in the stats, as v tells.
+func newRatingService(db *gorm.DB, us UserService, policy visibilityPolicy, quota *ratingQuota, p probation, rules *Rules, fields *targetFieldEngine, clock Clock, ob *outbox, v verification) *ratingService {
+	if clock == nil {
+		clock = SystemClock
+	}
+
 	return &ratingService{
 		RatingService: &ratingValidator{
-			RatingDB:    &ratingGorm{db},
+			RatingDB:    &ratingGorm{db: db, probation: p, fields: fields, outbox: ob, verifiedWeight: v.weight, clock: clock},
 			userService: us,
+			campaigns:   &campaignGorm{db: db},
+			quota:       quota,
+			rules:       rules,
+			clock:       clock,
+			verifier:    v.verifier,
 		},
+		db:           db,
+		us:           us,
+		policy:       policy,
+		quota:        quota,
+		probation:    p,
+		rules:        rules,
+		fields:       fields,
+		clock:        clock,
+		outbox:       ob,
+		verification: v,
+	}
+}
+
+func (rs *ratingService) Scoped(u *User) RatingService {
+	scope := rs.policy.scope(u.RoleID)
+	org := rs.org
+	if org == 0 && u.OrgID != nil {
+		org = *u.OrgID
+	}
+	if scope == nil && org == rs.org {
+		return rs
+	}
+
+	if org != 0 {
+		scope = organisationScope(org, scope)
+	}
+	return rs.scoped(scope, org)
+}
+
+// inOrganisation returns a copy of rs only reading the ratings of the
+// organisation org, see Services.InRequest. The ratings it changes are read
+// first, so the ones of the other organisations are not found.
+func (rs *ratingService) inOrganisation(org int64) *ratingService {
+	scoped := rs.scoped(organisationScope(org, nil), org)
+	scoped.policy = rs.policy
+	return scoped
+}
+
+// scoped returns a copy of rs whose ratings read are restricted by scope,
+// without the visibility policy, serving the organisation org, if not zero:
+// the ratings are only submitted to its campaigns.
+func (rs *ratingService) scoped(scope func(*gorm.DB) *gorm.DB, org int64) *ratingService {
+	var campaigns CampaignDB = &campaignGorm{db: rs.db}
+	if org != 0 {
+		campaigns = &campaignOrganisation{CampaignService: campaigns, org: org}
+	}
+
+	return &ratingService{
+		RatingService: &ratingValidator{
+			RatingDB:    &ratingGorm{db: rs.db, scope: scope, probation: rs.probation, fields: rs.fields, outbox: rs.outbox, verifiedWeight: rs.verification.weight, clock: rs.clock},
+			userService: rs.us,
+			campaigns:   campaigns,
+			quota:       rs.quota,
+			rules:       rs.rules,
+			clock:       rs.clock,
+			verifier:    rs.verification.verifier,
+		},
+		db:           rs.db,
+		us:           rs.us,
+		quota:        rs.quota,
+		probation:    rs.probation,
+		rules:        rs.rules,
+		fields:       rs.fields,
+		clock:        rs.clock,
+		outbox:       rs.outbox,
+		verification: rs.verification,
+		org:          org,
+	}
+}
+
+// organisationScope restricts the ratings read to the ones of the organisation
+// org, and by scope too if not nil.
+func organisationScope(org int64, scope func(*gorm.DB) *gorm.DB) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("ratings.org_id = ?", org)
+		if scope != nil {
+			db = scope(db)
+		}
+		return db
 	}
 }
 
 type ratingValidator struct {
 	RatingDB
 	userService UserService
+
+	// campaigns looks up the campaigns ratings are submitted to.
+	campaigns CampaignDB
+
+	// quota limits the ratings created by each user, if not nil.
+	quota *ratingQuota
+
+	// rules are the custom rules run after the validators, if not nil.
+	rules *Rules
+
+	// clock dates the ratings created.
+	clock Clock
+
+	// verifier verifies the ratings, if not nil.
+	verifier TransactionVerifier
 }
 
 func (rv *ratingValidator) Create(rating *Rating) error {
+	err := rv.validateCreate(rating)
+	if err != nil {
+		return err
+	}
+
+	rating.User = nil
+	return rv.RatingDB.Create(rating)
+}
+
+// validateCreate runs the validators and the custom rules of the ratings
+// created on rating.
+func (rv *ratingValidator) validateCreate(rating *Rating) error {
+	// the drafts are saved with CreateDraft
+	rating.Draft = false
+
 	rc := ratingValWithDBData{rv: rv, us: rv.userService}
 	err := rv.runValFuncs(rating,
 		rv.idSetToZero,
@@ -118,16 +637,26 @@ func (rv *ratingValidator) Create(rating *Rating) error {
 		rv.commentLength,
 		rv.extraLength,
 		rv.targetInvalid,
+		rc.fetchCategory,
+		rc.categoryScoreRange,
+		rc.categoryCommentRequired,
 		rc.fetchUser,
+		rc.quotaNotExceeded,
+		rc.fetchWindow,
+		rc.windowOpen,
+		rc.fetchCampaign,
+		rc.campaignOpen,
+		rc.campaignEligible,
+		rc.campaignIncludesTarget,
 		rc.setSessionUserAsUserID,
+		rc.setVerified,
 		rv.setDate,
 	)
 	if err != nil {
 		return err
 	}
 
-	rating.User = nil
-	return rv.RatingDB.Create(rating)
+	return rv.runValFuncs(rating, rv.rules.ratingRules()...)
 }
 
 func (rv *ratingValidator) Update(rating *Rating) error {
@@ -140,30 +669,111 @@ func (rv *ratingValidator) Update(rating *Rating) error {
 		rv.extraLength,
 		rc.fetchUser,
 		rc.fetchRating,
-		rc.userIsOwner,
+		rc.userCanChange,
 		rc.setDatabaseRatingDefaults,
-		rc.setSessionUserAsUserID,
+		rc.setVerified,
+		rc.fetchCategory,
+		rc.categoryScoreRange,
+		rc.categoryCommentRequired,
+		rc.fetchWindow,
+		rc.windowOpen,
+		rc.fetchCampaign,
+		rc.campaignOpen,
 		rv.setDate,
 	)
 	if err != nil {
 		return err
 	}
 
+	err = rv.runValFuncs(rating, rv.rules.ratingRules()...)
+	if err != nil {
+		return err
+	}
+
 	rating.User = nil
 	return rv.RatingDB.Update(rating)
 }
 
-func (rv *ratingValidator) Delete(rating *Rating) error {
+func (rv *ratingValidator) UpdatePartial(rating *Rating, patch []byte) error {
+	fields, err := patchFields(patch)
+	if err != nil {
+		return err
+	}
 
 	rc := ratingValWithDBData{rv: rv, us: rv.userService}
-	err := rv.runValFuncs(rating,
+	err = rv.runValFuncs(rating,
 		rv.userSessionExists,
 		rv.userSessionInvalid,
 		rc.fetchUser,
 		rc.fetchRating,
-		rc.userIsOwnerOrAdmin,
+		rc.userCanChange,
+	)
+	if err != nil {
+		return err
+	}
+
+	var pr Rating
+	if err := applyMergePatch(&rc.dbRating, patch, &pr); err != nil {
+		return err
+	}
+
+	// without a version from the client, the one read is used so changes
+	// made in between are not overwritten
+	pr.ID, pr.User, pr.Version = rating.ID, rating.User, rating.Version
+	if pr.Version == 0 {
+		pr.Version = rc.dbRating.Version
+	}
+	if len(pr.Extra) == 0 {
+		pr.Extra = json.RawMessage(`{}`)
+	}
+	*rating = pr
+
+	fns := []func() (string, ratingValFn){}
+	if fields["score"] {
+		fns = append(fns, rv.scoreRequired)
+	}
+	if fields["comment"] {
+		fns = append(fns, rv.commentLength)
+	}
+	if fields["extra"] {
+		fns = append(fns, rv.extraLength)
+	}
+	fns = append(fns,
+		rc.setDatabaseRatingDefaults,
+		rc.setVerified,
+		rc.fetchCategory,
+		rc.categoryScoreRange,
+		rc.categoryCommentRequired,
+		rc.fetchWindow,
+		rc.windowOpen,
+		rc.fetchCampaign,
+		rc.campaignOpen,
+		rv.setDate,
 	)
 
+	err = rv.runValFuncs(rating, fns...)
+	if err != nil {
+		return err
+	}
+
+	err = rv.runValFuncs(rating, rv.rules.ratingRules()...)
+	if err != nil {
+		return err
+	}
+
+	rating.User = nil
+	return rv.RatingDB.Update(rating)
+}
+
+func (rv *ratingValidator) Delete(rating *Rating) error {
+	rc := ratingValWithDBData{rv: rv, us: rv.userService}
+	err := rv.runValFuncs(rating,
+		rv.userSessionExists,
+		rv.userSessionInvalid,
+		rc.fetchUser,
+		rc.fetchRating,
+		rc.userCanChange,
+	)
 	if err != nil {
 		return err
 	}
@@ -172,13 +782,203 @@ func (rv *ratingValidator) Delete(rating *Rating) error {
 	return rv.RatingDB.Delete(rating)
 }
 
+func (rv *ratingValidator) StatsByTarget(target int64) (RatingStats, error) {
+	if target < 1 {
+		return RatingStats{}, ValidationError{"target": ErrInvalid}
+	}
+
+	return rv.RatingDB.StatsByTarget(target)
+}
+
+func (rv *ratingValidator) DetailedStatsByTarget(target int64, f StatsFilter) (RatingStats, error) {
+	if target < 1 {
+		return RatingStats{}, ValidationError{"target": ErrInvalid}
+	}
+
+	ve := ValidationError{}
+
+	if f.From < 0 || f.To < 0 || (f.To != 0 && f.From > f.To) {
+		ve["to"] = ErrInvalid
+	}
+
+	if f.Buckets == 0 {
+		f.Buckets = DefaultHistogramBuckets
+	} else if f.Buckets < 0 || f.Buckets > MaxHistogramBuckets {
+		ve["buckets"] = ErrInvalid
+	}
+
+	if len(ve) > 0 {
+		return RatingStats{}, ve
+	}
+
+	return rv.RatingDB.DetailedStatsByTarget(target, f)
+}
+
+func (rv *ratingValidator) Cohorts(by string) ([]RatingCohort, error) {
+	if by == "" {
+		return nil, ValidationError{"by": ErrRequired}
+	} else if _, ok := CohortGroupings[by]; !ok {
+		return nil, ValidationError{"by": ErrInvalid}
+	}
+
+	return rv.RatingDB.Cohorts(by)
+}
+
+func (rv *ratingValidator) StatsByCampaign(campaignID int64) (CampaignStats, error) {
+	if campaignID < 1 {
+		return CampaignStats{}, ErrNotFound
+	}
+
+	return rv.RatingDB.StatsByCampaign(campaignID)
+}
+
+func (rv *ratingValidator) Search(q RatingQuery) ([]Rating, error) {
+	err := rv.runQueryValFuncs(&q,
+		rv.queryTargetRequired,
+		rv.queryScoreRange,
+		rv.queryDateRange,
+		rv.querySortExists,
+		rv.queryLimitPositive,
+		rv.queryAfterSortedByID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return rv.RatingDB.Search(q)
+}
+
+func (rv *ratingValidator) Scoped(u *User) RatingService {
+	panic("method Scoped of ratingValidator must never be called")
+}
+
+func (rv *ratingValidator) Tags(target int64) ([]string, error) {
+	if target < 1 {
+		return nil, ValidationError{"target": ErrInvalid}
+	}
+
+	return rv.RatingDB.Tags(target)
+}
+
+func (rv *ratingValidator) SetTags(target int64, tags []string) error {
+	if target < 1 {
+		return ValidationError{"target": ErrInvalid}
+	}
+
+	var (
+		normalised = make([]string, 0, len(tags))
+		seen       = make(map[string]bool, len(tags))
+	)
+
+	for _, t := range tags {
+		t = normaliseTag(t)
+		if t == "" {
+			return ValidationError{"tags": ErrRequired}
+		} else if len(t) > 64 {
+			return ValidationError{"tags": ErrTooLong}
+		}
+
+		if !seen[t] {
+			seen[t] = true
+			normalised = append(normalised, t)
+		}
+	}
+
+	if len(normalised) > maxTargetTags {
+		return ValidationError{"tags": ErrTooLong}
+	}
+
+	return rv.RatingDB.SetTags(target, normalised)
+}
+
 type ratingValFn func(r *Rating) error
 
+type ratingQueryValFn func(q *RatingQuery) error
+
+func (rv *ratingValidator) runQueryValFuncs(q *RatingQuery, fns ...func() (string, ratingQueryValFn)) error {
+	return runValidationFunctions(q, fns)
+}
+
+// queryTargetRequired returns an error if the target is not a valid ID. It may
+// return ErrRequired or ErrInvalid.
+func (rv *ratingValidator) queryTargetRequired() (string, ratingQueryValFn) {
+	return "target", func(q *RatingQuery) error {
+		if q.Target == 0 {
+			return ErrRequired
+		} else if q.Target < 1 {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
+// queryScoreRange makes sure the minimum score is not greater than the maximum
+// score. It may return ErrInvalid.
+func (rv *ratingValidator) queryScoreRange() (string, ratingQueryValFn) {
+	return "maxScore", func(q *RatingQuery) error {
+		if q.MinScore != nil && q.MaxScore != nil && *q.MinScore > *q.MaxScore {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
+// queryDateRange makes sure the dates are not negative and the start date is
+// not after the end date. It may return ErrInvalid.
+func (rv *ratingValidator) queryDateRange() (string, ratingQueryValFn) {
+	return "to", func(q *RatingQuery) error {
+		if q.From < 0 || q.To < 0 || (q.To != 0 && q.From > q.To) {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
+// querySortExists makes sure the results are sorted by one of the fields in
+// ratingSortColumns. It may return ErrInvalid.
+func (rv *ratingValidator) querySortExists() (string, ratingQueryValFn) {
+	return "sort", func(q *RatingQuery) error {
+		if q.Sort == "" {
+			return nil
+		}
+
+		if _, ok := ratingSortColumns[strings.TrimPrefix(q.Sort, "-")]; !ok {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
+// queryLimitPositive makes sure the limit is not negative. It may return
+// ErrInvalid.
+func (rv *ratingValidator) queryLimitPositive() (string, ratingQueryValFn) {
+	return "limit", func(q *RatingQuery) error {
+		if q.Limit < 0 {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
+// queryAfterSortedByID makes sure the results are sorted by ID when they start
+// after a rating, as the ratings are paged by ID. It may return ErrInvalid.
+func (rv *ratingValidator) queryAfterSortedByID() (string, ratingQueryValFn) {
+	return "after", func(q *RatingQuery) error {
+		if q.After < 0 || (q.After > 0 && q.Sort != "") {
+			return ErrInvalid
+		}
+		return nil
+	}
+}
+
 type ratingValWithDBData struct {
 	rv          *ratingValidator
 	us          UserService
 	sessionUser User
 	dbRating    Rating
+	campaign    Campaign
+	category    TargetCategory
+	window      TargetWindow
 }
 
 func (rv *ratingValidator) runValFuncs(r *Rating, fns ...func() (string, ratingValFn)) error {
@@ -196,8 +996,7 @@ func (rv *ratingValidator) idSetToZero() (string, ratingValFn) {
 // setDate sets date to now. It does not return any errors.
 func (rv *ratingValidator) setDate() (string, ratingValFn) {
 	return "", func(r *Rating) error {
-		nowEpoch := time.Now().Unix()
-		r.Date = nowEpoch
+		r.Date = rv.clock.Now().Unix()
 		return nil
 	}
 }
@@ -310,60 +1109,173 @@ func (rc *ratingValWithDBData) fetchRating() (string, ratingValFn) {
 	}
 }
 
-// userIsOwner checks if the user of the session is the owner of the rating
-// being processed. A session user must have been successfully obtained before
-// using this method.
-func (rc *ratingValWithDBData) userIsOwner() (string, ratingValFn) {
+// userCanChange checks if the user of the session can change the rating being
+// processed: its owner can, and the moderators can change any, see
+// User.ModeratesRatings. A session user must have been successfully obtained
+// before using this method. It may return ErrReadOnly.
+func (rc *ratingValWithDBData) userCanChange() (string, ratingValFn) {
 	return "", func(r *Rating) error {
-
-		if rc.dbRating.UserID != rc.sessionUser.ID {
+		if rc.dbRating.UserID != rc.sessionUser.ID && !rc.sessionUser.ModeratesRatings() {
 			return ErrReadOnly
 		}
 		return nil
 	}
 }
 
-// setDatabaseRatingDefaults sets the target of the rating being processed to
-// its existing value in the database. This method is dependent on fetchRating.
+// setDatabaseRatingDefaults sets the target, the campaign, the author and the
+// organisation of the rating being processed to their existing values in the
+// database, so the ratings changed by moderators are kept by their author. This
+// method is dependent on fetchRating.
 func (rc *ratingValWithDBData) setDatabaseRatingDefaults() (string, ratingValFn) {
 	return "", func(r *Rating) error {
 		r.Target = rc.dbRating.Target
+		r.CampaignID = rc.dbRating.CampaignID
+		r.UserID = rc.dbRating.UserID
+		r.OrgID = rc.dbRating.OrgID
 		return nil
 	}
 }
 
-// setDatabaseRatingDefaults sets the UserID of the rating being processed to
-// the existing value of user retrieved from the session. This method is then
-// dependent on fetchUser.
-func (rc *ratingValWithDBData) setSessionUserAsUserID() (string, ratingValFn) {
-	return "", func(r *Rating) error {
-		r.UserID = rc.sessionUser.ID
-		return nil
+// fetchCampaign retrieves the campaign the rating is submitted to, if any. It
+// may return ErrRefNotFound.
+func (rc *ratingValWithDBData) fetchCampaign() (string, ratingValFn) {
+	return "campaignId", func(r *Rating) error {
+		if r.CampaignID == nil {
+			return nil
+		}
+
+		var err error
+		rc.campaign, err = rc.rv.campaigns.ByID(*r.CampaignID)
+		if xerrors.Is(err, ErrNotFound) {
+			return ErrRefNotFound
+		}
+		return err
 	}
 }
 
-// userIsOwnerOrAdmin proves that the user trying to delete a rating is the
-// owner or an administrator. A session user must have been successfully
-// obtained before using this method.
-func (rc *ratingValWithDBData) userIsOwnerOrAdmin() (string, ratingValFn) {
-	return "", func(r *Rating) error {
+// campaignOpen makes sure the campaign accepts ratings now. It may return
+// ErrCampaignClosed. This method is dependent on fetchCampaign.
+func (rc *ratingValWithDBData) campaignOpen() (string, ratingValFn) {
+	return "campaignId", func(r *Rating) error {
+		if r.CampaignID == nil || rc.campaign.Open(rc.rv.clock.Now()) {
+			return nil
+		}
+		return ErrCampaignClosed
+	}
+}
 
-		if rc.dbRating.UserID != rc.sessionUser.ID {
-			if r.User.RoleID != 1 {
-				return ErrReadOnly
-			}
+// campaignEligible makes sure the role of the session user can take part in
+// the campaign. It may return ErrNotEligible. This method is dependent on
+// fetchUser and fetchCampaign.
+func (rc *ratingValWithDBData) campaignEligible() (string, ratingValFn) {
+	return "campaignId", func(r *Rating) error {
+		if r.CampaignID == nil || rc.campaign.Eligible(rc.sessionUser.RoleID) {
+			return nil
 		}
+		return ErrNotEligible
+	}
+}
+
+// campaignIncludesTarget makes sure the target can be rated in the campaign.
+// It may return ErrInvalid. This method is dependent on fetchCampaign.
+func (rc *ratingValWithDBData) campaignIncludesTarget() (string, ratingValFn) {
+	return "target", func(r *Rating) error {
+		// nothing to check if the campaign could not be fetched
+		if r.CampaignID == nil || rc.campaign.ID == 0 || rc.campaign.Includes(r.Target) {
+			return nil
+		}
+		return ErrInvalid
+	}
+}
+
+// quotaNotExceeded makes sure the session user did not create the maximum
+// number of ratings allowed by the quota recently. It may return
+// ErrRateLimited. This method is dependent on fetchUser.
+func (rc *ratingValWithDBData) quotaNotExceeded() (string, ratingValFn) {
+	return "userId", func(r *Rating) error {
+		if rc.rv.quota == nil {
+			return nil
+		}
+		return rc.rv.quota.check(rc.sessionUser.ID)
+	}
+}
+
+// setSessionUserAsUserID sets the UserID of the rating being processed to the
+// existing value of user retrieved from the session, and its OrgID to the
+// organisation of the user, so the ratings belong to the organisation of their
+// author. This method is then dependent on fetchUser.
+func (rc *ratingValWithDBData) setSessionUserAsUserID() (string, ratingValFn) {
+	return "", func(r *Rating) error {
+		r.UserID = rc.sessionUser.ID
+		r.OrgID = rc.sessionUser.OrgID
 		return nil
 	}
 }
 
 type ratingGorm struct {
 	db *gorm.DB
+
+	// scope restricts the ratings read, and may be nil.
+	scope func(*gorm.DB) *gorm.DB
+
+	// probation holds back the ratings of new accounts from the stats.
+	probation probation
+
+	// fields computes the target fields along with the stats, and may be
+	// nil.
+	fields *targetFieldEngine
+
+	// outbox publishes the events of the ratings created and updated, and
+	// may be nil.
+	outbox *outbox
+
+	// verifiedWeight is the weight of the scores of the verified ratings
+	// in the stats, see verifiedWeightSQL.
+	verifiedWeight float64
+
+	// clock dates the revisions of the ratings, the clock of the system
+	// if nil.
+	clock Clock
+}
+
+// now returns the time told by the clock of rg.
+func (rg *ratingGorm) now() time.Time {
+	if rg.clock == nil {
+		return SystemClock.Now()
+	}
+
+	return rg.clock.Now()
 }
 
+// read returns the database handle used to read ratings, restricted by the
+// scope of rg.
+func (rg *ratingGorm) read() *gorm.DB {
+	if rg.scope == nil {
+		return rg.db
+	}
+
+	return rg.db.Scopes(rg.scope)
+}
+
+// Create stores r, held back from the aggregates if its user is on probation.
 func (rg *ratingGorm) Create(r *Rating) error {
-	res := rg.db.Create(r)
+	err := gormTransaction(rg.db, func(tx *gorm.DB) error {
+		return rg.insert(tx, r)
+	})
+	if err != nil {
+		return err
+	}
 
+	rg.outbox.added(rg.db)
+	return nil
+}
+
+// insert stores r as Create does. It must be called within a transaction.
+func (rg *ratingGorm) insert(tx *gorm.DB, r *Rating) error {
+	// gorm sets the times of the ratings created
+	r.CreatedAt, r.UpdatedAt = nil, nil
+
+	res := tx.Create(r)
 	if res.Error != nil {
 		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) {
 			switch {
@@ -379,39 +1291,107 @@ func (rg *ratingGorm) Create(r *Rating) error {
 		return wrap("could not create rating", res.Error)
 	}
 
-	return nil
+	err := rg.probation.hold(tx, r.ID)
+	if err != nil {
+		return err
+	}
+
+	return rg.outbox.add(tx, events.Event{Type: events.RatingCreated, Data: *r})
 }
 
+// Update stores the new values of r and records the values it replaces as a
+// RatingRevision, both within the same transaction.
 func (rg *ratingGorm) Update(r *Rating) error {
-	res := rg.db.Model(&Rating{ID: r.ID}).Updates(gormToMap(rg.db, r))
+	err := gormTransaction(rg.db, func(tx *gorm.DB) error {
+		err := reviseRating(tx, r, rg.now())
+		if err != nil {
+			return err
+		}
 
-	if res.Error != nil {
-		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) {
+		return rg.outbox.add(tx, events.Event{Type: events.RatingUpdated, Data: *r})
+	})
+	if err != nil {
+		return err
+	}
+
+	rg.outbox.added(rg.db)
+	return nil
+}
+
+// reviseRating stores the new values of r and records the values it replaces as
+// a RatingRevision, revised at now. It must be called within a transaction.
+func reviseRating(tx *gorm.DB, r *Rating, now time.Time) error {
+	var current Rating
+	err := tx.Set("gorm:query_option", "FOR UPDATE").First(&current, r.ID).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+
+		return wrap("could not get rating to be revised", err)
+	}
+
+	err = tx.Create(&RatingRevision{
+		RatingID:  current.ID,
+		Active:    current.Active,
+		Anonymous: current.Anonymous,
+		Comment:   current.Comment,
+		Date:      current.Date,
+		Extra:     current.Extra,
+		Score:     current.Score,
+		Target:    current.Target,
+		UserID:    current.UserID,
+		RevisedAt: now.Unix(),
+	}).Error
+	if err != nil {
+		return wrap("could not create rating revision", err)
+	}
+
+	v, err := gormVersionedUpdates(tx, &Rating{ID: r.ID}, r, r.Version)
+	if err != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(err, &perr) {
 			switch {
 			case perr.Code.Name() == "foreign_key_violation" && perr.Constraint == "ratings_user_id_users_id_foreign":
 				return ValidationError{"userId": ErrRefNotFound}
 			case perr.Code.Name() == "unique_violation" && perr.Constraint == "uix_ratings_user_id_target":
 				return ValidationError{"target": ErrDuplicate}
 			}
-		}
 
-		return wrap("could not update rating", res.Error)
+		} else if xerrors.Is(err, ErrNotFound) || xerrors.Is(err, ErrConflict) {
+			return err
+		}
 
-	} else if res.RowsAffected == 0 {
-		return ErrNotFound
+		return wrap("could not update rating", err)
 	}
 
+	r.Version = v
 	return nil
 }
 
 func (rg *ratingGorm) Delete(r *Rating) error {
-	res := rg.db.Delete(&Rating{}, r.ID)
+	qb := rg.db
+	if r.Version != 0 {
+		qb = qb.Where("version = ?", r.Version)
+	}
 
+	res := qb.Delete(&Rating{}, r.ID)
 	if res.Error != nil {
 		return wrap("could not delete rating by id", res.Error)
 
 	} else if res.RowsAffected == 0 {
-		return ErrNotFound
+		if r.Version == 0 {
+			return ErrNotFound
+		}
+
+		var ct int64
+		err := rg.db.Model(&Rating{}).Where("id = ?", r.ID).Count(&ct).Error
+		if err != nil {
+			return wrap("could not count the ratings by id", err)
+		} else if ct == 0 {
+			return ErrNotFound
+		}
+
+		return ErrConflict
 	}
 
 	return nil
@@ -419,13 +1399,13 @@ func (rg *ratingGorm) Delete(r *Rating) error {
 
 func (rg *ratingGorm) ByID(id int64) (Rating, error) {
 	var rating Rating
-	err := rg.db.First(&rating, id).Error
+	err := rg.read().First(&rating, id).Error
 
 	if err != nil {
 		if xerrors.Is(err, gorm.ErrRecordNotFound) {
 			return Rating{}, ErrNotFound
 		}
-		return Rating{}, wrap("could not get rating by ID", err)
+		return Rating{}, with(wrap("could not get rating by ID", err), "rating_id", id)
 	}
 
 	return rating, err
@@ -433,14 +1413,341 @@ func (rg *ratingGorm) ByID(id int64) (Rating, error) {
 
 func (rg *ratingGorm) ByTarget(target int64) ([]Rating, error) {
 	var ratings []Rating
-	err := rg.db.Where("target = ?", target).Find(&ratings).Error
+	err := rg.read().Where("target = ?", target).Find(&ratings).Error
 
 	if err != nil {
 		if xerrors.Is(err, gorm.ErrRecordNotFound) {
 			return []Rating{}, nil
 		}
-		return []Rating{}, wrap("failed to list ratings by target", err)
+		return []Rating{}, with(wrap("failed to list ratings by target", err), "target", target)
 	}
 
 	return ratings, nil
 }
+
+// statsAggregates returns the selection of the fields of RatingStats
+// summarising a set of ratings.
+func (rg *ratingGorm) statsAggregates() string {
+	return "count(*) AS count, coalesce(avg(score), 0) AS average, coalesce(min(score), 0) AS min, coalesce(max(score), 0) AS max, " +
+		"coalesce(sum(score * " + reputationWeightSQL + ") / sum(" + reputationWeightSQL + "), 0) AS weighted_average, " +
+		rg.verifiedAggregate()
+}
+
+// verifiedAggregate returns the selection of RatingStats.VerifiedWeightedAverage.
+func (rg *ratingGorm) verifiedAggregate() string {
+	w := verifiedWeightSQL(rg.verifiedWeight)
+	return "coalesce(sum(score * " + w + ") / sum(" + w + "), 0) AS verified_weighted_average"
+}
+
+func (rg *ratingGorm) StatsByTarget(target int64) (RatingStats, error) {
+	var stats RatingStats
+
+	err := rg.probation.counted(rg.read()).Model(&Rating{}).
+		Select(rg.statsAggregates()).
+		Where("target = ? AND active", target).
+		Scan(&stats).
+		Error
+	if err != nil {
+		return RatingStats{}, with(wrap("failed to get rating stats by target", err), "target", target)
+	}
+
+	stats.Target = target
+	return rg.computeFields(stats)
+}
+
+func (rg *ratingGorm) DetailedStatsByTarget(target int64, f StatsFilter) (RatingStats, error) {
+	qb := rg.probation.counted(rg.read()).Model(&Rating{}).Where("target = ? AND active", target)
+
+	if f.Verified {
+		qb = qb.Where("EXISTS (SELECT 1 FROM rating_moderations WHERE rating_moderations.rating_id = ratings.id AND outcome = ?)", ModerationApproved)
+	}
+
+	if f.From != 0 {
+		qb = qb.Where("date >= ?", f.From)
+	}
+
+	if f.To != 0 {
+		qb = qb.Where("date <= ?", f.To)
+	}
+
+	var stats RatingStats
+	err := qb.Select(rg.statsAggregates()).Scan(&stats).Error
+	if err != nil {
+		return RatingStats{}, with(wrap("failed to get detailed rating stats by target", err), "target", target)
+	}
+
+	stats.Target = target
+	stats.Percentiles = &ScorePercentiles{}
+	if stats.Count == 0 {
+		return stats, nil
+	}
+
+	err = qb.Select("percentile_cont(0.25) WITHIN GROUP (ORDER BY score) AS p25, " +
+		"percentile_cont(0.5) WITHIN GROUP (ORDER BY score) AS p50, " +
+		"percentile_cont(0.75) WITHIN GROUP (ORDER BY score) AS p75").
+		Scan(stats.Percentiles).
+		Error
+	if err != nil {
+		return RatingStats{}, with(wrap("failed to get the percentiles of the scores of the target", err), "target", target)
+	}
+
+	width := histogramWidth(stats.Min, stats.Max, f.Buckets)
+
+	var counts []struct {
+		Bucket int
+		Count  int64
+	}
+	err = qb.Select("(score - ?) / ? AS bucket, count(*) AS count", stats.Min, width).
+		Group("bucket").
+		Scan(&counts).
+		Error
+	if err != nil {
+		return RatingStats{}, with(wrap("failed to get the histogram of the scores of the target", err), "target", target)
+	}
+
+	stats.Histogram = histogramBuckets(stats.Min, stats.Max, width)
+	for _, c := range counts {
+		if c.Bucket >= 0 && c.Bucket < len(stats.Histogram) {
+			stats.Histogram[c.Bucket].Count = c.Count
+		}
+	}
+
+	return stats, nil
+}
+
+func (rg *ratingGorm) Cohorts(by string) ([]RatingCohort, error) {
+	cohorts := []RatingCohort{}
+
+	// the users are not joined, so the visibility rules can't refer to
+	// their columns by mistake
+	err := rg.probation.counted(rg.read()).Model(&Rating{}).
+		Select("date_trunc(?, (SELECT created_at FROM users WHERE users.id = ratings.user_id) AT TIME ZONE 'UTC') AS cohort, "+
+			"count(DISTINCT user_id) AS users, count(*) AS count, avg(score) AS average", CohortGroupings[by]).
+		Where("active").
+		Group("cohort").
+		Order("cohort").
+		Scan(&cohorts).
+		Error
+	if err != nil {
+		return nil, with(wrap("failed to get the rating cohorts", err), "by", by)
+	}
+
+	for i := range cohorts {
+		// the timestamps without time zone are read as UTC
+		cohorts[i].Cohort = cohorts[i].Cohort.UTC()
+	}
+
+	return cohorts, nil
+}
+
+// histogramWidth returns the width of the buckets of a histogram of the scores
+// from min to max, both included, with at most n buckets.
+func histogramWidth(min, max, n int) int {
+	return (max - min + n) / n
+}
+
+// histogramBuckets returns the empty buckets, of the given width, of a
+// histogram of the scores from min to max, both included.
+func histogramBuckets(min, max, width int) []HistogramBucket {
+	var buckets []HistogramBucket
+	for from := min; from <= max; from += width {
+		to := from + width - 1
+		if to > max {
+			to = max
+		}
+		buckets = append(buckets, HistogramBucket{Min: from, Max: to})
+	}
+
+	return buckets
+}
+
+// computeFields sets the target fields computed from stats, if any.
+func (rg *ratingGorm) computeFields(stats RatingStats) (RatingStats, error) {
+	programs, err := rg.fields.load()
+	if err != nil || len(programs) == 0 {
+		return stats, err
+	}
+
+	var counts []struct {
+		Score int64
+		Count int64
+	}
+	err = rg.probation.counted(rg.read()).Model(&Rating{}).
+		Select("score, count(*) AS count").
+		Where("target = ? AND active", stats.Target).
+		Group("score").
+		Scan(&counts).
+		Error
+	if err != nil {
+		return RatingStats{}, with(wrap("failed to count the ratings of the target by score", err), "target", stats.Target)
+	}
+
+	scores := make(map[int64]int64, len(counts))
+	for _, c := range counts {
+		scores[c.Score] = c.Count
+	}
+
+	stats.Computed = computeTargetFields(programs, stats, scores)
+	return stats, nil
+}
+
+func (rg *ratingGorm) StatsByCampaign(campaignID int64) (CampaignStats, error) {
+	const aggregates = "count(*) AS count, coalesce(avg(score), 0) AS average, " +
+		"coalesce(sum(score * " + reputationWeightSQL + ") / sum(" + reputationWeightSQL + "), 0) AS weighted_average"
+
+	stats := CampaignStats{CampaignID: campaignID, Targets: []RatingStats{}}
+
+	err := rg.probation.counted(rg.read()).Model(&Rating{}).
+		Select(aggregates).
+		Where("campaign_id = ? AND active", campaignID).
+		Scan(&stats).
+		Error
+	if err != nil {
+		return CampaignStats{}, with(wrap("failed to get rating stats by campaign", err), "campaign_id", campaignID)
+	}
+
+	err = rg.probation.counted(rg.read()).Model(&Rating{}).
+		Select("target, "+aggregates+", min(score) AS min, max(score) AS max, "+rg.verifiedAggregate()).
+		Where("campaign_id = ? AND active", campaignID).
+		Group("target").
+		Order("target").
+		Scan(&stats.Targets).
+		Error
+	if err != nil {
+		return CampaignStats{}, with(wrap("failed to get rating stats of campaign targets", err), "campaign_id", campaignID)
+	}
+
+	stats.CampaignID = campaignID
+	return stats, nil
+}
+
+func (rg *ratingGorm) Search(q RatingQuery) ([]Rating, error) {
+	var ratings []Rating
+
+	qb := rg.read().Where("target = ?", q.Target)
+
+	if q.MinScore != nil {
+		qb = qb.Where("score >= ?", *q.MinScore)
+	}
+
+	if q.MaxScore != nil {
+		qb = qb.Where("score <= ?", *q.MaxScore)
+	}
+
+	if q.From != 0 {
+		qb = qb.Where("date >= ?", q.From)
+	}
+
+	if q.To != 0 {
+		qb = qb.Where("date <= ?", q.To)
+	}
+
+	if q.Active != nil {
+		qb = qb.Where("active = ?", *q.Active)
+	}
+
+	if q.Anonymous != nil {
+		qb = qb.Where("anonymous = ?", *q.Anonymous)
+	}
+
+	if q.After != 0 {
+		qb = qb.Where("id > ?", q.After)
+	}
+
+	order := "id"
+	if col := ratingSortColumns[strings.TrimPrefix(q.Sort, "-")]; col != "" {
+		order = col
+		if strings.HasPrefix(q.Sort, "-") {
+			order += " DESC"
+		}
+
+		// ties are sorted by ID so results are stable
+		order += ", id"
+	}
+
+	qb = qb.Order(order)
+	if q.Limit > 0 {
+		qb = qb.Limit(q.Limit)
+	}
+
+	err := qb.Find(&ratings).Error
+	if err != nil {
+		return nil, wrap("failed to search ratings", err)
+	}
+
+	return ratings, nil
+}
+
+func (rg *ratingGorm) History(id int64) ([]RatingRevision, error) {
+	var ct int64
+	err := rg.read().Model(&Rating{}).Where("id = ?", id).Count(&ct).Error
+	if err != nil {
+		return nil, wrap("could not check rating for history", err)
+	} else if ct == 0 {
+		return nil, ErrNotFound
+	}
+
+	var revisions []RatingRevision
+	err = rg.db.Where("rating_id = ?", id).Order("id").Find(&revisions).Error
+	if err != nil {
+		return nil, wrap("failed to list rating revisions", err)
+	}
+
+	return revisions, nil
+}
+
+func (rg *ratingGorm) Tags(target int64) ([]string, error) {
+	var tags []string
+	err := rg.db.Model(&TargetTag{}).Where("target = ?", target).Order("tag").Pluck("tag", &tags).Error
+	if err != nil {
+		return nil, wrap("failed to list target tags", err)
+	}
+
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return tags, nil
+}
+
+// SetTags replaces the tags of a target within a transaction, so the ratings
+// visible by tag never miss the target while its tags are replaced.
+func (rg *ratingGorm) Authors(ids ...int64) ([]RatingAuthor, error) {
+	authors := []RatingAuthor{}
+	if len(ids) == 0 {
+		return authors, nil
+	}
+
+	// the users are joined so a rating is read even if its author is
+	// missing, as it would be left out of an inner join
+	err := rg.db.Raw(`SELECT r.id AS rating_id, r.user_id,
+			u.id IS NULL OR NOT u.active OR u.email LIKE 'deleted-%@users.invalid' AS deleted
+		FROM ratings r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.id IN (?)`, ids).
+		Scan(&authors).
+		Error
+	if err != nil {
+		return nil, with(wrap("could not read the authors of the ratings", err), "rating_ids", ids)
+	}
+
+	return authors, nil
+}
+
+func (rg *ratingGorm) SetTags(target int64, tags []string) error {
+	return gormTransaction(rg.db, func(tx *gorm.DB) error {
+		err := tx.Where("target = ?", target).Delete(&TargetTag{}).Error
+		if err != nil {
+			return wrap("could not remove target tags", err)
+		}
+
+		for _, t := range tags {
+			err = tx.Create(&TargetTag{Target: target, Tag: t}).Error
+			if err != nil {
+				return wrap("could not add target tag", err)
+			}
+		}
+
+		return nil
+	})
+}
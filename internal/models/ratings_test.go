@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +19,75 @@ type testRatingDB struct {
 	update func(*Rating) error
 	delete func(*Rating) error
 	byID   func(int64) (Rating, error)
+	search func(RatingQuery) ([]Rating, error)
+
+	setTags       func(int64, []string) error
+	detailedStats func(int64, StatsFilter) (RatingStats, error)
+	cohorts       func(string) ([]RatingCohort, error)
+	scores        func([]int64) ([]TargetScore, error)
+	category      func(int64) (TargetCategory, error)
+	window        func(int64) (TargetWindow, error)
+	setWindow     func(*TargetWindow) error
+
+	createDraft func(*Rating) error
+	draftByID   func(int64) (Rating, error)
+	publish     func(*Rating, int64) error
+}
+
+func (t *testRatingDB) Category(target int64) (TargetCategory, error) {
+	if t.category != nil {
+		return t.category(target)
+	}
+
+	return TargetCategory{}, ErrNotFound
+}
+
+func (t *testRatingDB) Window(target int64) (TargetWindow, error) {
+	if t.window != nil {
+		return t.window(target)
+	}
+
+	return TargetWindow{Target: target}, nil
+}
+
+func (t *testRatingDB) SetWindow(w *TargetWindow) error {
+	if t.setWindow != nil {
+		return t.setWindow(w)
+	}
+
+	return nil
+}
+
+func (t *testRatingDB) Scores(targets []int64) ([]TargetScore, error) {
+	if t.scores != nil {
+		return t.scores(targets)
+	}
+
+	return []TargetScore{}, nil
+}
+
+func (t *testRatingDB) Cohorts(by string) ([]RatingCohort, error) {
+	if t.cohorts != nil {
+		return t.cohorts(by)
+	}
+
+	return []RatingCohort{}, nil
+}
+
+func (t *testRatingDB) DetailedStatsByTarget(target int64, f StatsFilter) (RatingStats, error) {
+	if t.detailedStats != nil {
+		return t.detailedStats(target, f)
+	}
+
+	return RatingStats{Target: target}, nil
+}
+
+func (t *testRatingDB) SetTags(target int64, tags []string) error {
+	if t.setTags != nil {
+		return t.setTags(target, tags)
+	}
+
+	return nil
 }
 
 func (t *testRatingDB) Create(mr *Rating) error {
@@ -52,8 +122,16 @@ func (t *testRatingDB) ByID(id int64) (Rating, error) {
 	return Rating{}, nil
 }
 
+func (t *testRatingDB) Search(q RatingQuery) ([]Rating, error) {
+	if t.search != nil {
+		return t.search(q)
+	}
+
+	return nil, nil
+}
+
 func dropRatingsTable(db *gorm.DB) {
-	db.DropTableIfExists(&Rating{})
+	db.DropTableIfExists(&Reaction{}, &RatingRevision{}, &Rating{})
 }
 
 func TestRatingService_Create(t *testing.T) {
@@ -373,6 +451,41 @@ func TestRatingService_Update(t *testing.T) {
 				}
 			},
 		},
+		{
+			"ownRatingsOnly",
+			&Rating{ID: 99, Score: 10, User: &User{ID: 22}},
+			nil,
+			ErrReadOnly,
+			func(t *testing.T) {
+				trdb.byID = func(id int64) (Rating, error) {
+					return Rating{ID: 99, Target: 999, UserID: 1}, nil
+				}
+				tudb.byID = func(id int64) (User, error) {
+					return User{ID: 22, Active: true, RoleID: 999,
+						Role: &Role{ID: 999, Permissions: PermissionWriteOwnRatings}}, nil
+				}
+			},
+		},
+		{
+			"moderator",
+			&Rating{ID: 99, Score: 5, User: &User{ID: 22}},
+			&Rating{ID: 99, Score: 5, Target: 999, UserID: 1},
+			nil,
+			func(t *testing.T) {
+				trdb.byID = func(id int64) (Rating, error) {
+					return Rating{ID: 99, Target: 999, UserID: 1}, nil
+				}
+				tudb.byID = func(id int64) (User, error) {
+					return User{ID: 22, Active: true, RoleID: 999,
+						Role: &Role{ID: 999, Permissions: PermissionWriteRatings}}, nil
+				}
+				trdb.update = func(rt *Rating) error {
+					assert.Equal(t, int64(1), rt.UserID, "the author must be kept")
+					rt.Date = 0
+					return nil
+				}
+			},
+		},
 		{
 			"ok",
 			&Rating{
@@ -444,6 +557,138 @@ func TestRatingService_Update(t *testing.T) {
 	}
 }
 
+func TestRatingService_UpdatePartial(t *testing.T) {
+	tudb := &testUserDB{}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	trdb := &testRatingDB{}
+	rs := NewRatingService(nil, us)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	stored := func(id int64) (Rating, error) {
+		return Rating{
+			ID:        99,
+			Active:    true,
+			Anonymous: true,
+			Comment:   "a comment",
+			Date:      1257894000,
+			Extra:     json.RawMessage(`{"color":"blue","size":"xl"}`),
+			Score:     10,
+			Target:    999,
+			UserID:    1,
+			Version:   5,
+		}, nil
+	}
+	owner := func(id int64) (User, error) {
+		return User{ID: id, Active: true, RoleID: 2}, nil
+	}
+
+	var cases = []struct {
+		name      string
+		rating    *Rating
+		patch     string
+		outrating *Rating
+		outerr    error
+		setup     func(t *testing.T)
+	}{
+		{
+			"userIdRequired",
+			&Rating{ID: 99},
+			`{"score":5}`,
+			nil,
+			ErrRequired,
+			nil,
+		},
+		{
+			"userIsOwner",
+			&Rating{ID: 99, User: &User{ID: 22}},
+			`{"score":5}`,
+			nil,
+			ErrReadOnly,
+			func(t *testing.T) {
+				trdb.byID = stored
+				tudb.byID = owner
+			},
+		},
+		{
+			"scoreRemoved",
+			&Rating{ID: 99, User: &User{ID: 1}},
+			`{"score":null}`,
+			nil,
+			ValidationError{"score": ErrRequired},
+			func(t *testing.T) {
+				trdb.byID = stored
+				tudb.byID = owner
+			},
+		},
+		{
+			"commentTooLong",
+			&Rating{ID: 99, User: &User{ID: 1}},
+			`{"comment":"` + strings.Repeat("a", 513) + `"}`,
+			nil,
+			ValidationError{"comment": ErrTooLong},
+			func(t *testing.T) {
+				trdb.byID = stored
+				tudb.byID = owner
+			},
+		},
+		{
+			"ok",
+			&Rating{ID: 99, User: &User{ID: 1}},
+			`{"score":5,"target":1,"extra":{"color":"red","size":null}}`,
+			&Rating{
+				ID:        99,
+				Active:    true,
+				Anonymous: true,
+				Comment:   "a comment",
+				Extra:     json.RawMessage(`{"color":"red"}`),
+				Score:     5,
+				Target:    999,
+				UserID:    1,
+				Version:   6,
+			},
+			nil,
+			func(t *testing.T) {
+				trdb.byID = stored
+				tudb.byID = owner
+				trdb.update = func(rt *Rating) error {
+					assert.NotEqual(t, int64(1257894000), rt.Date, "must set a new date")
+					assert.Equal(t, int64(5), rt.Version, "must use the stored version")
+					assert.Nil(t, rt.User)
+
+					rt.Date = 0
+					rt.Version = 6
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			err := rs.UpdatePartial(cs.rating, []byte(cs.patch))
+
+			if cs.outerr != nil {
+				assert.Error(t, err)
+				assert.True(t, xerrors.Is(err, cs.outerr),
+					"errors must match, expected %v, got %v", cs.outerr, err)
+
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cs.outrating, cs.rating)
+			}
+
+			*trdb = testRatingDB{}
+			*tudb = testUserDB{}
+		})
+	}
+}
+
 func TestRatingService_Delete(t *testing.T) {
 	tudb := &testUserDB{}
 	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
@@ -551,6 +796,273 @@ func TestRatingService_Delete(t *testing.T) {
 	})
 }
 
+func TestRatingService_StatsByTarget(t *testing.T) {
+	rs := NewRatingService(nil, nil)
+
+	_, err := rs.StatsByTarget(0)
+	assert.Equal(t, ValidationError{"target": ErrInvalid}, err)
+
+	_, err = rs.StatsByTarget(-4)
+	assert.Equal(t, ValidationError{"target": ErrInvalid}, err)
+}
+
+func TestRatingService_DetailedStatsByTarget(t *testing.T) {
+	trdb := &testRatingDB{}
+	rs := NewRatingService(nil, nil)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	var cases = []struct {
+		name      string
+		target    int64
+		filter    StatsFilter
+		outerr    error
+		outfilter StatsFilter
+	}{
+		{"ok", 9, StatsFilter{Verified: true, From: 10, To: 20, Buckets: 8}, nil, StatsFilter{Verified: true, From: 10, To: 20, Buckets: 8}},
+		{"defaultBuckets", 9, StatsFilter{From: 10}, nil, StatsFilter{From: 10, Buckets: DefaultHistogramBuckets}},
+		{"targetInvalid", 0, StatsFilter{}, ValidationError{"target": ErrInvalid}, StatsFilter{}},
+		{"dateRange", 9, StatsFilter{From: 20, To: 10}, ValidationError{"to": ErrInvalid}, StatsFilter{}},
+		{"negativeDate", 9, StatsFilter{From: -1}, ValidationError{"to": ErrInvalid}, StatsFilter{}},
+		{"tooManyBuckets", 9, StatsFilter{Buckets: MaxHistogramBuckets + 1}, ValidationError{"buckets": ErrInvalid}, StatsFilter{}},
+		{"negativeBuckets", 9, StatsFilter{Buckets: -1, To: 5, From: 6}, ValidationError{"buckets": ErrInvalid, "to": ErrInvalid}, StatsFilter{}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			called := false
+			trdb.detailedStats = func(target int64, f StatsFilter) (RatingStats, error) {
+				called = true
+				assert.Equal(t, cs.target, target)
+				assert.Equal(t, cs.outfilter, f)
+				return RatingStats{Target: target}, nil
+			}
+
+			_, err := rs.DetailedStatsByTarget(cs.target, cs.filter)
+			assert.Equal(t, cs.outerr, err)
+			assert.Equal(t, cs.outerr == nil, called)
+		})
+	}
+}
+
+func TestRatingService_Cohorts(t *testing.T) {
+	trdb := &testRatingDB{}
+	rs := NewRatingService(nil, nil)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	_, err := rs.Cohorts("")
+	assert.Equal(t, ValidationError{"by": ErrRequired}, err)
+
+	_, err = rs.Cohorts("country")
+	assert.Equal(t, ValidationError{"by": ErrInvalid}, err)
+
+	trdb.cohorts = func(by string) ([]RatingCohort, error) {
+		assert.Equal(t, "signupMonth", by)
+		return []RatingCohort{}, nil
+	}
+	_, err = rs.Cohorts("signupMonth")
+	assert.NoError(t, err)
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	var cases = []struct {
+		name     string
+		min, max int
+		n        int
+		out      []HistogramBucket
+	}{
+		{"even", 1, 10, 5, []HistogramBucket{{Min: 1, Max: 2}, {Min: 3, Max: 4}, {Min: 5, Max: 6}, {Min: 7, Max: 8}, {Min: 9, Max: 10}}},
+		{"uneven", 1, 5, 2, []HistogramBucket{{Min: 1, Max: 3}, {Min: 4, Max: 5}}},
+		{"fewScores", 1, 3, 5, []HistogramBucket{{Min: 1, Max: 1}, {Min: 2, Max: 2}, {Min: 3, Max: 3}}},
+		{"single", 4, 4, 5, []HistogramBucket{{Min: 4, Max: 4}}},
+		{"negative", -5, 4, 2, []HistogramBucket{{Min: -5, Max: -1}, {Min: 0, Max: 4}}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			width := histogramWidth(cs.min, cs.max, cs.n)
+			buckets := histogramBuckets(cs.min, cs.max, width)
+			assert.Equal(t, cs.out, buckets)
+			assert.True(t, len(buckets) <= cs.n)
+		})
+	}
+}
+
+func TestRatingService_SetTags(t *testing.T) {
+	trdb := &testRatingDB{}
+	rs := NewRatingService(nil, nil)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	many := make([]string, maxTargetTags+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	var cases = []struct {
+		name    string
+		target  int64
+		tags    []string
+		outtags []string
+		outerr  error
+	}{
+		{"targetInvalid", 0, []string{"retail"}, nil, ValidationError{"target": ErrInvalid}},
+		{"emptyTag", 9, []string{"retail", " "}, nil, ValidationError{"tags": ErrRequired}},
+		{"tagTooLong", 9, []string{strings.Repeat("a", 65)}, nil, ValidationError{"tags": ErrTooLong}},
+		{"tooMany", 9, many, nil, ValidationError{"tags": ErrTooLong}},
+		{"normalised", 9, []string{" Retail", "north", "RETAIL"}, []string{"retail", "north"}, nil},
+		{"clear", 9, nil, []string{}, nil},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var called bool
+			trdb.setTags = func(target int64, tags []string) error {
+				called = true
+				assert.Equal(t, cs.target, target)
+				assert.Equal(t, cs.outtags, tags)
+				return nil
+			}
+
+			err := rs.SetTags(cs.target, cs.tags)
+			if cs.outerr != nil {
+				assert.Equal(t, cs.outerr, err)
+				assert.False(t, called)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, called)
+			}
+		})
+	}
+}
+
+func TestRatingValidator_setDate(t *testing.T) {
+	now := time.Date(2020, 3, 14, 10, 0, 0, 0, time.UTC)
+	rv := &ratingValidator{clock: FixedClock(now)}
+
+	r := Rating{Date: 1}
+	_, fn := rv.setDate()
+	require.NoError(t, fn(&r))
+	assert.Equal(t, now.Unix(), r.Date, "must date the rating with the clock")
+}
+
+func TestRatingService_Scoped(t *testing.T) {
+	rs := newRatingService(nil, nil, newVisibilityPolicy([]VisibilityRule{
+		{RoleID: 3, Targets: []int64{9}},
+	}), nil, probation{}, nil, nil, nil, nil, verification{})
+
+	assert.Equal(t, rs, rs.Scoped(&User{ID: 1, RoleID: 1}), "unrestricted roles must use the service itself")
+	assert.Equal(t, rs, rs.Scoped(&User{ID: 7, RoleID: 2}), "unrestricted roles must use the service itself")
+
+	scoped := rs.Scoped(&User{ID: 8, RoleID: 3})
+	assert.NotEqual(t, rs, scoped)
+	assert.NotNil(t, scoped.(*ratingService).RatingService.(*ratingValidator).RatingDB.(*ratingGorm).scope)
+	assert.Equal(t, scoped, scoped.Scoped(&User{ID: 8, RoleID: 3}), "a scoped service must not be scoped again")
+
+	org := int64(4)
+	scoped = rs.Scoped(&User{ID: 9, RoleID: 2, OrgID: &org})
+	assert.Equal(t, org, scoped.(*ratingService).org)
+	assert.NotNil(t, scoped.(*ratingService).RatingService.(*ratingValidator).RatingDB.(*ratingGorm).scope, "the users of an organisation must only read its ratings")
+	inOrg := rs.inOrganisation(org)
+	assert.Equal(t, inOrg, inOrg.Scoped(&User{ID: 9, RoleID: 2, OrgID: &org}), "the service of an organisation must not be scoped again for its users")
+
+	t.Run("gorm", func(t *testing.T) {
+		db := setupGorm(t)
+		require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 11, Active: true, Extra: json.RawMessage(`{}`), Score: 3, Target: 10, UserID: 1}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 12, Active: true, Extra: json.RawMessage(`{}`), Score: 7, Target: 11, UserID: 1}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 13, Active: true, Anonymous: true, Extra: json.RawMessage(`{}`), Score: 7, Target: 12, UserID: 98}).Error)
+
+		rs := newRatingService(db, nil, newVisibilityPolicy([]VisibilityRule{
+			{RoleID: 2, Targets: []int64{9}},
+			{RoleID: 2, TargetTags: []string{"retail"}},
+			{RoleID: 2, SQL: "anonymous"},
+		}), nil, probation{}, nil, nil, nil, nil, verification{})
+		require.NoError(t, rs.SetTags(10, []string{"Retail"}))
+		require.NoError(t, rs.SetTags(11, []string{"wholesale"}))
+
+		tags, err := rs.Tags(10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"retail"}, tags)
+
+		scoped := rs.Scoped(&User{ID: 98, RoleID: 2})
+		for _, target := range []int64{9, 10, 12} {
+			ratings, err := scoped.ByTarget(target)
+			require.NoError(t, err)
+			assert.Len(t, ratings, 1, "target %d must be visible", target)
+		}
+
+		ratings, err := scoped.ByTarget(11)
+		require.NoError(t, err)
+		assert.Empty(t, ratings)
+
+		ratings, err = scoped.Search(RatingQuery{Target: 11, Sort: "score"})
+		require.NoError(t, err)
+		assert.Empty(t, ratings)
+
+		_, err = scoped.ByID(12)
+		assert.Equal(t, ErrNotFound, err)
+		_, err = scoped.History(12)
+		assert.Equal(t, ErrNotFound, err)
+
+		stats, err := scoped.StatsByTarget(11)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), stats.Count)
+
+		r, err := rs.ByID(12)
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), r.Target, "the service itself must not be restricted")
+	})
+}
+
+func TestRatingService_Search(t *testing.T) {
+	trdb := &testRatingDB{}
+	rs := NewRatingService(nil, nil)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	score := func(v int) *int { return &v }
+
+	var cases = []struct {
+		name   string
+		query  RatingQuery
+		outerr error
+	}{
+		{"targetRequired", RatingQuery{}, ValidationError{"target": ErrRequired}},
+		{"targetInvalid", RatingQuery{Target: -1}, ValidationError{"target": ErrInvalid}},
+		{"scoreRange", RatingQuery{Target: 9, MinScore: score(5), MaxScore: score(2)}, ValidationError{"maxScore": ErrInvalid}},
+		{"dateRange", RatingQuery{Target: 9, From: 200, To: 100}, ValidationError{"to": ErrInvalid}},
+		{"dateNegative", RatingQuery{Target: 9, From: -1}, ValidationError{"to": ErrInvalid}},
+		{"sortInvalid", RatingQuery{Target: 9, Sort: "-comment"}, ValidationError{"sort": ErrInvalid}},
+		{"limitNegative", RatingQuery{Target: 9, Limit: -1}, ValidationError{"limit": ErrInvalid}},
+		{"afterNegative", RatingQuery{Target: 9, After: -1}, ValidationError{"after": ErrInvalid}},
+		{"afterSorted", RatingQuery{Target: 9, After: 10, Sort: "date"}, ValidationError{"after": ErrInvalid}},
+		{"ok", RatingQuery{Target: 9, MinScore: score(-2), MaxScore: score(-2), From: 100, Sort: "-date"}, nil},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var searched bool
+			trdb.search = func(q RatingQuery) ([]Rating, error) {
+				assert.Equal(t, cs.query, q)
+				searched = true
+				return nil, nil
+			}
+
+			_, err := rs.Search(cs.query)
+
+			if cs.outerr != nil {
+				assert.Error(t, err)
+				assert.True(t, xerrors.Is(err, cs.outerr),
+					"errors must match, expected %v, got %v", cs.outerr, err)
+				assert.False(t, searched)
+
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, searched)
+			}
+		})
+	}
+}
+
 func TestRatingGORM_Create(t *testing.T) {
 	var cases = []struct {
 		name   string
@@ -665,7 +1177,7 @@ func TestRatingGORM_Create(t *testing.T) {
 						FirstName: "Test",
 						LastName:  "User",
 						Password:  "TestPasswordHAsh",
-						Settings:  "Settings string here",
+						Settings:  json.RawMessage(`{"theme": "dark"}`),
 					},
 				).Error)
 
@@ -702,7 +1214,7 @@ func TestRatingGORM_Create(t *testing.T) {
 				cs.setup(t, db)
 			}
 
-			err := (&ratingGorm{db}).Create(cs.rating)
+			err := (&ratingGorm{db: db}).Create(cs.rating)
 
 			if cs.outerr != nil {
 				assert.Error(t, err)
@@ -772,6 +1284,22 @@ func TestRatingGORM_Update(t *testing.T) {
 				require.NoError(t, db.Create(&Rating{ID: 999, Active: false, Anonymous: false, Comment: "", Date: 0, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1}).Error)
 			},
 		},
+		{
+			"currentVersion",
+			&Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1, Version: 1},
+			nil,
+			func(t *testing.T, db *gorm.DB) {
+				require.NoError(t, db.Create(&Rating{ID: 999, Active: true, Anonymous: true, Comment: "", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1}).Error)
+			},
+		},
+		{
+			"staleVersion",
+			&Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1, Version: 1},
+			ErrConflict,
+			func(t *testing.T, db *gorm.DB) {
+				require.NoError(t, db.Create(&Rating{ID: 999, Active: true, Anonymous: true, Comment: "", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1, Version: 3}).Error)
+			},
+		},
 		{
 			"internalError",
 			&Rating{ID: 999, Active: true, Anonymous: true, Comment: "", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1},
@@ -790,7 +1318,7 @@ func TestRatingGORM_Update(t *testing.T) {
 				cs.setup(t, db)
 			}
 
-			err := (&ratingGorm{db}).Update(cs.rating)
+			err := (&ratingGorm{db: db}).Update(cs.rating)
 
 			if cs.outerr != nil {
 				assert.Error(t, err)
@@ -805,6 +1333,13 @@ func TestRatingGORM_Update(t *testing.T) {
 				var urating Rating
 				require.NoError(t, db.First(&urating, cs.rating.ID).Error)
 				assert.Equal(t, cs.rating, &urating)
+				assert.Equal(t, int64(2), urating.Version, "must increment the version")
+				require.NotNil(t, cs.rating.CreatedAt, "must read back the creation time")
+				assert.False(t, cs.rating.UpdatedAt.Before(*cs.rating.CreatedAt))
+
+				var revisions []RatingRevision
+				require.NoError(t, db.Where("rating_id = ?", cs.rating.ID).Find(&revisions).Error)
+				assert.Len(t, revisions, 1, "must record the previous values as a revision")
 			}
 		})
 	}
@@ -825,12 +1360,34 @@ func TestRatingGORM_Delete(t *testing.T) {
 				require.NoError(t, db.Create(&Rating{ID: 999, Active: true, Anonymous: true, Comment: "", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1}).Error)
 			},
 		},
+		{
+			"version",
+			&Rating{ID: 999, Version: 1},
+			nil,
+			func(t *testing.T, db *gorm.DB) {
+				require.NoError(t, db.Create(&Rating{ID: 999, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1}).Error)
+			},
+		},
+		{
+			"versionConflict",
+			&Rating{ID: 999, Version: 2},
+			ErrConflict,
+			func(t *testing.T, db *gorm.DB) {
+				require.NoError(t, db.Create(&Rating{ID: 999, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1}).Error)
+			},
+		},
 		{
 			"notFound",
 			&Rating{ID: 999},
 			ErrNotFound,
 			nil,
 		},
+		{
+			"versionNotFound",
+			&Rating{ID: 999, Version: 1},
+			ErrNotFound,
+			nil,
+		},
 		{
 			"internalError",
 			&Rating{ID: 999},
@@ -849,7 +1406,12 @@ func TestRatingGORM_Delete(t *testing.T) {
 				cs.setup(t, db)
 			}
 
-			err := (&ratingGorm{db}).Delete(cs.rating)
+			err := (&ratingGorm{db: db}).Delete(cs.rating)
+			if cs.outerr == ErrConflict {
+				var ct int64
+				require.NoError(t, db.Model(&Rating{}).Where("id = ?", cs.rating.ID).Count(&ct).Error)
+				assert.Equal(t, int64(1), ct, "must keep the rating of another version")
+			}
 
 			if cs.outerr != nil {
 				assert.Error(t, err)
@@ -878,7 +1440,7 @@ func TestRatingGORM_ByID(t *testing.T) {
 		{
 			"ok",
 			999,
-			&Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1},
+			&Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1, Version: 1},
 			nil,
 			true,
 			func(t *testing.T, db *gorm.DB) {
@@ -923,7 +1485,7 @@ func TestRatingGORM_ByID(t *testing.T) {
 				cs.setup(t, db)
 			}
 
-			r, err := (&ratingGorm{db}).ByID(cs.queryID)
+			r, err := (&ratingGorm{db: db}).ByID(cs.queryID)
 
 			if cs.outerr != nil {
 				assert.Error(t, err)
@@ -958,7 +1520,7 @@ func TestRatingGORM_ByTarget(t *testing.T) {
 			"ok",
 			6345,
 			&[]Rating{
-				Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1},
+				Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1, Version: 1},
 			},
 			nil,
 			func(t *testing.T, db *gorm.DB) {
@@ -969,7 +1531,7 @@ func TestRatingGORM_ByTarget(t *testing.T) {
 			"getOne",
 			6345,
 			&[]Rating{
-				Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1},
+				Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1, Version: 1},
 			},
 			nil,
 			func(t *testing.T, db *gorm.DB) {
@@ -981,8 +1543,8 @@ func TestRatingGORM_ByTarget(t *testing.T) {
 			"getMultiple",
 			6345,
 			&[]Rating{
-				Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1},
-				Rating{ID: 888, Active: true, Anonymous: true, Comment: "Awesome too", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 99},
+				Rating{ID: 999, Active: true, Anonymous: true, Comment: "Awesome", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 1, Version: 1},
+				Rating{ID: 888, Active: true, Anonymous: true, Comment: "Awesome too", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 10, Target: 6345, UserID: 99, Version: 1},
 			},
 			nil,
 			func(t *testing.T, db *gorm.DB) {
@@ -1027,7 +1589,7 @@ func TestRatingGORM_ByTarget(t *testing.T) {
 				cs.setup(t, db)
 			}
 
-			r, err := (&ratingGorm{db}).ByTarget(cs.queryID)
+			r, err := (&ratingGorm{db: db}).ByTarget(cs.queryID)
 
 			if cs.outerr != nil {
 				assert.Error(t, err)
@@ -1044,3 +1606,262 @@ func TestRatingGORM_ByTarget(t *testing.T) {
 		})
 	}
 }
+
+func TestRatingGORM_StatsByTarget(t *testing.T) {
+	db := setupGorm(t)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 6345, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: -2, Target: 6345, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{Active: false, Extra: json.RawMessage(`{}`), Score: 9, Target: 6345, UserID: 99}).Error)
+
+	stats, err := (&ratingGorm{db: db}).StatsByTarget(6345)
+	assert.NoError(t, err)
+	assert.Equal(t, RatingStats{Target: 6345, Count: 2, Average: 1.5, Min: -2, Max: 5, WeightedAverage: 1.5}, stats)
+
+	t.Run("weighted", func(t *testing.T) {
+		require.NoError(t, db.Create(&Reputation{UserID: 1, Points: 99, Weight: 3}).Error)
+		defer db.Delete(&Reputation{UserID: 1})
+
+		stats, err := (&ratingGorm{db: db}).StatsByTarget(6345)
+		assert.NoError(t, err)
+		assert.Equal(t, 3.25, stats.WeightedAverage)
+		assert.Equal(t, 1.5, stats.Average)
+	})
+
+	stats, err = (&ratingGorm{db: db}).StatsByTarget(8974)
+	assert.NoError(t, err)
+	assert.Equal(t, RatingStats{Target: 8974}, stats)
+
+	t.Run("internalError", func(t *testing.T) {
+		dropRatingsTable(db)
+
+		_, err := (&ratingGorm{db: db}).StatsByTarget(6345)
+		assert.Error(t, err)
+	})
+}
+
+func TestRatingGORM_DetailedStatsByTarget(t *testing.T) {
+	db := setupGorm(t)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Date: 100, Extra: json.RawMessage(`{}`), Score: 1, Target: 6345, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 11, Active: true, Date: 200, Extra: json.RawMessage(`{}`), Score: 4, Target: 6345, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 12, Active: true, Date: 300, Extra: json.RawMessage(`{}`), Score: 5, Target: 6345, UserID: 99}).Error)
+	rg := &ratingGorm{db: db}
+
+	stats, err := rg.DetailedStatsByTarget(6345, StatsFilter{Buckets: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Count)
+	assert.Equal(t, &ScorePercentiles{P25: 2.5, P50: 4, P75: 4.5}, stats.Percentiles)
+	assert.Equal(t, []HistogramBucket{{Min: 1, Max: 3, Count: 1}, {Min: 4, Max: 5, Count: 2}}, stats.Histogram)
+
+	t.Run("dates", func(t *testing.T) {
+		stats, err := rg.DetailedStatsByTarget(6345, StatsFilter{From: 150, To: 250, Buckets: 5})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Count)
+		assert.Equal(t, &ScorePercentiles{P25: 4, P50: 4, P75: 4}, stats.Percentiles)
+		assert.Equal(t, []HistogramBucket{{Min: 4, Max: 4, Count: 1}}, stats.Histogram)
+	})
+
+	t.Run("verified", func(t *testing.T) {
+		require.NoError(t, db.Exec(`INSERT INTO rating_moderations (rating_id, user_id, outcome, moderator_id) VALUES (10, 1, 'approved', 1), (11, 98, 'removed', 1)`).Error)
+
+		stats, err := rg.DetailedStatsByTarget(6345, StatsFilter{Verified: true, Buckets: 5})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Count)
+		assert.Equal(t, 1.0, stats.Average)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		stats, err := rg.DetailedStatsByTarget(8974, StatsFilter{Buckets: 5})
+		require.NoError(t, err)
+		assert.Equal(t, RatingStats{Target: 8974, Percentiles: &ScorePercentiles{}}, stats)
+	})
+}
+
+func TestRatingGORM_Cohorts(t *testing.T) {
+	db := setupGorm(t)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Exec("UPDATE users SET created_at = '2020-03-14T10:00:00Z' WHERE id IN (1, 98)").Error)
+	require.NoError(t, db.Exec("UPDATE users SET created_at = '2020-04-02T10:00:00Z' WHERE id = 99").Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 6345, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 6346, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 6345, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 6345, UserID: 99}).Error)
+	require.NoError(t, db.Create(&Rating{Active: false, Extra: json.RawMessage(`{}`), Score: 9, Target: 6346, UserID: 99}).Error)
+
+	cohorts, err := (&ratingGorm{db: db}).Cohorts("signupMonth")
+	require.NoError(t, err)
+	assert.Equal(t, []RatingCohort{
+		{Cohort: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), Users: 2, Count: 3, Average: 3},
+		{Cohort: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), Users: 1, Count: 1, Average: 4},
+	}, cohorts)
+
+	cohorts, err = (&ratingGorm{db: db}).Cohorts("signupYear")
+	require.NoError(t, err)
+	assert.Equal(t, []RatingCohort{{Cohort: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Users: 3, Count: 4, Average: 3.25}}, cohorts)
+}
+
+func TestRatingGORM_Search(t *testing.T) {
+	t.Run("internalError", func(t *testing.T) {
+		db := setupGorm(t)
+		dropRatingsTable(db)
+
+		_, err := (&ratingGorm{db: db}).Search(RatingQuery{Target: 6345})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		db := setupGorm(t)
+		require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+		require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh"}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Anonymous: true, Date: 1000, Extra: json.RawMessage(`{}`), Score: 5, Target: 6345, UserID: 1}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 11, Active: false, Anonymous: true, Date: 3000, Extra: json.RawMessage(`{}`), Score: -3, Target: 6345, UserID: 98}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 12, Active: true, Anonymous: false, Date: 2000, Extra: json.RawMessage(`{}`), Score: 9, Target: 6345, UserID: 99}).Error)
+		require.NoError(t, db.Create(&Rating{ID: 13, Active: true, Anonymous: true, Date: 2000, Extra: json.RawMessage(`{}`), Score: 9, Target: 8974, UserID: 1}).Error)
+
+		score := func(v int) *int { return &v }
+		flag := func(v bool) *bool { return &v }
+
+		var cases = []struct {
+			name  string
+			query RatingQuery
+			out   []int64
+		}{
+			{"target", RatingQuery{Target: 6345}, []int64{10, 11, 12}},
+			{"minScore", RatingQuery{Target: 6345, MinScore: score(5)}, []int64{10, 12}},
+			{"maxScore", RatingQuery{Target: 6345, MaxScore: score(5)}, []int64{10, 11}},
+			{"dateRange", RatingQuery{Target: 6345, From: 1500, To: 3000}, []int64{11, 12}},
+			{"active", RatingQuery{Target: 6345, Active: flag(false)}, []int64{11}},
+			{"anonymous", RatingQuery{Target: 6345, Anonymous: flag(true), Active: flag(true)}, []int64{10}},
+			{"sortDate", RatingQuery{Target: 6345, Sort: "date"}, []int64{10, 12, 11}},
+			{"sortScoreDesc", RatingQuery{Target: 6345, Sort: "-score"}, []int64{12, 10, 11}},
+			{"limit", RatingQuery{Target: 6345, Sort: "-date", Limit: 2}, []int64{11, 12}},
+			{"page", RatingQuery{Target: 6345, After: 10, Limit: 1}, []int64{11}},
+		}
+
+		for _, cs := range cases {
+			t.Run(cs.name, func(t *testing.T) {
+				ratings, err := (&ratingGorm{db: db}).Search(cs.query)
+				assert.NoError(t, err)
+
+				var ids []int64
+				for _, r := range ratings {
+					ids = append(ids, r.ID)
+				}
+				assert.Equal(t, cs.out, ids)
+			})
+		}
+	})
+}
+
+func TestRatingGORM_Authors(t *testing.T) {
+	db := setupGorm(t)
+	for _, u := range []User{
+		{ID: 97, RoleID: 2, Email: "active@test.com", FirstName: "Active", Password: "TestPasswordHAsh", Active: true},
+		{ID: 98, RoleID: 2, Email: "inactive@test.com", FirstName: "Inactive", Password: "TestPasswordHAsh"},
+		{ID: 99, RoleID: 2, Email: "anonymised@test.com", FirstName: "Anonymised", Password: "TestPasswordHAsh", Active: true},
+	} {
+		require.NoError(t, db.Create(&u).Error)
+	}
+	for i, uid := range []int64{97, 98, 99} {
+		require.NoError(t, db.Create(&Rating{ID: int64(10 + i), Active: true, Extra: json.RawMessage(`{}`), Score: 3, Target: 6345, UserID: uid}).Error)
+	}
+
+	require.NoError(t, (&userGorm{db: db}).anonymise(99))
+	require.NoError(t, (&userGorm{db: db}).SetActive(99, true))
+
+	authors, err := (&ratingGorm{db: db}).Authors(10, 11, 12, 404)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []RatingAuthor{
+		{RatingID: 10, UserID: 97},
+		{RatingID: 11, UserID: 98, Deleted: true},
+		{RatingID: 12, UserID: 99, Deleted: true},
+	}, authors, "must tell the inactive and anonymised authors are deleted")
+
+	authors, err = (&ratingGorm{db: db}).Authors()
+	require.NoError(t, err)
+	assert.Empty(t, authors)
+}
+
+func TestRatingGORM_History(t *testing.T) {
+	var cases = []struct {
+		name      string
+		queryID   int64
+		revisions []RatingRevision
+		outerr    error
+		setup     func(t *testing.T, db *gorm.DB)
+	}{
+		{
+			"ok",
+			999,
+			[]RatingRevision{
+				RatingRevision{RatingID: 999, Active: true, Anonymous: true, Comment: "First", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 3, Target: 6345, UserID: 1},
+				RatingRevision{RatingID: 999, Active: true, Anonymous: true, Comment: "Second", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 7, Target: 6345, UserID: 1},
+			},
+			nil,
+			func(t *testing.T, db *gorm.DB) {
+				require.NoError(t, db.Create(&Rating{ID: 999, Active: true, Anonymous: true, Comment: "First", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 3, Target: 6345, UserID: 1}).Error)
+				require.NoError(t, (&ratingGorm{db: db}).Update(&Rating{ID: 999, Active: true, Anonymous: true, Comment: "Second", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 7, Target: 6345, UserID: 1}))
+				require.NoError(t, (&ratingGorm{db: db}).Update(&Rating{ID: 999, Active: true, Anonymous: true, Comment: "Third", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 9, Target: 6345, UserID: 1}))
+			},
+		},
+		{
+			"noRevisions",
+			999,
+			nil,
+			nil,
+			func(t *testing.T, db *gorm.DB) {
+				require.NoError(t, db.Create(&Rating{ID: 999, Active: true, Anonymous: true, Comment: "First", Date: 1257894000000, Extra: json.RawMessage(`{}`), Score: 3, Target: 6345, UserID: 1}).Error)
+			},
+		},
+		{
+			"notFound",
+			999,
+			nil,
+			ErrNotFound,
+			nil,
+		},
+		{
+			"internalError",
+			999,
+			nil,
+			privateError("any internal private error"),
+			func(t *testing.T, db *gorm.DB) {
+				dropRatingsTable(db)
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			db := setupGorm(t)
+
+			if cs.setup != nil {
+				cs.setup(t, db)
+			}
+
+			revs, err := (&ratingGorm{db: db}).History(cs.queryID)
+
+			if cs.outerr != nil {
+				assert.Error(t, err)
+				if _, ok := cs.outerr.(PublicError); ok {
+					assert.True(t, xerrors.Is(err, cs.outerr))
+				}
+
+			} else {
+				assert.NoError(t, err)
+				require.Len(t, revs, len(cs.revisions))
+				for i := range revs {
+					assert.NotEqual(t, int64(0), revs[i].ID)
+					assert.NotEqual(t, int64(0), revs[i].RevisedAt)
+					assert.Equal(t, cs.revisions[i].Comment, revs[i].Comment)
+					assert.Equal(t, cs.revisions[i].Score, revs[i].Score)
+				}
+			}
+		})
+	}
+}
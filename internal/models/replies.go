@@ -0,0 +1,299 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/replies.go -pkg modelstest . ReplyService:ReplyService
+
+// ReplyService defines a set of methods to be used when dealing with the
+// replies to the ratings, and with the owners of the targets allowed to write
+// them.
+type ReplyService interface {
+	ReplyDB
+}
+
+// ReplyDB defines how the service interacts with the database.
+type ReplyDB interface {
+	// Create adds a reply to a rating. The RatingID, AuthorID and Body
+	// fields are required. The body is trimmed, and ID, CreatedAt and
+	// UpdatedAt are set. ErrNotFound is returned if the rating does not
+	// exist.
+	Create(*Reply) error
+
+	// Update replaces the body of the reply with ID r.ID to the rating
+	// r.RatingID, and sets r to the updated reply.
+	Update(r *Reply) error
+
+	// Delete removes the reply with ID id to the rating ratingID.
+	Delete(ratingID, id int64) error
+
+	// ByID retrieves the reply with ID id to the rating ratingID.
+	ByID(ratingID, id int64) (Reply, error)
+
+	// ByRating retrieves the replies to a rating, oldest first.
+	ByRating(ratingID int64) ([]Reply, error)
+
+	// Owners retrieves the IDs of the users owning a target, sorted.
+	Owners(target int64) ([]int64, error)
+
+	// SetOwners replaces the owners of a target. ErrRefNotFound is
+	// returned for the "owners" field if any of the users does not exist.
+	SetOwners(target int64, userIDs []int64) error
+}
+
+// maxReplyLength is the maximum length of the body of a reply, as the one of
+// the comment of a rating.
+const maxReplyLength = 512
+
+// maxTargetOwners is the maximum number of owners of a target.
+const maxTargetOwners = 100
+
+// A Reply is the answer of the owner of a target, or of an administrator, to a
+// rating of the target.
+type Reply struct {
+	ID       int64 `gorm:"primary_key;type:bigserial" json:"id"`
+	RatingID int64 `gorm:"type:bigint;not null" json:"ratingId"`
+
+	// AuthorID is the ID of the user who wrote the reply.
+	AuthorID int64  `gorm:"type:bigint;not null" json:"authorId"`
+	Body     string `gorm:"type:text;not null" json:"body"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updatedAt"`
+}
+
+// TargetOwner links a target with one of the users owning it.
+type TargetOwner struct {
+	Target int64 `gorm:"primary_key;type:bigint"`
+	UserID int64 `gorm:"primary_key;type:bigint"`
+}
+
+type replyService struct {
+	ReplyService
+}
+
+// NewReplyService instantiates a new ReplyService implementation with db as
+// the backing database.
+func NewReplyService(db *gorm.DB) ReplyService {
+	return newReplyService(db, SystemClock)
+}
+
+// newReplyService instantiates a new ReplyService implementation, as
+// NewReplyService does, dating the replies with clock.
+func newReplyService(db *gorm.DB, clock Clock) ReplyService {
+	return &replyService{
+		ReplyService: &replyValidator{
+			ReplyDB: &replyGorm{db: db, clock: clock},
+		},
+	}
+}
+
+type replyValidator struct {
+	ReplyDB
+}
+
+func (rv *replyValidator) Create(r *Reply) error {
+	r.ID = 0
+
+	if r.RatingID < 1 {
+		return ErrNotFound
+	}
+
+	err := rv.validate(r)
+	if err != nil {
+		return err
+	}
+
+	return rv.ReplyDB.Create(r)
+}
+
+func (rv *replyValidator) Update(r *Reply) error {
+	if r.ID < 1 || r.RatingID < 1 {
+		return ErrNotFound
+	}
+
+	err := rv.validate(r)
+	if err != nil {
+		return err
+	}
+
+	return rv.ReplyDB.Update(r)
+}
+
+// validate checks the fields of r, normalising them.
+func (rv *replyValidator) validate(r *Reply) error {
+	ve := ValidationError{}
+
+	r.Body = strings.TrimSpace(r.Body)
+	if r.Body == "" {
+		ve["body"] = ErrRequired
+	} else if len(r.Body) > maxReplyLength {
+		ve["body"] = ErrTooLong
+	}
+
+	if r.AuthorID < 1 {
+		ve["authorId"] = ErrRequired
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return nil
+}
+
+func (rv *replyValidator) Delete(ratingID, id int64) error {
+	if ratingID < 1 || id < 1 {
+		return ErrNotFound
+	}
+
+	return rv.ReplyDB.Delete(ratingID, id)
+}
+
+func (rv *replyValidator) ByID(ratingID, id int64) (Reply, error) {
+	if ratingID < 1 || id < 1 {
+		return Reply{}, ErrNotFound
+	}
+
+	return rv.ReplyDB.ByID(ratingID, id)
+}
+
+func (rv *replyValidator) Owners(target int64) ([]int64, error) {
+	if target < 1 {
+		return nil, ValidationError{"target": ErrInvalid}
+	}
+
+	return rv.ReplyDB.Owners(target)
+}
+
+func (rv *replyValidator) SetOwners(target int64, userIDs []int64) error {
+	if target < 1 {
+		return ValidationError{"target": ErrInvalid}
+	}
+
+	owners, err := normaliseIDs(userIDs)
+	if err != nil {
+		return ValidationError{"owners": ErrInvalid}
+	} else if len(owners) > maxTargetOwners {
+		return ValidationError{"owners": ErrTooLong}
+	}
+
+	return rv.ReplyDB.SetOwners(target, owners)
+}
+
+type replyGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (rg *replyGorm) Create(r *Reply) error {
+	var ct int
+	err := rg.db.Model(&Rating{}).Where("id = ?", r.RatingID).Count(&ct).Error
+	if err != nil {
+		return with(wrap("could not look up the rating of the reply", err), "rating_id", r.RatingID)
+	} else if ct == 0 {
+		return ErrNotFound
+	}
+
+	r.CreatedAt = rg.clock.Now()
+	r.UpdatedAt = r.CreatedAt
+	err = rg.db.Create(r).Error
+	if err != nil {
+		return with(wrap("could not create reply", err), "rating_id", r.RatingID)
+	}
+
+	return nil
+}
+
+func (rg *replyGorm) Update(r *Reply) error {
+	res := rg.db.Model(&Reply{}).Where("id = ? AND rating_id = ?", r.ID, r.RatingID).Updates(map[string]interface{}{
+		"body":       r.Body,
+		"updated_at": rg.clock.Now(),
+	})
+	if res.Error != nil {
+		return with(wrap("could not update reply", res.Error), "reply_id", r.ID)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	var err error
+	*r, err = rg.ByID(r.RatingID, r.ID)
+	return err
+}
+
+func (rg *replyGorm) Delete(ratingID, id int64) error {
+	res := rg.db.Where("rating_id = ?", ratingID).Delete(&Reply{}, id)
+	if res.Error != nil {
+		return with(wrap("could not delete reply", res.Error), "reply_id", id)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (rg *replyGorm) ByID(ratingID, id int64) (Reply, error) {
+	var r Reply
+	err := rg.db.Where("rating_id = ?", ratingID).First(&r, id).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return Reply{}, ErrNotFound
+		}
+		return Reply{}, with(wrap("could not get reply by ID", err), "reply_id", id)
+	}
+
+	return r, nil
+}
+
+func (rg *replyGorm) ByRating(ratingID int64) ([]Reply, error) {
+	replies := []Reply{}
+	err := rg.db.Where("rating_id = ?", ratingID).Order("id").Find(&replies).Error
+	if err != nil {
+		return nil, with(wrap("could not list the replies of the rating", err), "rating_id", ratingID)
+	}
+
+	return replies, nil
+}
+
+func (rg *replyGorm) Owners(target int64) ([]int64, error) {
+	owners := []int64{}
+	err := rg.db.Model(&TargetOwner{}).Where("target = ?", target).Order("user_id").Pluck("user_id", &owners).Error
+	if err != nil {
+		return nil, with(wrap("could not list the owners of the target", err), "target", target)
+	}
+
+	return owners, nil
+}
+
+func (rg *replyGorm) SetOwners(target int64, userIDs []int64) error {
+	return gormTransaction(rg.db, func(tx *gorm.DB) error {
+		if len(userIDs) > 0 {
+			var ct int
+			err := tx.Model(&User{}).Where("id IN (?)", userIDs).Count(&ct).Error
+			if err != nil {
+				return wrap("could not look up the owners of the target", err)
+			} else if ct != len(userIDs) {
+				return ValidationError{"owners": ErrRefNotFound}
+			}
+		}
+
+		err := tx.Where("target = ?", target).Delete(&TargetOwner{}).Error
+		if err != nil {
+			return wrap("could not remove the owners of the target", err)
+		}
+
+		for _, id := range userIDs {
+			err = tx.Create(&TargetOwner{Target: target, UserID: id}).Error
+			if err != nil {
+				return wrap("could not add an owner of the target", err)
+			}
+		}
+
+		return nil
+	})
+}
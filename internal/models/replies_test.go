@@ -0,0 +1,128 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type testReplyDB struct {
+	ReplyDB
+	create    func(*Reply) error
+	setOwners func(int64, []int64) error
+}
+
+func (t *testReplyDB) Create(r *Reply) error {
+	if t.create != nil {
+		return t.create(r)
+	}
+
+	return nil
+}
+
+func (t *testReplyDB) SetOwners(target int64, userIDs []int64) error {
+	if t.setOwners != nil {
+		return t.setOwners(target, userIDs)
+	}
+
+	return nil
+}
+
+func TestReplyValidator(t *testing.T) {
+	trdb := &testReplyDB{}
+	rs := NewReplyService(nil)
+	rs.(*replyService).ReplyService.(*replyValidator).ReplyDB = trdb
+
+	var cases = []struct {
+		name   string
+		change func(*Reply)
+		outerr error
+	}{
+		{"ok", func(r *Reply) {}, nil},
+		{"ratingNotFound", func(r *Reply) { r.RatingID = 0 }, ErrNotFound},
+		{"bodyRequired", func(r *Reply) { r.Body = "  " }, ValidationError{"body": ErrRequired}},
+		{"bodyTooLong", func(r *Reply) { r.Body = strings.Repeat("a", maxReplyLength+1) }, ValidationError{"body": ErrTooLong}},
+		{"authorRequired", func(r *Reply) { r.AuthorID = 0 }, ValidationError{"authorId": ErrRequired}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Reply{ID: 55, RatingID: 10, AuthorID: 1, Body: " Thanks! "}
+			tc.change(r)
+
+			err := rs.Create(r)
+			assert.Equal(t, tc.outerr, err)
+			if tc.outerr == nil {
+				assert.Equal(t, int64(0), r.ID, "must not use the ID provided")
+				assert.Equal(t, "Thanks!", r.Body)
+			}
+		})
+	}
+
+	t.Run("updateNotFound", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, rs.Update(&Reply{RatingID: 10, AuthorID: 1, Body: "Thanks!"}))
+	})
+
+	t.Run("setOwners", func(t *testing.T) {
+		trdb.setOwners = func(target int64, userIDs []int64) error {
+			assert.Equal(t, int64(9), target)
+			assert.Equal(t, []int64{3, 7}, userIDs)
+			return nil
+		}
+		assert.NoError(t, rs.SetOwners(9, []int64{7, 3, 7}))
+		assert.Equal(t, ValidationError{"owners": ErrInvalid}, rs.SetOwners(9, []int64{0}))
+		assert.Equal(t, ValidationError{"target": ErrInvalid}, rs.SetOwners(-9, nil))
+	})
+}
+
+func TestReplyGorm(t *testing.T) {
+	db := setupGorm(t)
+	rs := NewReplyService(db)
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1}).Error)
+
+	t.Run("ratingNotFound", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, rs.Create(&Reply{RatingID: 404, AuthorID: 98, Body: "Thanks!"}))
+	})
+
+	r := Reply{RatingID: 10, AuthorID: 98, Body: "Thanks!"}
+	require.NoError(t, rs.Create(&r))
+	assert.NotZero(t, r.ID)
+	assert.False(t, r.CreatedAt.IsZero())
+
+	r.Body = "Thanks a lot!"
+	require.NoError(t, rs.Update(&r))
+	assert.Equal(t, "Thanks a lot!", r.Body)
+
+	other := Reply{ID: r.ID, RatingID: 11, AuthorID: 98, Body: "Wrong rating"}
+	assert.True(t, xerrors.Is(rs.Update(&other), ErrNotFound), "must not update the replies of other ratings")
+
+	replies, err := rs.ByRating(10)
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, "Thanks a lot!", replies[0].Body)
+
+	t.Run("owners", func(t *testing.T) {
+		assert.Equal(t, ValidationError{"owners": ErrRefNotFound}, rs.SetOwners(9, []int64{98, 404}))
+		require.NoError(t, rs.SetOwners(9, []int64{98, 1}))
+
+		owners, err := rs.Owners(9)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 98}, owners)
+
+		require.NoError(t, rs.SetOwners(9, nil))
+		owners, err = rs.Owners(9)
+		require.NoError(t, err)
+		assert.Empty(t, owners)
+	})
+
+	require.NoError(t, rs.Delete(10, r.ID))
+	_, err = rs.ByID(10, r.ID)
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+	assert.True(t, xerrors.Is(rs.Delete(10, r.ID), ErrNotFound))
+}
@@ -0,0 +1,413 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/noelruault/ratingsapp/internal/events"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/reputation.go -pkg modelstest . ReputationService:ReputationService
+
+// ReputationService defines a set of methods used to rate the reviewers
+// themselves: users react to the ratings of others as helpful or not,
+// administrators moderate ratings, and both outcomes are summarised in the
+// Reputation of each author.
+type ReputationService interface {
+	ReputationDB
+}
+
+// ReputationDB defines how the service interacts with the database.
+type ReputationDB interface {
+	// ByUser retrieves the reputation of a user as of its last
+	// computation. Users whose reputation was never computed get zero
+	// counters and a Weight of 1.
+	//
+	// ErrNotFound is returned if the user does not exist.
+	ByUser(userID int64) (Reputation, error)
+
+	// React records the reaction of x.UserID to a rating, replacing any
+	// previous one. ErrNotFound is returned if the rating does not exist,
+	// and ErrOwnRating if it belongs to the user.
+	React(x *Reaction) error
+
+	// Unreact removes the reaction of a user to a rating. ErrNotFound is
+	// returned if there is none.
+	Unreact(ratingID, userID int64) error
+
+	// Moderate records the outcome of the moderation of a rating,
+	// replacing any previous one. Ratings removed are deactivated, but
+	// approving a rating does not activate it again. m.UserID and
+	// m.DecidedAt are set by the service.
+	//
+	// ErrNotFound is returned if the rating does not exist.
+	Moderate(m *Moderation) error
+
+	// Held retrieves the moderation queue: the active ratings held back
+	// from the aggregates until they are approved, because their authors'
+	// accounts are new. Oldest first. See Config.NewAccountPeriod.
+	Held() ([]Rating, error)
+
+	// Recompute updates the reputation of every user from their active
+	// ratings, the reactions to them and their moderation outcomes.
+	Recompute() error
+}
+
+// Moderation outcomes, as used in Moderation.Outcome.
+const (
+	ModerationApproved = "approved"
+	ModerationRemoved  = "removed"
+)
+
+// Badges awarded with the reputation, as listed in Reputation.Badges.
+const (
+	// BadgeProlific is awarded for 50 or more active ratings.
+	BadgeProlific = "prolific"
+
+	// BadgeHelpful is awarded for 25 or more helpful reactions.
+	BadgeHelpful = "helpful"
+
+	// BadgeTrusted is awarded for 100 or more points without any rating
+	// removed by moderation.
+	BadgeTrusted = "trusted"
+)
+
+// Reputation points awarded for each counter of a Reputation. Points never go
+// below zero.
+const (
+	reputationRatingPoints    = 1
+	reputationHelpfulPoints   = 2
+	reputationUnhelpfulPoints = -1
+	reputationApprovedPoints  = 3
+	reputationRemovedPoints   = -10
+)
+
+// reputationWeightSQL is the weight of the score of a rating in the aggregates
+// weighted by reputation, see Reputation.Weight. It must be used in queries on
+// the ratings table.
+const reputationWeightSQL = "coalesce((SELECT weight FROM user_reputations WHERE user_reputations.user_id = ratings.user_id), 1)"
+
+// A Reaction tells whether a user found a rating helpful.
+type Reaction struct {
+	RatingID int64 `gorm:"primary_key;type:bigint" json:"ratingId"`
+	UserID   int64 `gorm:"primary_key;type:bigint" json:"userId"`
+
+	Helpful bool `gorm:"not null" json:"helpful"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// TableName is the name of the table holding the reactions.
+func (Reaction) TableName() string {
+	return "rating_reactions"
+}
+
+// A Moderation is the outcome of the review of a rating by a moderator.
+type Moderation struct {
+	RatingID int64 `gorm:"primary_key;type:bigint" json:"ratingId"`
+
+	// UserID is the author of the rating. Outcomes are kept when the
+	// rating is deleted, so they still count for its author.
+	UserID int64 `gorm:"type:bigint;not null" json:"userId"`
+
+	// Outcome is either ModerationApproved or ModerationRemoved.
+	Outcome string `gorm:"size:16;not null" json:"outcome"`
+
+	ModeratorID int64     `gorm:"type:bigint;not null" json:"moderatorId"`
+	DecidedAt   time.Time `gorm:"type:timestamptz;not null;default:now()" json:"decidedAt"`
+}
+
+// TableName is the name of the table holding the moderation outcomes.
+func (Moderation) TableName() string {
+	return "rating_moderations"
+}
+
+// Reputation summarises the standing of a user as a reviewer. It is computed
+// periodically, see ReputationDB.Recompute.
+type Reputation struct {
+	UserID int64 `gorm:"primary_key;type:bigint" json:"userId"`
+
+	// Points add up the counters below: each active rating is worth 1,
+	// each helpful reaction 2 and each approved rating 3, while each
+	// unhelpful reaction takes 1 away and each removed rating 10.
+	Points int64 `gorm:"type:bigint;not null" json:"points"`
+
+	// Weight is the weight of the scores of the user in the aggregates
+	// weighted by reputation, like RatingStats.WeightedAverage. It is
+	// 1 + log10(1 + Points), so it starts at 1 and grows slowly.
+	Weight float64 `gorm:"not null;default:1" json:"weight"`
+
+	Ratings   int64 `gorm:"type:bigint;not null" json:"ratings"`
+	Helpful   int64 `gorm:"type:bigint;not null" json:"helpful"`
+	Unhelpful int64 `gorm:"type:bigint;not null" json:"unhelpful"`
+	Approved  int64 `gorm:"type:bigint;not null" json:"approved"`
+	Removed   int64 `gorm:"type:bigint;not null" json:"removed"`
+
+	// Badges lists the badges earned, see BadgeProlific and the others.
+	Badges []string `gorm:"-" json:"badges"`
+
+	// ComputedAt is nil if the reputation was never computed.
+	ComputedAt *time.Time `gorm:"type:timestamptz" json:"computedAt,omitempty"`
+}
+
+// TableName is the name of the table holding the reputations.
+func (Reputation) TableName() string {
+	return "user_reputations"
+}
+
+// setBadges lists in r.Badges the badges earned with the counters of r.
+func (r *Reputation) setBadges() {
+	r.Badges = []string{}
+
+	if r.Ratings >= 50 {
+		r.Badges = append(r.Badges, BadgeProlific)
+	}
+	if r.Helpful >= 25 {
+		r.Badges = append(r.Badges, BadgeHelpful)
+	}
+	if r.Points >= 100 && r.Removed == 0 {
+		r.Badges = append(r.Badges, BadgeTrusted)
+	}
+}
+
+type reputationService struct {
+	ReputationService
+}
+
+// NewReputationService instantiates a new ReputationService implementation with
+// db as the backing database.
+func NewReputationService(db *gorm.DB) ReputationService {
+	return newReputationService(db, probation{}, nil, nil)
+}
+
+// newReputationService instantiates a new ReputationService implementation that
+// queues the ratings of the accounts on probation for moderation, and calls
+// onModerated with the ratings moderated. The events of the ratings moderated
+// are written to ob. onModerated and ob may be nil.
+func newReputationService(db *gorm.DB, p probation, onModerated func(Rating), ob *outbox) ReputationService {
+	return &reputationService{
+		ReputationService: &reputationValidator{
+			ReputationDB: &reputationGorm{db: db, probation: p, onModerated: onModerated, outbox: ob},
+		},
+	}
+}
+
+type reputationValidator struct {
+	ReputationDB
+}
+
+func (rv *reputationValidator) React(x *Reaction) error {
+	if x.RatingID < 1 {
+		return ErrNotFound
+	}
+	if x.UserID < 1 {
+		return ValidationError{"userId": ErrRequired}
+	}
+
+	return rv.ReputationDB.React(x)
+}
+
+func (rv *reputationValidator) Unreact(ratingID, userID int64) error {
+	if ratingID < 1 || userID < 1 {
+		return ErrNotFound
+	}
+
+	return rv.ReputationDB.Unreact(ratingID, userID)
+}
+
+func (rv *reputationValidator) Moderate(m *Moderation) error {
+	if m.RatingID < 1 {
+		return ErrNotFound
+	}
+
+	switch m.Outcome {
+	case ModerationApproved, ModerationRemoved:
+	case "":
+		return ValidationError{"outcome": ErrRequired}
+	default:
+		return ValidationError{"outcome": ErrInvalid}
+	}
+
+	if m.ModeratorID < 1 {
+		return ValidationError{"moderatorId": ErrRequired}
+	}
+
+	return rv.ReputationDB.Moderate(m)
+}
+
+type reputationGorm struct {
+	db          *gorm.DB
+	probation   probation
+	onModerated func(Rating)
+	outbox      *outbox
+}
+
+func (rg *reputationGorm) ByUser(userID int64) (Reputation, error) {
+	var rep Reputation
+	err := rg.db.Where("user_id = ?", userID).First(&rep).Error
+	if err != nil {
+		if !xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return Reputation{}, with(wrap("could not get reputation", err), "user_id", userID)
+		}
+
+		var ct int64
+		err = rg.db.Model(&User{}).Where("id = ?", userID).Count(&ct).Error
+		if err != nil {
+			return Reputation{}, with(wrap("could not look up user of reputation", err), "user_id", userID)
+		} else if ct == 0 {
+			return Reputation{}, ErrNotFound
+		}
+
+		rep = Reputation{UserID: userID, Weight: 1}
+	}
+
+	rep.setBadges()
+	return rep, nil
+}
+
+func (rg *reputationGorm) React(x *Reaction) error {
+	var r Rating
+	err := rg.db.Select("id, user_id").First(&r, x.RatingID).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+
+		return with(wrap("could not get rating to react to", err), "rating_id", x.RatingID)
+	}
+
+	if r.UserID == x.UserID {
+		return ErrOwnRating
+	}
+
+	x.CreatedAt = rg.probation.now()
+	err = rg.db.Exec(`INSERT INTO rating_reactions (rating_id, user_id, helpful, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (rating_id, user_id) DO UPDATE SET helpful = EXCLUDED.helpful, created_at = EXCLUDED.created_at`,
+		x.RatingID, x.UserID, x.Helpful, x.CreatedAt).Error
+	if err != nil {
+		// the rating or the user were deleted in the meantime
+		if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ErrNotFound
+		}
+
+		return with(wrap("could not save reaction", err), "rating_id", x.RatingID)
+	}
+
+	return nil
+}
+
+func (rg *reputationGorm) Unreact(ratingID, userID int64) error {
+	res := rg.db.Where("rating_id = ? AND user_id = ?", ratingID, userID).Delete(&Reaction{})
+	if res.Error != nil {
+		return with(wrap("could not delete reaction", res.Error), "rating_id", ratingID)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (rg *reputationGorm) Moderate(m *Moderation) error {
+	var r Rating
+
+	err := gormTransaction(rg.db, func(tx *gorm.DB) error {
+		err := tx.Set("gorm:query_option", "FOR UPDATE").First(&r, m.RatingID).Error
+		if err != nil {
+			if xerrors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+
+			return wrap("could not get rating to moderate", err)
+		}
+
+		m.UserID = r.UserID
+		m.DecidedAt = rg.probation.now()
+		err = tx.Exec(`INSERT INTO rating_moderations (rating_id, user_id, outcome, moderator_id, decided_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (rating_id) DO UPDATE SET outcome = EXCLUDED.outcome, moderator_id = EXCLUDED.moderator_id, decided_at = EXCLUDED.decided_at`,
+			m.RatingID, m.UserID, m.Outcome, m.ModeratorID, m.DecidedAt).Error
+		if err != nil {
+			return wrap("could not save moderation", err)
+		}
+
+		err = release(tx, r.ID)
+		if err != nil {
+			return err
+		}
+
+		if m.Outcome == ModerationRemoved && r.Active {
+			r.Active = false
+			r.Version = 0
+			err = reviseRating(tx, &r, m.DecidedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		return rg.outbox.add(tx, events.Event{Type: events.RatingModerated, Data: r})
+	})
+	if err != nil {
+		if xerrors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		return with(err, "rating_id", m.RatingID)
+	}
+	rg.outbox.added(rg.db)
+
+	// removing or approving a rating may change the aggregates of its
+	// target
+	if rg.onModerated != nil {
+		rg.onModerated(r)
+	}
+
+	return nil
+}
+
+func (rg *reputationGorm) Held() ([]Rating, error) {
+	ratings := []Rating{}
+	err := rg.probation.held(rg.db).Order("id").Find(&ratings).Error
+	if err != nil {
+		return nil, wrap("could not list held ratings", err)
+	}
+
+	return ratings, nil
+}
+
+func (rg *reputationGorm) Recompute() error {
+	err := rg.db.Exec(`INSERT INTO user_reputations (user_id, points, weight, ratings, helpful, unhelpful, approved, removed, computed_at)
+		SELECT user_id, points, 1 + log(1 + points::double precision), ratings, helpful, unhelpful, approved, removed, now()
+		FROM (
+			SELECT *, greatest(ratings * ? + helpful * ? + unhelpful * ? + approved * ? + removed * ?, 0) AS points
+			FROM (
+				SELECT u.id AS user_id,
+					(SELECT count(*) FROM ratings r WHERE r.user_id = u.id AND r.active) AS ratings,
+					(SELECT count(*) FROM rating_reactions x JOIN ratings r ON r.id = x.rating_id WHERE r.user_id = u.id AND x.helpful) AS helpful,
+					(SELECT count(*) FROM rating_reactions x JOIN ratings r ON r.id = x.rating_id WHERE r.user_id = u.id AND NOT x.helpful) AS unhelpful,
+					(SELECT count(*) FROM rating_moderations m WHERE m.user_id = u.id AND m.outcome = 'approved') AS approved,
+					(SELECT count(*) FROM rating_moderations m WHERE m.user_id = u.id AND m.outcome = 'removed') AS removed
+				FROM users u
+			) counts
+		) scored
+		ON CONFLICT (user_id) DO UPDATE SET
+			points = EXCLUDED.points,
+			weight = EXCLUDED.weight,
+			ratings = EXCLUDED.ratings,
+			helpful = EXCLUDED.helpful,
+			unhelpful = EXCLUDED.unhelpful,
+			approved = EXCLUDED.approved,
+			removed = EXCLUDED.removed,
+			computed_at = EXCLUDED.computed_at`,
+		reputationRatingPoints,
+		reputationHelpfulPoints,
+		reputationUnhelpfulPoints,
+		reputationApprovedPoints,
+		reputationRemovedPoints,
+	).Error
+	if err != nil {
+		return wrap("could not recompute reputations", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestReputation_setBadges(t *testing.T) {
+	var cases = []struct {
+		name   string
+		rep    Reputation
+		badges []string
+	}{
+		{"none", Reputation{Ratings: 49, Helpful: 24, Points: 99}, []string{}},
+		{"prolific", Reputation{Ratings: 50, Points: 50}, []string{BadgeProlific}},
+		{"helpful", Reputation{Helpful: 25, Points: 50}, []string{BadgeHelpful}},
+		{"trusted", Reputation{Points: 100}, []string{BadgeTrusted}},
+		{"removedNotTrusted", Reputation{Points: 100, Removed: 1}, []string{}},
+		{"all", Reputation{Ratings: 60, Helpful: 30, Points: 120}, []string{BadgeProlific, BadgeHelpful, BadgeTrusted}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			cs.rep.setBadges()
+			assert.Equal(t, cs.badges, cs.rep.Badges)
+		})
+	}
+}
+
+type testReputationDB struct {
+	ReputationDB
+}
+
+func (t *testReputationDB) React(x *Reaction) error              { return nil }
+func (t *testReputationDB) Unreact(ratingID, userID int64) error { return nil }
+func (t *testReputationDB) Moderate(m *Moderation) error         { return nil }
+
+func (t *testReputationDB) Recompute() error { return nil }
+
+func TestReputationValidator(t *testing.T) {
+	rv := &reputationValidator{ReputationDB: &testReputationDB{}}
+
+	var cases = []struct {
+		name string
+		call func() error
+		err  error
+	}{
+		{"reactNoRating", func() error { return rv.React(&Reaction{UserID: 1}) }, ErrNotFound},
+		{"reactNoUser", func() error { return rv.React(&Reaction{RatingID: 1}) }, ValidationError{"userId": ErrRequired}},
+		{"react", func() error { return rv.React(&Reaction{RatingID: 1, UserID: 1}) }, nil},
+		{"unreactInvalid", func() error { return rv.Unreact(0, 1) }, ErrNotFound},
+		{"moderateNoRating", func() error { return rv.Moderate(&Moderation{Outcome: ModerationRemoved, ModeratorID: 1}) }, ErrNotFound},
+		{"moderateNoOutcome", func() error { return rv.Moderate(&Moderation{RatingID: 1, ModeratorID: 1}) }, ValidationError{"outcome": ErrRequired}},
+		{"moderateBadOutcome", func() error { return rv.Moderate(&Moderation{RatingID: 1, Outcome: "hidden", ModeratorID: 1}) }, ValidationError{"outcome": ErrInvalid}},
+		{"moderateNoModerator", func() error { return rv.Moderate(&Moderation{RatingID: 1, Outcome: ModerationApproved}) }, ValidationError{"moderatorId": ErrRequired}},
+		{"moderate", func() error {
+			return rv.Moderate(&Moderation{RatingID: 1, Outcome: ModerationApproved, ModeratorID: 1})
+		}, nil},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			assert.Equal(t, cs.err, cs.call())
+		})
+	}
+}
+
+func TestReputationGORM(t *testing.T) {
+	db := setupGorm(t)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 1, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 10, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 2, Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 11, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 3, Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 10, UserID: 99}).Error)
+
+	var moderated []Rating
+	rg := &reputationGorm{db: db, onModerated: func(r Rating) { moderated = append(moderated, r) }}
+
+	t.Run("neverComputed", func(t *testing.T) {
+		rep, err := rg.ByUser(98)
+		require.NoError(t, err)
+		assert.Equal(t, Reputation{UserID: 98, Weight: 1, Badges: []string{}}, rep)
+
+		_, err = rg.ByUser(404)
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("react", func(t *testing.T) {
+		require.NoError(t, rg.React(&Reaction{RatingID: 1, UserID: 99, Helpful: false}))
+		require.NoError(t, rg.React(&Reaction{RatingID: 1, UserID: 99, Helpful: true}), "must replace the reaction")
+		require.NoError(t, rg.React(&Reaction{RatingID: 2, UserID: 99, Helpful: true}))
+		require.NoError(t, rg.React(&Reaction{RatingID: 3, UserID: 98, Helpful: false}))
+
+		assert.Equal(t, ErrOwnRating, rg.React(&Reaction{RatingID: 1, UserID: 98, Helpful: true}))
+		assert.Equal(t, ErrNotFound, rg.React(&Reaction{RatingID: 404, UserID: 98, Helpful: true}))
+
+		require.NoError(t, rg.React(&Reaction{RatingID: 3, UserID: 1, Helpful: true}))
+		require.NoError(t, rg.Unreact(3, 1))
+		assert.Equal(t, ErrNotFound, rg.Unreact(3, 1))
+	})
+
+	t.Run("moderate", func(t *testing.T) {
+		m := Moderation{RatingID: 2, Outcome: ModerationApproved, ModeratorID: 1}
+		require.NoError(t, rg.Moderate(&m))
+		assert.Equal(t, int64(98), m.UserID)
+		require.Len(t, moderated, 1, "approved ratings may be counted again")
+		assert.Equal(t, int64(11), moderated[0].Target)
+
+		require.NoError(t, rg.Moderate(&Moderation{RatingID: 3, Outcome: ModerationRemoved, ModeratorID: 1}))
+		require.Len(t, moderated, 2)
+		assert.Equal(t, int64(10), moderated[1].Target)
+
+		var r Rating
+		require.NoError(t, db.First(&r, 3).Error)
+		assert.False(t, r.Active, "must deactivate removed ratings")
+		assert.Equal(t, int64(2), r.Version)
+
+		assert.Equal(t, ErrNotFound, rg.Moderate(&Moderation{RatingID: 404, Outcome: ModerationRemoved, ModeratorID: 1}))
+	})
+
+	t.Run("recompute", func(t *testing.T) {
+		require.NoError(t, rg.Recompute())
+		require.NoError(t, rg.Recompute(), "must update the existing reputations")
+
+		rep, err := rg.ByUser(98)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2+2*2+3), rep.Points)
+		assert.InDelta(t, 2, rep.Weight, 0.0001)
+		assert.Equal(t, []int64{2, 2, 0, 1, 0}, []int64{rep.Ratings, rep.Helpful, rep.Unhelpful, rep.Approved, rep.Removed})
+		assert.NotNil(t, rep.ComputedAt)
+
+		rep, err = rg.ByUser(99)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), rep.Points, "points must not be negative")
+		assert.Equal(t, 1.0, rep.Weight)
+		assert.Equal(t, []int64{0, 0, 1, 0, 1}, []int64{rep.Ratings, rep.Helpful, rep.Unhelpful, rep.Approved, rep.Removed})
+	})
+
+	t.Run("internalError", func(t *testing.T) {
+		db.Exec("DROP TABLE user_reputations")
+
+		err := rg.Recompute()
+		assert.Error(t, err)
+		assert.False(t, xerrors.Is(err, ErrNotFound))
+	})
+}
@@ -0,0 +1,270 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/retention.go -pkg modelstest . RetentionService:RetentionService
+
+// RetentionService defines a set of methods to be used when dealing with the
+// retention policy of the ratings, applied by Services.ApplyRetention.
+type RetentionService interface {
+	// Policy returns the retention policy of the ratings, the one of the
+	// tenant if it overrides the policy of the application.
+	Policy() RetentionPolicy
+
+	// Log retrieves the latest entries of the retention log, newest
+	// first.
+	Log() ([]RetentionEntry, error)
+}
+
+// What happens to the old ratings, see RetentionPolicy.Mode.
+const (
+	// RetentionScrub erases the comments of the ratings.
+	RetentionScrub = "scrub"
+
+	// RetentionAnonymise erases the comments and the extra data of the
+	// ratings, and makes them anonymous, as RatingsAnonymise does with
+	// the ratings of the users deleted. Their scores are kept.
+	RetentionAnonymise = "anonymise"
+
+	// RetentionKeep keeps the ratings as they are, for the tenants not
+	// following the policy of the application.
+	RetentionKeep = "keep"
+)
+
+// retentionBatch is the number of ratings changed at once by
+// Services.ApplyRetention.
+const retentionBatch = 500
+
+// maxRetentionEntries is the number of entries listed by RetentionService.Log.
+const maxRetentionEntries = 100
+
+// A RetentionPolicy sets what happens to the ratings once they are old. The
+// revisions of the ratings are changed the same way.
+type RetentionPolicy struct {
+	// Days is the number of days after which the ratings are changed,
+	// counted from their date, the last time they were submitted. The
+	// ratings are kept as they are if zero.
+	Days int `gorm:"not null;default:0" json:"days"`
+
+	// Mode is RetentionScrub, RetentionAnonymise or RetentionKeep. It
+	// defaults to RetentionScrub.
+	Mode string `gorm:"size:16;not null;default:''" json:"mode"`
+}
+
+// Enabled tells whether the policy changes the old ratings.
+func (p RetentionPolicy) Enabled() bool {
+	return p.Days > 0 && p.Mode != RetentionKeep
+}
+
+// override returns p with the fields set on o, like the policy of a tenant,
+// replaced.
+func (p RetentionPolicy) override(o RetentionPolicy) RetentionPolicy {
+	if o.Days > 0 {
+		p.Days = o.Days
+	}
+	if o.Mode != "" {
+		p.Mode = o.Mode
+	}
+
+	return p
+}
+
+// validate returns a ValidationError if the fields of p are not valid, whose
+// keys are prefixed with prefix.
+func (p RetentionPolicy) validate(prefix string) error {
+	ve := ValidationError{}
+	if p.Days < 0 {
+		ve[prefix+"days"] = ErrInvalid
+	}
+
+	switch p.Mode {
+	case "", RetentionScrub, RetentionAnonymise, RetentionKeep:
+	default:
+		ve[prefix+"mode"] = ErrInvalid
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return nil
+}
+
+// A RetentionEntry records a rating changed by the retention policy.
+type RetentionEntry struct {
+	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
+
+	RatingID int64 `gorm:"type:bigint;not null" json:"ratingId"`
+	UserID   int64 `gorm:"type:bigint;not null" json:"userId"`
+	Target   int64 `gorm:"type:bigint;not null" json:"target"`
+
+	// Mode and Days are the ones of the policy applied.
+	Mode string `gorm:"size:16;not null" json:"mode"`
+	Days int    `gorm:"not null" json:"days"`
+
+	ScrubbedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"scrubbedAt"`
+}
+
+// TableName is the name of the table holding the retention log.
+func (RetentionEntry) TableName() string {
+	return "retention_log"
+}
+
+// newRetentionService instantiates a new RetentionService implementation with db
+// as the backing database, and policy as the retention policy of its ratings.
+func newRetentionService(db *gorm.DB, policy RetentionPolicy) RetentionService {
+	return &retentionGorm{db: db, policy: policy}
+}
+
+type retentionGorm struct {
+	db     *gorm.DB
+	policy RetentionPolicy
+}
+
+func (rg *retentionGorm) Policy() RetentionPolicy {
+	return rg.policy
+}
+
+func (rg *retentionGorm) Log() ([]RetentionEntry, error) {
+	entries := []RetentionEntry{}
+	err := rg.db.Order("id DESC").Limit(maxRetentionEntries).Find(&entries).Error
+	if err != nil {
+		return nil, wrap("could not list retention entries", err)
+	}
+
+	return entries, nil
+}
+
+// ApplyRetention applies the retention policy to the old ratings of the data
+// shared by the application, and to the ones of the active and suspended
+// tenants, with the policy of each tenant. The ratings changed are recorded in
+// the retention log of their schema, and their number is returned. The ratings
+// are changed in batches, each in a transaction of its own, so a run stopped
+// by ctx is resumed by the next one.
+func (s *Services) ApplyRetention(ctx context.Context) (int64, error) {
+	now := s.clock.Now()
+
+	scrubbed, targets, err := applyRetention(ctx, s.db, "", s.retention, now)
+	for _, target := range targets {
+		s.ratingChanged(Rating{Target: target})
+	}
+	if err != nil {
+		return scrubbed, err
+	}
+
+	var tenants []Tenant
+	err = s.db.
+		Where("schema_name <> '' AND status IN (?)", []string{TenantActive, TenantSuspended}).
+		Order("id").
+		Find(&tenants).
+		Error
+	if err != nil {
+		return scrubbed, wrap("failed to list the tenants", err)
+	}
+
+	for _, t := range tenants {
+		n, _, err := applyRetention(ctx, s.db, t.Schema, s.retention.override(t.Retention), now)
+		scrubbed += n
+		if err != nil {
+			return scrubbed, with(err, "tenant_id", t.ID)
+		}
+	}
+
+	return scrubbed, nil
+}
+
+// retentionChanges are the changes made to the ratings by each mode of the
+// retention policies, and the conditions of the ratings not changed yet.
+var retentionChanges = map[string]struct{ set, pending string }{
+	RetentionScrub: {
+		set:     "comment = ''",
+		pending: "comment <> ''",
+	},
+	RetentionAnonymise: {
+		set:     "comment = '', extra = '{}', anonymous = true",
+		pending: "(comment <> '' OR extra <> '{}' OR NOT anonymous)",
+	},
+}
+
+// applyRetention applies p to the ratings in schema, the public schema if empty,
+// dated before now minus p.Days. Their cards are refreshed in the same
+// transaction, as no event is published for them. It returns the number of
+// ratings changed, and their targets.
+func applyRetention(ctx context.Context, db *gorm.DB, schema string, p RetentionPolicy, now time.Time) (int64, []int64, error) {
+	if !p.Enabled() {
+		return 0, nil, nil
+	}
+
+	mode := p.Mode
+	if mode == "" {
+		mode = RetentionScrub
+	}
+	change := retentionChanges[mode]
+	before := now.AddDate(0, 0, -p.Days).Unix()
+
+	var scrubbed int64
+	var targets []int64
+	seen := make(map[int64]bool)
+	for {
+		if err := ctx.Err(); err != nil {
+			return scrubbed, targets, err
+		}
+
+		var batch []struct{ RatingID, Target int64 }
+		err := gormTransaction(db, func(tx *gorm.DB) error {
+			if schema != "" {
+				err := tx.Exec("SET LOCAL search_path TO " + pq.QuoteIdentifier(schema)).Error
+				if err != nil {
+					return wrap("could not switch to the tenant schema", err)
+				}
+			}
+
+			err := tx.Raw(`WITH scrubbed AS (
+					UPDATE ratings SET `+change.set+`, version = version + 1, updated_at = now()
+					WHERE id IN (SELECT id FROM ratings WHERE date < ? AND `+change.pending+` ORDER BY id LIMIT ?)
+					RETURNING id, user_id, target
+				)
+				INSERT INTO retention_log (rating_id, user_id, target, mode, days, scrubbed_at)
+				SELECT id, user_id, target, ?, ?, ? FROM scrubbed
+				RETURNING rating_id, target`, before, retentionBatch, mode, p.Days, now).
+				Scan(&batch).
+				Error
+			if err != nil {
+				return wrap("could not apply the retention policy to the ratings", err)
+			}
+
+			err = tx.Exec(`UPDATE rating_revisions SET `+change.set+` WHERE date < ? AND `+change.pending, before).Error
+			if err != nil {
+				return wrap("could not apply the retention policy to the revisions", err)
+			}
+
+			ids := make([]int64, len(batch))
+			for i, r := range batch {
+				ids[i] = r.RatingID
+			}
+
+			return (&cardGorm{db: tx}).Refresh(ids...)
+		})
+		if err != nil {
+			return scrubbed, targets, with(err, "schema", schema)
+		}
+
+		scrubbed += int64(len(batch))
+		for _, r := range batch {
+			if !seen[r.Target] {
+				seen[r.Target] = true
+				targets = append(targets, r.Target)
+			}
+		}
+
+		if len(batch) < retentionBatch {
+			return scrubbed, targets, nil
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	var cases = []struct {
+		name     string
+		policy   RetentionPolicy
+		tenant   RetentionPolicy
+		out      RetentionPolicy
+		enabled  bool
+		validate error
+	}{
+		{"disabled", RetentionPolicy{}, RetentionPolicy{}, RetentionPolicy{}, false, nil},
+		{"inherited", RetentionPolicy{Days: 30}, RetentionPolicy{}, RetentionPolicy{Days: 30}, true, nil},
+		{"days", RetentionPolicy{Days: 30, Mode: RetentionScrub}, RetentionPolicy{Days: 7}, RetentionPolicy{Days: 7, Mode: RetentionScrub}, true, nil},
+		{"mode", RetentionPolicy{Days: 30}, RetentionPolicy{Mode: RetentionAnonymise}, RetentionPolicy{Days: 30, Mode: RetentionAnonymise}, true, nil},
+		{"keep", RetentionPolicy{Days: 30}, RetentionPolicy{Mode: RetentionKeep}, RetentionPolicy{Days: 30, Mode: RetentionKeep}, false, nil},
+		{"tenantOnly", RetentionPolicy{}, RetentionPolicy{Days: 90}, RetentionPolicy{Days: 90}, true, nil},
+		{"daysInvalid", RetentionPolicy{}, RetentionPolicy{Days: -1}, RetentionPolicy{}, false, ValidationError{"retention.days": ErrInvalid}},
+		{"modeInvalid", RetentionPolicy{}, RetentionPolicy{Mode: "delete"}, RetentionPolicy{Mode: "delete"}, false, ValidationError{"retention.mode": ErrInvalid}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.validate, tc.tenant.validate("retention."))
+
+			p := tc.policy.override(tc.tenant)
+			assert.Equal(t, tc.out, p)
+			assert.Equal(t, tc.enabled, p.Enabled())
+		})
+	}
+}
+
+func TestServices_ApplyRetention(t *testing.T) {
+	dsl := testsupport.Database(t)
+	db := testsupport.Open(t, dsl)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.AddDate(0, 0, -31).Unix()
+	ratings := []Rating{
+		{Active: true, Comment: "Old", Extra: json.RawMessage(`{"table": 4}`), Score: 4, Target: 6345, UserID: 1, Date: old},
+		{Active: true, Comment: "Recent", Extra: json.RawMessage(`{}`), Score: 2, Target: 6345, UserID: 1, Date: now.Unix()},
+		{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 6346, UserID: 1, Date: old},
+	}
+	for i := range ratings {
+		require.NoError(t, db.Create(&ratings[i]).Error)
+	}
+	cards := NewCardService(db)
+	require.NoError(t, cards.Rebuild())
+
+	services, err := NewServices(&Config{JWTSecret: []byte(testJWTSecret), DatabaseDSL: dsl,
+		Clock: FixedClock(now), Retention: RetentionPolicy{Days: 30}})
+	require.NoError(t, err)
+	defer services.Close()
+
+	scrubbed, err := services.ApplyRetention(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), scrubbed, "must only scrub the old ratings with a comment")
+
+	var got Rating
+	require.NoError(t, db.First(&got, ratings[0].ID).Error)
+	assert.Empty(t, got.Comment)
+	assert.JSONEq(t, `{"table": 4}`, string(got.Extra), "must keep the extra data when scrubbing")
+	assert.Equal(t, 4, got.Score)
+	require.NoError(t, db.First(&got, ratings[1].ID).Error)
+	assert.Equal(t, "Recent", got.Comment)
+
+	list, err := cards.ByTarget(6345, CardQuery{})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "Recent", list[0].Comment)
+	assert.Empty(t, list[1].Comment, "must scrub the comments of the cards")
+	assert.Equal(t, "admin", list[1].ReviewerName)
+
+	log, err := services.Retention.Log()
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, ratings[0].ID, log[0].RatingID)
+	assert.Equal(t, RetentionScrub, log[0].Mode)
+	assert.Equal(t, 30, log[0].Days)
+
+	scrubbed, err = services.ApplyRetention(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, scrubbed, "must not scrub the ratings twice")
+
+	t.Run("anonymise", func(t *testing.T) {
+		services.retention.Mode = RetentionAnonymise
+		defer func() { services.retention.Mode = "" }()
+
+		scrubbed, err := services.ApplyRetention(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), scrubbed)
+
+		require.NoError(t, db.First(&got, ratings[0].ID).Error)
+		assert.True(t, got.Anonymous)
+		assert.JSONEq(t, `{}`, string(got.Extra))
+
+		list, err := cards.ByTarget(6345, CardQuery{})
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.True(t, list[1].Anonymous)
+		assert.Empty(t, list[1].ReviewerName, "must anonymise the cards")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := services.ApplyRetention(ctx)
+		assert.Equal(t, context.Canceled, err)
+	})
+}
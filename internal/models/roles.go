@@ -9,6 +9,18 @@ import (
 	"golang.org/x/xerrors"
 )
 
+// The IDs of the system roles, created by the migrations. They can't be changed
+// nor deleted.
+const (
+	// AdminRoleID is the ID of the admin role, whose users are the
+	// administrators, permitted everything.
+	AdminRoleID int64 = 1
+
+	// UserRoleID is the ID of the user role, given to the users created
+	// without a role.
+	UserRoleID int64 = 2
+)
+
 // The permission constants enumerate the permissions recognised by the application.
 const (
 	// PermissionReadUsers allows reading and listing user accounts.
@@ -20,28 +32,56 @@ const (
 	// PermissionReadRatings allow reading any ratings information.
 	PermissionReadRatings
 
-	// PermissionWriteRatings allow modifying ratings information.
+	// PermissionWriteRatings allow modifying ratings information, the
+	// ratings of other users included, as moderators do.
 	PermissionWriteRatings
+
+	// PermissionWriteOwnRatings allows creating ratings, and modifying
+	// and deleting the ones of the user only.
+	PermissionWriteOwnRatings
 )
 
 var (
 	permissionsFromString = map[string]Permissions{
-		"readUsers":    PermissionReadUsers,
-		"writeUsers":   PermissionWriteUsers,
-		"readRatings":  PermissionReadRatings,
-		"writeRatings": PermissionWriteRatings,
+		"readUsers":       PermissionReadUsers,
+		"writeUsers":      PermissionWriteUsers,
+		"readRatings":     PermissionReadRatings,
+		"writeRatings":    PermissionWriteRatings,
+		"writeOwnRatings": PermissionWriteOwnRatings,
 	}
 
 	permissionsToString = map[Permissions]string{
-		PermissionReadUsers:    "readUsers",
-		PermissionWriteUsers:   "writeUsers",
-		PermissionReadRatings:  "readRatings",
-		PermissionWriteRatings: "writeRatings",
+		PermissionReadUsers:       "readUsers",
+		PermissionWriteUsers:      "writeUsers",
+		PermissionReadRatings:     "readRatings",
+		PermissionWriteRatings:    "writeRatings",
+		PermissionWriteOwnRatings: "writeOwnRatings",
+	}
+
+	// permissionDescriptions tell what the permissions allow, see
+	// AllPermissions.
+	permissionDescriptions = map[Permissions]string{
+		PermissionReadUsers:       "Read and list the users and roles.",
+		PermissionWriteUsers:      "Create, modify and delete the users and roles, and invite users.",
+		PermissionReadRatings:     "Read and list any rating.",
+		PermissionWriteRatings:    "Create ratings, and modify and delete any rating, as moderators do.",
+		PermissionWriteOwnRatings: "Create ratings, and modify and delete the ones of the user.",
 	}
 )
 
+//go:generate go run github.com/matryer/moq -out modelstest/roles.go -pkg modelstest . RoleService:RoleService
+
 // RoleService defines a set of methods to be used when dealing with system roles.
 type RoleService interface {
+	// UpdatePartial updates the role with ID r.ID by applying patch, a
+	// JSON Merge Patch document (RFC 7396). Only the fields present in
+	// patch are validated and modified, the others keep their stored
+	// values.
+	//
+	// r.Version is handled as in Update. On success, r is set to the
+	// updated role.
+	UpdatePartial(r *Role, patch []byte) error
+
 	RoleDB
 }
 
@@ -63,6 +103,10 @@ type RoleDB interface {
 	// Use NewRole() to use appropriate default values for the fields.
 	//
 	// The admin and user role cannot be updated.
+	//
+	// If the Version field is not zero, ErrConflict is returned when the
+	// stored role has a different version. On success, Version is set to
+	// the new version.
 	Update(*Role) error
 
 	// Delete removes a role by ID. The admin and user roles with
@@ -81,14 +125,24 @@ type RoleDB interface {
 type Role struct {
 	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
 
-	// Label uniquely identifies a role in the system. The
-	// "admin" and "user" labels are system defaults and
-	// cannot be used or modified.
-	Label string `gorm:"unique;size:255;not null" json:"label"`
+	// Label uniquely identifies a role in its organisation, or
+	// among the shared roles. The "admin" and "user" labels are
+	// system defaults and cannot be used or modified.
+	Label string `gorm:"size:255;not null" json:"label"`
+
+	// OrgID is the ID of the organisation the role belongs to, see
+	// Organisation, and nil for the roles shared by every
+	// organisation, like the system roles. It is set when the role is
+	// created, and never changed.
+	OrgID *int64 `gorm:"type:bigint" json:"orgId,omitempty"`
 
 	// Permissions mark what actions are allowed to be executed
 	// by users with this role.
 	Permissions Permissions `gorm:"type:bigint;not null" json:"permissions"`
+
+	// Version is increased every time the role is updated. When set on
+	// an update, the update only succeeds if it matches the stored version.
+	Version int64 `gorm:"type:bigint;not null;default:1" json:"-"`
 }
 
 // NewRole creates a new Role value with default field values applied.
@@ -96,6 +150,23 @@ func NewRole() Role {
 	return Role{}
 }
 
+// Clone returns a new role labelled label, with the permissions of r that the
+// application recognises. The admin role, which has every bit set, is cloned
+// with all of them.
+func (r Role) Clone(label string) Role {
+	c := NewRole()
+	c.Label = label
+	c.Permissions = r.Permissions & allPermissions()
+	return c
+}
+
+// AvailableTo tells whether r can be given to the users of the organisation org,
+// nil for the users of no organisation: the shared roles are available to every
+// user, and the roles of an organisation to its own users only.
+func (r Role) AvailableTo(org *int64) bool {
+	return r.OrgID == nil || sameOrganisation(r.OrgID, org)
+}
+
 // Permissions defines bitfields where each bit represents a set of operations a user is allowed to perform on the application.
 //
 // A set of constants determine what operations are available and accepted as permissions.
@@ -121,6 +192,11 @@ func (p *Permissions) UnmarshalJSON(b []byte) error {
 
 // MarshalJSON encodes p as a list of strings, each one representing an enumerated permission.
 func (p Permissions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Names())
+}
+
+// Names returns the names of the permissions enumerated in p, as encoded in JSON.
+func (p Permissions) Names() []string {
 	var s = []string{}
 
 	var max = uint64(0x8000000000000000)
@@ -132,7 +208,7 @@ func (p Permissions) MarshalJSON() ([]byte, error) {
 		}
 	}
 
-	return json.Marshal(s)
+	return s
 }
 
 type roleService struct {
@@ -142,15 +218,25 @@ type roleService struct {
 // NewRoleService instantiates a new RoleService implementation with db as the
 // backing database.
 func NewRoleService(db *gorm.DB) RoleService {
+	return newRoleService(db, nil)
+}
+
+// newRoleService instantiates a new RoleService implementation that checks the
+// custom rules on the roles, which may be nil.
+func newRoleService(db *gorm.DB, rules *Rules) RoleService {
 	return &roleService{
 		RoleService: &roleValidator{
 			RoleDB: &roleGorm{db},
+			rules:  rules,
 		},
 	}
 }
 
 type roleValidator struct {
 	RoleDB
+
+	// rules are the custom rules run after the validators, if not nil.
+	rules *Rules
 }
 
 func (rv *roleValidator) Create(role *Role) error {
@@ -166,6 +252,11 @@ func (rv *roleValidator) Create(role *Role) error {
 		return err
 	}
 
+	err = rv.runValFuncs(role, rv.rules.roleRules()...)
+	if err != nil {
+		return err
+	}
+
 	return rv.RoleDB.Create(role)
 }
 
@@ -182,6 +273,67 @@ func (rv *roleValidator) Update(role *Role) error {
 	if err != nil {
 		return err
 	}
+
+	err = rv.runValFuncs(role, rv.rules.roleRules()...)
+	if err != nil {
+		return err
+	}
+
+	return rv.RoleDB.Update(role)
+}
+
+func (rv *roleValidator) UpdatePartial(role *Role, patch []byte) error {
+	fields, err := patchFields(patch)
+	if err != nil {
+		return err
+	}
+
+	err = rv.runValFuncs(role,
+		rv.idNotAdmin,
+		rv.idNotUser,
+	)
+	if err != nil {
+		return err
+	}
+
+	current, err := rv.RoleDB.ByID(role.ID)
+	if err != nil {
+		return err
+	}
+
+	var pr Role
+	if err := applyMergePatch(&current, patch, &pr); err != nil {
+		return err
+	}
+
+	// without a version from the client, the one read is used so changes
+	// made in between are not overwritten
+	pr.ID, pr.Version = role.ID, role.Version
+	if pr.Version == 0 {
+		pr.Version = current.Version
+	}
+	// the organisation of the roles never changes
+	pr.OrgID = current.OrgID
+	*role = pr
+
+	if fields["label"] {
+		err = rv.runValFuncs(role,
+			rv.isNotAdmin,
+			rv.isNotUser,
+			rv.labelRequired,
+			rv.normaliseLabel,
+			rv.labelLength,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rv.runValFuncs(role, rv.rules.roleRules()...)
+	if err != nil {
+		return err
+	}
+
 	return rv.RoleDB.Update(role)
 }
 
@@ -233,10 +385,10 @@ func (rv *roleValidator) isNotUser() (string, roleValFn) {
 	}
 }
 
-// idNotAdmin makes sure the ID is not equal to 1. It may return ErrReadOnly.
+// idNotAdmin makes sure the ID is not AdminRoleID. It may return ErrReadOnly.
 func (rv *roleValidator) idNotAdmin() (string, roleValFn) {
 	return "", func(r *Role) error {
-		if r.ID == 1 {
+		if r.ID == AdminRoleID {
 			return ErrReadOnly
 		}
 
@@ -244,10 +396,10 @@ func (rv *roleValidator) idNotAdmin() (string, roleValFn) {
 	}
 }
 
-// idNotUser makes sure the label is not equal to 2. It may return ErrReadOnly.
+// idNotUser makes sure the ID is not UserRoleID. It may return ErrReadOnly.
 func (rv *roleValidator) idNotUser() (string, roleValFn) {
 	return "", func(r *Role) error {
-		if r.ID == 2 {
+		if r.ID == UserRoleID {
 			return ErrReadOnly
 		}
 
@@ -301,6 +453,8 @@ func (rg *roleGorm) Create(r *Role) error {
 				return ValidationError{"id": ErrIDTaken}
 			case perr.Code.Name() == "unique_violation" && perr.Constraint == "roles_label_key":
 				return ValidationError{"label": ErrDuplicate}
+			case perr.Code.Name() == "foreign_key_violation" && perr.Constraint == "roles_org_id_fkey":
+				return ValidationError{"orgId": ErrRefNotFound}
 			}
 		}
 
@@ -311,23 +465,25 @@ func (rg *roleGorm) Create(r *Role) error {
 }
 
 func (rg *roleGorm) Update(r *Role) error {
-	res := rg.db.Model(&Role{ID: r.ID}).Updates(gormToMap(rg.db, r))
-
-	if res.Error != nil {
-		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) {
-			switch {
-			case perr.Code.Name() == "unique_violation" && perr.Constraint == "roles_label_key":
-				return ValidationError{"label": ErrDuplicate}
+	return gormTransaction(rg.db, func(tx *gorm.DB) error {
+		v, err := gormVersionedUpdates(tx, &Role{ID: r.ID}, r, r.Version)
+		if err != nil {
+			if perr := (*pq.Error)(nil); xerrors.As(err, &perr) {
+				switch {
+				case perr.Code.Name() == "unique_violation" && perr.Constraint == "roles_label_key":
+					return ValidationError{"label": ErrDuplicate}
+				}
+
+			} else if xerrors.Is(err, ErrNotFound) || xerrors.Is(err, ErrConflict) {
+				return err
 			}
-		}
-
-		return wrap("could not update role", res.Error)
 
-	} else if res.RowsAffected == 0 {
-		return ErrNotFound
-	}
+			return wrap("could not update role", err)
+		}
 
-	return nil
+		r.Version = v
+		return nil
+	})
 }
 
 func (rg *roleGorm) Delete(id int64) error {
@@ -60,7 +60,7 @@ func (t *testRoleDB) ByIDs(id ...int64) ([]Role, error) {
 }
 
 func dropRolesTable(db *gorm.DB) {
-	db.DropTableIfExists(&Rating{}, &User{}, &Role{})
+	db.DropTableIfExists(&Consent{}, &Reaction{}, &Moderation{}, &Reputation{}, &adminBootstrap{}, &RatingRevision{}, &Rating{}, &User{}, &Role{})
 }
 
 func TestPermissions_UnmarshalJSON(t *testing.T) {
@@ -406,6 +406,97 @@ func TestRoleService_Update(t *testing.T) {
 	}
 }
 
+func TestRoleService_UpdatePartial(t *testing.T) {
+	rdb := &testRoleDB{}
+	rs := NewRoleService(nil)
+	rs.(*roleService).RoleService.(*roleValidator).RoleDB = rdb
+
+	stored := func(id int64) (Role, error) {
+		return Role{ID: 99, Label: "workers", Permissions: PermissionReadRatings, Version: 5}, nil
+	}
+
+	var cases = []struct {
+		name    string
+		role    *Role
+		patch   string
+		outrole *Role
+		outerr  error
+		setup   func(t *testing.T)
+	}{
+		{
+			"idAdminReadOnly",
+			&Role{ID: 1},
+			`{"permissions":[]}`,
+			nil,
+			ErrReadOnly,
+			nil,
+		},
+		{
+			"labelUserNotAllowed",
+			&Role{ID: 99},
+			`{"label":"user"}`,
+			nil,
+			ValidationError{"label": ErrDuplicate},
+			func(t *testing.T) {
+				rdb.byID = stored
+			},
+		},
+		{
+			"labelRemoved",
+			&Role{ID: 99},
+			`{"label":null}`,
+			nil,
+			ValidationError{"label": ErrRequired},
+			func(t *testing.T) {
+				rdb.byID = stored
+			},
+		},
+		{
+			"ok",
+			&Role{ID: 99},
+			`{"permissions":["readRatings","writeRatings"]}`,
+			&Role{ID: 99, Label: "workers", Permissions: PermissionReadRatings | PermissionWriteRatings, Version: 6},
+			nil,
+			func(t *testing.T) {
+				rdb.byID = stored
+				rdb.update = func(r *Role) error {
+					assert.Equal(t, &Role{
+						ID:          99,
+						Label:       "workers",
+						Permissions: PermissionReadRatings | PermissionWriteRatings,
+						Version:     5,
+					}, r)
+
+					r.Version = 6
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			err := rs.UpdatePartial(cs.role, []byte(cs.patch))
+
+			if cs.outerr != nil {
+				assert.Error(t, err)
+				assert.True(t, xerrors.Is(err, cs.outerr),
+					"errors must match, expected %v, got %v", cs.outerr, err)
+
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cs.outrole, cs.role)
+			}
+
+			*rdb = testRoleDB{}
+		})
+	}
+}
+
 func TestRoleService_Delete(t *testing.T) {
 	rdb := &testRoleDB{}
 	rs := NewRoleService(nil)
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"github.com/noelruault/ratingsapp/pkg/rules"
+)
+
+// Rules holds the validation rules the validators run on the users, roles and
+// ratings once the built-in validations passed, when a value is created or
+// updated, and before it is stored. They are the custom rules of the
+// deployment, see rules.Rules, converted with customRules, and the rules of the
+// services themselves, like the policies of the ratings. Partial updates are
+// checked as patched.
+//
+// A rule checks a field, or the whole value if its field is empty, and is run
+// as the other validation functions: it must return PublicError values, or a
+// ValidationError, and any other error fails the request as an internal error.
+//
+// The rules of the zero value are empty. They must be added before the services
+// are created, and are then safe for concurrent use.
+type Rules struct {
+	users   []func() (string, userValFn)
+	roles   []func() (string, roleValFn)
+	ratings []func() (string, ratingValFn)
+}
+
+// AddUser adds a rule on the users, checking the given field.
+func (r *Rules) AddUser(field string, fn func(u *User) error) {
+	r.users = append(r.users, func() (string, userValFn) {
+		return field, fn
+	})
+}
+
+// AddRole adds a rule on the roles, checking the given field.
+func (r *Rules) AddRole(field string, fn func(r *Role) error) {
+	r.roles = append(r.roles, func() (string, roleValFn) {
+		return field, fn
+	})
+}
+
+// AddRating adds a rule on the ratings, checking the given field. The UserID
+// of the ratings is the ID of the user creating or updating them.
+func (r *Rules) AddRating(field string, fn func(r *Rating) error) {
+	r.ratings = append(r.ratings, func() (string, ratingValFn) {
+		return field, fn
+	})
+}
+
+// Copy returns a copy of r, so rules can be added to it without changing r.
+func (r *Rules) Copy() *Rules {
+	if r == nil {
+		return &Rules{}
+	}
+
+	return &Rules{
+		users:   append([]func() (string, userValFn)(nil), r.users...),
+		roles:   append([]func() (string, roleValFn)(nil), r.roles...),
+		ratings: append([]func() (string, ratingValFn)(nil), r.ratings...),
+	}
+}
+
+// userRules returns the validation functions of the rules on the users, if
+// any. It is safe to call on a nil r.
+func (r *Rules) userRules() []func() (string, userValFn) {
+	if r == nil {
+		return nil
+	}
+
+	return r.users
+}
+
+// roleRules returns the validation functions of the rules on the roles, as
+// userRules.
+func (r *Rules) roleRules() []func() (string, roleValFn) {
+	if r == nil {
+		return nil
+	}
+
+	return r.roles
+}
+
+// ratingRules returns the validation functions of the rules on the ratings, as
+// userRules.
+func (r *Rules) ratingRules() []func() (string, ratingValFn) {
+	if r == nil {
+		return nil
+	}
+
+	return r.ratings
+}
+
+// ruleErrors are the model errors returned for the errors of the rules sharing
+// the codes of the built-in validations.
+var ruleErrors = map[rules.Error]ModelError{
+	rules.ErrRequired: ErrRequired,
+	rules.ErrInvalid:  ErrInvalid,
+	rules.ErrTooLong:  ErrTooLong,
+	rules.ErrReadOnly: ErrReadOnly,
+}
+
+// customRules returns the custom rules of the deployment, converted to the
+// rules run by the validators. The values are copied for the custom rules, so
+// they can't change them.
+func customRules(r *rules.Rules) *Rules {
+	cr := &Rules{}
+	for _, rule := range r.Users() {
+		check := rule.Check
+		cr.AddUser(rule.Field, func(u *User) error {
+			return ruleError(check(&rules.User{
+				ID:        u.ID,
+				Active:    u.Active,
+				Email:     u.Email,
+				FirstName: u.FirstName,
+				LastName:  u.LastName,
+				RoleID:    u.RoleID,
+				Settings:  string(u.Settings),
+			}))
+		})
+	}
+
+	for _, rule := range r.Roles() {
+		check := rule.Check
+		cr.AddRole(rule.Field, func(rl *Role) error {
+			return ruleError(check(&rules.Role{
+				ID:          rl.ID,
+				Label:       rl.Label,
+				Permissions: rl.Permissions.Names(),
+			}))
+		})
+	}
+
+	for _, rule := range r.Ratings() {
+		check := rule.Check
+		cr.AddRating(rule.Field, func(rt *Rating) error {
+			var campaignID *int64
+			if rt.CampaignID != nil {
+				id := *rt.CampaignID
+				campaignID = &id
+			}
+
+			return ruleError(check(&rules.Rating{
+				ID:         rt.ID,
+				Active:     rt.Active,
+				Anonymous:  rt.Anonymous,
+				Comment:    rt.Comment,
+				Date:       rt.Date,
+				Extra:      append([]byte(nil), rt.Extra...),
+				Score:      rt.Score,
+				Target:     rt.Target,
+				UserID:     rt.UserID,
+				CampaignID: campaignID,
+			}))
+		})
+	}
+
+	return cr
+}
+
+// ruleError converts the errors of the custom rules to the public errors of the
+// models. The other errors are returned as internal errors.
+func ruleError(err error) error {
+	switch terr := err.(type) {
+	case nil:
+		return nil
+	case rules.Error:
+		return ruleCode(terr)
+	case rules.FieldErrors:
+		ve := ValidationError{}
+		for field, e := range terr {
+			ve[field] = ruleCode(e)
+		}
+		return ve
+	default:
+		return wrap("custom validation rule failed", err)
+	}
+}
+
+// ruleCode returns the public error with the code of e.
+func ruleCode(e rules.Error) PublicError {
+	if me, ok := ruleErrors[e]; ok {
+		return me
+	}
+
+	return ModelError("models: " + string(e) + ", custom validation rule failed")
+}
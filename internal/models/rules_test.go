@@ -0,0 +1,132 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/pkg/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestRules(t *testing.T) {
+	custom := &rules.Rules{}
+	custom.AddUser("email", func(u *rules.User) error {
+		if !strings.HasSuffix(u.Email, "@acme.com") {
+			return rules.Error("corporate_email_required")
+		}
+		return nil
+	})
+	custom.AddRole("label", func(r *rules.Role) error {
+		if strings.HasPrefix(r.Label, "tmp") {
+			return rules.ErrInvalid
+		}
+		return nil
+	})
+	custom.AddRole("", func(r *rules.Role) error {
+		for _, p := range r.Permissions {
+			if p == "writeUsers" {
+				return rules.ErrReadOnly
+			}
+		}
+		return nil
+	})
+	custom.AddRating("", func(r *rules.Rating) error {
+		r.Score = 1
+		switch {
+		case r.Comment == "fields":
+			return rules.FieldErrors{"comment": "too_rude", "score": rules.ErrRequired}
+		case r.Comment == "internal":
+			return ErrNotFound
+		}
+		return nil
+	})
+	rules := customRules(custom)
+
+	rdb := &testRoleDB{}
+	rs := newRoleService(nil, rules)
+	rs.(*roleService).RoleService.(*roleValidator).RoleDB = rdb
+
+	tudb := &testUserDB{
+		byEmail: func(e string) (User, error) {
+			return User{}, ErrNotFound
+		},
+	}
+	us, err := newUserService(nil, rs, jwtKeys{secret: []byte(testJWTSecret)}, nil, nil, nil, rules, nil, false)
+	require.NoError(t, err)
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	t.Run("userRejected", func(t *testing.T) {
+		u := User{Email: "rick@sanchez.com", FirstName: "Rick", Password: "1234luggage", RoleID: 2}
+		err := us.Create(&u)
+
+		assert.Equal(t, ValidationError{"email": ModelError("models: corporate_email_required, custom validation rule failed")}, err)
+		assert.Equal(t, "corporate_email_required", err.(ValidationError)["email"].Public())
+	})
+
+	t.Run("userAccepted", func(t *testing.T) {
+		u := User{Email: "rick@acme.com", FirstName: "Rick", Password: "1234luggage", RoleID: 2}
+		assert.NoError(t, us.Create(&u))
+	})
+
+	t.Run("builtInFirst", func(t *testing.T) {
+		u := User{Email: "rick@sanchez.com", Password: "1234luggage", RoleID: 2}
+		err := us.Create(&u)
+
+		assert.Equal(t, ValidationError{"firstName": ErrRequired}, err, "must only run the rules once the built-in validations passed")
+	})
+
+	t.Run("roleField", func(t *testing.T) {
+		err := rs.Create(&Role{Label: "tmpuser", Permissions: PermissionWriteUsers})
+
+		assert.Equal(t, ValidationError{"label": ErrInvalid}, err, "must not run other rules if a field failed")
+	})
+
+	t.Run("roleValue", func(t *testing.T) {
+		err := rs.Create(&Role{Label: "manager", Permissions: PermissionWriteUsers})
+
+		assert.Equal(t, ErrReadOnly, err)
+	})
+
+	t.Run("rolePatched", func(t *testing.T) {
+		rdb.byID = func(id int64) (Role, error) {
+			return Role{ID: id, Label: "manager", Permissions: PermissionReadRatings}, nil
+		}
+		defer func() {
+			rdb.byID = nil
+		}()
+
+		err := rs.UpdatePartial(&Role{ID: 9}, []byte(`{"permissions":["writeUsers"]}`))
+
+		assert.Equal(t, ErrReadOnly, err, "must check the role as patched")
+	})
+
+	t.Run("rating", func(t *testing.T) {
+		check := rules.ratingRules()[0]
+		_, fn := check()
+
+		r := Rating{Score: 5, Comment: "fields"}
+		assert.Equal(t, ValidationError{"comment": ModelError("models: too_rude, custom validation rule failed"), "score": ErrRequired}, fn(&r))
+		assert.Equal(t, 5, r.Score, "must not let the custom rules change the values")
+
+		r.Comment = "internal"
+		err := fn(&r)
+		assert.True(t, xerrors.Is(err, ErrNotFound))
+		_, public := err.(PublicError)
+		assert.False(t, public, "must fail as an internal error")
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		c := rules.Copy()
+		c.AddRating("comment", func(r *Rating) error {
+			return ErrRequired
+		})
+
+		assert.Len(t, c.ratingRules(), 2)
+		assert.Len(t, rules.ratingRules(), 1, "must not change the rules copied")
+		assert.Len(t, c.userRules(), 1)
+		assert.Len(t, c.roleRules(), 2)
+		assert.Empty(t, (*Rules)(nil).roleRules())
+	})
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// sandboxKeptTables are the tables ResetSandbox leaves as they are, which
+// record the state of the schema rather than data.
+var sandboxKeptTables = []string{"schema_migrations", "permission_upgrades"}
+
+// sandbox is the configuration of the services in the sandbox mode, see
+// Config.Sandbox.
+type sandbox struct {
+	adminPassword string
+	roles         []DefaultRole
+}
+
+// ResetSandbox erases all the data of the application, and creates its default
+// values again as on the first start: the admin and user roles, the roles
+// configured, and the admin user with the password it is configured with. It
+// is only available in the sandbox mode, see Config.Sandbox.
+//
+// The IDs are not reused, so the tokens of the users erased are not valid for
+// the users created afterwards, except for the admin user.
+func (s *Services) ResetSandbox() error {
+	if s.sandbox == nil {
+		return wrap("the data can only be reset in the sandbox mode", nil)
+	}
+
+	var tables []string
+	err := s.db.Raw(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' AND table_name NOT IN (?)
+		ORDER BY table_name`, sandboxKeptTables).
+		Pluck("table_name", &tables).
+		Error
+	if err != nil {
+		return wrap("could not list the tables", err)
+	}
+
+	for i, t := range tables {
+		tables[i] = pq.QuoteIdentifier(t)
+	}
+
+	err = gormTransaction(s.db, func(tx *gorm.DB) error {
+		err := tx.Exec("TRUNCATE " + strings.Join(tables, ", ") + " CASCADE").Error
+		if err != nil {
+			return wrap("could not erase the data", err)
+		}
+
+		err = createDefaultRoles(tx)
+		if err != nil {
+			return err
+		}
+
+		_, err = createConfiguredRoles(tx, s.sandbox.roles)
+		if err != nil {
+			return err
+		}
+
+		_, err = createAdmin(tx, s.sandbox.adminPassword, s.clock)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// the values of every cached service were erased along with the data
+	for name, l := range s.loaders {
+		err = l.Flush()
+		if err != nil {
+			return with(err, "cache", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestServices_ResetSandbox(t *testing.T) {
+	db := setupGorm(t)
+
+	assert.Error(t, (&Services{db: db}).ResetSandbox(), "must only reset in the sandbox mode")
+
+	require.NoError(t, db.Create(&Role{ID: 3, Label: "moderator", Permissions: PermissionReadUsers}).Error)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 3, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 98}).Error)
+
+	s := &Services{db: db, sandbox: &sandbox{
+		adminPassword: "sandbox password",
+		roles:         []DefaultRole{{Label: "support", Permissions: PermissionReadRatings}},
+	}}
+	require.NoError(t, s.ResetSandbox())
+
+	var count int
+	require.NoError(t, db.Model(&Rating{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	var users []User
+	require.NoError(t, db.Order("id").Find(&users).Error)
+	require.Len(t, users, 1)
+	assert.Equal(t, int64(adminID), users[0].ID)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(users[0].Password), []byte("sandbox password")))
+
+	var labels []string
+	require.NoError(t, db.Model(&Role{}).Order("id").Pluck("label", &labels).Error)
+	assert.Equal(t, []string{"admin", "user", "support"}, labels)
+
+	var support Role
+	require.NoError(t, db.Where("label = ?", "support").First(&support).Error)
+	assert.True(t, support.ID > 3, "must not reuse the IDs")
+
+	require.NoError(t, db.Raw("SELECT count(*) FROM schema_migrations").Row().Scan(&count))
+	assert.NotZero(t, count, "must keep the migrations applied")
+}
+
+func TestServices_ResetSandbox_cache(t *testing.T) {
+	s, err := NewServices(&Config{
+		JWTSecret:     []byte(testJWTSecret),
+		DatabaseDSL:   testsupport.Database(t),
+		Cache:         cache.NewLRU(100),
+		Sandbox:       true,
+		AdminPassword: "sandbox password",
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	r := Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: adminID}
+	require.NoError(t, s.db.Create(&r).Error)
+
+	// cached before the reset
+	ratings, err := s.Rating.ByTarget(9)
+	require.NoError(t, err)
+	require.Len(t, ratings, 1)
+	stats, err := s.Rating.StatsByTarget(9)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), stats.Count)
+
+	require.NoError(t, s.ResetSandbox())
+
+	ratings, err = s.Rating.ByTarget(9)
+	require.NoError(t, err)
+	assert.Empty(t, ratings, "must not read the ratings erased from the cache")
+	stats, err = s.Rating.StatsByTarget(9)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Count, "must not read the stats erased from the cache")
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"io"
+	"time"
+)
+
+// Security events, as used in SecurityEvent.Type.
+const (
+	// SecurityLoginFailed tells that a login failed, because of a wrong
+	// password or an unknown email address.
+	SecurityLoginFailed = "login_failed"
+
+	// SecurityAccountLocked tells that a login was attempted to a
+	// deactivated user, whose account is locked.
+	SecurityAccountLocked = "account_locked"
+
+	// SecurityTokenReused tells that a refresh token was used again after
+	// its session ended, as it was refreshed or revoked already, which is
+	// how a stolen token shows up. Only reported when sessions are
+	// tracked.
+	SecurityTokenReused = "token_reused"
+)
+
+// A SecurityEvent reports an attempt to access the application that may be
+// part of an attack, like the failed logins of a brute-force attack, so the
+// security operations can alert on them. Neither the passwords nor the tokens
+// are part of the events.
+type SecurityEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// UserID is the ID of the user the event is about, if known, and
+	// Email the email address the login was attempted with.
+	UserID int64  `json:"userId,omitempty"`
+	Email  string `json:"email,omitempty"`
+
+	// SessionID is the session of the token reused.
+	SessionID string `json:"sessionId,omitempty"`
+
+	// IP and UserAgent identify the client, if known.
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+
+	// Tenant is the schema of the tenant of the user, empty for the
+	// data shared by the application.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// SecurityEvents receives the security events, see Config.SecurityEvents.
+// Record is called by the requests reporting them, so it must be safe for
+// concurrent use, and should not block.
+type SecurityEvents interface {
+	Record(e SecurityEvent)
+}
+
+// SecurityEventSinks records the security events to each of its sinks, in
+// order.
+type SecurityEventSinks []SecurityEvents
+
+// Record records e to each sink.
+func (s SecurityEventSinks) Record(e SecurityEvent) {
+	for _, sink := range s {
+		sink.Record(e)
+	}
+}
+
+// Close closes the sinks that are io.Closers, and returns the first error.
+func (s SecurityEventSinks) Close() error {
+	var firstErr error
+	for _, sink := range s {
+		if cl, ok := sink.(io.Closer); ok {
+			err := cl.Close()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type testSecurityEvents []SecurityEvent
+
+func (t *testSecurityEvents) Record(e SecurityEvent) {
+	*t = append(*t, e)
+}
+
+func TestUserService_SecurityEvents(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("7vb6sCaHrV5DfV6wE7i9QdGC"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	ss, _ := newTestSessionStore(t)
+	got := &testSecurityEvents{}
+	us, _ := newUserService(nil, nil, jwtKeys{secret: []byte(testJWTSecret), schema: "tenant_1"}, ss, got, nil, nil, FixedClock(now), false)
+	us.(*userService).UserService.(*userValidator).UserDB = &testUserDB{
+		byEmail: func(e string) (User, error) {
+			switch e {
+			case "active@name.com":
+				return User{ID: 1, Active: true, Password: string(hash)}, nil
+			case "inactive@name.com":
+				return User{ID: 2, Password: string(hash)}, nil
+			}
+
+			return User{}, ErrNotFound
+		},
+		byID: func(id int64) (User, error) {
+			return User{ID: id, Active: true}, nil
+		},
+	}
+	client := SessionClient{UserAgent: "test/1.0", IP: "203.0.113.7"}
+
+	_, err = us.AuthenticateFrom("active@name.com", "7vb6sCaHrV5DfV6wE7i9QdGC", client)
+	require.NoError(t, err)
+	_, err = us.AuthenticateFrom("", "", client)
+	assert.Equal(t, ErrNoCredentials, err)
+	assert.Empty(t, *got, "must only report the failed logins")
+
+	_, err = us.AuthenticateFrom("active@name.com", "adifferentpassword", client)
+	assert.Equal(t, ErrUnauthorised, err)
+	_, err = us.AuthenticateFrom("unknown@name.com", "7vb6sCaHrV5DfV6wE7i9QdGC", client)
+	assert.Equal(t, ErrUnauthorised, err)
+	_, err = us.AuthenticateFrom("inactive@name.com", "7vb6sCaHrV5DfV6wE7i9QdGC", client)
+	assert.Equal(t, ErrUnauthorised, err)
+
+	assert.Equal(t, testSecurityEvents{
+		{Type: SecurityLoginFailed, Time: now.UTC(), UserID: 1, Email: "active@name.com", IP: "203.0.113.7", UserAgent: "test/1.0", Tenant: "tenant_1"},
+		{Type: SecurityLoginFailed, Time: now.UTC(), Email: "unknown@name.com", IP: "203.0.113.7", UserAgent: "test/1.0", Tenant: "tenant_1"},
+		{Type: SecurityAccountLocked, Time: now.UTC(), UserID: 2, Email: "inactive@name.com", IP: "203.0.113.7", UserAgent: "test/1.0", Tenant: "tenant_1"},
+	}, *got)
+
+	t.Run("tokenReused", func(t *testing.T) {
+		*got = nil
+
+		tok, err := us.Token(&User{ID: 1})
+		require.NoError(t, err)
+		_, _, err = us.RefreshSession(tok.RefreshToken, client)
+		require.NoError(t, err)
+		assert.Empty(t, *got)
+
+		_, _, err = us.RefreshSession(tok.RefreshToken, client)
+		assert.Equal(t, ErrUnauthorised, err)
+		require.Len(t, *got, 1)
+		assert.Equal(t, SecurityTokenReused, (*got)[0].Type)
+		assert.Equal(t, int64(1), (*got)[0].UserID)
+		assert.NotEmpty(t, (*got)[0].SessionID)
+		assert.Equal(t, "203.0.113.7", (*got)[0].IP)
+	})
+}
+
+func TestSecurityEventSinks(t *testing.T) {
+	var a, b testSecurityEvents
+	SecurityEventSinks{&a, &b}.Record(SecurityEvent{Type: SecurityLoginFailed})
+
+	assert.Len(t, a, 1)
+	assert.Len(t, b, 1)
+	assert.NoError(t, SecurityEventSinks{&a}.Close())
+}
@@ -4,8 +4,26 @@ Package models implements persistence/fetch/update and validation for applicatio
 package models
 
 import (
+	"database/sql"
+	"io"
+	"net/url"
+	"time"
+
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres" // gorm's postgres support
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/noelruault/ratingsapp/internal/storage"
+	"github.com/noelruault/ratingsapp/internal/tracing"
+	"github.com/noelruault/ratingsapp/pkg/rules"
+	"golang.org/x/xerrors"
+)
+
+// Defaults of the pool of database connections, see Config.MaxOpenConns.
+const (
+	DefaultMaxOpenConns    = 20
+	DefaultMaxIdleConns    = 10
+	DefaultConnMaxLifetime = 30 * time.Minute
 )
 
 // Services aggregates all services provided by the models package.
@@ -13,8 +31,162 @@ type Services struct {
 	User   UserService
 	Role   RoleService
 	Rating RatingService
+	Sync   SyncService
+	Query  QueryService
+
+	Reputation ReputationService
+	Consent    ConsentService
+	Campaign   CampaignService
+	Reply      ReplyService
+
+	// AuthCode issues and exchanges the codes of the OAuth
+	// authorization code grant, for the clients of
+	// Config.OAuthClients.
+	AuthCode AuthCodeService
+
+	// Identity is only set when Config.IdentityProvider is
+	// defined.
+	Identity IdentityService
+
+	// Invitation invites people to create their user.
+	Invitation InvitationService
+
+	// Audit records the sensitive actions of the administrators.
+	Audit AuditService
+
+	// Attachment is only set when Config.Attachments is defined.
+	Attachment AttachmentService
+
+	Subscription SubscriptionService
+	Alert        AlertService
+
+	// Notification serves the inbox of the users, filled with the
+	// notifications of the targets they follow, and of the replies to
+	// their ratings and their moderation, from Events.
+	Notification NotificationService
+
+	// Card serves the rating cards, refreshed from Events.
+	Card CardService
+
+	Tenant TenantService
+
+	// Organisation manages the organisations, the isolated workspaces
+	// of the customers of the deployment, see InRequest.
+	Organisation OrganisationService
+
+	// Policy manages the policies evaluated on the ratings.
+	Policy PolicyService
+
+	// TargetField manages the fields computed along with the stats of
+	// the targets.
+	TargetField TargetFieldService
+
+	// Category manages the categories of the targets, and the
+	// rules of their ratings.
+	Category TargetCategoryService
+
+	// Retention tells the retention policy of the ratings, and the
+	// ratings it changed, see ApplyRetention.
+	Retention RetentionService
+
+	// Metering meters the usage of the tenants, see Meter.
+	Metering MeteringService
+
+	// RatingQueue is only set when Config.WriteQueueDir is defined.
+	RatingQueue RatingQueue
+
+	// Events publishes the changes of the ratings, the reactions
+	// to them and the users, see events.RatingCreated and the
+	// other event types.
+	Events *events.Bus
+
+	db       *gorm.DB
+	jwtKeys  jwtKeys
+	policy   visibilityPolicy
+	cache    cache.Cache
+	loaders  map[string]*cache.Loader
+	sessions SessionStore
+	security SecurityEvents
+	auth     AuthProvider
+	quota    *ratingQuota
+	rules    *Rules
+	fields   *targetFieldEngine
+	clock    Clock
+
+	// attachments keeps the content of the attachments, if any.
+	attachments storage.Storage
+
+	// consentVersion is the current version of the data processing
+	// policy, see Config.ConsentPolicyVersion.
+	consentVersion string
+
+	// probation holds back the ratings of new accounts from the
+	// aggregates.
+	probation probation
 
-	db *gorm.DB
+	// verification verifies the ratings, and weights them in the stats.
+	verification verification
+
+	// retention is the retention policy of the ratings, see
+	// Config.Retention.
+	retention RetentionPolicy
+
+	// auditRetention is how long the audit log is kept, see
+	// Config.AuditRetention.
+	auditRetention time.Duration
+
+	// notifier notifies the followers of the targets.
+	notifier *notifier
+
+	// sandbox is set in the sandbox mode, see Config.Sandbox.
+	sandbox *sandbox
+
+	// userCache caches the users of the access tokens, if the cache
+	// is enabled.
+	userCache *userCache
+
+	// identities verifies the ID tokens of the users signing in with
+	// an OpenID Connect provider, if any.
+	identities IdentityProvider
+
+	// oauthClients are the clients of the authorization code grant,
+	// see Config.OAuthClients.
+	oauthClients OAuthClients
+
+	// invitationURL is the URL of the links of the invitations, see
+	// Config.InvitationURL.
+	invitationURL *url.URL
+
+	// omitUserRoles is set by Config.OmitUserRoles.
+	omitUserRoles bool
+
+	// metering is Metering, run by Meter.
+	metering *meteringService
+
+	// outbox publishes the events of the ratings once their
+	// changes are committed.
+	outbox *outbox
+
+	// provisioner provisions and deletes the tenants in the
+	// background.
+	provisioner *tenantProvisioner
+
+	// changes are the changes made in the transaction of the
+	// services, if any, see WithTransaction.
+	changes *txChanges
+
+	// limits enforces the limits of the tenant on the services running
+	// on its schema, if any, see InTenant.
+	limits *tenantLimits
+
+	// org is the organisation whose users, roles and ratings the
+	// services reach, if not zero, see InRequest.
+	org int64
+
+	// requests is the pool of the statements of the requests, see
+	// InRequest: a pool of its own, whose sessions have the statement
+	// timeout set by Config.StatementTimeout, or db if there is none.
+	requests *gorm.DB
 }
 
 // Config defines configuration options for instantiating new Services values.
@@ -23,12 +195,280 @@ type Config struct {
 	// identify users.
 	JWTSecret []byte
 
+	// PreviousJWTSecret is the secret JWTSecret replaced,
+	// if any. The tokens it signed stay valid until
+	// PreviousJWTSecretExpiry, so the users keep their
+	// sessions while the secret is rotated.
+	PreviousJWTSecret       []byte
+	PreviousJWTSecretExpiry time.Time
+
+	// TrustTokenPermissions validates the access tokens
+	// with the permissions they carry, without reading
+	// their user and its role on every request. The
+	// changes to the users and roles, deactivations
+	// included, then only apply to the tokens issued or
+	// refreshed after them.
+	TrustTokenPermissions bool
+
+	// TokenPermissionNames adds the names of the
+	// permissions of the role of the user to the access
+	// tokens, besides their bits, so the clients can read
+	// them without fetching the role.
+	TokenPermissionNames bool
+
+	// AccessTokenTTL and RefreshTokenTTL are the time the
+	// access and refresh tokens are valid, defaulting to
+	// DefaultAccessTokenTTL and DefaultRefreshTokenTTL.
+	// AccessTokenTTL can't be shorter than
+	// MinAccessTokenTTL, nor RefreshTokenTTL shorter than
+	// the access tokens.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// RememberTokenTTL is the time the refresh tokens of
+	// the logins remembered are valid, see TokenOptions,
+	// DefaultRememberTokenTTL if zero. It can't be
+	// shorter than RefreshTokenTTL.
+	RememberTokenTTL time.Duration
+
+	// OmitUserRoles lists the users without their role,
+	// sparing the query reading the roles when the users
+	// are listed by ID or searched.
+	OmitUserRoles bool
+
+	// OAuthClients are the clients allowed to use the
+	// authorization code grant, with their redirect URIs.
+	// The grant can't be used if empty.
+	OAuthClients OAuthClients
+
+	// IdentityProvider verifies the ID tokens of the users
+	// signing in with an OpenID Connect provider, who are
+	// created with the default role the first time. Users
+	// can't sign in with a provider if nil.
+	IdentityProvider IdentityProvider
+
+	// InvitationURL is the URL of the page where the
+	// invitees accept their invitation, which gets its
+	// token as the token query parameter. The invitations
+	// are only returned with their token if nil.
+	InvitationURL *url.URL
+
 	// DatabaseDSL is the database connection string to
 	// the database. Currently, it only accepts Postgres.
 	DatabaseDSL string
+
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime
+	// tune the pool of database connections, see
+	// sql.DB. They default to DefaultMaxOpenConns,
+	// DefaultMaxIdleConns and DefaultConnMaxLifetime.
+	// A negative value removes the limit, or keeps no
+	// idle connections for MaxIdleConns.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// ConnectTimeout is how long the connection to the
+	// database is retried for when the services start,
+	// with an exponential backoff, while the database is
+	// not ready. It is only tried once if zero.
+	// OnConnectRetry, if not nil, is called with the
+	// error of each attempt retried, and the wait before
+	// the next one.
+	ConnectTimeout time.Duration
+	OnConnectRetry func(err error, wait time.Duration)
+
+	// StatementTimeout, if not zero, cancels the statements
+	// of the requests that run for longer, so the slow
+	// queries of a request don't outlive its deadline. The
+	// request then fails with an error reported by
+	// IsTimeout. It only applies to the services of the
+	// requests, see InRequest, which run their statements
+	// on a pool of connections of their own, with the
+	// limits of the other one: the background jobs, the
+	// tasks and the migrations are not limited.
+	StatementTimeout time.Duration
+
+	// Migrate applies the pending migrations when the
+	// services start. Instances starting at the same time
+	// are coordinated so only one of them migrates.
+	// Otherwise, ErrSchemaOutdated is returned if any
+	// migration is pending, or the last one failed.
+	Migrate bool
+
+	// AdminPassword is the password of the admin user,
+	// only used to create it on the first start. A random
+	// password is generated if empty, and passed to
+	// OnAdminPasswordGenerated.
+	AdminPassword string
+
+	// AdminPasswordMaxAge is the time the admin user can
+	// keep the password it was created with. Afterwards,
+	// NewServices calls OnAdminPasswordNotChanged on
+	// every start until the password is changed. Defaults
+	// to DefaultAdminPasswordMaxAge.
+	AdminPasswordMaxAge time.Duration
+
+	// OnAdminPasswordGenerated is called with the password
+	// generated for the admin user, which is not stored
+	// anywhere else. May be nil.
+	OnAdminPasswordGenerated func(password string)
+
+	// OnAdminPasswordNotChanged is called with
+	// ErrAdminPasswordNotChanged when the admin user kept
+	// its password for longer than AdminPasswordMaxAge.
+	// May be nil.
+	OnAdminPasswordNotChanged func(err error)
+
+	// Cache is used to cache frequently read values,
+	// like the ratings of each target. Nothing is
+	// cached if nil.
+	Cache cache.Cache
+
+	// Sessions tracks the tokens issued to the users,
+	// which allows revoking them and listing the active
+	// sessions of each user. Sessions are not tracked
+	// if nil.
+	Sessions SessionStore
+
+	// AuthProvider checks the passwords of the users it
+	// knows, like the ones of a directory, before the
+	// database. The users it knows are created on their
+	// first login, and given the role it tells. Only the
+	// database checks them if nil.
+	AuthProvider AuthProvider
+
+	// SecurityEvents receives the security events, like
+	// the failed logins, so the brute-force attacks can
+	// be alerted on. They are not reported if nil. It is
+	// closed along with the services if it is an
+	// io.Closer.
+	SecurityEvents SecurityEvents
+
+	// DefaultRoles are created when the services start,
+	// and when the tenants are provisioned, besides the
+	// admin and user roles, unless a role already has
+	// their label.
+	DefaultRoles []DefaultRole
+
+	// Sandbox allows erasing all the data with
+	// Services.ResetSandbox, for deployments where the
+	// integrators test the API. AdminPassword must be set,
+	// so the admin user created again keeps it.
+	Sandbox bool
+
+	// VisibilityRules restrict the ratings the users of
+	// each role can read. See VisibilityRule.
+	VisibilityRules []VisibilityRule
+
+	// Rules are the custom validation rules on the users,
+	// roles and ratings. The rules.Default rules are used if
+	// nil.
+	Rules *rules.Rules
+
+	// SavedQueries are the queries that can be run with
+	// the QueryService. See ParseSavedQueries.
+	SavedQueries map[string]SavedQuery
+
+	// WriteQueueDir enables the write-behind queue for
+	// the creation of ratings when defined. It is the
+	// directory where queued ratings are kept until they
+	// are persisted.
+	WriteQueueDir string
+
+	// OnQueueError is called with the errors found by the
+	// write-behind queue workers. May be nil.
+	OnQueueError func(error)
+
+	// ConsentPolicyVersion is the version of the data
+	// processing policy the users must accept before
+	// submitting ratings. Nothing must be accepted if
+	// empty.
+	ConsentPolicyVersion string
+
+	// RatingQuota limits the ratings each user can create
+	// in a period of time. Ratings are not limited if its
+	// Max is zero.
+	RatingQuota RatingQuota
+
+	// NewAccountPeriod holds back the ratings created by
+	// accounts less than NewAccountPeriod old from the
+	// aggregates, like the stats of the targets, until a
+	// moderator reviews them. Nothing new is held back if
+	// zero.
+	NewAccountPeriod time.Duration
+
+	// Tracer records a span for each database query, and
+	// may be nil. See tracing.InstrumentGorm.
+	Tracer *tracing.Tracer
+
+	// Clock tells the time the tokens expire at, the
+	// ratings, their revisions, the consents, the replies,
+	// the notifications and the other records are dated
+	// with, the rating quota, the probation of the new
+	// accounts and the age of the admin password are
+	// counted from, and the day the API calls are metered
+	// in. The clock of the system is used if nil.
+	Clock Clock
+
+	// Notifiers deliver the notifications of the targets
+	// followed, by channel, like ChannelEmail. Only the
+	// channels defined, and ChannelInApp, can be
+	// subscribed to.
+	Notifiers map[string]NotificationSender
+
+	// OnNotificationError is called with the errors found
+	// notifying the followers of the targets, and the
+	// authors of the ratings. May be nil.
+	OnNotificationError func(error)
+
+	// OnCardError is called with the errors found
+	// refreshing the rating cards. May be nil.
+	OnCardError func(error)
+
+	// OnTenantError is called with the errors found
+	// provisioning or deleting the tenants. May be nil.
+	OnTenantError func(error)
+
+	// MeteringGrace is the time the other instances may
+	// take to write the API calls of a day they counted,
+	// before Meter aggregates it: the interval it is run
+	// with, usually.
+	MeteringGrace time.Duration
+
+	// Billing receives the daily usage of the tenants, and
+	// may be nil. See BillingProvider.
+	Billing BillingProvider
+
+	// Attachments keeps the content of the files attached
+	// to the ratings. Files can't be attached if nil.
+	Attachments storage.Storage
+
+	// TransactionVerifier tells whether the users completed
+	// a transaction with the targets they rate, which
+	// makes their ratings verified. No rating is verified
+	// if nil.
+	TransactionVerifier TransactionVerifier
+
+	// VerifiedWeight is the weight of the scores of the
+	// verified ratings in the verified weighted average
+	// of the stats, the others weighing 1. Defaults to
+	// DefaultVerifiedWeight.
+	VerifiedWeight float64
+
+	// Retention is the retention policy of the old
+	// ratings, applied by Services.ApplyRetention. The
+	// tenants can override it, see Tenant.Retention. The
+	// ratings are kept as they are if its Days is zero.
+	Retention RetentionPolicy
+
+	// AuditRetention, if not zero, is how long the entries
+	// of the audit log are kept, see Services.PruneAudit.
+	AuditRetention time.Duration
 }
 
-// NewServices instantiate and configures a new Services value.
+// NewServices instantiate and configures a new Services value. The database
+// must have been migrated with Migrate, or c.Migrate must be set, otherwise
+// ErrSchemaOutdated is returned.
 func NewServices(c *Config) (*Services, error) {
 	var s Services
 
@@ -37,36 +477,286 @@ func NewServices(c *Config) (*Services, error) {
 		return nil, wrap("invalid configuration", err)
 	}
 
-	s.db, err = gorm.Open("postgres", c.DatabaseDSL)
+	s.db, err = newConnector(c, c.DatabaseDSL).connect()
 	if err != nil {
 		return nil, wrap("failed to connect to postgres", err)
 	}
 
-	err = s.autoMigrate()
+	c.configurePool(s.db.DB())
+	tracing.InstrumentGorm(s.db, c.Tracer)
+
+	s.requests = s.db
+	if c.StatementTimeout > 0 {
+		s.requests, err = newConnector(c, statementTimeoutDSL(c.DatabaseDSL, c.StatementTimeout)).connect()
+		if err != nil {
+			return nil, wrap("failed to connect to postgres", err)
+		}
+
+		c.configurePool(s.requests.DB())
+		tracing.InstrumentGorm(s.requests, c.Tracer)
+	}
+
+	migrations, err := loadMigrations(migrationFiles)
 	if err != nil {
-		return nil, wrap("can't migrate", err)
+		return nil, wrap("can't load migrations", err)
 	}
 
-	s.Role = NewRoleService(s.db)
+	if c.Migrate {
+		_, err = migrateAll(s.db)
+		if err != nil {
+			return nil, wrap("can't migrate", err)
+		}
+	}
 
-	s.User, err = NewUserService(s.db, s.Role, c.JWTSecret)
+	err = checkSchema(s.db, migrations)
+	if err != nil {
+		return nil, wrap("can't use the database", err)
+	}
+
+	s.cache = c.Cache
+	s.loaders = make(map[string]*cache.Loader)
+
+	s.clock = c.Clock
+	if s.clock == nil {
+		s.clock = SystemClock
+	}
+
+	s.omitUserRoles = c.OmitUserRoles
+
+	if c.Sandbox {
+		s.sandbox = &sandbox{adminPassword: c.AdminPassword, roles: c.DefaultRoles}
+	}
+
+	validation := c.Rules
+	if validation == nil {
+		validation = rules.Default
+	}
+
+	// the policies run after the custom rules, on the ratings they
+	// accepted
+	engine := &policyEngine{db: s.db, clock: s.clock}
+	s.Policy = newPolicyService(s.db, engine)
+	s.rules = customRules(validation)
+	s.rules.AddRating("", engine.checkRating)
+
+	s.fields = &targetFieldEngine{db: s.db}
+	s.TargetField = newTargetFieldService(s.db, s.fields, s.clock)
+
+	s.Role = newRoleService(s.db, s.rules)
+	if s.cache != nil {
+		s.loaders["roles"] = cache.NewLoader(s.cache)
+		s.Role = newRoleCache(s.Role, s.loaders["roles"])
+	}
+
+	s.Events = events.NewBus(0)
+	s.outbox = &outbox{db: s.db, bus: s.Events}
+
+	s.jwtKeys = jwtKeys{
+		secret:           c.JWTSecret,
+		previous:         c.PreviousJWTSecret,
+		previousUntil:    c.PreviousJWTSecretExpiry,
+		trustPermissions: c.TrustTokenPermissions,
+		permissionNames:  c.TokenPermissionNames,
+		accessTTL:        c.AccessTokenTTL,
+		refreshTTL:       c.RefreshTokenTTL,
+		rememberTTL:      c.RememberTokenTTL,
+	}
+	s.sessions = c.Sessions
+	s.security = c.SecurityEvents
+	s.auth = c.AuthProvider
+	s.User, err = newUserService(s.db, s.Role, s.jwtKeys, s.sessions, s.security, s.auth, s.rules, s.clock, s.omitUserRoles)
 	if err != nil {
 		return nil, wrap("can't start UserService", err)
 	}
+	s.User = newUserEvents(s.User, s.Events)
+	if s.cache != nil {
+		s.loaders["tokens"] = cache.NewLoader(s.cache)
+		s.userCache = newUserCache(s.User, s.loaders["tokens"], s.Role, s.clock)
+		s.User = s.userCache
+	}
+	s.User = &userRatingChanges{UserService: s.User, targets: s.ratedTargets, changed: func(target int64) {
+		s.ratingChanged(Rating{Target: target})
+	}}
+
+	policy := newVisibilityPolicy(c.VisibilityRules)
+	s.policy = policy
+
+	s.quota = newRatingQuota(s.db, c.RatingQuota, s.clock)
+	s.probation = probation{period: c.NewAccountPeriod, clock: s.clock}
+	s.verification = verification{verifier: c.TransactionVerifier, weight: c.VerifiedWeight}
+	s.Rating = newRatingService(s.db, s.User, policy, s.quota, s.probation, s.rules, s.fields, s.clock, s.outbox, s.verification)
+	if c.Attachments != nil {
+		s.attachments = c.Attachments
+		s.Attachment = newAttachmentService(s.db, s.attachments, s.clock)
+		s.Rating = &ratingAttachments{RatingService: s.Rating, attachments: s.Attachment, files: s.attachments}
+	}
+	if s.cache != nil {
+		s.loaders["ratings"] = cache.NewLoader(s.cache)
+		s.Rating = newRatingCache(s.Rating, s.loaders["ratings"])
+	}
+	s.Sync = newSyncService(s.db, policy)
+	s.Query = newQueryService(s.db, c.SavedQueries, c.StatementTimeout)
+	s.Reputation = newReputationService(s.db, s.probation, s.ratingModerated, s.outbox)
+	s.Reputation = newReputationEvents(s.Reputation, s.Events)
+	s.consentVersion = c.ConsentPolicyVersion
+	s.Consent = newConsentService(s.db, s.consentVersion, s.clock)
+	s.oauthClients = c.OAuthClients
+	s.AuthCode = newAuthCodeService(s.db, s.User, s.oauthClients, s.clock)
+	if c.IdentityProvider != nil {
+		s.identities = c.IdentityProvider
+		s.Identity = newIdentityService(s.db, s.User, s.identities, s.clock)
+	}
+	s.invitationURL = c.InvitationURL
+	s.Invitation = newInvitationService(s.db, s.User, s.Role, s.jwtKeys, s.invitationURL, s.clock)
+	s.Audit = newAuditService(s.db, s.clock)
+	s.auditRetention = c.AuditRetention
+	s.Campaign = newCampaignService(s.db, s.clock)
+	s.Category = newTargetCategoryService(s.db, s.clock)
+	s.Organisation = NewOrganisationService(s.db)
+	s.retention = c.Retention
+	s.Retention = newRetentionService(s.db, s.retention)
+	s.Reply = newReplyEvents(newReplyService(s.db, s.clock), s.Events)
+
+	stats := &ratingGorm{db: s.db, probation: s.probation}
+	channels := make([]string, 0, len(c.Notifiers))
+	for ch := range c.Notifiers {
+		channels = append(channels, ch)
+	}
+	s.Subscription = newSubscriptionService(s.db, stats, channels, s.clock)
+	n := &notifier{
+		db:        s.db,
+		ratings:   stats,
+		policy:    policy,
+		probation: s.probation,
+		senders:   c.Notifiers,
+		onError:   c.OnNotificationError,
+	}
+	s.notifier = n
+	s.Events.Subscribe(n.handle, events.RatingCreated, events.RatingUpdated)
+	s.Alert = newAlertService(s.db, n, channels, s.clock)
+
+	s.Notification = newNotificationService(s.db, s.clock)
+	ib := &inbox{db: s.db, clock: s.clock, ratings: stats, onError: c.OnNotificationError}
+	s.Events.Subscribe(ib.handle, events.ReplyCreated, events.RatingModerated)
+
+	s.provisioner = &tenantProvisioner{
+		db:           s.db,
+		clock:        s.clock,
+		defaultRoles: c.DefaultRoles,
+		onError:      c.OnTenantError,
+		onChanged:    s.tenantChanged,
+	}
+	s.Tenant = newTenantService(s.db, s.provisioner)
+	if s.cache != nil {
+		s.loaders["tenants"] = cache.NewLoader(s.cache)
+		s.Tenant = newTenantCache(s.Tenant, s.loaders["tenants"])
+	}
+
+	s.metering = newMeteringService(s.db, c.Billing, s.clock)
+	s.metering.grace = c.MeteringGrace
+	s.Metering = s.metering
 
-	s.Rating = NewRatingService(s.db, s.User)
+	s.Card = newCardService(s.db, policy)
+	cp := &cardProjector{cards: s.Card, onError: c.OnCardError}
+	s.Events.Subscribe(cp.handle,
+		events.RatingCreated,
+		events.RatingUpdated,
+		events.RatingModerated,
+		events.ReactionChanged,
+		events.UserUpdated,
+	)
 
-	err = s.createDefaultValues()
+	if c.WriteQueueDir != "" {
+		s.RatingQueue, err = NewRatingQueue(s.db, &QueueConfig{
+			Dir:         c.WriteQueueDir,
+			OnError:     c.OnQueueError,
+			OnPersisted: s.ratingPersisted,
+			outbox:      s.outbox,
+			quota:       s.quota,
+			rules:       s.rules,
+			probation:   s.probation,
+			verifier:    s.verification.verifier,
+			clock:       s.clock,
+		})
+		if err != nil {
+			return nil, wrap("can't start RatingQueue", err)
+		}
+	}
+
+	generated, err := s.createDefaultValues(c.AdminPassword, c.DefaultRoles)
 	if err != nil {
 		return nil, wrap("can't insert default values", err)
 	}
+	if generated != "" && c.OnAdminPasswordGenerated != nil {
+		c.OnAdminPasswordGenerated(generated)
+	}
+
+	maxAge := c.AdminPasswordMaxAge
+	if maxAge == 0 {
+		maxAge = DefaultAdminPasswordMaxAge
+	}
+
+	err = checkAdminPassword(s.db, maxAge, s.clock)
+	if xerrors.Is(err, ErrAdminPasswordNotChanged) {
+		if c.OnAdminPasswordNotChanged != nil {
+			c.OnAdminPasswordNotChanged(err)
+		}
+	} else if err != nil {
+		return nil, wrap("can't check the admin password", err)
+	}
 
 	return &s, nil
 }
 
 // Close release all resources related to s.
 func (s *Services) Close() error {
-	err := s.db.Close()
+	// the calls counted since the last run
+	err := s.Metering.Flush()
+	if err != nil {
+		return wrap("failed to flush the api calls", err)
+	}
+
+	s.provisioner.wait()
+
+	if s.RatingQueue != nil {
+		err := s.RatingQueue.Close()
+		if err != nil {
+			return wrap("failed to stop the rating queue", err)
+		}
+	}
+
+	// the events queued are handled while the database is still open
+	s.Events.Close()
+
+	if cl, ok := s.cache.(io.Closer); ok {
+		err := cl.Close()
+		if err != nil {
+			return wrap("failed to close the cache", err)
+		}
+	}
+
+	if cl, ok := s.sessions.(io.Closer); ok {
+		err := cl.Close()
+		if err != nil {
+			return wrap("failed to close the session store", err)
+		}
+	}
+
+	if cl, ok := s.security.(io.Closer); ok {
+		err := cl.Close()
+		if err != nil {
+			return wrap("failed to close the security events", err)
+		}
+	}
+
+	if s.requests != s.db {
+		err = s.requests.Close()
+		if err != nil {
+			return wrap("failed to close database connections", err)
+		}
+	}
+
+	err = s.db.Close()
 	if err != nil {
 		return wrap("failed to close database connections", err)
 	}
@@ -74,41 +764,142 @@ func (s *Services) Close() error {
 	return nil
 }
 
-// autoMigrate creates or updates the database schema.
-func (s *Services) autoMigrate() error {
-	err := s.db.
-		AutoMigrate(&Role{}).
-		AutoMigrate(&User{}).AddForeignKey("role_id", "roles(id)", "RESTRICT", "RESTRICT").
-		AutoMigrate(&Rating{}).AddForeignKey("user_id", "users(id)", "RESTRICT", "RESTRICT").
-		Error
-	if err != nil {
-		return err
+// CacheStats returns the hit and miss counters of each cached service, by name.
+// It is empty if Config.Cache is nil.
+func (s *Services) CacheStats() map[string]cache.Stats {
+	stats := make(map[string]cache.Stats, len(s.loaders))
+	for name, l := range s.loaders {
+		stats[name] = l.Stats()
 	}
 
-	return nil
+	return stats
+}
+
+// Stats returns the statistics of the pool of database connections, added up
+// with the ones of the pool of the requests, if any, see
+// Config.StatementTimeout.
+func (s *Services) Stats() sql.DBStats {
+	st := s.db.DB().Stats()
+	if s.requests == s.db {
+		return st
+	}
+
+	rst := s.requests.DB().Stats()
+	st.MaxOpenConnections += rst.MaxOpenConnections
+	st.OpenConnections += rst.OpenConnections
+	st.InUse += rst.InUse
+	st.Idle += rst.Idle
+	st.WaitCount += rst.WaitCount
+	st.WaitDuration += rst.WaitDuration
+	st.MaxIdleClosed += rst.MaxIdleClosed
+	st.MaxLifetimeClosed += rst.MaxLifetimeClosed
+	return st
+}
+
+// RateLimited returns the number of ratings rejected because their authors
+// exceeded Config.RatingQuota since the services started.
+func (s *Services) RateLimited() uint64 {
+	return s.quota.rejections()
+}
+
+// ratingChanged invalidates the cached values of the target of a rating
+// changed outside of the RatingService, like the ratings created by the
+// write-behind queue or moderated.
+func (s *Services) ratingChanged(r Rating) {
+	if rc, ok := s.Rating.(*ratingCache); ok {
+		rc.invalidate(r.Target)
+	}
+}
+
+// ratedTargets returns the targets rated by the user with the given ID.
+func (s *Services) ratedTargets(userID int64) ([]int64, error) {
+	return ratedTargets(s.db, userID)
+}
+
+// tenantChanged invalidates the cached values of a tenant changed in the
+// background, like the tenants provisioned.
+func (s *Services) tenantChanged(t Tenant) {
+	if tc, ok := s.Tenant.(*tenantCache); ok {
+		tc.invalidate(t.Hostnames...)
+	}
+}
+
+// ratingModerated is called with the ratings moderated. Their events are
+// published from the outbox.
+func (s *Services) ratingModerated(r Rating) {
+	s.ratingChanged(r)
+}
+
+// ratingPersisted is called with the ratings created by the write-behind queue,
+// whose events were written to the outbox.
+func (s *Services) ratingPersisted(r Rating) {
+	s.ratingChanged(r)
+	s.outbox.wake()
 }
 
 // createDefaultValues uses the instantiated services to add the set of fixed, default
-// values that the database is supposed to have.
-func (s *Services) createDefaultValues() error {
+// values that the database is supposed to have, the permission upgrades and the
+// roles configured. The admin user is created with adminPassword, or a random
+// password that is returned if it is empty.
+func (s *Services) createDefaultValues(adminPassword string, roles []DefaultRole) (string, error) {
+	err := createDefaultRoles(s.db)
+	if err != nil {
+		return "", err
+	}
+
+	// before the configured roles are created, so they only have the
+	// permissions they are declared with
+	err = s.upgradeAllPermissions()
+	if err != nil {
+		return "", err
+	}
+
+	created, err := createConfiguredRoles(s.db, roles)
+	if created > 0 && s.cache != nil {
+		s.cache.Delete(allRolesKey)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return createAdmin(s.db, adminPassword, s.clock)
+}
+
+// createDefaultRoles adds the admin and user roles to db, if missing. The admin
+// role has every permission, but the ones permissionUpgrades exclude.
+func createDefaultRoles(db *gorm.DB) error {
 	// warning: non standard SQL used to update sequence counters
-	err := s.db.
-		Save(&Role{ID: 1, Label: "admin", Permissions: Permissions(-1)}).
-		Save(&Role{ID: 2, Label: "user", Permissions: Permissions(0)}).
+	err := db.
+		Save(&Role{ID: 1, Label: "admin", Permissions: adminPermissions(permissionUpgrades), Version: 1}).
+		Save(&Role{ID: 2, Label: "user", Permissions: Permissions(0), Version: 1}).
 		Exec("DO $$ BEGIN IF (SELECT last_value = 1 FROM roles_id_seq) THEN ALTER SEQUENCE roles_id_seq RESTART WITH 3; END IF; END; $$").
 		Error
 	if err != nil {
 		return wrapi("failed to create default values when migrating", err)
 	}
 
-	err = s.db.Save(&User{ID: 1, Active: true, Email: "admin@admin.com", FirstName: "admin", Password: "$2y$12$5wXQu8UknGQxEvdATbjvUORLJAQXYfB7tLCqqISFZqjlXz3f9FYwO", RoleID: 1}).
-		Exec("DO $$ BEGIN IF (SELECT last_value = 1 FROM users_id_seq) THEN ALTER SEQUENCE users_id_seq RESTART WITH 2; END IF; END; $$").
-		Error
-	if err != nil {
-		return wrapi("failed to create default roles when migrating", err)
+	return nil
+}
+
+// configurePool applies the limits of the pool of database connections to db.
+func (c *Config) configurePool(db *sql.DB) {
+	maxOpen := c.MaxOpenConns
+	if maxOpen == 0 {
+		maxOpen = DefaultMaxOpenConns
 	}
+	db.SetMaxOpenConns(maxOpen)
 
-	return nil
+	maxIdle := c.MaxIdleConns
+	if maxIdle == 0 {
+		maxIdle = DefaultMaxIdleConns
+	}
+	db.SetMaxIdleConns(maxIdle)
+
+	lifetime := c.ConnMaxLifetime
+	if lifetime == 0 {
+		lifetime = DefaultConnMaxLifetime
+	}
+	db.SetConnMaxLifetime(lifetime)
 }
 
 // check does basic verification on configuration keys. It will not
@@ -118,6 +909,29 @@ func (c *Config) check() error {
 	if len(c.JWTSecret) < 32 {
 		return ErrJWTSecretTooShort
 	}
+	if len(c.PreviousJWTSecret) > 0 && len(c.PreviousJWTSecret) < 32 {
+		return ErrJWTSecretTooShort
+	}
+	access, refresh, remember := jwtKeys{accessTTL: c.AccessTokenTTL, refreshTTL: c.RefreshTokenTTL,
+		rememberTTL: c.RememberTokenTTL}.ttls()
+	if c.AccessTokenTTL < 0 || access < MinAccessTokenTTL {
+		return wrap("the access token TTL can't be shorter than "+MinAccessTokenTTL.String(), nil)
+	}
+	if c.RefreshTokenTTL < 0 || refresh < access {
+		return wrap("the refresh token TTL can't be shorter than the access token TTL", nil)
+	}
+	if c.RememberTokenTTL < 0 || remember < refresh {
+		return wrap("the remember token TTL can't be shorter than the refresh token TTL", nil)
+	}
+	if c.Sandbox && c.AdminPassword == "" {
+		return wrap("the sandbox mode requires an admin password", nil)
+	}
+	if c.VerifiedWeight < 0 {
+		return wrap("the verified weight can't be negative", nil)
+	}
+	if c.Retention.validate("") != nil {
+		return wrap("invalid retention policy", c.Retention.validate(""))
+	}
 
 	return nil
 }
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/xerrors"
+)
+
+// SessionStore keeps track of the sessions started by users, that is, of the
+// refresh tokens that were issued and have not been used or revoked yet. It
+// allows revoking tokens before they expire.
+//
+// Every refresh token can only be used once: refreshing a session revokes it
+// and starts a new one.
+type SessionStore interface {
+	// Add stores s as an active session until s.ExpiresAt.
+	Add(s Session) error
+
+	// Get retrieves an active session of a user by ID. ErrNotFound is
+	// returned if the session does not exist, has expired or was revoked.
+	Get(userID int64, id string) (Session, error)
+
+	// ByUser retrieves the active sessions of a user, sorted by creation
+	// time.
+	ByUser(userID int64) ([]Session, error)
+
+	// Revoke ends a session of a user by ID. ErrNotFound is returned if
+	// the session does not exist, has expired or was already revoked.
+	Revoke(userID int64, id string) error
+
+	// RevokeAll ends all the sessions of a user.
+	RevokeAll(userID int64) error
+}
+
+// A Session represents a set of tokens issued to a user.
+type Session struct {
+	// ID identifies the session, and is the JWT ID of its tokens.
+	ID string `json:"id"`
+
+	// UserID is the ID of the user the tokens were issued to.
+	UserID int64 `json:"userId"`
+
+	// UserAgent is the User-Agent of the client the session was started
+	// by, which tells the device it runs on.
+	UserAgent string `json:"userAgent,omitempty"`
+
+	// CreatedAt is the time the user signed in. The sessions started when
+	// refreshing tokens keep the time of the session refreshed.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// LastUsedAt is the time the tokens were issued, as the session was
+	// started or refreshed.
+	LastUsedAt time.Time `json:"lastUsedAt"`
+
+	// ExpiresAt is the time the refresh token expires.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// maxUserAgentSize is the size the user agents of the sessions are truncated
+// to.
+const maxUserAgentSize = 255
+
+// A SessionClient describes the client tokens are issued to, which is recorded
+// in the session they start.
+type SessionClient struct {
+	// UserAgent is the User-Agent header of the client.
+	UserAgent string
+
+	// IP is the address of the client, only reported in the security
+	// events, see SecurityEvents.
+	IP string
+}
+
+// newSessionID generates a random session ID.
+func newSessionID() (string, error) {
+	var id [16]byte
+	_, err := rand.Read(id[:])
+	if err != nil {
+		return "", wrap("could not generate session ID", err)
+	}
+
+	return hex.EncodeToString(id[:]), nil
+}
+
+// redisSessionStore is a SessionStore backed by Redis, which allows sharing the
+// sessions between multiple instances of the application. Each session is kept
+// in its own key, expiring with its refresh token, and the IDs of the sessions
+// of each user are kept in a set.
+type redisSessionStore struct {
+	r      redis.UniversalClient
+	prefix string
+}
+
+// NewRedisSessionStore instantiates a new SessionStore implementation with r as
+// the backing Redis server. Every key is prefixed with prefix.
+func NewRedisSessionStore(r *cache.Redis, prefix string) SessionStore {
+	return &redisSessionStore{r: r.Client(), prefix: prefix}
+}
+
+func (rs *redisSessionStore) sessionKey(userID int64, id string) string {
+	return rs.prefix + "session:" + strconv.FormatInt(userID, 10) + ":" + id
+}
+
+func (rs *redisSessionStore) userKey(userID int64) string {
+	return rs.prefix + "sessions:" + strconv.FormatInt(userID, 10)
+}
+
+func (rs *redisSessionStore) Add(s Session) error {
+	ttl := time.Until(s.ExpiresAt).Truncate(time.Millisecond)
+	if ttl < time.Millisecond {
+		return nil
+	}
+
+	b, err := json.Marshal(&s)
+	if err != nil {
+		return wrap("could not encode session", err)
+	}
+
+	// the set lives as long as the latest session of the user
+	_, err = rs.r.TxPipelined(context.Background(), func(p redis.Pipeliner) error {
+		p.Set(context.Background(), rs.sessionKey(s.UserID, s.ID), b, ttl)
+		p.SAdd(context.Background(), rs.userKey(s.UserID), s.ID)
+		p.PExpire(context.Background(), rs.userKey(s.UserID), ttl)
+		return nil
+	})
+	if err != nil {
+		return wrap("could not store session", err)
+	}
+
+	return nil
+}
+
+func (rs *redisSessionStore) Get(userID int64, id string) (Session, error) {
+	b, err := rs.r.Get(context.Background(), rs.sessionKey(userID, id)).Bytes()
+	if xerrors.Is(err, redis.Nil) {
+		return Session{}, ErrNotFound
+	} else if err != nil {
+		return Session{}, wrap("could not get session", err)
+	}
+
+	var s Session
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return Session{}, wrap("could not decode session", err)
+	}
+
+	return s, nil
+}
+
+func (rs *redisSessionStore) ByUser(userID int64) ([]Session, error) {
+	ids, err := rs.members(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sessions []Session
+		expired  []interface{}
+	)
+
+	for _, id := range ids {
+		s, err := rs.Get(userID, id)
+		if xerrors.Is(err, ErrNotFound) {
+			expired = append(expired, id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	// forget the IDs of the sessions that expired
+	if len(expired) > 0 {
+		err = rs.r.SRem(context.Background(), rs.userKey(userID), expired...).Err()
+		if err != nil {
+			return nil, wrap("could not remove expired sessions", err)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+func (rs *redisSessionStore) Revoke(userID int64, id string) error {
+	n, err := rs.r.Del(context.Background(), rs.sessionKey(userID, id)).Result()
+	if err != nil {
+		return wrap("could not revoke session", err)
+	}
+
+	err = rs.r.SRem(context.Background(), rs.userKey(userID), id).Err()
+	if err != nil {
+		return wrap("could not remove revoked session", err)
+	}
+
+	// only one of the concurrent revocations of a session deletes it
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (rs *redisSessionStore) RevokeAll(userID int64) error {
+	ids, err := rs.members(userID)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{rs.userKey(userID)}
+	for _, id := range ids {
+		keys = append(keys, rs.sessionKey(userID, id))
+	}
+
+	err = rs.r.Del(context.Background(), keys...).Err()
+	if err != nil {
+		return wrap("could not revoke sessions", err)
+	}
+
+	return nil
+}
+
+// Close closes the connections to the Redis server.
+func (rs *redisSessionStore) Close() error {
+	return rs.r.Close()
+}
+
+// members returns the IDs of the sessions of a user, including the expired
+// ones.
+func (rs *redisSessionStore) members(userID int64) ([]string, error) {
+	ids, err := rs.r.SMembers(context.Background(), rs.userKey(userID)).Result()
+	if err != nil {
+		return nil, wrap("could not get user sessions", err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// newTestSessionStore returns a redisSessionStore backed by an in-memory Redis
+// server, closed with t, prefixing the keys with "test:".
+func newTestSessionStore(t *testing.T) (*redisSessionStore, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	ss := &redisSessionStore{r: redis.NewClient(&redis.Options{Addr: mr.Addr()}), prefix: "test:"}
+	t.Cleanup(func() { ss.Close() })
+
+	return ss, mr
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	ss, mr := newTestSessionStore(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	s1 := Session{ID: "one", UserID: 7, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	s2 := Session{ID: "two", UserID: 7, CreatedAt: now, ExpiresAt: now.Add(2 * time.Hour)}
+
+	require.NoError(t, ss.Add(s2))
+	require.NoError(t, ss.Add(s1))
+	require.NoError(t, ss.Add(Session{ID: "other", UserID: 8, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+	t.Run("expiry", func(t *testing.T) {
+		assert.True(t, mr.Exists("test:session:7:one"))
+		assert.InDelta(t, float64(time.Hour), float64(mr.TTL("test:session:7:one")), float64(5*time.Second))
+		assert.InDelta(t, float64(time.Hour), float64(mr.TTL("test:sessions:7")), float64(5*time.Second))
+
+		err := ss.Add(Session{ID: "expired", UserID: 7, CreatedAt: now, ExpiresAt: now.Add(-time.Second)})
+		assert.NoError(t, err)
+		assert.False(t, mr.Exists("test:session:7:expired"))
+	})
+
+	t.Run("get", func(t *testing.T) {
+		s, err := ss.Get(7, "one")
+		require.NoError(t, err)
+		assert.Equal(t, s1.ID, s.ID)
+		assert.True(t, s1.CreatedAt.Equal(s.CreatedAt))
+
+		_, err = ss.Get(8, "one")
+		assert.True(t, xerrors.Is(err, ErrNotFound))
+	})
+
+	t.Run("byUser", func(t *testing.T) {
+		// sessions expired by Redis are removed from the user set
+		_, err := mr.SetAdd("test:sessions:7", "gone")
+		require.NoError(t, err)
+
+		sessions, err := ss.ByUser(7)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "one", sessions[0].ID)
+		assert.Equal(t, "two", sessions[1].ID)
+		members, _ := mr.Members("test:sessions:7")
+		assert.NotContains(t, members, "gone")
+
+		sessions, err = ss.ByUser(9)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		require.NoError(t, ss.Revoke(7, "one"))
+
+		err := ss.Revoke(7, "one")
+		assert.True(t, xerrors.Is(err, ErrNotFound))
+
+		_, err = ss.Get(7, "one")
+		assert.True(t, xerrors.Is(err, ErrNotFound))
+		members, _ := mr.Members("test:sessions:7")
+		assert.NotContains(t, members, "one")
+	})
+
+	t.Run("revokeAll", func(t *testing.T) {
+		require.NoError(t, ss.Add(s1))
+		require.NoError(t, ss.RevokeAll(7))
+
+		sessions, err := ss.ByUser(7)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		_, err = ss.Get(8, "other")
+		assert.NoError(t, err, "sessions of other users must be kept")
+	})
+
+	t.Run("redisError", func(t *testing.T) {
+		mr.SetError("test connection error")
+		defer mr.SetError("")
+
+		_, err := ss.Get(8, "other")
+		assert.Error(t, err)
+		assert.False(t, xerrors.Is(err, ErrNotFound))
+	})
+}
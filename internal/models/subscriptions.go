@@ -0,0 +1,337 @@
+package models
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/subscriptions.go -pkg modelstest . SubscriptionService:SubscriptionService
+
+// SubscriptionService defines a set of methods to be used when dealing with the
+// targets followed by the users, and the notifications they receive.
+type SubscriptionService interface {
+	SubscriptionDB
+}
+
+// SubscriptionDB defines how the service interacts with the database.
+type SubscriptionDB interface {
+	// Follow subscribes s.UserID to the ratings of s.Target, replacing any
+	// previous subscription to it. Channel is required, and WebhookURL is
+	// required by the webhook channel.
+	//
+	// A ValidationError is returned if any field is invalid, or the
+	// channel is not enabled.
+	Follow(s *Subscription) error
+
+	// Unfollow removes the subscription of a user to a target.
+	// ErrNotFound is returned if there is none.
+	Unfollow(userID, target int64) error
+
+	// ByUser retrieves the subscriptions of a user, sorted by target.
+	ByUser(userID int64) ([]Subscription, error)
+
+	// ByTarget retrieves the subscriptions to a target.
+	ByTarget(target int64) ([]Subscription, error)
+
+	// Notifications retrieves the latest in-app notifications of a user,
+	// newest first.
+	Notifications(userID int64) ([]Notification, error)
+}
+
+// Notification channels, as used in Subscription.Channel.
+const (
+	// ChannelInApp keeps the notifications in the application, see
+	// SubscriptionService.Notifications.
+	ChannelInApp = "inApp"
+
+	// ChannelEmail sends the notifications to the email of the user.
+	ChannelEmail = "email"
+
+	// ChannelWebhook posts the notifications as JSON to
+	// Subscription.WebhookURL.
+	ChannelWebhook = "webhook"
+)
+
+// Notification kinds, as used in Notification.Kind.
+const (
+	// NotificationNewRating tells that a rating was created for a target.
+	NotificationNewRating = "newRating"
+
+	// NotificationAverageBelow tells that the average score of a target
+	// dropped below Subscription.AverageBelow.
+	NotificationAverageBelow = "averageBelow"
+
+	// NotificationAverageAbove tells that the average score of a target
+	// rose above Subscription.AverageAbove.
+	NotificationAverageAbove = "averageAbove"
+
+	// NotificationAlert tells that the recent average score of a target
+	// dropped below the threshold of an AlertRule.
+	NotificationAlert = "alert"
+
+	// NotificationReply tells the author of a rating that it was replied
+	// to, see ReplyService.
+	NotificationReply = "reply"
+
+	// NotificationRatingApproved and NotificationRatingRemoved tell the
+	// author of a rating the outcome of its moderation, see
+	// ReputationService.Moderate.
+	NotificationRatingApproved = "ratingApproved"
+	NotificationRatingRemoved  = "ratingRemoved"
+)
+
+// maxNotifications is the number of notifications listed by
+// SubscriptionService.Notifications.
+const maxNotifications = 100
+
+// A Subscription makes a user follow the ratings of a target.
+type Subscription struct {
+	UserID int64 `gorm:"primary_key;type:bigint" json:"userId"`
+	Target int64 `gorm:"primary_key;type:bigint" json:"target"`
+
+	// Channel is how the notifications are delivered: ChannelInApp,
+	// ChannelEmail or ChannelWebhook.
+	Channel string `gorm:"size:16;not null" json:"channel"`
+
+	// WebhookURL is the http or https URL the notifications are posted
+	// to with the webhook channel.
+	WebhookURL string `gorm:"size:2048;not null" json:"webhookUrl,omitempty"`
+
+	// NewRatings notifies every rating created for the target, except the
+	// user's own.
+	NewRatings bool `gorm:"not null" json:"newRatings"`
+
+	// AverageBelow and AverageAbove notify when the average score of the
+	// target crosses them, see RatingStats.Average. They are ignored when
+	// nil.
+	AverageBelow *float64 `json:"averageBelow,omitempty"`
+	AverageAbove *float64 `json:"averageAbove,omitempty"`
+
+	// LastAverage is the average of the target when the subscription was
+	// last evaluated.
+	LastAverage *float64 `json:"-"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// TableName is the name of the table holding the subscriptions.
+func (Subscription) TableName() string {
+	return "target_subscriptions"
+}
+
+// A Notification tells a user about a target they follow, or about one of their
+// ratings.
+type Notification struct {
+	ID     int64 `gorm:"primary_key;type:bigserial" json:"id"`
+	UserID int64 `gorm:"type:bigint;not null" json:"userId"`
+
+	// Kind is NotificationNewRating, NotificationAverageBelow,
+	// NotificationAverageAbove, NotificationAlert, NotificationReply,
+	// NotificationRatingApproved or NotificationRatingRemoved.
+	Kind string `gorm:"size:32;not null" json:"kind"`
+
+	Target int64 `gorm:"type:bigint;not null" json:"target"`
+
+	// RatingID is the rating created, or the rating that made the average
+	// cross a threshold. Alerts have no rating.
+	RatingID *int64 `gorm:"type:bigint" json:"ratingId,omitempty"`
+	Score    *int   `gorm:"type:int" json:"score,omitempty"`
+
+	// AlertRuleID is the rule of the alerts.
+	AlertRuleID *int64 `gorm:"type:bigint" json:"alertRuleId,omitempty"`
+
+	// ReplyID is the reply of the NotificationReply notifications.
+	ReplyID *int64 `gorm:"type:bigint" json:"replyId,omitempty"`
+
+	// Average is the average score of the target after the rating, over
+	// the window of the rule of an alert, or when the author of a rating
+	// is notified about it.
+	Average float64 `gorm:"not null" json:"average"`
+
+	// EventID is the ID of the event of the rating notified, so the
+	// webhooks can recognise the notifications posted twice, as the
+	// events may be published twice, see events.Event. It is only sent to
+	// the webhooks.
+	EventID string `gorm:"-" json:"eventId,omitempty"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+
+	// ReadAt is when the user marked the notification as read, see
+	// NotificationService.MarkRead.
+	ReadAt *time.Time `gorm:"type:timestamptz" json:"readAt,omitempty"`
+}
+
+type subscriptionService struct {
+	SubscriptionDB
+}
+
+// NewSubscriptionService instantiates a new SubscriptionService implementation
+// with db as the backing database, accepting the channels given besides
+// ChannelInApp.
+func NewSubscriptionService(db *gorm.DB, channels ...string) SubscriptionService {
+	return newSubscriptionService(db, &ratingGorm{db: db}, channels, SystemClock)
+}
+
+// newSubscriptionService instantiates a new SubscriptionService implementation
+// that reads the averages of the targets from ratings, and dates the
+// subscriptions with clock.
+func newSubscriptionService(db *gorm.DB, ratings RatingDB, channels []string, clock Clock) SubscriptionService {
+	return &subscriptionService{
+		SubscriptionDB: &subscriptionValidator{
+			SubscriptionDB: &subscriptionGorm{db: db, ratings: ratings, clock: clock},
+			channels:       enabledChannels(channels),
+		},
+	}
+}
+
+// enabledChannels returns the set of the channels given, and ChannelInApp.
+func enabledChannels(channels []string) map[string]bool {
+	enabled := map[string]bool{ChannelInApp: true}
+	for _, c := range channels {
+		enabled[c] = true
+	}
+
+	return enabled
+}
+
+type subscriptionValidator struct {
+	SubscriptionDB
+
+	// channels are the channels enabled.
+	channels map[string]bool
+}
+
+func (sv *subscriptionValidator) Follow(s *Subscription) error {
+	if s.Target < 1 {
+		return ErrNotFound
+	}
+
+	ve := ValidationError{}
+	if s.UserID < 1 {
+		ve["userId"] = ErrRequired
+	}
+
+	validateChannel(ve, sv.channels, s.Channel, &s.WebhookURL)
+
+	if !s.NewRatings && s.AverageBelow == nil && s.AverageAbove == nil {
+		ve["newRatings"] = ErrRequired
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return sv.SubscriptionDB.Follow(s)
+}
+
+// validateChannel adds the errors of a notification channel, and of its webhook
+// URL, to ve. The URL is cleared if the channel is not ChannelWebhook.
+func validateChannel(ve ValidationError, enabled map[string]bool, channel string, webhookURL *string) {
+	switch {
+	case channel == "":
+		ve["channel"] = ErrRequired
+	case !enabled[channel]:
+		ve["channel"] = ErrInvalid
+	}
+
+	if channel != ChannelWebhook {
+		*webhookURL = ""
+	} else if *webhookURL == "" {
+		ve["webhookUrl"] = ErrRequired
+	} else if len(*webhookURL) > 2048 {
+		ve["webhookUrl"] = ErrTooLong
+	} else if u, err := url.Parse(*webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		ve["webhookUrl"] = ErrInvalid
+	}
+}
+
+func (sv *subscriptionValidator) Unfollow(userID, target int64) error {
+	if userID < 1 || target < 1 {
+		return ErrNotFound
+	}
+
+	return sv.SubscriptionDB.Unfollow(userID, target)
+}
+
+type subscriptionGorm struct {
+	db    *gorm.DB
+	clock Clock
+
+	// ratings computes the averages of the targets.
+	ratings RatingDB
+}
+
+func (sg *subscriptionGorm) Follow(s *Subscription) error {
+	// thresholds are crossed from the current average
+	stats, err := sg.ratings.StatsByTarget(s.Target)
+	if err != nil {
+		return err
+	}
+
+	s.LastAverage = &stats.Average
+	s.CreatedAt = sg.clock.Now()
+	err = sg.db.Exec(`INSERT INTO target_subscriptions (user_id, target, channel, webhook_url, new_ratings, average_below, average_above, last_average, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, target) DO UPDATE SET
+			channel = EXCLUDED.channel,
+			webhook_url = EXCLUDED.webhook_url,
+			new_ratings = EXCLUDED.new_ratings,
+			average_below = EXCLUDED.average_below,
+			average_above = EXCLUDED.average_above,
+			last_average = EXCLUDED.last_average`,
+		s.UserID, s.Target, s.Channel, s.WebhookURL, s.NewRatings, s.AverageBelow, s.AverageAbove, s.LastAverage, s.CreatedAt).Error
+	if err != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ValidationError{"userId": ErrRefNotFound}
+		}
+
+		return with(wrap("could not save subscription", err), "target", s.Target)
+	}
+
+	return nil
+}
+
+func (sg *subscriptionGorm) Unfollow(userID, target int64) error {
+	res := sg.db.Where("user_id = ? AND target = ?", userID, target).Delete(&Subscription{})
+	if res.Error != nil {
+		return with(wrap("could not delete subscription", res.Error), "target", target)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (sg *subscriptionGorm) ByUser(userID int64) ([]Subscription, error) {
+	subs := []Subscription{}
+	err := sg.db.Where("user_id = ?", userID).Order("target").Find(&subs).Error
+	if err != nil {
+		return nil, with(wrap("could not list subscriptions by user", err), "user_id", userID)
+	}
+
+	return subs, nil
+}
+
+func (sg *subscriptionGorm) ByTarget(target int64) ([]Subscription, error) {
+	subs := []Subscription{}
+	err := sg.db.Where("target = ?", target).Order("user_id").Find(&subs).Error
+	if err != nil {
+		return nil, with(wrap("could not list subscriptions by target", err), "target", target)
+	}
+
+	return subs, nil
+}
+
+func (sg *subscriptionGorm) Notifications(userID int64) ([]Notification, error) {
+	ns := []Notification{}
+	err := sg.db.Where("user_id = ?", userID).Order("id DESC").Limit(maxNotifications).Find(&ns).Error
+	if err != nil {
+		return nil, with(wrap("could not list notifications", err), "user_id", userID)
+	}
+
+	return ns, nil
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSubscriptionDB struct {
+	SubscriptionDB
+	follow func(*Subscription) error
+}
+
+func (t *testSubscriptionDB) Follow(s *Subscription) error {
+	if t.follow != nil {
+		return t.follow(s)
+	}
+
+	return nil
+}
+
+type testNotificationSender struct {
+	sent []Notification
+	err  error
+}
+
+func (t *testNotificationSender) Send(u User, s Subscription, n Notification) error {
+	t.sent = append(t.sent, n)
+	return t.err
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func TestSubscriptionValidator(t *testing.T) {
+	ss := newSubscriptionService(nil, nil, []string{ChannelWebhook}, SystemClock)
+	ss.(*subscriptionService).SubscriptionDB.(*subscriptionValidator).SubscriptionDB = &testSubscriptionDB{}
+
+	valid := func() *Subscription {
+		return &Subscription{UserID: 1, Target: 9, Channel: ChannelInApp, NewRatings: true}
+	}
+
+	var cases = []struct {
+		name   string
+		change func(*Subscription)
+		outerr error
+	}{
+		{"ok", func(s *Subscription) {}, nil},
+		{"thresholdsOnly", func(s *Subscription) { s.NewRatings, s.AverageBelow = false, float(2.5) }, nil},
+		{"webhook", func(s *Subscription) { s.Channel, s.WebhookURL = ChannelWebhook, "https://hooks.test.com/ratings" }, nil},
+		{"targetNotFound", func(s *Subscription) { s.Target = 0 }, ErrNotFound},
+		{"userIdRequired", func(s *Subscription) { s.UserID = 0 }, ValidationError{"userId": ErrRequired}},
+		{"channelRequired", func(s *Subscription) { s.Channel = "" }, ValidationError{"channel": ErrRequired}},
+		{"channelInvalid", func(s *Subscription) { s.Channel = "sms" }, ValidationError{"channel": ErrInvalid}},
+		{"channelDisabled", func(s *Subscription) { s.Channel = ChannelEmail }, ValidationError{"channel": ErrInvalid}},
+		{"webhookUrlRequired", func(s *Subscription) { s.Channel = ChannelWebhook }, ValidationError{"webhookUrl": ErrRequired}},
+		{"webhookUrlTooLong", func(s *Subscription) {
+			s.Channel, s.WebhookURL = ChannelWebhook, "https://hooks.test.com/"+strings.Repeat("a", 2048)
+		}, ValidationError{"webhookUrl": ErrTooLong}},
+		{"webhookUrlInvalid", func(s *Subscription) { s.Channel, s.WebhookURL = ChannelWebhook, "ftp://hooks.test.com" }, ValidationError{"webhookUrl": ErrInvalid}},
+		{"nothingNotified", func(s *Subscription) { s.NewRatings = false }, ValidationError{"newRatings": ErrRequired}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := valid()
+			tc.change(s)
+			assert.Equal(t, tc.outerr, ss.Follow(s))
+		})
+	}
+
+	t.Run("webhookUrlIgnored", func(t *testing.T) {
+		s := valid()
+		s.WebhookURL = "https://hooks.test.com"
+		require.NoError(t, ss.Follow(s))
+		assert.Empty(t, s.WebhookURL)
+	})
+
+	t.Run("unfollowNotFound", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, ss.Unfollow(1, 0))
+	})
+}
+
+func TestNotifications(t *testing.T) {
+	var cases = []struct {
+		name    string
+		sub     Subscription
+		average float64
+		created bool
+		kinds   []string
+	}{
+		{"newRating", Subscription{NewRatings: true}, 3, true, []string{NotificationNewRating}},
+		{"updated", Subscription{NewRatings: true}, 3, false, nil},
+		{"below", Subscription{AverageBelow: float(3), LastAverage: float(3)}, 2.5, false, []string{NotificationAverageBelow}},
+		{"stillBelow", Subscription{AverageBelow: float(3), LastAverage: float(2.5)}, 2, true, nil},
+		{"above", Subscription{NewRatings: true, AverageAbove: float(4), LastAverage: float(3.5)}, 4.5, true,
+			[]string{NotificationNewRating, NotificationAverageAbove}},
+		{"noLastAverage", Subscription{AverageAbove: float(4)}, 4.5, true, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.kinds, notifications(tc.sub, tc.average, tc.created))
+		})
+	}
+}
+
+func TestSubscriptionGorm(t *testing.T) {
+	db := setupGorm(t)
+	ss := newSubscriptionService(db, &ratingGorm{db: db}, nil, SystemClock)
+
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 9, UserID: 1}).Error)
+
+	s := Subscription{UserID: 1, Target: 9, Channel: ChannelInApp, NewRatings: true}
+	require.NoError(t, ss.Follow(&s))
+	assert.Equal(t, float64(4), *s.LastAverage)
+
+	s.AverageBelow = float(3)
+	require.NoError(t, ss.Follow(&s), "must replace the subscription")
+
+	subs, err := ss.ByUser(1)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	assert.Equal(t, float64(3), *subs[0].AverageBelow)
+
+	subs, err = ss.ByTarget(9)
+	require.NoError(t, err)
+	assert.Len(t, subs, 1)
+
+	assert.Equal(t, ValidationError{"userId": ErrRefNotFound}, ss.Follow(&Subscription{UserID: 404, Target: 9, Channel: ChannelInApp, NewRatings: true}))
+
+	require.NoError(t, ss.Unfollow(1, 9))
+	assert.Equal(t, ErrNotFound, ss.Unfollow(1, 9))
+
+	ns, err := ss.Notifications(1)
+	require.NoError(t, err)
+	assert.Empty(t, ns)
+}
+
+func TestNotifier(t *testing.T) {
+	db := setupGorm(t)
+	ratings := &ratingGorm{db: db}
+	ss := newSubscriptionService(db, ratings, []string{ChannelEmail}, SystemClock)
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh", Active: true}).Error)
+	require.NoError(t, db.Create(&User{ID: 99, RoleID: 2, Email: "third@test.com", FirstName: "Third", Password: "TestPasswordHAsh", Active: true}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 9, UserID: 1}).Error)
+
+	require.NoError(t, ss.Follow(&Subscription{UserID: 98, Target: 9, Channel: ChannelInApp, NewRatings: true}))
+	require.NoError(t, ss.Follow(&Subscription{UserID: 99, Target: 9, Channel: ChannelEmail, AverageBelow: float(3)}))
+
+	email := &testNotificationSender{}
+	n := &notifier{db: db, ratings: ratings, senders: map[string]NotificationSender{ChannelEmail: email}}
+
+	r := Rating{ID: 11, Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 99}
+	require.NoError(t, db.Create(&r).Error)
+	require.NoError(t, n.notify(r, true, ""))
+
+	ns, err := ss.Notifications(98)
+	require.NoError(t, err)
+	require.Len(t, ns, 1)
+	assert.Equal(t, NotificationNewRating, ns[0].Kind)
+	assert.Equal(t, int64(11), *ns[0].RatingID)
+	assert.Equal(t, float64(2.5), ns[0].Average)
+	assert.Empty(t, email.sent, "authors must not be notified of their own ratings")
+
+	r = Rating{ID: 12, Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 98}
+	require.NoError(t, db.Create(&r).Error)
+	email.err = errors.New("smtp down")
+	assert.Error(t, n.notify(r, true, ""))
+
+	require.Len(t, email.sent, 1)
+	assert.Equal(t, NotificationAverageBelow, email.sent[0].Kind)
+	assert.Equal(t, int64(99), email.sent[0].UserID)
+
+	subs, err := ss.ByTarget(9)
+	require.NoError(t, err)
+	assert.Equal(t, float64(2), *subs[0].LastAverage)
+
+	t.Run("invisible", func(t *testing.T) {
+		n.policy = newVisibilityPolicy([]VisibilityRule{{RoleID: 2, Targets: []int64{7}}})
+		defer func() { n.policy = nil }()
+
+		require.NoError(t, n.notify(Rating{ID: 10, Target: 9, UserID: 1}, true, ""))
+		ns, err := ss.Notifications(98)
+		require.NoError(t, err)
+		assert.Len(t, ns, 1)
+	})
+}
@@ -0,0 +1,297 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/sync.go -pkg modelstest . SyncService:SyncService
+
+// SyncService defines a set of methods used by clients that keep a local copy
+// of the system's data and only need to fetch what changed since their last
+// synchronisation.
+type SyncService interface {
+	SyncDB
+}
+
+// SyncDB defines how the service interacts with the database.
+type SyncDB interface {
+	// Changes returns the users, roles and ratings created, updated or
+	// deleted after the cursor in q. Only the entity kinds enabled in q
+	// are looked up. An empty cursor returns all existing entities.
+	//
+	// The returned Changes contains a new cursor to be used on the next
+	// call. The cursor is the oldest transaction still running when the
+	// changes are read, so the changes of the transactions committed
+	// later are returned on the next call, however long they took. The
+	// changes of the transactions committed meanwhile are returned again
+	// too, so clients must apply them by ID.
+	Changes(q *SyncQuery) (Changes, error)
+}
+
+// SyncQuery defines which changes are requested from SyncService.Changes.
+type SyncQuery struct {
+	// Since is the cursor returned by a previous call to Changes. It may
+	// be left empty to obtain all entities.
+	Since string
+
+	// Users, Roles and Ratings enable the lookup of changes of each kind
+	// of entity.
+	Users   bool
+	Roles   bool
+	Ratings bool
+
+	// RoleID is the role of the requester. The ratings are restricted to
+	// those visible to the role, as defined by its VisibilityRule values.
+	// The IDs of the deleted ratings are not restricted.
+	RoleID int64
+
+	// sinceXID is the transaction of the cursor, or sinceTime the time
+	// of the cursors returned before the transactions were tracked.
+	sinceXID  int64
+	sinceTime time.Time
+}
+
+// after returns a scope selecting the rows changed after the cursor of q, with
+// xid and at the columns recording the transaction and time of their change.
+func (q *SyncQuery) after(xid, at string) func(*gorm.DB) *gorm.DB {
+	return func(qb *gorm.DB) *gorm.DB {
+		if !q.sinceTime.IsZero() {
+			return qb.Where(at+" > ?", q.sinceTime)
+		}
+
+		return qb.Where(xid+" >= ?", q.sinceXID)
+	}
+}
+
+// Changes contains the entities changed since a cursor. The entity lists are
+// only set when they were requested.
+type Changes struct {
+	// Cursor identifies the transactions up to which changes are
+	// included and must be passed as SyncQuery.Since on the next request.
+	Cursor string `json:"cursor"`
+
+	Users   *UserChanges   `json:"users,omitempty"`
+	Roles   *RoleChanges   `json:"roles,omitempty"`
+	Ratings *RatingChanges `json:"ratings,omitempty"`
+}
+
+// UserChanges lists the users created or updated, and the IDs of the users
+// deleted since a cursor.
+type UserChanges struct {
+	Updated []User  `json:"updated"`
+	Deleted []int64 `json:"deleted"`
+}
+
+// RoleChanges lists the roles created or updated, and the IDs of the roles
+// deleted since a cursor.
+type RoleChanges struct {
+	Updated []Role  `json:"updated"`
+	Deleted []int64 `json:"deleted"`
+}
+
+// RatingChanges lists the ratings created or updated, and the IDs of the
+// ratings deleted since a cursor.
+type RatingChanges struct {
+	Updated []Rating `json:"updated"`
+	Deleted []int64  `json:"deleted"`
+}
+
+// A Tombstone records the deletion of an entity so synchronising clients can
+// be told about it. Tombstones are written by the database itself when a user,
+// role or rating is deleted.
+type Tombstone struct {
+	ID int64 `gorm:"primary_key;type:bigserial"`
+
+	// Entity is the name of the table the deleted entity belonged to.
+	Entity string `gorm:"size:64;not null"`
+
+	// EntityID is the ID of the deleted entity.
+	EntityID int64 `gorm:"type:bigint;not null"`
+
+	// RemovedAt is the time the entity was deleted.
+	RemovedAt time.Time `gorm:"type:timestamptz;not null;default:now();index"`
+
+	// RemovedXID is the transaction that deleted the entity.
+	RemovedXID int64 `gorm:"column:removed_xid;not null;default:txid_current()"`
+}
+
+type syncService struct {
+	SyncService
+}
+
+// NewSyncService instantiates a new SyncService implementation with db as the
+// backing database.
+func NewSyncService(db *gorm.DB) SyncService {
+	return newSyncService(db, nil)
+}
+
+// newSyncService instantiates a new SyncService implementation that restricts
+// the ratings returned to each role with the rules in policy.
+func newSyncService(db *gorm.DB, policy visibilityPolicy) SyncService {
+	return &syncService{
+		SyncService: &syncValidator{
+			SyncDB: &syncGorm{db: db, policy: policy},
+		},
+	}
+}
+
+type syncValidator struct {
+	SyncDB
+}
+
+func (sv *syncValidator) Changes(q *SyncQuery) (Changes, error) {
+	err := sv.runValFuncs(q,
+		sv.sinceFormat,
+	)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	return sv.SyncDB.Changes(q)
+}
+
+type syncValFn func(q *SyncQuery) error
+
+func (sv *syncValidator) runValFuncs(q *SyncQuery, fns ...func() (string, syncValFn)) error {
+	return runValidationFunctions(q, fns)
+}
+
+// sinceFormat parses the cursor in q.Since. An empty cursor is accepted and
+// stands for the beginning of time. The cursors returned before the
+// transactions were tracked, in microseconds since the epoch, are still
+// accepted. It may return ErrInvalid.
+func (sv *syncValidator) sinceFormat() (string, syncValFn) {
+	return "since", func(q *SyncQuery) error {
+		q.sinceXID, q.sinceTime = 0, time.Time{}
+		if q.Since == "" {
+			return nil
+		}
+
+		legacy := !strings.HasPrefix(q.Since, syncCursorPrefix)
+		v, err := strconv.ParseInt(strings.TrimPrefix(q.Since, syncCursorPrefix), 10, 64)
+		if err != nil || v < 0 {
+			return ErrInvalid
+		}
+
+		if legacy {
+			q.sinceTime = time.Unix(0, v*int64(time.Microsecond))
+		} else {
+			q.sinceXID = v
+		}
+		return nil
+	}
+}
+
+// syncCursorPrefix starts the cursors holding a transaction ID, see
+// SyncDB.Changes.
+const syncCursorPrefix = "x"
+
+type syncGorm struct {
+	db     *gorm.DB
+	policy visibilityPolicy
+}
+
+func (sg *syncGorm) Changes(q *SyncQuery) (Changes, error) {
+	var ch Changes
+
+	err := gormTransaction(sg.db, func(tx *gorm.DB) error {
+		// all lookups must see the same snapshot, so the returned cursor
+		// is consistent with the returned entities
+		err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY").Error
+		if err != nil {
+			return wrap("could not set sync transaction mode", err)
+		}
+
+		// the transactions older than the snapshot are all over, and
+		// their changes seen, but the newer ones may commit later, so
+		// the next call starts from the oldest one still running
+		var snapshot struct{ XMin int64 }
+		err = tx.Raw("SELECT txid_snapshot_xmin(txid_current_snapshot()) AS x_min").Scan(&snapshot).Error
+		if err != nil {
+			return wrap("could not get sync cursor", err)
+		}
+
+		changed := func(qb *gorm.DB) *gorm.DB {
+			return qb.Scopes(q.after("sync_xid", "updated_at")).Order("id")
+		}
+
+		if q.Users {
+			ch.Users = &UserChanges{Updated: []User{}}
+			err = changed(tx).Find(&ch.Users.Updated).Error
+			if err != nil {
+				return wrap("could not list changed users", err)
+			}
+
+			for i := range ch.Users.Updated {
+				ch.Users.Updated[i].Password = ""
+			}
+
+			ch.Users.Deleted, err = sg.deleted(tx, "users", q)
+			if err != nil {
+				return err
+			}
+		}
+
+		if q.Roles {
+			ch.Roles = &RoleChanges{Updated: []Role{}}
+			err = changed(tx).Find(&ch.Roles.Updated).Error
+			if err != nil {
+				return wrap("could not list changed roles", err)
+			}
+
+			ch.Roles.Deleted, err = sg.deleted(tx, "roles", q)
+			if err != nil {
+				return err
+			}
+		}
+
+		if q.Ratings {
+			ch.Ratings = &RatingChanges{Updated: []Rating{}}
+
+			qb := changed(tx)
+			if scope := sg.policy.scope(q.RoleID); scope != nil {
+				qb = qb.Scopes(scope)
+			}
+
+			err = qb.Find(&ch.Ratings.Updated).Error
+			if err != nil {
+				return wrap("could not list changed ratings", err)
+			}
+
+			ch.Ratings.Deleted, err = sg.deleted(tx, "ratings", q)
+			if err != nil {
+				return err
+			}
+		}
+
+		ch.Cursor = syncCursorPrefix + strconv.FormatInt(snapshot.XMin, 10)
+		return nil
+	})
+	if err != nil {
+		return Changes{}, err
+	}
+
+	return ch, nil
+}
+
+// deleted lists the IDs of the entities removed from table after the cursor of
+// q.
+func (sg *syncGorm) deleted(tx *gorm.DB, table string, q *SyncQuery) ([]int64, error) {
+	var ids = []int64{}
+
+	err := tx.Model(&Tombstone{}).
+		Scopes(q.after("removed_xid", "removed_at")).
+		Where("entity = ?", table).
+		Order("id").
+		Pluck("entity_id", &ids).
+		Error
+	if err != nil {
+		return nil, wrap("could not list deleted "+table, err)
+	}
+
+	return ids, nil
+}
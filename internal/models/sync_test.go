@@ -0,0 +1,158 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type testSyncDB struct {
+	SyncDB
+	changes func(*SyncQuery) (Changes, error)
+}
+
+func (t *testSyncDB) Changes(q *SyncQuery) (Changes, error) {
+	if t.changes != nil {
+		return t.changes(q)
+	}
+
+	return Changes{}, nil
+}
+
+func TestSyncService_Changes(t *testing.T) {
+	tsdb := &testSyncDB{}
+	ss := NewSyncService(nil)
+	ss.(*syncService).SyncService.(*syncValidator).SyncDB = tsdb
+
+	var cases = []struct {
+		name     string
+		query    *SyncQuery
+		outxid   int64
+		outsince time.Time
+		outerr   error
+	}{
+		{"emptyCursor", &SyncQuery{}, 0, time.Time{}, nil},
+		{"cursor", &SyncQuery{Since: "x1234"}, 1234, time.Time{}, nil},
+		{"legacyCursor", &SyncQuery{Since: "1500000000000000"}, 0, time.Unix(1500000000, 0), nil},
+		{"badCursor", &SyncQuery{Since: "abc"}, 0, time.Time{}, ValidationError{"since": ErrInvalid}},
+		{"badXIDCursor", &SyncQuery{Since: "x"}, 0, time.Time{}, ValidationError{"since": ErrInvalid}},
+		{"negativeCursor", &SyncQuery{Since: "-10"}, 0, time.Time{}, ValidationError{"since": ErrInvalid}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var called bool
+			tsdb.changes = func(q *SyncQuery) (Changes, error) {
+				called = true
+				assert.Equal(t, cs.outxid, q.sinceXID)
+				assert.True(t, cs.outsince.Equal(q.sinceTime))
+				return Changes{}, nil
+			}
+
+			_, err := ss.Changes(cs.query)
+
+			if cs.outerr != nil {
+				assert.False(t, called, "must not query the database with an invalid cursor")
+				assert.True(t, xerrors.Is(err, cs.outerr))
+			} else {
+				assert.True(t, called)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSyncGORM_Changes(t *testing.T) {
+	db := setupGorm(t)
+	sg := &syncGorm{db: db}
+
+	ch, err := sg.Changes(&SyncQuery{Users: true, Roles: true, Ratings: true})
+	require.NoError(t, err)
+	assert.Len(t, ch.Users.Updated, 1, "must list the default admin user")
+	assert.Empty(t, ch.Users.Updated[0].Password, "must not expose passwords")
+	assert.Len(t, ch.Roles.Updated, 2, "must list the default roles")
+	assert.Empty(t, ch.Ratings.Updated)
+	assert.NotEmpty(t, ch.Cursor)
+
+	// changes made in another transaction must be newer than the cursor
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, db.Create(&Rating{ID: 99, Active: true, Extra: json.RawMessage(`{}`), Score: 3, Target: 9, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 98, Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 8, UserID: 1}).Error)
+	require.NoError(t, db.Delete(&Rating{}, 98).Error)
+
+	ch2, err := sg.Changes(syncQuery(t, ch.Cursor, &SyncQuery{Ratings: true}))
+	require.NoError(t, err)
+	assert.Nil(t, ch2.Users, "must not include entities that were not requested")
+	assert.Nil(t, ch2.Roles, "must not include entities that were not requested")
+	require.Len(t, ch2.Ratings.Updated, 1)
+	assert.Equal(t, int64(99), ch2.Ratings.Updated[0].ID)
+	assert.Equal(t, []int64{98}, ch2.Ratings.Deleted)
+
+	c1, _ := strconv.ParseInt(strings.TrimPrefix(ch.Cursor, syncCursorPrefix), 10, 64)
+	c2, _ := strconv.ParseInt(strings.TrimPrefix(ch2.Cursor, syncCursorPrefix), 10, 64)
+	assert.True(t, c2 > c1, "the cursor must move forward")
+
+	t.Run("visibility", func(t *testing.T) {
+		sg := &syncGorm{db: db, policy: newVisibilityPolicy([]VisibilityRule{{RoleID: 2, Targets: []int64{8}}})}
+
+		ch, err := sg.Changes(&SyncQuery{Ratings: true, RoleID: 2})
+		require.NoError(t, err)
+		assert.Empty(t, ch.Ratings.Updated, "must not include ratings that are not visible")
+
+		ch, err = sg.Changes(&SyncQuery{Ratings: true, RoleID: 1})
+		require.NoError(t, err)
+		assert.Len(t, ch.Ratings.Updated, 1)
+	})
+
+	t.Run("noChanges", func(t *testing.T) {
+		ch3, err := sg.Changes(syncQuery(t, ch2.Cursor, &SyncQuery{Users: true, Ratings: true}))
+		require.NoError(t, err)
+		assert.Empty(t, ch3.Users.Updated)
+		assert.Empty(t, ch3.Ratings.Updated)
+		assert.Empty(t, ch3.Ratings.Deleted)
+	})
+
+	t.Run("lateCommit", func(t *testing.T) {
+		// a writer running while the changes are read commits after
+		tx := db.Begin()
+		require.NoError(t, tx.Create(&Rating{ID: 97, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1}).Error)
+
+		ch3, err := sg.Changes(syncQuery(t, ch2.Cursor, &SyncQuery{Ratings: true}))
+		require.NoError(t, err)
+		assert.Empty(t, ch3.Ratings.Updated)
+		require.NoError(t, tx.Commit().Error)
+
+		ch4, err := sg.Changes(syncQuery(t, ch3.Cursor, &SyncQuery{Ratings: true}))
+		require.NoError(t, err)
+		require.Len(t, ch4.Ratings.Updated, 1, "must return the changes committed after the cursor was read")
+		assert.Equal(t, int64(97), ch4.Ratings.Updated[0].ID)
+	})
+
+	t.Run("legacyCursor", func(t *testing.T) {
+		ch3, err := sg.Changes(syncQuery(t, "0", &SyncQuery{Ratings: true}))
+		require.NoError(t, err)
+		assert.Len(t, ch3.Ratings.Updated, 2)
+		assert.True(t, strings.HasPrefix(ch3.Cursor, syncCursorPrefix), "must return the new cursors")
+	})
+
+	t.Run("internalError", func(t *testing.T) {
+		dropRatingsTable(db)
+
+		_, err := sg.Changes(&SyncQuery{Ratings: true})
+		assert.Error(t, err)
+	})
+}
+
+// syncQuery sets the cursor of q, parsed as by SyncService.
+func syncQuery(t *testing.T, cursor string, q *SyncQuery) *SyncQuery {
+	q.Since = cursor
+	_, parse := (&syncValidator{}).sinceFormat()
+	require.NoError(t, parse(q))
+	return q
+}
@@ -0,0 +1,297 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/jinzhu/gorm"
+)
+
+// The expressions of the target fields are written in CEL, like the policies,
+// and can use these variables:
+//
+//	stats   the stats of the target: count, min and max, as ints, and average,
+//	        weightedAverage and verifiedWeightedAverage, as doubles, see
+//	        RatingStats
+//	scores  the number of active ratings of the target by score, only holding
+//	        the scores given
+//
+// They must return an int, a double, a bool or a string.
+var targetFieldEnv = mustPolicyEnv(
+	cel.Variable("stats", cel.MapType(cel.StringType, cel.DynType)),
+	cel.Variable("scores", cel.MapType(cel.IntType, cel.IntType)),
+	cel.CrossTypeNumericComparisons(true),
+	cel.ParserExpressionSizeLimit(policyMaxLength),
+	cel.ParserRecursionLimit(policyMaxDepth),
+)
+
+// targetFieldName matches the valid names of the target fields.
+var targetFieldName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+//go:generate go run github.com/matryer/moq -out modelstest/targetfields.go -pkg modelstest . TargetFieldService:TargetFieldService
+
+// TargetFieldService defines a set of methods used to manage the target fields,
+// the summary fields computed from the stats of each target with the
+// expressions set by the administrators. Their values are returned along with
+// the stats of the targets, see RatingStats.Computed.
+//
+// The changes of the fields are applied by the other instances in a few
+// seconds, and to the stats already cached once they expire.
+type TargetFieldService interface {
+	// List retrieves the target fields, sorted by name.
+	List() ([]TargetField, error)
+
+	// Set sets the expression of the field named f.Name, creating it if
+	// needed. The expression is checked as in Check, and a
+	// ValidationError is returned for the "expression" field if it is
+	// invalid. On success, f.UpdatedAt is set.
+	Set(f *TargetField) error
+
+	// Remove removes a target field by name. ErrNotFound is returned if
+	// it does not exist.
+	Remove(name string) error
+
+	// Check compiles the expression of a target field, and evaluates it
+	// with sample stats, returning an error describing why it is
+	// invalid, if so.
+	Check(expression string) error
+}
+
+// A TargetField is a summary field computed from the stats of each target.
+type TargetField struct {
+	Name       string `gorm:"primary_key;size:64" json:"name"`
+	Expression string `gorm:"type:text;not null" json:"expression"`
+
+	// UpdatedBy is the ID of the user who set the expression.
+	UpdatedBy int64     `gorm:"type:bigint;not null" json:"updatedBy"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updatedAt"`
+}
+
+type targetFieldService struct {
+	TargetFieldService
+
+	engine *targetFieldEngine
+}
+
+// newTargetFieldService instantiates a new TargetFieldService implementation
+// whose changes are applied to engine right away, and dated with clock.
+func newTargetFieldService(db *gorm.DB, engine *targetFieldEngine, clock Clock) TargetFieldService {
+	return &targetFieldService{
+		TargetFieldService: &targetFieldValidator{
+			TargetFieldService: &targetFieldGorm{db: db, clock: clock},
+		},
+		engine: engine,
+	}
+}
+
+func (ts *targetFieldService) Set(f *TargetField) error {
+	err := ts.TargetFieldService.Set(f)
+	if err != nil {
+		return err
+	}
+
+	ts.engine.invalidate()
+	return nil
+}
+
+func (ts *targetFieldService) Remove(name string) error {
+	err := ts.TargetFieldService.Remove(name)
+	if err != nil {
+		return err
+	}
+
+	ts.engine.invalidate()
+	return nil
+}
+
+type targetFieldValidator struct {
+	TargetFieldService
+}
+
+func (tv *targetFieldValidator) Set(f *TargetField) error {
+	ve := ValidationError{}
+	switch {
+	case f.Name == "":
+		ve["name"] = ErrRequired
+	case !targetFieldName.MatchString(f.Name):
+		ve["name"] = ErrInvalid
+	}
+
+	switch {
+	case f.Expression == "":
+		ve["expression"] = ErrRequired
+	case len(f.Expression) > policyMaxLength:
+		ve["expression"] = ErrTooLong
+	case tv.Check(f.Expression) != nil:
+		ve["expression"] = ErrInvalid
+	}
+
+	if f.UpdatedBy < 1 {
+		ve["updatedBy"] = ErrRequired
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return tv.TargetFieldService.Set(f)
+}
+
+func (tv *targetFieldValidator) Check(expression string) error {
+	p, err := compileIn(targetFieldEnv, expression)
+	if err != nil {
+		return err
+	}
+
+	// the sample values catch the type errors, like misspelt fields
+	v, err := evalPolicy(p, targetFieldValues(RatingStats{Count: 1, Average: 1, Min: 1, Max: 1, WeightedAverage: 1, VerifiedWeightedAverage: 1}, map[int64]int64{1: 1}))
+	if err != nil {
+		return err
+	}
+
+	switch v.(type) {
+	case int64, uint64, float64, bool, string:
+		return nil
+	}
+
+	return wrap("target fields must return an int, a double, a bool or a string", nil)
+}
+
+type targetFieldGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (tg *targetFieldGorm) List() ([]TargetField, error) {
+	fields := []TargetField{}
+	err := tg.db.Order("name").Find(&fields).Error
+	if err != nil {
+		return nil, wrap("could not list target fields", err)
+	}
+
+	return fields, nil
+}
+
+func (tg *targetFieldGorm) Set(f *TargetField) error {
+	f.UpdatedAt = tg.clock.Now()
+	err := tg.db.Exec(`INSERT INTO target_fields (name, expression, updated_by, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET expression = excluded.expression, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		f.Name, f.Expression, f.UpdatedBy, f.UpdatedAt).Error
+	if err != nil {
+		return with(wrap("could not set target field", err), "name", f.Name)
+	}
+
+	return nil
+}
+
+func (tg *targetFieldGorm) Remove(name string) error {
+	res := tg.db.Exec("DELETE FROM target_fields WHERE name = ?", name)
+	if res.Error != nil {
+		return with(wrap("could not remove target field", res.Error), "name", name)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (tg *targetFieldGorm) Check(expression string) error {
+	panic("method Check of targetFieldGorm must never be called")
+}
+
+// targetFieldValues returns the values of the variables of the target fields
+// evaluated for stats, with the number of ratings of each score given.
+func targetFieldValues(stats RatingStats, scores map[int64]int64) map[string]interface{} {
+	return map[string]interface{}{
+		"stats": map[string]interface{}{
+			"count":                   stats.Count,
+			"average":                 stats.Average,
+			"min":                     int64(stats.Min),
+			"max":                     int64(stats.Max),
+			"weightedAverage":         stats.WeightedAverage,
+			"verifiedWeightedAverage": stats.VerifiedWeightedAverage,
+		},
+		"scores": scores,
+	}
+}
+
+// targetFieldEngine computes the target fields from the stats of the targets.
+// The fields are read from the database at most every policyRefresh.
+type targetFieldEngine struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	programs map[string]cel.Program
+	loadedAt time.Time
+}
+
+// invalidate makes the fields be read again on their next computation.
+func (te *targetFieldEngine) invalidate() {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	te.programs = nil
+}
+
+// load returns the compiled fields, reading them if they are outdated. It is
+// safe to call on a nil te, which has no fields.
+func (te *targetFieldEngine) load() (map[string]cel.Program, error) {
+	if te == nil {
+		return nil, nil
+	}
+
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	if te.programs != nil && time.Since(te.loadedAt) < policyRefresh {
+		return te.programs, nil
+	}
+
+	fields, err := (&targetFieldGorm{db: te.db}).List()
+	if err != nil {
+		return nil, err
+	}
+
+	programs := make(map[string]cel.Program, len(fields))
+	for _, f := range fields {
+		programs[f.Name], err = compileIn(targetFieldEnv, f.Expression)
+		if err != nil {
+			return nil, with(wrap("invalid target field", err), "name", f.Name)
+		}
+	}
+
+	te.programs, te.loadedAt = programs, time.Now()
+	return programs, nil
+}
+
+// computeTargetFields evaluates programs for stats, with the number of ratings
+// of each score given. The fields whose evaluation fails, like a division by
+// zero, or returning a double that is not finite, are null.
+func computeTargetFields(programs map[string]cel.Program, stats RatingStats, scores map[int64]int64) map[string]interface{} {
+	values := targetFieldValues(stats, scores)
+
+	computed := make(map[string]interface{}, len(programs))
+	for name, p := range programs {
+		v, err := evalPolicy(p, values)
+		if err != nil {
+			computed[name] = nil
+			continue
+		}
+
+		switch tv := v.(type) {
+		case int64, uint64, bool, string:
+		case float64:
+			if math.IsNaN(tv) || math.IsInf(tv, 0) {
+				v = nil
+			}
+		default:
+			v = nil
+		}
+		computed[name] = v
+	}
+
+	return computed
+}
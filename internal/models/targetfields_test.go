@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetFieldService_Check(t *testing.T) {
+	ts := newTargetFieldService(nil, &targetFieldEngine{}, SystemClock)
+
+	var cases = []struct {
+		name  string
+		expr  string
+		valid bool
+	}{
+		{"double", `stats.average * 20.0`, true},
+		{"scores", `double((9 in scores ? scores[9] : 0) - (1 in scores ? scores[1] : 0)) / double(stats.count)`, true},
+		{"bool", `stats.min >= 3`, true},
+		{"string", `stats.average > 4.0 ? "top" : "regular"`, true},
+		{"syntax", `stats.average *`, false},
+		{"unknownVariable", `rating.score > 2`, false},
+		{"unknownField", `stats.median > 2.0`, false},
+		{"list", `[stats.min, stats.max]`, false},
+		{"mixedTypes", `stats.count * stats.average`, false},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			err := ts.Check(cs.expr)
+			if cs.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	t.Run("setInvalid", func(t *testing.T) {
+		err := ts.Set(&TargetField{Name: "1st", Expression: "stats.min", UpdatedBy: 1})
+		assert.Equal(t, ValidationError{"name": ErrInvalid}, err)
+
+		err = ts.Set(&TargetField{Name: "top", Expression: "stats.unknown"})
+		assert.Equal(t, ValidationError{"expression": ErrInvalid, "updatedBy": ErrRequired}, err)
+	})
+}
+
+func TestComputeTargetFields(t *testing.T) {
+	compile := func(expr string) cel.Program {
+		p, err := compileIn(targetFieldEnv, expr)
+		require.NoError(t, err)
+		return p
+	}
+
+	programs := map[string]cel.Program{
+		"promoters": compile(`double((5 in scores ? scores[5] : 0) - (1 in scores ? scores[1] : 0)) / double(stats.count) * 100.0`),
+		"rated":     compile(`stats.count > 0`),
+		"spread":    compile(`stats.max - stats.min`),
+		"ratio":     compile(`stats.count / (5 in scores ? scores[5] : 0)`),
+		"infinite":  compile(`stats.average / 0.0`),
+	}
+
+	stats := RatingStats{Target: 9, Count: 4, Average: 3.5, Min: 1, Max: 5}
+	computed := computeTargetFields(programs, stats, map[int64]int64{1: 1, 4: 1, 5: 2})
+	assert.Equal(t, map[string]interface{}{
+		"promoters": 25.0,
+		"rated":     true,
+		"spread":    int64(4),
+		"ratio":     int64(2),
+		"infinite":  nil,
+	}, computed)
+
+	t.Run("failed", func(t *testing.T) {
+		computed := computeTargetFields(programs, RatingStats{Target: 9}, map[int64]int64{})
+		assert.Nil(t, computed["ratio"], "a division by zero must be null")
+		assert.Nil(t, computed["promoters"], "a division by zero must be null")
+		assert.Equal(t, false, computed["rated"])
+	})
+
+	t.Run("none", func(t *testing.T) {
+		programs, err := (*targetFieldEngine)(nil).load()
+		assert.NoError(t, err)
+		assert.Empty(t, programs)
+	})
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// maxScoreTargets is the maximum number of targets whose scores are read at
+// once, see RatingDB.Scores.
+const maxScoreTargets = 100
+
+// A TargetScore holds the number of active ratings of a target and their
+// average score. They are denormalised, see RatingDB.Scores.
+type TargetScore struct {
+	Target  int64   `gorm:"primary_key;type:bigint" json:"target"`
+	Count   int64   `gorm:"type:bigint;not null" json:"count"`
+	Average float64 `gorm:"not null" json:"average"`
+
+	// ScoreSum is the sum of the scores, which the average is computed
+	// from.
+	ScoreSum int64 `gorm:"type:bigint;not null" json:"-"`
+
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"-"`
+}
+
+// TableName returns the name of the table of the target scores.
+func (TargetScore) TableName() string {
+	return "targets"
+}
+
+func (rv *ratingValidator) Scores(targets []int64) ([]TargetScore, error) {
+	ids, err := normaliseIDs(targets)
+	if err != nil {
+		return nil, ValidationError{"targets": ErrInvalid}
+	} else if len(ids) == 0 {
+		return nil, ValidationError{"targets": ErrRequired}
+	} else if len(ids) > maxScoreTargets {
+		return nil, ValidationError{"targets": ErrTooLong}
+	}
+
+	return rv.RatingDB.Scores(ids)
+}
+
+func (rg *ratingGorm) Scores(targets []int64) ([]TargetScore, error) {
+	scores := make([]TargetScore, 0, len(targets))
+
+	var err error
+	if rg.scope != nil {
+		// the denormalised scores count the ratings the scope may hide
+		err = rg.probation.counted(rg.read()).Model(&Rating{}).
+			Select("target, count(*) AS count, avg(score) AS average").
+			Where("target IN (?) AND active", targets).
+			Group("target").
+			Order("target").
+			Scan(&scores).
+			Error
+	} else {
+		err = rg.db.Where("target IN (?) AND count > 0", targets).Order("target").Find(&scores).Error
+	}
+	if err != nil {
+		return nil, wrap("failed to get the scores of the targets", err)
+	}
+
+	byTarget := make(map[int64]TargetScore, len(scores))
+	for _, s := range scores {
+		byTarget[s.Target] = s
+	}
+
+	scores = scores[:0]
+	for _, t := range targets {
+		s := byTarget[t]
+		s.Target = t
+		scores = append(scores, s)
+	}
+
+	return scores, nil
+}
+
+// ReconcileTargets recomputes the denormalised scores of the targets, see
+// RatingDB.Scores, of the data shared by the application and of the active and
+// suspended tenants, correcting their drift. It returns the number of targets
+// corrected. The ratings can't be written while the targets of their schema
+// are recomputed.
+func (s *Services) ReconcileTargets() (int64, error) {
+	var corrected int64
+
+	err := gormTransaction(s.db, func(tx *gorm.DB) error {
+		var err error
+		corrected, err = reconcileTargets(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var schemas []string
+	err = s.db.Model(&Tenant{}).
+		Where("schema_name <> '' AND status IN (?)", []string{TenantActive, TenantSuspended}).
+		Order("id").
+		Pluck("schema_name", &schemas).
+		Error
+	if err != nil {
+		return corrected, wrap("failed to list the schemas of the tenants", err)
+	}
+
+	for _, schema := range schemas {
+		err = gormTransaction(s.db, func(tx *gorm.DB) error {
+			err := tx.Exec("SET LOCAL search_path TO " + pq.QuoteIdentifier(schema)).Error
+			if err != nil {
+				return wrap("could not switch to the tenant schema", err)
+			}
+
+			n, err := reconcileTargets(tx)
+			corrected += n
+			return err
+		})
+		if err != nil {
+			return corrected, with(err, "schema", schema)
+		}
+	}
+
+	return corrected, nil
+}
+
+// reconcileTargets recomputes the scores of the targets of the schema of tx,
+// which must be a transaction, and returns the number of targets corrected.
+func reconcileTargets(tx *gorm.DB) (int64, error) {
+	// the triggers of the ratings written meanwhile wait for the lock,
+	// so their changes are not lost, nor counted twice
+	err := tx.Exec("LOCK TABLE targets IN EXCLUSIVE MODE").Error
+	if err != nil {
+		return 0, wrap("could not lock the targets", err)
+	}
+
+	res := tx.Exec(`INSERT INTO targets (target, count, score_sum, average, updated_at)
+		SELECT target, count(*), sum(score), avg(score), now() FROM ratings WHERE active AND NOT held GROUP BY target
+		ON CONFLICT (target) DO UPDATE SET
+			count = EXCLUDED.count,
+			score_sum = EXCLUDED.score_sum,
+			average = EXCLUDED.average,
+			updated_at = EXCLUDED.updated_at
+		WHERE targets.count <> EXCLUDED.count OR targets.score_sum <> EXCLUDED.score_sum`)
+	if res.Error != nil {
+		return 0, wrap("could not recompute the scores of the targets", res.Error)
+	}
+	corrected := res.RowsAffected
+
+	res = tx.Exec(`UPDATE targets SET count = 0, score_sum = 0, average = 0, updated_at = now()
+		WHERE count <> 0 AND NOT EXISTS (SELECT 1 FROM ratings WHERE ratings.target = targets.target AND active AND NOT held)`)
+	if res.Error != nil {
+		return 0, wrap("could not reset the scores of the targets without ratings", res.Error)
+	}
+
+	return corrected + res.RowsAffected, nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingService_Scores(t *testing.T) {
+	trdb := &testRatingDB{}
+	rs := NewRatingService(nil, nil)
+	rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+	tooMany := make([]int64, maxScoreTargets+1)
+	for i := range tooMany {
+		tooMany[i] = int64(i + 1)
+	}
+
+	var cases = []struct {
+		name    string
+		targets []int64
+		outerr  error
+	}{
+		{"required", nil, ValidationError{"targets": ErrRequired}},
+		{"invalid", []int64{3, 0}, ValidationError{"targets": ErrInvalid}},
+		{"tooLong", tooMany, ValidationError{"targets": ErrTooLong}},
+		{"ok", []int64{9, 3, 9}, nil},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			called := false
+			trdb.scores = func(targets []int64) ([]TargetScore, error) {
+				called = true
+				assert.Equal(t, []int64{3, 9}, targets, "must deduplicate the targets")
+				return []TargetScore{}, nil
+			}
+
+			_, err := rs.Scores(cs.targets)
+			assert.Equal(t, cs.outerr, err)
+			assert.Equal(t, cs.outerr == nil, called)
+		})
+	}
+}
+
+func TestRatingGORM_Scores(t *testing.T) {
+	db := setupGorm(t)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 6345, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 11, Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 6345, UserID: 98}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 12, Active: false, Extra: json.RawMessage(`{}`), Score: 9, Target: 6346, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{ID: 13, Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 6346, UserID: 98}).Error)
+	require.NoError(t, db.Exec("UPDATE ratings SET held = true WHERE id = 13").Error)
+
+	scores := func(t *testing.T, rg *ratingGorm) []TargetScore {
+		scores, err := rg.Scores([]int64{6345, 6346, 6347})
+		require.NoError(t, err)
+		return scores
+	}
+	target := func(s TargetScore) TargetScore {
+		return TargetScore{Target: s.Target, Count: s.Count, Average: s.Average}
+	}
+
+	rg := &ratingGorm{db: db}
+	got := scores(t, rg)
+	require.Len(t, got, 3)
+	assert.Equal(t, []TargetScore{
+		{Target: 6345, Count: 2, Average: 3.5},
+		{Target: 6346},
+		{Target: 6347},
+	}, []TargetScore{target(got[0]), target(got[1]), target(got[2])})
+
+	t.Run("updated", func(t *testing.T) {
+		require.NoError(t, db.Model(&Rating{}).Where("id = 11").Update("score", 8).Error)
+		require.NoError(t, db.Model(&Rating{}).Where("id = 12").Update("active", true).Error)
+		require.NoError(t, db.Exec("UPDATE ratings SET held = false WHERE id = 13").Error)
+		require.NoError(t, db.Delete(&Rating{ID: 10}).Error)
+
+		got := scores(t, rg)
+		assert.Equal(t, []TargetScore{
+			{Target: 6345, Count: 1, Average: 8},
+			{Target: 6346, Count: 2, Average: 5},
+			{Target: 6347},
+		}, []TargetScore{target(got[0]), target(got[1]), target(got[2])})
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		scope := func(db *gorm.DB) *gorm.DB { return db.Where("ratings.user_id = ?", 98) }
+
+		got := scores(t, &ratingGorm{db: db, scope: scope})
+		assert.Equal(t, []TargetScore{
+			{Target: 6345, Count: 1, Average: 8},
+			{Target: 6346, Count: 1, Average: 1},
+			{Target: 6347},
+		}, []TargetScore{target(got[0]), target(got[1]), target(got[2])})
+	})
+
+	t.Run("internalError", func(t *testing.T) {
+		require.NoError(t, db.Exec("DROP TABLE targets").Error)
+
+		_, err := rg.Scores([]int64{6345})
+		assert.Error(t, err)
+	})
+}
+
+func TestServices_ReconcileTargets(t *testing.T) {
+	dsl := testsupport.Database(t)
+	db := testsupport.Open(t, dsl)
+
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 6345, UserID: 1}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 6346, UserID: 1}).Error)
+	// drift the scores of a target, and leave one without ratings
+	require.NoError(t, db.Exec("UPDATE targets SET count = 7, score_sum = 1, average = 0.5 WHERE target = 6345").Error)
+	require.NoError(t, db.Exec("INSERT INTO targets (target, count, score_sum, average) VALUES (6347, 1, 3, 3)").Error)
+
+	services, err := NewServices(&Config{JWTSecret: []byte(testJWTSecret), DatabaseDSL: dsl})
+	require.NoError(t, err)
+	defer services.Close()
+
+	corrected, err := services.ReconcileTargets()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), corrected)
+
+	scores, err := (&ratingGorm{db: db}).Scores([]int64{6345, 6346, 6347})
+	require.NoError(t, err)
+	for i, want := range []TargetScore{{Target: 6345, Count: 1, Average: 4}, {Target: 6346, Count: 1, Average: 2}, {Target: 6347}} {
+		assert.Equal(t, want.Count, scores[i].Count, "count of target %d", want.Target)
+		assert.Equal(t, want.Average, scores[i].Average, "average of target %d", want.Target)
+	}
+
+	corrected, err = services.ReconcileTargets()
+	require.NoError(t, err)
+	assert.Zero(t, corrected, "must not correct the targets twice")
+}
@@ -0,0 +1,660 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+//go:generate go run github.com/matryer/moq -out modelstest/tenants.go -pkg modelstest . TenantService:TenantService
+
+// TenantService defines a set of methods to be used when dealing with the
+// tenants, the organisations served by the application, each on its own
+// hostnames.
+type TenantService interface {
+	TenantDB
+
+	// Provision creates a tenant with the TenantProvisioning status, and
+	// prepares its schema in the background: the schema is created and
+	// migrated, and the default roles and an admin user with the
+	// credentials of admin are added to it. The tenant becomes
+	// TenantActive once done, or TenantFailed, and its Progress is
+	// updated along the way.
+	//
+	// A ValidationError is returned if the tenant or admin are not
+	// valid.
+	Provision(t *Tenant, admin TenantAdmin) error
+
+	// Suspend stops serving an active tenant, until it is resumed.
+	// ErrTenantStatus is returned if the tenant is not active.
+	Suspend(id int64) error
+
+	// Resume serves a suspended tenant again. ErrTenantStatus is
+	// returned if the tenant is not suspended.
+	Resume(id int64) error
+
+	// Delete sets a tenant to TenantDeleting, and removes it in the
+	// background with its schema and hostnames, once it is no longer
+	// being provisioned. If the removal fails, the tenant is left
+	// TenantFailed.
+	Delete(id int64) error
+}
+
+// TenantDB defines how the service interacts with the database.
+type TenantDB interface {
+	// Create adds a tenant to the system. The Name field is required, and
+	// the tenant is created without hostnames. The input parameter will
+	// be modified with normalised values and ID will be set to the new
+	// tenant ID.
+	//
+	// The tenant is TenantActive, unless its Status is set to
+	// TenantProvisioning, in which case its Schema is set too. Use
+	// TenantService.Provision to create the tenants with a schema.
+	Create(*Tenant) error
+
+	// Update renames the tenant with ID t.ID, and sets its Limits and
+	// Retention. Its hostnames are not modified, and are set on t on
+	// success.
+	Update(*Tenant) error
+
+	// ByID retrieves a tenant by ID, with its hostnames and the
+	// resources it uses.
+	ByID(id int64) (Tenant, error)
+
+	// ByHostname retrieves the tenant served on a hostname, with its
+	// hostnames. The hostname is normalised as in AddHostname. The
+	// resources it uses are not set, as it is called on every request.
+	//
+	// ErrNotFound is returned if no tenant is served on it.
+	ByHostname(hostname string) (Tenant, error)
+
+	// List retrieves all the tenants with their hostnames and the
+	// resources they use, sorted by ID.
+	List() ([]Tenant, error)
+
+	// AddHostname serves a tenant on a hostname, which is trimmed and
+	// lowercased. A ValidationError is returned if the hostname is not
+	// valid or already taken by another tenant, and ErrNotFound if the
+	// tenant does not exist. Adding a hostname of the tenant again has
+	// no effect.
+	AddHostname(tenantID int64, hostname string) error
+
+	// RemoveHostname stops serving a tenant on a hostname. ErrNotFound is
+	// returned if the tenant is not served on it.
+	RemoveHostname(tenantID int64, hostname string) error
+
+	// SetStatus changes the status of a tenant. If from is not empty,
+	// ErrTenantStatus is returned unless the status of the tenant is one
+	// of from.
+	SetStatus(id int64, status string, from ...string) error
+
+	// SetProgress records the progress of the provisioning or deletion
+	// of a tenant.
+	SetProgress(id int64, p TenantProgress) error
+
+	// Usage returns the resources used by a tenant, with its limits.
+	Usage(tenantID int64) (TenantUsage, error)
+}
+
+// Statuses of the tenants, see Tenant.Status.
+const (
+	TenantActive       = "active"
+	TenantProvisioning = "provisioning"
+	TenantSuspended    = "suspended"
+	TenantDeleting     = "deleting"
+	TenantFailed       = "failed"
+)
+
+// A Tenant is an organisation served by the application. Requests are
+// attributed to a tenant by the hostname they are sent to.
+type Tenant struct {
+	ID int64 `gorm:"primary_key;type:bigserial" json:"id"`
+
+	Name string `gorm:"size:128;not null" json:"name"`
+
+	// Hostnames are the hostnames the tenant is served on, sorted
+	// alphabetically. They are managed with TenantDB.AddHostname and
+	// TenantDB.RemoveHostname.
+	Hostnames []string `gorm:"-" json:"hostnames"`
+
+	// Status is the stage of the tenant in its lifecycle, like
+	// TenantActive. Only the active tenants are served.
+	Status string `gorm:"size:16;not null;default:'active'" json:"status"`
+
+	// Schema is the database schema prepared for the tenant when it is
+	// provisioned. It is empty for the tenants created without one.
+	Schema string `gorm:"column:schema_name;size:63;not null;default:''" json:"schema"`
+
+	// Progress reports the provisioning or deletion of the tenant, in
+	// progress or last run.
+	Progress TenantProgress `gorm:"embedded;embedded_prefix:progress_" json:"progress"`
+
+	// Limits are the resources the tenant can use, not limited when
+	// zero. They are enforced when the users and ratings are created
+	// in its schema, see Services.InTenant, so the tenants without a
+	// schema are not limited.
+	Limits TenantResources `gorm:"embedded;embedded_prefix:limit_" json:"limits"`
+
+	// Retention overrides the fields it sets of the retention policy of
+	// the application on the ratings of the schema of the tenant, see
+	// Services.ApplyRetention.
+	Retention RetentionPolicy `gorm:"embedded;embedded_prefix:retention_" json:"retention"`
+
+	// Used are the resources stored in the schema of the tenant. The
+	// tenants without a schema, sharing the data of the application,
+	// use none.
+	Used TenantResources `gorm:"-" json:"used"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"createdAt"`
+}
+
+// TenantProgress reports the progress of a provisioning or deletion of a
+// tenant, run as a sequence of steps.
+type TenantProgress struct {
+	// Step is the name of the step running, or the last one run.
+	Step string `gorm:"size:32;not null;default:''" json:"step"`
+
+	// Done is the number of steps completed, out of Total.
+	Done  int `gorm:"not null;default:0" json:"done"`
+	Total int `gorm:"not null;default:0" json:"total"`
+
+	// Error describes why the step failed, if it did.
+	Error string `gorm:"not null;default:''" json:"error,omitempty"`
+}
+
+// TenantResources are amounts of the resources used by the tenants.
+type TenantResources struct {
+	Users   int64 `gorm:"not null;default:0" json:"users"`
+	Ratings int64 `gorm:"not null;default:0" json:"ratings"`
+
+	// Storage is the size in bytes of the users, the ratings and their
+	// revisions, as stored.
+	Storage int64 `gorm:"not null;default:0" json:"storage"`
+}
+
+// TenantUsage reports the resources used by a tenant, like for billing.
+type TenantUsage struct {
+	TenantID int64           `json:"tenantId"`
+	Used     TenantResources `json:"used"`
+	Limits   TenantResources `json:"limits"`
+
+	// At is when the usage was read.
+	At time.Time `json:"at"`
+}
+
+// TenantAdmin holds the credentials of the admin user of a tenant, see
+// TenantService.Provision.
+type TenantAdmin struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// A TenantHostname is a hostname a tenant is served on.
+type TenantHostname struct {
+	Hostname string `gorm:"primary_key;size:253"`
+	TenantID int64  `gorm:"type:bigint;not null"`
+}
+
+// hostnameRegex matches the hostnames made of dot-separated labels of letters,
+// digits and hyphens, not starting nor ending with a hyphen.
+var hostnameRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// tenantSchema returns the name of the schema of the tenant with the given ID.
+func tenantSchema(id int64) string {
+	return "tenant_" + strconv.FormatInt(id, 10)
+}
+
+// normaliseHostname trims and lowercases a hostname, removing its trailing dot.
+func normaliseHostname(hostname string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+}
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx carrying t, see TenantFrom.
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, t)
+}
+
+// TenantFrom returns the tenant carried by ctx, or nil if there is none, like
+// in the requests sent to the hostnames of no tenant.
+func TenantFrom(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantContextKey{}).(*Tenant)
+	return t
+}
+
+type tenantService struct {
+	TenantDB
+	provisioner *tenantProvisioner
+}
+
+// NewTenantService instantiates a new TenantService implementation with db as
+// the backing database.
+func NewTenantService(db *gorm.DB) TenantService {
+	return newTenantService(db, &tenantProvisioner{db: db, clock: SystemClock})
+}
+
+// newTenantService instantiates a TenantService provisioning and deleting the
+// tenants with tp, and telling the time with its clock.
+func newTenantService(db *gorm.DB, tp *tenantProvisioner) TenantService {
+	tdb := &tenantValidator{
+		TenantDB: &tenantGorm{db: db, clock: tp.clock},
+	}
+	tp.tenants = tdb
+
+	return &tenantService{
+		TenantDB:    tdb,
+		provisioner: tp,
+	}
+}
+
+func (ts *tenantService) Provision(t *Tenant, admin TenantAdmin) error {
+	admin.Email = strings.ToLower(strings.TrimSpace(admin.Email))
+	switch {
+	case admin.Email == "":
+		return ValidationError{"admin.email": ErrRequired}
+	case !emailRegex.MatchString(admin.Email):
+		return ValidationError{"admin.email": ErrInvalid}
+	case admin.Password == "":
+		return ValidationError{"admin.password": ErrRequired}
+	case len(admin.Password) < 8:
+		return ValidationError{"admin.password": ErrTooShort}
+	}
+
+	t.Status = TenantProvisioning
+	err := ts.TenantDB.Create(t)
+	if err != nil {
+		return err
+	}
+
+	ts.provisioner.start(func() { ts.provisioner.provision(*t, admin) })
+	return nil
+}
+
+func (ts *tenantService) Suspend(id int64) error {
+	return ts.TenantDB.SetStatus(id, TenantSuspended, TenantActive)
+}
+
+func (ts *tenantService) Resume(id int64) error {
+	return ts.TenantDB.SetStatus(id, TenantActive, TenantSuspended)
+}
+
+func (ts *tenantService) Delete(id int64) error {
+	t, err := ts.TenantDB.ByID(id)
+	if err != nil {
+		return err
+	}
+
+	err = ts.TenantDB.SetStatus(id, TenantDeleting)
+	if err != nil {
+		return err
+	}
+
+	ts.provisioner.start(func() { ts.provisioner.remove(t) })
+	return nil
+}
+
+type tenantValidator struct {
+	TenantDB
+}
+
+func (tv *tenantValidator) Create(t *Tenant) error {
+	t.ID = 0
+	t.Schema = ""
+	t.Progress = TenantProgress{}
+	t.Used = TenantResources{}
+	if t.Status != TenantProvisioning {
+		t.Status = ""
+	}
+
+	err := tv.validate(t)
+	if err != nil {
+		return err
+	}
+
+	return tv.TenantDB.Create(t)
+}
+
+func (tv *tenantValidator) Update(t *Tenant) error {
+	if t.ID < 1 {
+		return ErrNotFound
+	}
+
+	err := tv.validate(t)
+	if err != nil {
+		return err
+	}
+
+	return tv.TenantDB.Update(t)
+}
+
+// validate checks the fields of t, normalising them.
+func (tv *tenantValidator) validate(t *Tenant) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return ValidationError{"name": ErrRequired}
+	} else if len(t.Name) > 128 {
+		return ValidationError{"name": ErrTooLong}
+	}
+
+	switch {
+	case t.Limits.Users < 0:
+		return ValidationError{"limits.users": ErrInvalid}
+	case t.Limits.Ratings < 0:
+		return ValidationError{"limits.ratings": ErrInvalid}
+	case t.Limits.Storage < 0:
+		return ValidationError{"limits.storage": ErrInvalid}
+	}
+
+	return t.Retention.validate("retention.")
+}
+
+func (tv *tenantValidator) ByID(id int64) (Tenant, error) {
+	if id < 1 {
+		return Tenant{}, ErrNotFound
+	}
+
+	return tv.TenantDB.ByID(id)
+}
+
+func (tv *tenantValidator) ByHostname(hostname string) (Tenant, error) {
+	hostname = normaliseHostname(hostname)
+	if hostname == "" {
+		return Tenant{}, ErrNotFound
+	}
+
+	return tv.TenantDB.ByHostname(hostname)
+}
+
+func (tv *tenantValidator) AddHostname(tenantID int64, hostname string) error {
+	if tenantID < 1 {
+		return ErrNotFound
+	}
+
+	hostname = normaliseHostname(hostname)
+	switch {
+	case hostname == "":
+		return ValidationError{"hostname": ErrRequired}
+	case len(hostname) > 253:
+		return ValidationError{"hostname": ErrTooLong}
+	case !hostnameRegex.MatchString(hostname):
+		return ValidationError{"hostname": ErrInvalid}
+	}
+
+	return tv.TenantDB.AddHostname(tenantID, hostname)
+}
+
+func (tv *tenantValidator) RemoveHostname(tenantID int64, hostname string) error {
+	if tenantID < 1 {
+		return ErrNotFound
+	}
+
+	return tv.TenantDB.RemoveHostname(tenantID, normaliseHostname(hostname))
+}
+
+func (tv *tenantValidator) SetStatus(id int64, status string, from ...string) error {
+	if id < 1 {
+		return ErrNotFound
+	}
+
+	return tv.TenantDB.SetStatus(id, status, from...)
+}
+
+func (tv *tenantValidator) Usage(tenantID int64) (TenantUsage, error) {
+	if tenantID < 1 {
+		return TenantUsage{}, ErrNotFound
+	}
+
+	return tv.TenantDB.Usage(tenantID)
+}
+
+type tenantGorm struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+func (tg *tenantGorm) Create(t *Tenant) error {
+	t.CreatedAt = tg.clock.Now()
+	t.Hostnames = []string{}
+	if t.Status == "" {
+		t.Status = TenantActive
+	}
+
+	err := gormTransaction(tg.db, func(tx *gorm.DB) error {
+		err := tx.Create(t).Error
+		if err != nil || t.Status != TenantProvisioning {
+			return err
+		}
+
+		t.Schema = tenantSchema(t.ID)
+		return tx.Model(t).Update("schema_name", t.Schema).Error
+	})
+	if err != nil {
+		return wrap("could not create tenant", err)
+	}
+
+	return nil
+}
+
+func (tg *tenantGorm) Update(t *Tenant) error {
+	res := tg.db.Model(&Tenant{}).Where("id = ?", t.ID).Updates(map[string]interface{}{
+		"name":          t.Name,
+		"limit_users":   t.Limits.Users,
+		"limit_ratings": t.Limits.Ratings,
+		"limit_storage": t.Limits.Storage,
+
+		"retention_days": t.Retention.Days,
+		"retention_mode": t.Retention.Mode,
+	})
+	if res.Error != nil {
+		return with(wrap("could not update tenant", res.Error), "tenant_id", t.ID)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	var err error
+	*t, err = tg.ByID(t.ID)
+	return err
+}
+
+func (tg *tenantGorm) ByID(id int64) (Tenant, error) {
+	t, err := tg.byID(id)
+	if err != nil {
+		return Tenant{}, err
+	}
+
+	tenants := []Tenant{t}
+	err = tg.setUsed(tenants)
+	if err != nil {
+		return Tenant{}, err
+	}
+
+	return tenants[0], nil
+}
+
+// byID retrieves a tenant by ID, with its hostnames only.
+func (tg *tenantGorm) byID(id int64) (Tenant, error) {
+	var t Tenant
+	err := tg.db.First(&t, id).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return Tenant{}, ErrNotFound
+		}
+		return Tenant{}, with(wrap("could not get tenant by ID", err), "tenant_id", id)
+	}
+
+	tenants := []Tenant{t}
+	err = tg.setHostnames(tenants)
+	if err != nil {
+		return Tenant{}, err
+	}
+
+	return tenants[0], nil
+}
+
+func (tg *tenantGorm) ByHostname(hostname string) (Tenant, error) {
+	var h TenantHostname
+	err := tg.db.Where("hostname = ?", hostname).First(&h).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return Tenant{}, ErrNotFound
+		}
+		return Tenant{}, with(wrap("could not get tenant by hostname", err), "hostname", hostname)
+	}
+
+	return tg.byID(h.TenantID)
+}
+
+func (tg *tenantGorm) List() ([]Tenant, error) {
+	tenants := []Tenant{}
+	err := tg.db.Order("id").Find(&tenants).Error
+	if err != nil {
+		return nil, wrap("could not list tenants", err)
+	}
+
+	err = tg.setHostnames(tenants)
+	if err == nil {
+		err = tg.setUsed(tenants)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tenants, nil
+}
+
+// setHostnames sets the hostnames of each of the tenants.
+func (tg *tenantGorm) setHostnames(tenants []Tenant) error {
+	if len(tenants) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(tenants))
+	byID := make(map[int64]*Tenant, len(tenants))
+	for i := range tenants {
+		ids[i] = tenants[i].ID
+		byID[tenants[i].ID] = &tenants[i]
+		tenants[i].Hostnames = []string{}
+	}
+
+	var hostnames []TenantHostname
+	err := tg.db.Where("tenant_id IN (?)", ids).Order("hostname").Find(&hostnames).Error
+	if err != nil {
+		return wrap("could not get tenant hostnames", err)
+	}
+
+	for _, h := range hostnames {
+		t := byID[h.TenantID]
+		t.Hostnames = append(t.Hostnames, h.Hostname)
+	}
+
+	return nil
+}
+
+// setUsed sets the resources used by each of the tenants, stored in their
+// schemas. The schemas of the tenants not active nor suspended may not be
+// ready, or may be gone, so they are not read.
+func (tg *tenantGorm) setUsed(tenants []Tenant) error {
+	for i, t := range tenants {
+		tenants[i].Used = TenantResources{}
+		if t.Schema == "" || (t.Status != TenantActive && t.Status != TenantSuspended) {
+			continue
+		}
+
+		used, err := schemaUsage(tg.db, t.Schema)
+		if err != nil {
+			return with(err, "tenant_id", t.ID)
+		}
+		tenants[i].Used = used
+	}
+
+	return nil
+}
+
+func (tg *tenantGorm) AddHostname(tenantID int64, hostname string) error {
+	res := tg.db.Exec("INSERT INTO tenant_hostnames (hostname, tenant_id) VALUES (?, ?) ON CONFLICT (hostname) DO UPDATE SET tenant_id = EXCLUDED.tenant_id WHERE tenant_hostnames.tenant_id = EXCLUDED.tenant_id",
+		hostname, tenantID)
+	if res.Error != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ErrNotFound
+		}
+
+		return with(wrap("could not add tenant hostname", res.Error), "tenant_id", tenantID)
+	} else if res.RowsAffected == 0 {
+		// served by another tenant
+		return ValidationError{"hostname": ErrDuplicate}
+	}
+
+	return nil
+}
+
+func (tg *tenantGorm) SetStatus(id int64, status string, from ...string) error {
+	q := tg.db.Model(&Tenant{}).Where("id = ?", id)
+	if len(from) > 0 {
+		q = q.Where("status IN (?)", from)
+	}
+
+	res := q.Update("status", status)
+	if res.Error != nil {
+		return with(wrap("could not set tenant status", res.Error), "tenant_id", id)
+	} else if res.RowsAffected == 0 {
+		// either missing or in another status
+		_, err := tg.ByID(id)
+		if err != nil {
+			return err
+		}
+		return ErrTenantStatus
+	}
+
+	return nil
+}
+
+func (tg *tenantGorm) SetProgress(id int64, p TenantProgress) error {
+	err := tg.db.Model(&Tenant{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"progress_step":  p.Step,
+		"progress_done":  p.Done,
+		"progress_total": p.Total,
+		"progress_error": p.Error,
+	}).Error
+	if err != nil {
+		return with(wrap("could not set tenant progress", err), "tenant_id", id)
+	}
+
+	return nil
+}
+
+func (tg *tenantGorm) Usage(tenantID int64) (TenantUsage, error) {
+	var t Tenant
+	err := tg.db.First(&t, tenantID).Error
+	if err != nil {
+		if xerrors.Is(err, gorm.ErrRecordNotFound) {
+			return TenantUsage{}, ErrNotFound
+		}
+		return TenantUsage{}, with(wrap("could not get tenant usage", err), "tenant_id", tenantID)
+	}
+
+	tenants := []Tenant{t}
+	err = tg.setUsed(tenants)
+	if err != nil {
+		return TenantUsage{}, err
+	}
+
+	return TenantUsage{TenantID: t.ID, Used: tenants[0].Used, Limits: t.Limits, At: tg.clock.Now()}, nil
+}
+
+func (tg *tenantGorm) RemoveHostname(tenantID int64, hostname string) error {
+	res := tg.db.Where("hostname = ? AND tenant_id = ?", hostname, tenantID).Delete(&TenantHostname{})
+	if res.Error != nil {
+		return with(wrap("could not remove tenant hostname", res.Error), "tenant_id", tenantID)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTenantDB struct {
+	TenantDB
+	hostname string
+}
+
+func (t *testTenantDB) Create(tn *Tenant) error {
+	return nil
+}
+
+func (t *testTenantDB) AddHostname(tenantID int64, hostname string) error {
+	t.hostname = hostname
+	return nil
+}
+
+func TestTenantValidator(t *testing.T) {
+	tdb := &testTenantDB{}
+	tv := &tenantValidator{TenantDB: tdb}
+
+	t.Run("create", func(t *testing.T) {
+		tn := Tenant{ID: 5, Name: " Acme "}
+		require.NoError(t, tv.Create(&tn))
+		assert.Equal(t, Tenant{Name: "Acme"}, tn)
+
+		assert.Equal(t, ValidationError{"name": ErrRequired}, tv.Create(&Tenant{Name: " "}))
+		assert.Equal(t, ValidationError{"name": ErrTooLong}, tv.Create(&Tenant{Name: strings.Repeat("a", 129)}))
+		assert.Equal(t, ErrNotFound, tv.Update(&Tenant{Name: "Acme"}))
+
+		tn = Tenant{Name: "Acme", Used: TenantResources{Users: 3}}
+		require.NoError(t, tv.Create(&tn))
+		assert.Equal(t, TenantResources{}, tn.Used, "must not set the resources used")
+		assert.Equal(t, ValidationError{"limits.users": ErrInvalid}, tv.Create(&Tenant{Name: "Acme", Limits: TenantResources{Users: -1}}))
+		assert.Equal(t, ValidationError{"limits.storage": ErrInvalid}, tv.Create(&Tenant{Name: "Acme", Limits: TenantResources{Storage: -1}}))
+		assert.Equal(t, ValidationError{"retention.mode": ErrInvalid}, tv.Create(&Tenant{Name: "Acme", Retention: RetentionPolicy{Mode: "delete"}}))
+	})
+
+	var cases = []struct {
+		name     string
+		hostname string
+		out      string
+		outerr   error
+	}{
+		{"ok", "acme.ratings.test", "acme.ratings.test", nil},
+		{"normalised", " Acme.Ratings.Test. ", "acme.ratings.test", nil},
+		{"singleLabel", "localhost", "localhost", nil},
+		{"required", " ", "", ValidationError{"hostname": ErrRequired}},
+		{"port", "acme.ratings.test:8000", "", ValidationError{"hostname": ErrInvalid}},
+		{"hyphen", "-acme.ratings.test", "", ValidationError{"hostname": ErrInvalid}},
+		{"emptyLabel", "acme..test", "", ValidationError{"hostname": ErrInvalid}},
+		{"tooLong", strings.Repeat("a.", 127) + "test", "", ValidationError{"hostname": ErrTooLong}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tdb.hostname = ""
+			err := tv.AddHostname(3, tc.hostname)
+			assert.Equal(t, tc.outerr, err)
+			assert.Equal(t, tc.out, tdb.hostname)
+		})
+	}
+}
+
+func TestTenantService_Provision(t *testing.T) {
+	ts := &tenantService{TenantDB: &testTenantDB{}}
+
+	var cases = []struct {
+		name   string
+		admin  TenantAdmin
+		outerr error
+	}{
+		{"emailRequired", TenantAdmin{Password: "very long password"}, ValidationError{"admin.email": ErrRequired}},
+		{"emailInvalid", TenantAdmin{Email: "admin", Password: "very long password"}, ValidationError{"admin.email": ErrInvalid}},
+		{"passwordRequired", TenantAdmin{Email: "admin@acme.test"}, ValidationError{"admin.password": ErrRequired}},
+		{"passwordTooShort", TenantAdmin{Email: "admin@acme.test", Password: "short"}, ValidationError{"admin.password": ErrTooShort}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.outerr, ts.Provision(&Tenant{Name: "Acme"}, tc.admin))
+		})
+	}
+}
+
+func TestTenantContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, TenantFrom(ctx))
+
+	tn := &Tenant{ID: 3}
+	assert.Equal(t, tn, TenantFrom(WithTenant(ctx, tn)))
+}
+
+func TestTenantGorm(t *testing.T) {
+	db := setupGorm(t)
+	ts := NewTenantService(db)
+
+	acme := Tenant{Name: "Acme"}
+	require.NoError(t, ts.Create(&acme))
+	assert.NotZero(t, acme.ID)
+	globex := Tenant{Name: "Globex"}
+	require.NoError(t, ts.Create(&globex))
+
+	require.NoError(t, ts.AddHostname(acme.ID, "www.acme.test"))
+	require.NoError(t, ts.AddHostname(acme.ID, "acme.test"))
+	require.NoError(t, ts.AddHostname(acme.ID, "acme.test"), "must accept adding a hostname again")
+	assert.Equal(t, ValidationError{"hostname": ErrDuplicate}, ts.AddHostname(globex.ID, "acme.test"))
+	assert.Equal(t, ErrNotFound, ts.AddHostname(404, "unknown.test"))
+
+	got, err := ts.ByHostname("ACME.test")
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, got.ID)
+	assert.Equal(t, []string{"acme.test", "www.acme.test"}, got.Hostnames)
+
+	_, err = ts.ByHostname("globex.test")
+	assert.Equal(t, ErrNotFound, err)
+
+	acme.Name = "Acme Corp"
+	require.NoError(t, ts.Update(&acme))
+	assert.Equal(t, []string{"acme.test", "www.acme.test"}, acme.Hostnames)
+
+	list, err := ts.List()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "Acme Corp", list[0].Name)
+	assert.Equal(t, []string{}, list[1].Hostnames)
+
+	require.NoError(t, ts.RemoveHostname(acme.ID, "www.acme.test"))
+	assert.Equal(t, ErrNotFound, ts.RemoveHostname(globex.ID, "acme.test"))
+	got, err = ts.ByID(acme.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme.test"}, got.Hostnames)
+}
+
+func TestTenantQuotas(t *testing.T) {
+	s, err := NewServices(&Config{
+		JWTSecret:   []byte("test secret with long size and other"),
+		DatabaseDSL: testsupport.Database(t),
+	})
+	require.NoError(t, err)
+
+	// the admin is the first user
+	acme := Tenant{Name: "Acme", Limits: TenantResources{Users: 2, Ratings: 1}}
+	require.NoError(t, s.Tenant.Provision(&acme, TenantAdmin{Email: "admin@acme.test", Password: "very long password"}))
+	s.provisioner.wait()
+
+	u, err := s.Tenant.Usage(acme.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), u.Used.Users)
+	assert.True(t, u.Used.Storage > 0, "must count the bytes of the admin")
+	assert.Equal(t, acme.Limits, u.Limits)
+	assert.False(t, u.At.IsZero())
+
+	var userID int64
+	err = s.InTenant(&acme, func(ts *Services) error {
+		u := User{Active: true, Email: "user@acme.test", FirstName: "Acme", Password: "very long password", RoleID: 2}
+		require.NoError(t, ts.User.Create(&u))
+		userID = u.ID
+
+		u = User{Active: true, Email: "other@acme.test", FirstName: "Acme", Password: "very long password", RoleID: 2}
+		assert.Equal(t, ErrQuotaExceeded, ts.User.Create(&u))
+
+		r := NewRating()
+		r.Score, r.Target, r.UserID = 5, 9, userID
+		require.NoError(t, ts.Rating.Create(&r))
+
+		// the request goes on, and is committed without the rating
+		// refused
+		r2 := NewRating()
+		r2.Score, r2.Target, r2.UserID = 4, 10, userID
+		assert.Equal(t, ErrQuotaExceeded, ts.Rating.Create(&r2))
+		return nil
+	})
+	require.NoError(t, err)
+
+	u, err = s.Tenant.Usage(acme.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), u.Used.Users)
+	assert.Equal(t, int64(1), u.Used.Ratings)
+
+	err = s.InTenant(&acme, func(ts *Services) error {
+		ratings, err := ts.Rating.ByTarget(9)
+		require.NoError(t, err)
+		require.Len(t, ratings, 1)
+		require.NoError(t, ts.Rating.Delete(&ratings[0]))
+
+		r := NewRating()
+		r.Score, r.Target, r.UserID = 4, 10, userID
+		assert.NoError(t, ts.Rating.Create(&r), "must release the ratings deleted")
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the tenants without a schema share the data, and are not limited
+	globex := Tenant{Name: "Globex", Limits: TenantResources{Users: 1}}
+	require.NoError(t, s.Tenant.Create(&globex))
+	err = s.InTenant(&globex, func(ts *Services) error {
+		u := User{Active: true, Email: "user@globex.test", FirstName: "Globex", Password: "very long password", RoleID: 2}
+		return ts.User.Create(&u)
+	})
+	require.NoError(t, err)
+
+	u, err = s.Tenant.Usage(globex.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TenantResources{}, u.Used)
+
+	_, err = s.Tenant.Usage(404)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestTenantLifecycle(t *testing.T) {
+	db := setupGorm(t)
+
+	var changed []int64
+	tp := &tenantProvisioner{db: db, clock: SystemClock, onChanged: func(t Tenant) { changed = append(changed, t.ID) }}
+	ts := newTenantService(db, tp)
+
+	acme := Tenant{Name: "Acme"}
+	require.NoError(t, ts.Provision(&acme, TenantAdmin{Email: " Admin@Acme.test", Password: "very long password"}))
+	assert.Equal(t, TenantProvisioning, acme.Status)
+	assert.Equal(t, tenantSchema(acme.ID), acme.Schema)
+	tp.wait()
+
+	got, err := ts.ByID(acme.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TenantActive, got.Status)
+	assert.Equal(t, TenantProgress{Step: "admin", Done: 5, Total: 5}, got.Progress)
+	assert.Equal(t, []int64{acme.ID}, changed)
+
+	t.Run("schema", func(t *testing.T) {
+		var roles int
+		require.NoError(t, db.Table(acme.Schema+".roles").Count(&roles).Error)
+		assert.Equal(t, 2, roles)
+
+		var admin User
+		require.NoError(t, db.Table(acme.Schema+".users").Where("id = ?", adminID).First(&admin).Error)
+		assert.Equal(t, "admin@acme.test", admin.Email)
+		assert.Equal(t, int64(1), admin.RoleID)
+
+		var users int
+		require.NoError(t, db.Model(&User{}).Where("email = ?", "admin@acme.test").Count(&users).Error)
+		assert.Zero(t, users, "must not create the admin in the public schema")
+
+		require.NoError(t, migrateTenants(db), "must find the tenant schemas migrated")
+	})
+
+	t.Run("suspend", func(t *testing.T) {
+		require.NoError(t, ts.Suspend(acme.ID))
+		assert.Equal(t, ErrTenantStatus, ts.Suspend(acme.ID))
+		assert.Equal(t, ErrNotFound, ts.Suspend(404))
+
+		require.NoError(t, ts.Resume(acme.ID))
+		assert.Equal(t, ErrTenantStatus, ts.Resume(acme.ID))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, ts.AddHostname(acme.ID, "acme.test"))
+		require.NoError(t, ts.Delete(acme.ID))
+		tp.wait()
+
+		_, err := ts.ByID(acme.ID)
+		assert.Equal(t, ErrNotFound, err)
+		_, err = ts.ByHostname("acme.test")
+		assert.Equal(t, ErrNotFound, err)
+
+		var schemas int
+		require.NoError(t, db.Table("information_schema.schemata").Where("schema_name = ?", acme.Schema).Count(&schemas).Error)
+		assert.Zero(t, schemas, "must drop the schema of the tenant")
+	})
+}
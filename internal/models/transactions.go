@@ -0,0 +1,634 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/noelruault/ratingsapp/internal/tracing"
+)
+
+// WithTransaction calls f with copies of the User, Role and Rating services
+// running in a single database transaction, so several models can be changed
+// atomically, like a rating and the settings of its author. The transaction is
+// committed if f returns nil, and rolled back otherwise, or if f panics.
+//
+// Only the User, Role and Rating services of tx are set, and they are only
+// valid while f runs. They bypass the cache, and their events are published,
+// and the cached values they changed invalidated, once the transaction is
+// committed. Calling WithTransaction on tx runs f in a savepoint of the
+// transaction instead.
+//
+// The sessions of the users and the quota of the ratings are not part of the
+// transaction.
+func (s *Services) WithTransaction(f func(tx *Services) error) error {
+	changes := &txChanges{}
+
+	err := gormTransaction(s.db, func(db *gorm.DB) error {
+		tx, err := s.inTransaction(db, changes)
+		if err != nil {
+			return err
+		}
+
+		return f(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.changes != nil {
+		// only committed along with the outer transaction
+		s.changes.merge(changes)
+		return nil
+	}
+
+	s.committed(changes)
+	return nil
+}
+
+// inTransaction returns the services running in the transaction db, recording
+// their changes.
+func (s *Services) inTransaction(db *gorm.DB, changes *txChanges) (*Services, error) {
+	tx := &Services{
+		Events:    s.Events,
+		db:        db,
+		jwtKeys:   s.jwtKeys,
+		policy:    s.policy,
+		sessions:  s.sessions,
+		security:  s.security,
+		auth:      s.auth,
+		quota:     s.quota,
+		probation: s.probation,
+		rules:     s.rules,
+		fields:    s.fields,
+		clock:     s.clock,
+		changes:   changes,
+		outbox:    s.outbox,
+		org:       s.org,
+
+		omitUserRoles: s.omitUserRoles,
+	}
+
+	tx.Role = &roleChanges{RoleService: newRoleService(db, s.rules), changes: changes}
+	if s.org != 0 {
+		tx.Role = &roleOrganisation{RoleService: tx.Role, org: s.org}
+	}
+
+	var err error
+	tx.User, err = newUserService(db, tx.Role, s.jwtKeys, s.sessions, s.security, s.auth, s.rules, s.clock, s.omitUserRoles)
+	if err != nil {
+		return nil, wrap("can't start UserService", err)
+	}
+	tx.User = newUserEvents(tx.User, changes)
+	tx.User = &userChanges{UserService: tx.User, changes: changes}
+	tx.User = &userRatingChanges{UserService: tx.User, targets: tx.ratedTargets, changed: changes.targetChanged}
+	if s.org != 0 {
+		tx.User = &userOrganisation{UserService: tx.User, org: s.org}
+	}
+
+	rating := newRatingService(db, tx.User, s.policy, s.quota, s.probation, s.rules, tx.fields, s.clock, s.outbox, s.verification)
+	if s.org != 0 {
+		rating = rating.inOrganisation(s.org)
+	}
+	tx.Rating = &ratingChanges{RatingService: rating, changes: changes}
+
+	if s.limits != nil {
+		tx.limits = s.limits.in(db)
+		tx.User = &userLimits{UserService: tx.User, limits: tx.limits}
+		tx.Rating = &ratingLimits{RatingService: tx.Rating, limits: tx.limits}
+	}
+
+	return tx, nil
+}
+
+// InTenant calls f with copies of the services running in a single database
+// transaction on the schema of t, so the requests sent to a provisioned tenant
+// only read and change its own data. The transaction is committed if f returns
+// nil, and rolled back otherwise, or if f panics. Tenants without a schema share
+// the data of the application: f is called with s.
+//
+// Only the User, Role, Rating, Sync, Reputation, Consent, AuthCode, Identity,
+// Invitation, Audit, Campaign, Category, Retention, Reply and Attachment
+// services of ts are set, and they are only valid while f runs. The Identity
+// and Attachment services are only set if the ones of s are. They bypass the cache, their
+// events are not published, and the sessions of their users are not tracked.
+// The tokens of the users of a tenant, and of their invitations, are signed
+// with a key derived from the JWT secrets, as their IDs overlap with the ones of
+// the other tenants. The quota of the ratings counts the ratings of the tenant,
+// and the users and ratings created are limited by the limits of t, see
+// Tenant.Limits.
+func (s *Services) InTenant(t *Tenant, f func(ts *Services) error) error {
+	if t == nil || t.Schema == "" {
+		return f(s)
+	}
+
+	return gormTransaction(s.db, func(db *gorm.DB) error {
+		ts, err := s.inTenant(db, t)
+		if err != nil {
+			return err
+		}
+
+		return f(ts)
+	})
+}
+
+// InRequest calls f with copies of the services serving a request, whose
+// statements are cancelled once they run for longer than
+// Config.StatementTimeout, and whose queries are traced as children of the span
+// in ctx, like the span of the request.
+//
+// The requests to the provisioned tenant t run in a single database transaction
+// on its schema, with the services set as with InTenant, which is committed if f
+// returns nil, and rolled back otherwise, or if f panics. The other requests run
+// on the data shared by the application, out of a transaction, so none is held
+// open while they call other services, and the changes made before a failure
+// are kept: the services of rs are the ones InTenant sets, but they are read
+// through the cache, and their events are published, and the cached values they
+// changed invalidated, once f returns.
+//
+// The requests of the users of an organisation on the data shared by the
+// application, whose ctx carries it, see WithOrganisation, only reach its users,
+// roles, ratings and campaigns, and the shared roles, which they can't change.
+// The other users, roles and campaigns are not found, and the ratings are scoped
+// as with RatingService.Scoped. The users, roles and campaigns created belong to
+// the organisation, and the ratings to the one of their author. Their ratings
+// are not read through the cache.
+func (s *Services) InRequest(ctx context.Context, t *Tenant, f func(rs *Services) error) error {
+	db := tracing.WithContext(s.requests, ctx)
+
+	if t != nil && t.Schema != "" {
+		return gormTransaction(db, func(db *gorm.DB) error {
+			ts, err := s.inTenant(db, t)
+			if err != nil {
+				return err
+			}
+
+			return f(ts)
+		})
+	}
+
+	changes := &txChanges{}
+	rs, err := s.inRequest(db, changes, OrganisationFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	// the statements are committed as they run, even if f fails
+	defer s.committed(changes)
+	return f(rs)
+}
+
+// inRequest returns the services serving a request on the data shared by the
+// application with db, recording their changes, see InRequest. They only reach
+// the organisation org, if not zero.
+func (s *Services) inRequest(db *gorm.DB, changes *txChanges, org int64) (*Services, error) {
+	rs := &Services{
+		Events:         s.Events,
+		db:             db,
+		jwtKeys:        s.jwtKeys,
+		policy:         s.policy,
+		sessions:       s.sessions,
+		security:       s.security,
+		auth:           s.auth,
+		quota:          s.quota,
+		probation:      s.probation,
+		verification:   s.verification,
+		rules:          s.rules,
+		fields:         s.fields,
+		attachments:    s.attachments,
+		consentVersion: s.consentVersion,
+		oauthClients:   s.oauthClients,
+		identities:     s.identities,
+		invitationURL:  s.invitationURL,
+		clock:          s.clock,
+		changes:        changes,
+		outbox:         s.outbox,
+		retention:      s.retention,
+		org:            org,
+
+		omitUserRoles: s.omitUserRoles,
+	}
+
+	rs.Role = newRoleService(db, s.rules)
+	if l, ok := s.loaders["roles"]; ok {
+		rs.Role = newRoleCache(rs.Role, l)
+	}
+	rs.Role = &roleChanges{RoleService: rs.Role, changes: changes}
+	if org != 0 {
+		rs.Role = &roleOrganisation{RoleService: rs.Role, org: org}
+	}
+
+	var err error
+	rs.User, err = newUserService(db, rs.Role, s.jwtKeys, s.sessions, s.security, s.auth, s.rules, s.clock, s.omitUserRoles)
+	if err != nil {
+		return nil, wrap("can't start UserService", err)
+	}
+	rs.User = newUserEvents(rs.User, changes)
+	if l, ok := s.loaders["tokens"]; ok {
+		rs.User = newUserCache(rs.User, l, rs.Role, s.clock)
+	}
+	rs.User = &userChanges{UserService: rs.User, changes: changes}
+	rs.User = &userRatingChanges{UserService: rs.User, targets: rs.ratedTargets, changed: changes.targetChanged}
+	if org != 0 {
+		rs.User = &userOrganisation{UserService: rs.User, org: org}
+	}
+
+	rating := newRatingService(db, rs.User, s.policy, s.quota, s.probation, s.rules, s.fields, s.clock, s.outbox, s.verification)
+	if org != 0 {
+		rating = rating.inOrganisation(org)
+	}
+	rs.Rating = rating
+	if s.attachments != nil {
+		rs.Attachment = newAttachmentService(db, s.attachments, s.clock)
+		rs.Rating = &ratingAttachments{RatingService: rs.Rating, attachments: rs.Attachment, files: s.attachments}
+	}
+	// the cached ratings are the ones of every organisation
+	if l, ok := s.loaders["ratings"]; ok && org == 0 {
+		rs.Rating = newRatingCache(rs.Rating, l)
+	}
+	rs.Rating = &ratingChanges{RatingService: rs.Rating, changes: changes}
+
+	moderated := func(r Rating) { changes.targetChanged(r.Target) }
+	rs.Sync = newSyncService(db, s.policy)
+	rs.Reputation = newReputationEvents(newReputationService(db, s.probation, moderated, s.outbox), changes)
+	rs.Consent = newConsentService(db, s.consentVersion, s.clock)
+	rs.AuthCode = newAuthCodeService(db, rs.User, s.oauthClients, s.clock)
+	if s.identities != nil {
+		rs.Identity = newIdentityService(db, rs.User, s.identities, s.clock)
+	}
+	rs.Invitation = newInvitationService(db, rs.User, rs.Role, s.jwtKeys, s.invitationURL, s.clock)
+	rs.Audit = newAuditService(db, s.clock)
+	rs.Campaign = newCampaignService(db, s.clock)
+	if org != 0 {
+		rs.Campaign = &campaignOrganisation{CampaignService: rs.Campaign, org: org}
+	}
+	rs.Category = newTargetCategoryService(db, s.clock)
+	rs.Retention = newRetentionService(db, s.retention)
+	rs.Reply = newReplyEvents(newReplyService(db, s.clock), changes)
+
+	return rs, nil
+}
+
+// inTenant switches the transaction db to the schema of t, and returns the
+// services running on it, see InTenant.
+func (s *Services) inTenant(db *gorm.DB, t *Tenant) (*Services, error) {
+	// the public schema is left out, so the tables shared by the tenants
+	// can't be reached
+	err := db.Exec("SET LOCAL search_path TO " + pq.QuoteIdentifier(t.Schema)).Error
+	if err != nil {
+		return nil, with(wrap("could not switch to the tenant schema", err), "tenant_id", t.ID)
+	}
+
+	ts := &Services{
+		Events:         events.NewBus(0),
+		db:             db,
+		jwtKeys:        s.jwtKeys.tenant(t.Schema),
+		security:       s.security,
+		auth:           s.auth,
+		policy:         s.policy,
+		probation:      s.probation,
+		rules:          s.rules,
+		fields:         s.fields,
+		attachments:    s.attachments,
+		consentVersion: s.consentVersion,
+		oauthClients:   s.oauthClients,
+		identities:     s.identities,
+		invitationURL:  s.invitationURL,
+		clock:          s.clock,
+		omitUserRoles:  s.omitUserRoles,
+		changes:        &txChanges{},
+		limits:         &tenantLimits{db: db, limits: t.Limits},
+		retention:      s.retention.override(t.Retention),
+	}
+	if s.quota != nil {
+		ts.quota = &ratingQuota{RatingQuota: s.quota.RatingQuota, db: db, clock: s.quota.clock}
+	}
+
+	ts.Role = newRoleService(db, s.rules)
+
+	ts.User, err = newUserService(db, ts.Role, ts.jwtKeys, nil, s.security, s.auth, s.rules, s.clock, s.omitUserRoles)
+	if err != nil {
+		return nil, wrap("can't start UserService", err)
+	}
+
+	ts.User = &userLimits{UserService: ts.User, limits: ts.limits}
+
+	ts.Rating = newRatingService(db, ts.User, s.policy, ts.quota, s.probation, s.rules, ts.fields, s.clock, nil, s.verification)
+	ts.Rating = &ratingLimits{RatingService: ts.Rating, limits: ts.limits}
+	ts.Sync = newSyncService(db, s.policy)
+	ts.Reputation = newReputationService(db, s.probation, nil, nil)
+	ts.Consent = newConsentService(db, s.consentVersion, s.clock)
+	ts.AuthCode = newAuthCodeService(db, ts.User, s.oauthClients, s.clock)
+	if s.identities != nil {
+		ts.Identity = newIdentityService(db, ts.User, s.identities, s.clock)
+	}
+	ts.Invitation = newInvitationService(db, ts.User, ts.Role, ts.jwtKeys, s.invitationURL, s.clock)
+	ts.Audit = newAuditService(db, s.clock)
+	ts.Campaign = newCampaignService(db, s.clock)
+	ts.Category = newTargetCategoryService(db, s.clock)
+	ts.Retention = newRetentionService(db, ts.retention)
+	ts.Reply = newReplyService(db, s.clock)
+	if s.attachments != nil {
+		ts.Attachment = newAttachmentService(db, s.attachments, s.clock)
+		ts.Rating = &ratingAttachments{RatingService: ts.Rating, attachments: ts.Attachment, files: s.attachments}
+	}
+
+	return ts, nil
+}
+
+// tenantSecret derives the key signing the tokens of the users of the tenant
+// with the given schema from secret.
+func tenantSecret(secret []byte, schema string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("tenant:" + schema))
+	return h.Sum(nil)
+}
+
+// committed publishes the events of the changes committed, and invalidates the
+// cached values they changed.
+func (s *Services) committed(changes *txChanges) {
+	s.invalidate(changes)
+
+	for _, e := range changes.events {
+		s.Events.Publish(e)
+	}
+
+	// the events of the ratings were written to the outbox
+	s.outbox.wake()
+}
+
+// invalidate invalidates the cached values changed by changes.
+func (s *Services) invalidate(changes *txChanges) {
+	for _, target := range changes.targets {
+		s.ratingChanged(Rating{Target: target})
+	}
+
+	if rc, ok := s.Role.(*roleCache); ok {
+		for _, id := range changes.roles {
+			rc.invalidate(id)
+		}
+	}
+
+	if s.userCache != nil {
+		for _, id := range changes.users {
+			s.userCache.invalidate(id)
+		}
+	}
+}
+
+// txChanges records the changes made in a transaction, to be applied to the
+// events and the cache once it is committed. It is not safe for concurrent use,
+// like the transaction itself.
+type txChanges struct {
+	events  []events.Event
+	targets []int64
+	roles   []int64
+	users   []int64
+}
+
+// Publish records e, so txChanges can be passed to the events decorators.
+func (tc *txChanges) Publish(e events.Event) {
+	tc.events = append(tc.events, e)
+}
+
+// merge adds the changes of a nested transaction to tc.
+func (tc *txChanges) merge(nested *txChanges) {
+	tc.events = append(tc.events, nested.events...)
+	tc.targets = append(tc.targets, nested.targets...)
+	tc.roles = append(tc.roles, nested.roles...)
+	tc.users = append(tc.users, nested.users...)
+}
+
+// targetChanged records a target whose ratings were written.
+func (tc *txChanges) targetChanged(target int64) {
+	tc.targets = append(tc.targets, target)
+}
+
+// ratingChanges is a RatingService decorator recording the targets of the
+// ratings written in a transaction, see ratingCache.
+type ratingChanges struct {
+	RatingService
+	changes *txChanges
+}
+
+func (rc *ratingChanges) Scoped(u *User) RatingService {
+	scoped := rc.RatingService.Scoped(u)
+	if scoped == rc.RatingService {
+		return rc
+	}
+
+	return &ratingChanges{RatingService: scoped, changes: rc.changes}
+}
+
+func (rc *ratingChanges) Create(r *Rating) error {
+	err := rc.RatingService.Create(r)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.targets = append(rc.changes.targets, r.Target)
+	return nil
+}
+
+func (rc *ratingChanges) PublishDraft(r *Rating, patch []byte) error {
+	err := rc.RatingService.PublishDraft(r, patch)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.targets = append(rc.changes.targets, r.Target)
+	return nil
+}
+
+func (rc *ratingChanges) Update(r *Rating) error {
+	err := rc.RatingService.Update(r)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.targets = append(rc.changes.targets, r.Target)
+	return nil
+}
+
+func (rc *ratingChanges) UpdatePartial(r *Rating, patch []byte) error {
+	err := rc.RatingService.UpdatePartial(r, patch)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.targets = append(rc.changes.targets, r.Target)
+	return nil
+}
+
+func (rc *ratingChanges) Delete(r *Rating) error {
+	// only the ID is known before deleting
+	current, err := rc.RatingService.ByID(r.ID)
+	if err != nil {
+		return rc.RatingService.Delete(r)
+	}
+
+	err = rc.RatingService.Delete(r)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.targets = append(rc.changes.targets, current.Target)
+	return nil
+}
+
+// roleChanges is a RoleService decorator recording the roles written in a
+// transaction, see roleCache.
+type roleChanges struct {
+	RoleService
+	changes *txChanges
+}
+
+func (rc *roleChanges) Create(r *Role) error {
+	err := rc.RoleService.Create(r)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.roles = append(rc.changes.roles, r.ID)
+	return nil
+}
+
+func (rc *roleChanges) Update(r *Role) error {
+	err := rc.RoleService.Update(r)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.roles = append(rc.changes.roles, r.ID)
+	return nil
+}
+
+func (rc *roleChanges) UpdatePartial(r *Role, patch []byte) error {
+	err := rc.RoleService.UpdatePartial(r, patch)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.roles = append(rc.changes.roles, r.ID)
+	return nil
+}
+
+func (rc *roleChanges) Delete(id int64) error {
+	err := rc.RoleService.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	rc.changes.roles = append(rc.changes.roles, id)
+	return nil
+}
+
+// userChanges is a UserService decorator recording the users written in a
+// transaction, or whose sessions were ended, see userCache.
+type userChanges struct {
+	UserService
+	changes *txChanges
+}
+
+func (uc *userChanges) Refresh(refreshToken string) (User, error) {
+	u, err := uc.UserService.Refresh(refreshToken)
+	if err != nil {
+		return User{}, err
+	}
+
+	uc.changes.users = append(uc.changes.users, u.ID)
+	return u, nil
+}
+
+func (uc *userChanges) RefreshSession(refreshToken string, client SessionClient) (User, Token, error) {
+	u, tok, err := uc.UserService.RefreshSession(refreshToken, client)
+	if err != nil {
+		return User{}, Token{}, err
+	}
+
+	uc.changes.users = append(uc.changes.users, u.ID)
+	return u, tok, nil
+}
+
+func (uc *userChanges) RevokeSession(userID int64, id string) error {
+	err := uc.UserService.RevokeSession(userID, id)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, userID)
+	return nil
+}
+
+func (uc *userChanges) RevokeSessions(userID int64) error {
+	err := uc.UserService.RevokeSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, userID)
+	return nil
+}
+
+func (uc *userChanges) Deactivate(id int64) error {
+	err := uc.UserService.Deactivate(id)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, id)
+	return nil
+}
+
+func (uc *userChanges) Activate(id int64) error {
+	err := uc.UserService.Activate(id)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, id)
+	return nil
+}
+
+func (uc *userChanges) Update(u *User) error {
+	err := uc.UserService.Update(u)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, u.ID)
+	return nil
+}
+
+func (uc *userChanges) UpdatePartial(u *User, patch []byte) error {
+	err := uc.UserService.UpdatePartial(u, patch)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, u.ID)
+	return nil
+}
+
+func (uc *userChanges) Delete(id int64) error {
+	err := uc.UserService.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, id)
+	return nil
+}
+
+func (uc *userChanges) DeleteWith(id int64, d UserDeletion) error {
+	err := uc.UserService.DeleteWith(id, d)
+	if err != nil {
+		return err
+	}
+
+	uc.changes.users = append(uc.changes.users, id)
+	return nil
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"github.com/noelruault/ratingsapp/internal/events"
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServices_WithTransaction(t *testing.T) {
+	s, err := NewServices(&Config{
+		JWTSecret:   []byte("test secret with long size and other"),
+		DatabaseDSL: testsupport.Database(t),
+		Cache:       cache.NewLRU(100),
+	})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var published []string
+	s.Events.Subscribe(func(e events.Event) {
+		mu.Lock()
+		published = append(published, e.Type)
+		mu.Unlock()
+	})
+
+	u := User{Active: true, Email: "tx@test.com", FirstName: "Tx", Password: "very long password", RoleID: 2}
+	require.NoError(t, s.User.Create(&u))
+
+	// cached before the transaction
+	ratings, err := s.Rating.ByTarget(9)
+	require.NoError(t, err)
+	require.Empty(t, ratings)
+
+	t.Run("commit", func(t *testing.T) {
+		err := s.WithTransaction(func(tx *Services) error {
+			r := NewRating()
+			r.Score, r.Target, r.UserID = 5, 9, u.ID
+			err := tx.Rating.Create(&r)
+			if err != nil {
+				return err
+			}
+
+			tu := User{ID: u.ID}
+			return tx.User.UpdatePartial(&tu, []byte(`{"settings":{"rated":9}}`))
+		})
+		require.NoError(t, err)
+
+		ratings, err := s.Rating.ByTarget(9)
+		require.NoError(t, err)
+		assert.Len(t, ratings, 1, "must invalidate the cached ratings once committed")
+
+		got, err := s.User.ByID(u.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"rated":9}`, string(got.Settings))
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		err := s.WithTransaction(func(tx *Services) error {
+			r := NewRating()
+			r.Score, r.Target, r.UserID = 5, 10, u.ID
+			require.NoError(t, tx.Rating.Create(&r))
+
+			return ErrConflict
+		})
+		assert.Equal(t, ErrConflict, err)
+
+		ratings, err := s.Rating.ByTarget(10)
+		require.NoError(t, err)
+		assert.Empty(t, ratings, "must roll back the ratings created")
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		err := s.WithTransaction(func(tx *Services) error {
+			role := Role{Label: "nested", Permissions: PermissionReadRatings}
+			err := tx.Role.Create(&role)
+			if err != nil {
+				return err
+			}
+
+			err = tx.WithTransaction(func(tx *Services) error {
+				r := NewRating()
+				r.Score, r.Target, r.UserID = 5, 11, u.ID
+				require.NoError(t, tx.Rating.Create(&r))
+				return ErrNotFound
+			})
+			assert.Equal(t, ErrNotFound, err)
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		roles, err := s.Role.ByIDs()
+		require.NoError(t, err)
+		assert.Len(t, roles, 3, "must keep the changes of the outer transaction")
+
+		ratings, err := s.Rating.ByTarget(11)
+		require.NoError(t, err)
+		assert.Empty(t, ratings, "must roll back the nested transaction")
+	})
+
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{events.RatingCreated, events.UserUpdated}, published,
+		"must only publish the events of the transactions committed")
+}
+
+func TestServices_InTenant(t *testing.T) {
+	s, err := NewServices(&Config{
+		JWTSecret:   []byte("test secret with long size and other"),
+		DatabaseDSL: testsupport.Database(t),
+	})
+	require.NoError(t, err)
+
+	acme := Tenant{Name: "Acme"}
+	require.NoError(t, s.Tenant.Provision(&acme, TenantAdmin{Email: "admin@acme.test", Password: "very long password"}))
+	s.provisioner.wait()
+
+	var token string
+	err = s.InTenant(&acme, func(ts *Services) error {
+		u := User{Active: true, Email: "user@acme.test", FirstName: "Acme", Password: "very long password", RoleID: 2}
+		require.NoError(t, ts.User.Create(&u))
+
+		r := NewRating()
+		r.Score, r.Target, r.UserID = 5, 9, u.ID
+		require.NoError(t, ts.Rating.Create(&r))
+
+		admin, err := ts.User.Authenticate("admin@acme.test", "very long password")
+		require.NoError(t, err)
+		tok, err := ts.User.Token(&admin)
+		require.NoError(t, err)
+		token = tok.AccessToken
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	ratings, err := s.Rating.ByTarget(9)
+	require.NoError(t, err)
+	assert.Empty(t, ratings, "must not write the ratings of the tenant in the shared schema")
+
+	_, err = s.User.Validate(token)
+	assert.Error(t, err, "must not accept the tokens of the tenant on the shared data")
+
+	err = s.InTenant(&acme, func(ts *Services) error {
+		ratings, err := ts.Rating.ByTarget(9)
+		require.NoError(t, err)
+		assert.Len(t, ratings, 1)
+
+		_, err = ts.User.Validate(token)
+		assert.NoError(t, err)
+
+		r := NewRating()
+		r.Score, r.Target, r.UserID = 3, 10, ratings[0].UserID
+		require.NoError(t, ts.Rating.Create(&r))
+		return ErrConflict
+	})
+	assert.Equal(t, ErrConflict, err)
+
+	err = s.InTenant(&acme, func(ts *Services) error {
+		ratings, err := ts.Rating.ByTarget(10)
+		require.NoError(t, err)
+		assert.Empty(t, ratings, "must roll back the failed requests")
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the tenants without a schema share the data
+	called := false
+	require.NoError(t, s.InTenant(&Tenant{ID: 9}, func(ts *Services) error {
+		called = true
+		assert.Equal(t, s, ts)
+		return nil
+	}))
+	assert.True(t, called)
+}
+
+func TestServices_InRequest(t *testing.T) {
+	s, err := NewServices(&Config{
+		JWTSecret:        []byte("test secret with long size and other"),
+		DatabaseDSL:      testsupport.Database(t),
+		Cache:            cache.NewLRU(100),
+		StatementTimeout: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	// the jobs run their statements on the services, out of the requests
+	require.NoError(t, s.db.Exec("SELECT pg_sleep(0.3)").Error, "must not limit the statements of the jobs")
+
+	u := User{Active: true, Email: "request@test.com", FirstName: "Request", Password: "very long password", RoleID: UserRoleID}
+	require.NoError(t, s.User.Create(&u))
+
+	// cached before the request
+	ratings, err := s.Rating.ByTarget(12)
+	require.NoError(t, err)
+	require.Empty(t, ratings)
+
+	err = s.InRequest(context.Background(), nil, func(rs *Services) error {
+		return rs.db.Exec("SELECT pg_sleep(0.3)").Error
+	})
+	assert.True(t, IsTimeout(err), "must cancel the slow statements of the requests, got %v", err)
+
+	err = s.InRequest(context.Background(), &Tenant{ID: 9}, func(rs *Services) error {
+		r := NewRating()
+		r.Score, r.Target, r.UserID = 4, 12, u.ID
+		return rs.Rating.Create(&r)
+	})
+	require.NoError(t, err)
+
+	ratings, err = s.Rating.ByTarget(12)
+	require.NoError(t, err)
+	assert.Len(t, ratings, 1, "must invalidate the cached ratings once committed")
+
+	err = s.InRequest(context.Background(), nil, func(rs *Services) error {
+		r := NewRating()
+		r.Score, r.Target, r.UserID = 2, 12, u.ID
+		require.NoError(t, rs.Rating.Create(&r))
+
+		// like the reactions to a rating that does not exist
+		return rs.db.Exec("INSERT INTO rating_reactions (rating_id, user_id, helpful, created_at) VALUES (404, ?, true, now())", u.ID).Error
+	})
+	require.Error(t, err)
+
+	ratings, err = s.Rating.ByTarget(12)
+	require.NoError(t, err)
+	assert.Len(t, ratings, 2, "must keep the changes made before the failure")
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,13 +18,40 @@ import (
 )
 
 const (
+	// MaxSettingsSize is the maximum size of the settings of a user, in
+	// bytes of compact JSON.
+	MaxSettingsSize = 8192
+
+	// maxSettingsKeySize is the maximum size of the names of the members
+	// of the settings.
+	maxSettingsKeySize = 64
+
 	// waitAfterAuthError is the period to sleep after a failed user authentication attempt.
 	waitAfterAuthError = 500 * time.Millisecond
 
-	jwtAccessDuration  = 6 * time.Hour
-	jwtRefreshDuration = 10 * 24 * time.Hour
+	// DefaultAccessTokenTTL and DefaultRefreshTokenTTL are the time the
+	// access and refresh tokens are valid if Config.AccessTokenTTL and
+	// Config.RefreshTokenTTL are zero.
+	DefaultAccessTokenTTL  = 6 * time.Hour
+	DefaultRefreshTokenTTL = 10 * 24 * time.Hour
+
+	// DefaultRememberTokenTTL is the time the refresh tokens of the
+	// logins remembered are valid if Config.RememberTokenTTL is zero, see
+	// TokenOptions.
+	DefaultRememberTokenTTL = 30 * 24 * time.Hour
+
+	// MinAccessTokenTTL is the shortest time the access tokens may be
+	// valid, as the clients would spend more time refreshing them than
+	// using them.
+	MinAccessTokenTTL = time.Minute
+
+	// ImpersonationDuration is the time the access tokens of the
+	// impersonations are valid, see UserService.Impersonate.
+	ImpersonationDuration = 15 * time.Minute
 )
 
+//go:generate go run github.com/matryer/moq -out modelstest/users.go -pkg modelstest . UserService:UserService
+
 // UserService defines a set of methods to be used when dealing with system users
 // and authenticating them.
 type UserService interface {
@@ -32,6 +62,10 @@ type UserService interface {
 	// ErrUnauthorised.
 	Authenticate(username, password string) (User, error)
 
+	// AuthenticateFrom returns a user as Authenticate, reporting the
+	// failed logins of client as security events, see SecurityEvents.
+	AuthenticateFrom(username, password string, client SessionClient) (User, error)
+
 	// Refresh returns a user based on a valid refresh token.
 	Refresh(refreshToken string) (User, error)
 
@@ -39,9 +73,64 @@ type UserService interface {
 	Validate(accessToken string) (User, error)
 
 	// Token generates a set of tokens based on the user provided as
-	// input.
+	// input. When sessions are tracked, the tokens start a new session.
 	Token(u *User) (Token, error)
 
+	// TokenFor generates a set of tokens as Token, with the options
+	// of the login they are issued for.
+	TokenFor(u *User, opts TokenOptions) (Token, error)
+
+	// Impersonate generates an access token with which the administrator
+	// actor acts as u, as support does to see what u sees. The token is
+	// valid for ImpersonationDuration, without a refresh token, and it
+	// names actor in its act claim. The users it is validated for have
+	// ImpersonatedBy set. When sessions are tracked, the token starts a
+	// session of actor, and it is only valid while the session is active
+	// and actor is an active administrator.
+	//
+	// ErrCannotImpersonate is returned if u is actor, an administrator or
+	// inactive, or if actor is impersonating someone already.
+	Impersonate(u *User, actor *User) (Token, error)
+
+	// RefreshSession returns a user based on a valid refresh token, as
+	// Refresh, and a set of tokens for it. When sessions are tracked, the
+	// tokens start a new session replacing the one of the refresh token,
+	// which keeps its creation time, and its user agent unless client
+	// tells another one.
+	RefreshSession(refreshToken string, client SessionClient) (User, Token, error)
+
+	// Sessions retrieves the active sessions of a user. ErrSessionsDisabled
+	// is returned if no SessionStore is configured.
+	Sessions(userID int64) ([]Session, error)
+
+	// RevokeSession ends a session of a user by ID, so its tokens are no
+	// longer valid. ErrNotFound is returned if the session is not active.
+	// ErrSessionsDisabled is returned if no SessionStore is configured.
+	RevokeSession(userID int64, id string) error
+
+	// RevokeSessions ends all the sessions of a user, logging them out
+	// everywhere. ErrSessionsDisabled is returned if no SessionStore is
+	// configured.
+	RevokeSessions(userID int64) error
+
+	// Deactivate marks a user as inactive, so it can no longer log in
+	// nor use its tokens, and ends its sessions, if tracked. Its ratings
+	// are kept. The admin user with ID 1 cannot be deactivated.
+	Deactivate(id int64) error
+
+	// Activate marks a user deactivated as active again.
+	Activate(id int64) error
+
+	// UpdatePartial updates the user with ID u.ID by applying patch, a
+	// JSON Merge Patch document (RFC 7396). Only the fields present in
+	// patch are validated and modified, the others keep their stored
+	// values. A null member resets a field to its zero value, except for
+	// the password, which is kept.
+	//
+	// u.Version and the default admin user are handled as in Update.
+	// On success, u is set to the updated user.
+	UpdatePartial(u *User, patch []byte) error
+
 	UserDB
 }
 
@@ -69,24 +158,101 @@ type UserDB interface {
 	// fields.
 	//
 	// For application users, email and password cannot be updated.
+	// Only the password of the default admin user, with ID 1, can
+	// be updated: ErrReadOnly is returned for any other change.
+	//
+	// If u.Version is not zero, ErrConflict is returned when the stored
+	// user has a different version. On success, u.Version is set to the
+	// new version.
 	Update(u *User) error
 
 	// Delete removes a user by ID. The admin user with ID
-	// 1 cannot be removed.
+	// 1 cannot be removed. ErrInUse is returned if the user
+	// has ratings, see DeleteWith.
 	Delete(int64) error
 
+	// DeleteWith removes a user by ID as Delete, handling its
+	// ratings as set by d, in a single transaction.
+	DeleteWith(id int64, d UserDeletion) error
+
+	// SetActive sets the active flag of a user, see Deactivate.
+	SetActive(id int64, active bool) error
+
+	// AssignRole gives the role with ID roleID to the users with the
+	// given IDs, in a single transaction, and returns the result for
+	// each user, sorted by ID. The users not found, the admin user with
+	// ID 1 and the ones the custom rules reject are reported as failed
+	// and left as they are, without failing the others.
+	//
+	// ErrNotFound is returned if the role does not exist. A
+	// ValidationError is returned for the "userIds" field if no ID is
+	// supplied, if an ID is not positive, or if there are more than
+	// maxRoleAssignments.
+	AssignRole(roleID int64, ids ...int64) ([]RoleAssignment, error)
+
 	// ByID retrieves a user by ID.
 	ByID(int64) (User, error)
 
-	// ByIDs retrieves a list of users by their IDs. If
+	// ByIDs retrieves a list of users by their IDs, with their
+	// role unless Config.OmitUserRoles is set. If
 	// no ID is supplied, all users in the database are returned.
 	ByIDs(...int64) ([]User, error)
 
 	// ByEmail retrieves a user by email address, as it
 	// is unique in the database.
 	ByEmail(string) (User, error)
+
+	// Search retrieves the users matching all the criteria in q, with
+	// their role unless Config.OmitUserRoles is set. An empty query
+	// returns all users in the database, sorted by ID.
+	//
+	// Sort and Q are validated, and a ValidationError is returned for
+	// the "sort" or "q" fields if they are invalid.
+	Search(q SearchQuery) ([]User, error)
 }
 
+// SearchQuery defines the criteria used to look up users in UserDB.Search.
+// Zero-valued fields are not used for filtering.
+type SearchQuery struct {
+	// IDs restricts the search to the users with these IDs.
+	IDs []int64
+
+	// Q is a text to be found, case-insensitively, in the users' email,
+	// first name or last name.
+	Q string
+
+	// Active filters users by their active flag.
+	Active *bool
+
+	// RoleID filters users by the role they are attached to.
+	RoleID int64
+
+	// OrgID filters users by their organisation, see Organisation.
+	OrgID int64
+
+	// Sort is the name of the field used to sort the results, which
+	// is one of "id", "email", "firstName" or "lastName". The name can
+	// be prefixed with "-" to sort in descending order. Results are
+	// sorted by ID if it is left empty.
+	Sort string
+
+	// Roles tells whether the users are returned with their role. If
+	// nil, they are unless Config.OmitUserRoles is set.
+	Roles *bool
+}
+
+// userSortColumns maps the user fields accepted by SearchQuery.Sort to their
+// database columns.
+var userSortColumns = map[string]string{
+	"id":        "id",
+	"email":     "email",
+	"firstName": "first_name",
+	"lastName":  "last_name",
+}
+
+// emailRegex matches the email addresses accepted for the users.
+var emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9._\-]+\.[a-z0-9._\-]{2,16}$`)
+
 // A User represents an application user, be it a human or another application
 // that connects to this one.
 type User struct {
@@ -121,19 +287,133 @@ type User struct {
 	// by the UserService methods.
 	Role *Role `json:"role,omitempty"`
 
-	// Settings is used by the frontend to store free-form
-	// contents related to user preferences.
-	Settings string `gorm:"type:text;not null" json:"settings,omitempty"` // settings information related to a user.
+	// OrgID is the ID of the organisation of the user, see Organisation,
+	// and nil for the users of the deployment itself, who reach every
+	// organisation. It is set when the user is created, and never
+	// changed.
+	OrgID *int64 `gorm:"type:bigint" json:"orgId,omitempty"`
+
+	// Settings is used by the frontend to store the preferences of the
+	// user, as a JSON object of at most MaxSettingsSize bytes. Partial
+	// updates merge its members, so clients only change the keys they set.
+	Settings json.RawMessage `gorm:"type:jsonb;not null" json:"settings,omitempty"`
+
+	// Version is increased every time the user is updated. When set on
+	// an update, the update only succeeds if it matches the stored version.
+	Version int64 `gorm:"type:bigint;not null;default:1" json:"-"`
+
+	// CreatedAt and UpdatedAt are the times the user was created and last
+	// updated, and are only nil until it is stored. Any input value will be
+	// ignored.
+	CreatedAt *time.Time `gorm:"type:timestamptz;not null" json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `gorm:"type:timestamptz;not null" json:"updatedAt,omitempty"`
+
+	// ImpersonatedBy is the ID of the administrator acting as the user,
+	// when it was validated from the token of an impersonation, see
+	// UserService.Impersonate. It is zero otherwise.
+	ImpersonatedBy int64 `gorm:"-" json:"-"`
+}
+
+// What happens to the ratings of the users deleted, see UserDeletion.
+const (
+	// RatingsRestrict refuses to delete the users with ratings, with
+	// ErrInUse. It is the default.
+	RatingsRestrict = "restrict"
+
+	// RatingsAnonymise keeps the ratings, made anonymous, and the user
+	// as their author, with its personal data erased. It is left
+	// inactive, with an email like deleted-12@users.invalid and the
+	// first name "Deleted user", and its consents, subscriptions,
+	// notifications and alert rules are removed. The revisions of the
+	// ratings are made anonymous too.
+	RatingsAnonymise = "anonymise"
+
+	// RatingsReassign moves the ratings, and their revisions, to
+	// another user before deleting the user.
+	RatingsReassign = "reassign"
+)
+
+// UserDeletion sets how the ratings of a user are handled when it is deleted,
+// see UserDB.DeleteWith.
+type UserDeletion struct {
+	// Ratings is RatingsRestrict, RatingsAnonymise or RatingsReassign.
+	// It defaults to RatingsRestrict.
+	Ratings string
+
+	// ReassignTo is the ID of the user the ratings are moved to with
+	// RatingsReassign. It must not have rated the same targets.
+	ReassignTo int64
+}
+
+// maxRoleAssignments is the maximum number of users given a role at once, see
+// UserDB.AssignRole.
+const maxRoleAssignments = 500
+
+// The statuses of the users given a role, see RoleAssignment.
+const (
+	// AssignmentAssigned tells the user was given the role.
+	AssignmentAssigned = "assigned"
+
+	// AssignmentUnchanged tells the user had the role already.
+	AssignmentUnchanged = "unchanged"
+
+	// AssignmentFailed tells the user could not be given the role, for
+	// the error of the assignment.
+	AssignmentFailed = "failed"
+)
+
+// RoleAssignment is the result of giving a role to a user, see
+// UserDB.AssignRole.
+type RoleAssignment struct {
+	UserID int64 `json:"userId"`
+
+	// Status is AssignmentAssigned, AssignmentUnchanged or
+	// AssignmentFailed.
+	Status string `json:"status"`
+
+	// Error is the code of the error the user could not be given the
+	// role for, like "not_found", and Fields the codes of the errors of
+	// its fields, if it is "validation_error".
+	Error  string            `json:"error,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
+// failedAssignment returns the result of the user with the given ID that could
+// not be given a role for err.
+func failedAssignment(id int64, err PublicError) RoleAssignment {
+	ra := RoleAssignment{UserID: id, Status: AssignmentFailed, Error: err.Public()}
+	if ve, ok := err.(ValidationError); ok {
+		ra.Fields = make(map[string]string, len(ve))
+		for field, ferr := range ve {
+			ra.Fields[field] = ferr.Public()
+		}
+	}
+
+	return ra
+}
+
+// deletedUserFirstName is the first name of the users anonymised, see
+// RatingsAnonymise.
+const deletedUserFirstName = "Deleted user"
+
 // NewUser creates a new User value with default field values applied.
 func NewUser() User {
 	return User{
-		RoleID: 2,
+		RoleID: UserRoleID,
 		Active: true,
 	}
 }
 
+// ModeratesRatings tells whether u can change and delete the ratings of the
+// other users, which its role permits with PermissionWriteRatings. The admin
+// role always can, and u.Role must be set otherwise.
+func (u *User) ModeratesRatings() bool {
+	if u.RoleID == AdminRoleID {
+		return true
+	}
+	return u.Role != nil && u.Role.Permissions&PermissionWriteRatings != 0
+}
+
 // A Token is a set of tokens that represent a user logged in the system.
 type Token struct {
 	AccessToken  string `json:"access_token"`
@@ -142,6 +422,19 @@ type Token struct {
 	TokenType    string `json:"token_type"`
 }
 
+// TokenOptions are the options of the login a set of tokens is issued for,
+// see UserService.TokenFor.
+type TokenOptions struct {
+	// Client is recorded in the session the tokens start.
+	Client SessionClient
+
+	// Remember issues a refresh token valid for Config.RememberTokenTTL
+	// instead of Config.RefreshTokenTTL, as the clients remembering the
+	// login of their user ask. The tokens refreshed with it keep being
+	// remembered.
+	Remember bool
+}
+
 // ValidationResult contains the result of a token validation request.
 type ValidationResult struct {
 	UserID    int64
@@ -152,21 +445,146 @@ type ValidationResult struct {
 type authClaims struct {
 	jwt.Claims
 	RoleID int64 `json:"fdr,omitempty"`
+
+	// Tenant is the schema of the tenant the token was issued for, empty
+	// for the data shared by the application.
+	Tenant string `json:"tnt,omitempty"`
+
+	// OrgID is the ID of the organisation of the user, zero for the users
+	// of no organisation, see Organisation.
+	OrgID int64 `json:"org,omitempty"`
+
+	// Permissions are the permissions of the role of the user when the
+	// access token was issued, if it was known. See jwtKeys.
+	Permissions *int64 `json:"prm,omitempty"`
+
+	// PermissionNames are the names of Permissions, as encoded in JSON,
+	// if jwtKeys.permissionNames is set, for the clients to read.
+	PermissionNames []string `json:"pms,omitempty"`
+
+	// Actor is the administrator acting as the user with the access
+	// tokens of the impersonations (RFC 8693), see
+	// UserService.Impersonate.
+	Actor *actorClaim `json:"act,omitempty"`
+
+	// Remember marks the refresh tokens of the logins remembered, see
+	// TokenOptions.
+	Remember bool `json:"rmb,omitempty"`
+}
+
+// actorClaim identifies the party acting as the subject of a token.
+type actorClaim struct {
+	Subject string `json:"sub"`
+}
+
+// jwtKeys are the keys signing and verifying the tokens of the users. Tokens are
+// signed with secret, and verified with secret or, until previousUntil, with
+// previous, so the tokens issued before the secret was rotated stay valid for a
+// grace period. They are only valid for the tenant with the schema schema.
+//
+// If trustPermissions is set, the access tokens carrying the permissions of
+// their user are validated without reading the user and its role, so the
+// changes made to them since the tokens were issued only apply once refreshed.
+// If permissionNames is set, the access tokens carry the names of the
+// permissions too.
+type jwtKeys struct {
+	secret        []byte
+	previous      []byte
+	previousUntil time.Time
+
+	schema           string
+	trustPermissions bool
+	permissionNames  bool
+
+	// accessTTL, refreshTTL and rememberTTL are the time the tokens
+	// issued are valid, DefaultAccessTokenTTL, DefaultRefreshTokenTTL and
+	// DefaultRememberTokenTTL if zero.
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	rememberTTL time.Duration
+}
+
+// verifying returns the keys verifying the tokens at t, the secret first.
+func (k jwtKeys) verifying(t time.Time) [][]byte {
+	if len(k.previous) == 0 || !t.Before(k.previousUntil) {
+		return [][]byte{k.secret}
+	}
+
+	return [][]byte{k.secret, k.previous}
+}
+
+// ttls returns the time the access and refresh tokens issued are valid, and
+// the refresh tokens of the logins remembered.
+func (k jwtKeys) ttls() (access, refresh, remember time.Duration) {
+	access, refresh, remember = k.accessTTL, k.refreshTTL, k.rememberTTL
+	if access == 0 {
+		access = DefaultAccessTokenTTL
+	}
+	if refresh == 0 {
+		refresh = DefaultRefreshTokenTTL
+	}
+	if remember == 0 {
+		remember = DefaultRememberTokenTTL
+	}
+
+	return access, refresh, remember
+}
+
+// tenant returns the keys of the tenant with the given schema, derived from k,
+// see tenantSecret.
+func (k jwtKeys) tenant(schema string) jwtKeys {
+	tk := jwtKeys{
+		secret:           tenantSecret(k.secret, schema),
+		previousUntil:    k.previousUntil,
+		schema:           schema,
+		trustPermissions: k.trustPermissions,
+		permissionNames:  k.permissionNames,
+		accessTTL:        k.accessTTL,
+		refreshTTL:       k.refreshTTL,
+		rememberTTL:      k.rememberTTL,
+	}
+	if len(k.previous) > 0 {
+		tk.previous = tenantSecret(k.previous, schema)
+	}
+
+	return tk
 }
 
 type userService struct {
 	UserService
 
 	signer jose.Signer
-	secret []byte
+	keys   jwtKeys
+
+	// sessions tracks the issued tokens, and may be nil.
+	sessions SessionStore
+
+	// security receives the security events, and may be nil.
+	security SecurityEvents
+
+	// clock tells when the tokens expire.
+	clock Clock
 }
 
 // NewUserService instantiates a new UserService implementation with db as the
 // backing database.
 func NewUserService(db *gorm.DB, rs RoleService, jwtSecret []byte) (UserService, error) {
+	return newUserService(db, rs, jwtKeys{secret: jwtSecret}, nil, nil, nil, nil, nil, false)
+}
+
+// newUserService instantiates a new UserService implementation that signs the
+// tokens with keys, tracks the sessions of the users in ss, and checks the custom
+// rules on the users. Sessions are not tracked if ss is nil, and rules may be nil.
+// The tokens expire by the time told by clock, the clock of the system if nil.
+// The users listed are returned without their role if omitRoles is set.
+func newUserService(db *gorm.DB, rs RoleService, keys jwtKeys, ss SessionStore, sec SecurityEvents, auth AuthProvider, rules *Rules, clock Clock, omitRoles bool) (UserService, error) {
+	if clock == nil {
+		clock = SystemClock
+	}
+
 	sig, err := jose.NewSigner(jose.SigningKey{
 		Algorithm: jose.HS512,
-		Key:       []byte(jwtSecret),
+		Key:       keys.secret,
 	}, (&jose.SignerOptions{}).WithType("JWT"))
 	if err != nil {
 		return nil, wrap("failed to instantiate JWT signer", err)
@@ -174,33 +592,65 @@ func NewUserService(db *gorm.DB, rs RoleService, jwtSecret []byte) (UserService,
 
 	return &userService{
 		UserService: &userValidator{
-			UserDB:      &userGorm{db},
+			UserDB:      &userGorm{db: db, omitRoles: omitRoles},
 			roleService: rs,
-			emailRegex:  regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9._\-]+\.[a-z0-9._\-]{2,16}$`),
+			emailRegex:  emailRegex,
+			rules:       rules,
+			auth:        auth,
 		},
-		signer: sig,
-		secret: jwtSecret,
+		signer:   sig,
+		keys:     keys,
+		sessions: ss,
+		security: sec,
+		clock:    clock,
 	}, nil
 }
 
+// report records e, of the tenant of us, if the security events are received.
+func (us *userService) report(e SecurityEvent) {
+	if us.security == nil {
+		return
+	}
+
+	e.Time = us.clock.Now().UTC()
+	e.Tenant = us.keys.schema
+	us.security.Record(e)
+}
+
 func (us *userService) Authenticate(username, password string) (User, error) {
+	return us.AuthenticateFrom(username, password, SessionClient{})
+}
+
+func (us *userService) AuthenticateFrom(username, password string, client SessionClient) (User, error) {
 	// hide the actual errors to reduce ease of BF attacks.
 	user, err := us.UserService.Authenticate(username, password)
 	if err != nil {
 		if xerrors.Is(err, ValidationError{"email": ErrRequired}) ||
 			xerrors.Is(err, ValidationError{"password": ErrRequired}) {
-			return user, ErrNoCredentials
+			return User{}, ErrNoCredentials
+		}
 
-		} else if verr := ValidationError(nil); xerrors.As(err, &verr) {
+		// the validator returns the ID of the user the login was
+		// attempted to, if any
+		e := SecurityEvent{Type: SecurityLoginFailed, UserID: user.ID, Email: username,
+			IP: client.IP, UserAgent: client.UserAgent}
+		if verr := ValidationError(nil); xerrors.As(err, &verr) {
 			if verr["password"] == ErrPasswordIncorrect {
-				return user, ErrUnauthorised
+				us.report(e)
+				return User{}, ErrUnauthorised
 			}
 
 			err = ErrUnauthorised
 
 		} else if merr := ModelError(""); xerrors.As(err, &merr) {
+			if err == ErrInvalid {
+				e.Type = SecurityAccountLocked
+			}
 			err = ErrUnauthorised
 		}
+		if err == ErrUnauthorised {
+			us.report(e)
+		}
 
 		// protection sleep to reduce effectiveness of BF attacks
 		time.Sleep(waitAfterAuthError)
@@ -211,35 +661,85 @@ func (us *userService) Authenticate(username, password string) (User, error) {
 }
 
 func (us *userService) Refresh(refreshToken string) (User, error) {
+	user, _, _, err := us.refresh(refreshToken, SessionClient{})
+	return user, err
+}
+
+func (us *userService) RefreshSession(refreshToken string, client SessionClient) (User, Token, error) {
+	user, prev, remember, err := us.refresh(refreshToken, client)
+	if err != nil {
+		return User{}, Token{}, err
+	}
+
+	if client.UserAgent != "" {
+		prev.UserAgent = client.UserAgent
+	}
+
+	tok, err := us.token(&user, prev, remember)
+	if err != nil {
+		return User{}, Token{}, err
+	}
+
+	return user, tok, nil
+}
+
+// refresh returns the user of a valid refresh token, and ends the session of
+// the token, which is returned along with whether the login of the token is
+// remembered. The session is empty if sessions are not tracked. The reuse of
+// the token by client after its session ended is reported as a security event.
+func (us *userService) refresh(refreshToken string, client SessionClient) (User, Session, bool, error) {
 	if refreshToken == "" {
-		return User{}, ErrNoCredentials
+		return User{}, Session{}, false, ErrNoCredentials
 	}
 
 	// validate the token
-	uid, _, err := us.tokenValidate(refreshToken, true)
+	uid, cl, err := us.tokenValidate(refreshToken, true)
 	if err != nil {
 		if merr := ModelError(""); xerrors.As(err, &merr) {
-			return User{}, ErrUnauthorised
+			return User{}, Session{}, false, ErrUnauthorised
 		}
 
-		return User{}, wrap("failed to validate refresh token", err)
+		return User{}, Session{}, false, wrap("failed to validate refresh token", err)
+	}
+
+	// refresh tokens are used only once, so the session is ended and a
+	// new one is started when the tokens are issued again
+	var prev Session
+	if us.sessions != nil {
+		if cl.ID == "" {
+			return User{}, Session{}, false, ErrUnauthorised
+		}
+
+		prev, err = us.sessions.Get(uid, cl.ID)
+		if err == nil {
+			err = us.sessions.Revoke(uid, cl.ID)
+		}
+		if err != nil {
+			if xerrors.Is(err, ErrNotFound) {
+				us.report(SecurityEvent{Type: SecurityTokenReused, UserID: uid, SessionID: cl.ID,
+					IP: client.IP, UserAgent: client.UserAgent})
+				return User{}, Session{}, false, ErrUnauthorised
+			}
+
+			return User{}, Session{}, false, wrap("on refresh, failed to end session", err)
+		}
 	}
 
 	// get the user from the database
 	user, err := us.ByID(uid)
 	if err != nil {
 		if xerrors.Is(err, ErrNotFound) {
-			return User{}, ErrUnauthorised
+			return User{}, Session{}, false, ErrUnauthorised
 		}
 
-		return User{}, wrap("on refresh, failed to obtain user from database", err)
+		return User{}, Session{}, false, wrap("on refresh, failed to obtain user from database", err)
 	}
 
 	if !user.Active {
-		return User{}, ErrUnauthorised
+		return User{}, Session{}, false, ErrUnauthorised
 	}
 
-	return user, nil
+	return user, prev, cl.Remember, nil
 }
 
 func (us *userService) Validate(accessToken string) (User, error) {
@@ -248,7 +748,7 @@ func (us *userService) Validate(accessToken string) (User, error) {
 	}
 
 	// validate the token
-	uid, _, err := us.tokenValidate(accessToken, false)
+	uid, cl, err := us.tokenValidate(accessToken, false)
 	if err != nil {
 		if merr := ModelError(""); xerrors.As(err, &merr) {
 			return User{}, ErrUnauthorised
@@ -257,6 +757,48 @@ func (us *userService) Validate(accessToken string) (User, error) {
 		return User{}, wrap("failed to validate refresh token", err)
 	}
 
+	// the impersonations are bound to a session of the administrator
+	sessionUser, actorID := uid, int64(0)
+	if cl.Actor != nil {
+		actorID, err = strconv.ParseInt(cl.Actor.Subject, 10, 64)
+		if err != nil {
+			return User{}, ErrUnauthorised
+		}
+		sessionUser = actorID
+	}
+
+	// access tokens are only valid while their session is active
+	if us.sessions != nil {
+		if cl.ID == "" {
+			return User{}, ErrUnauthorised
+		}
+
+		_, err = us.sessions.Get(sessionUser, cl.ID)
+		if err != nil {
+			if xerrors.Is(err, ErrNotFound) {
+				return User{}, ErrUnauthorised
+			}
+
+			return User{}, wrap("on validate, failed to obtain session", err)
+		}
+	}
+
+	// the user and its role are only read if the permissions of the
+	// token can't be trusted, and the administrator of the impersonations
+	// is always checked
+	if us.keys.trustPermissions && cl.Permissions != nil && cl.Actor == nil {
+		u := User{
+			ID:     uid,
+			Active: true,
+			RoleID: cl.RoleID,
+			Role:   &Role{ID: cl.RoleID, Permissions: Permissions(*cl.Permissions)},
+		}
+		if cl.OrgID != 0 {
+			u.OrgID = &cl.OrgID
+		}
+		return u, nil
+	}
+
 	// get the user from the database
 	user, err := us.ByID(uid)
 	if err != nil {
@@ -267,29 +809,84 @@ func (us *userService) Validate(accessToken string) (User, error) {
 		return User{}, wrap("on validate, failed to obtain user from database", err)
 	}
 
-	if !user.Active {
+	// the tokens are only valid for the organisation they were issued for
+	if !user.Active || orgID(user.OrgID) != cl.OrgID {
 		return User{}, ErrUnauthorised
 	}
 
+	if actorID != 0 {
+		actor, err := us.ByID(actorID)
+		if err != nil && !xerrors.Is(err, ErrNotFound) {
+			return User{}, wrap("on validate, failed to obtain impersonator from database", err)
+		} else if err != nil || !actor.Active || actor.RoleID != AdminRoleID ||
+			actor.OrgID != nil && !sameOrganisation(actor.OrgID, user.OrgID) {
+			return User{}, ErrUnauthorised
+		}
+
+		user.ImpersonatedBy = actorID
+	}
+
 	return user, nil
 }
 
 func (us *userService) Token(u *User) (Token, error) {
+	return us.token(u, Session{}, false)
+}
+
+func (us *userService) TokenFor(u *User, opts TokenOptions) (Token, error) {
+	return us.token(u, Session{UserAgent: opts.Client.UserAgent}, opts.Remember)
+}
+
+// token generates a set of tokens for u, with a refresh token valid for longer
+// if remember is true. When sessions are tracked, the tokens start a new
+// session with the user agent of s, created at the time of s if set.
+func (us *userService) token(u *User, s Session, remember bool) (Token, error) {
+	now := us.clock.Now().UTC()
+
+	// both tokens carry the session ID, when sessions are tracked
+	var sid string
+	if us.sessions != nil {
+		var err error
+		sid, err = newSessionID()
+		if err != nil {
+			return Token{}, err
+		}
+	}
+
+	accessTTL, refreshTTL, rememberTTL := us.keys.ttls()
+	if remember {
+		refreshTTL = rememberTTL
+	}
+
 	cla := authClaims{
 		Claims: jwt.Claims{
+			ID:      sid,
 			Subject: strconv.FormatInt(u.ID, 10),
 			Issuer:  "ratingsapp",
-			Expiry:  jwt.NewNumericDate(time.Now().UTC().Add(jwtAccessDuration)),
+			Expiry:  jwt.NewNumericDate(now.Add(accessTTL)),
 		},
 		RoleID: u.RoleID,
+		Tenant: us.keys.schema,
+		OrgID:  orgID(u.OrgID),
+	}
+	if u.Role != nil {
+		p := int64(u.Role.Permissions)
+		cla.Permissions = &p
+		if us.keys.permissionNames {
+			cla.PermissionNames = u.Role.Permissions.Names()
+		}
 	}
 	clr := authClaims{
 		Claims: jwt.Claims{
+			ID:      sid,
 			Subject: strconv.FormatInt(u.ID, 10),
 			Issuer:  "ratingsappr",
-			Expiry:  jwt.NewNumericDate(time.Now().UTC().Add(jwtRefreshDuration)),
+			Expiry:  jwt.NewNumericDate(now.Add(refreshTTL)),
 		},
-		RoleID: u.RoleID,
+		RoleID:   u.RoleID,
+		Tenant:   us.keys.schema,
+		OrgID:    orgID(u.OrgID),
+		Remember: remember,
 	}
 
 	atok, err := jwt.Signed(us.signer).Claims(cla).CompactSerialize()
@@ -302,14 +899,135 @@ func (us *userService) Token(u *User) (Token, error) {
 		return Token{}, wrap("failed to generate refresh token", err)
 	}
 
+	if us.sessions != nil {
+		if s.CreatedAt.IsZero() {
+			s.CreatedAt = now
+		}
+		if len(s.UserAgent) > maxUserAgentSize {
+			s.UserAgent = s.UserAgent[:maxUserAgentSize]
+		}
+
+		err = us.sessions.Add(Session{
+			ID:         sid,
+			UserID:     u.ID,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: now,
+			ExpiresAt:  clr.Expiry.Time().UTC(),
+		})
+		if err != nil {
+			return Token{}, wrap("failed to start session", err)
+		}
+	}
+
 	return Token{
 		AccessToken:  atok,
 		RefreshToken: rtok,
-		ExpiresIn:    int(jwtAccessDuration / time.Second),
+		ExpiresIn:    int(accessTTL / time.Second),
 		TokenType:    "bearer",
 	}, nil
 }
 
+func (us *userService) Impersonate(u *User, actor *User) (Token, error) {
+	if u.ID == actor.ID || u.RoleID == AdminRoleID || !u.Active || actor.ImpersonatedBy != 0 {
+		return Token{}, ErrCannotImpersonate
+	}
+
+	now := us.clock.Now().UTC()
+
+	var sid string
+	if us.sessions != nil {
+		var err error
+		sid, err = newSessionID()
+		if err != nil {
+			return Token{}, err
+		}
+	}
+
+	cl := authClaims{
+		Claims: jwt.Claims{
+			ID:      sid,
+			Subject: strconv.FormatInt(u.ID, 10),
+			Issuer:  "ratingsapp",
+			Expiry:  jwt.NewNumericDate(now.Add(ImpersonationDuration)),
+		},
+		RoleID: u.RoleID,
+		Tenant: us.keys.schema,
+		OrgID:  orgID(u.OrgID),
+		Actor:  &actorClaim{Subject: strconv.FormatInt(actor.ID, 10)},
+	}
+
+	tok, err := jwt.Signed(us.signer).Claims(cl).CompactSerialize()
+	if err != nil {
+		return Token{}, wrap("failed to generate impersonation token", err)
+	}
+
+	// the administrator ends the impersonation by revoking its session
+	if us.sessions != nil {
+		err = us.sessions.Add(Session{
+			ID:         sid,
+			UserID:     actor.ID,
+			UserAgent:  "Impersonation of user " + strconv.FormatInt(u.ID, 10),
+			CreatedAt:  now,
+			LastUsedAt: now,
+			ExpiresAt:  cl.Expiry.Time().UTC(),
+		})
+		if err != nil {
+			return Token{}, wrap("failed to start impersonation session", err)
+		}
+	}
+
+	return Token{
+		AccessToken: tok,
+		ExpiresIn:   int(ImpersonationDuration / time.Second),
+		TokenType:   "bearer",
+	}, nil
+}
+
+func (us *userService) Sessions(userID int64) ([]Session, error) {
+	if us.sessions == nil {
+		return nil, ErrSessionsDisabled
+	}
+
+	return us.sessions.ByUser(userID)
+}
+
+func (us *userService) RevokeSession(userID int64, id string) error {
+	if us.sessions == nil {
+		return ErrSessionsDisabled
+	}
+
+	return us.sessions.Revoke(userID, id)
+}
+
+func (us *userService) RevokeSessions(userID int64) error {
+	if us.sessions == nil {
+		return ErrSessionsDisabled
+	}
+
+	return us.sessions.RevokeAll(userID)
+}
+
+func (us *userService) Deactivate(id int64) error {
+	err := us.SetActive(id, false)
+	if err != nil {
+		return err
+	}
+
+	if us.sessions != nil {
+		err = us.sessions.RevokeAll(id)
+		if err != nil {
+			return with(wrap("could not end the sessions of the user deactivated", err), "user_id", id)
+		}
+	}
+
+	return nil
+}
+
+func (us *userService) Activate(id int64) error {
+	return us.SetActive(id, true)
+}
+
 func (us *userService) ByID(id int64) (User, error) {
 	u, err := us.UserService.ByID(id)
 
@@ -334,21 +1052,38 @@ func (us *userService) ByEmail(e string) (User, error) {
 	return u, err
 }
 
-// tokenValidate validates token as a JWT. If refresh is true, it validates it as being a
-// refresh token. The method returns the user id and role id present in the token claims
-func (us *userService) tokenValidate(token string, isRefresh bool) (uid, rid int64, err error) {
-	var cl = authClaims{}
+func (us *userService) Search(q SearchQuery) ([]User, error) {
+	u, err := us.UserService.Search(q)
+
+	for i := range u {
+		u[i].Password = ""
+	}
+
+	return u, err
+}
 
+// tokenValidate validates token as a JWT. If refresh is true, it validates it as being a
+// refresh token, issued for the tenant of the keys. The method returns the user id present in the
+// token claims, and the claims.
+func (us *userService) tokenValidate(token string, isRefresh bool) (uid int64, cl authClaims, err error) {
 	// parse the token first
 	tok, err := jwt.ParseSigned(token)
 	if err != nil {
-		return 0, 0, ErrRefreshInvalid
+		return 0, authClaims{}, ErrRefreshInvalid
 	}
 
-	// verify the claims check with the signature key
-	err = tok.Claims(us.secret, &cl)
+	// verify the claims check with the signature keys, the previous secret
+	// being accepted during its grace period
+	now := us.clock.Now().UTC()
+	err = ErrRefreshInvalid
+	for _, key := range us.keys.verifying(now) {
+		if tok.Claims(key, &cl) == nil {
+			err = nil
+			break
+		}
+	}
 	if err != nil {
-		return 0, 0, ErrRefreshInvalid
+		return 0, authClaims{}, err
 	}
 
 	// verify the token has not expired
@@ -359,29 +1094,41 @@ func (us *userService) tokenValidate(token string, isRefresh bool) (uid, rid int
 
 	err = cl.Validate(jwt.Expected{
 		Issuer: iss,
-		Time:   time.Now().UTC(),
+		Time:   now,
 	})
 	if err != nil {
 		if xerrors.Is(err, jwt.ErrExpired) {
-			return 0, 0, ErrRefreshExpired
+			return 0, authClaims{}, ErrRefreshExpired
 		}
 
-		return 0, 0, ErrRefreshInvalid
+		return 0, authClaims{}, ErrRefreshInvalid
+	}
+
+	// the tokens of a tenant are signed with keys of their own too, see
+	// jwtKeys.tenant
+	if cl.Tenant != us.keys.schema {
+		return 0, authClaims{}, ErrRefreshInvalid
 	}
 
 	// get the user ID in the claim, passed in the subject field
 	id, err := strconv.ParseInt(cl.Subject, 10, 0)
 	if err != nil {
-		return 0, 0, ErrRefreshInvalid
+		return 0, authClaims{}, ErrRefreshInvalid
 	}
 
-	return id, cl.RoleID, nil
+	return id, cl, nil
 }
 
 type userValidator struct {
 	UserDB
 	roleService RoleService
 	emailRegex  *regexp.Regexp
+
+	// rules are the custom rules run after the validators, if not nil.
+	rules *Rules
+
+	// auth checks the passwords before the database, if not nil.
+	auth AuthProvider
 }
 
 func (uv *userValidator) Authenticate(username, password string) (User, error) {
@@ -402,39 +1149,56 @@ func (uv *userValidator) Authenticate(username, password string) (User, error) {
 		return User{}, err
 	}
 
-	// fetch real user from DB after basic validation passes
-	user, err = uv.UserDB.ByEmail(user.Email)
-	if err != nil {
-		return User{}, err
-	}
+	// check the credentials after basic validation passes
+	return uv.authenticate(user.Email, password)
+}
 
-	if !user.Active {
-		return User{}, ErrInvalid
-	}
+func (uv *userValidator) AuthenticateFrom(username, password string, client SessionClient) (User, error) {
+	panic("method AuthenticateFrom of userValidator must never be called")
+}
 
-	// check the password matches
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
-		if xerrors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return User{}, ValidationError{"password": ErrPasswordIncorrect}
-		}
+func (uv *userValidator) Refresh(refreshToken string) (User, error) {
+	panic("method Refresh of userValidator must never be called")
+}
 
-		return User{}, wrap("failed to compare password hashes", err)
-	}
+func (uv *userValidator) Validate(accessToken string) (User, error) {
+	panic("method Validate of userValidator must never be called")
+}
 
-	return user, nil
+func (uv *userValidator) Sessions(userID int64) ([]Session, error) {
+	panic("method Sessions of userValidator must never be called")
+}
+
+func (uv *userValidator) RevokeSession(userID int64, id string) error {
+	panic("method RevokeSession of userValidator must never be called")
+}
+
+func (uv *userValidator) RevokeSessions(userID int64) error {
+	panic("method RevokeSessions of userValidator must never be called")
+}
+
+func (uv *userValidator) Deactivate(id int64) error {
+	panic("method Deactivate of userValidator must never be called")
+}
+
+func (uv *userValidator) Activate(id int64) error {
+	panic("method Activate of userValidator must never be called")
+}
+
+func (uv *userValidator) Token(u *User) (Token, error) {
+	panic("method Token of userValidator must never be called")
 }
 
-func (uv *userValidator) Refresh(refreshToken string) (User, error) {
-	panic("method Refresh of userValidator must never be called")
+func (uv *userValidator) TokenFor(u *User, opts TokenOptions) (Token, error) {
+	panic("method TokenFor of userValidator must never be called")
 }
 
-func (uv *userValidator) Validate(accessToken string) (User, error) {
-	panic("method Validate of userValidator must never be called")
+func (uv *userValidator) Impersonate(u *User, actor *User) (Token, error) {
+	panic("method Impersonate of userValidator must never be called")
 }
 
-func (uv *userValidator) Token(u *User) (Token, error) {
-	panic("method Token of userValidator must never be called")
+func (uv *userValidator) RefreshSession(refreshToken string, client SessionClient) (User, Token, error) {
+	panic("method RefreshSession of userValidator must never be called")
 }
 
 func (uv *userValidator) Create(u *User) error {
@@ -447,7 +1211,7 @@ func (uv *userValidator) Create(u *User) error {
 		uv.idSetToZero,
 		uv.firstNameRequired,
 		uv.firstNameLength,
-		uv.settingsLength,
+		uv.settingsObject,
 		uv.passwordRequired,
 		uv.passwordLength,
 		uv.passwordHash,
@@ -460,6 +1224,10 @@ func (uv *userValidator) Create(u *User) error {
 		return err
 	}
 
+	if err := uv.runValFuncs(u, uv.rules.userRules()...); err != nil {
+		return err
+	}
+
 	return uv.UserDB.Create(u)
 }
 
@@ -472,22 +1240,90 @@ func (uv *userValidator) Update(u *User) error {
 	uc := userValWithCurrent{uv: uv}
 	if err := uv.runValFuncs(u,
 		uc.fetchUser,
-		uv.idNotAdmin,
 		uv.firstNameRequired,
 		uv.firstNameLength,
-		uv.settingsLength,
+		uv.settingsObject,
 		uv.emailRequired,
 		uv.normaliseEmail,
 		uv.emailFormat,
 		uv.passwordLength,
 		uv.passwordHash,
+		uc.adminPasswordOnly,
 		uc.preservePassword,
+		uc.preserveOrganisation,
 		uc.emailIsTaken,
 		uv.roleIDExists,
 	); err != nil {
 		return err
 	}
 
+	if err := uv.runValFuncs(u, uv.rules.userRules()...); err != nil {
+		return err
+	}
+
+	return uv.UserDB.Update(u)
+}
+
+func (uv *userValidator) UpdatePartial(u *User, patch []byte) error {
+	defer func() {
+		u.Password = ""
+	}()
+
+	fields, err := patchFields(patch)
+	if err != nil {
+		return err
+	}
+
+	uc := userValWithCurrent{uv: uv}
+	uc.current, err = uv.UserDB.ByID(u.ID)
+	if err != nil {
+		return err
+	}
+
+	// the stored password hash must never be patched, only replaced
+	patched := uc.current
+	patched.Password = ""
+	patched.Role = nil
+
+	var pu User
+	if err := applyMergePatch(&patched, patch, &pu); err != nil {
+		return err
+	}
+
+	// without a version from the client, the one read is used so changes
+	// made in between are not overwritten
+	pu.ID, pu.Version = u.ID, u.Version
+	if pu.Version == 0 {
+		pu.Version = uc.current.Version
+	}
+	*u = pu
+
+	fns := []func() (string, userValFn){}
+	if fields["firstName"] {
+		fns = append(fns, uv.firstNameRequired, uv.firstNameLength)
+	}
+	if fields["settings"] {
+		fns = append(fns, uv.settingsObject)
+	}
+	if fields["email"] {
+		fns = append(fns, uv.emailRequired, uv.normaliseEmail, uv.emailFormat, uc.emailIsTaken)
+	}
+	if fields["password"] {
+		fns = append(fns, uv.passwordLength, uv.passwordHash)
+	}
+	fns = append(fns, uc.adminPasswordOnly, uc.preservePassword, uc.preserveOrganisation)
+	if fields["roleId"] {
+		fns = append(fns, uv.roleIDExists)
+	}
+
+	if err := uv.runValFuncs(u, fns...); err != nil {
+		return err
+	}
+
+	if err := uv.runValFuncs(u, uv.rules.userRules()...); err != nil {
+		return err
+	}
+
 	return uv.UserDB.Update(u)
 }
 
@@ -501,6 +1337,116 @@ func (uv *userValidator) Delete(id int64) error {
 	return uv.UserDB.Delete(id)
 }
 
+func (uv *userValidator) DeleteWith(id int64, d UserDeletion) error {
+	if err := uv.runValFuncs(&User{ID: id},
+		uv.idNotAdmin,
+	); err != nil {
+		return err
+	}
+
+	switch d.Ratings {
+	case "", RatingsRestrict:
+		return uv.UserDB.Delete(id)
+	case RatingsAnonymise:
+	case RatingsReassign:
+		if d.ReassignTo < 1 || d.ReassignTo == id {
+			return ValidationError{"reassignTo": ErrInvalid}
+		}
+
+		_, err := uv.UserDB.ByID(d.ReassignTo)
+		if err != nil {
+			if xerrors.Is(err, ErrNotFound) {
+				return ValidationError{"reassignTo": ErrRefNotFound}
+			}
+			return err
+		}
+	default:
+		return ValidationError{"ratings": ErrInvalid}
+	}
+
+	return uv.UserDB.DeleteWith(id, d)
+}
+
+func (uv *userValidator) SetActive(id int64, active bool) error {
+	if err := uv.runValFuncs(&User{ID: id},
+		uv.idNotAdmin,
+	); err != nil {
+		return err
+	}
+
+	return uv.UserDB.SetActive(id, active)
+}
+
+func (uv *userValidator) AssignRole(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+	ids, err := normaliseIDs(ids)
+	switch {
+	case err != nil:
+		return nil, ValidationError{"userIds": ErrInvalid}
+	case len(ids) == 0:
+		return nil, ValidationError{"userIds": ErrRequired}
+	case len(ids) > maxRoleAssignments:
+		return nil, ValidationError{"userIds": ErrTooLong}
+	}
+
+	role, err := uv.roleService.ByID(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := false
+	users, err := uv.UserDB.Search(SearchQuery{IDs: ids, Roles: &roles})
+	if err != nil {
+		return nil, err
+	}
+
+	// the users are checked as they would be updated with the role, and
+	// the ones rejected are left out of the assignment
+	var results []RoleAssignment
+	rejected := make(map[int64]bool)
+	for _, u := range users {
+		u.RoleID = roleID
+
+		if !role.AvailableTo(u.OrgID) {
+			results = append(results, failedAssignment(u.ID, ValidationError{"roleId": ErrRefNotFound}))
+			rejected[u.ID] = true
+			continue
+		}
+
+		err := uv.runValFuncs(&u, append([]func() (string, userValFn){uv.idNotAdmin}, uv.rules.userRules()...)...)
+		if err == nil {
+			continue
+		}
+
+		pe, ok := err.(PublicError)
+		if !ok {
+			return nil, err
+		}
+		results = append(results, failedAssignment(u.ID, pe))
+		rejected[u.ID] = true
+	}
+
+	assign := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !rejected[id] {
+			assign = append(assign, id)
+		}
+	}
+
+	if len(assign) > 0 {
+		assigned, err := uv.UserDB.AssignRole(roleID, assign...)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, assigned...)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].UserID < results[j].UserID
+	})
+
+	return results, nil
+}
+
 func (uv *userValidator) ByEmail(e string) (User, error) {
 	user := User{
 		Email: e,
@@ -517,8 +1463,63 @@ func (uv *userValidator) ByEmail(e string) (User, error) {
 	return uv.UserDB.ByEmail(user.Email)
 }
 
+func (uv *userValidator) Search(q SearchQuery) ([]User, error) {
+	if err := uv.runSearchValFuncs(&q,
+		uv.normaliseSearchText,
+		uv.searchTextLength,
+		uv.searchSortExists,
+	); err != nil {
+		return nil, err
+	}
+
+	return uv.UserDB.Search(q)
+}
+
 type userValFn func(u *User) error
 
+type userSearchValFn func(q *SearchQuery) error
+
+func (uv *userValidator) runSearchValFuncs(q *SearchQuery, fns ...func() (string, userSearchValFn)) error {
+	return runValidationFunctions(q, fns)
+}
+
+// normaliseSearchText removes leading and trailing white space from the searched text. It does not return any
+// errors.
+func (uv *userValidator) normaliseSearchText() (string, userSearchValFn) {
+	return "q", func(q *SearchQuery) error {
+		q.Q = strings.TrimSpace(q.Q)
+		return nil
+	}
+}
+
+// searchTextLength makes sure the searched text has a maximum of 255 characters, the size of the searched
+// fields. It may return ErrTooLong.
+func (uv *userValidator) searchTextLength() (string, userSearchValFn) {
+	return "q", func(q *SearchQuery) error {
+		if len(q.Q) > 255 {
+			return ErrTooLong
+		}
+
+		return nil
+	}
+}
+
+// searchSortExists makes sure the results are sorted by one of the fields in userSortColumns. It may return
+// ErrInvalid.
+func (uv *userValidator) searchSortExists() (string, userSearchValFn) {
+	return "sort", func(q *SearchQuery) error {
+		if q.Sort == "" {
+			return nil
+		}
+
+		if _, ok := userSortColumns[strings.TrimPrefix(q.Sort, "-")]; !ok {
+			return ErrInvalid
+		}
+
+		return nil
+	}
+}
+
 type userValWithCurrent struct {
 	uv      *userValidator
 	current User
@@ -553,6 +1554,26 @@ func (uc *userValWithCurrent) emailIsTaken() (string, userValFn) {
 	}
 }
 
+// adminPasswordOnly makes sure the only change made to the default admin user is a new password, so
+// it can replace the password it was created with. It returns ErrReadOnly otherwise.
+//
+// This method must be called AFTER the password hashing validators and BEFORE preservePassword.
+func (uc *userValWithCurrent) adminPasswordOnly() (string, userValFn) {
+	return "", func(u *User) error {
+		if u.ID != adminID {
+			return nil
+		}
+
+		cu := uc.current
+		if u.Password == "" || u.Active != cu.Active || u.Email != cu.Email || u.FirstName != cu.FirstName ||
+			u.LastName != cu.LastName || u.RoleID != cu.RoleID || !sameJSON(u.Settings, cu.Settings) {
+			return ErrReadOnly
+		}
+
+		return nil
+	}
+}
+
 // preservePassword makes sure an existing user's password is preserved if a new one is not provided.
 // It does not return any errors.
 //
@@ -568,6 +1589,18 @@ func (uc *userValWithCurrent) preservePassword() (string, userValFn) {
 	}
 }
 
+// preserveOrganisation keeps the organisation of an existing user, which never changes. It does not
+// return any errors.
+//
+// This method must be called BEFORE roleIDExists, so the role is checked against the organisation
+// of the user.
+func (uc *userValWithCurrent) preserveOrganisation() (string, userValFn) {
+	return "", func(u *User) error {
+		u.OrgID = uc.current.OrgID
+		return nil
+	}
+}
+
 func (uv *userValidator) runValFuncs(u *User, fns ...func() (string, userValFn)) error {
 	return runValidationFunctions(u, fns)
 }
@@ -580,11 +1613,11 @@ func (uv *userValidator) idSetToZero() (string, userValFn) {
 	}
 }
 
-// idNotAdmin makes sure a user's ID is not 1, the default admin user.
+// idNotAdmin makes sure a user's ID is not the one of the default admin user.
 // It returns an ErrIDAdminCannotChange in case it is.
 func (uv *userValidator) idNotAdmin() (string, userValFn) {
 	return "", func(u *User) error {
-		if u.ID == 1 {
+		if u.ID == adminID {
 			return ErrReadOnly
 		}
 
@@ -702,29 +1735,53 @@ func (uv *userValidator) firstNameLength() (string, userValFn) {
 	}
 }
 
-// settingsLength makes sure that the text contained in settings is not greater
-// than X bytes. It may return ErrTooLong.
-func (uv *userValidator) settingsLength() (string, userValFn) {
+// settingsObject makes sure that the settings, if any, are a JSON object, whose
+// members have names of at most maxSettingsKeySize bytes, and that they are not
+// greater than MaxSettingsSize bytes once compacted. It may return ErrInvalid or
+// ErrTooLong.
+func (uv *userValidator) settingsObject() (string, userValFn) {
 	return "settings", func(u *User) error {
-		if len(u.Settings) > 8192 {
+		if len(u.Settings) == 0 {
+			return nil
+		}
+
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(u.Settings, &members); err != nil || members == nil {
+			return ErrInvalid
+		}
+		for k := range members {
+			if k == "" || len(k) > maxSettingsKeySize {
+				return ErrInvalid
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, u.Settings); err != nil {
+			return ErrInvalid
+		}
+		if buf.Len() > MaxSettingsSize {
 			return ErrTooLong
 		}
 
+		u.Settings = buf.Bytes()
 		return nil
 	}
 }
 
-// roleIDExists verifies that the requested role ID exists in the database. It may return
-// an ErrNotFound.
+// roleIDExists verifies that the requested role ID exists in the database, and that the role is
+// available to the organisation of the user, see Role.AvailableTo. It may return an ErrRefNotFound.
 //
 // If an error happens when checking the database, it will be ignored and the validation will be considered
 // as a pass. The database integrity checks will then make sure that the role exists in the end.
 func (uv *userValidator) roleIDExists() (string, userValFn) {
 	return "roleId", func(u *User) error {
-		if _, err := uv.roleService.ByID(u.RoleID); err != nil {
+		r, err := uv.roleService.ByID(u.RoleID)
+		if err != nil {
 			if xerrors.Is(err, ErrNotFound) {
 				return ErrRefNotFound
 			}
+		} else if !r.AvailableTo(u.OrgID) {
+			return ErrRefNotFound
 		}
 
 		return nil
@@ -733,9 +1790,30 @@ func (uv *userValidator) roleIDExists() (string, userValFn) {
 
 type userGorm struct {
 	db *gorm.DB
+
+	// omitRoles lists the users without their role, see
+	// Config.OmitUserRoles.
+	omitRoles bool
+}
+
+// listed returns qb reading the roles of the users listed along with them, if
+// roles is true, or if it is nil and omitRoles is not set. The roles are read
+// in a single query.
+func (ug *userGorm) listed(qb *gorm.DB, roles *bool) *gorm.DB {
+	if roles == nil && ug.omitRoles || roles != nil && !*roles {
+		return qb
+	}
+
+	return qb.Preload("Role")
 }
 
 func (ug *userGorm) Create(u *User) error {
+	if len(u.Settings) == 0 {
+		u.Settings = json.RawMessage(`{}`)
+	}
+	// gorm sets the times of the users created
+	u.CreatedAt, u.UpdatedAt = nil, nil
+
 	res := ug.db.Create(u)
 	if res.Error != nil {
 		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) {
@@ -746,6 +1824,8 @@ func (ug *userGorm) Create(u *User) error {
 				return ValidationError{"email": ErrDuplicate}
 			case perr.Code.Name() == "foreign_key_violation" && perr.Constraint == "users_role_id_roles_id_foreign":
 				return ValidationError{"roleId": ErrRefNotFound}
+			case perr.Code.Name() == "foreign_key_violation" && perr.Constraint == "users_org_id_fkey":
+				return ValidationError{"orgId": ErrRefNotFound}
 			}
 		}
 
@@ -756,19 +1836,41 @@ func (ug *userGorm) Create(u *User) error {
 }
 
 func (ug *userGorm) Update(u *User) error {
-	res := ug.db.Model(&User{ID: u.ID}).Updates(gormToMap(ug.db, u))
+	// the settings are stored as a JSON object, an empty one if not set
+	if len(u.Settings) == 0 {
+		u.Settings = json.RawMessage(`{}`)
+	}
 
-	if res.Error != nil {
-		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) {
-			switch {
-			case perr.Code.Name() == "unique_violation" && perr.Constraint == "users_email_key":
-				return ValidationError{"email": ErrDuplicate}
-			case perr.Code.Name() == "foreign_key_violation" && perr.Constraint == "users_role_id_roles_id_foreign":
-				return ValidationError{"roleId": ErrRefNotFound}
+	return gormTransaction(ug.db, func(tx *gorm.DB) error {
+		v, err := gormVersionedUpdates(tx, &User{ID: u.ID}, u, u.Version)
+		if err != nil {
+			if perr := (*pq.Error)(nil); xerrors.As(err, &perr) {
+				switch {
+				case perr.Code.Name() == "unique_violation" && perr.Constraint == "users_email_key":
+					return ValidationError{"email": ErrDuplicate}
+				case perr.Code.Name() == "foreign_key_violation" && perr.Constraint == "users_role_id_roles_id_foreign":
+					return ValidationError{"roleId": ErrRefNotFound}
+				}
+
+			} else if xerrors.Is(err, ErrNotFound) || xerrors.Is(err, ErrConflict) {
+				return err
 			}
+
+			return wrap("could not update user", err)
 		}
 
-		return wrap("could not update user", res.Error)
+		u.Version = v
+		return nil
+	})
+}
+
+func (ug *userGorm) Delete(id int64) error {
+	res := ug.db.Delete(&User{}, id)
+	if res.Error != nil {
+		if perr := (*pq.Error)(nil); xerrors.As(res.Error, &perr) && perr.Code.Name() == "foreign_key_violation" {
+			return ErrInUse
+		}
+		return wrap("could not delete user by id", res.Error)
 
 	} else if res.RowsAffected == 0 {
 		return ErrNotFound
@@ -777,11 +1879,91 @@ func (ug *userGorm) Update(u *User) error {
 	return nil
 }
 
-func (ug *userGorm) Delete(id int64) error {
-	res := ug.db.Delete(&User{}, id)
+func (ug *userGorm) DeleteWith(id int64, d UserDeletion) error {
+	return gormTransaction(ug.db, func(tx *gorm.DB) error {
+		txg := &userGorm{db: tx, omitRoles: ug.omitRoles}
+
+		switch d.Ratings {
+		case RatingsAnonymise:
+			return txg.anonymise(id)
+		case RatingsReassign:
+			err := tx.
+				Exec(`UPDATE rating_revisions SET user_id = ?
+					WHERE rating_id IN (SELECT id FROM ratings WHERE user_id = ?)`, d.ReassignTo, id).
+				Exec("UPDATE ratings SET user_id = ? WHERE user_id = ?", d.ReassignTo, id).
+				Error
+			if err != nil {
+				if perr := (*pq.Error)(nil); xerrors.As(err, &perr) {
+					switch perr.Code.Name() {
+					case "unique_violation":
+						// both rated the same target
+						return ValidationError{"reassignTo": ErrDuplicate}
+					case "foreign_key_violation":
+						return ValidationError{"reassignTo": ErrRefNotFound}
+					}
+				}
+				return with(wrap("could not reassign the ratings of the user", err), "user_id", id)
+			}
+		}
+
+		return txg.Delete(id)
+	})
+}
+
+// ratedTargets returns the targets rated by the user with the given ID.
+func ratedTargets(db *gorm.DB, userID int64) ([]int64, error) {
+	var targets []int64
+	err := db.Model(&Rating{}).Where("user_id = ?", userID).Pluck("target", &targets).Error
+	if err != nil {
+		return nil, with(wrap("could not get the targets rated by the user", err), "user_id", userID)
+	}
+
+	return targets, nil
+}
+
+// anonymise erases the personal data of the user with the given ID, which is
+// kept inactive as the author of its ratings, made anonymous. See
+// RatingsAnonymise.
+func (ug *userGorm) anonymise(id int64) error {
+	res := ug.db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"active":     false,
+		"email":      "deleted-" + strconv.FormatInt(id, 10) + "@users.invalid",
+		"first_name": deletedUserFirstName,
+		"last_name":  "",
+		"password":   "",
+		"settings":   "{}",
+		"version":    gorm.Expr("version + 1"),
+	})
 	if res.Error != nil {
-		return wrap("could not delete user by id", res.Error)
+		return with(wrap("could not anonymise user", res.Error), "user_id", id)
+	} else if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	err := ug.db.
+		Exec("UPDATE ratings SET anonymous = true WHERE user_id = ?", id).
+		Exec(`UPDATE rating_revisions SET anonymous = true, user_id = ?
+			WHERE rating_id IN (SELECT id FROM ratings WHERE user_id = ?)`, id, id).
+		Exec("DELETE FROM user_consents WHERE user_id = ?", id).
+		Exec("DELETE FROM rating_drafts WHERE user_id = ?", id).
+		Exec("DELETE FROM target_subscriptions WHERE user_id = ?", id).
+		Exec("DELETE FROM notifications WHERE user_id = ?", id).
+		Exec("DELETE FROM alert_rules WHERE owner_id = ?", id).
+		Error
+	if err != nil {
+		return with(wrap("could not anonymise the data of the user", err), "user_id", id)
+	}
+
+	return nil
+}
 
+func (ug *userGorm) SetActive(id int64, active bool) error {
+	res := ug.db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"active":  active,
+		"version": gorm.Expr("version + 1"),
+	})
+	if res.Error != nil {
+		return with(wrap("could not set user active", res.Error), "user_id", id)
 	} else if res.RowsAffected == 0 {
 		return ErrNotFound
 	}
@@ -789,6 +1971,63 @@ func (ug *userGorm) Delete(id int64) error {
 	return nil
 }
 
+func (ug *userGorm) AssignRole(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+	var results []RoleAssignment
+	err := gormTransaction(ug.db, func(tx *gorm.DB) error {
+		var users []User
+		err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Select("id, role_id").
+			Where(ids).
+			Find(&users).
+			Error
+		if err != nil {
+			return wrap("could not lock the users assigned a role", err)
+		}
+
+		current := make(map[int64]int64, len(users))
+		for _, u := range users {
+			current[u.ID] = u.RoleID
+		}
+
+		results = make([]RoleAssignment, 0, len(ids))
+		var assign []int64
+		for _, id := range ids {
+			rid, ok := current[id]
+			switch {
+			case !ok:
+				results = append(results, failedAssignment(id, ErrNotFound))
+			case rid == roleID:
+				results = append(results, RoleAssignment{UserID: id, Status: AssignmentUnchanged})
+			default:
+				results = append(results, RoleAssignment{UserID: id, Status: AssignmentAssigned})
+				assign = append(assign, id)
+			}
+		}
+		if len(assign) == 0 {
+			return nil
+		}
+
+		err = tx.Model(&User{}).Where("id IN (?)", assign).Updates(map[string]interface{}{
+			"role_id": roleID,
+			"version": gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			if perr := (*pq.Error)(nil); xerrors.As(err, &perr) && perr.Code.Name() == "foreign_key_violation" {
+				// the role was removed in between
+				return ErrNotFound
+			}
+			return with(wrap("could not assign the role to the users", err), "role_id", roleID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
 func (ug *userGorm) ByEmail(e string) (User, error) {
 	var user User
 
@@ -827,10 +2066,57 @@ func (ug *userGorm) ByIDs(ids ...int64) ([]User, error) {
 		qb = qb.Where(ids)
 	}
 
-	err := qb.Find(&users).Error
+	err := ug.listed(qb, nil).Find(&users).Error
 	if err != nil {
 		return nil, wrap("failed to list users by ids", err)
 	}
 
 	return users, nil
 }
+
+func (ug *userGorm) Search(q SearchQuery) ([]User, error) {
+	var users []User
+
+	qb := ug.db
+	if len(q.IDs) > 0 {
+		qb = qb.Where(q.IDs)
+	}
+
+	if q.Q != "" {
+		// the text is matched literally, so LIKE wildcards must be escaped
+		like := "%" + likeEscaper.Replace(q.Q) + "%"
+		qb = qb.Where("email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?", like, like, like)
+	}
+
+	if q.Active != nil {
+		qb = qb.Where("active = ?", *q.Active)
+	}
+
+	if q.RoleID != 0 {
+		qb = qb.Where("role_id = ?", q.RoleID)
+	}
+
+	if q.OrgID != 0 {
+		qb = qb.Where("org_id = ?", q.OrgID)
+	}
+
+	order := "id"
+	if col := userSortColumns[strings.TrimPrefix(q.Sort, "-")]; col != "" {
+		order = col
+		if strings.HasPrefix(q.Sort, "-") {
+			order += " DESC"
+		}
+
+		// ties are sorted by ID so results are stable
+		if col != "id" {
+			order += ", id"
+		}
+	}
+
+	err := ug.listed(qb, q.Roles).Order(order).Find(&users).Error
+	if err != nil {
+		return nil, wrap("failed to search users", err)
+	}
+
+	return users, nil
+}
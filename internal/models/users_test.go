@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -20,8 +22,11 @@ type testUserDB struct {
 	byID    func(id int64) (User, error)
 	byIDs   func(id ...int64) ([]User, error)
 	delete  func(id int64) error
+	deleteW func(id int64, d UserDeletion) error
 	create  func(*User) error
 	update  func(*User) error
+	search  func(SearchQuery) ([]User, error)
+	assign  func(roleID int64, ids ...int64) ([]RoleAssignment, error)
 }
 
 func (t *testUserDB) ByEmail(e string) (User, error) {
@@ -56,6 +61,14 @@ func (t *testUserDB) Delete(id int64) error {
 	return nil
 }
 
+func (t *testUserDB) DeleteWith(id int64, d UserDeletion) error {
+	if t.deleteW != nil {
+		return t.deleteW(id, d)
+	}
+
+	return nil
+}
+
 func (t *testUserDB) Create(u *User) error {
 	if t.create != nil {
 		return t.create(u)
@@ -72,8 +85,24 @@ func (t *testUserDB) Update(u *User) error {
 	return nil
 }
 
+func (t *testUserDB) Search(q SearchQuery) ([]User, error) {
+	if t.search != nil {
+		return t.search(q)
+	}
+
+	return nil, nil
+}
+
+func (t *testUserDB) AssignRole(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+	if t.assign != nil {
+		return t.assign(roleID, ids...)
+	}
+
+	return nil, nil
+}
+
 func dropUsersTable(db *gorm.DB) {
-	db.DropTableIfExists(&Rating{}, &User{})
+	db.DropTableIfExists(&RatingCard{}, &Consent{}, &Reaction{}, &Moderation{}, &Reputation{}, &adminBootstrap{}, &RatingRevision{}, &Rating{}, &User{})
 }
 
 type testSigner struct {
@@ -519,6 +548,187 @@ func TestUserService_Validate(t *testing.T) {
 	})
 }
 
+func TestUserService_ValidateRotatedSecret(t *testing.T) {
+	const newSecret = "the new jwt test secret, replacing the previous one"
+
+	user := User{ID: 888, Active: true, RoleID: 999}
+	tudb := &testUserDB{byID: func(id int64) (User, error) {
+		return user, nil
+	}}
+
+	newService := func(t *testing.T, keys jwtKeys) UserService {
+		us, err := newUserService(nil, nil, keys, nil, nil, nil, nil, nil, false)
+		require.NoError(t, err)
+		us.(*userService).UserService.(*userValidator).UserDB = tudb
+		return us
+	}
+
+	previous := newService(t, jwtKeys{secret: []byte(testJWTSecret)})
+	tok, err := previous.Token(&user)
+	require.NoError(t, err)
+
+	var cases = []struct {
+		name  string
+		keys  jwtKeys
+		valid bool
+	}{
+		{"gracePeriod", jwtKeys{secret: []byte(newSecret), previous: []byte(testJWTSecret), previousUntil: time.Now().Add(time.Hour)}, true},
+		{"gracePeriodOver", jwtKeys{secret: []byte(newSecret), previous: []byte(testJWTSecret), previousUntil: time.Now().Add(-time.Second)}, false},
+		{"noPrevious", jwtKeys{secret: []byte(newSecret)}, false},
+		{"tenant", jwtKeys{secret: []byte(newSecret), previous: []byte(testJWTSecret), previousUntil: time.Now().Add(time.Hour)}.tenant("tenant_1"), false},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			us := newService(t, cs.keys)
+
+			_, err := us.Validate(tok.AccessToken)
+			if !cs.valid {
+				assert.True(t, xerrors.Is(err, ErrUnauthorised))
+				return
+			}
+			assert.NoError(t, err)
+
+			_, err = us.Refresh(tok.RefreshToken)
+			assert.NoError(t, err, "the refresh tokens must be valid too")
+
+			rotated, err := us.Token(&user)
+			require.NoError(t, err)
+			_, err = previous.Validate(rotated.AccessToken)
+			assert.True(t, xerrors.Is(err, ErrUnauthorised), "must sign with the new secret")
+		})
+	}
+
+	t.Run("tenantGracePeriod", func(t *testing.T) {
+		keys := jwtKeys{secret: []byte(newSecret), previous: []byte(testJWTSecret), previousUntil: time.Now().Add(time.Hour)}
+		tenantPrevious := newService(t, jwtKeys{secret: []byte(testJWTSecret)}.tenant("tenant_1"))
+		tok, err := tenantPrevious.Token(&user)
+		require.NoError(t, err)
+
+		_, err = newService(t, keys.tenant("tenant_1")).Validate(tok.AccessToken)
+		assert.NoError(t, err, "the tenant keys must be derived from both secrets")
+	})
+}
+
+func TestUserService_ValidateClaims(t *testing.T) {
+	user := User{ID: 888, Active: true, RoleID: 999, Role: &Role{ID: 999, Permissions: PermissionReadRatings}}
+
+	var reads int
+	newService := func(t *testing.T, keys jwtKeys) UserService {
+		us, err := newUserService(nil, nil, keys, nil, nil, nil, nil, nil, false)
+		require.NoError(t, err)
+		us.(*userService).UserService.(*userValidator).UserDB = &testUserDB{byID: func(id int64) (User, error) {
+			reads++
+			u := user
+			u.Role = &Role{ID: 999, Permissions: PermissionReadRatings | PermissionWriteRatings}
+			return u, nil
+		}}
+		return us
+	}
+
+	keys := jwtKeys{secret: []byte(testJWTSecret)}
+	tok, err := newService(t, keys).Token(&user)
+	require.NoError(t, err)
+
+	t.Run("trusted", func(t *testing.T) {
+		reads = 0
+		trusted := keys
+		trusted.trustPermissions = true
+
+		u, err := newService(t, trusted).Validate(tok.AccessToken)
+		require.NoError(t, err)
+		assert.Zero(t, reads, "must not read the user")
+		assert.Equal(t, int64(888), u.ID)
+		assert.Equal(t, int64(999), u.RoleID)
+		require.NotNil(t, u.Role)
+		assert.Equal(t, PermissionReadRatings, u.Role.Permissions, "must use the permissions of the token")
+
+		noRole := user
+		noRole.Role = nil
+		old, err := newService(t, keys).Token(&noRole)
+		require.NoError(t, err)
+		u, err = newService(t, trusted).Validate(old.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reads, "must read the user if the token has no permissions")
+		assert.Equal(t, PermissionReadRatings|PermissionWriteRatings, u.Role.Permissions)
+	})
+
+	t.Run("notTrusted", func(t *testing.T) {
+		reads = 0
+
+		u, err := newService(t, keys).Validate(tok.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reads)
+		assert.Equal(t, PermissionReadRatings|PermissionWriteRatings, u.Role.Permissions)
+	})
+
+	t.Run("otherTenant", func(t *testing.T) {
+		// same secret, as if the keys were not derived
+		other := keys
+		other.schema = "tenant_1"
+
+		_, err := newService(t, other).Validate(tok.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+
+		tenantTok, err := newService(t, other).Token(&user)
+		require.NoError(t, err)
+		_, err = newService(t, keys).Validate(tenantTok.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+		_, err = newService(t, other).Validate(tenantTok.AccessToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("organisation", func(t *testing.T) {
+		org := int64(4)
+		member := user
+		member.OrgID = &org
+		orgTok, err := newService(t, keys).Token(&member)
+		require.NoError(t, err)
+
+		jtok, err := jwt.ParseSigned(orgTok.AccessToken)
+		require.NoError(t, err)
+		var cl authClaims
+		require.NoError(t, jtok.Claims([]byte(testJWTSecret), &cl))
+		assert.Equal(t, org, cl.OrgID, "the organisation must be included in the token")
+
+		trusted := keys
+		trusted.trustPermissions = true
+		u, err := newService(t, trusted).Validate(orgTok.AccessToken)
+		require.NoError(t, err)
+		require.NotNil(t, u.OrgID)
+		assert.Equal(t, org, *u.OrgID, "must use the organisation of the token")
+
+		_, err = newService(t, keys).Validate(orgTok.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised), "must not accept a token of another organisation than the user's")
+	})
+}
+
+func TestUserService_Clock(t *testing.T) {
+	user := User{ID: 888, Active: true, RoleID: 999}
+	issued := time.Now().Add(-DefaultAccessTokenTTL - time.Minute)
+
+	newService := func(t *testing.T, clock Clock) UserService {
+		us, err := newUserService(nil, nil, jwtKeys{secret: []byte(testJWTSecret)}, nil, nil, nil, nil, clock, false)
+		require.NoError(t, err)
+		us.(*userService).UserService.(*userValidator).UserDB = &testUserDB{byID: func(id int64) (User, error) {
+			return user, nil
+		}}
+		return us
+	}
+
+	tok, err := newService(t, FixedClock(issued)).Token(&user)
+	require.NoError(t, err)
+
+	_, err = newService(t, nil).Validate(tok.AccessToken)
+	assert.True(t, xerrors.Is(err, ErrUnauthorised), "must expire by the time of the system")
+
+	_, err = newService(t, FixedClock(issued.Add(time.Hour))).Validate(tok.AccessToken)
+	assert.NoError(t, err, "must be valid at the time of the clock")
+
+	_, err = newService(t, nil).Refresh(tok.RefreshToken)
+	assert.NoError(t, err)
+}
+
 func TestUserService_Token(t *testing.T) {
 	const jwtkey = "test secret key for jwt signing"
 
@@ -528,8 +738,8 @@ func TestUserService_Token(t *testing.T) {
 		RoleID: 888,
 	}
 
-	assert.True(t, jwtAccessDuration >= 6*time.Hour, "jwt access duration must have a reasonable length of time")
-	assert.True(t, jwtRefreshDuration >= 1*24*time.Hour, "jwt refresh duration must have a reasonable length of time")
+	assert.True(t, DefaultAccessTokenTTL >= 6*time.Hour, "jwt access duration must have a reasonable length of time")
+	assert.True(t, DefaultRefreshTokenTTL >= 1*24*time.Hour, "jwt refresh duration must have a reasonable length of time")
 
 	t.Run("good", func(t *testing.T) {
 		tok, err := us.Token(&user)
@@ -537,7 +747,7 @@ func TestUserService_Token(t *testing.T) {
 		assert.NotEmpty(t, tok.AccessToken)
 		assert.NotEmpty(t, tok.RefreshToken)
 		assert.Equal(t, "bearer", tok.TokenType)
-		assert.Equal(t, int(jwtAccessDuration/time.Second), tok.ExpiresIn)
+		assert.Equal(t, int(DefaultAccessTokenTTL/time.Second), tok.ExpiresIn)
 
 		// access token
 		jtok, err := jwt.ParseSigned(tok.AccessToken)
@@ -552,8 +762,8 @@ func TestUserService_Token(t *testing.T) {
 
 		assert.Equal(t, "999", cl.Subject, "subject is present on token")
 		assert.Equal(t, int64(888), cl.RoleID, "role id is included in token")
-		assert.True(t, cl.Expiry.Time().After(time.Now().Add(jwtAccessDuration-1*time.Minute)), "token has the right expiry time")
-		assert.True(t, cl.Expiry.Time().Before(time.Now().Add(jwtAccessDuration+1*time.Minute)), "token has the right expiry time")
+		assert.True(t, cl.Expiry.Time().After(time.Now().Add(DefaultAccessTokenTTL-1*time.Minute)), "token has the right expiry time")
+		assert.True(t, cl.Expiry.Time().Before(time.Now().Add(DefaultAccessTokenTTL+1*time.Minute)), "token has the right expiry time")
 
 		rtok, err := jwt.ParseSigned(tok.RefreshToken)
 		require.NoError(t, err)
@@ -567,8 +777,53 @@ func TestUserService_Token(t *testing.T) {
 
 		require.Equal(t, "999", cl.Subject, "subject is present on token")
 		require.Equal(t, int64(888), cl.RoleID, "role id is included in token")
-		assert.True(t, cl.Expiry.Time().After(time.Now().Add(jwtRefreshDuration-1*time.Minute)), "token has the right expiry time")
-		assert.True(t, cl.Expiry.Time().Before(time.Now().Add(jwtRefreshDuration+1*time.Minute)), "token has the right expiry time")
+		assert.True(t, cl.Expiry.Time().After(time.Now().Add(DefaultRefreshTokenTTL-1*time.Minute)), "token has the right expiry time")
+		assert.True(t, cl.Expiry.Time().Before(time.Now().Add(DefaultRefreshTokenTTL+1*time.Minute)), "token has the right expiry time")
+	})
+
+	t.Run("ttls", func(t *testing.T) {
+		us, err := newUserService(nil, nil, jwtKeys{secret: []byte(jwtkey), accessTTL: 5 * time.Minute, refreshTTL: time.Hour}, nil, nil, nil, nil, nil, false)
+		require.NoError(t, err)
+
+		tok, err := us.Token(&user)
+		require.NoError(t, err)
+		assert.Equal(t, 300, tok.ExpiresIn)
+
+		for tok, ttl := range map[string]time.Duration{tok.AccessToken: 5 * time.Minute, tok.RefreshToken: time.Hour} {
+			jtok, err := jwt.ParseSigned(tok)
+			require.NoError(t, err)
+
+			var cl authClaims
+			require.NoError(t, jtok.Claims([]byte(jwtkey), &cl))
+			assert.WithinDuration(t, time.Now().Add(ttl), cl.Expiry.Time(), time.Minute, "token has the configured expiry time")
+		}
+	})
+
+	t.Run("permissionNames", func(t *testing.T) {
+		user := User{ID: 999, RoleID: 888, Role: &Role{ID: 888, Permissions: PermissionReadRatings | PermissionWriteOwnRatings}}
+		claims := func(keys jwtKeys) authClaims {
+			us, err := newUserService(nil, nil, keys, nil, nil, nil, nil, nil, false)
+			require.NoError(t, err)
+
+			tok, err := us.Token(&user)
+			require.NoError(t, err)
+
+			jtok, err := jwt.ParseSigned(tok.AccessToken)
+			require.NoError(t, err)
+
+			var cl authClaims
+			require.NoError(t, jtok.Claims([]byte(jwtkey), &cl))
+			return cl
+		}
+
+		cl := claims(jwtKeys{secret: []byte(jwtkey)})
+		assert.Nil(t, cl.PermissionNames, "must only carry the names when enabled")
+		require.NotNil(t, cl.Permissions)
+
+		cl = claims(jwtKeys{secret: []byte(jwtkey), permissionNames: true})
+		assert.Equal(t, []string{"readRatings", "writeOwnRatings"}, cl.PermissionNames)
+		require.NotNil(t, cl.Permissions)
+		assert.Equal(t, int64(PermissionReadRatings|PermissionWriteOwnRatings), *cl.Permissions)
 	})
 
 	t.Run("badSigner", func(t *testing.T) {
@@ -581,6 +836,277 @@ func TestUserService_Token(t *testing.T) {
 
 }
 
+func TestUserService_Impersonate(t *testing.T) {
+	ss, _ := newTestSessionStore(t)
+	tudb := &testUserDB{}
+	us, _ := newUserService(nil, nil, jwtKeys{secret: []byte(testJWTSecret)}, ss, nil, nil, nil, nil, false)
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	admin := User{ID: 1, Active: true, RoleID: 1}
+	user := User{ID: 888, Active: true, RoleID: 999}
+	tudb.byID = func(id int64) (User, error) {
+		switch id {
+		case admin.ID:
+			return admin, nil
+		case user.ID:
+			return user, nil
+		}
+		return User{}, ErrNotFound
+	}
+
+	var cases = []struct {
+		name  string
+		user  User
+		actor User
+	}{
+		{"self", admin, admin},
+		{"admin", User{ID: 2, Active: true, RoleID: 1}, admin},
+		{"inactive", User{ID: 888, RoleID: 999}, admin},
+		{"nested", user, User{ID: 1, Active: true, RoleID: 1, ImpersonatedBy: 3}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := us.Impersonate(&tc.user, &tc.actor)
+			assert.Equal(t, ErrCannotImpersonate, err)
+		})
+	}
+
+	tok, err := us.Impersonate(&user, &admin)
+	require.NoError(t, err)
+	assert.Empty(t, tok.RefreshToken, "impersonations must not be refreshed")
+	assert.Equal(t, int(ImpersonationDuration/time.Second), tok.ExpiresIn)
+
+	jtok, err := jwt.ParseSigned(tok.AccessToken)
+	require.NoError(t, err)
+	var cl authClaims
+	require.NoError(t, jtok.Claims([]byte(testJWTSecret), &cl))
+	assert.Equal(t, "888", cl.Subject)
+	assert.Equal(t, &actorClaim{Subject: "1"}, cl.Actor)
+	assert.Nil(t, cl.Permissions)
+
+	t.Run("validate", func(t *testing.T) {
+		u, err := us.Validate(tok.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, int64(888), u.ID)
+		assert.Equal(t, int64(1), u.ImpersonatedBy)
+
+		sessions, err := us.Sessions(888)
+		require.NoError(t, err)
+		assert.Empty(t, sessions, "the sessions of the user must not list the impersonation")
+	})
+
+	t.Run("actorDeactivated", func(t *testing.T) {
+		admin.Active = false
+		defer func() { admin.Active = true }()
+
+		_, err := us.Validate(tok.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+	})
+
+	t.Run("sessionRevoked", func(t *testing.T) {
+		sessions, err := us.Sessions(1)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "Impersonation of user 888", sessions[0].UserAgent)
+
+		require.NoError(t, us.RevokeSession(1, sessions[0].ID))
+		_, err = us.Validate(tok.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+	})
+}
+
+func TestUserService_Sessions(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+
+		_, err := us.Sessions(888)
+		assert.True(t, xerrors.Is(err, ErrSessionsDisabled))
+		assert.True(t, xerrors.Is(us.RevokeSession(888, "abc"), ErrSessionsDisabled))
+		assert.True(t, xerrors.Is(us.RevokeSessions(888), ErrSessionsDisabled))
+	})
+
+	ss, mr := newTestSessionStore(t)
+	tudb := &testUserDB{}
+	us, _ := newUserService(nil, nil, jwtKeys{secret: []byte(testJWTSecret)}, ss, nil, nil, nil, nil, false)
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	user := User{
+		ID:     888,
+		Active: true,
+		RoleID: 999,
+	}
+	tudb.byID = func(id int64) (User, error) {
+		assert.Equal(t, int64(888), id)
+		return user, nil
+	}
+
+	t.Run("tokenStartsSession", func(t *testing.T) {
+		tok, err := us.Token(&user)
+		require.NoError(t, err)
+
+		sessions, err := us.Sessions(888)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, int64(888), sessions[0].UserID)
+		assert.True(t, sessions[0].ExpiresAt.After(time.Now().Add(DefaultRefreshTokenTTL-time.Minute)))
+
+		for _, raw := range []string{tok.AccessToken, tok.RefreshToken} {
+			jtok, err := jwt.ParseSigned(raw)
+			require.NoError(t, err)
+
+			var cl = authClaims{}
+			require.NoError(t, jtok.Claims([]byte(testJWTSecret), &cl))
+			assert.Equal(t, sessions[0].ID, cl.ID, "tokens must carry the session ID")
+		}
+
+		require.NoError(t, us.RevokeSessions(888))
+	})
+
+	t.Run("refreshRotates", func(t *testing.T) {
+		tok, err := us.Token(&user)
+		require.NoError(t, err)
+
+		_, err = us.Refresh(tok.RefreshToken)
+		require.NoError(t, err)
+
+		// a refresh token can only be used once
+		_, err = us.Refresh(tok.RefreshToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+
+		_, err = us.Validate(tok.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+
+		sessions, err := us.Sessions(888)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("refreshKeepsClient", func(t *testing.T) {
+		tok, err := us.TokenFor(&user, TokenOptions{Client: SessionClient{UserAgent: "test/1.0"}})
+		require.NoError(t, err)
+
+		sessions, err := us.Sessions(888)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		started := sessions[0]
+		assert.Equal(t, "test/1.0", started.UserAgent)
+		assert.Equal(t, started.CreatedAt, started.LastUsedAt)
+
+		later, _ := newUserService(nil, nil, jwtKeys{secret: []byte(testJWTSecret)}, ss, nil, nil, nil, FixedClock(time.Now().Add(time.Hour)), false)
+		later.(*userService).UserService.(*userValidator).UserDB = tudb
+
+		ruser, _, err := later.RefreshSession(tok.RefreshToken, SessionClient{})
+		require.NoError(t, err)
+		assert.Equal(t, user, ruser)
+
+		sessions, err = us.Sessions(888)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.NotEqual(t, started.ID, sessions[0].ID)
+		assert.Equal(t, "test/1.0", sessions[0].UserAgent)
+		assert.True(t, started.CreatedAt.Equal(sessions[0].CreatedAt))
+		assert.True(t, sessions[0].LastUsedAt.After(started.LastUsedAt))
+
+		_, _, err = later.RefreshSession(tok.RefreshToken, SessionClient{})
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+
+		require.NoError(t, us.RevokeSessions(888))
+	})
+
+	t.Run("remember", func(t *testing.T) {
+		tok, err := us.TokenFor(&user, TokenOptions{Remember: true})
+		require.NoError(t, err)
+
+		sessions, err := us.Sessions(888)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.WithinDuration(t, time.Now().Add(DefaultRememberTokenTTL), sessions[0].ExpiresAt, time.Minute)
+
+		_, _, err = us.RefreshSession(tok.RefreshToken, SessionClient{})
+		require.NoError(t, err)
+
+		sessions, err = us.Sessions(888)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.WithinDuration(t, time.Now().Add(DefaultRememberTokenTTL), sessions[0].ExpiresAt, time.Minute,
+			"the tokens refreshed must keep being remembered")
+
+		require.NoError(t, us.RevokeSessions(888))
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		tok1, err := us.Token(&user)
+		require.NoError(t, err)
+		tok2, err := us.Token(&user)
+		require.NoError(t, err)
+
+		sessions, err := us.Sessions(888)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+
+		jtok, err := jwt.ParseSigned(tok1.AccessToken)
+		require.NoError(t, err)
+		var cl = authClaims{}
+		require.NoError(t, jtok.Claims([]byte(testJWTSecret), &cl))
+
+		require.NoError(t, us.RevokeSession(888, cl.ID))
+		assert.True(t, xerrors.Is(us.RevokeSession(888, cl.ID), ErrNotFound))
+
+		_, err = us.Validate(tok1.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+		_, err = us.Refresh(tok1.RefreshToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+
+		auser, err := us.Validate(tok2.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user, auser)
+	})
+
+	t.Run("logOutEverywhere", func(t *testing.T) {
+		tok1, err := us.Token(&user)
+		require.NoError(t, err)
+		tok2, err := us.Token(&user)
+		require.NoError(t, err)
+
+		require.NoError(t, us.RevokeSessions(888))
+
+		for _, tok := range []Token{tok1, tok2} {
+			_, err = us.Validate(tok.AccessToken)
+			assert.True(t, xerrors.Is(err, ErrUnauthorised))
+			_, err = us.Refresh(tok.RefreshToken)
+			assert.True(t, xerrors.Is(err, ErrUnauthorised))
+		}
+	})
+
+	t.Run("untrackedToken", func(t *testing.T) {
+		// tokens issued before sessions were tracked have no ID
+		plain, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+		tok, err := plain.Token(&user)
+		require.NoError(t, err)
+
+		_, err = us.Validate(tok.AccessToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+		_, err = us.Refresh(tok.RefreshToken)
+		assert.True(t, xerrors.Is(err, ErrUnauthorised))
+	})
+
+	t.Run("storeError", func(t *testing.T) {
+		tok, err := us.Token(&user)
+		require.NoError(t, err)
+
+		mr.SetError("test connection error")
+		defer mr.SetError("")
+
+		_, err = us.Validate(tok.AccessToken)
+		assert.Error(t, err)
+		assert.False(t, xerrors.Is(err, ErrUnauthorised))
+
+		_, err = us.Token(&user)
+		assert.Error(t, err)
+	})
+}
+
 func TestUserService_ByID(t *testing.T) {
 	tudb := &testUserDB{}
 	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
@@ -690,34 +1216,245 @@ func TestUserService_ByIDs(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, users, rusers)
 	})
-}
+}
+
+func TestUserService_Search(t *testing.T) {
+	tudb := &testUserDB{}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	var cases = []struct {
+		name   string
+		query  SearchQuery
+		outerr error
+		setup  func(*testing.T)
+	}{
+		{
+			"textTooLong",
+			SearchQuery{Q: strings.Repeat("a", 256)},
+			ValidationError{"q": ErrTooLong},
+			nil,
+		},
+		{
+			"sortInvalid",
+			SearchQuery{Sort: "password"},
+			ValidationError{"sort": ErrInvalid},
+			nil,
+		},
+		{
+			"sortDescInvalid",
+			SearchQuery{Sort: "-roleId"},
+			ValidationError{"sort": ErrInvalid},
+			nil,
+		},
+		{
+			"ok",
+			SearchQuery{Q: "  alice ", RoleID: 2, Sort: "-firstName"},
+			nil,
+			func(t *testing.T) {
+				tudb.search = func(q SearchQuery) ([]User, error) {
+					assert.Equal(t, SearchQuery{Q: "alice", RoleID: 2, Sort: "-firstName"}, q)
+					return []User{{ID: 10, Password: "hash"}}, nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			users, err := us.Search(cs.query)
+
+			if cs.outerr != nil {
+				assert.Error(t, err)
+				assert.True(t, xerrors.Is(err, cs.outerr), "errors must match, expected %v, got %v", cs.outerr, err)
+
+			} else {
+				assert.NoError(t, err)
+				for _, u := range users {
+					assert.Empty(t, u.Password, "must clear the passwords")
+				}
+			}
+
+			*tudb = testUserDB{}
+		})
+	}
+}
+
+func TestUserService_Delete(t *testing.T) {
+	tudb := &testUserDB{}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	t.Run("mustNotDeleteAdmin", func(t *testing.T) {
+		tudb.delete = nil
+
+		err := us.Delete(1)
+
+		assert.Error(t, err)
+		assert.True(t, xerrors.Is(err, ErrReadOnly))
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		var called bool
+		tudb.delete = func(id int64) error {
+			assert.Equal(t, int64(888), id)
+			called = true
+			return nil
+		}
+
+		err := us.Delete(888)
+
+		assert.NoError(t, err)
+		assert.True(t, called)
+	})
+}
+
+func TestUserService_DeleteWith(t *testing.T) {
+	tudb := &testUserDB{}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	tudb.byID = func(id int64) (User, error) {
+		if id == 404 {
+			return User{}, ErrNotFound
+		}
+		return User{ID: id}, nil
+	}
+
+	var cases = []struct {
+		name    string
+		id      int64
+		d       UserDeletion
+		outerr  error
+		outcall string
+	}{
+		{"admin", 1, UserDeletion{Ratings: RatingsAnonymise}, ErrReadOnly, ""},
+		{"restrict", 888, UserDeletion{}, nil, "delete"},
+		{"anonymise", 888, UserDeletion{Ratings: RatingsAnonymise}, nil, "deleteWith"},
+		{"reassign", 888, UserDeletion{Ratings: RatingsReassign, ReassignTo: 3}, nil, "deleteWith"},
+		{"reassignMissing", 888, UserDeletion{Ratings: RatingsReassign}, ValidationError{"reassignTo": ErrInvalid}, ""},
+		{"reassignSelf", 888, UserDeletion{Ratings: RatingsReassign, ReassignTo: 888}, ValidationError{"reassignTo": ErrInvalid}, ""},
+		{"reassignNotFound", 888, UserDeletion{Ratings: RatingsReassign, ReassignTo: 404}, ValidationError{"reassignTo": ErrRefNotFound}, ""},
+		{"badMode", 888, UserDeletion{Ratings: "cascade"}, ValidationError{"ratings": ErrInvalid}, ""},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var called string
+			tudb.delete = func(id int64) error {
+				called = "delete"
+				return nil
+			}
+			tudb.deleteW = func(id int64, d UserDeletion) error {
+				assert.Equal(t, cs.d, d)
+				called = "deleteWith"
+				return nil
+			}
+
+			err := us.DeleteWith(cs.id, cs.d)
+
+			assert.True(t, xerrors.Is(err, cs.outerr) || err == cs.outerr, "got %v", err)
+			assert.Equal(t, cs.outcall, called)
+		})
+	}
+}
+
+func TestUserService_AssignRole(t *testing.T) {
+	rdb := &testRoleDB{}
+	rs := NewRoleService(nil)
+	rs.(*roleService).RoleService.(*roleValidator).RoleDB = rdb
+	rdb.byID = func(id int64) (Role, error) {
+		if id == 404 {
+			return Role{}, ErrNotFound
+		}
+		return Role{ID: id}, nil
+	}
+
+	var r Rules
+	r.AddUser("email", func(u *User) error {
+		if u.RoleID == 7 && !strings.HasSuffix(u.Email, "@staff.com") {
+			return ErrInvalid
+		}
+		return nil
+	})
 
-func TestUserService_Delete(t *testing.T) {
 	tudb := &testUserDB{}
-	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us, err := newUserService(nil, rs, jwtKeys{secret: []byte(testJWTSecret)}, nil, nil, nil, &r, nil, false)
+	require.NoError(t, err)
 	us.(*userService).UserService.(*userValidator).UserDB = tudb
 
-	t.Run("mustNotDeleteAdmin", func(t *testing.T) {
-		tudb.delete = nil
+	tudb.search = func(q SearchQuery) ([]User, error) {
+		assert.False(t, *q.Roles)
 
-		err := us.Delete(1)
+		var users []User
+		for _, id := range q.IDs {
+			if id != 5 {
+				users = append(users, User{ID: id, Email: "user" + strconv.FormatInt(id, 10) + "@staff.com", RoleID: 2})
+			}
+		}
+		if len(users) > 2 {
+			users[2].Email = "guest@test.com"
+		}
+		return users, nil
+	}
 
-		assert.Error(t, err)
-		assert.True(t, xerrors.Is(err, ErrReadOnly))
-	})
+	var cases = []struct {
+		name     string
+		roleID   int64
+		ids      []int64
+		outIDs   []int64
+		outerr   error
+		outItems []RoleAssignment
+	}{
+		{"noIDs", 7, nil, nil, ValidationError{"userIds": ErrRequired}, nil},
+		{"badID", 7, []int64{3, 0}, nil, ValidationError{"userIds": ErrInvalid}, nil},
+		{"roleNotFound", 404, []int64{3}, nil, ErrNotFound, nil},
+		{"assign", 7, []int64{6, 3, 1, 5, 3}, []int64{3, 5}, nil, []RoleAssignment{
+			{UserID: 1, Status: AssignmentFailed, Error: "read_only"},
+			{UserID: 3, Status: AssignmentAssigned},
+			{UserID: 5, Status: AssignmentFailed, Error: "not_found"},
+			{UserID: 6, Status: AssignmentFailed, Error: "validation_error", Fields: map[string]string{"email": "invalid"}},
+		}},
+	}
 
-	t.Run("ok", func(t *testing.T) {
-		var called bool
-		tudb.delete = func(id int64) error {
-			assert.Equal(t, int64(888), id)
-			called = true
-			return nil
-		}
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			var assigned []int64
+			tudb.assign = func(roleID int64, ids ...int64) ([]RoleAssignment, error) {
+				assert.Equal(t, cs.roleID, roleID)
+				assigned = ids
+
+				var results []RoleAssignment
+				for _, id := range ids {
+					if id == 5 {
+						results = append(results, failedAssignment(id, ErrNotFound))
+					} else {
+						results = append(results, RoleAssignment{UserID: id, Status: AssignmentAssigned})
+					}
+				}
+				return results, nil
+			}
 
-		err := us.Delete(888)
+			items, err := us.AssignRole(cs.roleID, cs.ids...)
 
-		assert.NoError(t, err)
-		assert.True(t, called)
+			assert.Equal(t, cs.outerr, err)
+			assert.Equal(t, cs.outItems, items)
+			assert.Equal(t, cs.outIDs, assigned)
+		})
+	}
+
+	t.Run("tooMany", func(t *testing.T) {
+		ids := make([]int64, maxRoleAssignments+1)
+		for i := range ids {
+			ids[i] = int64(i + 1)
+		}
+
+		_, err := us.AssignRole(7, ids...)
+		assert.Equal(t, ValidationError{"userIds": ErrTooLong}, err)
 	})
 }
 
@@ -818,11 +1555,19 @@ func TestUserService_Create(t *testing.T) {
 		{
 			"settingsLength",
 			&User{RoleID: 2, Email: "a_test@address.com", FirstName: "shortname",
-				Password: "testpassword", Settings: `{"setting1": "` + strings.Repeat("a", 8192) + `"}`},
+				Password: "testpassword", Settings: json.RawMessage(`{"setting1": "` + strings.Repeat("a", 8192) + `"}`)},
 			nil,
 			ValidationError{"settings": ErrTooLong},
 			nil,
 		},
+		{
+			"settingsNotObject",
+			&User{RoleID: 2, Email: "a_test@address.com", FirstName: "shortname",
+				Password: "testpassword", Settings: json.RawMessage(`"a string of preferences"`)},
+			nil,
+			ValidationError{"settings": ErrInvalid},
+			nil,
+		},
 		{
 			"passwordRequired",
 			&User{RoleID: 2, Email: "a_test@address.com", FirstName: "shortname", Password: ""},
@@ -883,6 +1628,15 @@ func TestUserService_Create(t *testing.T) {
 	}
 }
 
+// testAdminUser returns the default admin user as stored.
+func testAdminUser(id int64) (User, error) {
+	if id != adminID {
+		return User{}, ErrNotFound
+	}
+
+	return User{ID: adminID, Active: true, Email: "admin@admin.com", FirstName: "admin", Password: "StoredPasswordHash", RoleID: 1, Version: 2}, nil
+}
+
 func TestUserService_Update(t *testing.T) {
 	rdb := &testRoleDB{}
 	rs := NewRoleService(nil)
@@ -925,10 +1679,36 @@ func TestUserService_Update(t *testing.T) {
 		},
 		{
 			"idIsAdmin",
-			&User{ID: 1, Email: "test@address.com", FirstName: "Test", Password: "testpassword"},
+			&User{ID: 1, Active: true, Email: "admin@admin.com", FirstName: "Test", Password: "testpassword", RoleID: 1},
+			nil,
+			ErrReadOnly,
+			func(t *testing.T) {
+				tudb.byID = testAdminUser
+			},
+		},
+		{
+			"adminWithoutPassword",
+			&User{ID: 1, Active: true, Email: "admin@admin.com", FirstName: "admin", RoleID: 1},
 			nil,
 			ErrReadOnly,
+			func(t *testing.T) {
+				tudb.byID = testAdminUser
+			},
+		},
+		{
+			"adminPasswordChanged",
+			&User{ID: 1, Active: true, Email: "Admin@Admin.com", FirstName: "admin", Password: "a new password", RoleID: 1},
+			&User{ID: 1, Active: true, Email: "admin@admin.com", FirstName: "admin", RoleID: 1},
 			nil,
+			func(t *testing.T) {
+				tudb.byID = testAdminUser
+				tudb.update = func(u *User) error {
+					updated = true
+
+					assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("a new password")))
+					return nil
+				}
+			},
 		},
 		{
 			"emailRequired",
@@ -1004,7 +1784,7 @@ func TestUserService_Update(t *testing.T) {
 		{
 			"settingsLength",
 			&User{RoleID: 2, Email: "a_test@address.com", FirstName: "shortname",
-				Password: "testpassword", Settings: `{"setting1": "` + strings.Repeat("a", 8192) + `"}`},
+				Password: "testpassword", Settings: json.RawMessage(`{"setting1": "` + strings.Repeat("a", 8192) + `"}`)},
 			nil,
 			ValidationError{"settings": ErrTooLong},
 			nil,
@@ -1123,6 +1903,179 @@ func TestUserService_Update(t *testing.T) {
 	}
 }
 
+func TestUserService_UpdatePartial(t *testing.T) {
+	tudb := &testUserDB{}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	stored := func(id int64) (User, error) {
+		return User{
+			ID:        99,
+			Active:    true,
+			Email:     "test@address.com",
+			FirstName: "",
+			LastName:  "User",
+			Password:  "StoredPasswordHash",
+			RoleID:    2,
+			Settings:  json.RawMessage(`{"theme":"dark"}`),
+			Version:   5,
+		}, nil
+	}
+
+	var cases = []struct {
+		name    string
+		user    *User
+		patch   string
+		outuser *User
+		outerr  error
+		setup   func(*testing.T)
+	}{
+		{
+			"idIsAdmin",
+			&User{ID: 1},
+			`{"lastName":"Dear"}`,
+			nil,
+			ErrReadOnly,
+			func(t *testing.T) {
+				tudb.byID = testAdminUser
+			},
+		},
+		{
+			"adminPasswordAndOtherFields",
+			&User{ID: 1},
+			`{"password":"a new password","roleId":2}`,
+			nil,
+			ErrReadOnly,
+			func(t *testing.T) {
+				tudb.byID = testAdminUser
+			},
+		},
+		{
+			"adminPasswordChanged",
+			&User{ID: 1},
+			`{"password":"a new password"}`,
+			&User{ID: 1, Active: true, Email: "admin@admin.com", FirstName: "admin", RoleID: 1, Version: 2},
+			nil,
+			func(t *testing.T) {
+				tudb.byID = testAdminUser
+				tudb.update = func(u *User) error {
+					assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("a new password")))
+					return nil
+				}
+			},
+		},
+		{
+			"notObject",
+			&User{ID: 99},
+			`["lastName"]`,
+			nil,
+			ErrInvalid,
+			nil,
+		},
+		{
+			"cannotFind",
+			&User{ID: 99},
+			`{"lastName":"Dear"}`,
+			nil,
+			ErrNotFound,
+			func(t *testing.T) {
+				tudb.byID = func(id int64) (User, error) {
+					assert.Equal(t, int64(99), id)
+					return User{}, ErrNotFound
+				}
+			},
+		},
+		{
+			"emailInvalid",
+			&User{ID: 99},
+			`{"email":"  testEmailBad!!##BADEMAIL   "}`,
+			nil,
+			ValidationError{"email": ErrInvalid},
+			func(t *testing.T) {
+				tudb.byID = stored
+			},
+		},
+		{
+			"onlyPatchedFieldsValidated",
+			&User{ID: 99},
+			`{"lastName":"Dear"}`,
+			&User{ID: 99, Active: true, Email: "test@address.com", LastName: "Dear", RoleID: 2, Settings: json.RawMessage(`{"theme":"dark"}`), Version: 6},
+			nil,
+			func(t *testing.T) {
+				tudb.byID = stored
+				tudb.update = func(u *User) error {
+					assert.Equal(t, &User{
+						ID:       99,
+						Active:   true,
+						Email:    "test@address.com",
+						LastName: "Dear",
+						Password: "StoredPasswordHash",
+						RoleID:   2,
+						Settings: json.RawMessage(`{"theme":"dark"}`),
+						Version:  5,
+					}, u, "must keep the stored values and version")
+
+					u.Version = 6
+					return nil
+				}
+			},
+		},
+		{
+			"nullResetsField",
+			&User{ID: 99, Version: 3},
+			`{"settings":null,"active":false}`,
+			&User{ID: 99, Email: "test@address.com", LastName: "User", RoleID: 2, Version: 4},
+			nil,
+			func(t *testing.T) {
+				tudb.byID = stored
+				tudb.update = func(u *User) error {
+					assert.Empty(t, u.Settings)
+					assert.False(t, u.Active)
+					assert.Equal(t, int64(3), u.Version, "must keep the version provided")
+
+					u.Version = 4
+					return nil
+				}
+			},
+		},
+		{
+			"passwordChanged",
+			&User{ID: 99},
+			`{"password":"a new password"}`,
+			&User{ID: 99, Active: true, Email: "test@address.com", LastName: "User", RoleID: 2, Settings: json.RawMessage(`{"theme":"dark"}`), Version: 5},
+			nil,
+			func(t *testing.T) {
+				tudb.byID = stored
+				tudb.update = func(u *User) error {
+					assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(u.Password), []byte("a new password")))
+					return nil
+				}
+			},
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			if cs.setup != nil {
+				cs.setup(t)
+			}
+
+			err := us.UpdatePartial(cs.user, []byte(cs.patch))
+
+			if cs.outerr != nil {
+				assert.Error(t, err)
+				assert.True(t, xerrors.Is(err, cs.outerr), "errors must match, expected %v, got %v", cs.outerr, err)
+
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cs.outuser, cs.user)
+			}
+
+			*tudb = testUserDB{}
+		})
+	}
+}
+
 func TestUserGORM_Create(t *testing.T) {
 	t.Run("idExists", func(t *testing.T) {
 		db := setupGorm(t)
@@ -1134,12 +2087,12 @@ func TestUserGORM_Create(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
 		require.NoError(t, db.Create(user).Error)
 
-		err := (&userGorm{db}).Create(user)
+		err := (&userGorm{db: db}).Create(user)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ValidationError{"id": ErrIDTaken}))
@@ -1154,13 +2107,13 @@ func TestUserGORM_Create(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
 		require.NoError(t, db.Create(user).Error)
 
 		user.ID = 0
-		err := (&userGorm{db}).Create(user)
+		err := (&userGorm{db: db}).Create(user)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ValidationError{"email": ErrDuplicate}))
@@ -1175,10 +2128,10 @@ func TestUserGORM_Create(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
-		err := (&userGorm{db}).Create(user)
+		err := (&userGorm{db: db}).Create(user)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ValidationError{"roleId": ErrRefNotFound}))
@@ -1193,10 +2146,10 @@ func TestUserGORM_Create(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
-		err := (&userGorm{db}).Create(user)
+		err := (&userGorm{db: db}).Create(user)
 
 		assert.NoError(t, err)
 		assert.NotEqual(t, 0, user.ID)
@@ -1218,10 +2171,10 @@ func TestUserGORM_Update(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
-		err := (&userGorm{db}).Update(user)
+		err := (&userGorm{db: db}).Update(user)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ErrNotFound))
@@ -1237,12 +2190,12 @@ func TestUserGORM_Update(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
 		require.NoError(t, db.Create(user).Error)
 
-		err := (&userGorm{db}).Update(user)
+		err := (&userGorm{db: db}).Update(user)
 		assert.NoError(t, err)
 
 		var cuser User
@@ -1261,7 +2214,7 @@ func TestUserGORM_Update(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
 		require.NoError(t, db.Create(user).Error)
@@ -1269,9 +2222,9 @@ func TestUserGORM_Update(t *testing.T) {
 		user.FirstName = ""
 		user.LastName = ""
 		user.Password = ""
-		user.Settings = ""
+		user.Settings = json.RawMessage(`{}`)
 
-		err := (&userGorm{db}).Update(user)
+		err := (&userGorm{db: db}).Update(user)
 		assert.NoError(t, err)
 
 		var cuser User
@@ -1290,7 +2243,7 @@ func TestUserGORM_Update(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
 		require.NoError(t, db.Create(user).Error)
@@ -1299,7 +2252,7 @@ func TestUserGORM_Update(t *testing.T) {
 		require.NoError(t, db.Create(user).Error)
 
 		user.Email = "test@test.com"
-		err := (&userGorm{db}).Update(user)
+		err := (&userGorm{db: db}).Update(user)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ValidationError{"email": ErrDuplicate}))
@@ -1315,13 +2268,13 @@ func TestUserGORM_Update(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
 		require.NoError(t, db.Create(user).Error)
 
 		user.RoleID = 88
-		err := (&userGorm{db}).Update(user)
+		err := (&userGorm{db: db}).Update(user)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ValidationError{"roleId": ErrRefNotFound}))
@@ -1337,7 +2290,7 @@ func TestUserGORM_Update(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 
 		require.NoError(t, db.Create(user).Error)
@@ -1348,15 +2301,40 @@ func TestUserGORM_Update(t *testing.T) {
 		user.FirstName = "Another"
 		user.LastName = ""
 		user.Password = "Different Hash"
-		user.Settings = "Changed settings"
+		user.Settings = json.RawMessage(`{"theme": "light"}`)
 
-		err := (&userGorm{db}).Update(user)
+		err := (&userGorm{db: db}).Update(user)
 
 		assert.NoError(t, err)
 
 		var cuser User
 		require.NoError(t, db.First(&cuser, 10).Error)
 		assert.Equal(t, user, &cuser)
+		assert.Equal(t, int64(2), cuser.Version, "must increment the version")
+	})
+
+	t.Run("staleVersion", func(t *testing.T) {
+		db := setupGorm(t)
+		user := &User{
+			ID:        10,
+			Active:    true,
+			RoleID:    2,
+			Email:     "test@test.com",
+			FirstName: "Test",
+			LastName:  "User",
+			Password:  "TestPasswordHAsh",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
+		}
+
+		require.NoError(t, db.Create(user).Error)
+		require.NoError(t, db.Model(user).Update("version", 3).Error)
+
+		user.Version = 1
+		user.FirstName = "Another"
+		err := (&userGorm{db: db}).Update(user)
+
+		assert.Error(t, err)
+		assert.True(t, xerrors.Is(err, ErrConflict))
 	})
 }
 
@@ -1364,7 +2342,7 @@ func TestUserGORM_Delete(t *testing.T) {
 	t.Run("notFound", func(t *testing.T) {
 		db := setupGorm(t)
 
-		err := (&userGorm{db}).Delete(999)
+		err := (&userGorm{db: db}).Delete(999)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ErrNotFound))
@@ -1374,7 +2352,7 @@ func TestUserGORM_Delete(t *testing.T) {
 		db := setupGorm(t)
 		dropUsersTable(db)
 
-		err := (&userGorm{db}).Delete(999)
+		err := (&userGorm{db: db}).Delete(999)
 
 		assert.Error(t, err)
 	})
@@ -1389,7 +2367,7 @@ func TestUserGORM_Delete(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 		role := &Role{
 			ID:          99,
@@ -1400,18 +2378,139 @@ func TestUserGORM_Delete(t *testing.T) {
 		require.NoError(t, db.Create(role).Error)
 		require.NoError(t, db.Create(user).Error)
 
-		err := (&userGorm{db}).Delete(999)
+		err := (&userGorm{db: db}).Delete(999)
 		user.Role = role
 
 		assert.NoError(t, err)
 	})
 }
 
+func TestUserGORM_DeleteWith(t *testing.T) {
+	setup := func(t *testing.T) *gorm.DB {
+		db := setupGorm(t)
+		for _, u := range []User{
+			{ID: 97, RoleID: 2, Email: "first@test.com", FirstName: "First", Password: "TestPasswordHAsh", Active: true},
+			{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh", Active: true},
+		} {
+			require.NoError(t, db.Create(&u).Error)
+		}
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 7, UserID: 97}).Error)
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 2, Target: 9, UserID: 97}).Error)
+		require.NoError(t, db.Exec(`INSERT INTO rating_revisions (rating_id, active, anonymous, comment, date, extra, score, target, user_id, revised_at)
+			SELECT id, active, false, 'first comment', date, extra, score, target, user_id, date FROM ratings`).Error)
+		return db
+	}
+
+	countRevisions := func(t *testing.T, db *gorm.DB, where string, args ...interface{}) int {
+		var n int
+		require.NoError(t, db.Model(&RatingRevision{}).Where(where, args...).Count(&n).Error)
+		return n
+	}
+
+	countRatings := func(t *testing.T, db *gorm.DB, where string, args ...interface{}) int {
+		var n int
+		require.NoError(t, db.Model(&Rating{}).Where(where, args...).Count(&n).Error)
+		return n
+	}
+
+	t.Run("restrict", func(t *testing.T) {
+		db := setup(t)
+
+		err := (&userGorm{db: db}).DeleteWith(97, UserDeletion{Ratings: RatingsRestrict})
+		assert.True(t, xerrors.Is(err, ErrInUse))
+		assert.True(t, xerrors.Is((&userGorm{db: db}).Delete(97), ErrInUse))
+	})
+
+	t.Run("anonymise", func(t *testing.T) {
+		db := setup(t)
+
+		require.NoError(t, (&userGorm{db: db}).DeleteWith(97, UserDeletion{Ratings: RatingsAnonymise}))
+
+		u, err := (&userGorm{db: db}).ByID(97)
+		require.NoError(t, err)
+		assert.False(t, u.Active)
+		assert.Equal(t, "deleted-97@users.invalid", u.Email)
+		assert.Equal(t, deletedUserFirstName, u.FirstName)
+		assert.Empty(t, u.Password)
+		assert.Equal(t, 2, countRatings(t, db, "user_id = ? AND anonymous", 97))
+		assert.Equal(t, 2, countRevisions(t, db, "user_id = ? AND anonymous", 97), "must anonymise the revisions")
+
+		err = (&userGorm{db: db}).DeleteWith(404, UserDeletion{Ratings: RatingsAnonymise})
+		assert.True(t, xerrors.Is(err, ErrNotFound))
+	})
+
+	t.Run("reassign", func(t *testing.T) {
+		db := setup(t)
+
+		require.NoError(t, (&userGorm{db: db}).DeleteWith(97, UserDeletion{Ratings: RatingsReassign, ReassignTo: 98}))
+
+		_, err := (&userGorm{db: db}).ByID(97)
+		assert.True(t, xerrors.Is(err, ErrNotFound))
+		assert.Equal(t, 2, countRatings(t, db, "user_id = ?", 98))
+		assert.Equal(t, 2, countRevisions(t, db, "user_id = ?", 98), "must reassign the revisions")
+	})
+
+	t.Run("reassignDuplicate", func(t *testing.T) {
+		db := setup(t)
+		require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 98}).Error)
+
+		err := (&userGorm{db: db}).DeleteWith(97, UserDeletion{Ratings: RatingsReassign, ReassignTo: 98})
+		assert.Equal(t, ValidationError{"reassignTo": ErrDuplicate}, err)
+		assert.Equal(t, 2, countRatings(t, db, "user_id = ?", 97), "must roll back the ratings reassigned")
+		assert.Equal(t, 2, countRevisions(t, db, "user_id = ?", 97), "must roll back the revisions reassigned")
+	})
+}
+
+func TestUserGORM_SetActive(t *testing.T) {
+	db := setupGorm(t)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh", Active: true}).Error)
+
+	require.NoError(t, (&userGorm{db: db}).SetActive(98, false))
+	u, err := (&userGorm{db: db}).ByID(98)
+	require.NoError(t, err)
+	assert.False(t, u.Active)
+	assert.Equal(t, int64(2), u.Version)
+
+	require.NoError(t, (&userGorm{db: db}).SetActive(98, true))
+	u, err = (&userGorm{db: db}).ByID(98)
+	require.NoError(t, err)
+	assert.True(t, u.Active)
+
+	assert.True(t, xerrors.Is((&userGorm{db: db}).SetActive(404, false), ErrNotFound))
+}
+
+func TestUserGORM_AssignRole(t *testing.T) {
+	db := setupGorm(t)
+	require.NoError(t, db.Create(&Role{ID: 7, Label: "editor"}).Error)
+	require.NoError(t, db.Create(&User{ID: 97, RoleID: 7, Email: "first@test.com", FirstName: "First", Password: "TestPasswordHAsh", Active: true}).Error)
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh", Active: true}).Error)
+
+	results, err := (&userGorm{db: db}).AssignRole(7, 97, 98, 404)
+	require.NoError(t, err)
+	assert.Equal(t, []RoleAssignment{
+		{UserID: 97, Status: AssignmentUnchanged},
+		{UserID: 98, Status: AssignmentAssigned},
+		{UserID: 404, Status: AssignmentFailed, Error: "not_found"},
+	}, results)
+
+	u, err := (&userGorm{db: db}).ByID(98)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), u.RoleID)
+	assert.Equal(t, int64(2), u.Version)
+
+	_, err = (&userGorm{db: db}).AssignRole(404, 97, 98)
+	assert.Equal(t, ErrNotFound, err)
+
+	u, err = (&userGorm{db: db}).ByID(97)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), u.Version, "must not change the users unchanged")
+}
+
 func TestUserGORM_ByEmail(t *testing.T) {
 	t.Run("notFound", func(t *testing.T) {
 		db := setupGorm(t)
 
-		_, err := (&userGorm{db}).ByEmail("atestaddress")
+		_, err := (&userGorm{db: db}).ByEmail("atestaddress")
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ErrNotFound))
@@ -1421,7 +2520,7 @@ func TestUserGORM_ByEmail(t *testing.T) {
 		db := setupGorm(t)
 		dropUsersTable(db)
 
-		_, err := (&userGorm{db}).ByEmail("atestaddress")
+		_, err := (&userGorm{db: db}).ByEmail("atestaddress")
 
 		assert.Error(t, err)
 	})
@@ -1435,7 +2534,7 @@ func TestUserGORM_ByEmail(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 		role := &Role{
 			ID:          99,
@@ -1446,7 +2545,7 @@ func TestUserGORM_ByEmail(t *testing.T) {
 		require.NoError(t, db.Create(role).Error)
 		require.NoError(t, db.Create(user).Error)
 
-		outuser, err := (&userGorm{db}).ByEmail("test@test.com")
+		outuser, err := (&userGorm{db: db}).ByEmail("test@test.com")
 		user.Role = role
 
 		assert.NoError(t, err)
@@ -1459,7 +2558,7 @@ func TestUserGORM_ByID(t *testing.T) {
 	t.Run("notFound", func(t *testing.T) {
 		db := setupGorm(t)
 
-		_, err := (&userGorm{db}).ByID(999)
+		_, err := (&userGorm{db: db}).ByID(999)
 
 		assert.Error(t, err)
 		assert.True(t, xerrors.Is(err, ErrNotFound))
@@ -1469,7 +2568,7 @@ func TestUserGORM_ByID(t *testing.T) {
 		db := setupGorm(t)
 		dropUsersTable(db)
 
-		_, err := (&userGorm{db}).ByID(999)
+		_, err := (&userGorm{db: db}).ByID(999)
 
 		assert.Error(t, err)
 	})
@@ -1484,7 +2583,7 @@ func TestUserGORM_ByID(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 		role := &Role{
 			ID:          99,
@@ -1495,7 +2594,7 @@ func TestUserGORM_ByID(t *testing.T) {
 		require.NoError(t, db.Create(role).Error)
 		require.NoError(t, db.Create(user).Error)
 
-		outuser, err := (&userGorm{db}).ByID(999)
+		outuser, err := (&userGorm{db: db}).ByID(999)
 		user.Role = role
 
 		assert.NoError(t, err)
@@ -1508,7 +2607,7 @@ func TestUserGORM_ByIDs(t *testing.T) {
 	t.Run("notFound", func(t *testing.T) {
 		db := setupGorm(t)
 
-		users, err := (&userGorm{db}).ByIDs(999)
+		users, err := (&userGorm{db: db}).ByIDs(999)
 
 		assert.NoError(t, err)
 		assert.Empty(t, users)
@@ -1518,7 +2617,7 @@ func TestUserGORM_ByIDs(t *testing.T) {
 		db := setupGorm(t)
 		dropUsersTable(db)
 
-		_, err := (&userGorm{db}).ByIDs(999)
+		_, err := (&userGorm{db: db}).ByIDs(999)
 
 		assert.Error(t, err)
 	})
@@ -1533,7 +2632,7 @@ func TestUserGORM_ByIDs(t *testing.T) {
 			FirstName: "Test",
 			LastName:  "User",
 			Password:  "TestPasswordHAsh",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 		user2 := User{
 			ID:        1002,
@@ -1543,7 +2642,7 @@ func TestUserGORM_ByIDs(t *testing.T) {
 			FirstName: "Second",
 			LastName:  "User",
 			Password:  "TestPasswordHAshOther",
-			Settings:  "Settings string here",
+			Settings:  json.RawMessage(`{"theme": "dark"}`),
 		}
 		role := Role{
 			ID:          99,
@@ -1555,8 +2654,21 @@ func TestUserGORM_ByIDs(t *testing.T) {
 		require.NoError(t, db.Create(&user1).Error)
 		require.NoError(t, db.Create(&user2).Error)
 
+		t.Run("omitRoles", func(t *testing.T) {
+			outusers, err := (&userGorm{db: db, omitRoles: true}).ByIDs(1002, 999)
+
+			assert.NoError(t, err)
+			assert.Len(t, outusers, 2)
+			assert.Contains(t, outusers, user1)
+			assert.Contains(t, outusers, user2)
+		})
+
+		// the roles are preloaded by default
+		user1.Role = &role
+		user2.Role = &role
+
 		t.Run("listAll", func(t *testing.T) {
-			outusers, err := (&userGorm{db}).ByIDs()
+			outusers, err := (&userGorm{db: db}).ByIDs()
 
 			assert.NoError(t, err)
 			assert.Len(t, outusers, 3)
@@ -1565,7 +2677,7 @@ func TestUserGORM_ByIDs(t *testing.T) {
 		})
 
 		t.Run("listOne", func(t *testing.T) {
-			outusers, err := (&userGorm{db}).ByIDs(999)
+			outusers, err := (&userGorm{db: db}).ByIDs(999)
 
 			assert.NoError(t, err)
 			assert.Len(t, outusers, 1)
@@ -1573,7 +2685,7 @@ func TestUserGORM_ByIDs(t *testing.T) {
 		})
 
 		t.Run("listOther", func(t *testing.T) {
-			outusers, err := (&userGorm{db}).ByIDs(1002)
+			outusers, err := (&userGorm{db: db}).ByIDs(1002)
 
 			assert.NoError(t, err)
 			assert.Len(t, outusers, 1)
@@ -1581,7 +2693,7 @@ func TestUserGORM_ByIDs(t *testing.T) {
 		})
 
 		t.Run("listSome", func(t *testing.T) {
-			outusers, err := (&userGorm{db}).ByIDs(1002, 999)
+			outusers, err := (&userGorm{db: db}).ByIDs(1002, 999)
 
 			assert.NoError(t, err)
 			assert.Len(t, outusers, 2)
@@ -1590,3 +2702,59 @@ func TestUserGORM_ByIDs(t *testing.T) {
 		})
 	})
 }
+
+func TestUserGORM_Search(t *testing.T) {
+	t.Run("otherErrors", func(t *testing.T) {
+		db := setupGorm(t)
+		dropUsersTable(db)
+
+		_, err := (&userGorm{db: db}).Search(SearchQuery{})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		db := setupGorm(t)
+		alice := User{ID: 10, RoleID: 2, Active: true, Email: "alice@test.com", FirstName: "Alice", LastName: "Smith", Password: "hash"}
+		bob := User{ID: 11, RoleID: 2, Active: false, Email: "bob@test.com", FirstName: "Bob", LastName: "Alison", Password: "hash"}
+		carol := User{ID: 12, RoleID: 1, Active: true, Email: "carol_100%@test.com", FirstName: "Carol", LastName: "Jones", Password: "hash"}
+
+		require.NoError(t, db.Create(&alice).Error)
+		require.NoError(t, db.Create(&bob).Error)
+		require.NoError(t, db.Create(&carol).Error)
+
+		ids := func(users []User) []int64 {
+			var ret []int64
+			for _, u := range users {
+				ret = append(ret, u.ID)
+			}
+			return ret
+		}
+
+		var cases = []struct {
+			name  string
+			query SearchQuery
+			out   []int64
+		}{
+			{"all", SearchQuery{}, []int64{1, 10, 11, 12}},
+			{"textInAnyField", SearchQuery{Q: "ALI"}, []int64{10, 11}},
+			{"textIsLiteral", SearchQuery{Q: "_100%"}, []int64{12}},
+			{"wildcardNotExpanded", SearchQuery{Q: "a%e"}, nil},
+			{"active", SearchQuery{Q: "ali", Active: func(b bool) *bool { return &b }(true)}, []int64{10}},
+			{"inactive", SearchQuery{Active: func(b bool) *bool { return &b }(false)}, []int64{11}},
+			{"role", SearchQuery{RoleID: 2}, []int64{10, 11}},
+			{"ids", SearchQuery{IDs: []int64{11, 12}, RoleID: 2}, []int64{11}},
+			{"sortAsc", SearchQuery{RoleID: 2, Sort: "lastName"}, []int64{11, 10}},
+			{"sortDesc", SearchQuery{Sort: "-email"}, []int64{12, 11, 10, 1}},
+		}
+
+		for _, cs := range cases {
+			t.Run(cs.name, func(t *testing.T) {
+				users, err := (&userGorm{db: db}).Search(cs.query)
+
+				assert.NoError(t, err)
+				assert.Equal(t, cs.out, ids(users))
+			})
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strconv"
+)
+
+// DefaultVerifiedWeight is the weight of the scores of the verified ratings in
+// RatingStats.VerifiedWeightedAverage if Config.VerifiedWeight is not set.
+const DefaultVerifiedWeight = 2
+
+// A TransactionVerifier tells whether the users completed a transaction with the
+// targets, like an order delivered by a restaurant, so their ratings are
+// verified. See Config.TransactionVerifier.
+type TransactionVerifier interface {
+	// Completed tells whether the user with ID userID completed a
+	// transaction with target.
+	Completed(userID, target int64) (bool, error)
+}
+
+// TransactionVerifierFunc adapts a function to a TransactionVerifier.
+type TransactionVerifierFunc func(userID, target int64) (bool, error)
+
+// Completed calls f(userID, target).
+func (f TransactionVerifierFunc) Completed(userID, target int64) (bool, error) {
+	return f(userID, target)
+}
+
+// verification tells which ratings are verified, and the weight of their scores
+// in the stats.
+type verification struct {
+	// verifier checks the transactions of the users, and may be nil, in
+	// which case no rating is verified.
+	verifier TransactionVerifier
+
+	// weight is the weight of the scores of the verified ratings,
+	// DefaultVerifiedWeight if not positive.
+	weight float64
+}
+
+// verifiedWeightSQL returns the weight of the score of a rating in the
+// aggregates weighted by verification, where the scores of the verified ratings
+// weigh weight, or DefaultVerifiedWeight if it is not positive, and the others
+// 1. It must be used in queries on the ratings table.
+func verifiedWeightSQL(weight float64) string {
+	if weight <= 0 {
+		weight = DefaultVerifiedWeight
+	}
+
+	return "CASE WHEN ratings.verified THEN " + strconv.FormatFloat(weight, 'f', -1, 64) + " ELSE 1 END"
+}
+
+// setVerified sets whether the rating is verified, asking the verifier whether
+// its user completed a transaction with its target. The ratings already
+// verified stay verified. This method is dependent on the user and the target
+// being set.
+func (rc *ratingValWithDBData) setVerified() (string, ratingValFn) {
+	return "", func(r *Rating) error {
+		r.Verified = rc.dbRating.Verified
+		if r.Verified || rc.rv.verifier == nil {
+			return nil
+		}
+
+		var err error
+		r.Verified, err = rc.rv.verifier.Completed(r.UserID, r.Target)
+		if err != nil {
+			return with(wrap("could not verify the transactions of the user", err), "user_id", r.UserID)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifiedWeightSQL(t *testing.T) {
+	assert.Equal(t, "CASE WHEN ratings.verified THEN 2 ELSE 1 END", verifiedWeightSQL(0))
+	assert.Equal(t, "CASE WHEN ratings.verified THEN 1.5 ELSE 1 END", verifiedWeightSQL(1.5))
+}
+
+func TestRatingService_Verified(t *testing.T) {
+	tudb := &testUserDB{
+		byID: func(id int64) (User, error) {
+			return User{ID: id, Active: true, RoleID: 2}, nil
+		},
+	}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	var stored Rating
+	trdb := &testRatingDB{
+		byID: func(id int64) (Rating, error) {
+			return Rating{ID: id, Target: 9, UserID: 1, Score: 4, Verified: id == 4, Extra: json.RawMessage(`{}`)}, nil
+		},
+		create: func(r *Rating) error {
+			stored = *r
+			return nil
+		},
+		update: func(r *Rating) error {
+			stored = *r
+			return nil
+		},
+	}
+
+	var asked []int64
+	completed := map[int64]bool{9: true}
+	verifier := TransactionVerifierFunc(func(userID, target int64) (bool, error) {
+		asked = append(asked, userID, target)
+		if target == 13 {
+			return false, wrap("verifier unavailable", nil)
+		}
+		return completed[target], nil
+	})
+
+	rs := newRatingService(nil, us, nil, nil, probation{}, nil, nil, nil, nil, verification{verifier: verifier})
+	rs.RatingService.(*ratingValidator).RatingDB = trdb
+
+	t.Run("completed", func(t *testing.T) {
+		asked = nil
+		r := Rating{Target: 9, Score: 5, User: &User{ID: 1}}
+		require.NoError(t, rs.Create(&r))
+		assert.True(t, stored.Verified)
+		assert.Equal(t, []int64{1, 9}, asked)
+	})
+
+	t.Run("notCompleted", func(t *testing.T) {
+		r := Rating{Target: 8, Score: 5, Verified: true, User: &User{ID: 1}}
+		require.NoError(t, rs.Create(&r))
+		assert.False(t, stored.Verified, "the input value must be ignored")
+	})
+
+	t.Run("verifierFails", func(t *testing.T) {
+		r := Rating{Target: 13, Score: 5, User: &User{ID: 1}}
+		err := rs.Create(&r)
+		require.Error(t, err)
+		_, ok := err.(ValidationError)
+		assert.False(t, ok, "must not be reported as a validation error")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		asked = nil
+		r := Rating{ID: 3, Score: 2, User: &User{ID: 1}}
+		require.NoError(t, rs.Update(&r))
+		assert.True(t, stored.Verified, "the stored target must be verified")
+		assert.Equal(t, []int64{1, 9}, asked)
+	})
+
+	t.Run("staysVerified", func(t *testing.T) {
+		asked = nil
+		completed[9] = false
+		defer func() { completed[9] = true }()
+
+		r := Rating{ID: 4, User: &User{ID: 1}}
+		require.NoError(t, rs.UpdatePartial(&r, []byte(`{"score": 3, "verified": false}`)))
+		assert.True(t, stored.Verified)
+		assert.Empty(t, asked, "the verified ratings must not be verified again")
+	})
+
+	t.Run("noVerifier", func(t *testing.T) {
+		rs := NewRatingService(nil, us)
+		rs.(*ratingService).RatingService.(*ratingValidator).RatingDB = trdb
+
+		r := Rating{Target: 9, Score: 5, Verified: true, User: &User{ID: 1}}
+		require.NoError(t, rs.Create(&r))
+		assert.False(t, stored.Verified)
+	})
+}
+
+func TestRatingGorm_VerifiedWeightedAverage(t *testing.T) {
+	db := setupGorm(t)
+	rg := &ratingGorm{db: db, verifiedWeight: 3}
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh"}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1, Verified: true}).Error)
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 1, Target: 9, UserID: 98}).Error)
+
+	stats, err := rg.StatsByTarget(9)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), stats.Average)
+	assert.Equal(t, float64(4), stats.VerifiedWeightedAverage, "(5*3 + 1) / 4")
+
+	stats, err = rg.DetailedStatsByTarget(9, StatsFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, float64(4), stats.VerifiedWeightedAverage)
+
+	stats, err = rg.StatsByTarget(10)
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), stats.VerifiedWeightedAverage)
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A VisibilityRule grants the users of a role access to a subset of the
+// ratings. Roles without rules can read every rating, while the users of a role
+// with rules can only read the ratings matched by at least one of them. Rules
+// only restrict reads: they are applied by RatingService.Scoped and to the
+// ratings returned by SyncService.
+//
+// Each rule defines exactly one of Targets, TargetTags or SQL.
+type VisibilityRule struct {
+	// RoleID is the ID of the role restricted by the rule. The admin role
+	// cannot be restricted.
+	RoleID int64 `json:"roleId"`
+
+	// Description explains the purpose of the rule.
+	Description string `json:"description,omitempty"`
+
+	// Targets matches the ratings of these targets.
+	Targets []int64 `json:"targets,omitempty"`
+
+	// TargetTags matches the ratings of the targets tagged with any of
+	// these tags. See RatingService.SetTags.
+	TargetTags []string `json:"targetTags,omitempty"`
+
+	// SQL is a boolean expression on the columns of the ratings table, like
+	// "NOT anonymous". It is trusted as it is part of the configuration.
+	SQL string `json:"sql,omitempty"`
+}
+
+// A TargetTag attaches a tag to a target, which allows granting access to the
+// ratings of a group of targets with VisibilityRule.TargetTags.
+type TargetTag struct {
+	Target int64  `gorm:"primary_key;type:bigint" json:"target"`
+	Tag    string `gorm:"primary_key;size:64" json:"tag"`
+}
+
+// ParseVisibilityRules decodes the visibility rules defined in b, a JSON array
+// of VisibilityRule values. The rules are checked to be usable by the services.
+func ParseVisibilityRules(b []byte) ([]VisibilityRule, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+
+	var rules []VisibilityRule
+	err := d.Decode(&rules)
+	if err != nil {
+		return nil, wrap("could not decode visibility rules", err)
+	}
+
+	for i := range rules {
+		err = rules[i].check()
+		if err != nil {
+			return nil, wrap("invalid visibility rule "+strconv.Itoa(i), err)
+		}
+	}
+
+	return rules, nil
+}
+
+// check verifies the definition of r and normalises its tags.
+func (r *VisibilityRule) check() error {
+	if r.RoleID < 1 {
+		return wrap("roleId is required", nil)
+	}
+	if r.RoleID == AdminRoleID {
+		return wrap("the admin role cannot be restricted", nil)
+	}
+
+	var criteria int
+	if len(r.Targets) > 0 {
+		criteria++
+	}
+	if len(r.TargetTags) > 0 {
+		criteria++
+	}
+	if r.SQL != "" {
+		criteria++
+	}
+	if criteria != 1 {
+		return wrap("exactly one of targets, targetTags or sql must be defined", nil)
+	}
+
+	for i, t := range r.TargetTags {
+		r.TargetTags[i] = normaliseTag(t)
+		if r.TargetTags[i] == "" {
+			return wrap("targetTags cannot be empty", nil)
+		}
+	}
+
+	if strings.Contains(r.SQL, ";") {
+		return wrap("sql must be a single expression", nil)
+	}
+
+	return nil
+}
+
+// normaliseTag trims and lowercases a target tag.
+func normaliseTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// visibilityPolicy holds the visibility rules of each role.
+type visibilityPolicy map[int64][]VisibilityRule
+
+func newVisibilityPolicy(rules []VisibilityRule) visibilityPolicy {
+	p := make(visibilityPolicy)
+	for _, r := range rules {
+		p[r.RoleID] = append(p[r.RoleID], r)
+	}
+
+	return p
+}
+
+// scope returns a gorm scope that restricts the queries on the ratings table to
+// the ratings visible to the users of a role. nil is returned if the role is
+// not restricted.
+func (p visibilityPolicy) scope(roleID int64) func(*gorm.DB) *gorm.DB {
+	rules := p[roleID]
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var (
+		preds []string
+		args  []interface{}
+	)
+
+	for _, r := range rules {
+		switch {
+		case len(r.Targets) > 0:
+			preds = append(preds, "ratings.target IN (?)")
+			args = append(args, r.Targets)
+		case len(r.TargetTags) > 0:
+			preds = append(preds, "ratings.target IN (SELECT target FROM target_tags WHERE tag IN (?))")
+			args = append(args, r.TargetTags)
+		default:
+			preds = append(preds, "("+r.SQL+")")
+		}
+	}
+
+	where := strings.Join(preds, " OR ")
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(where, args...)
+	}
+}
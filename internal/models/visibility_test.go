@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVisibilityRules(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		rules, err := ParseVisibilityRules([]byte(`[
+			{"roleId": 3, "description": "Retail department", "targetTags": [" Retail "]},
+			{"roleId": 3, "targets": [1, 2]},
+			{"roleId": 4, "sql": "NOT anonymous"}
+		]`))
+		require.NoError(t, err)
+		require.Len(t, rules, 3)
+		assert.Equal(t, []string{"retail"}, rules[0].TargetTags)
+
+		p := newVisibilityPolicy(rules)
+		assert.Len(t, p[3], 2)
+		assert.Len(t, p[4], 1)
+		assert.NotNil(t, p.scope(3))
+		assert.Nil(t, p.scope(2), "roles without rules must not be restricted")
+	})
+
+	var cases = []struct {
+		name string
+		in   string
+	}{
+		{"badJSON", `{"roleId": 3}`},
+		{"unknownField", `[{"roleId": 3, "targets": [1], "tags": ["a"]}]`},
+		{"roleRequired", `[{"targets": [1]}]`},
+		{"admin", `[{"roleId": 1, "targets": [1]}]`},
+		{"noCriteria", `[{"roleId": 3}]`},
+		{"manyCriteria", `[{"roleId": 3, "targets": [1], "sql": "true"}]`},
+		{"emptyTag", `[{"roleId": 3, "targetTags": [" "]}]`},
+		{"multipleStatements", `[{"roleId": 3, "sql": "true; DELETE FROM ratings"}]`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			_, err := ParseVisibilityRules([]byte(cs.in))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+)
+
+// WarmUp reads the values requested most often, so the first requests served
+// after starting do not pay for cold caches and connections. It opens a
+// database connection, reads every role and the ratings and stats of the
+// hotTargets targets with the most active ratings.
+//
+// The values read are cached if Config.Cache is set. Either way, the queries
+// run by the most frequent requests are executed once, which warms up the
+// connection pool and the database buffers: gorm does not keep prepared
+// statements, so there are none to prepare.
+//
+// WarmUp stops early, returning the error of ctx, if ctx is done.
+func (s *Services) WarmUp(ctx context.Context, hotTargets int) error {
+	err := s.Ping(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Role.ByIDs()
+	if err != nil {
+		return wrap("failed to load roles", err)
+	}
+
+	if hotTargets < 1 {
+		return nil
+	}
+
+	var targets []int64
+	err = s.db.Model(&TargetScore{}).
+		Where("count > 0").
+		Order("count DESC, target").
+		Limit(hotTargets).
+		Pluck("target", &targets).
+		Error
+	if err != nil {
+		return wrap("failed to find hot targets", err)
+	}
+
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, err = s.Rating.ByTarget(target)
+		if err != nil {
+			return wrap("failed to load ratings by target", err)
+		}
+
+		_, err = s.Rating.StatsByTarget(target)
+		if err != nil {
+			return wrap("failed to load rating stats", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/cache"
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServices_WarmUp(t *testing.T) {
+	dsl := testsupport.Database(t)
+	db := testsupport.Open(t, dsl)
+
+	for target := int64(1); target <= 3; target++ {
+		// target 3 gets the most ratings, then 2
+		for i := int64(1); i <= target; i++ {
+			id := 10*target + i
+			u := User{ID: id, Active: true, Email: "warm" + strconv.FormatInt(id, 10) + "@test.com", FirstName: "warm", Password: "x", RoleID: 2}
+			require.NoError(t, db.Create(&u).Error)
+			require.NoError(t, db.Create(&Rating{Active: true, Score: 3, Target: target, UserID: u.ID, Extra: []byte(`{}`)}).Error)
+		}
+	}
+
+	c := Config{
+		JWTSecret:   []byte(testJWTSecret),
+		DatabaseDSL: dsl,
+		Cache:       cache.NewLRU(100),
+	}
+	services, err := NewServices(&c)
+	require.NoError(t, err)
+	defer services.Close()
+
+	require.NoError(t, services.WarmUp(context.Background(), 2))
+
+	_, ok, _ := c.Cache.Get(allRolesKey)
+	assert.True(t, ok, "must load the roles")
+	for target, cached := range map[int64]bool{3: true, 2: true, 1: false} {
+		_, ok, _ := c.Cache.Get(ratingsByTargetKey(target))
+		assert.Equal(t, cached, ok, "ratings of target %d", target)
+		_, ok, _ = c.Cache.Get(ratingStatsKey(target))
+		assert.Equal(t, cached, ok, "stats of target %d", target)
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.Error(t, services.WarmUp(ctx, 2))
+	})
+}
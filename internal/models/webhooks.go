@@ -0,0 +1,159 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// maxWebhookAttempts is the number of times a notification is posted
+	// to a webhook before giving up.
+	maxWebhookAttempts = 6
+
+	// webhookRetryBatch is the maximum number of deliveries retried by a
+	// run of Services.RetryWebhooks.
+	webhookRetryBatch = 100
+
+	// webhookRetryLease is how long the deliveries being retried by an
+	// instance are hidden from the others.
+	webhookRetryLease = 5 * time.Minute
+)
+
+// webhookDelivery is a notification that could not be posted to a webhook,
+// to be retried.
+type webhookDelivery struct {
+	ID           int64           `gorm:"primary_key;type:bigserial"`
+	UserID       int64           `gorm:"type:bigint;not null"`
+	WebhookURL   string          `gorm:"size:2048;not null"`
+	Notification json.RawMessage `gorm:"type:jsonb;not null"`
+
+	// Attempts is the number of times the delivery failed, and LastError
+	// the error of the last attempt.
+	Attempts  int    `gorm:"not null"`
+	LastError string `gorm:"type:text;not null"`
+
+	NextAttemptAt time.Time `gorm:"type:timestamptz;not null"`
+	CreatedAt     time.Time `gorm:"type:timestamptz;not null;default:now()"`
+}
+
+// TableName returns the name of the table of the webhook deliveries.
+func (webhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// webhookBackoff returns the time to wait before retrying a delivery that
+// failed attempts times: a minute, then doubled after every attempt.
+func webhookBackoff(attempts int) time.Duration {
+	return time.Minute << uint(attempts-1)
+}
+
+// queueWebhook records the notification nt to s.WebhookURL, which failed with
+// sendErr, to be retried by Services.RetryWebhooks.
+func (n *notifier) queueWebhook(s Subscription, nt Notification, sendErr error) error {
+	data, err := json.Marshal(nt)
+	if err != nil {
+		return wrap("could not encode notification", err)
+	}
+
+	err = n.db.Create(&webhookDelivery{
+		UserID:        s.UserID,
+		WebhookURL:    s.WebhookURL,
+		Notification:  data,
+		Attempts:      1,
+		LastError:     sendErr.Error(),
+		NextAttemptAt: time.Now().Add(webhookBackoff(1)),
+	}).Error
+	if err != nil {
+		return with(wrap("could not queue webhook delivery", err), "user_id", s.UserID)
+	}
+
+	return nil
+}
+
+// RetryWebhooks posts again the notifications that could not be posted to the
+// webhooks of the subscriptions, once their delay elapsed. The deliveries are
+// dropped once they succeed, after too many attempts, or if their user was
+// deactivated. An error is returned for the deliveries given up on.
+func (s *Services) RetryWebhooks() error {
+	sender, ok := s.notifier.senders[ChannelWebhook]
+	if !ok {
+		return nil
+	}
+
+	// the deliveries are leased, so they are only retried by one instance
+	var deliveries []webhookDelivery
+	err := s.db.Raw(`UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries WHERE next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, time.Now().Add(webhookRetryLease), webhookRetryBatch).
+		Scan(&deliveries).
+		Error
+	if err != nil {
+		return wrap("could not lease webhook deliveries", err)
+	}
+
+	var firstErr error
+	for _, d := range deliveries {
+		err = s.retryWebhook(sender, d)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// retryWebhook posts the notification of d again with sender.
+func (s *Services) retryWebhook(sender NotificationSender, d webhookDelivery) error {
+	var u User
+	err := s.db.Where("id = ? AND active", d.UserID).First(&u).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return s.dropWebhook(d)
+	} else if err != nil {
+		return with(wrap("could not get webhook user", err), "user_id", d.UserID)
+	}
+
+	var nt Notification
+	err = json.Unmarshal(d.Notification, &nt)
+	if err == nil {
+		err = sender.Send(u, Subscription{UserID: d.UserID, Target: nt.Target, Channel: ChannelWebhook, WebhookURL: d.WebhookURL}, nt)
+	}
+	if err == nil {
+		return s.dropWebhook(d)
+	}
+
+	attempts := d.Attempts + 1
+	if attempts >= maxWebhookAttempts {
+		derr := s.dropWebhook(d)
+		if derr != nil {
+			return derr
+		}
+
+		return with(wrap("gave up webhook delivery", err), "user_id", d.UserID, "attempts", attempts)
+	}
+
+	err = s.db.Model(&d).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"last_error":      err.Error(),
+		"next_attempt_at": time.Now().Add(webhookBackoff(attempts)),
+	}).Error
+	if err != nil {
+		return with(wrap("could not reschedule webhook delivery", err), "id", d.ID)
+	}
+
+	return nil
+}
+
+// dropWebhook removes the delivery d.
+func (s *Services) dropWebhook(d webhookDelivery) error {
+	err := s.db.Delete(&d).Error
+	if err != nil {
+		return with(wrap("could not remove webhook delivery", err), "id", d.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, webhookBackoff(1))
+	assert.Equal(t, 2*time.Minute, webhookBackoff(2))
+	assert.Equal(t, 16*time.Minute, webhookBackoff(5))
+}
+
+func TestServices_RetryWebhooks(t *testing.T) {
+	db := setupGorm(t)
+	ratings := &ratingGorm{db: db}
+	ss := newSubscriptionService(db, ratings, []string{ChannelWebhook}, SystemClock)
+
+	require.NoError(t, db.Create(&User{ID: 98, RoleID: 2, Email: "second@test.com", FirstName: "Second", Password: "TestPasswordHAsh", Active: true}).Error)
+	require.NoError(t, ss.Follow(&Subscription{UserID: 98, Target: 9, Channel: ChannelWebhook, WebhookURL: "https://hooks.test/98", NewRatings: true}))
+
+	webhook := &testNotificationSender{err: errors.New("webhook down")}
+	n := &notifier{db: db, ratings: ratings, senders: map[string]NotificationSender{ChannelWebhook: webhook}}
+	s := &Services{db: db, notifier: n}
+
+	r := Rating{ID: 10, Active: true, Extra: json.RawMessage(`{}`), Score: 4, Target: 9, UserID: 1}
+	require.NoError(t, db.Create(&r).Error)
+	assert.Error(t, n.notify(r, true, ""))
+
+	var deliveries []webhookDelivery
+	require.NoError(t, db.Find(&deliveries).Error)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "https://hooks.test/98", deliveries[0].WebhookURL)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, "webhook down", deliveries[0].LastError)
+
+	due := func() {
+		require.NoError(t, db.Exec("UPDATE webhook_deliveries SET next_attempt_at = now() - interval '1 second'").Error)
+	}
+
+	t.Run("notDue", func(t *testing.T) {
+		require.NoError(t, s.RetryWebhooks())
+		assert.Len(t, webhook.sent, 1, "must wait for the delay")
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		due()
+		require.NoError(t, s.RetryWebhooks())
+		require.Len(t, webhook.sent, 2)
+		assert.Equal(t, int64(10), *webhook.sent[1].RatingID)
+
+		var d webhookDelivery
+		require.NoError(t, db.First(&d).Error)
+		assert.Equal(t, 2, d.Attempts)
+		assert.WithinDuration(t, time.Now().Add(webhookBackoff(2)), d.NextAttemptAt, time.Minute)
+	})
+
+	t.Run("givenUp", func(t *testing.T) {
+		require.NoError(t, db.Exec("UPDATE webhook_deliveries SET attempts = ?", maxWebhookAttempts-1).Error)
+		due()
+		assert.Error(t, s.RetryWebhooks())
+
+		var count int
+		require.NoError(t, db.Model(&webhookDelivery{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("delivered", func(t *testing.T) {
+		assert.Error(t, n.notify(r, true, ""))
+		webhook.err = nil
+		due()
+		require.NoError(t, s.RetryWebhooks())
+
+		var count int
+		require.NoError(t, db.Model(&webhookDelivery{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("inactiveUser", func(t *testing.T) {
+		webhook.err = errors.New("webhook down")
+		assert.Error(t, n.notify(r, true, ""))
+		require.NoError(t, db.Model(&User{}).Where("id = 98").Update("active", false).Error)
+		due()
+		sent := len(webhook.sent)
+		require.NoError(t, s.RetryWebhooks())
+		assert.Len(t, webhook.sent, sent, "must not notify inactive users")
+
+		var count int
+		require.NoError(t, db.Model(&webhookDelivery{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A TargetWindow bounds the time the ratings of a target are accepted.
+type TargetWindow struct {
+	Target int64 `json:"target"`
+
+	// OpensAt and ClosesAt delimit the window, OpensAt included. A nil
+	// bound does not restrict the time, so a target without bounds is
+	// always open.
+	OpensAt  *time.Time `json:"opensAt"`
+	ClosesAt *time.Time `json:"closesAt"`
+}
+
+// Open tells whether the ratings of the target are accepted at time t.
+func (w TargetWindow) Open(t time.Time) bool {
+	return (w.OpensAt == nil || !t.Before(*w.OpensAt)) && (w.ClosesAt == nil || t.Before(*w.ClosesAt))
+}
+
+func (rv *ratingValidator) Window(target int64) (TargetWindow, error) {
+	if target < 1 {
+		return TargetWindow{}, ValidationError{"target": ErrInvalid}
+	}
+
+	return rv.RatingDB.Window(target)
+}
+
+func (rv *ratingValidator) SetWindow(w *TargetWindow) error {
+	ve := ValidationError{}
+	if w.Target < 1 {
+		ve["target"] = ErrInvalid
+	}
+	if w.OpensAt != nil && w.ClosesAt != nil && !w.ClosesAt.After(*w.OpensAt) {
+		ve["closesAt"] = ErrInvalid
+	}
+
+	if len(ve) > 0 {
+		return ve
+	}
+
+	return rv.RatingDB.SetWindow(w)
+}
+
+// Window reads the window of a target from its row of the targets. The targets
+// without a row have no bounds.
+func (rg *ratingGorm) Window(target int64) (TargetWindow, error) {
+	var w TargetWindow
+	err := rg.db.Raw(`SELECT target, opens_at, closes_at FROM targets WHERE target = ?`, target).
+		Scan(&w).
+		Error
+	if gorm.IsRecordNotFoundError(err) {
+		return TargetWindow{Target: target}, nil
+	} else if err != nil {
+		return TargetWindow{}, with(wrap("could not get the window of the target", err), "target", target)
+	}
+
+	return w, nil
+}
+
+// SetWindow sets the window of a target on its row of the targets, which is
+// created if it has no ratings yet.
+func (rg *ratingGorm) SetWindow(w *TargetWindow) error {
+	err := rg.db.Exec(`INSERT INTO targets (target, opens_at, closes_at) VALUES (?, ?, ?)
+		ON CONFLICT (target) DO UPDATE SET opens_at = excluded.opens_at, closes_at = excluded.closes_at`,
+		w.Target, w.OpensAt, w.ClosesAt).Error
+	if err != nil {
+		return with(wrap("could not set the window of the target", err), "target", w.Target)
+	}
+
+	return nil
+}
+
+// fetchWindow retrieves the window of the target of the rating, checked by
+// windowOpen. This method is dependent on the target being set.
+func (rc *ratingValWithDBData) fetchWindow() (string, ratingValFn) {
+	return "", func(r *Rating) error {
+		var err error
+		rc.window, err = rc.rv.RatingDB.Window(r.Target)
+		return err
+	}
+}
+
+// windowOpen makes sure the target accepts ratings now. It may return
+// ErrRatingClosed. This method is dependent on fetchWindow.
+func (rc *ratingValWithDBData) windowOpen() (string, ratingValFn) {
+	return "target", func(r *Rating) error {
+		if rc.window.Open(rc.rv.clock.Now()) {
+			return nil
+		}
+		return ErrRatingClosed
+	}
+}
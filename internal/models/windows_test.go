@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetWindow_Open(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	assert.True(t, TargetWindow{}.Open(now))
+	assert.True(t, TargetWindow{OpensAt: &before, ClosesAt: &after}.Open(now))
+	assert.True(t, TargetWindow{OpensAt: &now}.Open(now), "must include the opening")
+	assert.False(t, TargetWindow{ClosesAt: &now}.Open(now), "must exclude the closing")
+	assert.False(t, TargetWindow{OpensAt: &after}.Open(now))
+	assert.False(t, TargetWindow{ClosesAt: &before}.Open(now))
+}
+
+func TestRatingService_Window(t *testing.T) {
+	tudb := &testUserDB{
+		byID: func(id int64) (User, error) {
+			return User{ID: id, Active: true, RoleID: 2}, nil
+		},
+	}
+	us, _ := NewUserService(nil, nil, []byte(testJWTSecret))
+	us.(*userService).UserService.(*userValidator).UserDB = tudb
+
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	trdb := &testRatingDB{
+		window: func(target int64) (TargetWindow, error) {
+			if target == 9 {
+				return TargetWindow{Target: 9, ClosesAt: &before}, nil
+			}
+			return TargetWindow{Target: target}, nil
+		},
+		byID: func(id int64) (Rating, error) {
+			return Rating{ID: id, Target: 9, UserID: 1, Score: 4, Extra: json.RawMessage(`{}`)}, nil
+		},
+	}
+	rs := NewRatingService(nil, us)
+	rv := rs.(*ratingService).RatingService.(*ratingValidator)
+	rv.RatingDB = trdb
+	rv.clock = FixedClock(now)
+
+	t.Run("setWindow", func(t *testing.T) {
+		var cases = []struct {
+			name   string
+			window TargetWindow
+			outerr error
+		}{
+			{"ok", TargetWindow{Target: 9, OpensAt: &before, ClosesAt: &after}, nil},
+			{"unbounded", TargetWindow{Target: 9}, nil},
+			{"targetInvalid", TargetWindow{}, ValidationError{"target": ErrInvalid}},
+			{"reversed", TargetWindow{Target: 9, OpensAt: &after, ClosesAt: &before}, ValidationError{"closesAt": ErrInvalid}},
+			{"empty", TargetWindow{Target: 9, OpensAt: &now, ClosesAt: &now}, ValidationError{"closesAt": ErrInvalid}},
+		}
+
+		trdb.setWindow = func(*TargetWindow) error { return nil }
+		defer func() { trdb.setWindow = nil }()
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				w := tc.window
+				assert.Equal(t, tc.outerr, rs.SetWindow(&w))
+			})
+		}
+	})
+
+	t.Run("windowTargetInvalid", func(t *testing.T) {
+		_, err := rs.Window(0)
+		assert.Equal(t, ValidationError{"target": ErrInvalid}, err)
+	})
+
+	t.Run("create", func(t *testing.T) {
+		r := Rating{Target: 9, Score: 5, User: &User{ID: 1}}
+		assert.Equal(t, ValidationError{"target": ErrRatingClosed}, rs.Create(&r))
+
+		r = Rating{Target: 8, Score: 5, User: &User{ID: 1}}
+		assert.NoError(t, rs.Create(&r))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		r := Rating{ID: 3, Score: 5, User: &User{ID: 1}}
+		assert.Equal(t, ValidationError{"target": ErrRatingClosed}, rs.Update(&r))
+
+		r = Rating{ID: 3, User: &User{ID: 1}}
+		assert.Equal(t, ValidationError{"target": ErrRatingClosed}, rs.UpdatePartial(&r, []byte(`{"score": 2}`)))
+	})
+}
+
+func TestRatingGORM_Window(t *testing.T) {
+	db := setupGorm(t)
+	rg := &ratingGorm{db: db}
+
+	// the target has no ratings, so no row, yet
+	w, err := rg.Window(9)
+	require.NoError(t, err)
+	assert.Equal(t, TargetWindow{Target: 9}, w)
+
+	opens := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	closes := opens.AddDate(0, 0, 7)
+	require.NoError(t, rg.SetWindow(&TargetWindow{Target: 9, OpensAt: &opens, ClosesAt: &closes}))
+
+	w, err = rg.Window(9)
+	require.NoError(t, err)
+	if assert.NotNil(t, w.OpensAt) && assert.NotNil(t, w.ClosesAt) {
+		assert.True(t, opens.Equal(*w.OpensAt))
+		assert.True(t, closes.Equal(*w.ClosesAt))
+	}
+
+	require.NoError(t, db.Create(&Rating{Active: true, Extra: json.RawMessage(`{}`), Score: 5, Target: 9, UserID: 1}).Error)
+	scores, err := rg.Scores([]int64{9})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), scores[0].Count, "the window must not change the scores")
+
+	require.NoError(t, rg.SetWindow(&TargetWindow{Target: 9}))
+	w, err = rg.Window(9)
+	require.NoError(t, err)
+	assert.Equal(t, TargetWindow{Target: 9}, w)
+}
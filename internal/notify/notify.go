@@ -0,0 +1,153 @@
+/*
+Package notify delivers the notifications of the targets followed by the users outside of the
+application, see models.NotificationSender.
+
+Email sends them through an SMTP server, and Webhook posts them as JSON to the URL of each
+subscription. Both are configured once, and used by the services for every notification of their
+channel.
+
+SecurityWebhook posts the security events to a single URL, see models.SecurityEvents.
+*/
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+var (
+	wrap = errors.Wrapper("notify")
+)
+
+// DefaultTimeout is the time a notification can take to be delivered.
+const DefaultTimeout = 10 * time.Second
+
+// Email sends the notifications by email, through an SMTP server.
+type Email struct {
+	addr string
+	auth smtp.Auth
+	from string
+
+	// send is smtp.SendMail, replaced in the tests.
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmail creates an Email sender from a URL with the format
+// "smtp://[user:password@]host[:port]", sending the emails from the address
+// from. The server must support STARTTLS when credentials are given.
+func NewEmail(rawurl, from string) (*Email, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, wrap("invalid SMTP URL", err)
+	}
+	if u.Scheme != "smtp" {
+		return nil, wrap("SMTP URL must use the smtp scheme", nil)
+	}
+	if from == "" {
+		return nil, wrap("the sender address is required", nil)
+	}
+
+	e := &Email{addr: u.Host, from: from, send: smtp.SendMail}
+	if u.Port() == "" {
+		e.addr = net.JoinHostPort(u.Hostname(), "25")
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		e.auth = smtp.PlainAuth("", u.User.Username(), password, u.Hostname())
+	}
+
+	return e, nil
+}
+
+// Send sends n to the email address of u.
+func (e *Email) Send(u models.User, s models.Subscription, n models.Notification) error {
+	var subject string
+	switch n.Kind {
+	case models.NotificationAverageBelow:
+		subject = fmt.Sprintf("The average score of target %d dropped below %g", n.Target, *s.AverageBelow)
+	case models.NotificationAverageAbove:
+		subject = fmt.Sprintf("The average score of target %d rose above %g", n.Target, *s.AverageAbove)
+	case models.NotificationAlert:
+		subject = fmt.Sprintf("Alert: the recent average score of target %d dropped below %g", n.Target, *s.AverageBelow)
+	default:
+		subject = fmt.Sprintf("New rating for target %d", n.Target)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", u.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Hello %s,\r\n\r\n", u.FirstName)
+	if n.RatingID != nil && n.Score != nil {
+		fmt.Fprintf(&msg, "Target %d was rated %d (rating %d). Its average score is now %.2f.\r\n", n.Target, *n.Score, *n.RatingID, n.Average)
+	} else {
+		fmt.Fprintf(&msg, "The recent average score of target %d is %.2f.\r\n", n.Target, n.Average)
+	}
+
+	err := e.send(e.addr, e.auth, e.from, []string{u.Email}, []byte(msg.String()))
+	if err != nil {
+		return wrap("could not send email", err)
+	}
+
+	return nil
+}
+
+// Webhook posts the notifications as JSON to the URL of each subscription.
+type Webhook struct {
+	client *http.Client
+}
+
+// NewWebhook creates a Webhook sender giving up on the requests that take longer
+// than timeout, or DefaultTimeout if it is zero.
+func NewWebhook(timeout time.Duration) *Webhook {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Webhook{client: &http.Client{Timeout: timeout}}
+}
+
+// Send posts n to the WebhookURL of s. Any status other than 2xx is an error.
+func (w *Webhook) Send(u models.User, s models.Subscription, n models.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return wrap("could not encode notification", err)
+	}
+
+	return postJSON(w.client, s.WebhookURL, body)
+}
+
+// postJSON posts body, a JSON document, to url. Any status other than 2xx is an
+// error.
+func postJSON(client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return wrap("invalid webhook request", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ratingsapp")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return wrap("could not post to webhook", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return wrap(fmt.Sprintf("webhook responded %d", resp.StatusCode), nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+// securityQueueSize is the number of security events waiting to be posted by a
+// SecurityWebhook, before the next ones are dropped.
+const securityQueueSize = 1024
+
+// SecurityWebhook posts the security events as JSON to a URL, like the one of
+// the SIEM of the security operations, see models.SecurityEvents. The events
+// are posted in the background, one at a time and in order, so recording them
+// does not slow down the requests. They are dropped while too many are
+// waiting, as when an attack outpaces the webhook.
+type SecurityWebhook struct {
+	url    string
+	client *http.Client
+
+	// onError is called with the errors posting the events, and the
+	// events dropped.
+	onError func(error)
+
+	queue     chan models.SecurityEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSecurityWebhook creates a SecurityWebhook posting the events to rawurl,
+// giving up on the requests that take longer than timeout, or DefaultTimeout if
+// it is zero. onError is called with the errors found posting them, and may be
+// nil.
+func NewSecurityWebhook(rawurl string, timeout time.Duration, onError func(error)) (*SecurityWebhook, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, wrap("invalid security webhook URL", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, wrap("security webhook URL must use the http or https scheme", nil)
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	w := &SecurityWebhook{
+		url:     rawurl,
+		client:  &http.Client{Timeout: timeout},
+		onError: onError,
+		queue:   make(chan models.SecurityEvent, securityQueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+
+	return w, nil
+}
+
+// Record queues e to be posted. It must not be called once w is closed.
+func (w *SecurityWebhook) Record(e models.SecurityEvent) {
+	select {
+	case w.queue <- e:
+	default:
+		w.onError(errors.With(wrap("security event dropped, too many waiting", nil), "type", e.Type))
+	}
+}
+
+// Close posts the events waiting, and stops w.
+func (w *SecurityWebhook) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.queue)
+	})
+	<-w.done
+
+	return nil
+}
+
+// run posts the events queued until w is closed.
+func (w *SecurityWebhook) run() {
+	defer close(w.done)
+
+	for e := range w.queue {
+		body, err := json.Marshal(e)
+		if err == nil {
+			err = postJSON(w.client, w.url, body)
+		}
+		if err != nil {
+			w.onError(errors.With(wrap("could not post security event", err), "type", e.Type))
+		}
+	}
+}
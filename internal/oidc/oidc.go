@@ -0,0 +1,259 @@
+/*
+Package oidc implements the verification of the ID tokens of an OpenID Connect provider, like
+Google, see models.IdentityProvider.
+
+The provider is discovered from the openid-configuration document of its issuer the first time a
+token is verified, so the application starts even if the provider can't be reached. Its signing
+keys are read from its jwks_uri, and read again when a token is signed with an unknown key, which
+happens when the provider rotates them, at most once a minute.
+*/
+package oidc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"github.com/noelruault/ratingsapp/internal/models"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+var (
+	wrap = errors.Wrapper("oidc")
+)
+
+const (
+	// DefaultTimeout is the time a request to the provider can take.
+	DefaultTimeout = 10 * time.Second
+
+	// leeway is the clock skew tolerated between the provider and the
+	// application when checking the expiry of the tokens.
+	leeway = time.Minute
+
+	// refreshInterval is the shortest time between two reads of the keys.
+	refreshInterval = time.Minute
+)
+
+// Provider verifies the ID tokens an OpenID Connect provider issues to a client.
+type Provider struct {
+	issuer   string
+	clientID string
+	client   *http.Client
+
+	// now tells the time the tokens are checked at.
+	now func() time.Time
+
+	mu      sync.Mutex
+	jwksURI string
+	keys    jose.JSONWebKeySet
+	fetched time.Time
+}
+
+// NewProvider creates a Provider verifying the ID tokens issued by issuer, like
+// https://accounts.google.com, to the client clientID. The requests taking
+// longer than timeout, or DefaultTimeout if it is zero, are given up.
+func NewProvider(issuer, clientID string, timeout time.Duration) (*Provider, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return nil, wrap("invalid issuer", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, wrap("issuer must use the http or https scheme", nil)
+	}
+	if clientID == "" {
+		return nil, wrap("client ID is required", nil)
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Provider{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		clientID: clientID,
+		client:   &http.Client{Timeout: timeout},
+		now:      time.Now,
+	}, nil
+}
+
+// claims are the claims of the ID tokens besides the registered ones.
+type claims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+// Verify checks the signature, issuer, audience and expiry of idToken, and that
+// its nonce claim is nonce, and returns the identity it asserts.
+// models.ErrUnauthorised is returned if it is not valid.
+func (p *Provider) Verify(idToken, nonce string) (models.Identity, error) {
+	if nonce == "" {
+		return models.Identity{}, models.ErrUnauthorised
+	}
+
+	tok, err := jwt.ParseSigned(idToken)
+	if err != nil || len(tok.Headers) != 1 {
+		return models.Identity{}, models.ErrUnauthorised
+	}
+
+	// the keys of the provider are asymmetric, so the tokens signed
+	// with a MAC could have been signed by anyone knowing them
+	h := tok.Headers[0]
+	if strings.HasPrefix(h.Algorithm, "HS") {
+		return models.Identity{}, models.ErrUnauthorised
+	}
+
+	key, err := p.key(h.KeyID)
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	var (
+		cl  jwt.Claims
+		ext claims
+	)
+	err = tok.Claims(key.Key, &cl, &ext)
+	if err != nil {
+		return models.Identity{}, models.ErrUnauthorised
+	}
+
+	// Google issues tokens with and without the scheme in their issuer
+	if cl.Issuer != p.issuer && "https://"+cl.Issuer != p.issuer {
+		return models.Identity{}, models.ErrUnauthorised
+	}
+
+	err = cl.ValidateWithLeeway(jwt.Expected{
+		Audience: jwt.Audience{p.clientID},
+		Time:     p.now(),
+	}, leeway)
+	if err != nil || cl.Subject == "" || cl.Expiry == nil {
+		return models.Identity{}, models.ErrUnauthorised
+	}
+
+	// the token must have been issued for this sign in, so one leaked or
+	// obtained by another client can't be replayed
+	if subtle.ConstantTimeCompare([]byte(ext.Nonce), []byte(nonce)) != 1 {
+		return models.Identity{}, models.ErrUnauthorised
+	}
+
+	return models.Identity{
+		Issuer:        p.issuer,
+		Subject:       cl.Subject,
+		Email:         ext.Email,
+		EmailVerified: ext.EmailVerified,
+		GivenName:     ext.GivenName,
+		FamilyName:    ext.FamilyName,
+	}, nil
+}
+
+// key returns the signing key of the provider with the given ID, reading the
+// keys again if it is not known. models.ErrUnauthorised is returned if the
+// provider does not have it.
+func (p *Provider) key(id string) (*jose.JSONWebKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k := p.find(id); k != nil {
+		return k, nil
+	}
+
+	if !p.fetched.IsZero() && p.now().Sub(p.fetched) < refreshInterval {
+		return nil, models.ErrUnauthorised
+	}
+
+	err := p.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	if k := p.find(id); k != nil {
+		return k, nil
+	}
+
+	return nil, models.ErrUnauthorised
+}
+
+// find returns the signing key with the given ID, or the only signing key if id
+// is empty, or nil if there is none.
+func (p *Provider) find(id string) *jose.JSONWebKey {
+	var found []jose.JSONWebKey
+	for _, k := range p.keys.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if id == "" || k.KeyID == id {
+			found = append(found, k)
+		}
+	}
+
+	if len(found) != 1 {
+		return nil
+	}
+
+	return &found[0]
+}
+
+// refresh reads the keys of the provider, discovering it first if needed. It
+// must be called with p.mu held.
+func (p *Provider) refresh() error {
+	if p.jwksURI == "" {
+		var config struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		err := p.get(p.issuer+"/.well-known/openid-configuration", &config)
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSuffix(config.Issuer, "/") != p.issuer || config.JWKSURI == "" {
+			return wrap("invalid openid configuration of "+p.issuer, nil)
+		}
+		p.jwksURI = config.JWKSURI
+	}
+
+	var keys jose.JSONWebKeySet
+	err := p.get(p.jwksURI, &keys)
+	if err != nil {
+		return err
+	}
+
+	p.keys = keys
+	p.fetched = p.now()
+	return nil
+}
+
+// get reads the JSON document at uri in dst.
+func (p *Provider) get(uri string, dst interface{}) error {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return wrap("invalid provider URI", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "ratingsapp")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return wrap("could not reach identity provider", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return wrap(fmt.Sprintf("identity provider responded %d", resp.StatusCode), nil)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(dst)
+	if err != nil {
+		return wrap("invalid identity provider response", err)
+	}
+
+	return nil
+}
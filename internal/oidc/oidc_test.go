@@ -0,0 +1,128 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider("https://accounts.google.com/", "client", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "https://accounts.google.com", p.issuer)
+	assert.Equal(t, DefaultTimeout, p.client.Timeout)
+
+	_, err = NewProvider("ftp://accounts.google.com", "client", 0)
+	assert.Error(t, err)
+
+	_, err = NewProvider("https://accounts.google.com", "", 0)
+	assert.Error(t, err)
+}
+
+func TestProvider_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var (
+		srv      *httptest.Server
+		jwksHits int
+		kid      = "key-1"
+	)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+		case "/keys":
+			jwksHits++
+			json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+				{Key: &key.PublicKey, KeyID: kid, Algorithm: "RS256", Use: "sig"},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	p, err := NewProvider(srv.URL, "client", 0)
+	require.NoError(t, err)
+	p.now = func() time.Time { return now }
+
+	sign := func(k *rsa.PrivateKey, kid string, cl jwt.Claims, ext claims) string {
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: k},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", kid))
+		require.NoError(t, err)
+
+		tok, err := jwt.Signed(sig).Claims(cl).Claims(ext).CompactSerialize()
+		require.NoError(t, err)
+		return tok
+	}
+
+	valid := jwt.Claims{
+		Issuer:   srv.URL,
+		Subject:  "1234",
+		Audience: jwt.Audience{"client"},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(now),
+	}
+	ext := claims{Nonce: "nonce", Email: "user@example.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"}
+
+	id, err := p.Verify(sign(key, "key-1", valid, ext), "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, models.Identity{
+		Issuer:        srv.URL,
+		Subject:       "1234",
+		Email:         "user@example.com",
+		EmailVerified: true,
+		GivenName:     "Jane",
+		FamilyName:    "Doe",
+	}, id)
+
+	with := func(f func(cl *jwt.Claims)) jwt.Claims {
+		cl := valid
+		f(&cl)
+		return cl
+	}
+
+	for name, tok := range map[string]string{
+		"malformed":     "not a token",
+		"otherKey":      sign(other, "key-1", valid, ext),
+		"unknownKey":    sign(key, "key-2", valid, ext),
+		"otherIssuer":   sign(key, "key-1", with(func(cl *jwt.Claims) { cl.Issuer = "https://evil.example.com" }), ext),
+		"otherAudience": sign(key, "key-1", with(func(cl *jwt.Claims) { cl.Audience = jwt.Audience{"other"} }), ext),
+		"expired":       sign(key, "key-1", with(func(cl *jwt.Claims) { cl.Expiry = jwt.NewNumericDate(now.Add(-2 * time.Minute)) }), ext),
+		"noExpiry":      sign(key, "key-1", with(func(cl *jwt.Claims) { cl.Expiry = nil }), ext),
+		"noSubject":     sign(key, "key-1", with(func(cl *jwt.Claims) { cl.Subject = "" }), ext),
+		"otherNonce":    sign(key, "key-1", valid, claims{Nonce: "other", Email: ext.Email}),
+		"noNonce":       sign(key, "key-1", valid, claims{Email: ext.Email}),
+	} {
+		_, err := p.Verify(tok, "nonce")
+		assert.Equal(t, models.ErrUnauthorised, err, name)
+	}
+
+	_, err = p.Verify(sign(key, "key-1", valid, claims{Email: ext.Email}), "")
+	assert.Equal(t, models.ErrUnauthorised, err, "must require a nonce")
+
+	assert.Equal(t, 1, jwksHits, "must read the keys again once a minute at most")
+
+	t.Run("rotated", func(t *testing.T) {
+		kid = "key-2"
+		now = now.Add(refreshInterval)
+
+		_, err := p.Verify(sign(key, "key-2", valid, ext), "nonce")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, jwksHits, "must read the keys again for an unknown key")
+	})
+}
@@ -0,0 +1,189 @@
+/*
+Package privacy anonymises the personal data of the clients of the application, like their IP
+addresses and user agents, before it is recorded.
+
+An Anonymizer is configured once per deployment, with the Mode required by the privacy regulations
+that apply to it, and used wherever such data is logged or stored.
+*/
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+)
+
+var (
+	wrap = errors.Wrapper("privacy")
+)
+
+// Mode selects how an Anonymizer transforms the values.
+type Mode string
+
+// Supported modes.
+const (
+	// Off records the values as they are.
+	Off Mode = ""
+
+	// Truncate removes the identifying parts of the values: the last
+	// octet of IPv4 addresses, all but the first 48 bits of IPv6
+	// addresses, and the comments and minor versions of user agents.
+	// Truncated values can still be used to tell networks and browsers
+	// apart.
+	Truncate Mode = "truncate"
+
+	// Hash replaces the values with a keyed hash of them. Hashed values
+	// can only be used to tell whether two records come from the same
+	// client.
+	Hash Mode = "hash"
+)
+
+// hashSize is the number of bytes of the hashes kept by the Hash mode.
+const hashSize = 16
+
+// Anonymizer anonymises client data as configured by its Mode. A nil
+// *Anonymizer records the values as they are.
+type Anonymizer struct {
+	mode Mode
+	key  []byte
+}
+
+// NewAnonymizer creates an Anonymizer for mode. The key is used by the Hash
+// mode, so the hashes cannot be reversed by hashing every IP address: values
+// are only hashed the same while the key is kept.
+func NewAnonymizer(mode Mode, key []byte) (*Anonymizer, error) {
+	switch mode {
+	case Off, Truncate:
+	case Hash:
+		if len(key) == 0 {
+			return nil, wrap("the hash mode requires a key", nil)
+		}
+	default:
+		return nil, wrap("unknown mode "+strconv.Quote(string(mode)), nil)
+	}
+
+	return &Anonymizer{mode: mode, key: key}, nil
+}
+
+// Mode returns the mode of a.
+func (a *Anonymizer) Mode() Mode {
+	if a == nil {
+		return Off
+	}
+
+	return a.mode
+}
+
+// Client describes the client of a request, as recorded.
+type Client struct {
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// Client anonymises the IP address and the user agent of a client.
+func (a *Anonymizer) Client(ip, userAgent string) Client {
+	return Client{IP: a.IP(ip), UserAgent: a.UserAgent(userAgent)}
+}
+
+// IP anonymises an IP address. Values that are not IP addresses are
+// discarded, unless the mode is Off.
+func (a *Anonymizer) IP(ip string) string {
+	switch a.Mode() {
+	case Truncate:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return ""
+		}
+
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return parsed.Mask(net.CIDRMask(48, 128)).String()
+
+	case Hash:
+		if net.ParseIP(ip) == nil {
+			return ""
+		}
+		return a.hash("ip", ip)
+
+	default:
+		return ip
+	}
+}
+
+// UserAgent anonymises the value of a User-Agent header.
+func (a *Anonymizer) UserAgent(ua string) string {
+	switch a.Mode() {
+	case Truncate:
+		return truncateUserAgent(ua)
+
+	case Hash:
+		if ua == "" {
+			return ""
+		}
+		return a.hash("ua", ua)
+
+	default:
+		return ua
+	}
+}
+
+// hash returns the keyed hash of a value of a kind, so equal values of
+// different kinds are hashed differently.
+func (a *Anonymizer) hash(kind, v string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + ":" + v))
+
+	return hex.EncodeToString(mac.Sum(nil)[:hashSize])
+}
+
+// truncateUserAgent keeps the products of a user agent, like "Firefox/68.0",
+// with their major versions only, and drops the comments between
+// parentheses, which describe the system and device of the client.
+func truncateUserAgent(ua string) string {
+	var (
+		products []string
+		depth    int
+		b        strings.Builder
+	)
+
+	flush := func() {
+		if b.Len() == 0 {
+			return
+		}
+
+		p := b.String()
+		b.Reset()
+		if i := strings.IndexByte(p, '/'); i >= 0 {
+			if j := strings.IndexByte(p[i+1:], '.'); j >= 0 {
+				p = p[:i+1+j]
+			}
+		}
+		products = append(products, p)
+	}
+
+	for _, r := range ua {
+		switch {
+		case r == '(':
+			flush()
+			depth++
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case r == ' ' || r == '\t':
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+
+	return strings.Join(products, " ")
+}
@@ -0,0 +1,82 @@
+package privacy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:68.0) Gecko/20100101 Firefox/68.0"
+
+func TestNewAnonymizer(t *testing.T) {
+	for _, mode := range []Mode{Off, Truncate, Hash} {
+		_, err := NewAnonymizer(mode, []byte("key"))
+		assert.NoError(t, err, "mode %q", mode)
+	}
+
+	_, err := NewAnonymizer("redact", []byte("key"))
+	assert.Error(t, err)
+	_, err = NewAnonymizer(Hash, nil)
+	assert.Error(t, err)
+}
+
+func TestAnonymizer_Off(t *testing.T) {
+	var nilAnon *Anonymizer
+	off, err := NewAnonymizer(Off, nil)
+	require.NoError(t, err)
+
+	for _, a := range []*Anonymizer{nilAnon, off} {
+		assert.Equal(t, Client{IP: "203.0.113.25", UserAgent: testUserAgent}, a.Client("203.0.113.25", testUserAgent))
+	}
+}
+
+func TestAnonymizer_Truncate(t *testing.T) {
+	a, err := NewAnonymizer(Truncate, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		in, out string
+	}{
+		{"203.0.113.25", "203.0.113.0"},
+		{"::ffff:203.0.113.25", "203.0.113.0"},
+		{"2001:db8:85a3:8d3:1319:8a2e:370:7348", "2001:db8:85a3::"},
+		{"unknown", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.out, a.IP(tt.in), tt.in)
+	}
+
+	uas := []struct {
+		in, out string
+	}{
+		{testUserAgent, "Mozilla/5 Gecko/20100101 Firefox/68"},
+		{"curl/7.64.0", "curl/7"},
+		{"Bot (+https://example.com/bot (v2))", "Bot"},
+		{"", ""},
+	}
+	for _, tt := range uas {
+		assert.Equal(t, tt.out, a.UserAgent(tt.in), tt.in)
+	}
+}
+
+func TestAnonymizer_Hash(t *testing.T) {
+	a, err := NewAnonymizer(Hash, []byte("key"))
+	require.NoError(t, err)
+	other, err := NewAnonymizer(Hash, []byte("other key"))
+	require.NoError(t, err)
+
+	ip := a.IP("203.0.113.25")
+	assert.Len(t, ip, 2*hashSize)
+	assert.Equal(t, ip, a.IP("203.0.113.25"), "must hash the same values the same")
+	assert.NotEqual(t, ip, a.IP("203.0.113.26"))
+	assert.NotEqual(t, ip, other.IP("203.0.113.25"), "must depend on the key")
+	assert.NotEqual(t, ip, a.UserAgent("203.0.113.25"), "must depend on the kind of value")
+	assert.Equal(t, "", a.IP("unknown"))
+
+	ua := a.UserAgent(testUserAgent)
+	assert.Len(t, ua, 2*hashSize)
+	assert.NotContains(t, ua, "Firefox")
+	assert.Equal(t, "", a.UserAgent(""))
+}
@@ -0,0 +1,211 @@
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schedule tells when a job runs.
+type Schedule interface {
+	// Next returns the first time the job runs after t.
+	Next(t time.Time) time.Time
+
+	// String returns the specification the schedule was parsed from.
+	String() string
+}
+
+// Parse parses a schedule specification, which is either:
+//
+//   - "@every <duration>", like "@every 90s", to run every duration, counted
+//     from the end of the previous run, of at least a second;
+//   - "@hourly", "@daily", "@weekly" or "@monthly", to run at the start of
+//     each hour, day, week or month;
+//   - a cron expression with 5 fields, "minute hour day-of-month month
+//     day-of-week", like "*/15 3 * * 1-5". Each field is "*", a number, a
+//     range like "1-5", or a list of them like "0,30", optionally followed by
+//     a step like "/15". Sunday is day 0 of the week.
+//
+// The cron expressions are evaluated in UTC. As in cron, a job runs when
+// either the day of the month or the day of the week matches, if both are
+// restricted.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || d < time.Second {
+			return nil, wrap("invalid interval in schedule "+strconv.Quote(spec), err)
+		}
+
+		return every{d: d, spec: spec}, nil
+	}
+
+	expr, ok := map[string]string{
+		"@hourly":  "0 * * * *",
+		"@daily":   "0 0 * * *",
+		"@weekly":  "0 0 * * 0",
+		"@monthly": "0 0 1 * *",
+	}[spec]
+	if !ok {
+		expr = spec
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, wrap("schedule "+strconv.Quote(spec)+" must have 5 fields", nil)
+	}
+
+	c := cron{spec: spec}
+	for i, b := range cronBounds {
+		set, err := parseField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, wrap("invalid "+b.name+" in schedule "+strconv.Quote(spec), err)
+		}
+		c.fields[i] = set
+	}
+	c.anyDay = fields[2] == "*"
+	c.anyWeekday = fields[4] == "*"
+
+	return c, nil
+}
+
+// every is a Schedule running at a fixed interval.
+type every struct {
+	d    time.Duration
+	spec string
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.d)
+}
+
+func (e every) String() string {
+	return e.spec
+}
+
+// cronBounds are the names and ranges of the fields of the cron expressions.
+var cronBounds = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// cron is a Schedule parsed from a cron expression.
+type cron struct {
+	// fields are the values of each field matched, as bits.
+	fields [5]uint64
+
+	// anyDay and anyWeekday are set if the day of the month or the day
+	// of the week are not restricted.
+	anyDay, anyWeekday bool
+
+	spec string
+}
+
+// maxCronSearch is how far Next looks for a time matching a cron expression,
+// so the expressions that never match, like the 31st of February, end.
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+func (c cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxCronSearch)
+
+	for t.Before(end) {
+		switch {
+		case !has(c.fields[3], int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !has(c.fields[1], t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !has(c.fields[0], t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchDay tells whether the day of t matches c.
+func (c cron) matchDay(t time.Time) bool {
+	day := has(c.fields[2], t.Day())
+	weekday := has(c.fields[4], int(t.Weekday()))
+
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+
+	return day || weekday
+}
+
+func (c cron) String() string {
+	return c.spec
+}
+
+// has tells whether the bit v of set is set.
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+// parseField parses a field of a cron expression, with values from min to max,
+// returning the values matched as bits.
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, wrap("invalid step "+strconv.Quote(part[i+1:]), nil)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, wrap("invalid value "+strconv.Quote(bounds[0]), nil)
+			}
+
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, wrap("invalid value "+strconv.Quote(bounds[1]), nil)
+				}
+			} else if step > 1 {
+				// "5/15" means from 5 to the end, every 15
+				hi = max
+			}
+
+			if lo < min || hi > max || lo > hi {
+				return 0, wrap("value out of range "+strconv.Quote(part), nil)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
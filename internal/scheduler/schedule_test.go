@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2020, 3, 14, 10, 7, 30, 0, time.UTC) // a Saturday
+
+	var cases = []struct {
+		spec string
+		next time.Time
+	}{
+		{"@every 90s", from.Add(90 * time.Second)},
+		{"@hourly", time.Date(2020, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2020, 3, 14, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2020, 3, 14, 10, 25, 0, 0, time.UTC)},
+		{"0,30 3 * * *", time.Date(2020, 3, 15, 3, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2020, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// either the day of the month or the day of the week
+		{"0 0 20 * 0", time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.spec, func(t *testing.T) {
+			s, err := Parse(cs.spec)
+			require.NoError(t, err)
+			assert.Equal(t, cs.spec, s.String())
+			assert.Equal(t, cs.next, s.Next(from))
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, spec := range []string{
+			"",
+			"@every",
+			"@every 10ms",
+			"@yearly",
+			"* * * *",
+			"60 * * * *",
+			"* 24 * * *",
+			"* * 0 * *",
+			"* * * 13 *",
+			"* * * * 7",
+			"5-1 * * * *",
+			"*/0 * * * *",
+			"a * * * *",
+		} {
+			_, err := Parse(spec)
+			assert.Error(t, err, spec)
+		}
+	})
+}
@@ -0,0 +1,270 @@
+/*
+Package scheduler runs the background jobs of the application, like the maintenance of the data,
+on cron-like schedules.
+
+Jobs are added to a Scheduler before it starts, each with a Schedule parsed by Parse. Every job
+runs in its own goroutine, so a slow job does not delay the others, and never overlaps with
+itself: the runs due while it is running are skipped. Jobs can also be triggered on demand with
+Trigger, or woken with Wake to run again once their run in progress ends, and the counts and
+durations of their runs are reported by Stats.
+*/
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"golang.org/x/xerrors"
+)
+
+var (
+	wrap = errors.Wrapper("scheduler")
+)
+
+var (
+	// ErrNotFound is returned when no job has a name.
+	ErrNotFound = xerrors.New("scheduler: job not found")
+
+	// ErrRunning is returned when triggering a job already running or
+	// triggered.
+	ErrRunning = xerrors.New("scheduler: job already running")
+)
+
+// A Job is run by a Scheduler. It must stop early when ctx is done, which
+// happens when the scheduler is closed.
+type Job func(ctx context.Context) error
+
+// Stats describes the runs of a job.
+type Stats struct {
+	Name     string
+	Schedule string
+
+	// Runs and Failures count the runs of the job, and the ones that
+	// returned an error, since the scheduler started.
+	Runs     int64
+	Failures int64
+
+	// Running tells whether the job is running.
+	Running bool
+
+	// LastRun is the time the last run started, LastDuration how long it
+	// took, and LastError the error it returned, if any. LastSuccess is
+	// the time the last successful run ended.
+	LastRun      *time.Time
+	LastDuration time.Duration
+	LastError    string
+	LastSuccess  *time.Time
+
+	// NextRun is the next time the job is scheduled to run.
+	NextRun time.Time
+}
+
+// Scheduler runs jobs on their schedules until it is closed.
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+
+	// onError is called with the errors of the jobs, and may be nil.
+	onError func(name string, err error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// job is a Job added to a Scheduler, and the stats of its runs, which are
+// guarded by the mutex of the scheduler.
+type job struct {
+	run      Job
+	schedule Schedule
+	trigger  chan struct{}
+
+	stats Stats
+}
+
+// New creates a Scheduler. The errors returned by the jobs are passed to
+// onError, which may be nil, along with their name.
+func New(onError func(name string, err error)) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Scheduler{
+		jobs:    make(map[string]*job),
+		onError: onError,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Add adds a job named name, run on schedule once the scheduler starts. It
+// panics if a job was already added with the same name.
+func (s *Scheduler) Add(name string, schedule Schedule, run Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		panic(wrap("job "+name+" already added", nil))
+	}
+
+	s.jobs[name] = &job{
+		run:      run,
+		schedule: schedule,
+		trigger:  make(chan struct{}, 1),
+		stats:    Stats{Name: name, Schedule: schedule.String()},
+	}
+}
+
+// Start starts running the jobs on their schedules. The jobs are not run
+// right away, unless they are due or triggered.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+}
+
+// Close stops running the jobs, cancelling the context of the runs in
+// progress and waiting for them to end.
+func (s *Scheduler) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Trigger runs the job named name as soon as possible, without changing its
+// schedule. ErrNotFound is returned if there is no job with this name, and
+// ErrRunning if it is already running or triggered.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	running := ok && j.stats.Running
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	} else if running {
+		return ErrRunning
+	}
+
+	select {
+	case j.trigger <- struct{}{}:
+		return nil
+	default:
+		return ErrRunning
+	}
+}
+
+// Wake runs the job named name again as soon as possible: right away if it is
+// idle, or once the run in progress ends, without changing its schedule. The
+// wakes requested before it runs are merged into one run, and the ones requested
+// before the scheduler starts make it run once started. ErrNotFound is returned
+// if there is no job with this name.
+func (s *Scheduler) Wake(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Stats returns the stats of the runs of every job, sorted by name.
+func (s *Scheduler) Stats() []Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]Stats, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		st := j.stats
+		if st.LastRun != nil {
+			t := *st.LastRun
+			st.LastRun = &t
+		}
+		if st.LastSuccess != nil {
+			t := *st.LastSuccess
+			st.LastSuccess = &t
+		}
+		stats = append(stats, st)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+// loop runs j on its schedule, or when triggered, until the scheduler is
+// closed.
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(time.Now())
+		s.mu.Lock()
+		j.stats.NextRun = next
+		s.mu.Unlock()
+
+		if next.IsZero() {
+			// the schedule never matches, so it only runs when triggered
+			select {
+			case <-j.trigger:
+			case <-s.ctx.Done():
+				return
+			}
+		} else {
+			t := time.NewTimer(time.Until(next))
+			select {
+			case <-t.C:
+			case <-j.trigger:
+				t.Stop()
+			case <-s.ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+
+		s.runOnce(j)
+	}
+}
+
+// runOnce runs j and records its stats.
+func (s *Scheduler) runOnce(j *job) {
+	start := time.Now()
+	s.mu.Lock()
+	j.stats.Running = true
+	j.stats.LastRun = &start
+	s.mu.Unlock()
+
+	err := j.run(s.ctx)
+
+	end := time.Now()
+	s.mu.Lock()
+	j.stats.Running = false
+	j.stats.Runs++
+	j.stats.LastDuration = end.Sub(start)
+	j.stats.LastError = ""
+	if err != nil {
+		j.stats.Failures++
+		j.stats.LastError = err.Error()
+	} else {
+		j.stats.LastSuccess = &end
+	}
+	s.mu.Unlock()
+
+	if err != nil && s.onError != nil {
+		s.onError(j.stats.Name, err)
+	}
+}
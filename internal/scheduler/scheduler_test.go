@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// never is a Schedule that never runs the jobs, so they only run when
+// triggered.
+type never struct{}
+
+func (never) Next(time.Time) time.Time { return time.Time{} }
+func (never) String() string           { return "never" }
+
+func TestScheduler(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		errs   []string
+		ran    = make(chan string, 10)
+		block  = make(chan struct{})
+		failed = xerrors.New("failed")
+	)
+
+	s := New(func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, name+": "+err.Error())
+	})
+
+	every, err := Parse("@every 1s")
+	require.NoError(t, err)
+
+	s.Add("every", every, func(ctx context.Context) error {
+		ran <- "every"
+		return nil
+	})
+	s.Add("failing", never{}, func(ctx context.Context) error {
+		ran <- "failing"
+		return failed
+	})
+	s.Add("blocking", never{}, func(ctx context.Context) error {
+		ran <- "blocking"
+		select {
+		case <-block:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	assert.Panics(t, func() { s.Add("every", every, nil) }, "must not add the same job twice")
+
+	s.Start()
+	defer s.Close()
+
+	select {
+	case name := <-ran:
+		assert.Equal(t, "every", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job must run on its schedule")
+	}
+
+	assert.Equal(t, ErrNotFound, s.Trigger("missing"))
+
+	require.NoError(t, s.Trigger("failing"))
+	assert.Equal(t, "failing", <-ran)
+
+	require.NoError(t, s.Trigger("blocking"))
+	assert.Equal(t, "blocking", <-ran)
+	assert.Equal(t, ErrRunning, s.Trigger("blocking"))
+	close(block)
+
+	assert.Eventually(t, func() bool {
+		for _, st := range s.Stats() {
+			if st.Runs == 0 || st.Running {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := s.Stats()
+	require.Len(t, stats, 3)
+	assert.Equal(t, []string{"blocking", "every", "failing"}, []string{stats[0].Name, stats[1].Name, stats[2].Name})
+
+	assert.Equal(t, "never", stats[2].Schedule)
+	assert.Equal(t, int64(1), stats[2].Runs)
+	assert.Equal(t, int64(1), stats[2].Failures)
+	assert.Equal(t, "failed", stats[2].LastError)
+	assert.NotNil(t, stats[2].LastRun)
+	assert.Nil(t, stats[2].LastSuccess)
+	assert.True(t, stats[2].NextRun.IsZero())
+
+	assert.Equal(t, "@every 1s", stats[1].Schedule)
+	assert.Zero(t, stats[1].Failures)
+	assert.NotNil(t, stats[1].LastSuccess)
+	assert.False(t, stats[1].NextRun.IsZero())
+
+	mu.Lock()
+	assert.Equal(t, []string{"failing: failed"}, errs)
+	mu.Unlock()
+}
+
+func TestScheduler_Close(t *testing.T) {
+	s := New(nil)
+
+	started := make(chan struct{})
+	var cancelled bool
+	s.Add("blocking", never{}, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		cancelled = true
+		return ctx.Err()
+	})
+
+	s.Start()
+	require.NoError(t, s.Trigger("blocking"))
+	<-started
+
+	s.Close()
+	assert.True(t, cancelled, "must cancel the runs in progress")
+}
+
+func TestScheduler_Wake(t *testing.T) {
+	s := New(nil)
+
+	ran := make(chan struct{}, 10)
+	block := make(chan struct{})
+	s.Add("blocking", never{}, func(ctx context.Context) error {
+		ran <- struct{}{}
+		<-block
+		return nil
+	})
+	assert.Equal(t, ErrNotFound, s.Wake("missing"))
+
+	// woken before the start
+	require.NoError(t, s.Wake("blocking"))
+	s.Start()
+	defer s.Close()
+	<-ran
+
+	require.NoError(t, s.Wake("blocking"))
+	require.NoError(t, s.Wake("blocking"))
+	close(block)
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("must run again once the run in progress ends")
+	}
+
+	assert.Eventually(t, func() bool { return !s.Stats()[0].Running }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(2), s.Stats()[0].Runs, "must merge the wakes requested during a run")
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// Disk is a Storage keeping the files in a local directory. It is safe for concurrent use, but
+// its files are not shared with the instances of the application running on other hosts.
+type Disk struct {
+	dir string
+}
+
+// NewDisk creates a Disk storage keeping the files in dir, which is created if needed.
+func NewDisk(dir string) (*Disk, error) {
+	if dir == "" {
+		return nil, wrap("the storage directory is required", nil)
+	}
+
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, wrap("could not create the storage directory", err)
+	}
+
+	return &Disk{dir: dir}, nil
+}
+
+// path returns the path of the file stored with key.
+func (d *Disk) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", wrap("invalid storage key "+key, nil)
+	}
+
+	return filepath.Join(d.dir, filepath.FromSlash(key)), nil
+}
+
+// Put implements Storage.Put. The file is written to a temporary file first, so a file is
+// never read partially written.
+func (d *Disk) Put(key string, content io.Reader, size int64, contentType string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return wrap("could not create the directory of the file", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return wrap("could not create file", err)
+	}
+	defer os.Remove(f.Name())
+
+	n, err := io.Copy(f, io.LimitReader(content, size))
+	if err == nil && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		f.Close()
+		return wrap("could not write file", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return wrap("could not write file", err)
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return wrap("could not store file", err)
+	}
+
+	return nil
+}
+
+// Get implements Storage.Get.
+func (d *Disk) Get(key string) (io.ReadCloser, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if xerrors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, wrap("could not open file", err)
+	}
+
+	return f, nil
+}
+
+// Delete implements Storage.Delete.
+func (d *Disk) Delete(key string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !xerrors.Is(err, os.ErrNotExist) {
+		return wrap("could not delete file", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDisk(filepath.Join(dir, "files"))
+	require.NoError(t, err)
+
+	_, err = d.Get("a/b.txt")
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+
+	require.NoError(t, d.Put("a/b.txt", strings.NewReader("hello world"), 5, "text/plain"))
+
+	f, err := d.Get("a/b.txt")
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b), "must only store size bytes")
+
+	t.Run("short", func(t *testing.T) {
+		assert.Error(t, d.Put("a/c.txt", strings.NewReader("hi"), 5, "text/plain"))
+		_, err := d.Get("a/c.txt")
+		assert.True(t, xerrors.Is(err, ErrNotFound), "must not keep partial files")
+
+		entries, err := os.ReadDir(filepath.Join(dir, "files", "a"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "must remove the temporary files")
+	})
+
+	t.Run("invalidKey", func(t *testing.T) {
+		assert.Error(t, d.Put("../escape.txt", strings.NewReader("x"), 1, "text/plain"))
+		_, err := os.Stat(filepath.Join(dir, "escape.txt"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	require.NoError(t, d.Delete("a/b.txt"))
+	require.NoError(t, d.Delete("a/b.txt"), "missing files must be ignored")
+	_, err = d.Get("a/b.txt")
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/xerrors"
+)
+
+// s3Timeout is the timeout of the requests sent to S3.
+const s3Timeout = 30 * time.Second
+
+// S3 is a Storage keeping the files in an S3 bucket, or in a bucket of any service compatible
+// with S3, which allows sharing the files between the instances of the application. It is safe
+// for concurrent use.
+type S3 struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewS3 creates an S3 storage from a URL with the format
+// "s3://[access_key:secret_key@]bucket[/prefix][?region=region&endpoint=url]". Every key is
+// prefixed with prefix, which allows sharing a bucket with other applications. The endpoint
+// selects a service compatible with S3, like MinIO, whose buckets are addressed by path.
+//
+// The credentials and the region not set in the URL are read as by the AWS command line
+// interface, from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION environment
+// variables, the shared configuration files or the role of the instance.
+func NewS3(rawurl string) (*S3, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, wrap("invalid S3 URL", err)
+	}
+
+	var opts []func(*config.LoadOptions) error
+	if region := u.Query().Get("region"); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if u.User != nil {
+		secret, _ := u.User.Password()
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(u.User.Username(), secret, "")))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, wrap("could not load the AWS configuration", err)
+	}
+
+	endpoint := u.Query().Get("endpoint")
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+// key returns the key of the object of the file stored with key.
+func (s *S3) key(key string) (*string, error) {
+	if !validKey(key) {
+		return nil, wrap("invalid storage key "+key, nil)
+	}
+
+	return aws.String(s.prefix + key), nil
+}
+
+// Put implements Storage.Put. The content is read in memory first if it is not an
+// io.ReadSeeker, which S3 needs to sign the requests sent without TLS and to retry them.
+func (s *S3) Put(key string, content io.Reader, size int64, contentType string) error {
+	k, err := s.key(key)
+	if err != nil {
+		return err
+	}
+
+	body, ok := content.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(io.LimitReader(content, size))
+		if err != nil {
+			return wrap("could not read file", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           k,
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return wrap("S3 PutObject failed", err)
+	}
+
+	return nil
+}
+
+// Get implements Storage.Get.
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	k, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the body is read after returning, so the request is not cancelled
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    k,
+	})
+	if nsk := (*types.NoSuchKey)(nil); xerrors.As(err, &nsk) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, wrap("S3 GetObject failed", err)
+	}
+
+	return out.Body, nil
+}
+
+// Delete implements Storage.Delete.
+func (s *S3) Delete(key string) error {
+	k, err := s.key(key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    k,
+	})
+	if err != nil {
+		return wrap("S3 DeleteObject failed", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// fakeS3 serves the objects of the S3 API used by S3, addressed by path.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		b, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(b)
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case "GET":
+		v, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		io.WriteString(w, v)
+	case "DELETE":
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: map[string]string{}, types: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	s, err := NewS3("s3://key:secret@bucket/uploads/?region=eu-west-1&endpoint=" + srv.URL)
+	require.NoError(t, err)
+
+	_, err = s.Get("a/b.png")
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+
+	require.NoError(t, s.Put("a/b.png", strings.NewReader("image"), 5, "image/png"))
+	assert.Equal(t, "image", fake.objects["/bucket/uploads/a/b.png"])
+	assert.Equal(t, "image/png", fake.types["/bucket/uploads/a/b.png"])
+
+	t.Run("unseekable", func(t *testing.T) {
+		require.NoError(t, s.Put("a/c.png", io.MultiReader(strings.NewReader("image")), 5, "image/png"))
+		assert.Equal(t, "image", fake.objects["/bucket/uploads/a/c.png"])
+	})
+
+	f, err := s.Get("a/b.png")
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(b))
+
+	require.NoError(t, s.Delete("a/b.png"))
+	_, err = s.Get("a/b.png")
+	assert.True(t, xerrors.Is(err, ErrNotFound))
+
+	assert.Error(t, s.Put("../b.png", strings.NewReader("image"), 5, "image/png"))
+
+	t.Run("invalidURL", func(t *testing.T) {
+		_, err := NewS3("s3:///prefix")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,87 @@
+/*
+Package storage implements the stores of the files uploaded to the application, like the
+attachments of the ratings.
+
+Two implementations of Storage are provided: Disk, which keeps the files in a local directory, and
+S3, which keeps them in an S3 bucket, or any compatible service, so they are shared by multiple
+instances of the application. New selects one of them from a URL.
+*/
+package storage
+
+import (
+	"io"
+	"net/url"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+	"golang.org/x/xerrors"
+)
+
+var (
+	wrap = errors.Wrapper("storage")
+)
+
+// ErrNotFound is returned when no file is stored with a key.
+var ErrNotFound = xerrors.New("storage: file not found")
+
+// Storage defines a store of files by key. Keys are made of letters, digits, dashes, dots and
+// underscores, and may be split in directories with slashes.
+type Storage interface {
+	// Put stores size bytes read from content with key, replacing any previous file.
+	Put(key string, content io.Reader, size int64, contentType string) error
+
+	// Get opens the file stored with key, which must be closed once read. ErrNotFound is
+	// returned if there is none.
+	Get(key string) (io.ReadCloser, error)
+
+	// Delete removes the file stored with key. Missing files are ignored.
+	Delete(key string) error
+}
+
+// New creates a Storage from a URL, which is either "file:///path/to/dir" to keep the files in
+// a local directory, see NewDisk, or "s3://bucket[/prefix]" to keep them in an S3 bucket, see
+// NewS3.
+func New(rawurl string) (Storage, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, wrap("invalid storage URL", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewDisk(u.Path)
+	case "s3":
+		return NewS3(rawurl)
+	}
+
+	return nil, wrap("unsupported storage URL scheme "+u.Scheme, nil)
+}
+
+// validKey tells whether key can be used to store a file, which keeps the files of Disk in its
+// directory.
+func validKey(key string) bool {
+	if key == "" || key[0] == '/' || key[len(key)-1] == '/' {
+		return false
+	}
+
+	prev := byte('/')
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		case c == '.':
+			// dot-only segments, like "..", are not allowed
+			if prev == '/' && (i+1 == len(key) || key[i+1] == '.' || key[i+1] == '/') {
+				return false
+			}
+		case c == '/':
+			if prev == '/' {
+				return false
+			}
+		default:
+			return false
+		}
+		prev = c
+	}
+
+	return true
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := New("file://" + dir)
+	require.NoError(t, err)
+	assert.IsType(t, &Disk{}, s)
+
+	s, err = New("s3://key:secret@bucket/prefix?region=eu-west-1")
+	require.NoError(t, err)
+	assert.IsType(t, &S3{}, s)
+
+	_, err = New("ftp://files")
+	assert.Error(t, err)
+}
+
+func TestValidKey(t *testing.T) {
+	var cases = []struct {
+		key   string
+		valid bool
+	}{
+		{"a1b2.png", true},
+		{"ratings/10/a1b2_c-3.png", true},
+		{".hidden", true},
+		{"", false},
+		{"/abs", false},
+		{"dir/", false},
+		{"a//b", false},
+		{"..", false},
+		{"a/../b", false},
+		{"a/./b", false},
+		{"a/b/..", false},
+		{"spaced name", false},
+		{`back\slash`, false},
+	}
+
+	for _, cs := range cases {
+		assert.Equal(t, cs.valid, validKey(cs.key), cs.key)
+	}
+}
@@ -0,0 +1,70 @@
+package testsupport
+
+import (
+	"context"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"golang.org/x/xerrors"
+)
+
+// postgresImage is the image of the test Postgres containers, matching the
+// version of docker-compose.
+const postgresImage = "postgres:9.6-alpine"
+
+// startPostgres starts a disposable Postgres container, returning the DSL of
+// its maintenance database and a function stopping it. The container is also
+// removed by the reaper of testcontainers if the tests do not stop it.
+//
+// ErrNoServer is returned if Docker is not running.
+func startPostgres() (string, func(), error) {
+	ctx := context.Background()
+
+	err := checkDocker(ctx)
+	if err != nil {
+		return "", nil, xerrors.Errorf("could not reach Docker (%v): %w", err, ErrNoServer)
+	}
+
+	c, err := postgres.Run(ctx, postgresImage,
+		postgres.WithDatabase("postgres"),
+		postgres.WithUsername("ratingsapp"),
+		postgres.WithPassword("ratingspassword"),
+		testcontainers.WithWaitStrategy(
+			// the server restarts once initialised
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+	if err != nil {
+		return "", nil, xerrors.Errorf("could not start Postgres container: %w", err)
+	}
+
+	dsl, err := c.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		testcontainers.TerminateContainer(c)
+		return "", nil, xerrors.Errorf("could not get Postgres container address: %w", err)
+	}
+
+	return dsl, func() { testcontainers.TerminateContainer(c) }, nil
+}
+
+// checkDocker returns an error if the Docker daemon cannot be reached.
+func checkDocker(ctx context.Context) (err error) {
+	// the provider panics when no Docker host can be found
+	defer func() {
+		if r := recover(); r != nil {
+			err = xerrors.Errorf("%v", r)
+		}
+	}()
+
+	p, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		return err
+	}
+
+	// Health closes the provider
+	return p.Health(ctx)
+}
@@ -0,0 +1,284 @@
+// Package testsupport provides disposable Postgres databases to the tests that
+// need one.
+//
+// The databases are created on the server of the RATINGSAPP_POSTGRES_TEST_DSL
+// environment variable if it is set, or otherwise on a Postgres container
+// started with testcontainers-go, which requires Docker. Tests requiring a
+// database are skipped if there is no server.
+//
+// Each test gets its own database, cloned from a template database migrated
+// once per test binary, so tests do not see each other's data, the existing
+// databases of the server are never modified and tests can run in parallel.
+// Tests can also run in a transaction rolled back when they are done, see Tx.
+//
+// Packages using testsupport declare a TestMain calling Main, which removes the
+// databases and the container when the tests are done:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(testsupport.Main(m, migrate))
+//	}
+package testsupport
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres" // gorm's postgres support
+	"golang.org/x/xerrors"
+)
+
+// DSLEnv is the environment variable with the DSL of the Postgres server used
+// by the tests, instead of a container.
+const DSLEnv = "RATINGSAPP_POSTGRES_TEST_DSL"
+
+// ErrNoServer is returned when there is no Postgres server to create the test
+// databases on.
+var ErrNoServer = xerrors.New("no test Postgres server: set " + DSLEnv + " or run Docker")
+
+var (
+	// migrateFunc is run on the template database, as set by Main.
+	migrateFunc func(*gorm.DB) error
+
+	setupOnce sync.Once
+	setupErr  error
+
+	// server is the connection to the maintenance database of the server,
+	// used to create and drop the databases.
+	server    *sql.DB
+	serverDSL string
+	stopFunc  func()
+
+	// prefix is the prefix of the names of the databases of the test
+	// binary, and also the name of its template database.
+	prefix string
+	count  int64
+
+	// createMu serialises the creation of the databases, as Postgres
+	// refuses to copy a template database accessed by another session.
+	createMu sync.Mutex
+
+	dropMu  sync.Mutex
+	dropped []string
+)
+
+// Main runs the tests of m, migrating the template database with migrate, and
+// removes the databases and the container created for the tests. The exit code
+// of the tests is returned.
+func Main(m *testing.M, migrate func(*gorm.DB) error) int {
+	migrateFunc = migrate
+	defer Teardown()
+
+	return m.Run()
+}
+
+// Teardown drops the databases created by NewDatabase and the template
+// database, and stops the Postgres container. It is called by Main, and only
+// needs to be called by the tests running their own TestMain.
+func Teardown() {
+	if server == nil {
+		return
+	}
+
+	dropMu.Lock()
+	names := append(dropped, prefix)
+	dropped = nil
+	dropMu.Unlock()
+
+	for _, name := range names {
+		server.Exec("DROP DATABASE IF EXISTS " + name)
+	}
+	server.Close()
+	server = nil
+
+	if stopFunc != nil {
+		stopFunc()
+	}
+}
+
+// setup connects to the test server, starting a container if needed, and
+// creates the template database.
+func setup() error {
+	setupOnce.Do(func() {
+		serverDSL = os.Getenv(DSLEnv)
+		if serverDSL == "" {
+			serverDSL, stopFunc, setupErr = startPostgres()
+			if setupErr != nil {
+				return
+			}
+		}
+
+		server, setupErr = sql.Open("postgres", serverDSL)
+		if setupErr != nil {
+			setupErr = xerrors.Errorf("could not connect to the test server: %w", setupErr)
+			return
+		}
+
+		prefix = fmt.Sprintf("ratingsapp_test_%d", os.Getpid())
+		_, setupErr = server.Exec("CREATE DATABASE " + prefix)
+		if setupErr != nil {
+			setupErr = xerrors.Errorf("could not create the template database: %w", setupErr)
+			return
+		}
+
+		if migrateFunc == nil {
+			return
+		}
+
+		var db *gorm.DB
+		db, setupErr = gorm.Open("postgres", withDatabase(serverDSL, prefix))
+		if setupErr != nil {
+			setupErr = xerrors.Errorf("could not connect to the template database: %w", setupErr)
+			return
+		}
+		defer db.Close()
+
+		setupErr = migrateFunc(db)
+		if setupErr != nil {
+			setupErr = xerrors.Errorf("could not migrate the template database: %w", setupErr)
+		}
+	})
+
+	return setupErr
+}
+
+// createDatabase creates a database, empty or as a copy of the template
+// database, returning its name.
+func createDatabase(template bool) (string, error) {
+	err := setup()
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s_%d", prefix, atomic.AddInt64(&count, 1))
+	query := "CREATE DATABASE " + name
+	if template {
+		query += " TEMPLATE " + prefix
+	}
+
+	createMu.Lock()
+	defer createMu.Unlock()
+
+	_, err = server.Exec(query)
+	if err != nil {
+		return "", xerrors.Errorf("could not create test database: %w", err)
+	}
+
+	return name, nil
+}
+
+// NewDatabase creates a migrated database that is dropped by Teardown, and
+// returns its DSL. It is meant for the databases shared by all the tests of a
+// package, see Database for the databases of a single test.
+//
+// ErrNoServer is returned if there is no server to create it on.
+func NewDatabase() (string, error) {
+	name, err := createDatabase(true)
+	if err != nil {
+		return "", err
+	}
+
+	dropMu.Lock()
+	dropped = append(dropped, name)
+	dropMu.Unlock()
+
+	return withDatabase(serverDSL, name), nil
+}
+
+// Database creates a migrated database for t, dropped when t is done, and
+// returns its DSL. t is skipped if there is no server to create it on.
+//
+// The connections to the database must be closed by the end of t.
+func Database(t *testing.T) string {
+	return database(t, true)
+}
+
+// EmptyDatabase creates an empty database for t, like Database, for the tests
+// of the migrations themselves.
+func EmptyDatabase(t *testing.T) string {
+	return database(t, false)
+}
+
+func database(t *testing.T, template bool) string {
+	t.Helper()
+
+	name, err := createDatabase(template)
+	if xerrors.Is(err, ErrNoServer) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, err := server.Exec("DROP DATABASE IF EXISTS " + name)
+		if err != nil {
+			t.Logf("testsupport: could not drop database %s: %v", name, err)
+		}
+	})
+
+	return withDatabase(serverDSL, name)
+}
+
+// Open connects to the database of dsl, closing the connection when t is done.
+func Open(t *testing.T, dsl string) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open("postgres", dsl)
+	if err != nil {
+		t.Fatalf("testsupport: could not connect to the test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// uncomment this line to see helpful SQL output
+	// db.LogMode(true)
+
+	return db
+}
+
+// DB connects to a migrated database created for t, see Database.
+func DB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	return Open(t, Database(t))
+}
+
+// Tx begins a transaction on db, rolled back when t is done, so nothing written
+// by t is kept. It is cheaper than a database per test for the tests only
+// reading and writing data through one connection.
+//
+// As in any Postgres transaction, the statements following a failed one fail
+// too: the tests expecting database errors outside of a transaction of their
+// own, and those relying on other connections seeing their data, must use a
+// database of their own instead.
+func Tx(t *testing.T, db *gorm.DB) *gorm.DB {
+	t.Helper()
+
+	tx := db.Begin()
+	if err := tx.Error; err != nil {
+		t.Fatalf("testsupport: could not begin transaction: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+
+	return tx
+}
+
+// withDatabase returns dsl connecting to the database name instead, for both
+// the URL and the key/value forms of the DSLs.
+func withDatabase(dsl, name string) string {
+	if strings.HasPrefix(dsl, "postgres://") || strings.HasPrefix(dsl, "postgresql://") {
+		u, err := url.Parse(dsl)
+		if err == nil {
+			u.Path = "/" + name
+			return u.String()
+		}
+	}
+
+	// for key/value DSLs, the last value of a key is used
+	return dsl + " dbname=" + name
+}
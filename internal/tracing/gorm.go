@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// gormContextKey is the gorm setting holding the context of the
+	// queries, see WithContext.
+	gormContextKey = "tracing:context"
+
+	// gormSpanKey is the gorm instance setting holding the span of the
+	// query in progress.
+	gormSpanKey = "tracing:span"
+)
+
+// InstrumentGorm records a span for each query run with db or the handles
+// derived from it, including their SQL statement and table. The queries run
+// with a handle returned by WithContext are children of the span in its
+// context. Raw statements run with Exec are not recorded.
+func InstrumentGorm(db *gorm.DB, t *Tracer) {
+	if t == nil {
+		return
+	}
+
+	cb := db.Callback()
+	cb.Create().Before("gorm:create").Register("tracing:before_create", t.beforeQuery("INSERT"))
+	cb.Create().After("gorm:create").Register("tracing:after_create", afterQuery)
+	cb.Query().Before("gorm:query").Register("tracing:before_query", t.beforeQuery("SELECT"))
+	cb.Query().After("gorm:query").Register("tracing:after_query", afterQuery)
+	cb.Update().Before("gorm:update").Register("tracing:before_update", t.beforeQuery("UPDATE"))
+	cb.Update().After("gorm:update").Register("tracing:after_update", afterQuery)
+	cb.Delete().Before("gorm:delete").Register("tracing:before_delete", t.beforeQuery("DELETE"))
+	cb.Delete().After("gorm:delete").Register("tracing:after_delete", afterQuery)
+	cb.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", t.beforeQuery("SELECT"))
+	cb.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", afterQuery)
+}
+
+// WithContext returns a handle of db whose queries are children of the span in
+// ctx, like the span of the request they are run for. The transactions begun
+// with the handle keep the context. The queries run with db itself are the
+// roots of their own traces.
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(gormContextKey, ctx)
+}
+
+// beforeQuery returns a callback starting the span of a query of the type op.
+func (t *Tracer) beforeQuery(op string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		ctx := context.Background()
+		if v, ok := scope.Get(gormContextKey); ok {
+			ctx = v.(context.Context)
+		}
+
+		table := scope.TableName()
+		_, s := t.Start(ctx, op+" "+table, KindClient)
+		s.SetAttribute("db.system", "postgresql")
+		s.SetAttribute("db.operation", op)
+		s.SetAttribute("db.sql.table", table)
+		scope.InstanceSet(gormSpanKey, s)
+	}
+}
+
+// afterQuery ends the span started by beforeQuery.
+func afterQuery(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+
+	s := v.(*Span)
+	s.SetAttribute("db.statement", scope.SQL)
+	if scope.HasError() && !xerrors.Is(scope.DB().Error, gorm.ErrRecordNotFound) {
+		s.SetError(scope.DB().Error)
+	}
+	s.End()
+}
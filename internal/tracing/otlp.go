@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans started by the application.
+const instrumentationName = "github.com/noelruault/ratingsapp"
+
+// newOTLPExporter creates an exporter sending the spans in batches to the
+// OTLP/HTTP receiver at c.Endpoint.
+func newOTLPExporter(c Config) (exporter, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, wrap("invalid endpoint "+c.Endpoint, err)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	exp, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, wrap("could not create the OTLP exporter", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", c.ServiceName))),
+	)
+
+	return &otlpExporter{
+		provider: tp,
+		tracer:   tp.Tracer(instrumentationName),
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	}, nil
+}
+
+type otlpExporter struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// spanKinds maps each Kind to its OpenTelemetry equivalent.
+var spanKinds = map[Kind]trace.SpanKind{
+	KindInternal: trace.SpanKindInternal,
+	KindServer:   trace.SpanKindServer,
+	KindClient:   trace.SpanKindClient,
+}
+
+func (e *otlpExporter) start(ctx context.Context, name string, kind Kind) (context.Context, span) {
+	ctx, s := e.tracer.Start(ctx, name, trace.WithSpanKind(spanKinds[kind]))
+	return ctx, otlpSpan{s}
+}
+
+func (e *otlpExporter) extract(ctx context.Context, h http.Header) context.Context {
+	return e.propagator.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+func (e *otlpExporter) shutdown(ctx context.Context) error {
+	return e.provider.Shutdown(ctx)
+}
+
+type otlpSpan struct {
+	s trace.Span
+}
+
+func (s otlpSpan) setAttribute(key string, value interface{}) {
+	var kv attribute.KeyValue
+	switch v := value.(type) {
+	case string:
+		kv = attribute.String(key, v)
+	case bool:
+		kv = attribute.Bool(key, v)
+	case int:
+		kv = attribute.Int(key, v)
+	case int64:
+		kv = attribute.Int64(key, v)
+	case float64:
+		kv = attribute.Float64(key, v)
+	default:
+		kv = attribute.String(key, fmt.Sprint(v))
+	}
+
+	s.s.SetAttributes(kv)
+}
+
+func (s otlpSpan) setError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s otlpSpan) end() {
+	s.s.End()
+}
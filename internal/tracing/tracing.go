@@ -0,0 +1,159 @@
+/*
+Package tracing records spans of the HTTP requests served and of the database queries they run,
+so slow queries can be attributed to the endpoints that ran them.
+
+Spans are exported to an OpenTelemetry collector with OTLP over HTTP, using the OpenTelemetry SDK. A
+nil *Tracer is valid and records nothing, and a Recorder keeps the spans in memory for tests.
+*/
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+)
+
+var (
+	wrap = errors.Wrapper("tracing")
+)
+
+// Kind tells the role of a span in a trace.
+type Kind int
+
+const (
+	// KindInternal spans are operations within the application.
+	KindInternal Kind = iota
+
+	// KindServer spans are requests served by the application.
+	KindServer
+
+	// KindClient spans are requests to other services, like the database.
+	KindClient
+)
+
+// Config defines how spans are exported.
+type Config struct {
+	// Endpoint is the URL of the OTLP/HTTP receiver of an OpenTelemetry
+	// collector, like http://localhost:4318. The path defaults to
+	// /v1/traces, and plain HTTP is used with the http scheme.
+	Endpoint string
+
+	// ServiceName identifies the application in the traces.
+	ServiceName string
+}
+
+// exporter records the spans of a Tracer. Implementations must be safe for
+// concurrent use.
+type exporter interface {
+	// start starts a span as a child of the span in ctx, if any, and
+	// returns a context holding the new span.
+	start(ctx context.Context, name string, kind Kind) (context.Context, span)
+
+	// extract returns ctx with the remote span context propagated in h,
+	// if any.
+	extract(ctx context.Context, h http.Header) context.Context
+
+	// shutdown exports the pending spans and releases the resources of
+	// the exporter.
+	shutdown(ctx context.Context) error
+}
+
+// span is a span started by an exporter.
+type span interface {
+	setAttribute(key string, value interface{})
+	setError(err error)
+	end()
+}
+
+// A Tracer starts spans. A nil *Tracer is valid and records nothing.
+type Tracer struct {
+	exp exporter
+}
+
+// New creates a Tracer exporting the spans as defined by c.
+func New(c Config) (*Tracer, error) {
+	if c.Endpoint == "" {
+		return nil, wrap("the endpoint is required", nil)
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = "ratingsapp"
+	}
+
+	exp, err := newOTLPExporter(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tracer{exp: exp}, nil
+}
+
+// Start starts a span named name, as a child of the span in ctx if there is
+// one. The returned context holds the new span, which must be ended.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	ctx, s := t.exp.start(ctx, name, kind)
+	return ctx, &Span{s: s}
+}
+
+// Extract returns ctx with the span context propagated by a client in the
+// headers h, like W3C's traceparent, so the spans started with it belong to
+// the trace of the client.
+func (t *Tracer) Extract(ctx context.Context, h http.Header) context.Context {
+	if t == nil {
+		return ctx
+	}
+
+	return t.exp.extract(ctx, h)
+}
+
+// Shutdown exports the spans not exported yet, waiting until ctx is done at
+// most.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	err := t.exp.shutdown(ctx)
+	if err != nil {
+		return wrap("could not shut down the exporter", err)
+	}
+
+	return nil
+}
+
+// A Span records an operation. A nil *Span is valid and records nothing.
+type Span struct {
+	s span
+}
+
+// SetAttribute attaches a value to the span, which is either a string, a bool,
+// an int, an int64 or a float64. Other values are recorded as strings.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.s.setAttribute(key, value)
+}
+
+// SetError marks the span as failed with err.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.s.setError(err)
+}
+
+// End ends the span.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.s.end()
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testsupport.Main(m, nil))
+}
+
+func TestTracer(t *testing.T) {
+	tracer, rec := NewRecorder()
+
+	ctx, parent := tracer.Start(context.Background(), "parent", KindServer)
+	_, child := tracer.Start(ctx, "child", KindClient)
+	child.SetAttribute("db.operation", "SELECT")
+	child.SetError(errors.New("boom"))
+	child.End()
+	parent.SetError(nil)
+	parent.End()
+
+	assert.Equal(t, []RecordedSpan{
+		{Name: "child", Kind: KindClient, Parent: "parent", Attributes: map[string]interface{}{"db.operation": "SELECT"}, Err: errors.New("boom")},
+		{Name: "parent", Kind: KindServer, Attributes: map[string]interface{}{}},
+	}, rec.Spans())
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+
+	ctx, span := tracer.Start(context.Background(), "noop", KindInternal)
+	assert.Equal(t, context.Background(), ctx)
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("boom"))
+	span.End()
+
+	assert.Equal(t, context.Background(), tracer.Extract(context.Background(), nil))
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+
+	_, err = New(Config{Endpoint: "localhost:4318"})
+	assert.Error(t, err, "the scheme is required")
+}
+
+func TestNew_Export(t *testing.T) {
+	var paths []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		paths = append(paths, r.Method+" "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	tracer, err := New(Config{Endpoint: srv.URL})
+	require.NoError(t, err)
+
+	_, span := tracer.Start(context.Background(), "GET /api/v1/ratings/:id", KindServer)
+	span.SetAttribute("http.status_code", 200)
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"POST /v1/traces"}, paths)
+}
+
+func TestInstrumentGorm(t *testing.T) {
+	db := testsupport.DB(t)
+
+	tracer, rec := NewRecorder()
+	InstrumentGorm(db, tracer)
+
+	type tracingTest struct {
+		ID int64
+	}
+	require.NoError(t, db.DropTableIfExists(&tracingTest{}).Error)
+	require.NoError(t, db.CreateTable(&tracingTest{}).Error)
+	defer db.DropTable(&tracingTest{})
+
+	ctx, req := tracer.Start(context.Background(), "GET /", KindServer)
+	require.NoError(t, WithContext(db, ctx).Create(&tracingTest{ID: 1}).Error)
+	req.End()
+
+	var found tracingTest
+	assert.Error(t, db.First(&found, 404).Error)
+
+	spans := rec.Spans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "INSERT tracing_tests", spans[0].Name)
+	assert.Equal(t, "GET /", spans[0].Parent)
+	assert.Contains(t, spans[0].Attributes["db.statement"], "INSERT INTO")
+	assert.Equal(t, "SELECT tracing_tests", spans[2].Name)
+	assert.Empty(t, spans[2].Parent)
+	assert.NoError(t, spans[2].Err, "missing records are not errors")
+}
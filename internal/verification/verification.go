@@ -0,0 +1,100 @@
+/*
+Package verification implements the transaction verifiers telling whether the users completed a
+transaction with the targets they rate, see models.TransactionVerifier.
+
+HTTP asks the transactions service of the platform, like the order service of a delivery app: the
+user and the target are sent as the user and target query parameters of a GET request, which is
+answered with {"completed": true} if the user completed a transaction with the target.
+*/
+package verification
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/errors"
+)
+
+var (
+	wrap = errors.Wrapper("verification")
+)
+
+// DefaultTimeout is the time a request to the transactions service can take.
+const DefaultTimeout = 5 * time.Second
+
+// HTTP asks a transactions service whether the users completed a transaction
+// with the targets.
+type HTTP struct {
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+// NewHTTP creates an HTTP verifier for the transactions service at endpoint,
+// like https://orders.example.com/v1/completed, authenticating with the bearer
+// token key, if not empty. The requests taking longer than timeout, or
+// DefaultTimeout if it is zero, are given up.
+func NewHTTP(endpoint, key string, timeout time.Duration) (*HTTP, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, wrap("invalid verification endpoint", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, wrap("verification endpoint must use the http or https scheme", nil)
+	}
+	if u.RawQuery != "" {
+		return nil, wrap("verification endpoint can't have a query", nil)
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &HTTP{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		key:      key,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Completed asks the transactions service whether the user with ID userID
+// completed a transaction with target. Any status other than 2xx is an error.
+func (h *HTTP) Completed(userID, target int64) (bool, error) {
+	q := url.Values{}
+	q.Set("user", strconv.FormatInt(userID, 10))
+	q.Set("target", strconv.FormatInt(target, 10))
+
+	req, err := http.NewRequest(http.MethodGet, h.endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return false, wrap("invalid verification request", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "ratingsapp")
+	if h.key != "" {
+		req.Header.Set("Authorization", "Bearer "+h.key)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false, wrap("could not reach transactions service", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, wrap(fmt.Sprintf("transactions service responded %d", resp.StatusCode), nil)
+	}
+
+	var res struct {
+		Completed bool `json:"completed"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return false, wrap("invalid transactions service response", err)
+	}
+
+	return res.Completed, nil
+}
@@ -0,0 +1,63 @@
+package verification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ models.TransactionVerifier = (*HTTP)(nil)
+
+func TestNewHTTP(t *testing.T) {
+	h, err := NewHTTP("https://orders.test.com/v1/completed/", "sk_test", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "https://orders.test.com/v1/completed", h.endpoint)
+	assert.Equal(t, DefaultTimeout, h.client.Timeout)
+
+	_, err = NewHTTP("ftp://orders.test.com", "", 0)
+	assert.Error(t, err)
+
+	_, err = NewHTTP("https://orders.test.com/v1/completed?status=delivered", "", 0)
+	assert.Error(t, err)
+}
+
+func TestHTTP_Completed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		assert.Equal(t, http.MethodGet, r.Method)
+
+		switch r.URL.Query().Get("target") {
+		case "404":
+			w.WriteHeader(http.StatusNotFound)
+		case "500":
+			w.Write([]byte("not json"))
+		default:
+			json.NewEncoder(w).Encode(map[string]bool{
+				"completed": r.URL.Query().Get("user") == "1" && r.URL.Query().Get("target") == "9",
+			})
+		}
+	}))
+	defer srv.Close()
+
+	h, err := NewHTTP(srv.URL, "sk_test", 0)
+	require.NoError(t, err)
+
+	ok, err := h.Completed(1, 9)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Completed(2, 9)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = h.Completed(1, 404)
+	assert.Error(t, err, "must fail when the transactions service does not answer")
+
+	_, err = h.Completed(1, 500)
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package views
+
+import (
+	"encoding/json"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+// DeletedUserName is the first name of the placeholder the deleted authors of the ratings are
+// returned as, see Author.
+const DeletedUserName = "Deleted user"
+
+// Author is the author of a rating, as returned along with it: the user who wrote it, or a
+// placeholder if the user was deleted, which only keeps its ID, with DeletedUserName as first
+// name and a "deleted" field set to true. The placeholder is the same whatever happened to the
+// user, so the ratings of the users removed, deactivated or anonymised render alike.
+type Author struct {
+	*models.User
+
+	// Deleted marks the placeholder of a deleted user.
+	Deleted bool
+}
+
+// deletedAuthor is the JSON encoding of the placeholder of a deleted user.
+type deletedAuthor struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"firstName"`
+	Deleted   bool   `json:"deleted"`
+}
+
+// ResolveAuthor returns the author of a rating, given a, as read by models.RatingDB.Authors,
+// and u, the user who wrote it, which is nil if it could not be found. The placeholder of a
+// deleted user is returned if a tells so, or if u is nil.
+func ResolveAuthor(a models.RatingAuthor, u *models.User) *Author {
+	if a.Deleted || u == nil {
+		return &Author{User: &models.User{ID: a.UserID, FirstName: DeletedUserName}, Deleted: true}
+	}
+
+	return &Author{User: u}
+}
+
+// MarshalJSON encodes a as the user, or as the placeholder of a deleted user.
+func (a Author) MarshalJSON() ([]byte, error) {
+	if a.Deleted {
+		return json.Marshal(deletedAuthor{ID: a.User.ID, FirstName: DeletedUserName, Deleted: true})
+	}
+
+	return json.Marshal(a.User)
+}
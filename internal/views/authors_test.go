@@ -0,0 +1,36 @@
+package views
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveAuthor(t *testing.T) {
+	user := &models.User{ID: 7, Active: true, Email: "ana@test.com", FirstName: "Ana", RoleID: 2}
+
+	var cases = []struct {
+		name    string
+		author  models.RatingAuthor
+		user    *models.User
+		outjson string
+	}{
+		{"user", models.RatingAuthor{RatingID: 10, UserID: 7}, user,
+			`{"id":7,"active":true,"email":"ana@test.com","firstName":"Ana","lastName":"","roleId":2}`},
+		{"deleted", models.RatingAuthor{RatingID: 10, UserID: 7, Deleted: true}, user,
+			`{"id":7,"firstName":"Deleted user","deleted":true}`},
+		{"notFound", models.RatingAuthor{RatingID: 10, UserID: 7}, nil,
+			`{"id":7,"firstName":"Deleted user","deleted":true}`},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			b, err := json.Marshal(ResolveAuthor(cs.author, cs.user))
+			require.NoError(t, err)
+			assert.JSONEq(t, cs.outjson, string(b))
+		})
+	}
+}
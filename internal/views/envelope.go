@@ -0,0 +1,224 @@
+package views
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+)
+
+// ErrorFormat is the format of the error responses. The format of a request is set on its context
+// with SetErrorFormat, and is LegacyErrors if it is not set. The requests accepting the
+// application/problem+json media type get the ProblemErrors format in any case.
+type ErrorFormat int
+
+// The formats of the error responses.
+const (
+	// LegacyErrors returns the error code in an "error" field, along with the fields of a
+	// validation error in a "fields" field. The OAuth endpoints return the error codes of
+	// RFC 6749 instead, with an "error_description" field, see OAuthJSON.
+	LegacyErrors ErrorFormat = iota
+
+	// CompatibleErrors returns the fields of both LegacyErrors and EnvelopeErrors, so the
+	// clients can move to the envelope while the fields they read are still returned.
+	CompatibleErrors
+
+	// EnvelopeErrors returns every error in the same envelope: the error code in a "code"
+	// field, a message for the developers in a "message" field, the fields of a validation
+	// error in a "fields" field, along with their messages in a "fieldMessages" field, and the
+	// ID of the request in a "requestId" field, see SetRequestID. Unlike the codes, the
+	// messages may change between releases.
+	//
+	// The messages are in the language of the Accept-Language header of the request, English
+	// or Spanish, and in English without the header. They are left out if the request only
+	// accepts other languages.
+	EnvelopeErrors
+
+	// ProblemErrors returns the errors as the problem documents of RFC 7807, with the
+	// application/problem+json media type, so gateways and clients can handle them
+	// generically. Their "type" is the URI of their error code, see SetProblemTypeBase, their
+	// "title" the message of the code, and their "status" the HTTP status code of the
+	// response. The other fields of EnvelopeErrors are returned as extension members.
+	ProblemErrors
+)
+
+// problemMediaType is the media type of the problem documents of RFC 7807.
+const problemMediaType = "application/problem+json"
+
+// DefaultProblemTypeBase is the prefix of the type URIs of the problem documents, followed by
+// their error code, when no other is set with SetProblemTypeBase.
+const DefaultProblemTypeBase = "urn:ratingsapp:error:"
+
+// ErrUnknownErrorFormat is returned by ParseErrorFormat for an unknown format.
+var ErrUnknownErrorFormat = errors.New("views: unknown error format, must be legacy, compatible, envelope or problem")
+
+// ParseErrorFormat returns the format named s, which is "legacy", "compatible", "envelope" or
+// "problem". An empty s is LegacyErrors.
+func ParseErrorFormat(s string) (ErrorFormat, error) {
+	switch s {
+	case "", "legacy":
+		return LegacyErrors, nil
+	case "compatible":
+		return CompatibleErrors, nil
+	case "envelope":
+		return EnvelopeErrors, nil
+	case "problem":
+		return ProblemErrors, nil
+	}
+
+	return LegacyErrors, ErrUnknownErrorFormat
+}
+
+// SetErrorFormat sets the format of the errors returned to the request of c.
+func SetErrorFormat(c *gin.Context, f ErrorFormat) {
+	c.Set("errorFormat", f)
+}
+
+// SetProblemTypeBase sets the prefix of the type URIs of the problem documents returned to the
+// request of c, like "https://api.example.com/errors/", which is followed by their error code.
+// The URIs should resolve to the documentation of the errors, but don't have to.
+func SetProblemTypeBase(c *gin.Context, base string) {
+	c.Set("problemTypeBase", base)
+}
+
+// SetRequestID sets the ID of the request of c, returned in the error envelope.
+func SetRequestID(c *gin.Context, id string) {
+	c.Set("requestId", id)
+}
+
+// OAuthJSON returns a JSON document with an error response of the OAuth endpoints to a requester,
+// with an HTTP status code. In the LegacyErrors format, code is one of the error codes of RFC
+// 6749, returned in an "error" field, along with description, if not empty, in an
+// "error_description" field. In the EnvelopeErrors format, description is returned as the code
+// if it is not empty, as it is the code of the error of the models.
+func OAuthJSON(c *gin.Context, status int, code, description string) {
+	res := errorResponse{status: status, legacy: gin.H{"error": code}, code: code, fallback: code}
+	if description != "" {
+		res.legacy["error_description"] = description
+		res.code, res.fallback = description, description
+	}
+
+	res.abort(c)
+}
+
+// errorResponse is an error response, in any format.
+type errorResponse struct {
+	status int
+
+	// legacy is the body of the response in the LegacyErrors format.
+	legacy gin.H
+
+	// code is the code of the envelope, and fallback its message if no catalog has it.
+	code     string
+	fallback string
+
+	// fields are the invalid fields of a validation error.
+	fields models.ValidationError
+}
+
+// abort ends the request of c with the response r, in the error format of the request.
+func (r errorResponse) abort(c *gin.Context) {
+	var f ErrorFormat
+	if v, ok := c.Get("errorFormat"); ok {
+		f = v.(ErrorFormat)
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+	if acceptsProblem(c.GetHeader("Accept")) {
+		f = ProblemErrors
+	}
+	if f == LegacyErrors {
+		c.AbortWithStatusJSON(r.status, r.legacy)
+		return
+	}
+
+	data := gin.H{"code": r.code}
+	for k, v := range r.legacy {
+		if k != "error" && k != "error_description" {
+			data[k] = v
+		}
+	}
+
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	if lang := language(c); lang != "" {
+		c.Header("Content-Language", lang)
+		data["message"] = message(lang, r.code, r.fallback)
+
+		if len(r.fields) > 0 {
+			messages := make(map[string]string, len(r.fields))
+			for field, err := range r.fields {
+				messages[field] = message(lang, err.Public(), errorMessage(err))
+			}
+			data["fieldMessages"] = messages
+		}
+	}
+
+	if id := c.GetString("requestId"); id != "" {
+		data["requestId"] = id
+	}
+
+	switch f {
+	case CompatibleErrors:
+		data["error"] = r.legacy["error"]
+		if d, ok := r.legacy["error_description"]; ok {
+			data["error_description"] = d
+		}
+
+	case ProblemErrors:
+		base := DefaultProblemTypeBase
+		if b := c.GetString("problemTypeBase"); b != "" {
+			base = b
+		}
+
+		data["type"] = base + r.code
+		data["status"] = r.status
+		if m, ok := data["message"]; ok {
+			data["title"] = m
+			delete(data, "message")
+		}
+
+		c.Header("Content-Type", problemMediaType+"; charset=utf-8")
+	}
+
+	c.AbortWithStatusJSON(r.status, data)
+}
+
+// acceptsProblem tells whether the Accept header acc lists the media type of the problem
+// documents.
+func acceptsProblem(acc string) bool {
+	for _, mt := range strings.Split(acc, ",") {
+		params := strings.Split(mt, ";")
+		if strings.ToLower(strings.TrimSpace(params[0])) != problemMediaType {
+			continue
+		}
+
+		// a zero quality value means "not acceptable"
+		rejected := false
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if p == "q=0" || strings.HasPrefix(p, "q=0.") && strings.Trim(p[4:], "0") == "" {
+				rejected = true
+			}
+		}
+		if !rejected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorMessage returns the message of pe, the text that follows its error code in the messages of
+// the errors of the models, the middleware and the controllers, like "resource not found" in
+// "models: not_found, resource not found". The error code is returned for other errors.
+func errorMessage(pe models.PublicError) string {
+	code := pe.Public()
+
+	s := pe.Error()
+	i := strings.Index(s, ": "+code+", ")
+	if i < 0 {
+		return code
+	}
+
+	return s[i+len(code)+4:]
+}
@@ -0,0 +1,223 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestParseErrorFormat(t *testing.T) {
+	for s, f := range map[string]ErrorFormat{
+		"":           LegacyErrors,
+		"legacy":     LegacyErrors,
+		"compatible": CompatibleErrors,
+		"envelope":   EnvelopeErrors,
+		"problem":    ProblemErrors,
+	} {
+		out, err := ParseErrorFormat(s)
+		assert.NoError(t, err)
+		assert.Equal(t, f, out, s)
+	}
+
+	_, err := ParseErrorFormat("xml")
+	assert.Equal(t, ErrUnknownErrorFormat, err)
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var ev Error
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	var cases = []struct {
+		name      string
+		format    ErrorFormat
+		write     func(c *gin.Context)
+		outstatus int
+		outjson   string
+	}{
+		{
+			"envelope",
+			EnvelopeErrors,
+			func(c *gin.Context) { ev.JSON(c, models.ErrNotFound) },
+			http.StatusNotFound,
+			`{"code":"not_found","message":"resource not found","requestId":"req-1"}`,
+		},
+		{
+			"compatible",
+			CompatibleErrors,
+			func(c *gin.Context) { ev.JSON(c, models.ErrNotFound) },
+			http.StatusNotFound,
+			`{"error":"not_found","code":"not_found","message":"resource not found","requestId":"req-1"}`,
+		},
+		{
+			"legacy",
+			LegacyErrors,
+			func(c *gin.Context) { ev.JSON(c, models.ErrNotFound) },
+			http.StatusNotFound,
+			`{"error":"not_found"}`,
+		},
+		{
+			"validation",
+			EnvelopeErrors,
+			func(c *gin.Context) { ev.JSON(c, models.ValidationError{"email": models.ErrRequired}) },
+			http.StatusBadRequest,
+			`{
+				"code":"validation_error",
+				"message":"the request has invalid fields",
+				"fields":{"email":"required"},
+				"fieldMessages":{"email":"value cannot be empty"},
+				"requestId":"req-1"
+			}`,
+		},
+		{
+			"internal",
+			EnvelopeErrors,
+			func(c *gin.Context) { ev.JSON(c, xerrors.New("test error private")) },
+			http.StatusInternalServerError,
+			`{"code":"server_error","message":"internal server error","requestId":"req-1"}`,
+		},
+		{
+			"extra",
+			CompatibleErrors,
+			func(c *gin.Context) { ev.JSONWith(c, models.ErrNotFound, gin.H{"supported": []string{"v1"}}) },
+			http.StatusNotFound,
+			`{"error":"not_found","code":"not_found","message":"resource not found","requestId":"req-1","supported":["v1"]}`,
+		},
+		{
+			"oauthEnvelope",
+			EnvelopeErrors,
+			func(c *gin.Context) {
+				OAuthJSON(c, http.StatusBadRequest, "invalid_request", "credentials_not_provided")
+			},
+			http.StatusBadRequest,
+			`{"code":"credentials_not_provided","message":"username, password or refresh token are empty","requestId":"req-1"}`,
+		},
+		{
+			"oauthCompatible",
+			CompatibleErrors,
+			func(c *gin.Context) { OAuthJSON(c, http.StatusUnauthorized, "invalid_client", "") },
+			http.StatusUnauthorized,
+			`{"error":"invalid_client","code":"invalid_client","message":"the client authentication failed","requestId":"req-1"}`,
+		},
+		{
+			"oauthLegacy",
+			LegacyErrors,
+			func(c *gin.Context) {
+				OAuthJSON(c, http.StatusBadRequest, "invalid_request", "credentials_not_provided")
+			},
+			http.StatusBadRequest,
+			`{"error":"invalid_request","error_description":"credentials_not_provided"}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			SetErrorFormat(c, cs.format)
+			SetRequestID(c, "req-1")
+
+			cs.write(c)
+
+			assert.Equal(t, cs.outstatus, w.Code)
+			assert.JSONEq(t, cs.outjson, w.Body.String())
+		})
+	}
+}
+
+func TestErrorProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var ev Error
+	ev.SetCode(models.ErrNotFound, http.StatusNotFound)
+
+	var cases = []struct {
+		name     string
+		format   ErrorFormat
+		accept   string
+		typeBase string
+		write    func(c *gin.Context)
+		outjson  string
+	}{
+		{
+			"format",
+			ProblemErrors,
+			"",
+			"",
+			func(c *gin.Context) { ev.JSON(c, models.ErrNotFound) },
+			`{"type":"urn:ratingsapp:error:not_found","title":"resource not found","status":404,"code":"not_found","requestId":"req-1"}`,
+		},
+		{
+			"accept",
+			LegacyErrors,
+			"application/json, application/problem+json;q=0.5",
+			"https://api.example.com/errors/",
+			func(c *gin.Context) { ev.JSON(c, models.ErrNotFound) },
+			`{"type":"https://api.example.com/errors/not_found","title":"resource not found","status":404,"code":"not_found","requestId":"req-1"}`,
+		},
+		{
+			"validation",
+			ProblemErrors,
+			"",
+			"",
+			func(c *gin.Context) { ev.JSON(c, models.ValidationError{"email": models.ErrRequired}) },
+			`{
+				"type":"urn:ratingsapp:error:validation_error",
+				"title":"the request has invalid fields",
+				"status":400,
+				"code":"validation_error",
+				"fields":{"email":"required"},
+				"fieldMessages":{"email":"value cannot be empty"},
+				"requestId":"req-1"
+			}`,
+		},
+		{
+			"oauth",
+			ProblemErrors,
+			"",
+			"",
+			func(c *gin.Context) { OAuthJSON(c, http.StatusUnauthorized, "invalid_client", "") },
+			`{"type":"urn:ratingsapp:error:invalid_client","title":"the client authentication failed","status":401,"code":"invalid_client","requestId":"req-1"}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			c.Request.Header.Set("Accept", cs.accept)
+			SetErrorFormat(c, cs.format)
+			SetRequestID(c, "req-1")
+			if cs.typeBase != "" {
+				SetProblemTypeBase(c, cs.typeBase)
+			}
+
+			cs.write(c)
+
+			assert.Equal(t, "application/problem+json; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, cs.outjson, w.Body.String())
+		})
+	}
+}
+
+func TestAcceptsProblem(t *testing.T) {
+	for acc, out := range map[string]bool{
+		"":                         false,
+		"application/json":         false,
+		"application/problem+json": true,
+		"application/json, APPLICATION/PROBLEM+JSON": true,
+		"application/problem+json; q=0.1":            true,
+		"application/problem+json;q=0":               false,
+		"application/problem+json;q=0.000":           false,
+	} {
+		assert.Equal(t, out, acceptsProblem(acc), acc)
+	}
+}
@@ -37,22 +37,45 @@ func (e *Error) SetCode(err models.PublicError, code int) {
 // In case err does not have a "Public() string" method, it returns an HTTP Internal Server
 // Error code and the JSON "error" field receives a "server_error" value.
 //
+// In case err was caused by a deadline, see models.IsTimeout, it returns by default an HTTP
+// Gateway Timeout code and the JSON "error" field receives a "timeout" value.
+//
 // In case err is a models.ValidationError, it returns by default an HTTP Bad Request doce an error code of "validation_error"
 // is returned, and the specific errors for each field are included as the
 // value of the JSON "fields" field. .
 //
+// The response is written in the error format of the request, see ErrorFormat: the JSON fields
+// described above are the ones of the LegacyErrors format.
+//
 // JSONError always logs the error into c.
 func (e Error) JSON(c *gin.Context, err error) {
+	e.JSONWith(c, err, nil)
+}
+
+// JSONWith returns a JSON document with an error response to a requester, as JSON does, with the
+// fields of extra added to it.
+func (e Error) JSONWith(c *gin.Context, err error, extra gin.H) {
 	// set the defaults we are going to return
 	status := http.StatusInternalServerError
 	data := gin.H{"error": "server_error"}
+	res := errorResponse{code: "server_error", fallback: "internal server error"}
 
-	// if it is a public error, must check if there's a different HTTP code set in the map
-	if pe, ok := err.(models.PublicError); ok {
+	pe, ok := err.(models.PublicError)
+	if models.IsTimeout(err) {
+		// the requests are timed out as a gateway would, whatever error
+		// their deadline caused
+		pe, ok = models.ErrTimeout, true
+		status = http.StatusGatewayTimeout
+	} else if ok {
 		status = http.StatusBadRequest
+	}
+
+	// if it is a public error, must check if there's a different HTTP code set in the map
+	if ok {
 
 		public := pe.Public()
 		data["error"] = public
+		res.code, res.fallback = public, errorMessage(pe)
 
 		if s := e.codes[public]; s != 0 {
 			status = s
@@ -74,8 +97,15 @@ func (e Error) JSON(c *gin.Context, err error) {
 		}
 
 		data["fields"] = vem
+		res.fields = ve
 	}
 
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	res.status, res.legacy = status, data
+
 	c.Error(err)
-	c.AbortWithStatusJSON(status, data)
+	res.abort(c)
 }
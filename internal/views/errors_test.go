@@ -1,6 +1,7 @@
 package views
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -72,6 +73,14 @@ func TestError(t *testing.T) {
 			http.StatusConflict,
 			`{"error":"validation_error", "fields":{"field1":"invalid", "field2":"too_short"}}`,
 		},
+		{
+			"timeout",
+			nil,
+			0,
+			xerrors.Errorf("models: could not list ratings: %w", context.DeadlineExceeded),
+			http.StatusGatewayTimeout,
+			`{"error":"timeout"}`,
+		},
 	}
 
 	for _, cs := range cases {
@@ -0,0 +1,114 @@
+package views
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLanguage is the language of the messages returned to the requests without an
+// Accept-Language header.
+const defaultLanguage = "en"
+
+//go:embed messages/*.json
+var catalogFiles embed.FS
+
+// catalogs are the messages of the error codes, by language. Each catalog is a JSON object in
+// messages/<language>.json, mapping the codes to their messages.
+var catalogs = func() map[string]map[string]string {
+	files, err := catalogFiles.ReadDir("messages")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogs := make(map[string]map[string]string, len(files))
+	for _, f := range files {
+		b, err := catalogFiles.ReadFile(path.Join("messages", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		var messages map[string]string
+		err = json.Unmarshal(b, &messages)
+		if err != nil {
+			panic("views: invalid message catalog " + f.Name() + ": " + err.Error())
+		}
+
+		catalogs[strings.TrimSuffix(f.Name(), ".json")] = messages
+	}
+
+	return catalogs
+}()
+
+// language returns the language of the messages of the errors returned to the request of c: the
+// one of its Accept-Language header with a catalog the client prefers, or English if it doesn't
+// have the header or accepts any language. An empty string is returned if the client only accepts
+// languages without a catalog, so the errors only have their codes.
+func language(c *gin.Context) string {
+	header := c.GetHeader("Accept-Language")
+	if strings.TrimSpace(header) == "" {
+		return defaultLanguage
+	}
+
+	type accepted struct {
+		tag string
+		q   float64
+	}
+
+	var langs []accepted
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		l := accepted{tag: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, err := strconv.ParseFloat(p[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				l.q = q
+			}
+		}
+
+		if l.tag != "" && l.q > 0 {
+			langs = append(langs, l)
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	for _, l := range langs {
+		if l.tag == "*" {
+			return defaultLanguage
+		}
+
+		// the regional variants share the catalog of their language
+		tag := strings.SplitN(l.tag, "-", 2)[0]
+		if catalogs[tag] != nil {
+			return tag
+		}
+	}
+
+	return ""
+}
+
+// message returns the message of the error code in the language lang, or in English if the
+// catalog of lang doesn't have it. fallback is returned if no catalog has it, like the codes of the
+// custom validation rules.
+func message(lang, code, fallback string) string {
+	if m := catalogs[lang][code]; m != "" {
+		return m
+	}
+	if m := catalogs[defaultLanguage][code]; m != "" {
+		return m
+	}
+
+	return fallback
+}
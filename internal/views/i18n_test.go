@@ -0,0 +1,103 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogs(t *testing.T) {
+	assert.Contains(t, catalogs, "en")
+	assert.Contains(t, catalogs, "es")
+
+	for lang, messages := range catalogs {
+		for code := range catalogs[defaultLanguage] {
+			assert.NotEmpty(t, messages[code], "%s must have a message for %s", lang, code)
+		}
+		for code := range messages {
+			assert.Contains(t, catalogs[defaultLanguage], code, "%s has a message for an unknown code", lang)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cases = []struct {
+		header string
+		lang   string
+	}{
+		{"", "en"},
+		{"es", "es"},
+		{"es-ES,es;q=0.9", "es"},
+		{"fr-FR, es;q=0.8, en;q=0.9", "en"},
+		{"fr, es;q=0.5", "es"},
+		{"fr, *;q=0.1", "en"},
+		{"es;q=0, en;q=0.3", "en"},
+		{"fr-CA, de", ""},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.header, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			c.Request.Header.Set("Accept-Language", cs.header)
+
+			assert.Equal(t, cs.lang, language(c))
+		})
+	}
+}
+
+func TestErrorLocalized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var ev Error
+	var cases = []struct {
+		name     string
+		header   string
+		err      error
+		language string
+		outjson  string
+	}{
+		{
+			"spanish",
+			"es-ES",
+			models.ValidationError{"email": models.ErrRequired, "rule": models.ModelError("models: too_rude, custom validation rule failed")},
+			"es",
+			`{
+				"code":"validation_error",
+				"message":"la petición tiene campos inválidos",
+				"fields":{"email":"required","rule":"too_rude"},
+				"fieldMessages":{"email":"el valor no puede estar vacío","rule":"custom validation rule failed"}
+			}`,
+		},
+		{
+			"unknownLocale",
+			"fr",
+			models.ValidationError{"email": models.ErrRequired},
+			"",
+			`{"code":"validation_error","fields":{"email":"required"}}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			c.Request.Header.Set("Accept-Language", cs.header)
+			SetErrorFormat(c, EnvelopeErrors)
+
+			ev.JSON(c, cs.err)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, cs.language, w.Header().Get("Content-Language"))
+			assert.Equal(t, []string{"Accept", "Accept-Language"}, w.Header().Values("Vary"))
+			assert.JSONEq(t, cs.outjson, w.Body.String())
+		})
+	}
+}
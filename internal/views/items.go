@@ -0,0 +1,72 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/xerrors"
+)
+
+// Items returns a JSON document listing items to a requester, as the value of the JSON "items"
+// field, with an HTTP OK code. items must be a slice of values encoded as JSON objects.
+//
+// In case the request has a "fields" query parameter, a comma-separated list of field names, the
+// items only have the fields named, so large lists can be trimmed to what the requester needs.
+// Unknown names are ignored, and the items are returned whole if the list is empty. Nested
+// objects, like the user embedded in a rating, are kept or left out whole.
+//
+// In case items can't be encoded, nothing is written and the error is returned.
+func Items(c *gin.Context, items interface{}) error {
+	fields := queryFields(c)
+	if fields == nil {
+		c.JSON(http.StatusOK, gin.H{"items": items})
+		return nil
+	}
+
+	b, err := json.Marshal(items)
+	if err != nil {
+		return xerrors.Errorf("views: could not encode the items: %w", err)
+	}
+
+	var objects []map[string]json.RawMessage
+	err = json.Unmarshal(b, &objects)
+	if err != nil {
+		return xerrors.Errorf("views: the items are not objects: %w", err)
+	}
+
+	for _, o := range objects {
+		for name := range o {
+			if !fields[name] {
+				delete(o, name)
+			}
+		}
+	}
+
+	if objects == nil {
+		objects = []map[string]json.RawMessage{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": objects})
+	return nil
+}
+
+// queryFields returns the set of the field names in the "fields" query parameter, or nil if it
+// is missing or empty.
+func queryFields(c *gin.Context) map[string]bool {
+	var fields map[string]bool
+	for _, name := range strings.Split(c.Query("fields"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if fields == nil {
+			fields = make(map[string]bool)
+		}
+		fields[name] = true
+	}
+
+	return fields
+}
@@ -0,0 +1,95 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type item struct {
+		ID       int64  `json:"id"`
+		Email    string `json:"email"`
+		Settings string `json:"settings,omitempty"`
+		Nested   *item  `json:"nested,omitempty"`
+	}
+
+	items := []item{
+		{ID: 1, Email: "one@test.com", Settings: "{}", Nested: &item{ID: 3, Email: "three@test.com"}},
+		{ID: 2, Email: "two@test.com"},
+	}
+
+	var cases = []struct {
+		name    string
+		path    string
+		items   interface{}
+		outjson string
+	}{
+		{
+			"allFields",
+			"/items",
+			items,
+			`{"items":[
+				{"id":1,"email":"one@test.com","settings":"{}","nested":{"id":3,"email":"three@test.com"}},
+				{"id":2,"email":"two@test.com"}
+			]}`,
+		},
+		{
+			"emptyFields",
+			"/items?fields=,",
+			items,
+			`{"items":[
+				{"id":1,"email":"one@test.com","settings":"{}","nested":{"id":3,"email":"three@test.com"}},
+				{"id":2,"email":"two@test.com"}
+			]}`,
+		},
+		{
+			"someFields",
+			"/items?fields=id,settings,unknown",
+			items,
+			`{"items":[{"id":1,"settings":"{}"},{"id":2}]}`,
+		},
+		{
+			"nestedWhole",
+			"/items?fields=nested",
+			items,
+			`{"items":[{"nested":{"id":3,"email":"three@test.com"}},{}]}`,
+		},
+		{
+			"noItems",
+			"/items?fields=id",
+			[]item(nil),
+			`{"items":[]}`,
+		},
+	}
+
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", cs.path, nil)
+
+			err := Items(c, cs.items)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, cs.outjson, w.Body.String())
+		})
+	}
+
+	t.Run("notObjects", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/items?fields=id", nil)
+
+		err := Items(c, []int{1, 2})
+
+		assert.Error(t, err)
+		assert.Empty(t, w.Body.String())
+	})
+}
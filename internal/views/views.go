@@ -1,6 +1,6 @@
 /*
-Package views in this project provides a standard way of outputting JSON errors.
-These functions make checks on the error messages passed and decide how they
-should be returned to the API caller.
+Package views in this project provides a standard way of outputting JSON errors
+and lists. These functions make checks on the error messages passed and decide
+how they should be returned to the API caller.
 */
 package views
@@ -0,0 +1,26 @@
+// Package web holds the frontend of the application, embedded in the binary and
+// served by the Static controller when RATINGSAPP_SERVE_STATIC is "true".
+//
+// The frontend is a single page application, built into the dist directory: its
+// index.html page, and its assets in dist/assets, whose names must change with
+// their contents, like app.3f9a1c.js, as they are cached for good.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed dist
+var dist embed.FS
+
+// Files returns the files of the frontend, index.html at its root.
+func Files() fs.FS {
+	files, err := fs.Sub(dist, "dist")
+	if err != nil {
+		// dist is embedded, so it always exists
+		panic(err)
+	}
+
+	return files
+}
@@ -0,0 +1,268 @@
+// Package client is a Go client of the REST API of the ratings service, for the
+// services calling it.
+//
+// A Client logs in once, with Login, and then refreshes its access token on its
+// own, before it expires or when the service rejects it, for as long as its
+// refresh token is valid:
+//
+//	c := client.New("https://ratings.example.com")
+//	_, err := c.Login(ctx, "rick@sanchez.com", "OhGeezMorty1234")
+//	...
+//	ratings, err := c.ListRatingsByTarget(ctx, 999, client.Page{Limit: 50})
+//
+// The errors of the service are returned as the errors of this package their
+// code stands for, like ErrNotFound or a ValidationError, so they are checked as
+// the service itself checks them. The others are returned as an *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshMargin is how long before its expiry the access token is refreshed, so
+// it does not expire on its way to the service.
+const refreshMargin = 30 * time.Second
+
+// Client calls the REST API of the ratings service. It is safe for concurrent
+// use.
+type Client struct {
+	baseURL string
+	hc      *http.Client
+
+	// mu guards the tokens, and is held while refreshing them so a refresh
+	// token, which sessions only accept once, is only used once.
+	mu      sync.Mutex
+	token   Token
+	expires time.Time
+	now     func() time.Time
+}
+
+// New creates a new Client of the service at baseURL, like
+// "https://ratings.example.com", using http.DefaultClient.
+func New(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		hc:      http.DefaultClient,
+		now:     time.Now,
+	}
+}
+
+// WithHTTPClient sets the HTTP client the requests are sent with, and returns c.
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	c.hc = hc
+	return c
+}
+
+// Login authenticates a user with their email address and password, and
+// returns their tokens, which the following requests are sent with.
+func (c *Client) Login(ctx context.Context, email, password string) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.grant(ctx, url.Values{
+		"grant_type": {"password"},
+		"email":      {email},
+		"password":   {password},
+	})
+}
+
+// Refresh exchanges the refresh token of c for new tokens, and returns them.
+// Requests refresh the tokens on their own, so it is only needed to refresh
+// them ahead of time. ErrUnauthorised is returned if c has no refresh
+// token.
+func (c *Client) Refresh(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refresh(ctx)
+}
+
+// refresh exchanges the refresh token for new tokens. c.mu must be held.
+func (c *Client) refresh(ctx context.Context) (Token, error) {
+	if c.token.RefreshToken == "" {
+		return Token{}, ErrUnauthorised
+	}
+
+	return c.grant(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {c.token.RefreshToken},
+	})
+}
+
+// grant requests tokens from the token endpoint with form, and keeps them. c.mu
+// must be held.
+func (c *Client) grant(ctx context.Context, form url.Values) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/oauth/token/",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tok Token
+	_, err = c.send(req, &tok)
+	if err != nil {
+		return Token{}, err
+	}
+
+	c.token = tok
+	c.expires = c.now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return tok, nil
+}
+
+// accessToken returns the access token, refreshed first if it expires soon or
+// if it is rejected, the token the service rejected, unless the tokens were
+// refreshed since. c.mu must not be held.
+func (c *Client) accessToken(ctx context.Context, rejected string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.AccessToken == "" {
+		return "", ErrUnauthorised
+	}
+
+	if c.token.AccessToken == rejected || (c.token.RefreshToken != "" && c.now().Add(refreshMargin).After(c.expires)) {
+		_, err := c.refresh(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return c.token.AccessToken, nil
+}
+
+// Page selects a page of a list. The ratings are paged by ID: the next page
+// starts after the ID of the last rating of the previous page, and the last
+// page has less than Limit ratings.
+type Page struct {
+	// Limit is the maximum number of ratings of the page, or zero for all
+	// of them.
+	Limit int
+
+	// After is the ID of the last rating of the previous page, or zero for
+	// the first page.
+	After int64
+}
+
+// ListRatingsByTarget returns a page of the ratings of a target, sorted by ID.
+func (c *Client) ListRatingsByTarget(ctx context.Context, target int64, p Page) ([]Rating, error) {
+	q := url.Values{"target": {strconv.FormatInt(target, 10)}}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.After > 0 {
+		q.Set("after", strconv.FormatInt(p.After, 10))
+	}
+
+	var res struct {
+		Items []Rating `json:"items"`
+	}
+	_, err := c.do(ctx, http.MethodGet, "/api/v1/ratings/?"+q.Encode(), nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Items, nil
+}
+
+// CreateRating creates r, and sets its fields to the ones of the rating
+// created. If the service queues the ratings created, r is left as it is and
+// the receipt of the queued creation is returned instead.
+func (c *Client) CreateRating(ctx context.Context, r *Rating) (*QueueReceipt, error) {
+	var res json.RawMessage
+	status, err := c.do(ctx, http.MethodPost, "/api/v1/ratings/", r, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == http.StatusAccepted {
+		var receipt QueueReceipt
+		return &receipt, json.Unmarshal(res, &receipt)
+	}
+
+	return nil, json.Unmarshal(res, r)
+}
+
+// do sends an authenticated request with the JSON of in as body, if not nil,
+// and decodes the response into out. A request rejected as unauthorised is
+// sent again once, with refreshed tokens. It returns the status of the
+// response.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var rejected string
+	for {
+		tok, err := c.accessToken(ctx, rejected)
+		if err != nil {
+			return 0, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+		req.Header.Set("Accept", "application/json")
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		status, err := c.send(req, out)
+		if err == ErrUnauthorised && rejected == "" && c.refreshable() {
+			rejected = tok
+			continue
+		}
+
+		return status, err
+	}
+}
+
+// refreshable reports whether c has a refresh token.
+func (c *Client) refreshable() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token.RefreshToken != ""
+}
+
+// send sends req, and decodes the body of a successful response into out, or
+// returns the error of the response.
+func (c *Client) send(req *http.Request, out interface{}) (int, error) {
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, err
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return res.StatusCode, responseError(res.StatusCode, body)
+	}
+
+	if out != nil && len(body) > 0 {
+		err = json.Unmarshal(body, out)
+	}
+
+	return res.StatusCode, err
+}
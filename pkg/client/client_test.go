@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/noelruault/ratingsapp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		issued  int
+		access  string
+		grants  []string
+		handler http.HandlerFunc
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/oauth/token/" {
+			require.NoError(t, r.ParseForm())
+			grants = append(grants, r.PostForm.Get("grant_type"))
+			if r.PostForm.Get("grant_type") == "password" && r.PostForm.Get("password") != "OhGeezMorty1234" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client"}`))
+				return
+			}
+
+			issued++
+			access = "access" + string(rune('0'+issued))
+			json.NewEncoder(w).Encode(Token{AccessToken: access, RefreshToken: "refresh", ExpiresIn: 3600, TokenType: "bearer"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+access {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorised"}`))
+			return
+		}
+
+		handler(w, r)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	c := New(srv.URL + "/")
+	c.now = func() time.Time { return now }
+
+	t.Run("notLoggedIn", func(t *testing.T) {
+		_, err := c.ListRatingsByTarget(ctx, 999, Page{})
+		assert.Equal(t, ErrUnauthorised, err)
+	})
+
+	t.Run("badLogin", func(t *testing.T) {
+		_, err := c.Login(ctx, "rick@sanchez.com", "wrong")
+		assert.Equal(t, ErrUnauthorised, err)
+	})
+
+	t.Run("login", func(t *testing.T) {
+		tok, err := c.Login(ctx, "rick@sanchez.com", "OhGeezMorty1234")
+		require.NoError(t, err)
+		assert.Equal(t, "access1", tok.AccessToken)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "GET", r.Method)
+			assert.Equal(t, "/api/v1/ratings/", r.URL.Path)
+			assert.Equal(t, "after=88&limit=2&target=999", r.URL.RawQuery)
+			w.Write([]byte(`{"items":[{"id":89,"score":4,"target":999},{"id":90,"score":5,"target":999}]}`))
+		}
+
+		ratings, err := c.ListRatingsByTarget(ctx, 999, Page{Limit: 2, After: 88})
+		require.NoError(t, err)
+		assert.Equal(t, []Rating{{ID: 89, Score: 4, Target: 999}, {ID: 90, Score: 5, Target: 999}}, ratings)
+	})
+
+	t.Run("refreshExpiring", func(t *testing.T) {
+		now = now.Add(time.Hour - 10*time.Second)
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"items":[]}`))
+		}
+
+		_, err := c.ListRatingsByTarget(ctx, 999, Page{})
+		require.NoError(t, err)
+		assert.Equal(t, "access2", access)
+		assert.Equal(t, []string{"password", "password", "refresh_token"}, grants)
+	})
+
+	t.Run("refreshRejected", func(t *testing.T) {
+		access = "revoked"
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":91,"score":3,"target":999,"userId":4}`))
+		}
+
+		r := Rating{Score: 3, Target: 999}
+		receipt, err := c.CreateRating(ctx, &r)
+		require.NoError(t, err)
+		assert.Nil(t, receipt)
+		assert.Equal(t, Rating{ID: 91, Score: 3, Target: 999, UserID: 4}, r)
+		assert.Equal(t, "access3", access)
+	})
+
+	t.Run("queued", func(t *testing.T) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"key":"8f14e45f","status":"pending"}`))
+		}
+
+		r := Rating{Score: 3, Target: 999}
+		receipt, err := c.CreateRating(ctx, &r)
+		require.NoError(t, err)
+		assert.Equal(t, &QueueReceipt{Key: "8f14e45f", Status: QueuePending}, receipt)
+		assert.Zero(t, r.ID)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var cases = []struct {
+			name   string
+			status int
+			body   string
+			outErr error
+		}{
+			{"model", http.StatusNotFound, `{"error":"not_found"}`, ErrNotFound},
+			{"validation", http.StatusBadRequest, `{"error":"validation_error","fields":{"score":"required","after":"invalid_parse"}}`,
+				ValidationError{"score": ErrRequired, "after": &Error{StatusCode: http.StatusBadRequest, Code: "invalid_parse"}}},
+			{"envelope", http.StatusConflict, `{"code":"conflict","message":"resource was modified since the version provided"}`, ErrConflict},
+			{"oauthDescription", http.StatusBadRequest, `{"error":"invalid_request","error_description":"credentials_not_provided"}`, ErrNoCredentials},
+			{"other", http.StatusForbidden, `{"error":"forbidden"}`, &Error{StatusCode: http.StatusForbidden, Code: "forbidden"}},
+			{"notJSON", http.StatusBadGateway, `Bad Gateway`, &Error{StatusCode: http.StatusBadGateway}},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				handler = func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tc.status)
+					w.Write([]byte(tc.body))
+				}
+
+				_, err := c.CreateRating(ctx, &Rating{})
+				assert.Equal(t, tc.outErr, err)
+			})
+		}
+	})
+}
+
+func TestError(t *testing.T) {
+	assert.Equal(t, "client: forbidden, the service responded with status 403", (&Error{StatusCode: 403, Code: "forbidden"}).Error())
+	assert.Equal(t, "client: the service responded with status 502", (&Error{StatusCode: 502}).Error())
+}
+
+func TestCodeErrors(t *testing.T) {
+	// the codes of the service, so the ones added are given an error
+	for _, err := range []models.ModelError{
+		models.ErrNotFound, models.ErrReadOnly, models.ErrFieldReadOnly, models.ErrInUse,
+		models.ErrUnauthorised, models.ErrConflict, models.ErrIDTaken, models.ErrTooShort,
+		models.ErrTooLong, models.ErrRequired, models.ErrInvalid, models.ErrDuplicate,
+		models.ErrRefNotFound, models.ErrNoCredentials, models.ErrRefreshInvalid,
+		models.ErrRefreshExpired, models.ErrSessionsDisabled, models.ErrUnknownClient,
+		models.ErrInvalidGrant, models.ErrInvalidInvitation, models.ErrCannotImpersonate,
+		models.ErrPasswordIncorrect, models.ErrOwnRating, models.ErrCampaignClosed,
+		models.ErrNotEligible, models.ErrRatingClosed, models.ErrRateLimited,
+		models.ErrPolicyDenied, models.ErrTenantStatus, models.ErrTenantUnavailable,
+		models.ErrQuotaExceeded, models.ErrBillingDisabled, models.ErrTimeout,
+	} {
+		ce, ok := codeErrors[err.Public()]
+		if assert.True(t, ok, err.Public()) {
+			assert.Equal(t, err.Public(), ce.Public())
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// These errors are returned for the error codes of the service, so they can be
+// checked as the service itself checks them. The other codes are returned as an
+// *Error.
+const (
+	ErrNotFound      CodeError = "client: not_found, resource not found"
+	ErrReadOnly      CodeError = "client: read_only, resource cannot be modified or deleted"
+	ErrFieldReadOnly CodeError = "client: field_read_only, field cannot be modified"
+	ErrInUse         CodeError = "client: in_use, resource cannot be deleted because other resources depend on it"
+	ErrUnauthorised  CodeError = "client: unauthorised, the credentials or the tokens are invalid"
+	ErrConflict      CodeError = "client: conflict, resource was modified since the version provided"
+
+	ErrIDTaken     CodeError = "client: id_taken, primary key already exists"
+	ErrTooShort    CodeError = "client: too_short, value is shorter than required"
+	ErrTooLong     CodeError = "client: too_long, value is longer than required"
+	ErrRequired    CodeError = "client: required, value cannot be empty"
+	ErrInvalid     CodeError = "client: invalid, value does not match its specification"
+	ErrDuplicate   CodeError = "client: is_duplicate, value already exists and cannot be a duplicate"
+	ErrRefNotFound CodeError = "client: reference_not_found, referenced resource not found"
+
+	ErrNoCredentials    CodeError = "client: credentials_not_provided, username, password or refresh token are empty"
+	ErrRefreshInvalid   CodeError = "client: invalid_refresh_token, refresh token is not valid"
+	ErrRefreshExpired   CodeError = "client: expired_refresh_token, refresh token has expired"
+	ErrSessionsDisabled CodeError = "client: sessions_disabled, sessions are not tracked"
+
+	ErrUnknownClient     CodeError = "client: unknown_client, the client is not allowed to use the redirect URI"
+	ErrInvalidGrant      CodeError = "client: invalid_grant, the authorization code is invalid, expired or was issued to another client"
+	ErrInvalidInvitation CodeError = "client: invalid_invitation, the invitation is invalid, expired, was accepted or was revoked"
+	ErrCannotImpersonate CodeError = "client: cannot_impersonate, the user cannot be impersonated"
+
+	ErrPasswordIncorrect CodeError = "client: incorrect_password, incorrect password provided"
+	ErrOwnRating         CodeError = "client: own_rating, users cannot react to their own ratings"
+	ErrCampaignClosed    CodeError = "client: campaign_closed, the campaign does not accept ratings at this time"
+	ErrNotEligible       CodeError = "client: not_eligible, the role of the user cannot take part in the campaign"
+	ErrRatingClosed      CodeError = "client: rating_closed, the target does not accept ratings at this time"
+	ErrRateLimited       CodeError = "client: rate_limited, the user created too many ratings recently"
+	ErrPolicyDenied      CodeError = "client: policy_denied, a policy does not allow the operation"
+
+	ErrTenantStatus      CodeError = "client: invalid_tenant_status, the tenant cannot be changed in its current status"
+	ErrTenantUnavailable CodeError = "client: tenant_unavailable, the tenant is not active"
+	ErrQuotaExceeded     CodeError = "client: quota_exceeded, the tenant used all the resources it is allowed"
+	ErrBillingDisabled   CodeError = "client: billing_disabled, no billing provider is configured"
+
+	ErrTimeout CodeError = "client: timeout, the request took too long to complete"
+)
+
+// codeErrors are the errors returned for their codes.
+var codeErrors = map[string]CodeError{}
+
+func init() {
+	for _, err := range []CodeError{
+		ErrNotFound, ErrReadOnly, ErrFieldReadOnly, ErrInUse, ErrUnauthorised, ErrConflict,
+		ErrIDTaken, ErrTooShort, ErrTooLong, ErrRequired, ErrInvalid, ErrDuplicate,
+		ErrRefNotFound, ErrNoCredentials, ErrRefreshInvalid, ErrRefreshExpired,
+		ErrSessionsDisabled, ErrUnknownClient, ErrInvalidGrant, ErrInvalidInvitation,
+		ErrCannotImpersonate, ErrPasswordIncorrect, ErrOwnRating, ErrCampaignClosed,
+		ErrNotEligible, ErrRatingClosed, ErrRateLimited, ErrPolicyDenied, ErrTenantStatus,
+		ErrTenantUnavailable, ErrQuotaExceeded, ErrBillingDisabled, ErrTimeout,
+	} {
+		codeErrors[err.Public()] = err
+	}
+
+	// the token endpoint answers the invalid credentials as OAuth does
+	codeErrors["invalid_client"] = ErrUnauthorised
+}
+
+// CodeError is an error of the service with a known code, like ErrNotFound.
+type CodeError string
+
+// Error returns the message of e.
+func (e CodeError) Error() string {
+	return string(e)
+}
+
+// Public returns the code of e, the string between the package prefix and the
+// first comma of its message.
+func (e CodeError) Public() string {
+	s := string(e)[len("client: "):]
+	for i := 1; i < len(s); i++ {
+		if s[i] == ',' {
+			return s[:i]
+		}
+	}
+
+	return s
+}
+
+// ValidationError is returned for the requests with invalid fields, with the
+// error of each field: a CodeError, like ErrRequired, or an *Error.
+type ValidationError map[string]error
+
+// Error returns the list of the fields with errors.
+func (v ValidationError) Error() string {
+	ret := "client: validation error on fields "
+	for k := range v {
+		ret += k + ", "
+	}
+
+	return ret[:len(ret)-2]
+}
+
+// Public returns the code of the validation errors, "validation_error".
+func (v ValidationError) Public() string {
+	return "validation_error"
+}
+
+// Is reports whether err is a ValidationError whose fields all have the same
+// error in v, so errors.Is can check for the errors of some of the fields.
+func (v ValidationError) Is(err error) bool {
+	ve, ok := err.(ValidationError)
+	if !ok {
+		return false
+	}
+
+	for k := range ve {
+		if v[k] != ve[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Error is an error returned by the service whose code has no CodeError, like
+// "forbidden" or "server_error".
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Code is the code of the error, or empty if the response had none.
+	Code string
+}
+
+// Error returns the code and the status code of e.
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return "client: the service responded with status " + strconv.Itoa(e.StatusCode)
+	}
+
+	return "client: " + e.Code + ", the service responded with status " + strconv.Itoa(e.StatusCode)
+}
+
+// Public returns the code of e, so it is reported as the service reported it.
+func (e *Error) Public() string {
+	return e.Code
+}
+
+// responseError returns the error of a response with status and body, in any of
+// the error formats of the service: the code is read from the envelope if the
+// response has one, and from the legacy fields otherwise.
+func responseError(status int, body []byte) error {
+	var res struct {
+		Code        string            `json:"code"`
+		Error       string            `json:"error"`
+		Description string            `json:"error_description"`
+		Fields      map[string]string `json:"fields"`
+	}
+	if json.Unmarshal(body, &res) != nil {
+		return &Error{StatusCode: status}
+	}
+
+	code := res.Code
+	if code == "" {
+		// the token endpoint describes its invalid requests with the code
+		// of their error
+		code = res.Error
+		if res.Error == "invalid_request" && res.Description != "" {
+			code = res.Description
+		}
+	}
+
+	if code == "validation_error" {
+		ve := make(ValidationError, len(res.Fields))
+		for field, fc := range res.Fields {
+			ve[field] = codeError(status, fc)
+		}
+
+		return ve
+	}
+
+	return codeError(status, code)
+}
+
+// codeError returns the CodeError with code, or an *Error if there is none.
+func codeError(status int, code string) error {
+	if err, ok := codeErrors[code]; ok {
+		return err
+	}
+
+	return &Error{StatusCode: status, Code: code}
+}
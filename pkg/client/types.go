@@ -0,0 +1,74 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Token holds the tokens issued by the token endpoint.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+
+	// ExpiresIn is the number of seconds the access token is valid for.
+	ExpiresIn int    `json:"expires_in"`
+	TokenType string `json:"token_type"`
+}
+
+// Rating is a rating of a target, as the service represents it. The fields
+// other than Score, Target, Comment, Anonymous, Extra and CampaignID are set by
+// the service, and ignored when the rating is sent to it.
+type Rating struct {
+	ID         int64           `json:"id"`
+	Active     bool            `json:"active"`
+	Anonymous  bool            `json:"anonymous"`
+	Comment    string          `json:"comment,omitempty"`
+	Date       int64           `json:"date"`
+	Extra      json.RawMessage `json:"extra"`
+	Score      int             `json:"score"`
+	Target     int64           `json:"target"`
+	UserID     int64           `json:"userId"`
+	CampaignID *int64          `json:"campaignId,omitempty"`
+	OrgID      *int64          `json:"orgId,omitempty"`
+	Verified   bool            `json:"verified,omitempty"`
+
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment describes a file attached to a rating.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	RatingID    int64     `json:"ratingId"`
+	UserID      int64     `json:"userId"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// The statuses of a QueueReceipt.
+const (
+	QueuePending = "pending"
+	QueueCreated = "created"
+	QueueFailed  = "failed"
+)
+
+// QueueReceipt is the receipt of the creation of a rating the service queued,
+// to be created later.
+type QueueReceipt struct {
+	Key string `json:"key"`
+
+	// Status is one of QueuePending, QueueCreated or QueueFailed.
+	Status string `json:"status"`
+
+	// RatingID is the ID of the rating created, once it is.
+	RatingID int64 `json:"ratingId,omitempty"`
+
+	// Error and Fields describe why the rating could not be created, with
+	// the codes of the errors the creation returns.
+	Error  string          `json:"error,omitempty"`
+	Fields json.RawMessage `json:"fields,omitempty"`
+}
@@ -0,0 +1,176 @@
+// Package rules defines the custom validation rules of the deployments of the
+// ratings service, which enforce their own business rules on the users, roles
+// and ratings without changing the service.
+//
+// It is the API of the validation plugins, so it only depends on the standard
+// library: the plugins import it instead of the internal packages of the
+// service. The rules check copies of the values, described by the User, Role
+// and Rating types.
+package rules
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Rules holds the custom validation rules of a deployment. They run once the
+// built-in validations passed, when a value is created or updated, and before
+// it is stored. Partial updates are checked as patched. A value created has a
+// zero ID.
+//
+// A rule checks a field, like "comment", or the whole value if its field is
+// empty. Field rules all run, and their errors are returned together as a
+// validation error, while the other rules only run if no field failed, and
+// their errors are returned as they are. Rules must return an Error, or
+// FieldErrors: any other error fails the request as an internal error.
+//
+// The rules of the zero value are empty. They must be added before the service
+// starts, and are then safe for concurrent use.
+type Rules struct {
+	users   []UserRule
+	roles   []RoleRule
+	ratings []RatingRule
+}
+
+// Default are the rules used by the service when no others are set. Packages
+// can add their rules to Default in their init functions, so importing them is
+// enough to compile the rules in.
+var Default = &Rules{}
+
+// A UserRule checks the users on Field, or as a whole if empty.
+type UserRule struct {
+	Field string
+	Check func(u *User) error
+}
+
+// A RoleRule checks the roles on Field, or as a whole if empty.
+type RoleRule struct {
+	Field string
+	Check func(r *Role) error
+}
+
+// A RatingRule checks the ratings on Field, or as a whole if empty.
+type RatingRule struct {
+	Field string
+	Check func(r *Rating) error
+}
+
+// AddUser adds a rule on the users, checking the given field.
+func (r *Rules) AddUser(field string, check func(u *User) error) {
+	r.users = append(r.users, UserRule{Field: field, Check: check})
+}
+
+// AddRole adds a rule on the roles, checking the given field.
+func (r *Rules) AddRole(field string, check func(r *Role) error) {
+	r.roles = append(r.roles, RoleRule{Field: field, Check: check})
+}
+
+// AddRating adds a rule on the ratings, checking the given field.
+func (r *Rules) AddRating(field string, check func(r *Rating) error) {
+	r.ratings = append(r.ratings, RatingRule{Field: field, Check: check})
+}
+
+// Copy returns a copy of r, so rules can be added to it without changing r.
+func (r *Rules) Copy() *Rules {
+	if r == nil {
+		return &Rules{}
+	}
+
+	return &Rules{
+		users:   append([]UserRule(nil), r.users...),
+		roles:   append([]RoleRule(nil), r.roles...),
+		ratings: append([]RatingRule(nil), r.ratings...),
+	}
+}
+
+// Users returns the rules on the users, in the order they were added. It is
+// safe to call on a nil r.
+func (r *Rules) Users() []UserRule {
+	if r == nil {
+		return nil
+	}
+
+	return r.users
+}
+
+// Roles returns the rules on the roles, as Users.
+func (r *Rules) Roles() []RoleRule {
+	if r == nil {
+		return nil
+	}
+
+	return r.roles
+}
+
+// Ratings returns the rules on the ratings, as Users.
+func (r *Rules) Ratings() []RatingRule {
+	if r == nil {
+		return nil
+	}
+
+	return r.ratings
+}
+
+// User is a user checked by the rules. Its password is left out.
+type User struct {
+	ID        int64
+	Active    bool
+	Email     string
+	FirstName string
+	LastName  string
+	RoleID    int64
+
+	// Settings is the JSON object of the settings of the user.
+	Settings string
+}
+
+// Role is a role checked by the rules. Its permissions are named as in the
+// API, like "writeRatings".
+type Role struct {
+	ID          int64
+	Label       string
+	Permissions []string
+}
+
+// Rating is a rating checked by the rules. Its UserID is the ID of the user
+// creating or updating it.
+type Rating struct {
+	ID         int64
+	Active     bool
+	Anonymous  bool
+	Comment    string
+	Date       int64
+	Extra      json.RawMessage
+	Score      int
+	Target     int64
+	UserID     int64
+	CampaignID *int64
+}
+
+// Error is an error returned by the rules, holding the code presented to the
+// API users, like "vip_only".
+type Error string
+
+// Errors of the rules sharing the codes of the built-in validations.
+const (
+	ErrRequired Error = "required"
+	ErrInvalid  Error = "invalid"
+	ErrTooLong  Error = "too_long"
+	ErrReadOnly Error = "read_only"
+)
+
+func (e Error) Error() string {
+	return "rules: " + string(e) + ", custom validation rule failed"
+}
+
+// FieldErrors holds the errors found by a rule on several fields, by field.
+type FieldErrors map[string]Error
+
+func (fe FieldErrors) Error() string {
+	ret := "rules: validation error on fields "
+	for k := range fe {
+		ret += k + ", "
+	}
+
+	return strings.TrimSuffix(ret, ", ")
+}
@@ -0,0 +1,33 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	r := &Rules{}
+	r.AddUser("email", func(u *User) error { return ErrInvalid })
+	r.AddRole("", func(r *Role) error { return nil })
+
+	c := r.Copy()
+	c.AddRating("comment", func(r *Rating) error { return Error("comment_required") })
+
+	assert.Len(t, c.Ratings(), 1)
+	assert.Empty(t, r.Ratings(), "must not change the rules copied")
+	assert.Len(t, c.Users(), 1)
+	assert.Equal(t, "email", c.Users()[0].Field)
+	assert.Len(t, c.Roles(), 1)
+
+	var none *Rules
+	assert.Empty(t, none.Users())
+	assert.Empty(t, none.Roles())
+	assert.Empty(t, none.Ratings())
+	assert.NotNil(t, none.Copy())
+}
+
+func TestErrors(t *testing.T) {
+	assert.Equal(t, "rules: comment_required, custom validation rule failed", Error("comment_required").Error())
+	assert.Equal(t, "rules: validation error on fields score", FieldErrors{"score": ErrRequired}.Error())
+}
@@ -0,0 +1,12 @@
+//go:build tools
+
+// Package tools pins the versions of the tools run by go generate, so they are
+// vendored along with the dependencies of the application.
+package tools
+
+import (
+	// gqlgen generates the executable GraphQL schema, see package graph.
+	_ "github.com/99designs/gqlgen"
+	// moq generates the fakes of the services, see package modelstest.
+	_ "github.com/matryer/moq"
+)